@@ -0,0 +1,180 @@
+package torus
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// Volumes can be restricted to a set of client identities. An identity is
+// either the common name of a certificate, written "cn:NAME", or a token,
+// written "token:" followed by the hex SHA-256 of the token so that the
+// token itself is never stored. A volume without an ACL is open to everyone.
+
+// Permission is what an identity may do with a volume. Each permission
+// implies the ones before it.
+type Permission int
+
+const (
+	PermNone Permission = iota
+	PermRead
+	PermWrite
+	PermAdmin
+)
+
+// ClusterACL is the pseudo-volume whose ACL applies to every volume that has
+// an ACL of its own, such as for the identities of storage nodes.
+const ClusterACL VolumeID = 0
+
+func (p Permission) String() string {
+	switch p {
+	case PermNone:
+		return "none"
+	case PermRead:
+		return "read"
+	case PermWrite:
+		return "write"
+	case PermAdmin:
+		return "admin"
+	}
+	return fmt.Sprintf("Permission(%d)", int(p))
+}
+
+func ParsePermission(s string) (Permission, error) {
+	switch s {
+	case "read":
+		return PermRead, nil
+	case "write":
+		return PermWrite, nil
+	case "admin":
+		return PermAdmin, nil
+	}
+	return PermNone, fmt.Errorf("torus: unknown permission %q, expected read, write or admin", s)
+}
+
+func (p Permission) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Permission) UnmarshalText(b []byte) error {
+	v, err := ParsePermission(string(b))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// ACL maps identities to their permission on a volume.
+type ACL map[string]Permission
+
+// ACLMetadataService is implemented by metadata services that can store the
+// ACLs of volumes.
+type ACLMetadataService interface {
+	// GetACL returns the ACL of the volume, which is empty if it has none.
+	GetACL(vid VolumeID) (ACL, error)
+	// ModifyACL atomically applies f to the ACL of the volume, which is
+	// nil if it has none, and stores the result. f may be called more
+	// than once.
+	ModifyACL(vid VolumeID, f func(ACL) (ACL, error)) error
+}
+
+// CertIdentity returns the identity of a client presenting cert.
+func CertIdentity(cert *x509.Certificate) string {
+	return "cn:" + cert.Subject.CommonName
+}
+
+// TokenIdentity returns the identity of a client presenting token.
+func TokenIdentity(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:])
+}
+
+// WithIdentity returns a context carrying the identity of the client a
+// request came from.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, CtxIdentity, identity)
+}
+
+// Identity returns the identity of the client a request came from, and
+// whether it came from one at all; requests made within the process carry
+// none.
+func Identity(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(CtxIdentity).(string)
+	return id, ok
+}
+
+// Allows returns whether identity may do want with a volume that has acl,
+// given the cluster ACL.
+func Allows(acl, cluster ACL, identity string, want Permission) bool {
+	if len(acl) == 0 {
+		return true
+	}
+	return acl[identity] >= want || cluster[identity] >= want
+}
+
+// CheckAccess returns ErrPermissionDenied if identity may not do want with
+// the volume.
+func CheckAccess(mds MetadataService, vid VolumeID, identity string, want Permission) error {
+	amds, ok := mds.(ACLMetadataService)
+	if !ok {
+		return nil
+	}
+	acl, err := amds.GetACL(vid)
+	if err != nil {
+		return err
+	}
+	if len(acl) == 0 {
+		return nil
+	}
+	cluster, err := amds.GetACL(ClusterACL)
+	if err != nil {
+		return err
+	}
+	if !Allows(acl, cluster, identity, want) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// SetPermission sets the permission of who on the volume, or removes it for
+// PermNone, on behalf of identity. Once a volume has an ACL, only its admins
+// may change it. The first grant on a volume is open to anyone, and makes
+// identity an admin as well so that they don't lock themselves out.
+func SetPermission(mds MetadataService, identity string, vid VolumeID, who string, p Permission) error {
+	amds, ok := mds.(ACLMetadataService)
+	if !ok {
+		return ErrNotSupported
+	}
+	var cluster ACL
+	if vid != ClusterACL {
+		var err error
+		cluster, err = amds.GetACL(ClusterACL)
+		if err != nil {
+			return err
+		}
+	}
+	return amds.ModifyACL(vid, func(acl ACL) (ACL, error) {
+		if !Allows(acl, cluster, identity, PermAdmin) {
+			return nil, ErrPermissionDenied
+		}
+		if len(acl) == 0 {
+			if p == PermNone {
+				return acl, nil
+			}
+			acl = make(ACL)
+			if identity != "" {
+				acl[identity] = PermAdmin
+			}
+		}
+		if p == PermNone {
+			delete(acl, who)
+		} else {
+			acl[who] = p
+		}
+		return acl, nil
+	})
+}
@@ -0,0 +1,76 @@
+package block
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+var (
+	// attachRenewInterval is how often an attachment is renewed.
+	attachRenewInterval = 5 * time.Second
+	// ForceAttachWait is how long ForceOpenBlockFile waits for the holder
+	// of an attachment to renew it before taking it over. It's a few
+	// renewals, so that a holder that's only slow isn't taken over.
+	ForceAttachWait = 3 * attachRenewInterval
+)
+
+// lock attaches the volume, taking the attachment over from a holder that's
+// stopped renewing it if force is set. A takeover only returns once every
+// peer has had time to look up the new epoch, so that none of them takes
+// another write from the old holder.
+func (s *BlockVolume) lock(force bool) (uint64, error) {
+	if !force {
+		return s.mds.Lock(s.srv.Lease())
+	}
+	lmds, ok := s.mds.(leasedBlockMetadata)
+	if !ok {
+		return 0, torus.ErrNotSupported
+	}
+	epoch, err := lmds.ForceLock(s.srv.Lease(), ForceAttachWait)
+	if err != nil {
+		return 0, err
+	}
+	time.Sleep(torus.FenceLookupInterval)
+	return epoch, nil
+}
+
+// startRenew renews the attachment until the file is closed. If it's been
+// taken over, the file stops taking writes, which peers would fence off
+// anyway.
+func (f *BlockFile) startRenew() {
+	lmds, ok := f.vol.mds.(leasedBlockMetadata)
+	if !ok {
+		return
+	}
+	f.stopRenewCh = make(chan struct{})
+	f.renewDone = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(attachRenewInterval):
+			}
+			err := lmds.RenewLock()
+			if err == torus.ErrLocked {
+				clog.Errorf("the attachment of %s was taken over by another client; no longer writing to it", f.vol.volume.Name)
+				f.File.Revoke()
+				return
+			}
+			if err != nil {
+				clog.Warningf("couldn't renew the attachment of %s: %v", f.vol.volume.Name, err)
+			}
+		}
+	}(f.stopRenewCh, f.renewDone)
+}
+
+func (f *BlockFile) stopRenew() {
+	if f.stopRenewCh == nil {
+		return
+	}
+	close(f.stopRenewCh)
+	<-f.renewDone
+	f.stopRenewCh = nil
+}
@@ -1,6 +1,9 @@
 package block
 
 import (
+	"sync"
+	"time"
+
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/blockset"
 	"golang.org/x/net/context"
@@ -9,13 +12,43 @@ import (
 type BlockFile struct {
 	*torus.File
 	vol *BlockVolume
+
+	syncMut    sync.Mutex
+	syncPolicy torus.INodeSyncPolicy
+	// writes is the number of writes since the last sync.
+	writes   int
+	lastSync time.Time
+	stopSync chan struct{}
+
+	stopDedupCh chan struct{}
+	dedupDone   chan struct{}
+
+	stopRenewCh chan struct{}
+	renewDone   chan struct{}
+}
+
+func (s *BlockVolume) OpenBlockFile() (*BlockFile, error) {
+	return s.openBlockFile(false)
 }
 
-func (s *BlockVolume) OpenBlockFile() (file *BlockFile, err error) {
+// ForceOpenBlockFile attaches the volume like OpenBlockFile, but if it's
+// attached elsewhere and the holder doesn't renew its attachment within
+// ForceAttachWait, takes the attachment over. The old holder's writes are
+// fenced off from then on.
+func (s *BlockVolume) ForceOpenBlockFile() (*BlockFile, error) {
+	return s.openBlockFile(true)
+}
+
+func (s *BlockVolume) openBlockFile(force bool) (file *BlockFile, err error) {
 	if s.volume.Type != VolumeType {
 		panic("Wrong type")
 	}
-	if err = s.mds.Lock(s.srv.Lease()); err != nil {
+	err = s.checkAccess(torus.PermWrite)
+	if err != nil {
+		return nil, err
+	}
+	epoch, err := s.lock(force)
+	if err != nil {
 		return nil, err
 	}
 	defer func() {
@@ -37,33 +70,42 @@ func (s *BlockVolume) OpenBlockFile() (file *BlockFile, err error) {
 	if err != nil {
 		return nil, err
 	}
+	bs = s.withDedup(bs)
 	f, err := s.srv.CreateFile(s.volume, inode, bs)
 	if err != nil {
 		return nil, err
 	}
-	return &BlockFile{
+	f.Epoch = epoch
+	f.IOClass = s.IOClass
+	// A volume resized since it was last open takes its new size now.
+	if f.Size() != s.volume.MaxBytes {
+		err = f.Truncate(int64(s.volume.MaxBytes))
+		if err != nil {
+			return nil, err
+		}
+	}
+	bf := &BlockFile{
 		File: f,
 		vol:  s,
-	}, nil
+	}
+	bf.refreshReadahead()
+	bf.startSyncPolicy()
+	bf.startDedup()
+	bf.startRenew()
+	return bf, nil
 }
 
 func (s *BlockVolume) OpenSnapshot(name string) (*BlockFile, error) {
 	if s.volume.Type != VolumeType {
 		panic("wrong type")
 	}
-	snaps, err := s.mds.GetSnapshots()
+	err := s.checkAccess(torus.PermRead)
 	if err != nil {
 		return nil, err
 	}
-	var found Snapshot
-	for _, x := range snaps {
-		if x.Name == name {
-			found = x
-			break
-		}
-	}
-	if found.Name != name {
-		return nil, torus.ErrNotExist
+	found, err := s.getSnapshot(name)
+	if err != nil {
+		return nil, err
 	}
 	ref := torus.INodeRefFromBytes(found.INodeRef)
 	inode, err := s.getOrCreateBlockINode(ref)
@@ -79,36 +121,35 @@ func (s *BlockVolume) OpenSnapshot(name string) (*BlockFile, error) {
 		return nil, err
 	}
 	f.ReadOnly = true
-	return &BlockFile{
+	bf := &BlockFile{
 		File: f,
 		vol:  s,
-	}, nil
+	}
+	bf.refreshReadahead()
+	return bf, nil
 }
 
 func (s *BlockVolume) RestoreSnapshot(name string) (err error) {
 	if s.volume.Type != VolumeType {
 		panic("Wrong type")
 	}
-	if err = s.mds.Lock(s.srv.Lease()); err != nil {
+	if err = s.checkAccess(torus.PermWrite); err != nil {
+		return err
+	}
+	if _, err = s.mds.Lock(s.srv.Lease()); err != nil {
 		return err
 	}
 	defer s.mds.Unlock()
-	snaps, err := s.mds.GetSnapshots()
+	found, err := s.getSnapshot(name)
 	if err != nil {
 		return err
 	}
-	var found Snapshot
-	for _, x := range snaps {
-		if x.Name == name {
-			found = x
-			break
-		}
-	}
-	if found.Name != name {
-		return torus.ErrNotExist
-	}
 	ref := torus.INodeRefFromBytes(found.INodeRef)
-	return s.mds.SyncINode(ref)
+	err = s.mds.SyncINode(ref)
+	if bci, ok := s.srv.Blocks.(torus.BlockCacheInvalidator); ok {
+		bci.InvalidateVolume(torus.VolumeID(s.volume.Id))
+	}
+	return err
 }
 
 func (f *BlockFile) Close() (err error) {
@@ -121,6 +162,9 @@ func (f *BlockFile) Close() (err error) {
 		}
 	}()
 
+	f.stopRenew()
+	f.stopDedup()
+	f.stopSyncPolicy()
 	if err = f.Sync(); err != nil {
 		return err
 	}
@@ -128,15 +172,30 @@ func (f *BlockFile) Close() (err error) {
 }
 
 func (f *BlockFile) inodeContext() context.Context {
-	return context.WithValue(context.TODO(), torus.CtxWriteLevel, torus.WriteAll)
+	ctx := torus.WithWriteLevel(context.TODO(), torus.WriteAll)
+	if f.Epoch != 0 {
+		ctx = torus.WithWriteEpoch(ctx, f.Epoch)
+	}
+	return ctx
 }
 
 func (f *BlockFile) Sync() error {
+	f.syncMut.Lock()
+	defer f.syncMut.Unlock()
+	return f.sync()
+}
+
+func (f *BlockFile) sync() error {
+	f.writes = 0
+	f.lastSync = time.Now()
 	if !f.WriteOpen() {
 		clog.Debugf("not syncing")
 		return nil
 	}
 	clog.Debugf("Syncing block volume: %v", f.vol.volume.Name)
+	// Blocks trimmed before a sync that fails are left for garbage
+	// collection.
+	trimmed := f.File.TakeTrimmed()
 	err := f.File.SyncBlocks()
 	if err != nil {
 		return err
@@ -145,5 +204,44 @@ func (f *BlockFile) Sync() error {
 	if err != nil {
 		return err
 	}
-	return f.vol.mds.SyncINode(ref)
+	err = f.vol.mds.SyncINode(ref)
+	if err != nil {
+		return err
+	}
+	f.discard(trimmed)
+	return nil
+}
+
+// discard frees trimmed blocks the volume's INode no longer refers to on the
+// peers that hold them, rather than waiting for garbage collection. Blocks
+// as old as the newest snapshot may be shared with it, and are left alone.
+func (f *BlockFile) discard(refs []torus.BlockRef) {
+	bd, ok := f.vol.srv.Blocks.(torus.BlockDiscarder)
+	if !ok || len(refs) == 0 {
+		return
+	}
+	snaps, err := f.vol.mds.GetSnapshots()
+	if err != nil {
+		clog.Warningf("couldn't get snapshots of %s, leaving discarded blocks for gc: %v", f.vol.volume.Name, err)
+		return
+	}
+	var newest torus.INodeID
+	for _, x := range snaps {
+		if id := torus.INodeRefFromBytes(x.INodeRef).INode; id > newest {
+			newest = id
+		}
+	}
+	var free []torus.BlockRef
+	for _, ref := range refs {
+		if ref.INode > newest {
+			free = append(free, ref)
+		}
+	}
+	if len(free) == 0 {
+		return
+	}
+	err = bd.DiscardBlocks(f.inodeContext(), free)
+	if err != nil {
+		clog.Warningf("couldn't discard blocks of %s, leaving them for gc: %v", f.vol.volume.Name, err)
+	}
 }
@@ -0,0 +1,268 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/consul"
+	"github.com/coreos/torus/models"
+)
+
+type blockConsul struct {
+	*consul.Consul
+	name string
+	vid  torus.VolumeID
+}
+
+func (b *blockConsul) txn(ops api.KVTxnOps) (bool, *api.KVTxnResponse, error) {
+	ok, resp, _, err := b.Consul.Client.KV().Txn(ops, nil)
+	return ok, resp, err
+}
+
+func (b *blockConsul) volKey(s ...string) string {
+	return consul.MkKey(append([]string{"volumemeta", consul.Uint64ToHex(uint64(b.vid))}, s...)...)
+}
+
+func (b *blockConsul) CreateBlockVolume(volume *models.Volume) error {
+	return b.CreateBlockVolumes([]*models.Volume{volume})
+}
+
+// Consul caps the operations in a transaction at 64, and creating a volume
+// takes five.
+const consulTxnVolumes = 12
+
+// CreateBlockVolumes creates the volumes in transactions of up to
+// consulTxnVolumes each. Each transaction creates all of its volumes, or none
+// of them if any name is taken; those before it are kept.
+func (b *blockConsul) CreateBlockVolumes(volumes []*models.Volume) error {
+	for len(volumes) > consulTxnVolumes {
+		err := b.createBlockVolumes(volumes[:consulTxnVolumes])
+		if err != nil {
+			return err
+		}
+		volumes = volumes[consulTxnVolumes:]
+	}
+	return b.createBlockVolumes(volumes)
+}
+
+func (b *blockConsul) createBlockVolumes(volumes []*models.Volume) error {
+	var ops api.KVTxnOps
+	for _, volume := range volumes {
+		vbytes, err := volume.Marshal()
+		if err != nil {
+			return err
+		}
+		inodeBytes := torus.NewINodeRef(torus.VolumeID(volume.Id), 1).ToBytes()
+		hex := consul.Uint64ToHex(volume.Id)
+		ops = append(ops,
+			&api.KVTxnOp{Verb: api.KVCheckNotExists, Key: consul.MkKey("volumes", volume.Name)},
+			&api.KVTxnOp{Verb: api.KVSet, Key: consul.MkKey("volumes", volume.Name), Value: consul.Uint64ToBytes(volume.Id)},
+			&api.KVTxnOp{Verb: api.KVSet, Key: consul.MkKey("volumeid", hex), Value: vbytes},
+			&api.KVTxnOp{Verb: api.KVSet, Key: consul.MkKey("volumemeta", hex, "inode"), Value: consul.Uint64ToBytes(1)},
+			&api.KVTxnOp{Verb: api.KVSet, Key: consul.MkKey("volumemeta", hex, "blockinode"), Value: inodeBytes},
+		)
+	}
+	ok, _, err := b.txn(ops)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return torus.ErrExists
+	}
+	return nil
+}
+
+func (b *blockConsul) DeleteVolume() error {
+	hex := consul.Uint64ToHex(uint64(b.vid))
+	ok, _, err := b.txn(api.KVTxnOps{
+		{Verb: api.KVCheckNotExists, Key: b.volKey("blocklock")},
+		{Verb: api.KVDelete, Key: consul.MkKey("volumes", b.name)},
+		{Verb: api.KVDelete, Key: consul.MkKey("volumeid", hex)},
+		{Verb: api.KVDeleteTree, Key: consul.MkPrefix("volumemeta", hex)},
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (b *blockConsul) Lock(lease int64) (uint64, error) {
+	if lease == 0 {
+		return 0, torus.ErrInvalid
+	}
+	session, err := b.Consul.LeaseSession(lease)
+	if err != nil {
+		return 0, err
+	}
+	k := b.volKey("blocklock")
+	ok, resp, err := b.txn(api.KVTxnOps{
+		{Verb: api.KVCheckNotExists, Key: k},
+		{Verb: api.KVLock, Key: k, Value: []byte(b.Consul.UUID()), Session: session},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, torus.ErrLocked
+	}
+	// Consul's index only ever goes up, so the one that took the lock makes
+	// a good epoch.
+	var epoch uint64
+	for _, kv := range resp.Results {
+		if kv != nil && kv.Key == k && kv.ModifyIndex > epoch {
+			epoch = kv.ModifyIndex
+		}
+	}
+	return epoch, nil
+}
+
+// heldLock returns the index of the volume's lock if this client holds it.
+func (b *blockConsul) heldLock() (uint64, error) {
+	kv, _, err := b.Consul.Client.KV().Get(b.volKey("blocklock"), nil)
+	if err != nil {
+		return 0, err
+	}
+	if kv == nil || string(kv.Value) != b.Consul.UUID() {
+		return 0, torus.ErrLocked
+	}
+	return kv.ModifyIndex, nil
+}
+
+func (b *blockConsul) GetINode() (torus.INodeRef, error) {
+	kv, _, err := b.Consul.Client.KV().Get(b.volKey("blockinode"), nil)
+	if err != nil {
+		return torus.NewINodeRef(0, 0), err
+	}
+	if kv == nil {
+		return torus.NewINodeRef(0, 0), errors.New("unexpected metadata for volume")
+	}
+	return torus.INodeRefFromBytes(kv.Value), nil
+}
+
+func (b *blockConsul) SyncINode(inode torus.INodeRef) error {
+	hex := consul.Uint64ToHex(uint64(inode.Volume()))
+	lock, err := b.heldLock()
+	if err != nil {
+		return err
+	}
+	ok, _, err := b.txn(api.KVTxnOps{
+		{Verb: api.KVCheckIndex, Key: consul.MkKey("volumemeta", hex, "blocklock"), Index: lock},
+		{Verb: api.KVSet, Key: consul.MkKey("volumemeta", hex, "blockinode"), Value: inode.ToBytes()},
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (b *blockConsul) Unlock() error {
+	lock, err := b.heldLock()
+	if err != nil {
+		return err
+	}
+	ok, _, err := b.Consul.Client.KV().DeleteCAS(&api.KVPair{
+		Key:         b.volKey("blocklock"),
+		ModifyIndex: lock,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (b *blockConsul) SaveSnapshot(name string) error {
+	sshotKey := b.volKey("snapshots", name)
+	for {
+		kv, _, err := b.Consul.Client.KV().Get(sshotKey, nil)
+		if err != nil {
+			return err
+		}
+		if kv != nil {
+			return torus.ErrExists
+		}
+		ino, _, err := b.Consul.Client.KV().Get(b.volKey("blockinode"), nil)
+		if err != nil {
+			return err
+		}
+		if ino == nil {
+			return errors.New("unexpected metadata for volume")
+		}
+		bytes, err := json.Marshal(Snapshot{
+			Name:     name,
+			When:     time.Now(),
+			INodeRef: ino.Value,
+		})
+		if err != nil {
+			return err
+		}
+		ok, _, err := b.txn(api.KVTxnOps{
+			{Verb: api.KVCheckNotExists, Key: sshotKey},
+			{Verb: api.KVCheckIndex, Key: ino.Key, Index: ino.ModifyIndex},
+			{Verb: api.KVSet, Key: sshotKey, Value: bytes},
+		})
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+func (b *blockConsul) GetSnapshots() ([]Snapshot, error) {
+	kvs, _, err := b.Consul.Client.KV().List(consul.MkPrefix("volumemeta", consul.Uint64ToHex(uint64(b.vid)), "snapshots"), nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Snapshot, len(kvs))
+	for i, kv := range kvs {
+		err := json.Unmarshal(kv.Value, &out[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (b *blockConsul) DeleteSnapshot(name string) error {
+	k := b.volKey("snapshots", name)
+	kv, _, err := b.Consul.Client.KV().Get(k, nil)
+	if err != nil {
+		return err
+	}
+	if kv == nil {
+		return torus.ErrNotExist
+	}
+	ok, _, err := b.Consul.Client.KV().DeleteCAS(&api.KVPair{Key: k, ModifyIndex: kv.ModifyIndex}, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return torus.ErrNotExist
+	}
+	return nil
+}
+
+func createBlockConsulMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (blockMetadata, error) {
+	if c, ok := mds.(*consul.Consul); ok {
+		return &blockConsul{
+			Consul: c,
+			name:   name,
+			vid:    vid,
+		}, nil
+	}
+	panic("how are we creating a consul metadata that doesn't implement it but reports as being consul")
+}
@@ -0,0 +1,174 @@
+package block
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+)
+
+var errDedupErasure = errors.New("erasure-coded volumes can't be deduplicated")
+
+// SetDedup sets whether volume name stores blocks with the same contents
+// once. It takes effect the next time the volume is attached.
+func SetDedup(mds torus.MetadataService, name string, on bool) error {
+	dmds, ok := mds.(torus.DedupMetadataService)
+	if !ok {
+		return torus.ErrNotSupported
+	}
+	vol, err := mds.GetVolume(name)
+	if err != nil {
+		return err
+	}
+	if vol.Type != VolumeType {
+		return errors.New("only block volumes can be deduplicated")
+	}
+	vid := torus.VolumeID(vol.Id)
+	if on {
+		red, err := torus.GetRedundancy(mds, vid)
+		if err != nil {
+			return err
+		}
+		if red.Kind == torus.ErasureCoded {
+			return errDedupErasure
+		}
+	}
+	return dmds.SetDedup(vid, on)
+}
+
+// withDedup adds or takes off the dedup layer of a blockset about to be
+// opened for writing, as the volume's setting says.
+func (s *BlockVolume) withDedup(bs torus.Blockset) torus.Blockset {
+	dmds, ok := s.srv.MDS.(torus.DedupMetadataService)
+	if !ok {
+		return bs
+	}
+	on, err := dmds.GetDedup(torus.VolumeID(s.volume.Id))
+	if err != nil {
+		clog.Warningf("couldn't get dedup setting of %s: %v", s.volume.Name, err)
+		return bs
+	}
+	out, err := blockset.SetDedup(bs, on)
+	if err != nil {
+		clog.Warningf("couldn't dedup %s: %v", s.volume.Name, err)
+		return bs
+	}
+	return out
+}
+
+// startDedup learns the contents of the blocks written before the volume
+// was deduplicated, in the background, sharing those found to be the same.
+func (f *BlockFile) startDedup() {
+	if len(f.UnhashedBlocks()) == 0 {
+		return
+	}
+	f.stopDedupCh = make(chan struct{})
+	f.dedupDone = make(chan struct{})
+	go f.dedupLoop(f.stopDedupCh, f.dedupDone)
+}
+
+func (f *BlockFile) stopDedup() {
+	if f.stopDedupCh == nil {
+		return
+	}
+	close(f.stopDedupCh)
+	<-f.dedupDone
+	f.stopDedupCh = nil
+}
+
+func (f *BlockFile) dedupLoop(stop, done chan struct{}) {
+	defer close(done)
+	linked := 0
+	for _, i := range f.UnhashedBlocks() {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		ok, err := f.DedupBlock(i)
+		if err != nil {
+			clog.Warningf("dedup of %s stopped at block %d: %v", f.vol.volume.Name, i, err)
+			return
+		}
+		if ok {
+			linked++
+		}
+	}
+	err := f.Sync()
+	if err != nil {
+		clog.Warningf("couldn't sync %s after dedup: %v", f.vol.volume.Name, err)
+		return
+	}
+	clog.Infof("dedup of %s learned its written blocks, and shared %d of them", f.vol.volume.Name, linked)
+}
+
+// DedupAnalysis is how much deduplicating a volume would save.
+type DedupAnalysis struct {
+	// Blocks is how many blocks of the volume have been written.
+	Blocks uint64
+	// Stored is how many stored blocks they take now.
+	Stored uint64
+	// Unique is how many different contents they have, which is how many
+	// stored blocks they'd take deduplicated.
+	Unique uint64
+	// BlockSize is the size of each block.
+	BlockSize uint64
+}
+
+// Savings returns how many bytes deduplicating the volume would give back.
+func (a DedupAnalysis) Savings() uint64 {
+	return (a.Stored - a.Unique) * a.BlockSize
+}
+
+// AnalyzeDedup reads every block of the volume, without changing anything,
+// to find out how much deduplicating it would save.
+func (s *BlockVolume) AnalyzeDedup() (*DedupAnalysis, error) {
+	if err := s.checkAccess(torus.PermRead); err != nil {
+		return nil, err
+	}
+	red, err := torus.GetRedundancy(s.srv.MDS, torus.VolumeID(s.volume.Id))
+	if err != nil {
+		return nil, err
+	}
+	if red.Kind == torus.ErasureCoded {
+		return nil, errDedupErasure
+	}
+	out := &DedupAnalysis{BlockSize: s.srv.MDS.GlobalMetadata().BlockSize}
+	ref, err := s.mds.GetINode()
+	if err != nil {
+		return nil, err
+	}
+	if ref.INode <= 1 {
+		return out, nil
+	}
+	inode, err := s.srv.INodes.GetINode(s.getContext(), ref)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := blockset.UnmarshalFromProto(inode.Blocks, s.srv.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	ctx := torus.WithIOClass(s.getContext(), torus.IOClassBatch)
+	seen := make(map[torus.BlockRef]bool)
+	unique := make(map[[sha256.Size]byte]bool)
+	for i, x := range bs.GetAllBlockRefs() {
+		if x.IsZero() {
+			continue
+		}
+		out.Blocks++
+		if seen[x] {
+			continue
+		}
+		seen[x] = true
+		data, err := bs.GetBlock(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		unique[sha256.Sum256(data)] = true
+	}
+	out.Stored = uint64(len(seen))
+	out.Unique = uint64(len(unique))
+	return out, nil
+}
@@ -17,23 +17,38 @@ type blockEtcd struct {
 	*etcd.Etcd
 	name string
 	vid  torus.VolumeID
+
+	// lease and epoch are those of the attachment this client took, if
+	// any. The epoch is the revision that took it, so it's also the lock
+	// key's mod revision for as long as the attachment is this client's.
+	lease int64
+	epoch int64
 }
 
 func (b *blockEtcd) CreateBlockVolume(volume *models.Volume) error {
-	vbytes, err := volume.Marshal()
-	if err != nil {
-		return err
-	}
-	inodeBytes := torus.NewINodeRef(torus.VolumeID(volume.Id), 1).ToBytes()
+	return b.CreateBlockVolumes([]*models.Volume{volume})
+}
 
-	do := b.Etcd.Client.Txn(b.getContext()).If(
-		etcdv3.Compare(etcdv3.Version(etcd.MkKey("volumes", volume.Name)), "=", 0),
-	).Then(
-		etcdv3.OpPut(etcd.MkKey("volumes", volume.Name), string(etcd.Uint64ToBytes(volume.Id))),
-		etcdv3.OpPut(etcd.MkKey("volumeid", etcd.Uint64ToHex(volume.Id)), string(vbytes)),
-		etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(volume.Id), "inode"), string(etcd.Uint64ToBytes(1))),
-		etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(volume.Id), "blockinode"), string(inodeBytes)),
-	)
+// CreateBlockVolumes creates all of the volumes in one transaction, or none of
+// them if any name is taken.
+func (b *blockEtcd) CreateBlockVolumes(volumes []*models.Volume) error {
+	var cmps []etcdv3.Cmp
+	var ops []etcdv3.Op
+	for _, volume := range volumes {
+		vbytes, err := volume.Marshal()
+		if err != nil {
+			return err
+		}
+		inodeBytes := torus.NewINodeRef(torus.VolumeID(volume.Id), 1).ToBytes()
+		cmps = append(cmps, etcdv3.Compare(etcdv3.Version(etcd.MkKey("volumes", volume.Name)), "=", 0))
+		ops = append(ops,
+			etcdv3.OpPut(etcd.MkKey("volumes", volume.Name), string(etcd.Uint64ToBytes(volume.Id))),
+			etcdv3.OpPut(etcd.MkKey("volumeid", etcd.Uint64ToHex(volume.Id)), string(vbytes)),
+			etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(volume.Id), "inode"), string(etcd.Uint64ToBytes(1))),
+			etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(volume.Id), "blockinode"), string(inodeBytes)),
+		)
+	}
+	do := b.Etcd.Client.Txn(b.getContext()).If(cmps...).Then(ops...)
 	resp, err := do.Commit()
 	if err != nil {
 		return err
@@ -46,8 +61,16 @@ func (b *blockEtcd) CreateBlockVolume(volume *models.Volume) error {
 
 func (b *blockEtcd) DeleteVolume() error {
 	vid := uint64(b.vid)
+	n, gen, err := b.sharers()
+	if err != nil {
+		return err
+	}
+	if n != 0 {
+		return torus.ErrLocked
+	}
 	tx := b.Etcd.Client.Txn(b.getContext()).If(
 		etcdv3.Compare(etcdv3.Version(etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid), "blocklock")), "=", 0),
+		etcdv3.Compare(etcdv3.ModRevision(b.key("sharergen")), "=", gen),
 	).Then(
 		etcdv3.OpDelete(etcd.MkKey("volumes", b.name)),
 		etcdv3.OpDelete(etcd.MkKey("volumeid", etcd.Uint64ToHex(vid))),
@@ -68,17 +91,61 @@ func (b *blockEtcd) getContext() context.Context {
 	return context.TODO()
 }
 
-func (b *blockEtcd) Lock(lease int64) error {
+func (b *blockEtcd) Lock(lease int64) (uint64, error) {
 	if lease == 0 {
-		return torus.ErrInvalid
+		return 0, torus.ErrInvalid
 	}
 	k := etcd.MkKey("volumemeta", etcd.Uint64ToHex(uint64(b.vid)), "blocklock")
 	tx := b.Etcd.Client.Txn(b.getContext()).If(
 		etcdv3.Compare(etcdv3.Version(k), "=", 0),
+		etcdv3.Compare(etcdv3.Version(b.key("shared")), "=", 0),
 	).Then(
 		etcdv3.OpPut(k, b.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(lease))),
+		etcdv3.OpPut(b.key("blockrenew"), b.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(lease))),
+	).Else(
+		etcdv3.OpGet(b.key("shared")),
 	)
 	resp, err := tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		if len(resp.Responses[0].GetResponseRange().Kvs) != 0 {
+			return 0, torus.ErrShared
+		}
+		return 0, torus.ErrLocked
+	}
+	// The revision that took the lock only ever goes up, which makes it a
+	// good epoch.
+	b.lease, b.epoch = lease, resp.Header.Revision
+	return uint64(resp.Header.Revision), nil
+}
+
+// held returns the comparisons that hold while this client has the
+// attachment.
+func (b *blockEtcd) held() []etcdv3.Cmp {
+	k := b.key("blocklock")
+	cmps := []etcdv3.Cmp{
+		etcdv3.Compare(etcdv3.Version(k), ">", 0),
+		etcdv3.Compare(etcdv3.Value(k), "=", b.Etcd.UUID()),
+	}
+	if b.epoch != 0 {
+		cmps = append(cmps, etcdv3.Compare(etcdv3.ModRevision(k), "=", b.epoch))
+	}
+	return cmps
+}
+
+// The holder of an attachment puts the renew key every so often. A client
+// forcing its way in waits to see whether it does, and takes the attachment
+// over if not.
+
+func (b *blockEtcd) RenewLock() error {
+	if b.epoch == 0 {
+		return torus.ErrLocked
+	}
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(b.held()...).Then(
+		etcdv3.OpPut(b.key("blockrenew"), b.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(b.lease))),
+	).Commit()
 	if err != nil {
 		return err
 	}
@@ -88,6 +155,57 @@ func (b *blockEtcd) Lock(lease int64) error {
 	return nil
 }
 
+func (b *blockEtcd) ForceLock(lease int64, wait time.Duration) (uint64, error) {
+	if lease == 0 {
+		return 0, torus.ErrInvalid
+	}
+	resp, err := b.Etcd.Client.Txn(b.getContext()).Then(
+		etcdv3.OpGet(b.key("blocklock")),
+		etcdv3.OpGet(b.key("blockrenew")),
+	).Commit()
+	if err != nil {
+		return 0, err
+	}
+	lock := resp.Responses[0].GetResponseRange().Kvs
+	if len(lock) == 0 {
+		return b.Lock(lease)
+	}
+	var renewed int64
+	if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) != 0 {
+		renewed = kvs[0].ModRevision
+	}
+	clog.Infof("waiting %s to see whether the attachment of %s is still renewed", wait, b.name)
+	time.Sleep(wait)
+	k := b.key("blocklock")
+	resp, err = b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.ModRevision(k), "=", lock[0].ModRevision),
+		etcdv3.Compare(etcdv3.ModRevision(b.key("blockrenew")), "=", renewed),
+		etcdv3.Compare(etcdv3.Version(b.key("shared")), "=", 0),
+	).Then(
+		etcdv3.OpPut(k, b.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(lease))),
+		etcdv3.OpPut(b.key("blockrenew"), b.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(lease))),
+	).Else(
+		etcdv3.OpGet(k),
+		etcdv3.OpGet(b.key("shared")),
+	).Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		switch {
+		case len(resp.Responses[1].GetResponseRange().Kvs) != 0:
+			return 0, torus.ErrShared
+		case len(resp.Responses[0].GetResponseRange().Kvs) == 0:
+			// Its holder let it go in the meantime.
+			return b.Lock(lease)
+		}
+		return 0, torus.ErrLocked
+	}
+	clog.Warningf("took over the attachment of %s from %s, which had stopped renewing it", b.name, lock[0].Value)
+	b.lease, b.epoch = lease, resp.Header.Revision
+	return uint64(resp.Header.Revision), nil
+}
+
 func (b *blockEtcd) GetINode() (torus.INodeRef, error) {
 	resp, err := b.Etcd.Client.Get(b.getContext(), etcd.MkKey("volumemeta", etcd.Uint64ToHex(uint64(b.vid)), "blockinode"))
 	if err != nil {
@@ -102,11 +220,7 @@ func (b *blockEtcd) GetINode() (torus.INodeRef, error) {
 func (b *blockEtcd) SyncINode(inode torus.INodeRef) error {
 	vid := uint64(inode.Volume())
 	inodeBytes := string(inode.ToBytes())
-	k := etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid), "blocklock")
-	tx := b.Etcd.Client.Txn(b.getContext()).If(
-		etcdv3.Compare(etcdv3.Version(k), ">", 0),
-		etcdv3.Compare(etcdv3.Value(k), "=", b.Etcd.UUID()),
-	).Then(
+	tx := b.Etcd.Client.Txn(b.getContext()).If(b.held()...).Then(
 		etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid), "blockinode"), inodeBytes),
 	)
 	resp, err := tx.Commit()
@@ -121,12 +235,9 @@ func (b *blockEtcd) SyncINode(inode torus.INodeRef) error {
 
 func (b *blockEtcd) Unlock() error {
 	vid := uint64(b.vid)
-	k := etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid), "blocklock")
-	tx := b.Etcd.Client.Txn(b.getContext()).If(
-		etcdv3.Compare(etcdv3.Version(k), ">", 0),
-		etcdv3.Compare(etcdv3.Value(k), "=", b.Etcd.UUID()),
-	).Then(
+	tx := b.Etcd.Client.Txn(b.getContext()).If(b.held()...).Then(
 		etcdv3.OpDelete(etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid), "blocklock")),
+		etcdv3.OpDelete(b.key("blockrenew")),
 	)
 	resp, err := tx.Commit()
 	if err != nil {
@@ -135,6 +246,7 @@ func (b *blockEtcd) Unlock() error {
 	if !resp.Succeeded {
 		return torus.ErrLocked
 	}
+	b.lease, b.epoch = 0, 0
 	return nil
 }
 
@@ -212,11 +324,222 @@ func (b *blockEtcd) DeleteSnapshot(name string) error {
 		return err
 	}
 	if !resp.Succeeded {
+		return torus.ErrNotExist
+	}
+	return nil
+}
+
+// key returns the key of the volume's metadata at path.
+func (b *blockEtcd) key(path ...string) string {
+	return etcd.MkKey(append([]string{"volumemeta", etcd.Uint64ToHex(uint64(b.vid))}, path...)...)
+}
+
+// Every shared attachment has a key under sharers, and bumps sharergen as it
+// attaches, so that a transaction can tell whether any attached since the
+// sharers were counted.
+
+func (b *blockEtcd) sharers() (n int64, gen int64, err error) {
+	resp, err := b.Etcd.Client.Txn(b.getContext()).Then(
+		etcdv3.OpGet(b.key("sharers")+"/", etcdv3.WithPrefix(), etcdv3.WithCountOnly()),
+		etcdv3.OpGet(b.key("sharergen")),
+	).Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+	n = resp.Responses[0].GetResponseRange().Count
+	if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) != 0 {
+		gen = kvs[0].ModRevision
+	}
+	return n, gen, nil
+}
+
+func (b *blockEtcd) SetShared(shared bool) error {
+	if shared {
+		resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+			etcdv3.Compare(etcdv3.Version(b.key("blocklock")), "=", 0),
+		).Then(
+			etcdv3.OpPut(b.key("shared"), "1"),
+		).Commit()
+		if err != nil {
+			return err
+		}
+		if !resp.Succeeded {
+			return torus.ErrLocked
+		}
+		return nil
+	}
+	n, gen, err := b.sharers()
+	if err != nil {
+		return err
+	}
+	if n != 0 {
+		return torus.ErrLocked
+	}
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.ModRevision(b.key("sharergen")), "=", gen),
+	).Then(
+		etcdv3.OpDelete(b.key("shared")),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (b *blockEtcd) IsShared() (bool, error) {
+	resp, err := b.Etcd.Client.Get(b.getContext(), b.key("shared"))
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Kvs) != 0, nil
+}
+
+func (b *blockEtcd) AttachShared(lease int64) error {
+	if lease == 0 {
+		return torus.ErrInvalid
+	}
+	k := b.key("sharers", b.Etcd.UUID())
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(b.key("shared")), ">", 0),
+		etcdv3.Compare(etcdv3.Version(k), "=", 0),
+	).Then(
+		etcdv3.OpPut(k, b.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(lease))),
+		etcdv3.OpPut(b.key("sharergen"), ""),
+	).Else(
+		etcdv3.OpGet(b.key("shared")),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		if len(resp.Responses[0].GetResponseRange().Kvs) == 0 {
+			return torus.ErrInvalid
+		}
 		return torus.ErrLocked
 	}
 	return nil
 }
 
+func (b *blockEtcd) DetachShared() error {
+	k := b.key("sharers", b.Etcd.UUID())
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(k), ">", 0),
+	).Then(
+		etcdv3.OpDelete(k),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (b *blockEtcd) rangeKey(i int) string {
+	return b.key("rangelock", etcd.Uint64ToHex(uint64(i)))
+}
+
+func (b *blockEtcd) LockBlocks(lease int64, from, to int) error {
+	if lease == 0 || to <= from || to-from > maxLockBlocks {
+		return torus.ErrInvalid
+	}
+	var cmps []etcdv3.Cmp
+	var ops []etcdv3.Op
+	for i := from; i < to; i++ {
+		cmps = append(cmps, etcdv3.Compare(etcdv3.Version(b.rangeKey(i)), "=", 0))
+		ops = append(ops, etcdv3.OpPut(b.rangeKey(i), b.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(lease))))
+	}
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (b *blockEtcd) UnlockBlocks(from, to int) error {
+	var cmps []etcdv3.Cmp
+	var ops []etcdv3.Op
+	for i := from; i < to; i++ {
+		cmps = append(cmps, etcdv3.Compare(etcdv3.Value(b.rangeKey(i)), "=", b.Etcd.UUID()))
+		ops = append(ops, etcdv3.OpDelete(b.rangeKey(i)))
+	}
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (b *blockEtcd) GetSharedINode() (torus.INodeRef, int64, error) {
+	resp, err := b.Etcd.Client.Get(b.getContext(), b.key("blockinode"))
+	if err != nil {
+		return torus.ZeroINode(), 0, err
+	}
+	if len(resp.Kvs) != 1 {
+		return torus.ZeroINode(), 0, errors.New("unexpected metadata for volume")
+	}
+	return torus.INodeRefFromBytes(resp.Kvs[0].Value), resp.Kvs[0].ModRevision, nil
+}
+
+func (b *blockEtcd) SyncSharedINode(inode torus.INodeRef, version int64) (int64, error) {
+	k := b.key("sharers", b.Etcd.UUID())
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.ModRevision(b.key("blockinode")), "=", version),
+		etcdv3.Compare(etcdv3.Version(k), ">", 0),
+	).Then(
+		etcdv3.OpPut(b.key("blockinode"), string(inode.ToBytes())),
+	).Else(
+		etcdv3.OpGet(k),
+	).Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		if len(resp.Responses[0].GetResponseRange().Kvs) == 0 {
+			return 0, torus.ErrLocked
+		}
+		return 0, torus.ErrCompareFailed
+	}
+	return resp.Header.Revision, nil
+}
+
+func (b *blockEtcd) GetReservations() ([]byte, int64, error) {
+	resp, err := b.Etcd.Client.Get(b.getContext(), b.key("reservations"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+	return resp.Kvs[0].Value, resp.Kvs[0].ModRevision, nil
+}
+
+func (b *blockEtcd) SaveReservations(data []byte, version int64) (int64, error) {
+	k := b.key("reservations")
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.ModRevision(k), "=", version),
+	).Then(
+		etcdv3.OpPut(k, string(data)),
+	).Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, torus.ErrCompareFailed
+	}
+	return resp.Header.Revision, nil
+}
+
 func createBlockEtcdMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (blockMetadata, error) {
 	if e, ok := mds.(*etcd.Etcd); ok {
 		return &blockEtcd{
@@ -0,0 +1,299 @@
+package block
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+)
+
+// An export is a stream of the blocks of a volume that differ between two of
+// its snapshots, or of every block written as of one snapshot for a full
+// export. Applying a full export and then each incremental one after it, in
+// order, to an image file reproduces the volume as of the last snapshot.
+//
+// The format is, with all integers big-endian:
+//
+//	"TORUSEXP"       8 bytes of magic
+//	version          uint32, currently 1
+//	block size       uint64
+//	volume size      uint64
+//	from             uint32 length, then the name of the older snapshot,
+//	                 empty for a full export
+//	to               uint32 length, then the name of the newer snapshot
+//	blocks           repeated: uint64 block index, then block size bytes
+//	end              uint64 0xffffffffffffffff, then uint64 number of blocks
+//
+// Blocks are in increasing order of index. Blocks trimmed since the older
+// snapshot are sent as zeros.
+
+const (
+	exportMagic   = "TORUSEXP"
+	exportVersion = 1
+	exportEnd     = ^uint64(0)
+)
+
+var (
+	errNotExport       = errors.New("block: not a torus export")
+	errTruncatedExport = errors.New("block: export ends early")
+)
+
+// ExportHeader describes an export.
+type ExportHeader struct {
+	BlockSize  uint64
+	VolumeSize uint64
+	// From is the snapshot the export is relative to, or empty if it's a
+	// full export.
+	From string
+	// To is the snapshot the export brings an image up to.
+	To string
+}
+
+// getSnapshot returns the named snapshot of the volume.
+func (s *BlockVolume) getSnapshot(name string) (Snapshot, error) {
+	snaps, err := s.mds.GetSnapshots()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, x := range snaps {
+		if x.Name == name {
+			return x, nil
+		}
+	}
+	return Snapshot{}, torus.ErrNotExist
+}
+
+// snapshotRefs returns the ref of each block of the named snapshot, by
+// index, with zero refs for blocks never written.
+func (s *BlockVolume) snapshotRefs(name string) ([]torus.BlockRef, error) {
+	snap, err := s.getSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	inode, err := s.getOrCreateBlockINode(torus.INodeRefFromBytes(snap.INodeRef))
+	if err != nil {
+		return nil, err
+	}
+	bs, err := blockset.UnmarshalFromProto(inode.GetBlocks(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return bs.GetAllBlockRefs()[:bs.Length()], nil
+}
+
+// ChangedBlocks returns the indexes of the blocks that differ between the
+// snapshots from and to of the volume, in increasing order. If from is
+// empty, it returns every block written as of to.
+func (s *BlockVolume) ChangedBlocks(from, to string) ([]int, error) {
+	if err := s.checkAccess(torus.PermRead); err != nil {
+		return nil, err
+	}
+	newer, err := s.snapshotRefs(to)
+	if err != nil {
+		return nil, err
+	}
+	var older []torus.BlockRef
+	if from != "" {
+		older, err = s.snapshotRefs(from)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var out []int
+	for i, ref := range newer {
+		if i < len(older) {
+			if ref != older[i] {
+				out = append(out, i)
+			}
+			continue
+		}
+		if !ref.IsZero() {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+// Export writes the blocks that differ between the snapshots from and to to
+// w, in the export format, and returns how many it wrote. If from is empty,
+// the export is a full one.
+func (s *BlockVolume) Export(w io.Writer, from, to string) (int, error) {
+	changed, err := s.ChangedBlocks(from, to)
+	if err != nil {
+		return 0, err
+	}
+	f, err := s.OpenSnapshot(to)
+	if err != nil {
+		return 0, err
+	}
+	defer f.File.Close()
+	bsize := s.mds.GlobalMetadata().BlockSize
+	bw := bufio.NewWriter(w)
+	hdr := ExportHeader{
+		BlockSize:  bsize,
+		VolumeSize: f.Size(),
+		From:       from,
+		To:         to,
+	}
+	err = writeExportHeader(bw, hdr)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, bsize)
+	n := 0
+	for _, i := range changed {
+		off := uint64(i) * bsize
+		if off >= hdr.VolumeSize {
+			break
+		}
+		n++
+		for j := range buf {
+			buf[j] = 0
+		}
+		end := bsize
+		if off+end > hdr.VolumeSize {
+			end = hdr.VolumeSize - off
+		}
+		_, err := f.ReadAt(buf[:end], int64(off))
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("couldn't read block %d: %v", i, err)
+		}
+		err = binary.Write(bw, binary.BigEndian, uint64(i))
+		if err != nil {
+			return 0, err
+		}
+		_, err = bw.Write(buf)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = binary.Write(bw, binary.BigEndian, []uint64{exportEnd, uint64(n)})
+	if err != nil {
+		return 0, err
+	}
+	return n, bw.Flush()
+}
+
+func writeExportHeader(w io.Writer, hdr ExportHeader) error {
+	_, err := io.WriteString(w, exportMagic)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, struct {
+		Version    uint32
+		BlockSize  uint64
+		VolumeSize uint64
+	}{exportVersion, hdr.BlockSize, hdr.VolumeSize})
+	if err != nil {
+		return err
+	}
+	for _, s := range []string{hdr.From, hdr.To} {
+		err = binary.Write(w, binary.BigEndian, uint32(len(s)))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readExportHeader(r io.Reader) (*ExportHeader, error) {
+	magic := make([]byte, len(exportMagic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil || string(magic) != exportMagic {
+		return nil, errNotExport
+	}
+	var fixed struct {
+		Version    uint32
+		BlockSize  uint64
+		VolumeSize uint64
+	}
+	err = binary.Read(r, binary.BigEndian, &fixed)
+	if err != nil {
+		return nil, errTruncatedExport
+	}
+	if fixed.Version != exportVersion {
+		return nil, fmt.Errorf("block: unsupported export version %d", fixed.Version)
+	}
+	if fixed.BlockSize == 0 {
+		return nil, errNotExport
+	}
+	hdr := &ExportHeader{
+		BlockSize:  fixed.BlockSize,
+		VolumeSize: fixed.VolumeSize,
+	}
+	for _, s := range []*string{&hdr.From, &hdr.To} {
+		var n uint32
+		err = binary.Read(r, binary.BigEndian, &n)
+		if err != nil {
+			return nil, errTruncatedExport
+		}
+		if n > 4096 {
+			return nil, errNotExport
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return nil, errTruncatedExport
+		}
+		*s = string(b)
+	}
+	return hdr, nil
+}
+
+// ApplyExport writes the blocks of the export read from r to their place in
+// dst, such as an image file made from the export's From snapshot, and
+// returns the export's header and how many blocks it applied. Block data past
+// the end of the volume is left out.
+func ApplyExport(dst io.WriterAt, r io.Reader) (*ExportHeader, int, error) {
+	br := bufio.NewReader(r)
+	hdr, err := readExportHeader(br)
+	if err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, hdr.BlockSize)
+	n := 0
+	for {
+		var i uint64
+		err = binary.Read(br, binary.BigEndian, &i)
+		if err != nil {
+			return hdr, n, errTruncatedExport
+		}
+		if i == exportEnd {
+			break
+		}
+		_, err = io.ReadFull(br, buf)
+		if err != nil {
+			return hdr, n, errTruncatedExport
+		}
+		off := i * hdr.BlockSize
+		if off >= hdr.VolumeSize {
+			return hdr, n, fmt.Errorf("block: export has block %d past the end of the volume", i)
+		}
+		data := buf
+		if off+hdr.BlockSize > hdr.VolumeSize {
+			data = buf[:hdr.VolumeSize-off]
+		}
+		_, err = dst.WriteAt(data, int64(off))
+		if err != nil {
+			return hdr, n, err
+		}
+		n++
+	}
+	var count uint64
+	err = binary.Read(br, binary.BigEndian, &count)
+	if err != nil {
+		return hdr, n, errTruncatedExport
+	}
+	if count != uint64(n) {
+		return hdr, n, fmt.Errorf("block: export claims %d blocks but has %d", count, n)
+	}
+	return hdr, n, nil
+}
@@ -22,6 +22,8 @@ type blockvolGC struct {
 	set        map[torus.BlockRef]bool
 	highwaters map[torus.VolumeID]torus.INodeID
 	curINodes  []torus.INodeRef
+	// others are the volumes of other types, which are for their own GCs.
+	others map[torus.VolumeID]bool
 }
 
 func NewBlockVolGC(srv *torus.Server, inodes gc.INodeFetcher) (gc.GC, error) {
@@ -40,6 +42,7 @@ func (b *blockvolGC) getContext() context.Context {
 
 func (b *blockvolGC) PrepVolume(vol *models.Volume) error {
 	if vol.Type != VolumeType {
+		b.others[torus.VolumeID(vol.Id)] = true
 		return nil
 	}
 	mds, err := createBlockMetadata(b.srv.MDS, vol.Name, torus.VolumeID(vol.Id))
@@ -91,6 +94,9 @@ func (b *blockvolGC) PrepVolume(vol *models.Volume) error {
 }
 
 func (b *blockvolGC) IsDead(ref torus.BlockRef) bool {
+	if b.others[ref.Volume()] {
+		return false
+	}
 	v, ok := b.highwaters[ref.Volume()]
 	if !ok {
 		if clog.LevelAt(capnslog.TRACE) {
@@ -135,4 +141,5 @@ func (b *blockvolGC) Clear() {
 	b.highwaters = make(map[torus.VolumeID]torus.INodeID)
 	b.curINodes = make([]torus.INodeRef, 0, len(b.curINodes))
 	b.set = make(map[torus.BlockRef]bool)
+	b.others = make(map[torus.VolumeID]bool)
 }
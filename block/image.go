@@ -0,0 +1,161 @@
+package block
+
+import (
+	"io"
+
+	"github.com/coreos/torus"
+)
+
+// Disk images, raw or qcow2, are copied in and out of volumes a block at a
+// time. Blocks of zeros are skipped both ways, so sparse images stay sparse
+// and importing them writes only what's there.
+
+type importBlock struct {
+	data []byte
+	zero bool
+	err  error
+}
+
+// ImportImage writes size bytes of src into the volume through f, leaving
+// out blocks of zeros, which an empty volume already reads as, and returns
+// how many blocks it wrote. workers goroutines read blocks of src and check
+// them for zeros ahead of the writes, which go in order.
+func (f *BlockFile) ImportImage(src io.ReaderAt, size uint64, workers int) (int, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	bsize := f.vol.mds.GlobalMetadata().BlockSize
+	nblocks := int((size + bsize - 1) / bsize)
+	type job struct {
+		i   int
+		out chan importBlock
+	}
+	jobs := make(chan job)
+	queue := make(chan chan importBlock, 2*workers)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(jobs)
+		defer close(queue)
+		for i := 0; i < nblocks; i++ {
+			out := make(chan importBlock, 1)
+			select {
+			case queue <- out:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- job{i, out}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for j := range jobs {
+				off := uint64(j.i) * bsize
+				n := bsize
+				if off+n > size {
+					n = size - off
+				}
+				data := make([]byte, n)
+				_, err := src.ReadAt(data, int64(off))
+				if err == io.EOF {
+					err = nil
+				}
+				j.out <- importBlock{data: data, zero: isZero(data), err: err}
+			}
+		}()
+	}
+	written := 0
+	i := 0
+	for out := range queue {
+		b := <-out
+		if b.err != nil {
+			return written, b.err
+		}
+		if !b.zero {
+			_, err := f.WriteAt(b.data, int64(uint64(i)*bsize))
+			if err != nil {
+				return written, err
+			}
+			written++
+		}
+		i++
+	}
+	return written, nil
+}
+
+// ExportImage reads the volume as of the named snapshot into dst, which may
+// require writes in increasing order of offset, and returns how many blocks
+// it wrote. Blocks never written, and blocks of zeros, are skipped, so dst
+// should start out empty. Blocks are fetched window at a time from every
+// peer at once, through the read cache.
+func (s *BlockVolume) ExportImage(dst io.WriterAt, snapshot string, window int) (int, error) {
+	if window < 1 {
+		window = 1
+	}
+	refs, err := s.snapshotRefs(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	f, err := s.OpenSnapshot(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	defer f.File.Close()
+	bsize := int64(s.mds.GlobalMetadata().BlockSize)
+	size := int64(f.Size())
+	var written []int
+	for i, ref := range refs {
+		if !ref.IsZero() && int64(i)*bsize < size {
+			written = append(written, i)
+		}
+	}
+	buf := make([]byte, bsize)
+	n := 0
+	for start := 0; start < len(written); start += window {
+		end := start + window
+		if end > len(written) {
+			end = len(written)
+		}
+		ranges := make([]torus.ByteRange, 0, end-start)
+		for _, i := range written[start:end] {
+			ranges = append(ranges, torus.ByteRange{Offset: int64(i) * bsize, Length: bsize})
+		}
+		err = f.Prefetch(ranges)
+		if err != nil {
+			clog.Warningf("couldn't prefetch blocks for export: %v", err)
+		}
+		for _, i := range written[start:end] {
+			off := int64(i) * bsize
+			data := buf
+			if off+bsize > size {
+				data = buf[:size-off]
+			}
+			_, err = f.ReadAt(data, off)
+			if err != nil && err != io.EOF {
+				return n, err
+			}
+			if isZero(data) {
+				continue
+			}
+			_, err = dst.WriteAt(data, off)
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
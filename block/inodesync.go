@@ -0,0 +1,116 @@
+package block
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+var (
+	// inodeSyncTick is how often a pending interval sync is checked for.
+	inodeSyncTick = time.Second
+	// inodeSyncRefresh is how often the volume's policy is read again, so
+	// that changes apply to volumes that are already attached.
+	inodeSyncRefresh = 30 * time.Second
+)
+
+// WriteAt writes to the volume, and syncs it afterwards if the volume's inode
+// sync policy calls for it.
+func (f *BlockFile) WriteAt(b []byte, off int64) (int, error) {
+	f.syncMut.Lock()
+	defer f.syncMut.Unlock()
+	n, err := f.File.WriteAt(b, off)
+	if err != nil {
+		return n, err
+	}
+	return n, f.wrote()
+}
+
+func (f *BlockFile) Write(b []byte) (int, error) {
+	f.syncMut.Lock()
+	defer f.syncMut.Unlock()
+	n, err := f.File.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, f.wrote()
+}
+
+func (f *BlockFile) wrote() error {
+	f.writes++
+	switch f.syncPolicy.Mode {
+	case torus.INodeSyncEveryWrite:
+		return f.sync()
+	case torus.INodeSyncWrites:
+		if f.writes >= f.syncPolicy.Writes {
+			return f.sync()
+		}
+	case torus.INodeSyncInterval:
+		if time.Since(f.lastSync) >= f.syncPolicy.Interval {
+			return f.sync()
+		}
+	}
+	return nil
+}
+
+func (f *BlockFile) startSyncPolicy() {
+	f.lastSync = time.Now()
+	f.refreshSyncPolicy()
+	f.stopSync = make(chan struct{})
+	go f.syncPolicyLoop(f.stopSync)
+}
+
+func (f *BlockFile) stopSyncPolicy() {
+	if f.stopSync == nil {
+		return
+	}
+	close(f.stopSync)
+	f.stopSync = nil
+}
+
+// refreshSyncPolicy reads the volume's policy. Called with syncMut held, or
+// before the file is shared.
+func (f *BlockFile) refreshSyncPolicy() {
+	imds, ok := f.vol.srv.MDS.(torus.INodeSyncMetadataService)
+	if !ok {
+		return
+	}
+	p, err := imds.GetINodeSync(torus.VolumeID(f.vol.volume.Id))
+	if err != nil {
+		clog.Warningf("couldn't get inode sync policy of %s: %v", f.vol.volume.Name, err)
+		return
+	}
+	if p != f.syncPolicy {
+		clog.Infof("inode sync policy of %s is now %s", f.vol.volume.Name, p)
+	}
+	f.syncPolicy = p
+}
+
+// syncPolicyLoop syncs writes that an interval policy has left waiting
+// longer than the interval, and picks up changes to the policy and to the
+// readahead window.
+func (f *BlockFile) syncPolicyLoop(stop chan struct{}) {
+	tick := time.NewTicker(inodeSyncTick)
+	defer tick.Stop()
+	lastRefresh := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+		f.syncMut.Lock()
+		if time.Since(lastRefresh) >= inodeSyncRefresh {
+			f.refreshSyncPolicy()
+			f.refreshReadahead()
+			lastRefresh = time.Now()
+		}
+		if f.syncPolicy.Mode == torus.INodeSyncInterval && f.writes != 0 && time.Since(f.lastSync) >= f.syncPolicy.Interval {
+			err := f.sync()
+			if err != nil {
+				clog.Errorf("couldn't sync %s: %v", f.vol.volume.Name, err)
+			}
+		}
+		f.syncMut.Unlock()
+	}
+}
@@ -0,0 +1,307 @@
+package iscsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// cmdWindow is how many commands past the last one received an initiator
+// may send.
+const cmdWindow = 32
+
+// conn is a connection, and the session it is the only connection of.
+type conn struct {
+	t *Target
+	c net.Conn
+
+	isid      [6]byte
+	tsih      uint16
+	initiator string
+	target    string
+	// nexus identifies the initiator port to reservations.
+	nexus     string
+	discovery bool
+
+	statSN   uint32
+	expCmdSN uint32
+
+	// Negotiated in the login.
+	maxSendSeg int
+	maxBurst   int
+
+	// pending holds PDUs that arrived while waiting for the data of a
+	// write.
+	pending []*pdu
+	nextTTT uint32
+}
+
+func (c *conn) serve() error {
+	if err := c.login(); err != nil {
+		return err
+	}
+	for {
+		var p *pdu
+		if len(c.pending) > 0 {
+			p, c.pending = c.pending[0], c.pending[1:]
+		} else {
+			var err error
+			p, err = readPDU(c.c)
+			if err != nil {
+				return err
+			}
+		}
+		c.received(p)
+		var err error
+		switch p.opcode() {
+		case opNopOut:
+			err = c.nopOut(p)
+		case opSCSICmd:
+			if c.discovery {
+				err = c.reject(p, 0x0b)
+			} else {
+				err = c.scsiCommand(p)
+			}
+		case opTaskMgmt:
+			err = c.taskMgmt(p)
+		case opTextReq:
+			err = c.text(p)
+		case opDataOut:
+			// Data for a write that has already failed.
+			continue
+		case opLogoutReq:
+			return c.logout(p)
+		default:
+			err = c.reject(p, 0x04)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// received moves the command window past a request.
+func (c *conn) received(p *pdu) {
+	switch p.opcode() {
+	case opDataOut:
+		return
+	case opNopOut:
+		if p.itt() == noTag {
+			return
+		}
+	}
+	if !p.immediate() && int32(p.cmdSN()-c.expCmdSN) >= 0 {
+		c.expCmdSN = p.cmdSN() + 1
+	}
+}
+
+// setSNs fills in the sequence numbers of a response that carries status.
+func (c *conn) setSNs(p *pdu) {
+	p.setField(24, c.statSN)
+	c.statSN++
+	c.setCmdSNs(p)
+}
+
+func (c *conn) setCmdSNs(p *pdu) {
+	p.setField(28, c.expCmdSN)
+	p.setField(32, c.expCmdSN+cmdWindow-1)
+}
+
+func (c *conn) send(p *pdu) error {
+	return p.writeTo(c.c)
+}
+
+func (c *conn) nopOut(p *pdu) error {
+	if p.itt() == noTag {
+		// The answer to a ping of ours.
+		return nil
+	}
+	r := newPDU(opNopIn, flagFinal, p.itt())
+	copy(r.bhs[8:16], p.bhs[8:16])
+	r.setField(20, noTag)
+	c.setSNs(r)
+	r.data = p.data
+	return c.send(r)
+}
+
+func (c *conn) taskMgmt(p *pdu) error {
+	// Commands run one at a time, so there is never one to abort. Resets
+	// leave persistent reservations alone.
+	fn := p.bhs[1] & 0x7f
+	resp := byte(0)
+	switch fn {
+	case 1, 2, 3, 4, 5, 6:
+	default:
+		resp = 5 // function not supported
+	}
+	r := newPDU(opTaskResp, flagFinal, p.itt())
+	r.bhs[2] = resp
+	c.setSNs(r)
+	return c.send(r)
+}
+
+func (c *conn) text(p *pdu) error {
+	keys, err := parseText(p.data)
+	if err != nil {
+		return c.reject(p, 0x09)
+	}
+	resp := &textPairs{}
+	for _, k := range keys.keys {
+		v := keys.values[k]
+		if k != "SendTargets" {
+			resp.add(k, "NotUnderstood")
+			continue
+		}
+		// Only us, and only if it's us being asked about.
+		if v == "All" && c.discovery || v == c.t.cfg.Name || v == "" && !c.discovery {
+			resp.add("TargetName", c.t.cfg.Name)
+			resp.add("TargetAddress", portalAddr(c.c.LocalAddr()))
+		}
+	}
+	r := newPDU(opTextResp, flagFinal, p.itt())
+	r.setField(20, noTag)
+	c.setSNs(r)
+	r.data = resp.bytes()
+	return c.send(r)
+}
+
+func (c *conn) logout(p *pdu) error {
+	r := newPDU(opLogoutResp, flagFinal, p.itt())
+	c.setSNs(r)
+	if err := c.send(r); err != nil {
+		return err
+	}
+	clog.Infof("%s logged out", c.nexus)
+	return nil
+}
+
+// reject refuses a PDU with the given reason, returning it with the
+// rejection.
+func (c *conn) reject(p *pdu, reason byte) error {
+	r := newPDU(opReject, flagFinal, noTag)
+	r.bhs[2] = reason
+	c.setSNs(r)
+	r.data = p.bhs[:]
+	return c.send(r)
+}
+
+// receiveData collects the data of a write of length bytes at the command
+// p, which may have brought some with it, asking for the rest with R2Ts.
+func (c *conn) receiveData(p *pdu, length int) ([]byte, error) {
+	buf := make([]byte, length)
+	got := copy(buf, p.data)
+	r2tsn := uint32(0)
+	for got < length {
+		want := length - got
+		if want > c.maxBurst {
+			want = c.maxBurst
+		}
+		ttt := c.nextTTT
+		c.nextTTT++
+		if c.nextTTT == noTag {
+			c.nextTTT = 0
+		}
+		r := newPDU(opR2T, flagFinal, p.itt())
+		copy(r.bhs[8:16], p.bhs[8:16])
+		r.setField(20, ttt)
+		r.setField(24, c.statSN)
+		c.setCmdSNs(r)
+		r.setField(36, r2tsn)
+		r.setField(40, uint32(got))
+		r.setField(44, uint32(want))
+		r2tsn++
+		if err := c.send(r); err != nil {
+			return nil, err
+		}
+		end := got + want
+		for got < end {
+			d, err := readPDU(c.c)
+			if err != nil {
+				return nil, err
+			}
+			if d.opcode() != opDataOut || d.itt() != p.itt() || d.ttt() != ttt {
+				c.pending = append(c.pending, d)
+				continue
+			}
+			off := int(d.field(40))
+			if off != got || off+len(d.data) > end {
+				return nil, fmt.Errorf("iscsi: data out of order for task %#x", p.itt())
+			}
+			copy(buf[off:], d.data)
+			got += len(d.data)
+			if d.final() && got != end {
+				return nil, fmt.Errorf("iscsi: short burst for task %#x", p.itt())
+			}
+		}
+	}
+	return buf, nil
+}
+
+// sendData sends the data of a read as Data-In PDUs, the last of which
+// carries the good status.
+func (c *conn) sendData(p *pdu, data []byte) error {
+	expected := int(p.field(20))
+	flags := byte(0)
+	residual := 0
+	if len(data) > expected {
+		flags = 0x04 // overflow
+		residual = len(data) - expected
+		data = data[:expected]
+	} else if len(data) < expected {
+		flags = 0x02 // underflow
+		residual = expected - len(data)
+	}
+	if len(data) == 0 {
+		r := newPDU(opSCSIResp, flagFinal|flags, p.itt())
+		c.setSNs(r)
+		r.setField(44, uint32(residual))
+		return c.send(r)
+	}
+	datasn := uint32(0)
+	burst := 0
+	for off := 0; off < len(data); {
+		n := len(data) - off
+		if n > c.maxSendSeg {
+			n = c.maxSendSeg
+		}
+		last := off+n == len(data)
+		burst += n
+		d := newPDU(opDataIn, 0, p.itt())
+		if last || burst >= c.maxBurst {
+			d.bhs[1] |= flagFinal
+			burst = 0
+		}
+		d.setField(20, noTag)
+		d.setField(36, datasn)
+		d.setField(40, uint32(off))
+		if last {
+			d.bhs[1] |= 0x01 | flags
+			d.bhs[3] = statusGood
+			d.setField(44, uint32(residual))
+			c.setSNs(d)
+		} else {
+			c.setCmdSNs(d)
+		}
+		d.data = data[off : off+n]
+		if err := c.send(d); err != nil {
+			return err
+		}
+		datasn++
+		off += n
+	}
+	return nil
+}
+
+// respond sends the status of a command, with sense data for a check
+// condition.
+func (c *conn) respond(p *pdu, status byte, sense []byte) error {
+	r := newPDU(opSCSIResp, flagFinal, p.itt())
+	r.bhs[3] = status
+	c.setSNs(r)
+	if sense != nil {
+		r.data = make([]byte, 2+len(sense))
+		binary.BigEndian.PutUint16(r.data, uint16(len(sense)))
+		copy(r.data[2:], sense)
+	}
+	return c.send(r)
+}
@@ -0,0 +1,427 @@
+package iscsi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+type memDevice struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (m *memDevice) ReadAt(b []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copy(b, m.data[off:]), nil
+}
+
+func (m *memDevice) WriteAt(b []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copy(m.data[off:], b), nil
+}
+
+func (m *memDevice) Trim(off, length int64) error {
+	_, err := m.WriteAt(make([]byte, length), off)
+	return err
+}
+
+func (m *memDevice) Sync() error  { return nil }
+func (m *memDevice) Size() uint64 { return uint64(len(m.data)) }
+func (m *memDevice) Close() error { return nil }
+
+const (
+	testTarget = "iqn.2016-06.com.coreos:torus.test"
+	testUser   = "initiator"
+	testSecret = "secretsecret"
+)
+
+// initiator is just enough of an iSCSI initiator to drive the target.
+type initiator struct {
+	t      *testing.T
+	c      net.Conn
+	name   string
+	isid   byte
+	cmdSN  uint32
+	itt    uint32
+	status byte
+}
+
+func dial(t *testing.T, tg *Target, name string, isid byte) *initiator {
+	c, err := net.Dial("tcp", tg.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &initiator{t: t, c: c, name: name, isid: isid, cmdSN: 1}
+}
+
+func (in *initiator) loginPDU(csg, nsg byte, transit bool, keys *textPairs) *pdu {
+	p := newPDU(opLoginReq|flagImmediate, csg<<2|nsg, in.itt)
+	if transit {
+		p.bhs[1] |= 0x80
+	}
+	p.bhs[13] = in.isid
+	p.setField(24, in.cmdSN)
+	p.data = keys.bytes()
+	if err := p.writeTo(in.c); err != nil {
+		in.t.Fatal(err)
+	}
+	r, err := readPDU(in.c)
+	if err != nil {
+		in.t.Fatal(err)
+	}
+	return r
+}
+
+// login logs in with CHAP, returning the login status.
+func (in *initiator) login(secret string) uint16 {
+	keys := &textPairs{}
+	keys.add("InitiatorName", in.name)
+	keys.add("SessionType", "Normal")
+	keys.add("TargetName", testTarget)
+	keys.add("AuthMethod", "CHAP,None")
+	r := in.loginPDU(stageSecurity, stageOperational, true, keys)
+	if r.bhs[36] != 0 {
+		return uint16(r.bhs[36])<<8 | uint16(r.bhs[37])
+	}
+	keys = &textPairs{}
+	keys.add("CHAP_A", "5")
+	r = in.loginPDU(stageSecurity, stageOperational, false, keys)
+	got, _ := parseText(r.data)
+	id, _ := strconv.Atoi(got.values["CHAP_I"])
+	challenge, _ := decodeCHAP(got.values["CHAP_C"])
+	keys = &textPairs{}
+	keys.add("CHAP_N", testUser)
+	keys.add("CHAP_R", "0x"+hex.EncodeToString(chapResponse(byte(id), secret, challenge)))
+	r = in.loginPDU(stageSecurity, stageOperational, true, keys)
+	if r.bhs[36] != 0 {
+		return uint16(r.bhs[36])<<8 | uint16(r.bhs[37])
+	}
+	keys = &textPairs{}
+	keys.add("HeaderDigest", "None")
+	keys.add("DataDigest", "None")
+	keys.add("ImmediateData", "Yes")
+	keys.add("MaxRecvDataSegmentLength", "4096")
+	keys.add("MaxBurstLength", "8192")
+	r = in.loginPDU(stageOperational, stageFullFeature, true, keys)
+	if r.bhs[1]&0x83 != 0x83 {
+		in.t.Fatalf("expected to go to the full feature phase, got flags %#x", r.bhs[1])
+	}
+	return uint16(r.bhs[36])<<8 | uint16(r.bhs[37])
+}
+
+// command runs a SCSI command on LUN 0, sending data with the command up to
+// immediate bytes and the rest as asked for, and returns the data read.
+func (in *initiator) command(cdb []byte, out []byte, immediate int, readLen int) []byte {
+	in.itt++
+	p := newPDU(opSCSICmd, flagFinal, in.itt)
+	if out != nil {
+		p.bhs[1] |= 0x20
+		p.setField(20, uint32(len(out)))
+		if immediate > len(out) {
+			immediate = len(out)
+		}
+		p.data = out[:immediate]
+	} else {
+		p.bhs[1] |= 0x40
+		p.setField(20, uint32(readLen))
+	}
+	p.setField(24, in.cmdSN)
+	in.cmdSN++
+	copy(p.bhs[32:48], cdb)
+	if err := p.writeTo(in.c); err != nil {
+		in.t.Fatal(err)
+	}
+	var data []byte
+	for {
+		r, err := readPDU(in.c)
+		if err != nil {
+			in.t.Fatal(err)
+		}
+		switch r.opcode() {
+		case opR2T:
+			off := int(r.field(40))
+			n := int(r.field(44))
+			for sent := 0; sent < n; {
+				m := n - sent
+				if m > 4096 {
+					m = 4096
+				}
+				d := newPDU(opDataOut, 0, in.itt)
+				if sent+m == n {
+					d.bhs[1] = flagFinal
+				}
+				d.setField(20, r.ttt())
+				d.setField(40, uint32(off+sent))
+				d.data = out[off+sent : off+sent+m]
+				if err := d.writeTo(in.c); err != nil {
+					in.t.Fatal(err)
+				}
+				sent += m
+			}
+		case opDataIn:
+			data = append(data, r.data...)
+			if r.bhs[1]&0x01 != 0 {
+				in.status = r.bhs[3]
+				return data
+			}
+		case opSCSIResp:
+			in.status = r.bhs[3]
+			return data
+		default:
+			in.t.Fatalf("unexpected opcode %#x", r.opcode())
+		}
+	}
+}
+
+func rw10(op byte, lba uint32, n uint16) []byte {
+	cdb := make([]byte, 16)
+	cdb[0] = op
+	binary.BigEndian.PutUint32(cdb[2:6], lba)
+	binary.BigEndian.PutUint16(cdb[7:9], n)
+	return cdb
+}
+
+func prOut(action, typ byte, key, saKey uint64) ([]byte, []byte) {
+	cdb := make([]byte, 16)
+	cdb[0] = scsiPROut
+	cdb[1] = action
+	cdb[2] = typ
+	cdb[8] = 24
+	params := make([]byte, 24)
+	binary.BigEndian.PutUint64(params[0:8], key)
+	binary.BigEndian.PutUint64(params[8:16], saKey)
+	return cdb, params
+}
+
+func newTestTarget(t *testing.T) (*Target, *memDevice) {
+	dev := &memDevice{data: make([]byte, 1<<20)}
+	return newStoreTarget(t, dev, nil), dev
+}
+
+func newStoreTarget(t *testing.T, dev *memDevice, store ReservationStore) *Target {
+	cfg := Config{Name: testTarget, CHAPUser: testUser, CHAPSecret: testSecret}
+	tg, err := NewTarget("127.0.0.1:0", cfg, []*LUN{{Name: "vol", Device: dev, BlockSize: 4096, Store: store}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tg.Serve()
+	return tg
+}
+
+// memStore is a ReservationStore shared by the targets of a test.
+type memStore struct {
+	mu      sync.Mutex
+	data    []byte
+	version int64
+}
+
+func (m *memStore) GetReservations() ([]byte, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data, m.version, nil
+}
+
+func (m *memStore) SaveReservations(data []byte, version int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if version != m.version {
+		return 0, torus.ErrCompareFailed
+	}
+	m.data = data
+	m.version++
+	return m.version, nil
+}
+
+func TestLoginAndReadWrite(t *testing.T) {
+	tg, dev := newTestTarget(t)
+	defer tg.Close()
+
+	bad := dial(t, tg, "iqn.1994-05.com.example:bad", 1)
+	if st := bad.login("wrongwrongwrong"); st != loginAuthFailed {
+		t.Errorf("expected a bad secret to fail authentication, got status %04x", st)
+	}
+	bad.c.Close()
+
+	// Reserved stages don't skip authentication.
+	for _, csg := range []byte{2, stageFullFeature} {
+		skip := dial(t, tg, "iqn.1994-05.com.example:skip", 2)
+		keys := &textPairs{}
+		keys.add("InitiatorName", skip.name)
+		keys.add("TargetName", testTarget)
+		r := skip.loginPDU(csg, stageFullFeature, true, keys)
+		if st := uint16(r.bhs[36])<<8 | uint16(r.bhs[37]); st != loginInitiatorError {
+			t.Errorf("expected a login from stage %d to be refused, got status %04x", csg, st)
+		}
+		skip.c.Close()
+	}
+
+	in := dial(t, tg, "iqn.1994-05.com.example:a", 1)
+	defer in.c.Close()
+	if st := in.login(testSecret); st != 0 {
+		t.Fatalf("login failed with status %04x", st)
+	}
+	inq := in.command([]byte{scsiInquiry, 0, 0, 0, 96}, nil, 0, 96)
+	if in.status != statusGood || string(inq[16:24]) != "TorusBlk" {
+		t.Fatalf("unexpected inquiry data %q", inq)
+	}
+
+	// Bigger than a burst, so it takes several R2Ts after the immediate
+	// data.
+	data := make([]byte, 40*sectorSize)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	in.command(rw10(scsiWrite10, 8, 40), data, 1024, 0)
+	if in.status != statusGood {
+		t.Fatalf("write failed with status %#x", in.status)
+	}
+	if !bytes.Equal(dev.data[8*sectorSize:48*sectorSize], data) {
+		t.Error("write didn't reach the device")
+	}
+	got := in.command(rw10(scsiRead10, 8, 40), nil, 0, len(data))
+	if in.status != statusGood || !bytes.Equal(got, data) {
+		t.Error("read back different data")
+	}
+	in.command(rw10(scsiRead10, 2040, 16), nil, 0, 16*sectorSize)
+	if in.status != statusCheckCondition {
+		t.Errorf("expected a read past the end to fail, got status %#x", in.status)
+	}
+
+	// Unmapping part of a device block zeroes it too.
+	unmap := make([]byte, 24)
+	binary.BigEndian.PutUint16(unmap[0:2], 22)
+	binary.BigEndian.PutUint16(unmap[2:4], 16)
+	binary.BigEndian.PutUint64(unmap[8:16], 10)
+	binary.BigEndian.PutUint32(unmap[16:20], 20)
+	cdb := make([]byte, 16)
+	cdb[0] = scsiUnmap
+	cdb[8] = 24
+	in.command(cdb, unmap, 24, 0)
+	got = in.command(rw10(scsiRead10, 8, 40), nil, 0, len(data))
+	if in.status != statusGood || !bytes.Equal(got[2*sectorSize:22*sectorSize], make([]byte, 20*sectorSize)) ||
+		!bytes.Equal(got[22*sectorSize:], data[22*sectorSize:]) {
+		t.Error("expected exactly the unmapped range to read as zeros")
+	}
+}
+
+func TestPersistentReservations(t *testing.T) {
+	tg, _ := newTestTarget(t)
+	defer tg.Close()
+	a := dial(t, tg, "iqn.1994-05.com.example:a", 1)
+	defer a.c.Close()
+	b := dial(t, tg, "iqn.1994-05.com.example:b", 2)
+	defer b.c.Close()
+	for _, in := range []*initiator{a, b} {
+		if st := in.login(testSecret); st != 0 {
+			t.Fatalf("login failed with status %04x", st)
+		}
+	}
+	block := make([]byte, sectorSize)
+
+	cdb, params := prOut(0, 0, 0, 0xaa)
+	a.command(cdb, params, 24, 0)
+	cdb, params = prOut(0, 0, 0, 0xbb)
+	b.command(cdb, params, 24, 0)
+	cdb, params = prOut(1, prWriteExclusive, 0xaa, 0)
+	a.command(cdb, params, 24, 0)
+	if a.status != statusGood {
+		t.Fatalf("reserve failed with status %#x", a.status)
+	}
+
+	b.command(rw10(scsiWrite10, 0, 1), block, 0, 0)
+	if b.status != statusReservationConflict {
+		t.Errorf("expected a write from the other initiator to conflict, got status %#x", b.status)
+	}
+	b.command(rw10(scsiRead10, 0, 1), nil, 0, sectorSize)
+	if b.status != statusGood {
+		t.Errorf("expected reads to be allowed under write exclusive, got status %#x", b.status)
+	}
+	cdb, params = prOut(1, prWriteExclusive, 0xbb, 0)
+	b.command(cdb, params, 24, 0)
+	if b.status != statusReservationConflict {
+		t.Errorf("expected a second reservation to conflict, got status %#x", b.status)
+	}
+
+	// b takes over, as a cluster does when a node dies.
+	cdb, params = prOut(4, prWriteExclusive, 0xbb, 0xaa)
+	b.command(cdb, params, 24, 0)
+	if b.status != statusGood {
+		t.Fatalf("preempt failed with status %#x", b.status)
+	}
+	b.command(rw10(scsiWrite10, 0, 1), block, sectorSize, 0)
+	if b.status != statusGood {
+		t.Errorf("expected the new holder to write, got status %#x", b.status)
+	}
+	a.command(rw10(scsiWrite10, 0, 1), block, sectorSize, 0)
+	if a.status != statusReservationConflict {
+		t.Errorf("expected the preempted initiator to conflict, got status %#x", a.status)
+	}
+
+	cdb = make([]byte, 16)
+	cdb[0] = scsiPRIn
+	cdb[8] = 255
+	keys := a.command(cdb, nil, 0, 255)
+	if len(keys) != 16 || binary.BigEndian.Uint32(keys[4:8]) != 8 || binary.BigEndian.Uint64(keys[8:16]) != 0xbb {
+		t.Errorf("expected only b's key to be left, got %x", keys)
+	}
+	cdb[1] = 1
+	res := a.command(cdb, nil, 0, 255)
+	if len(res) != 24 || binary.BigEndian.Uint64(res[8:16]) != 0xbb || res[21] != prWriteExclusive {
+		t.Errorf("expected b to hold the reservation, got %x", res)
+	}
+}
+
+func TestStoredReservations(t *testing.T) {
+	dev := &memDevice{data: make([]byte, 1<<20)}
+	store := &memStore{}
+	tg1 := newStoreTarget(t, dev, store)
+	defer tg1.Close()
+	a := dial(t, tg1, "iqn.1994-05.com.example:a", 1)
+	defer a.c.Close()
+	if st := a.login(testSecret); st != 0 {
+		t.Fatalf("login failed with status %04x", st)
+	}
+	cdb, params := prOut(0, 0, 0, 0xaa)
+	a.command(cdb, params, 24, 0)
+	cdb, params = prOut(1, prExclusiveAccess, 0xaa, 0)
+	a.command(cdb, params, 24, 0)
+	if a.status != statusGood {
+		t.Fatalf("reserve failed with status %#x", a.status)
+	}
+
+	// Another target exporting the volume, or this one after a restart,
+	// sees the reservation.
+	tg2 := newStoreTarget(t, dev, store)
+	defer tg2.Close()
+	b := dial(t, tg2, "iqn.1994-05.com.example:b", 2)
+	defer b.c.Close()
+	if st := b.login(testSecret); st != 0 {
+		t.Fatalf("login failed with status %04x", st)
+	}
+	b.command(rw10(scsiRead10, 0, 1), nil, 0, sectorSize)
+	if b.status != statusReservationConflict {
+		t.Errorf("expected a read through the other target to conflict, got status %#x", b.status)
+	}
+	cdb, params = prOut(0, 0, 0, 0xbb)
+	b.command(cdb, params, 24, 0)
+	if b.status != statusGood {
+		t.Fatalf("register failed with status %#x", b.status)
+	}
+
+	cdb = make([]byte, 16)
+	cdb[0] = scsiPRIn
+	cdb[8] = 255
+	keys := a.command(cdb, nil, 0, 255)
+	if len(keys) != 24 || binary.BigEndian.Uint32(keys[0:4]) != 2 {
+		t.Errorf("expected both keys at generation 2, got %x", keys)
+	}
+}
@@ -0,0 +1,376 @@
+package iscsi
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Login stages.
+const (
+	stageSecurity    = 0
+	stageOperational = 1
+	stageFullFeature = 3
+)
+
+// Login status classes and details, from RFC 7143 section 11.13.5.
+const (
+	loginAuthFailed      = 0x0201
+	loginNotFound        = 0x0203
+	loginMissingParam    = 0x0207
+	loginNoSession       = 0x020a
+	loginUnsupportedVers = 0x0205
+	loginInitiatorError  = 0x0200
+)
+
+const chapMD5 = "5"
+
+type loginError struct {
+	status uint16
+	msg    string
+}
+
+func (e *loginError) Error() string {
+	return fmt.Sprintf("iscsi: login failed with status %04x: %s", e.status, e.msg)
+}
+
+// chap is the progress of a CHAP exchange in the security stage.
+type chap struct {
+	method    string
+	id        byte
+	challenge []byte
+	done      bool
+}
+
+// login runs the login phase, returning once the initiator is in the full
+// feature phase.
+func (c *conn) login() error {
+	var (
+		auth    chap
+		text    []byte
+		first   = true
+		replied = make(map[string]bool)
+	)
+	for {
+		p, err := readPDU(c.c)
+		if err != nil {
+			return err
+		}
+		if p.opcode() != opLoginReq {
+			return fmt.Errorf("iscsi: expected a login request, got opcode %#x", p.opcode())
+		}
+		transit := p.bhs[1]&0x80 != 0
+		cont := p.bhs[1]&0x40 != 0
+		csg := p.bhs[1] >> 2 & 3
+		nsg := p.bhs[1] & 3
+		if first {
+			copy(c.isid[:], p.bhs[8:14])
+			c.statSN = p.field(28)
+			c.expCmdSN = p.cmdSN()
+			first = false
+			if p.bhs[3] != 0 {
+				return c.loginReject(p, &loginError{loginUnsupportedVers, "unsupported version"})
+			}
+			if tsih := uint16(p.bhs[14])<<8 | uint16(p.bhs[15]); tsih != 0 {
+				return c.loginReject(p, &loginError{loginNoSession, "adding connections to a session isn't supported"})
+			}
+		}
+		// Stage 2 is reserved, and the full feature phase is only ever
+		// the next stage. Anything else would step around authentication.
+		if csg != stageSecurity && csg != stageOperational || transit && (nsg == 2 || nsg <= csg) {
+			return c.loginReject(p, &loginError{loginInitiatorError, fmt.Sprintf("invalid login stages %d to %d", csg, nsg)})
+		}
+		text = append(text, p.data...)
+		if cont {
+			// More keys to come; acknowledge the piece.
+			if err := c.loginRespond(p, csg, csg, false, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		keys, err := parseText(text)
+		text = nil
+		if err != nil {
+			return c.loginReject(p, &loginError{loginInitiatorError, err.Error()})
+		}
+		resp := &textPairs{}
+		if err := c.loginKeys(keys, resp, csg, &auth, replied); err != nil {
+			if le, ok := err.(*loginError); ok {
+				return c.loginReject(p, le)
+			}
+			return err
+		}
+		authed := auth.done || auth.method == "None"
+		if csg == stageOperational && !authed {
+			if c.t.cfg.CHAPUser != "" {
+				return c.loginReject(p, &loginError{loginAuthFailed, "authentication is required"})
+			}
+			auth.method = "None"
+			authed = true
+		}
+		if !transit || (csg == stageSecurity && !authed) {
+			if err := c.loginRespond(p, csg, nsg, false, resp); err != nil {
+				return err
+			}
+			continue
+		}
+		if nsg == stageFullFeature {
+			if !authed || (c.t.cfg.CHAPUser != "" && !auth.done) {
+				return c.loginReject(p, &loginError{loginAuthFailed, "authentication is required"})
+			}
+			if !replied["MaxRecvDataSegmentLength"] {
+				resp.add("MaxRecvDataSegmentLength", strconv.Itoa(maxDataSegment))
+			}
+			c.tsih, err = c.t.startSession(c)
+			if err != nil {
+				return err
+			}
+		}
+		if err := c.loginRespond(p, csg, nsg, true, resp); err != nil {
+			return err
+		}
+		if nsg == stageFullFeature {
+			clog.Infof("%s logged in from %s", c.nexus, c.c.RemoteAddr())
+			return nil
+		}
+	}
+}
+
+func (c *conn) loginKeys(keys *textPairs, resp *textPairs, csg byte, auth *chap, replied map[string]bool) error {
+	if v, ok := keys.get("InitiatorName"); ok {
+		c.initiator = v
+		c.nexus = fmt.Sprintf("%s,i,0x%x", v, c.isid[:])
+	}
+	if c.initiator == "" {
+		return &loginError{loginMissingParam, "no InitiatorName"}
+	}
+	if v, ok := keys.get("SessionType"); ok {
+		c.discovery = v == "Discovery"
+	}
+	if v, ok := keys.get("TargetName"); ok && !c.discovery {
+		if v != c.t.cfg.Name {
+			return &loginError{loginNotFound, "no target " + v}
+		}
+		c.target = v
+	}
+	if c.target == "" && !c.discovery {
+		return &loginError{loginMissingParam, "no TargetName"}
+	}
+	if !c.discovery && !replied["TargetPortalGroupTag"] {
+		resp.add("TargetPortalGroupTag", "1")
+		replied["TargetPortalGroupTag"] = true
+	}
+	if csg == stageSecurity {
+		if err := c.authenticate(keys, resp, auth); err != nil {
+			return err
+		}
+	}
+	for _, k := range keys.keys {
+		v := keys.values[k]
+		switch k {
+		case "InitiatorName", "SessionType", "TargetName", "InitiatorAlias", "AuthMethod",
+			"CHAP_A", "CHAP_N", "CHAP_R", "CHAP_I", "CHAP_C":
+			continue
+		}
+		r, ok := c.negotiate(k, v)
+		if ok {
+			resp.add(k, r)
+		}
+		replied[k] = true
+	}
+	return nil
+}
+
+// negotiate returns the answer to an operational key, and whether it needs
+// one.
+func (c *conn) negotiate(k, v string) (string, bool) {
+	num := func(max int) (int, bool) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		if n > max {
+			n = max
+		}
+		return n, true
+	}
+	switch k {
+	case "HeaderDigest", "DataDigest":
+		if contains(strings.Split(v, ","), "None") {
+			return "None", true
+		}
+		return "Reject", true
+	case "MaxConnections", "MaxOutstandingR2T":
+		return "1", true
+	case "InitialR2T", "DataPDUInOrder", "DataSequenceInOrder":
+		return "Yes", true
+	case "ImmediateData":
+		return v, true
+	case "ErrorRecoveryLevel", "DefaultTime2Retain":
+		return "0", true
+	case "DefaultTime2Wait":
+		return v, true
+	case "IFMarker", "OFMarker":
+		return "No", true
+	case "IFMarkInt", "OFMarkInt":
+		return "Irrelevant", true
+	case "MaxRecvDataSegmentLength":
+		if n, ok := num(maxDataSegment); ok {
+			c.maxSendSeg = n
+		}
+		return "", false
+	case "MaxBurstLength":
+		if n, ok := num(maxDataSegment); ok {
+			c.maxBurst = n
+			return strconv.Itoa(n), true
+		}
+		return "Reject", true
+	case "FirstBurstLength":
+		if n, ok := num(65536); ok {
+			return strconv.Itoa(n), true
+		}
+		return "Reject", true
+	case "TargetAlias":
+		return "", false
+	}
+	return "NotUnderstood", true
+}
+
+// authenticate moves the CHAP exchange along; when it's done, auth.done is
+// set.
+func (c *conn) authenticate(keys *textPairs, resp *textPairs, auth *chap) error {
+	cfg := c.t.cfg
+	if v, ok := keys.get("AuthMethod"); ok && auth.method == "" {
+		offered := strings.Split(v, ",")
+		switch {
+		case cfg.CHAPUser != "" && contains(offered, "CHAP"):
+			auth.method = "CHAP"
+		case cfg.CHAPUser == "" && contains(offered, "None"):
+			auth.method = "None"
+		default:
+			return &loginError{loginAuthFailed, "no acceptable AuthMethod in " + v}
+		}
+		resp.add("AuthMethod", auth.method)
+	}
+	if auth.method != "CHAP" {
+		return nil
+	}
+	if v, ok := keys.get("CHAP_A"); ok {
+		if !contains(strings.Split(v, ","), chapMD5) {
+			return &loginError{loginAuthFailed, "CHAP with MD5 is required"}
+		}
+		auth.challenge = make([]byte, 16)
+		id := make([]byte, 1)
+		if _, err := rand.Read(auth.challenge); err != nil {
+			return err
+		}
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		auth.id = id[0]
+		resp.add("CHAP_A", chapMD5)
+		resp.add("CHAP_I", strconv.Itoa(int(auth.id)))
+		resp.add("CHAP_C", "0x"+hex.EncodeToString(auth.challenge))
+		return nil
+	}
+	name, ok := keys.get("CHAP_N")
+	if !ok {
+		return nil
+	}
+	if auth.challenge == nil {
+		return &loginError{loginAuthFailed, "CHAP response before a challenge"}
+	}
+	r, _ := keys.get("CHAP_R")
+	got, err := decodeCHAP(r)
+	if err != nil || name != cfg.CHAPUser || !bytes.Equal(got, chapResponse(auth.id, cfg.CHAPSecret, auth.challenge)) {
+		return &loginError{loginAuthFailed, "bad CHAP credentials for " + name}
+	}
+	// The initiator may want us to authenticate too.
+	if ci, ok := keys.get("CHAP_I"); ok {
+		cc, _ := keys.get("CHAP_C")
+		id, err := strconv.Atoi(ci)
+		challenge, cerr := decodeCHAP(cc)
+		switch {
+		case cfg.MutualUser == "":
+			return &loginError{loginAuthFailed, "mutual CHAP isn't configured"}
+		case err != nil || id < 0 || id > 255 || cerr != nil || len(challenge) == 0:
+			return &loginError{loginAuthFailed, "malformed CHAP challenge"}
+		case bytes.Equal(challenge, auth.challenge):
+			return &loginError{loginAuthFailed, "CHAP challenge reflected"}
+		}
+		resp.add("CHAP_N", cfg.MutualUser)
+		resp.add("CHAP_R", "0x"+hex.EncodeToString(chapResponse(byte(id), cfg.MutualSecret, challenge)))
+	}
+	auth.done = true
+	return nil
+}
+
+func chapResponse(id byte, secret string, challenge []byte) []byte {
+	h := md5.New()
+	h.Write([]byte{id})
+	h.Write([]byte(secret))
+	h.Write(challenge)
+	return h.Sum(nil)
+}
+
+var errBadCHAPValue = errors.New("iscsi: malformed CHAP value")
+
+// decodeCHAP decodes the hex (0x) or base64 (0b) encoded CHAP values.
+func decodeCHAP(v string) ([]byte, error) {
+	if len(v) < 2 {
+		return nil, errBadCHAPValue
+	}
+	switch strings.ToLower(v[:2]) {
+	case "0x":
+		return hex.DecodeString(v[2:])
+	case "0b":
+		return base64.StdEncoding.DecodeString(v[2:])
+	}
+	return nil, errBadCHAPValue
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *conn) loginRespond(req *pdu, csg, nsg byte, transit bool, keys *textPairs) error {
+	p := newPDU(opLoginResp, csg<<2, req.itt())
+	if transit {
+		p.bhs[1] |= 0x80 | nsg
+	}
+	copy(p.bhs[8:14], c.isid[:])
+	if transit && nsg == stageFullFeature {
+		p.bhs[14] = byte(c.tsih >> 8)
+		p.bhs[15] = byte(c.tsih)
+	}
+	c.setSNs(p)
+	if keys != nil {
+		p.data = keys.bytes()
+	}
+	return p.writeTo(c.c)
+}
+
+// loginReject sends the failed status of a login and returns the error to
+// end the connection with.
+func (c *conn) loginReject(req *pdu, le *loginError) error {
+	p := newPDU(opLoginResp, 0, req.itt())
+	copy(p.bhs[8:14], c.isid[:])
+	c.setSNs(p)
+	p.bhs[36] = byte(le.status >> 8)
+	p.bhs[37] = byte(le.status)
+	if err := p.writeTo(c.c); err != nil {
+		return err
+	}
+	return le
+}
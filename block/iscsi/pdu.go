@@ -0,0 +1,152 @@
+package iscsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Opcodes, from RFC 7143 section 11.
+const (
+	opNopOut      = 0x00
+	opSCSICmd     = 0x01
+	opTaskMgmt    = 0x02
+	opLoginReq    = 0x03
+	opTextReq     = 0x04
+	opDataOut     = 0x05
+	opLogoutReq   = 0x06
+	opNopIn       = 0x20
+	opSCSIResp    = 0x21
+	opTaskResp    = 0x22
+	opLoginResp   = 0x23
+	opTextResp    = 0x24
+	opDataIn      = 0x25
+	opLogoutResp  = 0x26
+	opR2T         = 0x31
+	opReject      = 0x3f
+	flagFinal     = 0x80
+	flagImmediate = 0x40
+	noTag         = 0xffffffff
+	bhsLen        = 48
+	// maxDataSegment is the longest data segment we accept, and declare as
+	// our MaxRecvDataSegmentLength.
+	maxDataSegment = 256 * 1024
+)
+
+// pdu is an iSCSI protocol data unit: the 48-byte basic header segment and
+// the data segment. Additional header segments are read and dropped.
+type pdu struct {
+	bhs  [bhsLen]byte
+	data []byte
+}
+
+func (p *pdu) opcode() byte    { return p.bhs[0] & 0x3f }
+func (p *pdu) immediate() bool { return p.bhs[0]&flagImmediate != 0 }
+func (p *pdu) final() bool     { return p.bhs[1]&flagFinal != 0 }
+func (p *pdu) lun() uint64     { return binary.BigEndian.Uint64(p.bhs[8:16]) }
+func (p *pdu) itt() uint32     { return binary.BigEndian.Uint32(p.bhs[16:20]) }
+func (p *pdu) ttt() uint32     { return binary.BigEndian.Uint32(p.bhs[20:24]) }
+func (p *pdu) cmdSN() uint32   { return binary.BigEndian.Uint32(p.bhs[24:28]) }
+
+func (p *pdu) field(off int) uint32 {
+	return binary.BigEndian.Uint32(p.bhs[off : off+4])
+}
+
+func (p *pdu) setField(off int, v uint32) {
+	binary.BigEndian.PutUint32(p.bhs[off:off+4], v)
+}
+
+func newPDU(op byte, flags byte, itt uint32) *pdu {
+	p := &pdu{}
+	p.bhs[0] = op
+	p.bhs[1] = flags
+	p.setField(16, itt)
+	return p
+}
+
+func readPDU(r io.Reader) (*pdu, error) {
+	p := &pdu{}
+	if _, err := io.ReadFull(r, p.bhs[:]); err != nil {
+		return nil, err
+	}
+	ahs := int(p.bhs[4]) * 4
+	dlen := int(p.bhs[5])<<16 | int(p.bhs[6])<<8 | int(p.bhs[7])
+	if dlen > maxDataSegment {
+		return nil, fmt.Errorf("iscsi: data segment of %d bytes is too long", dlen)
+	}
+	if ahs > 0 {
+		if _, err := io.ReadFull(r, make([]byte, ahs)); err != nil {
+			return nil, err
+		}
+	}
+	padded := (dlen + 3) &^ 3
+	if padded > 0 {
+		buf := make([]byte, padded)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		p.data = buf[:dlen]
+	}
+	return p, nil
+}
+
+func (p *pdu) writeTo(w io.Writer) error {
+	n := len(p.data)
+	p.bhs[4] = 0
+	p.bhs[5] = byte(n >> 16)
+	p.bhs[6] = byte(n >> 8)
+	p.bhs[7] = byte(n)
+	buf := make([]byte, bhsLen+(n+3)&^3)
+	copy(buf, p.bhs[:])
+	copy(buf[bhsLen:], p.data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// textPairs are the key=value pairs of login and text PDUs, in order.
+type textPairs struct {
+	keys   []string
+	values map[string]string
+}
+
+func parseText(data []byte) (*textPairs, error) {
+	t := &textPairs{values: make(map[string]string)}
+	for _, kv := range strings.Split(string(data), "\x00") {
+		if kv == "" {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("iscsi: malformed key %q", kv)
+		}
+		t.add(kv[:i], kv[i+1:])
+	}
+	return t, nil
+}
+
+func (t *textPairs) add(k, v string) {
+	if t.values == nil {
+		t.values = make(map[string]string)
+	}
+	if _, ok := t.values[k]; !ok {
+		t.keys = append(t.keys, k)
+	}
+	t.values[k] = v
+}
+
+func (t *textPairs) get(k string) (string, bool) {
+	v, ok := t.values[k]
+	return v, ok
+}
+
+func (t *textPairs) bytes() []byte {
+	var b []byte
+	for _, k := range t.keys {
+		b = append(b, k...)
+		b = append(b, '=')
+		b = append(b, t.values[k]...)
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,443 @@
+package iscsi
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// Persistent reservation types, from SPC-4 section 6.16.
+const (
+	prWriteExclusive             = 1
+	prExclusiveAccess            = 3
+	prWriteExclusiveRegistrants  = 5
+	prExclusiveAccessRegistrants = 6
+	prWriteExclusiveAll          = 7
+	prExclusiveAccessAll         = 8
+)
+
+// reservationRefresh is how stale the persistent reservations of a LUN
+// with a Store may be when a command is checked against them. The
+// PERSISTENT RESERVE commands always read them afresh.
+const reservationRefresh = time.Second
+
+// ReservationStore keeps the persistent reservations of a LUN. Torus block
+// volumes provide one that keeps them in the metadata service.
+type ReservationStore interface {
+	// GetReservations returns the saved reservations, nil if there are
+	// none, and a version that changes every time they're saved.
+	GetReservations() (data []byte, version int64, err error)
+	// SaveReservations saves the reservations if they're still at version,
+	// returning the new version. It fails with torus.ErrCompareFailed if
+	// they were saved since.
+	SaveReservations(data []byte, version int64) (int64, error)
+}
+
+// reservations are the reservations of a LUN: the persistent ones, which
+// outlive the sessions that made them, and the older kind made with
+// RESERVE, which end with the session.
+type reservations struct {
+	scsi2 string
+
+	keys       map[string]uint64
+	generation uint32
+	// holder is the nexus holding the persistent reservation, if any.
+	// With the all registrants types, every registered nexus holds it and
+	// holder is empty.
+	holder  string
+	resType byte
+
+	// version and loaded are the version and time of the persistent
+	// reservations last read from the LUN's Store.
+	version int64
+	loaded  time.Time
+}
+
+// savedReservations is how the persistent reservations are kept in a
+// ReservationStore.
+type savedReservations struct {
+	Keys       map[string]uint64 `json:"keys,omitempty"`
+	Generation uint32            `json:"generation"`
+	Holder     string            `json:"holder,omitempty"`
+	Type       byte              `json:"type,omitempty"`
+}
+
+var errReservationsChanged = errors.New("iscsi: reservations changed")
+
+// loadReservations reads the persistent reservations of the LUN from its
+// Store, if it has one and they were read longer than maxAge ago. The
+// caller holds l.mu.
+func (l *LUN) loadReservations(maxAge time.Duration) error {
+	r := &l.res
+	if l.Store == nil || maxAge > 0 && time.Since(r.loaded) < maxAge {
+		return nil
+	}
+	data, version, err := l.Store.GetReservations()
+	if err != nil {
+		clog.Errorf("%s: couldn't read persistent reservations: %v", l.Name, err)
+		return senseTargetFailure
+	}
+	var saved savedReservations
+	if data != nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			clog.Errorf("%s: bad persistent reservations: %v", l.Name, err)
+			return senseTargetFailure
+		}
+	}
+	r.keys = saved.Keys
+	r.generation = saved.Generation
+	r.holder = saved.Holder
+	r.resType = saved.Type
+	r.version = version
+	r.loaded = time.Now()
+	return nil
+}
+
+// saveReservations writes the persistent reservations of the LUN to its
+// Store, if it has one. It fails with errReservationsChanged if another
+// target saved them since they were loaded. The caller holds l.mu.
+func (l *LUN) saveReservations() error {
+	r := &l.res
+	if l.Store == nil {
+		return nil
+	}
+	data, err := json.Marshal(savedReservations{
+		Keys:       r.keys,
+		Generation: r.generation,
+		Holder:     r.holder,
+		Type:       r.resType,
+	})
+	if err != nil {
+		return err
+	}
+	version, err := l.Store.SaveReservations(data, r.version)
+	if err == torus.ErrCompareFailed {
+		return errReservationsChanged
+	}
+	if err != nil {
+		clog.Errorf("%s: couldn't save persistent reservations: %v", l.Name, err)
+		return senseTargetFailure
+	}
+	r.version = version
+	r.loaded = time.Now()
+	return nil
+}
+
+func allRegistrants(t byte) bool {
+	return t == prWriteExclusiveAll || t == prExclusiveAccessAll
+}
+
+func (r *reservations) holds(nexus string) bool {
+	if r.resType == 0 {
+		return false
+	}
+	if allRegistrants(r.resType) {
+		_, ok := r.keys[nexus]
+		return ok
+	}
+	return r.holder == nexus
+}
+
+// conflicts is whether a command from nexus is kept from the LUN by
+// another's reservation.
+func (r *reservations) conflicts(nexus string, op byte) bool {
+	var read, write bool
+	switch op {
+	case scsiInquiry, scsiReportLUNs, scsiRequestSense, scsiPRIn, scsiPROut,
+		scsiReadCapacity10, scsiServiceActionIn, scsiTestUnitReady:
+	case scsiRead6, scsiRead10, scsiRead12, scsiRead16, scsiVerify10, scsiVerify16,
+		scsiModeSense6, scsiModeSense10:
+		read = true
+	default:
+		write = true
+	}
+	if r.scsi2 != "" && r.scsi2 != nexus {
+		switch op {
+		case scsiInquiry, scsiReportLUNs, scsiRequestSense, scsiRelease6, scsiRelease10:
+			return false
+		}
+		return true
+	}
+	switch op {
+	case scsiReserve6, scsiReserve10:
+		// The two kinds don't mix.
+		return len(r.keys) != 0
+	}
+	if r.resType == 0 || r.holds(nexus) {
+		return false
+	}
+	_, registered := r.keys[nexus]
+	switch r.resType {
+	case prWriteExclusive:
+		return write
+	case prExclusiveAccess:
+		return read || write
+	case prWriteExclusiveRegistrants, prWriteExclusiveAll:
+		return write && !registered
+	case prExclusiveAccessRegistrants, prExclusiveAccessAll:
+		return (read || write) && !registered
+	}
+	return false
+}
+
+// reserve takes or gives up a RESERVE reservation.
+func (r *reservations) reserve(nexus string, take bool) error {
+	if !take {
+		if r.scsi2 == nexus {
+			r.scsi2 = ""
+		}
+		return nil
+	}
+	if r.scsi2 != "" && r.scsi2 != nexus {
+		return errConflict
+	}
+	r.scsi2 = nexus
+	return nil
+}
+
+func (l *LUN) persistentReserveIn(cdb []byte) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.loadReservations(0); err != nil {
+		return nil, err
+	}
+	r := &l.res
+	n := int(binary.BigEndian.Uint16(cdb[7:9]))
+	var b []byte
+	switch cdb[1] & 0x1f {
+	case 0: // read keys
+		nexuses := r.nexuses()
+		b = make([]byte, 8+8*len(nexuses))
+		binary.BigEndian.PutUint32(b[0:4], r.generation)
+		binary.BigEndian.PutUint32(b[4:8], uint32(8*len(nexuses)))
+		for i, nx := range nexuses {
+			binary.BigEndian.PutUint64(b[8+8*i:], r.keys[nx])
+		}
+	case 1: // read reservation
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint32(b[0:4], r.generation)
+		if r.resType != 0 {
+			d := make([]byte, 16)
+			if !allRegistrants(r.resType) {
+				binary.BigEndian.PutUint64(d[0:8], r.keys[r.holder])
+			}
+			d[13] = r.resType
+			b = append(b, d...)
+			binary.BigEndian.PutUint32(b[4:8], 16)
+		}
+	case 2: // report capabilities
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint16(b[0:2], 8)
+		b[3] = 0x80 // TMV
+		if l.Store != nil {
+			b[2] |= 0x01 // PTPL_C
+			b[3] |= 0x01 // PTPL_A
+		}
+		b[4] = 0x80 | 0x40 | 0x20 | 0x08 | 0x02
+		b[5] = 0x01
+	case 3: // read full status
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint32(b[0:4], r.generation)
+		for _, nx := range r.nexuses() {
+			id := transportID(nx)
+			d := make([]byte, 24, 24+len(id))
+			binary.BigEndian.PutUint64(d[0:8], r.keys[nx])
+			if r.holds(nx) {
+				d[12] = 0x01
+				d[13] = r.resType
+			}
+			binary.BigEndian.PutUint16(d[18:20], 1)
+			binary.BigEndian.PutUint32(d[20:24], uint32(len(id)))
+			b = append(b, append(d, id...)...)
+		}
+		binary.BigEndian.PutUint32(b[4:8], uint32(len(b)-8))
+	default:
+		return nil, senseInvalidCDB
+	}
+	return allocation(b, n), nil
+}
+
+func (r *reservations) nexuses() []string {
+	var out []string
+	for nx := range r.keys {
+		out = append(out, nx)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// transportID is the iSCSI TransportID, with the session id, of a nexus.
+func transportID(nexus string) []byte {
+	n := (len(nexus) + 1 + 3) &^ 3
+	b := make([]byte, 4+n)
+	b[0] = 0x40 | 0x05
+	binary.BigEndian.PutUint16(b[2:4], uint16(n))
+	copy(b[4:], nexus)
+	return b
+}
+
+func (c *conn) persistentReserveOut(l *LUN, p *pdu, cdb []byte) error {
+	length := int(binary.BigEndian.Uint32(cdb[5:9]))
+	if length != 24 {
+		return senseParamLength
+	}
+	params, err := c.parameters(p, length)
+	if err != nil {
+		return err
+	}
+	key := binary.BigEndian.Uint64(params[0:8])
+	saKey := binary.BigEndian.Uint64(params[8:16])
+	if params[20]&0x08 != 0 || params[20]&0x01 != 0 && l.Store == nil {
+		// Registering other initiators isn't supported, and without a
+		// Store, neither is keeping the reservations through a restart
+		// of the target. With one, they're always kept.
+		return senseInvalidParam
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.res.scsi2 != "" && l.res.scsi2 != c.nexus {
+		return errConflict
+	}
+	scope, typ := cdb[2]>>4, cdb[2]&0x0f
+	action := cdb[1] & 0x1f
+	for {
+		if err := l.loadReservations(0); err != nil {
+			return err
+		}
+		if err := l.res.out(c.nexus, action, scope, typ, key, saKey); err != nil {
+			return err
+		}
+		// Another target may have changed them in the meantime, in which
+		// case the action is done again on what it saved.
+		if err := l.saveReservations(); err != errReservationsChanged {
+			return err
+		}
+	}
+}
+
+// out does the PERSISTENT RESERVE OUT action for nexus.
+func (r *reservations) out(nexus string, action, scope, typ byte, key, saKey uint64) error {
+	if r.keys == nil {
+		r.keys = make(map[string]uint64)
+	}
+	switch action {
+	case 1, 2, 4, 5:
+		if scope != 0 {
+			return senseInvalidCDB
+		}
+		switch typ {
+		case prWriteExclusive, prExclusiveAccess, prWriteExclusiveRegistrants,
+			prExclusiveAccessRegistrants, prWriteExclusiveAll, prExclusiveAccessAll:
+		default:
+			return senseInvalidCDB
+		}
+	}
+	mine, registered := r.keys[nexus]
+	switch action {
+	case 0, 6: // register, and register and ignore existing key
+		if action == 0 && (registered && key != mine || !registered && key != 0) {
+			return errConflict
+		}
+		if saKey == 0 {
+			if !registered {
+				return nil
+			}
+			r.unregister(nexus)
+		} else {
+			r.keys[nexus] = saKey
+		}
+		r.generation++
+		return nil
+	}
+	if !registered || key != mine {
+		return errConflict
+	}
+	switch action {
+	case 1: // reserve
+		if r.resType == 0 {
+			r.resType = typ
+			if !allRegistrants(typ) {
+				r.holder = nexus
+			}
+			return nil
+		}
+		if r.holds(nexus) && r.resType == typ {
+			return nil
+		}
+		return errConflict
+	case 2: // release
+		if !r.holds(nexus) {
+			return nil
+		}
+		if r.resType != typ {
+			return senseInvalidRelease
+		}
+		r.resType = 0
+		r.holder = ""
+		return nil
+	case 3: // clear
+		r.keys = make(map[string]uint64)
+		r.resType = 0
+		r.holder = ""
+		r.generation++
+		return nil
+	case 4, 5: // preempt, and preempt and abort
+		return r.preempt(nexus, saKey, typ)
+	}
+	return senseInvalidCDB
+}
+
+func (r *reservations) unregister(nexus string) {
+	delete(r.keys, nexus)
+	if r.holder == nexus || allRegistrants(r.resType) && len(r.keys) == 0 {
+		r.resType = 0
+		r.holder = ""
+	}
+}
+
+// preempt removes the registrations with saKey, taking over the reservation
+// if it was held under that key.
+func (r *reservations) preempt(nexus string, saKey uint64, typ byte) error {
+	removeKey := func() bool {
+		found := false
+		for nx, k := range r.keys {
+			if k == saKey && nx != nexus {
+				delete(r.keys, nx)
+				found = true
+			}
+		}
+		return found
+	}
+	switch {
+	case r.resType != 0 && allRegistrants(r.resType) && saKey == 0:
+		for nx := range r.keys {
+			if nx != nexus {
+				delete(r.keys, nx)
+			}
+		}
+		r.resType = typ
+		r.holder = ""
+		if !allRegistrants(typ) {
+			r.holder = nexus
+		}
+	case r.resType != 0 && !allRegistrants(r.resType) && r.keys[r.holder] == saKey:
+		removeKey()
+		r.resType = typ
+		r.holder = ""
+		if !allRegistrants(typ) {
+			r.holder = nexus
+		}
+	case saKey == 0:
+		return senseInvalidParam
+	default:
+		if !removeKey() {
+			return errConflict
+		}
+	}
+	r.generation++
+	return nil
+}
@@ -0,0 +1,545 @@
+package iscsi
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// SCSI operation codes, from SPC-4 and SBC-3.
+const (
+	scsiTestUnitReady   = 0x00
+	scsiRequestSense    = 0x03
+	scsiRead6           = 0x08
+	scsiWrite6          = 0x0a
+	scsiInquiry         = 0x12
+	scsiReserve6        = 0x16
+	scsiRelease6        = 0x17
+	scsiModeSense6      = 0x1a
+	scsiStartStopUnit   = 0x1b
+	scsiReadCapacity10  = 0x25
+	scsiRead10          = 0x28
+	scsiWrite10         = 0x2a
+	scsiVerify10        = 0x2f
+	scsiSyncCache10     = 0x35
+	scsiWriteSame10     = 0x41
+	scsiUnmap           = 0x42
+	scsiReserve10       = 0x56
+	scsiRelease10       = 0x57
+	scsiModeSense10     = 0x5a
+	scsiPRIn            = 0x5e
+	scsiPROut           = 0x5f
+	scsiRead16          = 0x88
+	scsiWrite16         = 0x8a
+	scsiVerify16        = 0x8f
+	scsiSyncCache16     = 0x91
+	scsiWriteSame16     = 0x93
+	scsiServiceActionIn = 0x9e
+	scsiReportLUNs      = 0xa0
+	scsiRead12          = 0xa8
+	scsiWrite12         = 0xaa
+)
+
+// SCSI status codes.
+const (
+	statusGood                = 0x00
+	statusCheckCondition      = 0x02
+	statusReservationConflict = 0x18
+)
+
+// sectorSize is the logical block size of every LUN. It is what ESXi and
+// older Windows expect; the device's own block size is reported as the
+// physical block size.
+const sectorSize = 512
+
+// senseCode is a failure reported to the initiator with a check condition:
+// the sense key, additional sense code and qualifier.
+type senseCode [3]byte
+
+func (s senseCode) Error() string {
+	return "iscsi: scsi check condition"
+}
+
+// bytes is the fixed format sense data for the code.
+func (s senseCode) bytes() []byte {
+	b := make([]byte, 18)
+	b[0] = 0x70
+	b[2] = s[0]
+	b[7] = 10
+	b[12] = s[1]
+	b[13] = s[2]
+	return b
+}
+
+var (
+	senseInvalidOpcode   = senseCode{0x05, 0x20, 0x00}
+	senseLBAOutOfRange   = senseCode{0x05, 0x21, 0x00}
+	senseInvalidCDB      = senseCode{0x05, 0x24, 0x00}
+	senseLUNNotSupported = senseCode{0x05, 0x25, 0x00}
+	senseInvalidParam    = senseCode{0x05, 0x26, 0x00}
+	senseParamLength     = senseCode{0x05, 0x1a, 0x00}
+	senseInvalidRelease  = senseCode{0x05, 0x26, 0x04}
+	senseReadError       = senseCode{0x03, 0x11, 0x00}
+	senseWriteError      = senseCode{0x03, 0x0c, 0x00}
+	senseTargetFailure   = senseCode{0x04, 0x44, 0x00}
+
+	errConflict = errors.New("iscsi: reservation conflict")
+)
+
+func (c *conn) scsiCommand(p *pdu) error {
+	l := c.t.lun(p.lun())
+	data, err := c.execute(l, p)
+	switch err := err.(type) {
+	case nil:
+		return c.sendData(p, data)
+	case senseCode:
+		return c.respond(p, statusCheckCondition, err.bytes())
+	}
+	if err == errConflict {
+		return c.respond(p, statusReservationConflict, nil)
+	}
+	return err
+}
+
+// execute runs the command p on l, returning the data to send back. SCSI
+// failures are returned as a senseCode or errConflict; other errors end the
+// connection.
+func (c *conn) execute(l *LUN, p *pdu) ([]byte, error) {
+	cdb := p.bhs[32:48]
+	op := cdb[0]
+	if l == nil {
+		switch op {
+		case scsiInquiry:
+			// No device here.
+			return allocation(inquiry(0x7f), int(binary.BigEndian.Uint16(cdb[3:5]))), nil
+		case scsiReportLUNs:
+			return c.reportLUNs(cdb), nil
+		case scsiRequestSense:
+			return allocation(senseLUNNotSupported.bytes(), int(cdb[4])), nil
+		}
+		return nil, senseLUNNotSupported
+	}
+	l.mu.Lock()
+	err := l.loadReservations(reservationRefresh)
+	conflict := l.res.conflicts(c.nexus, op)
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if conflict {
+		return nil, errConflict
+	}
+	switch op {
+	case scsiTestUnitReady, scsiStartStopUnit:
+		return nil, nil
+	case scsiRequestSense:
+		return allocation(senseCode{}.bytes(), int(cdb[4])), nil
+	case scsiInquiry:
+		return l.inquiry(cdb)
+	case scsiReportLUNs:
+		return c.reportLUNs(cdb), nil
+	case scsiReadCapacity10:
+		b := make([]byte, 8)
+		last := l.sectors() - 1
+		if last > 0xffffffff {
+			last = 0xffffffff
+		}
+		binary.BigEndian.PutUint32(b[0:4], uint32(last))
+		binary.BigEndian.PutUint32(b[4:8], sectorSize)
+		return b, nil
+	case scsiServiceActionIn:
+		if cdb[1]&0x1f != 0x10 {
+			return nil, senseInvalidCDB
+		}
+		return allocation(l.readCapacity16(), int(binary.BigEndian.Uint32(cdb[10:14]))), nil
+	case scsiModeSense6, scsiModeSense10:
+		return l.modeSense(cdb)
+	case scsiRead6, scsiRead10, scsiRead12, scsiRead16:
+		return l.read(cdb)
+	case scsiWrite6, scsiWrite10, scsiWrite12, scsiWrite16:
+		return nil, c.write(l, p, cdb)
+	case scsiVerify10, scsiVerify16:
+		if cdb[1]&0x06 != 0 {
+			return nil, senseInvalidCDB
+		}
+		return nil, nil
+	case scsiSyncCache10, scsiSyncCache16:
+		if err := l.Device.Sync(); err != nil {
+			clog.Errorf("%s: sync failed: %v", l.Name, err)
+			return nil, senseWriteError
+		}
+		return nil, nil
+	case scsiUnmap:
+		return nil, c.unmap(l, p, cdb)
+	case scsiWriteSame10, scsiWriteSame16:
+		return nil, c.writeSame(l, p, cdb)
+	case scsiReserve6, scsiReserve10, scsiRelease6, scsiRelease10:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return nil, l.res.reserve(c.nexus, op == scsiReserve6 || op == scsiReserve10)
+	case scsiPRIn:
+		return l.persistentReserveIn(cdb)
+	case scsiPROut:
+		return nil, c.persistentReserveOut(l, p, cdb)
+	}
+	return nil, senseInvalidOpcode
+}
+
+func (l *LUN) sectors() uint64 {
+	return l.Device.Size() / sectorSize
+}
+
+// allocation trims data to the allocation length of a command.
+func allocation(data []byte, n int) []byte {
+	if len(data) > n {
+		return data[:n]
+	}
+	return data
+}
+
+// naa is the LUN's NAA identifier, which clustered hosts use to tell disks
+// apart, taken from its name.
+func (l *LUN) naa() []byte {
+	h := sha1.Sum([]byte(l.Name))
+	id := make([]byte, 16)
+	copy(id, h[:])
+	// NAA 6, IEEE company id 0.
+	id[0] = 0x60
+	id[1] = 0
+	id[2] = 0
+	id[3] &= 0x0f
+	return id
+}
+
+func inquiry(peripheral byte) []byte {
+	b := make([]byte, 36)
+	b[0] = peripheral
+	b[2] = 0x06 // SPC-4
+	b[3] = 0x12 // HiSup, response data format 2
+	b[4] = byte(len(b) - 5)
+	b[7] = 0x02 // CmdQue
+	copy(b[8:16], "CoreOS  ")
+	copy(b[16:32], "TorusBlk        ")
+	copy(b[32:36], "0001")
+	return b
+}
+
+func (l *LUN) inquiry(cdb []byte) ([]byte, error) {
+	n := int(binary.BigEndian.Uint16(cdb[3:5]))
+	if cdb[1]&0x01 == 0 {
+		if cdb[2] != 0 {
+			return nil, senseInvalidCDB
+		}
+		return allocation(inquiry(0), n), nil
+	}
+	var page []byte
+	switch cdb[2] {
+	case 0x00:
+		page = []byte{0x00, 0x80, 0x83, 0xb0, 0xb1, 0xb2}
+	case 0x80:
+		h := sha1.Sum([]byte(l.Name))
+		page = []byte(hex.EncodeToString(h[:8]))
+	case 0x83:
+		naa := l.naa()
+		page = append([]byte{0x01, 0x03, 0x00, byte(len(naa))}, naa...)
+		vendor := []byte("CoreOS  torus:" + l.Name)
+		if len(vendor) > 250 {
+			vendor = vendor[:250]
+		}
+		page = append(page, 0x02, 0x01, 0x00, byte(len(vendor)))
+		page = append(page, vendor...)
+	case 0xb0:
+		page = make([]byte, 60)
+		gran := l.granularity()
+		page[0] = 0x01 // WSNZ
+		binary.BigEndian.PutUint16(page[2:4], gran)
+		binary.BigEndian.PutUint32(page[4:8], maxDataSegment/sectorSize*16)
+		binary.BigEndian.PutUint32(page[8:12], maxDataSegment/sectorSize)
+		binary.BigEndian.PutUint32(page[16:20], 0xffffffff)
+		binary.BigEndian.PutUint32(page[20:24], 256)
+		binary.BigEndian.PutUint32(page[24:28], uint32(gran))
+		page[28] = 0x80 // UGAVALID, aligned at zero
+		binary.BigEndian.PutUint64(page[32:40], 0x400000)
+	case 0xb1:
+		page = make([]byte, 60)
+		binary.BigEndian.PutUint16(page[0:2], 1) // non-rotating
+	case 0xb2:
+		page = make([]byte, 4)
+		// LBPU, LBPWS, LBPWS10, LBPRZ; thin provisioned.
+		page[1] = 0x80 | 0x40 | 0x20 | 0x04
+		page[2] = 0x02
+	default:
+		return nil, senseInvalidCDB
+	}
+	b := make([]byte, 4+len(page))
+	b[1] = cdb[2]
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(page)))
+	copy(b[4:], page)
+	return allocation(b, n), nil
+}
+
+// granularity is the device's block size in sectors.
+func (l *LUN) granularity() uint16 {
+	if l.BlockSize < sectorSize {
+		return 1
+	}
+	return uint16(l.BlockSize / sectorSize)
+}
+
+func (l *LUN) readCapacity16() []byte {
+	b := make([]byte, 32)
+	binary.BigEndian.PutUint64(b[0:8], l.sectors()-1)
+	binary.BigEndian.PutUint32(b[8:12], sectorSize)
+	exp := byte(0)
+	for g := l.granularity(); g > 1; g >>= 1 {
+		exp++
+	}
+	b[13] = exp
+	b[14] = 0x80 | 0x40 // LBPME, LBPRZ
+	return b
+}
+
+func (c *conn) reportLUNs(cdb []byte) []byte {
+	n := len(c.t.luns)
+	b := make([]byte, 8+8*n)
+	binary.BigEndian.PutUint32(b[0:4], uint32(8*n))
+	for i := 0; i < n; i++ {
+		e := b[8+8*i:]
+		if i < 256 {
+			e[1] = byte(i)
+		} else {
+			e[0] = 0x40 | byte(i>>8)
+			e[1] = byte(i)
+		}
+	}
+	return allocation(b, int(binary.BigEndian.Uint32(cdb[6:10])))
+}
+
+func (l *LUN) modeSense(cdb []byte) ([]byte, error) {
+	page := cdb[2] & 0x3f
+	changeable := cdb[2]>>6 == 1
+	if cdb[3] != 0 && !(page == 0x3f && cdb[3] == 0xff) {
+		return nil, senseInvalidCDB
+	}
+	caching := make([]byte, 20)
+	caching[0], caching[1] = 0x08, 0x12
+	control := make([]byte, 12)
+	control[0], control[1] = 0x0a, 0x0a
+	if !changeable {
+		caching[2] = 0x04 // WCE; writes are cached until a sync.
+	}
+	var pages []byte
+	switch page {
+	case 0x08:
+		pages = caching
+	case 0x0a:
+		pages = control
+	case 0x3f:
+		pages = append(caching, control...)
+	default:
+		return nil, senseInvalidCDB
+	}
+	if cdb[0] == scsiModeSense6 {
+		b := append(make([]byte, 4), pages...)
+		b[0] = byte(len(b) - 1)
+		b[2] = 0x10 // DPOFUA
+		return allocation(b, int(cdb[4])), nil
+	}
+	b := append(make([]byte, 8), pages...)
+	binary.BigEndian.PutUint16(b[0:2], uint16(len(b)-2))
+	b[3] = 0x10
+	return allocation(b, int(binary.BigEndian.Uint16(cdb[7:9]))), nil
+}
+
+// rw decodes the logical block address and number of blocks of a read or
+// write command, and whether it asks for the data to be forced to storage.
+func rw(cdb []byte) (lba uint64, n uint32, fua bool) {
+	switch cdb[0] {
+	case scsiRead6, scsiWrite6:
+		lba = uint64(cdb[1]&0x1f)<<16 | uint64(cdb[2])<<8 | uint64(cdb[3])
+		n = uint32(cdb[4])
+		if n == 0 {
+			n = 256
+		}
+		return lba, n, false
+	case scsiRead10, scsiWrite10, scsiVerify10, scsiWriteSame10:
+		lba = uint64(binary.BigEndian.Uint32(cdb[2:6]))
+		n = uint32(binary.BigEndian.Uint16(cdb[7:9]))
+	case scsiRead12, scsiWrite12:
+		lba = uint64(binary.BigEndian.Uint32(cdb[2:6]))
+		n = binary.BigEndian.Uint32(cdb[6:10])
+	default:
+		lba = binary.BigEndian.Uint64(cdb[2:10])
+		n = binary.BigEndian.Uint32(cdb[10:14])
+	}
+	return lba, n, cdb[1]&0x08 != 0
+}
+
+func (l *LUN) inRange(lba uint64, n uint32) bool {
+	return lba+uint64(n) >= lba && lba+uint64(n) <= l.sectors()
+}
+
+func (l *LUN) read(cdb []byte) ([]byte, error) {
+	lba, n, _ := rw(cdb)
+	if !l.inRange(lba, n) {
+		return nil, senseLBAOutOfRange
+	}
+	buf := make([]byte, int(n)*sectorSize)
+	_, err := l.Device.ReadAt(buf, int64(lba*sectorSize))
+	if err != nil && err != io.EOF {
+		clog.Errorf("%s: read failed: %v", l.Name, err)
+		return nil, senseReadError
+	}
+	return buf, nil
+}
+
+func (c *conn) write(l *LUN, p *pdu, cdb []byte) error {
+	lba, n, fua := rw(cdb)
+	if !l.inRange(lba, n) {
+		return senseLBAOutOfRange
+	}
+	length := int(n) * sectorSize
+	if int(p.field(20)) != length {
+		return senseInvalidCDB
+	}
+	data, err := c.receiveData(p, length)
+	if err != nil {
+		return err
+	}
+	if _, err := l.Device.WriteAt(data, int64(lba*sectorSize)); err != nil {
+		clog.Errorf("%s: write failed: %v", l.Name, err)
+		return senseWriteError
+	}
+	if fua {
+		if err := l.Device.Sync(); err != nil {
+			clog.Errorf("%s: sync failed: %v", l.Name, err)
+			return senseWriteError
+		}
+	}
+	return nil
+}
+
+// parameters receives the parameter list of a command, of the length given
+// in the CDB.
+func (c *conn) parameters(p *pdu, length int) ([]byte, error) {
+	if int(p.field(20)) < length {
+		return nil, senseParamLength
+	}
+	return c.receiveData(p, length)
+}
+
+func (c *conn) unmap(l *LUN, p *pdu, cdb []byte) error {
+	data, err := c.parameters(p, int(binary.BigEndian.Uint16(cdb[7:9])))
+	if err != nil {
+		return err
+	}
+	if len(data) < 8 {
+		return nil
+	}
+	descs := data[8:]
+	if n := int(binary.BigEndian.Uint16(data[2:4])); n < len(descs) {
+		descs = descs[:n]
+	}
+	for ; len(descs) >= 16; descs = descs[16:] {
+		lba := binary.BigEndian.Uint64(descs[0:8])
+		n := binary.BigEndian.Uint32(descs[8:12])
+		if !l.inRange(lba, n) {
+			return senseLBAOutOfRange
+		}
+		if err := l.unmap(lba, n); err != nil {
+			clog.Errorf("%s: unmap failed: %v", l.Name, err)
+			return senseWriteError
+		}
+	}
+	return nil
+}
+
+// unmap frees the device blocks wholly in the range and zeroes the rest of
+// it, so that all of it reads back as zeros.
+func (l *LUN) unmap(lba uint64, n uint32) error {
+	off := int64(lba * sectorSize)
+	end := off + int64(n)*sectorSize
+	bs := int64(l.granularity()) * sectorSize
+	from := (off + bs - 1) / bs * bs
+	to := end / bs * bs
+	if from >= to {
+		return l.zero(off, end)
+	}
+	if err := l.zero(off, from); err != nil {
+		return err
+	}
+	if err := l.Device.Trim(from, to-from); err != nil {
+		return err
+	}
+	return l.zero(to, end)
+}
+
+func (l *LUN) zero(off, end int64) error {
+	if end <= off {
+		return nil
+	}
+	const chunk = 1 << 20
+	zeros := make([]byte, chunk)
+	for off < end {
+		n := end - off
+		if n > chunk {
+			n = chunk
+		}
+		if _, err := l.Device.WriteAt(zeros[:n], off); err != nil {
+			return err
+		}
+		off += n
+	}
+	return nil
+}
+
+func (c *conn) writeSame(l *LUN, p *pdu, cdb []byte) error {
+	lba, n, _ := rw(cdb)
+	if n == 0 {
+		return senseInvalidCDB
+	}
+	if !l.inRange(lba, n) {
+		return senseLBAOutOfRange
+	}
+	unmap := cdb[1]&0x08 != 0
+	block := make([]byte, sectorSize)
+	if !(cdb[0] == scsiWriteSame16 && cdb[1]&0x01 != 0) {
+		data, err := c.parameters(p, sectorSize)
+		if err != nil {
+			return err
+		}
+		block = data
+	}
+	zero := true
+	for _, b := range block {
+		if b != 0 {
+			zero = false
+			break
+		}
+	}
+	var err error
+	if unmap || zero {
+		err = l.unmap(lba, n)
+	} else {
+		const chunk = 2048
+		buf := make([]byte, 0, chunk*sectorSize)
+		for i := 0; i < chunk; i++ {
+			buf = append(buf, block...)
+		}
+		for done := uint32(0); done < n && err == nil; {
+			m := n - done
+			if m > chunk {
+				m = chunk
+			}
+			_, err = l.Device.WriteAt(buf[:m*sectorSize], int64((lba+uint64(done))*sectorSize))
+			done += m
+		}
+	}
+	if err != nil {
+		clog.Errorf("%s: write same failed: %v", l.Name, err)
+		return senseWriteError
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Package iscsi provides an iSCSI target that serves Torus block volumes, or
+// any other Device, as the LUNs of a single target, for initiators that
+// can't use NBD, such as ESXi and Windows.
+package iscsi
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "iscsi")
+
+const tcpKeepAlive = 10 * time.Second
+
+// Device is what a LUN reads and writes. torus block files satisfy it.
+type Device interface {
+	io.ReaderAt
+	io.WriterAt
+	Sync() error
+	Trim(off, len int64) error
+	Size() uint64
+	Close() error
+}
+
+// Config is how a target names and authenticates itself.
+type Config struct {
+	// Name is the target's iSCSI qualified name, such as
+	// "iqn.2016-06.com.coreos:torus.host1".
+	Name string
+	// CHAPUser and CHAPSecret, if set, are what initiators must log in
+	// with.
+	CHAPUser   string
+	CHAPSecret string
+	// MutualUser and MutualSecret, if set, are what the target answers
+	// with when an initiator asks it to authenticate too.
+	MutualUser   string
+	MutualSecret string
+}
+
+// LUN is a logical unit of the target. Name identifies it to initiators; it
+// should stay the same for the same volume, since clustered hosts such as
+// ESXi tell disks apart by it.
+type LUN struct {
+	Name   string
+	Device Device
+	// BlockSize is the device's own block size, which initiators are told
+	// to align to, or zero if it has none.
+	BlockSize uint64
+	// Store, if set, keeps the persistent reservations of the LUN, so that
+	// they outlive the target and are shared by every target exporting the
+	// device. Otherwise they're kept for as long as the target runs.
+	Store ReservationStore
+
+	// mu guards the reservations of the LUN, which are shared by every
+	// session.
+	mu  sync.Mutex
+	res reservations
+}
+
+// Target serves the LUNs over iSCSI on a TCP listener.
+type Target struct {
+	cfg  Config
+	luns []*LUN
+	l    net.Listener
+
+	mu       sync.Mutex
+	tsih     uint16
+	sessions map[string]*conn
+	closed   bool
+}
+
+var ErrNoName = errors.New("iscsi: target needs a name")
+
+// NewTarget listens on addr for initiators to log in to the target named by
+// cfg, with luns as its logical units, numbered in order from zero.
+func NewTarget(addr string, cfg Config, luns []*LUN) (*Target, error) {
+	if cfg.Name == "" {
+		return nil, ErrNoName
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Target{
+		cfg:      cfg,
+		luns:     luns,
+		l:        l,
+		sessions: make(map[string]*conn),
+	}, nil
+}
+
+// Addr is the address the target listens on.
+func (t *Target) Addr() net.Addr {
+	return t.l.Addr()
+}
+
+// Serve accepts connections until the target is closed.
+func (t *Target) Serve() error {
+	for {
+		c, err := t.l.Accept()
+		if err != nil {
+			t.mu.Lock()
+			closed := t.closed
+			t.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if tc, ok := c.(*net.TCPConn); ok {
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(tcpKeepAlive)
+		}
+		go t.serveConn(c)
+	}
+}
+
+// Close stops accepting connections and logs out every session. The
+// devices of the LUNs are left open.
+func (t *Target) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	for _, c := range t.sessions {
+		c.c.Close()
+	}
+	t.mu.Unlock()
+	return t.l.Close()
+}
+
+func (t *Target) serveConn(nc net.Conn) {
+	c := &conn{
+		t:          t,
+		c:          nc,
+		maxSendSeg: 8192,
+		maxBurst:   maxDataSegment,
+	}
+	err := c.serve()
+	if err != nil && err != io.EOF {
+		clog.Errorf("%s: %s: %v", nc.RemoteAddr(), c.initiator, err)
+	}
+	nc.Close()
+	t.endSession(c)
+}
+
+// startSession registers a logged-in session under its I_T nexus, the
+// initiator's name and session id, replacing any earlier connection of the
+// same nexus, and returns the session's handle.
+func (t *Target) startSession(c *conn) (uint16, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return 0, errors.New("iscsi: target is closed")
+	}
+	t.tsih++
+	if t.tsih == 0 {
+		t.tsih++
+	}
+	if c.discovery {
+		return t.tsih, nil
+	}
+	if old, ok := t.sessions[c.nexus]; ok {
+		clog.Infof("%s reinstated its session", c.nexus)
+		old.c.Close()
+	}
+	t.sessions[c.nexus] = c
+	return t.tsih, nil
+}
+
+func (t *Target) endSession(c *conn) {
+	if c.nexus == "" || c.discovery {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessions[c.nexus] != c {
+		// Replaced by a reinstated session of the same nexus.
+		return
+	}
+	delete(t.sessions, c.nexus)
+	// Reservations made with RESERVE go with the nexus; persistent ones
+	// stay.
+	for _, l := range t.luns {
+		l.mu.Lock()
+		if l.res.scsi2 == c.nexus {
+			l.res.scsi2 = ""
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (t *Target) lun(n uint64) *LUN {
+	// Only the single level, peripheral addressing of LUNs below 256 and
+	// flat addressing above.
+	var i uint64
+	switch n >> 62 {
+	case 0:
+		i = n >> 48 & 0xff
+	case 1:
+		i = n >> 48 & 0x3fff
+	default:
+		return nil
+	}
+	if i >= uint64(len(t.luns)) {
+		return nil
+	}
+	return t.luns[i]
+}
+
+// portalAddr is the TargetAddress of the portal a connection came in on.
+func portalAddr(local net.Addr) string {
+	return local.String() + ",1"
+}
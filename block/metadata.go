@@ -20,13 +20,16 @@ type Snapshot struct {
 type blockMetadata interface {
 	torus.MetadataService
 
-	Lock(lease int64) error
+	// Lock attaches the volume, returning the epoch of the attachment. Each
+	// attachment of a volume has a higher epoch than the last.
+	Lock(lease int64) (epoch uint64, err error)
 	Unlock() error
 
 	GetINode() (torus.INodeRef, error)
 	SyncINode(torus.INodeRef) error
 
 	CreateBlockVolume(vol *models.Volume) error
+	CreateBlockVolumes(vols []*models.Volume) error
 	DeleteVolume() error
 
 	SaveSnapshot(name string) error
@@ -34,12 +37,78 @@ type blockMetadata interface {
 	DeleteSnapshot(name string) error
 }
 
+// leasedBlockMetadata is implemented by the metadata services whose
+// attachments are renewed by the clients holding them, so that one whose
+// client has stopped renewing it can be taken over.
+type leasedBlockMetadata interface {
+	// RenewLock renews the attachment taken by Lock or ForceLock. It fails
+	// with ErrLocked if the attachment has been taken over.
+	RenewLock() error
+	// ForceLock attaches the volume as Lock does, taking the attachment
+	// over if its holder doesn't renew it for wait. It fails with ErrLocked
+	// if the holder renews it.
+	ForceLock(lease int64, wait time.Duration) (epoch uint64, err error)
+}
+
+// sharedBlockMetadata is implemented by the metadata services that can
+// attach a volume to many clients at once. A shared volume can only be
+// attached shared, and an attachment writes a range of blocks only while it
+// holds the range's lock.
+type sharedBlockMetadata interface {
+	// SetShared makes the volume shared, or not. A volume can't be made
+	// shared while it's attached, nor unshared while any client has it
+	// attached; either fails with ErrLocked.
+	SetShared(shared bool) error
+	IsShared() (bool, error)
+
+	// AttachShared attaches a shared volume for as long as lease lasts. It
+	// fails with ErrInvalid if the volume isn't shared, and with ErrLocked
+	// if this client has already attached it.
+	AttachShared(lease int64) error
+	DetachShared() error
+
+	// LockBlocks takes the lock on blocks [from, to) of the volume for as
+	// long as lease lasts, or until UnlockBlocks. It fails with ErrLocked if
+	// another attachment holds any of them. At most maxLockBlocks can be
+	// locked at once.
+	LockBlocks(lease int64, from, to int) error
+	UnlockBlocks(from, to int) error
+
+	// GetSharedINode returns the volume's INode, with a version that
+	// changes every time it's synced.
+	GetSharedINode() (ref torus.INodeRef, version int64, err error)
+	// SyncSharedINode syncs the volume's INode if it's still at version,
+	// returning the new version. If another attachment synced it first, it
+	// fails with ErrCompareFailed; if this client is no longer attached,
+	// with ErrLocked.
+	SyncSharedINode(ref torus.INodeRef, version int64) (int64, error)
+}
+
+// reservationBlockMetadata is implemented by the metadata services that
+// keep the SCSI persistent reservations of a volume for the targets that
+// export it.
+type reservationBlockMetadata interface {
+	// GetReservations returns the volume's saved reservations, nil if it
+	// has none, and a version that changes every time they're saved.
+	GetReservations() (data []byte, version int64, err error)
+	// SaveReservations saves the volume's reservations if they're still at
+	// version, returning the new version. If they were saved since, it
+	// fails with ErrCompareFailed.
+	SaveReservations(data []byte, version int64) (int64, error)
+}
+
+// maxLockBlocks is the most blocks LockBlocks takes at once. Each block is
+// one operation of the transaction, and etcd allows 128 by default.
+const maxLockBlocks = 64
+
 func createBlockMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (blockMetadata, error) {
 	switch mds.Kind() {
 	case torus.EtcdMetadata:
 		return createBlockEtcdMetadata(mds, name, vid)
 	case torus.TempMetadata:
 		return createBlockTempMetadata(mds, name, vid)
+	case torus.ConsulMetadata:
+		return createBlockConsulMetadata(mds, name, vid)
 	default:
 		return nil, errors.New("unimplemented for this kind of metadata")
 	}
@@ -0,0 +1,19 @@
+package block
+
+import "github.com/coreos/torus"
+
+// refreshReadahead sets the file's readahead window from the volume's. Like
+// the inode sync policy, it is read again now and then so that changes apply
+// to volumes that are already attached.
+func (f *BlockFile) refreshReadahead() {
+	rmds, ok := f.vol.srv.MDS.(torus.ReadaheadMetadataService)
+	if !ok {
+		return
+	}
+	bytes, err := rmds.GetReadahead(torus.VolumeID(f.vol.volume.Id))
+	if err != nil {
+		clog.Warningf("couldn't get readahead of %s: %v", f.vol.volume.Name, err)
+		return
+	}
+	f.SetReadahead(bytes)
+}
@@ -0,0 +1,36 @@
+package block
+
+import "github.com/coreos/torus"
+
+// Reservations keeps the SCSI persistent reservations of a volume in the
+// metadata service, so that they survive a restart of the target exporting
+// it, and are seen by every target exporting it. It's an iscsi
+// ReservationStore.
+type Reservations struct {
+	vol  *BlockVolume
+	rmds reservationBlockMetadata
+}
+
+// Reservations returns the volume's persistent reservations. It fails with
+// ErrNotSupported if the metadata service can't keep them.
+func (s *BlockVolume) Reservations() (*Reservations, error) {
+	rmds, ok := s.mds.(reservationBlockMetadata)
+	if !ok {
+		return nil, torus.ErrNotSupported
+	}
+	return &Reservations{vol: s, rmds: rmds}, nil
+}
+
+func (r *Reservations) GetReservations() ([]byte, int64, error) {
+	if err := r.vol.checkAccess(torus.PermRead); err != nil {
+		return nil, 0, err
+	}
+	return r.rmds.GetReservations()
+}
+
+func (r *Reservations) SaveReservations(data []byte, version int64) (int64, error) {
+	if err := r.vol.checkAccess(torus.PermWrite); err != nil {
+		return 0, err
+	}
+	return r.rmds.SaveReservations(data, version)
+}
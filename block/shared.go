@@ -0,0 +1,344 @@
+package block
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A shared volume can be attached by many clients at once, for clustered
+// filesystems such as OCFS2 and GFS2 that coordinate their own writes. Each
+// write takes the locks of the blocks it touches, applies itself to the
+// volume as last synced, and syncs the volume's INode right away, so that
+// it's seen by every attachment once it returns. The INode is synced with a
+// compare-and-swap; if another attachment synced first, having written
+// other blocks under their own locks, the write is applied again on top of
+// its INode. Reads take no locks, but load the volume's INode again if it
+// has changed.
+//
+// Every write costs a metadata transaction and an INode, so shared volumes
+// are much slower to write than ones attached to a single client.
+
+var (
+	promSharedLockWaits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_block_shared_lock_waits_total",
+		Help: "Number of times a write to a shared volume waited for another attachment's block locks",
+	})
+	promSharedRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_block_shared_retries_total",
+		Help: "Number of times a write to a shared volume was applied again because another attachment synced first",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promSharedLockWaits)
+	prometheus.MustRegister(promSharedRetries)
+}
+
+// sharedLockTimeout is how long a write waits for the locks of its blocks
+// before failing with ErrLocked.
+var sharedLockTimeout = 30 * time.Second
+
+// sharedMetadata returns the shared metadata of block volume name.
+func sharedMetadata(mds torus.MetadataService, name string) (sharedBlockMetadata, error) {
+	vol, err := mds.GetVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	if vol.Type != VolumeType {
+		return nil, errors.New("only block volumes can be shared")
+	}
+	bmds, err := createBlockMetadata(mds, vol.Name, torus.VolumeID(vol.Id))
+	if err != nil {
+		return nil, err
+	}
+	smds, ok := bmds.(sharedBlockMetadata)
+	if !ok {
+		return nil, torus.ErrNotSupported
+	}
+	return smds, nil
+}
+
+// SetShared sets whether volume name can be attached by many clients at
+// once, and only that way. It fails with ErrLocked if the volume is
+// attached.
+func SetShared(mds torus.MetadataService, name string, shared bool) error {
+	smds, err := sharedMetadata(mds, name)
+	if err != nil {
+		return err
+	}
+	return smds.SetShared(shared)
+}
+
+// IsShared returns whether volume name is shared.
+func IsShared(mds torus.MetadataService, name string) (bool, error) {
+	smds, err := sharedMetadata(mds, name)
+	if err == torus.ErrNotSupported {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return smds.IsShared()
+}
+
+// Shared returns whether the volume is shared.
+func (s *BlockVolume) Shared() (bool, error) {
+	smds, ok := s.mds.(sharedBlockMetadata)
+	if !ok {
+		return false, nil
+	}
+	return smds.IsShared()
+}
+
+// SharedBlockFile is an attachment of a shared volume.
+type SharedBlockFile struct {
+	vol  *BlockVolume
+	smds sharedBlockMetadata
+
+	mut  sync.Mutex
+	file *torus.File
+	// version is the version of the volume's INode that file was loaded from.
+	version int64
+}
+
+// OpenSharedBlockFile attaches a shared volume. It fails with ErrInvalid if
+// the volume isn't shared.
+func (s *BlockVolume) OpenSharedBlockFile() (f *SharedBlockFile, err error) {
+	if s.volume.Type != VolumeType {
+		panic("Wrong type")
+	}
+	smds, ok := s.mds.(sharedBlockMetadata)
+	if !ok {
+		return nil, torus.ErrNotSupported
+	}
+	if err = s.checkAccess(torus.PermWrite); err != nil {
+		return nil, err
+	}
+	if err = smds.AttachShared(s.srv.Lease()); err != nil {
+		return nil, err
+	}
+	f = &SharedBlockFile{
+		vol:  s,
+		smds: smds,
+	}
+	if err = f.refresh(); err != nil {
+		smds.DetachShared()
+		return nil, err
+	}
+	return f, nil
+}
+
+// refresh loads the volume's INode again if another attachment has synced
+// it since it was last loaded. The caller holds f.mut.
+func (f *SharedBlockFile) refresh() error {
+	ref, version, err := f.smds.GetSharedINode()
+	if err != nil {
+		return err
+	}
+	if f.file != nil && version == f.version {
+		return nil
+	}
+	s := f.vol
+	inode, err := s.getOrCreateBlockINode(ref)
+	if err != nil {
+		return err
+	}
+	bs, err := blockset.UnmarshalFromProto(inode.GetBlocks(), s.srv.Blocks)
+	if err != nil {
+		return err
+	}
+	file, err := s.srv.CreateFile(s.volume, inode, bs)
+	if err != nil {
+		return err
+	}
+	file.IOClass = s.IOClass
+	if file.Size() != s.volume.MaxBytes {
+		err = file.Truncate(int64(s.volume.MaxBytes))
+		if err != nil {
+			return err
+		}
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.version = version
+	return nil
+}
+
+// blockRange returns the blocks [from, to) that bytes [off, off+length) of
+// the volume fall in.
+func (f *SharedBlockFile) blockRange(off, length int64) (from, to int) {
+	bs := int64(f.vol.srv.MDS.GlobalMetadata().BlockSize)
+	return int(off / bs), int((off+length-1)/bs) + 1
+}
+
+// lockBlocks takes the locks of blocks [from, to), waiting up to
+// sharedLockTimeout for other attachments to release them. Every attachment
+// takes them in increasing order, maxLockBlocks at a time, so that none
+// waits on another that's waiting on it.
+func (f *SharedBlockFile) lockBlocks(from, to int) error {
+	deadline := time.Now().Add(sharedLockTimeout)
+	for start := from; start < to; start += maxLockBlocks {
+		end := start + maxLockBlocks
+		if end > to {
+			end = to
+		}
+		wait := time.Millisecond
+		for {
+			err := f.smds.LockBlocks(f.vol.srv.Lease(), start, end)
+			if err == nil {
+				break
+			}
+			if err != torus.ErrLocked || time.Now().After(deadline) {
+				if start > from {
+					f.unlockBlocks(from, start)
+				}
+				return err
+			}
+			promSharedLockWaits.Inc()
+			time.Sleep(wait)
+			if wait < 100*time.Millisecond {
+				wait *= 2
+			}
+		}
+	}
+	return nil
+}
+
+func (f *SharedBlockFile) unlockBlocks(from, to int) {
+	for start := from; start < to; start += maxLockBlocks {
+		end := start + maxLockBlocks
+		if end > to {
+			end = to
+		}
+		err := f.smds.UnlockBlocks(start, end)
+		if err != nil {
+			clog.Warningf("couldn't unlock blocks [%d, %d) of %s, they're held until the attachment's lease runs out: %v",
+				start, end, f.vol.volume.Name, err)
+		}
+	}
+}
+
+// commit applies op to the volume as last synced and syncs the result,
+// applying it again if another attachment synced first. The caller holds
+// f.mut and the locks of every block op writes.
+func (f *SharedBlockFile) commit(op func(file *torus.File) error) error {
+	for {
+		err := f.refresh()
+		if err != nil {
+			return err
+		}
+		err = op(f.file)
+		if err == nil {
+			err = f.sync()
+		}
+		switch err {
+		case nil:
+			return nil
+		case torus.ErrCompareFailed:
+			promSharedRetries.Inc()
+			continue
+		}
+		// What was applied can't be trusted; load the INode afresh next
+		// time.
+		f.file.Close()
+		f.file = nil
+		return err
+	}
+}
+
+func (f *SharedBlockFile) sync() error {
+	if !f.file.WriteOpen() {
+		return nil
+	}
+	err := f.file.SyncBlocks()
+	if err != nil {
+		return err
+	}
+	ref, err := f.file.SyncINode(torus.WithWriteLevel(f.vol.getContext(), torus.WriteAll))
+	if err != nil {
+		return err
+	}
+	version, err := f.smds.SyncSharedINode(ref, f.version)
+	if err != nil {
+		return err
+	}
+	f.version = version
+	// The blocks trimmed are left for garbage collection, as another
+	// attachment may still be reading them.
+	f.file.TakeTrimmed()
+	return nil
+}
+
+func (f *SharedBlockFile) ReadAt(b []byte, off int64) (int, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	err := f.refresh()
+	if err != nil {
+		return 0, err
+	}
+	return f.file.ReadAt(b, off)
+}
+
+func (f *SharedBlockFile) WriteAt(b []byte, off int64) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	from, to := f.blockRange(off, int64(len(b)))
+	if err = f.lockBlocks(from, to); err != nil {
+		return 0, err
+	}
+	defer f.unlockBlocks(from, to)
+	err = f.commit(func(file *torus.File) error {
+		n, err = file.WriteAt(b, off)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (f *SharedBlockFile) Trim(off, length int64) error {
+	if length <= 0 {
+		return nil
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	from, to := f.blockRange(off, length)
+	if err := f.lockBlocks(from, to); err != nil {
+		return err
+	}
+	defer f.unlockBlocks(from, to)
+	return f.commit(func(file *torus.File) error {
+		return file.Trim(off, length)
+	})
+}
+
+// Sync does nothing, as every write is synced before it returns.
+func (f *SharedBlockFile) Sync() error {
+	return nil
+}
+
+func (f *SharedBlockFile) Size() uint64 {
+	return f.vol.volume.MaxBytes
+}
+
+// Close detaches the volume.
+func (f *SharedBlockFile) Close() error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.smds.DetachShared()
+}
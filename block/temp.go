@@ -13,44 +13,127 @@ type blockTempMetadata struct {
 	*temp.Client
 	name string
 	vid  torus.VolumeID
+
+	// epoch is that of the attachment this client took, if any.
+	epoch uint64
 }
 
 type blockTempVolumeData struct {
 	locked string
-	id     torus.INodeRef
-	snaps  []Snapshot
+	epoch  uint64
+	// renewals counts the renewals of the current attachment.
+	renewals uint64
+	id       torus.INodeRef
+	snaps    []Snapshot
+
+	shared  bool
+	sharers map[string]bool
+	// ranges are the holders of the locked blocks of a shared volume.
+	ranges map[int]string
+	// version changes every time id is synced.
+	version int64
+
+	// reservations are the volume's saved SCSI persistent reservations,
+	// and resVersion changes every time they're saved.
+	reservations []byte
+	resVersion   int64
 }
 
 func (b *blockTempMetadata) CreateBlockVolume(volume *models.Volume) error {
+	return b.CreateBlockVolumes([]*models.Volume{volume})
+}
+
+func (b *blockTempMetadata) CreateBlockVolumes(volumes []*models.Volume) error {
 	b.LockData()
 	defer b.UnlockData()
-	_, ok := b.GetData(fmt.Sprint(volume.Id))
-	if ok {
-		return torus.ErrExists
+	for _, volume := range volumes {
+		_, ok := b.GetData(fmt.Sprint(volume.Id))
+		if ok {
+			return torus.ErrExists
+		}
+		if b.VolumeExists(volume.Name) {
+			return torus.ErrExists
+		}
+	}
+	for _, volume := range volumes {
+		b.CreateVolume(volume)
+		b.SetData(fmt.Sprint(volume.Id), &blockTempVolumeData{
+			locked: "",
+			id:     torus.NewINodeRef(torus.VolumeID(volume.Id), 1),
+		})
 	}
-	b.CreateVolume(volume)
-	b.SetData(fmt.Sprint(volume.Id), &blockTempVolumeData{
-		locked: "",
-		id:     torus.NewINodeRef(torus.VolumeID(volume.Id), 1),
-	})
 	return nil
 }
 
-func (b *blockTempMetadata) Lock(lease int64) error {
+func (b *blockTempMetadata) Lock(lease int64) (uint64, error) {
 	b.LockData()
 	defer b.UnlockData()
 	v, ok := b.GetData(fmt.Sprint(b.vid))
 	if !ok {
-		return torus.ErrNotExist
+		return 0, torus.ErrNotExist
 	}
 	d := v.(*blockTempVolumeData)
+	if d.shared {
+		return 0, torus.ErrShared
+	}
 	if d.locked != "" {
-		return torus.ErrLocked
+		return 0, torus.ErrLocked
 	}
 	d.locked = b.UUID()
+	d.epoch++
+	d.renewals = 0
+	b.epoch = d.epoch
+	return d.epoch, nil
+}
+
+// holds returns whether this client has the attachment.
+func (b *blockTempMetadata) holds(d *blockTempVolumeData) bool {
+	return d.locked == b.UUID() && (b.epoch == 0 || d.epoch == b.epoch)
+}
+
+func (b *blockTempMetadata) RenewLock() error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return err
+	}
+	if b.epoch == 0 || !b.holds(d) {
+		return torus.ErrLocked
+	}
+	d.renewals++
 	return nil
 }
 
+func (b *blockTempMetadata) ForceLock(lease int64, wait time.Duration) (uint64, error) {
+	b.LockData()
+	d, err := b.volumeData()
+	if err != nil {
+		b.UnlockData()
+		return 0, err
+	}
+	if d.locked == "" {
+		b.UnlockData()
+		return b.Lock(lease)
+	}
+	epoch, renewals := d.epoch, d.renewals
+	b.UnlockData()
+	time.Sleep(wait)
+	b.LockData()
+	defer b.UnlockData()
+	switch {
+	case d.shared:
+		return 0, torus.ErrShared
+	case d.locked != "" && (d.epoch != epoch || d.renewals != renewals):
+		return 0, torus.ErrLocked
+	}
+	d.locked = b.UUID()
+	d.epoch++
+	d.renewals = 0
+	b.epoch = d.epoch
+	return d.epoch, nil
+}
+
 func (b *blockTempMetadata) GetINode() (torus.INodeRef, error) {
 	b.LockData()
 	defer b.UnlockData()
@@ -70,10 +153,11 @@ func (b *blockTempMetadata) SyncINode(inode torus.INodeRef) error {
 		return torus.ErrNotExist
 	}
 	d := v.(*blockTempVolumeData)
-	if d.locked != b.UUID() {
+	if !b.holds(d) {
 		return torus.ErrLocked
 	}
 	d.id = inode
+	d.version++
 	return nil
 }
 
@@ -85,24 +169,30 @@ func (b *blockTempMetadata) Unlock() error {
 		return torus.ErrNotExist
 	}
 	d := v.(*blockTempVolumeData)
-	if d.locked != b.UUID() {
+	if !b.holds(d) {
 		return torus.ErrLocked
 	}
 	d.locked = ""
+	b.epoch = 0
 	return nil
 }
 
 func (b *blockTempMetadata) DeleteVolume() error {
 	b.LockData()
-	defer b.UnlockData()
 	v, ok := b.GetData(fmt.Sprint(b.vid))
 	if !ok {
+		b.UnlockData()
 		return torus.ErrNotExist
 	}
 	d := v.(*blockTempVolumeData)
-	if d.locked != b.UUID() {
+	// As with etcd, a volume can't be deleted while another attachment
+	// holds it.
+	if (d.locked != "" && d.locked != b.UUID()) || len(d.sharers) != 0 {
+		b.UnlockData()
 		return torus.ErrLocked
 	}
+	// The client takes the data lock itself.
+	b.UnlockData()
 	return b.Client.DeleteVolume(b.name)
 }
 
@@ -157,6 +247,175 @@ func (b *blockTempMetadata) DeleteSnapshot(name string) error {
 	return torus.ErrNotExist
 }
 
+// volumeData returns the volume's data. The caller holds the data lock.
+func (b *blockTempMetadata) volumeData() (*blockTempVolumeData, error) {
+	v, ok := b.GetData(fmt.Sprint(b.vid))
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return v.(*blockTempVolumeData), nil
+}
+
+func (b *blockTempMetadata) SetShared(shared bool) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return err
+	}
+	if d.locked != "" || len(d.sharers) != 0 {
+		return torus.ErrLocked
+	}
+	d.shared = shared
+	return nil
+}
+
+func (b *blockTempMetadata) IsShared() (bool, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return false, err
+	}
+	return d.shared, nil
+}
+
+func (b *blockTempMetadata) AttachShared(lease int64) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return err
+	}
+	if !d.shared {
+		return torus.ErrInvalid
+	}
+	if d.sharers[b.UUID()] {
+		return torus.ErrLocked
+	}
+	if d.sharers == nil {
+		d.sharers = make(map[string]bool)
+		d.ranges = make(map[int]string)
+	}
+	d.sharers[b.UUID()] = true
+	return nil
+}
+
+func (b *blockTempMetadata) DetachShared() error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return err
+	}
+	if !d.sharers[b.UUID()] {
+		return torus.ErrLocked
+	}
+	delete(d.sharers, b.UUID())
+	// As if its lease had run out.
+	for i, holder := range d.ranges {
+		if holder == b.UUID() {
+			delete(d.ranges, i)
+		}
+	}
+	return nil
+}
+
+func (b *blockTempMetadata) LockBlocks(lease int64, from, to int) error {
+	if to <= from || to-from > maxLockBlocks {
+		return torus.ErrInvalid
+	}
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return err
+	}
+	if !d.sharers[b.UUID()] {
+		return torus.ErrLocked
+	}
+	for i := from; i < to; i++ {
+		if _, ok := d.ranges[i]; ok {
+			return torus.ErrLocked
+		}
+	}
+	for i := from; i < to; i++ {
+		d.ranges[i] = b.UUID()
+	}
+	return nil
+}
+
+func (b *blockTempMetadata) UnlockBlocks(from, to int) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return err
+	}
+	for i := from; i < to; i++ {
+		if d.ranges[i] != b.UUID() {
+			return torus.ErrLocked
+		}
+	}
+	for i := from; i < to; i++ {
+		delete(d.ranges, i)
+	}
+	return nil
+}
+
+func (b *blockTempMetadata) GetSharedINode() (torus.INodeRef, int64, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return torus.ZeroINode(), 0, err
+	}
+	return d.id, d.version, nil
+}
+
+func (b *blockTempMetadata) SyncSharedINode(inode torus.INodeRef, version int64) (int64, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return 0, err
+	}
+	if !d.sharers[b.UUID()] {
+		return 0, torus.ErrLocked
+	}
+	if d.version != version {
+		return 0, torus.ErrCompareFailed
+	}
+	d.id = inode
+	d.version++
+	return d.version, nil
+}
+
+func (b *blockTempMetadata) GetReservations() ([]byte, int64, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return nil, 0, err
+	}
+	return d.reservations, d.resVersion, nil
+}
+
+func (b *blockTempMetadata) SaveReservations(data []byte, version int64) (int64, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.volumeData()
+	if err != nil {
+		return 0, err
+	}
+	if d.resVersion != version {
+		return 0, torus.ErrCompareFailed
+	}
+	d.reservations = append([]byte(nil), data...)
+	d.resVersion++
+	return d.resVersion, nil
+}
+
 func createBlockTempMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (blockMetadata, error) {
 	if t, ok := mds.(*temp.Client); ok {
 		return &blockTempMetadata{
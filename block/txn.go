@@ -0,0 +1,84 @@
+package block
+
+import (
+	"path"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/etcd"
+	"github.com/coreos/torus/models"
+)
+
+// blockVolumeOps returns the changes that create a block volume, in the key
+// layout the etcd and Consul backends share.
+func blockVolumeOps(volume *models.Volume) ([]torus.MetadataOp, error) {
+	vbytes, err := volume.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	hex := etcd.Uint64ToHex(volume.Id)
+	return []torus.MetadataOp{
+		{Key: path.Join("volumes", volume.Name), Value: etcd.Uint64ToBytes(volume.Id)},
+		{Key: path.Join("volumeid", hex), Value: vbytes},
+		{Key: path.Join("volumemeta", hex, "inode"), Value: etcd.Uint64ToBytes(1)},
+		{Key: path.Join("volumemeta", hex, "blockinode"), Value: torus.NewINodeRef(torus.VolumeID(volume.Id), 1).ToBytes()},
+	}, nil
+}
+
+// createTenantBlockVolumeTxn creates a volume, assigns it to tenant and checks
+// the tenant's quota in one transaction, so that volumes created for a tenant
+// at the same time can't together take it over its hard quota. Each volume
+// created this way bumps a generation key of its tenant, which fails the
+// transactions of any others that checked the quota before it.
+func createTenantBlockVolumeTxn(mds torus.MetadataService, tenant, volume string, size uint64) (soft bool, err error) {
+	tmds := mds.(torus.TxnMetadataService)
+	if err := torus.CheckNewVolume(mds, size); err != nil {
+		return false, err
+	}
+	id, err := mds.NewVolumeID()
+	if err != nil {
+		return false, err
+	}
+	vol := &models.Volume{
+		Name:     volume,
+		Id:       uint64(id),
+		Type:     VolumeType,
+		MaxBytes: size,
+	}
+	genKey := path.Join("tenant-gen", tenant)
+	err = torus.AtomicUpdate(mds, []string{path.Join("volumes", volume), genKey}, func(kvs []torus.MetadataKV) ([]torus.MetadataOp, error) {
+		if kvs[0].Version != 0 {
+			return nil, torus.ErrExists
+		}
+		// Read the volumes here, rather than through GetVolumes, which
+		// may be answered from a cache that hasn't seen the others yet.
+		vkvs, err := tmds.ListKeys("volumeid")
+		if err != nil {
+			return nil, err
+		}
+		vols := make([]*models.Volume, len(vkvs))
+		for i, kv := range vkvs {
+			vols[i] = &models.Volume{}
+			err := vols[i].Unmarshal(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		soft, err = torus.CheckTenantQuotaOf(mds, vols, tenant, size)
+		if err != nil {
+			return nil, err
+		}
+		ops, err := blockVolumeOps(vol)
+		if err != nil {
+			return nil, err
+		}
+		var gen uint64
+		if kvs[1].Version != 0 {
+			gen = etcd.BytesToUint64(kvs[1].Value)
+		}
+		return append(ops,
+			torus.MetadataOp{Key: path.Join("volumemeta", etcd.Uint64ToHex(vol.Id), "tenant"), Value: []byte(tenant)},
+			torus.MetadataOp{Key: genKey, Value: etcd.Uint64ToBytes(gen + 1)},
+		), nil
+	})
+	return soft, err
+}
@@ -1,6 +1,9 @@
 package block
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/blockset"
 	"github.com/coreos/torus/models"
@@ -13,18 +16,29 @@ type BlockVolume struct {
 	srv    *torus.Server
 	mds    blockMetadata
 	volume *models.Volume
+
+	// IOClass is how urgent the I/O of files opened from the volume is.
+	IOClass torus.IOClass
 }
 
 func CreateBlockVolume(mds torus.MetadataService, volume string, size uint64) error {
+	_, err := createBlockVolume(mds, volume, size)
+	return err
+}
+
+func createBlockVolume(mds torus.MetadataService, volume string, size uint64) (torus.VolumeID, error) {
+	if err := torus.CheckNewVolume(mds, size); err != nil {
+		return 0, err
+	}
 	id, err := mds.NewVolumeID()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	blkmd, err := createBlockMetadata(mds, volume, id)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return blkmd.CreateBlockVolume(&models.Volume{
+	return id, blkmd.CreateBlockVolume(&models.Volume{
 		Name:     volume,
 		Id:       uint64(id),
 		Type:     VolumeType,
@@ -32,6 +46,100 @@ func CreateBlockVolume(mds torus.MetadataService, volume string, size uint64) er
 	})
 }
 
+// MaxBatchVolumes is the most volumes CreateBlockVolumes creates at once. Each
+// volume takes four operations of the transaction, and etcd allows 128 by
+// default.
+const MaxBatchVolumes = 32
+
+// CreateBlockVolumes creates a block volume of the given size for each name,
+// all in one metadata transaction. Either every volume is created or, if any
+// name is taken, none is.
+func CreateBlockVolumes(mds torus.MetadataService, names []string, size uint64) error {
+	if len(names) == 0 || len(names) > MaxBatchVolumes {
+		return fmt.Errorf("can create between 1 and %d volumes at once, not %d", MaxBatchVolumes, len(names))
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("volume %s given twice", name)
+		}
+		seen[name] = true
+	}
+	if err := torus.CheckVolumeQuota(mds, 0, size); err != nil {
+		return err
+	}
+	if err := torus.CheckCapacity(mds, size*uint64(len(names))); err != nil {
+		return err
+	}
+	ids := make([]torus.VolumeID, len(names))
+	if r, ok := mds.(torus.VolumeIDReserver); ok {
+		first, err := r.NewVolumeIDs(len(names))
+		if err != nil {
+			return err
+		}
+		for i := range ids {
+			ids[i] = first + torus.VolumeID(i)
+		}
+	} else {
+		for i := range ids {
+			id, err := mds.NewVolumeID()
+			if err != nil {
+				return err
+			}
+			ids[i] = id
+		}
+	}
+	vols := make([]*models.Volume, len(names))
+	for i, name := range names {
+		vols[i] = &models.Volume{
+			Name:     name,
+			Id:       uint64(ids[i]),
+			Type:     VolumeType,
+			MaxBytes: size,
+		}
+	}
+	blkmd, err := createBlockMetadata(mds, names[0], ids[0])
+	if err != nil {
+		return err
+	}
+	return blkmd.CreateBlockVolumes(vols)
+}
+
+// CreateTenantBlockVolume creates a block volume belonging to tenant, as long
+// as it fits in the tenant's hard quota. It returns whether the tenant is now
+// over its soft quota. Metadata services with transactions do it all at once;
+// with others, volumes created for the same tenant at the same time may each
+// fit on their own but not together.
+func CreateTenantBlockVolume(mds torus.MetadataService, tenant, volume string, size uint64) (soft bool, err error) {
+	tmds, ok := mds.(torus.TenantMetadataService)
+	if !ok {
+		return false, torus.ErrNotSupported
+	}
+	err = torus.ValidTenantName(tenant)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := mds.(torus.TxnMetadataService); ok {
+		return createTenantBlockVolumeTxn(mds, tenant, volume, size)
+	}
+	soft, err = torus.CheckTenantQuota(mds, tenant, size)
+	if err != nil {
+		return false, err
+	}
+	id, err := createBlockVolume(mds, volume, size)
+	if err != nil {
+		return false, err
+	}
+	err = tmds.SetVolumeTenant(id, tenant)
+	if err != nil {
+		if derr := DeleteBlockVolume(mds, volume); derr != nil {
+			clog.Errorf("couldn't clean up volume %s: %v", volume, derr)
+		}
+		return false, err
+	}
+	return soft, nil
+}
+
 func OpenBlockVolume(s *torus.Server, volume string) (*BlockVolume, error) {
 	vol, err := s.MDS.GetVolume(volume)
 	if err != nil {
@@ -60,9 +168,50 @@ func DeleteBlockVolume(mds torus.MetadataService, volume string) error {
 	return bmds.DeleteVolume()
 }
 
-func (s *BlockVolume) SaveSnapshot(name string) error    { return s.mds.SaveSnapshot(name) }
-func (s *BlockVolume) GetSnapshots() ([]Snapshot, error) { return s.mds.GetSnapshots() }
-func (s *BlockVolume) DeleteSnapshot(name string) error  { return s.mds.DeleteSnapshot(name) }
+// Snapshots are copy-on-write: a snapshot is just the volume's INode at the
+// time it was taken. Writes after it go to blocks of newer INodes, so the
+// snapshot shares every block the volume hasn't rewritten since, and the
+// blockvol GC keeps whatever any snapshot's INode still refers to.
+
+// SaveSnapshot records the volume as of its last sync under name.
+func (s *BlockVolume) SaveSnapshot(name string) error {
+	if err := validSnapshotName(name); err != nil {
+		return err
+	}
+	if err := s.checkAccess(torus.PermWrite); err != nil {
+		return err
+	}
+	return s.mds.SaveSnapshot(name)
+}
+
+func (s *BlockVolume) GetSnapshots() ([]Snapshot, error) {
+	if err := s.checkAccess(torus.PermRead); err != nil {
+		return nil, err
+	}
+	return s.mds.GetSnapshots()
+}
+
+// DeleteSnapshot deletes the named snapshot. The blocks only it referred to
+// are collected by the next GC pass.
+func (s *BlockVolume) DeleteSnapshot(name string) error {
+	if err := s.checkAccess(torus.PermWrite); err != nil {
+		return err
+	}
+	return s.mds.DeleteSnapshot(name)
+}
+
+func validSnapshotName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/@") {
+		return fmt.Errorf("invalid snapshot name %q; it can't be empty or contain '/' or '@'", name)
+	}
+	return nil
+}
+
+// checkAccess returns ErrPermissionDenied if the volume's ACL doesn't allow
+// the server's identity to do want.
+func (s *BlockVolume) checkAccess(want torus.Permission) error {
+	return torus.CheckAccess(s.srv.MDS, torus.VolumeID(s.volume.Id), s.srv.Cfg.Identity, want)
+}
 
 func (s *BlockVolume) getContext() context.Context {
 	return context.TODO()
@@ -76,7 +225,15 @@ func (s *BlockVolume) getOrCreateBlockINode(ref torus.INodeRef) (*models.INode,
 		return s.srv.INodes.GetINode(s.getContext(), ref)
 	}
 	globals := s.mds.GlobalMetadata()
-	bs, err := blockset.CreateBlocksetFromSpec(globals.DefaultBlockSpec, nil)
+	spec := globals.DefaultBlockSpec
+	red, err := torus.GetRedundancy(s.srv.MDS, torus.VolumeID(s.volume.Id))
+	if err != nil {
+		return nil, err
+	}
+	if red.Kind == torus.ErasureCoded {
+		spec = blockset.WithErasureCoding(spec, red.Data, red.Parity)
+	}
+	bs, err := blockset.CreateBlocksetFromSpec(spec, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -95,3 +252,31 @@ func (s *BlockVolume) getOrCreateBlockINode(ref torus.INodeRef) (*models.INode,
 	inode.Blocks, err = torus.MarshalBlocksetToProto(bs)
 	return inode, err
 }
+
+// BlockRefs returns the refs of the blocks currently backing the volume. Blocks
+// that have never been written are left out.
+func (s *BlockVolume) BlockRefs() ([]torus.BlockRef, error) {
+	ref, err := s.mds.GetINode()
+	if err != nil {
+		return nil, err
+	}
+	if ref.INode <= 1 {
+		return nil, nil
+	}
+	inode, err := s.srv.INodes.GetINode(s.getContext(), ref)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := blockset.UnmarshalFromProto(inode.Blocks, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []torus.BlockRef
+	for _, x := range bs.GetAllBlockRefs() {
+		if x.IsZero() {
+			continue
+		}
+		out = append(out, x)
+	}
+	return out, nil
+}
@@ -91,6 +91,25 @@ func (b *baseBlockset) PutBlock(ctx context.Context, inode torus.INodeRef, i int
 	return nil
 }
 
+func (b *baseBlockset) linkBlock(i int, ref torus.BlockRef, _ []byte) error {
+	if i > len(b.blocks) {
+		return torus.ErrBlockNotExist
+	}
+	if i == len(b.blocks) {
+		b.blocks = append(b.blocks, ref)
+	} else {
+		b.blocks[i] = ref
+	}
+	return nil
+}
+
+func (b *baseBlockset) blockRef(i int) torus.BlockRef {
+	if i >= len(b.blocks) {
+		return torus.ZeroBlock()
+	}
+	return b.blocks[i]
+}
+
 func (b *baseBlockset) makeID(i torus.INodeRef) torus.BlockRef {
 	id := atomic.AddUint64(&b.ids, 1)
 	return torus.BlockRef{
@@ -26,11 +26,26 @@ var (
 		Name: "torus_blockset_base_failed_blocks",
 		Help: "Number of blocks that failed",
 	})
+	promErasureReconstructed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_blockset_erasure_reconstructed_blocks",
+		Help: "Number of erasure coded blocks rebuilt from the rest of their stripe",
+	})
+	promErasureFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_blockset_erasure_failed_blocks",
+		Help: "Number of erasure coded blocks that couldn't be read or rebuilt",
+	})
+	promDedupLinked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_blockset_dedup_linked_blocks_total",
+		Help: "Number of blocks that share a stored block with the same contents instead of being stored again",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(promCRCFail)
 	prometheus.MustRegister(promBaseFail)
+	prometheus.MustRegister(promErasureReconstructed)
+	prometheus.MustRegister(promErasureFail)
+	prometheus.MustRegister(promDedupLinked)
 }
 
 type blockset interface {
@@ -45,6 +60,8 @@ const (
 	Base torus.BlockLayerKind = iota
 	CRC
 	Replication
+	ErasureCoded
+	Dedup
 )
 
 // CreateBlocksetFunc is the signature of a constructor used to create
@@ -125,6 +142,10 @@ func ParseBlockLayerKind(s string) (torus.BlockLayerKind, error) {
 		return CRC, nil
 	case "rep", "r":
 		return Replication, nil
+	case "ec":
+		return ErasureCoded, nil
+	case "dedup":
+		return Dedup, nil
 	default:
 		return torus.BlockLayerKind(-1), fmt.Errorf("no such block layer type: %s", s)
 	}
@@ -95,6 +95,31 @@ func (b *crcBlockset) PutBlock(ctx context.Context, inode torus.INodeRef, i int,
 	return nil
 }
 
+func (b *crcBlockset) linkBlock(i int, ref torus.BlockRef, data []byte) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if i > len(b.crcs) {
+		return torus.ErrBlockNotExist
+	}
+	err := b.sub.(linkingBlockset).linkBlock(i, ref, data)
+	if err != nil {
+		return err
+	}
+	crc := crc32.ChecksumIEEE(data)
+	if i == len(b.crcs) {
+		b.crcs = append(b.crcs, crc)
+	} else {
+		b.crcs[i] = crc
+	}
+	return nil
+}
+
+func (b *crcBlockset) blockRef(i int) torus.BlockRef {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.sub.(linkingBlockset).blockRef(i)
+}
+
 func (b *crcBlockset) makeID(i torus.INodeRef) torus.BlockRef {
 	return b.sub.makeID(i)
 }
@@ -0,0 +1,357 @@
+package blockset
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/coreos/torus"
+)
+
+// dedupHashSize is how much of the SHA-256 of a block is kept to find
+// blocks with the same contents.
+const dedupHashSize = 16
+
+type dedupHash [dedupHashSize]byte
+
+// unknownHash marks blocks whose contents the layer doesn't know yet, such as
+// those written before the layer was added.
+var unknownHash dedupHash
+
+// linkingBlockset is implemented by layers that can make a block share the
+// stored block of another with the same contents, rather than storing it
+// again.
+type linkingBlockset interface {
+	blockset
+	// linkBlock makes the ith block the stored block ref, whose contents
+	// are data.
+	linkBlock(i int, ref torus.BlockRef, data []byte) error
+	// blockRef returns the ref of the ith block.
+	blockRef(i int) torus.BlockRef
+}
+
+var errNotLinkable = errors.New("blockset: dedup only works atop crc and base layers")
+
+// dedupBlockset keeps a hash of the contents of each block, and stores blocks
+// with the same contents as a block already stored once. How many blocks
+// share each stored block is counted, so that a stored block is only
+// offered for sharing while some block still uses it.
+type dedupBlockset struct {
+	sub    linkingBlockset
+	mut    sync.RWMutex
+	hashes []dedupHash
+	index  map[dedupHash]torus.BlockRef
+	refs   map[torus.BlockRef]int
+}
+
+var (
+	_ blockset            = &dedupBlockset{}
+	_ torus.DedupBlockset = &dedupBlockset{}
+	_ linkingBlockset     = &crcBlockset{}
+	_ linkingBlockset     = &baseBlockset{}
+)
+
+func init() {
+	RegisterBlockset(Dedup, func(_ string, _ torus.BlockStore, sub blockset) (blockset, error) {
+		return newDedupBlockset(sub)
+	})
+}
+
+func newDedupBlockset(sub blockset) (*dedupBlockset, error) {
+	if !linkable(sub) {
+		return nil, errNotLinkable
+	}
+	b := &dedupBlockset{
+		sub: sub.(linkingBlockset),
+	}
+	b.hashes = make([]dedupHash, sub.Length())
+	b.rebuild()
+	return b, nil
+}
+
+func linkable(b blockset) bool {
+	switch l := b.(type) {
+	case *baseBlockset:
+		return true
+	case *crcBlockset:
+		return linkable(l.sub)
+	}
+	return false
+}
+
+// SetDedup adds a dedup layer atop bs if on, or takes it off if not. The
+// blocks already written are hashed as they're learned; see
+// torus.DedupBlockset.
+func SetDedup(bs torus.Blockset, on bool) (torus.Blockset, error) {
+	d, ok := bs.(*dedupBlockset)
+	if !on {
+		if ok {
+			return d.sub, nil
+		}
+		return bs, nil
+	}
+	if ok {
+		return bs, nil
+	}
+	sub, ok := bs.(blockset)
+	if !ok {
+		return nil, errNotLinkable
+	}
+	return newDedupBlockset(sub)
+}
+
+func hashBlock(data []byte) dedupHash {
+	var h dedupHash
+	sum := sha256.Sum256(data)
+	copy(h[:], sum[:])
+	return h
+}
+
+// rebuild counts the blocks sharing each stored block, and indexes the
+// stored blocks by the hashes known for them.
+func (b *dedupBlockset) rebuild() {
+	b.index = make(map[dedupHash]torus.BlockRef)
+	b.refs = make(map[torus.BlockRef]int)
+	for i, h := range b.hashes {
+		ref := b.sub.blockRef(i)
+		if ref.IsZero() {
+			continue
+		}
+		b.refs[ref]++
+		if h == unknownHash {
+			continue
+		}
+		if _, ok := b.index[h]; !ok {
+			b.index[h] = ref
+		}
+	}
+}
+
+// release drops a block's use of the stored block ref, which held the
+// contents h.
+func (b *dedupBlockset) release(ref torus.BlockRef, h dedupHash) {
+	if ref.IsZero() {
+		return
+	}
+	b.refs[ref]--
+	if b.refs[ref] > 0 {
+		return
+	}
+	delete(b.refs, ref)
+	if b.index[h] == ref {
+		delete(b.index, h)
+	}
+}
+
+func (b *dedupBlockset) use(ref torus.BlockRef, h dedupHash) {
+	if ref.IsZero() {
+		return
+	}
+	b.refs[ref]++
+	if cur, ok := b.index[h]; (!ok || b.refs[cur] == 0) && h != unknownHash {
+		b.index[h] = ref
+	}
+}
+
+func (b *dedupBlockset) Length() int {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return len(b.hashes)
+}
+
+func (b *dedupBlockset) Kind() uint32 {
+	return uint32(Dedup)
+}
+
+func (b *dedupBlockset) GetBlock(ctx context.Context, i int) ([]byte, error) {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.sub.GetBlock(ctx, i)
+}
+
+func (b *dedupBlockset) PutBlock(ctx context.Context, inode torus.INodeRef, i int, data []byte) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if i > len(b.hashes) {
+		return torus.ErrBlockNotExist
+	}
+	h := hashBlock(data)
+	old, oldHash := torus.ZeroBlock(), unknownHash
+	if i < len(b.hashes) {
+		old, oldHash = b.sub.blockRef(i), b.hashes[i]
+	}
+	var err error
+	if ref, ok := b.index[h]; ok && b.refs[ref] > 0 {
+		if ref == old {
+			b.hashes[i] = h
+			return nil
+		}
+		err = b.sub.linkBlock(i, ref, data)
+		if err == nil {
+			promDedupLinked.Inc()
+		}
+	} else {
+		err = b.sub.PutBlock(ctx, inode, i, data)
+	}
+	if err != nil {
+		return err
+	}
+	if i == len(b.hashes) {
+		b.hashes = append(b.hashes, h)
+	} else {
+		b.hashes[i] = h
+	}
+	b.release(old, oldHash)
+	b.use(b.sub.blockRef(i), h)
+	return nil
+}
+
+func (b *dedupBlockset) UnhashedBlocks() []int {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	var out []int
+	for i, h := range b.hashes {
+		if h == unknownHash && !b.sub.blockRef(i).IsZero() {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func (b *dedupBlockset) BlockRef(i int) torus.BlockRef {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if i >= len(b.hashes) {
+		return torus.ZeroBlock()
+	}
+	return b.sub.blockRef(i)
+}
+
+func (b *dedupBlockset) LearnBlock(i int, ref torus.BlockRef, data []byte) (bool, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if i >= len(b.hashes) || ref.IsZero() || b.sub.blockRef(i) != ref {
+		return false, nil
+	}
+	h := hashBlock(data)
+	shared, ok := b.index[h]
+	if !ok || b.refs[shared] == 0 {
+		b.index[h] = ref
+	}
+	if !ok || shared == ref || b.refs[shared] == 0 {
+		b.hashes[i] = h
+		return false, nil
+	}
+	err := b.sub.linkBlock(i, shared, data)
+	if err != nil {
+		return false, err
+	}
+	b.release(ref, b.hashes[i])
+	b.hashes[i] = h
+	b.use(shared, h)
+	promDedupLinked.Inc()
+	return true, nil
+}
+
+func (b *dedupBlockset) DedupStats() (blocks, stored int) {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	for _, n := range b.refs {
+		blocks += n
+	}
+	return blocks, len(b.refs)
+}
+
+func (b *dedupBlockset) makeID(i torus.INodeRef) torus.BlockRef {
+	return b.sub.makeID(i)
+}
+
+func (b *dedupBlockset) setStore(s torus.BlockStore) {
+	b.sub.setStore(s)
+}
+
+func (b *dedupBlockset) getStore() torus.BlockStore {
+	return b.sub.getStore()
+}
+
+func (b *dedupBlockset) Marshal() ([]byte, error) {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	buf := make([]byte, len(b.hashes)*dedupHashSize)
+	for i, h := range b.hashes {
+		copy(buf[i*dedupHashSize:], h[:])
+	}
+	return buf, nil
+}
+
+func (b *dedupBlockset) Unmarshal(data []byte) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.hashes = make([]dedupHash, b.sub.Length())
+	for i := range b.hashes {
+		if (i+1)*dedupHashSize > len(data) {
+			break
+		}
+		copy(b.hashes[i][:], data[i*dedupHashSize:])
+	}
+	b.rebuild()
+	return nil
+}
+
+func (b *dedupBlockset) GetSubBlockset() torus.Blockset { return b.sub }
+
+func (b *dedupBlockset) GetLiveINodes() *roaring.Bitmap {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.sub.GetLiveINodes()
+}
+
+func (b *dedupBlockset) Truncate(lastIndex int, blocksize uint64) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	for i := lastIndex; i < len(b.hashes); i++ {
+		b.release(b.sub.blockRef(i), b.hashes[i])
+	}
+	err := b.sub.Truncate(lastIndex, blocksize)
+	if err != nil {
+		return err
+	}
+	if lastIndex <= len(b.hashes) {
+		b.hashes = b.hashes[:lastIndex]
+		return nil
+	}
+	b.hashes = append(b.hashes, make([]dedupHash, lastIndex-len(b.hashes))...)
+	return nil
+}
+
+func (b *dedupBlockset) Trim(from, to int) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if to > len(b.hashes) {
+		to = len(b.hashes)
+	}
+	for i := from; i < to; i++ {
+		b.release(b.sub.blockRef(i), b.hashes[i])
+	}
+	err := b.sub.Trim(from, to)
+	if err != nil {
+		return err
+	}
+	for i := from; i < to; i++ {
+		b.hashes[i] = unknownHash
+	}
+	return nil
+}
+
+func (b *dedupBlockset) GetAllBlockRefs() []torus.BlockRef {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.sub.GetAllBlockRefs()
+}
+
+func (b *dedupBlockset) String() string {
+	return "dedup\n" + b.sub.String()
+}
@@ -0,0 +1,102 @@
+package blockset
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func TestDedupReadWrite(t *testing.T) {
+	s, _ := torus.CreateBlockStore("temp", "test", torus.Config{StorageSize: 300 * 1024}, torus.GlobalMetadata{BlockSize: 1024})
+	b, err := newDedupBlockset(newCRCBlockset(newBaseBlockset(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readWriteTest(t, b)
+}
+
+func TestDedupSharesBlocks(t *testing.T) {
+	s, _ := torus.CreateBlockStore("temp", "test", torus.Config{StorageSize: 300 * 1024}, torus.GlobalMetadata{BlockSize: 1024})
+	crc := newCRCBlockset(newBaseBlockset(s))
+	inode := torus.NewINodeRef(1, 1)
+	ctx := context.TODO()
+	for i, data := range []string{"a", "b", "a"} {
+		err := crc.PutBlock(ctx, inode, i, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs, err := SetDedup(crc, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := bs.(torus.DedupBlockset)
+	if got := d.UnhashedBlocks(); len(got) != 3 {
+		t.Fatalf("expected all 3 blocks to be unhashed, got %v", got)
+	}
+	for _, i := range d.UnhashedBlocks() {
+		data, err := d.GetBlock(ctx, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		linked, err := d.LearnBlock(i, d.BlockRef(i), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked != (i == 2) {
+			t.Errorf("block %d: expected linked %v", i, i == 2)
+		}
+	}
+	err = d.PutBlock(ctx, torus.NewINodeRef(1, 2), 3, []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := d.GetAllBlockRefs()
+	if refs[0] != refs[2] || refs[1] != refs[3] || refs[0] == refs[1] {
+		t.Fatalf("expected identical blocks to share refs, got %v", refs)
+	}
+	if blocks, stored := d.DedupStats(); blocks != 4 || stored != 2 {
+		t.Fatalf("expected 4 blocks in 2 stored blocks, got %d in %d", blocks, stored)
+	}
+
+	// Sharing survives a round trip through the INode.
+	marshal, err := torus.MarshalBlocksetToProto(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err = UnmarshalFromProto(marshal, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = bs.(torus.DedupBlockset)
+	if len(d.UnhashedBlocks()) != 0 {
+		t.Fatal("expected hashes to be kept")
+	}
+
+	// Once no block uses a stored block, it's no longer shared.
+	err = d.Trim(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.PutBlock(ctx, torus.NewINodeRef(1, 3), 3, []byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.PutBlock(ctx, torus.NewINodeRef(1, 3), 1, []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := d.GetAllBlockRefs()
+	if got[1] == refs[1] {
+		t.Error("expected a block no longer used to be stored again, not shared")
+	}
+	data, err := d.GetBlock(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a" {
+		t.Errorf("expected shared block to read back, got %q", data)
+	}
+}
@@ -0,0 +1,452 @@
+package blockset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/rs"
+)
+
+// erasureBlockset stores blocks in stripes of Data consecutive blocks plus
+// Parity parity blocks, each stored once, instead of replicating every block.
+// Any Data of a stripe's blocks are enough to rebuild the others, so a block
+// whose peer is down is reconstructed on read.
+//
+// It is a bottom layer, like base. Every write re-encodes the block's stripe,
+// reading the rest of the stripe to do so, which suits cold data better than
+// hot.
+type erasureBlockset struct {
+	mut   sync.RWMutex
+	code  *rs.Code
+	store torus.BlockStore
+	seq   uint32
+	// length is the number of blocks. blocks always holds whole stripes;
+	// blocks past length in the last stripe read as zeros, but may still
+	// hold data the stripe's parity was computed from.
+	length int
+	blocks []torus.BlockRef
+	parity [][]torus.BlockRef
+	// trimmed blocks read as zeros, but, like those past length, keep their
+	// data until their stripe is next written.
+	trimmed *roaring.Bitmap
+}
+
+var _ blockset = &erasureBlockset{}
+
+func init() {
+	RegisterBlockset(ErasureCoded, func(opt string, store torus.BlockStore, sub blockset) (blockset, error) {
+		if sub != nil {
+			return nil, errors.New("erasure coding must be the last block layer")
+		}
+		b := &erasureBlockset{
+			store:   store,
+			trimmed: roaring.NewBitmap(),
+		}
+		if opt == "" {
+			// Options come from Unmarshal.
+			return b, nil
+		}
+		data, parity, err := parseErasureOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		b.code, err = rs.New(data, parity)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	})
+}
+
+func parseErasureOptions(opt string) (data, parity int, err error) {
+	parts := strings.Split(opt, "+")
+	if len(parts) == 2 {
+		data, err = strconv.Atoi(parts[0])
+		if err == nil {
+			parity, err = strconv.Atoi(parts[1])
+		}
+		if err == nil && data > 0 && parity > 0 {
+			return data, parity, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unknown erasure coding %q; use DATA+PARITY", opt)
+}
+
+// WithErasureCoding returns spec with its bottom layer replaced by erasure
+// coding with the given numbers of data and parity blocks per stripe. Any
+// replication layers are dropped, since parity takes their place.
+func WithErasureCoding(spec torus.BlockLayerSpec, data, parity int) torus.BlockLayerSpec {
+	var out torus.BlockLayerSpec
+	for _, l := range spec {
+		if l.Kind == Base || l.Kind == Replication {
+			continue
+		}
+		out = append(out, l)
+	}
+	return append(out, torus.BlockLayer{
+		Kind:    ErasureCoded,
+		Options: fmt.Sprintf("%d+%d", data, parity),
+	})
+}
+
+func (b *erasureBlockset) Length() int {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.length
+}
+
+func (b *erasureBlockset) Kind() uint32 {
+	return uint32(ErasureCoded)
+}
+
+func (b *erasureBlockset) GetBlock(ctx context.Context, i int) ([]byte, error) {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if i >= b.length {
+		return nil, torus.ErrBlockNotExist
+	}
+	return b.getBlock(ctx, i)
+}
+
+func (b *erasureBlockset) getBlock(ctx context.Context, i int) ([]byte, error) {
+	ref := b.blocks[i]
+	if ref.IsZero() || b.trimmed.Contains(uint32(i)) {
+		return make([]byte, b.store.BlockSize()), nil
+	}
+	data, err := b.store.GetBlock(ctx, ref)
+	if err == nil {
+		return data, nil
+	}
+	clog.Debugf("erasure: block %d unavailable, reconstructing: %v", i, err)
+	s := i / b.code.Data
+	shards, err := b.readStripe(ctx, s, i%b.code.Data)
+	if err != nil {
+		promErasureFail.Inc()
+		clog.Errorf("erasure: couldn't reconstruct block %d: %v", i, err)
+		return nil, torus.ErrBlockUnavailable
+	}
+	promErasureReconstructed.Inc()
+	return shards[i%b.code.Data], nil
+}
+
+// shardRefs returns the refs of every shard of stripe s, data first.
+func (b *erasureBlockset) shardRefs(s int) []torus.BlockRef {
+	d := b.code.Data
+	out := make([]torus.BlockRef, 0, d+b.code.Parity)
+	out = append(out, b.blocks[s*d:(s+1)*d]...)
+	return append(out, b.parity[s]...)
+}
+
+// readStripe reads every shard of stripe s except the one at skip, which is
+// known to be unavailable, and rebuilds the missing ones.
+func (b *erasureBlockset) readStripe(ctx context.Context, s int, skip int) ([][]byte, error) {
+	size := int(b.store.BlockSize())
+	refs := b.shardRefs(s)
+	shards := make([][]byte, len(refs))
+	var wg sync.WaitGroup
+	for pos, ref := range refs {
+		if pos == skip {
+			continue
+		}
+		if ref.IsZero() {
+			// Never written, so zero; parity is only missing if all the
+			// data is.
+			shards[pos] = make([]byte, size)
+			continue
+		}
+		wg.Add(1)
+		go func(pos int, ref torus.BlockRef) {
+			defer wg.Done()
+			data, err := b.store.GetBlock(ctx, ref)
+			if err != nil {
+				return
+			}
+			shards[pos] = padShard(data, size)
+		}(pos, ref)
+	}
+	wg.Wait()
+	err := b.code.Reconstruct(shards)
+	if err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+func padShard(data []byte, size int) []byte {
+	if len(data) >= size {
+		return data
+	}
+	out := make([]byte, size)
+	copy(out, data)
+	return out
+}
+
+func (b *erasureBlockset) PutBlock(ctx context.Context, inode torus.INodeRef, i int, data []byte) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if i > b.length {
+		return torus.ErrBlockNotExist
+	}
+	if i == b.length {
+		err := b.truncate(b.length + 1)
+		if err != nil {
+			return err
+		}
+	}
+	d := b.code.Data
+	size := int(b.store.BlockSize())
+	s := i / d
+	shards := make([][]byte, d+b.code.Parity)
+	for k := 0; k < d; k++ {
+		idx := s*d + k
+		switch {
+		case idx == i:
+			shards[k] = padShard(data, size)
+		case idx >= b.length || b.trimmed.Contains(uint32(idx)) || b.blocks[idx].IsZero():
+			shards[k] = make([]byte, size)
+		default:
+			blk, err := b.getBlock(ctx, idx)
+			if err != nil {
+				return err
+			}
+			shards[k] = padShard(blk, size)
+		}
+	}
+	err := b.code.Encode(shards)
+	if err != nil {
+		return err
+	}
+	b.seq++
+	ref := torus.ShardRef(inode, b.seq, s, i%d)
+	if torus.BlockLog.LevelAt(capnslog.TRACE) {
+		torus.BlockLog.Tracef("erasure: writing block %d at BlockID %s", i, ref)
+	}
+	err = b.store.WriteBlock(ctx, ref, data)
+	if err != nil {
+		return err
+	}
+	parity := make([]torus.BlockRef, b.code.Parity)
+	for j := range parity {
+		parity[j] = torus.ShardRef(inode, b.seq, s, d+j)
+		err = b.store.WriteBlock(ctx, parity[j], shards[d+j])
+		if err != nil {
+			return err
+		}
+	}
+	// Only now that the whole stripe is written does it replace the old
+	// one, which stays consistent if any of the writes fail.
+	for k := 0; k < d; k++ {
+		idx := s*d + k
+		if idx >= b.length || b.trimmed.Contains(uint32(idx)) {
+			b.blocks[idx] = torus.ZeroBlock()
+			b.trimmed.Remove(uint32(idx))
+		}
+	}
+	b.blocks[i] = ref
+	b.parity[s] = parity
+	return nil
+}
+
+func (b *erasureBlockset) makeID(i torus.INodeRef) torus.BlockRef {
+	b.seq++
+	return torus.BlockRef{
+		INodeRef: i,
+		Index:    torus.IndexID(b.seq),
+	}
+}
+
+func (b *erasureBlockset) setStore(s torus.BlockStore) {
+	b.store = s
+}
+
+func (b *erasureBlockset) getStore() torus.BlockStore {
+	return b.store
+}
+
+func (b *erasureBlockset) Marshal() ([]byte, error) {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	buf := new(bytes.Buffer)
+	for _, x := range []int{b.code.Data, b.code.Parity, b.length, len(b.parity)} {
+		err := binary.Write(buf, binary.LittleEndian, int32(x))
+		if err != nil {
+			return nil, err
+		}
+	}
+	ref := make([]byte, torus.BlockRefByteSize)
+	for _, x := range b.blocks {
+		x.ToBytesBuf(ref)
+		buf.Write(ref)
+	}
+	for _, stripe := range b.parity {
+		for _, x := range stripe {
+			x.ToBytesBuf(ref)
+			buf.Write(ref)
+		}
+	}
+	_, err := b.trimmed.WriteTo(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (b *erasureBlockset) Unmarshal(data []byte) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	r := bytes.NewReader(data)
+	var hdr [4]int32
+	err := binary.Read(r, binary.LittleEndian, &hdr)
+	if err != nil {
+		return err
+	}
+	b.code, err = rs.New(int(hdr[0]), int(hdr[1]))
+	if err != nil {
+		return err
+	}
+	b.length = int(hdr[2])
+	stripes := int(hdr[3])
+	readRefs := func(n int) ([]torus.BlockRef, error) {
+		out := make([]torus.BlockRef, n)
+		ref := make([]byte, torus.BlockRefByteSize)
+		for i := range out {
+			_, err := io.ReadFull(r, ref)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = torus.BlockRefFromBytes(ref)
+		}
+		return out, nil
+	}
+	b.blocks, err = readRefs(stripes * b.code.Data)
+	if err != nil {
+		return err
+	}
+	b.parity = make([][]torus.BlockRef, stripes)
+	for s := range b.parity {
+		b.parity[s], err = readRefs(b.code.Parity)
+		if err != nil {
+			return err
+		}
+	}
+	b.trimmed = roaring.NewBitmap()
+	_, err = b.trimmed.ReadFrom(r)
+	return err
+}
+
+func (b *erasureBlockset) GetSubBlockset() torus.Blockset { return nil }
+
+func (b *erasureBlockset) GetLiveINodes() *roaring.Bitmap {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	out := roaring.NewBitmap()
+	for _, blk := range b.allRefs() {
+		if blk.IsZero() {
+			continue
+		}
+		out.Add(uint32(blk.INode))
+	}
+	return out
+}
+
+func (b *erasureBlockset) Truncate(lastIndex int, _ uint64) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.truncate(lastIndex)
+}
+
+func (b *erasureBlockset) truncate(lastIndex int) error {
+	d := b.code.Data
+	stripes := (lastIndex + d - 1) / d
+	if stripes > torus.MaxStripes {
+		return fmt.Errorf("erasure: can't have more than %d stripes", torus.MaxStripes)
+	}
+	// Blocks past the old length that the new length uncovers read as zeros
+	// until rewritten.
+	for i := b.length; i < lastIndex && i < len(b.blocks); i++ {
+		if !b.blocks[i].IsZero() {
+			b.trimmed.Add(uint32(i))
+		}
+	}
+	for len(b.parity) < stripes {
+		b.blocks = append(b.blocks, make([]torus.BlockRef, d)...)
+		b.parity = append(b.parity, make([]torus.BlockRef, b.code.Parity))
+	}
+	b.blocks = b.blocks[:stripes*d]
+	b.parity = b.parity[:stripes]
+	b.trimmed.RemoveRange(uint64(stripes*d), uint64(torus.MaxStripes*torus.MaxShards))
+	b.length = lastIndex
+	return nil
+}
+
+func (b *erasureBlockset) Trim(from, to int) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if to > b.length {
+		to = b.length
+	}
+	for i := from; i < to; i++ {
+		if !b.blocks[i].IsZero() {
+			b.trimmed.Add(uint32(i))
+		}
+	}
+	// A stripe that is all zeros needs no parity.
+	d := b.code.Data
+	for s := from / d; s*d < to; s++ {
+		empty := true
+		for i := s * d; i < (s+1)*d; i++ {
+			if i < b.length && !b.blocks[i].IsZero() && !b.trimmed.Contains(uint32(i)) {
+				empty = false
+				break
+			}
+		}
+		if !empty {
+			continue
+		}
+		for i := s * d; i < (s+1)*d; i++ {
+			b.blocks[i] = torus.ZeroBlock()
+			b.trimmed.Remove(uint32(i))
+		}
+		b.parity[s] = make([]torus.BlockRef, b.code.Parity)
+	}
+	return nil
+}
+
+// GetAllBlockRefs returns the refs of the blocks in order, then those of the
+// parity blocks and of data kept past the end only for parity's sake.
+func (b *erasureBlockset) GetAllBlockRefs() []torus.BlockRef {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.allRefs()
+}
+
+func (b *erasureBlockset) allRefs() []torus.BlockRef {
+	out := make([]torus.BlockRef, 0, len(b.blocks)+len(b.parity)*b.code.Parity)
+	out = append(out, b.blocks...)
+	for _, stripe := range b.parity {
+		out = append(out, stripe...)
+	}
+	return out
+}
+
+func (b *erasureBlockset) String() string {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	out := fmt.Sprintf("ec %d+%d\n[\n", b.code.Data, b.code.Parity)
+	for _, x := range b.allRefs() {
+		out += x.String() + "\n"
+	}
+	out += "]"
+	return out
+}
@@ -0,0 +1,69 @@
+package blockset
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func newErasureTest(t *testing.T) (torus.BlockStore, blockset) {
+	s, _ := torus.CreateBlockStore("temp", "test", torus.Config{StorageSize: 300 * 1024}, torus.GlobalMetadata{BlockSize: 1024})
+	b, err := CreateBlocksetFromSpec(MustParseBlockLayerSpec("ec=2+1"), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, b.(blockset)
+}
+
+func TestErasureReadWrite(t *testing.T) {
+	_, b := newErasureTest(t)
+	readWriteTest(t, b)
+}
+
+func TestErasureMarshal(t *testing.T) {
+	s, _ := torus.CreateBlockStore("temp", "test", torus.Config{StorageSize: 300 * 1024}, torus.GlobalMetadata{BlockSize: 1024})
+	marshalTest(t, s, MustParseBlockLayerSpec("ec=2+1"))
+}
+
+func TestErasureReconstruct(t *testing.T) {
+	s, b := newErasureTest(t)
+	inode := torus.NewINodeRef(1, 1)
+	blocks := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+	for i, data := range blocks {
+		err := b.PutBlock(context.TODO(), inode, i, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	refs := b.GetAllBlockRefs()
+	// Two data stripes, and a parity block for each.
+	if len(refs) != 6 {
+		t.Fatalf("expected 6 refs, got %d", len(refs))
+	}
+	// Lose one block of each stripe.
+	for _, ref := range []torus.BlockRef{refs[0], refs[5]} {
+		err := s.DeleteBlock(context.TODO(), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range blocks {
+		data, err := b.GetBlock(context.TODO(), i)
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		if !bytes.Equal(bytes.TrimRight(data, "\x00"), want) {
+			t.Errorf("block %d: expected %q, got %q", i, want, bytes.TrimRight(data, "\x00"))
+		}
+	}
+	err := s.DeleteBlock(context.TODO(), refs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetBlock(context.TODO(), 0); err != torus.ErrBlockUnavailable {
+		t.Fatalf("expected an unavailable block after losing two of a stripe, got %v", err)
+	}
+}
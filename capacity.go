@@ -0,0 +1,322 @@
+package torus
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/torus/models"
+)
+
+// ErrCapacityReserved is returned if creating a volume would eat into the
+// capacity the cluster keeps in reserve.
+var ErrCapacityReserved = errors.New("torus: cluster free space is down to its reserve")
+
+// CapacityReserve is how much of the cluster's raw capacity is kept free.
+// Volumes aren't created once they would take free space below it, so that
+// the cluster doesn't find out it's full when writes start failing on full
+// peers.
+type CapacityReserve struct {
+	// Percent is the share of raw capacity to keep free, or zero to create
+	// volumes whatever is left.
+	Percent int `json:"percent"`
+}
+
+// ParseCapacityReserve parses a reserve given as a percentage, such as "10%"
+// or "10".
+func ParseCapacityReserve(s string) (CapacityReserve, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || n < 0 || n >= 100 {
+		return CapacityReserve{}, fmt.Errorf("invalid capacity reserve %q; use a percentage from 0 to 99", s)
+	}
+	return CapacityReserve{Percent: n}, nil
+}
+
+// CapacityMetadataService is implemented by metadata services that can store
+// the cluster's capacity reserve.
+type CapacityMetadataService interface {
+	GetCapacityReserve() (CapacityReserve, error)
+	SetCapacityReserve(CapacityReserve) error
+}
+
+// VolumeQuotaMetadataService is implemented by metadata services that can
+// store quotas on the logical size of volumes.
+type VolumeQuotaMetadataService interface {
+	// GetVolumeQuota returns the quota of a volume, or 0 if it has none of
+	// its own.
+	GetVolumeQuota(vid VolumeID) (uint64, error)
+	// SetVolumeQuota sets the quota of a volume; 0 removes it.
+	SetVolumeQuota(vid VolumeID, quota uint64) error
+	// GetDefaultVolumeQuota returns the quota of volumes without one of their
+	// own, or 0 if there is none.
+	GetDefaultVolumeQuota() (uint64, error)
+	// SetDefaultVolumeQuota sets the quota of volumes without one of their
+	// own; 0 removes it.
+	SetDefaultVolumeQuota(quota uint64) error
+}
+
+// GetVolumeQuota returns the largest logical size volume vid can be given:
+// its own quota, or else the default one, or 0 if neither is set. A vid of 0
+// is a volume that's yet to be created.
+func GetVolumeQuota(mds MetadataService, vid VolumeID) (uint64, error) {
+	qmds, ok := mds.(VolumeQuotaMetadataService)
+	if !ok {
+		return 0, nil
+	}
+	if vid != 0 {
+		q, err := qmds.GetVolumeQuota(vid)
+		if err != nil || q != 0 {
+			return q, err
+		}
+	}
+	return qmds.GetDefaultVolumeQuota()
+}
+
+// CheckVolumeQuota returns ErrVolumeQuota if volume vid, or a new volume if
+// vid is 0, can't be given a logical size of size bytes. A size of 0, which
+// a bucket takes to mean no limit, is over any quota.
+func CheckVolumeQuota(mds MetadataService, vid VolumeID, size uint64) error {
+	q, err := GetVolumeQuota(mds, vid)
+	if err != nil || q == 0 {
+		return err
+	}
+	if size == 0 || size > q {
+		return ErrVolumeQuota
+	}
+	return nil
+}
+
+// ClusterCapacity is the raw storage of the live peers a volume is placed
+// on, in bytes: the members of the cluster's ring, or of its pool's or its
+// own.
+type ClusterCapacity struct {
+	Total    uint64
+	Used     uint64
+	Reserved uint64
+	// Replication is the replication factor of the ring.
+	Replication int
+	// Redundancy is the volume's, by which every byte written to it is
+	// multiplied.
+	Redundancy Redundancy
+}
+
+// Free returns the raw bytes not yet used.
+func (c ClusterCapacity) Free() uint64 {
+	if c.Used > c.Total {
+		return 0
+	}
+	return c.Total - c.Used
+}
+
+// overhead returns how many raw bytes are stored for every so many bytes
+// written to the volume.
+func (c ClusterCapacity) overhead() (stored, written uint64) {
+	if c.Redundancy.Kind == ErasureCoded {
+		return uint64(c.Redundancy.Data + c.Redundancy.Parity), uint64(c.Redundancy.Data)
+	}
+	return uint64(c.Redundancy.Width(c.Replication)), 1
+}
+
+// Available returns how many bytes the volume can still be given before free
+// space would go below the reserve, after its redundancy.
+func (c ClusterCapacity) Available() uint64 {
+	free := c.Free()
+	stored, written := c.overhead()
+	if free <= c.Reserved || stored < 1 {
+		return 0
+	}
+	return (free - c.Reserved) / stored * written
+}
+
+// GetClusterCapacity adds up the capacity of the members of the cluster's
+// ring that haven't timed out, for a new volume that follows the ring.
+func GetClusterCapacity(mds MetadataService) (ClusterCapacity, error) {
+	return getCapacity(mds, Redundancy{}, nil, "")
+}
+
+// GetVolumeCapacity adds up the capacity of the live peers volume vid is
+// placed on, after its redundancy. A volume that's being moved counts as
+// moved.
+func GetVolumeCapacity(mds MetadataService, vid VolumeID) (ClusterCapacity, error) {
+	red, b, pool, err := volumePlacement(mds, vid)
+	if err != nil {
+		return ClusterCapacity{}, err
+	}
+	return getCapacity(mds, red, b, pool)
+}
+
+// volumePlacement returns the redundancy of volume vid and the ring it's
+// placed by: the marshalled ring b, or the named pool's, or the cluster's if
+// neither is set.
+func volumePlacement(mds MetadataService, vid VolumeID) (red Redundancy, b []byte, pool string, err error) {
+	red, err = GetRedundancy(mds, vid)
+	if err != nil {
+		return
+	}
+	if mmds, ok := mds.(MigrationMetadataService); ok {
+		var m *Migration
+		m, err = mmds.GetMigration(vid)
+		if err == ErrNotExist {
+			err = nil
+		}
+		b, pool = m.Current(), m.CurrentPool()
+	}
+	return
+}
+
+// getCapacity adds up the capacity of the live members of the ring a volume
+// of redundancy red is placed by: the named pool's, if there is one, or the
+// marshalled ring b, or the cluster's.
+func getCapacity(mds MetadataService, red Redundancy, b []byte, pool string) (ClusterCapacity, error) {
+	c := ClusterCapacity{Redundancy: red}
+	var members PeerList
+	if pool != "" || len(b) == 0 {
+		var r Ring
+		var err error
+		if pool != "" {
+			pmds, ok := mds.(PoolMetadataService)
+			if !ok {
+				return c, ErrNotSupported
+			}
+			r, err = pmds.GetPool(pool)
+		} else {
+			r, err = mds.GetRing()
+		}
+		if err != nil {
+			return c, err
+		}
+		members = r.Members()
+		b, err = r.Marshal()
+		if err != nil {
+			return c, err
+		}
+	} else {
+		var mr models.Ring
+		if err := mr.Unmarshal(b); err != nil {
+			return c, err
+		}
+		members = PeerInfoList(mr.Peers).PeerList()
+	}
+	var err error
+	c.Replication, err = ringReplication(b)
+	if err != nil {
+		return c, err
+	}
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return c, err
+	}
+	bs := mds.GlobalMetadata().BlockSize
+	for _, p := range peers {
+		if p.TimedOut || !members.Has(p.UUID) {
+			continue
+		}
+		c.Total += p.TotalBlocks * bs
+		c.Used += p.UsedBlocks * bs
+	}
+	if cmds, ok := mds.(CapacityMetadataService); ok {
+		r, err := cmds.GetCapacityReserve()
+		if err != nil {
+			return c, err
+		}
+		c.Reserved = c.Total / 100 * uint64(r.Percent)
+	}
+	return c, nil
+}
+
+// ringReplication returns the replication factor of a marshalled ring, or
+// the larger of both rings' while one is migrated to another. Single peer
+// rings don't record theirs.
+func ringReplication(b []byte) (int, error) {
+	var mr models.Ring
+	if err := mr.Unmarshal(b); err != nil {
+		return 0, err
+	}
+	oldb, hasOld := mr.Attrs["old"]
+	newb, hasNew := mr.Attrs["new"]
+	if hasOld && hasNew {
+		o, err := ringReplication(oldb)
+		if err != nil {
+			return 0, err
+		}
+		n, err := ringReplication(newb)
+		if n < o {
+			n = o
+		}
+		return n, err
+	}
+	if mr.ReplicationFactor == 0 {
+		return 1, nil
+	}
+	return int(mr.ReplicationFactor), nil
+}
+
+// CheckCapacity returns ErrCapacityReserved if filling a new volume of size
+// bytes, placed by the cluster's ring with its replication, would take free
+// space below the reserve. Volumes are thinly provisioned, so this only
+// holds while those already created aren't filled further; it keeps a
+// filling cluster from taking on more, rather than promising space to each
+// volume.
+func CheckCapacity(mds MetadataService, size uint64) error {
+	return checkCapacity(mds, size, func() (ClusterCapacity, error) {
+		return GetClusterCapacity(mds)
+	})
+}
+
+// CheckVolumeCapacity is CheckCapacity for size more bytes of volume vid,
+// placed and protected as it is.
+func CheckVolumeCapacity(mds MetadataService, vid VolumeID, size uint64) error {
+	return checkCapacity(mds, size, func() (ClusterCapacity, error) {
+		return GetVolumeCapacity(mds, vid)
+	})
+}
+
+// checkPlacement is CheckVolumeCapacity for the size bytes of volume vid
+// were it protected by red and placed by pool instead, whichever of them is
+// set.
+func checkPlacement(mds MetadataService, vid VolumeID, size uint64, red *Redundancy, pool string) error {
+	return checkCapacity(mds, size, func() (ClusterCapacity, error) {
+		r, b, p, err := volumePlacement(mds, vid)
+		if err != nil {
+			return ClusterCapacity{}, err
+		}
+		if red != nil {
+			r = *red
+		}
+		if pool != "" {
+			b, p = nil, pool
+		}
+		return getCapacity(mds, r, b, p)
+	})
+}
+
+func checkCapacity(mds MetadataService, size uint64, get func() (ClusterCapacity, error)) error {
+	cmds, ok := mds.(CapacityMetadataService)
+	if !ok {
+		return nil
+	}
+	r, err := cmds.GetCapacityReserve()
+	if err != nil || r.Percent == 0 {
+		return err
+	}
+	c, err := get()
+	if err != nil {
+		return err
+	}
+	if c.Free() <= c.Reserved || size > c.Available() {
+		clog.Warningf("refusing %d more bytes of volumes: %d of %d bytes free, %d reserved", size, c.Free(), c.Total, c.Reserved)
+		return ErrCapacityReserved
+	}
+	return nil
+}
+
+// CheckNewVolume returns an error if a new volume of size bytes would be
+// over the default volume quota, or eat into the cluster's capacity
+// reserve.
+func CheckNewVolume(mds MetadataService, size uint64) error {
+	if err := CheckVolumeQuota(mds, 0, size); err != nil {
+		return err
+	}
+	return CheckCapacity(mds, size)
+}
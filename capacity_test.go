@@ -0,0 +1,171 @@
+package torus_test
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+)
+
+// capacityTestMDS returns a metadata service whose ring has two live peers,
+// a and b, that are half used. Peer c is down and d is live but outside the
+// ring.
+func capacityTestMDS(t *testing.T) (*temp.Client, uint64) {
+	mds := temp.NewClient(torus.Config{}, temp.NewServer())
+	peers := torus.PeerInfoList{
+		{UUID: "a", TotalBlocks: 1000, UsedBlocks: 400},
+		{UUID: "b", TotalBlocks: 1000, UsedBlocks: 400},
+		{UUID: "c", TotalBlocks: 1000, TimedOut: true},
+		{UUID: "d", TotalBlocks: 500},
+	}
+	for _, p := range peers {
+		mds.RegisterPeer(1, p)
+	}
+	r, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Mod),
+		Version:           2,
+		ReplicationFactor: 2,
+		Peers:             peers[:2],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mds.SetRing(r); err != nil {
+		t.Fatal(err)
+	}
+	return mds, mds.GlobalMetadata().BlockSize
+}
+
+func TestCheckCapacity(t *testing.T) {
+	mds, bs := capacityTestMDS(t)
+	if err := torus.CheckCapacity(mds, 1<<40); err != nil {
+		t.Fatalf("expected no check without a reserve, got %v", err)
+	}
+	if err := mds.SetCapacityReserve(torus.CapacityReserve{Percent: 10}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := torus.GetClusterCapacity(mds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2000 blocks on live peers, 800 used, 200 reserved, and each byte
+	// stored twice.
+	if c.Total != 2000*bs || c.Free() != 1200*bs || c.Available() != 500*bs {
+		t.Fatalf("unexpected capacity %+v, %d available", c, c.Available())
+	}
+	if err := torus.CheckCapacity(mds, 500*bs); err != nil {
+		t.Fatalf("expected a volume that fits to be allowed, got %v", err)
+	}
+	if err := torus.CheckCapacity(mds, 501*bs); err != torus.ErrCapacityReserved {
+		t.Fatalf("expected ErrCapacityReserved, got %v", err)
+	}
+}
+
+func TestVolumeCapacity(t *testing.T) {
+	mds, bs := capacityTestMDS(t)
+	// Erasure coding 2+1 needs three peers in the ring.
+	r, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Mod),
+		Version:           3,
+		ReplicationFactor: 2,
+		Peers:             torus.PeerInfoList{{UUID: "a"}, {UUID: "b"}, {UUID: "d"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mds.SetRing(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := mds.SetCapacityReserve(torus.CapacityReserve{Percent: 10}); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Mod),
+		Version:           1,
+		ReplicationFactor: 1,
+		Peers:             torus.PeerInfoList{{UUID: "d"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mds.CreatePool("fast", pool); err != nil {
+		t.Fatal(err)
+	}
+	mds.CreateVolume(&models.Volume{Name: "ec", Id: 1, Type: "block", MaxBytes: 600 * bs})
+	mds.CreateVolume(&models.Volume{Name: "pooled", Id: 2, Type: "block", MaxBytes: 400 * bs})
+	mds.CreateVolume(&models.Volume{Name: "big", Id: 3, Type: "block", MaxBytes: 500 * bs})
+
+	// 2500 blocks, 800 used and 250 reserved leave 1450; a 2+1 stripe
+	// stores 3 blocks for every 2 written, and three replicas 3 for 1.
+	if err := torus.SetInitialRedundancy(mds, "ec", torus.Redundancy{Kind: torus.ErasureCoded, Data: 2, Parity: 1}); err != nil {
+		t.Fatalf("expected an erasure coded volume that fits to be allowed, got %v", err)
+	}
+	c, err := torus.GetVolumeCapacity(mds, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Available() != 1450*bs/3*2 {
+		t.Fatalf("unexpected capacity %+v, %d available", c, c.Available())
+	}
+	if err := torus.SetInitialRedundancy(mds, "big", torus.Redundancy{Kind: torus.Replicated, Replicas: 3}); err != torus.ErrCapacityReserved {
+		t.Fatalf("expected ErrCapacityReserved for three replicas, got %v", err)
+	}
+
+	// The pool's only peer has 500 blocks, 50 of them reserved.
+	if err := torus.SetInitialPool(mds, "pooled", "fast"); err != nil {
+		t.Fatalf("expected a volume that fits in its pool to be allowed, got %v", err)
+	}
+	c, err = torus.GetVolumeCapacity(mds, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Total != 500*bs || c.Replication != 1 || c.Available() != 450*bs {
+		t.Fatalf("unexpected pool capacity %+v, %d available", c, c.Available())
+	}
+	// Growing is checked by how much the volume grows.
+	if _, err := torus.ResizeVolume(mds, "pooled", 851*bs); err != torus.ErrCapacityReserved {
+		t.Fatalf("expected ErrCapacityReserved growing past the pool, got %v", err)
+	}
+	if _, err := torus.ResizeVolume(mds, "pooled", 850*bs); err != nil {
+		t.Fatalf("expected growing within the pool to be allowed, got %v", err)
+	}
+}
+
+func TestVolumeQuota(t *testing.T) {
+	mds, bs := capacityTestMDS(t)
+	if err := torus.CheckNewVolume(mds, 1<<40); err != nil {
+		t.Fatalf("expected no check without a quota, got %v", err)
+	}
+	if err := mds.SetDefaultVolumeQuota(100 * bs); err != nil {
+		t.Fatal(err)
+	}
+	if err := torus.CheckNewVolume(mds, 100*bs); err != nil {
+		t.Fatalf("expected a volume within the quota to be allowed, got %v", err)
+	}
+	if err := torus.CheckNewVolume(mds, 101*bs); err != torus.ErrVolumeQuota {
+		t.Fatalf("expected ErrVolumeQuota, got %v", err)
+	}
+
+	mds.CreateVolume(&models.Volume{Name: "a", Id: 1, Type: "block", MaxBytes: 50 * bs})
+	if _, err := torus.ResizeVolume(mds, "a", 101*bs); err != torus.ErrVolumeQuota {
+		t.Fatalf("expected ErrVolumeQuota growing past the default quota, got %v", err)
+	}
+	if err := mds.SetVolumeQuota(1, 200*bs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := torus.ResizeVolume(mds, "a", 200*bs); err != nil {
+		t.Fatalf("expected the volume's own quota to apply, got %v", err)
+	}
+	if _, err := torus.ResizeVolume(mds, "a", 0); err != torus.ErrVolumeQuota {
+		t.Fatalf("expected ErrVolumeQuota lifting the size limit, got %v", err)
+	}
+	// Shrinking is always allowed, even under a smaller quota.
+	if err := mds.SetVolumeQuota(1, 10*bs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := torus.ResizeVolume(mds, "a", 150*bs); err != nil {
+		t.Fatalf("expected shrinking to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+const defaultPeerBlocks = 100 * 1024 * 1024 * 1024 // 100giga-blocks for testing
+
+// peerCapacities returns the capacity, in blocks, of each of n simulated peers.
+//
+// An explicit list of capacities is repeated as needed to cover all the peers.
+// Otherwise, capacities are drawn from the named distribution around the mean
+// capacity; "fixed" gives every peer the mean. A peer can't be smaller than a
+// block, since it would have no weight on the ring and could never be full.
+func peerCapacities(rnd *rand.Rand, n int, list, dist, meanStr string) ([]uint64, error) {
+	out := make([]uint64, n)
+	if list != "" {
+		var caps []uint64
+		for _, s := range strings.Split(list, ",") {
+			c, err := humanize.ParseBytes(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing capacity %q: %s", s, err)
+			}
+			if c < blockSize {
+				return nil, fmt.Errorf("capacity %q is less than a block", s)
+			}
+			caps = append(caps, c/blockSize)
+		}
+		for i := range out {
+			out[i] = caps[i%len(caps)]
+		}
+		return out, nil
+	}
+
+	mean := uint64(defaultPeerBlocks)
+	if meanStr != "" {
+		c, err := humanize.ParseBytes(meanStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing capacity %q: %s", meanStr, err)
+		}
+		if c < blockSize {
+			return nil, fmt.Errorf("capacity %q is less than a block", meanStr)
+		}
+		mean = c / blockSize
+	}
+	for i := range out {
+		var f float64
+		switch dist {
+		case "fixed":
+			f = 1
+		case "uniform":
+			f = 0.5 + rnd.Float64()
+		case "lognormal":
+			// sigma 0.5, with mu chosen so the mean comes out at 1.
+			f = math.Exp(rnd.NormFloat64()*0.5 - 0.125)
+		default:
+			return nil, errors.New("unknown capacity distribution; use one of 'fixed', 'uniform' or 'lognormal'")
+		}
+		out[i] = roundCapacity(uint64(f * float64(mean)))
+	}
+	return out, nil
+}
+
+// roundCapacity rounds drawn capacities to 1/64th of their power of two, like
+// real disk sizes, which keeps the GCD used for ring weights reasonable.
+func roundCapacity(c uint64) uint64 {
+	if c < 64 {
+		return c + 1
+	}
+	step := uint64(1) << uint(math.Floor(math.Log2(float64(c)))-6)
+	return (c / step) * step
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPeerCapacities(t *testing.T) {
+	defer func(b uint64) { blockSize = b }(blockSize)
+	blockSize = 1024
+
+	for _, tt := range []struct {
+		name  string
+		n     int
+		list  string
+		dist  string
+		mean  string
+		want  []uint64
+		fails bool
+	}{
+		{name: "list repeated", n: 5, list: "1MiB, 2MiB", want: []uint64{1024, 2048, 1024, 2048, 1024}},
+		{name: "fixed", n: 2, dist: "fixed", mean: "4MiB", want: []uint64{4096, 4096}},
+		{name: "fixed default", n: 1, dist: "fixed", want: []uint64{defaultPeerBlocks}},
+		{name: "bad size", n: 1, list: "1MiB,lots", fails: true},
+		{name: "bad distribution", n: 1, dist: "normal", fails: true},
+		{name: "zero in list", n: 2, list: "1MiB,0", fails: true},
+		{name: "less than a block in list", n: 2, list: "1MiB,512B", fails: true},
+		{name: "zero mean", n: 2, dist: "uniform", mean: "0", fails: true},
+		{name: "zero mean, fixed", n: 2, dist: "fixed", mean: "0", fails: true},
+	} {
+		caps, err := peerCapacities(rand.New(rand.NewSource(1)), tt.n, tt.list, tt.dist, tt.mean)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.name, caps)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(caps) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, caps)
+			continue
+		}
+		for i := range caps {
+			if caps[i] != tt.want[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, caps)
+				break
+			}
+		}
+	}
+
+	// Drawn capacities are never zero, however small the mean.
+	for _, dist := range []string{"uniform", "lognormal"} {
+		caps, err := peerCapacities(rand.New(rand.NewSource(1)), 1000, "", dist, "1KiB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range caps {
+			if c == 0 {
+				t.Fatalf("%s: expected no zero capacities, got %v", dist, caps)
+			}
+		}
+	}
+}
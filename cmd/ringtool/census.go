@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+	"github.com/coreos/torus/internal/census"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"github.com/coreos/torus/ringsim"
+	"github.com/dustin/go-humanize"
+
+	_ "github.com/coreos/torus/metadata/etcd"
+	_ "github.com/coreos/torus/storage"
+)
+
+// mainFromCensus simulates -delta and -repEnd on a real cluster instead of a
+// synthetic one. The starting ring, peers, capacities and blocks all come
+// from the census; -nodes, -rep, -total-data and -block-size are ignored, and
+// -ring only applies if given.
+func mainFromCensus(rnd *rand.Rand) {
+	c, err := loadCensus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading cluster: %s\n", err)
+		os.Exit(1)
+	}
+	blockSize = c.BlockSize
+	from, err := ring.CreateRing(c.Ring)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating the cluster's ring: %s\n", err)
+		os.Exit(1)
+	}
+
+	// The ring's members come first, as createToRing expects. Peers that are
+	// up report their current capacity; the rest have the one they joined
+	// the ring with.
+	live := torus.PeerInfoList(c.Peers)
+	ringPeers := torus.PeerInfoList(c.Ring.Peers)
+	peers = nil
+	for _, uuid := range from.Members() {
+		pi := &models.PeerInfo{UUID: uuid}
+		if i := live.UUIDAt(uuid); i != -1 {
+			pi.TotalBlocks = live[i].TotalBlocks
+			pi.Zone = live[i].Zone
+		} else if i := ringPeers.UUIDAt(uuid); i != -1 {
+			pi.TotalBlocks = ringPeers[i].TotalBlocks
+			pi.Zone = ringPeers[i].Zone
+		}
+		if *racks != "" {
+			pi.Zone = rackOf(len(peers))
+		}
+		if pi.TotalBlocks == 0 {
+			fmt.Fprintf(os.Stderr, "peer %s is down and its capacity is unknown\n", uuid)
+			os.Exit(1)
+		}
+		peers = append(peers, pi)
+	}
+	*nodes = len(peers)
+	*replication = int(c.Ring.ReplicationFactor)
+	if *refStr != "" && *planStr != "" {
+		fmt.Fprintf(os.Stderr, "-ref can't be used with -plan\n")
+		os.Exit(1)
+	}
+	if events := mustParsePlan(); events != nil {
+		fmt.Printf("Cluster: %d peers, ring version %d, replication %d, %s blocks\n",
+			*nodes, from.Version(), *replication, humanize.IBytes(blockSize))
+		g, err := ringsim.NewGenerator(rnd, *workloadName, blockSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		blocks := c.BlockRefs()
+		g.After(blocks)
+		simulatePlan(rnd, g, ringsim.SliceStream(blocks), from, events)
+		return
+	}
+	if *nodes+*delta < 0 {
+		fmt.Fprintf(os.Stderr, "can't remove %d of %d peers\n", -*delta, *nodes)
+		os.Exit(1)
+	}
+	if *delta > 0 {
+		caps, err := peerCapacities(rnd, *delta, *capacities, *capacityDist, *capacityMean)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		for _, size := range caps {
+			peers = append(peers, &models.PeerInfo{
+				UUID:        randomUUID(rnd),
+				TotalBlocks: size,
+				Zone:        rackOf(len(peers)),
+			})
+		}
+	}
+	if *replicationEnd == 0 {
+		*replicationEnd = *replication
+	}
+	ttype := torus.RingType(c.Ring.Type)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "ring" {
+			ttype = mustRingType(*ringType)
+		}
+	})
+	if *refStr != "" {
+		ref, err := torus.ParseBlockRef(*refStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		printPlacement("Before", from, ref)
+		printPlacement("After", createToRing(from, ttype), ref)
+		return
+	}
+	fmt.Printf("Cluster: %d peers, ring version %d, replication %d, %s blocks\n",
+		*nodes, from.Version(), *replication, humanize.IBytes(blockSize))
+	simulate(rnd, ringsim.SliceStream(c.BlockRefs()), from, createToRing(from, ttype))
+}
+
+func loadCensus() (*census.Census, error) {
+	if *fromDump != "" {
+		f, err := os.Open(*fromDump)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return census.Read(f)
+	}
+	cfg := torus.Config{
+		MetadataAddress: strings.TrimPrefix(*fromCluster, "etcd://"),
+		StorageSize:     128 * 1024 * 1024,
+	}
+	srv, err := torus.NewServer(cfg, "etcd", "temp")
+	if err != nil {
+		return nil, err
+	}
+	defer srv.Close()
+	err = distributor.OpenReplication(srv)
+	if err != nil {
+		return nil, err
+	}
+	return census.Take(srv)
+}
+
+// printPlacement prints the peers r places ref on, replicas first, with the
+// rack of each.
+func printPlacement(label string, r torus.Ring, ref torus.BlockRef) {
+	perm, err := torus.GetBlockPeers(r, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error placing %s: %s\n", ref, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %s in ring %d (%s)\n", label, ref, r.Version(), r.Describe())
+	for i, p := range perm.Peers {
+		role := "fallback"
+		if i < perm.Replication {
+			role = fmt.Sprintf("replica %d", i+1)
+		}
+		rack := ""
+		if j := peers.UUIDAt(p); j != -1 && peers[j].Zone != "" {
+			rack = " (rack " + peers[j].Zone + ")"
+		}
+		fmt.Printf("  %-10s %s%s\n", role, p, rack)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/ringsim"
+	"github.com/dustin/go-humanize"
+)
+
+type FailureStats struct {
+	Failed          torus.PeerList
+	UnderReplicated uint64
+	Lost            uint64
+	// Sent and Received count the blocks each surviving peer has to send and
+	// receive to restore full replication.
+	Sent     map[string]uint64
+	Received map[string]uint64
+}
+
+// parseLinkSpeed parses a per-peer network speed into bytes per second. Speeds
+// ending in "bps" are bits per second with SI prefixes (eg. 10Gbps); anything
+// else is bytes per second as understood by humanize (eg. 1GiB).
+func parseLinkSpeed(s string) (uint64, error) {
+	if strings.HasSuffix(s, "bps") {
+		num := strings.TrimSuffix(s, "bps")
+		mult := 1.0
+		if len(num) > 0 {
+			switch num[len(num)-1] {
+			case 'k', 'K':
+				mult = 1e3
+			case 'M':
+				mult = 1e6
+			case 'G':
+				mult = 1e9
+			case 'T':
+				mult = 1e12
+			}
+			if mult != 1.0 {
+				num = num[:len(num)-1]
+			}
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil || f <= 0 {
+			return 0, fmt.Errorf("invalid link speed %q", s)
+		}
+		return uint64(f * mult / 8), nil
+	}
+	v, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, err
+	}
+	if v == 0 {
+		return 0, fmt.Errorf("invalid link speed %q", s)
+	}
+	return v, nil
+}
+
+// simulateFailure removes n random peers from the ring, and works out what it
+// takes to re-replicate their data from the survivors.
+func simulateFailure(rnd *rand.Rand, r torus.Ring, blocks ringsim.Stream, n int) (FailureStats, error) {
+	stats := FailureStats{
+		Sent:     make(map[string]uint64),
+		Received: make(map[string]uint64),
+	}
+	members := r.Members()
+	if n >= len(members) {
+		return stats, errors.New("cannot fail every peer in the ring")
+	}
+	remover, ok := r.(torus.RingRemover)
+	if !ok {
+		return stats, errors.New("ring type doesn't support removing peers")
+	}
+	for _, i := range rnd.Perm(len(members))[:n] {
+		stats.Failed = append(stats.Failed, members[i])
+	}
+	after, err := remover.RemovePeers(stats.Failed)
+	if err != nil {
+		return stats, err
+	}
+	for _, p := range after.Members() {
+		stats.Sent[p] = 0
+		stats.Received[p] = 0
+	}
+	err = blocks(func(b torus.BlockRef) error {
+		oldp, err := r.GetPeers(b)
+		if err != nil {
+			return err
+		}
+		newp, err := after.GetPeers(b)
+		if err != nil {
+			return err
+		}
+		surviving := oldp.Peers[:oldp.Replication].AndNot(stats.Failed)
+		if len(surviving) == len(oldp.Peers[:oldp.Replication]) {
+			return nil
+		}
+		stats.UnderReplicated++
+		if len(surviving) == 0 {
+			stats.Lost++
+			return nil
+		}
+		// The first surviving replica copies the block to each new home.
+		for _, p := range newp.Peers[:newp.Replication].AndNot(surviving) {
+			stats.Sent[surviving[0]]++
+			stats.Received[p]++
+		}
+		return nil
+	})
+	return stats, err
+}
+
+func (s FailureStats) printStats(nblocks uint64, linkSpeed uint64) {
+	fmt.Printf("Failed peers: %d\n", len(s.Failed))
+	for _, p := range s.Failed {
+		fmt.Printf("\t%s\n", p)
+	}
+	fmt.Printf("Under-replicated blocks: %d (%0.2f%%)\n", s.UnderReplicated, float64(s.UnderReplicated)*100/float64(nblocks))
+	fmt.Printf("Lost blocks: %d (%0.2f%%)\n", s.Lost, float64(s.Lost)*100/float64(nblocks))
+	fmt.Println("Re-replication traffic:")
+	var uuids []string
+	for p := range s.Sent {
+		uuids = append(uuids, p)
+	}
+	sort.Strings(uuids)
+	var total, busiest uint64
+	for _, p := range uuids {
+		fmt.Printf("\t%s: sends %s, receives %s\n", p,
+			humanize.IBytes(s.Sent[p]*blockSize),
+			humanize.IBytes(s.Received[p]*blockSize),
+		)
+		total += s.Sent[p]
+		if s.Sent[p] > busiest {
+			busiest = s.Sent[p]
+		}
+		if s.Received[p] > busiest {
+			busiest = s.Received[p]
+		}
+	}
+	fmt.Printf("Total traffic: %s\n", humanize.IBytes(total*blockSize))
+	// Peers copy in parallel, so recovery takes as long as the busiest link.
+	recovery := time.Duration(float64(busiest*blockSize) / float64(linkSpeed) * float64(time.Second))
+	fmt.Printf("Estimated recovery time at %s/s per peer: %s\n", humanize.Bytes(linkSpeed), recovery-recovery%time.Second)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"github.com/coreos/torus/ringsim"
+	"github.com/dustin/go-humanize"
+)
+
+// planEvent is one event of a -plan.
+type planEvent struct {
+	text string
+	// kind is add, remove, rep or wait.
+	kind string
+	n    int
+	// from is the replication a rep event expects to change from, or 0.
+	from int
+	// size is how many bytes the workload writes after a wait.
+	size uint64
+}
+
+var errPlanSyntax = errors.New(`events are "add N", "remove N", "rep N", "rep N->M", "wait" or "wait SIZE"`)
+
+// parsePlan parses a plan such as "add 2; wait; remove 1; rep 2->3".
+func parsePlan(s string) ([]planEvent, error) {
+	var out []planEvent
+	for _, text := range strings.Split(s, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		f := strings.Fields(text)
+		ev := planEvent{text: text, kind: f[0]}
+		var err error
+		switch {
+		case (ev.kind == "add" || ev.kind == "remove") && len(f) == 2:
+			ev.n, err = strconv.Atoi(f[1])
+			if err == nil && ev.n <= 0 {
+				err = errPlanSyntax
+			}
+		case ev.kind == "rep" && len(f) == 2:
+			to := f[1]
+			if i := strings.Index(to, "->"); i != -1 {
+				ev.from, err = strconv.Atoi(to[:i])
+				to = to[i+2:]
+			}
+			if err == nil {
+				ev.n, err = strconv.Atoi(to)
+			}
+			if err == nil && ev.n <= 0 {
+				err = errPlanSyntax
+			}
+		case ev.kind == "wait" && len(f) == 1:
+		case ev.kind == "wait" && len(f) == 2:
+			ev.size, err = humanize.ParseBytes(f[1])
+		default:
+			err = errPlanSyntax
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing plan event %q: %s", text, err)
+		}
+		out = append(out, ev)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("the plan is empty")
+	}
+	return out, nil
+}
+
+// planner applies the ring changes of a plan one at a time.
+type planner struct {
+	rnd  *rand.Rand
+	ring torus.Ring
+	rep  int
+}
+
+func (p *planner) apply(ev planEvent) error {
+	members := p.ring.Members()
+	var next torus.Ring
+	var err error
+	switch ev.kind {
+	case "add":
+		var caps []uint64
+		caps, err = peerCapacities(p.rnd, ev.n, *capacities, *capacityDist, *capacityMean)
+		if err != nil {
+			return err
+		}
+		var added torus.PeerInfoList
+		for i, size := range caps {
+			added = append(added, &models.PeerInfo{
+				UUID:        randomUUID(p.rnd),
+				TotalBlocks: size,
+				Zone:        rackOf(len(peers) + i),
+			})
+		}
+		peers = append(peers, added...)
+		if v, ok := p.ring.(torus.RingAdder); ok {
+			next, err = v.AddPeers(added)
+		} else {
+			next, err = p.recreate(append(p.peerInfos(members), added...), p.rep)
+		}
+	case "remove":
+		if ev.n >= len(members) {
+			return fmt.Errorf("can't remove %d of %d peers", ev.n, len(members))
+		}
+		gone := members[len(members)-ev.n:]
+		if v, ok := p.ring.(torus.RingRemover); ok {
+			next, err = v.RemovePeers(gone)
+		} else {
+			next, err = p.recreate(p.peerInfos(members[:len(members)-ev.n]), p.rep)
+		}
+	case "rep":
+		if ev.from != 0 && ev.from != p.rep {
+			return fmt.Errorf("replication is %d by then, not %d", p.rep, ev.from)
+		}
+		if v, ok := p.ring.(torus.ModifyableRing); ok {
+			next, err = v.ChangeReplication(ev.n)
+		} else {
+			next, err = p.recreate(p.peerInfos(members), ev.n)
+		}
+		if err == nil {
+			p.rep = ev.n
+		}
+	}
+	if err != nil {
+		return err
+	}
+	p.ring = next
+	return nil
+}
+
+// recreate makes a new version of a ring that can't be changed in place.
+func (p *planner) recreate(pis torus.PeerInfoList, rep int) (torus.Ring, error) {
+	return ring.CreateRing(&models.Ring{
+		Type:              uint32(p.ring.Type()),
+		Version:           uint32(p.ring.Version() + 1),
+		ReplicationFactor: uint32(rep),
+		Peers:             pis,
+	})
+}
+
+func (p *planner) peerInfos(members torus.PeerList) torus.PeerInfoList {
+	var out torus.PeerInfoList
+	for _, uuid := range members {
+		out = append(out, peers[peers.UUIDAt(uuid)])
+	}
+	return out
+}
+
+// simulatePlan runs a plan against a cluster that starts on ring from. The
+// ring changes between two waits make up one step: the rebalancer only sees
+// the ring it ends up with, so that's what the step is rebalanced to. A wait
+// with a size has the workload write that much more data once the step
+// before it is done.
+func simulatePlan(rnd *rand.Rand, g *ringsim.Generator, blocks ringsim.Stream, from torus.Ring, events []planEvent) {
+	countBlocks(blocks)
+	cluster, err := ringsim.AssignCounts(blocks, from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("@START *****")
+	printBalance(cluster)
+	series.record("start", cluster)
+
+	p := &planner{rnd: rnd, ring: from, rep: *replication}
+	var (
+		settled                = from
+		settledRep             = *replication
+		pending                []string
+		steps                  int
+		totalSent, totalKept   uint64
+		totalIntra, totalInter uint64
+		totalTime              time.Duration
+		written                uint64
+		topo                   = mustTopology()
+	)
+	finish := func() {
+		if len(pending) == 0 {
+			return
+		}
+		steps++
+		newc, stats, err := ringsim.RebalanceCounts(blocks, settled, p.ring)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("@STEP %d: %s *****\n", steps, strings.Join(pending, "; "))
+		printBalance(newc)
+		series.record(strings.Join(pending, "; "), newc)
+		fmt.Println("Changes:")
+		topo = mustTopology()
+		printStats(stats, topo, perfectFraction(settled, settledRep, p.ring, p.rep))
+		totalSent += stats.BlocksSent
+		totalKept += stats.BlocksKept
+		intra, inter := stats.CrossRack(topo)
+		totalIntra += intra
+		totalInter += inter
+		totalTime += stats.TopologyDuration(blockSize, topo)
+		cluster, settled, settledRep, pending = newc, p.ring, p.rep, nil
+	}
+	for _, ev := range events {
+		if ev.kind != "wait" {
+			err := p.apply(ev)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error applying %q: %s\n", ev.text, err)
+				os.Exit(1)
+			}
+			pending = append(pending, ev.text)
+			continue
+		}
+		finish()
+		if ev.size == 0 {
+			continue
+		}
+		more := g.Stream(int(ev.size / blockSize))
+		counts, err := ringsim.AssignCounts(more, settled)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		for peer, n := range counts {
+			cluster[peer] += n
+		}
+		blocks = ringsim.Concat(blocks, more)
+		written += ev.size
+		fmt.Printf("@WRITE %s *****\n", humanize.IBytes(ev.size))
+		series.record(ev.text, cluster)
+	}
+	finish()
+
+	fmt.Println("@TOTAL *****")
+	fmt.Printf("Steps: %d\n", steps)
+	fmt.Printf("Data Written: %s\n", humanize.IBytes(written))
+	fmt.Printf("Blocks Sent: %d\n", totalSent)
+	if totalSent+totalKept > 0 {
+		fmt.Printf("Percentage Sent: %0.2f\n", float64(totalSent)*100/float64(totalSent+totalKept))
+	}
+	fmt.Printf("Network Traffic: %s\n", humanize.IBytes(totalSent*blockSize))
+	if multiRack(topo) {
+		fmt.Printf("Intra-Rack Traffic: %s\n", humanize.IBytes(totalIntra*blockSize))
+		fmt.Printf("Cross-Rack Traffic: %s\n", humanize.IBytes(totalInter*blockSize))
+	}
+	fmt.Printf("Estimated Time: %s\n", totalTime)
+}
+
+// perfectFraction is the least share of the blocks a step could move: those
+// that the new peers must hold, or that the new replicas must.
+func perfectFraction(prev torus.Ring, prevRep int, next torus.Ring, nextRep int) float64 {
+	n, m := len(prev.Members()), len(next.Members())
+	f := math.Abs(float64(m-n)) / float64(m)
+	if nextRep > prevRep {
+		f = math.Max(f, float64(nextRep-prevRep)/float64(nextRep))
+	}
+	return f
+}
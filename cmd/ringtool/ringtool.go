@@ -6,99 +6,217 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/coreos/torus"
-	"github.com/coreos/torus/metadata"
 	"github.com/coreos/torus/models"
 	"github.com/coreos/torus/ring"
+	"github.com/coreos/torus/ringsim"
 	"github.com/dustin/go-humanize"
 )
 
 var (
-	ringType       = flag.String("ring", "mod", "Ring Type")
+	ringType       = flag.String("ring", "mod", "Ring type; any registered type, eg. mod or ketama")
 	replication    = flag.Int("rep", 2, "Start Replication")
 	replicationEnd = flag.Int("repEnd", 0, "Target Replication (0 = same as start)")
 	nodes          = flag.Int("nodes", 0, "Number of nodes to start")
 	delta          = flag.Int("delta", 2, "Number of nodes to add (positive)/remove (negative)")
+	planStr        = flag.String("plan", "", "Sequence of ring changes to simulate instead of -delta and -repEnd, eg. \"add 2; wait; remove 1; rep 2->3\"")
 	blockSizeStr   = flag.String("block-size", "256KiB", "Blocksize")
 	totalDataStr   = flag.String("total-data", "1TiB", "Total data simulated")
-	partition      = flag.Int("rewrite-edge", 40, "Percentage of files with small writes")
+	workloadName   = flag.String("workload", "mixed", "Workload writing the simulated blocks: vm-images, oltp, backup-stream or mixed")
+	capacities     = flag.String("capacities", "", "Comma-separated capacity of each node, eg. 4TiB,4TiB,8TiB,2TiB (repeated as needed)")
+	capacityDist   = flag.String("capacity-distribution", "fixed", "Distribution of node capacities when -capacities isn't given: fixed, uniform or lognormal")
+	capacityMean   = flag.String("capacity", "", "Mean node capacity for -capacity-distribution (default 100 giga-blocks)")
+	fail           = flag.Int("fail", 0, "Number of random nodes to fail in the starting ring")
+	linkSpeedStr   = flag.String("link-speed", "10Gbps", "Network speed of each node, for estimating transfer and recovery times")
+	intraRack      = flag.String("intra-rack", "", "Network speed of each node to nodes in its rack (default -link-speed)")
+	interRack      = flag.String("inter-rack", "", "Network speed of each node to other racks, its share of an oversubscribed uplink (default -intra-rack)")
+	racks          = flag.String("racks", "", "Comma-separated rack of each node, eg. r1,r1,r2,r2 (repeated as needed; default each node's zone, or one rack)")
+	fromCluster    = flag.String("from-cluster", "", "Start from the peers, ring and blocks of a live cluster, eg. etcd://127.0.0.1:2379")
+	fromDump       = flag.String("from-dump", "", "Start from the peers, ring and blocks in a file written by `torusctl ring dump`")
+	seriesFile     = flag.String("series", "", "File to write each node's blocks and fill at each step to, for plotting")
+	seriesFormat   = flag.String("series-format", "csv", "Format of -series: csv or tsv")
+	workers        = flag.Int("workers", runtime.NumCPU(), "Number of goroutines placing blocks in parallel")
+	hll            = flag.Bool("hll", false, "Estimate the number of unique blocks with HyperLogLog, for blocks that may repeat, rather than counting them")
+	seed           = flag.Int64("seed", 0, "Seed for the simulation's randomness, to reproduce an earlier run (default random)")
+	refStr         = flag.String("ref", "", "Instead of simulating, show the peers a block of the cluster, as VOLUME:INODE:INDEX, is on before and after -delta and -repEnd")
 	blockSize      uint64
 	totalData      uint64
 	peers          torus.PeerInfoList
 )
 
-var maxIterations = 30
-
-type ClusterState map[string][]torus.BlockRef
-
-type RebalanceStats struct {
-	BlocksKept uint64
-	BlocksSent uint64
-}
-
 func main() {
 	var err error
 	flag.Parse()
+	ringsim.Workers = *workers
+	rnd := newRand()
+	series = mustOpenSeries()
+	defer series.close()
+	if *fromCluster != "" || *fromDump != "" {
+		mainFromCensus(rnd)
+		return
+	}
+	if *refStr != "" {
+		fmt.Fprintf(os.Stderr, "-ref needs a real cluster, from -from-cluster or -from-dump\n")
+		os.Exit(1)
+	}
 	if *replicationEnd == 0 {
 		*replicationEnd = *replication
 	}
+	events := mustParsePlan()
 	nPeers := *nodes + *delta
-	if *delta <= 0 {
+	if *delta <= 0 || events != nil {
 		nPeers = *nodes
 	}
-	peers = make([]*models.PeerInfo, nPeers)
-	for i := 0; i < nPeers; i++ {
-		peers[i] = &models.PeerInfo{
-			UUID:        metadata.MakeUUID(),
-			TotalBlocks: 100 * 1024 * 1024 * 1024, // 100giga-blocks for testing
-		}
-	}
 	blockSize, err = humanize.ParseBytes(*blockSizeStr)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error parsing block-size: %s\n", err)
 		os.Exit(1)
 	}
+	caps, err := peerCapacities(rnd, nPeers, *capacities, *capacityDist, *capacityMean)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	peers = make([]*models.PeerInfo, nPeers)
+	for i := 0; i < nPeers; i++ {
+		peers[i] = &models.PeerInfo{
+			UUID:        randomUUID(rnd),
+			TotalBlocks: caps[i],
+			Zone:        rackOf(i),
+		}
+	}
 	totalData, err = humanize.ParseBytes(*totalDataStr)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error parsing total-data: %s\n", err)
 		os.Exit(1)
 	}
 	nblocks := totalData / blockSize
-	var blocks []torus.BlockRef
-	inode := torus.INodeID(1)
-	part := float64(*partition) / 100.0
-	for len(blocks) < int(nblocks) {
-		perFile := rand.Intn(1000) + 1
-		f := rand.NormFloat64()
-		var out []torus.BlockRef
-		if f < part {
-			out, inode = generateRewrittenFile(torus.VolumeID(1), inode, perFile)
-		} else {
-			out, inode = generateLinearFile(torus.VolumeID(1), inode, perFile)
-		}
-		blocks = append(blocks, out...)
+	g, err := ringsim.NewGenerator(rnd, *workloadName, blockSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Workload: %s\n", *workloadName)
+	blocks := g.Stream(int(nblocks))
+	if events != nil {
+		simulatePlan(rnd, g, blocks, createFromRing(), events)
+		return
 	}
 	r1, r2 := createRings()
-	fmt.Printf("Unique blocks: %d\n", len(blocks))
-	cluster := assignData(blocks, r1)
+	simulate(rnd, blocks, r1, r2)
+}
+
+// newRand returns the source of all of the simulation's randomness, seeded
+// from -seed so that a run can be repeated exactly.
+func newRand() *rand.Rand {
+	s := time.Now().UnixNano()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			s = *seed
+		}
+	})
+	fmt.Printf("Seed: %d\n", s)
+	return rand.New(rand.NewSource(s))
+}
+
+// randomUUID makes a peer UUID from rnd, as ring placement depends on UUIDs.
+func randomUUID(rnd *rand.Rand) string {
+	b := make([]byte, 16)
+	rnd.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// mustParsePlan returns the events of -plan, or nil if there isn't one.
+func mustParsePlan() []planEvent {
+	if *planStr == "" {
+		return nil
+	}
+	events, err := parsePlan(*planStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	return events
+}
+
+func mustLinkSpeed() uint64 {
+	linkSpeed, err := parseLinkSpeed(*linkSpeedStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing link-speed: %s\n", err)
+		os.Exit(1)
+	}
+	return linkSpeed
+}
+
+// countBlocks returns how many blocks there are, and prints it.
+func countBlocks(blocks ringsim.Stream) uint64 {
+	var n uint64
+	var h ringsim.HyperLogLog
+	err := blocks(func(b torus.BlockRef) error {
+		n++
+		if *hll {
+			h.Add(b)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if *hll {
+		n = h.Count()
+		fmt.Printf("Unique blocks: about %d (HyperLogLog estimate)\n", n)
+		return n
+	}
+	fmt.Printf("Unique blocks: %d\n", n)
+	return n
+}
+
+func simulate(rnd *rand.Rand, blocks ringsim.Stream, r1, r2 torus.Ring) {
+	linkSpeed := mustLinkSpeed()
+	nblocks := countBlocks(blocks)
+	cluster, err := ringsim.AssignCounts(blocks, r1)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
 	fmt.Println("@START *****")
-	cluster.printBalance()
-	newc, rebalance := cluster.Rebalance(r1, r2)
+	printBalance(cluster)
+	series.record("start", cluster)
+	if *fail > 0 {
+		fstats, err := simulateFailure(rnd, r1, blocks, *fail)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error failing peers: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("@FAILURE *****")
+		fstats.printStats(nblocks, linkSpeed)
+	}
+	newc, rebalance, err := ringsim.RebalanceCounts(blocks, r1, r2)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
 	fmt.Println("@END *****")
-	newc.printBalance()
+	printBalance(newc)
+	series.record("end", newc)
 	fmt.Println("Changes:")
-	rebalance.printStats()
+	printStats(rebalance, mustTopology(), math.Abs(float64(*delta)/float64(*delta+*nodes)))
 }
 
 func createRings() (torus.Ring, torus.Ring) {
-	ftype, ok := ring.RingTypeFromString(*ringType)
-	if !ok {
-		fmt.Fprintf(os.Stderr, "unknown ring type: %s\n", *ringType)
-		os.Exit(1)
-	}
+	from := createFromRing()
+	return from, createToRing(from, mustRingType(*ringType))
+}
+
+func createFromRing() torus.Ring {
 	from, err := ring.CreateRing(&models.Ring{
-		Type:              uint32(ftype),
+		Type:              uint32(mustRingType(*ringType)),
 		Version:           1,
 		ReplicationFactor: uint32(*replication),
 		Peers:             peers[:*nodes],
@@ -107,14 +225,20 @@ func createRings() (torus.Ring, torus.Ring) {
 		fmt.Fprintf(os.Stderr, "error creating from-ring: %s\n", err)
 		os.Exit(1)
 	}
+	return from
+}
 
+// createToRing applies -delta and -repEnd to the starting ring. Peers are
+// added or removed in place when the ring supports it, so that the simulation
+// moves as little as a live change would.
+func createToRing(from torus.Ring, ttype torus.RingType) torus.Ring {
 	if v, ok := from.(torus.RingAdder); *delta > 0 && ok {
 		to, err := v.AddPeers(peers[*nodes:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error adding peers to ring: %s\n", err)
 			os.Exit(1)
 		}
-		return from, to
+		return to
 	}
 	if v, ok := from.(torus.RingRemover); *delta <= 0 && ok {
 		to, err := v.RemovePeers(peers[*nodes+*delta:].PeerList())
@@ -122,17 +246,12 @@ func createRings() (torus.Ring, torus.Ring) {
 			fmt.Fprintf(os.Stderr, "error removing peers from ring: %s\n", err)
 			os.Exit(1)
 		}
-		return from, to
+		return to
 	}
 
-	ttype, ok := ring.RingTypeFromString(*ringType)
-	if !ok {
-		fmt.Fprintf(os.Stderr, "unknown ring type: %s\n", *ringType)
-		os.Exit(1)
-	}
 	to, err := ring.CreateRing(&models.Ring{
 		Type:              uint32(ttype),
-		Version:           2,
+		Version:           uint32(from.Version() + 1),
 		ReplicationFactor: uint32(*replicationEnd),
 		Peers:             peers[:(*nodes + *delta)],
 	})
@@ -140,124 +259,64 @@ func createRings() (torus.Ring, torus.Ring) {
 		fmt.Fprintf(os.Stderr, "error creating from-ring: %s\n", err)
 		os.Exit(1)
 	}
-	return from, to
+	return to
 }
 
-func assignData(blocks []torus.BlockRef, r torus.Ring) ClusterState {
-	out := make(map[string][]torus.BlockRef)
-	for _, p := range r.Members() {
-		out[p] = make([]torus.BlockRef, 0)
-	}
-	for _, b := range blocks {
-		peers, err := r.GetPeers(b)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error in the ring: %s\n", err)
-			os.Exit(1)
-		}
-		for _, p := range peers.Peers[:peers.Replication] {
-			out[p] = append(out[p], b)
-		}
+func mustRingType(name string) torus.RingType {
+	t, ok := ring.RingTypeFromString(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown ring type: %s (try one of %s)\n", name, strings.Join(ring.RingNames(), ", "))
+		os.Exit(1)
 	}
-	return out
+	return t
 }
 
-func (c ClusterState) printBalance() {
+func printBalance(c ringsim.Counts) {
 	fmt.Println("Balance:")
-	total := 0
-	for p, l := range c {
-		fmt.Printf("\t%s: %d\n", p, len(l))
-		total += len(l)
+	var total uint64
+	var fills []float64
+	var uuids []string
+	for p := range c {
+		uuids = append(uuids, p)
+	}
+	sort.Strings(uuids)
+	for _, p := range uuids {
+		n := c[p]
+		i := peers.UUIDAt(p)
+		fill := float64(n) * 100 / float64(peers[i].TotalBlocks)
+		fills = append(fills, fill)
+		fmt.Printf("\t%s: %d (%s, %0.2f%% full)\n", p, n, humanize.IBytes(peers[i].TotalBlocks*blockSize), fill)
+		total += n
 	}
 	mean := float64(total) / float64(len(c))
 	v := float64(0)
-	for _, l := range c {
-		v += math.Pow(float64(len(l))-mean, 2.0)
+	for _, n := range c {
+		v += math.Pow(float64(n)-mean, 2.0)
 	}
 	v = math.Sqrt(v / float64(len(c)))
 	//	fmt.Printf("Total: %d, Mean: %0.2f, Stddev: %0.4f\n", total, mean, v)
 	fmt.Printf("Total: %s, Mean: %s, Stddev: %s\n",
-		humanize.IBytes(uint64(total)*blockSize),
+		humanize.IBytes(total*blockSize),
 		humanize.IBytes(uint64(mean)*blockSize),
 		humanize.IBytes(uint64(v)*blockSize),
 	)
-}
-
-func (c ClusterState) Rebalance(oldRing, newRing torus.Ring) (ClusterState, RebalanceStats) {
-	var stats RebalanceStats
-	out := make(map[string][]torus.BlockRef)
-	for _, p := range newRing.Members() {
-		out[p] = make([]torus.BlockRef, 0)
+	minFill, maxFill := math.Inf(1), math.Inf(-1)
+	for _, f := range fills {
+		minFill = math.Min(minFill, f)
+		maxFill = math.Max(maxFill, f)
 	}
-	for p, l := range c {
-		for _, ref := range l {
-			newp, err := newRing.GetPeers(ref)
-			newpeers := newp.Peers[:newp.Replication]
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error in the new ring: %s\n", err)
-				os.Exit(1)
-			}
-			oldp, err := oldRing.GetPeers(ref)
-			oldpeers := oldp.Peers[:oldp.Replication]
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error in the old ring: %s\n", err)
-				os.Exit(1)
-			}
-			myIndex := oldpeers.IndexAt(p)
-			if newpeers.Has(p) {
-				out[p] = append(out[p], ref)
-				stats.BlocksKept++
-			}
-			diffpeers := newpeers.AndNot(oldpeers)
-			if myIndex >= len(diffpeers) {
-				// downsizing
-				continue
-			}
-			if myIndex == len(oldpeers)-1 && len(diffpeers) > len(oldpeers) {
-				for i := myIndex; i < len(diffpeers); i++ {
-					p := diffpeers[i]
-					out[p] = append(out[p], ref)
-					stats.BlocksSent++
-				}
-			} else {
-				p := diffpeers[myIndex]
-				out[p] = append(out[p], ref)
-				stats.BlocksSent++
-			}
-		}
-	}
-	return out, stats
+	fmt.Printf("Fill: min %0.2f%%, max %0.2f%%\n", minFill, maxFill)
 }
 
-func (s RebalanceStats) printStats() {
+// printStats prints what a change of ring cost. perfect is the share of the
+// blocks an ideal ring would have moved.
+func printStats(s ringsim.Stats, t ringsim.Topology, perfect float64) {
 	fmt.Printf("Blocks Kept: %d\n", s.BlocksKept)
 	fmt.Printf("Blocks Sent: %d\n", s.BlocksSent)
 	fmt.Printf("Percentage Sent: %0.2f\n", ((float64(s.BlocksSent) * 100) / (float64(s.BlocksSent + s.BlocksKept))))
 	fmt.Printf("Network Traffic: %s\n", humanize.IBytes(s.BlocksSent*blockSize))
 	total := float64((s.BlocksSent + s.BlocksKept) * blockSize)
-	perfect := total * math.Abs(float64(*delta)/float64(*delta+*nodes))
-	fmt.Printf("Perfect Traffic: %s\n", humanize.IBytes(uint64(perfect)))
-}
-
-func generateLinearFile(vol torus.VolumeID, in torus.INodeID, size int) ([]torus.BlockRef, torus.INodeID) {
-	var out []torus.BlockRef
-	for x := 1; x <= size; x++ {
-		out = append(out, torus.BlockRef{
-			INodeRef: torus.NewINodeRef(vol, in),
-			Index:    torus.IndexID(x),
-		})
-	}
-	return out, in + 1
-}
-
-func generateRewrittenFile(vol torus.VolumeID, inStart torus.INodeID, size int) ([]torus.BlockRef, torus.INodeID) {
-	file, inode := generateLinearFile(vol, inStart, size)
-	its := rand.Intn(maxIterations)
-	for i := 0; i < its; i++ {
-		off := rand.Intn(len(file))
-		len := rand.Intn(len(file) - off)
-		piece, in := generateLinearFile(vol, inode, len)
-		inode = in
-		copy(file[off:], piece)
-	}
-	return file, inode
+	fmt.Printf("Perfect Traffic: %s\n", humanize.IBytes(uint64(total*perfect)))
+	printRackTraffic(s, t)
+	fmt.Printf("Estimated Time: %s\n", s.TopologyDuration(blockSize, t))
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/coreos/torus/ringsim"
+)
+
+// seriesWriter writes the blocks and fill of every peer at each step of the
+// simulation, one row per peer per step, for plotting.
+type seriesWriter struct {
+	f    *os.File
+	w    *csv.Writer
+	step int
+}
+
+// series is where -series goes, or nil.
+var series *seriesWriter
+
+func mustOpenSeries() *seriesWriter {
+	if *seriesFile == "" {
+		return nil
+	}
+	var comma rune
+	switch *seriesFormat {
+	case "csv":
+		comma = ','
+	case "tsv":
+		comma = '\t'
+	default:
+		fmt.Fprintf(os.Stderr, "unknown series format %q; use one of 'csv' or 'tsv'\n", *seriesFormat)
+		os.Exit(1)
+	}
+	f, err := os.Create(*seriesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating series file: %s\n", err)
+		os.Exit(1)
+	}
+	s := &seriesWriter{f: f, w: csv.NewWriter(f)}
+	s.w.Comma = comma
+	s.w.Write([]string{"step", "event", "peer", "rack", "blocks", "capacity", "fill"})
+	return s
+}
+
+// record writes where the blocks of c are after event.
+func (s *seriesWriter) record(event string, c ringsim.Counts) {
+	if s == nil {
+		return
+	}
+	var uuids []string
+	for p := range c {
+		uuids = append(uuids, p)
+	}
+	sort.Strings(uuids)
+	for _, p := range uuids {
+		n := c[p]
+		var total uint64
+		var rack string
+		if i := peers.UUIDAt(p); i != -1 {
+			total = peers[i].TotalBlocks
+			rack = peers[i].Zone
+		}
+		fill := 0.0
+		if total != 0 {
+			fill = float64(n) / float64(total)
+		}
+		s.w.Write([]string{
+			strconv.Itoa(s.step),
+			event,
+			p,
+			rack,
+			strconv.FormatUint(n, 10),
+			strconv.FormatUint(total, 10),
+			strconv.FormatFloat(fill, 'g', -1, 64),
+		})
+	}
+	s.step++
+}
+
+func (s *seriesWriter) close() {
+	if s == nil {
+		return
+	}
+	s.w.Flush()
+	err := s.w.Error()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing series file: %s\n", err)
+		os.Exit(1)
+	}
+}
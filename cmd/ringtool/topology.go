@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/torus/ringsim"
+	"github.com/dustin/go-humanize"
+)
+
+// rackOf returns the rack -racks puts the ith peer in, or "" if it isn't
+// given. The list is repeated as needed to cover all the peers.
+func rackOf(i int) string {
+	if *racks == "" {
+		return ""
+	}
+	list := strings.Split(*racks, ",")
+	return strings.TrimSpace(list[i%len(list)])
+}
+
+// mustTopology returns how the peers are connected: each peer's zone is its
+// rack, linked at -intra-rack within it and -inter-rack to the others.
+func mustTopology() ringsim.Topology {
+	t := ringsim.Topology{
+		Racks:     make(map[string]string),
+		IntraRack: mustLinkSpeed(),
+	}
+	var err error
+	if *intraRack != "" {
+		t.IntraRack, err = parseLinkSpeed(*intraRack)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing intra-rack: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	t.InterRack = t.IntraRack
+	if *interRack != "" {
+		t.InterRack, err = parseLinkSpeed(*interRack)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing inter-rack: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, p := range peers {
+		t.Racks[p.UUID] = p.Zone
+	}
+	return t
+}
+
+// multiRack returns whether the peers are spread over more than one rack.
+func multiRack(t ringsim.Topology) bool {
+	seen := make(map[string]bool)
+	for _, rack := range t.Racks {
+		seen[rack] = true
+	}
+	return len(seen) > 1
+}
+
+func printRackTraffic(s ringsim.Stats, t ringsim.Topology) {
+	if !multiRack(t) {
+		return
+	}
+	intra, inter := s.CrossRack(t)
+	fmt.Printf("Intra-Rack Traffic: %s\n", humanize.IBytes(intra*blockSize))
+	fmt.Printf("Cross-Rack Traffic: %s\n", humanize.IBytes(inter*blockSize))
+}
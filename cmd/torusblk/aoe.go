@@ -88,6 +88,7 @@ func aoeAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("server doesn't support block volumes: %v", err)
 	}
+	blockvol.IOClass = ioClass
 
 	ai, err := aoe.NewInterface(ifname)
 	if err != nil {
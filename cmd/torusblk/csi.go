@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/csi"
+)
+
+var csiCommand = &cobra.Command{
+	Use:   "csi",
+	Short: "serve the Container Storage Interface for block volumes",
+	Long: strings.TrimSpace(`
+Serve the Container Storage Interface (CSI), so that Kubernetes and other
+container orchestrators can create and delete block volumes and attach them
+to the nodes their workloads run on.
+
+Run it on every node that mounts volumes, with --node-id set to the name the
+orchestrator knows the node by, and next to the orchestrator's provisioner.
+Volumes are attached over NBD by the process that publishes them, so it must
+keep running for as long as they are in use.
+`),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := csiAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+var (
+	csiEndpoint string
+	csiNodeID   string
+)
+
+func init() {
+	rootCommand.AddCommand(csiCommand)
+
+	csiCommand.Flags().StringVarP(&csiEndpoint, "endpoint", "", "unix:///var/lib/kubelet/plugins/"+csi.DriverName+"/csi.sock", "CSI endpoint to listen on")
+	csiCommand.Flags().StringVarP(&csiNodeID, "node-id", "", "", "name of this node to the orchestrator (default the hostname)")
+}
+
+func csiAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	nodeID := csiNodeID
+	if nodeID == "" {
+		var err error
+		nodeID, err = os.Hostname()
+		if err != nil {
+			return fmt.Errorf("couldn't get the hostname for the node ID: %v", err)
+		}
+	}
+	l, err := csi.Listen(csiEndpoint)
+	if err != nil {
+		return fmt.Errorf("couldn't listen on %s: %v", csiEndpoint, err)
+	}
+
+	srv := createServer()
+	defer srv.Close()
+	d := csi.NewDriver(srv, nodeID)
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for _ = range signalChan {
+			fmt.Println("\nReceived an interrupt, detaching volumes...")
+			d.Stop()
+		}
+	}()
+
+	if err := d.Serve(l); err != nil {
+		return fmt.Errorf("error from CSI server: %v", err)
+	}
+	return nil
+}
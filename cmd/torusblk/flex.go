@@ -26,6 +26,7 @@ type VolumeData struct {
 	ReadWrite      string `json:"kubernetes.io/readwrite"`
 	WriteLevel     string `json:"writeLevel"`
 	WriteCacheSize string `json:"writeCacheSize"`
+	IOClass        string `json:"ioClass"`
 }
 
 type Response struct {
@@ -183,6 +184,13 @@ func attachAction(cmd *cobra.Command, args []string) {
 	if vol.WriteCacheSize != "" {
 		cmdList = append(cmdList, []string{"--write-cache-size", vol.WriteCacheSize}...)
 	}
+	if vol.IOClass != "" {
+		_, err := torus.ParseIOClass(vol.IOClass)
+		if err != nil {
+			onErr(err)
+		}
+		cmdList = append(cmdList, []string{"--io-class", vol.IOClass}...)
+	}
 
 	ch := make(chan string)
 
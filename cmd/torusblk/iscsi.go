@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/block/iscsi"
+)
+
+var iscsiCommand = &cobra.Command{
+	Use:   "iscsi VOLUME...",
+	Short: "serve block volumes over iSCSI",
+	Long: strings.TrimSpace(`
+Serve block volumes as the LUNs of an iSCSI target, in the order given, for
+initiators that can't use NBD, such as ESXi and Windows.
+
+Initiators must log in with CHAP if --chap-user is set, and may ask the
+target to authenticate too if --mutual-chap-user is set. Persistent
+reservations are kept in the metadata service, so they survive a restart of
+the target and are seen by every target serving the same volume.
+
+An example of serving two volumes to initiators that log in as "esx":
+
+	torusblk iscsi --chap-user esx --chap-secret s3cretpassword vol01 vol02
+`),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := iscsiAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+var (
+	iscsiListen       string
+	iscsiTargetName   string
+	iscsiCHAPUser     string
+	iscsiCHAPSecret   string
+	iscsiMutualUser   string
+	iscsiMutualSecret string
+)
+
+func init() {
+	rootCommand.AddCommand(iscsiCommand)
+
+	iscsiCommand.Flags().StringVarP(&iscsiListen, "listen", "l", "0.0.0.0:3260", "iSCSI portal listen address")
+	iscsiCommand.Flags().StringVarP(&iscsiTargetName, "target-name", "", "", "iSCSI qualified name of the target (default iqn.2016-06.com.coreos:torus.HOSTNAME)")
+	iscsiCommand.Flags().StringVarP(&iscsiCHAPUser, "chap-user", "", "", "CHAP user name initiators must log in with")
+	iscsiCommand.Flags().StringVarP(&iscsiCHAPSecret, "chap-secret", "", "", "CHAP secret initiators must log in with")
+	iscsiCommand.Flags().StringVarP(&iscsiMutualUser, "mutual-chap-user", "", "", "CHAP user name the target authenticates to initiators with")
+	iscsiCommand.Flags().StringVarP(&iscsiMutualSecret, "mutual-chap-secret", "", "", "CHAP secret the target authenticates to initiators with")
+}
+
+func iscsiAction(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return torus.ErrUsage
+	}
+	if (iscsiCHAPUser == "") != (iscsiCHAPSecret == "") || (iscsiMutualUser == "") != (iscsiMutualSecret == "") {
+		return fmt.Errorf("CHAP users and secrets must be given together")
+	}
+	if iscsiMutualUser != "" && iscsiCHAPUser == "" {
+		return fmt.Errorf("mutual CHAP needs --chap-user too")
+	}
+	name := iscsiTargetName
+	if name == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("couldn't get the hostname for the target name: %v", err)
+		}
+		name = "iqn.2016-06.com.coreos:torus." + strings.ToLower(host)
+	}
+
+	srv := createServer()
+	defer srv.Close()
+	gmd := srv.MDS.GlobalMetadata()
+
+	var luns []*iscsi.LUN
+	for _, vol := range args {
+		blockvol, err := block.OpenBlockVolume(srv, vol)
+		if err != nil {
+			return fmt.Errorf("server doesn't support block volumes: %s", err)
+		}
+		blockvol.IOClass = ioClass
+		f, err := blockvol.OpenBlockFile()
+		if err != nil {
+			if err == torus.ErrLocked {
+				return fmt.Errorf("volume %s is already mounted on another host", vol)
+			}
+			return fmt.Errorf("can't open block volume %s: %s", vol, err)
+		}
+		defer f.Close()
+		lun := &iscsi.LUN{
+			Name:      vol,
+			Device:    f,
+			BlockSize: gmd.BlockSize,
+		}
+		if res, err := blockvol.Reservations(); err == nil {
+			lun.Store = res
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: persistent reservations of %s will be lost when the target stops: %v\n", vol, err)
+		}
+		luns = append(luns, lun)
+	}
+
+	t, err := iscsi.NewTarget(iscsiListen, iscsi.Config{
+		Name:         name,
+		CHAPUser:     iscsiCHAPUser,
+		CHAPSecret:   iscsiCHAPSecret,
+		MutualUser:   iscsiMutualUser,
+		MutualSecret: iscsiMutualSecret,
+	}, luns)
+	if err != nil {
+		return fmt.Errorf("failed to create iSCSI target: %v", err)
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	go func() {
+		for _ = range signalChan {
+			fmt.Println("\nReceived an interrupt, stopping the target...")
+			t.Close()
+		}
+	}()
+
+	fmt.Printf("serving %s on %s\n", name, t.Addr())
+	if err := t.Serve(); err != nil {
+		return fmt.Errorf("error from iSCSI target: %v", err)
+	}
+	return nil
+}
@@ -11,8 +11,10 @@ import (
 	"github.com/coreos/torus/distributor"
 	"github.com/coreos/torus/internal/flagconfig"
 	"github.com/coreos/torus/internal/http"
+	"github.com/coreos/torus/internal/tracing"
 
 	// Register all the drivers.
+	_ "github.com/coreos/torus/metadata/consul"
 	_ "github.com/coreos/torus/metadata/etcd"
 	_ "github.com/coreos/torus/storage"
 )
@@ -22,7 +24,13 @@ var (
 	httpAddr string
 	cfg      torus.Config
 
+	ioClassName string
+	ioClass     torus.IOClass
+
 	debug bool
+
+	// stopTracing flushes the spans of a command that started a server.
+	stopTracing = func() {}
 )
 
 var rootCommand = &cobra.Command{
@@ -61,7 +69,9 @@ func init() {
 	rootCommand.PersistentFlags().StringVarP(&logpkg, "logpkg", "", "", "Specific package logging")
 	rootCommand.PersistentFlags().StringVarP(&httpAddr, "http", "", "", "HTTP endpoint for debug and stats")
 	rootCommand.PersistentFlags().BoolVarP(&debug, "debug", "", false, "Turn on debug output")
+	rootCommand.PersistentFlags().StringVarP(&ioClassName, "io-class", "", "normal", "How urgent the volume's I/O is on shared peers: latency, normal or batch")
 	flagconfig.AddConfigFlags(rootCommand.PersistentFlags())
+	tracing.AddFlags(rootCommand.PersistentFlags())
 }
 
 func configureServer(cmd *cobra.Command, args []string) {
@@ -82,11 +92,24 @@ func configureServer(cmd *cobra.Command, args []string) {
 		rl.SetLogLevel(llc)
 	}
 
+	var err error
+	ioClass, err = torus.ParseIOClass(ioClassName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing io-class: %s\n", err)
+		os.Exit(1)
+	}
+
 	cfg = flagconfig.BuildConfigFromFlags()
 }
 
 func createServer() *torus.Server {
-	srv, err := torus.NewServer(cfg, "etcd", "temp")
+	stop, err := tracing.Start("torusblk")
+	if err != nil {
+		fmt.Printf("Couldn't start tracing: %s\n", err)
+		os.Exit(1)
+	}
+	stopTracing = stop
+	srv, err := torus.NewServer(cfg, flagconfig.MetadataService(), "temp")
 	if err != nil {
 		fmt.Printf("Couldn't start: %s\n", err)
 		os.Exit(1)
@@ -105,7 +128,9 @@ func createServer() *torus.Server {
 func main() {
 	capnslog.SetGlobalLogLevel(capnslog.WARNING)
 
-	if err := rootCommand.Execute(); err != nil {
+	err := rootCommand.Execute()
+	stopTracing()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -45,6 +45,8 @@ var (
 var (
 	serveListenAddress string
 	detachDevice       string
+	nbdConnections     int
+	nbdForce           bool
 )
 
 func init() {
@@ -52,6 +54,8 @@ func init() {
 	rootCommand.AddCommand(nbdServeCommand)
 
 	nbdCommand.Flags().StringVarP(&detachDevice, "detach", "d", "", "detach an NBD device from a block volume. (e.g. torsublk nbd -d /dev/nbd0)")
+	nbdCommand.Flags().IntVarP(&nbdConnections, "connections", "", 1, "number of connections the kernel sends requests over, for more parallel I/O (needs Linux 4.10 or later for more than one)")
+	nbdCommand.Flags().BoolVarP(&nbdForce, "force", "", false, "take the volume over from the host that has it attached if that host has stopped renewing its attachment, as when failing a VM over")
 	nbdServeCommand.Flags().StringVarP(&serveListenAddress, "listen", "l", "0.0.0.0:10809", "nbd server listen address")
 }
 
@@ -89,10 +93,14 @@ func nbdAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("server doesn't support block volumes: %s", err)
 	}
+	blockvol.IOClass = ioClass
 
-	f, err := blockvol.OpenBlockFile()
+	f, err := attach(blockvol, nbdForce)
 	if err != nil {
 		if err == torus.ErrLocked {
+			if nbdForce {
+				return fmt.Errorf("volume %s is attached on another host that is still renewing its attachment", args[0])
+			}
 			return fmt.Errorf("volume %s is already mounted on another host", args[0])
 		}
 		return fmt.Errorf("can't open block volume: %s", err)
@@ -105,13 +113,39 @@ func nbdAction(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func connectNBD(srv *torus.Server, f *block.BlockFile, target string, closer chan bool) error {
+// attach attaches a block volume, shared if it's a shared volume. With force,
+// an attachment that's no longer renewed is taken over.
+func attach(blockvol *block.BlockVolume, force bool) (nbd.Device, error) {
+	shared, err := blockvol.Shared()
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		f, err := blockvol.OpenSharedBlockFile()
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	open := blockvol.OpenBlockFile
+	if force {
+		open = blockvol.ForceOpenBlockFile
+	}
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func connectNBD(srv *torus.Server, f nbd.Device, target string, closer chan bool) error {
 	defer f.Close()
 	size := f.Size()
 
 	gmd := srv.MDS.GlobalMetadata()
 
 	handle := nbd.Create(f, int64(size), int64(gmd.BlockSize))
+	handle.SetConnections(nbdConnections)
 
 	if target == "" {
 		t, err := nbd.FindDevice()
@@ -147,8 +181,9 @@ func (f *finder) FindDevice(name string) (nbd.Device, error) {
 	if err != nil {
 		return nil, err
 	}
+	blockvol.IOClass = ioClass
 
-	return blockvol.OpenBlockFile()
+	return attach(blockvol, false)
 }
 
 func (f *finder) ListDevices() ([]string, error) {
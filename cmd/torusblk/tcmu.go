@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/block"
@@ -18,6 +19,15 @@ var (
 	tcmuCommand = &cobra.Command{
 		Use:   "tcmu VOLUME",
 		Short: "attach a torus block volume via SCSI",
+		Long: strings.TrimSpace(`
+Attach a block volume as a local SCSI disk through the kernel's
+target_core_user (TCMU) module, so it is used through the kernel's own SCSI
+stack and page cache rather than NBD.
+
+This needs the target_core_user and tcm_loop modules loaded and configfs
+mounted at /sys/kernel/config. Each attached volume gets its own user HBA,
+so several can be attached on one host at once.
+`),
 		Run: func(cmd *cobra.Command, args []string) {
 			err := tcmuAction(cmd, args)
 			if err == torus.ErrUsage {
@@ -30,8 +40,12 @@ var (
 	}
 )
 
+var tcmuWorkers int
+
 func init() {
 	rootCommand.AddCommand(tcmuCommand)
+
+	tcmuCommand.Flags().IntVarP(&tcmuWorkers, "workers", "", 4, "number of SCSI commands served at once")
 }
 
 func tcmuAction(cmd *cobra.Command, args []string) error {
@@ -56,6 +70,7 @@ func tcmuAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("server doesn't support block volumes: %s", err)
 	}
+	blockvol.IOClass = ioClass
 
 	f, err := blockvol.OpenBlockFile()
 	if err != nil {
@@ -65,7 +80,10 @@ func tcmuAction(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("can't open block volume: %s", err)
 	}
 	defer f.Close()
-	err = torustcmu.ConnectAndServe(f, args[0], closer)
+	err = torustcmu.ConnectAndServe(f, args[0], torustcmu.Options{
+		Workers:   tcmuWorkers,
+		BlockSize: srv.MDS.GlobalMetadata().BlockSize,
+	}, closer)
 	if err != nil {
 		return fmt.Errorf("failed to serve volume using SCSI: %s", err)
 	}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/flagconfig"
+	"github.com/spf13/cobra"
+)
+
+var aclCluster bool
+
+var (
+	aclCommand = &cobra.Command{
+		Use:   "acl",
+		Short: "manage who may use volumes",
+		Long: `manage the access control lists of volumes.
+
+Identities are written cn:NAME, for clients presenting a peer certificate
+with common name NAME, or token:TOKEN, for clients started with --token TOKEN.
+Permissions are read, write and admin; each implies the ones before it. A
+volume without an ACL is open to everyone. With --cluster, the cluster ACL is
+changed instead, which applies to every volume that has an ACL, such as for
+storage nodes.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	aclGrantCommand = &cobra.Command{
+		Use:   "grant [VOLUME] IDENTITY PERMISSION",
+		Short: "give an identity a permission on a volume",
+		Run:   aclRun(aclGrantAction),
+	}
+
+	aclRevokeCommand = &cobra.Command{
+		Use:   "revoke [VOLUME] IDENTITY",
+		Short: "take away an identity's permission on a volume",
+		Run:   aclRun(aclRevokeAction),
+	}
+
+	aclListCommand = &cobra.Command{
+		Use:   "list [VOLUME]",
+		Short: "show the ACL of a volume",
+		Run:   aclRun(aclListAction),
+	}
+)
+
+func init() {
+	aclCommand.AddCommand(aclGrantCommand)
+	aclCommand.AddCommand(aclRevokeCommand)
+	aclCommand.AddCommand(aclListCommand)
+	aclCommand.PersistentFlags().BoolVarP(&aclCluster, "cluster", "", false, "use the cluster ACL instead of a volume's")
+	aclListCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func aclRun(f func(cfg torus.Config, mds torus.MetadataService, args []string) error) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		cfg := flagconfig.BuildConfigFromFlags()
+		mds, err := torus.CreateMetadataService(flagconfig.MetadataService(), cfg)
+		if err != nil {
+			die("couldn't connect to the metadata service: %v", err)
+		}
+		err = f(cfg, mds, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	}
+}
+
+// aclVolume takes the volume from the front of args, unless --cluster was
+// given, and returns the rest of them.
+func aclVolume(mds torus.MetadataService, args []string) (torus.VolumeID, []string, error) {
+	if aclCluster {
+		return torus.ClusterACL, args, nil
+	}
+	if len(args) == 0 {
+		return 0, nil, torus.ErrUsage
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return 0, nil, fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	return torus.VolumeID(vol.Id), args[1:], nil
+}
+
+func parseIdentity(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, "cn:") && len(s) > len("cn:"):
+		return s, nil
+	case strings.HasPrefix(s, "token:") && len(s) > len("token:"):
+		return torus.TokenIdentity(strings.TrimPrefix(s, "token:")), nil
+	}
+	return "", fmt.Errorf("identity %q must be cn:NAME or token:TOKEN", s)
+}
+
+func aclGrantAction(cfg torus.Config, mds torus.MetadataService, args []string) error {
+	vid, args, err := aclVolume(mds, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return torus.ErrUsage
+	}
+	who, err := parseIdentity(args[0])
+	if err != nil {
+		return err
+	}
+	p, err := torus.ParsePermission(args[1])
+	if err != nil {
+		return err
+	}
+	return torus.SetPermission(mds, cfg.Identity, vid, who, p)
+}
+
+func aclRevokeAction(cfg torus.Config, mds torus.MetadataService, args []string) error {
+	vid, args, err := aclVolume(mds, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	who, err := parseIdentity(args[0])
+	if err != nil {
+		return err
+	}
+	return torus.SetPermission(mds, cfg.Identity, vid, who, torus.PermNone)
+}
+
+func aclListAction(cfg torus.Config, mds torus.MetadataService, args []string) error {
+	vid, args, err := aclVolume(mds, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	amds, ok := mds.(torus.ACLMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support ACLs")
+	}
+	acl, err := amds.GetACL(vid)
+	if err != nil {
+		return fmt.Errorf("couldn't get ACL: %v", err)
+	}
+	if len(acl) == 0 && !outputAsCSV {
+		fmt.Println("no ACL; open to everyone")
+		return nil
+	}
+	ids := make([]string, 0, len(acl))
+	for id := range acl {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Identity", "Permission"})
+	for _, id := range ids {
+		table.Append([]string{id, acl[id].String()})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+	} else {
+		table.Render()
+	}
+	return nil
+}
@@ -22,6 +22,8 @@ var blockCreateCommand = &cobra.Command{
 
 func init() {
 	blockCommand.AddCommand(blockCreateCommand)
+	blockCreateCommand.Flags().BoolVarP(&volumeShared, "shared", "", false, "let many hosts attach the volume at once, for clustered filesystems")
+	blockCreateCommand.Flags().StringVarP(&volumePool, "pool", "", "", "storage pool to place the volume in, instead of the cluster's ring")
 	flagconfig.AddConfigFlags(blockCommand.PersistentFlags())
 }
 
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	locateFallbacks int
+	verifyWorkers   int
+)
+
+var blockLocateCommand = &cobra.Command{
+	Use:   "locate REF",
+	Short: "ask the peers a block is placed on for their copies of it",
+	Long: `ask the peers a block is placed on, given its ref as VOLUME:INODE:INDEX, for
+their copies of it, and show which have it and the checksum of each copy.
+
+Every replica should have the same copy. Fallbacks only have one if a write
+was handed off to them while a replica was down.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := blockLocateAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+var blockVerifyCommand = &cobra.Command{
+	Use:   "verify VOLUME",
+	Short: "check that every replica of every block of a volume has the same copy",
+	Long: `ask the replicas of every block of block volume VOLUME for their copies,
+and list the blocks that a replica is missing, can't read, or has a copy of
+that differs from the others'. It exits with an error if there are any.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := blockVerifyAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	blockCommand.AddCommand(blockLocateCommand, blockVerifyCommand)
+	blockLocateCommand.Flags().IntVar(&locateFallbacks, "fallbacks", 2, "how many fallbacks after the replicas to ask as well")
+	blockVerifyCommand.Flags().IntVar(&verifyWorkers, "parallel", 16, "how many blocks to check at once")
+}
+
+func mustBlockLocator(srv *torus.Server) torus.BlockLocator {
+	l, ok := srv.Blocks.(torus.BlockLocator)
+	if !ok {
+		die("the block store can't locate blocks")
+	}
+	return l
+}
+
+func blockLocateAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	ref, err := torus.ParseBlockRef(args[0])
+	if err != nil {
+		return err
+	}
+	srv := createServer()
+	defer srv.Close()
+	copies, err := mustBlockLocator(srv).LocateBlock(context.Background(), ref, locateFallbacks)
+	if err != nil {
+		return fmt.Errorf("couldn't locate %s: %v", ref, err)
+	}
+	peers, err := srv.MDS.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peers: %v", err)
+	}
+
+	fmt.Printf("Block: %s\n\n", ref)
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Role", "UUID", "Address", "Has", "Checksum", "Error"})
+	n := 0
+	for _, c := range copies {
+		role := "fallback"
+		if c.Replica {
+			n++
+			role = fmt.Sprintf("replica %d", n)
+		}
+		addr := ""
+		if i := peers.UUIDAt(c.Peer); i != -1 {
+			addr = peers[i].Address
+		}
+		has, sum, msg := "no", "", ""
+		switch {
+		case c.Has:
+			has = "yes"
+		case c.Err != nil:
+			has = "?"
+		}
+		if c.Has && c.Err == nil {
+			sum = fmt.Sprintf("%08x", c.Checksum)
+		}
+		if c.Err != nil {
+			msg = c.Err.Error()
+		}
+		table.Append([]string{role, c.Peer, addr, has, sum, msg})
+	}
+	table.Render()
+	if problem := replicaProblem(copies); problem != "" {
+		fmt.Printf("\n%s\n", problem)
+	}
+	return nil
+}
+
+// replicaProblem returns what's wrong with the replicas of a block, or "" if
+// they all have the same copy.
+func replicaProblem(copies []torus.ReplicaCopy) string {
+	var missing, unreadable, unknown int
+	sums := make(map[uint32]bool)
+	for _, c := range copies {
+		if !c.Replica {
+			continue
+		}
+		switch {
+		case c.Has && c.Err != nil:
+			unreadable++
+		case c.Has:
+			sums[c.Checksum] = true
+		case c.Err != nil:
+			unknown++
+		default:
+			missing++
+		}
+	}
+	var out string
+	add := func(format string, args ...interface{}) {
+		if out != "" {
+			out += ", "
+		}
+		out += fmt.Sprintf(format, args...)
+	}
+	if missing != 0 {
+		add("%d replicas missing", missing)
+	}
+	if unreadable != 0 {
+		add("%d replicas unreadable", unreadable)
+	}
+	if unknown != 0 {
+		add("%d replicas couldn't be asked", unknown)
+	}
+	if len(sums) > 1 {
+		add("replicas have %d different copies", len(sums))
+	}
+	return out
+}
+
+func blockVerifyAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	if verifyWorkers < 1 {
+		verifyWorkers = 1
+	}
+	srv := createServer()
+	defer srv.Close()
+	l := mustBlockLocator(srv)
+	bv, err := block.OpenBlockVolume(srv, args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't open volume %s: %v", args[0], err)
+	}
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		return fmt.Errorf("couldn't list the blocks of %s: %v", args[0], err)
+	}
+
+	var (
+		mut  sync.Mutex
+		bad  int
+		wg   sync.WaitGroup
+		work = make(chan torus.BlockRef)
+	)
+	for w := 0; w < verifyWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ref := range work {
+				problem := ""
+				copies, err := l.LocateBlock(context.Background(), ref, 0)
+				if err != nil {
+					problem = err.Error()
+				} else {
+					problem = replicaProblem(copies)
+				}
+				if problem == "" {
+					continue
+				}
+				mut.Lock()
+				bad++
+				fmt.Printf("%s: %s\n", ref, problem)
+				mut.Unlock()
+			}
+		}()
+	}
+	for _, ref := range refs {
+		work <- ref
+	}
+	close(work)
+	wg.Wait()
+	fmt.Printf("Checked %d blocks of %s: %d with problems\n", len(refs), args[0], bad)
+	if bad != 0 {
+		return fmt.Errorf("%d blocks of %s have problems; see 'torusctl block locate REF'", bad, args[0])
+	}
+	return nil
+}
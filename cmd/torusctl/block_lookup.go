@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var blockLookupCommand = &cobra.Command{
+	Use:   "lookup REF",
+	Short: "show which peers a block is placed on",
+	Long: `show which peers a block is placed on, given its ref as VOLUME:INODE:INDEX,
+as it appears in logs.
+
+The replicas are the peers the block should be on, by the current ring and its
+volume's replication; the fallbacks are where reads look and writes go when a
+replica is down.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := blockLookupAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	blockCommand.AddCommand(blockLookupCommand)
+}
+
+func blockLookupAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	ref, err := torus.ParseBlockRef(args[0])
+	if err != nil {
+		return err
+	}
+	srv := createServer()
+	defer srv.Close()
+	r, err := srv.MDS.GetRing()
+	if err != nil {
+		return fmt.Errorf("couldn't get ring: %v", err)
+	}
+	// The distributor's ring accounts for per-volume replication.
+	if d, ok := srv.Blocks.(interface {
+		Ring() torus.Ring
+	}); ok {
+		r = d.Ring()
+	}
+	perm, err := torus.GetBlockPeers(r, ref)
+	if err != nil {
+		return fmt.Errorf("couldn't place %s: %v", ref, err)
+	}
+	peers, err := srv.MDS.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peers: %v", err)
+	}
+
+	vol := "unknown"
+	vols, _, err := srv.MDS.GetVolumes()
+	if err != nil {
+		return fmt.Errorf("couldn't get volumes: %v", err)
+	}
+	for _, v := range vols {
+		if torus.VolumeID(v.Id) == ref.Volume() {
+			vol = v.Name
+		}
+	}
+	fmt.Printf("Block:  %s\n", ref)
+	fmt.Printf("Volume: %s\n", vol)
+	fmt.Printf("Ring:   %d (%s)\n\n", r.Version(), r.Describe())
+
+	replicas := perm.Replicas()
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Role", "UUID", "Address", "Zone", "Status"})
+	for i, p := range perm.Peers {
+		role := fmt.Sprintf("replica %d", i+1)
+		if i >= len(replicas) {
+			role = "fallback"
+		}
+		addr, zone, status := "", "", "down"
+		if j := peers.UUIDAt(p); j != -1 {
+			addr, zone = peers[j].Address, peers[j].Zone
+			if !torus.PeerStale(peers[j], srv.Cfg.PeerTimeout) {
+				status = "up"
+			}
+		}
+		table.Append([]string{role, p, addr, zone, status})
+	}
+	table.Render()
+	return nil
+}
@@ -11,69 +11,51 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var (
-	blockSnapshotCommand = &cobra.Command{
+// snapshotCommand returns the snapshot command tree. It's available as both
+// "torusctl block snapshot" and "torusctl volume snapshot", and cobra
+// commands can only have one parent, so each gets its own.
+func snapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
 		Use:   "snapshot",
 		Short: "manipulate snapshots for a block volume",
 		Run:   blockAction,
 	}
-
-	bsnapListCommand = &cobra.Command{
+	list := &cobra.Command{
 		Use:   "list VOLUME",
 		Short: "list snapshots for a block volume",
-		Run: func(cmd *cobra.Command, args []string) {
-			err := bsnapListAction(cmd, args)
-			if err == torus.ErrUsage {
-				cmd.Usage()
-				os.Exit(1)
-			} else if err != nil {
-				die("%v", err)
-			}
-		},
+		Run:   snapshotRun(bsnapListAction),
 	}
-
-	bsnapCreateCommand = &cobra.Command{
+	list.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+	cmd.AddCommand(list)
+	cmd.AddCommand(&cobra.Command{
 		Use:   "create VOLUME@SNAPSHOT_NAME",
 		Short: "create a snapshot for a block volume",
-		Run: func(cmd *cobra.Command, args []string) {
-			err := bsnapCreateAction(cmd, args)
-			if err == torus.ErrUsage {
-				cmd.Usage()
-				os.Exit(1)
-			} else if err != nil {
-				die("%v", err)
-			}
-		},
-	}
-
-	bsnapDeleteCommand = &cobra.Command{
+		Run:   snapshotRun(bsnapCreateAction),
+	})
+	cmd.AddCommand(&cobra.Command{
 		Use:   "delete VOLUME@SNAPSHOT_NAME",
 		Short: "delete a snapshot for a block volume",
-		Run: func(cmd *cobra.Command, args []string) {
-			err := bsnapDeleteAction(cmd, args)
-			if err == torus.ErrUsage {
-				cmd.Usage()
-				os.Exit(1)
-			} else if err != nil {
-				die("%v", err)
-			}
-		},
-	}
-
-	bsnapRestoreCommand = &cobra.Command{
+		Run:   snapshotRun(bsnapDeleteAction),
+	})
+	cmd.AddCommand(&cobra.Command{
 		Use:   "restore VOLUME@SNAPSHOT_NAME",
 		Short: "restore VOLUME to the state it had as of SNAPSHOT_NAME",
-		Run: func(cmd *cobra.Command, args []string) {
-			err := bsnapRestoreAction(cmd, args)
-			if err == torus.ErrUsage {
-				cmd.Usage()
-				os.Exit(1)
-			} else if err != nil {
-				die("%v", err)
-			}
-		},
+		Run:   snapshotRun(bsnapRestoreAction),
+	})
+	return cmd
+}
+
+func snapshotRun(f func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		err := f(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
 	}
-)
+}
 
 type SnapName struct {
 	Volume   string
@@ -89,12 +71,8 @@ func ParseSnapName(s string) SnapName {
 }
 
 func init() {
-	blockCommand.AddCommand(blockSnapshotCommand)
-	blockSnapshotCommand.AddCommand(bsnapListCommand)
-	blockSnapshotCommand.AddCommand(bsnapCreateCommand)
-	blockSnapshotCommand.AddCommand(bsnapDeleteCommand)
-	blockSnapshotCommand.AddCommand(bsnapRestoreCommand)
-	bsnapListCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+	blockCommand.AddCommand(snapshotCommand())
+	volumeCommand.AddCommand(snapshotCommand())
 }
 
 func bsnapListAction(cmd *cobra.Command, args []string) error {
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var capacityCommand = &cobra.Command{
+	Use:   "capacity [reserve PERCENT|volume-quota SIZE|none]",
+	Short: "show the cluster's capacity, or set how much of it to keep in reserve",
+	Long: `show the raw capacity of the live peers in the cluster's ring, how much is
+used, and how much can still be given to new volumes, or set the share of raw
+capacity to keep free, such as 'torusctl capacity reserve 10%'.
+
+Once free space would go below the reserve, after replication, new volumes
+aren't created and existing ones aren't grown. A reserve of 0 turns this off.
+Volumes with a redundancy of their own, or in a storage pool, are checked
+against the peers they're placed on and their own redundancy.
+
+'torusctl capacity volume-quota SIZE' sets the default quota on the size of
+volumes that don't have one of their own; 'none' removes it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := capacityAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func capacityAction(cmd *cobra.Command, args []string) error {
+	mds := mustConnectToMDS()
+	switch len(args) {
+	case 0:
+	case 2:
+		if args[0] == "volume-quota" {
+			q, err := parseVolumeQuota(args[1])
+			if err != nil {
+				return err
+			}
+			qmds, ok := mds.(torus.VolumeQuotaMetadataService)
+			if !ok {
+				return fmt.Errorf("metadata service doesn't support volume quotas")
+			}
+			return qmds.SetDefaultVolumeQuota(q)
+		}
+		if args[0] != "reserve" {
+			return torus.ErrUsage
+		}
+		r, err := torus.ParseCapacityReserve(args[1])
+		if err != nil {
+			return err
+		}
+		cmds, ok := mds.(torus.CapacityMetadataService)
+		if !ok {
+			return fmt.Errorf("metadata service doesn't support a capacity reserve")
+		}
+		return cmds.SetCapacityReserve(r)
+	default:
+		return torus.ErrUsage
+	}
+	c, err := torus.GetClusterCapacity(mds)
+	if err != nil {
+		return fmt.Errorf("couldn't get cluster capacity: %v", err)
+	}
+	fmt.Printf("Total:       %s\n", humanize.IBytes(c.Total))
+	fmt.Printf("Used:        %s\n", humanize.IBytes(c.Used))
+	fmt.Printf("Free:        %s\n", humanize.IBytes(c.Free()))
+	fmt.Printf("Reserved:    %s\n", humanize.IBytes(c.Reserved))
+	fmt.Printf("Replication: %d\n", c.Replication)
+	fmt.Printf("Available:   %s\n", humanize.IBytes(c.Available()))
+	q, err := torus.GetVolumeQuota(mds, 0)
+	if err != nil {
+		return fmt.Errorf("couldn't get default volume quota: %v", err)
+	}
+	fmt.Printf("Quota:       %s\n", describeVolumeQuota(q))
+	return nil
+}
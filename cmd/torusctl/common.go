@@ -9,6 +9,7 @@ import (
 	"github.com/coreos/torus/internal/flagconfig"
 
 	// Register all the drivers.
+	_ "github.com/coreos/torus/metadata/consul"
 	_ "github.com/coreos/torus/metadata/etcd"
 	_ "github.com/coreos/torus/storage"
 
@@ -22,16 +23,19 @@ func die(why string, args ...interface{}) {
 
 func mustConnectToMDS() torus.MetadataService {
 	cfg := flagconfig.BuildConfigFromFlags()
-	mds, err := torus.CreateMetadataService("etcd", cfg)
+	// Commands read most keys once, and then often wait on their own
+	// writes, which the cache can lag.
+	cfg.MetadataCache = false
+	mds, err := torus.CreateMetadataService(flagconfig.MetadataService(), cfg)
 	if err != nil {
-		die("couldn't connect to etcd: %v", err)
+		die("couldn't connect to the metadata service: %v", err)
 	}
 	return mds
 }
 
 func createServer() *torus.Server {
 	cfg := flagconfig.BuildConfigFromFlags()
-	srv, err := torus.NewServer(cfg, "etcd", "temp")
+	srv, err := torus.NewServer(cfg, flagconfig.MetadataService(), "temp")
 	if err != nil {
 		die("Couldn't start: %s\n", err)
 	}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dedupCommand = &cobra.Command{
+		Use:   "dedup",
+		Short: "find out how much deduplicating block volumes would save",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	dedupAnalyzeCommand = &cobra.Command{
+		Use:   "analyze VOLUME...",
+		Short: "report how much deduplicating block volumes would save",
+		Long: `read every block of the given block volumes and report how many have the
+same contents as another block of the same volume, and how much space
+deduplicating them with 'torusctl volume dedup' would give back.
+
+Nothing is changed. Blocks already shared, such as by a volume that is
+deduplicated, count once.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := dedupAnalyzeAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	dedupCommand.AddCommand(dedupAnalyzeCommand)
+	dedupAnalyzeCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func dedupAnalyzeAction(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return torus.ErrUsage
+	}
+	srv := createServer()
+	defer srv.Close()
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Volume", "Blocks", "Stored", "Unique", "Savings", "Ratio"})
+	var total block.DedupAnalysis
+	for _, name := range args {
+		vol, err := block.OpenBlockVolume(srv, name)
+		if err != nil {
+			return fmt.Errorf("couldn't open block volume %s: %v", name, err)
+		}
+		a, err := vol.AnalyzeDedup()
+		if err != nil {
+			return fmt.Errorf("couldn't analyze %s: %v", name, err)
+		}
+		table.Append(dedupRow(name, a))
+		total.Blocks += a.Blocks
+		total.Stored += a.Stored
+		total.Unique += a.Unique
+		total.BlockSize = a.BlockSize
+	}
+	if len(args) > 1 {
+		table.Append(dedupRow("(total)", &total))
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
+
+func dedupRow(name string, a *block.DedupAnalysis) []string {
+	ratio := "-"
+	if a.Unique != 0 {
+		ratio = fmt.Sprintf("%.2f", float64(a.Stored)/float64(a.Unique))
+	}
+	return []string{
+		name,
+		fmt.Sprint(a.Blocks),
+		fmt.Sprint(a.Stored),
+		fmt.Sprint(a.Unique),
+		humanize.IBytes(a.Savings()),
+		ratio,
+	}
+}
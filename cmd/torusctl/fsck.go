@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fsckFix     bool
+	fsckTimeout time.Duration
+)
+
+var fsckCommand = &cobra.Command{
+	Use:   "fsck",
+	Short: "check every peer's blocks against the metadata and the ring",
+	Long: `check every block stored on every peer against the volumes' INodes and the
+current ring, and report:
+
+  orphan     blocks no volume uses anymore
+  misplaced  blocks stored on a peer the ring doesn't put them on
+  missing    replicas the ring puts on a peer that doesn't have them
+
+With --fix, peers delete orphans, copy blocks to the peers missing them, and
+delete misplaced copies once every replica has the block. Each peer lists at
+most 100 of the blocks it found; the counts cover them all.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := fsckAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	fsckCommand.Flags().BoolVarP(&fsckFix, "fix", "", false, "fix the problems found")
+	fsckCommand.Flags().DurationVarP(&fsckTimeout, "timeout", "", 30*time.Minute, "how long to wait for every peer to finish")
+	fsckCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func fsckAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	fmds, ok := mds.(torus.FsckMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support fsck")
+	}
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peers: %v", err)
+	}
+	req := torus.FsckRequest{
+		Requested: time.Now().UnixNano(),
+		Fix:       fsckFix,
+	}
+	err = fmds.RequestFsck(req)
+	if err != nil {
+		return fmt.Errorf("couldn't request fsck: %v", err)
+	}
+	waiting := make(map[string]bool)
+	for _, p := range peers {
+		if p.Address != "" {
+			waiting[p.UUID] = true
+		}
+	}
+	var reports []*torus.FsckReport
+	deadline := time.Now().Add(fsckTimeout)
+	for len(waiting) != 0 {
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "WARNING: %d peers didn't finish in time\n", len(waiting))
+			break
+		}
+		time.Sleep(time.Second)
+		rs, err := fmds.GetFsckReports()
+		if err != nil {
+			return fmt.Errorf("couldn't get fsck reports: %v", err)
+		}
+		for _, r := range rs {
+			if r.Requested == req.Requested && waiting[r.Peer] {
+				delete(waiting, r.Peer)
+				reports = append(reports, r)
+			}
+		}
+	}
+
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "UUID", "Checked", "Orphans", "Misplaced", "Missing", "Fixed"})
+	var problems, fixed uint64
+	for _, r := range reports {
+		addr := ""
+		if i := peers.UUIDAt(r.Peer); i != -1 {
+			addr = peers[i].Address
+		}
+		table.Append([]string{
+			addr,
+			r.Peer,
+			fmt.Sprint(r.Checked),
+			fmt.Sprint(r.Orphans),
+			fmt.Sprint(r.Misplaced),
+			fmt.Sprint(r.Missing),
+			fmt.Sprint(r.Fixed),
+		})
+		problems += r.Orphans + r.Misplaced + r.Missing
+		fixed += r.Fixed
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+	} else {
+		table.Render()
+	}
+
+	blocks := NewTableWriter(os.Stdout)
+	blocks.SetHeader([]string{"Block", "Problem", "Stored On", "Missing On", "Fixed"})
+	for _, r := range reports {
+		for _, b := range r.Blocks {
+			blocks.Append([]string{
+				b.Ref.String(),
+				b.Problem,
+				r.Peer,
+				b.Peer,
+				fmt.Sprint(b.Fixed),
+			})
+		}
+	}
+	if problems != 0 {
+		fmt.Println()
+		if outputAsCSV {
+			blocks.RenderCSV()
+		} else {
+			blocks.Render()
+		}
+	}
+	for _, r := range reports {
+		for _, e := range r.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", r.Peer, e)
+		}
+	}
+	if len(waiting) != 0 || problems != fixed {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcCommand = &cobra.Command{
+		Use:   "gc",
+		Short: "inspect garbage collection of unused blocks",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	gcStatusCommand = &cobra.Command{
+		Use:   "status",
+		Short: "show how far each peer's garbage collector has got",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := gcStatusAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	gcCommand.AddCommand(gcStatusCommand)
+	gcStatusCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func gcStatusAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	gmds, ok := mds.(torus.GCMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't keep garbage collection status")
+	}
+	ss, err := gmds.GetGCStatuses()
+	if err != nil {
+		return fmt.Errorf("couldn't get gc status: %v", err)
+	}
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peers: %v", err)
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "UUID", "Generation", "State", "Progress", "Reclaimed", "Freed", "Last Pass", "Updated"})
+	for _, s := range ss {
+		addr := ""
+		if i := peers.UUIDAt(s.Peer); i != -1 {
+			addr = peers[i].Address
+		}
+		state, progress := "idle", ""
+		switch {
+		case s.Marking:
+			state = "marking"
+		case s.Sweeping:
+			state = "sweeping"
+			if s.Total != 0 {
+				progress = fmt.Sprintf("%d/%d (%.0f%%)", s.Swept, s.Total, float64(s.Swept)/float64(s.Total)*100)
+			}
+		}
+		last := "never"
+		if s.PassFinish != 0 {
+			last = humanize.Time(time.Unix(0, s.PassFinish))
+		}
+		table.Append([]string{
+			addr,
+			s.Peer,
+			fmt.Sprint(s.Generation),
+			state,
+			progress,
+			fmt.Sprint(s.Reclaimed),
+			humanize.IBytes(s.BytesFreed),
+			last,
+			humanize.Time(time.Unix(0, s.Saved)),
+		})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
@@ -3,25 +3,17 @@ package main
 import (
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/blockset"
 	"github.com/coreos/torus/internal/flagconfig"
-	"github.com/coreos/torus/ring"
-	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 
+	_ "github.com/coreos/torus/metadata/consul"
 	_ "github.com/coreos/torus/metadata/etcd"
 )
 
-var (
-	blockSize    uint64
-	blockSizeStr string
-	blockSpec    string
-	noMakeRing   bool
-	metaView     bool
-)
+var metaView bool
 
 var initCommand = &cobra.Command{
 	Use:    "init",
@@ -31,9 +23,7 @@ var initCommand = &cobra.Command{
 }
 
 func init() {
-	initCommand.Flags().StringVarP(&blockSizeStr, "block-size", "", "512KiB", "size of all data blocks in this storage cluster")
-	initCommand.Flags().StringVarP(&blockSpec, "block-spec", "", "crc", "default replication/error correction applied to blocks in this storage cluster")
-	initCommand.Flags().BoolVar(&noMakeRing, "no-ring", false, "do not create the default ring as part of init")
+	flagconfig.AddInitFlags(initCommand.Flags())
 	initCommand.Flags().BoolVar(&metaView, "view", false, "view metadata configured in this storage cluster")
 }
 
@@ -42,32 +32,24 @@ func initPreRun(cmd *cobra.Command, args []string) {
 		viewMetadata()
 		os.Exit(0)
 	}
-	// We *always* need base.
-	if !strings.HasSuffix(blockSpec, ",base") && !strings.HasPrefix(blockSpec, "base") {
-		blockSpec += ",base"
-	}
-	var err error
-	blockSize, err = humanize.ParseBytes(blockSizeStr)
-	if err != nil {
-		die("error parsing block-size: %v", err)
-	}
 }
 
 func initAction(cmd *cobra.Command, args []string) {
-	var err error
-	md := torus.GlobalMetadata{}
-	md.BlockSize = blockSize
-	md.DefaultBlockSpec, err = blockset.ParseBlockLayerSpec(blockSpec)
+	md, ringType, err := flagconfig.InitMetadata()
 	if err != nil {
-		die("error parsing block-spec: %v", err)
+		die("%v", err)
 	}
 
-	cfg := flagconfig.BuildConfigFromFlags()
-	ringType := ring.Ketama
-	if noMakeRing {
-		ringType = ring.Empty
+	if inventoryFile != "" {
+		if flagconfig.NoRing() {
+			die("--from-inventory makes the first ring, so can't be used with --no-ring")
+		}
+		initFromInventory(md)
+		return
 	}
-	err = torus.InitMDS("etcd", cfg, md, ringType)
+
+	cfg := flagconfig.BuildConfigFromFlags()
+	err = torus.InitMDS(flagconfig.MetadataService(), cfg, md, ringType)
 	if err != nil {
 		die("error writing metadata: %v", err)
 	}
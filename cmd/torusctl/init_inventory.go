@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/flagconfig"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"github.com/dustin/go-humanize"
+)
+
+var (
+	inventoryFile        string
+	inventoryRingType    string
+	inventoryReplication int
+	inventoryWait        time.Duration
+)
+
+func init() {
+	initCommand.Flags().StringVar(&inventoryFile, "from-inventory", "", "file listing the cluster's nodes, one per line as ADDRESS CAPACITY [RACK], to make the first ring of once they're all up")
+	initCommand.Flags().StringVar(&inventoryRingType, "ring-type", "ketama", "type of the first ring, with --from-inventory")
+	initCommand.Flags().IntVar(&inventoryReplication, "replication", 2, "replication of the first ring, with --from-inventory")
+	initCommand.Flags().DurationVar(&inventoryWait, "wait", 10*time.Minute, "how long to wait for every node in the inventory to come up, with --from-inventory")
+}
+
+// inventoryNode is a node of the inventory given to init --from-inventory.
+type inventoryNode struct {
+	// Address is the peer address the node's torusd advertises.
+	Address string
+	// Capacity is how many bytes of blocks it should hold.
+	Capacity uint64
+	// Rack is the zone the node's torusd should run in, if given.
+	Rack string
+}
+
+// readInventory reads an inventory, where each line is a node's peer
+// address, capacity and, optionally, rack, separated by spaces. Anything
+// after a # is a comment.
+func readInventory(path string) ([]inventoryNode, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []inventoryNode
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if i := strings.Index(text, "#"); i != -1 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected ADDRESS CAPACITY [RACK]", path, line)
+		}
+		u, err := url.Parse(fields[0])
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("%s:%d: address %s isn't a peer address like http://10.0.0.1:40000", path, line, fields[0])
+		}
+		if seen[fields[0]] {
+			return nil, fmt.Errorf("%s:%d: %s is listed twice", path, line, fields[0])
+		}
+		seen[fields[0]] = true
+		capacity, err := humanize.ParseBytes(fields[1])
+		if err != nil || capacity == 0 {
+			return nil, fmt.Errorf("%s:%d: invalid capacity %s", path, line, fields[1])
+		}
+		n := inventoryNode{Address: fields[0], Capacity: capacity}
+		if len(fields) == 3 {
+			n.Rack = fields[2]
+		}
+		out = append(out, n)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s lists no nodes", path)
+	}
+	return out, nil
+}
+
+// initFromInventory initializes the metadata with md and an empty ring, then
+// waits for every node in the inventory to register and be reachable before
+// committing the first ring of them. If it gives up, running it again picks
+// up where it left off, as long as the ring is still empty.
+func initFromInventory(md torus.GlobalMetadata) {
+	nodes, err := readInventory(inventoryFile)
+	if err != nil {
+		die("couldn't read inventory: %v", err)
+	}
+	t, ok := ring.RingTypeFromString(inventoryRingType)
+	switch {
+	case !ok:
+		die("invalid ring type %s (try one of %s)", inventoryRingType, strings.Join(ring.RingNames(), ", "))
+	case t == ring.Empty || t == ring.Union:
+		die("the first ring can't be of type %s", inventoryRingType)
+	case t == ring.Single && len(nodes) != 1:
+		die("a single ring needs an inventory of one node")
+	}
+	if inventoryReplication < 1 || inventoryReplication > len(nodes) {
+		die("replication %d needs between 1 and %d, the number of nodes", inventoryReplication, len(nodes))
+	}
+
+	cfg := flagconfig.BuildConfigFromFlags()
+	err = torus.InitMDS(flagconfig.MetadataService(), cfg, md, ring.Empty)
+	resuming := err == torus.ErrExists
+	if err != nil && !resuming {
+		die("error writing metadata: %v", err)
+	}
+	mds := mustConnectToMDS()
+	cur, err := mds.GetRing()
+	if err != nil {
+		die("couldn't get ring: %v", err)
+	}
+	if cur.Type() != ring.Empty {
+		die("the cluster already has a %s ring; --from-inventory only starts new clusters", cur.Describe())
+	}
+	if resuming {
+		fmt.Println("The metadata is already initialized; waiting for the nodes again.")
+	}
+	// The metadata may be from an earlier run with other flags.
+	blockSize := mds.GlobalMetadata().BlockSize
+
+	fmt.Printf("Waiting up to %s for %d nodes to come up...\n", inventoryWait, len(nodes))
+	peers, err := waitForInventory(mds, nodes, blockSize, time.Now().Add(inventoryWait))
+	if err != nil {
+		die("%v\nThe metadata is initialized, but no ring was made; run this again once they're fixed.", err)
+	}
+
+	newRing, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(t),
+		Version:           uint32(cur.Version() + 1),
+		ReplicationFactor: uint32(inventoryReplication),
+		Peers:             peers,
+	})
+	if err != nil {
+		die("couldn't create the first ring: %v", err)
+	}
+	err = torus.SetRing(flagconfig.MetadataService(), cfg, newRing)
+	if err != nil {
+		die("couldn't set the first ring: %v", err)
+	}
+	fmt.Printf("Made ring %d of %d nodes: %s\n", newRing.Version(), len(peers), newRing.Describe())
+}
+
+// waitForInventory waits until every node has registered under its address
+// and can be dialed, and returns them as ring members, weighed by their
+// capacity in the inventory. It gives up at deadline, saying what's wrong
+// with each node that isn't ready.
+func waitForInventory(mds torus.MetadataService, nodes []inventoryNode, blockSize uint64, deadline time.Time) (torus.PeerInfoList, error) {
+	reachable := make(map[string]bool)
+	for {
+		registered, err := mds.GetPeers()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get peer list: %v", err)
+		}
+		var out torus.PeerInfoList
+		var problems []string
+		for _, n := range nodes {
+			var p *models.PeerInfo
+			for _, r := range registered {
+				if r.Address == n.Address && !r.TimedOut {
+					p = r
+				}
+			}
+			if p == nil {
+				problems = append(problems, fmt.Sprintf("%s hasn't registered", n.Address))
+				continue
+			}
+			if !reachable[n.Address] {
+				u, _ := url.Parse(n.Address)
+				conn, err := net.DialTimeout("tcp", u.Host, 5*time.Second)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s can't be reached: %v", n.Address, err))
+					continue
+				}
+				conn.Close()
+				reachable[n.Address] = true
+			}
+			if n.Rack != "" && p.Zone != n.Rack {
+				problems = append(problems, fmt.Sprintf("%s runs in zone %q, not rack %s; start it with --zone %s", n.Address, p.Zone, n.Rack, n.Rack))
+				continue
+			}
+			blocks := n.Capacity / blockSize
+			if p.TotalBlocks < blocks {
+				problems = append(problems, fmt.Sprintf("%s has room for %s, less than its %s in the inventory", n.Address,
+					humanize.IBytes(p.TotalBlocks*blockSize), humanize.IBytes(n.Capacity)))
+				continue
+			}
+			out = append(out, &models.PeerInfo{
+				UUID:        p.UUID,
+				Address:     p.Address,
+				TotalBlocks: blocks,
+				Zone:        n.Rack,
+			})
+		}
+		if len(problems) == 0 {
+			return out, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("not every node is ready:\n  %s", strings.Join(problems, "\n  "))
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var joinTokenCommand = &cobra.Command{
+	Use:   "join-token",
+	Short: "manage the token nodes need to add themselves to the cluster",
+	Long: `manage the token nodes need to add themselves to the cluster.
+
+Once the cluster has a join token, torusd only adds itself to the ring with
+--auto-join if it's started with the same --join-token. Only a hash of the
+token is kept in the metadata service, so it's printed only when generated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+		os.Exit(1)
+	},
+}
+
+var joinTokenGenerateCommand = &cobra.Command{
+	Use:   "generate",
+	Short: "make a new random join token, replacing the old one",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := joinTokenGenerateAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+var joinTokenSetCommand = &cobra.Command{
+	Use:   "set TOKEN",
+	Short: "set the join token",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := joinTokenSetAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+var joinTokenClearCommand = &cobra.Command{
+	Use:   "clear",
+	Short: "remove the join token, letting any node add itself",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := joinTokenClearAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	joinTokenCommand.AddCommand(joinTokenGenerateCommand, joinTokenSetCommand, joinTokenClearCommand)
+}
+
+func mustJoinTokenMDS() torus.JoinTokenMetadataService {
+	mds := mustConnectToMDS()
+	jt, ok := mds.(torus.JoinTokenMetadataService)
+	if !ok {
+		die("the metadata service doesn't support join tokens")
+	}
+	return jt
+}
+
+func joinTokenGenerateAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+	if err := mustJoinTokenMDS().SetJoinTokenHash(torus.HashJoinToken(token)); err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+func joinTokenSetAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return torus.ErrUsage
+	}
+	return mustJoinTokenMDS().SetJoinTokenHash(torus.HashJoinToken(args[0]))
+}
+
+func joinTokenClearAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	return mustJoinTokenMDS().SetJoinTokenHash(nil)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -39,9 +40,13 @@ func listPeersAction(cmd *cobra.Command, args []string) {
 	if err != nil {
 		die("couldn't get ring: %v", err)
 	}
+	draining, err := drainingPeers(mds)
+	if err != nil {
+		die("%v", err)
+	}
 	members := ring.Members()
 	table := NewTableWriter(os.Stdout)
-	table.SetHeader([]string{"Address", "UUID", "Size", "Used", "Member", "Updated", "Reb/Rep Data"})
+	table.SetHeader([]string{"Address", "UUID", "Size", "Used", "Member", "Updated", "Reb/Rep Data", "Storage", "Load"})
 	rebalancing := false
 	for _, x := range peers {
 		ringStatus := "Avail"
@@ -50,6 +55,9 @@ func listPeersAction(cmd *cobra.Command, args []string) {
 		}
 		if members.Has(x.UUID) {
 			ringStatus = "OK"
+			if draining[x.UUID] {
+				ringStatus = "Draining"
+			}
 		}
 		table.Append([]string{
 			x.Address,
@@ -59,7 +67,23 @@ func listPeersAction(cmd *cobra.Command, args []string) {
 			ringStatus,
 			humanize.Time(time.Unix(0, x.LastSeen)),
 			bytesOrIbytes(x.RebalanceInfo.LastRebalanceBlocks*gmd.BlockSize*uint64(time.Second)/uint64(x.LastSeen+1-x.RebalanceInfo.LastRebalanceFinish), outputAsSI) + "/sec",
+			storageOptions(x.DirectIO, x.Preallocated),
+			peerLoad(x.QueueDepth, x.ReadLatency),
 		})
+		// Disks of a peer that has several are listed under it.
+		for _, dev := range x.Devices {
+			table.Append([]string{
+				"  " + dev.Address,
+				dev.UUID,
+				bytesOrIbytes(dev.TotalBlocks*gmd.BlockSize, outputAsSI),
+				bytesOrIbytes(dev.UsedBlocks*gmd.BlockSize, outputAsSI),
+				"Device",
+				"",
+				"",
+				"",
+				"",
+			})
+		}
 		if x.RebalanceInfo.Rebalancing {
 			rebalancing = true
 		}
@@ -87,6 +111,8 @@ func listPeersAction(cmd *cobra.Command, args []string) {
 			ringStatus,
 			"Missing",
 			"",
+			"",
+			"",
 		})
 	}
 	if outputAsCSV {
@@ -96,3 +122,27 @@ func listPeersAction(cmd *cobra.Command, args []string) {
 		fmt.Printf("Balanced: %v Usage: %5.2f%%\n", !rebalancing, (float64(usedStorage) / float64(totalStorage) * 100.0))
 	}
 }
+
+// storageOptions describes how a peer uses its disk.
+func storageOptions(directIO, preallocated bool) string {
+	var opts []string
+	if directIO {
+		opts = append(opts, "direct")
+	}
+	if preallocated {
+		opts = append(opts, "prealloc")
+	}
+	if len(opts) == 0 {
+		return "-"
+	}
+	return strings.Join(opts, ",")
+}
+
+// peerLoad describes how busy a peer said it was serving blocks: how many
+// requests it had in flight, and how long its reads have lately taken.
+func peerLoad(queueDepth uint64, readLatency int64) string {
+	if readLatency == 0 {
+		return fmt.Sprintf("%d", queueDepth)
+	}
+	return fmt.Sprintf("%d @ %s", queueDepth, time.Duration(readLatency))
+}
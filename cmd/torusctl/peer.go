@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/coreos/torus"
@@ -9,9 +10,10 @@ import (
 )
 
 var (
-	newPeers torus.PeerInfoList
-	allPeers bool
-	force    bool
+	newPeers    torus.PeerInfoList
+	allPeers    bool
+	force       bool
+	cancelDrain bool
 )
 
 var peerCommand = &cobra.Command{
@@ -40,10 +42,20 @@ var peerRemoveCommand = &cobra.Command{
 	Run:    peerRemoveAction,
 }
 
+var peerDrainCommand = &cobra.Command{
+	Use:   "drain UUID...",
+	Short: "move all the blocks off peers, keeping them in the ring, so they can be removed safely",
+	Run:   peerDrainAction,
+}
+
 func init() {
-	peerCommand.AddCommand(peerAddCommand, peerRemoveCommand, peerListCommand)
+	peerCommand.AddCommand(peerAddCommand, peerRemoveCommand, peerListCommand, peerDrainCommand)
+	peerDrainCommand.Flags().BoolVar(&cancelDrain, "cancel", false, "stop draining the peers, letting blocks be placed on them again")
 	peerAddCommand.Flags().BoolVar(&allPeers, "all-peers", false, "add all peers")
 	peerRemoveCommand.PersistentFlags().BoolVar(&force, "force", false, "force-remove a UUID")
+	for _, c := range []*cobra.Command{peerAddCommand, peerRemoveCommand} {
+		c.Flags().DurationVar(&ringAckTimeout, "ack-timeout", torus.DefaultRingAckTimeout, "how long to wait for every peer to acknowledge the new ring before giving up on it")
+	}
 }
 
 func peerAction(cmd *cobra.Command, args []string) {
@@ -113,10 +125,49 @@ func peerAddAction(cmd *cobra.Command, args []string) {
 	if err != nil {
 		die("couldn't add peer to ring: %v", err)
 	}
-	err = mds.SetRing(newRing)
+	err = torus.ChangeRing(mds, newRing, ringAckTimeout)
 	if err != nil {
 		die("couldn't set new ring: %v", err)
 	}
+	// Peers drained before their removal don't need the mark anymore.
+	if dmds, ok := mds.(torus.DrainMetadataService); ok {
+		draining, err := dmds.GetDraining()
+		if err != nil {
+			die("couldn't get draining peers: %v", err)
+		}
+		for _, p := range newPeers.PeerList().Intersect(draining) {
+			if err := dmds.SetDraining(p, false); err != nil {
+				die("couldn't clear draining peer %s: %v", p, err)
+			}
+		}
+	}
+}
+
+func peerDrainAction(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	mds = mustConnectToMDS()
+	dmds, ok := mds.(torus.DrainMetadataService)
+	if !ok {
+		die("metadata service doesn't support draining peers")
+	}
+	r, err := mds.GetRing()
+	if err != nil {
+		die("couldn't get ring: %v", err)
+	}
+	for _, uuid := range args {
+		if !cancelDrain && !r.Members().Has(uuid) {
+			die("peer %s isn't in the ring", uuid)
+		}
+		if err := dmds.SetDraining(uuid, !cancelDrain); err != nil {
+			die("couldn't set peer %s draining: %v", uuid, err)
+		}
+	}
+	if !cancelDrain {
+		fmt.Println("Draining; once `torusctl peer list` shows the peers using nothing, remove them with `torusctl peer remove`.")
+	}
 }
 
 func peerRemoveAction(cmd *cobra.Command, args []string) {
@@ -136,7 +187,7 @@ func peerRemoveAction(cmd *cobra.Command, args []string) {
 	if err != nil {
 		die("couldn't remove peer from ring: %v", err)
 	}
-	err = mds.SetRing(newRing)
+	err = torus.ChangeRing(mds, newRing, ringAckTimeout)
 	if err != nil {
 		die("couldn't set new ring: %v", err)
 	}
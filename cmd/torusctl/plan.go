@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planBandwidth string
+	planMaxFill   float64
+)
+
+var (
+	planCommand = &cobra.Command{
+		Use:   "plan",
+		Short: "check the impact of cluster changes before making them",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	planRemovePeerCommand = &cobra.Command{
+		Use:   "remove-peer UUID...",
+		Short: "check whether the cluster can absorb the removal of peers",
+		Long: `check whether the rest of the cluster can absorb the data of the given peers
+at the current replication, and estimate how long moving it will take.
+
+Exits non-zero if the removal would be unsafe.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := planRemovePeerAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	planCommand.AddCommand(planRemovePeerCommand)
+	planRemovePeerCommand.Flags().StringVarP(&planBandwidth, "bandwidth", "", "100MiB", "rebalance throughput of a single peer, per second")
+	planRemovePeerCommand.Flags().Float64VarP(&planMaxFill, "max-fill", "", 0.85, "warn if any remaining peer would be fuller than this fraction")
+}
+
+// shrinkPlan is the projected outcome of removing peers from the ring.
+type shrinkPlan struct {
+	Replication int
+	Removed     torus.PeerList
+	// Down are the removed peers that aren't currently heartbeating, and so
+	// can't hand off their own data.
+	Down      torus.PeerList
+	Remaining torus.PeerList
+
+	// MoveBlocks is the number of blocks that need a new home.
+	MoveBlocks uint64
+	// Used and Total are summed over the remaining peers, before the move.
+	Used  uint64
+	Total uint64
+
+	// Fill is each remaining peer's projected used fraction after the move.
+	Fill map[string]float64
+	// Hosts is the number of distinct hosts among the remaining peers.
+	Hosts int
+	// Duration is the estimated time to move the data.
+	Duration time.Duration
+
+	Refusals []string
+	Warnings []string
+}
+
+func planRemovePeerAction(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return torus.ErrUsage
+	}
+	bw, err := humanize.ParseBytes(planBandwidth)
+	if err != nil || bw == 0 {
+		return fmt.Errorf("invalid bandwidth %q", planBandwidth)
+	}
+	mds := mustConnectToMDS()
+	r, err := mds.GetRing()
+	if err != nil {
+		return fmt.Errorf("couldn't get ring: %v", err)
+	}
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peer list: %v", err)
+	}
+	members := r.Members()
+	for _, uuid := range args {
+		if !members.Has(uuid) {
+			return fmt.Errorf("peer %s is not in the ring", uuid)
+		}
+	}
+	if _, ok := r.(torus.RingRemover); !ok {
+		return fmt.Errorf("current ring type cannot support removal")
+	}
+	rm, err := ringModel(r)
+	if err != nil {
+		return fmt.Errorf("couldn't read ring: %v", err)
+	}
+	blockSize := mds.GlobalMetadata().BlockSize
+	p := planRemovePeers(members, rm, peers, args, blockSize, bw, planMaxFill)
+	printShrinkPlan(p, peers, blockSize, bw)
+	if len(p.Refusals) != 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// ringModel returns the stored form of the ring, which records the
+// replication factor and the capacity of every member.
+func ringModel(r torus.Ring) (*models.Ring, error) {
+	b, err := r.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	m := &models.Ring{}
+	err = m.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func planRemovePeers(members torus.PeerList, rm *models.Ring, peers torus.PeerInfoList, removed torus.PeerList, blockSize, bw uint64, maxFill float64) *shrinkPlan {
+	replication := int(rm.ReplicationFactor)
+	p := &shrinkPlan{
+		Replication: replication,
+		Removed:     removed,
+		Remaining:   members.AndNot(removed),
+		Fill:        make(map[string]float64),
+	}
+	var maxSend uint64
+	for _, uuid := range removed {
+		i := peers.UUIDAt(uuid)
+		if i == -1 {
+			p.Down = append(p.Down, uuid)
+			continue
+		}
+		p.MoveBlocks += peers[i].UsedBlocks
+		if peers[i].UsedBlocks > maxSend {
+			maxSend = peers[i].UsedBlocks
+		}
+	}
+	hosts := make(map[string]bool)
+	var unknown torus.PeerList
+	for _, uuid := range p.Remaining {
+		i := peers.UUIDAt(uuid)
+		if i == -1 {
+			unknown = append(unknown, uuid)
+			continue
+		}
+		p.Used += peers[i].UsedBlocks
+		p.Total += peers[i].TotalBlocks
+		hosts[peerHost(peers[i].Address)] = true
+	}
+	p.Hosts = len(hosts)
+
+	// We don't know how much a down peer held, so assume it was as full as
+	// the rest of the cluster.
+	if len(p.Down) != 0 && p.Total != 0 {
+		ringPeers := torus.PeerInfoList(rm.Peers)
+		for _, uuid := range p.Down {
+			if i := ringPeers.UUIDAt(uuid); i != -1 {
+				p.MoveBlocks += ringPeers[i].TotalBlocks * p.Used / p.Total
+			}
+		}
+	}
+
+	// The ring weights peers by capacity, so each remaining peer takes a share
+	// of the moved data in proportion to its size.
+	var maxRecv float64
+	for _, uuid := range p.Remaining {
+		i := peers.UUIDAt(uuid)
+		if i == -1 || peers[i].TotalBlocks == 0 {
+			continue
+		}
+		pi := peers[i]
+		recv := float64(p.MoveBlocks) * float64(pi.TotalBlocks) / float64(p.Total)
+		if recv > maxRecv {
+			maxRecv = recv
+		}
+		p.Fill[uuid] = (float64(pi.UsedBlocks) + recv) / float64(pi.TotalBlocks)
+	}
+	if len(p.Down) != 0 {
+		// The data of down peers has to come from the surviving replicas,
+		// which share the load much like the receivers do.
+		maxSend = uint64(maxRecv)
+	}
+	busiest := maxRecv
+	if float64(maxSend) > busiest {
+		busiest = float64(maxSend)
+	}
+	p.Duration = time.Duration(busiest * float64(blockSize) / float64(bw) * float64(time.Second))
+
+	if len(p.Remaining) < replication {
+		p.Refusals = append(p.Refusals, fmt.Sprintf("only %d peers would remain for replication %d", len(p.Remaining), replication))
+	}
+	if len(p.Down) >= replication {
+		p.Refusals = append(p.Refusals, fmt.Sprintf("%d removed peers are down; blocks replicated only on them would be lost", len(p.Down)))
+	} else if len(p.Down) != 0 {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("%d removed peers are down; their data will be copied from the remaining replicas, and its size is estimated", len(p.Down)))
+	}
+	if len(unknown) != 0 {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("%d remaining peers are down and were not counted: %v", len(unknown), unknown))
+	}
+	if p.Used+p.MoveBlocks > p.Total {
+		p.Refusals = append(p.Refusals, fmt.Sprintf("remaining peers don't have room for %d more blocks", p.MoveBlocks))
+	} else {
+		for _, uuid := range p.Remaining {
+			f, ok := p.Fill[uuid]
+			if !ok {
+				continue
+			}
+			if f > 1 {
+				p.Refusals = append(p.Refusals, fmt.Sprintf("peer %s would overflow (%.0f%% full)", uuid, f*100))
+			} else if f > maxFill {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("peer %s would be %.0f%% full", uuid, f*100))
+			}
+		}
+	}
+	if len(p.Remaining) == replication {
+		p.Warnings = append(p.Warnings, "no spare peers would remain; losing another peer would leave blocks under-replicated until it returns")
+	}
+	if p.Hosts < replication && len(unknown) == 0 {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("remaining peers span only %d hosts; some replicas would share a host", p.Hosts))
+	}
+	return p
+}
+
+// peerHost returns the host a peer advertises, which is the closest thing we
+// have to a failure domain.
+func peerHost(addr string) string {
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		addr = u.Host
+	}
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		return h
+	}
+	return addr
+}
+
+func printShrinkPlan(p *shrinkPlan, peers torus.PeerInfoList, blockSize, bw uint64) {
+	fmt.Printf("Removing %d of %d peers (replication %d)\n", len(p.Removed), len(p.Removed)+len(p.Remaining), p.Replication)
+	fmt.Printf("Data to move:       %s (%d blocks)\n", humanize.IBytes(p.MoveBlocks*blockSize), p.MoveBlocks)
+	if p.Total != 0 {
+		fmt.Printf("Remaining capacity: %s of %s used (%.0f%% -> %.0f%%)\n",
+			humanize.IBytes(p.Used*blockSize), humanize.IBytes(p.Total*blockSize),
+			float64(p.Used)/float64(p.Total)*100, float64(p.Used+p.MoveBlocks)/float64(p.Total)*100)
+	}
+	fmt.Printf("Remaining hosts:    %d\n", p.Hosts)
+	fmt.Printf("Estimated time:     %s at %s/s per peer\n", p.Duration, humanize.IBytes(bw))
+	fmt.Println()
+
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Peer", "Address", "Size", "Used", "After"})
+	for _, uuid := range p.Remaining {
+		i := peers.UUIDAt(uuid)
+		if i == -1 {
+			table.Append([]string{uuid, "(down)", "", "", ""})
+			continue
+		}
+		pi := peers[i]
+		used := 0.0
+		if pi.TotalBlocks != 0 {
+			used = float64(pi.UsedBlocks) / float64(pi.TotalBlocks) * 100
+		}
+		table.Append([]string{
+			uuid,
+			pi.Address,
+			humanize.IBytes(pi.TotalBlocks * blockSize),
+			fmt.Sprintf("%.0f%%", used),
+			fmt.Sprintf("%.0f%%", p.Fill[uuid]*100),
+		})
+	}
+	table.Render()
+
+	for _, w := range p.Warnings {
+		fmt.Printf("WARNING: %s\n", w)
+	}
+	for _, r := range p.Refusals {
+		fmt.Printf("UNSAFE: %s\n", r)
+	}
+	if len(p.Refusals) == 0 {
+		fmt.Printf("OK: run `torusctl peer remove %s` to proceed\n", strings.Join(p.Removed, " "))
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+// planCluster returns the members, ring and peer list of a cluster of peers
+// a, b, c... on hosts of their own, each with room for 100 blocks and used
+// as given.
+func planCluster(replication int, used ...uint64) (torus.PeerList, *models.Ring, torus.PeerInfoList) {
+	var members torus.PeerList
+	var peers torus.PeerInfoList
+	for i, u := range used {
+		uuid := string('a' + rune(i))
+		members = append(members, uuid)
+		peers = append(peers, &models.PeerInfo{
+			UUID:        uuid,
+			Address:     fmt.Sprintf("http://10.0.0.%d:40000", i+1),
+			TotalBlocks: 100,
+			UsedBlocks:  u,
+		})
+	}
+	return members, &models.Ring{ReplicationFactor: uint32(replication), Peers: peers}, peers
+}
+
+func TestPlanRemovePeers(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		replication int
+		used        []uint64
+		removed     torus.PeerList
+		// down are peers missing from the peer list.
+		down []string
+
+		moveBlocks uint64
+		fill       map[string]float64
+		refusals   []string
+		warnings   []string
+	}{
+		{
+			name:        "fits",
+			replication: 2,
+			used:        []uint64{30, 30, 30, 30},
+			removed:     torus.PeerList{"d"},
+			moveBlocks:  30,
+			fill:        map[string]float64{"a": 0.4, "b": 0.4, "c": 0.4},
+		},
+		{
+			name:        "over max fill",
+			replication: 2,
+			used:        []uint64{60, 60, 60, 60},
+			removed:     torus.PeerList{"d"},
+			moveBlocks:  60,
+			fill:        map[string]float64{"a": 0.8, "b": 0.8, "c": 0.8},
+			warnings:    []string{"peer a would be 80% full", "peer b would be 80% full", "peer c would be 80% full"},
+		},
+		{
+			name:        "capacity shortfall",
+			replication: 2,
+			used:        []uint64{80, 80, 80, 80},
+			removed:     torus.PeerList{"d"},
+			moveBlocks:  80,
+			refusals:    []string{"remaining peers don't have room for 80 more blocks"},
+		},
+		{
+			name:        "down peer estimated",
+			replication: 2,
+			used:        []uint64{30, 30, 30, 30},
+			removed:     torus.PeerList{"d"},
+			down:        []string{"d"},
+			moveBlocks:  30,
+			warnings:    []string{"1 removed peers are down"},
+		},
+		{
+			name:        "down peers lose data",
+			replication: 2,
+			used:        []uint64{10, 10, 10, 10},
+			removed:     torus.PeerList{"c", "d"},
+			down:        []string{"c", "d"},
+			// Assumed to be as full as a and b.
+			moveBlocks: 20,
+			refusals:   []string{"2 removed peers are down; blocks replicated only on them would be lost"},
+			warnings:   []string{"no spare peers would remain"},
+		},
+		{
+			name:        "replication greater than the remaining peers",
+			replication: 3,
+			used:        []uint64{10, 10, 10, 10},
+			removed:     torus.PeerList{"c", "d"},
+			moveBlocks:  20,
+			fill:        map[string]float64{"a": 0.2, "b": 0.2},
+			refusals:    []string{"only 2 peers would remain for replication 3"},
+			warnings:    []string{"remaining peers span only 2 hosts"},
+		},
+		{
+			name:        "no spare peers",
+			replication: 3,
+			used:        []uint64{10, 10, 10, 10},
+			removed:     torus.PeerList{"d"},
+			moveBlocks:  10,
+			warnings:    []string{"no spare peers would remain"},
+		},
+		{
+			name:        "every peer",
+			replication: 2,
+			used:        []uint64{10, 10, 10},
+			removed:     torus.PeerList{"a", "b", "c"},
+			moveBlocks:  30,
+			fill:        map[string]float64{},
+			refusals:    []string{"only 0 peers would remain for replication 2", "remaining peers don't have room for 30 more blocks"},
+			warnings:    []string{"remaining peers span only 0 hosts"},
+		},
+		{
+			name:        "every peer, all down",
+			replication: 2,
+			used:        []uint64{10, 10, 10},
+			removed:     torus.PeerList{"a", "b", "c"},
+			down:        []string{"a", "b", "c"},
+			fill:        map[string]float64{},
+			refusals:    []string{"only 0 peers would remain for replication 2", "3 removed peers are down"},
+			warnings:    []string{"remaining peers span only 0 hosts"},
+		},
+	} {
+		members, rm, peers := planCluster(tt.replication, tt.used...)
+		var up torus.PeerInfoList
+		for _, pi := range peers {
+			if !torus.PeerList(tt.down).Has(pi.UUID) {
+				up = append(up, pi)
+			}
+		}
+		p := planRemovePeers(members, rm, up, tt.removed, 512*1024, 100*1024*1024, 0.75)
+
+		if p.MoveBlocks != tt.moveBlocks {
+			t.Errorf("%s: expected %d blocks to move, got %d", tt.name, tt.moveBlocks, p.MoveBlocks)
+		}
+		if tt.fill != nil {
+			if len(p.Fill) != len(tt.fill) {
+				t.Errorf("%s: expected fill %v, got %v", tt.name, tt.fill, p.Fill)
+			}
+			for uuid, f := range tt.fill {
+				if got, ok := p.Fill[uuid]; !ok || got < f-0.001 || got > f+0.001 {
+					t.Errorf("%s: expected peer %s to be %.2f full, got %.2f", tt.name, uuid, f, got)
+				}
+			}
+		}
+		checkPlanMessages(t, tt.name, "refusals", p.Refusals, tt.refusals)
+		checkPlanMessages(t, tt.name, "warnings", p.Warnings, tt.warnings)
+	}
+}
+
+// checkPlanMessages checks that got are the messages that begin with want, in
+// order.
+func checkPlanMessages(t *testing.T, name, kind string, got, want []string) {
+	if len(got) != len(want) {
+		t.Errorf("%s: expected %s %q, got %q", name, kind, want, got)
+		return
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(got[i], w) {
+			t.Errorf("%s: expected %s %q, got %q", name, kind, want, got)
+			return
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	poolPeers       []string
+	poolRingType    string
+	poolReplication int
+)
+
+var (
+	poolCommand = &cobra.Command{
+		Use:   "pool",
+		Short: "manage storage pools, independent rings that volumes can be placed by",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	poolCreateCommand = &cobra.Command{
+		Use:   "create NAME",
+		Short: "create a storage pool of the given peers",
+		Long: `creates storage pool NAME, with a ring of its own over the peers given with
+--peers and its own replication. Volumes created with --pool NAME are placed
+by the pool's ring instead of the cluster's, so their blocks only ever live
+on the pool's peers, and blocks of volumes outside the pool never do unless
+those peers are in the cluster's ring too.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := poolCreateAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	poolListCommand = &cobra.Command{
+		Use:   "list",
+		Short: "list storage pools",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := poolListAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	poolAddCommand = &cobra.Command{
+		Use:   "add NAME ADDRESS|UUID...",
+		Short: "add peers to a storage pool",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := poolChangeAction(cmd, args, true)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	poolRemoveCommand = &cobra.Command{
+		Use:   "remove NAME ADDRESS|UUID...",
+		Short: "remove peers from a storage pool",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := poolChangeAction(cmd, args, false)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	poolDeleteCommand = &cobra.Command{
+		Use:   "delete NAME",
+		Short: "delete a storage pool no volume is in",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := poolDeleteAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	poolCommand.AddCommand(poolCreateCommand, poolListCommand, poolAddCommand, poolRemoveCommand, poolDeleteCommand)
+	poolCreateCommand.Flags().StringSliceVar(&poolPeers, "peers", nil, "addresses or UUIDs of the pool's peers")
+	poolCreateCommand.Flags().StringVar(&poolRingType, "type", "ketama", "type of the pool's ring")
+	poolCreateCommand.Flags().IntVarP(&poolReplication, "replication", "r", 2, "number of replicas of each block in the pool")
+	poolListCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func poolMetadata() (torus.MetadataService, torus.PoolMetadataService, error) {
+	mds := mustConnectToMDS()
+	pmds, ok := mds.(torus.PoolMetadataService)
+	if !ok {
+		return nil, nil, torus.ErrNotSupported
+	}
+	return mds, pmds, nil
+}
+
+func poolCreateAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	if err := torus.ValidPoolName(args[0]); err != nil {
+		return err
+	}
+	if len(poolPeers) == 0 {
+		return fmt.Errorf("need the pool's peers, with --peers")
+	}
+	if poolReplication < 1 {
+		return fmt.Errorf("replication must be at least 1")
+	}
+	mds, pmds, err := poolMetadata()
+	if err != nil {
+		return err
+	}
+	r, err := makeRing(mds, poolRingType, poolReplication, poolPeers)
+	if err != nil {
+		return err
+	}
+	err = pmds.CreatePool(args[0], r)
+	if err == torus.ErrExists {
+		return fmt.Errorf("pool %s already exists", args[0])
+	} else if err != nil {
+		return fmt.Errorf("couldn't create pool %s: %v", args[0], err)
+	}
+	fmt.Printf("created pool %s: %s\n", args[0], describeRing(r))
+	return nil
+}
+
+func poolListAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds, pmds, err := poolMetadata()
+	if err != nil {
+		return err
+	}
+	pools, err := pmds.GetPools()
+	if err != nil {
+		return fmt.Errorf("couldn't list pools: %v", err)
+	}
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		return fmt.Errorf("couldn't list volumes: %v", err)
+	}
+	count := make(map[string]int)
+	for _, v := range vols {
+		pool, err := torus.GetVolumePool(mds, torus.VolumeID(v.Id))
+		if err != nil {
+			return fmt.Errorf("couldn't get the pool of %s: %v", v.Name, err)
+		}
+		count[pool]++
+	}
+	var names []string
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Pool", "Ring", "Version", "Peers", "Volumes"})
+	for _, name := range names {
+		r := pools[name]
+		table.Append([]string{
+			name,
+			describeRing(r),
+			fmt.Sprint(r.Version()),
+			strings.Join(r.Members(), ", "),
+			fmt.Sprint(count[name]),
+		})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
+
+// poolChangeAction adds peers to a pool's ring, or removes them from it. The
+// rebalancer moves the blocks of the pool's volumes to match.
+func poolChangeAction(cmd *cobra.Command, args []string, add bool) error {
+	if len(args) < 2 {
+		return torus.ErrUsage
+	}
+	mds, pmds, err := poolMetadata()
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	cur, err := pmds.GetPool(name)
+	if err == torus.ErrNotExist {
+		return fmt.Errorf("no pool named %s", name)
+	} else if err != nil {
+		return fmt.Errorf("couldn't get pool %s: %v", name, err)
+	}
+	var next torus.Ring
+	if add {
+		adder, ok := cur.(torus.RingAdder)
+		if !ok {
+			return fmt.Errorf("the pool's ring can't have peers added")
+		}
+		pil, err := resolvePeers(mds, args[1:])
+		if err != nil {
+			return err
+		}
+		next, err = adder.AddPeers(pil)
+		if err != nil {
+			return fmt.Errorf("couldn't add peers: %v", err)
+		}
+	} else {
+		remover, ok := cur.(torus.RingRemover)
+		if !ok {
+			return fmt.Errorf("the pool's ring can't have peers removed")
+		}
+		peers, err := mds.GetPeers()
+		if err != nil {
+			return fmt.Errorf("couldn't get peers: %v", err)
+		}
+		// Peers that are down can only be given by UUID.
+		members := cur.Members()
+		var pl torus.PeerList
+		for _, arg := range args[1:] {
+			uuid := arg
+			for _, p := range peers {
+				if p.Address != "" && p.Address == arg {
+					uuid = p.UUID
+				}
+			}
+			if !members.Has(uuid) {
+				return fmt.Errorf("peer %s isn't in pool %s", arg, name)
+			}
+			pl = append(pl, uuid)
+		}
+		next, err = remover.RemovePeers(pl)
+		if err != nil {
+			return fmt.Errorf("couldn't remove peers: %v", err)
+		}
+	}
+	err = pmds.SetPoolRing(name, next)
+	if err == torus.ErrNonSequentialRing {
+		return fmt.Errorf("pool %s was changed at the same time; try again", name)
+	} else if err != nil {
+		return fmt.Errorf("couldn't change pool %s: %v", name, err)
+	}
+	fmt.Printf("pool %s is now %s\n", name, describeRing(next))
+	return nil
+}
+
+func poolDeleteAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	err := torus.DeletePool(mds, args[0])
+	if err == torus.ErrNotExist {
+		return fmt.Errorf("no pool named %s", args[0])
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var rebalanceHistoryPeers bool
+
+var (
+	rebalanceCommand = &cobra.Command{
+		Use:   "rebalance",
+		Short: "inspect the movement of data between peers",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	rebalanceHistoryCommand = &cobra.Command{
+		Use:   "history",
+		Short: "show how much data recent ring changes moved, and how fast",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := rebalanceHistoryAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	rebalanceCommand.AddCommand(rebalanceHistoryCommand)
+	rebalanceHistoryCommand.Flags().BoolVarP(&rebalanceHistoryPeers, "peers", "", false, "show every peer's part in each ring change")
+	rebalanceHistoryCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+// ringChange sums the records of every peer for one ring change.
+type ringChange struct {
+	torus.RebalanceRecord
+	peers int
+}
+
+func (c *ringChange) add(r *torus.RebalanceRecord) {
+	if c.peers == 0 {
+		c.RebalanceRecord = *r
+		c.peers = 1
+		return
+	}
+	c.peers++
+	if r.FromVersion < c.FromVersion {
+		c.FromVersion = r.FromVersion
+	}
+	if r.Start < c.Start {
+		c.Start = r.Start
+	}
+	if r.Finish > c.Finish {
+		c.Finish = r.Finish
+	}
+	c.BlocksSent += r.BlocksSent
+	c.BytesSent += r.BytesSent
+	if r.PeakRate > c.PeakRate {
+		c.PeakRate = r.PeakRate
+	}
+	c.Errors += r.Errors
+}
+
+func rebalanceHistoryAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	hmds, ok := mds.(torus.RebalanceHistoryService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't keep rebalance history")
+	}
+	rs, err := hmds.GetRebalanceHistory()
+	if err != nil {
+		return fmt.Errorf("couldn't get rebalance history: %v", err)
+	}
+	table := NewTableWriter(os.Stdout)
+	header := []string{"Ring", "Finished", "Duration", "Peers", "Blocks Sent", "Data Sent", "Peak Peer Rate", "Errors"}
+	if rebalanceHistoryPeers {
+		header[3] = "Peer"
+	}
+	table.SetHeader(header)
+	row := func(r torus.RebalanceRecord, peer string) []string {
+		return []string{
+			fmt.Sprintf("%d -> %d", r.FromVersion, r.ToVersion),
+			humanize.Time(time.Unix(0, r.Finish)),
+			time.Duration(r.Finish - r.Start).String(),
+			peer,
+			fmt.Sprint(r.BlocksSent),
+			humanize.IBytes(r.BytesSent),
+			humanize.IBytes(r.PeakRate) + "/s",
+			fmt.Sprint(r.Errors),
+		}
+	}
+	if rebalanceHistoryPeers {
+		for _, r := range rs {
+			table.Append(row(*r, r.Peer))
+		}
+	} else {
+		var order []int
+		changes := make(map[int]*ringChange)
+		for _, r := range rs {
+			c, ok := changes[r.ToVersion]
+			if !ok {
+				c = &ringChange{}
+				changes[r.ToVersion] = c
+				order = append(order, r.ToVersion)
+			}
+			c.add(r)
+		}
+		for _, v := range order {
+			c := changes[v]
+			table.Append(row(c.RebalanceRecord, fmt.Sprint(c.peers)))
+		}
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	repairCommand = &cobra.Command{
+		Use:   "repair",
+		Short: "inspect and control repair of under-replicated data",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	repairPolicyCommand = &cobra.Command{
+		Use:   "policy [normal|preempt]",
+		Short: "get or set the cluster's emergency repair policy",
+		Long: `get or set the cluster's emergency repair policy.
+
+With 'preempt', as soon as any peer finds blocks down to their last live
+replica, all other peers pause rebalancing, garbage collection and scrubbing
+until the blocks have been re-replicated. With 'normal', repair happens at the usual
+background rate.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := repairPolicyAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	repairStatusCommand = &cobra.Command{
+		Use:   "status",
+		Short: "show peers currently repairing blocks with a single live replica",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := repairStatusAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	repairCommand.AddCommand(repairPolicyCommand)
+	repairCommand.AddCommand(repairStatusCommand)
+	repairStatusCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func mustConnectToRepairMDS() (torus.MetadataService, torus.RepairMetadataService) {
+	mds := mustConnectToMDS()
+	rmds, ok := mds.(torus.RepairMetadataService)
+	if !ok {
+		die("metadata service doesn't support repair coordination")
+	}
+	return mds, rmds
+}
+
+func repairPolicyAction(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return torus.ErrUsage
+	}
+	_, rmds := mustConnectToRepairMDS()
+	if len(args) == 0 {
+		p, err := rmds.GetRepairPolicy()
+		if err != nil {
+			return fmt.Errorf("couldn't get repair policy: %v", err)
+		}
+		fmt.Println(p)
+		return nil
+	}
+	p, err := torus.ParseRepairPolicy(args[0])
+	if err != nil {
+		return err
+	}
+	return rmds.SetRepairPolicy(p)
+}
+
+func repairStatusAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds, rmds := mustConnectToRepairMDS()
+	p, err := rmds.GetRepairPolicy()
+	if err != nil {
+		return fmt.Errorf("couldn't get repair policy: %v", err)
+	}
+	es, err := rmds.GetEmergencies()
+	if err != nil {
+		return fmt.Errorf("couldn't get emergencies: %v", err)
+	}
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peers: %v", err)
+	}
+	if !outputAsCSV {
+		fmt.Printf("Policy: %s\n", p)
+		if len(es) == 0 {
+			fmt.Println("No emergencies.")
+			return nil
+		}
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "UUID", "Critical Blocks", "Since"})
+	for _, e := range es {
+		addr := ""
+		if i := peers.UUIDAt(e.Peer); i != -1 {
+			addr = peers[i].Address
+		}
+		table.Append([]string{
+			addr,
+			e.Peer,
+			fmt.Sprint(e.CriticalBlocks),
+			humanize.Time(time.Unix(0, e.Since)),
+		})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/internal/flagconfig"
@@ -18,7 +20,12 @@ var (
 	uuids     []string
 	allUUIDs  bool
 	repFactor int
-	mds       torus.MetadataService
+
+	weightScale int
+	maxFill     []string
+	mds         torus.MetadataService
+
+	ringAckTimeout time.Duration
 )
 
 var ringCommand = &cobra.Command{
@@ -46,14 +53,25 @@ var ringGetCommand = &cobra.Command{
 	Run:   ringGetAction,
 }
 
+var ringAbortCommand = &cobra.Command{
+	Use:   "abort",
+	Short: "abandon a proposed ring that was never committed",
+	Long:  "drops the ring staged by a ring change, such as one whose torusctl died while waiting for peers to acknowledge it, keeping the current ring. Proposals lapse by themselves a while after their change gives up, but this saves waiting.",
+	Run:   ringAbortAction,
+}
+
 func init() {
 	ringCommand.AddCommand(ringChangeReplicationCommand)
 	ringCommand.AddCommand(ringChangeCommand)
 	ringCommand.AddCommand(ringGetCommand)
+	ringCommand.AddCommand(ringAbortCommand)
 	ringChangeCommand.Flags().StringSliceVar(&uuids, "uuids", []string{}, "uuids to incorporate in the ring")
 	ringChangeCommand.Flags().BoolVar(&allUUIDs, "all-peers", false, "use all peers in the ring")
-	ringChangeCommand.Flags().StringVar(&ringType, "type", "ketama", "type of ring to create (empty, single, mod or ketama)")
+	ringChangeCommand.Flags().StringVar(&ringType, "type", "ketama", "type of ring to create (empty, single, mod, ketama or any other registered type)")
 	ringChangeCommand.Flags().IntVarP(&repFactor, "replication", "r", 2, "number of replicas")
+	ringChangeCommand.Flags().IntVar(&weightScale, "weight-scale", 0, fmt.Sprintf("weigh ketama peers from 1 up to this, rather than by the GCD of their capacities (%d if only --max-fill is given)", torus.DefaultWeightScale))
+	ringChangeCommand.Flags().StringSliceVar(&maxFill, "max-fill", nil, "UUID=FRACTION of a ketama peer's capacity to fill at most, such as 0.85 for one that shares its disk")
+	ringChangeReplicationCommand.Flags().DurationVar(&ringAckTimeout, "ack-timeout", torus.DefaultRingAckTimeout, "how long to wait for every peer to acknowledge the new ring before giving up on it")
 }
 
 func ringAction(cmd *cobra.Command, args []string) {
@@ -71,6 +89,30 @@ func ringGetAction(cmd *cobra.Command, args []string) {
 	fmt.Println(ring.Describe())
 }
 
+func ringAbortAction(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	mds := mustConnectToMDS()
+	rc, ok := mds.(torus.RingChangeMetadataService)
+	if !ok {
+		die("the metadata service changes rings at once; there's nothing to abort")
+	}
+	r, err := rc.GetProposedRing()
+	if err != nil {
+		die("couldn't get proposed ring: %v", err)
+	}
+	if r == nil {
+		fmt.Println("no ring change is in progress")
+		return
+	}
+	if err := rc.AbortRing(r.Version()); err != nil {
+		die("couldn't abort ring %d: %v", r.Version(), err)
+	}
+	fmt.Printf("abandoned proposed ring %d\n", r.Version())
+}
+
 func ringChangeAction(cmd *cobra.Command, args []string) {
 	if mds == nil {
 		mds = mustConnectToMDS()
@@ -79,46 +121,60 @@ func ringChangeAction(cmd *cobra.Command, args []string) {
 	if err != nil {
 		die("couldn't get ring: %v", err)
 	}
-	var newRing torus.Ring
+	t, ok := ring.RingTypeFromString(ringType)
+	if !ok {
+		panic("still unknown ring type")
+	}
+	rm := &models.Ring{
+		Type:    uint32(t),
+		Version: uint32(currentRing.Version() + 1),
+	}
 	switch ringType {
 	case "empty":
-		newRing, err = ring.CreateRing(&models.Ring{
-			Type:    uint32(ring.Empty),
-			Version: uint32(currentRing.Version() + 1),
-		})
 	case "single":
-		newRing, err = ring.CreateRing(&models.Ring{
-			Type:    uint32(ring.Single),
-			Peers:   peers,
-			Version: uint32(currentRing.Version() + 1),
-		})
-	case "mod":
-		newRing, err = ring.CreateRing(&models.Ring{
-			Type:              uint32(ring.Mod),
-			Peers:             peers,
-			ReplicationFactor: uint32(repFactor),
-			Version:           uint32(currentRing.Version() + 1),
-		})
-	case "ketama":
-		newRing, err = ring.CreateRing(&models.Ring{
-			Type:              uint32(ring.Ketama),
-			Peers:             peers,
-			ReplicationFactor: uint32(repFactor),
-			Version:           uint32(currentRing.Version() + 1),
-		})
+		rm.Peers = peers
 	default:
-		panic("still unknown ring type")
+		// mod, ketama and any ring registered out of tree.
+		rm.Peers = peers
+		rm.ReplicationFactor = uint32(repFactor)
+	}
+	if weightScale != 0 || len(maxFill) != 0 {
+		fills, err := parseMaxFill(maxFill)
+		if err != nil {
+			die("%v", err)
+		}
+		err = ring.SetCappedWeights(rm, weightScale, fills)
+		if err != nil {
+			die("%v", err)
+		}
 	}
+	newRing, err := ring.CreateRing(rm)
 	if err != nil {
 		die("couldn't create new ring: %v", err)
 	}
 	cfg := flagconfig.BuildConfigFromFlags()
-	err = torus.SetRing("etcd", cfg, newRing)
+	err = torus.SetRing(flagconfig.MetadataService(), cfg, newRing)
 	if err != nil {
 		die("couldn't set new ring: %v", err)
 	}
 }
 
+func parseMaxFill(list []string) (map[string]float64, error) {
+	out := make(map[string]float64)
+	for _, x := range list {
+		kv := strings.SplitN(x, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid max fill %q; use UUID=FRACTION", x)
+		}
+		f, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || f <= 0 || f > 1 {
+			return nil, fmt.Errorf("invalid max fill %q; the fraction is from 0 to 1", x)
+		}
+		out[kv[0]] = f
+	}
+	return out, nil
+}
+
 func ringChangePreRun(cmd *cobra.Command, args []string) {
 	mds = mustConnectToMDS()
 	currentPeers, err := mds.GetPeers()
@@ -150,10 +206,12 @@ func ringChangePreRun(cmd *cobra.Command, args []string) {
 			die("single needs one peer (use --uuids)\n")
 		}
 		return
-	case "mod":
-	case "ketama":
+	case "union":
+		die("union rings are only made by the cluster, while it moves between rings")
 	default:
-		die(`invalid ring type %s (try "empty", "mod", "single" or "ketama")`, ringType)
+		if _, ok := ring.RingTypeFromString(ringType); !ok {
+			die("invalid ring type %s (try one of %s)", ringType, strings.Join(ring.RingNames(), ", "))
+		}
 	}
 }
 
@@ -182,7 +240,7 @@ func ringChangeReplicationAction(cmd *cobra.Command, args []string) {
 	if err != nil {
 		die("couldn't change replication amount: %v", err)
 	}
-	err = mds.SetRing(newRing)
+	err = torus.ChangeRing(mds, newRing, ringAckTimeout)
 	if err != nil {
 		die("couldn't set new ring: %v", err)
 	}
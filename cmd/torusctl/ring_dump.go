@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/census"
+	"github.com/spf13/cobra"
+)
+
+var ringDumpCommand = &cobra.Command{
+	Use:   "dump OUTPUT_FILE",
+	Short: "dump the cluster's peers, ring and blocks for ringtool -from-dump",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := ringDumpAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	ringCommand.AddCommand(ringDumpCommand)
+}
+
+func ringDumpAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	output, err := getWriterFromArg(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't open output: %v", err)
+	}
+	srv := createServer()
+	defer srv.Close()
+	c, err := census.Take(srv)
+	if err != nil {
+		return fmt.Errorf("couldn't take census of the cluster: %v", err)
+	}
+	err = c.Write(output)
+	if err != nil {
+		return fmt.Errorf("couldn't write census: %v", err)
+	}
+	if output != os.Stdout {
+		fmt.Fprintf(os.Stderr, "dumped %d peers and %d blocks\n", len(c.Peers), len(c.Blocks))
+	}
+	return nil
+}
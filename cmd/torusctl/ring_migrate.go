@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"github.com/spf13/cobra"
+)
+
+var migrateForce bool
+
+var ringMigrateCommand = &cobra.Command{
+	Use:   "migrate TYPE|finish|abort",
+	Short: "move the cluster to a ring of another type without downtime",
+	Long: `move the cluster to a ring of another type, such as from mod to ketama,
+while it keeps serving.
+
+'migrate TYPE' starts the migration. Until it ends, blocks are placed by both
+the current ring and a TYPE ring of the same peers: writes go to the replicas
+of both, reads try the current ring's first, and the rebalancer copies every
+block to its new replicas. Once 'torusctl peer list' shows the cluster
+balanced, 'migrate finish' makes the TYPE ring the cluster's ring, and the
+copies only the old ring wanted are cleaned up. 'migrate abort' goes back to
+the old ring instead.`,
+	Run: ringMigrateAction,
+}
+
+func init() {
+	ringCommand.AddCommand(ringMigrateCommand)
+	ringMigrateCommand.Flags().IntVarP(&repFactor, "replication", "r", 0, "number of replicas in the new ring (default: as now)")
+	ringMigrateCommand.Flags().BoolVar(&migrateForce, "force", false, "finish even though blocks are still being copied to the new ring")
+	ringMigrateCommand.Flags().DurationVar(&ringAckTimeout, "ack-timeout", torus.DefaultRingAckTimeout, "how long to wait for every peer to acknowledge the new ring before giving up on it")
+}
+
+func ringMigrateAction(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Usage()
+		die("need a ring type, finish or abort")
+	}
+	if mds == nil {
+		mds = mustConnectToMDS()
+	}
+	currentRing, err := mds.GetRing()
+	if err != nil {
+		die("couldn't get ring: %v", err)
+	}
+	oldRing, newRing, migrating := ring.SplitUnion(currentRing)
+	var next torus.Ring
+	switch args[0] {
+	case "finish", "abort":
+		if !migrating {
+			die("the cluster isn't migrating between rings")
+		}
+		target := oldRing
+		if args[0] == "finish" {
+			target = newRing
+			if !migrateForce {
+				checkMigrated(currentRing)
+			}
+		}
+		next, err = ring.WithVersion(target, currentRing.Version()+1)
+		if err != nil {
+			die("couldn't make ring: %v", err)
+		}
+	default:
+		if migrating {
+			die("the cluster is already migrating; finish or abort that first")
+		}
+		next = migrationRing(currentRing, args[0])
+	}
+	err = torus.ChangeRing(mds, next, ringAckTimeout)
+	if err != nil {
+		die("couldn't set new ring: %v", err)
+	}
+}
+
+// migrationRing returns the union of the current ring and a ring of type
+// typ with the same peers.
+func migrationRing(currentRing torus.Ring, typ string) torus.Ring {
+	t, ok := ring.RingTypeFromString(typ)
+	if !ok || t == ring.Union {
+		die("unknown ring type %s; use one of %s", typ, strings.Join(ring.RingNames(), ", "))
+	}
+	if t == currentRing.Type() {
+		die("the ring is already of type %s", typ)
+	}
+	rep := repFactor
+	if rep == 0 {
+		perm, err := currentRing.GetPeers(torus.BlockRef{})
+		if err != nil {
+			die("couldn't work out the current replication: %v", err)
+		}
+		rep = perm.Replication
+	}
+	peers, err := mds.GetPeers()
+	if err != nil {
+		die("couldn't get peers: %v", err)
+	}
+	members := currentRing.Members()
+	var pil torus.PeerInfoList
+	for _, p := range peers {
+		if members.Has(p.UUID) {
+			pil = append(pil, &models.PeerInfo{
+				UUID:        p.UUID,
+				TotalBlocks: p.TotalBlocks,
+			})
+		}
+	}
+	if len(pil) != len(members) {
+		die("only %d of the ring's %d peers are up; bring them back before migrating", len(pil), len(members))
+	}
+	version := currentRing.Version() + 1
+	newRing, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(t),
+		Version:           uint32(version),
+		ReplicationFactor: uint32(rep),
+		Peers:             pil,
+	})
+	if err != nil {
+		die("couldn't create new ring: %v", err)
+	}
+	return ring.NewUnionRing(version, currentRing, newRing)
+}
+
+// checkMigrated dies unless every peer has finished copying its blocks to
+// the replicas the union ring wants.
+func checkMigrated(r torus.Ring) {
+	peers, err := mds.GetPeers()
+	if err != nil {
+		die("couldn't get peers: %v", err)
+	}
+	members := r.Members()
+	var busy []string
+	for _, p := range peers {
+		if !members.Has(p.UUID) || p.RebalanceInfo == nil {
+			continue
+		}
+		if p.RebalanceInfo.Rebalancing || p.RebalanceInfo.UnderReplicatedBlocks > 0 {
+			busy = append(busy, p.UUID)
+		}
+	}
+	if len(busy) != 0 {
+		fmt.Printf("still copying blocks to the new ring: %s\n", strings.Join(busy, ", "))
+		die("not finishing the migration; wait for it, or use --force")
+	}
+}
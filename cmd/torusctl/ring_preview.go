@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/census"
+	"github.com/coreos/torus/ringsim"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	previewAddNodes  []string
+	previewBandwidth string
+)
+
+var ringPreviewCommand = &cobra.Command{
+	Use:   "preview --add-node UUID...",
+	Short: "estimate what a ring change would move, before making it",
+	Long: `simulate the rebalance that adding peers to the ring would start, using the
+blocks the cluster actually holds, and report how many blocks would move, how
+much data would cross the network, and roughly how long it would take.
+
+Nothing is changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := ringPreviewAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	ringCommand.AddCommand(ringPreviewCommand)
+	ringPreviewCommand.Flags().StringSliceVar(&previewAddNodes, "add-node", nil, "UUID of a peer to add to the ring (may be repeated)")
+	ringPreviewCommand.Flags().StringVarP(&previewBandwidth, "bandwidth", "", "100MiB", "rebalance throughput of a single peer, per second")
+}
+
+func ringPreviewAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 || len(previewAddNodes) == 0 {
+		return torus.ErrUsage
+	}
+	bw, err := humanize.ParseBytes(previewBandwidth)
+	if err != nil || bw == 0 {
+		return fmt.Errorf("invalid bandwidth %q", previewBandwidth)
+	}
+	srv := createServer()
+	defer srv.Close()
+	cur, err := srv.MDS.GetRing()
+	if err != nil {
+		return fmt.Errorf("couldn't get ring: %v", err)
+	}
+	adder, ok := cur.(torus.RingAdder)
+	if !ok {
+		return fmt.Errorf("current ring type cannot support adding")
+	}
+	peers, err := srv.MDS.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peer list: %v", err)
+	}
+	members := cur.Members()
+	var add torus.PeerInfoList
+	for _, uuid := range previewAddNodes {
+		if members.Has(uuid) {
+			return fmt.Errorf("peer %s is already in the ring", uuid)
+		}
+		i := peers.UUIDAt(uuid)
+		if i == -1 {
+			return fmt.Errorf("peer %s is not currently healthy", uuid)
+		}
+		add = add.Union(torus.PeerInfoList{peers[i]})
+	}
+	proposed, err := adder.AddPeers(add)
+	if err != nil {
+		return fmt.Errorf("couldn't add peers to ring: %v", err)
+	}
+	refs, err := census.Blocks(srv)
+	if err != nil {
+		return fmt.Errorf("couldn't list the cluster's blocks: %v", err)
+	}
+	before, err := ringsim.Assign(refs, cur)
+	if err != nil {
+		return err
+	}
+	after, stats, err := before.Rebalance(cur, proposed)
+	if err != nil {
+		return err
+	}
+
+	blockSize := srv.MDS.GlobalMetadata().BlockSize
+	fmt.Printf("Adding %d peers to %d\n", len(add), len(members))
+	fmt.Printf("Blocks:         %d\n", len(refs))
+	fmt.Printf("Blocks moved:   %d\n", stats.BlocksSent)
+	fmt.Printf("Network data:   %s\n", humanize.IBytes(stats.BlocksSent*blockSize))
+	fmt.Printf("Estimated time: %s at %s/s per peer\n", stats.Duration(blockSize, bw), humanize.IBytes(bw))
+	fmt.Println()
+
+	var uuids []string
+	for uuid := range after {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Peer", "Before", "After", "Sends", "Receives"})
+	for _, uuid := range uuids {
+		table.Append([]string{
+			uuid,
+			humanize.IBytes(uint64(len(before[uuid])) * blockSize),
+			humanize.IBytes(uint64(len(after[uuid])) * blockSize),
+			humanize.IBytes(stats.Sent[uuid] * blockSize),
+			humanize.IBytes(stats.Received[uuid] * blockSize),
+		})
+	}
+	table.Render()
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scrubCommand = &cobra.Command{
+		Use:   "scrub",
+		Short: "inspect and control background verification of stored blocks",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	scrubStatusCommand = &cobra.Command{
+		Use:   "status",
+		Short: "show each peer's scrub progress and the corrupt blocks found",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := scrubStatusAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	scrubStartCommand = &cobra.Command{
+		Use:   "start",
+		Short: "resume scrubbing, and start a new pass on every peer",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := scrubStartAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	scrubPauseCommand = &cobra.Command{
+		Use:   "pause",
+		Short: "pause scrubbing on every peer until the next start",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := scrubPauseAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	scrubCommand.AddCommand(scrubStatusCommand)
+	scrubCommand.AddCommand(scrubStartCommand)
+	scrubCommand.AddCommand(scrubPauseCommand)
+	scrubStatusCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func mustConnectToScrubMDS() (torus.MetadataService, torus.ScrubMetadataService) {
+	mds := mustConnectToMDS()
+	smds, ok := mds.(torus.ScrubMetadataService)
+	if !ok {
+		die("metadata service doesn't support scrubbing")
+	}
+	return mds, smds
+}
+
+func scrubStartAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	_, smds := mustConnectToScrubMDS()
+	return smds.SetScrubControl(torus.ScrubControl{
+		Requested: time.Now().UnixNano(),
+	})
+}
+
+func scrubPauseAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	_, smds := mustConnectToScrubMDS()
+	sc, err := smds.GetScrubControl()
+	if err != nil {
+		return fmt.Errorf("couldn't get scrub control: %v", err)
+	}
+	sc.Paused = true
+	return smds.SetScrubControl(sc)
+}
+
+func scrubStatusAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds, smds := mustConnectToScrubMDS()
+	ss, err := smds.GetScrubStatuses()
+	if err != nil {
+		return fmt.Errorf("couldn't get scrub status: %v", err)
+	}
+	corrupt, err := smds.GetCorruptBlocks()
+	if err != nil {
+		return fmt.Errorf("couldn't get corrupt blocks: %v", err)
+	}
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peers: %v", err)
+	}
+	addr := func(uuid string) string {
+		if i := peers.UUIDAt(uuid); i != -1 {
+			return peers[i].Address
+		}
+		return ""
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "UUID", "State", "Progress", "Corrupt", "Repaired", "Last Pass"})
+	for _, s := range ss {
+		state := "idle"
+		switch {
+		case s.Paused:
+			state = "paused"
+		case s.Scrubbing:
+			state = "scrubbing"
+		}
+		progress := ""
+		if s.Scrubbing && s.Total != 0 {
+			progress = fmt.Sprintf("%d/%d (%.0f%%)", s.Checked, s.Total, float64(s.Checked)/float64(s.Total)*100)
+		}
+		last := "never"
+		if s.PassFinish != 0 {
+			last = humanize.Time(time.Unix(0, s.PassFinish))
+		}
+		table.Append([]string{
+			addr(s.Peer),
+			s.Peer,
+			state,
+			progress,
+			fmt.Sprint(s.Corrupt),
+			fmt.Sprint(s.Repaired),
+			last,
+		})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	if len(corrupt) == 0 {
+		return nil
+	}
+	fmt.Println()
+	ct := NewTableWriter(os.Stdout)
+	ct.SetHeader([]string{"UUID", "Block", "Found", "Repaired"})
+	for _, b := range corrupt {
+		ct.Append([]string{
+			b.Peer,
+			b.Ref.String(),
+			humanize.Time(time.Unix(0, b.Found)),
+			fmt.Sprint(b.Repaired),
+		})
+	}
+	ct.Render()
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/flagconfig"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusWatch    bool
+	statusInterval time.Duration
+)
+
+var statusCommand = &cobra.Command{
+	Use:   "status",
+	Short: "show the health, usage and rebalancing of every peer at a glance",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := statusAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	statusCommand.Flags().BoolVarP(&statusWatch, "watch", "w", false, "keep refreshing the status until interrupted")
+	statusCommand.Flags().DurationVarP(&statusInterval, "interval", "", 3*time.Second, "how often to refresh with --watch")
+	statusCommand.Flags().BoolVarP(&outputAsSI, "si", "", false, "output sizes in powers of 1000")
+}
+
+func statusAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	if !statusWatch {
+		return writeStatus(os.Stdout, mds)
+	}
+	for {
+		// Render to a buffer first, so that the screen is only cleared
+		// once there's something to replace it with.
+		var buf bytes.Buffer
+		err := writeStatus(&buf, mds)
+		if err != nil {
+			fmt.Fprintf(&buf, "couldn't get status: %v\n", err)
+		}
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("Every %s: torusctl status\t%s\n\n", statusInterval, time.Now().Format(time.Stamp))
+		buf.WriteTo(os.Stdout)
+		time.Sleep(statusInterval)
+	}
+}
+
+func writeStatus(w io.Writer, mds torus.MetadataService) error {
+	gmd := mds.GlobalMetadata()
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return fmt.Errorf("couldn't get peers: %v", err)
+	}
+	r, err := mds.GetRing()
+	if err != nil {
+		return fmt.Errorf("couldn't get ring: %v", err)
+	}
+	leaving := make(map[string]bool)
+	if dmds, ok := mds.(torus.DepartureMetadataService); ok {
+		ds, err := dmds.GetDepartures()
+		if err != nil {
+			return fmt.Errorf("couldn't get departures: %v", err)
+		}
+		for _, d := range ds {
+			leaving[d.Peer] = true
+		}
+	}
+	draining, err := drainingPeers(mds)
+	if err != nil {
+		return err
+	}
+	members := r.Members()
+	timeout := flagconfig.BuildConfigFromFlags().PeerTimeout
+	view := ring.HealthView{
+		Ring: r,
+		Down: func(uuid string) bool {
+			i := peers.UUIDAt(uuid)
+			return i == -1 || torus.PeerStale(peers[i], timeout)
+		},
+	}
+
+	var (
+		total, used     uint64
+		underReplicated uint64
+		rebalancing     int
+	)
+	table := NewTableWriter(w)
+	table.SetHeader([]string{"Address", "UUID", "Zone", "Health", "Size", "Used", "Use%", "Rebalance", "Under-Rep"})
+	for _, p := range peers {
+		if p.Address == "" {
+			continue
+		}
+		ri := p.RebalanceInfo
+		if ri == nil {
+			ri = &models.RebalanceInfo{}
+		}
+		if ri.Rebalancing {
+			rebalancing++
+		}
+		table.Append([]string{
+			p.Address,
+			p.UUID,
+			p.Zone,
+			peerHealth(p, members.Has(p.UUID), leaving[p.UUID], draining[p.UUID], timeout),
+			bytesOrIbytes(p.TotalBlocks*gmd.BlockSize, outputAsSI),
+			bytesOrIbytes(p.UsedBlocks*gmd.BlockSize, outputAsSI),
+			percent(p.UsedBlocks, p.TotalBlocks),
+			rebalanceProgress(ri),
+			fmt.Sprint(ri.UnderReplicatedBlocks),
+		})
+		total += p.TotalBlocks
+		used += p.UsedBlocks
+		underReplicated += ri.UnderReplicatedBlocks
+	}
+	for _, m := range members {
+		if peers.UUIDAt(m) != -1 {
+			continue
+		}
+		health := "DOWN"
+		if leaving[m] {
+			health = "Leaving"
+		}
+		table.Append([]string{"", m, "", health, "???", "???", "", "", ""})
+	}
+
+	fmt.Fprintf(w, "Ring:             version %d, %s\n", r.Version(), r.Describe())
+	fmt.Fprintf(w, "Healthy members:  %d of %d\n", len(view.HealthyMembers()), len(members))
+	fmt.Fprintf(w, "Usage:            %s of %s (%s)\n",
+		bytesOrIbytes(used*gmd.BlockSize, outputAsSI),
+		bytesOrIbytes(total*gmd.BlockSize, outputAsSI),
+		percent(used, total))
+	fmt.Fprintf(w, "Under-replicated: %d blocks\n", underReplicated)
+	fmt.Fprintf(w, "Rebalancing:      %d of %d peers\n\n", rebalancing, len(members))
+	table.Render()
+	return nil
+}
+
+// drainingPeers returns the set of peers being drained, if the metadata
+// service can drain them.
+func drainingPeers(mds torus.MetadataService) (map[string]bool, error) {
+	out := make(map[string]bool)
+	dmds, ok := mds.(torus.DrainMetadataService)
+	if !ok {
+		return out, nil
+	}
+	uuids, err := dmds.GetDraining()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get draining peers: %v", err)
+	}
+	for _, p := range uuids {
+		out[p] = true
+	}
+	return out, nil
+}
+
+// peerHealth sums up the state of a peer that has a heartbeat.
+func peerHealth(p *models.PeerInfo, member, leaving, draining bool, timeout time.Duration) string {
+	switch {
+	case leaving:
+		return "Leaving"
+	case torus.PeerStale(p, timeout):
+		return "TIMED OUT"
+	case !member:
+		return "Avail"
+	case draining:
+		return "Draining"
+	}
+	return "OK (" + humanize.Time(time.Unix(0, p.LastSeen)) + ")"
+}
+
+func rebalanceProgress(ri *models.RebalanceInfo) string {
+	if !ri.Rebalancing {
+		return "Balanced"
+	}
+	if ri.PassBlocks == 0 {
+		return "Starting"
+	}
+	return fmt.Sprintf("%d/%d (%s)", ri.PassCheckedBlocks, ri.PassBlocks, percent(ri.PassCheckedBlocks, ri.PassBlocks))
+}
+
+func percent(n, of uint64) string {
+	if of == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(of))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tenantSoftQuota string
+	tenantHardQuota string
+)
+
+var (
+	tenantCommand = &cobra.Command{
+		Use:   "tenant",
+		Short: "manage tenants and their quotas",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	tenantDfCommand = &cobra.Command{
+		Use:   "df",
+		Short: "show how much of its quota each tenant has provisioned",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := tenantDfAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	tenantSetQuotaCommand = &cobra.Command{
+		Use:   "set-quota TENANT",
+		Short: "set the soft and hard quotas of a tenant",
+		Long: `set the soft and hard quotas on the total size of a tenant's volumes.
+
+Going over the soft quota only warns. Volumes that would take the tenant over
+its hard quota can't be created, and a tenant that is over it anyway, because
+the quota was lowered, can't write to its volumes until it deletes enough of
+them. A quota of 0 means no limit.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := tenantSetQuotaAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	tenantCommand.AddCommand(tenantDfCommand)
+	tenantCommand.AddCommand(tenantSetQuotaCommand)
+	tenantDfCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+	tenantDfCommand.Flags().BoolVarP(&outputAsSI, "si", "", false, "output sizes in powers of 1000")
+	tenantSetQuotaCommand.Flags().StringVarP(&tenantSoftQuota, "soft", "", "0", "soft quota (G,GiB,M,MiB,etc suffixes accepted)")
+	tenantSetQuotaCommand.Flags().StringVarP(&tenantHardQuota, "hard", "", "0", "hard quota (G,GiB,M,MiB,etc suffixes accepted)")
+}
+
+func tenantSetQuotaAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	err := torus.ValidTenantName(args[0])
+	if err != nil {
+		return err
+	}
+	var q torus.TenantQuota
+	q.Soft, err = humanize.ParseBytes(tenantSoftQuota)
+	if err != nil {
+		return fmt.Errorf("error parsing soft quota %s: %v", tenantSoftQuota, err)
+	}
+	q.Hard, err = humanize.ParseBytes(tenantHardQuota)
+	if err != nil {
+		return fmt.Errorf("error parsing hard quota %s: %v", tenantHardQuota, err)
+	}
+	if q.Hard != 0 && q.Soft > q.Hard {
+		return fmt.Errorf("soft quota is larger than the hard quota")
+	}
+	mds := mustConnectToMDS()
+	tmds, ok := mds.(torus.TenantMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support tenants")
+	}
+	return tmds.SetTenantQuota(args[0], q)
+}
+
+func tenantDfAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	usage, err := torus.GetTenantUsage(mds)
+	if err == torus.ErrNotSupported {
+		return fmt.Errorf("metadata service doesn't support tenants")
+	} else if err != nil {
+		return fmt.Errorf("couldn't get tenant usage: %v", err)
+	}
+	var tenants []string
+	for t := range usage {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	quota := func(q uint64) string {
+		if q == 0 {
+			return "-"
+		}
+		return bytesOrIbytes(q, outputAsSI)
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Tenant", "Volumes", "Provisioned", "Soft Quota", "Hard Quota", "Use%", "Status"})
+	for _, t := range tenants {
+		u := usage[t]
+		use := "-"
+		if u.Quota.Hard != 0 {
+			use = fmt.Sprintf("%.0f%%", float64(u.Provisioned)/float64(u.Quota.Hard)*100)
+		}
+		status := "ok"
+		switch {
+		case u.OverHard():
+			status = "over hard quota; writes refused"
+		case u.OverSoft():
+			status = "over soft quota"
+		}
+		table.Append([]string{
+			t,
+			fmt.Sprint(u.Volumes),
+			bytesOrIbytes(u.Provisioned, outputAsSI),
+			quota(u.Quota.Soft),
+			quota(u.Quota.Hard),
+			use,
+			status,
+		})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
@@ -38,10 +38,23 @@ func init() {
 	rootCommand.PersistentFlags().BoolVarP(&debug, "debug", "", false, "enable debug logging")
 	rootCommand.AddCommand(initCommand)
 	rootCommand.AddCommand(blockCommand)
+	rootCommand.AddCommand(capacityCommand)
+	rootCommand.AddCommand(dedupCommand)
+	rootCommand.AddCommand(fsckCommand)
+	rootCommand.AddCommand(gcCommand)
 	rootCommand.AddCommand(listPeersCommand)
 	rootCommand.AddCommand(ringCommand)
 	rootCommand.AddCommand(peerCommand)
+	rootCommand.AddCommand(joinTokenCommand)
+	rootCommand.AddCommand(planCommand)
+	rootCommand.AddCommand(rebalanceCommand)
+	rootCommand.AddCommand(repairCommand)
+	rootCommand.AddCommand(scrubCommand)
+	rootCommand.AddCommand(statusCommand)
 	rootCommand.AddCommand(volumeCommand)
+	rootCommand.AddCommand(tenantCommand)
+	rootCommand.AddCommand(poolCommand)
+	rootCommand.AddCommand(aclCommand)
 	rootCommand.AddCommand(versionCommand)
 	rootCommand.AddCommand(wipeCommand)
 	rootCommand.AddCommand(configCommand)
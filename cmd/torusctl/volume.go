@@ -1,13 +1,28 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
+	"github.com/coreos/torus"
 	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/fs"
+	"github.com/coreos/torus/object"
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 )
 
+var (
+	volumeTenant     string
+	volumeCount      int
+	volumePrefix     string
+	volumeRedundancy string
+	volumeShared     bool
+	volumeListTags   []string
+	volumeShowTags   bool
+	volumePool       string
+)
+
 var volumeCommand = &cobra.Command{
 	Use:   "volume",
 	Short: "manage volumes in the cluster",
@@ -33,12 +48,54 @@ var volumeCreateBlockCommand = &cobra.Command{
 	Run:   volumeCreateBlockAction,
 }
 
+var volumeCreateFileCommand = &cobra.Command{
+	Use:   "create-file NAME SIZE",
+	Short: "create a file volume in the cluster",
+	Long:  "creates a file volume named NAME that holds up to SIZE bytes of files (G,GiB,M,MiB,etc suffixes accepted), to mount with torusfs",
+	Run:   volumeCreateFileAction,
+}
+
+var volumeCreateBucketCommand = &cobra.Command{
+	Use:   "create-bucket NAME",
+	Short: "create an object volume in the cluster",
+	Long:  "creates an object volume named NAME, a bucket to serve over the S3 API of torusd --s3-address",
+	Run:   volumeCreateBucketAction,
+}
+
+var volumeCreateCommand = &cobra.Command{
+	Use:   "create [NAME] SIZE",
+	Short: "create block volumes in the cluster",
+	Long: `creates a block volume named NAME of size SIZE bytes (G,GiB,M,MiB,etc suffixes
+accepted), or with --prefix, --count volumes named PREFIX0, PREFIX1, and so on.
+
+Volumes are created up to 32 at a time, each batch in a single metadata
+transaction.`,
+	Run: volumeCreateAction,
+}
+
 func init() {
+	volumeCommand.AddCommand(volumeCreateCommand)
 	volumeCommand.AddCommand(volumeDeleteCommand)
 	volumeCommand.AddCommand(volumeListCommand)
 	volumeCommand.AddCommand(volumeCreateBlockCommand)
+	volumeCommand.AddCommand(volumeCreateFileCommand)
+	volumeCommand.AddCommand(volumeCreateBucketCommand)
 	volumeListCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
 	volumeListCommand.Flags().BoolVarP(&outputAsSI, "si", "", false, "output sizes in powers of 1000")
+	volumeListCommand.Flags().StringSliceVarP(&volumeListTags, "tag", "", nil, "only list volumes with this tag, as KEY=VALUE, or KEY for any value; repeat to require several")
+	volumeListCommand.Flags().BoolVarP(&volumeShowTags, "show-tags", "", false, "add a column of each volume's tags")
+	volumeCreateCommand.Flags().IntVarP(&volumeCount, "count", "", 1, "number of volumes to create")
+	volumeCreateCommand.Flags().StringVarP(&volumePrefix, "prefix", "", "", "create volumes named by this prefix and a number")
+	volumeCreateCommand.Flags().StringVarP(&volumeRedundancy, "redundancy", "", "ring", "redundancy of the volumes: 'ring', 'rep=N', 'Nx' or 'ec=D+P'")
+	volumeCreateCommand.Flags().StringVarP(&volumePool, "pool", "", "", "storage pool to place the volumes in, instead of the cluster's ring")
+	volumeCreateBlockCommand.Flags().StringVarP(&volumeTenant, "tenant", "", "", "tenant the volume belongs to, and whose quota it counts against")
+	volumeCreateBlockCommand.Flags().StringVarP(&volumeRedundancy, "redundancy", "", "ring", "redundancy of the volume: 'ring', 'rep=N', 'Nx' or 'ec=D+P'")
+	volumeCreateBlockCommand.Flags().BoolVarP(&volumeShared, "shared", "", false, "let many hosts attach the volume at once, for clustered filesystems")
+	volumeCreateBlockCommand.Flags().StringVarP(&volumePool, "pool", "", "", "storage pool to place the volume in, instead of the cluster's ring")
+	volumeCreateFileCommand.Flags().StringVarP(&volumeRedundancy, "redundancy", "", "ring", "redundancy of the volume: 'ring', 'rep=N', 'Nx' or 'ec=D+P'")
+	volumeCreateFileCommand.Flags().StringVarP(&volumePool, "pool", "", "", "storage pool to place the volume in, instead of the cluster's ring")
+	volumeCreateBucketCommand.Flags().StringVarP(&volumeRedundancy, "redundancy", "", "ring", "redundancy of the volume: 'ring', 'rep=N', 'Nx' or 'ec=D+P'")
+	volumeCreateBucketCommand.Flags().StringVarP(&volumePool, "pool", "", "", "storage pool to place the volume in, instead of the cluster's ring")
 }
 
 func volumeAction(cmd *cobra.Command, args []string) {
@@ -51,20 +108,51 @@ func volumeListAction(cmd *cobra.Command, args []string) {
 		cmd.Usage()
 		os.Exit(1)
 	}
+	filter, err := torus.ParseTags(volumeListTags, true)
+	if err != nil {
+		die("%v", err)
+	}
 	mds := mustConnectToMDS()
 	vols, _, err := mds.GetVolumes()
 	if err != nil {
 		die("error listing volumes: %v\n", err)
 	}
+	var tags map[torus.VolumeID]map[string]string
+	if len(filter) != 0 || volumeShowTags {
+		tmds, ok := mds.(torus.TagMetadataService)
+		if !ok {
+			die("metadata service doesn't support volume tags")
+		}
+		tags, err = tmds.GetVolumeTags()
+		if err != nil {
+			die("error getting volume tags: %v", err)
+		}
+	}
 	table := NewTableWriter(os.Stdout)
-	table.SetHeader([]string{"Volume Name", "Size", "Type", "Status"})
+	header := []string{"Volume Name", "Size", "Type", "Redundancy", "Status"}
+	if volumeShowTags {
+		header = append(header, "Tags")
+	}
+	table.SetHeader(header)
 	for _, x := range vols {
-		table.Append([]string{
+		if !torus.MatchTags(tags[torus.VolumeID(x.Id)], filter) {
+			continue
+		}
+		red, err := torus.GetRedundancy(mds, torus.VolumeID(x.Id))
+		if err != nil {
+			die("error getting redundancy of %s: %v\n", x.Name, err)
+		}
+		row := []string{
 			x.Name,
 			bytesOrIbytes(x.MaxBytes, outputAsSI),
 			x.Type,
+			red.String(),
 			mds.GetLockStatus(x.Id),
-		})
+		}
+		if volumeShowTags {
+			row = append(row, torus.FormatTags(tags[torus.VolumeID(x.Id)]))
+		}
+		table.Append(row)
 	}
 	if outputAsCSV {
 		table.RenderCSV()
@@ -85,8 +173,12 @@ func volumeDeleteAction(cmd *cobra.Command, args []string) {
 		die("cannot get volume %s (perhaps it doesn't exist): %v", name, err)
 	}
 	switch vol.Type {
-	case "block":
+	case block.VolumeType:
 		err = block.DeleteBlockVolume(mds, name)
+	case fs.VolumeType:
+		err = fs.DeleteFileVolume(mds, name)
+	case object.VolumeType:
+		err = object.DeleteBucket(mds, name)
 	default:
 		die("unknown volume type %s", vol.Type)
 	}
@@ -105,8 +197,156 @@ func volumeCreateBlockAction(cmd *cobra.Command, args []string) {
 	if err != nil {
 		die("error parsing size %s: %v", args[1], err)
 	}
-	err = block.CreateBlockVolume(mds, args[0], size)
+	red, err := torus.ParseRedundancy(volumeRedundancy)
+	if err != nil {
+		die("%v", err)
+	}
+	if volumeTenant == "" {
+		err = block.CreateBlockVolume(mds, args[0], size)
+	} else {
+		var soft bool
+		soft, err = block.CreateTenantBlockVolume(mds, volumeTenant, args[0], size)
+		if soft {
+			fmt.Fprintf(os.Stderr, "WARNING: tenant %s is over its soft quota\n", volumeTenant)
+		}
+	}
 	if err != nil {
 		die("error creating volume %s: %v", args[0], err)
 	}
+	err = torus.SetInitialRedundancy(mds, args[0], red)
+	if err != nil {
+		if derr := block.DeleteBlockVolume(mds, args[0]); derr != nil {
+			die("couldn't set redundancy of %s: %v; deleting it failed too: %v", args[0], err, derr)
+		}
+		die("couldn't set redundancy of %s: %v", args[0], err)
+	}
+	err = torus.SetInitialPool(mds, args[0], volumePool)
+	if err != nil {
+		if derr := block.DeleteBlockVolume(mds, args[0]); derr != nil {
+			die("couldn't put %s in pool %s: %v; deleting it failed too: %v", args[0], volumePool, err, derr)
+		}
+		die("couldn't put %s in pool %s: %v", args[0], volumePool, err)
+	}
+	if volumeShared {
+		err = block.SetShared(mds, args[0], true)
+		if err != nil {
+			if derr := block.DeleteBlockVolume(mds, args[0]); derr != nil {
+				die("couldn't make %s shared: %v; deleting it failed too: %v", args[0], err, derr)
+			}
+			die("couldn't make %s shared: %v", args[0], err)
+		}
+	}
+}
+
+func volumeCreateFileAction(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	size, err := humanize.ParseBytes(args[1])
+	if err != nil {
+		die("error parsing size %s: %v", args[1], err)
+	}
+	red, err := torus.ParseRedundancy(volumeRedundancy)
+	if err != nil {
+		die("%v", err)
+	}
+	mds := mustConnectToMDS()
+	err = fs.CreateFileVolume(mds, args[0], size)
+	if err != nil {
+		die("error creating volume %s: %v", args[0], err)
+	}
+	err = torus.SetInitialRedundancy(mds, args[0], red)
+	if err != nil {
+		if derr := fs.DeleteFileVolume(mds, args[0]); derr != nil {
+			die("couldn't set redundancy of %s: %v; deleting it failed too: %v", args[0], err, derr)
+		}
+		die("couldn't set redundancy of %s: %v", args[0], err)
+	}
+	err = torus.SetInitialPool(mds, args[0], volumePool)
+	if err != nil {
+		if derr := fs.DeleteFileVolume(mds, args[0]); derr != nil {
+			die("couldn't put %s in pool %s: %v; deleting it failed too: %v", args[0], volumePool, err, derr)
+		}
+		die("couldn't put %s in pool %s: %v", args[0], volumePool, err)
+	}
+}
+
+func volumeCreateBucketAction(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	red, err := torus.ParseRedundancy(volumeRedundancy)
+	if err != nil {
+		die("%v", err)
+	}
+	mds := mustConnectToMDS()
+	err = object.CreateBucket(mds, args[0])
+	if err != nil {
+		die("error creating volume %s: %v", args[0], err)
+	}
+	err = torus.SetInitialRedundancy(mds, args[0], red)
+	if err != nil {
+		if derr := object.DeleteBucket(mds, args[0]); derr != nil {
+			die("couldn't set redundancy of %s: %v; deleting it failed too: %v", args[0], err, derr)
+		}
+		die("couldn't set redundancy of %s: %v", args[0], err)
+	}
+	err = torus.SetInitialPool(mds, args[0], volumePool)
+	if err != nil {
+		if derr := object.DeleteBucket(mds, args[0]); derr != nil {
+			die("couldn't put %s in pool %s: %v; deleting it failed too: %v", args[0], volumePool, err, derr)
+		}
+		die("couldn't put %s in pool %s: %v", args[0], volumePool, err)
+	}
+}
+
+func volumeCreateAction(cmd *cobra.Command, args []string) {
+	var names []string
+	switch {
+	case volumePrefix == "" && volumeCount == 1 && len(args) == 2:
+		names = []string{args[0]}
+	case volumePrefix != "" && volumeCount > 0 && len(args) == 1:
+		for i := 0; i < volumeCount; i++ {
+			names = append(names, fmt.Sprintf("%s%d", volumePrefix, i))
+		}
+	default:
+		cmd.Usage()
+		os.Exit(1)
+	}
+	sizeArg := args[len(args)-1]
+	size, err := humanize.ParseBytes(sizeArg)
+	if err != nil {
+		die("error parsing size %s: %v", sizeArg, err)
+	}
+	red, err := torus.ParseRedundancy(volumeRedundancy)
+	if err != nil {
+		die("%v", err)
+	}
+	mds := mustConnectToMDS()
+	for len(names) != 0 {
+		n := len(names)
+		if n > block.MaxBatchVolumes {
+			n = block.MaxBatchVolumes
+		}
+		err = block.CreateBlockVolumes(mds, names[:n], size)
+		if err != nil {
+			die("error creating volumes %s to %s: %v", names[0], names[n-1], err)
+		}
+		for _, name := range names[:n] {
+			err = torus.SetInitialRedundancy(mds, name, red)
+			if err != nil {
+				die("couldn't set redundancy of %s: %v", name, err)
+			}
+			err = torus.SetInitialPool(mds, name, volumePool)
+			if err != nil {
+				die("couldn't put %s in pool %s: %v", name, volumePool, err)
+			}
+		}
+		if n > 1 {
+			fmt.Printf("created volumes %s to %s\n", names[0], names[n-1])
+		}
+		names = names[n:]
+	}
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/internal/manifest"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checksumExtentSize string
+	checksumVerify     string
+	checksumFile       bool
+)
+
+var volumeChecksumCommand = &cobra.Command{
+	Use:   "checksum VOLUME [MANIFEST_FILE]",
+	Short: "write or verify a checksum manifest of a volume's contents",
+	Long: `write a manifest of SHA-256 checksums of every extent of block volume
+VOLUME, to MANIFEST_FILE or standard output.
+
+Keep the manifest outside the cluster. Later, --verify checks a volume against
+it and lists the extents that differ, which shows end-to-end whether a restore
+or a mirror copy matches the original. With --file, VOLUME is a local file or
+device instead, such as the output of 'torusctl block dump'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeChecksumAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeChecksumCommand)
+	volumeChecksumCommand.Flags().StringVarP(&checksumExtentSize, "extent-size", "", "4MiB", "size of each checksummed extent")
+	volumeChecksumCommand.Flags().StringVarP(&checksumVerify, "verify", "", "", "check the volume against this manifest instead of writing one")
+	volumeChecksumCommand.Flags().BoolVarP(&checksumFile, "file", "", false, "checksum a local file or device instead of a volume")
+}
+
+func volumeChecksumAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	var want *manifest.Manifest
+	extentSize, err := humanize.ParseBytes(checksumExtentSize)
+	if err != nil {
+		return fmt.Errorf("error parsing extent-size: %v", err)
+	}
+	if checksumVerify != "" {
+		if len(args) != 1 {
+			return torus.ErrUsage
+		}
+		f, err := os.Open(checksumVerify)
+		if err != nil {
+			return fmt.Errorf("couldn't open manifest: %v", err)
+		}
+		want, err = manifest.Read(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't read manifest %s: %v", checksumVerify, err)
+		}
+		extentSize = want.ExtentSize
+	}
+
+	var got *manifest.Manifest
+	if checksumFile {
+		got, err = checksumLocalFile(args[0], extentSize)
+	} else {
+		got, err = checksumVolume(args[0], extentSize)
+	}
+	if err != nil {
+		return err
+	}
+
+	if want == nil {
+		output := io.Writer(os.Stdout)
+		if len(args) == 2 {
+			output, err = getWriterFromArg(args[1])
+			if err != nil {
+				return fmt.Errorf("couldn't open output: %v", err)
+			}
+		}
+		return got.Write(output)
+	}
+	bad, err := want.Mismatches(got)
+	if err != nil {
+		return err
+	}
+	for _, off := range bad {
+		fmt.Printf("extent at offset %d differs\n", off)
+	}
+	if len(bad) != 0 {
+		return fmt.Errorf("%d of %d extents of %s differ from %s", len(bad), len(want.Extents), args[0], checksumVerify)
+	}
+	fmt.Printf("%s matches %s (sha256 %x)\n", args[0], checksumVerify, got.Sum)
+	return nil
+}
+
+// checksumVolume reads a snapshot of the volume, so that writes while it's
+// being read don't leave the manifest describing no single point in time.
+func checksumVolume(name string, extentSize uint64) (*manifest.Manifest, error) {
+	srv := createServer()
+	defer srv.Close()
+	blockvol, err := block.OpenBlockVolume(srv, name)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open block volume %s: %v", name, err)
+	}
+	tempsnap := fmt.Sprintf("temp-checksum-%d", os.Getpid())
+	err = blockvol.SaveSnapshot(tempsnap)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't snapshot: %v", err)
+	}
+	defer func() {
+		err := blockvol.DeleteSnapshot(tempsnap)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't delete snapshot %s: %v\n", tempsnap, err)
+		}
+	}()
+	bf, err := blockvol.OpenSnapshot(tempsnap)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open snapshot: %v", err)
+	}
+	defer bf.Close()
+	return manifest.Compute(name, bf, bf.Size(), extentSize)
+}
+
+func checksumLocalFile(path string, extentSize uint64) (*manifest.Manifest, error) {
+	f, err := getReaderFromArg(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open %s: %v", path, err)
+	}
+	defer f.Close()
+	// Seeking to the end works for block devices as well as files.
+	size, err := f.Seek(0, os.SEEK_END)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Compute(path, f, uint64(size), extentSize)
+}
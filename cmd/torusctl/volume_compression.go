@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var volumeCompressionCommand = &cobra.Command{
+	Use:   "compression NAME [on|off]",
+	Short: "get or set whether a volume is compressed at rest",
+	Long: `get or set whether the blocks of volume NAME are compressed at rest.
+
+With 'on', storage nodes compress each block of the volume they write with
+Zstandard, keeping it raw if that doesn't save at least an eighth of it.
+Blocks already stored are left as they are until rewritten. Reads are not
+affected either way.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeCompressionAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeCompressionCommand)
+}
+
+func volumeCompressionAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	cmds, ok := mds.(torus.CompressionMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support compression")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	if len(args) == 1 {
+		on, err := cmds.GetCompression(vid)
+		if err != nil {
+			return fmt.Errorf("couldn't get compression: %v", err)
+		}
+		if on {
+			fmt.Println("on")
+		} else {
+			fmt.Println("off")
+		}
+		return nil
+	}
+	switch args[1] {
+	case "on":
+		return cmds.SetCompression(vid, true)
+	case "off":
+		return cmds.SetCompression(vid, false)
+	}
+	return torus.ErrUsage
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var volumeConsistencyCommand = &cobra.Command{
+	Use:   "consistency NAME [READ_LEVEL WRITE_LEVEL|default]",
+	Short: "get or set the read and write levels of a volume",
+	Long: `get or set the read and write levels every client uses for volume NAME.
+
+READ_LEVEL is one of the --read-level values, and WRITE_LEVEL one of the
+--write-level values. With 'quorum quorum', a block is written to all of its
+replicas at once and a write returns when most of them have it, and a read
+returns the copy most of them agree on, so that reads always see the latest
+write while a minority of replicas is down or slow. With 'default', clients
+use their own levels. Attached volumes pick up changes within a minute.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeConsistencyAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeConsistencyCommand)
+}
+
+func volumeConsistencyAction(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 || len(args) > 3 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	cmds, ok := mds.(torus.ConsistencyMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support volume consistency")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	switch len(args) {
+	case 1:
+		c, err := cmds.GetConsistency(vid)
+		if err != nil {
+			return fmt.Errorf("couldn't get consistency: %v", err)
+		}
+		if c == nil {
+			fmt.Println("default")
+			return nil
+		}
+		fmt.Printf("read %s, write %s\n", c.Read, c.Write)
+		return nil
+	case 2:
+		if args[1] != "default" {
+			return torus.ErrUsage
+		}
+		return cmds.SetConsistency(vid, nil)
+	}
+	rl, err := torus.ParseReadLevel(args[1])
+	if err != nil {
+		return err
+	}
+	wl, err := torus.ParseWriteLevel(args[2])
+	if err != nil {
+		return err
+	}
+	return cmds.SetConsistency(vid, &torus.Consistency{Read: rl, Write: wl})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	volumeConvertCommand = &cobra.Command{
+		Use:   "convert",
+		Short: "convert volumes between redundancy schemes",
+		Run:   volumeAction,
+	}
+
+	volumeConvertStartCommand = &cobra.Command{
+		Use:   "start NAME REDUNDANCY",
+		Short: "start converting a volume to a new redundancy scheme",
+		Long:  "starts converting volume NAME to REDUNDANCY, either 'ring' or 'rep=N'. Data is moved in the background by the rebalancer. Erasure coding can only be chosen when a volume is created.",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeConvertStartAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeConvertStatusCommand = &cobra.Command{
+		Use:   "status [NAME]",
+		Short: "show the progress of volume conversions",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeConvertStatusAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeConvertAbortCommand = &cobra.Command{
+		Use:   "abort NAME",
+		Short: "abort a running conversion, rolling the volume back to its previous redundancy",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeConvertAbortAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	volumeCommand.AddCommand(volumeConvertCommand)
+	volumeConvertCommand.AddCommand(volumeConvertStartCommand)
+	volumeConvertCommand.AddCommand(volumeConvertStatusCommand)
+	volumeConvertCommand.AddCommand(volumeConvertAbortCommand)
+	volumeConvertStatusCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func volumeConvertStartAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return torus.ErrUsage
+	}
+	to, err := torus.ParseRedundancy(args[1])
+	if err != nil {
+		return err
+	}
+	if to.Kind == torus.ErasureCoded {
+		return fmt.Errorf("volumes can't be converted to erasure coding; use 'ring' or 'rep=N', or create a new volume with --redundancy %s", to)
+	}
+	mds := mustConnectToMDS()
+	r, err := mds.GetRing()
+	if err != nil {
+		return fmt.Errorf("couldn't get ring: %v", err)
+	}
+	if n := len(r.Members()); to.Width(0) > n {
+		fmt.Fprintf(os.Stderr, "warning: %s needs %d peers, but the ring only has %d\n", to, to.Width(0), n)
+	}
+	c, err := torus.StartConversion(mds, args[0], to)
+	switch err {
+	case nil:
+	case torus.ErrExists:
+		return fmt.Errorf("volume %s is already being converted", args[0])
+	case torus.ErrInvalid:
+		return fmt.Errorf("volume %s already uses %s", args[0], to)
+	default:
+		return fmt.Errorf("couldn't start conversion of %s: %v", args[0], err)
+	}
+	fmt.Printf("converting %s from %s to %s\n", c.Volume, c.From, c.To)
+	return nil
+}
+
+func volumeConvertStatusAction(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	cmds, ok := mds.(torus.ConversionMetadataService)
+	if !ok {
+		return torus.ErrNotSupported
+	}
+	r, err := mds.GetRing()
+	if err != nil {
+		return fmt.Errorf("couldn't get ring: %v", err)
+	}
+	members := r.Members()
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		return fmt.Errorf("couldn't list volumes: %v", err)
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Volume", "From", "To", "State", "Peers Done", "Blocks Sent", "Started"})
+	for _, v := range vols {
+		if len(args) == 1 && v.Name != args[0] {
+			continue
+		}
+		c, err := cmds.GetConversion(torus.VolumeID(v.Id))
+		if err == torus.ErrNotExist {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get conversion for %s: %v", v.Name, err)
+		}
+		var sent uint64
+		for _, p := range members {
+			sent += c.Progress[p].Sent
+		}
+		table.Append([]string{
+			v.Name,
+			c.From.String(),
+			c.To.String(),
+			string(c.State),
+			fmt.Sprintf("%d/%d", c.PeersDone(members), len(members)),
+			fmt.Sprint(sent),
+			time.Unix(0, c.Started).Format(time.RFC3339),
+		})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
+
+func volumeConvertAbortAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	c, err := torus.AbortConversion(mds, args[0])
+	if err == torus.ErrNotExist {
+		return fmt.Errorf("volume %s has no running conversion", args[0])
+	} else if err != nil {
+		return fmt.Errorf("couldn't abort conversion of %s: %v", args[0], err)
+	}
+	fmt.Printf("aborted conversion of %s; rolling back to %s\n", c.Volume, c.From)
+	return nil
+}
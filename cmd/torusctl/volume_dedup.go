@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/spf13/cobra"
+)
+
+var volumeDedupCommand = &cobra.Command{
+	Use:   "dedup NAME [on|off]",
+	Short: "get or set whether a block volume stores identical blocks once",
+	Long: `get or set whether block volume NAME stores blocks with the same contents
+once.
+
+With 'on', a block written with the same contents as another block of the
+volume shares the stored block instead of being stored again. Blocks written
+before are read and shared in the background the next time the volume is
+attached. Run 'torusctl dedup analyze' first to see what it would save.
+Erasure-coded volumes can't be deduplicated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeDedupAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeDedupCommand)
+}
+
+func volumeDedupAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	dmds, ok := mds.(torus.DedupMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support dedup")
+	}
+	if len(args) == 1 {
+		vol, err := mds.GetVolume(args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+		}
+		on, err := dmds.GetDedup(torus.VolumeID(vol.Id))
+		if err != nil {
+			return fmt.Errorf("couldn't get dedup: %v", err)
+		}
+		if on {
+			fmt.Println("on")
+		} else {
+			fmt.Println("off")
+		}
+		return nil
+	}
+	var on bool
+	switch args[1] {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return torus.ErrUsage
+	}
+	err := block.SetDedup(mds, args[0], on)
+	if err != nil {
+		return fmt.Errorf("couldn't set dedup of %s: %v", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var volumeResizeForce bool
+
+var (
+	volumeRenameCommand = &cobra.Command{
+		Use:   "rename NAME NEW_NAME",
+		Short: "rename a volume",
+		Long: `rename volume NAME to NEW_NAME.
+
+Clients that have the volume attached or mounted keep using it; from then on,
+it's attached by its new name.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeRenameAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeResizeCommand = &cobra.Command{
+		Use:   "resize NAME SIZE",
+		Short: "change the size of a volume",
+		Long: `change the size of volume NAME to SIZE bytes (G,GiB,M,MiB,etc suffixes
+accepted).
+
+A block volume that is attached keeps its old size until it's attached again;
+grow the filesystem on it after that. Shrinking a block volume drops whatever
+is stored past its new end, so it needs --force. The size of a bucket is a
+quota on its objects, which a size of 0 lifts. Growing a volume counts
+against the cluster's capacity reserve and, if it belongs to a tenant, the
+tenant's quota.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeResizeAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeTagCommand = &cobra.Command{
+		Use:   "tag NAME [KEY=VALUE...]",
+		Short: "show or set the tags of a volume",
+		Long: `show the tags of volume NAME, or set the given ones, such as owner=alice or
+env=prod. Tags keep track of what volumes are for; 'torusctl volume list
+--tag' lists the volumes with given tags.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeTagAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeUntagCommand = &cobra.Command{
+		Use:   "untag NAME KEY...",
+		Short: "remove tags from a volume",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeUntagAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	volumeCommand.AddCommand(volumeRenameCommand)
+	volumeCommand.AddCommand(volumeResizeCommand)
+	volumeCommand.AddCommand(volumeTagCommand)
+	volumeCommand.AddCommand(volumeUntagCommand)
+	volumeResizeCommand.Flags().BoolVarP(&volumeResizeForce, "force", "", false, "shrink the volume, dropping what's stored past its new end")
+}
+
+func volumeRenameAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	err := torus.RenameVolume(mds, args[0], args[1])
+	switch err {
+	case nil:
+		return nil
+	case torus.ErrExists:
+		return fmt.Errorf("there's already a volume named %s", args[1])
+	case torus.ErrNotSupported:
+		return fmt.Errorf("metadata service doesn't support renaming volumes")
+	default:
+		return fmt.Errorf("couldn't rename volume %s: %v", args[0], err)
+	}
+}
+
+func volumeResizeAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return torus.ErrUsage
+	}
+	size, err := humanize.ParseBytes(args[1])
+	if err != nil {
+		return fmt.Errorf("error parsing size %s: %v", args[1], err)
+	}
+	mds := mustConnectToMDS()
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	if vol.Type == block.VolumeType && size < vol.MaxBytes && !volumeResizeForce {
+		return fmt.Errorf("shrinking %s from %s to %s drops what's stored past its new end; use --force to do it anyway",
+			args[0], humanize.IBytes(vol.MaxBytes), humanize.IBytes(size))
+	}
+	soft, err := torus.ResizeVolume(mds, args[0], size)
+	if soft {
+		fmt.Fprintf(os.Stderr, "WARNING: the tenant of %s is over its soft quota\n", args[0])
+	}
+	switch err {
+	case nil:
+		return nil
+	case torus.ErrNotSupported:
+		return fmt.Errorf("metadata service doesn't support resizing volumes")
+	case torus.ErrVolumeQuota:
+		return fmt.Errorf("%s would be over its quota; see 'torusctl volume quota'", args[0])
+	case torus.ErrCapacityReserved:
+		return fmt.Errorf("growing %s would eat into the cluster's capacity reserve; see 'torusctl capacity'", args[0])
+	default:
+		return fmt.Errorf("couldn't resize volume %s: %v", args[0], err)
+	}
+}
+
+func volumeTagAction(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	tmds, ok := mds.(torus.TagMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support volume tags")
+	}
+	if len(args) > 1 {
+		tags, err := torus.ParseTags(args[1:], false)
+		if err != nil {
+			return err
+		}
+		return torus.SetVolumeTags(mds, args[0], tags)
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	all, err := tmds.GetVolumeTags()
+	if err != nil {
+		return fmt.Errorf("couldn't get tags: %v", err)
+	}
+	tags := all[torus.VolumeID(vol.Id)]
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Key", "Value"})
+	for _, k := range keys {
+		table.Append([]string{k, tags[k]})
+	}
+	table.Render()
+	return nil
+}
+
+func volumeUntagAction(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return torus.ErrUsage
+	}
+	tags, err := torus.ParseTags(args[1:], true)
+	if err != nil {
+		return err
+	}
+	for k := range tags {
+		tags[k] = ""
+	}
+	return torus.SetVolumeTags(mustConnectToMDS(), args[0], tags)
+}
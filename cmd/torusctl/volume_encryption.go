@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/flagconfig"
+	"github.com/spf13/cobra"
+)
+
+var volumeEncryptionCommand = &cobra.Command{
+	Use:   "encryption NAME [enable|rotate-key]",
+	Short: "show or manage a volume's encryption at rest",
+	Long: `show or manage the encryption at rest of volume NAME.
+
+'enable' gives the volume a data encryption key; blocks written from then on
+are encrypted with AES-256-GCM, and blocks written before are encrypted as
+they are read. 'rotate-key' gives an encrypted volume a new key in the same
+way. Both need --encryption-key-file, the key every storage node uses to
+unwrap volume keys. Without an argument, shows the current key version.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeEncryptionAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeEncryptionCommand)
+}
+
+func volumeEncryptionAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	emds, ok := mds.(torus.EncryptionMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support encryption")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vk, err := emds.GetVolumeKeys(torus.VolumeID(vol.Id))
+	if err != nil && err != torus.ErrNotExist {
+		return fmt.Errorf("couldn't get keys of %s: %v", args[0], err)
+	}
+	if len(args) == 1 {
+		if vk == nil {
+			fmt.Println("off")
+		} else {
+			fmt.Printf("on, key version %d\n", vk.Current)
+		}
+		return nil
+	}
+	switch args[1] {
+	case "enable":
+		if vk != nil {
+			return fmt.Errorf("volume %s is already encrypted", args[0])
+		}
+	case "rotate-key":
+		if vk == nil {
+			return fmt.Errorf("volume %s isn't encrypted", args[0])
+		}
+	default:
+		return torus.ErrUsage
+	}
+	kek := flagconfig.BuildConfigFromFlags().EncryptionKey
+	if len(kek) == 0 {
+		return fmt.Errorf("--encryption-key-file is required")
+	}
+	v, err := torus.RotateVolumeKey(mds, kek, args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't set key of %s: %v", args[0], err)
+	}
+	fmt.Printf("%s now uses key version %d\n", args[0], v)
+	return nil
+}
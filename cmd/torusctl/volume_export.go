@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/internal/qcow2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportIncremental string
+	exportSnapshot    string
+	exportFormat      string
+	exportParallel    int
+)
+
+var volumeExportCommand = &cobra.Command{
+	Use:   "export VOLUME OUTPUT_FILE",
+	Short: "export the blocks of a volume, or only those changed since a snapshot",
+	Long: `writes every block of VOLUME to OUTPUT_FILE ("-" for stdout), or with
+--incremental, only the blocks that changed since the given snapshot. The
+export is taken from the snapshot named by --snapshot, or from a temporary
+snapshot of the volume as it is now.
+
+Apply exports to an image of the volume with "torusctl volume apply-export",
+a full one first and then each incremental one in order.
+
+With --format raw or qcow2, OUTPUT_FILE is instead a disk image of the whole
+volume, which is left sparse where the volume has no data.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeExportAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+var volumeApplyExportCommand = &cobra.Command{
+	Use:   "apply-export EXPORT_FILE IMAGE_FILE",
+	Short: "write the blocks of an export into a local image of the volume",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeApplyExportAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeExportCommand)
+	volumeCommand.AddCommand(volumeApplyExportCommand)
+	volumeExportCommand.Flags().StringVarP(&exportIncremental, "incremental", "", "", "only export the blocks changed since this snapshot")
+	volumeExportCommand.Flags().StringVarP(&exportSnapshot, "snapshot", "", "", "export the volume as of this snapshot instead of now")
+	volumeExportCommand.Flags().StringVarP(&exportFormat, "format", "", "torus", "format of the output: 'torus', 'raw' or 'qcow2'")
+	volumeExportCommand.Flags().IntVarP(&exportParallel, "parallel", "", 32, "number of blocks to fetch from peers at once for raw and qcow2 exports")
+}
+
+func volumeExportAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return torus.ErrUsage
+	}
+	switch exportFormat {
+	case "torus":
+	case "raw", "qcow2":
+		if exportIncremental != "" {
+			return fmt.Errorf("--incremental only works with --format torus")
+		}
+		if args[1] == "-" {
+			return fmt.Errorf("%s images have to be written to a file", exportFormat)
+		}
+	default:
+		return fmt.Errorf("unknown format %q; use 'torus', 'raw' or 'qcow2'", exportFormat)
+	}
+	output, err := getWriterFromArg(args[1])
+	if err != nil {
+		return fmt.Errorf("couldn't open output: %v", err)
+	}
+	srv := createServer()
+	defer srv.Close()
+	blockvol, err := block.OpenBlockVolume(srv, args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't open block volume %s: %v", args[0], err)
+	}
+	to := exportSnapshot
+	if to == "" {
+		to = fmt.Sprintf("temp-export-%d", os.Getpid())
+		err = blockvol.SaveSnapshot(to)
+		if err != nil {
+			return fmt.Errorf("couldn't snapshot: %v", err)
+		}
+		defer func() {
+			if err := blockvol.DeleteSnapshot(to); err != nil {
+				fmt.Fprintf(os.Stderr, "couldn't delete snapshot %s: %v\n", to, err)
+			}
+		}()
+	}
+	var n int
+	if exportFormat == "torus" {
+		n, err = blockvol.Export(output, exportIncremental, to)
+	} else {
+		n, err = exportImage(blockvol, output.(*os.File), to)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't export: %v", err)
+	}
+	if c, ok := output.(*os.File); ok && c != os.Stdout {
+		err = c.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't write %s: %v", args[1], err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d blocks\n", n)
+	return nil
+}
+
+func volumeApplyExportAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return torus.ErrUsage
+	}
+	input := os.Stdin
+	if args[0] != "-" {
+		var err error
+		input, err = getReaderFromArg(args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't open export: %v", err)
+		}
+		defer input.Close()
+	}
+	image, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't open image: %v", err)
+	}
+	hdr, n, err := block.ApplyExport(image, input)
+	if err != nil {
+		image.Close()
+		return fmt.Errorf("couldn't apply export: %v", err)
+	}
+	err = image.Truncate(int64(hdr.VolumeSize))
+	if err == nil {
+		err = image.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write image: %v", err)
+	}
+	if hdr.From == "" {
+		fmt.Printf("applied %d blocks of a full export of snapshot %s\n", n, hdr.To)
+	} else {
+		fmt.Printf("applied %d blocks changed from snapshot %s to %s\n", n, hdr.From, hdr.To)
+	}
+	return nil
+}
+
+func exportImage(blockvol *block.BlockVolume, out *os.File, snapshot string) (int, error) {
+	size, err := snapshotSize(blockvol, snapshot)
+	if err != nil {
+		return 0, err
+	}
+	if exportFormat == "raw" {
+		n, err := blockvol.ExportImage(out, snapshot, exportParallel)
+		if err != nil {
+			return n, err
+		}
+		return n, out.Truncate(int64(size))
+	}
+	w, err := qcow2.NewWriter(out, size)
+	if err != nil {
+		return 0, err
+	}
+	n, err := blockvol.ExportImage(w, snapshot, exportParallel)
+	if err != nil {
+		return n, err
+	}
+	return n, w.Close()
+}
+
+func snapshotSize(blockvol *block.BlockVolume, snapshot string) (uint64, error) {
+	f, err := blockvol.OpenSnapshot(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	defer f.File.Close()
+	return f.Size(), nil
+}
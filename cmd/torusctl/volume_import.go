@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/internal/qcow2"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat   string
+	importParallel int
+)
+
+var volumeImportCommand = &cobra.Command{
+	Use:   "import IMAGE_FILE VOLUME [SIZE]",
+	Short: "create a block volume from a raw or qcow2 disk image",
+	Long: `creates VOLUME with the contents of the disk image IMAGE_FILE, which is
+as big as the image's virtual disk unless SIZE is given. Parts of the image
+that are unallocated or all zeros aren't written.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeImportAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeImportCommand)
+	volumeImportCommand.Flags().StringVarP(&importFormat, "format", "", "auto", "format of the image: 'auto', 'raw' or 'qcow2'")
+	volumeImportCommand.Flags().IntVarP(&importParallel, "parallel", "", 8, "number of blocks of the image to read at once")
+}
+
+func volumeImportAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return torus.ErrUsage
+	}
+	input, err := getReaderFromArg(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't open image: %v", err)
+	}
+	defer input.Close()
+	src, size, err := openImage(input)
+	if err != nil {
+		return err
+	}
+	volSize := size
+	if len(args) == 3 {
+		volSize, err = humanize.ParseBytes(args[2])
+		if err != nil {
+			return fmt.Errorf("error parsing size %s: %v", args[2], err)
+		}
+		if volSize < size {
+			return fmt.Errorf("size must be at least that of the image, %d bytes", size)
+		}
+	}
+
+	srv := createServer()
+	defer srv.Close()
+	err = block.CreateBlockVolume(srv.MDS, args[1], volSize)
+	if err != nil {
+		return fmt.Errorf("couldn't create block volume %s: %v", args[1], err)
+	}
+	blockvol, err := block.OpenBlockVolume(srv, args[1])
+	if err != nil {
+		return fmt.Errorf("couldn't open block volume %s: %v", args[1], err)
+	}
+	f, err := blockvol.OpenBlockFile()
+	if err != nil {
+		return fmt.Errorf("couldn't open blockfile %s: %v", args[1], err)
+	}
+	n, err := f.ImportImage(src, size, importParallel)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("couldn't import: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("couldn't sync: %v", err)
+	}
+	fmt.Printf("imported %d bytes, writing %d blocks\n", size, n)
+	return nil
+}
+
+// openImage returns a reader of the virtual disk in the image file, and its
+// size.
+func openImage(input *os.File) (io.ReaderAt, uint64, error) {
+	format := importFormat
+	if format == "auto" {
+		format = "raw"
+		if qcow2.IsQcow2(input) {
+			format = "qcow2"
+		}
+	}
+	switch format {
+	case "raw":
+		fi, err := input.Stat()
+		if err != nil {
+			return nil, 0, fmt.Errorf("couldn't stat image: %v", err)
+		}
+		return input, uint64(fi.Size()), nil
+	case "qcow2":
+		img, err := qcow2.Open(input)
+		if err != nil {
+			return nil, 0, err
+		}
+		return img, img.Size(), nil
+	}
+	return nil, 0, fmt.Errorf("unknown format %q; use 'auto', 'raw' or 'qcow2'", importFormat)
+}
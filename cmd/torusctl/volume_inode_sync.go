@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var volumeINodeSyncCommand = &cobra.Command{
+	Use:   "inode-sync NAME [sync|write|writes=N|interval=DURATION]",
+	Short: "get or set when a volume's block map is saved",
+	Long: `get or set the inode sync policy of volume NAME, which decides when the map
+of the volume's blocks is written to etcd.
+
+With 'sync', the default, it is written only when the volume is synced, such
+as when the filesystem on it flushes, or detached. With 'write' it is written
+after every write, with 'writes=N' after every N writes, and with
+'interval=DURATION' at most DURATION after a write. The more often it is
+written, the more load on etcd, but the fewer writes a crashed client can
+lose.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeINodeSyncAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeINodeSyncCommand)
+}
+
+func volumeINodeSyncAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	imds, ok := mds.(torus.INodeSyncMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support inode sync policies")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	if len(args) == 1 {
+		p, err := imds.GetINodeSync(vid)
+		if err != nil {
+			return fmt.Errorf("couldn't get inode sync policy: %v", err)
+		}
+		fmt.Println(p)
+		return nil
+	}
+	p, err := torus.ParseINodeSyncPolicy(args[1])
+	if err != nil {
+		return err
+	}
+	return imds.SetINodeSync(vid, p)
+}
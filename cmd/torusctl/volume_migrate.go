@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migratePeers       []string
+	migrateRingType    string
+	migrateReplication int
+	migrateToCluster   bool
+	migrateToPool      string
+)
+
+var (
+	volumeMigrateCommand = &cobra.Command{
+		Use:   "migrate",
+		Short: "move volumes to other rings while they're in use",
+		Run:   volumeAction,
+	}
+
+	volumeMigrateStartCommand = &cobra.Command{
+		Use:   "start NAME",
+		Short: "start moving a volume to a ring of the given peers, a storage pool, or back to the cluster's ring",
+		Long: `starts moving volume NAME to a ring of the peers given with --peers, into
+the storage pool given with --pool, or back to the cluster's ring with
+--cluster, while it stays attached.
+
+Until the migration ends, the volume's blocks are placed by both its current
+ring and the new one: writes go to the replicas of both, and the rebalancer
+copies every block to its new replicas. Once every peer has finished a pass,
+the new ring takes over, and the copies only the old ring wanted are cleaned
+up. 'migrate status' shows how far it has got.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeMigrateStartAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeMigrateStatusCommand = &cobra.Command{
+		Use:   "status [NAME]",
+		Short: "show the progress of volume migrations",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeMigrateStatusAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeMigrateAbortCommand = &cobra.Command{
+		Use:   "abort NAME",
+		Short: "abort a running migration, moving the volume back to its previous ring",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeMigrateAbortAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	volumeCommand.AddCommand(volumeMigrateCommand)
+	volumeMigrateCommand.AddCommand(volumeMigrateStartCommand)
+	volumeMigrateCommand.AddCommand(volumeMigrateStatusCommand)
+	volumeMigrateCommand.AddCommand(volumeMigrateAbortCommand)
+	volumeMigrateStartCommand.Flags().StringSliceVar(&migratePeers, "peers", nil, "addresses or UUIDs of the peers of the volume's new ring")
+	volumeMigrateStartCommand.Flags().StringVar(&migrateRingType, "type", "ketama", "type of the volume's new ring")
+	volumeMigrateStartCommand.Flags().IntVarP(&migrateReplication, "replication", "r", 0, "number of replicas in the volume's new ring (default: as in the cluster's ring)")
+	volumeMigrateStartCommand.Flags().BoolVar(&migrateToCluster, "cluster", false, "move the volume back to the cluster's ring")
+	volumeMigrateStartCommand.Flags().StringVar(&migrateToPool, "pool", "", "move the volume into this storage pool")
+	volumeMigrateStatusCommand.Flags().BoolVarP(&outputAsCSV, "csv", "", false, "output as csv instead")
+}
+
+func volumeMigrateStartAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	targets := 0
+	for _, set := range []bool{len(migratePeers) != 0, migrateToCluster, migrateToPool != ""} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("need one of --peers, --pool or --cluster")
+	}
+	mds := mustConnectToMDS()
+	var m *torus.Migration
+	var err error
+	switch {
+	case migrateToPool != "":
+		m, err = torus.StartPoolMigration(mds, args[0], migrateToPool)
+	case migrateToCluster:
+		m, err = torus.StartMigration(mds, args[0], nil)
+	default:
+		var to torus.Ring
+		to, err = makeRing(mds, migrateRingType, migrateReplication, migratePeers)
+		if err != nil {
+			return err
+		}
+		m, err = torus.StartMigration(mds, args[0], to)
+	}
+	switch err {
+	case nil:
+	case torus.ErrExists:
+		return fmt.Errorf("volume %s is already being migrated", args[0])
+	case torus.ErrInvalid:
+		return fmt.Errorf("volume %s is already on that ring", args[0])
+	default:
+		return fmt.Errorf("couldn't start migration of %s: %v", args[0], err)
+	}
+	fmt.Printf("migrating %s from %s to %s\n", m.Volume, describeVolumeRing(m.From, m.FromPool), describeVolumeRing(m.To, m.ToPool))
+	return nil
+}
+
+// makeRing makes a ring of type typ over the healthy peers given by address
+// or UUID, for a volume or pool. A replication of 0 is the cluster's.
+func makeRing(mds torus.MetadataService, typ string, rep int, peerArgs []string) (torus.Ring, error) {
+	t, ok := ring.RingTypeFromString(typ)
+	if !ok || t == ring.Union || t == ring.Empty {
+		return nil, fmt.Errorf("the ring can't be of type %s; use one of %s", typ, strings.Join(ring.RingNames(), ", "))
+	}
+	if rep == 0 {
+		cluster, err := mds.GetRing()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get ring: %v", err)
+		}
+		perm, err := cluster.GetPeers(torus.BlockRef{})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't work out the cluster's replication: %v", err)
+		}
+		rep = perm.Replication
+	}
+	if rep > len(peerArgs) {
+		return nil, fmt.Errorf("replication %d needs at least as many peers, but only %d were given", rep, len(peerArgs))
+	}
+	pil, err := resolvePeers(mds, peerArgs)
+	if err != nil {
+		return nil, err
+	}
+	return ring.CreateRing(&models.Ring{
+		Type:              uint32(t),
+		Version:           1,
+		ReplicationFactor: uint32(rep),
+		Peers:             pil,
+	})
+}
+
+// resolvePeers returns the healthy peers given by address or UUID, as ring
+// members.
+func resolvePeers(mds torus.MetadataService, args []string) (torus.PeerInfoList, error) {
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get peers: %v", err)
+	}
+	var pil torus.PeerInfoList
+	for _, arg := range args {
+		var found *models.PeerInfo
+		for _, p := range peers {
+			if p.Address != "" && (p.Address == arg || p.UUID == arg) {
+				found = p
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("peer %s isn't currently healthy", arg)
+		}
+		pil = pil.Union(torus.PeerInfoList{&models.PeerInfo{
+			UUID:        found.UUID,
+			TotalBlocks: found.TotalBlocks,
+			Zone:        found.Zone,
+		}})
+	}
+	return pil, nil
+}
+
+// describeVolumeRing describes one side of a migration, a pool or a
+// marshalled ring, in a few words.
+func describeVolumeRing(b []byte, pool string) string {
+	if pool != "" {
+		return "pool " + pool
+	}
+	if len(b) == 0 {
+		return "cluster ring"
+	}
+	r, err := ring.Unmarshal(b)
+	if err != nil {
+		return "unknown ring"
+	}
+	return describeRing(r)
+}
+
+// describeRing describes a ring in a few words.
+func describeRing(r torus.Ring) string {
+	rep := 0
+	if perm, err := r.GetPeers(torus.BlockRef{}); err == nil {
+		rep = perm.Replication
+	}
+	typ := "unknown"
+	for _, name := range ring.RingNames() {
+		if t, _ := ring.RingTypeFromString(name); t == r.Type() {
+			typ = name
+		}
+	}
+	return fmt.Sprintf("%s ring of %d peers, rep=%d", typ, len(r.Members()), rep)
+}
+
+func volumeMigrateStatusAction(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	mmds, ok := mds.(torus.MigrationMetadataService)
+	if !ok {
+		return torus.ErrNotSupported
+	}
+	r, err := mds.GetRing()
+	if err != nil {
+		return fmt.Errorf("couldn't get ring: %v", err)
+	}
+	cluster := r.Members()
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		return fmt.Errorf("couldn't list volumes: %v", err)
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Volume", "From", "To", "State", "Peers Done", "Blocks Sent", "Started"})
+	for _, v := range vols {
+		if len(args) == 1 && v.Name != args[0] {
+			continue
+		}
+		m, err := mmds.GetMigration(torus.VolumeID(v.Id))
+		if err == torus.ErrNotExist {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get migration for %s: %v", v.Name, err)
+		}
+		members := migrationMembers(mds, cluster, m)
+		var sent uint64
+		for _, p := range members {
+			sent += m.Progress[p].Sent
+		}
+		table.Append([]string{
+			v.Name,
+			describeVolumeRing(m.From, m.FromPool),
+			describeVolumeRing(m.To, m.ToPool),
+			string(m.State),
+			fmt.Sprintf("%d/%d", m.PeersDone(members), len(members)),
+			fmt.Sprint(sent),
+			time.Unix(0, m.Started).Format(time.RFC3339),
+		})
+	}
+	if outputAsCSV {
+		table.RenderCSV()
+		return nil
+	}
+	table.Render()
+	return nil
+}
+
+// migrationMembers returns the peers that report on a migration: those of
+// the cluster's ring and of both the migration's rings.
+func migrationMembers(mds torus.MetadataService, cluster torus.PeerList, m *torus.Migration) torus.PeerList {
+	out := cluster
+	sides := []struct {
+		b    []byte
+		pool string
+	}{{m.From, m.FromPool}, {m.To, m.ToPool}}
+	for _, side := range sides {
+		var r torus.Ring
+		var err error
+		if side.pool != "" {
+			if pmds, ok := mds.(torus.PoolMetadataService); ok {
+				r, err = pmds.GetPool(side.pool)
+			}
+		} else if len(side.b) != 0 {
+			r, err = ring.Unmarshal(side.b)
+		}
+		if err == nil && r != nil {
+			out = out.Union(r.Members())
+		}
+	}
+	return out
+}
+
+func volumeMigrateAbortAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	m, err := torus.AbortMigration(mds, args[0])
+	if err == torus.ErrNotExist {
+		return fmt.Errorf("volume %s has no running migration", args[0])
+	} else if err != nil {
+		return fmt.Errorf("couldn't abort migration of %s: %v", args[0], err)
+	}
+	fmt.Printf("aborted migration of %s; moving it back to the %s\n", m.Volume, describeVolumeRing(m.From, m.FromPool))
+	return nil
+}
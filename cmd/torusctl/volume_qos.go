@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	qosIOPS      uint64
+	qosBandwidth string
+)
+
+var (
+	volumeQoSCommand = &cobra.Command{
+		Use:   "qos",
+		Short: "show or set the I/O limits of a volume",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+			os.Exit(1)
+		},
+	}
+
+	volumeQoSShowCommand = &cobra.Command{
+		Use:   "show NAME",
+		Short: "show the I/O limits of a volume",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeQoSShowAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+
+	volumeQoSSetCommand = &cobra.Command{
+		Use:   "set NAME",
+		Short: "set the I/O limits of a volume",
+		Long: `set how many block reads and writes per second (--iops), and how many bytes
+of blocks per second (--bw, with G,GiB,M,MiB,etc suffixes), each client that
+has volume NAME attached or mounted may do. A limit of 0 lifts it; limits
+that aren't given are left as they are.
+
+Clients pick up changes within 30 seconds.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := volumeQoSSetAction(cmd, args)
+			if err == torus.ErrUsage {
+				cmd.Usage()
+				os.Exit(1)
+			} else if err != nil {
+				die("%v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	volumeCommand.AddCommand(volumeQoSCommand)
+	volumeQoSCommand.AddCommand(volumeQoSShowCommand)
+	volumeQoSCommand.AddCommand(volumeQoSSetCommand)
+	volumeQoSSetCommand.Flags().Uint64VarP(&qosIOPS, "iops", "", 0, "most block reads and writes per second")
+	volumeQoSSetCommand.Flags().StringVarP(&qosBandwidth, "bw", "", "", "most bytes of blocks read and written per second")
+}
+
+func mustConnectToQoSMDS(name string) (torus.QoSMetadataService, torus.VolumeID) {
+	mds := mustConnectToMDS()
+	qmds, ok := mds.(torus.QoSMetadataService)
+	if !ok {
+		die("metadata service doesn't support QoS limits")
+	}
+	vol, err := mds.GetVolume(name)
+	if err != nil {
+		die("couldn't get volume %s: %v", name, err)
+	}
+	return qmds, torus.VolumeID(vol.Id)
+}
+
+func volumeQoSShowAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	qmds, vid := mustConnectToQoSMDS(args[0])
+	q, err := qmds.GetQoS(vid)
+	if err != nil {
+		return fmt.Errorf("couldn't get QoS limits: %v", err)
+	}
+	iops, bw := "unlimited", "unlimited"
+	if q.IOPS != 0 {
+		iops = fmt.Sprint(q.IOPS)
+	}
+	if q.Bandwidth != 0 {
+		bw = humanize.IBytes(q.Bandwidth) + "/s"
+	}
+	fmt.Printf("IOPS:      %s\n", iops)
+	fmt.Printf("Bandwidth: %s\n", bw)
+	return nil
+}
+
+func volumeQoSSetAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return torus.ErrUsage
+	}
+	iopsSet, bwSet := cmd.Flags().Changed("iops"), cmd.Flags().Changed("bw")
+	if !iopsSet && !bwSet {
+		return torus.ErrUsage
+	}
+	qmds, vid := mustConnectToQoSMDS(args[0])
+	q, err := qmds.GetQoS(vid)
+	if err != nil {
+		return fmt.Errorf("couldn't get QoS limits: %v", err)
+	}
+	if iopsSet {
+		q.IOPS = qosIOPS
+	}
+	if bwSet {
+		q.Bandwidth, err = humanize.ParseBytes(qosBandwidth)
+		if err != nil {
+			return fmt.Errorf("error parsing bandwidth %s: %v", qosBandwidth, err)
+		}
+	}
+	return qmds.SetQoS(vid, q)
+}
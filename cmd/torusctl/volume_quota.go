@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var volumeQuotaCommand = &cobra.Command{
+	Use:   "quota NAME [SIZE|none]",
+	Short: "get or set the quota on a volume's size",
+	Long: `get or set the largest size volume NAME can be resized to. A volume without a
+quota of its own gets the default one, set with 'torusctl capacity
+volume-quota'; 'none' removes the volume's own quota.
+
+A quota doesn't shrink a volume that is already larger; it only stops it
+from growing.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeQuotaAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeQuotaCommand)
+}
+
+func volumeQuotaAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	qmds, ok := mds.(torus.VolumeQuotaMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support volume quotas")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	if len(args) == 1 {
+		q, err := qmds.GetVolumeQuota(vid)
+		if err != nil {
+			return fmt.Errorf("couldn't get quota: %v", err)
+		}
+		if q != 0 {
+			fmt.Println(describeVolumeQuota(q))
+			return nil
+		}
+		q, err = qmds.GetDefaultVolumeQuota()
+		if err != nil {
+			return fmt.Errorf("couldn't get default quota: %v", err)
+		}
+		fmt.Println(describeVolumeQuota(q) + " (default)")
+		return nil
+	}
+	q, err := parseVolumeQuota(args[1])
+	if err != nil {
+		return err
+	}
+	return qmds.SetVolumeQuota(vid, q)
+}
+
+func parseVolumeQuota(s string) (uint64, error) {
+	if s == "none" {
+		return 0, nil
+	}
+	q, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quota %q: %v", s, err)
+	}
+	if q == 0 {
+		return 0, fmt.Errorf("a quota of 0 would stop the volume holding anything; use 'none' to remove it")
+	}
+	return q, nil
+}
+
+func describeVolumeQuota(q uint64) string {
+	if q == 0 {
+		return "none"
+	}
+	return humanize.IBytes(q)
+}
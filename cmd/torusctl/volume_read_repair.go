@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var volumeReadRepairCommand = &cobra.Command{
+	Use:   "read-repair NAME [off|sampled|always]",
+	Short: "get or set a volume's read repair policy",
+	Long: `get or set the read repair policy of volume NAME.
+
+With 'always', every read that misses the read cache fetches the block from all
+of its replicas and rewrites any copy that is missing or disagrees with the
+rest. With 'sampled', one read in a hundred is checked this way. With 'off',
+the default, reads are served by the first replica that answers.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeReadRepairAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeReadRepairCommand)
+}
+
+func volumeReadRepairAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	rmds, ok := mds.(torus.ReadRepairMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support read repair policies")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	if len(args) == 1 {
+		p, err := rmds.GetReadRepair(vid)
+		if err != nil {
+			return fmt.Errorf("couldn't get read repair policy: %v", err)
+		}
+		fmt.Println(p)
+		return nil
+	}
+	p, err := torus.ParseReadRepairPolicy(args[1])
+	if err != nil {
+		return err
+	}
+	return rmds.SetReadRepair(vid, p)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var volumeReadaheadCommand = &cobra.Command{
+	Use:   "readahead NAME [SIZE]",
+	Short: "get or set how far ahead of sequential reads of a volume to fetch",
+	Long: `get or set the readahead window of volume NAME.
+
+Once a client has read a few blocks of the volume in order, it fetches the
+next SIZE of it from the peers holding it in the background, into its read
+cache, so that streaming reads aren't held up waiting on one block at a
+time. The window should fit comfortably in the client's --read-cache-size.
+0, the default, turns readahead off. Attached volumes pick up changes within
+a minute.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeReadaheadAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeReadaheadCommand)
+}
+
+func volumeReadaheadAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	rmds, ok := mds.(torus.ReadaheadMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support readahead")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	if len(args) == 1 {
+		bytes, err := rmds.GetReadahead(vid)
+		if err != nil {
+			return fmt.Errorf("couldn't get readahead: %v", err)
+		}
+		fmt.Println(humanize.IBytes(bytes))
+		return nil
+	}
+	bytes, err := humanize.ParseBytes(args[1])
+	if err != nil {
+		return fmt.Errorf("error parsing size %s: %v", args[1], err)
+	}
+	return rmds.SetReadahead(vid, bytes)
+}
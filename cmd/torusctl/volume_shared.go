@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/spf13/cobra"
+)
+
+var volumeSharedCommand = &cobra.Command{
+	Use:   "shared NAME [on|off]",
+	Short: "get or set whether a block volume can be attached by many hosts at once",
+	Long: `get or set whether block volume NAME can be attached by many hosts at once.
+
+With 'on', 'torusblk nbd' attaches the volume shared, and every host may have
+it attached at the same time, for clustered filesystems such as OCFS2 and GFS2.
+Each write takes a lock on the blocks it touches and is synced before it
+returns, so shared volumes are much slower to write. A shared volume can't be
+attached any other way, nor have its snapshots restored. The volume must not
+be attached while this is changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeSharedAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeSharedCommand)
+}
+
+func volumeSharedAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	if len(args) == 1 {
+		on, err := block.IsShared(mds, args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't get whether %s is shared: %v", args[0], err)
+		}
+		if on {
+			fmt.Println("on")
+		} else {
+			fmt.Println("off")
+		}
+		return nil
+	}
+	var on bool
+	switch args[1] {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return torus.ErrUsage
+	}
+	err := block.SetShared(mds, args[0], on)
+	if err == torus.ErrLocked {
+		return fmt.Errorf("volume %s is attached; detach it everywhere first", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't set whether %s is shared: %v", args[0], err)
+	}
+	return nil
+}
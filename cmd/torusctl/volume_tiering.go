@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/torus"
+	"github.com/spf13/cobra"
+)
+
+var volumeTieringCommand = &cobra.Command{
+	Use:   "tiering NAME [auto|fast|slow]",
+	Short: "get or set which devices a volume's blocks are kept on",
+	Long: `get or set the tiering policy of volume NAME, which decides which devices its
+blocks are kept on by peers with both fast devices, such as SSDs, and slow
+ones.
+
+With 'auto', the default, blocks are written to the slow devices, moved to the
+fast ones while they're used often, and moved back once they aren't. With
+'fast' every block is kept on the fast devices while they have room, and with
+'slow' every block is kept on the slow ones. Peers pick up a changed policy
+within 30 seconds, and move blocks already written within a few minutes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := volumeTieringAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+func init() {
+	volumeCommand.AddCommand(volumeTieringCommand)
+}
+
+func volumeTieringAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return torus.ErrUsage
+	}
+	mds := mustConnectToMDS()
+	tmds, ok := mds.(torus.TieringMetadataService)
+	if !ok {
+		return fmt.Errorf("metadata service doesn't support tiering policies")
+	}
+	vol, err := mds.GetVolume(args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't get volume %s: %v", args[0], err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	if len(args) == 1 {
+		p, err := tmds.GetTiering(vid)
+		if err != nil {
+			return fmt.Errorf("couldn't get tiering policy: %v", err)
+		}
+		fmt.Println(p)
+		return nil
+	}
+	p, err := torus.ParseTierPolicy(args[1])
+	if err != nil {
+		return err
+	}
+	return tmds.SetTiering(vid, p)
+}
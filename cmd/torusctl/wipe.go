@@ -10,6 +10,7 @@ import (
 
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/internal/flagconfig"
+	_ "github.com/coreos/torus/metadata/consul"
 	_ "github.com/coreos/torus/metadata/etcd"
 )
 
@@ -38,7 +39,7 @@ func wipeAction(cmd *cobra.Command, args []string) {
 		}
 	}
 	cfg := flagconfig.BuildConfigFromFlags()
-	err := torus.WipeMDS("etcd", cfg)
+	err := torus.WipeMDS(flagconfig.MetadataService(), cfg)
 	if err != nil {
 		die("error wiping metadata: %v", err)
 	}
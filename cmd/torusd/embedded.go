@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/torus/internal/flagconfig"
+	"github.com/coreos/torus/metadata/etcd"
+)
+
+// startEmbeddedMDS runs the cluster's etcd inside this torusd, and points the
+// config at it.
+func startEmbeddedMDS() (*etcd.Embedded, error) {
+	if flagconfig.MetadataService() != "etcd" {
+		return nil, fmt.Errorf("--embedded-mds keeps metadata in etcd, so can't be used with --consul")
+	}
+	clientURL, err := url.Parse(embeddedClientURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse --embedded-mds-client-url: %v", err)
+	}
+	peerURL, err := url.Parse(embeddedPeerURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse --embedded-mds-peer-url: %v", err)
+	}
+	name := embeddedName
+	if name == "" {
+		name, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+	emb, err := etcd.StartEmbedded(etcd.EmbeddedConfig{
+		Name:           name,
+		Dir:            filepath.Join(dataDir, "mds"),
+		ClientURL:      *clientURL,
+		PeerURL:        *peerURL,
+		InitialCluster: embeddedCluster,
+		Join:           embeddedJoin,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.MetadataAddress = clientURL.String()
+	return emb, nil
+}
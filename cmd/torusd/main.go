@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/dustin/go-humanize"
@@ -16,31 +18,62 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/coreos/torus"
-	"github.com/coreos/torus/blockset"
 	"github.com/coreos/torus/distributor"
+	"github.com/coreos/torus/internal/discovery"
 	"github.com/coreos/torus/internal/flagconfig"
 	"github.com/coreos/torus/internal/http"
+	"github.com/coreos/torus/internal/placement"
+	"github.com/coreos/torus/internal/s3"
+	"github.com/coreos/torus/internal/tracing"
+	"github.com/coreos/torus/metadata/etcd"
 	"github.com/coreos/torus/models"
-	"github.com/coreos/torus/ring"
 
 	// Register all the possible drivers.
 	_ "github.com/coreos/torus/block"
-	_ "github.com/coreos/torus/metadata/etcd"
+	_ "github.com/coreos/torus/fs"
+	_ "github.com/coreos/torus/metadata/consul"
 	_ "github.com/coreos/torus/metadata/temp"
+	_ "github.com/coreos/torus/object"
 	_ "github.com/coreos/torus/storage"
 )
 
 var (
-	dataDir     string
-	httpAddress string
-	peerAddress string
-	sizeStr     string
-	host        string
-	port        int
-	debugInit   bool
-	autojoin    bool
-	logpkg      string
-	cfg         torus.Config
+	dataDir          string
+	httpAddress      string
+	peerAddress      string
+	placementAddress string
+	s3Address        string
+	s3CredsFile      string
+	sizeStr          string
+	deviceStrs       []string
+	scrubRateStr     string
+	peerCacheStr     string
+	rebalanceRateStr string
+	storageBackend   string
+	journalSyncStr   string
+	journalInterval  time.Duration
+	directIO         bool
+	preallocate      bool
+	restartGrace     time.Duration
+	rebalanceSLO     time.Duration
+	failureTimeout   time.Duration
+	fillThreshold    float64
+	shutdownHandoff  bool
+	host             string
+	port             int
+	debugInit        bool
+	autojoin         bool
+	joinToken        string
+	mdnsAdvertise    bool
+	logpkg           string
+	cfg              torus.Config
+
+	embeddedMDS       bool
+	embeddedName      string
+	embeddedClientURL string
+	embeddedPeerURL   string
+	embeddedCluster   string
+	embeddedJoin      bool
 
 	debug      bool
 	version    bool
@@ -58,16 +91,43 @@ var rootCommand = &cobra.Command{
 func init() {
 	rootCommand.PersistentFlags().StringVarP(&dataDir, "data-dir", "", "torus-data", "Path to the data directory")
 	rootCommand.PersistentFlags().BoolVarP(&debug, "debug", "", false, "Turn on debug output")
-	rootCommand.PersistentFlags().BoolVarP(&debugInit, "debug-init", "", false, "Run a default init for the MDS if one doesn't exist")
+	rootCommand.PersistentFlags().BoolVarP(&debugInit, "debug-init", "", false, "Initialize the MDS, with the --block-size, --block-spec and --no-ring given, if it hasn't been")
 	rootCommand.PersistentFlags().StringVarP(&host, "host", "", "", "Host to listen on for HTTP")
 	rootCommand.PersistentFlags().IntVarP(&port, "port", "", 4321, "Port to listen on for HTTP")
 	rootCommand.PersistentFlags().StringVarP(&peerAddress, "peer-address", "", "", "Address to listen on for intra-cluster data")
+	rootCommand.PersistentFlags().StringVarP(&placementAddress, "placement-address", "", "", "Address to serve block placement queries from external schedulers on")
+	rootCommand.PersistentFlags().StringVarP(&s3Address, "s3-address", "", "", "Address to serve the S3 API for object volumes on")
+	rootCommand.PersistentFlags().StringVarP(&s3CredsFile, "s3-credentials", "", "", "File of access keys and secret keys, one pair per line, that S3 requests must be signed with (default: no authentication)")
 	rootCommand.PersistentFlags().StringVarP(&sizeStr, "size", "", "1GiB", "How much disk space to use for this storage node")
+	rootCommand.PersistentFlags().StringSliceVarP(&deviceStrs, "device", "", nil, "A disk to store blocks on, as PATH:SIZE, or PATH:SIZE:fast for an SSD, instead of under --data-dir; repeat for each disk")
+	rootCommand.PersistentFlags().StringVarP(&scrubRateStr, "scrub-rate", "", "4MiB", "How much local data per second to verify against checksums in the background (0 to disable)")
+	rootCommand.PersistentFlags().StringVarP(&storageBackend, "storage-backend", "", "mfile", fmt.Sprintf("Block store to keep local blocks in (one of %s)", strings.Join(torus.BlockStoreKinds(), ", ")))
+	rootCommand.PersistentFlags().StringVarP(&journalSyncStr, "journal-sync", "", "off", "When to sync the write-ahead journal of local blocks to disk (off, always, interval or never)")
+	rootCommand.PersistentFlags().DurationVarP(&journalInterval, "journal-sync-interval", "", torus.DefaultJournalSyncInterval, "How often to sync the journal with --journal-sync=interval")
+	rootCommand.PersistentFlags().BoolVarP(&directIO, "direct-io", "", false, "Read and write blocks with O_DIRECT, bypassing the page cache (needs a block size that is a multiple of 4KiB)")
+	rootCommand.PersistentFlags().BoolVarP(&preallocate, "preallocate", "", false, "Allocate all of --size on disk up front, rather than as blocks are written")
+	rootCommand.PersistentFlags().StringVarP(&peerCacheStr, "peer-cache-size", "", "0", "Amount of memory to use for caching blocks served to other peers and attachments (0 to disable)")
+	rootCommand.PersistentFlags().StringVarP(&rebalanceRateStr, "rebalance-rate", "", "0", "Most data per second to send to other peers when rebalancing, eg. 50MiB/s (0 for no limit)")
+	rootCommand.PersistentFlags().DurationVarP(&rebalanceSLO, "rebalance-latency-slo", "", 0, "Slow rebalancing down while the p99 latency of block requests served here is above this, eg. 20ms (0 to disable)")
+	rootCommand.PersistentFlags().DurationVarP(&failureTimeout, "failure-timeout", "", 15*time.Minute, "How long a ring member may be down before the blocks it held are copied elsewhere (0 to disable)")
+	rootCommand.PersistentFlags().Float64VarP(&fillThreshold, "fill-threshold", "", 0, "Fraction of its capacity past which a ring member's weight is lowered step by step, eg. 0.85, on rings that support it (0 to disable)")
+	rootCommand.PersistentFlags().DurationVarP(&restartGrace, "restart-grace", "", 5*time.Minute, "How long other peers wait for this one to come back after SIGTERM before treating it as failed")
+	rootCommand.PersistentFlags().BoolVarP(&shutdownHandoff, "shutdown-handoff", "", false, "On SIGTERM, hand the blocks no other replica has to the peers after this one, so they can be read until it's back")
 	rootCommand.PersistentFlags().StringVarP(&logpkg, "logpkg", "", "", "Specific package logging")
 	rootCommand.PersistentFlags().BoolVarP(&autojoin, "auto-join", "", false, "Automatically join the storage pool")
+	rootCommand.PersistentFlags().StringVarP(&joinToken, "join-token", "", "", "Token the cluster must have been given with 'torusctl join-token' for --auto-join to add this node to it")
+	rootCommand.PersistentFlags().BoolVarP(&mdnsAdvertise, "mdns-advertise", "", false, "Answer new nodes looking for the cluster with --discover=mdns with the etcd endpoints this one uses")
+	rootCommand.PersistentFlags().BoolVarP(&embeddedMDS, "embedded-mds", "", false, "Keep the cluster's metadata in an etcd member run inside torusd, rather than an etcd cluster of its own")
+	rootCommand.PersistentFlags().StringVarP(&embeddedName, "embedded-mds-name", "", "", "Name of this node's embedded metadata member (default: the host name)")
+	rootCommand.PersistentFlags().StringVarP(&embeddedClientURL, "embedded-mds-client-url", "", "http://127.0.0.1:2379", "URL to serve metadata to clients on, such as torusctl, with --embedded-mds")
+	rootCommand.PersistentFlags().StringVarP(&embeddedPeerURL, "embedded-mds-peer-url", "", "http://127.0.0.1:2380", "URL the embedded metadata members talk to each other on")
+	rootCommand.PersistentFlags().StringVarP(&embeddedCluster, "embedded-mds-cluster", "", "", "Every embedded metadata member, as NAME=PEER_URL,... (default: only this one)")
+	rootCommand.PersistentFlags().BoolVarP(&embeddedJoin, "embedded-mds-join", "", false, "Join a running cluster of embedded metadata members, rather than starting one")
 	rootCommand.PersistentFlags().BoolVarP(&version, "version", "", false, "Print version info and exit")
 	rootCommand.PersistentFlags().BoolVarP(&completion, "completion", "", false, "Output bash completion code")
 	flagconfig.AddConfigFlags(rootCommand.PersistentFlags())
+	flagconfig.AddInitFlags(rootCommand.PersistentFlags())
+	tracing.AddFlags(rootCommand.PersistentFlags())
 }
 
 func main() {
@@ -103,29 +163,112 @@ func configureServer(cmd *cobra.Command, args []string) {
 		httpAddress = fmt.Sprintf("%s:%d", host, port)
 	}
 
-	var (
-		err  error
-		size uint64
-	)
-	if strings.Contains(sizeStr, "%") {
-		percent, err := parsePercentage(sizeStr)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error parsing size %s: %s\n", sizeStr, err)
+	size, err := parseSize(sizeStr, dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing size %s: %s\n", sizeStr, err)
+		os.Exit(1)
+	}
+
+	var devices []torus.Device
+	for _, d := range deviceStrs {
+		spec := strings.TrimSuffix(d, ":fast")
+		i := strings.LastIndex(spec, ":")
+		if i == -1 {
+			fmt.Fprintf(os.Stderr, "error parsing device %s: expected PATH:SIZE or PATH:SIZE:fast\n", d)
 			os.Exit(1)
 		}
-		directory, _ := filepath.Abs(dataDir)
-		size = du.NewDiskUsage(directory).Size() * percent / 100
-	} else {
-		size, err = humanize.ParseBytes(sizeStr)
+		path := spec[:i]
+		devSize, err := parseSize(spec[i+1:], path)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error parsing size %s: %s\n", sizeStr, err)
+			fmt.Fprintf(os.Stderr, "error parsing device %s: %s\n", d, err)
 			os.Exit(1)
 		}
+		devices = append(devices, torus.Device{Path: path, Size: devSize, Fast: spec != d})
+	}
+
+	scrubRate, err := humanize.ParseBytes(scrubRateStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing scrub-rate %s: %s\n", scrubRateStr, err)
+		os.Exit(1)
+	}
+
+	journalSync, err := torus.ParseJournalSync(journalSyncStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing journal-sync %s: %s\n", journalSyncStr, err)
+		os.Exit(1)
+	}
+
+	peerCacheSize, err := humanize.ParseBytes(peerCacheStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing peer-cache-size %s: %s\n", peerCacheStr, err)
+		os.Exit(1)
+	}
+
+	rebalanceRate, err := humanize.ParseBytes(strings.TrimSuffix(rebalanceRateStr, "/s"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing rebalance-rate %s: %s\n", rebalanceRateStr, err)
+		os.Exit(1)
+	}
+	if fillThreshold < 0 || fillThreshold >= 1 {
+		fmt.Fprintf(os.Stderr, "fill-threshold %v must be between 0 and 1\n", fillThreshold)
+		os.Exit(1)
+	}
+
+	if embeddedMDS && cmd.Flags().Lookup("discover").Value.String() != "" {
+		fmt.Fprintf(os.Stderr, "--discover finds the etcd endpoints of another cluster, so can't be used with --embedded-mds\n")
+		os.Exit(1)
 	}
 
 	cfg = flagconfig.BuildConfigFromFlags()
 	cfg.DataDir = dataDir
 	cfg.StorageSize = size
+	cfg.Devices = devices
+	cfg.ScrubRate = scrubRate
+	cfg.JournalSync = journalSync
+	cfg.JournalSyncInterval = journalInterval
+	cfg.DirectIO = directIO
+	cfg.Preallocate = preallocate
+	cfg.PeerCacheSize = peerCacheSize
+	cfg.RebalanceRate = rebalanceRate
+	cfg.RebalanceLatencySLO = rebalanceSLO
+	cfg.FailureTimeout = failureTimeout
+	cfg.FillThreshold = fillThreshold
+	cfg.ShutdownHandoff = shutdownHandoff
+}
+
+// openInitialized opens the server on the metadata service of the given kind,
+// first initializing it as torusctl init's flags say if it hasn't been. The
+// embedded MDS starts out empty, and whichever member gets here first
+// initializes it; after that, restarts leave it as it is.
+func openInitialized(kind string) (*torus.Server, error) {
+	md, ringType, err := flagconfig.InitMetadata()
+	if err != nil {
+		return nil, err
+	}
+	srv, err := torus.NewServer(cfg, kind, storageBackend)
+	if err != torus.ErrNoGlobalMetadata {
+		return srv, err
+	}
+	// Another member may get there first.
+	err = torus.InitMDS(kind, cfg, md, ringType)
+	if err != nil && err != torus.ErrExists {
+		return nil, fmt.Errorf("couldn't initialize the MDS: %v", err)
+	}
+	return torus.NewServer(cfg, kind, storageBackend)
+}
+
+// parseSize parses a size in bytes, or as a percentage of the disk dir is
+// on.
+func parseSize(sizeStr, dir string) (uint64, error) {
+	if strings.Contains(sizeStr, "%") {
+		percent, err := parsePercentage(sizeStr)
+		if err != nil {
+			return 0, err
+		}
+		directory, _ := filepath.Abs(dir)
+		return du.NewDiskUsage(directory).Size() * percent / 100, nil
+	}
+	return humanize.ParseBytes(sizeStr)
 }
 
 func parsePercentage(percentString string) (uint64, error) {
@@ -148,33 +291,43 @@ func runServer(cmd *cobra.Command, args []string) {
 
 	var (
 		srv *torus.Server
+		emb *etcd.Embedded
 		err error
 	)
-	switch {
-	case cfg.MetadataAddress == "":
-		srv, err = torus.NewServer(cfg, "temp", "mfile")
-	case debugInit:
-		err = torus.InitMDS("etcd", cfg, torus.GlobalMetadata{
-			BlockSize:        512 * 1024,
-			DefaultBlockSpec: blockset.MustParseBlockLayerSpec("crc,base"),
-		}, ring.Ketama)
+	if embeddedMDS {
+		emb, err = startEmbeddedMDS()
 		if err != nil {
-			if err == torus.ErrExists {
-				fmt.Println("debug-init: Already exists")
-			} else {
-				fmt.Printf("Couldn't debug-init: %s\n", err)
+			fmt.Printf("Couldn't start embedded MDS: %s\n", err)
+			os.Exit(1)
+		}
+		defer emb.Close()
+		go func() {
+			if err, ok := <-emb.Err(); ok && err != nil {
+				fmt.Printf("Embedded MDS failed: %s\n", err)
 				os.Exit(1)
 			}
-		}
-		fallthrough
+		}()
+	}
+	switch {
+	case cfg.MetadataAddress == "":
+		srv, err = torus.NewServer(cfg, "temp", storageBackend)
+	case debugInit || embeddedMDS:
+		srv, err = openInitialized(flagconfig.MetadataService())
 	default:
-		srv, err = torus.NewServer(cfg, "etcd", "mfile")
+		srv, err = torus.NewServer(cfg, flagconfig.MetadataService(), storageBackend)
 	}
 	if err != nil {
 		fmt.Printf("Couldn't start: %s\n", err)
 		os.Exit(1)
 	}
 
+	if autojoin || joinToken != "" {
+		err = torus.CheckJoinToken(srv.MDS, joinToken)
+		if err != nil {
+			fmt.Printf("Couldn't join the cluster: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	if autojoin {
 		err = doAutojoin(srv)
 		if err != nil {
@@ -183,9 +336,28 @@ func runServer(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if mdnsAdvertise {
+		if flagconfig.MetadataService() != "etcd" || cfg.MetadataAddress == "" {
+			fmt.Println("--mdns-advertise advertises etcd endpoints, so needs etcd for metadata")
+			os.Exit(1)
+		}
+		resp, err := discovery.Advertise(etcd.Endpoints(cfg.MetadataAddress))
+		if err != nil {
+			fmt.Printf("Couldn't advertise over mDNS: %s\n", err)
+			os.Exit(1)
+		}
+		defer resp.Close()
+	}
+
+	stopTracing, err := tracing.Start("torusd")
+	if err != nil {
+		fmt.Printf("Couldn't start tracing: %s\n", err)
+		os.Exit(1)
+	}
+
 	mainClose := make(chan bool)
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
 	if peerAddress != "" {
 		var u *url.URL
@@ -208,9 +380,23 @@ func runServer(cmd *cobra.Command, args []string) {
 
 	defer srv.Close()
 	go func() {
-		for _ = range signalChan {
+		for sig := range signalChan {
+			if sig == syscall.SIGTERM {
+				fmt.Println("\nReceived SIGTERM, leaving the cluster...")
+				err := distributor.ShutdownReplication(srv, restartGrace)
+				if err != nil {
+					fmt.Println("couldn't leave the cluster gracefully:", err)
+				}
+				srv.Close()
+				if emb != nil {
+					emb.Close()
+				}
+				stopTracing()
+				os.Exit(0)
+			}
 			fmt.Println("\nReceived an interrupt, stopping services...")
 			close(mainClose)
+			stopTracing()
 			os.Exit(0)
 		}
 	}()
@@ -219,6 +405,32 @@ func runServer(cmd *cobra.Command, args []string) {
 		fmt.Println("couldn't use server:", err)
 		os.Exit(1)
 	}
+	if placementAddress != "" {
+		go func() {
+			err := placement.ServePlacement(placementAddress, srv)
+			if err != nil {
+				fmt.Println("couldn't serve placement:", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if s3Address != "" {
+		var creds map[string]string
+		if s3CredsFile != "" {
+			creds, err = s3.LoadCredentials(s3CredsFile)
+			if err != nil {
+				fmt.Println("couldn't load S3 credentials:", err)
+				os.Exit(1)
+			}
+		}
+		go func() {
+			err := s3.ServeS3(s3Address, srv, creds)
+			if err != nil {
+				fmt.Println("couldn't serve S3:", err)
+				os.Exit(1)
+			}
+		}()
+	}
 	if httpAddress != "" {
 		http.ServeHTTP(httpAddress, srv)
 	}
@@ -253,7 +465,13 @@ func doAutojoin(s *torus.Server) error {
 			fmt.Fprintf(os.Stderr, "couldn't add peer to ring: %v", err)
 			return err
 		}
-		err = s.MDS.SetRing(newRing)
+		err = torus.ChangeRing(s.MDS, newRing, torus.DefaultRingAckTimeout)
+		if err == torus.ErrRingChangePending {
+			// Wait for the other change to be committed, then join the ring
+			// it makes.
+			time.Sleep(time.Second)
+			continue
+		}
 		if err == torus.ErrNonSequentialRing || err == torus.ErrAgain {
 			fmt.Fprintf(os.Stderr, "failed to set ring, try again: %v", err)
 			continue
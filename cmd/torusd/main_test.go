@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	"github.com/coreos/torus/ring"
+)
+
+// initTestMDS stands in for a new embedded MDS, which has no global metadata
+// until it's initialized.
+type initTestMDS struct {
+	initialized bool
+	// raced makes Init fail as if another member had got there first.
+	raced    bool
+	inits    int
+	md       torus.GlobalMetadata
+	ringType torus.RingType
+}
+
+var initTest initTestMDS
+
+func init() {
+	torus.RegisterMetadataProvider("init-test", torus.MetadataProvider{
+		Create: func(cfg torus.Config) (torus.MetadataService, error) {
+			if !initTest.initialized {
+				return nil, torus.ErrNoGlobalMetadata
+			}
+			return torus.CreateMetadataService("temp", cfg)
+		},
+		Init: func(cfg torus.Config, md torus.GlobalMetadata, ringType torus.RingType) error {
+			initTest.initialized = true
+			if initTest.raced {
+				return torus.ErrExists
+			}
+			initTest.inits++
+			initTest.md = md
+			initTest.ringType = ringType
+			return nil
+		},
+	})
+}
+
+func TestOpenInitialized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torusd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(c torus.Config, b string) { cfg, storageBackend = c, b }(cfg, storageBackend)
+	cfg = torus.Config{DataDir: dir, StorageSize: 1024 * 1024}
+	storageBackend = "temp"
+	flags := rootCommand.PersistentFlags()
+	defer func() {
+		flags.Set("block-size", "512KiB")
+		flags.Set("block-spec", "crc")
+		flags.Set("no-ring", "false")
+	}()
+
+	for _, tt := range []struct {
+		name        string
+		initialized bool
+		raced       bool
+		blockSpec   string
+		noRing      bool
+		inits       int
+		fails       bool
+	}{
+		{name: "new", inits: 1},
+		{name: "new without a ring", noRing: true, inits: 1},
+		{name: "restarted", initialized: true},
+		{name: "initialized by another member", raced: true},
+		{name: "bad block spec", blockSpec: "nonsense", fails: true},
+		{name: "bad block spec on restart", initialized: true, blockSpec: "nonsense", fails: true},
+	} {
+		initTest = initTestMDS{initialized: tt.initialized, raced: tt.raced}
+		flags.Set("block-size", "1MiB")
+		flags.Set("block-spec", "rep")
+		if tt.blockSpec != "" {
+			flags.Set("block-spec", tt.blockSpec)
+		}
+		if tt.noRing {
+			flags.Set("no-ring", "true")
+		} else {
+			flags.Set("no-ring", "false")
+		}
+		srv, err := openInitialized("init-test")
+		if tt.fails {
+			if err == nil {
+				srv.Close()
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			if initTest.inits != 0 {
+				t.Errorf("%s: expected the MDS not to be initialized", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		srv.Close()
+		if initTest.inits != tt.inits {
+			t.Errorf("%s: expected %d inits, got %d", tt.name, tt.inits, initTest.inits)
+		}
+		if tt.inits == 0 {
+			continue
+		}
+		// The init flags are torusctl init's, with the same defaults.
+		want := blockset.MustParseBlockLayerSpec("rep,base")
+		if initTest.md.BlockSize != 1024*1024 || len(initTest.md.DefaultBlockSpec) != len(want) || initTest.md.DefaultBlockSpec[0] != want[0] {
+			t.Errorf("%s: expected a 1MiB block size and a rep,base block spec, got %+v", tt.name, initTest.md)
+		}
+		wantRing := ring.Ketama
+		if tt.noRing {
+			wantRing = ring.Empty
+		}
+		if initTest.ringType != wantRing {
+			t.Errorf("%s: expected ring type %v, got %v", tt.name, wantRing, initTest.ringType)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	fusefs "bazil.org/fuse/fs"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/fs"
+)
+
+// fileSystem serves a mounted file volume to the kernel. Files have no
+// owner of their own, so they all belong to whoever mounted the volume.
+type fileSystem struct {
+	fs        *fs.FS
+	blockSize uint64
+	uid, gid  uint32
+
+	// nodes keeps one FUSE node for each node of the volume the kernel
+	// knows about.
+	mut   sync.Mutex
+	nodes map[*fs.Node]*node
+}
+
+func newFileSystem(f *fs.FS, blockSize uint64) *fileSystem {
+	return &fileSystem{
+		fs:        f,
+		blockSize: blockSize,
+		uid:       uint32(os.Getuid()),
+		gid:       uint32(os.Getgid()),
+		nodes:     make(map[*fs.Node]*node),
+	}
+}
+
+func (s *fileSystem) node(n *fs.Node) *node {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	x, ok := s.nodes[n]
+	if !ok {
+		x = &node{sys: s, n: n}
+		s.nodes[n] = x
+	}
+	return x
+}
+
+func (s *fileSystem) Root() (fusefs.Node, error) {
+	return s.node(s.fs.Root()), nil
+}
+
+func (s *fileSystem) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+	size, used := s.fs.Statfs()
+	free := uint64(0)
+	if used < size {
+		free = size - used
+	}
+	resp.Bsize = uint32(s.blockSize)
+	resp.Frsize = uint32(s.blockSize)
+	resp.Blocks = size / s.blockSize
+	resp.Bfree = free / s.blockSize
+	resp.Bavail = resp.Bfree
+	resp.Namelen = 255
+	return nil
+}
+
+// errno turns the errors of the fs package into the ones the kernel
+// expects. Anything else is an I/O error.
+func errno(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case torus.ErrNotExist:
+		return fuse.ENOENT
+	case torus.ErrExists:
+		return fuse.EEXIST
+	case torus.ErrNotDir:
+		return fuse.Errno(syscall.ENOTDIR)
+	case torus.ErrIsDir:
+		return fuse.Errno(syscall.EISDIR)
+	case torus.ErrNotEmpty:
+		return fuse.Errno(syscall.ENOTEMPTY)
+	case torus.ErrInvalid:
+		return fuse.Errno(syscall.EINVAL)
+	case torus.ErrOutOfSpace:
+		return fuse.Errno(syscall.ENOSPC)
+	case torus.ErrPermissionDenied:
+		return fuse.EPERM
+	}
+	return err
+}
+
+type node struct {
+	sys *fileSystem
+	n   *fs.Node
+}
+
+func (x *node) Attr(ctx context.Context, attr *fuse.Attr) error {
+	a := x.sys.fs.Attr(x.n)
+	attr.Mode = a.Mode
+	attr.Size = a.Size
+	attr.Blocks = (a.Size + 511) / 512
+	attr.Mtime = a.ModTime
+	attr.Ctime = a.ModTime
+	attr.Atime = a.ModTime
+	attr.Nlink = 1
+	attr.Uid = x.sys.uid
+	attr.Gid = x.sys.gid
+	attr.BlockSize = uint32(x.sys.blockSize)
+	return nil
+}
+
+func (x *node) Lookup(ctx context.Context, name string) (fusefs.Node, error) {
+	n, err := x.sys.fs.Lookup(x.n, name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	return x.sys.node(n), nil
+}
+
+func (x *node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	ents, err := x.sys.fs.ReadDir(x.n)
+	if err != nil {
+		return nil, errno(err)
+	}
+	out := make([]fuse.Dirent, len(ents))
+	for i, e := range ents {
+		out[i] = fuse.Dirent{Name: e.Name, Type: fuse.DT_File}
+		if e.Mode.IsDir() {
+			out[i].Type = fuse.DT_Dir
+		}
+	}
+	return out, nil
+}
+
+func (x *node) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fusefs.Node, error) {
+	n, err := x.sys.fs.Mkdir(x.n, req.Name, req.Mode&^req.Umask)
+	if err != nil {
+		return nil, errno(err)
+	}
+	return x.sys.node(n), nil
+}
+
+func (x *node) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fusefs.Node, fusefs.Handle, error) {
+	n, err := x.sys.fs.Create(x.n, req.Name, req.Mode&^req.Umask)
+	if err != nil {
+		return nil, nil, errno(err)
+	}
+	f, err := x.sys.fs.Open(n)
+	if err != nil {
+		return nil, nil, errno(err)
+	}
+	return x.sys.node(n), &handle{f: f}, nil
+}
+
+func (x *node) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	n, err := x.sys.fs.Lookup(x.n, req.Name)
+	if err != nil {
+		return errno(err)
+	}
+	isDir := x.sys.fs.Attr(n).Mode.IsDir()
+	switch {
+	case req.Dir && !isDir:
+		return errno(torus.ErrNotDir)
+	case !req.Dir && isDir:
+		return errno(torus.ErrIsDir)
+	}
+	return errno(x.sys.fs.Remove(x.n, req.Name))
+}
+
+func (x *node) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fusefs.Node) error {
+	nd, ok := newDir.(*node)
+	if !ok {
+		return fuse.Errno(syscall.EXDEV)
+	}
+	return errno(x.sys.fs.Rename(x.n, req.OldName, nd.n, req.NewName))
+}
+
+func (x *node) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fusefs.Handle, error) {
+	if req.Dir {
+		return x, nil
+	}
+	f, err := x.sys.fs.Open(x.n)
+	if err != nil {
+		return nil, errno(err)
+	}
+	if req.Flags&fuse.OpenTruncate != 0 {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, errno(err)
+		}
+	}
+	return &handle{f: f}, nil
+}
+
+func (x *node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		if err := x.sys.fs.Truncate(x.n, int64(req.Size)); err != nil {
+			return errno(err)
+		}
+	}
+	if req.Valid.Mode() {
+		if err := x.sys.fs.Chmod(x.n, req.Mode); err != nil {
+			return errno(err)
+		}
+	}
+	if req.Valid.Mtime() {
+		if err := x.sys.fs.Chtimes(x.n, req.Mtime); err != nil {
+			return errno(err)
+		}
+	} else if req.Valid.MtimeNow() {
+		if err := x.sys.fs.Chtimes(x.n, time.Now()); err != nil {
+			return errno(err)
+		}
+	}
+	return x.Attr(ctx, &resp.Attr)
+}
+
+func (x *node) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	return errno(x.sys.fs.Sync())
+}
+
+func (x *node) Forget() {
+	x.sys.mut.Lock()
+	defer x.sys.mut.Unlock()
+	delete(x.sys.nodes, x.n)
+}
+
+// handle is an open file.
+type handle struct {
+	f *fs.File
+}
+
+func (h *handle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	buf := make([]byte, req.Size)
+	n, err := h.f.ReadAt(buf, req.Offset)
+	if err != nil && err != io.EOF {
+		return errno(err)
+	}
+	resp.Data = buf[:n]
+	return nil
+}
+
+func (h *handle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	n, err := h.f.WriteAt(req.Data, req.Offset)
+	resp.Size = n
+	return errno(err)
+}
+
+func (h *handle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	return errno(h.f.Sync())
+}
+
+func (h *handle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return errno(h.f.Close())
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+	"github.com/coreos/torus/internal/flagconfig"
+	"github.com/coreos/torus/internal/http"
+	"github.com/coreos/torus/internal/tracing"
+
+	// Register all the drivers.
+	_ "github.com/coreos/torus/metadata/consul"
+	_ "github.com/coreos/torus/metadata/etcd"
+	_ "github.com/coreos/torus/storage"
+)
+
+var (
+	logpkg   string
+	httpAddr string
+	cfg      torus.Config
+
+	ioClassName string
+	ioClass     torus.IOClass
+
+	debug bool
+
+	// stopTracing flushes the spans of a command that started a server.
+	stopTracing = func() {}
+)
+
+var rootCommand = &cobra.Command{
+	Use:              "torusfs",
+	Short:            "torus file volume tool",
+	Long:             "Mount file volumes of the torus distributed storage system",
+	PersistentPreRun: configureServer,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+		os.Exit(1)
+	},
+}
+
+var versionCommand = &cobra.Command{
+	Use:   "version",
+	Short: "print version",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("torusfs\nVersion: %s\n", torus.Version)
+		os.Exit(0)
+	},
+}
+
+func init() {
+	rootCommand.AddCommand(versionCommand)
+
+	rootCommand.PersistentFlags().StringVarP(&logpkg, "logpkg", "", "", "Specific package logging")
+	rootCommand.PersistentFlags().StringVarP(&httpAddr, "http", "", "", "HTTP endpoint for debug and stats")
+	rootCommand.PersistentFlags().BoolVarP(&debug, "debug", "", false, "Turn on debug output")
+	rootCommand.PersistentFlags().StringVarP(&ioClassName, "io-class", "", "normal", "How urgent the volume's I/O is on shared peers: latency, normal or batch")
+	flagconfig.AddConfigFlags(rootCommand.PersistentFlags())
+	tracing.AddFlags(rootCommand.PersistentFlags())
+}
+
+func configureServer(cmd *cobra.Command, args []string) {
+	switch {
+	case debug:
+		capnslog.SetGlobalLogLevel(capnslog.DEBUG)
+	default:
+		capnslog.SetGlobalLogLevel(capnslog.INFO)
+	}
+	if logpkg != "" {
+		capnslog.SetGlobalLogLevel(capnslog.NOTICE)
+		rl := capnslog.MustRepoLogger("github.com/coreos/torus")
+		llc, err := rl.ParseLogLevelConfig(logpkg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing logpkg: %s\n", err)
+			os.Exit(1)
+		}
+		rl.SetLogLevel(llc)
+	}
+
+	var err error
+	ioClass, err = torus.ParseIOClass(ioClassName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing io-class: %s\n", err)
+		os.Exit(1)
+	}
+
+	cfg = flagconfig.BuildConfigFromFlags()
+}
+
+func createServer() *torus.Server {
+	stop, err := tracing.Start("torusfs")
+	if err != nil {
+		fmt.Printf("Couldn't start tracing: %s\n", err)
+		os.Exit(1)
+	}
+	stopTracing = stop
+	srv, err := torus.NewServer(cfg, flagconfig.MetadataService(), "temp")
+	if err != nil {
+		fmt.Printf("Couldn't start: %s\n", err)
+		os.Exit(1)
+	}
+	err = distributor.OpenReplication(srv)
+	if err != nil {
+		fmt.Printf("Couldn't start: %s", err)
+		os.Exit(1)
+	}
+	if httpAddr != "" {
+		go http.ServeHTTP(httpAddr, srv)
+	}
+	return srv
+}
+
+func main() {
+	capnslog.SetGlobalLogLevel(capnslog.WARNING)
+
+	err := rootCommand.Execute()
+	stopTracing()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func die(why string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, why+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	fusefs "bazil.org/fuse/fs"
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/fs"
+)
+
+var mountCommand = &cobra.Command{
+	Use:   "mount VOLUME MOUNTPOINT",
+	Short: "mount a file volume through FUSE",
+	Long: strings.TrimSpace(`
+Mount a file volume at MOUNTPOINT through FUSE, and serve it until it is
+unmounted or the command is interrupted.
+
+A file volume is mounted on one host at a time. Files are written to the
+cluster when they are closed or fsynced, and the whole volume when it is
+unmounted.
+`),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := mountAction(cmd, args)
+		if err == torus.ErrUsage {
+			cmd.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			die("%v", err)
+		}
+	},
+}
+
+var (
+	mountAllowOther bool
+	mountReadOnly   bool
+)
+
+func init() {
+	rootCommand.AddCommand(mountCommand)
+
+	mountCommand.Flags().BoolVarP(&mountAllowOther, "allow-other", "", false, "let users other than the one mounting access the volume (needs user_allow_other in /etc/fuse.conf)")
+	mountCommand.Flags().BoolVarP(&mountReadOnly, "read-only", "", false, "mount the volume read-only")
+}
+
+func mountAction(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return torus.ErrUsage
+	}
+	name, mountpoint := args[0], args[1]
+
+	srv := createServer()
+	defer srv.Close()
+	vol, err := fs.OpenFileVolume(srv, name)
+	if err != nil {
+		if err == torus.ErrWrongVolumeType {
+			return fmt.Errorf("%s is not a file volume", name)
+		}
+		return fmt.Errorf("can't open volume %s: %v", name, err)
+	}
+	vol.IOClass = ioClass
+	mounted, err := vol.Mount()
+	if err != nil {
+		if err == torus.ErrLocked {
+			return fmt.Errorf("volume %s is already mounted on another host", name)
+		}
+		return fmt.Errorf("can't mount volume %s: %v", name, err)
+	}
+	defer func() {
+		if err := mounted.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't sync volume %s: %v\n", name, err)
+		}
+	}()
+
+	options := []fuse.MountOption{
+		fuse.FSName(name),
+		fuse.Subtype("torus"),
+	}
+	if mountAllowOther {
+		options = append(options, fuse.AllowOther())
+	}
+	if mountReadOnly {
+		options = append(options, fuse.ReadOnly())
+	}
+	conn, err := fuse.Mount(mountpoint, options...)
+	if err != nil {
+		return fmt.Errorf("can't mount %s at %s: %v", name, mountpoint, err)
+	}
+	defer conn.Close()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for _ = range signalChan {
+			fmt.Println("\nReceived an interrupt, unmounting...")
+			if err := fuse.Unmount(mountpoint); err != nil {
+				fmt.Fprintf(os.Stderr, "couldn't unmount %s: %v\n", mountpoint, err)
+			}
+		}
+	}()
+
+	err = fusefs.Serve(conn, newFileSystem(mounted, srv.MDS.GlobalMetadata().BlockSize))
+	if err != nil {
+		return fmt.Errorf("error serving %s: %v", mountpoint, err)
+	}
+	<-conn.Ready
+	if err := conn.MountError; err != nil {
+		return fmt.Errorf("can't mount %s at %s: %v", name, mountpoint, err)
+	}
+	return nil
+}
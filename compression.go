@@ -0,0 +1,19 @@
+package torus
+
+// CompressionMetadataService is implemented by metadata services that can
+// store whether each volume's blocks are compressed at rest.
+type CompressionMetadataService interface {
+	// GetCompression returns whether the volume is compressed, which is
+	// false if it was never set.
+	GetCompression(vid VolumeID) (bool, error)
+	SetCompression(vid VolumeID, on bool) error
+}
+
+// BlockCompressor is implemented by block stores that can compress blocks at
+// rest. Compression is transparent; blocks are always read back as written.
+type BlockCompressor interface {
+	// SetCompressionPolicy sets the function the store asks whether to
+	// compress a volume's blocks. It may be called on every write, and
+	// without the store's locks held.
+	SetCompressionPolicy(f func(vid VolumeID) bool)
+}
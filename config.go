@@ -1,6 +1,10 @@
 package torus
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+	"errors"
+	"time"
+)
 
 type Config struct {
 	DataDir         string
@@ -9,6 +13,154 @@ type Config struct {
 	ReadCacheSize   uint64
 	ReadLevel       ReadLevel
 	WriteLevel      WriteLevel
+	// ReadCacheDir is where blocks pushed out of the read cache in memory
+	// are kept, in up to ReadCacheDiskSize bytes. If either is unset, the
+	// read cache is only in memory.
+	ReadCacheDir      string
+	ReadCacheDiskSize uint64
+	// ScrubRate is how many bytes per second of local blocks the scrubber
+	// verifies. Zero disables scrubbing.
+	ScrubRate uint64
+	// JournalSync is when the write-ahead journal of the local block store
+	// is synced to disk. The default, JournalOff, writes blocks to storage
+	// without a journal.
+	JournalSync JournalSync
+	// JournalSyncInterval is how often the journal is synced under
+	// JournalInterval. Zero means DefaultJournalSyncInterval.
+	JournalSyncInterval time.Duration
+	// DirectIO reads and writes the blocks of the local block store with
+	// O_DIRECT, around the page cache, where the platform and filesystem
+	// allow it.
+	DirectIO bool
+	// Preallocate allocates the whole of the local block store on disk when
+	// it's created or grown, rather than as blocks are first written.
+	Preallocate bool
+	// Devices are the disks to keep local blocks on, each with its own
+	// capacity. If empty, blocks are kept under DataDir, in StorageSize
+	// bytes.
+	Devices []Device
+	// PeerCacheSize is how much memory a peer may use to keep the blocks it
+	// serves from its own storage. Zero disables the peer cache.
+	PeerCacheSize uint64
+	// WriteBatchSize is the most blocks a write to another peer carries.
+	// Writes to a peer that come in while an earlier one is in flight are
+	// sent together, once it's done. Zero or one sends every block on its
+	// own.
+	WriteBatchSize int
+	// WriteBatchInterval is how long a write waits for others to send with
+	// it, when the peer has none in flight. Zero sends it straight away.
+	WriteBatchInterval time.Duration
+	// HedgeDelay is how long a read with ReadHedged waits for a peer before
+	// asking the next one as well. Zero waits as long as the 95th
+	// percentile of recent reads from peers.
+	HedgeDelay time.Duration
+	// PeerConns is the most connections a peer keeps open to each other
+	// peer. Requests share them once there are that many. Zero means one.
+	PeerConns int
+	// PeerConnIdleTimeout is how long a connection to another peer may go
+	// unused before it's closed. Zero keeps it open.
+	PeerConnIdleTimeout time.Duration
+	// RebalanceRate caps how many bytes per second of blocks a peer sends
+	// to other peers when rebalancing. Zero leaves it uncapped.
+	RebalanceRate uint64
+	// RebalanceLatencySLO slows rebalancing down while the 99th percentile
+	// latency of the block reads and writes a peer serves is above it. Zero
+	// disables the throttle.
+	RebalanceLatencySLO time.Duration
+	// Zone is the failure domain, such as a rack or availability zone, this
+	// process runs in. Traffic to and from other peers is counted per pair
+	// of zones.
+	Zone string
+	// ReadLocalZone reads from replicas in the same zone before any others.
+	ReadLocalZone bool
+	// ReadLeastLoaded reads from the replicas that other peers' heartbeats
+	// say are least loaded more often than the rest.
+	ReadLeastLoaded bool
+	// PeerTimeout is how long a peer may go without heartbeating before
+	// this one considers it down and stops sending it requests. Zero means
+	// DefaultPeerTimeout.
+	PeerTimeout time.Duration
+	// FailureTimeout is how long a ring member may be down before it is
+	// considered lost for good, and the blocks it held are copied to the
+	// peers that would take its place. Zero disables this.
+	FailureTimeout time.Duration
+	// FillThreshold is how full, as a fraction of its capacity, a ring
+	// member may get before its weight on the ring is lowered, step by step,
+	// to steer blocks to emptier peers. Its weight is raised again once it's
+	// below. Only rings that implement WeightAdjustableRing can be adjusted.
+	// Zero disables this.
+	FillThreshold float64
+	// ShutdownHandoff, when a peer shuts down gracefully, hands the local
+	// blocks no other live replica has to the peers that follow the
+	// replicas, so that they can still be read while it's away.
+	ShutdownHandoff bool
+	// EncryptionKey is the key encryption key that wraps the keys of
+	// encrypted volumes. Without it, encrypted volumes can't be read or
+	// written.
+	EncryptionKey []byte
+	// PeerTLS, if set, secures block traffic between peers. Both sides of
+	// every connection must present a certificate the other side trusts.
+	PeerTLS *tls.Config
+	// Identity is who this process acts as when volume ACLs are checked,
+	// such as the common name of its peer certificate or a token.
+	Identity string
+	// Token, if set, is presented to peers on every block connection, so
+	// that they check volume ACLs against its identity rather than that of
+	// the peer certificate.
+	Token string
+	// MetadataCache keeps the ring, volumes and volume settings in memory,
+	// kept up to date by watching the metadata service, rather than asking
+	// it on every read. Only etcd supports it.
+	MetadataCache bool
 
 	TLS *tls.Config
 }
+
+// Device is a disk, or any other path, that a peer stores blocks on.
+type Device struct {
+	Path string
+	Size uint64
+	// Fast puts the device in the fast tier, such as an SSD among hard
+	// disks. Blocks are only moved between tiers if there are devices in
+	// both.
+	Fast bool
+}
+
+// DefaultJournalSyncInterval is how often the journal of the local block
+// store is synced under JournalInterval, unless configured otherwise.
+const DefaultJournalSyncInterval = 100 * time.Millisecond
+
+// JournalSync is when the write-ahead journal of the local block store is
+// synced to disk, which decides what a crash can lose.
+type JournalSync int
+
+const (
+	// JournalOff writes blocks straight to storage. A crash may leave
+	// blocks that were acknowledged missing or torn.
+	JournalOff JournalSync = iota
+	// JournalAlways syncs the journal before a write is acknowledged.
+	// Concurrent writes share a sync.
+	JournalAlways
+	// JournalInterval syncs the journal every JournalSyncInterval. A crash
+	// of the machine can lose the writes since the last sync, but a crash
+	// of the process loses nothing.
+	JournalInterval
+	// JournalNever leaves syncing the journal to the operating system.
+	JournalNever
+)
+
+func ParseJournalSync(s string) (js JournalSync, err error) {
+	switch s {
+	case "off":
+		js = JournalOff
+	case "always":
+		js = JournalAlways
+	case "interval":
+		js = JournalInterval
+	case "never":
+		js = JournalNever
+	default:
+		err = errors.New("invalid journal sync policy; use one of 'off', 'always', 'interval', or 'never'")
+	}
+	return
+}
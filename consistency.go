@@ -0,0 +1,73 @@
+package torus
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Consistency is the read and write levels a volume's blocks are read and
+// written at, in place of each client's own --read-level and --write-level.
+// Pairing ReadQuorum with WriteQuorum means a read always sees the latest
+// write, at the cost of waiting on most replicas rather than the first.
+type Consistency struct {
+	Read  ReadLevel
+	Write WriteLevel
+}
+
+// ParseConsistency parses the form String returns: the read level, then the
+// write level, separated by a comma.
+func ParseConsistency(s string) (*Consistency, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid consistency %q; use READ_LEVEL,WRITE_LEVEL", s)
+	}
+	rl, err := ParseReadLevel(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	wl, err := ParseWriteLevel(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return &Consistency{Read: rl, Write: wl}, nil
+}
+
+func (c Consistency) String() string {
+	return c.Read.String() + "," + c.Write.String()
+}
+
+// ConsistencyMetadataService is implemented by metadata services that can
+// store a consistency per volume.
+type ConsistencyMetadataService interface {
+	// GetConsistency returns the volume's consistency, or nil if clients use
+	// their own levels.
+	GetConsistency(vid VolumeID) (*Consistency, error)
+	// SetConsistency sets the volume's consistency; nil clears it.
+	SetConsistency(vid VolumeID, c *Consistency) error
+}
+
+// WithReadLevel returns a context whose block reads are made at rl, whatever
+// the volume or client would otherwise use.
+func WithReadLevel(ctx context.Context, rl ReadLevel) context.Context {
+	return context.WithValue(ctx, CtxReadLevel, rl)
+}
+
+// WithWriteLevel returns a context whose block writes are made at wl,
+// whatever the volume or client would otherwise use.
+func WithWriteLevel(ctx context.Context, wl WriteLevel) context.Context {
+	return context.WithValue(ctx, CtxWriteLevel, wl)
+}
+
+// RequestReadLevel returns the read level set on ctx, if any.
+func RequestReadLevel(ctx context.Context) (ReadLevel, bool) {
+	rl, ok := ctx.Value(CtxReadLevel).(ReadLevel)
+	return rl, ok
+}
+
+// RequestWriteLevel returns the write level set on ctx, if any.
+func RequestWriteLevel(ctx context.Context) (WriteLevel, bool) {
+	wl, ok := ctx.Value(CtxWriteLevel).(WriteLevel)
+	return wl, ok
+}
@@ -0,0 +1,344 @@
+package csi
+
+import (
+	"sort"
+	"strconv"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/models"
+)
+
+// defaultVolumeSize is the size of volumes created without a capacity.
+const defaultVolumeSize = 1024 * 1024 * 1024
+
+// Storage class parameters.
+const (
+	// paramRedundancy is the redundancy of new volumes, as given to
+	// torusctl volume create --redundancy.
+	paramRedundancy = "redundancy"
+	// paramTenant is the tenant whose quota new volumes count against.
+	paramTenant = "tenant"
+	// paramIOClass is the I/O class volumes are attached with.
+	paramIOClass = "ioClass"
+)
+
+// volumeID is the volume ID of a torus volume: its name, which is unique
+// and is what the orchestrator asked for in the first place.
+func volumeID(vol *models.Volume) string {
+	return vol.Name
+}
+
+func (d *Driver) findVolume(name string) (*models.Volume, error) {
+	vols, _, err := d.srv.MDS.GetVolumes()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	for _, v := range vols {
+		if v.Name == name {
+			if v.Type != block.VolumeType {
+				return nil, status.Errorf(codes.InvalidArgument, "volume %s isn't a block volume", name)
+			}
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *Driver) CreateVolume(ctx context.Context, req *spec.CreateVolumeRequest) (*spec.CreateVolumeResponse, error) {
+	name := req.GetName()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume name is required")
+	}
+	if err := checkCapabilities(req.GetVolumeCapabilities()); err != nil {
+		return nil, err
+	}
+	if req.GetVolumeContentSource() != nil {
+		return nil, status.Error(codes.InvalidArgument, "creating volumes from snapshots or other volumes isn't supported")
+	}
+	params := req.GetParameters()
+	var (
+		red torus.Redundancy
+		err error
+	)
+	for k, v := range params {
+		switch k {
+		case paramRedundancy:
+			red, err = torus.ParseRedundancy(v)
+		case paramIOClass:
+			_, err = torus.ParseIOClass(v)
+		case paramTenant:
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown parameter %q", k)
+		}
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	size, err := volumeSize(req.GetCapacityRange(), d.srv.MDS.GlobalMetadata().BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	// Creating is idempotent: a volume that already exists with a size
+	// that fits is what was asked for.
+	vol, err := d.findVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	if vol != nil {
+		if !fits(vol.MaxBytes, req.GetCapacityRange()) {
+			return nil, status.Errorf(codes.AlreadyExists, "volume %s already exists with size %d", name, vol.MaxBytes)
+		}
+		return &spec.CreateVolumeResponse{Volume: csiVolume(vol, params)}, nil
+	}
+
+	if tenant := params[paramTenant]; tenant != "" {
+		var soft bool
+		soft, err = block.CreateTenantBlockVolume(d.srv.MDS, tenant, name, size)
+		if soft {
+			clog.Warningf("tenant %s is over its soft quota", tenant)
+		}
+	} else {
+		err = block.CreateBlockVolume(d.srv.MDS, name, size)
+	}
+	switch err {
+	case nil:
+	case torus.ErrQuotaExceeded:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case torus.ErrExists:
+		return nil, status.Errorf(codes.Aborted, "volume %s is being created by another request", name)
+	default:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err := torus.SetInitialRedundancy(d.srv.MDS, name, red); err != nil {
+		if derr := block.DeleteBlockVolume(d.srv.MDS, name); derr != nil {
+			clog.Errorf("couldn't delete %s after failing to set its redundancy: %v", name, derr)
+		}
+		return nil, status.Errorf(codes.Internal, "couldn't set redundancy of %s: %v", name, err)
+	}
+	vol, err = d.findVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	if vol == nil {
+		return nil, status.Errorf(codes.Aborted, "volume %s was deleted as it was created", name)
+	}
+	clog.Infof("created volume %s of %d bytes", name, size)
+	return &spec.CreateVolumeResponse{Volume: csiVolume(vol, params)}, nil
+}
+
+// volumeSize is the size to create a volume at for a capacity range: the
+// least it may be, rounded up to whole blocks.
+func volumeSize(r *spec.CapacityRange, blockSize uint64) (uint64, error) {
+	req, limit := r.GetRequiredBytes(), r.GetLimitBytes()
+	if req < 0 || limit < 0 {
+		return 0, status.Error(codes.InvalidArgument, "capacity can't be negative")
+	}
+	size := uint64(req)
+	if size == 0 {
+		size = defaultVolumeSize
+		if limit != 0 && uint64(limit) < size {
+			size = uint64(limit)
+		}
+	}
+	if blockSize != 0 && size%blockSize != 0 {
+		size += blockSize - size%blockSize
+	}
+	if !fits(size, r) {
+		return 0, status.Errorf(codes.OutOfRange, "no size in whole %d byte blocks is between %d and %d bytes", blockSize, req, limit)
+	}
+	return size, nil
+}
+
+func fits(size uint64, r *spec.CapacityRange) bool {
+	if size < uint64(r.GetRequiredBytes()) {
+		return false
+	}
+	return r.GetLimitBytes() == 0 || size <= uint64(r.GetLimitBytes())
+}
+
+func csiVolume(vol *models.Volume, params map[string]string) *spec.Volume {
+	out := &spec.Volume{
+		VolumeId:      volumeID(vol),
+		CapacityBytes: int64(vol.MaxBytes),
+	}
+	if c, ok := params[paramIOClass]; ok {
+		out.VolumeContext = map[string]string{paramIOClass: c}
+	}
+	return out
+}
+
+// checkCapabilities checks that volumes can be used as asked. Volumes can
+// only be attached to one node at a time, as a block device or a
+// filesystem.
+func checkCapabilities(caps []*spec.VolumeCapability) error {
+	if len(caps) == 0 {
+		return status.Error(codes.InvalidArgument, "volume capabilities are required")
+	}
+	for _, c := range caps {
+		if msg := unsupported(c); msg != "" {
+			return status.Error(codes.InvalidArgument, msg)
+		}
+	}
+	return nil
+}
+
+// unsupported says why a capability isn't supported, or returns "" if it
+// is.
+func unsupported(c *spec.VolumeCapability) string {
+	if c.GetBlock() == nil && c.GetMount() == nil {
+		return "volumes can only be used as block devices or mounted filesystems"
+	}
+	switch m := c.GetAccessMode().GetMode(); m {
+	case spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		spec.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY:
+	default:
+		return "volumes can only be attached to a single node, not with access mode " + m.String()
+	}
+	return ""
+}
+
+func (d *Driver) DeleteVolume(ctx context.Context, req *spec.DeleteVolumeRequest) (*spec.DeleteVolumeResponse, error) {
+	id := req.GetVolumeId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	vol, err := d.findVolume(id)
+	if err != nil {
+		return nil, err
+	}
+	if vol == nil {
+		// Already gone.
+		return &spec.DeleteVolumeResponse{}, nil
+	}
+	switch err := block.DeleteBlockVolume(d.srv.MDS, id); err {
+	case nil, torus.ErrNotExist:
+	case torus.ErrLocked:
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %s is still attached", id)
+	default:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	clog.Infof("deleted volume %s", id)
+	return &spec.DeleteVolumeResponse{}, nil
+}
+
+func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *spec.ValidateVolumeCapabilitiesRequest) (*spec.ValidateVolumeCapabilitiesResponse, error) {
+	id := req.GetVolumeId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	if len(req.GetVolumeCapabilities()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume capabilities are required")
+	}
+	vol, err := d.findVolume(id)
+	if err != nil {
+		return nil, err
+	}
+	if vol == nil {
+		return nil, status.Errorf(codes.NotFound, "no volume %s", id)
+	}
+	for _, c := range req.GetVolumeCapabilities() {
+		if msg := unsupported(c); msg != "" {
+			return &spec.ValidateVolumeCapabilitiesResponse{Message: msg}, nil
+		}
+	}
+	return &spec.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &spec.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.GetVolumeContext(),
+			VolumeCapabilities: req.GetVolumeCapabilities(),
+			Parameters:         req.GetParameters(),
+		},
+	}, nil
+}
+
+// ListVolumes lists block volumes by name. The token is the index of the
+// next volume to list.
+func (d *Driver) ListVolumes(ctx context.Context, req *spec.ListVolumesRequest) (*spec.ListVolumesResponse, error) {
+	if req.GetMaxEntries() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "max entries can't be negative")
+	}
+	vols, _, err := d.srv.MDS.GetVolumes()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	var blockVols []*models.Volume
+	for _, v := range vols {
+		if v.Type == block.VolumeType {
+			blockVols = append(blockVols, v)
+		}
+	}
+	sort.Sort(byName(blockVols))
+	start := 0
+	if tok := req.GetStartingToken(); tok != "" {
+		start, err = strconv.Atoi(tok)
+		if err != nil || start < 0 || start > len(blockVols) {
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %q", tok)
+		}
+	}
+	end := len(blockVols)
+	if n := int(req.GetMaxEntries()); n > 0 && start+n < end {
+		end = start + n
+	}
+	resp := &spec.ListVolumesResponse{}
+	for _, v := range blockVols[start:end] {
+		resp.Entries = append(resp.Entries, &spec.ListVolumesResponse_Entry{Volume: csiVolume(v, nil)})
+	}
+	if end < len(blockVols) {
+		resp.NextToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+type byName []*models.Volume
+
+func (v byName) Len() int           { return len(v) }
+func (v byName) Less(i, j int) bool { return v[i].Name < v[j].Name }
+func (v byName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *spec.ControllerGetCapabilitiesRequest) (*spec.ControllerGetCapabilitiesResponse, error) {
+	var caps []*spec.ControllerServiceCapability
+	for _, t := range []spec.ControllerServiceCapability_RPC_Type{
+		spec.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		spec.ControllerServiceCapability_RPC_LIST_VOLUMES,
+	} {
+		caps = append(caps, &spec.ControllerServiceCapability{
+			Type: &spec.ControllerServiceCapability_Rpc{
+				Rpc: &spec.ControllerServiceCapability_RPC{Type: t},
+			},
+		})
+	}
+	return &spec.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
+}
+
+// Volumes are attached by the node plugin itself, over NBD, so there is
+// nothing for the controller to publish; nor are snapshots or capacity
+// offered yet.
+
+func (d *Driver) ControllerPublishVolume(ctx context.Context, req *spec.ControllerPublishVolumeRequest) (*spec.ControllerPublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *spec.ControllerUnpublishVolumeRequest) (*spec.ControllerUnpublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (d *Driver) GetCapacity(ctx context.Context, req *spec.GetCapacityRequest) (*spec.GetCapacityResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (d *Driver) CreateSnapshot(ctx context.Context, req *spec.CreateSnapshotRequest) (*spec.CreateSnapshotResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (d *Driver) DeleteSnapshot(ctx context.Context, req *spec.DeleteSnapshotRequest) (*spec.DeleteSnapshotResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (d *Driver) ListSnapshots(ctx context.Context, req *spec.ListSnapshotsRequest) (*spec.ListSnapshotsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
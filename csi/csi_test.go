@@ -0,0 +1,155 @@
+package csi
+
+import (
+	"testing"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coreos/torus"
+	_ "github.com/coreos/torus/metadata/temp"
+	_ "github.com/coreos/torus/storage"
+)
+
+func mountCap(mode spec.VolumeCapability_AccessMode_Mode) []*spec.VolumeCapability {
+	return []*spec.VolumeCapability{{
+		AccessType: &spec.VolumeCapability_Mount{Mount: &spec.VolumeCapability_MountVolume{}},
+		AccessMode: &spec.VolumeCapability_AccessMode{Mode: mode},
+	}}
+}
+
+func code(err error) codes.Code {
+	return status.Code(err)
+}
+
+func TestCreateVolume(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	d := NewDriver(srv, "node-1")
+	ctx := context.Background()
+	bs := int64(srv.MDS.GlobalMetadata().BlockSize)
+
+	req := &spec.CreateVolumeRequest{
+		Name:               "pvc-1",
+		CapacityRange:      &spec.CapacityRange{RequiredBytes: 10*bs + 1},
+		VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+		Parameters:         map[string]string{"redundancy": "rep=2", "ioClass": "batch"},
+	}
+	resp, err := d.CreateVolume(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol := resp.Volume
+	if vol.VolumeId != "pvc-1" || vol.CapacityBytes != 11*bs || vol.VolumeContext["ioClass"] != "batch" {
+		t.Errorf("unexpected volume %+v", vol)
+	}
+	mv, err := srv.MDS.GetVolume("pvc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	red, err := torus.GetRedundancy(srv.MDS, torus.VolumeID(mv.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if red.String() != "rep=2" {
+		t.Errorf("expected the volume to be created with rep=2, got %s", red)
+	}
+
+	// Asking again is fine, but not for a size the volume doesn't have.
+	if _, err := d.CreateVolume(ctx, req); err != nil {
+		t.Errorf("expected creating the same volume again to succeed, got %v", err)
+	}
+	req.CapacityRange = &spec.CapacityRange{RequiredBytes: 20 * bs}
+	if _, err := d.CreateVolume(ctx, req); code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists for a different size, got %v", err)
+	}
+
+	bad := []*spec.CreateVolumeRequest{
+		{Name: "pvc-2", VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER)},
+		{Name: "pvc-2"},
+		{Name: "pvc-2", VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			Parameters: map[string]string{"replicas": "3"}},
+		{Name: "pvc-2", VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			Parameters: map[string]string{"redundancy": "lots"}},
+	}
+	for i, r := range bad {
+		if _, err := d.CreateVolume(ctx, r); code(err) != codes.InvalidArgument {
+			t.Errorf("%d: expected InvalidArgument, got %v", i, err)
+		}
+	}
+	req = &spec.CreateVolumeRequest{
+		Name:               "pvc-2",
+		CapacityRange:      &spec.CapacityRange{RequiredBytes: bs + 1, LimitBytes: bs + 2},
+		VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+	}
+	if _, err := d.CreateVolume(ctx, req); code(err) != codes.OutOfRange {
+		t.Errorf("expected OutOfRange for a range without a whole number of blocks, got %v", err)
+	}
+}
+
+func TestListAndDeleteVolumes(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	d := NewDriver(srv, "node-1")
+	ctx := context.Background()
+
+	for _, name := range []string{"pvc-c", "pvc-a", "pvc-b"} {
+		_, err := d.CreateVolume(ctx, &spec.CreateVolumeRequest{
+			Name:               name,
+			VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var names []string
+	token := ""
+	for {
+		resp, err := d.ListVolumes(ctx, &spec.ListVolumesRequest{MaxEntries: 2, StartingToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range resp.Entries {
+			names = append(names, e.Volume.VolumeId)
+		}
+		if resp.NextToken == "" {
+			break
+		}
+		token = resp.NextToken
+	}
+	if len(names) != 3 || names[0] != "pvc-a" || names[1] != "pvc-b" || names[2] != "pvc-c" {
+		t.Errorf("expected every volume in order, got %v", names)
+	}
+	if _, err := d.ListVolumes(ctx, &spec.ListVolumesRequest{StartingToken: "x"}); code(err) != codes.Aborted {
+		t.Errorf("expected Aborted for a bad token, got %v", err)
+	}
+
+	v, err := d.ValidateVolumeCapabilities(ctx, &spec.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           "pvc-a",
+		VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+	})
+	if err != nil || v.Confirmed != nil || v.Message == "" {
+		t.Errorf("expected multi-node access not to be confirmed, got %+v, %v", v, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := d.DeleteVolume(ctx, &spec.DeleteVolumeRequest{VolumeId: "pvc-b"}); err != nil {
+			t.Fatalf("delete %d: %v", i, err)
+		}
+	}
+	vols, _, err := srv.MDS.GetVolumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 2 {
+		t.Errorf("expected two volumes left, got %d", len(vols))
+	}
+	if _, err := d.ValidateVolumeCapabilities(ctx, &spec.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           "pvc-b",
+		VolumeCapabilities: mountCap(spec.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+	}); code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a deleted volume, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package csi implements the Container Storage Interface for torus block
+// volumes, so that container orchestrators such as Kubernetes can provision
+// volumes and attach them to the nodes their workloads run on.
+package csi
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/coreos/pkg/capnslog"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/coreos/torus"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "csi")
+
+// DriverName is the name the driver registers under; storage classes name
+// it as their provisioner.
+const DriverName = "torus.coreos.com"
+
+// Driver serves the identity, controller and node services of the CSI for
+// the volumes of a torus cluster.
+type Driver struct {
+	srv    *torus.Server
+	nodeID string
+
+	// mu guards attachments, and serializes attaching so that two volumes
+	// don't race for the same NBD device.
+	mu          sync.Mutex
+	attachments map[string]*attachment
+	stopped     bool
+
+	grpc *grpc.Server
+}
+
+// NewDriver returns a driver for the cluster srv is connected to, running on
+// the node the orchestrator knows as nodeID.
+func NewDriver(srv *torus.Server, nodeID string) *Driver {
+	d := &Driver{
+		srv:         srv,
+		nodeID:      nodeID,
+		attachments: make(map[string]*attachment),
+		grpc:        grpc.NewServer(grpc.UnaryInterceptor(logErrors)),
+	}
+	spec.RegisterIdentityServer(d.grpc, d)
+	spec.RegisterControllerServer(d.grpc, d)
+	spec.RegisterNodeServer(d.grpc, d)
+	return d
+}
+
+// Listen listens on a CSI endpoint, such as unix:///csi/csi.sock or
+// tcp://127.0.0.1:10000, removing any socket left behind by a previous run.
+func Listen(endpoint string) (net.Listener, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Host
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	case "tcp":
+		return net.Listen("tcp", u.Host)
+	}
+	return nil, fmt.Errorf("csi: unsupported endpoint %q; use unix:// or tcp://", endpoint)
+}
+
+// Serve serves the CSI on l until Stop is called.
+func (d *Driver) Serve(l net.Listener) error {
+	clog.Infof("serving %s on %s", DriverName, l.Addr())
+	return d.grpc.Serve(l)
+}
+
+// Stop detaches every volume still attached to the node and stops serving.
+func (d *Driver) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	for id, a := range d.attachments {
+		for target := range a.targets {
+			if err := unmount(target); err != nil {
+				clog.Errorf("couldn't unmount %s: %v", target, err)
+			}
+		}
+		a.detach()
+		delete(d.attachments, id)
+	}
+	d.mu.Unlock()
+	d.grpc.Stop()
+}
+
+func logErrors(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		clog.Errorf("%s: %v", info.FullMethod, err)
+	}
+	return resp, err
+}
+
+func (d *Driver) GetPluginInfo(ctx context.Context, req *spec.GetPluginInfoRequest) (*spec.GetPluginInfoResponse, error) {
+	version := torus.Version
+	if version == "" {
+		version = "dev"
+	}
+	return &spec.GetPluginInfoResponse{
+		Name:          DriverName,
+		VendorVersion: version,
+	}, nil
+}
+
+func (d *Driver) GetPluginCapabilities(ctx context.Context, req *spec.GetPluginCapabilitiesRequest) (*spec.GetPluginCapabilitiesResponse, error) {
+	return &spec.GetPluginCapabilitiesResponse{
+		Capabilities: []*spec.PluginCapability{
+			{
+				Type: &spec.PluginCapability_Service_{
+					Service: &spec.PluginCapability_Service{
+						Type: spec.PluginCapability_Service_CONTROLLER_SERVICE,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (d *Driver) Probe(ctx context.Context, req *spec.ProbeRequest) (*spec.ProbeResponse, error) {
+	ready := d.srv.MDS.GlobalMetadata().BlockSize != 0
+	return &spec.ProbeResponse{Ready: &wrappers.BoolValue{Value: ready}}, nil
+}
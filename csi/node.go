@@ -0,0 +1,291 @@
+package csi
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	spec "github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/internal/nbd"
+)
+
+const (
+	defaultFSType = "ext4"
+	// attachTimeout is how long to wait for the kernel to connect an NBD
+	// device.
+	attachTimeout = 10 * time.Second
+)
+
+// attachment is a volume attached to an NBD device on this node, and the
+// paths it is published at.
+type attachment struct {
+	file    *block.BlockFile
+	nbd     *nbd.NBD
+	dev     string
+	targets map[string]bool
+	served  chan error
+}
+
+func (a *attachment) detach() {
+	a.nbd.Disconnect()
+	if err := <-a.served; err != nil {
+		clog.Errorf("error from nbd server for %s: %v", a.dev, err)
+	}
+	if err := a.file.Close(); err != nil {
+		clog.Errorf("couldn't close volume attached to %s: %v", a.dev, err)
+	}
+}
+
+// attach opens a volume and attaches it to a free NBD device, which it
+// serves until detached. d.mu must be held.
+func (d *Driver) attach(id string, ioClass string) (*attachment, error) {
+	vol, err := d.findVolume(id)
+	if err != nil {
+		return nil, err
+	}
+	if vol == nil {
+		return nil, status.Errorf(codes.NotFound, "no volume %s", id)
+	}
+	blockvol, err := block.OpenBlockVolume(d.srv, id)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if ioClass != "" {
+		blockvol.IOClass, err = torus.ParseIOClass(ioClass)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	f, err := blockvol.OpenBlockFile()
+	if err != nil {
+		if err == torus.ErrLocked {
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %s is attached to another node", id)
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	handle := nbd.Create(f, int64(f.Size()), int64(d.srv.MDS.GlobalMetadata().BlockSize))
+	dev, err := nbd.FindDevice()
+	if err == nil {
+		dev, err = handle.OpenDevice(dev)
+	}
+	if err != nil {
+		f.Close()
+		return nil, status.Errorf(codes.Unavailable, "couldn't get an NBD device: %v", err)
+	}
+	a := &attachment{
+		file:    f,
+		nbd:     handle,
+		dev:     dev,
+		targets: make(map[string]bool),
+		served:  make(chan error, 1),
+	}
+	go func() {
+		a.served <- handle.Serve()
+	}()
+	if err := waitConnected(dev, a.served); err != nil {
+		a.detach()
+		return nil, status.Errorf(codes.Internal, "couldn't attach %s to %s: %v", id, dev, err)
+	}
+	clog.Infof("attached %s to %s", id, dev)
+	return a, nil
+}
+
+// waitConnected waits for the kernel to start sending requests for an NBD
+// device, which it marks with the pid of the server.
+func waitConnected(dev string, served chan error) error {
+	pid := filepath.Join("/sys/block", filepath.Base(dev), "pid")
+	deadline := time.Now().Add(attachTimeout)
+	for {
+		if _, err := os.Stat(pid); err == nil {
+			return nil
+		}
+		select {
+		case err := <-served:
+			// Put it back for detach.
+			served <- err
+			if err == nil {
+				err = fmt.Errorf("server stopped")
+			}
+			return err
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out")
+		}
+	}
+}
+
+func (d *Driver) NodePublishVolume(ctx context.Context, req *spec.NodePublishVolumeRequest) (*spec.NodePublishVolumeResponse, error) {
+	id, target, vc := req.GetVolumeId(), req.GetTargetPath(), req.GetVolumeCapability()
+	switch {
+	case id == "":
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	case target == "":
+		return nil, status.Error(codes.InvalidArgument, "target path is required")
+	case vc == nil:
+		return nil, status.Error(codes.InvalidArgument, "volume capability is required")
+	}
+	if msg := unsupported(vc); msg != "" {
+		return nil, status.Error(codes.InvalidArgument, msg)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return nil, status.Error(codes.Unavailable, "the driver is stopping")
+	}
+	a := d.attachments[id]
+	if a != nil && a.targets[target] {
+		return &spec.NodePublishVolumeResponse{}, nil
+	}
+	if a == nil {
+		var err error
+		a, err = d.attach(id, req.GetVolumeContext()[paramIOClass])
+		if err != nil {
+			return nil, err
+		}
+		d.attachments[id] = a
+	}
+	if err := publish(a.dev, target, vc, req.GetReadonly()); err != nil {
+		if len(a.targets) == 0 {
+			a.detach()
+			delete(d.attachments, id)
+		}
+		return nil, status.Errorf(codes.Internal, "couldn't publish %s at %s: %v", id, target, err)
+	}
+	a.targets[target] = true
+	clog.Infof("published %s at %s", id, target)
+	return &spec.NodePublishVolumeResponse{}, nil
+}
+
+// publish makes dev available at target: bind mounted for raw block access,
+// or formatted if it needs to be and mounted.
+func publish(dev, target string, vc *spec.VolumeCapability, readonly bool) error {
+	opts := []string{}
+	if readonly || vc.GetAccessMode().GetMode() == spec.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY {
+		opts = append(opts, "ro")
+	}
+	if vc.GetBlock() != nil {
+		if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE, 0640)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		return run("mount", "-o", strings.Join(append(opts, "bind"), ","), dev, target)
+	}
+	mnt := vc.GetMount()
+	fsType := mnt.GetFsType()
+	if fsType == "" {
+		fsType = defaultFSType
+	}
+	if err := format(dev, fsType); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, 0750); err != nil {
+		return err
+	}
+	// Discards free the volume's blocks; see torusblk nbd.
+	opts = append(opts, "discard")
+	opts = append(opts, mnt.GetMountFlags()...)
+	return run("mount", "-t", fsType, "-o", strings.Join(opts, ","), dev, target)
+}
+
+// format makes a filesystem on dev unless it has one, which has to be of
+// the type asked for.
+func format(dev, fsType string) error {
+	out, err := exec.Command("blkid", "-p", "-s", "TYPE", "-o", "value", dev).Output()
+	if err == nil {
+		if got := strings.TrimSpace(string(out)); got != fsType {
+			return fmt.Errorf("%s already has a %s filesystem, not %s", dev, got, fsType)
+		}
+		return nil
+	}
+	// blkid exits with 2 when it finds nothing on the device; anything else
+	// is a real error, and formatting then could destroy data.
+	if ee, ok := err.(*exec.ExitError); !ok || ee.Sys().(syscall.WaitStatus).ExitStatus() != 2 {
+		return fmt.Errorf("blkid %s: %v", dev, err)
+	}
+	clog.Infof("making a %s filesystem on %s", fsType, dev)
+	return run("mkfs", "-t", fsType, dev)
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// unmount unmounts target if it is mounted, and removes it.
+func unmount(target string) error {
+	err := run("umount", target)
+	if err != nil && !strings.Contains(err.Error(), "not mounted") && !strings.Contains(err.Error(), "no mount point") {
+		if _, serr := os.Stat(target); !os.IsNotExist(serr) {
+			return err
+		}
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *Driver) NodeUnpublishVolume(ctx context.Context, req *spec.NodeUnpublishVolumeRequest) (*spec.NodeUnpublishVolumeResponse, error) {
+	id, target := req.GetVolumeId(), req.GetTargetPath()
+	switch {
+	case id == "":
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	case target == "":
+		return nil, status.Error(codes.InvalidArgument, "target path is required")
+	}
+	if err := unmount(target); err != nil {
+		return nil, status.Errorf(codes.Internal, "couldn't unpublish %s from %s: %v", id, target, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	a := d.attachments[id]
+	if a == nil {
+		return &spec.NodeUnpublishVolumeResponse{}, nil
+	}
+	delete(a.targets, target)
+	if len(a.targets) == 0 {
+		a.detach()
+		delete(d.attachments, id)
+		clog.Infof("detached %s from %s", id, a.dev)
+	}
+	return &spec.NodeUnpublishVolumeResponse{}, nil
+}
+
+func (d *Driver) NodeGetCapabilities(ctx context.Context, req *spec.NodeGetCapabilitiesRequest) (*spec.NodeGetCapabilitiesResponse, error) {
+	// Volumes are attached as they are published, so there is no staging.
+	return &spec.NodeGetCapabilitiesResponse{}, nil
+}
+
+func (d *Driver) NodeGetInfo(ctx context.Context, req *spec.NodeGetInfoRequest) (*spec.NodeGetInfoResponse, error) {
+	return &spec.NodeGetInfoResponse{NodeId: d.nodeID}, nil
+}
+
+func (d *Driver) NodeStageVolume(ctx context.Context, req *spec.NodeStageVolumeRequest) (*spec.NodeStageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (d *Driver) NodeUnstageVolume(ctx context.Context, req *spec.NodeUnstageVolumeRequest) (*spec.NodeUnstageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *spec.NodeGetVolumeStatsRequest) (*spec.NodeGetVolumeStatsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
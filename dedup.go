@@ -0,0 +1,71 @@
+package torus
+
+// DedupMetadataService is implemented by metadata services that can store
+// whether each block volume stores blocks with the same contents once.
+type DedupMetadataService interface {
+	// GetDedup returns whether the volume is deduplicated, which is false
+	// if it was never set.
+	GetDedup(vid VolumeID) (bool, error)
+	SetDedup(vid VolumeID, on bool) error
+}
+
+// DedupBlockset is implemented by blocksets that keep a hash of the contents
+// of their blocks, and make blocks with the same contents share one stored
+// block. Blocks written before the blockset knew their contents are hashed
+// as they're learned.
+type DedupBlockset interface {
+	Blockset
+	// UnhashedBlocks returns the indexes of the written blocks whose
+	// contents the blockset doesn't know yet.
+	UnhashedBlocks() []int
+	// BlockRef returns the ref of the ith block.
+	BlockRef(i int) BlockRef
+	// LearnBlock tells the blockset the contents of the ith block, which
+	// were read from ref. If another stored block has the same contents,
+	// the ith block is made to share it, and LearnBlock returns true; ref
+	// is then left for garbage collection if no other block uses it.
+	LearnBlock(i int, ref BlockRef, data []byte) (bool, error)
+	// DedupStats returns how many written blocks there are, and how many
+	// stored blocks they share.
+	DedupStats() (blocks, stored int)
+}
+
+// UnhashedBlocks returns the indexes of the blocks of the file to learn with
+// DedupBlock, or nil if the file's blockset doesn't deduplicate blocks.
+func (f *File) UnhashedBlocks() []int {
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+	ds, ok := f.blocks.(DedupBlockset)
+	if !ok {
+		return nil
+	}
+	return ds.UnhashedBlocks()
+}
+
+// DedupBlock reads the ith block of the file, and shares it with another
+// block with the same contents if there is one. It returns whether it did.
+func (f *File) DedupBlock(i int) (bool, error) {
+	f.mut.RLock()
+	ds, ok := f.blocks.(DedupBlockset)
+	if !ok {
+		f.mut.RUnlock()
+		return false, ErrNotSupported
+	}
+	ref := ds.BlockRef(i)
+	if ref.IsZero() {
+		f.mut.RUnlock()
+		return false, nil
+	}
+	data, err := f.blocks.GetBlock(WithIOClass(f.getContext(), IOClassBatch), i)
+	f.mut.RUnlock()
+	if err != nil {
+		return false, err
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	err = f.openWrite()
+	if err != nil {
+		return false, err
+	}
+	return ds.LearnBlock(i, ref, data)
+}
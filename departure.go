@@ -0,0 +1,34 @@
+package torus
+
+import "time"
+
+// Departure is announced by a peer that is shutting down on purpose, usually
+// to be restarted. Until it expires, other peers expect the peer back with its
+// data intact, and don't treat it as failed.
+type Departure struct {
+	Peer string `json:"peer"`
+	// Since is when the peer announced it was leaving, in Unix nanoseconds.
+	Since int64 `json:"since"`
+	// Until is when the peer is expected back by, in Unix nanoseconds.
+	Until int64 `json:"until"`
+}
+
+// Expired returns whether the peer should have been back by now.
+func (d *Departure) Expired() bool {
+	return time.Now().UnixNano() > d.Until
+}
+
+// DepartureMetadataService is implemented by metadata services that let peers
+// leave the cluster gracefully.
+type DepartureMetadataService interface {
+	// AnnounceDeparture records that this peer is leaving. Unlike the peer's
+	// heartbeat, it outlives the peer, until d.Until.
+	AnnounceDeparture(d *Departure) error
+	// ClearDeparture removes this peer's departure, once it's back.
+	ClearDeparture() error
+	// GetDepartures returns every departure that hasn't expired.
+	GetDepartures() ([]*Departure, error)
+	// DeregisterPeer removes this peer's heartbeat, and anything else tied to
+	// lease, right away instead of when the lease runs out.
+	DeregisterPeer(lease int64) error
+}
@@ -0,0 +1,669 @@
+package torus
+
+import (
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/torus/models"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+)
+
+// DeviceRing is implemented by rings that place blocks on the devices of
+// peers that have several, and not only on peers.
+type DeviceRing interface {
+	// GetDevices returns the UUIDs of the devices of peer in the order the
+	// ring places key on them, or nothing if the ring doesn't know of any.
+	GetDevices(key BlockRef, peer string) []string
+}
+
+// DeviceReporter is implemented by block stores that span several devices.
+type DeviceReporter interface {
+	// Devices describes each device as a sub-peer: its UUID, the path it's
+	// at as its address, and its total and used blocks.
+	Devices() []*models.PeerInfo
+}
+
+// DevicePlacer is implemented by block stores that can be told which of
+// their devices to keep a block on.
+type DevicePlacer interface {
+	DeviceReporter
+	// SetDevicePlacement sets the function that returns the UUIDs of the
+	// devices a block belongs on, most preferred first. Devices it leaves
+	// out are tried after those it returns.
+	SetDevicePlacement(f func(BlockRef) []string)
+}
+
+// deviceUUIDFile is the file, at the root of a device, holding its UUID.
+const deviceUUIDFile = "device-uuid"
+
+// deviceUUID returns the UUID of the device at path, giving it one if it
+// doesn't have one yet.
+func deviceUUID(path string) (string, error) {
+	filename := filepath.Join(path, deviceUUIDFile)
+	b, err := ioutil.ReadFile(filename)
+	if err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	id := uuid.NewUUID().String()
+	return id, ioutil.WriteFile(filename, []byte(id), 0600)
+}
+
+// openDevices opens a block store of the given kind on each device, and
+// returns them as one.
+func openDevices(kind, name string, cfg Config, gmd GlobalMetadata) (BlockStore, error) {
+	ds := &deviceSet{}
+	for _, dev := range cfg.Devices {
+		err := os.MkdirAll(filepath.Join(dev.Path, "block"), 0700)
+		if err != nil {
+			ds.Close()
+			return nil, err
+		}
+		id, err := deviceUUID(dev.Path)
+		if err != nil {
+			ds.Close()
+			return nil, err
+		}
+		dcfg := cfg
+		dcfg.DataDir = dev.Path
+		dcfg.StorageSize = dev.Size
+		dcfg.Devices = nil
+		store, err := CreateBlockStore(kind, name, dcfg, gmd)
+		if err != nil {
+			ds.Close()
+			return nil, err
+		}
+		clog.Infof("storing blocks on device %s at %s", id, dev.Path)
+		ds.uuids = append(ds.uuids, id)
+		ds.paths = append(ds.paths, dev.Path)
+		ds.stores = append(ds.stores, store)
+		ds.fast = append(ds.fast, dev.Fast)
+		if dev.Fast {
+			ds.fastDevs = append(ds.fastDevs, len(ds.stores)-1)
+		} else {
+			ds.slowDevs = append(ds.slowDevs, len(ds.stores)-1)
+		}
+	}
+	if len(ds.fastDevs) != 0 && len(ds.slowDevs) != 0 {
+		ds.heat = make(map[BlockRef]uint32)
+	}
+	return ds, nil
+}
+
+// deviceSet is a block store made of one block store per device. Each block
+// is kept on one device, the first of its devices that has room.
+//
+// If some devices are fast and others aren't, blocks are written to the
+// tier their volume's policy prefers, and Retier moves them between tiers by
+// how often they're used.
+type deviceSet struct {
+	uuids  []string
+	paths  []string
+	stores []BlockStore
+	fast   []bool
+
+	fastDevs []int
+	slowDevs []int
+
+	mut    sync.RWMutex
+	place  func(BlockRef) []string
+	policy func(VolumeID) TierPolicy
+
+	// heat counts the reads and writes of each block, halved on every
+	// Retier. It's nil if the devices aren't tiered.
+	heatMut sync.Mutex
+	heat    map[BlockRef]uint32
+
+	// moveMut is held to move a block between devices, and shared by
+	// everything else that touches blocks, so that none of them see it on
+	// neither or both.
+	moveMut sync.RWMutex
+}
+
+var (
+	_ BlockStore        = &deviceSet{}
+	_ DevicePlacer      = &deviceSet{}
+	_ BlockVerifier     = &deviceSet{}
+	_ BlockCompressor   = &deviceSet{}
+	_ BlockEncryptor    = &deviceSet{}
+	_ BlockWriterTo     = &deviceSet{}
+	_ HintLog           = &deviceSet{}
+	_ BlockFileReporter = &deviceSet{}
+	_ BlockTierer       = &deviceSet{}
+)
+
+func (ds *deviceSet) SetDevicePlacement(f func(BlockRef) []string) {
+	ds.mut.Lock()
+	defer ds.mut.Unlock()
+	ds.place = f
+}
+
+// order returns the indexes of the devices to look for ref on, or to write
+// it to, in order. Those the placement function doesn't name are ordered by
+// rendezvous hashing, weighted by size. If the devices are tiered, those of
+// the tier the volume's policy prefers come first.
+func (ds *deviceSet) order(ref BlockRef) []int {
+	out := ds.placeOrder(ref)
+	if ds.heat == nil {
+		return out
+	}
+	fastFirst := ds.tierPolicy(ref.Volume()) == TierFast
+	tiered := make([]int, 0, len(out))
+	for _, first := range []bool{fastFirst, !fastFirst} {
+		for _, i := range out {
+			if ds.fast[i] == first {
+				tiered = append(tiered, i)
+			}
+		}
+	}
+	return tiered
+}
+
+func (ds *deviceSet) placeOrder(ref BlockRef) []int {
+	ds.mut.RLock()
+	place := ds.place
+	ds.mut.RUnlock()
+	out := make([]int, 0, len(ds.stores))
+	seen := make([]bool, len(ds.stores))
+	if place != nil {
+		for _, id := range place(ref) {
+			for i, x := range ds.uuids {
+				if x == id && !seen[i] {
+					out = append(out, i)
+					seen[i] = true
+				}
+			}
+		}
+	}
+	if len(out) == len(ds.stores) {
+		return out
+	}
+	key := ref.ToBytes()
+	scores := make([]float64, len(ds.stores))
+	for i, id := range ds.uuids {
+		h := fnv.New64a()
+		h.Write(key)
+		h.Write([]byte(id))
+		// A uniform number in (0, 1).
+		x := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		scores[i] = -float64(ds.stores[i].NumBlocks()) / math.Log(x)
+	}
+	for len(out) < len(ds.stores) {
+		best := -1
+		for i := range ds.stores {
+			if !seen[i] && (best == -1 || scores[i] > scores[best]) {
+				best = i
+			}
+		}
+		out = append(out, best)
+		seen[best] = true
+	}
+	return out
+}
+
+// find returns the index of the device holding ref, or -1.
+func (ds *deviceSet) find(ctx context.Context, ref BlockRef) (int, error) {
+	for _, i := range ds.order(ref) {
+		ok, err := ds.stores[i].HasBlock(ctx, ref)
+		if err != nil {
+			return -1, err
+		}
+		if ok {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func (ds *deviceSet) Kind() string { return ds.stores[0].Kind() }
+
+func (ds *deviceSet) Flush() error {
+	var out error
+	for _, s := range ds.stores {
+		if err := s.Flush(); err != nil && out == nil {
+			out = err
+		}
+	}
+	return out
+}
+
+func (ds *deviceSet) Close() error {
+	var out error
+	for _, s := range ds.stores {
+		if err := s.Close(); err != nil && out == nil {
+			out = err
+		}
+	}
+	return out
+}
+
+func (ds *deviceSet) HasBlock(ctx context.Context, ref BlockRef) (bool, error) {
+	ds.moveMut.RLock()
+	defer ds.moveMut.RUnlock()
+	i, err := ds.find(ctx, ref)
+	return i != -1, err
+}
+
+func (ds *deviceSet) GetBlock(ctx context.Context, ref BlockRef) ([]byte, error) {
+	ds.moveMut.RLock()
+	defer ds.moveMut.RUnlock()
+	ds.touch(ref)
+	i, err := ds.find(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if i == -1 {
+		return nil, ErrBlockNotExist
+	}
+	return ds.stores[i].GetBlock(ctx, ref)
+}
+
+func (ds *deviceSet) WriteBlockTo(ctx context.Context, ref BlockRef, w io.Writer) error {
+	ds.moveMut.RLock()
+	defer ds.moveMut.RUnlock()
+	i, err := ds.find(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if i == -1 {
+		return ErrBlockNotExist
+	}
+	bw, ok := ds.stores[i].(BlockWriterTo)
+	if !ok {
+		return ErrNotSupported
+	}
+	ds.touch(ref)
+	return bw.WriteBlockTo(ctx, ref, w)
+}
+
+func (ds *deviceSet) WriteBlock(ctx context.Context, ref BlockRef, data []byte) error {
+	ds.moveMut.RLock()
+	defer ds.moveMut.RUnlock()
+	ds.touch(ref)
+	i, err := ds.find(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if i != -1 {
+		// Let the device that has it decide if it's the same block.
+		return ds.stores[i].WriteBlock(ctx, ref, data)
+	}
+	for _, i := range ds.order(ref) {
+		err = ds.stores[i].WriteBlock(ctx, ref, data)
+		if err != ErrOutOfSpace {
+			return err
+		}
+	}
+	return ErrOutOfSpace
+}
+
+// WriteBuf isn't supported; which device has room isn't known until the
+// block is written.
+func (ds *deviceSet) WriteBuf(ctx context.Context, ref BlockRef) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+func (ds *deviceSet) DeleteBlock(ctx context.Context, ref BlockRef) error {
+	ds.moveMut.RLock()
+	defer ds.moveMut.RUnlock()
+	i, err := ds.find(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if i == -1 {
+		return ErrBlockNotExist
+	}
+	return ds.stores[i].DeleteBlock(ctx, ref)
+}
+
+func (ds *deviceSet) GetBlockChecksum(ctx context.Context, ref BlockRef) (uint32, error) {
+	ds.moveMut.RLock()
+	defer ds.moveMut.RUnlock()
+	i, err := ds.find(ctx, ref)
+	if err != nil {
+		return 0, err
+	}
+	if i == -1 {
+		return 0, ErrBlockNotExist
+	}
+	return ds.stores[i].GetBlockChecksum(ctx, ref)
+}
+
+func (ds *deviceSet) VerifyBlock(ctx context.Context, ref BlockRef) error {
+	ds.moveMut.RLock()
+	defer ds.moveMut.RUnlock()
+	i, err := ds.find(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if i == -1 {
+		return ErrBlockNotExist
+	}
+	if v, ok := ds.stores[i].(BlockVerifier); ok {
+		return v.VerifyBlock(ctx, ref)
+	}
+	_, err = ds.stores[i].GetBlockChecksum(ctx, ref)
+	return err
+}
+
+func (ds *deviceSet) NumBlocks() uint64 {
+	var n uint64
+	for _, s := range ds.stores {
+		n += s.NumBlocks()
+	}
+	return n
+}
+
+func (ds *deviceSet) UsedBlocks() uint64 {
+	var n uint64
+	for _, s := range ds.stores {
+		n += s.UsedBlocks()
+	}
+	return n
+}
+
+func (ds *deviceSet) BlockSize() uint64 { return ds.stores[0].BlockSize() }
+
+func (ds *deviceSet) BlockIterator() BlockIterator {
+	its := make([]BlockIterator, len(ds.stores))
+	for i, s := range ds.stores {
+		its[i] = s.BlockIterator()
+	}
+	return &deviceIterator{its: its}
+}
+
+func (ds *deviceSet) Devices() []*models.PeerInfo {
+	out := make([]*models.PeerInfo, len(ds.stores))
+	for i, s := range ds.stores {
+		out[i] = &models.PeerInfo{
+			UUID:        ds.uuids[i],
+			Address:     ds.paths[i],
+			TotalBlocks: s.NumBlocks(),
+			UsedBlocks:  s.UsedBlocks(),
+		}
+	}
+	return out
+}
+
+func (ds *deviceSet) SetCompressionPolicy(f func(VolumeID) bool) {
+	for _, s := range ds.stores {
+		if c, ok := s.(BlockCompressor); ok {
+			c.SetCompressionPolicy(f)
+		}
+	}
+}
+
+func (ds *deviceSet) SetKeyringFunc(f func(VolumeID) (*Keyring, error)) {
+	for _, s := range ds.stores {
+		if e, ok := s.(BlockEncryptor); ok {
+			e.SetKeyringFunc(f)
+		}
+	}
+}
+
+// FileOptions reports an option as in use only if every device uses it.
+func (ds *deviceSet) FileOptions() BlockFileOptions {
+	out := BlockFileOptions{DirectIO: true, Preallocated: true}
+	for _, s := range ds.stores {
+		var opts BlockFileOptions
+		if r, ok := s.(BlockFileReporter); ok {
+			opts = r.FileOptions()
+		}
+		out.DirectIO = out.DirectIO && opts.DirectIO
+		out.Preallocated = out.Preallocated && opts.Preallocated
+	}
+	return out
+}
+
+// Hints are kept on the first device.
+
+func (ds *deviceSet) AddHint(peer string, ref BlockRef) error {
+	if hl, ok := ds.stores[0].(HintLog); ok {
+		return hl.AddHint(peer, ref)
+	}
+	return ErrNotSupported
+}
+
+func (ds *deviceSet) RemoveHint(peer string, ref BlockRef) error {
+	if hl, ok := ds.stores[0].(HintLog); ok {
+		return hl.RemoveHint(peer, ref)
+	}
+	return ErrNotSupported
+}
+
+func (ds *deviceSet) HintedPeers() []string {
+	if hl, ok := ds.stores[0].(HintLog); ok {
+		return hl.HintedPeers()
+	}
+	return nil
+}
+
+func (ds *deviceSet) Hints(peer string) []BlockRef {
+	if hl, ok := ds.stores[0].(HintLog); ok {
+		return hl.Hints(peer)
+	}
+	return nil
+}
+
+func (ds *deviceSet) SetTierPolicy(f func(VolumeID) TierPolicy) {
+	ds.mut.Lock()
+	defer ds.mut.Unlock()
+	ds.policy = f
+}
+
+func (ds *deviceSet) tierPolicy(vid VolumeID) TierPolicy {
+	ds.mut.RLock()
+	f := ds.policy
+	ds.mut.RUnlock()
+	if f == nil {
+		return TierAuto
+	}
+	return f(vid)
+}
+
+// touch counts a read or write of a block.
+func (ds *deviceSet) touch(ref BlockRef) {
+	if ds.heat == nil {
+		return
+	}
+	ds.heatMut.Lock()
+	defer ds.heatMut.Unlock()
+	if h := ds.heat[ref]; h != math.MaxUint32 {
+		ds.heat[ref] = h + 1
+	}
+}
+
+const (
+	// tierPromoteHeat is how many times a block of a TierAuto volume must
+	// be used, counting the uses before the last Retier at half, before it
+	// is moved to the fast tier.
+	tierPromoteHeat = 4
+	// tierHighWater is how full the fast tier may get before its coldest
+	// blocks are moved to the slow tier to make room.
+	tierHighWater = 0.9
+)
+
+func (ds *deviceSet) Retier(ctx context.Context, n int) (promoted, demoted int, err error) {
+	if ds.heat == nil {
+		return 0, 0, nil
+	}
+	// Take the heat since the last pass, and halve it for the next.
+	ds.heatMut.Lock()
+	heat := make(map[BlockRef]uint32, len(ds.heat))
+	for ref, h := range ds.heat {
+		heat[ref] = h
+		if h/2 == 0 {
+			delete(ds.heat, ref)
+		} else {
+			ds.heat[ref] = h / 2
+		}
+	}
+	ds.heatMut.Unlock()
+
+	var up, down, cold []BlockRef
+	for _, i := range ds.slowDevs {
+		it := ds.stores[i].BlockIterator()
+		for it.Next() {
+			ref := it.BlockRef()
+			switch ds.tierPolicy(ref.Volume()) {
+			case TierFast:
+				up = append(up, ref)
+			case TierAuto:
+				if heat[ref] >= tierPromoteHeat {
+					up = append(up, ref)
+				}
+			}
+		}
+		it.Close()
+	}
+	var fastUsed, fastTotal uint64
+	for _, i := range ds.fastDevs {
+		fastUsed += ds.stores[i].UsedBlocks()
+		fastTotal += ds.stores[i].NumBlocks()
+		it := ds.stores[i].BlockIterator()
+		for it.Next() {
+			ref := it.BlockRef()
+			switch ds.tierPolicy(ref.Volume()) {
+			case TierSlow:
+				down = append(down, ref)
+			case TierAuto:
+				if heat[ref] == 0 {
+					cold = append(cold, ref)
+				}
+			}
+		}
+		it.Close()
+	}
+	// Hottest first.
+	sort.Sort(byHeat{up, heat})
+
+	// Make room for what's coming, if the fast tier would be too full.
+	over := int64(fastUsed) - int64(len(down)) + int64(len(up)) - int64(tierHighWater*float64(fastTotal))
+	for i := 0; int64(i) < over && i < len(cold); i++ {
+		down = append(down, cold[i])
+	}
+
+	for _, ref := range down {
+		if promoted+demoted >= n {
+			break
+		}
+		if ds.move(ctx, ref, false) {
+			demoted++
+			promTierDemoted.Inc()
+		}
+	}
+	for _, ref := range up {
+		if promoted+demoted >= n {
+			break
+		}
+		if ds.move(ctx, ref, true) {
+			promoted++
+			promTierPromoted.Inc()
+		}
+	}
+	fastUsed = 0
+	for _, i := range ds.fastDevs {
+		fastUsed += ds.stores[i].UsedBlocks()
+	}
+	if fastTotal != 0 {
+		promTierFastUsed.Set(float64(fastUsed) / float64(fastTotal))
+	}
+	return promoted, demoted, nil
+}
+
+// move moves a block to the fast or slow tier, and returns whether it did.
+func (ds *deviceSet) move(ctx context.Context, ref BlockRef, fast bool) bool {
+	ds.moveMut.Lock()
+	defer ds.moveMut.Unlock()
+	src, err := ds.find(ctx, ref)
+	if err != nil || src == -1 || ds.fast[src] == fast {
+		// Deleted, or moved, since Retier looked.
+		return false
+	}
+	data, err := ds.stores[src].GetBlock(ctx, ref)
+	if err != nil {
+		clog.Warningf("couldn't read block %s to move it between tiers: %v", ref, err)
+		promTierMovesFailed.Inc()
+		return false
+	}
+	err = ErrOutOfSpace
+	for _, i := range ds.placeOrder(ref) {
+		if ds.fast[i] != fast {
+			continue
+		}
+		err = ds.stores[i].WriteBlock(ctx, ref, data)
+		if err != ErrOutOfSpace {
+			break
+		}
+	}
+	if err == ErrOutOfSpace {
+		// Not a failure; the tier is full.
+		return false
+	}
+	if err != nil {
+		clog.Warningf("couldn't move block %s between tiers: %v", ref, err)
+		promTierMovesFailed.Inc()
+		return false
+	}
+	err = ds.stores[src].DeleteBlock(ctx, ref)
+	if err != nil {
+		clog.Warningf("couldn't delete block %s after moving it between tiers: %v", ref, err)
+		promTierMovesFailed.Inc()
+	}
+	return true
+}
+
+type byHeat struct {
+	refs []BlockRef
+	heat map[BlockRef]uint32
+}
+
+func (b byHeat) Len() int           { return len(b.refs) }
+func (b byHeat) Less(i, j int) bool { return b.heat[b.refs[i]] > b.heat[b.refs[j]] }
+func (b byHeat) Swap(i, j int)      { b.refs[i], b.refs[j] = b.refs[j], b.refs[i] }
+
+// deviceIterator iterates over the blocks of each device in turn.
+type deviceIterator struct {
+	its []BlockIterator
+	err error
+}
+
+func (it *deviceIterator) Err() error { return it.err }
+
+func (it *deviceIterator) Next() bool {
+	for len(it.its) > 0 {
+		if it.its[0].Next() {
+			return true
+		}
+		if err := it.its[0].Err(); err != nil {
+			it.err = err
+			return false
+		}
+		it.its[0].Close()
+		it.its = it.its[1:]
+	}
+	return false
+}
+
+func (it *deviceIterator) BlockRef() BlockRef { return it.its[0].BlockRef() }
+
+func (it *deviceIterator) Close() error {
+	var out error
+	for _, x := range it.its {
+		if err := x.Close(); err != nil && out == nil {
+			out = err
+		}
+	}
+	it.its = nil
+	return out
+}
@@ -0,0 +1,146 @@
+package torus_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	_ "github.com/coreos/torus/metadata/temp"
+	_ "github.com/coreos/torus/storage"
+)
+
+func TestDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := torus.Config{
+		DataDir: filepath.Join(dir, "data"),
+		Devices: []torus.Device{
+			{Path: filepath.Join(dir, "disk1"), Size: 64 * 1024 * 1024},
+			{Path: filepath.Join(dir, "disk2"), Size: 64 * 1024 * 1024},
+		},
+	}
+	srv, err := torus.NewServer(cfg, "temp", "mfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	bs := srv.Blocks.BlockSize()
+	for i := 0; i < 64; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		data := make([]byte, bs)
+		data[0] = byte(i)
+		if err := srv.Blocks.WriteBlock(ctx, ref, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	devs := srv.Blocks.(torus.DeviceReporter).Devices()
+	if len(devs) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devs))
+	}
+	for _, d := range devs {
+		if d.UsedBlocks == 0 {
+			t.Errorf("expected blocks on device %s at %s", d.UUID, d.Address)
+		}
+	}
+	if srv.Blocks.UsedBlocks() != 64 {
+		t.Fatalf("expected 64 blocks, got %d", srv.Blocks.UsedBlocks())
+	}
+	for i := 0; i < 64; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		data, err := srv.Blocks.GetBlock(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != byte(i) {
+			t.Fatalf("block %d reads back differently", i)
+		}
+	}
+	n := 0
+	it := srv.Blocks.BlockIterator()
+	for it.Next() {
+		n++
+	}
+	it.Close()
+	if n != 64 {
+		t.Fatalf("expected to iterate over 64 blocks, got %d", n)
+	}
+	srv.Close()
+}
+
+func TestDeviceTiering(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-tiering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := torus.Config{
+		DataDir: filepath.Join(dir, "data"),
+		Devices: []torus.Device{
+			{Path: filepath.Join(dir, "ssd"), Size: 64 * 1024 * 1024, Fast: true},
+			{Path: filepath.Join(dir, "hdd"), Size: 64 * 1024 * 1024},
+		},
+	}
+	srv, err := torus.NewServer(cfg, "temp", "mfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ctx := context.TODO()
+	bt := srv.Blocks.(torus.BlockTierer)
+	policy := map[torus.VolumeID]torus.TierPolicy{2: torus.TierFast}
+	bt.SetTierPolicy(func(vid torus.VolumeID) torus.TierPolicy { return policy[vid] })
+	usedFast := func() uint64 {
+		return srv.Blocks.(torus.DeviceReporter).Devices()[0].UsedBlocks
+	}
+	data := make([]byte, srv.Blocks.BlockSize())
+	for i := 0; i < 8; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		if err := srv.Blocks.WriteBlock(ctx, ref, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pinned := torus.BlockRef{INodeRef: torus.NewINodeRef(2, 1), Index: 1}
+	if err := srv.Blocks.WriteBlock(ctx, pinned, data); err != nil {
+		t.Fatal(err)
+	}
+	if usedFast() != 1 {
+		t.Fatalf("expected only the pinned block on the fast device, got %d blocks", usedFast())
+	}
+
+	hot := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 3}
+	for i := 0; i < 5; i++ {
+		if _, err := srv.Blocks.GetBlock(ctx, hot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	promoted, demoted, err := bt.Retier(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted != 1 || demoted != 0 || usedFast() != 2 {
+		t.Fatalf("expected the hot block promoted, got %d promoted, %d demoted, %d fast", promoted, demoted, usedFast())
+	}
+	if _, err := srv.Blocks.GetBlock(ctx, hot); err != nil {
+		t.Fatal(err)
+	}
+
+	policy[1] = torus.TierSlow
+	policy[2] = torus.TierSlow
+	promoted, demoted, err = bt.Retier(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted != 0 || demoted != 2 || usedFast() != 0 {
+		t.Fatalf("expected everything demoted, got %d promoted, %d demoted, %d fast", promoted, demoted, usedFast())
+	}
+	if srv.Blocks.UsedBlocks() != 9 {
+		t.Fatalf("expected 9 blocks, got %d", srv.Blocks.UsedBlocks())
+	}
+}
@@ -0,0 +1,55 @@
+package distributor
+
+import (
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// checkAccess returns ErrPermissionDenied if the client a request came from
+// may not do want with the volume. Requests from other processes carry the
+// identity their client authenticated as, with a certificate or a token, or
+// the empty identity if it didn't, which no ACL allows anything. Those made
+// within the process carry none and are let through. If the ACLs can't be
+// looked up, access is denied.
+func (d *Distributor) checkAccess(ctx context.Context, vid torus.VolumeID, want torus.Permission) error {
+	identity, ok := torus.Identity(ctx)
+	if !ok {
+		return nil
+	}
+	acl, err := d.volumeACL(vid)
+	if err == nil && len(acl) == 0 {
+		return nil
+	}
+	var cluster torus.ACL
+	if err == nil {
+		cluster, err = d.volumeACL(torus.ClusterACL)
+	}
+	if err != nil || identity == "" || !torus.Allows(acl, cluster, identity, want) {
+		promDistACLDenied.Inc()
+		if identity == "" {
+			identity = "an unauthenticated client"
+		}
+		clog.Warningf("denying %s access to volume %d for %s", want, vid, identity)
+		return torus.ErrPermissionDenied
+	}
+	return nil
+}
+
+func (d *Distributor) volumeACL(vid torus.VolumeID) (torus.ACL, error) {
+	amds, ok := d.srv.MDS.(torus.ACLMetadataService)
+	if !ok {
+		return nil, nil
+	}
+	acl, err := d.policies.get(vid, policyACL, func(interface{}) (interface{}, error) {
+		acl, err := amds.GetACL(vid)
+		if err != nil {
+			clog.Errorf("couldn't get ACL for volume %d: %v", vid, err)
+			return nil, err
+		}
+		return acl, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acl.(torus.ACL), nil
+}
@@ -0,0 +1,66 @@
+package distributor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"golang.org/x/net/context"
+)
+
+// flakyACLs fails to look up ACLs once broken is set.
+type flakyACLs struct {
+	torus.MetadataService
+	broken bool
+}
+
+func (f *flakyACLs) GetACL(vid torus.VolumeID) (torus.ACL, error) {
+	if f.broken {
+		return nil, errors.New("etcd is down")
+	}
+	return f.MetadataService.(torus.ACLMetadataService).GetACL(vid)
+}
+
+func (f *flakyACLs) ModifyACL(vid torus.VolumeID, fn func(torus.ACL) (torus.ACL, error)) error {
+	return f.MetadataService.(torus.ACLMetadataService).ModifyACL(vid, fn)
+}
+
+func TestCheckAccess(t *testing.T) {
+	srv := newServer(temp.NewServer())
+	defer srv.Close()
+	mds := &flakyACLs{MetadataService: srv.MDS}
+	srv.MDS = mds
+	d := &Distributor{srv: srv}
+	err := torus.SetPermission(mds, "cn:alice", 1, "cn:bob", torus.PermRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		ctx  context.Context
+		vid  torus.VolumeID
+		want error
+	}{
+		{context.TODO(), 1, nil},
+		{torus.WithIdentity(context.TODO(), "cn:bob"), 1, nil},
+		{torus.WithIdentity(context.TODO(), "cn:eve"), 1, torus.ErrPermissionDenied},
+		{torus.WithIdentity(context.TODO(), ""), 1, torus.ErrPermissionDenied},
+		// Volumes without an ACL are open to everyone.
+		{torus.WithIdentity(context.TODO(), ""), 2, nil},
+	} {
+		if err := d.checkAccess(tt.ctx, tt.vid, torus.PermRead); err != tt.want {
+			t.Errorf("volume %d: expected %v, got %v", tt.vid, tt.want, err)
+		}
+	}
+
+	// A lookup that fails denies access rather than trusting what was
+	// cached, or nothing.
+	d.policies = policyCache{}
+	mds.broken = true
+	for _, vid := range []torus.VolumeID{1, 2} {
+		ctx := torus.WithIdentity(context.TODO(), "cn:bob")
+		if err := d.checkAccess(ctx, vid, torus.PermRead); err != torus.ErrPermissionDenied {
+			t.Errorf("volume %d: expected a failed lookup to deny access, got %v", vid, err)
+		}
+	}
+}
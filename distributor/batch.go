@@ -0,0 +1,145 @@
+package distributor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// sendBatchFunc sends blocks to a peer in one request, as written under
+// epoch.
+type sendBatchFunc func(peer string, epoch uint64, refs []torus.BlockRef, blocks [][]byte) error
+
+// writeBatcher coalesces the blocks written to the same peer into batches.
+// A write to a peer with nothing in flight is sent straight away, or after
+// the batch interval; writes that come in while a batch is in flight queue
+// up and go out together when it's done, or as soon as there are enough of
+// them to fill a batch. Sequential writes to the same volume tend to end up
+// in the same batch in order, so the peer writes them out close together.
+type writeBatcher struct {
+	send     sendBatchFunc
+	max      int
+	interval time.Duration
+
+	mut     sync.Mutex
+	batches map[batchKey]*peerBatch
+}
+
+// batchKey groups writes by where they go, and the epoch they were written
+// under, which the peer checks once per request.
+type batchKey struct {
+	peer  string
+	epoch uint64
+}
+
+type pendingWrite struct {
+	ref  torus.BlockRef
+	data []byte
+	done chan error
+}
+
+type peerBatch struct {
+	pending  []pendingWrite
+	inflight int
+	timer    *time.Timer
+}
+
+func newWriteBatcher(send sendBatchFunc, max int, interval time.Duration) *writeBatcher {
+	return &writeBatcher{
+		send:     send,
+		max:      max,
+		interval: interval,
+		batches:  make(map[batchKey]*peerBatch),
+	}
+}
+
+// put writes a block to peer as part of a batch, and waits for the batch
+// to be written.
+func (w *writeBatcher) put(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error {
+	key := batchKey{peer: peer, epoch: torus.WriteEpoch(ctx)}
+	pw := pendingWrite{ref: ref, data: data, done: make(chan error, 1)}
+	w.mut.Lock()
+	pb, ok := w.batches[key]
+	if !ok {
+		pb = &peerBatch{}
+		w.batches[key] = pb
+	}
+	pb.pending = append(pb.pending, pw)
+	w.flush(key, pb)
+	w.mut.Unlock()
+	select {
+	case err := <-pw.done:
+		return err
+	case <-ctx.Done():
+		// The block may still be written, which does no harm.
+		return torus.ErrBlockUnavailable
+	}
+}
+
+// flush sends whatever of pb is due. w.mut must be held.
+func (w *writeBatcher) flush(key batchKey, pb *peerBatch) {
+	for len(pb.pending) >= w.max {
+		w.sendLocked(key, pb)
+	}
+	if len(pb.pending) == 0 || pb.inflight != 0 {
+		return
+	}
+	if w.interval == 0 {
+		w.sendLocked(key, pb)
+		return
+	}
+	if pb.timer == nil {
+		pb.timer = time.AfterFunc(w.interval, func() {
+			w.mut.Lock()
+			defer w.mut.Unlock()
+			pb.timer = nil
+			if pb.inflight != 0 {
+				return
+			}
+			if len(pb.pending) != 0 {
+				w.sendLocked(key, pb)
+				return
+			}
+			delete(w.batches, key)
+		})
+	}
+}
+
+func (w *writeBatcher) sendLocked(key batchKey, pb *peerBatch) {
+	n := len(pb.pending)
+	if n > w.max {
+		n = w.max
+	}
+	batch := pb.pending[:n:n]
+	pb.pending = pb.pending[n:]
+	pb.inflight++
+	go func() {
+		refs := make([]torus.BlockRef, len(batch))
+		blocks := make([][]byte, len(batch))
+		for i, pw := range batch {
+			refs[i] = pw.ref
+			blocks[i] = pw.data
+		}
+		promDistWriteBatchBlocks.Observe(float64(len(batch)))
+		err := w.send(key.peer, key.epoch, refs, blocks)
+		for _, pw := range batch {
+			pw.done <- err
+		}
+		w.mut.Lock()
+		defer w.mut.Unlock()
+		pb.inflight--
+		if pb.inflight != 0 {
+			return
+		}
+		if len(pb.pending) != 0 {
+			// These have waited long enough.
+			w.sendLocked(key, pb)
+			return
+		}
+		if pb.timer == nil {
+			delete(w.batches, key)
+		}
+	}()
+}
@@ -0,0 +1,88 @@
+package distributor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+func TestWriteBatcher(t *testing.T) {
+	var mut sync.Mutex
+	var sizes []int
+	written := make(map[torus.BlockRef]bool)
+	release := make(chan struct{})
+	errBad := errors.New("bad peer")
+	send := func(peer string, epoch uint64, refs []torus.BlockRef, blocks [][]byte) error {
+		<-release
+		mut.Lock()
+		defer mut.Unlock()
+		if peer == "bad" {
+			return errBad
+		}
+		sizes = append(sizes, len(refs))
+		for i, ref := range refs {
+			if int(blocks[i][0]) != int(ref.Index) {
+				t.Errorf("block %s sent with the wrong data", ref)
+			}
+			written[ref] = true
+		}
+		return nil
+	}
+	w := newWriteBatcher(send, 4, 0)
+
+	// The first write goes out on its own; the rest queue behind it and go
+	// out in batches of at most 4.
+	var wg sync.WaitGroup
+	put := func(peer string, i int) {
+		defer wg.Done()
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		err := w.put(context.TODO(), peer, ref, []byte{byte(i)})
+		if peer == "bad" && err != errBad {
+			t.Errorf("expected the batch's error, got %v", err)
+		}
+		if peer != "bad" && err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(1)
+	go put("a", 0)
+	for {
+		w.mut.Lock()
+		n := len(w.batches)
+		w.mut.Unlock()
+		if n != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i <= 6; i++ {
+		wg.Add(1)
+		go put("a", i)
+	}
+	wg.Add(1)
+	go put("bad", 7)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if len(written) != 7 {
+		t.Fatalf("expected 7 blocks written, got %d", len(written))
+	}
+	for _, n := range sizes {
+		if n > 4 {
+			t.Fatalf("sent a batch of %d blocks", n)
+		}
+	}
+	if len(sizes) >= 7 {
+		t.Fatalf("no writes were batched: %v", sizes)
+	}
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if len(w.batches) != 0 {
+		t.Fatalf("%d peers left with batches", len(w.batches))
+	}
+}
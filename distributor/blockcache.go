@@ -0,0 +1,195 @@
+package distributor
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/coreos/torus"
+)
+
+// readCacheDirName is the directory, under the configured one, that the
+// on-disk read cache keeps its blocks in. It's emptied on startup; blocks
+// may have been deleted or the ring changed while we were down.
+const readCacheDirName = "torus-read-cache"
+
+// cachedBlock is a block in the read cache, with what it was valid as of.
+type cachedBlock struct {
+	data []byte
+	ring int
+	gen  uint64
+}
+
+// blockCache is the read cache of blocks read through the distributor. It
+// keeps the most recently used blocks in memory and, if it has a
+// directory, the ones pushed out of memory on disk.
+//
+// Blocks don't change once written, but every cached block is tagged with
+// the ring version and the generation of its volume as of when it was
+// cached, and isn't returned after either changes: blocks are rewritten by
+// recovery and repair after ring changes, and a restored volume no longer
+// refers to blocks written since the snapshot.
+type blockCache struct {
+	mem  *cache
+	disk *cache
+	dir  string
+
+	mut  sync.RWMutex
+	ring int
+	gens map[torus.VolumeID]uint64
+}
+
+func newBlockCache(size int, dir string, diskSize int) (*blockCache, error) {
+	bc := &blockCache{
+		mem:  newCache(size),
+		gens: make(map[torus.VolumeID]uint64),
+	}
+	if dir == "" || diskSize == 0 {
+		return bc, nil
+	}
+	bc.dir = filepath.Join(dir, readCacheDirName)
+	err := os.RemoveAll(bc.dir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(bc.dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	bc.disk = newCache(diskSize)
+	bc.disk.evicted = func(key string, _ interface{}) {
+		os.Remove(bc.path(key))
+	}
+	bc.mem.evicted = func(key string, value interface{}) {
+		bc.putDisk(key, value.(cachedBlock))
+	}
+	return bc, nil
+}
+
+func (bc *blockCache) path(key string) string {
+	return filepath.Join(bc.dir, hex.EncodeToString([]byte(key)))
+}
+
+func (bc *blockCache) putDisk(key string, b cachedBlock) {
+	if !bc.valid(torus.BlockRefFromBytes([]byte(key)), b) {
+		return
+	}
+	err := ioutil.WriteFile(bc.path(key), b.data, 0600)
+	if err != nil {
+		clog.Warningf("couldn't write block to the read cache: %v", err)
+		promDistBlockDiskCacheErrors.Inc()
+		return
+	}
+	b.data = nil
+	bc.disk.Put(key, b)
+}
+
+// valid returns whether a cached block is still good to use.
+func (bc *blockCache) valid(ref torus.BlockRef, b cachedBlock) bool {
+	bc.mut.RLock()
+	defer bc.mut.RUnlock()
+	return b.ring == bc.ring && b.gen == bc.gens[ref.Volume()]
+}
+
+func (bc *blockCache) Get(ref torus.BlockRef) ([]byte, bool) {
+	if bc == nil {
+		return nil, false
+	}
+	key := string(ref.ToBytes())
+	if v, ok := bc.mem.Get(key); ok {
+		b := v.(cachedBlock)
+		if bc.valid(ref, b) {
+			promDistBlockCacheHits.Inc()
+			return b.data, true
+		}
+		bc.mem.Remove(key)
+		return nil, false
+	}
+	if bc.disk == nil {
+		return nil, false
+	}
+	v, ok := bc.disk.Get(key)
+	if !ok {
+		return nil, false
+	}
+	b := v.(cachedBlock)
+	if !bc.valid(ref, b) {
+		bc.removeDisk(key)
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(bc.path(key))
+	if err != nil {
+		clog.Warningf("couldn't read block from the read cache: %v", err)
+		promDistBlockDiskCacheErrors.Inc()
+		bc.removeDisk(key)
+		return nil, false
+	}
+	promDistBlockDiskCacheHits.Inc()
+	// Back into memory with it, as the most recently used.
+	bc.removeDisk(key)
+	b.data = data
+	bc.mem.Put(key, b)
+	return data, true
+}
+
+func (bc *blockCache) Put(ref torus.BlockRef, data []byte) {
+	if bc == nil {
+		return
+	}
+	bc.mut.RLock()
+	b := cachedBlock{data: data, ring: bc.ring, gen: bc.gens[ref.Volume()]}
+	bc.mut.RUnlock()
+	key := string(ref.ToBytes())
+	// A block that's no longer valid may still be there.
+	bc.mem.Remove(key)
+	bc.mem.Put(key, b)
+}
+
+func (bc *blockCache) Remove(ref torus.BlockRef) {
+	if bc == nil {
+		return
+	}
+	key := string(ref.ToBytes())
+	bc.mem.Remove(key)
+	if bc.disk != nil {
+		bc.removeDisk(key)
+	}
+}
+
+func (bc *blockCache) removeDisk(key string) {
+	if _, ok := bc.disk.Get(key); ok {
+		bc.disk.Remove(key)
+		os.Remove(bc.path(key))
+	}
+}
+
+// SetRing invalidates every block cached before the ring changed to
+// version.
+func (bc *blockCache) SetRing(version int) {
+	if bc == nil {
+		return
+	}
+	bc.mut.Lock()
+	defer bc.mut.Unlock()
+	bc.ring = version
+}
+
+// InvalidateVolume invalidates every block of the volume cached so far.
+func (bc *blockCache) InvalidateVolume(vid torus.VolumeID) {
+	if bc == nil {
+		return
+	}
+	bc.mut.Lock()
+	defer bc.mut.Unlock()
+	bc.gens[vid]++
+}
+
+// Close removes the blocks cached on disk.
+func (bc *blockCache) Close() error {
+	if bc == nil || bc.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(bc.dir)
+}
@@ -0,0 +1,69 @@
+package distributor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+func TestBlockCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-blockcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bc, err := newBlockCache(2, dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	refs := make([]torus.BlockRef, 4)
+	for i := range refs {
+		refs[i] = torus.BlockRef{
+			INodeRef: torus.NewINodeRef(torus.VolumeID(1+i%2), 1),
+			Index:    torus.IndexID(i),
+		}
+		bc.Put(refs[i], bytes.Repeat([]byte{byte(i)}, 16))
+	}
+	// The first two were pushed out of memory onto disk.
+	files, err := ioutil.ReadDir(filepath.Join(dir, readCacheDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 blocks on disk, got %d", len(files))
+	}
+	for i, ref := range refs {
+		data, ok := bc.Get(ref)
+		if !ok {
+			t.Fatalf("block %d not cached", i)
+		}
+		if !bytes.Equal(data, bytes.Repeat([]byte{byte(i)}, 16)) {
+			t.Fatalf("block %d came back wrong", i)
+		}
+	}
+
+	bc.InvalidateVolume(1)
+	for i, ref := range refs {
+		_, ok := bc.Get(ref)
+		if want := i%2 == 1; ok != want {
+			t.Fatalf("block %d: expected cached %v after invalidating volume 1, got %v", i, want, ok)
+		}
+	}
+	bc.Put(refs[0], []byte{0})
+	if _, ok := bc.Get(refs[0]); !ok {
+		t.Fatal("block cached after invalidation not returned")
+	}
+
+	bc.SetRing(2)
+	for i, ref := range refs {
+		if _, ok := bc.Get(ref); ok {
+			t.Fatalf("block %d returned after the ring changed", i)
+		}
+	}
+}
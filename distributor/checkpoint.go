@@ -0,0 +1,93 @@
+package distributor
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// How often a rebalance pass saves its progress.
+var rebalanceCheckpointInterval = 10 * time.Second
+
+type checkpointState struct {
+	lastSave time.Time
+	// saved is set while there's a checkpoint to clear when the pass ends.
+	saved bool
+}
+
+// resumeRebalance picks up the checkpoint left by the last run, if any, so
+// that the first pass doesn't go over blocks it already finished with.
+func (d *Distributor) resumeRebalance() {
+	cmds, ok := d.srv.MDS.(torus.RebalanceCheckpointService)
+	if !ok {
+		return
+	}
+	cp, err := cmds.GetRebalanceCheckpoint()
+	if err != nil {
+		clog.Errorf("couldn't get rebalance checkpoint: %v", err)
+		return
+	}
+	if cp == nil {
+		return
+	}
+	d.checkpoint.saved = true
+	if cp.RingVersion != d.ring.Version() {
+		clog.Infof("ring changed from %d to %d since the last rebalance checkpoint; starting over", cp.RingVersion, d.ring.Version())
+		return
+	}
+	d.rebalancer.ResumeAfter(cp.RingVersion, cp.Last)
+}
+
+// saveRebalanceCheckpoint saves how far the current pass has got, at most
+// every rebalanceCheckpointInterval, or clears it once the pass is done.
+func (d *Distributor) saveRebalanceCheckpoint(passDone bool) {
+	cmds, ok := d.srv.MDS.(torus.RebalanceCheckpointService)
+	if !ok {
+		return
+	}
+	if passDone {
+		if !d.checkpoint.saved {
+			return
+		}
+		err := cmds.SaveRebalanceCheckpoint(nil)
+		if err != nil {
+			clog.Errorf("couldn't clear rebalance checkpoint: %v", err)
+			return
+		}
+		d.checkpoint.saved = false
+		return
+	}
+	if time.Since(d.checkpoint.lastSave) < rebalanceCheckpointInterval {
+		return
+	}
+	version, last, ok := d.rebalancer.Position()
+	if !ok {
+		return
+	}
+	d.checkpoint.lastSave = time.Now()
+	err := cmds.SaveRebalanceCheckpoint(&torus.RebalanceCheckpoint{
+		Peer:        d.UUID(),
+		RingVersion: version,
+		Last:        last,
+		Saved:       d.checkpoint.lastSave.UnixNano(),
+	})
+	if err != nil {
+		clog.Errorf("couldn't save rebalance checkpoint: %v", err)
+		return
+	}
+	d.checkpoint.saved = true
+}
+
+// rebalanceDelay is how long to wait after a rebalance tick that sent
+// written blocks, to keep under the configured rate.
+func (d *Distributor) rebalanceDelay(written int) time.Duration {
+	delay := 2 * time.Duration(written+1) * time.Millisecond
+	rate := d.srv.Cfg.RebalanceRate
+	if rate != 0 {
+		bytes := float64(uint64(written) * d.blocks.BlockSize())
+		if capped := time.Duration(bytes / float64(rate) * float64(time.Second)); capped > delay {
+			delay = capped
+		}
+	}
+	return d.throttled(delay)
+}
@@ -2,7 +2,6 @@ package distributor
 
 import (
 	"net/url"
-	"sync"
 	"time"
 
 	"github.com/coreos/torus"
@@ -20,43 +19,40 @@ const (
 // TODO(barakmich): Clean up errors
 
 type distClient struct {
-	dist *Distributor
-	//TODO(barakmich): Better connection pooling
-	openConns map[string]protocols.RPC
-	mut       sync.Mutex
+	dist  *Distributor
+	pool  *connPool
+	sched *peerScheduler
+	// batch is nil if writes aren't batched.
+	batch *writeBatcher
 }
 
 func newDistClient(d *Distributor) *distClient {
 
 	client := &distClient{
-		dist:      d,
-		openConns: make(map[string]protocols.RPC),
+		dist:  d,
+		sched: newPeerScheduler(maxPeerRequests),
+	}
+	client.pool = newConnPool(client.dial, d.srv.Cfg.PeerConns, d.srv.Cfg.PeerConnIdleTimeout)
+	if n := d.srv.Cfg.WriteBatchSize; n > 1 {
+		client.batch = newWriteBatcher(client.putBatch, n, d.srv.Cfg.WriteBatchInterval)
 	}
 	d.srv.AddTimeoutCallback(client.onPeerTimeout)
 	return client
 }
 
 func (d *distClient) onPeerTimeout(uuid string) {
-	d.mut.Lock()
-	defer d.mut.Unlock()
-	conn, ok := d.openConns[uuid]
-	if !ok {
-		return
-	}
-	err := conn.Close()
-	if err != nil {
-		clog.Errorf("peer timeout err on close: %s", err)
-	}
-	delete(d.openConns, uuid)
+	d.pool.closePeer(uuid)
+}
 
+// getConn returns a connection to the peer from the pool, or nil if it
+// can't be reached, and the function to hand it back with once the request
+// is done. Handing it back with an error closes it.
+func (d *distClient) getConn(uuid string) (protocols.RPC, func(error)) {
+	return d.pool.get(uuid)
 }
-func (d *distClient) getConn(uuid string) protocols.RPC {
-	d.mut.Lock()
-	if conn, ok := d.openConns[uuid]; ok {
-		d.mut.Unlock()
-		return conn
-	}
-	d.mut.Unlock()
+
+// dial opens a new connection to the peer.
+func (d *distClient) dial(uuid string) (protocols.RPC, error) {
 	pm := d.dist.srv.GetPeerMap()
 	pi := pm[uuid]
 	if pi == nil {
@@ -65,93 +61,326 @@ func (d *distClient) getConn(uuid string) protocols.RPC {
 		pi = pm[uuid]
 		if pi == nil {
 			// Not much more we can try
-			return nil
+			return nil, torus.ErrNoPeer
 		}
 	}
 	if pi.TimedOut {
-		return nil
+		return nil, torus.ErrNoPeer
 	}
 	uri, err := url.Parse(pi.Address)
 	if err != nil {
 		clog.Errorf("couldn't parse address %s: %v", pi.Address, err)
-		return nil
+		return nil, err
 	}
 	gmd := d.dist.srv.MDS.GlobalMetadata()
-	conn, err := protocols.DialRPC(uri, connectTimeout, gmd)
-	d.mut.Lock()
-	defer d.mut.Unlock()
+	conn, err := protocols.DialRPC(uri, connectTimeout, gmd, d.dist.srv.Cfg.PeerTLS, d.dist.srv.Cfg.Token)
 	if err != nil {
 		clog.Errorf("couldn't dial: %v", err)
-		return nil
+		return nil, err
 	}
-	d.openConns[uuid] = conn
-	return conn
+	return conn, nil
 }
 
-func (d *distClient) resetConn(uuid string) {
-	d.mut.Lock()
-	defer d.mut.Unlock()
-	conn, ok := d.openConns[uuid]
-	if !ok {
-		return
-	}
-	delete(d.openConns, uuid)
-	err := conn.Close()
-	if err != nil {
-		clog.Errorf("error resetConn: %s", err)
-	}
+// acquire waits for a turn to send a request to a peer.
+func (d *distClient) acquire(ctx context.Context, uuid string) (func(), error) {
+	_, span := torus.StartSpan(ctx, "peer.queue", torus.AttrPeer.String(uuid))
+	release, err := d.sched.acquire(ctx, uuid)
+	torus.EndSpan(span, err)
+	return release, err
 }
 
 func (d *distClient) Close() error {
-	d.mut.Lock()
-	defer d.mut.Unlock()
-	for _, c := range d.openConns {
-		err := c.Close()
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return d.pool.Close()
 }
 
 func (d *distClient) GetBlock(ctx context.Context, uuid string, b torus.BlockRef) ([]byte, error) {
-	conn := d.getConn(uuid)
+	ctx, span := torus.StartSpan(ctx, "peer.GetBlock", torus.AttrPeer.String(uuid), torus.AttrBlock.String(b.String()))
+	data, err := d.getBlock(ctx, uuid, b)
+	torus.EndSpan(span, err)
+	return data, err
+}
+
+func (d *distClient) getBlock(ctx context.Context, uuid string, b torus.BlockRef) ([]byte, error) {
+	release, err := d.acquire(ctx, uuid)
+	if err != nil {
+		return nil, torus.ErrBlockUnavailable
+	}
+	conn, done := d.getConn(uuid)
 	if conn == nil {
+		release()
 		return nil, torus.ErrNoPeer
 	}
 	data, err := conn.Block(ctx, b)
+	if ctx.Err() != nil || err == torus.ErrBlockCorrupt {
+		// The connection is fine; the reader gave up on it, as hedged and
+		// spread reads do with all but the first answer, or the peer's copy
+		// is bad.
+		done(nil)
+	} else {
+		done(err)
+	}
+	release()
+	if err == torus.ErrBlockCorrupt {
+		return nil, err
+	}
 	if err != nil {
-		d.resetConn(uuid)
 		clog.Debug(err)
 		return nil, torus.ErrBlockUnavailable
 	}
+	d.dist.countZoneBytes(zoneRead, uuid, d.dist.UUID(), len(data))
 	return data, nil
 }
 
+// GetBlocks fetches many blocks from a peer, in one request if its RPC
+// supports it. Blocks the peer couldn't return are nil.
+func (d *distClient) GetBlocks(ctx context.Context, uuid string, refs []torus.BlockRef) ([][]byte, error) {
+	release, err := d.acquire(ctx, uuid)
+	if err != nil {
+		return nil, torus.ErrBlockUnavailable
+	}
+	defer release()
+	conn, done := d.getConn(uuid)
+	if conn == nil {
+		return nil, torus.ErrNoPeer
+	}
+	if bc, ok := conn.(protocols.BatchRPC); ok {
+		data, err := bc.Blocks(ctx, refs)
+		done(err)
+		if err != nil {
+			clog.Debug(err)
+			return nil, torus.ErrBlockUnavailable
+		}
+		d.countBlocks(uuid, data)
+		return data, nil
+	}
+	defer done(nil)
+	out := make([][]byte, len(refs))
+	for i, ref := range refs {
+		data, err := conn.Block(ctx, ref)
+		if err == nil {
+			out[i] = data
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, torus.ErrBlockUnavailable
+		}
+	}
+	d.countBlocks(uuid, out)
+	return out, nil
+}
+
+func (d *distClient) countBlocks(uuid string, blocks [][]byte) {
+	n := 0
+	for _, b := range blocks {
+		n += len(b)
+	}
+	d.dist.countZoneBytes(zoneRead, uuid, d.dist.UUID(), n)
+}
+
 func (d *distClient) PutBlock(ctx context.Context, uuid string, b torus.BlockRef, data []byte) error {
-	conn := d.getConn(uuid)
+	if d.batch != nil {
+		conn, done := d.getConn(uuid)
+		_, ok := conn.(protocols.BatchPutRPC)
+		done(nil)
+		if ok {
+			return d.batch.put(ctx, uuid, b, data)
+		}
+	}
+	return d.putBlock(ctx, uuid, b, data, zoneReplication)
+}
+
+// putBatch sends a batch of writes to a peer in one request.
+func (d *distClient) putBatch(uuid string, epoch uint64, refs []torus.BlockRef, blocks [][]byte) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeClientTimeout)
+	defer cancel()
+	if epoch != 0 {
+		ctx = torus.WithWriteEpoch(ctx, epoch)
+	}
+	ctx, span := torus.StartSpan(ctx, "peer.PutBlocks", torus.AttrPeer.String(uuid))
+	defer func() { torus.EndSpan(span, err) }()
+	release, err := d.acquire(ctx, uuid)
+	if err != nil {
+		return torus.ErrBlockUnavailable
+	}
+	rpc, done := d.getConn(uuid)
+	conn, ok := rpc.(protocols.BatchPutRPC)
+	if !ok {
+		done(nil)
+		release()
+		return torus.ErrNoPeer
+	}
+	err = conn.PutBlocks(ctx, refs, blocks)
+	if err == torus.ErrStaleEpoch {
+		done(nil)
+	} else {
+		done(err)
+	}
+	release()
+	if err != nil {
+		if err == torus.ErrStaleEpoch {
+			return err
+		}
+		if err == context.DeadlineExceeded {
+			return torus.ErrBlockUnavailable
+		}
+		return err
+	}
+	n := 0
+	for _, b := range blocks {
+		n += len(b)
+	}
+	d.dist.countZoneBytes(zoneReplication, d.dist.UUID(), uuid, n)
+	return nil
+}
+
+func (d *distClient) putBlock(ctx context.Context, uuid string, b torus.BlockRef, data []byte, kind string) (err error) {
+	ctx, span := torus.StartSpan(ctx, "peer.PutBlock", torus.AttrPeer.String(uuid), torus.AttrBlock.String(b.String()))
+	defer func() { torus.EndSpan(span, err) }()
+	release, err := d.acquire(ctx, uuid)
+	if err != nil {
+		return torus.ErrBlockUnavailable
+	}
+	conn, done := d.getConn(uuid)
 	if conn == nil {
+		release()
 		return torus.ErrNoPeer
 	}
-	err := conn.PutBlock(ctx, b, data)
+	err = conn.PutBlock(ctx, b, data)
+	done(err)
+	release()
 	if err != nil {
-		d.resetConn(uuid)
 		if err == context.DeadlineExceeded {
 			return torus.ErrBlockUnavailable
 		}
+		return err
 	}
-	return err
+	d.dist.countZoneBytes(kind, d.dist.UUID(), uuid, len(data))
+	return nil
+}
+
+// sendBlocks streams blocks to a peer, if its RPC supports it, reading each
+// with get just before it's sent, and stamping each with the epoch of the
+// same index in epochs.
+func (d *distClient) sendBlocks(ctx context.Context, uuid string, refs []torus.BlockRef, epochs []uint64, get func(torus.BlockRef) ([]byte, error), kind string) (errs []error, err error) {
+	ctx, span := torus.StartSpan(ctx, "peer.SendBlocks", torus.AttrPeer.String(uuid))
+	defer func() { torus.EndSpan(span, err) }()
+	release, err := d.acquire(ctx, uuid)
+	if err != nil {
+		return nil, torus.ErrBlockUnavailable
+	}
+	defer release()
+	conn, done := d.getConn(uuid)
+	if conn == nil {
+		return nil, torus.ErrNoPeer
+	}
+	tc, ok := conn.(protocols.TransferRPC)
+	if !ok {
+		done(nil)
+		return nil, torus.ErrNotSupported
+	}
+	sizes := make([]int, len(refs))
+	errs, err = tc.SendBlocks(ctx, refs, epochs, func(i int) ([]byte, error) {
+		data, err := get(refs[i])
+		sizes[i] = len(data)
+		return data, err
+	})
+	done(err)
+	if err != nil {
+		if err == context.DeadlineExceeded {
+			return nil, torus.ErrBlockUnavailable
+		}
+		return nil, err
+	}
+	n := 0
+	for i, err := range errs {
+		if err == nil {
+			n += sizes[i]
+		}
+	}
+	d.dist.countZoneBytes(kind, d.dist.UUID(), uuid, n)
+	return errs, nil
 }
 
 func (d *distClient) Check(ctx context.Context, uuid string, blks []torus.BlockRef) ([]bool, error) {
-	conn := d.getConn(uuid)
+	conn, done := d.getConn(uuid)
 	if conn == nil {
 		return nil, torus.ErrNoPeer
 	}
 	resp, err := conn.RebalanceCheck(ctx, blks)
+	done(err)
 	if err != nil {
-		d.resetConn(uuid)
 		return nil, err
 	}
 	return resp, nil
 }
+
+func (d *distClient) PutHintedBlock(ctx context.Context, uuid string, owner string, b torus.BlockRef, data []byte) error {
+	conn, done := d.getConn(uuid)
+	if conn == nil {
+		return torus.ErrNoPeer
+	}
+	hc, ok := conn.(protocols.HintRPC)
+	if !ok {
+		done(nil)
+		return torus.ErrNotSupported
+	}
+	err := hc.PutHintedBlock(ctx, owner, b, data)
+	done(err)
+	if err != nil {
+		if err == context.DeadlineExceeded {
+			return torus.ErrBlockUnavailable
+		}
+		return err
+	}
+	d.dist.countZoneBytes(zoneReplication, d.dist.UUID(), uuid, len(data))
+	return nil
+}
+
+func (d *distClient) DrainHints(ctx context.Context, uuid string, owner string) error {
+	conn, done := d.getConn(uuid)
+	if conn == nil {
+		return torus.ErrNoPeer
+	}
+	hc, ok := conn.(protocols.HintRPC)
+	if !ok {
+		done(nil)
+		return torus.ErrNotSupported
+	}
+	err := hc.DrainHints(ctx, owner)
+	done(err)
+	return err
+}
+
+func (d *distClient) RepairBlock(ctx context.Context, uuid string, b torus.BlockRef, data []byte) error {
+	conn, done := d.getConn(uuid)
+	if conn == nil {
+		return torus.ErrNoPeer
+	}
+	rc, ok := conn.(protocols.RepairRPC)
+	if !ok {
+		done(nil)
+		return torus.ErrNotSupported
+	}
+	err := rc.RepairBlock(ctx, b, data)
+	done(err)
+	if err != nil {
+		return err
+	}
+	d.dist.countZoneBytes(zoneReplication, d.dist.UUID(), uuid, len(data))
+	return nil
+}
+
+func (d *distClient) DeleteBlocks(ctx context.Context, uuid string, refs []torus.BlockRef) error {
+	conn, done := d.getConn(uuid)
+	if conn == nil {
+		return torus.ErrNoPeer
+	}
+	dc, ok := conn.(protocols.DiscardRPC)
+	if !ok {
+		done(nil)
+		return torus.ErrNotSupported
+	}
+	err := dc.DeleteBlocks(ctx, refs)
+	done(err)
+	return err
+}
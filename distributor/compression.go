@@ -0,0 +1,22 @@
+package distributor
+
+import "github.com/coreos/torus"
+
+// compressVolume is the compression policy given to the local block store.
+// Blocks written before a change is seen keep the old setting, which is
+// harmless either way.
+func (d *Distributor) compressVolume(vid torus.VolumeID) bool {
+	cmds, ok := d.srv.MDS.(torus.CompressionMetadataService)
+	if !ok {
+		return false
+	}
+	on, _ := d.policies.get(vid, policyCompression, func(old interface{}) (interface{}, error) {
+		on, err := cmds.GetCompression(vid)
+		if err != nil {
+			clog.Errorf("couldn't get compression setting for volume %d: %v", vid, err)
+			on, _ = old.(bool)
+		}
+		return on, nil
+	})
+	return on.(bool)
+}
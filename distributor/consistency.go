@@ -0,0 +1,164 @@
+package distributor
+
+import (
+	"errors"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+var ErrNoQuorum = errors.New("distributor: fewer than a majority of replicas agreed")
+
+func (d *Distributor) volumeConsistency(vid torus.VolumeID) *torus.Consistency {
+	cmds, ok := d.srv.MDS.(torus.ConsistencyMetadataService)
+	if !ok {
+		return nil
+	}
+	c, _ := d.policies.get(vid, policyConsistency, func(old interface{}) (interface{}, error) {
+		c, err := cmds.GetConsistency(vid)
+		if err != nil {
+			clog.Errorf("couldn't get consistency for volume %d: %v", vid, err)
+			c, _ = old.(*torus.Consistency)
+		}
+		return c, nil
+	})
+	return c.(*torus.Consistency)
+}
+
+// readLevel returns the level to read a block of vid at: the request's own,
+// failing that the volume's, and failing that the client's.
+func (d *Distributor) readLevel(ctx context.Context, vid torus.VolumeID) torus.ReadLevel {
+	if rl, ok := torus.RequestReadLevel(ctx); ok {
+		return rl
+	}
+	if c := d.volumeConsistency(vid); c != nil {
+		return c.Read
+	}
+	return d.srv.Cfg.ReadLevel
+}
+
+// writeLevel is readLevel for writes.
+func (d *Distributor) writeLevel(ctx context.Context, vid torus.VolumeID) torus.WriteLevel {
+	if wl, ok := torus.RequestWriteLevel(ctx); ok {
+		return wl
+	}
+	if c := d.volumeConsistency(vid); c != nil {
+		return c.Write
+	}
+	return d.srv.Cfg.WriteLevel
+}
+
+// quorum is how many of n replicas make a majority.
+func quorum(n int) int {
+	return n/2 + 1
+}
+
+func (d *Distributor) writeReplica(ctx context.Context, p string, i torus.BlockRef, data []byte) error {
+	if p == d.UUID() {
+		return d.blocks.WriteBlock(ctx, i, data)
+	}
+	return d.client.PutBlock(ctx, p, i, data)
+}
+
+type replicaWrite struct {
+	peer string
+	err  error
+}
+
+// writeQuorum writes a block to all of its replicas at once, and returns as
+// soon as a majority of them have it. The rest are waited on in the
+// background, and those that fail are handed off, as for WriteAll. Handed
+// off copies don't count towards the majority, as a quorum read wouldn't
+// find them.
+func (d *Distributor) writeQuorum(ctx context.Context, i torus.BlockRef, data []byte, peers torus.PeerPermutation) error {
+	replicas := peers.Replicas()
+	need := quorum(len(replicas))
+	results := make(chan replicaWrite, len(replicas))
+	for _, p := range replicas {
+		go func(p string) {
+			results <- replicaWrite{p, d.writeReplica(ctx, p, i, data)}
+		}(p)
+	}
+	written := 0
+	var down torus.PeerList
+	for n := 0; n < len(replicas); n++ {
+		r := <-results
+		if r.err == torus.ErrStaleEpoch {
+			return r.err
+		}
+		if r.err != nil {
+			clog.Noticef("error WriteQuorum to peer %s: %s", r.peer, r.err)
+			down = append(down, r.peer)
+			continue
+		}
+		written++
+		if written == need {
+			go d.finishQuorumWrite(ctx, i, data, peers, results, len(replicas)-n-1, down)
+			return nil
+		}
+	}
+	d.handOff(ctx, i, data, peers, down)
+	promDistQuorumFailures.WithLabelValues("write").Inc()
+	clog.Warningf("only wrote block %s to %d/%d peers, short of a quorum", i, written, len(replicas))
+	return ErrNoQuorum
+}
+
+// finishQuorumWrite waits for the last pending writes of a quorum write, and
+// hands off the ones that failed.
+func (d *Distributor) finishQuorumWrite(ctx context.Context, i torus.BlockRef, data []byte, peers torus.PeerPermutation, results chan replicaWrite, pending int, down torus.PeerList) {
+	for ; pending > 0; pending-- {
+		r := <-results
+		if r.err == torus.ErrStaleEpoch {
+			return
+		}
+		if r.err != nil {
+			clog.Noticef("error WriteQuorum to peer %s: %s", r.peer, r.err)
+			down = append(down, r.peer)
+		}
+	}
+	d.handOff(ctx, i, data, peers, down)
+}
+
+// readQuorum reads a block from all of its replicas at once, and returns it
+// as soon as a majority of them agree on its contents. A block's ref names
+// the INode generation that wrote it, and isn't written twice, so a replica
+// either has the latest copy or lags behind without one; copies that differ
+// are corrupt. Either way, the replicas that answer otherwise are given the
+// agreed copy in the background.
+func (d *Distributor) readQuorum(ctx context.Context, i torus.BlockRef, peers torus.PeerPermutation) ([]byte, error) {
+	replicas := peers.Replicas()
+	need := quorum(len(replicas))
+	results := make(chan replicaCopy, len(replicas))
+	for _, p := range replicas {
+		go func(p string) {
+			results <- d.readReplica(ctx, p, i)
+		}(p)
+	}
+	votes := make(map[uint32]int)
+	var copies []replicaCopy
+	for n := 0; n < len(replicas); n++ {
+		c := <-results
+		copies = append(copies, c)
+		if c.err != nil {
+			clog.Debugf("quorum read of %s from %s failed: %v", i, c.peer, c.err)
+			continue
+		}
+		votes[c.sum]++
+		if votes[c.sum] == need {
+			d.readCache.Put(i, c.data)
+			go d.repairQuorumRead(ctx, i, c, copies, results, len(replicas)-n-1)
+			return c.data, nil
+		}
+	}
+	promDistQuorumFailures.WithLabelValues("read").Inc()
+	return nil, ErrNoQuorum
+}
+
+// repairQuorumRead waits for the replicas a quorum read didn't need, and
+// repairs those that lag behind or differ from the agreed copy.
+func (d *Distributor) repairQuorumRead(ctx context.Context, i torus.BlockRef, good replicaCopy, copies []replicaCopy, results chan replicaCopy, pending int) {
+	for ; pending > 0; pending-- {
+		copies = append(copies, <-results)
+	}
+	d.repairCopies(ctx, i, good, copies)
+}
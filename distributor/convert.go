@@ -0,0 +1,197 @@
+package distributor
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+// Redundancy conversions piggyback on the rebalancer. A volume's conversion
+// changes how many peers its blocks should live on; the rebalancer then moves
+// the data under its usual rate limiting, and each peer reports in once it has
+// completed a clean pass with the new placement.
+
+// redundancyRing wraps the current ring so that anything asking for a block's
+// peers, the rebalancer included, sees the replication of the block's volume.
+type redundancyRing struct {
+	torus.Ring
+	d *Distributor
+}
+
+func (r redundancyRing) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
+	return r.d.placeBlock(r.Ring, key)
+}
+
+func (d *Distributor) getPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
+	return d.placeBlock(d.ring, key)
+}
+
+func (d *Distributor) placeBlock(r torus.Ring, key torus.BlockRef) (torus.PeerPermutation, error) {
+	return d.placeBlockBy(d.perms.getPeers, r, key)
+}
+
+// placeBlockBy is placeBlock for rings whose placements don't belong in the
+// cache, getting the ring's own permutations from get instead.
+func (d *Distributor) placeBlockBy(get func(torus.Ring, torus.BlockRef) (torus.PeerPermutation, error), r torus.Ring, key torus.BlockRef) (torus.PeerPermutation, error) {
+	if e := d.migrationOf(key.Volume()); e.m != nil {
+		return d.placeMigrated(get, r, e, key)
+	}
+	return d.placeOnCluster(get, r, key)
+}
+
+// placeOnCluster places key by the cluster's ring r and, if r is the current
+// ring and this peer has acknowledged the one proposed to follow it, by that
+// one too. Other peers may move on to the proposed ring as soon as it's
+// committed, so anything written from the acknowledgement on is already
+// where they'll look for it.
+func (d *Distributor) placeOnCluster(get func(torus.Ring, torus.BlockRef) (torus.PeerPermutation, error), r torus.Ring, key torus.BlockRef) (torus.PeerPermutation, error) {
+	perm, err := d.placeOnRing(get, r, key)
+	if err != nil {
+		return perm, err
+	}
+	d.propMut.RLock()
+	p := d.proposed
+	d.propMut.RUnlock()
+	if p == nil || p.Version() != r.Version()+1 {
+		return perm, nil
+	}
+	// The cache is for the current ring.
+	n, err := d.placeOnRing(ringPeers, p, key)
+	if err != nil {
+		return n, err
+	}
+	return unionPermutation(perm, n), nil
+}
+
+// placeOnRing places key by r alone, with its volume's replication.
+func (d *Distributor) placeOnRing(get func(torus.Ring, torus.BlockRef) (torus.PeerPermutation, error), r torus.Ring, key torus.BlockRef) (torus.PeerPermutation, error) {
+	if key.BlockType() == torus.TypeShard {
+		// Shards are stored once, wherever their stripe puts them,
+		// whatever the volume's replication.
+		perm, err := get(r, torus.StripeKey(key))
+		if err != nil {
+			return perm, err
+		}
+		return torus.ShardPermutation(d.avoidDraining(perm), key.ShardPos()), nil
+	}
+	perm, err := get(r, key)
+	if err != nil {
+		return perm, err
+	}
+	return d.avoidDraining(d.applyRedundancy(key, perm)), nil
+}
+
+func (d *Distributor) applyRedundancy(key torus.BlockRef, perm torus.PeerPermutation) torus.PeerPermutation {
+	d.convMut.RLock()
+	c, ok := d.conversions[key.Volume()]
+	d.convMut.RUnlock()
+	if !ok {
+		c = d.lookupConversion(key.Volume())
+	}
+	if c == nil {
+		return perm
+	}
+	rep := c.Effective(perm.Replication)
+	if rep > len(perm.Peers) {
+		rep = len(perm.Peers)
+	}
+	perm.Replication = rep
+	return perm
+}
+
+// lookupConversion fetches the conversion state of a volume placeBlock
+// hasn't seen since the last refresh, such as one created since, so that its
+// first writes already get the volume's replication. Volumes without a
+// conversion are remembered as nil, so each is only looked up once.
+func (d *Distributor) lookupConversion(vid torus.VolumeID) *torus.Conversion {
+	cmds, ok := d.srv.MDS.(torus.ConversionMetadataService)
+	if !ok {
+		return nil
+	}
+	c, err := cmds.GetConversion(vid)
+	if err != nil && err != torus.ErrNotExist {
+		clog.Errorf("couldn't get conversion for volume %d: %v", vid, err)
+		return nil
+	}
+	d.convMut.Lock()
+	defer d.convMut.Unlock()
+	if d.conversions == nil {
+		d.conversions = make(map[torus.VolumeID]*torus.Conversion)
+	}
+	d.conversions[vid] = c
+	return c
+}
+
+// refreshConversions reloads the conversion state of every volume.
+func (d *Distributor) refreshConversions(vols []*models.Volume) {
+	cmds, ok := d.srv.MDS.(torus.ConversionMetadataService)
+	if !ok {
+		return
+	}
+	convs := make(map[torus.VolumeID]*torus.Conversion)
+	for _, v := range vols {
+		c, err := cmds.GetConversion(torus.VolumeID(v.Id))
+		if err == torus.ErrNotExist {
+			convs[torus.VolumeID(v.Id)] = nil
+			continue
+		}
+		if err != nil {
+			clog.Errorf("couldn't get conversion for %s: %v", v.Name, err)
+			continue
+		}
+		convs[torus.VolumeID(v.Id)] = c
+	}
+	d.convMut.Lock()
+	d.conversions = convs
+	d.convMut.Unlock()
+}
+
+// reportConversions records this peer's progress on every running conversion
+// after a full rebalance pass, and finishes any conversion all members of the
+// ring are done with.
+func (d *Distributor) reportConversions() {
+	cmds, ok := d.srv.MDS.(torus.ConversionMetadataService)
+	if !ok {
+		return
+	}
+	stats := d.rebalancer.VolumeStats()
+	members := d.Ring().Members()
+	uuid := d.UUID()
+	d.convMut.RLock()
+	var running []*torus.Conversion
+	for _, c := range d.conversions {
+		if c != nil && c.State == torus.ConversionRunning {
+			running = append(running, c)
+		}
+	}
+	d.convMut.RUnlock()
+	for _, c := range running {
+		st := stats[c.VolumeID]
+		started := c.Started
+		_, err := cmds.ModifyConversion(c.VolumeID, func(cur *torus.Conversion) (*torus.Conversion, error) {
+			if cur == nil || cur.State != torus.ConversionRunning || cur.Started != started {
+				// Aborted or restarted while we were working; our pass
+				// doesn't count for the new one.
+				return nil, torus.ErrAgain
+			}
+			if cur.Progress == nil {
+				cur.Progress = make(map[string]torus.ConversionProgress)
+			}
+			cur.Progress[uuid] = torus.ConversionProgress{
+				Blocks: st.Blocks,
+				Sent:   st.Sent,
+				Done:   st.Failed == 0,
+			}
+			if cur.PeersDone(members) == len(members) {
+				cur.State = torus.ConversionDone
+				cur.Finished = time.Now().UnixNano()
+				clog.Infof("conversion of %s to %s complete", cur.Volume, cur.To)
+			}
+			return cur, nil
+		})
+		if err != nil && err != torus.ErrAgain {
+			clog.Errorf("couldn't report conversion progress for %s: %v", c.Volume, err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package distributor
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// How often we look for peers that have left on purpose.
+var departurePollInterval = 5 * time.Second
+
+type departureState struct {
+	peers    map[string]bool
+	lastPoll time.Time
+}
+
+// ShutdownReplication takes s out of the cluster gracefully: it tells the
+// other peers it will be back within grace, stops taking writes, finishes
+// the writes in flight, hands off what it holds for other peers, and, with
+// Cfg.ShutdownHandoff, the blocks only it has, and stops heartbeating. Until grace
+// runs out, the rest of the cluster doesn't treat it as failed. The server
+// still has to be closed afterwards.
+func ShutdownReplication(s *torus.Server, grace time.Duration) error {
+	d, ok := s.Blocks.(*Distributor)
+	if !ok {
+		return torus.ErrNotSupported
+	}
+	return d.shutdown(grace)
+}
+
+func (d *Distributor) shutdown(grace time.Duration) error {
+	dmds, ok := d.srv.MDS.(torus.DepartureMetadataService)
+	if !ok {
+		return torus.ErrNotSupported
+	}
+	now := time.Now()
+	err := dmds.AnnounceDeparture(&torus.Departure{
+		Peer:  d.UUID(),
+		Since: now.UnixNano(),
+		Until: now.Add(grace).UnixNano(),
+	})
+	if err != nil {
+		return err
+	}
+	clog.Noticef("leaving the cluster; expected back within %s", grace)
+
+	// No new writes or background work, and wait for the writes in flight
+	// to land. Writes from other peers are handed off to the peers after
+	// us from now on.
+	d.mut.Lock()
+	atomic.StoreInt32(&d.leaving, 1)
+	d.stopBackground()
+	err = d.blocks.Flush()
+	d.mut.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Whatever can't be handed off now stays in the hint log until we're
+	// back.
+	if hl, ok := d.blocks.(torus.HintLog); ok {
+		for _, peer := range hl.HintedPeers() {
+			d.handoff(hl, peer, false)
+		}
+	}
+	if d.srv.Cfg.ShutdownHandoff {
+		n, err := d.handOffSoleCopies()
+		if err != nil {
+			clog.Errorf("couldn't hand off every block only we have: %v", err)
+		}
+		clog.Noticef("handed off %d blocks no other replica has", n)
+	}
+
+	d.srv.StopHeartbeat()
+	return dmds.DeregisterPeer(d.srv.Lease())
+}
+
+// isLeaving returns whether the peer has begun shutting down.
+func (d *Distributor) isLeaving() bool {
+	return atomic.LoadInt32(&d.leaving) != 0
+}
+
+// soleCopyBatch is how many local blocks handOffSoleCopies asks the other
+// replicas about at once.
+const soleCopyBatch = 1024
+
+// handOffSoleCopies writes the local blocks that no other live replica has,
+// such as those written with WriteOne and not yet rebalanced, or those of
+// volumes with a replication of 1, to the peers that follow the replicas,
+// hinted for this peer. They can be read from there while it's away, and are
+// handed back once it returns. It returns how many it handed off.
+func (d *Distributor) handOffSoleCopies() (int, error) {
+	// List the blocks first, as the rebalancer does, so that the iterator
+	// isn't held open while they're read.
+	it := d.blocks.BlockIterator()
+	var refs []torus.BlockRef
+	for it.Next() {
+		refs = append(refs, it.BlockRef())
+	}
+	err := it.Err()
+	it.Close()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for len(refs) > 0 {
+		batch := refs
+		if len(batch) > soleCopyBatch {
+			batch = batch[:soleCopyBatch]
+		}
+		refs = refs[len(batch):]
+		n += d.handOffSoleBatch(batch)
+	}
+	return n, nil
+}
+
+func (d *Distributor) handOffSoleBatch(refs []torus.BlockRef) int {
+	if len(refs) == 0 {
+		return 0
+	}
+	perms := make(map[torus.BlockRef]torus.PeerPermutation)
+	ask := make(map[string][]torus.BlockRef)
+	for _, ref := range refs {
+		d.mut.RLock()
+		perm, err := d.getPeers(ref)
+		d.mut.RUnlock()
+		if err != nil {
+			clog.Errorf("couldn't place block %s: %v", ref, err)
+			continue
+		}
+		if !perm.Replicas().Has(d.UUID()) {
+			// Kept only until the rebalancer deletes it.
+			continue
+		}
+		perms[ref] = perm
+		for _, p := range perm.Replicas() {
+			if p != d.UUID() && !d.srv.PeerDown(p) {
+				ask[p] = append(ask[p], ref)
+			}
+		}
+	}
+	for p, asked := range ask {
+		ctx, cancel := context.WithTimeout(context.TODO(), clientTimeout)
+		oks, err := d.client.Check(ctx, p, asked)
+		cancel()
+		if err != nil {
+			clog.Debugf("couldn't check blocks on %s: %v", p, err)
+			continue
+		}
+		for i, ok := range oks {
+			if ok {
+				delete(perms, asked[i])
+			}
+		}
+	}
+	n := 0
+	self := torus.PeerList{d.UUID()}
+	for ref, perm := range perms {
+		ctx, cancel := context.WithTimeout(torus.WithIOClass(context.TODO(), torus.IOClassBatch), writeClientTimeout)
+		data, err := d.blocks.GetBlock(ctx, ref)
+		if err == nil {
+			_, err = d.writeHinted(ctx, d.UUID(), ref, data, perm, self)
+		}
+		cancel()
+		if err != nil {
+			clog.Warningf("couldn't hand off %s: %v", ref, err)
+			continue
+		}
+		n++
+	}
+	promDistShutdownHandoffs.Add(float64(n))
+	return n
+}
+
+// clearDeparture lets the cluster know that we're back.
+func (d *Distributor) clearDeparture() {
+	dmds, ok := d.srv.MDS.(torus.DepartureMetadataService)
+	if !ok {
+		return
+	}
+	err := dmds.ClearDeparture()
+	if err != nil {
+		clog.Errorf("couldn't clear departure: %v", err)
+	}
+}
+
+// pollDepartures refreshes the set of peers that have left on purpose, at
+// most every departurePollInterval.
+func (d *Distributor) pollDepartures() {
+	dmds, ok := d.srv.MDS.(torus.DepartureMetadataService)
+	if !ok || time.Since(d.departures.lastPoll) < departurePollInterval {
+		return
+	}
+	d.departures.lastPoll = time.Now()
+	ds, err := dmds.GetDepartures()
+	if err != nil {
+		clog.Errorf("couldn't get departures: %v", err)
+		return
+	}
+	peers := make(map[string]bool)
+	for _, x := range ds {
+		if !d.departures.peers[x.Peer] {
+			clog.Infof("peer %s is leaving, and expected back within %s", x.Peer, time.Unix(0, x.Until).Sub(time.Now()))
+		}
+		peers[x.Peer] = true
+	}
+	d.departures.peers = peers
+}
+
+// Departed returns whether peer has left on purpose and is expected back, so
+// that its blocks shouldn't be considered lost.
+func (d *Distributor) Departed(peer string) bool {
+	return d.departures.peers[peer]
+}
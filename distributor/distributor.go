@@ -12,6 +12,7 @@ import (
 	"github.com/coreos/torus/distributor/protocols"
 	"github.com/coreos/torus/distributor/rebalance"
 	"github.com/coreos/torus/gc"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -24,35 +25,118 @@ type Distributor struct {
 	srv       *torus.Server
 	client    *distClient
 	rpcSrv    protocols.RPCServer
-	readCache *cache
+	readCache *blockCache
+	peerCache *cache
+	fence     *torus.Fence
 
 	ring            torus.Ring
+	perms           permCache
 	closed          bool
+	stopped         bool
 	rebalancerChan  chan struct{}
 	ringWatcherChan chan struct{}
+	policyChan      chan struct{}
 	rebalancer      rebalance.Rebalancer
+	collector       *gc.Collector
 	rebalancing     bool
+	handoffChan     chan struct{}
+	drainChan       chan string
+	scrubChan       chan struct{}
+	gcChan          chan struct{}
+	fsckChan        chan struct{}
+	tierChan        chan struct{}
+	fillChan        chan struct{}
+	// gcPreempted is set, atomically, while emergency repair preempts
+	// garbage collection and scrubbing.
+	gcPreempted int32
+	// leaving is set, atomically, once the peer has begun shutting down,
+	// after which it takes no more writes.
+	leaving int32
+
+	// proposed is the ring proposed to follow ring, once this peer has
+	// acknowledged it. Blocks are placed by both until it's committed or
+	// abandoned.
+	propMut  sync.RWMutex
+	proposed torus.Ring
+
+	convMut     sync.RWMutex
+	conversions map[torus.VolumeID]*torus.Conversion
+
+	latency latencyTracker
+	hedge   hedgeState
+	load    loadState
+
+	policies policyCache
+	qos      qosState
+
+	// fixing holds the corrupt blocks found by reads that are being
+	// repaired.
+	fixMut sync.Mutex
+	fixing map[torus.BlockRef]bool
+
+	// Only touched by the rebalance goroutine.
+	emergency  emergencyState
+	departures departureState
+	draining   drainingState
+	recovery   recoveryState
+	checkpoint checkpointState
+	throttle   throttleState
+	transition *transition
+	// settledVersion is the ring version of the last complete rebalance
+	// pass.
+	settledVersion int
+	// underReplicated is how many under-replicated blocks the last complete
+	// rebalance pass found.
+	underReplicated uint64
 }
 
 func newDistributor(srv *torus.Server, addr *url.URL) (*Distributor, error) {
 	var err error
 	d := &Distributor{
-		blocks: srv.Blocks,
-		srv:    srv,
+		blocks:    srv.Blocks,
+		srv:       srv,
+		drainChan: make(chan string, 16),
+		fence:     torus.NewFence(),
+		qos:       qosState{limiters: make(map[torus.VolumeID]*qosLimiter)},
+	}
+	if am, ok := srv.MDS.(torus.AttachEpochMetadataService); ok {
+		d.fence = torus.NewFenceWithLookup(am.GetAttachEpoch)
+	}
+	if bc, ok := d.blocks.(torus.BlockCompressor); ok {
+		bc.SetCompressionPolicy(d.compressVolume)
+	}
+	if be, ok := d.blocks.(torus.BlockEncryptor); ok {
+		be.SetKeyringFunc(d.volumeKeyring)
+	}
+	if dp, ok := d.blocks.(torus.DevicePlacer); ok {
+		dp.SetDevicePlacement(d.placeOnDevices)
+	}
+	if bt, ok := d.blocks.(torus.BlockTierer); ok {
+		bt.SetTierPolicy(d.tierVolume)
 	}
 	gmd := d.srv.MDS.GlobalMetadata()
 	if addr != nil {
-		d.rpcSrv, err = protocols.ListenRPC(addr, d, gmd)
+		d.rpcSrv, err = protocols.ListenRPC(addr, d, gmd, srv.Cfg.PeerTLS)
 		if err != nil {
 			return nil, err
 		}
+		if size := srv.Cfg.PeerCacheSize / gmd.BlockSize; size != 0 {
+			d.peerCache = newCache(int(size))
+		}
 	}
 	if srv.Cfg.ReadCacheSize != 0 {
 		size := srv.Cfg.ReadCacheSize / gmd.BlockSize
 		if size < 100 {
 			size = 100
 		}
-		d.readCache = newCache(int(size))
+		var diskSize int
+		if srv.Cfg.ReadCacheDir != "" {
+			diskSize = int(srv.Cfg.ReadCacheDiskSize / gmd.BlockSize)
+		}
+		d.readCache, err = newBlockCache(int(size), srv.Cfg.ReadCacheDir, diskSize)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Set up the rebalancer
@@ -60,13 +144,34 @@ func newDistributor(srv *torus.Server, addr *url.URL) (*Distributor, error) {
 	if err != nil {
 		return nil, err
 	}
+	d.settledVersion = d.ring.Version()
+	d.readCache.SetRing(d.ring.Version())
+	promDistRingVersion.Set(float64(d.ring.Version()))
 	d.ringWatcherChan = make(chan struct{})
 	go d.ringWatcher(d.rebalancerChan)
+	go d.ringPreparer(d.ringWatcherChan)
+	d.policyChan = make(chan struct{})
+	d.watchPolicies(d.policyChan)
 	d.client = newDistClient(d)
-	g := gc.NewGCController(d.srv, torus.NewINodeStore(d))
-	d.rebalancer = rebalance.NewRebalancer(d, d.blocks, d.client, g)
+	d.collector = gc.NewCollector(d.srv, d.blocks, torus.NewINodeStore(d))
+	d.rebalancer = rebalance.NewRebalancer(d, d.blocks, rebalanceClient{d.client}, d.collector.Marks())
+	d.resumeRebalance()
 	d.rebalancerChan = make(chan struct{})
 	go d.rebalanceTicker(d.rebalancerChan)
+	d.handoffChan = make(chan struct{})
+	go d.handoffTicker(d.handoffChan)
+	d.scrubChan = make(chan struct{})
+	go d.scrubTicker(d.scrubChan)
+	d.gcChan = make(chan struct{})
+	go d.gcTicker(d.gcChan)
+	d.fsckChan = make(chan struct{})
+	go d.fsckTicker(d.fsckChan)
+	d.fillChan = make(chan struct{})
+	go d.fillTicker(d.fillChan)
+	d.tierChan = make(chan struct{})
+	if bt, ok := d.blocks.(torus.BlockTierer); ok {
+		go d.tierTicker(bt, d.tierChan)
+	}
 	return d, nil
 }
 
@@ -77,7 +182,38 @@ func (d *Distributor) UUID() string {
 func (d *Distributor) Ring() torus.Ring {
 	d.mut.RLock()
 	defer d.mut.RUnlock()
-	return d.ring
+	return redundancyRing{d.ring, d}
+}
+
+// copyContext stamps ctx, for a copy of a block of vol this peer already
+// holds, with the epoch of the volume's current attachment, if it isn't
+// stamped already, so that peers don't fence the copy off as a write from an
+// unattached client.
+func (d *Distributor) copyContext(ctx context.Context, vol torus.VolumeID) (context.Context, error) {
+	if torus.WriteEpoch(ctx) != 0 {
+		return ctx, nil
+	}
+	epoch, err := d.fence.Current(vol)
+	if err != nil || epoch == 0 {
+		return ctx, err
+	}
+	return torus.WithWriteEpoch(ctx, epoch), nil
+}
+
+// stopBackground stops rebalancing, garbage collection, handoff, scrubbing,
+// fsck and tiering. d.mut must be held.
+func (d *Distributor) stopBackground() {
+	if d.stopped {
+		return
+	}
+	close(d.rebalancerChan)
+	close(d.handoffChan)
+	close(d.scrubChan)
+	close(d.gcChan)
+	close(d.fsckChan)
+	close(d.tierChan)
+	close(d.fillChan)
+	d.stopped = true
 }
 
 func (d *Distributor) Close() error {
@@ -86,8 +222,9 @@ func (d *Distributor) Close() error {
 	if d.closed {
 		return nil
 	}
-	close(d.rebalancerChan)
+	d.stopBackground()
 	close(d.ringWatcherChan)
+	close(d.policyChan)
 	if d.rpcSrv != nil {
 		d.rpcSrv.Close()
 	}
@@ -96,6 +233,10 @@ func (d *Distributor) Close() error {
 	if err != nil {
 		return err
 	}
+	err = d.readCache.Close()
+	if err != nil {
+		return err
+	}
 	d.closed = true
 	return nil
 }
@@ -1,6 +1,7 @@
 package distributor
 
 import (
+	"bytes"
 	"fmt"
 	"net/url"
 	"testing"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/metadata/temp"
+	"golang.org/x/net/context"
 
 	_ "github.com/coreos/torus/storage"
 )
@@ -70,3 +72,56 @@ func testOpenClose(t *testing.T) {
 	closeAll(t, srvs...)
 	md.Close()
 }
+
+func TestCopiesOfAttachedVolume(t *testing.T) {
+	srvs, md := createThree(t)
+	defer md.Close()
+	defer closeAll(t, srvs...)
+	srvs[0].UpdatePeerMap()
+
+	// Volume 1 is attached at epoch 7.
+	var ds []*Distributor
+	for _, srv := range srvs {
+		d := srv.Blocks.(*Distributor)
+		d.fence = torus.NewFenceWithLookup(func(vol torus.VolumeID) (uint64, error) {
+			return 7, nil
+		})
+		ds = append(ds, d)
+	}
+	ctx := context.TODO()
+	ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	data := bytes.Repeat([]byte{7}, int(srvs[0].Blocks.BlockSize()))
+	if err := ds[0].blocks.WriteBlock(ctx, ref, data); err != nil {
+		t.Fatal(err)
+	}
+	peer := srvs[1].MDS.UUID()
+	if err := ds[0].client.PutBlock(ctx, peer, ref, data); err != torus.ErrStaleEpoch {
+		t.Fatalf("expected ErrStaleEpoch writing with no epoch, got %v", err)
+	}
+	// Copies of blocks a peer holds are written at the current epoch.
+	if err := ds[0].repairReplica(ctx, peer, ref, data, false); err != nil {
+		t.Fatal(err)
+	}
+	rc := rebalanceClient{ds[0].client}
+	if err := rc.PutBlock(ctx, peer, ref, data); err != nil {
+		t.Fatal(err)
+	}
+	errs, err := rc.StreamBlocks(ctx, srvs[2].MDS.UUID(), []torus.BlockRef{ref}, func(torus.BlockRef) ([]byte, error) {
+		return data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	for _, d := range ds[1:] {
+		got, err := d.blocks.GetBlock(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("a peer has the wrong copy")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package distributor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// How often we look for peers that are being drained.
+var drainingPollInterval = 5 * time.Second
+
+type drainingState struct {
+	mut      sync.RWMutex
+	peers    map[string]bool
+	lastPoll time.Time
+}
+
+// pollDraining refreshes the set of peers being drained, at most every
+// drainingPollInterval. Blocks are placed away from them from then on, so
+// the rebalancer copies their blocks to other peers as it goes.
+func (d *Distributor) pollDraining() {
+	dmds, ok := d.srv.MDS.(torus.DrainMetadataService)
+	if !ok || time.Since(d.draining.lastPoll) < drainingPollInterval {
+		return
+	}
+	d.draining.lastPoll = time.Now()
+	uuids, err := dmds.GetDraining()
+	if err != nil {
+		clog.Errorf("couldn't get draining peers: %v", err)
+		return
+	}
+	peers := make(map[string]bool)
+	for _, p := range uuids {
+		peers[p] = true
+	}
+	d.draining.mut.Lock()
+	defer d.draining.mut.Unlock()
+	for p := range peers {
+		if !d.draining.peers[p] {
+			clog.Infof("peer %s is draining; moving its blocks to other peers", p)
+		}
+	}
+	for p := range d.draining.peers {
+		if !peers[p] {
+			clog.Infof("peer %s is no longer draining", p)
+		}
+	}
+	d.draining.peers = peers
+	promDistDrainingPeers.Set(float64(len(peers)))
+}
+
+// avoidDraining returns perm with the draining peers moved to the end, in
+// their original order, so that they hold a block only if there aren't
+// enough other peers to. Reads still fall back to them, as they do to any
+// peer past the replicas, until their blocks have been moved.
+func (d *Distributor) avoidDraining(perm torus.PeerPermutation) torus.PeerPermutation {
+	d.draining.mut.RLock()
+	defer d.draining.mut.RUnlock()
+	if len(d.draining.peers) == 0 {
+		return perm
+	}
+	drained := false
+	for _, p := range perm.Replicas() {
+		if d.draining.peers[p] {
+			drained = true
+			break
+		}
+	}
+	if !drained {
+		return perm
+	}
+	// The permutation may be shared with the placement cache, so build a
+	// new one.
+	out := make(torus.PeerList, 0, len(perm.Peers))
+	for _, p := range perm.Peers {
+		if !d.draining.peers[p] {
+			out = append(out, p)
+		}
+	}
+	for _, p := range perm.Peers {
+		if d.draining.peers[p] {
+			out = append(out, p)
+		}
+	}
+	return torus.PeerPermutation{
+		Peers:       out,
+		Replication: perm.Replication,
+	}
+}
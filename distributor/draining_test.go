@@ -0,0 +1,35 @@
+package distributor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+func TestAvoidDraining(t *testing.T) {
+	d := &Distributor{}
+	d.draining.peers = map[string]bool{"b": true}
+	perm := torus.PeerPermutation{
+		Peers:       torus.PeerList{"a", "b", "c", "d"},
+		Replication: 2,
+	}
+	got := d.avoidDraining(perm)
+	if want := (torus.PeerList{"a", "c", "d", "b"}); !reflect.DeepEqual(got.Peers, want) {
+		t.Fatalf("expected %v, got %v", want, got.Peers)
+	}
+	if perm.Peers[1] != "b" {
+		t.Fatal("expected the original permutation to be left alone")
+	}
+	// Peers past the replicas don't hold the block anyway.
+	d.draining.peers = map[string]bool{"d": true}
+	if got := d.avoidDraining(perm); !reflect.DeepEqual(got.Peers, perm.Peers) {
+		t.Fatalf("expected %v, got %v", perm.Peers, got.Peers)
+	}
+	// With too few peers left, draining ones still hold blocks.
+	d.draining.peers = map[string]bool{"a": true, "b": true, "c": true}
+	got = d.avoidDraining(perm)
+	if want := (torus.PeerList{"d", "a"}); !reflect.DeepEqual(got.Replicas(), want) {
+		t.Fatalf("expected replicas %v, got %v", want, got.Replicas())
+	}
+}
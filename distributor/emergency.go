@@ -0,0 +1,119 @@
+package distributor
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// How often we look for emergencies declared by other peers.
+var emergencyPollInterval = 5 * time.Second
+
+type emergencyState struct {
+	policy   torus.RepairPolicy
+	local    *torus.Emergency
+	others   int
+	lastPoll time.Time
+}
+
+func (d *Distributor) criticalBlocks() uint64 {
+	var n uint64
+	for _, st := range d.rebalancer.VolumeStats() {
+		n += st.Critical
+	}
+	return n
+}
+
+// pollEmergencies refreshes the repair policy and the emergencies declared by
+// other peers, at most every emergencyPollInterval.
+func (d *Distributor) pollEmergencies() {
+	rmds, ok := d.srv.MDS.(torus.RepairMetadataService)
+	if !ok || time.Since(d.emergency.lastPoll) < emergencyPollInterval {
+		return
+	}
+	d.emergency.lastPoll = time.Now()
+	policy, err := rmds.GetRepairPolicy()
+	if err != nil {
+		clog.Errorf("couldn't get repair policy: %v", err)
+	} else {
+		d.emergency.policy = policy
+	}
+	es, err := rmds.GetEmergencies()
+	if err != nil {
+		clog.Errorf("couldn't get emergencies: %v", err)
+		return
+	}
+	others := 0
+	for _, e := range es {
+		if e.Peer != d.UUID() {
+			others++
+		}
+	}
+	d.emergency.others = others
+}
+
+// updateEmergency declares, updates or clears this peer's emergency based on
+// the rebalance pass so far. passDone is set once the pass has finished.
+func (d *Distributor) updateEmergency(passDone bool) {
+	rmds, ok := d.srv.MDS.(torus.RepairMetadataService)
+	if !ok {
+		return
+	}
+	critical := d.criticalBlocks()
+	e := d.emergency.local
+	switch {
+	case critical > 0 && e == nil:
+		e = &torus.Emergency{
+			Peer:           d.UUID(),
+			Since:          time.Now().UnixNano(),
+			CriticalBlocks: critical,
+		}
+		clog.Errorf("EMERGENCY: %d blocks have no live replica besides the one on this peer; repairing", critical)
+		promDistEmergencies.Inc()
+	case e != nil && critical > e.CriticalBlocks:
+		e.CriticalBlocks = critical
+	case e != nil && passDone && critical == 0:
+		clog.Noticef("emergency over: all blocks on this peer have a second replica again (declared %s ago)", time.Since(time.Unix(0, e.Since)))
+		e = nil
+	default:
+		return
+	}
+	if e != nil {
+		promDistCriticalBlocks.Set(float64(e.CriticalBlocks))
+		promDistEmergencyActive.Set(1)
+	} else {
+		promDistCriticalBlocks.Set(0)
+		promDistEmergencyActive.Set(0)
+	}
+	err := rmds.SetEmergency(d.srv.Lease(), e)
+	if err != nil {
+		clog.Errorf("couldn't update emergency: %v", err)
+	}
+	d.emergency.local = e
+}
+
+// preempted returns whether this peer should hold off on background work so
+// that peers with critical blocks get the cluster to themselves.
+func (d *Distributor) preempted() bool {
+	return d.emergency.policy == torus.RepairPreempt && d.emergency.local == nil && d.emergency.others > 0
+}
+
+// repairing returns whether this peer should skip rate limiting because it
+// holds critical blocks.
+func (d *Distributor) repairing() bool {
+	return d.emergency.policy == torus.RepairPreempt && d.emergency.local != nil
+}
+
+// rebalanceWait returns how long the rebalancer waits before its next tick,
+// having moved written blocks in the last. A peer preempted by another's
+// emergency only wakes up to see whether it's over, unless it has failed
+// peers' blocks to recover, and one in an emergency doesn't wait at all.
+func (d *Distributor) rebalanceWait(written int) time.Duration {
+	switch {
+	case d.preempted() && !d.recovering():
+		return emergencyPollInterval
+	case d.repairing():
+		return 0
+	}
+	return d.rebalanceDelay(written)
+}
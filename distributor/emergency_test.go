@@ -0,0 +1,175 @@
+package distributor
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/rebalance"
+	"github.com/coreos/torus/gc"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"golang.org/x/net/context"
+)
+
+type testRinger struct {
+	r    torus.Ring
+	uuid string
+}
+
+func (t testRinger) Ring() torus.Ring { return t.r }
+func (t testRinger) UUID() string     { return t.uuid }
+
+// memPeer is another peer's block store, as the rebalancer sees it.
+type memPeer struct {
+	mut    sync.Mutex
+	blocks map[torus.BlockRef][]byte
+}
+
+func (p *memPeer) Check(ctx context.Context, peer string, refs []torus.BlockRef) ([]bool, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	out := make([]bool, len(refs))
+	for i, ref := range refs {
+		_, out[i] = p.blocks[ref]
+	}
+	return out, nil
+}
+
+func (p *memPeer) PutBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.blocks[ref] = data
+	return nil
+}
+
+// rebalancePass runs a whole rebalance pass, keeping the emergency up to date
+// as the rebalance ticker does, and returns how many blocks it sent.
+func rebalancePass(t *testing.T, d *Distributor) int {
+	d.rebalancer.Reset()
+	total := 0
+	for {
+		written, err := d.rebalancer.Tick()
+		d.updateEmergency(err == io.EOF)
+		total += written
+		if err == io.EOF {
+			return total
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmergencyRepairPreempts(t *testing.T) {
+	md := temp.NewServer()
+	defer md.Close()
+	var ds []*Distributor
+	for i := 0; i < 2; i++ {
+		srv := newServer(md)
+		defer srv.Close()
+		srv.Cfg.ScrubRate = 1024 * 1024
+		ds = append(ds, &Distributor{srv: srv, blocks: srv.Blocks})
+	}
+	a, b := ds[0], ds[1]
+	if err := a.srv.MDS.(torus.RepairMetadataService).SetRepairPolicy(torus.RepairPreempt); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Mod),
+		Version:           2,
+		ReplicationFactor: 2,
+		Peers:             torus.PeerInfoList{{UUID: a.UUID()}, {UUID: b.UUID()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every block of a's is down to its last replica; b has lost its
+	// copies.
+	peer := &memPeer{blocks: make(map[torus.BlockRef][]byte)}
+	a.rebalancer = rebalance.NewRebalancer(testRinger{r, a.UUID()}, a.blocks, peer, &gc.NullGC{})
+	data := make([]byte, a.blocks.BlockSize())
+	for i := 1; i <= 10; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		if err := a.blocks.WriteBlock(context.TODO(), ref, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range ds {
+		d.pollEmergencies()
+		if d.preempted() || d.repairing() {
+			t.Fatal("expected no emergency before any pass")
+		}
+	}
+
+	// The pass that finds them declares an emergency, and sends them on.
+	if n := rebalancePass(t, a); n != 10 {
+		t.Fatalf("expected the pass to repair 10 blocks, sent %d", n)
+	}
+	es, err := a.srv.MDS.(torus.RepairMetadataService).GetEmergencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 || es[0].CriticalBlocks != 10 {
+		t.Fatalf("expected an emergency over 10 blocks, got %+v", es)
+	}
+	a.emergency.lastPoll = time.Time{}
+	a.pollEmergencies()
+	if !a.repairing() || a.preempted() || a.rebalanceWait(10) != 0 {
+		t.Fatal("expected the peer in an emergency to repair without waiting")
+	}
+	// Other peers hold off on their rebalancing, garbage collection and
+	// scrubbing, only checking back on the emergency.
+	b.emergency.lastPoll = time.Time{}
+	b.pollEmergencies()
+	if !b.preempted() || b.repairing() {
+		t.Fatal("expected the other peer to be preempted")
+	}
+	if w := b.rebalanceWait(0); w != emergencyPollInterval {
+		t.Fatalf("expected the preempted peer to wait %s, got %s", emergencyPollInterval, w)
+	}
+	var scrubbers []*scrubber
+	for _, d := range ds {
+		d.setGCPreempted(d.preempted())
+		s := d.newScrubber()
+		s.start()
+		scrubbers = append(scrubbers, s)
+	}
+	if !scrubbers[0].active() {
+		t.Fatal("expected the repairing peer to keep scrubbing")
+	}
+	if scrubbers[1].active() {
+		t.Fatal("expected the preempted peer to hold off scrubbing")
+	}
+
+	// Once a pass finds every block with a second replica, it's over.
+	if n := rebalancePass(t, a); n != 0 {
+		t.Fatalf("expected nothing left to repair, sent %d", n)
+	}
+	es, err = a.srv.MDS.(torus.RepairMetadataService).GetEmergencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 0 {
+		t.Fatalf("expected the emergency to be over, got %+v", es)
+	}
+	for _, d := range ds {
+		d.emergency.lastPoll = time.Time{}
+		d.pollEmergencies()
+		if d.preempted() || d.repairing() {
+			t.Fatal("expected no peer to be preempted or repairing after the emergency")
+		}
+		if w := d.rebalanceWait(0); w != d.rebalanceDelay(0) {
+			t.Fatalf("expected the usual rebalance delay, got %s", w)
+		}
+	}
+	for i, d := range ds {
+		d.setGCPreempted(d.preempted())
+		if !scrubbers[i].active() {
+			t.Fatal("expected every peer to scrub after the emergency")
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package distributor
+
+import "github.com/coreos/torus"
+
+// keyringEntry is a volume's keyring, or why it can't be used.
+type keyringEntry struct {
+	kr  *torus.Keyring
+	err error
+}
+
+// volumeKeyring is the keyring function given to the local block store.
+func (d *Distributor) volumeKeyring(vid torus.VolumeID) (*torus.Keyring, error) {
+	emds, ok := d.srv.MDS.(torus.EncryptionMetadataService)
+	if !ok {
+		return nil, nil
+	}
+	v, err := d.policies.get(vid, policyKeyring, func(old interface{}) (interface{}, error) {
+		e, _ := old.(keyringEntry)
+		vk, err := emds.GetVolumeKeys(vid)
+		switch {
+		case err == torus.ErrNotExist:
+			e = keyringEntry{}
+		case err != nil:
+			clog.Errorf("couldn't get keys for volume %d: %v", vid, err)
+			if e.kr == nil {
+				// Better to fail than to write an encrypted volume's
+				// blocks in the clear.
+				return nil, torus.ErrKeyUnavailable
+			}
+		default:
+			e.kr, e.err = torus.UnwrapVolumeKeys(d.srv.Cfg.EncryptionKey, vid, vk)
+			if e.err != nil {
+				clog.Errorf("couldn't unwrap keys for volume %d: %v", vid, e.err)
+				e.kr, e.err = nil, torus.ErrKeyUnavailable
+			}
+		}
+		return e, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	e := v.(keyringEntry)
+	return e.kr, e.err
+}
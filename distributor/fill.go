@@ -0,0 +1,90 @@
+package distributor
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// When Cfg.FillThreshold is set, the weights of ring members that fill up
+// past it are lowered a step at a time, by ring changes like any other, so
+// that new blocks go to emptier peers and the rebalancer moves some of the
+// old ones there too. Every peer reports how full it is in its heartbeats;
+// only the live member with the lowest UUID proposes the changes, so that
+// peers don't race each other to.
+
+// How often ring members' fill is checked against the threshold. Each
+// change moves blocks, so this leaves time for them to move before the next.
+var fillPollInterval = 5 * time.Minute
+
+func (d *Distributor) fillTicker(closer chan struct{}) {
+	if d.srv.Cfg.FillThreshold == 0 {
+		return
+	}
+	// The version of the last ring that couldn't be adjusted, so that it's
+	// only complained about once.
+	unadjustable := -1
+	for {
+		select {
+		case <-closer:
+			return
+		case <-time.After(fillPollInterval):
+		}
+		d.mut.RLock()
+		r := d.ring
+		d.mut.RUnlock()
+		if r.Version() == unadjustable || !d.coordinatesFill(r) {
+			continue
+		}
+		wr, ok := r.(torus.WeightAdjustableRing)
+		if !ok {
+			clog.Warningf("can't adjust the weights of full peers: a %s ring doesn't weigh its peers", r.Describe())
+			unadjustable = r.Version()
+			continue
+		}
+		cur := wr.WeightAdjustments()
+		var infos torus.PeerInfoList
+		for _, m := range r.Members() {
+			if pi := d.srv.GetPeer(m); pi != nil && !pi.TimedOut {
+				infos = append(infos, pi)
+			}
+		}
+		next := torus.FillAdjustments(cur, infos, d.srv.Cfg.FillThreshold)
+		if reflect.DeepEqual(cur, next) {
+			continue
+		}
+		newRing, err := wr.AdjustWeights(next)
+		if err != nil {
+			clog.Warningf("can't adjust the weights of full peers: %v", err)
+			unadjustable = r.Version()
+			continue
+		}
+		err = torus.ChangeRing(d.srv.MDS, newRing, torus.DefaultRingAckTimeout)
+		if err != nil {
+			// Another change got there first; look again next time.
+			clog.Debugf("couldn't change ring %d to adjust weights: %v", newRing.Version(), err)
+			continue
+		}
+		promDistWeightAdjustments.Inc()
+		clog.Infof("adjusted the weights of ring members for fill in ring %d: %v", newRing.Version(), next)
+	}
+}
+
+// coordinatesFill returns whether this peer is the live member of r with the
+// lowest UUID, which is the one that adjusts weights for fill.
+func (d *Distributor) coordinatesFill(r torus.Ring) bool {
+	me := d.UUID()
+	if !r.Members().Has(me) {
+		return false
+	}
+	for _, m := range r.Members() {
+		if m >= me {
+			continue
+		}
+		if !d.srv.PeerDown(m) && d.srv.GetPeer(m) != nil {
+			return false
+		}
+	}
+	return true
+}
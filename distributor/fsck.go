@@ -0,0 +1,265 @@
+package distributor
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/gc"
+)
+
+var (
+	// How often peers look for a new fsck request.
+	fsckPollInterval = 5 * time.Second
+	// How long to wait on another peer for each batch of an fsck.
+	fsckTimeout = 5 * time.Second
+	// How many blocks to ask another peer about at once.
+	fsckCheckBatch = 1024
+)
+
+// fsckTicker answers each fsck request once, checking the local blocks and
+// saving a report of what it found.
+func (d *Distributor) fsckTicker(closer chan struct{}) {
+	fmds, ok := d.srv.MDS.(torus.FsckMetadataService)
+	if !ok {
+		return
+	}
+	// A request answered before a restart isn't answered again.
+	var last int64
+	if rs, err := fmds.GetFsckReports(); err == nil {
+		for _, r := range rs {
+			if r.Peer == d.UUID() {
+				last = r.Requested
+			}
+		}
+	}
+	for {
+		select {
+		case <-closer:
+			return
+		case <-time.After(fsckPollInterval):
+		}
+		req, err := fmds.GetFsckRequest()
+		if err != nil {
+			clog.Errorf("couldn't get fsck request: %v", err)
+			continue
+		}
+		if req.Requested == 0 || req.Requested == last {
+			continue
+		}
+		last = req.Requested
+		r := d.fsck(req)
+		err = fmds.SaveFsckReport(r)
+		if err != nil {
+			clog.Errorf("couldn't save fsck report: %v", err)
+		}
+	}
+}
+
+// fsckPlacement is a live local block and the peers the ring puts it on.
+type fsckPlacement struct {
+	ref      torus.BlockRef
+	replicas torus.PeerList
+}
+
+// fsck checks every local block against the volumes' INodes and the current
+// ring. Blocks no volume uses are orphans. Blocks the ring doesn't put here
+// are misplaced. Replicas the ring puts on other peers that don't have them
+// are missing; they're reported by the first replica that has the block, or,
+// if none has it, by every peer holding a misplaced copy.
+func (d *Distributor) fsck(req torus.FsckRequest) *torus.FsckReport {
+	r := &torus.FsckReport{
+		Peer:      d.UUID(),
+		Requested: req.Requested,
+	}
+	defer func() {
+		r.Finished = time.Now().UnixNano()
+		clog.Infof("fsck checked %d blocks: %d orphaned, %d misplaced, %d replicas missing, %d fixed",
+			r.Checked, r.Orphans, r.Misplaced, r.Missing, r.Fixed)
+	}()
+	clog.Infof("starting fsck of local blocks")
+	marks, err := gc.MarkAll(d.srv, torus.NewINodeStore(d))
+	if err != nil {
+		addFsckError(r, "couldn't mark volumes: %v", err)
+		return r
+	}
+	var refs []torus.BlockRef
+	it := d.blocks.BlockIterator()
+	for it.Next() {
+		refs = append(refs, it.BlockRef())
+	}
+	err = it.Err()
+	it.Close()
+	if err != nil {
+		addFsckError(r, "couldn't list local blocks: %v", err)
+		return r
+	}
+	d.mut.RLock()
+	ring := d.ring
+	d.mut.RUnlock()
+
+	self := d.UUID()
+	var live []fsckPlacement
+	ask := make(map[string][]torus.BlockRef)
+	for _, ref := range refs {
+		r.Checked++
+		if marks.IsDead(ref) {
+			r.Orphans++
+			fixed := false
+			if req.Fix {
+				fixed = d.fsckDelete(ref, r)
+			}
+			addFsckBlock(r, torus.FsckBlock{Ref: ref, Problem: torus.FsckOrphan, Fixed: fixed})
+			continue
+		}
+		perm, err := d.placeBlock(ring, ref)
+		if err != nil {
+			addFsckError(r, "couldn't place block %s: %v", ref, err)
+			continue
+		}
+		p := fsckPlacement{ref: ref, replicas: perm.Replicas()}
+		for _, peer := range p.replicas {
+			if peer != self {
+				ask[peer] = append(ask[peer], ref)
+			}
+		}
+		live = append(live, p)
+	}
+	has := d.fsckAsk(ask, r)
+
+	for _, p := range live {
+		misplaced := !p.replicas.Has(self)
+		first := ""
+		var missing []string
+		for _, peer := range p.replicas {
+			if peer == self || has[peer][p.ref] {
+				if first == "" {
+					first = peer
+				}
+				continue
+			}
+			if _, asked := has[peer]; asked {
+				missing = append(missing, peer)
+			}
+		}
+		report := first == self || (misplaced && first == "")
+		var data []byte
+		if req.Fix && len(missing) != 0 && (report || misplaced) {
+			data, err = d.blocks.GetBlock(context.TODO(), p.ref)
+			if err != nil {
+				addFsckError(r, "couldn't read block %s: %v", p.ref, err)
+			}
+		}
+		copied := 0
+		for _, peer := range missing {
+			fixed := false
+			if data != nil {
+				ctx, cancel := context.WithTimeout(context.TODO(), fsckTimeout)
+				ctx, err := d.copyContext(ctx, p.ref.Volume())
+				if err == nil {
+					err = d.client.PutBlock(ctx, peer, p.ref, data)
+				}
+				cancel()
+				if err != nil {
+					addFsckError(r, "couldn't copy block %s to %s: %v", p.ref, peer, err)
+				} else {
+					fixed = true
+					copied++
+				}
+			}
+			if report {
+				r.Missing++
+				addFsckBlock(r, torus.FsckBlock{Ref: p.ref, Problem: torus.FsckMissing, Peer: peer, Fixed: fixed})
+			}
+		}
+		if !misplaced {
+			continue
+		}
+		r.Misplaced++
+		fixed := false
+		// The misplaced copy goes once every replica is known to have the
+		// block.
+		if req.Fix && copied == len(missing) && allAsked(has, p.replicas) {
+			fixed = d.fsckDelete(p.ref, r)
+		}
+		addFsckBlock(r, torus.FsckBlock{Ref: p.ref, Problem: torus.FsckMisplaced, Fixed: fixed})
+	}
+	if req.Fix {
+		if err := d.blocks.Flush(); err != nil {
+			addFsckError(r, "couldn't flush local blocks: %v", err)
+		}
+	}
+	return r
+}
+
+// fsckAsk asks each peer which of the blocks it has. Peers that couldn't be
+// asked about all of their blocks are left out, and noted in the report.
+func (d *Distributor) fsckAsk(ask map[string][]torus.BlockRef, r *torus.FsckReport) map[string]map[torus.BlockRef]bool {
+	has := make(map[string]map[torus.BlockRef]bool)
+	for peer, refs := range ask {
+		set := make(map[torus.BlockRef]bool)
+		for len(refs) != 0 {
+			n := len(refs)
+			if n > fsckCheckBatch {
+				n = fsckCheckBatch
+			}
+			ctx, cancel := context.WithTimeout(context.TODO(), fsckTimeout)
+			oks, err := d.client.Check(ctx, peer, refs[:n])
+			cancel()
+			if err != nil {
+				addFsckError(r, "couldn't ask %s which blocks it has: %v", peer, err)
+				set = nil
+				break
+			}
+			for i, ok := range oks {
+				if ok {
+					set[refs[i]] = true
+				}
+			}
+			refs = refs[n:]
+		}
+		if set != nil {
+			has[peer] = set
+		}
+	}
+	return has
+}
+
+func allAsked(has map[string]map[torus.BlockRef]bool, peers torus.PeerList) bool {
+	for _, peer := range peers {
+		if _, ok := has[peer]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Distributor) fsckDelete(ref torus.BlockRef, r *torus.FsckReport) bool {
+	err := d.DeleteBlock(context.TODO(), ref)
+	if err != nil && err != torus.ErrBlockNotExist {
+		addFsckError(r, "couldn't delete block %s: %v", ref, err)
+		return false
+	}
+	return true
+}
+
+// addFsckBlock lists a problem block in the report, up to FsckMaxListed of
+// them, and counts it as fixed.
+func addFsckBlock(r *torus.FsckReport, b torus.FsckBlock) {
+	if b.Fixed {
+		r.Fixed++
+	}
+	if len(r.Blocks) < torus.FsckMaxListed {
+		r.Blocks = append(r.Blocks, b)
+	}
+}
+
+// addFsckError notes why part of the check couldn't be done, up to
+// FsckMaxListed times.
+func addFsckError(r *torus.FsckReport, format string, args ...interface{}) {
+	if len(r.Errors) < torus.FsckMaxListed {
+		r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+	}
+}
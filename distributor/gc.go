@@ -0,0 +1,57 @@
+package distributor
+
+import (
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// How often the garbage collector does a cycle of work, and the most
+	// blocks it sweeps in one.
+	gcCycleInterval = 100 * time.Millisecond
+	gcCycleBlocks   = 256
+	// How long the garbage collector rests between passes.
+	gcPassInterval = 30 * time.Second
+)
+
+// gcTicker runs the garbage collector a cycle at a time, resting between
+// passes and while emergency repair on another peer preempts background
+// work.
+func (d *Distributor) gcTicker(closer chan struct{}) {
+	time.Sleep(time.Duration(250+rand.Intn(250)) * time.Millisecond)
+	timeout := gcCycleInterval
+	for {
+		select {
+		case <-closer:
+			return
+		case <-time.After(timeout):
+		}
+		timeout = gcCycleInterval
+		if atomic.LoadInt32(&d.gcPreempted) != 0 {
+			timeout = emergencyPollInterval
+			continue
+		}
+		err := d.collector.Cycle(gcCycleBlocks)
+		switch err {
+		case nil:
+		case io.EOF:
+			timeout = gcPassInterval + time.Duration(rand.Intn(3))*time.Second
+		default:
+			clog.Errorf("gc cycle failed: %v", err)
+			timeout = gcPassInterval
+		}
+	}
+}
+
+// setGCPreempted holds the garbage collector and the scrubber off while
+// preempted. It's set by the rebalance goroutine, which keeps track of
+// emergencies.
+func (d *Distributor) setGCPreempted(preempted bool) {
+	var v int32
+	if preempted {
+		v = 1
+	}
+	atomic.StoreInt32(&d.gcPreempted, v)
+}
@@ -0,0 +1,158 @@
+package distributor
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// How often we try to hand off blocks held on behalf of other peers.
+var handoffInterval = 10 * time.Second
+
+// writeHinted stores a block that belongs on owner with the first peer after
+// the replicas that will take it, skipping those in skip. It returns the peer
+// that took it.
+func (d *Distributor) writeHinted(ctx context.Context, owner string, i torus.BlockRef, data []byte, peers torus.PeerPermutation, skip torus.PeerList) (string, error) {
+	for _, p := range peers.Fallback(-1) {
+		if skip.Has(p) {
+			continue
+		}
+		var err error
+		if p == d.UUID() {
+			err = d.writeLocalHinted(ctx, owner, i, data)
+		} else {
+			err = d.client.PutHintedBlock(ctx, p, owner, i, data)
+		}
+		if err == nil {
+			return p, nil
+		}
+		clog.Noticef("error writing block hinted for %s to peer %s: %s", owner, p, err)
+	}
+	return "", torus.ErrNoPeer
+}
+
+func (d *Distributor) writeLocalHinted(ctx context.Context, owner string, i torus.BlockRef, data []byte) error {
+	hl, ok := d.blocks.(torus.HintLog)
+	if !ok {
+		return torus.ErrNotSupported
+	}
+	err := d.blocks.WriteBlock(ctx, i, data)
+	if err != nil && err != torus.ErrExists {
+		return err
+	}
+	err = hl.AddHint(owner, i)
+	if err != nil {
+		return err
+	}
+	promDistHintsStored.Inc()
+	return nil
+}
+
+// handoffTicker hands off hinted blocks to their owners, periodically and
+// whenever an owner asks for them.
+func (d *Distributor) handoffTicker(closer chan struct{}) {
+	hl, ok := d.blocks.(torus.HintLog)
+	if !ok {
+		return
+	}
+	// Anything written while we were gone is waiting on other peers.
+	d.requestHandoff()
+	for {
+		select {
+		case <-closer:
+			return
+		case peer := <-d.drainChan:
+			d.handoff(hl, peer, true)
+		case <-time.After(handoffInterval):
+			for _, peer := range hl.HintedPeers() {
+				d.handoff(hl, peer, false)
+			}
+		}
+	}
+}
+
+// requestHandoff asks every other peer in the ring to hand off what it holds
+// for us.
+func (d *Distributor) requestHandoff() {
+	d.mut.RLock()
+	members := d.ring.Members()
+	d.mut.RUnlock()
+	for _, p := range members {
+		if p == d.UUID() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.TODO(), clientTimeout)
+		err := d.client.DrainHints(ctx, p, d.UUID())
+		cancel()
+		if err != nil {
+			clog.Debugf("couldn't request handoff from %s: %v", p, err)
+		}
+	}
+}
+
+// handoff sends the blocks held for peer back to it. Unless force is set, it
+// waits until the peer is heartbeating again.
+func (d *Distributor) handoff(hl torus.HintLog, peer string, force bool) {
+	if !force {
+		pi := d.srv.GetPeerMap()[peer]
+		if pi == nil || pi.TimedOut {
+			return
+		}
+	}
+	refs := hl.Hints(peer)
+	if len(refs) == 0 {
+		return
+	}
+	clog.Debugf("handing off %d blocks to %s", len(refs), peer)
+	n := 0
+	for _, ref := range refs {
+		d.mut.RLock()
+		perm, err := d.getPeers(ref)
+		d.mut.RUnlock()
+		if err != nil {
+			clog.Errorf("couldn't place hinted block %s: %v", ref, err)
+			continue
+		}
+		replicas := perm.Replicas()
+		ctx, cancel := context.WithTimeout(torus.WithIOClass(context.TODO(), torus.IOClassBatch), writeClientTimeout)
+		handedOff := false
+		if replicas.Has(peer) {
+			var data []byte
+			data, err = d.blocks.GetBlock(ctx, ref)
+			if err == nil {
+				ctx, err = d.copyContext(ctx, ref.Volume())
+				if err == nil {
+					err = d.client.PutBlock(ctx, peer, ref, data)
+				}
+				if err != nil && err != torus.ErrExists {
+					cancel()
+					clog.Warningf("couldn't hand off blocks to %s: %v", peer, err)
+					break
+				}
+				handedOff = true
+				n++
+				promDistHintsHandedOff.Inc()
+			}
+			// If the block is gone, it was collected or rebalanced away and
+			// there's nothing left to hand off.
+		}
+		// If the ring moved on and the peer no longer wants the block, the
+		// rebalancer takes care of it from here.
+		err = hl.RemoveHint(peer, ref)
+		if err == nil && handedOff && !replicas.Has(d.UUID()) {
+			err = d.blocks.DeleteBlock(ctx, ref)
+		}
+		cancel()
+		if err != nil {
+			clog.Errorf("couldn't clear hinted block %s: %v", ref, err)
+		}
+	}
+	if n != 0 {
+		clog.Infof("handed off %d blocks to %s", n, peer)
+	}
+	err := d.blocks.Flush()
+	if err != nil {
+		clog.Errorf("couldn't flush after handoff: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package distributor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// hedgeSamples is how many of the latest reads from peers the hedge
+	// delay is worked out from.
+	hedgeSamples = 512
+	// hedgeRecompute is how many reads go by between working it out.
+	hedgeRecompute = 32
+	// defaultHedgeDelay is the hedge delay until enough reads have been
+	// seen to work it out.
+	defaultHedgeDelay = 20 * time.Millisecond
+	// minHedgeDelay keeps reads from peers that answer very quickly from
+	// always being hedged.
+	minHedgeDelay = time.Millisecond
+)
+
+// hedgeState keeps the latency of the latest successful reads from peers,
+// and their 95th percentile, which is how long a hedged read waits before
+// asking another peer.
+type hedgeState struct {
+	mut     sync.Mutex
+	samples []time.Duration
+	next    int
+	since   int
+	p95     time.Duration
+}
+
+func (h *hedgeState) observe(d time.Duration) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if len(h.samples) < hedgeSamples {
+		h.samples = append(h.samples, d)
+	} else {
+		h.samples[h.next] = d
+		h.next = (h.next + 1) % hedgeSamples
+	}
+	h.since++
+	if h.since < hedgeRecompute {
+		return
+	}
+	h.since = 0
+	sorted := append(durations(nil), h.samples...)
+	sort.Sort(sorted)
+	h.p95 = sorted[len(sorted)*95/100]
+	promDistHedgeDelay.Set(h.p95.Seconds())
+}
+
+// delay returns how long a hedged read waits before asking another peer,
+// or zero if it isn't known yet.
+func (h *hedgeState) delay() time.Duration {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	return h.p95
+}
+
+func (d *Distributor) hedgeDelay() time.Duration {
+	if delay := d.srv.Cfg.HedgeDelay; delay != 0 {
+		return delay
+	}
+	delay := d.hedge.delay()
+	if delay == 0 {
+		return defaultHedgeDelay
+	}
+	if delay < minHedgeDelay {
+		return minHedgeDelay
+	}
+	return delay
+}
+
+// readHedged reads a block from the first peer to have it, and if it hasn't
+// answered within the hedge delay, asks the next peer too, and so on,
+// taking whichever answers first. A peer that fails is passed over without
+// waiting. If none of them answers, they are read in turn with backoff, as
+// for ReadBlock.
+func (d *Distributor) readHedged(ctx context.Context, i torus.BlockRef, peers torus.PeerPermutation) ([]byte, error) {
+	var remote []string
+	for _, p := range peers.Peers {
+		if p != d.UUID() {
+			remote = append(remote, p)
+		}
+	}
+	if len(remote) == 0 {
+		return d.readWithBackoff(ctx, i, peers)
+	}
+	type reply struct {
+		peer  string
+		blk   []byte
+		err   error
+		hedge bool
+	}
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replies := make(chan reply, len(remote))
+	sent := 0
+	send := func(hedge bool) {
+		peer := remote[sent]
+		sent++
+		if hedge {
+			promDistHedgedReads.Inc()
+		}
+		go func() {
+			start := time.Now()
+			getctx, cancel := context.WithTimeout(hctx, clientTimeout)
+			blk, err := d.readFromPeer(getctx, i, peer)
+			cancel()
+			if err == nil {
+				d.hedge.observe(time.Since(start))
+			}
+			replies <- reply{peer, blk, err, hedge}
+		}()
+	}
+
+	delay := d.hedgeDelay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	resetTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(delay)
+	}
+	send(false)
+	pending := 1
+	for pending != 0 {
+		select {
+		case r := <-replies:
+			pending--
+			if r.err == nil {
+				if r.hedge {
+					promDistHedgedReadWins.Inc()
+				}
+				return r.blk, nil
+			}
+			promDistBlockPeerFailures.WithLabelValues(r.peer).Inc()
+			clog.Debugf("failed hedged read of %s from %s: %v", i, r.peer, r.err)
+			if sent < len(remote) {
+				send(false)
+				pending++
+				resetTimer()
+			}
+		case <-timer.C:
+			if sent < len(remote) {
+				send(true)
+				pending++
+				timer.Reset(delay)
+			}
+		}
+	}
+	clog.Warningf("no peer answered a hedged read of %s, retrying", i)
+	return d.readWithBackoff(ctx, i, peers)
+}
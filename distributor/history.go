@@ -0,0 +1,87 @@
+package distributor
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/rebalance"
+)
+
+// transition accumulates what this peer does to move data for a ring change,
+// to be recorded in the rebalance history once the change is complete.
+type transition struct {
+	rec         torus.RebalanceRecord
+	windowStart time.Time
+	windowBytes uint64
+}
+
+// beginTransition starts accounting for a ring change, or extends the current
+// one if the ring changed again before it completed.
+func (d *Distributor) beginTransition() {
+	if d.transition != nil {
+		d.transition.rec.ToVersion = d.ring.Version()
+		return
+	}
+	now := time.Now()
+	d.transition = &transition{
+		rec: torus.RebalanceRecord{
+			Peer:        d.UUID(),
+			FromVersion: d.settledVersion,
+			ToVersion:   d.ring.Version(),
+			Start:       now.UnixNano(),
+		},
+		windowStart: now,
+	}
+}
+
+// sent counts blocks sent by a rebalance tick, keeping track of the peak rate
+// over one-second windows.
+func (t *transition) sent(blocks int, blockSize uint64) {
+	n := uint64(blocks) * blockSize
+	t.rec.BlocksSent += uint64(blocks)
+	t.rec.BytesSent += n
+	t.windowBytes += n
+	if elapsed := time.Since(t.windowStart); elapsed >= time.Second {
+		t.closeWindow(elapsed)
+	}
+}
+
+func (t *transition) closeWindow(elapsed time.Duration) {
+	rate := uint64(float64(t.windowBytes) / elapsed.Seconds())
+	if rate > t.rec.PeakRate {
+		t.rec.PeakRate = rate
+	}
+	t.windowStart = time.Now()
+	t.windowBytes = 0
+}
+
+// passDone adds the failures of a finished rebalance pass.
+func (t *transition) passDone(stats map[torus.VolumeID]rebalance.VolumeStats) {
+	for _, st := range stats {
+		t.rec.Errors += st.Failed
+	}
+}
+
+// finishTransition records the completed ring change in the rebalance
+// history.
+func (d *Distributor) finishTransition() {
+	t := d.transition
+	if t == nil {
+		return
+	}
+	d.transition = nil
+	if elapsed := time.Since(t.windowStart); t.windowBytes != 0 && elapsed > 0 {
+		t.closeWindow(elapsed)
+	}
+	t.rec.Finish = time.Now().UnixNano()
+	clog.Infof("rebalance from ring %d to %d done in %s: sent %d blocks with %d errors",
+		t.rec.FromVersion, t.rec.ToVersion, time.Duration(t.rec.Finish-t.rec.Start), t.rec.BlocksSent, t.rec.Errors)
+	hmds, ok := d.srv.MDS.(torus.RebalanceHistoryService)
+	if !ok {
+		return
+	}
+	err := hmds.RecordRebalance(&t.rec)
+	if err != nil {
+		clog.Errorf("couldn't record rebalance history: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package distributor
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/rebalance"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+)
+
+func TestTransitionHistory(t *testing.T) {
+	srv := newServer(temp.NewServer())
+	defer srv.Close()
+	d := &Distributor{srv: srv, settledVersion: 1}
+	setVersion := func(v int) {
+		r, err := ring.CreateRing(&models.Ring{
+			Type:              uint32(ring.Mod),
+			Version:           uint32(v),
+			ReplicationFactor: 1,
+			Peers:             torus.PeerInfoList{{UUID: d.UUID()}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.ring = r
+	}
+
+	setVersion(2)
+	d.beginTransition()
+	d.transition.sent(3, 1024)
+	d.transition.passDone(map[torus.VolumeID]rebalance.VolumeStats{1: {Failed: 2}})
+	// The ring changes again before the first change is done.
+	setVersion(3)
+	d.beginTransition()
+	d.transition.sent(1, 1024)
+	d.finishTransition()
+	if d.transition != nil {
+		t.Fatal("expected the transition to be over")
+	}
+	// Nothing is recorded without a transition.
+	d.finishTransition()
+
+	rs, err := srv.MDS.(torus.RebalanceHistoryService).GetRebalanceHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 {
+		t.Fatalf("expected one record, got %d", len(rs))
+	}
+	r := rs[0]
+	if r.Peer != d.UUID() || r.FromVersion != 1 || r.ToVersion != 3 {
+		t.Errorf("expected %s's record of ring 1 to 3, got %s's of %d to %d", d.UUID(), r.Peer, r.FromVersion, r.ToVersion)
+	}
+	if r.BlocksSent != 4 || r.BytesSent != 4096 || r.Errors != 2 {
+		t.Errorf("expected 4 blocks and 4096 bytes sent with 2 errors, got %+v", r)
+	}
+	if r.PeakRate == 0 || r.Finish < r.Start {
+		t.Errorf("expected a peak rate and a finish after the start, got %+v", r)
+	}
+}
@@ -0,0 +1,120 @@
+package distributor
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+const (
+	// loadDecay is how far each block read served moves the average read
+	// latency reported in heartbeats.
+	loadDecay = 0.1
+	// minLoadLatency stands in for the read latency of peers that haven't
+	// served a read yet, and keeps peers that answer very quickly from
+	// drawing nearly every read.
+	minLoadLatency = 100 * time.Microsecond
+)
+
+// loadState is how busy this peer is serving blocks to the others.
+type loadState struct {
+	mut     sync.Mutex
+	serving uint64
+	latency time.Duration
+}
+
+// beginServe counts a block request from another peer as in flight until
+// endServe is called with the time it returns.
+func (d *Distributor) beginServe() time.Time {
+	d.load.mut.Lock()
+	d.load.serving++
+	d.load.mut.Unlock()
+	return time.Now()
+}
+
+// endServe ends a request counted by beginServe, adding how long it took to
+// the average read latency if it was a read.
+func (d *Distributor) endServe(start time.Time, read bool) {
+	elapsed := time.Since(start)
+	d.load.mut.Lock()
+	defer d.load.mut.Unlock()
+	d.load.serving--
+	if !read {
+		return
+	}
+	if d.load.latency == 0 {
+		d.load.latency = elapsed
+		return
+	}
+	d.load.latency += time.Duration(loadDecay * float64(elapsed-d.load.latency))
+}
+
+// Load implements torus.LoadReporter.
+func (d *Distributor) Load() torus.PeerLoad {
+	d.load.mut.Lock()
+	defer d.load.mut.Unlock()
+	return torus.PeerLoad{
+		QueueDepth:  d.load.serving,
+		ReadLatency: d.load.latency,
+	}
+}
+
+// loadScore is how loaded a peer said it was in its last heartbeat: roughly,
+// how long a read sent to it now would wait.
+func loadScore(pi *models.PeerInfo) float64 {
+	latency := time.Duration(pi.ReadLatency)
+	if latency < minLoadLatency {
+		latency = minLoadLatency
+	}
+	return latency.Seconds() * float64(1+pi.QueueDepth)
+}
+
+// preferLeastLoaded returns peers with one of the replicas moved to the
+// front, picked at random with odds in inverse proportion to its load score.
+// Lightly loaded replicas draw more reads this way, without every client
+// piling onto the lightest one until the next heartbeats. Peers are left
+// alone if any replica hasn't reported its load.
+func (d *Distributor) preferLeastLoaded(peers torus.PeerPermutation) torus.PeerPermutation {
+	if !d.srv.Cfg.ReadLeastLoaded || peers.Replication < 2 {
+		return peers
+	}
+	reps := peers.Replicas()
+	weights := make([]float64, len(reps))
+	var total float64
+	for n, p := range reps {
+		pi := d.srv.GetPeer(p)
+		if pi == nil {
+			return peers
+		}
+		weights[n] = 1 / loadScore(pi)
+		total += weights[n]
+	}
+	x := rand.Float64() * total
+	pick := len(reps) - 1
+	for n, w := range weights {
+		if x < w {
+			pick = n
+			break
+		}
+		x -= w
+	}
+	if pick == 0 {
+		return peers
+	}
+	promDistLoadRedirectedReads.Inc()
+	out := make(torus.PeerList, 0, len(peers.Peers))
+	out = append(out, reps[pick])
+	for n, p := range reps {
+		if n != pick {
+			out = append(out, p)
+		}
+	}
+	out = append(out, peers.Peers[len(reps):]...)
+	return torus.PeerPermutation{
+		Peers:       out,
+		Replication: peers.Replication,
+	}
+}
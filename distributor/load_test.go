@@ -0,0 +1,73 @@
+package distributor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+)
+
+func TestPreferLeastLoaded(t *testing.T) {
+	md := temp.NewServer()
+	defer md.Close()
+	cfg := torus.Config{
+		StorageSize:     100 * 1024 * 1024,
+		ReadLeastLoaded: true,
+	}
+	mds := temp.NewClient(cfg, md)
+	blocks, _ := torus.CreateBlockStore("temp", "current", cfg, mds.GlobalMetadata())
+	srv, err := torus.NewServerByImpl(cfg, mds, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	loads := map[string]*models.PeerInfo{
+		"busy":  {UUID: "busy", ReadLatency: int64(5 * time.Millisecond), QueueDepth: 1},
+		"quiet": {UUID: "quiet", ReadLatency: int64(time.Millisecond)},
+	}
+	for _, pi := range loads {
+		err = mds.RegisterPeer(0, pi)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.UpdatePeerMap()
+	d := &Distributor{srv: srv}
+
+	// The quiet replica should be read from about ten times as often.
+	peers := torus.PeerPermutation{
+		Peers:       torus.PeerList{"busy", "quiet", "other"},
+		Replication: 2,
+	}
+	first := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		got := d.preferLeastLoaded(peers)
+		if got.Peers[2] != "other" || got.Replication != 2 {
+			t.Fatalf("expected only the replicas to be reordered, got %v", got.Peers)
+		}
+		first[got.Peers[0]]++
+	}
+	if first["busy"] == 0 || first["quiet"] < 3*first["busy"] {
+		t.Fatalf("expected most reads on the quiet replica, got %v", first)
+	}
+	if peers.Peers[0] != "busy" {
+		t.Error("reordering changed the original permutation")
+	}
+
+	// Replicas that haven't reported their load are left alone.
+	peers.Peers = torus.PeerList{"busy", "unknown"}
+	if got := d.preferLeastLoaded(peers); got.Peers[0] != "busy" {
+		t.Errorf("expected the original order, got %v", got.Peers)
+	}
+
+	start := d.beginServe()
+	if l := d.Load(); l.QueueDepth != 1 {
+		t.Errorf("expected a queue depth of 1, got %d", l.QueueDepth)
+	}
+	d.endServe(start, true)
+	if l := d.Load(); l.QueueDepth != 0 || l.ReadLatency == 0 {
+		t.Errorf("expected no queue and some read latency, got %+v", l)
+	}
+}
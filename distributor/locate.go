@@ -0,0 +1,64 @@
+package distributor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// LocateBlock reads the copies of ref that its replicas, and the first
+// fallbacks peers after them, hold. A peer whose copy can't be read is asked
+// whether it has the block at all, to tell a missing copy from an unreadable
+// one.
+func (d *Distributor) LocateBlock(ctx context.Context, ref torus.BlockRef, fallbacks int) ([]torus.ReplicaCopy, error) {
+	perm, err := torus.GetBlockPeers(d.Ring(), ref)
+	if err != nil {
+		return nil, err
+	}
+	replicas := perm.Replicas()
+	peers := append(append(torus.PeerList{}, replicas...), perm.Fallback(fallbacks)...)
+	out := make([]torus.ReplicaCopy, len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			out[i] = d.locateCopy(ctx, p, ref)
+			out[i].Replica = i < len(replicas)
+		}(i, p)
+	}
+	wg.Wait()
+	return out, nil
+}
+
+func (d *Distributor) locateCopy(ctx context.Context, p string, ref torus.BlockRef) torus.ReplicaCopy {
+	rc := torus.ReplicaCopy{Peer: p}
+	if p != d.UUID() && d.srv.PeerDown(p) {
+		rc.Err = torus.ErrNoPeer
+		return rc
+	}
+	c := d.readReplica(ctx, p, ref)
+	if c.err == nil {
+		rc.Has, rc.Checksum = true, c.sum
+		return rc
+	}
+	if p == d.UUID() {
+		if c.err != torus.ErrBlockUnavailable {
+			rc.Has, rc.Err = true, c.err
+		}
+		return rc
+	}
+	// Reads from other peers fail the same way whatever went wrong.
+	checkctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	has, err := d.client.Check(checkctx, p, []torus.BlockRef{ref})
+	cancel()
+	switch {
+	case err != nil:
+		rc.Err = err
+	case len(has) == 1 && has[0]:
+		rc.Has, rc.Err = true, fmt.Errorf("has the block, but couldn't read it: %v", c.err)
+	}
+	return rc
+}
@@ -11,6 +11,10 @@ type cache struct {
 	priority *list.List
 	maxSize  int
 	mut      sync.Mutex
+
+	// evicted, if set, is called with every entry pushed out to make room,
+	// without the cache's lock held.
+	evicted func(key string, value interface{})
 }
 
 type kv struct {
@@ -31,15 +35,21 @@ func (lru *cache) Put(key string, value interface{}) {
 		return
 	}
 	lru.mut.Lock()
-	defer lru.mut.Unlock()
 	if _, ok := lru.get(key); ok {
+		lru.mut.Unlock()
 		return
 	}
-	if len(lru.cache) == lru.maxSize {
-		lru.removeOldest()
+	var old kv
+	full := len(lru.cache) == lru.maxSize
+	if full {
+		old = lru.removeOldest()
 	}
 	lru.priority.PushFront(kv{key: key, value: value})
 	lru.cache[key] = lru.priority.Front()
+	lru.mut.Unlock()
+	if full && lru.evicted != nil {
+		lru.evicted(old.key, old.value)
+	}
 }
 
 func (lru *cache) Get(key string) (interface{}, bool) {
@@ -51,6 +61,27 @@ func (lru *cache) Get(key string) (interface{}, bool) {
 	return lru.get(key)
 }
 
+func (lru *cache) Remove(key string) {
+	if lru == nil {
+		return
+	}
+	lru.mut.Lock()
+	defer lru.mut.Unlock()
+	if element, ok := lru.cache[key]; ok {
+		lru.priority.Remove(element)
+		delete(lru.cache, key)
+	}
+}
+
+func (lru *cache) Len() int {
+	if lru == nil {
+		return 0
+	}
+	lru.mut.Lock()
+	defer lru.mut.Unlock()
+	return len(lru.cache)
+}
+
 func (lru *cache) get(key string) (interface{}, bool) {
 	if element, ok := lru.cache[key]; ok {
 		lru.priority.MoveToFront(element)
@@ -59,7 +90,8 @@ func (lru *cache) get(key string) (interface{}, bool) {
 	return nil, false
 }
 
-func (lru *cache) removeOldest() {
-	last := lru.priority.Remove(lru.priority.Back())
-	delete(lru.cache, last.(kv).key)
+func (lru *cache) removeOldest() kv {
+	last := lru.priority.Remove(lru.priority.Back()).(kv)
+	delete(lru.cache, last.key)
+	return last
 }
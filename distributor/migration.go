@@ -0,0 +1,217 @@
+package distributor
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+)
+
+// Volume migrations move a volume to another ring while it's in use. While
+// one runs, each of the volume's blocks is placed on the replicas of both
+// rings, so that new writes are mirrored to both placements, and the
+// rebalancer copies the blocks written before to their new replicas. Each
+// peer reports in once it has completed a clean pass; the last to do so
+// marks the migration done, which makes the new ring the only one the volume
+// is placed by, and the rebalancer then cleans up the copies only the old
+// ring wanted. A volume in a storage pool is placed by the pool's ring as it
+// is at the time, by way of the migration that put it there.
+//
+// A volume's migration is cached like its other settings, and so trusted for
+// up to policyTTL. A peer's pass only counts toward a migration if it began
+// this long after the migration did, by when every writer mirrors its writes.
+
+type migrationEntry struct {
+	m *torus.Migration
+	// from and to are m's rings, nil for the cluster's. A pool's is its
+	// ring as of when m was fetched.
+	from torus.Ring
+	to   torus.Ring
+}
+
+func (d *Distributor) newMigrationEntry(m *torus.Migration) (migrationEntry, error) {
+	e := migrationEntry{m: m}
+	if m == nil {
+		return e, nil
+	}
+	var err error
+	e.from, err = d.migrationRing(m.From, m.FromPool)
+	if err != nil {
+		return e, err
+	}
+	e.to, err = d.migrationRing(m.To, m.ToPool)
+	return e, err
+}
+
+// migrationRing returns the ring of one side of a migration: the named
+// pool's, if there is one, or the marshalled ring b, or nil for the
+// cluster's.
+func (d *Distributor) migrationRing(b []byte, pool string) (torus.Ring, error) {
+	if pool != "" {
+		pmds, ok := d.srv.MDS.(torus.PoolMetadataService)
+		if !ok {
+			return nil, torus.ErrNotSupported
+		}
+		return pmds.GetPool(pool)
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return ring.Unmarshal(b)
+}
+
+// members returns the peers that report on the migration: those of the
+// cluster's ring, and of the migration's own rings.
+func (e migrationEntry) members(cluster torus.PeerList) torus.PeerList {
+	out := cluster
+	for _, r := range []torus.Ring{e.from, e.to} {
+		if r != nil {
+			out = out.Union(r.Members())
+		}
+	}
+	return out
+}
+
+// migrationOf returns the latest migration of a volume. Volumes that never
+// had one are remembered with a nil migration.
+func (d *Distributor) migrationOf(vid torus.VolumeID) migrationEntry {
+	mmds, ok := d.srv.MDS.(torus.MigrationMetadataService)
+	if !ok {
+		return migrationEntry{}
+	}
+	e, _ := d.policies.get(vid, policyMigration, func(old interface{}) (interface{}, error) {
+		m, err := mmds.GetMigration(vid)
+		if err == torus.ErrNotExist {
+			err = nil
+		}
+		if err == nil {
+			var e migrationEntry
+			e, err = d.newMigrationEntry(m)
+			if err == nil {
+				return e, nil
+			}
+		}
+		clog.Errorf("couldn't get migration for volume %d: %v", vid, err)
+		e, _ := old.(migrationEntry)
+		return e, nil
+	})
+	return e.(migrationEntry)
+}
+
+// placeMigrated places key by the rings of its volume's migration: by both
+// while it runs, and by the one it ended on after. A nil ring is the
+// cluster's, r.
+func (d *Distributor) placeMigrated(get func(torus.Ring, torus.BlockRef) (torus.PeerPermutation, error), r torus.Ring, e migrationEntry, key torus.BlockRef) (torus.PeerPermutation, error) {
+	place := func(vr torus.Ring) (torus.PeerPermutation, error) {
+		if vr == nil {
+			return d.placeOnCluster(get, r, key)
+		}
+		// The cache is for the cluster's ring.
+		return d.placeOnRing(ringPeers, vr, key)
+	}
+	switch e.m.State {
+	case torus.MigrationDone:
+		return place(e.to)
+	case torus.MigrationAborted:
+		return place(e.from)
+	}
+	o, err := place(e.from)
+	if err != nil {
+		return o, err
+	}
+	n, err := place(e.to)
+	if err != nil {
+		return n, err
+	}
+	return unionPermutation(o, n), nil
+}
+
+// unionPermutation places a block on the replicas of both o and n. As in a
+// union ring, o's replicas come first, as they hold every block while the
+// new placement is still being filled.
+func unionPermutation(o, n torus.PeerPermutation) torus.PeerPermutation {
+	replicas := o.Replicas().Union(n.Replicas())
+	return torus.PeerPermutation{
+		Peers:       replicas.Union(o.Peers).Union(n.Peers),
+		Replication: len(replicas),
+	}
+}
+
+// refreshMigrations reloads the migration of every volume.
+func (d *Distributor) refreshMigrations(vols []*models.Volume) {
+	mmds, ok := d.srv.MDS.(torus.MigrationMetadataService)
+	if !ok {
+		return
+	}
+	migs := make(map[torus.VolumeID]interface{})
+	running := 0
+	for _, v := range vols {
+		m, err := mmds.GetMigration(torus.VolumeID(v.Id))
+		if err != nil && err != torus.ErrNotExist {
+			clog.Errorf("couldn't get migration for %s: %v", v.Name, err)
+			continue
+		}
+		e, err := d.newMigrationEntry(m)
+		if err != nil {
+			clog.Errorf("couldn't load the rings of %s's migration: %v", v.Name, err)
+			continue
+		}
+		if m != nil && m.State == torus.MigrationRunning {
+			running++
+		}
+		migs[torus.VolumeID(v.Id)] = e
+	}
+	d.policies.replace(policyMigration, migs)
+	promDistMigratingVolumes.Set(float64(running))
+}
+
+// reportMigrations records this peer's progress on every running migration
+// after a full rebalance pass that began at passStart, and finishes any
+// migration all its members are done with.
+func (d *Distributor) reportMigrations(passStart time.Time) {
+	mmds, ok := d.srv.MDS.(torus.MigrationMetadataService)
+	if !ok {
+		return
+	}
+	stats := d.rebalancer.VolumeStats()
+	cluster := d.Ring().Members()
+	uuid := d.UUID()
+	var running []migrationEntry
+	for _, v := range d.policies.values(policyMigration) {
+		if e := v.(migrationEntry); e.m != nil && e.m.State == torus.MigrationRunning {
+			running = append(running, e)
+		}
+	}
+	for _, e := range running {
+		m := e.m
+		members := e.members(cluster)
+		st := stats[m.VolumeID]
+		started := m.Started
+		settled := passStart.After(time.Unix(0, started).Add(policyTTL))
+		_, err := mmds.ModifyMigration(m.VolumeID, func(cur *torus.Migration) (*torus.Migration, error) {
+			if cur == nil || cur.State != torus.MigrationRunning || cur.Started != started {
+				// Aborted or restarted while we were working; our pass
+				// doesn't count for the new one.
+				return nil, torus.ErrAgain
+			}
+			if cur.Progress == nil {
+				cur.Progress = make(map[string]torus.MigrationProgress)
+			}
+			cur.Progress[uuid] = torus.MigrationProgress{
+				Blocks: st.Blocks,
+				Sent:   st.Sent,
+				Done:   settled && st.Failed == 0,
+			}
+			if cur.PeersDone(members) == len(members) {
+				cur.State = torus.MigrationDone
+				cur.Finished = time.Now().UnixNano()
+				clog.Infof("migration of %s to its new ring complete", cur.Volume)
+			}
+			return cur, nil
+		})
+		if err != nil && err != torus.ErrAgain {
+			clog.Errorf("couldn't report migration progress for %s: %v", m.Volume, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package distributor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/rebalance"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+)
+
+func TestVolumeMigration(t *testing.T) {
+	defer func(ttl time.Duration) { policyTTL = ttl }(policyTTL)
+	policyTTL = 0
+
+	md := temp.NewServer()
+	var ds []*Distributor
+	var peers torus.PeerInfoList
+	for i := 0; i < 3; i++ {
+		s := newServer(md)
+		ds = append(ds, &Distributor{
+			srv:        s,
+			rebalancer: rebalance.NewRebalancer(nil, nil, nil, nil),
+		})
+		peers = append(peers, &models.PeerInfo{UUID: s.MDS.UUID(), TotalBlocks: 100})
+	}
+	cluster, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Ketama),
+		Version:           2,
+		ReplicationFactor: 2,
+		Peers:             peers,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = md.SetRing(cluster); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range ds {
+		d.ring = cluster
+	}
+	mds := ds[0].srv.MDS
+	if err = mds.(*temp.Client).CreateVolume(&models.Volume{Name: "vol", Id: 5, Type: "block", MaxBytes: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	ref := torus.BlockRef{INodeRef: torus.NewINodeRef(5, 1), Index: 1}
+	before, err := ds[0].getPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := before.Replicas()
+
+	// Move the volume to a ring of the one peer that doesn't hold the block.
+	target := peers[0]
+	for _, p := range peers {
+		if !old.Has(p.UUID) {
+			target = p
+		}
+	}
+	to, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Single),
+		Version:           1,
+		ReplicationFactor: 1,
+		Peers:             torus.PeerInfoList{target},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = torus.StartMigration(mds, "vol", to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = torus.StartMigration(mds, "vol", nil); err != torus.ErrExists {
+		t.Fatalf("expected ErrExists starting a second migration, got %v", err)
+	}
+	perm, err := ds[0].getPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := old.Union(torus.PeerList{target.UUID})
+	if got := perm.Replicas(); len(got) != len(want) || len(got.AndNot(want)) != 0 || got[0] != old[0] || got[1] != old[1] {
+		t.Fatalf("expected the old replicas %v then the new one, got %v", old, got)
+	}
+
+	// The migration is done once every peer has finished a pass.
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmds := mds.(torus.MigrationMetadataService)
+	for i, d := range ds {
+		d.refreshMigrations(vols)
+		d.reportMigrations(time.Now())
+		m, err := mmds.GetMigration(5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done := i == len(ds)-1; (m.State == torus.MigrationDone) != done {
+			t.Fatalf("after %d peers reported, expected done %v, got state %s", i+1, done, m.State)
+		}
+	}
+	perm, err = ds[1].getPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := perm.Replicas(); len(got) != 1 || got[0] != target.UUID {
+		t.Fatalf("expected the block on %s alone, got %v", target.UUID, got)
+	}
+
+	// Aborting a migration back to the cluster's ring leaves it on the new
+	// ring.
+	if _, err = torus.AbortMigration(mds, "vol"); err != torus.ErrNotExist {
+		t.Fatalf("expected ErrNotExist aborting a finished migration, got %v", err)
+	}
+	if _, err = torus.StartMigration(mds, "vol", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = torus.AbortMigration(mds, "vol"); err != nil {
+		t.Fatal(err)
+	}
+	perm, err = ds[2].getPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := perm.Replicas(); len(got) != 1 || got[0] != target.UUID {
+		t.Fatalf("expected the block to stay on %s after aborting, got %v", target.UUID, got)
+	}
+}
+
+func TestStoragePool(t *testing.T) {
+	defer func(ttl time.Duration) { policyTTL = ttl }(policyTTL)
+	policyTTL = 0
+
+	md := temp.NewServer()
+	var ds []*Distributor
+	var peers torus.PeerInfoList
+	for i := 0; i < 4; i++ {
+		s := newServer(md)
+		ds = append(ds, &Distributor{
+			srv:        s,
+			rebalancer: rebalance.NewRebalancer(nil, nil, nil, nil),
+		})
+		peers = append(peers, &models.PeerInfo{UUID: s.MDS.UUID(), TotalBlocks: 100})
+	}
+	// The first two peers are the cluster's ring, and the others a pool.
+	cluster, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Ketama),
+		Version:           2,
+		ReplicationFactor: 2,
+		Peers:             peers[:2],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = md.SetRing(cluster); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range ds {
+		d.ring = cluster
+	}
+	pool, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Ketama),
+		Version:           1,
+		ReplicationFactor: 1,
+		Peers:             peers[2:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mds := ds[0].srv.MDS
+	pmds := mds.(torus.PoolMetadataService)
+	if err = pmds.CreatePool("ssd", pool); err != nil {
+		t.Fatal(err)
+	}
+	if err = pmds.CreatePool("ssd", pool); err != torus.ErrExists {
+		t.Fatalf("expected ErrExists creating the pool twice, got %v", err)
+	}
+	if err = mds.(*temp.Client).CreateVolume(&models.Volume{Name: "vol", Id: 5, Type: "block", MaxBytes: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	if err = torus.SetInitialPool(mds, "vol", "hdd"); err == nil {
+		t.Fatal("expected an error putting a volume in a pool that doesn't exist")
+	}
+	if err = torus.SetInitialPool(mds, "vol", "ssd"); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := torus.BlockRef{INodeRef: torus.NewINodeRef(5, 1), Index: 1}
+	perm, err := ds[0].getPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := perm.Replicas()
+	if len(got) != 1 || !pool.Members().Has(got[0]) {
+		t.Fatalf("expected the block on one of the pool's peers %v, got %v", pool.Members(), got)
+	}
+
+	// The volume follows changes to the pool's ring.
+	smaller, err := pool.(torus.RingRemover).RemovePeers(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pmds.SetPoolRing("ssd", pool); err != torus.ErrNonSequentialRing {
+		t.Fatalf("expected ErrNonSequentialRing setting the same ring version, got %v", err)
+	}
+	if err = pmds.SetPoolRing("ssd", smaller); err != nil {
+		t.Fatal(err)
+	}
+	perm, err = ds[1].getPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now := perm.Replicas(); len(now) != 1 || now[0] != smaller.Members()[0] {
+		t.Fatalf("expected the block on %s after shrinking the pool, got %v", smaller.Members()[0], now)
+	}
+
+	// A pool can't be deleted while a volume is in it or moving out of it.
+	if err = torus.DeletePool(mds, "ssd"); err == nil {
+		t.Fatal("expected an error deleting a pool that holds a volume")
+	}
+	m, err := torus.StartMigration(mds, "vol", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.FromPool != "ssd" || m.ToPool != "" {
+		t.Fatalf("expected a migration from pool ssd to the cluster's ring, got %q to %q", m.FromPool, m.ToPool)
+	}
+	if err = torus.DeletePool(mds, "ssd"); err == nil {
+		t.Fatal("expected an error deleting a pool a volume is moving out of")
+	}
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range ds {
+		d.refreshMigrations(vols)
+		d.reportMigrations(time.Now())
+	}
+	mmds := mds.(torus.MigrationMetadataService)
+	if m, err = mmds.GetMigration(5); err != nil {
+		t.Fatal(err)
+	} else if m.State != torus.MigrationDone {
+		t.Fatalf("expected the move out of the pool to be done, got %s", m.State)
+	}
+	if err = torus.DeletePool(mds, "ssd"); err != nil {
+		t.Fatal(err)
+	}
+	if err = torus.DeletePool(mds, "ssd"); err != torus.ErrNotExist {
+		t.Fatalf("expected ErrNotExist deleting the pool twice, got %v", err)
+	}
+}
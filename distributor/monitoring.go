@@ -12,6 +12,14 @@ var (
 		Name: "torus_distributor_block_cached_blocks",
 		Help: "Number of blocks returned from read cache of the distributor layer",
 	})
+	promDistBlockDiskCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_block_disk_cached_blocks",
+		Help: "Number of blocks returned from the part of the read cache on local disk",
+	})
+	promDistBlockDiskCacheErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_block_disk_cache_errors_total",
+		Help: "Number of blocks that couldn't be written to or read from the read cache on local disk",
+	})
 	promDistBlockLocalHits = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "torus_distributor_block_local_blocks",
 		Help: "Number of blocks returned from local storage",
@@ -24,6 +32,18 @@ var (
 		Name: "torus_distributor_block_peer_blocks",
 		Help: "Number of blocks returned from another peer in the cluster",
 	}, []string{"peer"})
+	promDistHedgedReads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_hedged_reads_total",
+		Help: "Number of hedged reads that asked another peer because the first was slow to answer",
+	})
+	promDistHedgedReadWins = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_hedged_read_wins_total",
+		Help: "Number of hedged reads answered first by a peer asked after the hedge delay",
+	})
+	promDistHedgeDelay = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_hedge_delay_seconds",
+		Help: "95th percentile latency of recent hedged reads from peers",
+	})
 	promDistBlockPeerFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "torus_distributor_block_peer_block_fails",
 		Help: "Number of failures incurred in retrieving a block from a peer",
@@ -32,6 +52,37 @@ var (
 		Name: "torus_distributor_block_request_failures",
 		Help: "Number of failed block requests",
 	})
+	promDistBlockPrefetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_block_prefetched_blocks_total",
+		Help: "Number of blocks fetched from other peers into the read cache ahead of being read",
+	})
+	// Peer cache
+	promDistPeerCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_peer_cache_hits_total",
+		Help: "Number of local blocks served from the peer cache",
+	})
+	promDistPeerCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_peer_cache_misses_total",
+		Help: "Number of local blocks read from storage into the peer cache",
+	})
+	promDistPeerCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_peer_cache_bytes",
+		Help: "Amount of memory used by blocks in the peer cache",
+	})
+	// Placement cache
+	promDistPermCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_placement_cache_hits_total",
+		Help: "Number of block placements served from the placement cache",
+	})
+	promDistPermCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_placement_cache_misses_total",
+		Help: "Number of block placements computed from the ring",
+	})
+	// Zones
+	promDistZoneBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_distributor_zone_bytes_total",
+		Help: "Bytes of blocks sent between peers, by the zones of the sender and receiver and the kind of traffic",
+	}, []string{"from_zone", "to_zone", "kind"})
 	// RPCs
 	promDistPutBlockRPCs = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "torus_distributor_put_block_rpcs_total",
@@ -41,6 +92,10 @@ var (
 		Name: "torus_distributor_put_block_rpc_failures",
 		Help: "Number of PutBlock RPCs with errors",
 	})
+	promDistACLDenied = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_acl_denied_rpcs_total",
+		Help: "Number of block RPCs refused because the volume's ACL didn't allow the caller",
+	})
 	promDistBlockRPCs = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "torus_distributor_block_rpcs_total",
 		Help: "Number of PutBlock RPCs made to this node",
@@ -49,6 +104,10 @@ var (
 		Name: "torus_distributor_block_rpc_failures",
 		Help: "Number of PutBlock RPCs with errors",
 	})
+	promDistBlockZeroCopy = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_block_zero_copy_total",
+		Help: "Number of blocks served to peers straight from storage, without a copy on the heap",
+	})
 	promDistRebalanceRPCs = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "torus_distributor_rebalance_rpcs_total",
 		Help: "Number of Rebalance RPCs made to this node",
@@ -57,22 +116,254 @@ var (
 		Name: "torus_distributor_rebalance_rpc_failures",
 		Help: "Number of Rebalance RPCs with errors",
 	})
+	promDistPeerQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "torus_distributor_peer_queue_wait_seconds",
+		Help:    "Time block requests waited for a turn to be sent to a peer, by I/O class",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"class"})
+	promDistWriteBatchBlocks = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "torus_distributor_write_batch_blocks",
+		Help:    "Number of blocks sent to a peer in each batched write",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+	})
+	// Latency of the block reads and writes this node makes, wherever the
+	// block lives.
+	promDistBlockLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "torus_distributor_block_latency_seconds",
+		Help:    "Latency of block reads and writes made through this node, by operation",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"op"})
+	promDistPeerBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_distributor_peer_bytes_total",
+		Help: "Bytes of blocks this node sent to and received from each peer",
+	}, []string{"peer", "direction"})
+	// Connection pool
+	promDistPeerConns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "torus_distributor_peer_conns",
+		Help: "Open connections to each peer",
+	}, []string{"peer"})
+	promDistPeerConnsInUse = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "torus_distributor_peer_conns_in_use",
+		Help: "Requests in flight on the connections to each peer",
+	}, []string{"peer"})
+	promDistPeerConnsSaturated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_distributor_peer_conns_saturated_total",
+		Help: "Requests that shared a busy connection to a peer because it had as many connections as allowed",
+	}, []string{"peer"})
+	promDistPeerConnDials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_distributor_peer_conn_dials_total",
+		Help: "Connections dialed to each peer",
+	}, []string{"peer"})
+	promDistPeerConnEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_distributor_peer_conn_evictions_total",
+		Help: "Connections to peers closed, by why: error, probe, idle or peer",
+	}, []string{"reason"})
+	// Ring and rebalance
+	promDistRingVersion = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_ring_version",
+		Help: "Version of the ring this node is using",
+	})
+	promDistRingAcks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_ring_acks_total",
+		Help: "Number of proposed rings this peer has acknowledged",
+	})
+	promDistShutdownHandoffs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_shutdown_handoff_blocks_total",
+		Help: "Number of blocks no other replica had that this node handed off to other peers as it shut down",
+	})
+	promDistDrainingPeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_draining_peers",
+		Help: "Number of peers being drained, that blocks are placed away from",
+	})
+	promDistMigratingVolumes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_migrating_volumes",
+		Help: "Number of volumes moving to another ring, whose blocks are placed by both",
+	})
+	promDistWeightAdjustments = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_weight_adjustments_total",
+		Help: "Number of ring changes this peer has made to adjust the weights of peers past the fill threshold",
+	})
+	promDistRebalancing = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_rebalancing",
+		Help: "1 while this node hasn't finished rebalancing to the current ring",
+	})
+	promDistRebalancePassBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_rebalance_pass_sent_blocks",
+		Help: "Blocks sent to other peers so far in the current rebalance pass",
+	})
+	// Rebalance throttle
+	promDistForegroundLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "torus_distributor_foreground_latency_seconds",
+		Help:    "Latency of the block reads and writes this node serves, as seen by the rebalance throttle",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+	promDistRebalanceThrottle = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_rebalance_throttle",
+		Help: "How many times slower than its rate this node is rebalancing, to protect foreground latency",
+	})
+	// Repair
+	promDistEmergencies = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_emergencies_total",
+		Help: "Number of times this node found blocks down to a single live replica",
+	})
+	promDistEmergencyActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_emergency_active",
+		Help: "Whether this node currently holds blocks with a single live replica",
+	})
+	promDistCriticalBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_critical_blocks",
+		Help: "Number of blocks found with a single live replica in the current emergency",
+	})
+	// Recovery
+	promDistFailedPeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_distributor_failed_peers",
+		Help: "Number of ring members down for longer than the failure timeout, whose blocks this node re-replicates",
+	})
+	promDistRecoveredBlocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_recovered_blocks_total",
+		Help: "Blocks this node copied to stand in for replicas on failed peers",
+	})
+	// Read repair
+	promDistReadRepairChecks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_read_repair_checks_total",
+		Help: "Number of reads that compared every replica of a block",
+	})
+	promDistReadRepairFixes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_read_repair_fixes_total",
+		Help: "Number of replicas rewritten because they were missing or differed from the others",
+	})
+	// Load
+	promDistLoadRedirectedReads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_load_redirected_reads_total",
+		Help: "Number of reads sent to a replica other than the first because it reported less load",
+	})
+	// Quorum
+	promDistQuorumFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_distributor_quorum_failures_total",
+		Help: "Number of quorum reads and writes that fewer than a majority of replicas agreed on",
+	}, []string{"op"})
+	// Handoff
+	promDistHintsStored = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_hints_stored_total",
+		Help: "Number of blocks stored on behalf of an unreachable peer",
+	})
+	promDistHintsHandedOff = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_hints_handed_off_total",
+		Help: "Number of hinted blocks handed off to their owner",
+	})
+	// Scrub
+	promDistScrubbedBlocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_scrubbed_blocks_total",
+		Help: "Number of local blocks verified against their checksum",
+	})
+	promDistScrubCorrupt = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_scrub_corrupt_blocks_total",
+		Help: "Number of local blocks found corrupt by the scrubber",
+	})
+	promDistScrubRepaired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_scrub_repaired_blocks_total",
+		Help: "Number of corrupt local blocks replaced with a copy from another replica",
+	})
+	promDistReadCorrupt = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_read_corrupt_blocks_total",
+		Help: "Number of reads of local blocks that found them corrupt",
+	})
+	// QoS
+	promDistQoSThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_qos_throttled_requests_total",
+		Help: "Number of block requests held back to keep their volume within its QoS limits",
+	})
+	promDistQoSDelay = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_qos_delay_seconds_total",
+		Help: "Total time block requests were held back by QoS limits",
+	})
+	// Discards
+	promDistDiscardedBlocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_distributor_discarded_blocks_total",
+		Help: "Number of local blocks deleted because a volume discarded them",
+	})
 )
 
 func init() {
 	// Block
 	prometheus.MustRegister(promDistBlockRequests)
 	prometheus.MustRegister(promDistBlockCacheHits)
+	prometheus.MustRegister(promDistBlockDiskCacheHits)
+	prometheus.MustRegister(promDistBlockDiskCacheErrors)
 	prometheus.MustRegister(promDistBlockLocalHits)
 	prometheus.MustRegister(promDistBlockLocalFailures)
 	prometheus.MustRegister(promDistBlockPeerHits)
 	prometheus.MustRegister(promDistBlockPeerFailures)
+	prometheus.MustRegister(promDistHedgedReads)
+	prometheus.MustRegister(promDistHedgedReadWins)
+	prometheus.MustRegister(promDistHedgeDelay)
 	prometheus.MustRegister(promDistBlockFailures)
+	prometheus.MustRegister(promDistBlockPrefetched)
+	// Peer cache
+	prometheus.MustRegister(promDistPeerCacheHits)
+	prometheus.MustRegister(promDistPeerCacheMisses)
+	prometheus.MustRegister(promDistPeerCacheBytes)
+	// Placement cache
+	prometheus.MustRegister(promDistPermCacheHits)
+	prometheus.MustRegister(promDistPermCacheMisses)
+	// Zones
+	prometheus.MustRegister(promDistZoneBytes)
 	// RPC
 	prometheus.MustRegister(promDistPutBlockRPCs)
 	prometheus.MustRegister(promDistPutBlockRPCFailures)
+	prometheus.MustRegister(promDistACLDenied)
 	prometheus.MustRegister(promDistBlockRPCs)
 	prometheus.MustRegister(promDistBlockRPCFailures)
+	prometheus.MustRegister(promDistBlockZeroCopy)
 	prometheus.MustRegister(promDistRebalanceRPCs)
 	prometheus.MustRegister(promDistRebalanceRPCFailures)
+	prometheus.MustRegister(promDistPeerQueueWait)
+	prometheus.MustRegister(promDistWriteBatchBlocks)
+	// Rebalance throttle
+	prometheus.MustRegister(promDistForegroundLatency)
+	prometheus.MustRegister(promDistBlockLatency)
+	prometheus.MustRegister(promDistPeerBytes)
+	// Connection pool
+	prometheus.MustRegister(promDistPeerConns)
+	prometheus.MustRegister(promDistPeerConnsInUse)
+	prometheus.MustRegister(promDistPeerConnsSaturated)
+	prometheus.MustRegister(promDistPeerConnDials)
+	prometheus.MustRegister(promDistPeerConnEvictions)
+	// Ring and rebalance
+	prometheus.MustRegister(promDistRingVersion)
+	prometheus.MustRegister(promDistRingAcks)
+	prometheus.MustRegister(promDistWeightAdjustments)
+	prometheus.MustRegister(promDistDrainingPeers)
+	prometheus.MustRegister(promDistMigratingVolumes)
+	prometheus.MustRegister(promDistShutdownHandoffs)
+	prometheus.MustRegister(promDistRebalancing)
+	prometheus.MustRegister(promDistRebalancePassBlocks)
+	prometheus.MustRegister(promDistRebalanceThrottle)
+	// Repair
+	prometheus.MustRegister(promDistEmergencies)
+	prometheus.MustRegister(promDistEmergencyActive)
+	prometheus.MustRegister(promDistCriticalBlocks)
+	// Recovery
+	prometheus.MustRegister(promDistFailedPeers)
+	prometheus.MustRegister(promDistRecoveredBlocks)
+	// Read repair
+	prometheus.MustRegister(promDistReadRepairChecks)
+	prometheus.MustRegister(promDistReadRepairFixes)
+	// Load
+	prometheus.MustRegister(promDistLoadRedirectedReads)
+	// Quorum
+	prometheus.MustRegister(promDistQuorumFailures)
+	// Handoff
+	prometheus.MustRegister(promDistHintsStored)
+	prometheus.MustRegister(promDistHintsHandedOff)
+	// Scrub
+	prometheus.MustRegister(promDistScrubbedBlocks)
+	prometheus.MustRegister(promDistScrubCorrupt)
+	prometheus.MustRegister(promDistScrubRepaired)
+	prometheus.MustRegister(promDistReadCorrupt)
+	// QoS
+	prometheus.MustRegister(promDistQoSThrottled)
+	prometheus.MustRegister(promDistQoSDelay)
+	// Discards
+	prometheus.MustRegister(promDistDiscardedBlocks)
 }
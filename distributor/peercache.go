@@ -0,0 +1,56 @@
+package distributor
+
+import (
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// localBlock reads a block from this peer's own storage through the peer
+// cache. Unlike the read cache, which belongs to a single client, the peer
+// cache is shared by every attachment and peer that reads from here, so hot
+// blocks -- such as those of an image that many VMs boot from clones of --
+// are served from memory instead of disk.
+func (d *Distributor) localBlock(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	if d.peerCache == nil {
+		data, err := d.blocks.GetBlock(ctx, ref)
+		if err == torus.ErrBlockCorrupt {
+			d.readCorrupt(ref)
+		}
+		return data, err
+	}
+	key := string(ref.ToBytes())
+	if data, ok := d.peerCache.Get(key); ok {
+		promDistPeerCacheHits.Inc()
+		return data.([]byte), nil
+	}
+	data, err := d.blocks.GetBlock(ctx, ref)
+	if err != nil {
+		if err == torus.ErrBlockCorrupt {
+			d.readCorrupt(ref)
+		}
+		return nil, err
+	}
+	promDistPeerCacheMisses.Inc()
+	// Storage may hand back memory that's reused once the block is deleted,
+	// so keep a copy.
+	cp := make([]byte, len(data))
+	copy(cp, data)
+	d.peerCache.Put(key, cp)
+	d.updatePeerCacheBytes()
+	return cp, nil
+}
+
+// forgetLocalBlock drops a block from the peer cache before its local copy is
+// replaced or deleted.
+func (d *Distributor) forgetLocalBlock(ref torus.BlockRef) {
+	if d.peerCache == nil {
+		return
+	}
+	d.peerCache.Remove(string(ref.ToBytes()))
+	d.updatePeerCacheBytes()
+}
+
+func (d *Distributor) updatePeerCacheBytes() {
+	n := uint64(d.peerCache.Len())
+	promDistPeerCacheBytes.Set(float64(n * d.srv.MDS.GlobalMetadata().BlockSize))
+}
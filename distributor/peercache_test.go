@@ -0,0 +1,65 @@
+package distributor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"golang.org/x/net/context"
+)
+
+func TestPeerCache(t *testing.T) {
+	srv := newServer(temp.NewServer())
+	defer srv.Close()
+	d := &Distributor{
+		blocks:    srv.Blocks,
+		srv:       srv,
+		peerCache: newCache(4),
+	}
+	ctx := context.TODO()
+	ref := torus.BlockRef{
+		INodeRef: torus.NewINodeRef(1, 1),
+		Index:    1,
+	}
+	size := srv.Blocks.BlockSize()
+	old := bytes.Repeat([]byte{1}, int(size))
+	err := d.blocks.WriteBlock(ctx, ref, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.localBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, old) {
+		t.Fatal("read back the wrong block")
+	}
+
+	// Replacing the block underneath the cache must not change what's
+	// cached, and forgetting it must.
+	repaired := bytes.Repeat([]byte{2}, int(size))
+	err = d.blocks.DeleteBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.blocks.WriteBlock(ctx, ref, repaired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = d.localBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, old) {
+		t.Error("expected the cached copy of the block")
+	}
+	d.forgetLocalBlock(ref)
+	data, err = d.localBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, repaired) {
+		t.Error("expected the repaired block after forgetting it")
+	}
+}
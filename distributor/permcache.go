@@ -0,0 +1,53 @@
+package distributor
+
+import (
+	"sync"
+
+	"github.com/coreos/torus"
+)
+
+// permCacheSize is the number of block placements kept per ring version.
+const permCacheSize = 16 * 1024
+
+// permCache remembers where the current ring places blocks. Placement walks
+// the ring, which on large clusters costs far more than the lookup it's used
+// for, and the same blocks are placed again and again by reads, writes and
+// every rebalance pass.
+//
+// Placements are hashed from the whole BlockRef, index included, so entries
+// are per block; a block's INodeRef forms the start of its key. A newer ring
+// empties the cache, and older ones, such as the one a rebalance pass that
+// started before a ring change is still using, bypass it.
+type permCache struct {
+	mut     sync.Mutex
+	version int
+	lru     *cache
+}
+
+// getPeers returns r's placement of key. The permutation's peer list is
+// shared, and must not be modified.
+func (c *permCache) getPeers(r torus.Ring, key torus.BlockRef) (torus.PeerPermutation, error) {
+	k := string(key.ToBytes())
+	c.mut.Lock()
+	if c.lru == nil || r.Version() > c.version {
+		c.version = r.Version()
+		c.lru = newCache(permCacheSize)
+	}
+	lru := c.lru
+	current := r.Version() == c.version
+	c.mut.Unlock()
+	if !current {
+		return r.GetPeers(key)
+	}
+	if perm, ok := lru.Get(k); ok {
+		promDistPermCacheHits.Inc()
+		return perm.(torus.PeerPermutation), nil
+	}
+	promDistPermCacheMisses.Inc()
+	perm, err := r.GetPeers(key)
+	if err != nil {
+		return perm, err
+	}
+	lru.Put(k, perm)
+	return perm, nil
+}
@@ -0,0 +1,54 @@
+package distributor
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+type countingRing struct {
+	torus.Ring
+	version int
+	calls   int
+}
+
+func (r *countingRing) Version() int { return r.version }
+
+func (r *countingRing) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
+	r.calls++
+	return torus.PeerPermutation{
+		Peers:       torus.PeerList{"a", "b"},
+		Replication: 1,
+	}, nil
+}
+
+func TestPermCache(t *testing.T) {
+	var c permCache
+	ref := torus.BlockRef{
+		INodeRef: torus.NewINodeRef(1, 1),
+		Index:    1,
+	}
+	r1 := &countingRing{version: 1}
+	for i := 0; i < 3; i++ {
+		_, err := c.getPeers(r1, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r1.calls != 1 {
+		t.Fatalf("expected the ring to be asked once, got %d", r1.calls)
+	}
+	r2 := &countingRing{version: 2}
+	c.getPeers(r2, ref)
+	c.getPeers(r2, ref)
+	if r2.calls != 1 {
+		t.Fatalf("expected a new ring to be asked once, got %d", r2.calls)
+	}
+	// The old ring mustn't be served from, or evict, the new ring's
+	// placements.
+	c.getPeers(r1, ref)
+	c.getPeers(r2, ref)
+	if r1.calls != 2 || r2.calls != 1 {
+		t.Fatalf("expected old ring to bypass the cache, got %d and %d calls", r1.calls, r2.calls)
+	}
+}
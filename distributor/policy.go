@@ -0,0 +1,153 @@
+package distributor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// How long we trust a volume's settings before asking the MDS again, unless
+// it tells us they've changed first. Where it can't, a change takes this long
+// to be seen.
+var policyTTL = 30 * time.Second
+
+// policyKind is one of the settings of a volume the distributor caches.
+type policyKind int
+
+const (
+	policyACL policyKind = iota
+	policyCompression
+	policyConsistency
+	policyKeyring
+	policyMigration
+	policyQoS
+	policyReadRepair
+	policyTiering
+	policyKinds
+)
+
+type policyKey struct {
+	vid  torus.VolumeID
+	kind policyKind
+}
+
+type policyEntry struct {
+	val     interface{}
+	fetched time.Time
+}
+
+// policyCache holds the settings of volumes that the distributor looks up on
+// the block path. A volume's are dropped as soon as the MDS says they've
+// changed, and are otherwise looked up again after policyTTL.
+type policyCache struct {
+	mut sync.Mutex
+	// gen counts the changes seen, so that a lookup that raced one doesn't
+	// cache what it read before it.
+	gen     uint64
+	entries map[policyKey]policyEntry
+}
+
+// get returns a volume's setting of the given kind, calling fetch to look it
+// up if it isn't cached or has gone stale. fetch is passed the value cached
+// before, or nil, to fall back on. If it fails, nothing is cached, so the
+// next call tries again, and its error is returned.
+func (c *policyCache) get(vid torus.VolumeID, kind policyKind, fetch func(old interface{}) (interface{}, error)) (interface{}, error) {
+	k := policyKey{vid, kind}
+	c.mut.Lock()
+	e, ok := c.entries[k]
+	gen := c.gen
+	c.mut.Unlock()
+	if ok && time.Since(e.fetched) < policyTTL {
+		return e.val, nil
+	}
+	val, err := fetch(e.val)
+	if err != nil {
+		return val, err
+	}
+	c.mut.Lock()
+	if c.gen == gen {
+		c.put(k, val)
+	}
+	c.mut.Unlock()
+	return val, nil
+}
+
+// put caches val. c.mut must be held.
+func (c *policyCache) put(k policyKey, val interface{}) {
+	if c.entries == nil {
+		c.entries = make(map[policyKey]policyEntry)
+	}
+	c.entries[k] = policyEntry{val: val, fetched: time.Now()}
+}
+
+// replace caches vals as the settings of the given kind of every volume,
+// dropping those of other volumes.
+func (c *policyCache) replace(kind policyKind, vals map[torus.VolumeID]interface{}) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for k := range c.entries {
+		if k.kind == kind {
+			delete(c.entries, k)
+		}
+	}
+	for vid, val := range vals {
+		c.put(policyKey{vid, kind}, val)
+	}
+}
+
+// values returns the cached settings of the given kind.
+func (c *policyCache) values(kind policyKind) []interface{} {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	var out []interface{}
+	for k, e := range c.entries {
+		if k.kind == kind {
+			out = append(out, e.val)
+		}
+	}
+	return out
+}
+
+// invalidate drops the cached settings of a volume.
+func (c *policyCache) invalidate(vid torus.VolumeID) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.gen++
+	for kind := policyKind(0); kind < policyKinds; kind++ {
+		delete(c.entries, policyKey{vid, kind})
+	}
+}
+
+// watchPolicies drops the cached settings of volumes as soon as the MDS says
+// they've changed, until closer is closed, if it can.
+func (d *Distributor) watchPolicies(closer chan struct{}) {
+	vmds, ok := d.srv.MDS.(torus.VolumeWatchMetadataService)
+	if !ok {
+		return
+	}
+	ch := make(chan torus.VolumeID)
+	if err := vmds.SubscribeVolumeChanges(ch); err != nil {
+		if err != torus.ErrNotSupported {
+			clog.Warningf("couldn't watch volume settings; changes take up to %s to be seen: %v", policyTTL, err)
+		}
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-closer:
+				// The MDS may be sending a change as we go.
+				go func() {
+					for range ch {
+					}
+				}()
+				vmds.UnsubscribeVolumeChanges(ch)
+				close(ch)
+				return
+			case vid := <-ch:
+				d.policies.invalidate(vid)
+			}
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+package distributor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+)
+
+func TestPolicyCacheWatch(t *testing.T) {
+	srv := newServer(temp.NewServer())
+	defer srv.Close()
+	d := &Distributor{srv: srv}
+	closer := make(chan struct{})
+	d.watchPolicies(closer)
+	defer close(closer)
+
+	if p := d.readRepairPolicy(1); p != torus.ReadRepairOff {
+		t.Fatalf("expected read repair to be off, got %v", p)
+	}
+	err := srv.MDS.(torus.ReadRepairMetadataService).SetReadRepair(1, torus.ReadRepairAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Well within policyTTL, so only the watch can have told us.
+	deadline := time.Now().Add(5 * time.Second)
+	for d.readRepairPolicy(1) != torus.ReadRepairAlways {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the changed policy to be seen at once")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPolicyCacheRace(t *testing.T) {
+	var c policyCache
+	fetches := 0
+	get := func(changed bool) interface{} {
+		v, err := c.get(1, policyReadRepair, func(interface{}) (interface{}, error) {
+			fetches++
+			if changed {
+				// The setting changes while it's being looked up.
+				c.invalidate(1)
+				return torus.ReadRepairOff, nil
+			}
+			return torus.ReadRepairAlways, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	get(true)
+	if v := get(false); v != torus.ReadRepairAlways || fetches != 2 {
+		t.Fatalf("expected a lookup that raced a change to be looked up again, got %v after %d lookups", v, fetches)
+	}
+	if v := get(false); v != torus.ReadRepairAlways || fetches != 2 {
+		t.Fatalf("expected the setting to be cached, got %v after %d lookups", v, fetches)
+	}
+}
@@ -0,0 +1,277 @@
+package distributor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/protocols"
+	"golang.org/x/net/context"
+)
+
+const (
+	// poolTick is how often the pool looks for connections to evict or
+	// probe.
+	poolTick = 10 * time.Second
+	// probeInterval is how long a connection may sit idle before the pool
+	// checks it still works.
+	probeInterval = 30 * time.Second
+)
+
+// dialFunc opens a new connection to a peer.
+type dialFunc func(uuid string) (protocols.RPC, error)
+
+// connPool keeps open connections to each peer for requests to share. A
+// request takes the connection with the fewest requests on it, and a new
+// connection is dialed when they all have some, up to max per peer; past
+// that, requests share the busy ones. Connections that break are closed and
+// dropped, as are those left idle for longer than idle, and idle ones are
+// probed now and then so that a dead one isn't found by the next request.
+type connPool struct {
+	dial dialFunc
+	max  int
+	idle time.Duration
+
+	mut    sync.Mutex
+	peers  map[string]*peerConns
+	closed bool
+	close  chan struct{}
+}
+
+type peerConns struct {
+	conns   []*pooledConn
+	dialing int
+}
+
+type pooledConn struct {
+	rpc      protocols.RPC
+	inUse    int
+	lastUsed time.Time
+	probed   time.Time
+	dropped  bool
+}
+
+func newConnPool(dial dialFunc, max int, idle time.Duration) *connPool {
+	if max < 1 {
+		max = 1
+	}
+	p := &connPool{
+		dial:  dial,
+		max:   max,
+		idle:  idle,
+		peers: make(map[string]*peerConns),
+		close: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// get returns a connection to the peer, and the function to hand it back
+// with once the request on it is done. Handing it back with an error drops
+// the connection. get returns a nil connection if the peer can't be
+// dialed.
+func (p *connPool) get(uuid string) (protocols.RPC, func(error)) {
+	p.mut.Lock()
+	pc := p.peers[uuid]
+	if pc == nil {
+		pc = &peerConns{}
+		p.peers[uuid] = pc
+	}
+	var best *pooledConn
+	for _, c := range pc.conns {
+		if best == nil || c.inUse < best.inUse {
+			best = c
+		}
+	}
+	if best != nil && (best.inUse == 0 || len(pc.conns)+pc.dialing >= p.max) {
+		if best.inUse != 0 {
+			promDistPeerConnsSaturated.WithLabelValues(uuid).Inc()
+		}
+		defer p.mut.Unlock()
+		return best.rpc, p.take(uuid, pc, best)
+	}
+	pc.dialing++
+	p.mut.Unlock()
+
+	rpc, err := p.dial(uuid)
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pc.dialing--
+	if err == nil && p.closed {
+		rpc.Close()
+		err = torus.ErrClosed
+	}
+	if err != nil {
+		if best != nil && !best.dropped {
+			// Make do with the busy one.
+			return best.rpc, p.take(uuid, pc, best)
+		}
+		p.forget(uuid, pc)
+		return nil, func(error) {}
+	}
+	promDistPeerConnDials.WithLabelValues(uuid).Inc()
+	c := &pooledConn{rpc: rpc, lastUsed: time.Now()}
+	pc.conns = append(pc.conns, c)
+	return rpc, p.take(uuid, pc, c)
+}
+
+// take puts a request on a connection, and returns the function that hands
+// it back. p.mut must be held.
+func (p *connPool) take(uuid string, pc *peerConns, c *pooledConn) func(error) {
+	c.inUse++
+	p.updateMetrics(uuid, pc)
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { p.release(uuid, c, err, "error", true) })
+	}
+}
+
+// release hands back a connection, dropping it if err isn't nil.
+func (p *connPool) release(uuid string, c *pooledConn, err error, reason string, used bool) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	c.inUse--
+	if used {
+		c.lastUsed = time.Now()
+	}
+	if err != nil && !c.dropped {
+		p.drop(uuid, c, reason)
+	}
+	if pc := p.peers[uuid]; pc != nil {
+		p.updateMetrics(uuid, pc)
+	}
+}
+
+// drop closes a connection and takes it out of the pool. p.mut must be
+// held.
+func (p *connPool) drop(uuid string, c *pooledConn, reason string) {
+	c.dropped = true
+	err := c.rpc.Close()
+	if err != nil {
+		clog.Errorf("error closing connection to %s: %v", uuid, err)
+	}
+	promDistPeerConnEvictions.WithLabelValues(reason).Inc()
+	pc := p.peers[uuid]
+	if pc == nil {
+		return
+	}
+	for i, x := range pc.conns {
+		if x == c {
+			pc.conns = append(pc.conns[:i], pc.conns[i+1:]...)
+			break
+		}
+	}
+	p.forget(uuid, pc)
+}
+
+// forget removes a peer with no connections left from the pool. p.mut must
+// be held.
+func (p *connPool) forget(uuid string, pc *peerConns) {
+	if len(pc.conns) != 0 || pc.dialing != 0 {
+		return
+	}
+	if p.peers[uuid] == pc {
+		delete(p.peers, uuid)
+	}
+	promDistPeerConns.DeleteLabelValues(uuid)
+	promDistPeerConnsInUse.DeleteLabelValues(uuid)
+}
+
+// closePeer drops every connection to a peer.
+func (p *connPool) closePeer(uuid string) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pc := p.peers[uuid]
+	if pc == nil {
+		return
+	}
+	for len(pc.conns) != 0 {
+		p.drop(uuid, pc.conns[0], "peer")
+	}
+}
+
+func (p *connPool) updateMetrics(uuid string, pc *peerConns) {
+	inUse := 0
+	for _, c := range pc.conns {
+		inUse += c.inUse
+	}
+	promDistPeerConns.WithLabelValues(uuid).Set(float64(len(pc.conns)))
+	promDistPeerConnsInUse.WithLabelValues(uuid).Set(float64(inUse))
+}
+
+func (p *connPool) run() {
+	t := time.NewTicker(poolTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.close:
+			return
+		case <-t.C:
+			p.evictIdle(time.Now())
+			p.probe(time.Now())
+		}
+	}
+}
+
+// evictIdle drops connections that have had nothing on them for longer
+// than the idle timeout.
+func (p *connPool) evictIdle(now time.Time) {
+	if p.idle == 0 {
+		return
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for uuid, pc := range p.peers {
+		for _, c := range append([]*pooledConn(nil), pc.conns...) {
+			if c.inUse == 0 && now.Sub(c.lastUsed) > p.idle {
+				p.drop(uuid, c, "idle")
+			}
+		}
+	}
+}
+
+// probe checks that connections idle for longer than probeInterval still
+// work, and drops those that don't.
+func (p *connPool) probe(now time.Time) {
+	type probe struct {
+		uuid string
+		c    *pooledConn
+	}
+	var probes []probe
+	p.mut.Lock()
+	for uuid, pc := range p.peers {
+		for _, c := range pc.conns {
+			if c.inUse == 0 && now.Sub(c.lastUsed) > probeInterval && now.Sub(c.probed) > probeInterval {
+				c.inUse++
+				c.probed = now
+				probes = append(probes, probe{uuid, c})
+			}
+		}
+	}
+	p.mut.Unlock()
+	for _, pr := range probes {
+		ctx, cancel := context.WithTimeout(torus.WithIOClass(context.TODO(), torus.IOClassBatch), connectTimeout)
+		// Any answer will do; no peer has the zero block.
+		_, err := pr.c.rpc.RebalanceCheck(ctx, []torus.BlockRef{{}})
+		cancel()
+		if err != nil {
+			clog.Debugf("connection to %s failed its probe: %v", pr.uuid, err)
+		}
+		// A probe doesn't keep a connection from going idle.
+		p.release(pr.uuid, pr.c, err, "probe", false)
+	}
+}
+
+// Close drops every connection and stops the pool.
+func (p *connPool) Close() error {
+	close(p.close)
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.closed = true
+	for uuid, pc := range p.peers {
+		for len(pc.conns) != 0 {
+			p.drop(uuid, pc.conns[0], "peer")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package distributor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/protocols"
+	"golang.org/x/net/context"
+)
+
+var errDead = errors.New("dead connection")
+
+type fakeConn struct {
+	dead   bool
+	closed bool
+}
+
+func (c *fakeConn) PutBlock(ctx context.Context, ref torus.BlockRef, data []byte) error {
+	return nil
+}
+
+func (c *fakeConn) Block(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *fakeConn) RebalanceCheck(ctx context.Context, refs []torus.BlockRef) ([]bool, error) {
+	if c.dead {
+		return nil, errDead
+	}
+	return make([]bool, len(refs)), nil
+}
+
+func (c *fakeConn) WriteBuf(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	return nil, torus.ErrNotSupported
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestConnPool(t *testing.T) {
+	var dialed []*fakeConn
+	dial := func(uuid string) (protocols.RPC, error) {
+		if uuid == "down" {
+			return nil, torus.ErrNoPeer
+		}
+		c := &fakeConn{}
+		dialed = append(dialed, c)
+		return c, nil
+	}
+	p := newConnPool(dial, 2, time.Minute)
+	defer p.Close()
+
+	// An idle connection is reused; busy ones get company up to the limit,
+	// then are shared.
+	a, doneA := p.get("peer")
+	doneA(nil)
+	b, doneB := p.get("peer")
+	if a != b || len(dialed) != 1 {
+		t.Fatal("expected the idle connection to be reused")
+	}
+	c, doneC := p.get("peer")
+	if c == b || len(dialed) != 2 {
+		t.Fatal("expected a second connection while the first is busy")
+	}
+	_, doneD := p.get("peer")
+	if len(dialed) != 2 {
+		t.Fatalf("dialed %d connections, past the limit of 2", len(dialed))
+	}
+	if conn, _ := p.get("down"); conn != nil {
+		t.Fatal("expected no connection to a peer that can't be dialed")
+	}
+
+	// A connection handed back with an error is closed and dropped.
+	doneB(errDead)
+	doneB(nil)
+	if !dialed[0].closed {
+		t.Fatal("expected the broken connection to be closed")
+	}
+	doneC(nil)
+	doneD(nil)
+	e, doneE := p.get("peer")
+	doneE(nil)
+	if e == a || len(p.peers["peer"].conns) != 1 {
+		t.Fatal("expected the broken connection to be out of the pool")
+	}
+	if e != c {
+		t.Fatal("expected the remaining connection to be reused")
+	}
+
+	// Idle connections that fail a probe are dropped, as are those idle
+	// for too long.
+	f, doneF := p.get("peer")
+	g, doneG := p.get("peer")
+	doneF(nil)
+	doneG(nil)
+	f.(*fakeConn).dead = true
+	p.probe(time.Now().Add(probeInterval + time.Second))
+	if !f.(*fakeConn).closed || g.(*fakeConn).closed {
+		t.Fatal("expected only the connection that failed its probe to be closed")
+	}
+	p.evictIdle(time.Now().Add(2 * time.Minute))
+	if !g.(*fakeConn).closed || len(p.peers) != 0 {
+		t.Fatal("expected the idle connection to be closed")
+	}
+}
@@ -0,0 +1,84 @@
+package distributor
+
+import (
+	"sync"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/ring"
+	"golang.org/x/net/context"
+)
+
+// prefetchBatchBytes bounds the size of a single batch read from a peer, so
+// that responses stay well under the RPC message size limit.
+const prefetchBatchBytes = 2 * 1024 * 1024
+
+// PrefetchBlocks reads refs into the read cache. The blocks are grouped by the
+// peer first in line for them, and each peer's share is fetched in batches,
+// with all peers and batches in flight at once. Blocks this peer holds itself
+// are read as usual, and blocks that can't be fetched are left for a normal
+// read to retry from other replicas.
+func (d *Distributor) PrefetchBlocks(ctx context.Context, refs []torus.BlockRef) error {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	if d.readCache == nil {
+		return nil
+	}
+	byPeer := make(map[string][]torus.BlockRef)
+	for _, ref := range refs {
+		if _, ok := d.readCache.Get(ref); ok {
+			continue
+		}
+		peers, err := d.getPeers(ref)
+		if err != nil {
+			return err
+		}
+		if len(peers.Peers) == 0 {
+			continue
+		}
+		peers = ring.SkipDown(peers, d.srv.PeerDown)
+		replicas := d.preferLocalZone(peers).Replicas()
+		if len(replicas) == 0 || replicas.Has(d.UUID()) {
+			continue
+		}
+		byPeer[replicas[0]] = append(byPeer[replicas[0]], ref)
+	}
+	batch := int(prefetchBatchBytes / d.srv.MDS.GlobalMetadata().BlockSize)
+	if batch == 0 {
+		batch = 1
+	}
+	var wg sync.WaitGroup
+	for peer, refs := range byPeer {
+		for len(refs) != 0 {
+			n := batch
+			if n > len(refs) {
+				n = len(refs)
+			}
+			wg.Add(1)
+			go func(peer string, refs []torus.BlockRef) {
+				defer wg.Done()
+				d.prefetchFromPeer(ctx, peer, refs)
+			}(peer, refs[:n])
+			refs = refs[n:]
+		}
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (d *Distributor) prefetchFromPeer(ctx context.Context, peer string, refs []torus.BlockRef) {
+	getctx, cancel := context.WithTimeout(ctx, rebalanceClientTimeout)
+	defer cancel()
+	blks, err := d.client.GetBlocks(getctx, peer, refs)
+	if err != nil {
+		clog.Debugf("couldn't prefetch %d blocks from %s: %v", len(refs), peer, err)
+		promDistBlockPeerFailures.WithLabelValues(peer).Inc()
+		return
+	}
+	for i, blk := range blks {
+		if blk == nil {
+			continue
+		}
+		d.readCache.Put(refs[i], blk)
+		promDistBlockPrefetched.Inc()
+	}
+}
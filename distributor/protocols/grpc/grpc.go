@@ -1,12 +1,20 @@
 package grpc
 
 import (
+	"crypto/tls"
 	"net"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"go.opentelemetry.io/otel"
 
 	"golang.org/x/net/context"
 
@@ -17,14 +25,17 @@ import (
 
 const defaultPort = "40000"
 
+var errNoHints = grpc.Errorf(codes.Unimplemented, "hinted handoff not supported")
+
 func init() {
 	protocols.RegisterRPCListener("http", grpcRPCListener)
 	protocols.RegisterRPCDialer("http", grpcRPCDialer)
 }
 
-func grpcRPCListener(url *url.URL, hdl protocols.RPC, gmd torus.GlobalMetadata) (protocols.RPCServer, error) {
+func grpcRPCListener(url *url.URL, hdl protocols.RPC, gmd torus.GlobalMetadata, tlsConfig *tls.Config) (protocols.RPCServer, error) {
 	out := &handler{
-		handle: hdl,
+		handle:    hdl,
+		transfers: make(map[string]*transferState),
 	}
 	h := url.Host
 	if !strings.Contains(h, ":") {
@@ -34,30 +45,150 @@ func grpcRPCListener(url *url.URL, hdl protocols.RPC, gmd torus.GlobalMetadata)
 	if err != nil {
 		return nil, err
 	}
-	out.grpc = grpc.NewServer()
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(intercept), grpc.StreamInterceptor(interceptStream)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	out.grpc = grpc.NewServer(opts...)
 	models.RegisterTorusStorageServer(out.grpc, out)
+	models.RegisterTorusHintsServer(out.grpc, out)
+	models.RegisterTorusTransferServer(out.grpc, out)
 	go out.grpc.Serve(lis)
 	return out, nil
 }
 
-func grpcRPCDialer(url *url.URL, timeout time.Duration, gmd torus.GlobalMetadata) (protocols.RPC, error) {
+func grpcRPCDialer(url *url.URL, timeout time.Duration, gmd torus.GlobalMetadata, tlsConfig *tls.Config, token string) (protocols.RPC, error) {
 	h := url.Host
 	if !strings.Contains(h, ":") {
 		h = net.JoinHostPort(h, defaultPort)
 	}
-	conn, err := grpc.Dial(h, grpc.WithInsecure(), grpc.WithTimeout(timeout))
+	opts := []grpc.DialOption{grpc.WithTimeout(timeout), grpc.WithUnaryInterceptor(propagate), grpc.WithStreamInterceptor(propagateStream)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(token)))
+	}
+	conn, err := grpc.Dial(h, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &client{
-		conn:    conn,
-		handler: models.NewTorusStorageClient(conn),
+		conn:     conn,
+		handler:  models.NewTorusStorageClient(conn),
+		hints:    models.NewTorusHintsClient(conn),
+		transfer: models.NewTorusTransferClient(conn),
 	}, nil
 }
 
+// intercept marks the context of each request with the identity of the
+// client that made it, and continues the client's trace.
+func intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, span := torus.StartSpan(requestContext(ctx), info.FullMethod)
+	resp, err := handler(ctx, req)
+	torus.EndSpan(span, err)
+	return resp, err
+}
+
+// interceptStream does the same as intercept, for streams.
+func interceptStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := torus.StartSpan(requestContext(ss.Context()), info.FullMethod)
+	err := handler(srv, contextStream{ss, ctx})
+	torus.EndSpan(span, err)
+	return err
+}
+
+func requestContext(ctx context.Context) context.Context {
+	var id string
+	if p, ok := peer.FromContext(ctx); ok {
+		if ti, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			id, _ = protocols.PeerIdentity(ti.State)
+		}
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		if t := md[tokenKey]; len(t) != 0 && t[0] != "" {
+			id = torus.TokenIdentity(t[0])
+		}
+		ctx = otel.GetTextMapPropagator().Extract(ctx, mdCarrier(md))
+	}
+	return torus.WithIdentity(ctx, id)
+}
+
+// tokenKey is the metadata key a client's token is sent under.
+const tokenKey = "torus-token"
+
+// tokenCredentials sends a token with every request.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{tokenKey: string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// contextStream is a stream with a context of our own.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// propagate sends the trace of each request along with it.
+func propagate(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(traceContext(ctx), method, req, reply, cc, opts...)
+}
+
+// propagateStream does the same as propagate, for streams.
+func propagateStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(traceContext(ctx), desc, cc, method, opts...)
+}
+
+func traceContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, mdCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// mdCarrier carries trace context in gRPC metadata.
+type mdCarrier metadata.MD
+
+func (c mdCarrier) Get(key string) string {
+	if v := metadata.MD(c)[key]; len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c mdCarrier) Set(key, value string) {
+	metadata.MD(c)[key] = []string{value}
+}
+
+func (c mdCarrier) Keys() []string {
+	out := make([]string, 0, len(c))
+	for k := range c {
+		out = append(out, k)
+	}
+	return out
+}
+
 type client struct {
-	conn    *grpc.ClientConn
-	handler models.TorusStorageClient
+	conn     *grpc.ClientConn
+	handler  models.TorusStorageClient
+	hints    models.TorusHintsClient
+	transfer models.TorusTransferClient
 }
 
 func (c *client) Close() error {
@@ -72,7 +203,61 @@ func (c *client) PutBlock(ctx context.Context, ref torus.BlockRef, data []byte)
 		Blocks: [][]byte{
 			data,
 		},
+		Epoch: torus.WriteEpoch(ctx),
 	})
+	if grpc.Code(err) == codes.FailedPrecondition {
+		return torus.ErrStaleEpoch
+	}
+	return err
+}
+
+func (c *client) PutBlocks(ctx context.Context, refs []torus.BlockRef, blocks [][]byte) error {
+	req := &models.PutBlockRequest{
+		Blocks: blocks,
+		Epoch:  torus.WriteEpoch(ctx),
+	}
+	for _, x := range refs {
+		req.Refs = append(req.Refs, x.ToProto())
+	}
+	_, err := c.handler.PutBlock(ctx, req)
+	if grpc.Code(err) == codes.FailedPrecondition {
+		return torus.ErrStaleEpoch
+	}
+	return err
+}
+
+func (c *client) RepairBlock(ctx context.Context, ref torus.BlockRef, data []byte) error {
+	_, err := c.handler.PutBlock(ctx, &models.PutBlockRequest{
+		Refs: []*models.BlockRef{
+			ref.ToProto(),
+		},
+		Blocks: [][]byte{
+			data,
+		},
+		Epoch:  torus.WriteEpoch(ctx),
+		Repair: true,
+	})
+	if grpc.Code(err) == codes.FailedPrecondition {
+		return torus.ErrStaleEpoch
+	}
+	return err
+}
+
+func (c *client) DeleteBlocks(ctx context.Context, refs []torus.BlockRef) error {
+	req := &models.DiscardBlocksRequest{
+		Epoch: torus.WriteEpoch(ctx),
+	}
+	for _, x := range refs {
+		req.Refs = append(req.Refs, x.ToProto())
+	}
+	_, err := c.handler.DiscardBlocks(ctx, req)
+	switch grpc.Code(err) {
+	case codes.FailedPrecondition:
+		return torus.ErrStaleEpoch
+	case codes.Unimplemented:
+		// Peers from before discards leave the blocks to be collected.
+		return torus.ErrNotSupported
+	}
 	return err
 }
 
@@ -80,6 +265,9 @@ func (c *client) Block(ctx context.Context, ref torus.BlockRef) ([]byte, error)
 	resp, err := c.handler.Block(ctx, &models.BlockRequest{
 		BlockRef: ref.ToProto(),
 	})
+	if grpc.Code(err) == codes.DataLoss {
+		return nil, torus.ErrBlockCorrupt
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +286,43 @@ func (c *client) RebalanceCheck(ctx context.Context, refs []torus.BlockRef) ([]b
 	return resp.Valid, nil
 }
 
+func (c *client) Blocks(ctx context.Context, refs []torus.BlockRef) ([][]byte, error) {
+	req := &models.BlocksRequest{}
+	for _, x := range refs {
+		req.BlockRefs = append(req.BlockRefs, x.ToProto())
+	}
+	resp, err := c.handler.Blocks(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Blocks) != len(refs) {
+		return nil, torus.ErrBlockUnavailable
+	}
+	out := make([][]byte, len(refs))
+	for i, b := range resp.Blocks {
+		if b.Ok {
+			out[i] = b.Data
+		}
+	}
+	return out, nil
+}
+
+func (c *client) PutHintedBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error {
+	_, err := c.hints.PutHintedBlock(ctx, &models.PutHintedBlockRequest{
+		Peer: peer,
+		Ref:  ref.ToProto(),
+		Data: data,
+	})
+	return err
+}
+
+func (c *client) DrainHints(ctx context.Context, peer string) error {
+	_, err := c.hints.DrainHints(ctx, &models.DrainHintsRequest{
+		Peer: peer,
+	})
+	return err
+}
+
 func (c *client) WriteBuf(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
 	panic("unimplemented")
 }
@@ -105,10 +330,16 @@ func (c *client) WriteBuf(ctx context.Context, ref torus.BlockRef) ([]byte, erro
 type handler struct {
 	handle protocols.RPC
 	grpc   *grpc.Server
+
+	transferMut sync.Mutex
+	transfers   map[string]*transferState
 }
 
 func (h *handler) Block(ctx context.Context, req *models.BlockRequest) (*models.BlockResponse, error) {
 	data, err := h.handle.Block(ctx, torus.BlockFromProto(req.BlockRef))
+	if err == torus.ErrBlockCorrupt {
+		return nil, grpc.Errorf(codes.DataLoss, "%v", err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -119,8 +350,22 @@ func (h *handler) Block(ctx context.Context, req *models.BlockRequest) (*models.
 }
 
 func (h *handler) PutBlock(ctx context.Context, req *models.PutBlockRequest) (*models.PutResponse, error) {
+	if req.Epoch != 0 {
+		ctx = torus.WithWriteEpoch(ctx, req.Epoch)
+	}
+	put := h.handle.PutBlock
+	if req.Repair {
+		rr, ok := h.handle.(protocols.RepairRPC)
+		if !ok {
+			return nil, grpc.Errorf(codes.Unimplemented, "repair not supported")
+		}
+		put = rr.RepairBlock
+	}
 	for i, ref := range req.Refs {
-		err := h.handle.PutBlock(ctx, torus.BlockFromProto(ref), req.Blocks[i])
+		err := put(ctx, torus.BlockFromProto(ref), req.Blocks[i])
+		if err == torus.ErrStaleEpoch {
+			return nil, grpc.Errorf(codes.FailedPrecondition, "%v", err)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -128,6 +373,28 @@ func (h *handler) PutBlock(ctx context.Context, req *models.PutBlockRequest) (*m
 	return &models.PutResponse{Ok: true}, nil
 }
 
+func (h *handler) DiscardBlocks(ctx context.Context, req *models.DiscardBlocksRequest) (*models.PutResponse, error) {
+	dr, ok := h.handle.(protocols.DiscardRPC)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unimplemented, "discard not supported")
+	}
+	if req.Epoch != 0 {
+		ctx = torus.WithWriteEpoch(ctx, req.Epoch)
+	}
+	refs := make([]torus.BlockRef, len(req.Refs))
+	for i, ref := range req.Refs {
+		refs[i] = torus.BlockFromProto(ref)
+	}
+	err := dr.DeleteBlocks(ctx, refs)
+	if err == torus.ErrStaleEpoch {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.PutResponse{Ok: true}, nil
+}
+
 func (h *handler) RebalanceCheck(ctx context.Context, req *models.RebalanceCheckRequest) (*models.RebalanceCheckResponse, error) {
 	check := make([]torus.BlockRef, len(req.BlockRefs))
 	for i, x := range req.BlockRefs {
@@ -142,6 +409,49 @@ func (h *handler) RebalanceCheck(ctx context.Context, req *models.RebalanceCheck
 	}, nil
 }
 
+func (h *handler) Blocks(ctx context.Context, req *models.BlocksRequest) (*models.BlocksResponse, error) {
+	resp := &models.BlocksResponse{
+		Blocks: make([]*models.BlockResponse, len(req.BlockRefs)),
+	}
+	for i, x := range req.BlockRefs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp.Blocks[i] = &models.BlockResponse{}
+		data, err := h.handle.Block(ctx, torus.BlockFromProto(x))
+		if err != nil {
+			continue
+		}
+		resp.Blocks[i].Ok = true
+		resp.Blocks[i].Data = data
+	}
+	return resp, nil
+}
+
+func (h *handler) PutHintedBlock(ctx context.Context, req *models.PutHintedBlockRequest) (*models.PutResponse, error) {
+	hr, ok := h.handle.(protocols.HintRPC)
+	if !ok {
+		return nil, errNoHints
+	}
+	err := hr.PutHintedBlock(ctx, req.Peer, torus.BlockFromProto(req.Ref), req.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PutResponse{Ok: true}, nil
+}
+
+func (h *handler) DrainHints(ctx context.Context, req *models.DrainHintsRequest) (*models.PutResponse, error) {
+	hr, ok := h.handle.(protocols.HintRPC)
+	if !ok {
+		return nil, errNoHints
+	}
+	err := hr.DrainHints(ctx, req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PutResponse{Ok: true}, nil
+}
+
 func (h *handler) Close() error {
 	h.grpc.Stop()
 	return nil
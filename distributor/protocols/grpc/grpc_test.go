@@ -0,0 +1,131 @@
+package grpc
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/protocols"
+)
+
+func TestTracePropagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4},
+		SpanID:     trace.SpanID{5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	// Carry the outgoing metadata of the client over to the server, as
+	// the connection would.
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	err := propagate(ctx, "/models.TorusStorage/Block", nil, nil, nil, invoker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) == 0 {
+		t.Fatal("expected the trace context to be sent")
+	}
+
+	var got trace.SpanContext
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = trace.SpanContextFromContext(ctx)
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/models.TorusStorage/Block"}
+	_, err = intercept(metadata.NewIncomingContext(context.Background(), sent), nil, info, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID() != sc.TraceID() {
+		t.Fatalf("expected the request to continue trace %s, got %s", sc.TraceID(), got.TraceID())
+	}
+}
+
+type plainRPC struct{}
+
+func (plainRPC) PutBlock(ctx context.Context, ref torus.BlockRef, data []byte) error {
+	return nil
+}
+
+func (plainRPC) Block(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	return nil, nil
+}
+
+func (plainRPC) RebalanceCheck(ctx context.Context, refs []torus.BlockRef) ([]bool, error) {
+	return nil, nil
+}
+
+func (plainRPC) Close() error {
+	return nil
+}
+
+func (plainRPC) WriteBuf(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	return nil, nil
+}
+
+type discardRPC struct {
+	plainRPC
+	refs  []torus.BlockRef
+	epoch uint64
+}
+
+func (d *discardRPC) DeleteBlocks(ctx context.Context, refs []torus.BlockRef) error {
+	d.refs = refs
+	d.epoch = torus.WriteEpoch(ctx)
+	return nil
+}
+
+func TestDiscardBlocks(t *testing.T) {
+	refs := []torus.BlockRef{{INodeRef: torus.NewINodeRef(1, 2), Index: 3}}
+	d := &discardRPC{}
+	tests := []struct {
+		addr string
+		hdl  protocols.RPC
+		err  error
+	}{
+		// A peer from before discards has nothing to free them with.
+		{"http://127.0.0.1:40070", plainRPC{}, torus.ErrNotSupported},
+		{"http://127.0.0.1:40071", d, nil},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv, err := grpcRPCListener(u, tt.hdl, torus.GlobalMetadata{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := grpcRPCDialer(u, 5*time.Second, torus.GlobalMetadata{}, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := torus.WithWriteEpoch(context.Background(), 7)
+		err = c.(protocols.DiscardRPC).DeleteBlocks(ctx, refs)
+		c.Close()
+		srv.Close()
+		if err != tt.err {
+			t.Errorf("%s: expected %v, got %v", tt.addr, tt.err, err)
+		}
+	}
+	if !reflect.DeepEqual(d.refs, refs) || d.epoch != 7 {
+		t.Errorf("expected refs %v at epoch 7 to be discarded, got %v at epoch %d", refs, d.refs, d.epoch)
+	}
+}
@@ -0,0 +1,221 @@
+package grpc
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+const (
+	// transferWindow is how many blocks may be sent ahead of the peer's
+	// acknowledgements.
+	transferWindow = 32
+	// transferAttempts is how many streams a transfer may take before it's
+	// given up on.
+	transferAttempts = 3
+	// transferTTL is how long a peer remembers a transfer it hasn't heard
+	// from, so that it can be resumed.
+	transferTTL = 10 * time.Minute
+)
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	errBadChecksum    = errors.New("checksum mismatch")
+	errBlockRejected  = errors.New("peer couldn't store block")
+	errTransferOffset = grpc.Errorf(codes.InvalidArgument, "transfer offset went backwards")
+)
+
+// SendBlocks streams the blocks to the peer, up to transferWindow of them
+// ahead of its acknowledgements. If the stream breaks, the transfer is
+// resumed on a new one from the first block the peer hadn't handled.
+func (c *client) SendBlocks(ctx context.Context, refs []torus.BlockRef, epochs []uint64, get func(i int) ([]byte, error)) ([]error, error) {
+	id := uuid.New()
+	errs := make([]error, len(refs))
+	var err error
+	for attempt := 0; attempt < transferAttempts; attempt++ {
+		err = c.sendBlocks(ctx, id, refs, epochs, get, errs)
+		if err == nil {
+			return errs, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+func (c *client) sendBlocks(ctx context.Context, id string, refs []torus.BlockRef, epochs []uint64, get func(i int) ([]byte, error), errs []error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.transfer.Transfer(ctx)
+	if err != nil {
+		return err
+	}
+	err = stream.Send(&models.TransferBlock{Transfer: id})
+	if err != nil {
+		return err
+	}
+	ack, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	for _, off := range ack.Failed {
+		if off < uint64(len(errs)) {
+			errs[off] = errBlockRejected
+		}
+	}
+
+	window := make(chan struct{}, transferWindow)
+	recvErr := make(chan error, 1)
+	done := make(chan struct{})
+	// Don't leave the receiver behind to race the next attempt.
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		for {
+			ack, err := stream.Recv()
+			if err == io.EOF {
+				recvErr <- nil
+				return
+			}
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			if ack.Err != "" && ack.Offset != 0 && ack.Offset <= uint64(len(errs)) {
+				errs[ack.Offset-1] = errors.New(ack.Err)
+			}
+			<-window
+		}
+	}()
+	for i := int(ack.Offset); i < len(refs); i++ {
+		data, err := get(i)
+		errs[i] = err
+		if err != nil {
+			continue
+		}
+		select {
+		case window <- struct{}{}:
+		case err := <-recvErr:
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		blk := &models.TransferBlock{
+			Transfer: id,
+			Offset:   uint64(i),
+			Ref:      refs[i].ToProto(),
+			Data:     data,
+			Crc:      crc32.Checksum(data, castagnoli),
+		}
+		if epochs != nil {
+			blk.Epoch = epochs[i]
+		}
+		err = stream.Send(blk)
+		if err != nil {
+			return err
+		}
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return err
+	}
+	return <-recvErr
+}
+
+// transferState is what a peer remembers of a transfer sent to it.
+type transferState struct {
+	next     uint64
+	failed   []uint64
+	lastSeen time.Time
+}
+
+func (h *handler) Transfer(stream models.TorusTransfer_TransferServer) error {
+	ctx := stream.Context()
+	hdr, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	id := hdr.Transfer
+	st := h.startTransfer(id)
+	h.transferMut.Lock()
+	ack := &models.TransferAck{Offset: st.next, Failed: st.failed}
+	h.transferMut.Unlock()
+	err = stream.Send(ack)
+	if err != nil {
+		return err
+	}
+	for {
+		blk, err := stream.Recv()
+		if err == io.EOF {
+			h.transferMut.Lock()
+			delete(h.transfers, id)
+			h.transferMut.Unlock()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		h.transferMut.Lock()
+		next := st.next
+		h.transferMut.Unlock()
+		if blk.Offset < next {
+			return errTransferOffset
+		}
+		bctx := ctx
+		if blk.Epoch != 0 {
+			bctx = torus.WithWriteEpoch(ctx, blk.Epoch)
+		}
+		var msg string
+		if crc32.Checksum(blk.Data, castagnoli) != blk.Crc {
+			msg = errBadChecksum.Error()
+		} else if err := h.handle.PutBlock(bctx, torus.BlockFromProto(blk.Ref), blk.Data); err != nil {
+			msg = err.Error()
+		}
+		h.transferMut.Lock()
+		st.next = blk.Offset + 1
+		st.lastSeen = time.Now()
+		if msg != "" {
+			st.failed = append(st.failed, blk.Offset)
+		}
+		h.transferMut.Unlock()
+		err = stream.Send(&models.TransferAck{Offset: blk.Offset + 1, Err: msg})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// startTransfer returns the state of the transfer, new or resumed, and
+// forgets transfers that haven't been heard from in a while.
+func (h *handler) startTransfer(id string) *transferState {
+	h.transferMut.Lock()
+	defer h.transferMut.Unlock()
+	now := time.Now()
+	for k, st := range h.transfers {
+		if now.Sub(st.lastSeen) > transferTTL {
+			delete(h.transfers, k)
+		}
+	}
+	st, ok := h.transfers[id]
+	if !ok {
+		st = &transferState{}
+		h.transfers[id] = st
+	}
+	st.lastSeen = now
+	return st
+}
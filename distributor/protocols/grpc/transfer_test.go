@@ -0,0 +1,133 @@
+package grpc
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+var errFull = errors.New("full")
+
+type storeRPC struct {
+	mut    sync.Mutex
+	blocks map[torus.BlockRef][]byte
+}
+
+func (s *storeRPC) PutBlock(ctx context.Context, ref torus.BlockRef, data []byte) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if ref.Index == 3 {
+		return errFull
+	}
+	s.blocks[ref] = data
+	return nil
+}
+
+func (s *storeRPC) Block(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	return nil, torus.ErrBlockNotExist
+}
+
+func (s *storeRPC) RebalanceCheck(ctx context.Context, refs []torus.BlockRef) ([]bool, error) {
+	return make([]bool, len(refs)), nil
+}
+
+func (s *storeRPC) WriteBuf(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	return nil, torus.ErrNotSupported
+}
+
+func (s *storeRPC) Close() error { return nil }
+
+func TestTransferResume(t *testing.T) {
+	store := &storeRPC{blocks: make(map[torus.BlockRef][]byte)}
+	h := &handler{
+		handle:    store,
+		transfers: make(map[string]*transferState),
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.grpc = grpc.NewServer(grpc.StreamInterceptor(interceptStream))
+	models.RegisterTorusTransferServer(h.grpc, h)
+	go h.grpc.Serve(lis)
+	defer h.Close()
+	dial := func() *client {
+		rpc, err := grpcRPCDialer(&url.URL{Scheme: "http", Host: lis.Addr().String()}, time.Second, torus.GlobalMetadata{}, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rpc.(*client)
+	}
+
+	refs := make([]torus.BlockRef, 10)
+	for i := range refs {
+		refs[i] = torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+	}
+	data := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, 64) }
+	next := func(id string) uint64 {
+		h.transferMut.Lock()
+		defer h.transferMut.Unlock()
+		if st, ok := h.transfers[id]; ok {
+			return st.next
+		}
+		return 0
+	}
+
+	// Drop the connection once the peer has handled the first 5 blocks.
+	const id = "transfer"
+	c := dial()
+	errs := make([]error, len(refs))
+	err = c.sendBlocks(context.Background(), id, refs, nil, func(i int) ([]byte, error) {
+		if i == 5 {
+			for next(id) != 5 {
+				time.Sleep(time.Millisecond)
+			}
+			c.Close()
+		}
+		return data(i), nil
+	}, errs)
+	if err == nil {
+		t.Fatal("expected the first stream to break")
+	}
+
+	var read []int
+	c = dial()
+	defer c.Close()
+	err = c.sendBlocks(context.Background(), id, refs, nil, func(i int) ([]byte, error) {
+		read = append(read, i)
+		return data(i), nil
+	}, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 5 || read[0] != 5 {
+		t.Fatalf("expected the transfer to resume at block 5, read %v", read)
+	}
+	for i, ref := range refs {
+		if i == 3 {
+			if errs[i] == nil {
+				t.Fatal("expected the block the peer refused to fail")
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Fatalf("block %d: %v", i, errs[i])
+		}
+		if !bytes.Equal(store.blocks[ref], data(i)) {
+			t.Fatalf("block %d wasn't stored", i)
+		}
+	}
+	if len(h.transfers) != 0 {
+		t.Fatal("expected the finished transfer to be forgotten")
+	}
+}
@@ -3,6 +3,7 @@
 package protocols
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/url"
 	"time"
@@ -22,12 +23,66 @@ type RPC interface {
 	WriteBuf(ctx context.Context, ref torus.BlockRef) ([]byte, error)
 }
 
+// HintRPC is implemented by RPCs that support hinted handoff, where a peer
+// holds blocks on behalf of an owner that is down.
+type HintRPC interface {
+	// PutHintedBlock stores a block that belongs on peer.
+	PutHintedBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error
+	// DrainHints asks for the blocks held on behalf of peer to be handed off
+	// without waiting for the next handoff pass.
+	DrainHints(ctx context.Context, peer string) error
+}
+
+// RepairRPC is implemented by RPCs that can overwrite a peer's copy of a
+// block, for fixing copies that have diverged.
+type RepairRPC interface {
+	// RepairBlock replaces the peer's copy of the block with data.
+	RepairBlock(ctx context.Context, ref torus.BlockRef, data []byte) error
+}
+
+// DiscardRPC is implemented by RPCs that can free a peer's copies of blocks
+// a volume no longer uses.
+type DiscardRPC interface {
+	// DeleteBlocks deletes the peer's copies of the blocks it has.
+	DeleteBlocks(ctx context.Context, refs []torus.BlockRef) error
+}
+
+// BatchRPC is implemented by RPCs that can fetch many blocks from a peer in one
+// request.
+type BatchRPC interface {
+	// Blocks returns the blocks in the order of refs. Blocks the peer doesn't
+	// have are nil.
+	Blocks(ctx context.Context, refs []torus.BlockRef) ([][]byte, error)
+}
+
+// BatchPutRPC is implemented by RPCs that can send many blocks to a peer in
+// one request.
+type BatchPutRPC interface {
+	// PutBlocks stores the blocks, in the order of refs, failing if any of
+	// them can't be stored.
+	PutBlocks(ctx context.Context, refs []torus.BlockRef, blocks [][]byte) error
+}
+
+// TransferRPC is implemented by RPCs that can stream many blocks to a peer,
+// picking up where they left off if the stream breaks.
+type TransferRPC interface {
+	// SendBlocks sends the blocks of refs to the peer in one transfer,
+	// reading each with get just before it's sent, and stamped with the
+	// attachment epoch of the same index in epochs, if any. It returns an
+	// error for each block the peer didn't store, nil for those it did, or an
+	// error if the transfer couldn't be finished.
+	SendBlocks(ctx context.Context, refs []torus.BlockRef, epochs []uint64, get func(i int) ([]byte, error)) ([]error, error)
+}
+
 type RPCServer interface {
 	Close() error
 }
 
-type RPCDialerFunc func(*url.URL, time.Duration, torus.GlobalMetadata) (RPC, error)
-type RPCListenerFunc func(*url.URL, RPC, torus.GlobalMetadata) (RPCServer, error)
+// RPCDialerFunc and RPCListenerFunc secure their connections with the given
+// TLS configuration, or don't if it's nil. A dialer given a token presents
+// it to the server, which checks volume ACLs against the token's identity.
+type RPCDialerFunc func(*url.URL, time.Duration, torus.GlobalMetadata, *tls.Config, string) (RPC, error)
+type RPCListenerFunc func(*url.URL, RPC, torus.GlobalMetadata, *tls.Config) (RPCServer, error)
 
 var rpcDialers map[string]RPCDialerFunc
 var rpcListeners map[string]RPCListenerFunc
@@ -44,12 +99,12 @@ func RegisterRPCListener(scheme string, newFunc RPCListenerFunc) {
 	rpcListeners[scheme] = newFunc
 }
 
-func ListenRPC(url *url.URL, handler RPC, gmd torus.GlobalMetadata) (RPCServer, error) {
+func ListenRPC(url *url.URL, handler RPC, gmd torus.GlobalMetadata, tlsConfig *tls.Config) (RPCServer, error) {
 	if rpcListeners[url.Scheme] == nil {
 		return nil, fmt.Errorf("Unknown ListenRPC protocol '%s'", url.Scheme)
 	}
 
-	return rpcListeners[url.Scheme](url, handler, gmd)
+	return rpcListeners[url.Scheme](url, handler, gmd, tlsConfig)
 }
 
 func RegisterRPCDialer(scheme string, newFunc RPCDialerFunc) {
@@ -64,10 +119,21 @@ func RegisterRPCDialer(scheme string, newFunc RPCDialerFunc) {
 	rpcDialers[scheme] = newFunc
 }
 
-func DialRPC(url *url.URL, timeout time.Duration, gmd torus.GlobalMetadata) (RPC, error) {
+// PeerIdentity returns the identity of the client on the other end of a TLS
+// connection, if it presented a certificate. Servers mark the requests of
+// clients that presented neither a certificate nor a token with the empty
+// identity, which no ACL grants anything to.
+func PeerIdentity(state tls.ConnectionState) (string, bool) {
+	if len(state.PeerCertificates) == 0 {
+		return "", false
+	}
+	return torus.CertIdentity(state.PeerCertificates[0]), true
+}
+
+func DialRPC(url *url.URL, timeout time.Duration, gmd torus.GlobalMetadata, tlsConfig *tls.Config, token string) (RPC, error) {
 	if rpcDialers[url.Scheme] == nil {
 		return nil, fmt.Errorf("Unknown DialRPC protocol '%s'", url.Scheme)
 	}
 
-	return rpcDialers[url.Scheme](url, timeout, gmd)
+	return rpcDialers[url.Scheme](url, timeout, gmd, tlsConfig, token)
 }
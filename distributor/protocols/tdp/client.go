@@ -1,6 +1,8 @@
 package tdp
 
 import (
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
@@ -40,7 +42,19 @@ type Conn struct {
 }
 
 func Dial(addr string, timeout time.Duration, blockSize uint64) (*Conn, error) {
-	c, err := net.Dial("tcp", addr)
+	return DialTLS(addr, timeout, blockSize, nil)
+}
+
+// DialTLS is like Dial, but speaks TLS to the server if tlsConfig is not
+// nil.
+func DialTLS(addr string, timeout time.Duration, blockSize uint64, tlsConfig *tls.Config) (*Conn, error) {
+	var c net.Conn
+	var err error
+	if tlsConfig != nil {
+		c, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
+	} else {
+		c, err = net.Dial("tcp", addr)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -54,6 +68,32 @@ func Dial(addr string, timeout time.Duration, blockSize uint64) (*Conn, error) {
 	return conn, nil
 }
 
+// PresentToken identifies the client to the server by token, for the
+// server's checks of volume ACLs, on every request that follows.
+func (c *Conn) PresentToken(token string) error {
+	if len(token) > 0xffff {
+		return errors.New("token too long")
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.conn.SetDeadline(time.Now().Add(clientTimeout))
+	b := make([]byte, 3, 3+len(token))
+	b[0] = cmdToken
+	binary.LittleEndian.PutUint16(b[1:], uint16(len(token)))
+	_, err := c.conn.Write(append(b, token...))
+	if err != nil {
+		return fmt.Errorf("couldn't write: %v", err)
+	}
+	err = readConnIntoBuffer(c.conn, c.buf[:1])
+	if err != nil {
+		return err
+	}
+	if c.buf[0] != respOk {
+		return errors.New("server refused token")
+	}
+	return nil
+}
+
 func (c *Conn) mainLoop() {
 	for {
 		select {
@@ -95,8 +135,11 @@ func (c *Conn) Block(_ context.Context, ref torus.BlockRef) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if c.buf[0] == respErr {
+	switch c.buf[0] {
+	case respErr:
 		return nil, errors.New("server error")
+	case respCorrupt:
+		return nil, torus.ErrBlockCorrupt
 	}
 	data := make([]byte, c.blockSize)
 	err = readConnIntoBuffer(c.conn, data)
@@ -114,11 +157,158 @@ func (c *Conn) PutBlock(ctx context.Context, ref torus.BlockRef, data []byte) er
 	defer c.mut.Unlock()
 	c.conn.SetDeadline(time.Now().Add(writeClientTimeout))
 	c.buf[0] = cmdPutBlock
+	epoch := torus.WriteEpoch(ctx)
+	if epoch != 0 {
+		c.buf[0] = cmdPutBlockEpoch
+	}
 	ref.ToBytesBuf(c.buf[1:])
 	_, err := c.conn.Write(c.buf)
 	if err != nil {
 		return fmt.Errorf("couldn't write: %v", err)
 	}
+	if epoch != 0 {
+		eb := make([]byte, 8)
+		binary.LittleEndian.PutUint64(eb, epoch)
+		_, err = c.conn.Write(eb)
+		if err != nil {
+			return fmt.Errorf("couldn't write epoch: %v", err)
+		}
+	}
+	_, err = c.conn.Write(data)
+	if err != nil {
+		return fmt.Errorf("couldn't write data: %v", err)
+	}
+	err = readConnIntoBuffer(c.conn, c.buf[:1])
+	if err != nil {
+		return err
+	}
+	switch c.buf[0] {
+	case respErr:
+		return errors.New("server error")
+	case respStaleEpoch:
+		return torus.ErrStaleEpoch
+	}
+	return nil
+}
+
+func (c *Conn) RepairBlock(ctx context.Context, ref torus.BlockRef, data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.conn.SetDeadline(time.Now().Add(writeClientTimeout))
+	c.buf[0] = cmdRepairBlock
+	epoch := torus.WriteEpoch(ctx)
+	if epoch != 0 {
+		c.buf[0] = cmdRepairBlockEpoch
+	}
+	ref.ToBytesBuf(c.buf[1:])
+	_, err := c.conn.Write(c.buf)
+	if err != nil {
+		return fmt.Errorf("couldn't write: %v", err)
+	}
+	if epoch != 0 {
+		eb := make([]byte, 8)
+		binary.LittleEndian.PutUint64(eb, epoch)
+		_, err = c.conn.Write(eb)
+		if err != nil {
+			return fmt.Errorf("couldn't write epoch: %v", err)
+		}
+	}
+	_, err = c.conn.Write(data)
+	if err != nil {
+		return fmt.Errorf("couldn't write data: %v", err)
+	}
+	err = readConnIntoBuffer(c.conn, c.buf[:1])
+	if err != nil {
+		return err
+	}
+	switch c.buf[0] {
+	case respErr:
+		return errors.New("server error")
+	case respStaleEpoch:
+		return torus.ErrStaleEpoch
+	}
+	return nil
+}
+
+// DeleteBlocks asks the server to delete its copies of refs, at most 255 at a
+// time.
+func (c *Conn) DeleteBlocks(ctx context.Context, refs []torus.BlockRef) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for len(refs) > 0 {
+		n := len(refs)
+		if n > 255 {
+			n = 255
+		}
+		c.conn.SetDeadline(time.Now().Add(writeClientTimeout))
+		hdr := make([]byte, 10)
+		hdr[0] = cmdDeleteBlocks
+		hdr[1] = byte(n)
+		binary.LittleEndian.PutUint64(hdr[2:], torus.WriteEpoch(ctx))
+		_, err := c.conn.Write(hdr)
+		if err != nil {
+			return fmt.Errorf("couldn't write: %v", err)
+		}
+		for _, ref := range refs[:n] {
+			ref.ToBytesBuf(c.buf)
+			_, err = c.conn.Write(c.buf[:torus.BlockRefByteSize])
+			if err != nil {
+				return fmt.Errorf("couldn't write ref: %v", err)
+			}
+		}
+		err = readConnIntoBuffer(c.conn, c.buf[:1])
+		if err != nil {
+			return err
+		}
+		switch c.buf[0] {
+		case respErr:
+			return errors.New("server error")
+		case respStaleEpoch:
+			return torus.ErrStaleEpoch
+		}
+		refs = refs[n:]
+	}
+	return nil
+}
+
+// peerHeader returns a command header followed by a length-prefixed peer UUID.
+func peerHeader(cmd byte, peer string) ([]byte, error) {
+	if len(peer) > 255 {
+		return nil, errors.New("peer UUID too long")
+	}
+	buf := make([]byte, 2+len(peer))
+	buf[0] = cmd
+	buf[1] = byte(len(peer))
+	copy(buf[2:], peer)
+	return buf, nil
+}
+
+func (c *Conn) PutHintedBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+	header, err := peerHeader(cmdPutHintedBlock, peer)
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.conn.SetDeadline(time.Now().Add(writeClientTimeout))
+	_, err = c.conn.Write(header)
+	if err != nil {
+		return fmt.Errorf("couldn't write: %v", err)
+	}
+	ref.ToBytesBuf(c.buf[1:])
+	_, err = c.conn.Write(c.buf[1:])
+	if err != nil {
+		return fmt.Errorf("couldn't write ref: %v", err)
+	}
 	_, err = c.conn.Write(data)
 	if err != nil {
 		return fmt.Errorf("couldn't write data: %v", err)
@@ -133,6 +323,31 @@ func (c *Conn) PutBlock(ctx context.Context, ref torus.BlockRef, data []byte) er
 	return nil
 }
 
+func (c *Conn) DrainHints(ctx context.Context, peer string) error {
+	if c.err != nil {
+		return c.err
+	}
+	header, err := peerHeader(cmdDrainHints, peer)
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.conn.SetDeadline(time.Now().Add(clientTimeout))
+	_, err = c.conn.Write(header)
+	if err != nil {
+		return fmt.Errorf("couldn't write: %v", err)
+	}
+	err = readConnIntoBuffer(c.conn, c.buf[:1])
+	if err != nil {
+		return err
+	}
+	if c.buf[0] == respErr {
+		return errors.New("server error")
+	}
+	return nil
+}
+
 func (c *Conn) RebalanceCheck(_ context.Context, refs []torus.BlockRef) ([]bool, error) {
 	if c.err != nil {
 		return nil, c.err
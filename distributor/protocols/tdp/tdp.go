@@ -1,6 +1,8 @@
 package tdp
 
 import (
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/protocols"
 	"golang.org/x/net/context"
 )
 
@@ -21,16 +24,27 @@ const (
 	cmdPutBlock
 	cmdBlock
 	cmdRebalanceCheck
+	cmdPutHintedBlock
+	cmdDrainHints
+	cmdPutBlockEpoch
+	cmdRepairBlock
+	cmdDeleteBlocks
+	cmdToken
+	cmdRepairBlockEpoch
 )
 
 const (
 	respOk byte = iota + 1
 	respErr
+	respStaleEpoch
+	respCorrupt
 )
 
 var (
-	headerOk  = []byte{respOk}
-	headerErr = []byte{respErr}
+	headerOk         = []byte{respOk}
+	headerErr        = []byte{respErr}
+	headerStaleEpoch = []byte{respStaleEpoch}
+	headerCorrupt    = []byte{respCorrupt}
 )
 
 type Server struct {
@@ -50,13 +64,58 @@ type Handler interface {
 	WriteBuf(ctx context.Context, ref torus.BlockRef) ([]byte, error)
 }
 
-var _ Handler = &Conn{}
+// HintHandler is implemented by handlers that support hinted handoff.
+type HintHandler interface {
+	PutHintedBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error
+	DrainHints(ctx context.Context, peer string) error
+}
+
+// RepairHandler is implemented by handlers that can replace their copy of a
+// block.
+type RepairHandler interface {
+	RepairBlock(ctx context.Context, ref torus.BlockRef, data []byte) error
+}
+
+// DeleteHandler is implemented by handlers that can delete their copies of
+// blocks that are no longer used.
+type DeleteHandler interface {
+	DeleteBlocks(ctx context.Context, refs []torus.BlockRef) error
+}
+
+// BlockWriterHandler is implemented by handlers that can write a block
+// straight from storage to the connection. Blocks they return
+// torus.ErrNotSupported for are served by Block.
+type BlockWriterHandler interface {
+	WriteBlockTo(ctx context.Context, ref torus.BlockRef, w io.Writer) error
+}
+
+var (
+	errNoHints  = errors.New("hinted handoff not supported")
+	errNoRepair = errors.New("repair not supported")
+	errNoDelete = errors.New("deleting blocks not supported")
+)
+
+var (
+	_ Handler       = &Conn{}
+	_ HintHandler   = &Conn{}
+	_ RepairHandler = &Conn{}
+	_ DeleteHandler = &Conn{}
+)
 
 func Serve(addr string, handler Handler, blocksize uint64) (*Server, error) {
+	return ServeTLS(addr, handler, blocksize, nil)
+}
+
+// ServeTLS is like Serve, but wraps every connection in TLS if tlsConfig
+// is not nil.
+func ServeTLS(addr string, handler Handler, blocksize uint64, tlsConfig *tls.Config) (*Server, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
 	srv := &Server{
 		lst:       l,
 		handler:   handler,
@@ -89,6 +148,20 @@ func (s *Server) serve() {
 }
 
 func (s *Server) handle(conn net.Conn) {
+	// Connections that present neither a certificate nor a token are
+	// marked with the empty identity.
+	ctx := torus.WithIdentity(context.Background(), "")
+	if tc, ok := conn.(*tls.Conn); ok {
+		err := tc.Handshake()
+		if err != nil {
+			clog.Warningf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		if id, ok := protocols.PeerIdentity(tc.ConnectionState()); ok {
+			ctx = torus.WithIdentity(ctx, id)
+		}
+	}
 	header := make([]byte, 1)
 	refbuf := make([]byte, torus.BlockRefByteSize)
 	null := make([]byte, s.blocksize)
@@ -110,13 +183,30 @@ func (s *Server) handle(conn net.Conn) {
 		case cmdKeepAlive:
 			continue
 		case cmdBlock:
-			err = s.handleBlock(conn, refbuf)
+			err = s.handleBlock(ctx, conn, refbuf)
 		case cmdPutBlock:
-			err = s.handlePutBlock(conn, refbuf, null)
+			err = s.handlePutBlock(ctx, conn, refbuf, null, false)
+		case cmdPutBlockEpoch:
+			err = s.handlePutBlock(ctx, conn, refbuf, null, true)
+		case cmdPutHintedBlock:
+			err = s.handlePutHintedBlock(ctx, conn, refbuf)
+		case cmdDrainHints:
+			err = s.handleDrainHints(ctx, conn)
+		case cmdRepairBlock:
+			err = s.handleRepairBlock(ctx, conn, refbuf, false)
+		case cmdRepairBlockEpoch:
+			err = s.handleRepairBlock(ctx, conn, refbuf, true)
+		case cmdToken:
+			ctx, err = s.handleToken(ctx, conn)
 		case cmdRebalanceCheck:
 			err := readConnIntoBuffer(conn, header)
 			if err == nil {
-				err = s.handleRebalanceCheck(conn, int(header[0]), refbuf)
+				err = s.handleRebalanceCheck(ctx, conn, int(header[0]), refbuf)
+			}
+		case cmdDeleteBlocks:
+			err = readConnIntoBuffer(conn, header)
+			if err == nil {
+				err = s.handleDeleteBlocks(ctx, conn, int(header[0]), refbuf)
 			}
 		default:
 			err = errors.New("unknown message on the data port")
@@ -131,6 +221,23 @@ func (s *Server) handle(conn net.Conn) {
 	}
 }
 
+// handleToken reads the token a client presents, returning the context for
+// the rest of its requests, which carries the token's identity.
+func (s *Server) handleToken(ctx context.Context, conn net.Conn) (context.Context, error) {
+	n := make([]byte, 2)
+	err := readConnIntoBuffer(conn, n)
+	if err != nil {
+		return ctx, err
+	}
+	token := make([]byte, binary.LittleEndian.Uint16(n))
+	err = readConnIntoBuffer(conn, token)
+	if err != nil {
+		return ctx, err
+	}
+	_, err = conn.Write(headerOk)
+	return torus.WithIdentity(ctx, torus.TokenIdentity(string(token))), err
+}
+
 func readConnIntoBuffer(conn net.Conn, buf []byte) error {
 	off := 0
 	for off != len(buf) {
@@ -143,17 +250,38 @@ func readConnIntoBuffer(conn net.Conn, buf []byte) error {
 	return nil
 }
 
-func (s *Server) handleBlock(conn net.Conn, refbuf []byte) error {
+func (s *Server) handleBlock(ctx context.Context, conn net.Conn, refbuf []byte) error {
 	err := readConnIntoBuffer(conn, refbuf)
 	if err != nil {
 		return err
 	}
 	ref := torus.BlockRefFromBytes(refbuf)
-	data, err := s.handler.Block(context.TODO(), ref)
+	if h, ok := s.handler.(BlockWriterHandler); ok {
+		w := &blockWriter{conn: conn}
+		err = h.WriteBlockTo(ctx, ref, w)
+		if w.sent {
+			return err
+		}
+		if err != torus.ErrNotSupported {
+			respheader := headerErr
+			if err == torus.ErrBlockCorrupt {
+				respheader = headerCorrupt
+			}
+			if err != nil {
+				clog.Warningf("failed to handle block: %v", err)
+			}
+			_, err = conn.Write(respheader)
+			return err
+		}
+	}
+	data, err := s.handler.Block(ctx, ref)
 	respheader := headerOk
 	if err != nil {
 		clog.Warningf("failed to handle block: %v", err)
 		respheader = headerErr
+		if err == torus.ErrBlockCorrupt {
+			respheader = headerCorrupt
+		}
 	}
 	_, err = conn.Write(respheader)
 	if err != nil {
@@ -166,17 +294,58 @@ func (s *Server) handleBlock(conn net.Conn, refbuf []byte) error {
 	return nil
 }
 
-func (s *Server) handlePutBlock(conn net.Conn, refbuf []byte, null []byte) error {
+// blockWriter writes a block to conn behind the OK header, sending the
+// header before the first write.
+type blockWriter struct {
+	conn net.Conn
+	sent bool
+}
+
+func (w *blockWriter) Write(p []byte) (int, error) {
+	if !w.sent {
+		w.sent = true
+		_, err := w.conn.Write(headerOk)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.conn.Write(p)
+}
+
+func (s *Server) handlePutBlock(ctx context.Context, conn net.Conn, refbuf []byte, null []byte, fenced bool) error {
 	err := readConnIntoBuffer(conn, refbuf)
 	if err != nil {
 		return err
 	}
 	ref := torus.BlockRefFromBytes(refbuf)
-	data, err := s.handler.WriteBuf(context.TODO(), ref)
+	if fenced {
+		epoch := make([]byte, 8)
+		err = readConnIntoBuffer(conn, epoch)
+		if err != nil {
+			return err
+		}
+		ctx = torus.WithWriteEpoch(ctx, binary.LittleEndian.Uint64(epoch))
+	}
+	respheader := headerOk
+	data, err := s.handler.WriteBuf(ctx, ref)
+	buffered := false
 	if err != nil {
-		if err == torus.ErrExists {
+		switch err {
+		case torus.ErrExists:
+			data = null
+		case torus.ErrStaleEpoch:
+			// Drain the block so the connection stays usable.
 			data = null
-		} else {
+			respheader = headerStaleEpoch
+		case torus.ErrPermissionDenied:
+			data = null
+			respheader = headerErr
+		case torus.ErrNotSupported:
+			// The store can't take the block in place, such as when
+			// it has to be encrypted first.
+			data = make([]byte, s.blocksize)
+			buffered = true
+		default:
 			return err
 		}
 	}
@@ -184,15 +353,153 @@ func (s *Server) handlePutBlock(conn net.Conn, refbuf []byte, null []byte) error
 	if err != nil {
 		return err
 	}
+	if buffered {
+		err = s.handler.PutBlock(ctx, ref, data)
+		switch err {
+		case nil, torus.ErrExists:
+		case torus.ErrStaleEpoch:
+			respheader = headerStaleEpoch
+		default:
+			clog.Warningf("failed to put block: %v", err)
+			respheader = headerErr
+		}
+	}
+	_, err = conn.Write(respheader)
+	return err
+}
+
+// readPeer reads a peer UUID, prefixed by its length.
+func readPeer(conn net.Conn) (string, error) {
+	l := make([]byte, 1)
+	err := readConnIntoBuffer(conn, l)
+	if err != nil {
+		return "", err
+	}
+	peer := make([]byte, l[0])
+	err = readConnIntoBuffer(conn, peer)
+	if err != nil {
+		return "", err
+	}
+	return string(peer), nil
+}
+
+func (s *Server) handlePutHintedBlock(ctx context.Context, conn net.Conn, refbuf []byte) error {
+	peer, err := readPeer(conn)
+	if err != nil {
+		return err
+	}
+	err = readConnIntoBuffer(conn, refbuf)
+	if err != nil {
+		return err
+	}
+	ref := torus.BlockRefFromBytes(refbuf)
+	data := make([]byte, s.blocksize)
+	err = readConnIntoBuffer(conn, data)
+	if err != nil {
+		return err
+	}
+	err = errNoHints
+	if h, ok := s.handler.(HintHandler); ok {
+		err = h.PutHintedBlock(ctx, peer, ref, data)
+	}
+	respheader := headerOk
+	if err != nil {
+		clog.Warningf("failed to put hinted block: %v", err)
+		respheader = headerErr
+	}
+	_, err = conn.Write(respheader)
+	return err
+}
+
+func (s *Server) handleRepairBlock(ctx context.Context, conn net.Conn, refbuf []byte, fenced bool) error {
+	err := readConnIntoBuffer(conn, refbuf)
+	if err != nil {
+		return err
+	}
+	ref := torus.BlockRefFromBytes(refbuf)
+	if fenced {
+		epoch := make([]byte, 8)
+		err = readConnIntoBuffer(conn, epoch)
+		if err != nil {
+			return err
+		}
+		ctx = torus.WithWriteEpoch(ctx, binary.LittleEndian.Uint64(epoch))
+	}
+	data := make([]byte, s.blocksize)
+	err = readConnIntoBuffer(conn, data)
+	if err != nil {
+		return err
+	}
+	err = errNoRepair
+	if h, ok := s.handler.(RepairHandler); ok {
+		err = h.RepairBlock(ctx, ref, data)
+	}
+	respheader := headerOk
+	switch err {
+	case nil:
+	case torus.ErrStaleEpoch:
+		respheader = headerStaleEpoch
+	default:
+		clog.Warningf("failed to repair block: %v", err)
+		respheader = headerErr
+	}
+	_, err = conn.Write(respheader)
+	return err
+}
+
+func (s *Server) handleDeleteBlocks(ctx context.Context, conn net.Conn, n int, refbuf []byte) error {
+	epoch := make([]byte, 8)
+	err := readConnIntoBuffer(conn, epoch)
+	if err != nil {
+		return err
+	}
+	if e := binary.LittleEndian.Uint64(epoch); e != 0 {
+		ctx = torus.WithWriteEpoch(ctx, e)
+	}
+	refs := make([]torus.BlockRef, n)
+	for i := range refs {
+		err = readConnIntoBuffer(conn, refbuf)
+		if err != nil {
+			return err
+		}
+		refs[i] = torus.BlockRefFromBytes(refbuf)
+	}
+	err = errNoDelete
+	if h, ok := s.handler.(DeleteHandler); ok {
+		err = h.DeleteBlocks(ctx, refs)
+	}
+	respheader := headerOk
+	switch err {
+	case nil:
+	case torus.ErrStaleEpoch:
+		respheader = headerStaleEpoch
+	default:
+		clog.Warningf("failed to delete blocks: %v", err)
+		respheader = headerErr
+	}
+	_, err = conn.Write(respheader)
+	return err
+}
+
+func (s *Server) handleDrainHints(ctx context.Context, conn net.Conn) error {
+	peer, err := readPeer(conn)
+	if err != nil {
+		return err
+	}
+	err = errNoHints
+	if h, ok := s.handler.(HintHandler); ok {
+		err = h.DrainHints(ctx, peer)
+	}
 	respheader := headerOk
 	if err != nil {
+		clog.Warningf("failed to drain hints: %v", err)
 		respheader = headerErr
 	}
 	_, err = conn.Write(respheader)
 	return err
 }
 
-func (s *Server) handleRebalanceCheck(conn net.Conn, len int, refbuf []byte) error {
+func (s *Server) handleRebalanceCheck(ctx context.Context, conn net.Conn, len int, refbuf []byte) error {
 	refs := make([]torus.BlockRef, len)
 	for i := 0; i < len; i++ {
 		err := readConnIntoBuffer(conn, refbuf)
@@ -201,7 +508,7 @@ func (s *Server) handleRebalanceCheck(conn net.Conn, len int, refbuf []byte) err
 		}
 		refs[i] = torus.BlockRefFromBytes(refbuf)
 	}
-	bools, err := s.handler.RebalanceCheck(context.TODO(), refs)
+	bools, err := s.handler.RebalanceCheck(ctx, refs)
 	respheader := headerOk
 	if err != nil {
 		clog.Warningf("failed to rebalance check: %v", err)
@@ -95,6 +95,23 @@ func (g *mockBlockGRPC) RebalanceCheck(ctx context.Context, req *models.Rebalanc
 	}, nil
 }
 
+func (g *mockBlockGRPC) Blocks(ctx context.Context, req *models.BlocksRequest) (*models.BlocksResponse, error) {
+	out := &models.BlocksResponse{}
+	for range req.BlockRefs {
+		out.Blocks = append(out.Blocks, &models.BlockResponse{
+			Ok:   true,
+			Data: g.data,
+		})
+	}
+	return out, nil
+}
+
+func (g *mockBlockGRPC) DiscardBlocks(ctx context.Context, req *models.DiscardBlocksRequest) (*models.PutResponse, error) {
+	return &models.PutResponse{
+		Ok: true,
+	}, nil
+}
+
 func makeTestData(size int) []byte {
 	out := make([]byte, size)
 	_, err := rand.Read(out)
@@ -0,0 +1,128 @@
+package distributor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// tokenBucket lets through rate tokens a second, and bursts of up to a
+// second's worth.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate uint64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: now}
+}
+
+// take takes n tokens and returns how long the caller must wait before
+// they'd have been there. Tokens taken ahead of time are owed, so that
+// waiting callers go in the order they came.
+func (b *tokenBucket) take(n float64, now time.Time) time.Duration {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// qosLimiter holds a volume's limits and the token buckets enforcing them.
+type qosLimiter struct {
+	qos  torus.QoS
+	iops *tokenBucket
+	bw   *tokenBucket
+}
+
+func (l *qosLimiter) reset(q torus.QoS, now time.Time) {
+	l.qos = q
+	l.iops, l.bw = nil, nil
+	if q.IOPS != 0 {
+		l.iops = newTokenBucket(q.IOPS, now)
+	}
+	if q.Bandwidth != 0 {
+		l.bw = newTokenBucket(q.Bandwidth, now)
+	}
+}
+
+// take returns how long a request for size bytes must wait.
+func (l *qosLimiter) take(size uint64, now time.Time) time.Duration {
+	var wait time.Duration
+	if l.iops != nil {
+		wait = l.iops.take(1, now)
+	}
+	if l.bw != nil {
+		if w := l.bw.take(float64(size), now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+type qosState struct {
+	mut      sync.Mutex
+	limiters map[torus.VolumeID]*qosLimiter
+}
+
+// volumeQoS returns the limiter of the volume, or nil if it isn't limited.
+// qos.mut must be held.
+func (d *Distributor) volumeQoS(vid torus.VolumeID, now time.Time) *qosLimiter {
+	qmds, ok := d.srv.MDS.(torus.QoSMetadataService)
+	if !ok {
+		return nil
+	}
+	l, ok := d.qos.limiters[vid]
+	if !ok {
+		l = &qosLimiter{}
+		d.qos.limiters[vid] = l
+	}
+	q, _ := d.policies.get(vid, policyQoS, func(old interface{}) (interface{}, error) {
+		q, err := qmds.GetQoS(vid)
+		if err != nil {
+			clog.Errorf("couldn't get QoS limits for volume %d: %v", vid, err)
+			q = l.qos
+		}
+		return q, nil
+	})
+	if q := q.(torus.QoS); q != l.qos {
+		l.reset(q, now)
+	}
+	if l.qos.IsUnlimited() {
+		return nil
+	}
+	return l
+}
+
+// waitQoS holds a client's block request back until it fits within its
+// volume's QoS limits.
+func (d *Distributor) waitQoS(ctx context.Context, vid torus.VolumeID) error {
+	now := time.Now()
+	d.qos.mut.Lock()
+	var wait time.Duration
+	if l := d.volumeQoS(vid, now); l != nil {
+		wait = l.take(d.blocks.BlockSize(), now)
+	}
+	d.qos.mut.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	promDistQoSThrottled.Inc()
+	promDistQoSDelay.Add(wait.Seconds())
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
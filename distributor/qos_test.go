@@ -0,0 +1,42 @@
+package distributor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+)
+
+func TestQoSLimiter(t *testing.T) {
+	srv := newServer(temp.NewServer())
+	defer srv.Close()
+	d := &Distributor{srv: srv, qos: qosState{limiters: make(map[torus.VolumeID]*qosLimiter)}}
+	now := time.Now()
+	if l := d.volumeQoS(1, now); l != nil {
+		t.Fatal("expected no limiter for a volume without limits")
+	}
+	srv.MDS.(torus.QoSMetadataService).SetQoS(1, torus.QoS{IOPS: 100, Bandwidth: 1000})
+	d.policies.invalidate(1)
+	l := d.volumeQoS(1, now)
+	if l == nil {
+		t.Fatal("expected a limiter once limits are set")
+	}
+
+	// A second's worth goes through at once.
+	for i := 0; i < 10; i++ {
+		if wait := l.take(100, now); wait != 0 {
+			t.Fatalf("request %d waited %s within the burst", i, wait)
+		}
+	}
+	// Then the bandwidth limit holds requests back, in the order they came.
+	if wait := l.take(100, now); wait != 100*time.Millisecond {
+		t.Fatalf("expected a 100ms wait, got %s", wait)
+	}
+	if wait := l.take(100, now); wait != 200*time.Millisecond {
+		t.Fatalf("expected a 200ms wait, got %s", wait)
+	}
+	if wait := l.take(0, now.Add(time.Second)); wait != 0 {
+		t.Fatalf("expected tokens to refill, waited %s", wait)
+	}
+}
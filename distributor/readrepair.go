@@ -0,0 +1,167 @@
+package distributor
+
+import (
+	"hash/crc32"
+	"math/rand"
+	"sync"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+var readRepairTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (d *Distributor) readRepairPolicy(vid torus.VolumeID) torus.ReadRepairPolicy {
+	rmds, ok := d.srv.MDS.(torus.ReadRepairMetadataService)
+	if !ok {
+		return torus.ReadRepairOff
+	}
+	p, _ := d.policies.get(vid, policyReadRepair, func(old interface{}) (interface{}, error) {
+		p, err := rmds.GetReadRepair(vid)
+		if err != nil {
+			clog.Errorf("couldn't get read repair policy for volume %d: %v", vid, err)
+			p, _ = old.(torus.ReadRepairPolicy)
+		}
+		return p, nil
+	})
+	return p.(torus.ReadRepairPolicy)
+}
+
+func (d *Distributor) shouldReadRepair(vid torus.VolumeID) bool {
+	switch d.readRepairPolicy(vid) {
+	case torus.ReadRepairAlways:
+		return true
+	case torus.ReadRepairSampled:
+		return rand.Intn(100) == 0
+	}
+	return false
+}
+
+type replicaCopy struct {
+	peer string
+	data []byte
+	sum  uint32
+	err  error
+}
+
+// readReplica reads peer's copy of a block. A replica that doesn't have it
+// answers ErrBlockUnavailable, and one whose copy is corrupt
+// ErrBlockCorrupt, whether it's this peer or another.
+func (d *Distributor) readReplica(ctx context.Context, p string, i torus.BlockRef) replicaCopy {
+	c := replicaCopy{peer: p}
+	if p == d.UUID() {
+		c.data, c.err = d.blocks.GetBlock(ctx, i)
+		if c.err == torus.ErrBlockNotExist {
+			c.err = torus.ErrBlockUnavailable
+		}
+	} else {
+		getctx, cancel := context.WithTimeout(ctx, clientTimeout)
+		c.data, c.err = d.client.GetBlock(getctx, p, i)
+		cancel()
+	}
+	if c.err == nil {
+		c.sum = crc32.Checksum(c.data, readRepairTable)
+	}
+	return c
+}
+
+// readRepair reads a block from all of its replicas and returns the copy most
+// of them agree on. Replicas that are missing the block or hold a different
+// copy are given the agreed one.
+func (d *Distributor) readRepair(ctx context.Context, i torus.BlockRef, peers torus.PeerPermutation) ([]byte, error) {
+	promDistReadRepairChecks.Inc()
+	replicas := peers.Replicas()
+	copies := make([]replicaCopy, len(replicas))
+	var wg sync.WaitGroup
+	for n, p := range replicas {
+		wg.Add(1)
+		go func(n int, p string) {
+			defer wg.Done()
+			copies[n] = d.readReplica(ctx, p, i)
+		}(n, p)
+	}
+	wg.Wait()
+
+	votes := make(map[uint32]int)
+	best := -1
+	for n, c := range copies {
+		if c.err != nil {
+			continue
+		}
+		votes[c.sum]++
+		if best == -1 || votes[c.sum] > votes[copies[best].sum] {
+			best = n
+		}
+	}
+	if best == -1 {
+		return nil, ErrNoPeersBlock
+	}
+	good := copies[best]
+	for sum, n := range votes {
+		if sum != good.sum && n >= votes[good.sum] {
+			// Without a majority there's no telling which copy is right.
+			clog.Errorf("replicas of block %s disagree with no majority; not repairing", i)
+			return good.data, nil
+		}
+	}
+	d.repairCopies(ctx, i, good, copies)
+	return good.data, nil
+}
+
+// repairCopies gives the replicas whose copies are missing, corrupt or differ
+// from good the good one.
+func (d *Distributor) repairCopies(ctx context.Context, i torus.BlockRef, good replicaCopy, copies []replicaCopy) {
+	for _, c := range copies {
+		var replace bool
+		switch {
+		case c.err == nil && c.sum != good.sum:
+			replace = true
+		case c.err == torus.ErrBlockCorrupt:
+			replace = true
+		case c.err == torus.ErrBlockUnavailable && c.peer == d.UUID():
+			replace = false
+		case c.err == torus.ErrBlockUnavailable:
+			// Another peer answers the same whatever went wrong, and a
+			// plain write wouldn't replace a copy it has but couldn't read.
+			checkctx, cancel := context.WithTimeout(ctx, clientTimeout)
+			has, err := d.client.Check(checkctx, c.peer, []torus.BlockRef{i})
+			cancel()
+			if err != nil || len(has) != 1 {
+				continue
+			}
+			replace = has[0]
+		default:
+			continue
+		}
+		err := d.repairReplica(ctx, c.peer, i, good.data, replace)
+		if err != nil {
+			clog.Warningf("couldn't repair block %s on %s: %v", i, c.peer, err)
+			continue
+		}
+		promDistReadRepairFixes.Inc()
+		clog.Noticef("read repair: rewrote block %s on %s", i, c.peer)
+	}
+}
+
+// repairReplica writes data to peer's copy of the block, replacing whatever
+// is there if replace is set.
+func (d *Distributor) repairReplica(ctx context.Context, peer string, i torus.BlockRef, data []byte, replace bool) error {
+	if peer != d.UUID() {
+		ctx, err := d.copyContext(ctx, i.Volume())
+		if err != nil {
+			return err
+		}
+		if replace {
+			return d.client.RepairBlock(ctx, peer, i, data)
+		}
+		return d.client.PutBlock(ctx, peer, i, data)
+	}
+	if replace {
+		d.forgetLocalBlock(i)
+		err := d.blocks.DeleteBlock(ctx, i)
+		if err != nil && err != torus.ErrBlockNotExist {
+			return err
+		}
+	}
+	return d.blocks.WriteBlock(ctx, i, data)
+}
@@ -0,0 +1,162 @@
+package distributor
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"golang.org/x/net/context"
+)
+
+func TestReadRepairCorrupt(t *testing.T) {
+	for i, scheme := range []string{"http", "tdp"} {
+		testReadRepairCorrupt(t, scheme, 40020+10*i)
+	}
+}
+
+func testReadRepairCorrupt(t *testing.T, scheme string, port int) {
+	md := temp.NewServer()
+	defer md.Close()
+	var srvs []*torus.Server
+	for i := 0; i < 3; i++ {
+		srv := newServer(md)
+		uri, err := url.Parse(fmt.Sprintf("%s://127.0.0.1:%d", scheme, port+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ListenReplication(srv, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srvs = append(srvs, srv)
+	}
+	defer closeAll(t, srvs...)
+	time.Sleep(10 * time.Millisecond)
+	srvs[0].UpdatePeerMap()
+
+	ctx := context.TODO()
+	ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	good := bytes.Repeat([]byte{7}, int(srvs[0].Blocks.BlockSize()))
+	var ds []*Distributor
+	var uuids torus.PeerList
+	for _, srv := range srvs {
+		d := srv.Blocks.(*Distributor)
+		if err := d.blocks.WriteBlock(ctx, ref, good); err != nil {
+			t.Fatal(err)
+		}
+		ds = append(ds, d)
+		uuids = append(uuids, srv.MDS.UUID())
+	}
+	// Corrupt the reader's own copy and one other peer's, underneath their
+	// checksums.
+	for _, d := range ds[:2] {
+		data, err := d.blocks.GetBlock(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[0] ^= 0xff
+		if _, err := d.blocks.GetBlock(ctx, ref); err != torus.ErrBlockCorrupt {
+			t.Fatalf("expected a corrupt copy, got %v", err)
+		}
+	}
+	if _, err := ds[0].client.GetBlock(ctx, uuids[1], ref); err != torus.ErrBlockCorrupt {
+		t.Fatalf("%s: expected ErrBlockCorrupt reading a corrupt remote copy, got %v", scheme, err)
+	}
+
+	data, err := ds[0].readRepair(ctx, ref, torus.PeerPermutation{Peers: uuids, Replication: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, good) {
+		t.Fatalf("%s: read repair returned the wrong copy", scheme)
+	}
+	for i, d := range ds {
+		// Reading the corrupt remote copy also set off a repair of it in
+		// the background; let that finish.
+		for {
+			d.fixMut.Lock()
+			fixing := d.fixing[ref]
+			d.fixMut.Unlock()
+			if !fixing {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		data, err := d.blocks.GetBlock(ctx, ref)
+		if err != nil {
+			t.Fatalf("%s: peer %d: %v", scheme, i, err)
+		}
+		if !bytes.Equal(data, good) {
+			t.Errorf("%s: expected peer %d's copy to be rewritten", scheme, i)
+		}
+	}
+}
+
+func TestRepairBlockFenced(t *testing.T) {
+	for i, scheme := range []string{"http", "tdp"} {
+		testRepairBlockFenced(t, scheme, 40050+10*i)
+	}
+}
+
+func testRepairBlockFenced(t *testing.T, scheme string, port int) {
+	md := temp.NewServer()
+	defer md.Close()
+	var srvs []*torus.Server
+	for i := 0; i < 2; i++ {
+		srv := newServer(md)
+		uri, err := url.Parse(fmt.Sprintf("%s://127.0.0.1:%d", scheme, port+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ListenReplication(srv, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srvs = append(srvs, srv)
+	}
+	defer closeAll(t, srvs...)
+	time.Sleep(10 * time.Millisecond)
+	srvs[0].UpdatePeerMap()
+
+	// The volume has since been attached at epoch 7.
+	peer := srvs[1].Blocks.(*Distributor)
+	peer.fence = torus.NewFenceWithLookup(func(vol torus.VolumeID) (uint64, error) {
+		return 7, nil
+	})
+	ctx := context.TODO()
+	ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	old := bytes.Repeat([]byte{5}, int(srvs[0].Blocks.BlockSize()))
+	good := bytes.Repeat([]byte{7}, int(srvs[0].Blocks.BlockSize()))
+	if err := peer.blocks.WriteBlock(ctx, ref, good); err != nil {
+		t.Fatal(err)
+	}
+	d := srvs[0].Blocks.(*Distributor)
+	uuid := srvs[1].MDS.UUID()
+	if err := d.client.RepairBlock(torus.WithWriteEpoch(ctx, 5), uuid, ref, old); err != torus.ErrStaleEpoch {
+		t.Fatalf("%s: expected ErrStaleEpoch repairing from a stale attachment, got %v", scheme, err)
+	}
+	if err := d.client.RepairBlock(ctx, uuid, ref, old); err != torus.ErrStaleEpoch {
+		t.Fatalf("%s: expected ErrStaleEpoch repairing with no epoch, got %v", scheme, err)
+	}
+	data, err := peer.blocks.GetBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, good) {
+		t.Fatalf("%s: a fenced repair replaced the block", scheme)
+	}
+	if err := d.client.RepairBlock(torus.WithWriteEpoch(ctx, 7), uuid, ref, old); err != nil {
+		t.Fatalf("%s: %v", scheme, err)
+	}
+	data, err = peer.blocks.GetBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, old) {
+		t.Fatalf("%s: expected the repair to replace the block", scheme)
+	}
+}
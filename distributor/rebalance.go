@@ -32,7 +32,10 @@ exit:
 				}
 				d.mut.Lock()
 				d.ring = newring
+				d.setProposed(nil)
 				d.mut.Unlock()
+				promDistRingVersion.Set(float64(newring.Version()))
+				d.readCache.SetRing(newring.Version())
 			} else {
 				break exit
 			}
@@ -40,56 +43,172 @@ exit:
 	}
 }
 
+// How often peers look for a proposed ring to acknowledge.
+var ringProposalPoll = time.Second
+
+// ringPreparer acknowledges proposed rings, so that they can be committed.
+// Before it does, it waits for every block request this peer began against
+// the current ring to finish; requests after that place blocks by both
+// rings until the proposed one is committed or abandoned.
+func (d *Distributor) ringPreparer(closer chan struct{}) {
+	rc, ok := d.srv.MDS.(torus.RingChangeMetadataService)
+	if !ok {
+		return
+	}
+	acked := 0
+	for {
+		select {
+		case <-closer:
+			return
+		case <-time.After(ringProposalPoll):
+		}
+		r, err := rc.GetProposedRing()
+		if err != nil {
+			clog.Warningf("couldn't get proposed ring: %v", err)
+			continue
+		}
+		if r == nil {
+			// Abandoned or committed; a ring proposed again under the
+			// same version needs acknowledging again.
+			acked = 0
+			d.dropAbandonedRing()
+			continue
+		}
+		d.mut.RLock()
+		current := d.ring.Version()
+		d.mut.RUnlock()
+		if r.Version() == acked || r.Version() != current+1 {
+			continue
+		}
+		// Block requests hold d.mut for reading until they're done, so
+		// taking it for writing waits them out.
+		start := time.Now()
+		d.mut.Lock()
+		if d.ring.Version()+1 == r.Version() {
+			d.setProposed(r)
+		}
+		d.mut.Unlock()
+		err = rc.AckRing(r.Version(), d.UUID())
+		if err != nil {
+			clog.Warningf("couldn't acknowledge proposed ring %d: %v", r.Version(), err)
+			continue
+		}
+		acked = r.Version()
+		promDistRingAcks.Inc()
+		clog.Infof("acknowledged proposed ring %d after %s draining requests", r.Version(), time.Since(start))
+	}
+}
+
+func (d *Distributor) setProposed(r torus.Ring) {
+	d.propMut.Lock()
+	d.proposed = r
+	d.propMut.Unlock()
+}
+
+// dropAbandonedRing stops placing blocks by the ring this peer acknowledged
+// once it's no longer proposed, unless it was committed, in which case the
+// ring watcher takes it up.
+func (d *Distributor) dropAbandonedRing() {
+	d.propMut.RLock()
+	p := d.proposed
+	d.propMut.RUnlock()
+	if p == nil {
+		return
+	}
+	cur, err := d.srv.MDS.GetRing()
+	if err != nil {
+		clog.Warningf("couldn't get ring: %v", err)
+		return
+	}
+	if cur.Version() >= p.Version() {
+		return
+	}
+	d.propMut.Lock()
+	if d.proposed == p {
+		d.proposed = nil
+		clog.Infof("proposed ring %d was abandoned; placing blocks by ring %d alone", p.Version(), p.Version()-1)
+	}
+	d.propMut.Unlock()
+}
+
 func (d *Distributor) rebalanceTicker(closer chan struct{}) {
 	n := 0
 	total := 0
 	time.Sleep(time.Duration(250+rand.Intn(250)) * time.Millisecond)
 exit:
 	for {
-		clog.Tracef("starting rebalance/gc cycle")
+		clog.Tracef("starting rebalance cycle")
 		volset, _, err := d.srv.MDS.GetVolumes()
 		if err != nil {
 			clog.Error(err)
 		}
-		for _, x := range volset {
-			err := d.rebalancer.PrepVolume(x)
-			if err != nil {
-				clog.Errorf("gc prep for %s failed: %s", x.Name, err)
-			}
-		}
+		d.refreshConversions(volset)
+		d.refreshMigrations(volset)
+		passStart := time.Now()
 	ratelimit:
 		for {
-			timeout := 2 * time.Duration(n+1) * time.Millisecond
+			timeout := d.rebalanceWait(n)
 			select {
 			case <-closer:
 				break exit
 			case <-time.After(timeout):
+				d.pollEmergencies()
+				d.setGCPreempted(d.preempted())
+				d.pollDepartures()
+				d.pollDraining()
+				d.pollFailures()
+				recovered := d.recoveryTick()
+				d.updateThrottle()
+				if d.preempted() {
+					clog.Debugf("rebalance preempted by emergency repair on another peer")
+					n = recovered
+					continue
+				}
 				written, err := d.rebalancer.Tick()
+				d.updateEmergency(err == io.EOF)
+				d.saveRebalanceCheckpoint(err == io.EOF)
 				if d.ring.Version() != d.rebalancer.VersionStart() {
 					// Something is changed -- we are now rebalancing
 					d.rebalancing = true
 				}
+				if d.ring.Version() != d.settledVersion {
+					d.beginTransition()
+				}
+				if d.transition != nil {
+					d.transition.sent(written, d.blocks.BlockSize())
+				}
 				info := &models.RebalanceInfo{
 					Rebalancing: d.rebalancing,
 				}
 				total += written
 				info.LastRebalanceBlocks = uint64(total)
+				d.passProgress(info, err == io.EOF)
+				promDistRebalancePassBlocks.Set(float64(total))
 				if err == io.EOF {
 					// Good job, sleep well, I'll most likely rebalance you in the morning.
 					info.LastRebalanceFinish = time.Now().UnixNano()
 					total = 0
+					if d.transition != nil {
+						d.transition.passDone(d.rebalancer.VolumeStats())
+					}
 					finishver := d.rebalancer.VersionStart()
 					if finishver == d.ring.Version() {
 						d.rebalancing = false
 						info.Rebalancing = false
+						d.finishTransition()
+						d.settledVersion = finishver
 					}
+					d.reportConversions()
+					d.reportMigrations(passStart)
+					setRebalancing(d.rebalancing)
 					d.srv.UpdateRebalanceInfo(info)
 					break ratelimit
 				} else if err != nil {
 					// This is usually really bad
 					clog.Error(err)
 				}
-				n = written
+				n = written + recovered
+				setRebalancing(d.rebalancing)
 				d.srv.UpdateRebalanceInfo(info)
 			}
 		}
@@ -97,3 +216,31 @@ exit:
 		d.rebalancer.Reset()
 	}
 }
+
+// passProgress reports how far the current pass has got, and how many
+// under-replicated blocks there are. Until a pass has counted more of them
+// than the last complete one, the last complete one's count stands.
+func (d *Distributor) passProgress(info *models.RebalanceInfo, passDone bool) {
+	checked, blocks := d.rebalancer.Progress()
+	info.PassCheckedBlocks = uint64(checked)
+	info.PassBlocks = uint64(blocks)
+	var under uint64
+	for _, st := range d.rebalancer.VolumeStats() {
+		under += st.UnderReplicated
+	}
+	if passDone {
+		d.underReplicated = under
+	}
+	if under < d.underReplicated {
+		under = d.underReplicated
+	}
+	info.UnderReplicatedBlocks = under
+}
+
+func setRebalancing(on bool) {
+	if on {
+		promDistRebalancing.Set(1)
+	} else {
+		promDistRebalancing.Set(0)
+	}
+}
@@ -0,0 +1,24 @@
+package rebalance
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	promPassBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_rebalance_pass_blocks",
+		Help: "Local blocks the current rebalance pass has to go through",
+	})
+	promPassChecked = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_rebalance_pass_checked_blocks",
+		Help: "Local blocks the current rebalance pass has gone through so far",
+	})
+	promDeletedBlocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_rebalance_deleted_blocks_total",
+		Help: "Local blocks deleted because they belong on other peers, which have them",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promPassBlocks)
+	prometheus.MustRegister(promPassChecked)
+	prometheus.MustRegister(promDeletedBlocks)
+}
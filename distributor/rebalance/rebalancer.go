@@ -7,7 +7,6 @@ import (
 	"github.com/coreos/pkg/capnslog"
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/gc"
-	"github.com/coreos/torus/models"
 	"golang.org/x/net/context"
 )
 
@@ -18,11 +17,41 @@ type Ringer interface {
 	UUID() string
 }
 
+// Departer is implemented by Ringers that know which peers have left on
+// purpose and are expected back with their blocks.
+type Departer interface {
+	Departed(peer string) bool
+}
+
 type Rebalancer interface {
 	Tick() (int, error)
 	VersionStart() int
-	PrepVolume(*models.Volume) error
 	Reset() error
+	// VolumeStats returns what the current pass has done so far, by volume.
+	VolumeStats() map[torus.VolumeID]VolumeStats
+	// Position returns the ring version the current pass is placing blocks
+	// by, and the last block it has finished with. ok is false if the pass
+	// hasn't finished with any.
+	Position() (version int, last torus.BlockRef, ok bool)
+	// ResumeAfter makes the next pass skip every block up to and including
+	// last, which an earlier run has finished with, as long as the ring is
+	// still at version.
+	ResumeAfter(version int, last torus.BlockRef)
+	// Progress returns how many of the local blocks listed for the current
+	// pass it has checked so far.
+	Progress() (checked, total int)
+}
+
+// VolumeStats counts what a rebalance pass did with one volume's local blocks.
+type VolumeStats struct {
+	Blocks uint64
+	Sent   uint64
+	Failed uint64
+	// Critical counts blocks for which no other desired peer had a copy.
+	Critical uint64
+	// UnderReplicated counts blocks with fewer live copies than desired,
+	// including the critical ones.
+	UnderReplicated uint64
 }
 
 type CheckAndSender interface {
@@ -30,12 +59,41 @@ type CheckAndSender interface {
 	PutBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error
 }
 
+// BlockStreamer is implemented by CheckAndSenders that can send many blocks
+// to a peer in one stream.
+type BlockStreamer interface {
+	// StreamBlocks sends the blocks of refs to peer, reading each with get
+	// just before it's sent, and returns the error for each block, nil for
+	// those sent. It returns torus.ErrNotSupported, having sent nothing, if
+	// the peer can't take a stream.
+	StreamBlocks(ctx context.Context, peer string, refs []torus.BlockRef, get func(torus.BlockRef) ([]byte, error)) ([]error, error)
+}
+
 func NewRebalancer(r Ringer, bs torus.BlockStore, cs CheckAndSender, gc gc.GC) Rebalancer {
 	return &rebalancer{
 		r:  r,
 		bs: bs,
 		cs: cs,
 		gc: gc,
+
+		stats: make(map[torus.VolumeID]*VolumeStats),
+	}
+}
+
+// NewRecoverer returns a Rebalancer that copies local blocks to the peers the
+// ring wants them on, but never deletes any, for re-replicating the blocks of
+// failed peers by a ring without them. Blocks for which skip returns true
+// are passed over.
+func NewRecoverer(r Ringer, bs torus.BlockStore, cs CheckAndSender, skip func(torus.BlockRef) bool) Rebalancer {
+	return &rebalancer{
+		r:        r,
+		bs:       bs,
+		cs:       cs,
+		gc:       &gc.NullGC{},
+		copyOnly: true,
+		skip:     skip,
+
+		stats: make(map[torus.VolumeID]*VolumeStats),
 	}
 }
 
@@ -43,9 +101,18 @@ type rebalancer struct {
 	r    Ringer
 	bs   torus.BlockStore
 	cs   CheckAndSender
-	it   torus.BlockIterator
 	gc   gc.GC
 	ring torus.Ring
+
+	copyOnly bool
+	skip     func(torus.BlockRef) bool
+
+	// The blocks of the current pass, and how far it has got.
+	refs   []torus.BlockRef
+	pos    int
+	resume *resumePoint
+
+	stats map[torus.VolumeID]*VolumeStats
 }
 
 func (r *rebalancer) VersionStart() int {
@@ -55,15 +122,47 @@ func (r *rebalancer) VersionStart() int {
 	return r.ring.Version()
 }
 
-func (r *rebalancer) PrepVolume(vol *models.Volume) error {
-	return r.gc.PrepVolume(vol)
-}
-
 func (r *rebalancer) Reset() error {
-	if r.it != nil {
-		r.it.Close()
-		r.it = nil
-	}
+	r.refs = nil
+	r.pos = 0
 	r.gc.Clear()
+	r.stats = make(map[torus.VolumeID]*VolumeStats)
 	return nil
 }
+
+type resumePoint struct {
+	version int
+	after   torus.BlockRef
+}
+
+func (r *rebalancer) Position() (int, torus.BlockRef, bool) {
+	if r.ring == nil || r.pos == 0 {
+		return 0, torus.BlockRef{}, false
+	}
+	return r.ring.Version(), r.refs[r.pos-1], true
+}
+
+func (r *rebalancer) ResumeAfter(version int, last torus.BlockRef) {
+	r.resume = &resumePoint{version: version, after: last}
+}
+
+func (r *rebalancer) Progress() (int, int) {
+	return r.pos, len(r.refs)
+}
+
+func (r *rebalancer) VolumeStats() map[torus.VolumeID]VolumeStats {
+	out := make(map[torus.VolumeID]VolumeStats)
+	for k, v := range r.stats {
+		out[k] = *v
+	}
+	return out
+}
+
+func (r *rebalancer) volumeStats(ref torus.BlockRef) *VolumeStats {
+	s, ok := r.stats[ref.Volume()]
+	if !ok {
+		s = &VolumeStats{}
+		r.stats[ref.Volume()] = s
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package rebalance
+
+import (
+	"io"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/gc"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"golang.org/x/net/context"
+
+	_ "github.com/coreos/torus/storage"
+)
+
+type testRinger struct {
+	r torus.Ring
+}
+
+func (t testRinger) Ring() torus.Ring { return t.r }
+func (t testRinger) UUID() string     { return "me" }
+
+func newTestRebalancer(t *testing.T, nblocks int) (Rebalancer, torus.Ring) {
+	r, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Single),
+		Peers:             []*models.PeerInfo{{UUID: "me"}},
+		ReplicationFactor: 1,
+		Version:           3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := torus.CreateBlockStore("temp", "test", torus.Config{StorageSize: 1024 * 1024}, torus.GlobalMetadata{BlockSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < nblocks; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		err := bs.WriteBlock(context.TODO(), ref, make([]byte, 256))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewRebalancer(testRinger{r}, bs, nil, &gc.NullGC{}), r
+}
+
+func TestRebalanceResume(t *testing.T) {
+	rb, r := newTestRebalancer(t, 2*maxIters+10)
+	_, err := rb.Tick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, last, ok := rb.Position()
+	if !ok || version != r.Version() {
+		t.Fatalf("expected a position at ring version %d", r.Version())
+	}
+	if last.Index != maxIters-1 {
+		t.Fatalf("expected to have finished with block %d, got %d", maxIters-1, last.Index)
+	}
+	if checked, total := rb.Progress(); checked != maxIters || total != 2*maxIters+10 {
+		t.Fatalf("expected to have checked %d of %d blocks, got %d of %d", maxIters, 2*maxIters+10, checked, total)
+	}
+
+	// A new run picks up after the first tick.
+	rb2, _ := newTestRebalancer(t, 2*maxIters+10)
+	rb2.ResumeAfter(version, last)
+	var err2 error
+	for err2 == nil {
+		_, err2 = rb2.Tick()
+	}
+	if err2 != io.EOF {
+		t.Fatal(err2)
+	}
+	if n := rb2.VolumeStats()[1].Blocks; n != maxIters+10 {
+		t.Errorf("expected the resumed pass to go over %d blocks, got %d", maxIters+10, n)
+	}
+
+	// A checkpoint for another ring is ignored.
+	rb3, _ := newTestRebalancer(t, 2*maxIters+10)
+	rb3.ResumeAfter(version-1, last)
+	_, err = rb3.Tick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, last, _ := rb3.Position(); last.Index != maxIters-1 {
+		t.Errorf("expected a fresh pass, got to block %d", last.Index)
+	}
+}
+
+type sendRecorder struct {
+	sent map[torus.BlockRef]string
+}
+
+func (s *sendRecorder) Check(ctx context.Context, peer string, refs []torus.BlockRef) ([]bool, error) {
+	return make([]bool, len(refs)), nil
+}
+
+func (s *sendRecorder) PutBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error {
+	s.sent[ref] = peer
+	return nil
+}
+
+func TestRecovererCopiesOnly(t *testing.T) {
+	r, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Single),
+		Peers:             []*models.PeerInfo{{UUID: "other"}},
+		ReplicationFactor: 1,
+		Version:           3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := torus.CreateBlockStore("temp", "test", torus.Config{StorageSize: 1024 * 1024}, torus.GlobalMetadata{BlockSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const nblocks = 10
+	for i := 0; i < nblocks; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		err := bs.WriteBlock(context.TODO(), ref, make([]byte, 256))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cs := &sendRecorder{sent: make(map[torus.BlockRef]string)}
+	skip := func(ref torus.BlockRef) bool { return ref.Index%2 == 1 }
+	rb := NewRecoverer(testRinger{r}, bs, cs, skip)
+	var err2 error
+	for err2 == nil {
+		_, err2 = rb.Tick()
+	}
+	if err2 != io.EOF {
+		t.Fatal(err2)
+	}
+	if len(cs.sent) != nblocks/2 {
+		t.Fatalf("expected %d blocks to be copied, got %d", nblocks/2, len(cs.sent))
+	}
+	for ref, peer := range cs.sent {
+		if skip(ref) {
+			t.Errorf("expected block %s to be skipped", ref)
+		}
+		if peer != "other" {
+			t.Errorf("expected block %s to be copied to other, got %s", ref, peer)
+		}
+	}
+	// The local copies stay, even though the ring doesn't want them here.
+	for i := 0; i < nblocks; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		if _, err := bs.GetBlock(context.TODO(), ref); err != nil {
+			t.Errorf("expected local block %s to be kept: %v", ref, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package rebalance
 
 import (
 	"io"
+	"sort"
 	"time"
 
 	"golang.org/x/net/context"
@@ -12,32 +13,84 @@ import (
 
 const maxIters = 50
 
+// startPass lists the local blocks for a new pass, in a stable order so that
+// the pass can be resumed from a checkpoint.
+func (r *rebalancer) startPass() error {
+	r.ring = r.r.Ring()
+	it := r.bs.BlockIterator()
+	refs := make([]torus.BlockRef, 0)
+	for it.Next() {
+		refs = append(refs, it.BlockRef())
+	}
+	err := it.Err()
+	it.Close()
+	if err != nil {
+		return err
+	}
+	sort.Sort(byRef(refs))
+	r.refs = refs
+	r.pos = 0
+	if r.resume != nil && r.resume.version == r.ring.Version() {
+		after := r.resume.after
+		r.pos = sort.Search(len(refs), func(i int) bool {
+			return refLess(after, refs[i])
+		})
+		clog.Infof("resuming rebalance for ring %d, skipping %d blocks already done", r.resume.version, r.pos)
+	}
+	r.resume = nil
+	if !r.copyOnly {
+		promPassBlocks.Set(float64(len(refs)))
+		promPassChecked.Set(float64(r.pos))
+	}
+	return nil
+}
+
+func refLess(a, b torus.BlockRef) bool {
+	if a.Volume() != b.Volume() {
+		return a.Volume() < b.Volume()
+	}
+	if a.INode != b.INode {
+		return a.INode < b.INode
+	}
+	return a.Index < b.Index
+}
+
+type byRef []torus.BlockRef
+
+func (b byRef) Len() int           { return len(b) }
+func (b byRef) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byRef) Less(i, j int) bool { return refLess(b[i], b[j]) }
+
 var rebalanceTimeout = 5 * time.Second
 
 func (r *rebalancer) Tick() (int, error) {
-	if r.it == nil {
-		r.it = r.bs.BlockIterator()
-		r.ring = r.r.Ring()
+	if r.refs == nil {
+		err := r.startPass()
+		if err != nil {
+			return 0, err
+		}
 	}
 	m := make(map[string][]torus.BlockRef)
 	toDelete := make(map[torus.BlockRef]bool)
-	dead := make(map[torus.BlockRef]bool)
+	// Live copies of each block we know of, and how many we want.
+	live := make(map[torus.BlockRef]int)
+	wanted := make(map[torus.BlockRef]int)
 	itDone := false
 
 	for i := 0; i < maxIters; i++ {
-		var ref torus.BlockRef
-		ok := r.it.Next()
-		if !ok {
-			err := r.it.Err()
-			if err != nil {
-				return 0, err
-			}
+		if r.pos == len(r.refs) {
 			itDone = true
 			break
 		}
-		ref = r.it.BlockRef()
+		ref := r.refs[r.pos]
+		r.pos++
+		if r.skip != nil && r.skip(ref) {
+			continue
+		}
+		r.volumeStats(ref).Blocks++
 		if r.gc.IsDead(ref) {
-			dead[ref] = true
+			// The garbage collector deletes it; don't spread it around
+			// in the meantime.
 			continue
 		}
 		perm, err := r.ring.GetPeers(ref)
@@ -46,13 +99,15 @@ func (r *rebalancer) Tick() (int, error) {
 		}
 		desired := torus.PeerList(perm.Peers[:perm.Replication])
 		myIndex := desired.IndexAt(r.r.UUID())
+		live[ref] = 1
+		wanted[ref] = len(desired)
 		for j, p := range desired {
 			if j == myIndex {
 				continue
 			}
 			m[p] = append(m[p], ref)
 		}
-		if myIndex == -1 {
+		if myIndex == -1 && !r.copyOnly {
 			toDelete[ref] = true
 		}
 	}
@@ -63,35 +118,45 @@ func (r *rebalancer) Tick() (int, error) {
 		oks, err := r.cs.Check(ctx, k, v)
 		cancel()
 		if err != nil {
+			// A peer that's restarting still has its copies; don't count
+			// them as lost.
+			departed := false
+			if dp, ok := r.r.(Departer); ok {
+				departed = dp.Departed(k)
+			}
 			for _, blk := range v {
 				toDelete[blk] = false
+				r.volumeStats(blk).Failed++
+				if departed {
+					live[blk]++
+				}
 			}
 			if err != torus.ErrNoPeer {
 				clog.Error(err)
 			}
 			continue
 		}
+		for i, ok := range oks {
+			if ok {
+				live[v[i]]++
+			}
+		}
+		var missing []torus.BlockRef
 		for i, ok := range oks {
 			if !ok {
-				data, err := r.bs.GetBlock(context.TODO(), v[i])
-				if err != nil {
-					clog.Warningf("couldn't get local block %s: %v", v[i], err)
-					continue
-				}
-				n++
-				ctx, cancel := context.WithTimeout(context.TODO(), rebalanceTimeout)
-				if torus.BlockLog.LevelAt(capnslog.TRACE) {
-					torus.BlockLog.Tracef("rebalance: sending block %s to %s", v[i], k)
-				}
-				err = r.cs.PutBlock(ctx, k, v[i], data)
-				cancel()
-				if err != nil {
-					// Continue for now
-					toDelete[v[i]] = false
-					clog.Errorf("couldn't rebalance block %s: %v", v[i], err)
-				}
+				missing = append(missing, v[i])
 			}
 		}
+		n += r.send(k, missing, toDelete)
+	}
+
+	for ref, n := range live {
+		if n < wanted[ref] {
+			r.volumeStats(ref).UnderReplicated++
+		}
+		if n <= 1 && wanted[ref] > 1 {
+			r.volumeStats(ref).Critical++
+		}
 	}
 
 	for k, v := range toDelete {
@@ -102,20 +167,14 @@ func (r *rebalancer) Tick() (int, error) {
 			err := r.bs.DeleteBlock(context.TODO(), k)
 			if err != nil {
 				clog.Errorf("couldn't delete replicated local block %s: %v", k, err)
+				continue
 			}
+			promDeletedBlocks.Inc()
 		}
 	}
 
-	for k, v := range dead {
-		if v {
-			if torus.BlockLog.LevelAt(capnslog.TRACE) {
-				torus.BlockLog.Tracef("rebalance: deleting dead block %s", k)
-			}
-			err := r.bs.DeleteBlock(context.TODO(), k)
-			if err != nil {
-				clog.Errorf("couldn't delete dead local block %s: %v", k, err)
-			}
-		}
+	if !r.copyOnly {
+		promPassChecked.Set(float64(r.pos))
 	}
 	err := r.bs.Flush()
 	if err != nil {
@@ -127,3 +186,70 @@ func (r *rebalancer) Tick() (int, error) {
 	}
 	return n, nil
 }
+
+// send copies local blocks to peer, in one stream if the peer can take one,
+// and returns how many it read to send.
+func (r *rebalancer) send(peer string, refs []torus.BlockRef, toDelete map[torus.BlockRef]bool) int {
+	if len(refs) == 0 {
+		return 0
+	}
+	n := 0
+	unread := make(map[torus.BlockRef]bool)
+	get := func(ref torus.BlockRef) ([]byte, error) {
+		data, err := r.bs.GetBlock(context.TODO(), ref)
+		if err != nil {
+			if !unread[ref] {
+				clog.Warningf("couldn't get local block %s: %v", ref, err)
+				r.volumeStats(ref).Failed++
+				unread[ref] = true
+			}
+			return nil, err
+		}
+		n++
+		if torus.BlockLog.LevelAt(capnslog.TRACE) {
+			torus.BlockLog.Tracef("rebalance: sending block %s to %s", ref, peer)
+		}
+		return data, nil
+	}
+	sent := func(ref torus.BlockRef, err error) {
+		if unread[ref] {
+			return
+		}
+		if err != nil {
+			// Continue for now
+			toDelete[ref] = false
+			r.volumeStats(ref).Failed++
+			clog.Errorf("couldn't rebalance block %s: %v", ref, err)
+			return
+		}
+		r.volumeStats(ref).Sent++
+	}
+	// Moving data can wait for clients' I/O.
+	bctx := torus.WithIOClass(context.TODO(), torus.IOClassBatch)
+	if bs, ok := r.cs.(BlockStreamer); ok {
+		ctx, cancel := context.WithTimeout(bctx, time.Duration(len(refs))*rebalanceTimeout)
+		errs, err := bs.StreamBlocks(ctx, peer, refs, get)
+		cancel()
+		if err != torus.ErrNotSupported {
+			for i, ref := range refs {
+				if err == nil {
+					sent(ref, errs[i])
+				} else {
+					sent(ref, err)
+				}
+			}
+			return n
+		}
+	}
+	for _, ref := range refs {
+		data, err := get(ref)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(bctx, rebalanceTimeout)
+		err = r.cs.PutBlock(ctx, peer, ref, data)
+		cancel()
+		sent(ref, err)
+	}
+	return n
+}
@@ -0,0 +1,283 @@
+package distributor
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor/rebalance"
+)
+
+// When a ring member stays down for longer than Cfg.FailureTimeout, the
+// blocks it held are down a replica until an admin takes it out of the ring.
+// Rather than wait, every peer copies its blocks that had a replica on the
+// failed member to wherever a ring without the member would put them. The
+// ring itself is left alone, so a member that comes back just has its blocks
+// again, and the extra copies are cleaned up by rebalancing as usual.
+
+// How often ring members are checked for having failed for good.
+var recoveryPollInterval = 10 * time.Second
+
+type recoveryState struct {
+	lastPoll  time.Time
+	downSince map[string]time.Time
+	// failed are the members that have been down for too long, sorted, as
+	// of ring version.
+	failed  torus.PeerList
+	version int
+	// rebalancer copies blocks by the ring without the failed members. It's
+	// nil when there's nothing to copy.
+	rebalancer rebalance.Rebalancer
+
+	lastSave time.Time
+	saved    bool
+}
+
+// recoveryRinger is the view of the cluster the recovery pass places blocks
+// by: the ring without the failed members.
+type recoveryRinger struct {
+	ring torus.Ring
+	d    *Distributor
+}
+
+func (r recoveryRinger) Ring() torus.Ring {
+	return recoveryRing{r.ring, r.d}
+}
+
+func (r recoveryRinger) UUID() string {
+	return r.d.UUID()
+}
+
+func (r recoveryRinger) Departed(peer string) bool {
+	return r.d.Departed(peer)
+}
+
+// recoveryRing places blocks like redundancyRing, but keeps its placements
+// out of the cache, which is for the real ring.
+type recoveryRing struct {
+	torus.Ring
+	d *Distributor
+}
+
+func (r recoveryRing) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
+	return r.d.placeBlockBy(ringPeers, r.Ring, key)
+}
+
+func ringPeers(r torus.Ring, key torus.BlockRef) (torus.PeerPermutation, error) {
+	return r.GetPeers(key)
+}
+
+// pollFailures looks for ring members that have been down for longer than
+// the failure timeout, at most every recoveryPollInterval, and starts a
+// recovery pass for them.
+func (d *Distributor) pollFailures() {
+	timeout := d.srv.Cfg.FailureTimeout
+	rs := &d.recovery
+	if timeout == 0 || time.Since(rs.lastPoll) < recoveryPollInterval {
+		return
+	}
+	now := time.Now()
+	rs.lastPoll = now
+	if rs.downSince == nil {
+		rs.downSince = make(map[string]time.Time)
+	}
+	d.mut.RLock()
+	r := d.ring
+	d.mut.RUnlock()
+
+	down := make(map[string]bool)
+	var failed torus.PeerList
+	for _, m := range r.Members() {
+		if m == d.UUID() || d.Departed(m) {
+			continue
+		}
+		if !d.srv.PeerDown(m) && d.srv.GetPeer(m) != nil {
+			continue
+		}
+		down[m] = true
+		since, ok := rs.downSince[m]
+		if !ok {
+			rs.downSince[m] = now
+			continue
+		}
+		if now.Sub(since) >= timeout {
+			failed = append(failed, m)
+		}
+	}
+	for m := range rs.downSince {
+		if !down[m] {
+			delete(rs.downSince, m)
+		}
+	}
+	sort.Strings(failed)
+	promDistFailedPeers.Set(float64(len(failed)))
+	if r.Version() == rs.version && samePeers(failed, rs.failed) {
+		return
+	}
+	d.startRecovery(r, failed)
+}
+
+func samePeers(a, b torus.PeerList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// startRecovery begins a pass copying the local blocks that had a replica on
+// a failed member of r, or stops the current one if there are none.
+func (d *Distributor) startRecovery(r torus.Ring, failed torus.PeerList) {
+	rs := &d.recovery
+	if rs.rebalancer != nil && len(failed) < len(rs.failed) {
+		clog.Noticef("failed peers are back; %d peers still failed", len(failed))
+	}
+	rs.version = r.Version()
+	rs.failed = failed
+	rs.rebalancer = nil
+	if len(failed) == 0 {
+		d.saveRecoveryCheckpoint(true)
+		return
+	}
+	rr, ok := r.(torus.RingRemover)
+	if !ok {
+		clog.Errorf("can't re-replicate the blocks of failed peers %v: a %s ring can't remove peers", failed, r.Describe())
+		return
+	}
+	without, err := rr.RemovePeers(failed)
+	if err != nil {
+		clog.Errorf("can't re-replicate the blocks of failed peers %v: %v", failed, err)
+		return
+	}
+	lost := make(map[string]bool)
+	for _, p := range failed {
+		lost[p] = true
+	}
+	skip := func(ref torus.BlockRef) bool {
+		// Only blocks that had a replica on a failed peer need another.
+		perm, err := d.placeBlock(r, ref)
+		if err != nil {
+			return false
+		}
+		for _, p := range perm.Replicas() {
+			if lost[p] {
+				return false
+			}
+		}
+		return true
+	}
+	clog.Warningf("peers %v have been down for more than %s; copying the blocks they held to the peers that take their place", failed, d.srv.Cfg.FailureTimeout)
+	rs.rebalancer = rebalance.NewRecoverer(recoveryRinger{without, d}, d.blocks, rebalanceClient{d.client}, skip)
+	d.resumeRecovery()
+}
+
+// recovering returns whether there's a recovery pass under way.
+func (d *Distributor) recovering() bool {
+	return d.recovery.rebalancer != nil
+}
+
+// recoveryTick moves the recovery pass along, if there is one, and returns
+// how many blocks it sent.
+func (d *Distributor) recoveryTick() int {
+	rs := &d.recovery
+	if rs.rebalancer == nil {
+		return 0
+	}
+	written, err := rs.rebalancer.Tick()
+	promDistRecoveredBlocks.Add(float64(written))
+	if err != io.EOF {
+		if err != nil {
+			clog.Error(err)
+		}
+		d.saveRecoveryCheckpoint(false)
+		return written
+	}
+	var sent, failed uint64
+	for _, st := range rs.rebalancer.VolumeStats() {
+		sent += st.Sent
+		failed += st.Failed
+	}
+	if failed != 0 {
+		// Go over the blocks again until they all make it.
+		clog.Warningf("recovery pass for failed peers %v copied %d blocks, and %d failed; retrying", rs.failed, sent, failed)
+		rs.rebalancer.Reset()
+		return written
+	}
+	clog.Noticef("recovery pass for failed peers %v is done, having copied %d blocks", rs.failed, sent)
+	rs.rebalancer = nil
+	d.saveRecoveryCheckpoint(true)
+	return written
+}
+
+// resumeRecovery picks up the checkpoint left by the last run, if it was
+// for the same ring and failed peers.
+func (d *Distributor) resumeRecovery() {
+	rs := &d.recovery
+	cmds, ok := d.srv.MDS.(torus.RecoveryCheckpointService)
+	if !ok {
+		return
+	}
+	cp, err := cmds.GetRecoveryCheckpoint()
+	if err != nil {
+		clog.Errorf("couldn't get recovery checkpoint: %v", err)
+		return
+	}
+	if cp == nil {
+		return
+	}
+	rs.saved = true
+	if cp.RingVersion != rs.version || !samePeers(cp.Failed, rs.failed) {
+		return
+	}
+	clog.Infof("resuming recovery for failed peers %v", rs.failed)
+	rs.rebalancer.ResumeAfter(rs.rebalancer.VersionStart(), cp.Last)
+}
+
+// saveRecoveryCheckpoint saves how far the recovery pass has got, at most
+// every rebalanceCheckpointInterval, or clears it once the pass is done.
+func (d *Distributor) saveRecoveryCheckpoint(passDone bool) {
+	rs := &d.recovery
+	cmds, ok := d.srv.MDS.(torus.RecoveryCheckpointService)
+	if !ok {
+		return
+	}
+	if passDone {
+		if !rs.saved {
+			return
+		}
+		err := cmds.SaveRecoveryCheckpoint(nil)
+		if err != nil {
+			clog.Errorf("couldn't clear recovery checkpoint: %v", err)
+			return
+		}
+		rs.saved = false
+		return
+	}
+	if time.Since(rs.lastSave) < rebalanceCheckpointInterval {
+		return
+	}
+	_, last, ok := rs.rebalancer.Position()
+	if !ok {
+		return
+	}
+	rs.lastSave = time.Now()
+	err := cmds.SaveRecoveryCheckpoint(&torus.RecoveryCheckpoint{
+		RebalanceCheckpoint: torus.RebalanceCheckpoint{
+			Peer:        d.UUID(),
+			RingVersion: rs.version,
+			Last:        last,
+			Saved:       rs.lastSave.UnixNano(),
+		},
+		Failed: rs.failed,
+	})
+	if err != nil {
+		clog.Errorf("couldn't save recovery checkpoint: %v", err)
+		return
+	}
+	rs.saved = true
+}
@@ -35,6 +35,7 @@ func openReplication(s *torus.Server, addr *url.URL) error {
 	if err != nil {
 		return err
 	}
+	dist.clearDeparture()
 	s.ReplicationOpen = true
 	return nil
 }
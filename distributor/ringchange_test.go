@@ -0,0 +1,138 @@
+package distributor
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+	"golang.org/x/net/context"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWritesWhileRingPrepared(t *testing.T) {
+	md := temp.NewServer()
+	defer md.Close()
+	var srvs []*torus.Server
+	for i := 0; i < 3; i++ {
+		srv := newServer(md)
+		uri, err := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", 40040+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ListenReplication(srv, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srvs = append(srvs, srv)
+	}
+	defer closeAll(t, srvs...)
+	time.Sleep(10 * time.Millisecond)
+
+	peers, err := srvs[0].MDS.GetPeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Mod),
+		Version:           2,
+		ReplicationFactor: 1,
+		Peers:             peers,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := md.SetRing(r); err != nil {
+		t.Fatal(err)
+	}
+	var ds []*Distributor
+	for _, srv := range srvs {
+		d := srv.Blocks.(*Distributor)
+		waitFor(t, "the ring", func() bool { return d.Ring().Version() == 2 })
+		ds = append(ds, d)
+	}
+
+	// Once every peer has acknowledged a ring with every block on every
+	// peer, writes go to both placements, so that nothing written before
+	// the commit is missing from the new one after it.
+	next, err := r.(torus.ModifyableRing).ChangeReplication(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := srvs[0].MDS.(torus.RingChangeMetadataService)
+	if err := rc.ProposeRing(next, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "acknowledgements", func() bool {
+		acks, err := rc.GetRingAcks(next.Version())
+		return err == nil && len(acks) == len(srvs)
+	})
+
+	ctx := context.TODO()
+	data := bytes.Repeat([]byte{3}, int(srvs[0].Blocks.BlockSize()))
+	var refs []torus.BlockRef
+	for i := 1; i <= 10; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		if err := ds[0].WriteBlock(ctx, ref, data); err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+	for i, d := range ds {
+		for _, ref := range refs {
+			if _, err := d.blocks.GetBlock(ctx, ref); err != nil {
+				t.Fatalf("peer %d is missing block %s written while the ring was prepared: %v", i, ref, err)
+			}
+		}
+	}
+
+	if err := rc.CommitRing(next.Version()); err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range ds {
+		waitFor(t, "the committed ring", func() bool { return d.Ring().Version() == next.Version() })
+		d.propMut.RLock()
+		p := d.proposed
+		d.propMut.RUnlock()
+		if p != nil {
+			t.Errorf("peer %d still places blocks by the proposed ring after the commit", i)
+		}
+	}
+
+	// An abandoned proposal goes back to the current ring alone.
+	last, err := next.(torus.ModifyableRing).ChangeReplication(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.ProposeRing(last, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "acknowledgements", func() bool {
+		acks, err := rc.GetRingAcks(last.Version())
+		return err == nil && len(acks) == len(srvs)
+	})
+	if err := rc.AbortRing(last.Version()); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range ds {
+		waitFor(t, "the abandoned ring to be dropped", func() bool {
+			d.propMut.RLock()
+			defer d.propMut.RUnlock()
+			return d.proposed == nil
+		})
+	}
+}
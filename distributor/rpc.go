@@ -1,14 +1,30 @@
 package distributor
 
 import (
+	"io"
+	"time"
+
 	"github.com/coreos/pkg/capnslog"
 	"github.com/coreos/torus"
 	"golang.org/x/net/context"
 )
 
 func (d *Distributor) Block(ctx context.Context, ref torus.BlockRef) ([]byte, error) {
+	defer d.observeForeground(ctx, time.Now())
+	defer d.endServe(d.beginServe(), true)
 	promDistBlockRPCs.Inc()
-	data, err := d.blocks.GetBlock(ctx, ref)
+	if err := d.checkAccess(ctx, ref.Volume(), torus.PermRead); err != nil {
+		promDistBlockRPCFailures.Inc()
+		return nil, err
+	}
+	data, err := d.localBlock(ctx, ref)
+	if err == torus.ErrBlockCorrupt {
+		// Let the reader know to try another replica, and that this copy
+		// needs replacing.
+		promDistBlockRPCFailures.Inc()
+		clog.Warningf("remote asking for corrupt block: %s", ref)
+		return nil, err
+	}
 	if err != nil {
 		promDistBlockRPCFailures.Inc()
 		clog.Warningf("remote asking for non-existent block: %s", ref)
@@ -20,11 +36,67 @@ func (d *Distributor) Block(ctx context.Context, ref torus.BlockRef) ([]byte, er
 	return data, nil
 }
 
+// WriteBlockTo serves a block to a peer by writing it straight from storage
+// to w, when the store can. It returns ErrNotSupported, having written
+// nothing, when the block has to be served by Block instead, as it is when
+// the peer cache is on.
+func (d *Distributor) WriteBlockTo(ctx context.Context, ref torus.BlockRef, w io.Writer) error {
+	bw, ok := d.blocks.(torus.BlockWriterTo)
+	if !ok || d.peerCache != nil {
+		return torus.ErrNotSupported
+	}
+	start := time.Now()
+	if err := d.checkAccess(ctx, ref.Volume(), torus.PermRead); err != nil {
+		promDistBlockRPCs.Inc()
+		promDistBlockRPCFailures.Inc()
+		return err
+	}
+	served := d.beginServe()
+	err := bw.WriteBlockTo(ctx, ref, w)
+	if err == torus.ErrNotSupported {
+		d.endServe(served, false)
+		return err
+	}
+	d.endServe(served, true)
+	d.observeForeground(ctx, start)
+	promDistBlockRPCs.Inc()
+	if err != nil {
+		promDistBlockRPCFailures.Inc()
+		if err == torus.ErrBlockCorrupt {
+			d.readCorrupt(ref)
+		}
+		clog.Warningf("couldn't write block %s to peer: %v", ref, err)
+		return err
+	}
+	promDistBlockZeroCopy.Inc()
+	if torus.BlockLog.LevelAt(capnslog.TRACE) {
+		torus.BlockLog.Tracef("rpc: wrote block %s", ref)
+	}
+	return nil
+}
+
 func (d *Distributor) PutBlock(ctx context.Context, ref torus.BlockRef, data []byte) error {
+	defer d.observeForeground(ctx, time.Now())
+	defer d.endServe(d.beginServe(), false)
 	d.mut.RLock()
 	defer d.mut.RUnlock()
 	promDistPutBlockRPCs.Inc()
-	peers, err := d.ring.GetPeers(ref)
+	if d.isLeaving() {
+		promDistPutBlockRPCFailures.Inc()
+		return torus.ErrLeaving
+	}
+	err := d.checkAccess(ctx, ref.Volume(), torus.PermWrite)
+	if err != nil {
+		promDistPutBlockRPCFailures.Inc()
+		return err
+	}
+	err = d.fence.Check(ref.Volume(), torus.WriteEpoch(ctx))
+	if err != nil {
+		promDistPutBlockRPCFailures.Inc()
+		clog.Warningf("rejecting write to %s: %v", ref, err)
+		return err
+	}
+	peers, err := d.getPeers(ref)
 	if err != nil {
 		promDistPutBlockRPCFailures.Inc()
 		return err
@@ -49,6 +121,111 @@ func (d *Distributor) PutBlock(ctx context.Context, ref torus.BlockRef, data []b
 	return d.Flush()
 }
 
+func (d *Distributor) PutHintedBlock(ctx context.Context, peer string, ref torus.BlockRef, data []byte) error {
+	hl, ok := d.blocks.(torus.HintLog)
+	if !ok {
+		return torus.ErrNotSupported
+	}
+	promDistPutBlockRPCs.Inc()
+	if d.isLeaving() {
+		promDistPutBlockRPCFailures.Inc()
+		return torus.ErrLeaving
+	}
+	err := d.checkAccess(ctx, ref.Volume(), torus.PermWrite)
+	if err != nil {
+		promDistPutBlockRPCFailures.Inc()
+		return err
+	}
+	err = d.blocks.WriteBlock(ctx, ref, data)
+	if err != nil && err != torus.ErrExists {
+		promDistPutBlockRPCFailures.Inc()
+		return err
+	}
+	err = hl.AddHint(peer, ref)
+	if err != nil {
+		promDistPutBlockRPCFailures.Inc()
+		return err
+	}
+	promDistHintsStored.Inc()
+	if torus.BlockLog.LevelAt(capnslog.TRACE) {
+		torus.BlockLog.Tracef("rpc: saving block %s on behalf of %s", ref, peer)
+	}
+	return d.Flush()
+}
+
+func (d *Distributor) DrainHints(ctx context.Context, peer string) error {
+	if _, ok := d.blocks.(torus.HintLog); !ok {
+		return torus.ErrNotSupported
+	}
+	select {
+	case d.drainChan <- peer:
+	default:
+		// A handoff is already queued; the peer will be picked up on a
+		// later pass.
+	}
+	return nil
+}
+
+// DeleteBlocks deletes this peer's copies of blocks a volume has discarded.
+func (d *Distributor) DeleteBlocks(ctx context.Context, refs []torus.BlockRef) error {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	for _, ref := range refs {
+		err := d.checkAccess(ctx, ref.Volume(), torus.PermWrite)
+		if err != nil {
+			return err
+		}
+		err = d.fence.Check(ref.Volume(), torus.WriteEpoch(ctx))
+		if err != nil {
+			clog.Warningf("rejecting discard of %s: %v", ref, err)
+			return err
+		}
+		ok, err := d.blocks.HasBlock(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		d.forgetLocalBlock(ref)
+		d.readCache.Remove(ref)
+		err = d.blocks.DeleteBlock(ctx, ref)
+		if err != nil && err != torus.ErrBlockNotExist {
+			return err
+		}
+		promDistDiscardedBlocks.Inc()
+	}
+	return d.blocks.Flush()
+}
+
+func (d *Distributor) RepairBlock(ctx context.Context, ref torus.BlockRef, data []byte) error {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+	if d.isLeaving() {
+		return torus.ErrLeaving
+	}
+	err := d.checkAccess(ctx, ref.Volume(), torus.PermWrite)
+	if err != nil {
+		return err
+	}
+	err = d.fence.Check(ref.Volume(), torus.WriteEpoch(ctx))
+	if err != nil {
+		clog.Warningf("rejecting repair of %s: %v", ref, err)
+		return err
+	}
+	d.forgetLocalBlock(ref)
+	err = d.blocks.DeleteBlock(ctx, ref)
+	if err != nil && err != torus.ErrBlockNotExist {
+		return err
+	}
+	err = d.blocks.WriteBlock(ctx, ref, data)
+	if err != nil {
+		return err
+	}
+	d.readCache.Put(ref, data)
+	return d.Flush()
+}
+
 func (d *Distributor) RebalanceCheck(ctx context.Context, refs []torus.BlockRef) ([]bool, error) {
 	out := make([]bool, len(refs))
 	for i, x := range refs {
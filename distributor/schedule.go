@@ -0,0 +1,97 @@
+package distributor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+// How many block requests this peer has in flight to any one other peer
+// before further requests wait their turn by I/O class.
+var maxPeerRequests = 32
+
+// peerQueue holds the requests waiting to be made of one peer, by the
+// priority of their I/O class.
+type peerQueue struct {
+	inflight int
+	waiting  [3][]chan struct{}
+}
+
+// peerScheduler limits the block requests in flight to each peer, letting
+// waiting requests go in order of I/O class. A steady stream of more urgent
+// requests can hold back less urgent ones for as long as it lasts; that is
+// the point.
+type peerScheduler struct {
+	mut   sync.Mutex
+	limit int
+	peers map[string]*peerQueue
+}
+
+func newPeerScheduler(limit int) *peerScheduler {
+	return &peerScheduler{
+		limit: limit,
+		peers: make(map[string]*peerQueue),
+	}
+}
+
+// acquire waits for a turn to make a request of peer, at the I/O class of ctx.
+// The returned func must be called once the request is done.
+func (s *peerScheduler) acquire(ctx context.Context, peer string) (func(), error) {
+	class := torus.GetIOClass(ctx)
+	release := func() { s.release(peer) }
+	s.mut.Lock()
+	q, ok := s.peers[peer]
+	if !ok {
+		q = &peerQueue{}
+		s.peers[peer] = q
+	}
+	if q.inflight < s.limit {
+		q.inflight++
+		s.mut.Unlock()
+		promDistPeerQueueWait.WithLabelValues(class.String()).Observe(0)
+		return release, nil
+	}
+	start := time.Now()
+	turn := make(chan struct{})
+	p := class.Priority()
+	q.waiting[p] = append(q.waiting[p], turn)
+	s.mut.Unlock()
+	select {
+	case <-turn:
+		promDistPeerQueueWait.WithLabelValues(class.String()).Observe(time.Since(start).Seconds())
+		return release, nil
+	case <-ctx.Done():
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for i, c := range q.waiting[p] {
+		if c == turn {
+			q.waiting[p] = append(q.waiting[p][:i], q.waiting[p][i+1:]...)
+			return nil, ctx.Err()
+		}
+	}
+	// We were given the turn as we gave up; pass it on.
+	s.releaseLocked(q)
+	return nil, ctx.Err()
+}
+
+func (s *peerScheduler) release(peer string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.releaseLocked(s.peers[peer])
+}
+
+// releaseLocked hands a finished request's turn to the most urgent waiting
+// request, if any.
+func (s *peerScheduler) releaseLocked(q *peerQueue) {
+	for p, w := range q.waiting {
+		if len(w) != 0 {
+			close(w[0])
+			q.waiting[p] = w[1:]
+			return
+		}
+	}
+	q.inflight--
+}
@@ -0,0 +1,75 @@
+package distributor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+func TestPeerSchedulerOrder(t *testing.T) {
+	s := newPeerScheduler(1)
+	release, err := s.acquire(context.TODO(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan torus.IOClass, 2)
+	wait := func(class torus.IOClass) {
+		r, err := s.acquire(torus.WithIOClass(context.TODO(), class), "a")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		order <- class
+		r()
+	}
+	go wait(torus.IOClassBatch)
+	waitQueued(t, s, "a", 1)
+	go wait(torus.IOClassLatency)
+	waitQueued(t, s, "a", 2)
+	release()
+	if c := <-order; c != torus.IOClassLatency {
+		t.Errorf("expected latency class to go first, got %s", c)
+	}
+	if c := <-order; c != torus.IOClassBatch {
+		t.Errorf("expected batch class to go last, got %s", c)
+	}
+}
+
+func TestPeerSchedulerCancel(t *testing.T) {
+	s := newPeerScheduler(1)
+	release, err := s.acquire(context.TODO(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.acquire(ctx, "a")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	release()
+	// The canceled request mustn't have kept its place.
+	release, err = s.acquire(context.TODO(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func waitQueued(t *testing.T, s *peerScheduler, peer string, n int) {
+	for i := 0; i < 100; i++ {
+		s.mut.Lock()
+		queued := 0
+		for _, w := range s.peers[peer].waiting {
+			queued += len(w)
+		}
+		s.mut.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d queued requests", n)
+}
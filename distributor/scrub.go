@@ -0,0 +1,230 @@
+package distributor
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+// How often the scrubber checks for operator commands and reports progress.
+var scrubPollInterval = 10 * time.Second
+
+// How long the scrubber rests after a complete pass before starting another.
+var scrubPassInterval = 24 * time.Hour
+
+type scrubber struct {
+	d        *Distributor
+	verifier torus.BlockVerifier
+	// mds is nil if the metadata service can't coordinate scrubbing, in which
+	// case the scrubber runs on its own schedule.
+	mds      torus.ScrubMetadataService
+	perBlock time.Duration
+
+	status torus.ScrubStatus
+	refs   []torus.BlockRef
+}
+
+func (d *Distributor) newScrubber() *scrubber {
+	rate := d.srv.Cfg.ScrubRate
+	v, ok := d.blocks.(torus.BlockVerifier)
+	if rate == 0 || !ok {
+		return nil
+	}
+	s := &scrubber{
+		d:        d,
+		verifier: v,
+		perBlock: time.Duration(float64(d.blocks.BlockSize()) / float64(rate) * float64(time.Second)),
+		status:   torus.ScrubStatus{Peer: d.UUID()},
+	}
+	s.mds, _ = d.srv.MDS.(torus.ScrubMetadataService)
+	return s
+}
+
+// scrubTicker verifies every local block against its checksum, one block at
+// a time at the configured rate, replacing corrupt blocks with a copy from
+// another replica. Like the garbage collector, it holds off while emergency
+// repair on another peer preempts background work.
+func (d *Distributor) scrubTicker(closer chan struct{}) {
+	s := d.newScrubber()
+	if s == nil {
+		return
+	}
+	time.Sleep(time.Duration(250+rand.Intn(250)) * time.Millisecond)
+	var lastPoll time.Time
+	for {
+		if time.Since(lastPoll) >= scrubPollInterval {
+			lastPoll = time.Now()
+			s.poll()
+		}
+		timeout := s.perBlock
+		if !s.active() {
+			timeout = scrubPollInterval
+		}
+		select {
+		case <-closer:
+			return
+		case <-time.After(timeout):
+			if s.active() {
+				s.step()
+			}
+		}
+	}
+}
+
+// active reports whether the scrubber should verify blocks now: a pass is
+// underway, and it's neither paused nor preempted.
+func (s *scrubber) active() bool {
+	return s.status.Scrubbing && !s.status.Paused && atomic.LoadInt32(&s.d.gcPreempted) == 0
+}
+
+// poll picks up operator commands, starts a pass if one is due, and reports
+// progress.
+func (s *scrubber) poll() {
+	if s.mds != nil {
+		sc, err := s.mds.GetScrubControl()
+		if err != nil {
+			clog.Errorf("couldn't get scrub control: %v", err)
+		} else {
+			s.status.Paused = sc.Paused
+			if sc.Requested > s.status.PassStart {
+				s.start()
+			}
+		}
+	}
+	if !s.status.Scrubbing && time.Since(time.Unix(0, s.status.PassFinish)) >= scrubPassInterval {
+		s.start()
+	}
+	s.report()
+}
+
+func (s *scrubber) report() {
+	if s.mds == nil {
+		return
+	}
+	err := s.mds.SetScrubStatus(s.d.srv.Lease(), &s.status)
+	if err != nil {
+		clog.Errorf("couldn't report scrub status: %v", err)
+	}
+}
+
+func (s *scrubber) start() {
+	it := s.d.blocks.BlockIterator()
+	s.refs = s.refs[:0]
+	for it.Next() {
+		s.refs = append(s.refs, it.BlockRef())
+	}
+	it.Close()
+	s.status.Scrubbing = true
+	s.status.PassStart = time.Now().UnixNano()
+	s.status.Checked = 0
+	s.status.Total = uint64(len(s.refs))
+	clog.Infof("starting scrub of %d blocks", len(s.refs))
+}
+
+// step verifies the next block of the current pass.
+func (s *scrubber) step() {
+	if s.status.Checked >= uint64(len(s.refs)) {
+		s.status.Scrubbing = false
+		s.status.PassFinish = time.Now().UnixNano()
+		s.refs = nil
+		clog.Infof("scrub finished in %s", time.Duration(s.status.PassFinish-s.status.PassStart))
+		s.report()
+		return
+	}
+	ref := s.refs[s.status.Checked]
+	s.status.Checked++
+	promDistScrubbedBlocks.Inc()
+	err := s.verifier.VerifyBlock(context.TODO(), ref)
+	switch err {
+	case nil, torus.ErrBlockNotExist:
+		// Blocks deleted since the pass started don't need checking.
+	case torus.ErrBlockCorrupt:
+		s.corrupt(ref)
+	default:
+		clog.Warningf("couldn't scrub block %s: %v", ref, err)
+	}
+}
+
+func (s *scrubber) corrupt(ref torus.BlockRef) {
+	promDistScrubCorrupt.Inc()
+	s.status.Corrupt++
+	if s.d.fixCorrupt(ref) {
+		promDistScrubRepaired.Inc()
+		s.status.Repaired++
+	}
+}
+
+// readCorrupt repairs a local block a read found to be corrupt, in the
+// background, unless a repair of it is already underway.
+func (d *Distributor) readCorrupt(ref torus.BlockRef) {
+	promDistReadCorrupt.Inc()
+	d.fixMut.Lock()
+	defer d.fixMut.Unlock()
+	if d.fixing == nil {
+		d.fixing = make(map[torus.BlockRef]bool)
+	}
+	if d.fixing[ref] {
+		return
+	}
+	d.fixing[ref] = true
+	go func() {
+		d.fixCorrupt(ref)
+		d.fixMut.Lock()
+		delete(d.fixing, ref)
+		d.fixMut.Unlock()
+	}()
+}
+
+// fixCorrupt replaces a corrupt local block and reports it to the metadata
+// service, returning whether it was replaced.
+func (d *Distributor) fixCorrupt(ref torus.BlockRef) bool {
+	b := torus.CorruptBlock{
+		Peer:  d.UUID(),
+		Ref:   ref,
+		Found: time.Now().UnixNano(),
+	}
+	err := d.repairCorrupt(ref)
+	if err != nil {
+		clog.Errorf("block %s is corrupt and couldn't be repaired: %v", ref, err)
+	} else {
+		clog.Noticef("block %s was corrupt; replaced it with a copy from another replica", ref)
+		b.Repaired = true
+	}
+	if smd, ok := d.srv.MDS.(torus.ScrubMetadataService); ok {
+		err = smd.ReportCorruptBlock(b)
+		if err != nil {
+			clog.Errorf("couldn't report corrupt block %s: %v", ref, err)
+		}
+	}
+	return b.Repaired
+}
+
+// repairCorrupt replaces the local copy of a block with one from another
+// replica. The corrupt copy stays if no other replica has the block.
+func (d *Distributor) repairCorrupt(ref torus.BlockRef) error {
+	peers, err := d.getPeers(ref)
+	if err != nil {
+		return err
+	}
+	for _, p := range peers.Replicas() {
+		if p == d.UUID() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.TODO(), clientTimeout)
+		data, err := d.client.GetBlock(ctx, p, ref)
+		cancel()
+		if err != nil {
+			continue
+		}
+		err = d.repairReplica(context.TODO(), d.UUID(), ref, data, true)
+		if err != nil {
+			return err
+		}
+		return d.blocks.Flush()
+	}
+	return ErrNoPeersBlock
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
 	"golang.org/x/net/context"
 )
 
@@ -14,15 +16,25 @@ var (
 )
 
 func (d *Distributor) GetBlock(ctx context.Context, i torus.BlockRef) ([]byte, error) {
+	ctx, span := torus.StartSpan(ctx, "Distributor.GetBlock", torus.AttrBlock.String(i.String()))
+	data, err := d.getBlock(ctx, i)
+	torus.EndSpan(span, err)
+	return data, err
+}
+
+func (d *Distributor) getBlock(ctx context.Context, i torus.BlockRef) ([]byte, error) {
+	defer d.observeForeground(ctx, time.Now())
+	defer observeLatency("read", time.Now())
+	if err := d.waitQoS(ctx, i.Volume()); err != nil {
+		return nil, err
+	}
 	d.mut.RLock()
 	defer d.mut.RUnlock()
 	promDistBlockRequests.Inc()
-	bcache, ok := d.readCache.Get(string(i.ToBytes()))
-	if ok {
-		promDistBlockCacheHits.Inc()
-		return bcache.([]byte), nil
+	if blk, ok := d.readCache.Get(i); ok {
+		return blk, nil
 	}
-	peers, err := d.ring.GetPeers(i)
+	peers, err := d.getPeers(i)
 	if err != nil {
 		promDistBlockFailures.Inc()
 		return nil, err
@@ -31,10 +43,32 @@ func (d *Distributor) GetBlock(ctx context.Context, i torus.BlockRef) ([]byte, e
 		promDistBlockFailures.Inc()
 		return nil, ErrNoPeersBlock
 	}
-	writeLevel := d.getWriteFromServer()
+	readLevel := d.readLevel(ctx, i.Volume())
+	if readLevel == torus.ReadQuorum {
+		// A majority is of all the replicas, down or not.
+		blk, err := d.readQuorum(ctx, i, peers)
+		if err != nil {
+			promDistBlockFailures.Inc()
+			clog.Errorf("no quorum for block %s: %v", i, err)
+		}
+		return blk, err
+	}
+	// Don't wait on peers that have stopped heartbeating.
+	peers = ring.SkipDown(peers, d.srv.PeerDown)
+	peers = d.preferLeastLoaded(peers)
+	peers = d.preferLocalZone(peers)
+	if d.shouldReadRepair(i.Volume()) {
+		blk, err := d.readRepair(ctx, i, peers)
+		if err == nil {
+			d.readCache.Put(i, blk)
+			return blk, nil
+		}
+		clog.Debugf("read repair of %s failed, reading normally: %v", i, err)
+	}
+	writeLevel := d.writeLevel(ctx, i.Volume())
 	for _, p := range peers.Peers[:peers.Replication] {
 		if p == d.UUID() || writeLevel == torus.WriteLocal {
-			b, err := d.blocks.GetBlock(ctx, i)
+			b, err := d.localBlock(ctx, i)
 			if err == nil {
 				promDistBlockLocalHits.Inc()
 				return b, nil
@@ -44,7 +78,6 @@ func (d *Distributor) GetBlock(ctx context.Context, i torus.BlockRef) ([]byte, e
 		}
 	}
 	var blk []byte
-	readLevel := d.getReadFromServer()
 	switch readLevel {
 	case torus.ReadBlock:
 		blk, err = d.readWithBackoff(ctx, i, peers)
@@ -52,6 +85,8 @@ func (d *Distributor) GetBlock(ctx context.Context, i torus.BlockRef) ([]byte, e
 		blk, err = d.readSequential(ctx, i, peers, clientTimeout)
 	case torus.ReadSpread:
 		blk, err = d.readSpread(ctx, i, peers)
+	case torus.ReadHedged:
+		blk, err = d.readHedged(ctx, i, peers)
 	default:
 		panic("unhandled read level")
 	}
@@ -79,7 +114,7 @@ func (d *Distributor) readSequential(ctx context.Context, i torus.BlockRef, peer
 	for _, p := range peers.Peers {
 		// If it's local, just try to get it.
 		if p == d.UUID() {
-			b, err := d.blocks.GetBlock(ctx, i)
+			b, err := d.localBlock(ctx, i)
 			if err == nil {
 				promDistBlockLocalHits.Inc()
 				return b, nil
@@ -98,8 +133,8 @@ func (d *Distributor) readSequential(ctx context.Context, i torus.BlockRef, peer
 			return blk, nil
 		}
 
-		// If this peer didn't have it, continue
-		if err == torus.ErrBlockUnavailable || err == torus.ErrNoPeer {
+		// If this peer didn't have it, or had a bad copy, continue
+		if err == torus.ErrBlockUnavailable || err == torus.ErrNoPeer || err == torus.ErrBlockCorrupt {
 			clog.Warningf("block %s from %s failed, trying next peer", i, p)
 			promDistBlockPeerFailures.WithLabelValues(p).Inc()
 			continue
@@ -137,6 +172,11 @@ func (d *Distributor) readSpread(ctx context.Context, i torus.BlockRef, peers to
 		}(p)
 		count++
 	}
+	if count == 0 {
+		// None of the replicas is another peer that is up; ask the
+		// rest in turn.
+		return d.readSequential(ctx, i, peers, clientTimeout)
+	}
 
 	for {
 		select {
@@ -156,33 +196,44 @@ func (d *Distributor) readFromPeer(ctx context.Context, i torus.BlockRef, peer s
 	blk, err := d.client.GetBlock(ctx, peer, i)
 	// If we're successful, store that.
 	if err == nil {
-		d.readCache.Put(string(i.ToBytes()), blk)
+		d.readCache.Put(i, blk)
 		promDistBlockPeerHits.WithLabelValues(peer).Inc()
 		return blk, nil
 	}
 	return nil, err
 }
 
-func (d *Distributor) getWriteFromServer() torus.WriteLevel {
-	return d.srv.Cfg.WriteLevel
-}
-
-func (d *Distributor) getReadFromServer() torus.ReadLevel {
-	return d.srv.Cfg.ReadLevel
+func (d *Distributor) WriteBlock(ctx context.Context, i torus.BlockRef, data []byte) error {
+	ctx, span := torus.StartSpan(ctx, "Distributor.WriteBlock", torus.AttrBlock.String(i.String()))
+	err := d.writeBlock(ctx, i, data)
+	torus.EndSpan(span, err)
+	return err
 }
 
-func (d *Distributor) WriteBlock(ctx context.Context, i torus.BlockRef, data []byte) error {
+func (d *Distributor) writeBlock(ctx context.Context, i torus.BlockRef, data []byte) error {
+	defer d.observeForeground(ctx, time.Now())
+	defer observeLatency("write", time.Now())
+	if err := d.waitQoS(ctx, i.Volume()); err != nil {
+		return err
+	}
 	d.mut.RLock()
 	defer d.mut.RUnlock()
-	peers, err := d.ring.GetPeers(i)
+	if d.isLeaving() {
+		return torus.ErrLeaving
+	}
+	err := d.fence.Check(i.Volume(), torus.WriteEpoch(ctx))
+	if err != nil {
+		return err
+	}
+	peers, err := d.getPeers(i)
 	if err != nil {
 		return err
 	}
 	if len(peers.Peers) == 0 {
 		return ErrNoPeersBlock
 	}
-	d.readCache.Put(string(i.ToBytes()), data)
-	switch d.getWriteFromServer() {
+	d.readCache.Put(i, data)
+	switch d.writeLevel(ctx, i.Volume()) {
 	case torus.WriteLocal:
 		err = d.blocks.WriteBlock(ctx, i, data)
 		if err == nil {
@@ -202,42 +253,84 @@ func (d *Distributor) WriteBlock(ctx context.Context, i torus.BlockRef, data []b
 				}
 			}
 		}
-		for _, p := range peers.Peers {
+		replicas := peers.Replicas()
+		for _, p := range replicas {
+			if p == d.UUID() {
+				continue
+			}
 			err = d.client.PutBlock(ctx, p, i, data)
-			if err == nil {
-				return nil
+			if err == nil || err == torus.ErrStaleEpoch {
+				return err
 			}
 			clog.Noticef("WriteOne error, remote: %s", err)
 		}
-		return torus.ErrNoPeer
+		// Every replica is down; leave the block with the peers next in
+		// line, on behalf of each of them, until they're back.
+		written := d.handOff(ctx, i, data, peers, replicas)
+		if written == 0 {
+			return torus.ErrNoPeer
+		}
+		if written < len(replicas) {
+			clog.Warningf("only handed off block to %d/%d peers", written, len(replicas))
+		}
+		return nil
 	case torus.WriteAll:
-		toWrite := peers.Replication
-		for _, p := range peers.Peers {
-			var err error
-			if p == d.UUID() {
-				err = d.blocks.WriteBlock(ctx, i, data)
-			} else {
-				err = d.client.PutBlock(ctx, p, i, data)
+		replicas := peers.Replicas()
+		var down torus.PeerList
+		for _, p := range replicas {
+			err := d.writeReplica(ctx, p, i, data)
+			if err == torus.ErrStaleEpoch {
+				// Another client has attached the volume since; don't
+				// hand off a write that's been fenced.
+				return err
 			}
 			if err != nil {
 				clog.Noticef("error WriteAll to peer %s: %s", p, err)
-			} else {
-				toWrite--
-			}
-			if toWrite == 0 {
-				return nil
+				down = append(down, p)
 			}
 		}
-		if toWrite == peers.Replication {
+		if len(down) == 0 {
+			return nil
+		}
+		written := len(replicas) - len(down) + d.handOff(ctx, i, data, peers, down)
+		if written == 0 {
 			clog.Noticef("error WriteAll to all peers")
 			return torus.ErrNoPeer
 		}
-		clog.Warningf("only wrote block to %d/%d peers", (peers.Replication - toWrite), peers.Replication)
+		if written < len(replicas) {
+			clog.Warningf("only wrote block to %d/%d peers", written, len(replicas))
+		}
+	case torus.WriteQuorum:
+		return d.writeQuorum(ctx, i, data, peers)
 	}
 	return nil
 }
 
+// handOff hands the writes for down replicas to the peers that follow them,
+// so that they can be replayed when the replicas come back. It returns how
+// many it handed off.
+func (d *Distributor) handOff(ctx context.Context, i torus.BlockRef, data []byte, peers torus.PeerPermutation, down torus.PeerList) int {
+	var used torus.PeerList
+	for _, p := range down {
+		fb, err := d.writeHinted(ctx, p, i, data, peers, used)
+		if err != nil {
+			break
+		}
+		used = append(used, fb)
+	}
+	return len(used)
+}
+
 func (d *Distributor) WriteBuf(ctx context.Context, i torus.BlockRef) ([]byte, error) {
+	err := d.checkAccess(ctx, i.Volume(), torus.PermWrite)
+	if err != nil {
+		return nil, err
+	}
+	err = d.fence.Check(i.Volume(), torus.WriteEpoch(ctx))
+	if err != nil {
+		clog.Warningf("rejecting write to %s: %v", i, err)
+		return nil, err
+	}
 	return d.blocks.WriteBuf(ctx, i)
 }
 
@@ -246,9 +339,58 @@ func (d *Distributor) HasBlock(ctx context.Context, i torus.BlockRef) (bool, err
 }
 
 func (d *Distributor) DeleteBlock(ctx context.Context, i torus.BlockRef) error {
+	d.forgetLocalBlock(i)
+	d.readCache.Remove(i)
 	return d.blocks.DeleteBlock(ctx, i)
 }
 
+// How long to wait on each peer asked to delete discarded blocks.
+var discardTimeout = 5 * time.Second
+
+// DiscardBlocks deletes the replicas of blocks a volume no longer uses from
+// the peers the ring puts them on, so that the space is given back right
+// away. Copies on peers that can't be reached are left for garbage
+// collection.
+func (d *Distributor) DiscardBlocks(ctx context.Context, refs []torus.BlockRef) error {
+	byPeer := make(map[string][]torus.BlockRef)
+	d.mut.RLock()
+	for _, ref := range refs {
+		d.readCache.Remove(ref)
+		perm, err := d.getPeers(ref)
+		if err != nil {
+			d.mut.RUnlock()
+			return err
+		}
+		for _, p := range perm.Replicas() {
+			byPeer[p] = append(byPeer[p], ref)
+		}
+	}
+	d.mut.RUnlock()
+	var firstErr error
+	for peer, prefs := range byPeer {
+		var err error
+		if peer == d.UUID() {
+			err = d.DeleteBlocks(ctx, prefs)
+		} else {
+			dctx, cancel := context.WithTimeout(ctx, discardTimeout)
+			err = d.client.DeleteBlocks(dctx, peer, prefs)
+			cancel()
+		}
+		if err != nil && err != torus.ErrNotSupported {
+			clog.Warningf("couldn't discard %d blocks on %s: %v", len(prefs), peer, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// InvalidateVolume drops the volume's blocks from the read cache.
+func (d *Distributor) InvalidateVolume(vid torus.VolumeID) {
+	d.readCache.InvalidateVolume(vid)
+}
+
 func (d *Distributor) NumBlocks() uint64 {
 	d.mut.RLock()
 	defer d.mut.RUnlock()
@@ -265,12 +407,44 @@ func (d *Distributor) BlockIterator() torus.BlockIterator {
 	return d.blocks.BlockIterator()
 }
 
+// GetBlockChecksum returns the checksum of this peer's own copy of a block.
+func (d *Distributor) GetBlockChecksum(ctx context.Context, i torus.BlockRef) (uint32, error) {
+	return d.blocks.GetBlockChecksum(ctx, i)
+}
+
 func (d *Distributor) Flush() error {
 	return d.blocks.Flush()
 }
 
 func (d *Distributor) Kind() string { return "distributor" }
 
+// FileOptions implements torus.BlockFileReporter for the local store.
+func (d *Distributor) FileOptions() torus.BlockFileOptions {
+	if r, ok := d.blocks.(torus.BlockFileReporter); ok {
+		return r.FileOptions()
+	}
+	return torus.BlockFileOptions{}
+}
+
+// Devices implements torus.DeviceReporter for the local store.
+func (d *Distributor) Devices() []*models.PeerInfo {
+	if r, ok := d.blocks.(torus.DeviceReporter); ok {
+		return r.Devices()
+	}
+	return nil
+}
+
+// placeOnDevices returns the local devices the ring places a block on.
+func (d *Distributor) placeOnDevices(ref torus.BlockRef) []string {
+	d.mut.RLock()
+	r := d.ring
+	d.mut.RUnlock()
+	if dr, ok := r.(torus.DeviceRing); ok {
+		return dr.GetDevices(ref, d.UUID())
+	}
+	return nil
+}
+
 func (d *Distributor) BlockSize() uint64 {
 	return d.blocks.BlockSize()
 }
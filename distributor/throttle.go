@@ -0,0 +1,121 @@
+package distributor
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// How many foreground latencies are kept between throttle updates.
+	latencySamples = 1024
+	// How far the throttle can slow rebalancing down.
+	maxRebalanceThrottle = 64
+)
+
+// How often the throttle compares foreground latency against the SLO.
+var throttleInterval = time.Second
+
+// latencyTracker samples the latency of the block reads and writes this peer
+// serves to clients, keeping a uniform sample of those since the last reset.
+type latencyTracker struct {
+	mut     sync.Mutex
+	samples []time.Duration
+	seen    int
+}
+
+func (l *latencyTracker) observe(d time.Duration) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.seen++
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	// Reservoir sampling, so a busy second doesn't only keep its start.
+	if i := rand.Intn(l.seen); i < latencySamples {
+		l.samples[i] = d
+	}
+}
+
+// reset returns the 99th percentile latency seen since the last reset, and
+// how many requests it was taken over.
+func (l *latencyTracker) reset() (time.Duration, int) {
+	l.mut.Lock()
+	samples := l.samples
+	seen := l.seen
+	l.samples = make([]time.Duration, 0, latencySamples)
+	l.seen = 0
+	l.mut.Unlock()
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	sort.Sort(durations(samples))
+	return samples[len(samples)*99/100], seen
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+
+// observeForeground records how long a client's block request took. Batch
+// I/O, such as rebalancing itself, isn't counted.
+func (d *Distributor) observeForeground(ctx context.Context, start time.Time) {
+	if d.srv.Cfg.RebalanceLatencySLO == 0 || torus.GetIOClass(ctx) == torus.IOClassBatch {
+		return
+	}
+	elapsed := time.Since(start)
+	promDistForegroundLatency.Observe(elapsed.Seconds())
+	d.latency.observe(elapsed)
+}
+
+func observeLatency(op string, start time.Time) {
+	promDistBlockLatency.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// throttleState is only touched by the rebalance goroutine.
+type throttleState struct {
+	factor     int
+	lastUpdate time.Time
+}
+
+// updateThrottle slows rebalancing down while foreground p99 latency is over
+// the SLO, and speeds it back up once latency is well under it or there's no
+// foreground I/O at all.
+func (d *Distributor) updateThrottle() {
+	slo := d.srv.Cfg.RebalanceLatencySLO
+	if slo == 0 || time.Since(d.throttle.lastUpdate) < throttleInterval {
+		return
+	}
+	d.throttle.lastUpdate = time.Now()
+	if d.throttle.factor == 0 {
+		d.throttle.factor = 1
+	}
+	p99, n := d.latency.reset()
+	switch {
+	case n != 0 && p99 > slo:
+		if d.throttle.factor < maxRebalanceThrottle {
+			d.throttle.factor *= 2
+			clog.Debugf("foreground p99 latency %s is over %s; slowing rebalance down %dx", p99, slo, d.throttle.factor)
+		}
+	case n == 0 || p99 < slo/2:
+		if d.throttle.factor > 1 {
+			d.throttle.factor /= 2
+		}
+	}
+	promDistRebalanceThrottle.Set(float64(d.throttle.factor))
+}
+
+// throttled stretches a delay between rebalance ticks by the throttle.
+func (d *Distributor) throttled(delay time.Duration) time.Duration {
+	if d.throttle.factor <= 1 {
+		return delay
+	}
+	return delay * time.Duration(d.throttle.factor)
+}
@@ -0,0 +1,47 @@
+package distributor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/torus/metadata/temp"
+)
+
+func TestRebalanceThrottle(t *testing.T) {
+	srv := newServer(temp.NewServer())
+	defer srv.Close()
+	srv.Cfg.RebalanceLatencySLO = 10 * time.Millisecond
+	d := &Distributor{srv: srv}
+	defer func(i time.Duration) { throttleInterval = i }(throttleInterval)
+	throttleInterval = 0
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 100; j++ {
+			d.latency.observe(50 * time.Millisecond)
+		}
+		d.updateThrottle()
+	}
+	if d.throttle.factor != 8 {
+		t.Fatalf("expected rebalancing to be slowed down 8x, got %dx", d.throttle.factor)
+	}
+	if delay := d.throttled(time.Millisecond); delay != 8*time.Millisecond {
+		t.Errorf("expected an 8ms delay, got %s", delay)
+	}
+
+	// Latency just under the SLO holds the throttle where it is.
+	for j := 0; j < 100; j++ {
+		d.latency.observe(8 * time.Millisecond)
+	}
+	d.updateThrottle()
+	if d.throttle.factor != 8 {
+		t.Fatalf("expected the throttle to hold at 8x, got %dx", d.throttle.factor)
+	}
+
+	// With no foreground I/O, it speeds back up.
+	for i := 0; i < 3; i++ {
+		d.updateThrottle()
+	}
+	if d.throttle.factor != 1 {
+		t.Fatalf("expected the throttle to be lifted, got %dx", d.throttle.factor)
+	}
+}
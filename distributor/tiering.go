@@ -0,0 +1,51 @@
+package distributor
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+	"golang.org/x/net/context"
+)
+
+var (
+	// How often blocks are moved between the fast and slow devices, and
+	// how many at most each time.
+	tierInterval     = time.Minute
+	tierMovesPerPass = 4096
+)
+
+// tierVolume is the tiering policy given to the local block store.
+func (d *Distributor) tierVolume(vid torus.VolumeID) torus.TierPolicy {
+	tmds, ok := d.srv.MDS.(torus.TieringMetadataService)
+	if !ok {
+		return torus.TierAuto
+	}
+	p, _ := d.policies.get(vid, policyTiering, func(old interface{}) (interface{}, error) {
+		p, err := tmds.GetTiering(vid)
+		if err != nil {
+			clog.Errorf("couldn't get tiering policy for volume %d: %v", vid, err)
+			p, _ = old.(torus.TierPolicy)
+		}
+		return p, nil
+	})
+	return p.(torus.TierPolicy)
+}
+
+// tierTicker moves blocks between the tiers of the local devices.
+func (d *Distributor) tierTicker(bt torus.BlockTierer, closer chan struct{}) {
+	for {
+		select {
+		case <-closer:
+			return
+		case <-time.After(tierInterval):
+		}
+		promoted, demoted, err := bt.Retier(context.TODO(), tierMovesPerPass)
+		if err != nil {
+			clog.Errorf("couldn't move blocks between tiers: %v", err)
+			continue
+		}
+		if promoted+demoted != 0 {
+			clog.Debugf("tiering: promoted %d blocks, demoted %d", promoted, demoted)
+		}
+	}
+}
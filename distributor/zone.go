@@ -0,0 +1,97 @@
+package distributor
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+// Kinds of traffic counted per pair of zones.
+const (
+	zoneRead        = "read"
+	zoneReplication = "replication"
+	zoneRebalance   = "rebalance"
+)
+
+// zoneOf returns the zone a peer last reported, or "" if it didn't report
+// one or isn't known.
+func (d *Distributor) zoneOf(uuid string) string {
+	if uuid == d.UUID() {
+		return d.srv.Cfg.Zone
+	}
+	pi := d.srv.GetPeer(uuid)
+	if pi == nil {
+		return ""
+	}
+	return pi.Zone
+}
+
+// countZoneBytes records n bytes of the given kind of traffic as having been
+// sent from one peer to another, one of which is this one.
+func (d *Distributor) countZoneBytes(kind, from, to string, n int) {
+	if n == 0 {
+		return
+	}
+	promDistZoneBytes.WithLabelValues(d.zoneOf(from), d.zoneOf(to), kind).Add(float64(n))
+	if from == d.UUID() {
+		promDistPeerBytes.WithLabelValues(to, "sent").Add(float64(n))
+	} else {
+		promDistPeerBytes.WithLabelValues(from, "received").Add(float64(n))
+	}
+}
+
+// preferLocalZone returns peers with the replicas in this peer's zone moved
+// to the front, in their original order, so that reads stay in the zone when
+// they can. Peers past the replicas are left alone.
+func (d *Distributor) preferLocalZone(peers torus.PeerPermutation) torus.PeerPermutation {
+	zone := d.srv.Cfg.Zone
+	if !d.srv.Cfg.ReadLocalZone || zone == "" {
+		return peers
+	}
+	reps := peers.Peers[:peers.Replication]
+	out := make(torus.PeerList, 0, len(peers.Peers))
+	for _, p := range reps {
+		if d.zoneOf(p) == zone {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 || len(out) == len(reps) {
+		return peers
+	}
+	for _, p := range reps {
+		if d.zoneOf(p) != zone {
+			out = append(out, p)
+		}
+	}
+	out = append(out, peers.Peers[peers.Replication:]...)
+	return torus.PeerPermutation{
+		Peers:       out,
+		Replication: peers.Replication,
+	}
+}
+
+// rebalanceClient sends blocks for the rebalancer, so that they are counted
+// as rebalance traffic rather than replication.
+type rebalanceClient struct {
+	*distClient
+}
+
+func (c rebalanceClient) PutBlock(ctx context.Context, uuid string, b torus.BlockRef, data []byte) error {
+	ctx, err := c.dist.copyContext(ctx, b.Volume())
+	if err != nil {
+		return err
+	}
+	return c.putBlock(ctx, uuid, b, data, zoneRebalance)
+}
+
+func (c rebalanceClient) StreamBlocks(ctx context.Context, uuid string, refs []torus.BlockRef, get func(torus.BlockRef) ([]byte, error)) ([]error, error) {
+	epochs := make([]uint64, len(refs))
+	for i, ref := range refs {
+		var err error
+		epochs[i], err = c.dist.fence.Current(ref.Volume())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.sendBlocks(ctx, uuid, refs, epochs, get, zoneRebalance)
+}
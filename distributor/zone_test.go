@@ -0,0 +1,65 @@
+package distributor
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+)
+
+func TestPreferLocalZone(t *testing.T) {
+	md := temp.NewServer()
+	defer md.Close()
+	var srvs []*torus.Server
+	for i, zone := range []string{"a", "b", "a"} {
+		cfg := torus.Config{
+			StorageSize:   100 * 1024 * 1024,
+			Zone:          zone,
+			ReadLocalZone: true,
+		}
+		mds := temp.NewClient(cfg, md)
+		blocks, _ := torus.CreateBlockStore("temp", "current", cfg, mds.GlobalMetadata())
+		srv, err := torus.NewServerByImpl(cfg, mds, blocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uri, err := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", 40010+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ListenReplication(srv, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srvs = append(srvs, srv)
+	}
+	defer closeAll(t, srvs...)
+	time.Sleep(10 * time.Millisecond)
+	srvs[0].UpdatePeerMap()
+
+	d := srvs[0].Blocks.(*Distributor)
+	uuids := make([]string, len(srvs))
+	for i, srv := range srvs {
+		uuids[i] = srv.MDS.UUID()
+		if z := d.zoneOf(uuids[i]); z != srv.Cfg.Zone {
+			t.Errorf("expected peer %d in zone %q, got %q", i, srv.Cfg.Zone, z)
+		}
+	}
+	peers := torus.PeerPermutation{
+		Peers:       torus.PeerList{uuids[1], uuids[2], uuids[0]},
+		Replication: 2,
+	}
+	got := d.preferLocalZone(peers)
+	want := torus.PeerList{uuids[2], uuids[1], uuids[0]}
+	for i := range want {
+		if got.Peers[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got.Peers)
+		}
+	}
+	if peers.Peers[0] != uuids[1] {
+		t.Error("reordering changed the original permutation")
+	}
+}
@@ -0,0 +1,15 @@
+package torus
+
+// DrainMetadataService is implemented by metadata services that can mark
+// peers as draining, for maintenance. A draining peer stays in the ring, and
+// its blocks can still be read from it, but no block is placed on it while
+// another peer can take it, so new writes go elsewhere and the rebalancer
+// copies its blocks away. Once it holds none, it can be taken out of the ring
+// without losing a replica of anything.
+type DrainMetadataService interface {
+	// SetDraining marks the peer with the given UUID as draining, or clears
+	// the mark.
+	SetDraining(uuid string, draining bool) error
+	// GetDraining returns the UUIDs of the draining peers.
+	GetDraining() ([]string, error)
+}
@@ -0,0 +1,175 @@
+package torus
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Volumes can be encrypted at rest with AES-256-GCM. Each encrypted volume has
+// its own data encryption keys, which are stored in the metadata service
+// wrapped with a key encryption key that only the cluster's nodes hold. Keys
+// are versioned so they can be rotated; every stored block records the
+// version it was encrypted with.
+
+// KeySize is the size of both key encryption keys and data encryption keys.
+const KeySize = 32
+
+// VolumeKeys are the wrapped data encryption keys of a volume, by version.
+// Old versions are kept so blocks not yet re-encrypted can still be read.
+type VolumeKeys struct {
+	Current uint32            `json:"current"`
+	Keys    map[uint32][]byte `json:"keys"`
+}
+
+// EncryptionMetadataService is implemented by metadata services that can
+// store the keys of encrypted volumes.
+type EncryptionMetadataService interface {
+	// GetVolumeKeys returns the keys of the volume, or ErrNotExist if it
+	// isn't encrypted.
+	GetVolumeKeys(vid VolumeID) (*VolumeKeys, error)
+	// ModifyVolumeKeys atomically applies f to the keys of the volume,
+	// which are nil if it isn't encrypted, and stores the result. f may be
+	// called more than once.
+	ModifyVolumeKeys(vid VolumeID, f func(k *VolumeKeys) (*VolumeKeys, error)) (*VolumeKeys, error)
+}
+
+// BlockEncryptor is implemented by block stores that can encrypt blocks at
+// rest.
+type BlockEncryptor interface {
+	// SetKeyringFunc sets the function the store asks for a volume's keys.
+	// It returns a nil Keyring for volumes that aren't encrypted, and may
+	// be called on every read and write, without the store's locks held.
+	SetKeyringFunc(f func(vid VolumeID) (*Keyring, error))
+}
+
+// Keyring holds the unwrapped keys of a volume.
+type Keyring struct {
+	Current uint32
+	aeads   map[uint32]cipher.AEAD
+}
+
+// Key returns the AEAD for the given key version, or nil if there's no such
+// version.
+func (k *Keyring) Key(version uint32) cipher.AEAD {
+	return k.aeads[version]
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("torus: keys must be %d bytes, got %d", KeySize, len(key))
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+// wrapAD binds a wrapped key to the volume and version it belongs to.
+func wrapAD(vid VolumeID, version uint32) []byte {
+	ad := make([]byte, 12)
+	binary.LittleEndian.PutUint64(ad[0:8], uint64(vid))
+	binary.LittleEndian.PutUint32(ad[8:12], version)
+	return ad
+}
+
+func wrapKey(kek cipher.AEAD, vid VolumeID, version uint32) ([]byte, error) {
+	dek := make([]byte, KeySize)
+	_, err := io.ReadFull(rand.Reader, dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, kek.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return kek.Seal(nonce, nonce, dek, wrapAD(vid, version)), nil
+}
+
+// UnwrapVolumeKeys unwraps the keys of a volume with the key encryption key.
+func UnwrapVolumeKeys(kek []byte, vid VolumeID, vk *VolumeKeys) (*Keyring, error) {
+	if len(kek) == 0 {
+		return nil, ErrKeyUnavailable
+	}
+	k, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	kr := &Keyring{
+		Current: vk.Current,
+		aeads:   make(map[uint32]cipher.AEAD),
+	}
+	for version, wrapped := range vk.Keys {
+		if len(wrapped) < k.NonceSize() {
+			return nil, errors.New("torus: wrapped key is too short")
+		}
+		n := k.NonceSize()
+		dek, err := k.Open(nil, wrapped[:n], wrapped[n:], wrapAD(vid, version))
+		if err != nil {
+			return nil, fmt.Errorf("torus: couldn't unwrap key %d of volume %d; wrong key encryption key?", version, vid)
+		}
+		kr.aeads[version], err = newAEAD(dek)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if kr.aeads[kr.Current] == nil {
+		return nil, fmt.Errorf("torus: volume %d has no key %d", vid, kr.Current)
+	}
+	return kr, nil
+}
+
+// RotateVolumeKey gives the named volume a new data encryption key,
+// encrypting it if it wasn't already, and returns the key's version. New
+// writes use the new key; blocks under older keys are re-encrypted as they
+// are read.
+func RotateVolumeKey(mds MetadataService, kek []byte, volume string) (uint32, error) {
+	emds, ok := mds.(EncryptionMetadataService)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	if len(kek) == 0 {
+		return 0, ErrKeyUnavailable
+	}
+	k, err := newAEAD(kek)
+	if err != nil {
+		return 0, err
+	}
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return 0, err
+	}
+	vid := VolumeID(vol.Id)
+	vk, err := emds.ModifyVolumeKeys(vid, func(old *VolumeKeys) (*VolumeKeys, error) {
+		vk := &VolumeKeys{Keys: make(map[uint32][]byte)}
+		if old != nil {
+			// Make sure the new key is wrapped with the same key
+			// encryption key as the old ones.
+			_, err := UnwrapVolumeKeys(kek, vid, old)
+			if err != nil {
+				return nil, err
+			}
+			vk.Current = old.Current
+			for v, w := range old.Keys {
+				vk.Keys[v] = w
+			}
+		}
+		vk.Current++
+		w, err := wrapKey(k, vid, vk.Current)
+		if err != nil {
+			return nil, err
+		}
+		vk.Keys[vk.Current] = w
+		return vk, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return vk.Current, nil
+}
@@ -0,0 +1,78 @@
+package torus
+
+// The Index of a shard packs, from the top, a sequence number that keeps
+// rewrites of the same shard distinct, the stripe, and the shard's position in
+// the stripe. Every shard of a stripe is placed relative to the same key, so
+// that each lands on a different peer.
+const (
+	shardPosBits    = 8
+	shardStripeBits = 24
+
+	// MaxStripes is the most stripes an erasure coded blockset can have.
+	MaxStripes = 1 << shardStripeBits
+	// MaxShards is the most shards a stripe can have.
+	MaxShards = 1 << shardPosBits
+)
+
+// ShardRef returns the ref of a shard of an erasure coded stripe.
+func ShardRef(inode INodeRef, seq uint32, stripe, pos int) BlockRef {
+	ref := BlockRef{
+		INodeRef: inode,
+		Index:    IndexID(uint64(seq)<<(shardStripeBits+shardPosBits) | uint64(stripe)<<shardPosBits | uint64(pos)),
+	}
+	ref.SetBlockType(TypeShard)
+	return ref
+}
+
+// ShardStripe returns the stripe a shard belongs to.
+func (b BlockRef) ShardStripe() int {
+	return int(uint64(b.Index)>>shardPosBits) & (MaxStripes - 1)
+}
+
+// ShardPos returns a shard's position in its stripe.
+func (b BlockRef) ShardPos() int {
+	return int(b.Index) & (MaxShards - 1)
+}
+
+// StripeKey returns the key every shard of b's stripe is placed by. It is the
+// same for every inode of the volume, since a stripe's shards may have been
+// written by different inodes. No real block has INode 0, so the key is an
+// ordinary block ref that is never stored.
+func StripeKey(b BlockRef) BlockRef {
+	return BlockRef{
+		INodeRef: NewINodeRef(b.Volume(), 0),
+		Index:    IndexID(b.ShardStripe()),
+	}
+}
+
+// ShardPermutation turns the permutation of a stripe's key into that of the
+// shard at pos: the peers are rotated by pos, so that the shards of a stripe
+// go to distinct peers as long as there are enough of them, and each shard is
+// stored once.
+func ShardPermutation(perm PeerPermutation, pos int) PeerPermutation {
+	n := len(perm.Peers)
+	if n == 0 {
+		return perm
+	}
+	peers := make(PeerList, n)
+	for i := range peers {
+		peers[i] = perm.Peers[(i+pos)%n]
+	}
+	return PeerPermutation{
+		Peers:       peers,
+		Replication: 1,
+	}
+}
+
+// GetBlockPeers returns the peers a block is placed on by r, taking erasure
+// coded shards into account.
+func GetBlockPeers(r Ring, ref BlockRef) (PeerPermutation, error) {
+	if ref.BlockType() != TypeShard {
+		return r.GetPeers(ref)
+	}
+	perm, err := r.GetPeers(StripeKey(ref))
+	if err != nil {
+		return perm, err
+	}
+	return ShardPermutation(perm, ref.ShardPos()), nil
+}
@@ -41,6 +41,10 @@ var (
 	// ErrNonSequentialRing is returned if the ring's internal version number appears to jump.
 	ErrNonSequentialRing = errors.New("torus: non-sequential ring")
 
+	// ErrRingChangePending is returned if a ring is proposed while another
+	// proposed ring is still waiting to be committed.
+	ErrRingChangePending = errors.New("torus: another ring change is in progress")
+
 	// ErrNoPeer is returned if the peer can't be found.
 	ErrNoPeer = errors.New("torus: no such peer")
 
@@ -53,6 +57,12 @@ var (
 	// ErrNotDir is returned if we're trying a directory operation on a non-directory path.
 	ErrNotDir = errors.New("torus: not a directory")
 
+	// ErrIsDir is returned if we're trying a file operation on a directory.
+	ErrIsDir = errors.New("torus: is a directory")
+
+	// ErrNotEmpty is returned if we're trying to remove a directory or bucket that still has entries.
+	ErrNotEmpty = errors.New("torus: directory not empty")
+
 	// ErrWrongVolumeType is returned if the operation cannot be performed on this type of volume.
 	ErrWrongVolumeType = errors.New("torus: wrong volume type")
 
@@ -63,9 +73,49 @@ var (
 	// ErrLocked is returned if the resource is locked.
 	ErrLocked = errors.New("torus: locked")
 
+	// ErrShared is returned if a shared volume is attached exclusively.
+	ErrShared = errors.New("torus: volume is shared")
+
 	// ErrLeaseNotFound is returned if the lease cannot be found.
 	ErrLeaseNotFound = errors.New("torus: lease not found")
 
+	// ErrStaleEpoch is returned if a write comes from an attachment that has
+	// since been superseded, or from no attachment while the volume is
+	// attached.
+	ErrStaleEpoch = errors.New("torus: write from stale attachment epoch")
+
+	// ErrBlockCorrupt is returned if a stored block doesn't match its
+	// checksum.
+	ErrBlockCorrupt = errors.New("torus: block is corrupt")
+
+	// ErrQuotaExceeded is returned if an operation would take a tenant over
+	// its hard quota.
+	ErrQuotaExceeded = errors.New("torus: tenant quota exceeded")
+
+	// ErrVolumeQuota is returned if a volume would be created or grown past
+	// the quota on its logical size.
+	ErrVolumeQuota = errors.New("torus: volume size over its quota")
+
+	// ErrKeyUnavailable is returned if a volume is encrypted and its keys
+	// can't be had, such as when no key encryption key was configured.
+	ErrKeyUnavailable = errors.New("torus: encryption key unavailable")
+
+	// ErrPermissionDenied is returned if the volume's ACL doesn't allow the
+	// operation.
+	ErrPermissionDenied = errors.New("torus: permission denied")
+
+	// ErrNoCapacity is returned if a weighted ring is made of peers none of
+	// which report any capacity.
+	ErrNoCapacity = errors.New("torus: no peer has any capacity")
+
+	// ErrLeaving is returned for writes to a peer that is shutting down, so
+	// that they go to another peer instead.
+	ErrLeaving = errors.New("torus: peer is leaving the cluster")
+
+	// ErrJoinToken is returned if a peer's join token doesn't match the
+	// cluster's, so it may not add itself to the ring.
+	ErrJoinToken = errors.New("torus: wrong join token")
+
 	// ErrUsage is returned if the command usage is wrong.
 	ErrUsage = errors.New("torus: wrong command usage")
 )
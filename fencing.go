@@ -0,0 +1,165 @@
+package torus
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// WithWriteEpoch returns a context that stamps writes with the given
+// attachment epoch.
+func WithWriteEpoch(ctx context.Context, epoch uint64) context.Context {
+	return context.WithValue(ctx, CtxWriteEpoch, epoch)
+}
+
+// WriteEpoch returns the attachment epoch writes in ctx are stamped with, or 0
+// if they aren't fenced.
+func WriteEpoch(ctx context.Context) uint64 {
+	if e, ok := ctx.Value(CtxWriteEpoch).(uint64); ok {
+		return e
+	}
+	return 0
+}
+
+// Fence tracks the newest attachment epoch seen for each volume, and rejects
+// writes from older ones. Every new attachment of a volume gets a higher
+// epoch, so once the new holder has written to a peer, a client that lost the
+// attachment can't write there anymore.
+//
+// Epochs are only kept in memory; without a lookup, a restarted peer learns
+// them again from the next fenced write. A Fence with a lookup asks the
+// metadata service for the epoch of a volume's current attachment before it
+// accepts the first write to it, again whenever a write comes with an epoch
+// newer than any it's seen, which is the sign of a takeover, and otherwise at
+// most every FenceLookupInterval. A client whose attachment has been taken
+// over is thus fenced off even before the new holder writes. While a volume
+// is attached, writes with no epoch are fenced off too, and if the lookup
+// fails, every write to the volume is refused until it succeeds.
+type Fence struct {
+	mut    sync.Mutex
+	epochs map[VolumeID]uint64
+
+	lookup  func(VolumeID) (uint64, error)
+	checked map[VolumeID]time.Time
+	// attached is the epoch of each volume's current attachment, as last
+	// looked up; 0 if it wasn't attached.
+	attached map[VolumeID]uint64
+}
+
+// FenceLookupInterval is how often a Fence with a lookup asks for the epoch
+// of a volume it's being written to. A client that takes over an attachment
+// waits this long before writing, so that by then every peer has looked up
+// the new epoch.
+var FenceLookupInterval = 2 * time.Second
+
+// AttachEpochMetadataService is implemented by the metadata services that
+// can tell the epoch of a volume's current attachment.
+type AttachEpochMetadataService interface {
+	// GetAttachEpoch returns the epoch of the volume's current attachment,
+	// or 0 if it isn't attached.
+	GetAttachEpoch(vid VolumeID) (uint64, error)
+}
+
+func NewFence() *Fence {
+	return &Fence{
+		epochs: make(map[VolumeID]uint64),
+	}
+}
+
+// NewFenceWithLookup returns a Fence that also learns the epochs of volumes
+// from lookup.
+func NewFenceWithLookup(lookup func(VolumeID) (uint64, error)) *Fence {
+	f := NewFence()
+	f.lookup = lookup
+	f.checked = make(map[VolumeID]time.Time)
+	f.attached = make(map[VolumeID]uint64)
+	return f
+}
+
+// Check returns ErrStaleEpoch if a write to vol at epoch must be rejected,
+// and otherwise records epoch as the newest seen. Writes with no epoch are
+// only rejected by a Fence with a lookup, while vol is attached. If the
+// lookup fails, its error is returned instead.
+func (f *Fence) Check(vol VolumeID, epoch uint64) error {
+	if f.lookup == nil && epoch == 0 {
+		return nil
+	}
+	if f.lookup != nil {
+		if err := f.learn(vol, false); err != nil {
+			return err
+		}
+		f.mut.Lock()
+		newer := epoch > f.epochs[vol]
+		f.mut.Unlock()
+		if newer {
+			if err := f.learn(vol, true); err != nil {
+				return err
+			}
+		}
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if epoch == 0 {
+		if f.attached[vol] != 0 {
+			return ErrStaleEpoch
+		}
+		return nil
+	}
+	cur := f.epochs[vol]
+	if epoch < cur {
+		return ErrStaleEpoch
+	}
+	if epoch > cur {
+		f.epochs[vol] = epoch
+	}
+	return nil
+}
+
+// Current returns the epoch that copies of blocks of vol the caller already
+// holds should be written at, so that a Fence with a lookup doesn't take them
+// for writes from an unattached client: that of the volume's current
+// attachment, or 0 if it isn't attached or there is no lookup.
+func (f *Fence) Current(vol VolumeID) (uint64, error) {
+	if f.lookup == nil {
+		return 0, nil
+	}
+	if err := f.learn(vol, false); err != nil {
+		return 0, err
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.attached[vol], nil
+}
+
+// learn asks the lookup for the epoch of vol, if it hasn't lately or now is
+// set. If the lookup fails, so does every write to vol until it succeeds.
+func (f *Fence) learn(vol VolumeID, now bool) error {
+	start := time.Now()
+	f.mut.Lock()
+	last, known := f.checked[vol]
+	if known && !now && start.Sub(last) < FenceLookupInterval {
+		f.mut.Unlock()
+		return nil
+	}
+	if known {
+		// Writes to vol in the meantime go by what's known already.
+		f.checked[vol] = start
+	}
+	f.mut.Unlock()
+	epoch, err := f.lookup(vol)
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if err != nil {
+		delete(f.checked, vol)
+		return err
+	}
+	if !known {
+		f.checked[vol] = start
+	}
+	f.attached[vol] = epoch
+	if epoch > f.epochs[vol] {
+		f.epochs[vol] = epoch
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package torus_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+func TestFence(t *testing.T) {
+	f := torus.NewFence()
+	steps := []struct {
+		vol   torus.VolumeID
+		epoch uint64
+		err   error
+	}{
+		{1, 5, nil},
+		{1, 5, nil},
+		{1, 4, torus.ErrStaleEpoch},
+		{1, 0, nil},
+		{2, 1, nil},
+		{1, 7, nil},
+		{1, 5, torus.ErrStaleEpoch},
+		{2, 1, nil},
+	}
+	for i, s := range steps {
+		if err := f.Check(s.vol, s.epoch); err != s.err {
+			t.Errorf("step %d: volume %d epoch %d: expected %v, got %v", i, s.vol, s.epoch, s.err, err)
+		}
+	}
+}
+
+func TestFenceLookup(t *testing.T) {
+	current := uint64(9)
+	lookups := 0
+	f := torus.NewFenceWithLookup(func(vol torus.VolumeID) (uint64, error) {
+		lookups++
+		return current, nil
+	})
+	steps := []struct {
+		current uint64
+		epoch   uint64
+		err     error
+		lookups int
+	}{
+		// A write from an attachment that's been taken over is fenced
+		// before the new holder has written anything.
+		{9, 5, torus.ErrStaleEpoch, 1},
+		{9, 9, nil, 1},
+		// So are writes from no attachment while the volume is attached.
+		{9, 0, torus.ErrStaleEpoch, 1},
+		// Lookups are otherwise made at most once an interval per volume,
+		// so a takeover isn't noticed straight away...
+		{12, 9, nil, 1},
+		// ...unless a write comes with an epoch newer than any seen.
+		{12, 10, torus.ErrStaleEpoch, 2},
+		{12, 12, nil, 2},
+		// Once the volume isn't attached, writes with no epoch are taken.
+		{0, 13, nil, 3},
+		{0, 0, nil, 3},
+	}
+	for i, s := range steps {
+		current = s.current
+		if err := f.Check(1, s.epoch); err != s.err {
+			t.Errorf("step %d: epoch %d: expected %v, got %v", i, s.epoch, s.err, err)
+		}
+		if lookups != s.lookups {
+			t.Errorf("step %d: expected %d lookups, got %d", i, s.lookups, lookups)
+		}
+	}
+}
+
+func TestFenceLookupFirstWrite(t *testing.T) {
+	lookupErr := errors.New("no metadata service")
+	fail := true
+	f := torus.NewFenceWithLookup(func(vol torus.VolumeID) (uint64, error) {
+		if fail {
+			return 0, lookupErr
+		}
+		return 9, nil
+	})
+	// A peer that hasn't learned the volume's epoch yet, as after a
+	// restart, can't tell whether a write is stale, so it refuses it.
+	if err := f.Check(1, 5); err != lookupErr {
+		t.Fatalf("expected %v, got %v", lookupErr, err)
+	}
+	fail = false
+	if err := f.Check(1, 5); err != torus.ErrStaleEpoch {
+		t.Fatalf("expected ErrStaleEpoch, got %v", err)
+	}
+	if err := f.Check(1, 9); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFenceLookupError(t *testing.T) {
+	lookupErr := errors.New("no metadata service")
+	fail := false
+	f := torus.NewFenceWithLookup(func(vol torus.VolumeID) (uint64, error) {
+		if fail {
+			return 0, lookupErr
+		}
+		return 9, nil
+	})
+	if err := f.Check(1, 9); err != nil {
+		t.Fatal(err)
+	}
+	// Once a lookup fails, every write is refused until one succeeds.
+	fail = true
+	if err := f.Check(1, 10); err != lookupErr {
+		t.Fatalf("expected %v, got %v", lookupErr, err)
+	}
+	if err := f.Check(1, 9); err != lookupErr {
+		t.Fatalf("expected %v, got %v", lookupErr, err)
+	}
+	if _, err := f.Current(1); err != lookupErr {
+		t.Fatalf("expected %v, got %v", lookupErr, err)
+	}
+	fail = false
+	if err := f.Check(1, 9); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFenceCurrent(t *testing.T) {
+	if epoch, err := torus.NewFence().Current(1); err != nil || epoch != 0 {
+		t.Fatalf("expected epoch 0 without a lookup, got %d, %v", epoch, err)
+	}
+	f := torus.NewFenceWithLookup(func(vol torus.VolumeID) (uint64, error) {
+		return 9, nil
+	})
+	epoch, err := f.Current(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch != 9 {
+		t.Fatalf("expected epoch 9, got %d", epoch)
+	}
+	// Copies written at the current epoch aren't fenced off.
+	if err := f.Check(1, epoch); err != nil {
+		t.Fatal(err)
+	}
+}
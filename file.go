@@ -46,6 +46,10 @@ var (
 		Help:    "Histogram of ms taken to write a block through the layers and into the file abstraction",
 		Buckets: prometheus.ExponentialBuckets(50.0, 2, 20),
 	})
+	promFileReadahead = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_server_file_readahead_blocks",
+		Help: "Number of blocks fetched ahead of sequential reads of a file on this server",
+	})
 )
 
 func init() {
@@ -56,6 +60,7 @@ func init() {
 	prometheus.MustRegister(promFileWrittenBytes)
 	prometheus.MustRegister(promFileBlockRead)
 	prometheus.MustRegister(promFileBlockWrite)
+	prometheus.MustRegister(promFileReadahead)
 }
 
 type File struct {
@@ -73,9 +78,20 @@ type File struct {
 	replaces uint64
 	changed  map[string]bool
 	cache    fileCache
+	ra       readahead
 
 	writeINodeRef INodeRef
 	writeOpen     bool
+	// trimmed are the blocks Trim has dropped since TakeTrimmed was last
+	// called.
+	trimmed []BlockRef
+
+	// Epoch is the epoch of the attachment the file is written under, if
+	// any. It is stamped on every write so that peers can fence off writers
+	// that have lost their attachment.
+	Epoch uint64
+	// IOClass is how urgent the file's block requests are to other peers.
+	IOClass IOClass
 }
 
 func (f *File) WriteOpen() bool {
@@ -107,6 +123,10 @@ func (f *File) openWrite() error {
 		return nil
 	}
 	vid := VolumeID(f.volume.Id)
+	err := f.srv.checkTenantWrite(vid)
+	if err != nil {
+		return err
+	}
 	newINode, err := f.srv.MDS.CommitINodeIndex(vid)
 	if err != nil {
 		return err
@@ -121,12 +141,19 @@ func (f *File) openWrite() error {
 	return nil
 }
 
-func (f *File) writeToBlock(i, from, to int, data []byte) (int, error) {
-	return f.cache.writeToBlock(f.getContext(), i, from, to, data)
+func (f *File) writeToBlock(ctx context.Context, i, from, to int, data []byte) (int, error) {
+	return f.cache.writeToBlock(ctx, i, from, to, data)
 }
 
 func (f *File) getContext() context.Context {
-	return f.srv.getContext()
+	ctx := f.srv.getContext()
+	if f.Epoch != 0 {
+		ctx = WithWriteEpoch(ctx, f.Epoch)
+	}
+	if f.IOClass != IOClassNormal {
+		ctx = WithIOClass(ctx, f.IOClass)
+	}
+	return ctx
 }
 
 func (f *File) Write(b []byte) (n int, err error) {
@@ -138,6 +165,8 @@ func (f *File) Write(b []byte) (n int, err error) {
 func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 	f.mut.Lock()
 	defer f.mut.Unlock()
+	ctx, span := StartSpan(f.getContext(), "File.WriteAt")
+	defer func() { EndSpan(span, err) }()
 	err = f.openWrite()
 	if err != nil {
 		return 0, err
@@ -177,7 +206,7 @@ func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 		if frontlen > toWrite {
 			frontlen = toWrite
 		}
-		wrote, err := f.writeToBlock(blkIndex, int(blkOff), int(blkOff)+frontlen, b[:frontlen])
+		wrote, err := f.writeToBlock(ctx, blkIndex, int(blkOff), int(blkOff)+frontlen, b[:frontlen])
 		clog.Tracef("head writing block at index %d, inoderef %s", blkIndex, f.writeINodeRef)
 		if err != nil {
 			return n, err
@@ -208,7 +237,7 @@ func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 			clog.Tracef("bulk writing block at index %d, inoderef %s", blkIndex, f.writeINodeRef)
 		}
 		start := time.Now()
-		err = f.blocks.PutBlock(f.getContext(), f.writeINodeRef, blkIndex, b[:f.blkSize])
+		err = f.blocks.PutBlock(ctx, f.writeINodeRef, blkIndex, b[:f.blkSize])
 		if err != nil {
 			promFileWrittenBytes.WithLabelValues(f.volume.Name).Add(float64(n))
 			return n, err
@@ -232,7 +261,7 @@ func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 		panic("Offset not equal to a block boundary after bulk")
 	}
 	blkIndex = int(off / f.blkSize)
-	wrote, err := f.writeToBlock(blkIndex, 0, toWrite, b)
+	wrote, err := f.writeToBlock(ctx, blkIndex, 0, toWrite, b)
 	if clog.LevelAt(capnslog.TRACE) {
 		clog.Tracef("tail writing block at index %d, inoderef %s", blkIndex, f.writeINodeRef)
 	}
@@ -258,6 +287,14 @@ func (f *File) Read(b []byte) (n int, err error) {
 func (f *File) ReadAt(b []byte, off int64) (n int, ferr error) {
 	f.mut.RLock()
 	defer f.mut.RUnlock()
+	ctx, span := StartSpan(f.getContext(), "File.ReadAt")
+	defer func() {
+		if ferr == io.EOF {
+			EndSpan(span, nil)
+		} else {
+			EndSpan(span, ferr)
+		}
+	}()
 	toRead := len(b)
 	if clog.LevelAt(capnslog.TRACE) {
 		clog.Trace("begin read: offset ", off, " size ", toRead)
@@ -268,13 +305,16 @@ func (f *File) ReadAt(b []byte, off int64) (n int, ferr error) {
 		ferr = io.EOF
 		clog.Tracef("read is longer than file")
 	}
+	if toRead > 0 {
+		f.readAhead(int(off/f.blkSize), int((off+int64(toRead)-1)/f.blkSize))
+	}
 	for toRead > n {
 		blkIndex := int(off / f.blkSize)
 		blkOff := off - int64(int(f.blkSize)*blkIndex)
 		if clog.LevelAt(capnslog.TRACE) {
 			clog.Tracef("getting block index %d", blkIndex)
 		}
-		blk, err := f.cache.getBlock(f.getContext(), blkIndex)
+		blk, err := f.cache.getBlock(ctx, blkIndex)
 		if err != nil {
 			return n, err
 		}
@@ -317,6 +357,15 @@ func (f *File) Close() error {
 	return nil
 }
 
+// Revoke stops the file from being written to any further, as when the
+// attachment it's written under has been taken over. Writes fail with
+// ErrLocked.
+func (f *File) Revoke() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.ReadOnly = true
+}
+
 func (f *File) Truncate(size int64) error {
 	err := f.openWrite()
 	if err != nil {
@@ -332,8 +381,13 @@ func (f *File) Truncate(size int64) error {
 	return nil
 }
 
-// Trim zeroes data in the middle of a file.
+// Trim zeroes data in the middle of a file. Only the blocks wholly inside
+// the range are zeroed; their references are dropped, so the space they took
+// is freed once the file is synced and the old blocks are collected, or
+// discarded by the file's owner; see TakeTrimmed.
 func (f *File) Trim(offset, length int64) error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
 	clog.Debugf("trimming %d %d", offset, length)
 	err := f.openWrite()
 	if err != nil {
@@ -345,7 +399,45 @@ func (f *File) Trim(offset, length int64) error {
 		blkFrom += 1
 	}
 	blkTo := (offset + length) / f.blkSize
-	return f.blocks.Trim(int(blkFrom), int(blkTo))
+	if blkTo <= blkFrom {
+		return nil
+	}
+	f.cache.trim(int(blkFrom), int(blkTo))
+	before := f.blocks.GetAllBlockRefs()
+	err = f.blocks.Trim(int(blkFrom), int(blkTo))
+	if err != nil {
+		return err
+	}
+	after := f.blocks.GetAllBlockRefs()
+	if len(after) != len(before) {
+		// The layout changed, so which blocks went isn't clear; leave
+		// them for garbage collection.
+		return nil
+	}
+	// A block shared with another that's kept, as when the blockset
+	// dedups blocks, isn't freed.
+	kept := make(map[BlockRef]bool)
+	for _, ref := range after {
+		kept[ref] = true
+	}
+	for i, ref := range before {
+		if !ref.IsZero() && ref != after[i] && !kept[ref] {
+			kept[ref] = true
+			f.trimmed = append(f.trimmed, ref)
+		}
+	}
+	return nil
+}
+
+// TakeTrimmed returns the blocks Trim has dropped since it was last called.
+// Once the file is synced without them, the blocks can be discarded, unless
+// another INode, such as a snapshot's, still refers to them.
+func (f *File) TakeTrimmed() []BlockRef {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	out := f.trimmed
+	f.trimmed = nil
+	return out
 }
 
 func (f *File) SyncAllWrites() (INodeRef, error) {
@@ -356,7 +448,11 @@ func (f *File) SyncAllWrites() (INodeRef, error) {
 	return f.SyncINode(f.getContext())
 }
 
-func (f *File) SyncINode(ctx context.Context) (INodeRef, error) {
+func (f *File) SyncINode(ctx context.Context) (_ INodeRef, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	ctx, span := StartSpan(ctx, "File.SyncINode")
+	defer func() { EndSpan(span, err) }()
 	ref := f.writeINodeRef
 	blkdata, err := MarshalBlocksetToProto(f.blocks)
 	if err != nil {
@@ -375,8 +471,12 @@ func (f *File) SyncINode(ctx context.Context) (INodeRef, error) {
 	return ref, nil
 }
 
-func (f *File) SyncBlocks() error {
-	err := f.cache.sync(f.getContext())
+func (f *File) SyncBlocks() (err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	ctx, span := StartSpan(f.getContext(), "File.SyncBlocks")
+	defer func() { EndSpan(span, err) }()
+	err = f.cache.sync(ctx)
 	if err != nil {
 		clog.Error("sync: couldn't sync block")
 		return err
@@ -1,6 +1,7 @@
 package torus
 
 import (
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -10,6 +11,7 @@ type fileCache interface {
 	newINode(ref INodeRef)
 	writeToBlock(ctx context.Context, i, from, to int, data []byte) (int, error)
 	getBlock(ctx context.Context, i int) ([]byte, error)
+	trim(from, to int)
 	sync(context.Context) error
 }
 
@@ -23,6 +25,9 @@ type singleBlockCache struct {
 
 	blocks Blockset
 
+	// readMut guards the last block read, which concurrent readers, holding
+	// only the file's read lock, replace.
+	readMut  sync.Mutex
 	readIdx  int
 	readData []byte
 
@@ -61,13 +66,16 @@ func (sb *singleBlockCache) openBlock(ctx context.Context, i int) error {
 		panic("writing beyond the end of a file without calling Truncate")
 	}
 
+	sb.readMut.Lock()
 	if sb.readIdx == i {
 		sb.openIdx = i
 		sb.openData = sb.readData
 		sb.readData = nil
 		sb.readIdx = -1
+		sb.readMut.Unlock()
 		return nil
 	}
+	sb.readMut.Unlock()
 	start := time.Now()
 	d, err := sb.blocks.GetBlock(ctx, i)
 	if err != nil {
@@ -106,28 +114,47 @@ func (sb *singleBlockCache) sync(ctx context.Context) error {
 	return err
 }
 
-func (sb *singleBlockCache) openRead(ctx context.Context, i int) error {
+func (sb *singleBlockCache) openRead(ctx context.Context, i int) ([]byte, error) {
 	start := time.Now()
 	d, err := sb.blocks.GetBlock(ctx, i)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	delta := time.Since(start)
 	promFileBlockRead.Observe(float64(delta.Nanoseconds()) / 1000)
+	sb.readMut.Lock()
 	sb.readData = d
 	sb.readIdx = i
-	return nil
+	sb.readMut.Unlock()
+	return d, nil
 }
 
 func (sb *singleBlockCache) getBlock(ctx context.Context, i int) ([]byte, error) {
 	if sb.openIdx == i {
 		return sb.openData, nil
 	}
-	if sb.readIdx != i {
-		err := sb.openRead(ctx, i)
-		if err != nil {
-			return nil, err
-		}
+	sb.readMut.Lock()
+	if sb.readIdx == i {
+		d := sb.readData
+		sb.readMut.Unlock()
+		return d, nil
+	}
+	sb.readMut.Unlock()
+	return sb.openRead(ctx, i)
+}
+
+// trim forgets the cached blocks in [from, to), which are being zeroed, so
+// that a half-finished write doesn't bring one back.
+func (sb *singleBlockCache) trim(from, to int) {
+	if sb.openIdx >= from && sb.openIdx < to {
+		sb.openIdx = -1
+		sb.openData = nil
+		sb.openWrote = false
+	}
+	sb.readMut.Lock()
+	if sb.readIdx >= from && sb.readIdx < to {
+		sb.readIdx = -1
+		sb.readData = nil
 	}
-	return sb.readData, nil
+	sb.readMut.Unlock()
 }
@@ -0,0 +1,3 @@
+// fs provides the implementation of the "file" volume type: a tree of
+// directories and files, each file a Torus file of its own.
+package fs
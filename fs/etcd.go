@@ -0,0 +1,172 @@
+package fs
+
+import (
+	"errors"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/etcd"
+	"github.com/coreos/torus/models"
+)
+
+// The mount lock shares its key with the attach lock of block volumes, so
+// that `torusctl volume list` shows mounted file volumes as in use.
+const lockKey = "blocklock"
+
+type fsEtcd struct {
+	*etcd.Etcd
+	name string
+	vid  torus.VolumeID
+}
+
+func (f *fsEtcd) getContext() context.Context {
+	return context.TODO()
+}
+
+func (f *fsEtcd) CreateFileVolume(volume *models.Volume, tree []byte) error {
+	vbytes, err := volume.Marshal()
+	if err != nil {
+		return err
+	}
+	tx := f.Etcd.Client.Txn(f.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(etcd.MkKey("volumes", volume.Name)), "=", 0),
+	).Then(
+		etcdv3.OpPut(etcd.MkKey("volumes", volume.Name), string(etcd.Uint64ToBytes(volume.Id))),
+		etcdv3.OpPut(etcd.MkKey("volumeid", etcd.Uint64ToHex(volume.Id)), string(vbytes)),
+		etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(volume.Id), "inode"), string(etcd.Uint64ToBytes(1))),
+		etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(volume.Id), "fstree"), string(tree)),
+	)
+	resp, err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrExists
+	}
+	return nil
+}
+
+func (f *fsEtcd) DeleteVolume() error {
+	vid := uint64(f.vid)
+	tx := f.Etcd.Client.Txn(f.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid), lockKey)), "=", 0),
+	).Then(
+		etcdv3.OpDelete(etcd.MkKey("volumes", f.name)),
+		etcdv3.OpDelete(etcd.MkKey("volumeid", etcd.Uint64ToHex(vid))),
+		etcdv3.OpDelete(etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid)), etcdv3.WithPrefix()),
+	)
+	resp, err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (f *fsEtcd) Lock(lease int64) (uint64, error) {
+	if lease == 0 {
+		return 0, torus.ErrInvalid
+	}
+	k := etcd.MkKey("volumemeta", etcd.Uint64ToHex(uint64(f.vid)), lockKey)
+	tx := f.Etcd.Client.Txn(f.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(k), "=", 0),
+	).Then(
+		etcdv3.OpPut(k, f.Etcd.UUID(), etcdv3.WithLease(etcdv3.LeaseID(lease))),
+	)
+	resp, err := tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, torus.ErrLocked
+	}
+	return uint64(resp.Header.Revision), nil
+}
+
+func (f *fsEtcd) Unlock() error {
+	k := etcd.MkKey("volumemeta", etcd.Uint64ToHex(uint64(f.vid)), lockKey)
+	tx := f.Etcd.Client.Txn(f.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(k), ">", 0),
+		etcdv3.Compare(etcdv3.Value(k), "=", f.Etcd.UUID()),
+	).Then(
+		etcdv3.OpDelete(k),
+	)
+	resp, err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrLocked
+	}
+	return nil
+}
+
+func (f *fsEtcd) GetTree() ([]byte, uint64, error) {
+	vid := etcd.Uint64ToHex(uint64(f.vid))
+	resp, err := f.Etcd.Client.Txn(f.getContext()).Then(
+		etcdv3.OpGet(etcd.MkKey("volumemeta", vid, "fstree")),
+		etcdv3.OpGet(etcd.MkKey("volumemeta", vid, "fstreegen")),
+	).Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+	tree := resp.Responses[0].GetResponseRange().Kvs
+	if len(tree) != 1 {
+		return nil, 0, errors.New("unexpected metadata for volume")
+	}
+	// Volumes that have never been synced since generations were added
+	// have none yet.
+	var gen uint64
+	if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) == 1 {
+		gen = etcd.BytesToUint64(kvs[0].Value)
+	}
+	return tree[0].Value, gen, nil
+}
+
+func (f *fsEtcd) SyncTree(tree []byte, gen uint64) error {
+	vid := etcd.Uint64ToHex(uint64(f.vid))
+	k := etcd.MkKey("volumemeta", vid, lockKey)
+	genKey := etcd.MkKey("volumemeta", vid, "fstreegen")
+	genCmp := etcdv3.Compare(etcdv3.Version(genKey), "=", 0)
+	if gen != 0 {
+		genCmp = etcdv3.Compare(etcdv3.Value(genKey), "=", string(etcd.Uint64ToBytes(gen)))
+	}
+	tx := f.Etcd.Client.Txn(f.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(k), ">", 0),
+		etcdv3.Compare(etcdv3.Value(k), "=", f.Etcd.UUID()),
+		genCmp,
+	).Then(
+		etcdv3.OpPut(etcd.MkKey("volumemeta", vid, "fstree"), string(tree)),
+		etcdv3.OpPut(genKey, string(etcd.Uint64ToBytes(gen+1))),
+	).Else(
+		etcdv3.OpGet(k),
+	)
+	resp, err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	if resp.Succeeded {
+		return nil
+	}
+	// Tell losing the mount from losing the race.
+	lock := resp.Responses[0].GetResponseRange().Kvs
+	if len(lock) == 0 || string(lock[0].Value) != f.Etcd.UUID() {
+		return torus.ErrLocked
+	}
+	return torus.ErrCompareFailed
+}
+
+func createFSEtcdMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (fsMetadata, error) {
+	if e, ok := mds.(*etcd.Etcd); ok {
+		return &fsEtcd{
+			Etcd: e,
+			name: name,
+			vid:  vid,
+		}, nil
+	}
+	panic("how are we creating an etcd metadata that doesn't implement it but reports as being etcd")
+}
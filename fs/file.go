@@ -0,0 +1,157 @@
+package fs
+
+import (
+	"sync"
+
+	"github.com/coreos/torus"
+)
+
+// openFile is the Torus file behind every handle on a node.
+type openFile struct {
+	mut  sync.Mutex
+	f    *torus.File
+	refs int
+	// floor is no higher than the INode the file's unsynced writes go to,
+	// or zero if there are none. It is guarded by the FS's lock.
+	floor torus.INodeID
+}
+
+// File is an open handle on a file of a mounted volume.
+type File struct {
+	fs *FS
+	n  *Node
+	of *openFile
+}
+
+// Open opens a file for reading and writing. Handles on the same file share
+// its data, so a write through one is read through the others.
+func (fs *FS) Open(n *Node) (*File, error) {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	if fs.closed {
+		return nil, torus.ErrClosed
+	}
+	if n.isDir() {
+		return nil, torus.ErrIsDir
+	}
+	of, ok := fs.open[n]
+	if !ok {
+		f, err := fs.vol.openFile(n.inode, fs.epoch)
+		if err != nil {
+			return nil, err
+		}
+		of = &openFile{f: f}
+		fs.open[n] = of
+	}
+	of.refs++
+	return &File{fs: fs, n: n, of: of}, nil
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.of.mut.Lock()
+	defer f.of.mut.Unlock()
+	return f.of.f.ReadAt(p, off)
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	f.of.mut.Lock()
+	defer f.of.mut.Unlock()
+	f.fs.mut.Lock()
+	err := f.fs.reserve(f.n, uint64(off)+uint64(len(p)))
+	f.fs.mut.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if err := f.beginWrite(); err != nil {
+		return 0, err
+	}
+	n, err := f.of.f.WriteAt(p, off)
+	f.fs.mut.Lock()
+	f.fs.resized(f.n, f.of.f.Size())
+	f.fs.mut.Unlock()
+	return n, err
+}
+
+// Truncate changes the length of the file. Growing it reads as zeroes.
+func (f *File) Truncate(size int64) error {
+	if size < 0 {
+		return torus.ErrInvalid
+	}
+	f.of.mut.Lock()
+	defer f.of.mut.Unlock()
+	f.fs.mut.Lock()
+	err := f.fs.reserve(f.n, uint64(size))
+	f.fs.mut.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := f.beginWrite(); err != nil {
+		return err
+	}
+	old := int64(f.of.f.Size())
+	// Truncating only drops whole blocks, so zero what's left of the last
+	// one, or it would come back if the file grew again.
+	blkSize := int64(f.fs.vol.mds.GlobalMetadata().BlockSize)
+	if size < old && size%blkSize != 0 {
+		end := (size/blkSize + 1) * blkSize
+		if end > old {
+			end = old
+		}
+		if _, err := f.of.f.WriteAt(make([]byte, end-size), size); err != nil {
+			return err
+		}
+	}
+	if err := f.of.f.Truncate(size); err != nil {
+		return err
+	}
+	f.fs.mut.Lock()
+	f.fs.resized(f.n, uint64(size))
+	f.fs.mut.Unlock()
+	return nil
+}
+
+// beginWrite records a floor for the INode the file is about to be written
+// to, if it isn't being written already: any INode taken from here on is
+// above the volume's INode index now. f.of.mut must be held.
+func (f *File) beginWrite() error {
+	if f.of.f.WriteOpen() {
+		return nil
+	}
+	cur, err := f.fs.vol.currentINode()
+	if err != nil {
+		return err
+	}
+	f.fs.mut.Lock()
+	f.of.floor = cur + 1
+	f.fs.mut.Unlock()
+	return nil
+}
+
+func (f *File) Size() uint64 {
+	return f.fs.Attr(f.n).Size
+}
+
+// Sync syncs the whole filesystem, so that the file is reachable from the
+// tree as well as written.
+func (f *File) Sync() error {
+	return f.fs.Sync()
+}
+
+// Close syncs the filesystem if this is the last handle on the file.
+func (f *File) Close() error {
+	f.fs.mut.Lock()
+	last := f.of.refs == 1
+	f.fs.mut.Unlock()
+	var err error
+	if last {
+		err = f.fs.Sync()
+	}
+	f.fs.mut.Lock()
+	defer f.fs.mut.Unlock()
+	f.of.refs--
+	if f.of.refs == 0 && f.fs.open[f.n] == f.of {
+		delete(f.fs.open, f.n)
+		f.of.f.Close()
+	}
+	return err
+}
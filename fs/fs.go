@@ -0,0 +1,421 @@
+package fs
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+// maxNameLen is the longest name an entry can have, as on most local
+// filesystems.
+const maxNameLen = 255
+
+// FS is a mounted file volume. Changes to it are kept until Sync, which
+// writes the files that changed and then the tree that refers to them.
+type FS struct {
+	vol   *FileVolume
+	epoch uint64
+	// generation is that of the tree as of the last sync, or the mount. A
+	// sync fails with torus.ErrCompareFailed if another writer synced the
+	// tree since.
+	generation uint64
+
+	// syncMut serializes syncs.
+	syncMut sync.Mutex
+
+	// mut guards the tree and the open files. A file's own lock, if needed,
+	// is taken first.
+	mut     sync.Mutex
+	root    *Node
+	used    uint64
+	open    map[*Node]*openFile
+	changed bool
+	closed  bool
+}
+
+// Attr describes a node.
+type Attr struct {
+	Mode    os.FileMode
+	Size    uint64
+	ModTime time.Time
+}
+
+// Dirent is an entry of a directory.
+type Dirent struct {
+	Name string
+	Node *Node
+	Mode os.FileMode
+}
+
+func newFS(vol *FileVolume, root *Node, epoch, gen uint64) *FS {
+	fs := &FS{
+		vol:        vol,
+		epoch:      epoch,
+		generation: gen,
+		root:       root,
+		open:       make(map[*Node]*openFile),
+	}
+	fs.used = usage(root)
+	return fs
+}
+
+func usage(n *Node) uint64 {
+	used := n.size
+	for _, x := range n.entries {
+		used += usage(x)
+	}
+	return used
+}
+
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || len(name) > maxNameLen || strings.ContainsAny(name, "/\x00") {
+		return torus.ErrInvalid
+	}
+	return nil
+}
+
+// Root returns the root directory.
+func (fs *FS) Root() *Node {
+	return fs.root
+}
+
+// Statfs returns how many bytes the volume can hold, and how many its files
+// take.
+func (fs *FS) Statfs() (size, used uint64) {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	return fs.vol.volume.MaxBytes, fs.used
+}
+
+func (fs *FS) Attr(n *Node) Attr {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	return Attr{
+		Mode:    n.mode,
+		Size:    n.size,
+		ModTime: n.modTime,
+	}
+}
+
+func (fs *FS) Lookup(dir *Node, name string) (*Node, error) {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	return lookup(dir, name)
+}
+
+func lookup(dir *Node, name string) (*Node, error) {
+	if !dir.isDir() {
+		return nil, torus.ErrNotDir
+	}
+	n, ok := dir.entries[name]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return n, nil
+}
+
+// Walk looks up a slash-separated path from the root.
+func (fs *FS) Walk(path string) (*Node, error) {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	n := fs.root
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		var err error
+		n, err = lookup(n, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// ReadDir returns the entries of a directory, sorted by name.
+func (fs *FS) ReadDir(dir *Node) ([]Dirent, error) {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	if !dir.isDir() {
+		return nil, torus.ErrNotDir
+	}
+	out := make([]Dirent, 0, len(dir.entries))
+	for name, n := range dir.entries {
+		out = append(out, Dirent{Name: name, Node: n, Mode: n.mode})
+	}
+	sort.Sort(direntsByName(out))
+	return out, nil
+}
+
+type direntsByName []Dirent
+
+func (d direntsByName) Len() int           { return len(d) }
+func (d direntsByName) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d direntsByName) Less(i, j int) bool { return d[i].Name < d[j].Name }
+
+func (fs *FS) Mkdir(dir *Node, name string, perm os.FileMode) (*Node, error) {
+	return fs.add(dir, name, newDir(perm))
+}
+
+// Create makes an empty file. It doesn't open it.
+func (fs *FS) Create(dir *Node, name string, perm os.FileMode) (*Node, error) {
+	return fs.add(dir, name, newFile(perm))
+}
+
+func (fs *FS) add(dir *Node, name string, n *Node) (*Node, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	if !dir.isDir() {
+		return nil, torus.ErrNotDir
+	}
+	if _, ok := dir.entries[name]; ok {
+		return nil, torus.ErrExists
+	}
+	dir.entries[name] = n
+	dir.modTime = n.modTime
+	fs.changed = true
+	return n, nil
+}
+
+// Remove removes a file or an empty directory. A file that is open stays
+// readable and writable until it is closed.
+func (fs *FS) Remove(dir *Node, name string) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	n, err := lookup(dir, name)
+	if err != nil {
+		return err
+	}
+	if n.isDir() && len(n.entries) != 0 {
+		return torus.ErrNotEmpty
+	}
+	fs.unlink(dir, name, n)
+	return nil
+}
+
+// unlink takes n out of the tree. fs.mut must be held.
+func (fs *FS) unlink(dir *Node, name string, n *Node) {
+	delete(dir.entries, name)
+	dir.modTime = time.Now()
+	n.removed = true
+	fs.used -= n.size
+	fs.changed = true
+}
+
+// Rename moves an entry, replacing whatever was at the new name as long as
+// it is of the same kind and, if it is a directory, empty.
+func (fs *FS) Rename(dir *Node, name string, newDir *Node, newName string) error {
+	if err := validName(newName); err != nil {
+		return err
+	}
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	n, err := lookup(dir, name)
+	if err != nil {
+		return err
+	}
+	if !newDir.isDir() {
+		return torus.ErrNotDir
+	}
+	if n.isDir() && n.contains(newDir) {
+		return torus.ErrInvalid
+	}
+	if old, ok := newDir.entries[newName]; ok {
+		if old == n {
+			return nil
+		}
+		switch {
+		case n.isDir() && !old.isDir():
+			return torus.ErrNotDir
+		case !n.isDir() && old.isDir():
+			return torus.ErrIsDir
+		case old.isDir() && len(old.entries) != 0:
+			return torus.ErrNotEmpty
+		}
+		fs.unlink(newDir, newName, old)
+	}
+	delete(dir.entries, name)
+	newDir.entries[newName] = n
+	now := time.Now()
+	dir.modTime = now
+	newDir.modTime = now
+	fs.changed = true
+	return nil
+}
+
+func (fs *FS) Chmod(n *Node, perm os.FileMode) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	n.mode = n.mode&os.ModeType | perm.Perm()
+	fs.changed = true
+	return nil
+}
+
+func (fs *FS) Chtimes(n *Node, mtime time.Time) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	n.modTime = mtime
+	fs.changed = true
+	return nil
+}
+
+// Truncate changes the length of a file, whether or not it is open.
+func (fs *FS) Truncate(n *Node, size int64) error {
+	f, err := fs.Open(n)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// reserve checks that a file can grow to size. fs.mut must be held.
+func (fs *FS) reserve(n *Node, size uint64) error {
+	if size <= n.size || n.removed {
+		return nil
+	}
+	if fs.used+size-n.size > fs.vol.volume.MaxBytes {
+		return torus.ErrOutOfSpace
+	}
+	return nil
+}
+
+// resized records a file's new length. fs.mut must be held.
+func (fs *FS) resized(n *Node, size uint64) {
+	if !n.removed {
+		fs.used = fs.used - n.size + size
+	}
+	n.size = size
+	n.modTime = time.Now()
+}
+
+// Sync writes every file that changed since the last sync, and then the
+// tree.
+func (fs *FS) Sync() error {
+	fs.syncMut.Lock()
+	defer fs.syncMut.Unlock()
+	return fs.sync()
+}
+
+func (fs *FS) sync() error {
+	fs.mut.Lock()
+	open := make(map[*Node]*openFile, len(fs.open))
+	for n, of := range fs.open {
+		open[n] = of
+	}
+	fs.mut.Unlock()
+
+	for n, of := range open {
+		of.mut.Lock()
+		err := fs.syncFile(n, of)
+		of.mut.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	if !fs.changed {
+		return nil
+	}
+	highwater, err := fs.highwater()
+	if err != nil {
+		return err
+	}
+	data, err := marshalTree(fs.root, highwater)
+	if err != nil {
+		return err
+	}
+	err = fs.vol.mds.SyncTree(data, fs.generation)
+	if err == torus.ErrCompareFailed {
+		clog.Errorf("file volume %s was synced by another writer since generation %d; not overwriting it", fs.vol.volume.Name, fs.generation)
+	}
+	if err != nil {
+		return err
+	}
+	fs.generation++
+	fs.changed = false
+	return nil
+}
+
+// highwater returns the lowest INode that writes not yet in the tree could
+// be using. Every write from now on takes an INode above the current one,
+// and every one in flight already has a floor. fs.mut must be held.
+func (fs *FS) highwater() (torus.INodeID, error) {
+	cur, err := fs.vol.currentINode()
+	if err != nil {
+		return 0, err
+	}
+	highwater := cur + 1
+	for _, of := range fs.open {
+		if of.floor != 0 && of.floor < highwater {
+			highwater = of.floor
+		}
+	}
+	return highwater, nil
+}
+
+// syncFile writes an open file's blocks and INode. of.mut must be held.
+func (fs *FS) syncFile(n *Node, of *openFile) error {
+	if !of.f.WriteOpen() {
+		return nil
+	}
+	if err := of.f.SyncBlocks(); err != nil {
+		return err
+	}
+	ref, err := of.f.SyncINode(fs.inodeContext())
+	if err != nil {
+		return err
+	}
+	fs.mut.Lock()
+	n.inode = ref.INode
+	n.synced = of.f.Size()
+	of.floor = 0
+	fs.changed = true
+	fs.mut.Unlock()
+	return nil
+}
+
+func (fs *FS) inodeContext() context.Context {
+	ctx := torus.WithWriteLevel(context.TODO(), torus.WriteAll)
+	if fs.epoch != 0 {
+		ctx = torus.WithWriteEpoch(ctx, fs.epoch)
+	}
+	return ctx
+}
+
+// Close syncs the filesystem, closes its files and gives up the volume.
+func (fs *FS) Close() (err error) {
+	defer func() {
+		unlockErr := fs.vol.mds.Unlock()
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+	fs.syncMut.Lock()
+	defer fs.syncMut.Unlock()
+	if err = fs.sync(); err != nil {
+		return err
+	}
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	fs.closed = true
+	for n, of := range fs.open {
+		of.f.Close()
+		delete(fs.open, n)
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	_ "github.com/coreos/torus/metadata/temp"
+	_ "github.com/coreos/torus/storage"
+	"golang.org/x/net/context"
+)
+
+func mountNew(t *testing.T, srv *torus.Server, size uint64) *FS {
+	if err := CreateFileVolume(srv.MDS, "files", size); err != nil {
+		t.Fatal(err)
+	}
+	return remount(t, srv)
+}
+
+func remount(t *testing.T, srv *torus.Server) *FS {
+	vol, err := OpenFileVolume(srv, "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := vol.Mount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func readAll(t *testing.T, f *File) []byte {
+	buf := make([]byte, f.Size())
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestReadWriteTruncate(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	bs := int(srv.MDS.GlobalMetadata().BlockSize)
+	fs := mountNew(t, srv, uint64(10*bs))
+
+	dir, err := fs.Mkdir(fs.Root(), "dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := fs.Create(dir, "a", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Create(dir, "a", 0644); err != torus.ErrExists {
+		t.Fatalf("expected ErrExists creating a file twice, got %v", err)
+	}
+	f, err := fs.Open(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("torus"), bs)
+	if _, err := f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, f); !bytes.Equal(got, data) {
+		t.Fatal("read back different data")
+	}
+	// Shrinking into a block and growing again reads zeroes past the cut.
+	if err := f.Truncate(int64(bs + 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(int64(2 * bs)); err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte{}, data[:bs+3]...), make([]byte, bs-3)...)
+	if got := readAll(t, f); !bytes.Equal(got, want) {
+		t.Fatal("truncated file has stale data past its end")
+	}
+	if _, err := f.WriteAt(make([]byte, 11*bs), 0); err != torus.ErrOutOfSpace {
+		t.Fatalf("expected ErrOutOfSpace past the volume size, got %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename(dir, "a", fs.Root(), "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename(fs.Root(), "dir", dir, "sub"); err != torus.ErrInvalid {
+		t.Fatalf("expected ErrInvalid moving a directory into itself, got %v", err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs = remount(t, srv)
+	defer fs.Close()
+	ents, err := fs.ReadDir(fs.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 2 || ents[0].Name != "b" || ents[1].Name != "dir" {
+		t.Fatalf("unexpected entries %v", ents)
+	}
+	n, err = fs.Walk("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err = fs.Open(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, f); !bytes.Equal(got, want) {
+		t.Fatal("file changed across a remount")
+	}
+	f.Close()
+	if _, err := fs.Open(fs.Root()); err != torus.ErrIsDir {
+		t.Fatalf("expected ErrIsDir opening a directory, got %v", err)
+	}
+	if err := fs.Remove(fs.Root(), "dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Walk("dir"); err != torus.ErrNotExist {
+		t.Fatalf("expected ErrNotExist after removing, got %v", err)
+	}
+}
+
+func TestMountLocks(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	fs := mountNew(t, srv, 1<<20)
+	vol, err := OpenFileVolume(srv, "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vol.Mount(); err != torus.ErrLocked {
+		t.Fatalf("expected ErrLocked mounting twice, got %v", err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFileVolume(srv.MDS, "files"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	stale := mountNew(t, srv, 1<<20)
+	if _, err := stale.Create(stale.Root(), "a", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := stale.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	// The mount is lost, as when its lease expires, and the volume is
+	// mounted again by the same server, which syncs first.
+	if err := stale.vol.mds.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	fresh := remount(t, srv)
+	if _, err := fresh.Create(fresh.Root(), "b", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old mount still holds the server's lock, but its tree is behind.
+	if _, err := stale.Create(stale.Root(), "c", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := stale.Sync(); err != torus.ErrCompareFailed {
+		t.Fatalf("expected ErrCompareFailed syncing a stale tree, got %v", err)
+	}
+	if err := stale.Sync(); err != torus.ErrCompareFailed {
+		t.Fatalf("expected the stale mount to keep failing, got %v", err)
+	}
+	if err := fresh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs := remount(t, srv)
+	defer fs.Close()
+	for name, want := range map[string]bool{"a": true, "b": true, "c": false} {
+		_, err := fs.Lookup(fs.Root(), name)
+		if got := err == nil; got != want {
+			t.Errorf("%s: expected it to exist: %v, got error %v", name, want, err)
+		}
+	}
+}
+
+func TestGCKeepsSyncedFiles(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	bs := int(srv.MDS.GlobalMetadata().BlockSize)
+	fs := mountNew(t, srv, 1<<20)
+	defer fs.Close()
+
+	n, err := fs.Create(fs.Root(), "a", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Open(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refsOf := func() []torus.BlockRef {
+		if err := f.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		inode, err := srv.INodes.GetINode(context.TODO(), torus.NewINodeRef(torus.VolumeID(fs.vol.volume.Id), n.inode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		set, err := blockset.UnmarshalFromProto(inode.Blocks, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return set.GetAllBlockRefs()
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte{1}, bs), 0); err != nil {
+		t.Fatal(err)
+	}
+	old := refsOf()
+	if _, err := f.WriteAt(bytes.Repeat([]byte{2}, bs), 0); err != nil {
+		t.Fatal(err)
+	}
+	cur := refsOf()
+	f.Close()
+
+	g, err := NewFileVolGC(srv, srv.INodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol, err := srv.MDS.GetVolume("files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.PrepVolume(vol); err != nil {
+		t.Fatal(err)
+	}
+	if !g.IsDead(old[0]) {
+		t.Error("overwritten block should be dead")
+	}
+	if g.IsDead(cur[0]) {
+		t.Error("current block shouldn't be dead")
+	}
+
+	// A file with unsynced writes keeps the highwater at or below its
+	// INode, even when a file written after it is synced.
+	a, err := fs.Open(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.WriteAt([]byte{3}, 0); err != nil {
+		t.Fatal(err)
+	}
+	inflight, err := fs.vol.currentINode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bn, err := fs.Create(fs.Root(), "b", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.Open(bn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.WriteAt([]byte{4}, 0); err != nil {
+		t.Fatal(err)
+	}
+	b.of.mut.Lock()
+	err = fs.syncFile(bn, b.of)
+	b.of.mut.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.mut.Lock()
+	hw, err := fs.highwater()
+	fs.mut.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hw > inflight {
+		t.Errorf("highwater %d is above unsynced INode %d", hw, inflight)
+	}
+	a.Close()
+	b.Close()
+}
@@ -0,0 +1,126 @@
+package fs
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	"github.com/coreos/torus/gc"
+	"github.com/coreos/torus/models"
+)
+
+func init() {
+	gc.RegisterGC("filevol", NewFileVolGC)
+}
+
+// filevolGC keeps the blocks of every file in the synced trees of file
+// volumes. Like the blockvol GC, it leaves INodes from a volume's highwater
+// up alone, since they may be writes in flight.
+type filevolGC struct {
+	srv        *torus.Server
+	inodes     gc.INodeFetcher
+	set        map[torus.BlockRef]bool
+	highwaters map[torus.VolumeID]torus.INodeID
+	curINodes  []torus.INodeRef
+	// others are the volumes of other types, which are for their own GCs.
+	others map[torus.VolumeID]bool
+}
+
+func NewFileVolGC(srv *torus.Server, inodes gc.INodeFetcher) (gc.GC, error) {
+	f := &filevolGC{
+		srv:    srv,
+		inodes: inodes,
+	}
+	f.Clear()
+	return f, nil
+}
+
+func (f *filevolGC) getContext() context.Context {
+	ctx, _ := context.WithTimeout(context.TODO(), 2*time.Second)
+	return f.srv.ExtendContext(ctx)
+}
+
+func (f *filevolGC) PrepVolume(vol *models.Volume) error {
+	vid := torus.VolumeID(vol.Id)
+	if vol.Type != VolumeType {
+		f.others[vid] = true
+		return nil
+	}
+	mds, err := createFSMetadata(f.srv.MDS, vol.Name, vid)
+	if err != nil {
+		return err
+	}
+	tree, _, err := mds.GetTree()
+	if err != nil {
+		return err
+	}
+	ids, highwater, err := treeINodes(tree)
+	if err != nil {
+		return err
+	}
+	f.highwaters[vid] = highwater
+	for _, id := range ids {
+		ref := torus.NewINodeRef(vid, id)
+		inode, err := f.inodes.GetINode(f.getContext(), ref)
+		if err != nil {
+			return err
+		}
+		set, err := blockset.UnmarshalFromProto(inode.Blocks, nil)
+		if err != nil {
+			return err
+		}
+		for _, bref := range set.GetAllBlockRefs() {
+			if bref.IsZero() {
+				continue
+			}
+			f.set[bref] = true
+		}
+		f.curINodes = append(f.curINodes, ref)
+	}
+	return nil
+}
+
+func (f *filevolGC) IsDead(ref torus.BlockRef) bool {
+	if f.others[ref.Volume()] {
+		return false
+	}
+	v, ok := f.highwaters[ref.Volume()]
+	if !ok {
+		if clog.LevelAt(capnslog.TRACE) {
+			clog.Tracef("%s doesn't exist anymore", ref)
+		}
+		return true
+	}
+	// Possibly a write that isn't synced yet.
+	if ref.INode >= v {
+		return false
+	}
+	if ref.BlockType() == torus.TypeINode {
+		for _, x := range f.curINodes {
+			if ref.HasINode(x, torus.TypeINode) {
+				return false
+			}
+		}
+		if clog.LevelAt(capnslog.TRACE) {
+			clog.Tracef("%s is a dead INode", ref)
+		}
+		return true
+	}
+	if f.set[ref] {
+		return false
+	}
+	if clog.LevelAt(capnslog.TRACE) {
+		clog.Tracef("%s is dead", ref)
+	}
+	return true
+}
+
+func (f *filevolGC) Clear() {
+	f.highwaters = make(map[torus.VolumeID]torus.INodeID)
+	f.curINodes = make([]torus.INodeRef, 0, len(f.curINodes))
+	f.set = make(map[torus.BlockRef]bool)
+	f.others = make(map[torus.VolumeID]bool)
+}
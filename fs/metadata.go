@@ -0,0 +1,42 @@
+package fs
+
+import (
+	"errors"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "fs")
+
+type fsMetadata interface {
+	torus.MetadataService
+
+	// Lock mounts the volume, returning the epoch of the mount. Like a block
+	// volume, a file volume is mounted by one server at a time.
+	Lock(lease int64) (epoch uint64, err error)
+	Unlock() error
+
+	// GetTree returns the volume's namespace as of its last sync, and its
+	// generation, which every sync increments. SyncTree replaces it, but
+	// only if it's still at generation gen, so that a writer that lost the
+	// volume to another can't overwrite what the other synced; otherwise
+	// it returns torus.ErrCompareFailed.
+	GetTree() (tree []byte, gen uint64, err error)
+	SyncTree(tree []byte, gen uint64) error
+
+	CreateFileVolume(vol *models.Volume, tree []byte) error
+	DeleteVolume() error
+}
+
+func createFSMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (fsMetadata, error) {
+	switch mds.Kind() {
+	case torus.EtcdMetadata:
+		return createFSEtcdMetadata(mds, name, vid)
+	case torus.TempMetadata:
+		return createFSTempMetadata(mds, name, vid)
+	default:
+		return nil, errors.New("unimplemented for this kind of metadata")
+	}
+}
@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"fmt"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+)
+
+type fsTempMetadata struct {
+	*temp.Client
+	name string
+	vid  torus.VolumeID
+}
+
+type fsTempVolumeData struct {
+	locked     string
+	epoch      uint64
+	tree       []byte
+	generation uint64
+}
+
+func (f *fsTempMetadata) CreateFileVolume(volume *models.Volume, tree []byte) error {
+	f.LockData()
+	defer f.UnlockData()
+	if _, ok := f.GetData(fmt.Sprint(volume.Id)); ok {
+		return torus.ErrExists
+	}
+	if f.VolumeExists(volume.Name) {
+		return torus.ErrExists
+	}
+	f.CreateVolume(volume)
+	f.SetData(fmt.Sprint(volume.Id), &fsTempVolumeData{tree: tree})
+	return nil
+}
+
+func (f *fsTempMetadata) getData() (*fsTempVolumeData, error) {
+	v, ok := f.GetData(fmt.Sprint(f.vid))
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return v.(*fsTempVolumeData), nil
+}
+
+func (f *fsTempMetadata) Lock(lease int64) (uint64, error) {
+	f.LockData()
+	defer f.UnlockData()
+	d, err := f.getData()
+	if err != nil {
+		return 0, err
+	}
+	if d.locked != "" {
+		return 0, torus.ErrLocked
+	}
+	d.locked = f.UUID()
+	d.epoch++
+	return d.epoch, nil
+}
+
+func (f *fsTempMetadata) Unlock() error {
+	f.LockData()
+	defer f.UnlockData()
+	d, err := f.getData()
+	if err != nil {
+		return err
+	}
+	if d.locked != f.UUID() {
+		return torus.ErrLocked
+	}
+	d.locked = ""
+	return nil
+}
+
+func (f *fsTempMetadata) GetTree() ([]byte, uint64, error) {
+	f.LockData()
+	defer f.UnlockData()
+	d, err := f.getData()
+	if err != nil {
+		return nil, 0, err
+	}
+	return d.tree, d.generation, nil
+}
+
+func (f *fsTempMetadata) SyncTree(tree []byte, gen uint64) error {
+	f.LockData()
+	defer f.UnlockData()
+	d, err := f.getData()
+	if err != nil {
+		return err
+	}
+	if d.locked != f.UUID() {
+		return torus.ErrLocked
+	}
+	if d.generation != gen {
+		return torus.ErrCompareFailed
+	}
+	d.tree = tree
+	d.generation++
+	return nil
+}
+
+func (f *fsTempMetadata) DeleteVolume() error {
+	f.LockData()
+	d, err := f.getData()
+	if err != nil {
+		f.UnlockData()
+		return err
+	}
+	if d.locked != "" && d.locked != f.UUID() {
+		f.UnlockData()
+		return torus.ErrLocked
+	}
+	// The client takes the data lock itself.
+	f.UnlockData()
+	return f.Client.DeleteVolume(f.name)
+}
+
+func createFSTempMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (fsMetadata, error) {
+	if t, ok := mds.(*temp.Client); ok {
+		return &fsTempMetadata{
+			Client: t,
+			name:   name,
+			vid:    vid,
+		}, nil
+	}
+	panic("how are we creating a temp metadata that doesn't implement it but reports as being temp")
+}
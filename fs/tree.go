@@ -0,0 +1,151 @@
+package fs
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// Node is a directory or file of a mounted file volume.
+type Node struct {
+	mode    os.FileMode
+	modTime time.Time
+	entries map[string]*Node
+
+	// size is the length of the file, including writes since the last sync.
+	size uint64
+	// inode and synced are the file's INode and length as of its last sync.
+	// The INode is zero for a file that has never been synced.
+	inode  torus.INodeID
+	synced uint64
+	// removed is set once the node is no longer in the tree, though it may
+	// still be open.
+	removed bool
+}
+
+func newDir(perm os.FileMode) *Node {
+	return &Node{
+		mode:    os.ModeDir | perm.Perm(),
+		modTime: time.Now(),
+		entries: make(map[string]*Node),
+	}
+}
+
+func newFile(perm os.FileMode) *Node {
+	return &Node{
+		mode:    perm.Perm(),
+		modTime: time.Now(),
+	}
+}
+
+func (n *Node) isDir() bool {
+	return n.mode.IsDir()
+}
+
+// contains reports whether o is n or below it.
+func (n *Node) contains(o *Node) bool {
+	if n == o {
+		return true
+	}
+	for _, x := range n.entries {
+		if x.contains(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// The whole tree of a volume is stored as one metadata value, which is what
+// limits file volumes to testing and light workloads: a sync rewrites it,
+// and etcd keeps values to a megabyte or so.
+type tree struct {
+	Root *treeNode `json:"root"`
+	// Highwater is the lowest INode a write that wasn't synced yet could
+	// have used; the GC leaves INodes from it up alone.
+	Highwater uint64 `json:"highwater,omitempty"`
+}
+
+type treeNode struct {
+	Mode    os.FileMode          `json:"mode"`
+	ModTime time.Time            `json:"mtime"`
+	Size    uint64               `json:"size,omitempty"`
+	INode   uint64               `json:"inode,omitempty"`
+	Entries map[string]*treeNode `json:"entries,omitempty"`
+}
+
+func toTreeNode(n *Node) *treeNode {
+	t := &treeNode{
+		Mode:    n.mode,
+		ModTime: n.modTime,
+		Size:    n.synced,
+		INode:   uint64(n.inode),
+	}
+	if n.isDir() {
+		t.Entries = make(map[string]*treeNode, len(n.entries))
+		for name, x := range n.entries {
+			t.Entries[name] = toTreeNode(x)
+		}
+	}
+	return t
+}
+
+func fromTreeNode(t *treeNode) *Node {
+	n := &Node{
+		mode:    t.Mode,
+		modTime: t.ModTime,
+		size:    t.Size,
+		synced:  t.Size,
+		inode:   torus.INodeID(t.INode),
+	}
+	if n.isDir() {
+		n.entries = make(map[string]*Node, len(t.Entries))
+		for name, x := range t.Entries {
+			n.entries[name] = fromTreeNode(x)
+		}
+	}
+	return n
+}
+
+func marshalTree(root *Node, highwater torus.INodeID) ([]byte, error) {
+	return json.Marshal(tree{
+		Root:      toTreeNode(root),
+		Highwater: uint64(highwater),
+	})
+}
+
+func unmarshalTree(data []byte) (*Node, error) {
+	var t tree
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	if t.Root == nil || !t.Root.Mode.IsDir() {
+		return nil, torus.ErrNotDir
+	}
+	return fromTreeNode(t.Root), nil
+}
+
+// treeINodes returns the INodes of every synced file in a stored tree, and
+// its highwater.
+func treeINodes(data []byte) ([]torus.INodeID, torus.INodeID, error) {
+	var t tree
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, 0, err
+	}
+	var out []torus.INodeID
+	var walk func(*treeNode)
+	walk = func(t *treeNode) {
+		if t == nil {
+			return
+		}
+		if t.INode != 0 {
+			out = append(out, torus.INodeID(t.INode))
+		}
+		for _, x := range t.Entries {
+			walk(x)
+		}
+	}
+	walk(t.Root)
+	return out, torus.INodeID(t.Highwater), nil
+}
@@ -0,0 +1,154 @@
+package fs
+
+import (
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	"github.com/coreos/torus/models"
+	"golang.org/x/net/context"
+)
+
+const VolumeType = "file"
+
+type FileVolume struct {
+	srv    *torus.Server
+	mds    fsMetadata
+	volume *models.Volume
+
+	// IOClass is how urgent the I/O of the volume's files is.
+	IOClass torus.IOClass
+}
+
+// CreateFileVolume creates an empty file volume that can hold up to size
+// bytes of files.
+func CreateFileVolume(mds torus.MetadataService, volume string, size uint64) error {
+	if err := torus.CheckNewVolume(mds, size); err != nil {
+		return err
+	}
+	id, err := mds.NewVolumeID()
+	if err != nil {
+		return err
+	}
+	fsmd, err := createFSMetadata(mds, volume, id)
+	if err != nil {
+		return err
+	}
+	tree, err := marshalTree(newDir(0755), 0)
+	if err != nil {
+		return err
+	}
+	return fsmd.CreateFileVolume(&models.Volume{
+		Name:     volume,
+		Id:       uint64(id),
+		Type:     VolumeType,
+		MaxBytes: size,
+	}, tree)
+}
+
+func OpenFileVolume(s *torus.Server, volume string) (*FileVolume, error) {
+	vol, err := s.MDS.GetVolume(volume)
+	if err != nil {
+		return nil, err
+	}
+	if vol.Type != VolumeType {
+		return nil, torus.ErrWrongVolumeType
+	}
+	mds, err := createFSMetadata(s.MDS, vol.Name, torus.VolumeID(vol.Id))
+	if err != nil {
+		return nil, err
+	}
+	return &FileVolume{
+		srv:    s,
+		mds:    mds,
+		volume: vol,
+	}, nil
+}
+
+func DeleteFileVolume(mds torus.MetadataService, volume string) error {
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return err
+	}
+	fsmd, err := createFSMetadata(mds, vol.Name, torus.VolumeID(vol.Id))
+	if err != nil {
+		return err
+	}
+	return fsmd.DeleteVolume()
+}
+
+// Mount takes the volume for this server, which keeps it until the returned
+// FS is closed, and loads its namespace.
+func (v *FileVolume) Mount() (fs *FS, err error) {
+	err = torus.CheckAccess(v.srv.MDS, torus.VolumeID(v.volume.Id), v.srv.Cfg.Identity, torus.PermWrite)
+	if err != nil {
+		return nil, err
+	}
+	epoch, err := v.mds.Lock(v.srv.Lease())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			v.mds.Unlock()
+		}
+	}()
+	data, gen, err := v.mds.GetTree()
+	if err != nil {
+		return nil, err
+	}
+	root, err := unmarshalTree(data)
+	if err != nil {
+		return nil, err
+	}
+	return newFS(v, root, epoch, gen), nil
+}
+
+// currentINode returns the last INode taken from the volume.
+func (v *FileVolume) currentINode() (torus.INodeID, error) {
+	return v.srv.MDS.GetINodeIndex(torus.VolumeID(v.volume.Id))
+}
+
+func (v *FileVolume) getContext() context.Context {
+	return context.TODO()
+}
+
+// getOrCreateINode fetches a file's INode, or makes an empty one for a file
+// that has never been synced.
+func (v *FileVolume) getOrCreateINode(id torus.INodeID) (*models.INode, error) {
+	if id != 0 {
+		return v.srv.INodes.GetINode(v.getContext(), torus.NewINodeRef(torus.VolumeID(v.volume.Id), id))
+	}
+	spec := v.mds.GlobalMetadata().DefaultBlockSpec
+	red, err := torus.GetRedundancy(v.srv.MDS, torus.VolumeID(v.volume.Id))
+	if err != nil {
+		return nil, err
+	}
+	if red.Kind == torus.ErasureCoded {
+		spec = blockset.WithErasureCoding(spec, red.Data, red.Parity)
+	}
+	bs, err := blockset.CreateBlocksetFromSpec(spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	inode := models.NewEmptyINode()
+	inode.Volume = v.volume.Id
+	inode.Blocks, err = torus.MarshalBlocksetToProto(bs)
+	return inode, err
+}
+
+func (v *FileVolume) openFile(id torus.INodeID, epoch uint64) (*torus.File, error) {
+	inode, err := v.getOrCreateINode(id)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := blockset.UnmarshalFromProto(inode.GetBlocks(), v.srv.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	f, err := v.srv.CreateFile(v.volume, inode, bs)
+	if err != nil {
+		return nil, err
+	}
+	f.Epoch = epoch
+	f.IOClass = v.IOClass
+	return f, nil
+}
@@ -0,0 +1,68 @@
+package torus
+
+// Problems FsckBlocks can have.
+const (
+	// FsckOrphan is a block no volume uses anymore.
+	FsckOrphan = "orphan"
+	// FsckMisplaced is a block stored on a peer the current ring doesn't
+	// put it on.
+	FsckMisplaced = "misplaced"
+	// FsckMissing is a block missing from one of the peers the current
+	// ring puts it on.
+	FsckMissing = "missing"
+)
+
+// FsckMaxListed is how many of the problem blocks a peer finds it lists in
+// its report; the counts cover them all.
+const FsckMaxListed = 100
+
+// FsckRequest asks every peer to check its blocks against the metadata and
+// the current ring.
+type FsckRequest struct {
+	// Requested is when the check was asked for, in Unix nanoseconds. It
+	// tells one request from the next.
+	Requested int64
+	// Fix makes peers fix what they find: delete orphans, move misplaced
+	// blocks to where they belong and copy blocks to the peers missing them.
+	Fix bool
+}
+
+// FsckBlock is a problem a peer found with a block it stores.
+type FsckBlock struct {
+	Ref     BlockRef
+	Problem string
+	// Peer is the peer missing the block, for FsckMissing.
+	Peer  string
+	Fixed bool
+}
+
+// FsckReport is what a peer's check found.
+type FsckReport struct {
+	Peer string
+	// Requested is that of the request the report answers.
+	Requested int64
+	Finished  int64
+	Checked   uint64
+	Orphans   uint64
+	Misplaced uint64
+	Missing   uint64
+	Fixed     uint64
+	// Blocks are the first FsckMaxListed problem blocks found.
+	Blocks []FsckBlock
+	// Errors are why parts of the check couldn't be done, such as peers
+	// that couldn't be asked which blocks they have.
+	Errors []string
+}
+
+// FsckMetadataService is implemented by metadata services that can
+// coordinate checks of every peer's blocks.
+type FsckMetadataService interface {
+	RequestFsck(FsckRequest) error
+	// GetFsckRequest returns the latest request, or a zero one if there's
+	// been none.
+	GetFsckRequest() (FsckRequest, error)
+
+	// SaveFsckReport saves this peer's report, replacing the last one.
+	SaveFsckReport(r *FsckReport) error
+	GetFsckReports() ([]*FsckReport, error)
+}
@@ -0,0 +1,44 @@
+package torus
+
+// GCStatus is how far a peer's garbage collector has got. Peers save it as
+// they go, so that a restarted peer picks up where it left off.
+type GCStatus struct {
+	Peer string
+	// Generation counts the peer's passes over its blocks. Each pass marks
+	// the blocks the cluster's volumes use, then sweeps the rest away; blocks
+	// of volumes and INodes newer than its marks belong to the next
+	// generation, and are left alone.
+	Generation uint64
+	// Marking is set while the pass is marking, and Sweeping while it's
+	// sweeping.
+	Marking  bool
+	Sweeping bool
+	// Last is the last block the pass has swept. Passes visit blocks in
+	// order of volume, inode and index.
+	Last BlockRef
+	// Swept and Total are how many of the local blocks listed for the pass
+	// it has swept so far.
+	Swept uint64
+	Total uint64
+	// PassStart is when the current or last pass started, and PassFinish
+	// when the last complete pass finished, in Unix nanoseconds.
+	PassStart  int64
+	PassFinish int64
+	// Reclaimed and BytesFreed count the blocks deleted over every pass.
+	Reclaimed  uint64
+	BytesFreed uint64
+	// Saved is when the status was saved, in Unix nanoseconds.
+	Saved int64
+}
+
+// GCMetadataService is implemented by metadata services that can keep the
+// garbage collection progress of peers.
+type GCMetadataService interface {
+	// SaveGCStatus saves this peer's status. Unlike most of a peer's state,
+	// it isn't tied to a lease, since it's for after the peer restarts.
+	SaveGCStatus(s *GCStatus) error
+	// GetGCStatus returns this peer's status, or nil if it has none.
+	GetGCStatus() (*GCStatus, error)
+	// GetGCStatuses returns the status of every peer that has saved one.
+	GetGCStatuses() ([]*GCStatus, error)
+}
@@ -0,0 +1,346 @@
+package gc
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+// How often a Collector saves its status while a pass is underway.
+var gcSaveInterval = 10 * time.Second
+
+// Collector deletes the local blocks no volume uses anymore, a bounded amount
+// of work at a time. Each pass, or generation, first marks what every volume
+// uses, one volume per cycle, and then sweeps the local blocks in order, a
+// batch per cycle. Blocks of volumes and INodes newer than the marks are left
+// for the next generation, so nothing has to stop while it runs.
+type Collector struct {
+	srv    *torus.Server
+	bs     torus.BlockStore
+	inodes INodeFetcher
+
+	// marks are those of the last pass that finished marking, which IsDead
+	// answers from.
+	mut   sync.RWMutex
+	marks GC
+
+	marking GC
+	toMark  []*models.Volume
+	marked  map[torus.VolumeID]bool
+	// maxVolume is the highest volume ID when the pass began. young are the
+	// volumes created since then that were listed before its sweep, and
+	// those that couldn't be marked.
+	maxVolume torus.VolumeID
+	young     map[torus.VolumeID]bool
+
+	refs     []torus.BlockRef
+	status   torus.GCStatus
+	resume   *torus.GCStatus
+	loaded   bool
+	lastSave time.Time
+}
+
+// NewCollector returns a Collector of the dead blocks in bs.
+func NewCollector(srv *torus.Server, bs torus.BlockStore, inodes INodeFetcher) *Collector {
+	return &Collector{
+		srv:    srv,
+		bs:     bs,
+		inodes: inodes,
+		status: torus.GCStatus{Peer: srv.MDS.UUID()},
+	}
+}
+
+// Status returns the collector's progress.
+func (c *Collector) Status() torus.GCStatus {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.status
+}
+
+// Marks returns a GC that answers IsDead from the collector's latest marks,
+// so that other passes over the local blocks, such as rebalancing, can pass
+// over dead ones. Until a pass has finished marking, nothing is dead.
+// Preparing and clearing it do nothing; the collector does that itself.
+func (c *Collector) Marks() GC {
+	return collectorMarks{c}
+}
+
+type collectorMarks struct {
+	c *Collector
+}
+
+func (m collectorMarks) PrepVolume(*models.Volume) error { return nil }
+func (m collectorMarks) Clear()                          {}
+
+func (m collectorMarks) IsDead(ref torus.BlockRef) bool {
+	m.c.mut.RLock()
+	defer m.c.mut.RUnlock()
+	if m.c.marks == nil || m.c.isYoung(ref) {
+		return false
+	}
+	return m.c.marks.IsDead(ref)
+}
+
+// MarkAll marks every volume at once, for checks that need marks right away
+// rather than a pass at a time. Like a Collector's marks, the GC it returns
+// counts blocks of volumes newer than it, or that couldn't be marked, as
+// alive, so long as the blocks are listed after it returns.
+func MarkAll(srv *torus.Server, inodes INodeFetcher) (GC, error) {
+	vols, maxVolume, err := srv.MDS.GetVolumes()
+	if err != nil {
+		return nil, err
+	}
+	c := &Collector{
+		marks:     NewGCController(srv, inodes),
+		maxVolume: maxVolume,
+		young:     make(map[torus.VolumeID]bool),
+	}
+	for _, vol := range vols {
+		err := c.marks.PrepVolume(vol)
+		if err != nil {
+			clog.Errorf("couldn't mark volume %s: %v", vol.Name, err)
+			c.young[torus.VolumeID(vol.Id)] = true
+		}
+	}
+	// As in a sweep, volumes that were being created as marking began are
+	// kept by listing them again; callers list blocks after this.
+	marked := make(map[torus.VolumeID]bool)
+	for _, vol := range vols {
+		marked[torus.VolumeID(vol.Id)] = true
+	}
+	vols, _, err = srv.MDS.GetVolumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, vol := range vols {
+		if !marked[torus.VolumeID(vol.Id)] {
+			c.young[torus.VolumeID(vol.Id)] = true
+		}
+	}
+	return c.Marks(), nil
+}
+
+// isYoung returns whether ref belongs to a volume the marks don't know of
+// because it's newer than them. c.mut must be held.
+func (c *Collector) isYoung(ref torus.BlockRef) bool {
+	return ref.Volume() > c.maxVolume || c.young[ref.Volume()]
+}
+
+// Cycle does one bounded step of collection, sweeping at most max blocks. It
+// returns io.EOF when it finishes a pass.
+func (c *Collector) Cycle(max int) error {
+	start := time.Now()
+	defer func() {
+		promGCCycleDuration.Observe(time.Since(start).Seconds())
+	}()
+	if !c.loaded {
+		c.load()
+	}
+	switch {
+	case c.marking == nil && c.refs == nil:
+		return c.startPass()
+	case c.marking != nil && len(c.toMark) != 0:
+		vol := c.toMark[0]
+		c.toMark = c.toMark[1:]
+		err := c.marking.PrepVolume(vol)
+		if err != nil {
+			// Its blocks are left alone until a pass can mark it.
+			clog.Errorf("gc couldn't mark volume %s: %v", vol.Name, err)
+			return nil
+		}
+		c.marked[torus.VolumeID(vol.Id)] = true
+		return nil
+	case c.marking != nil:
+		return c.startSweep()
+	}
+	return c.sweep(max)
+}
+
+// load picks up the generation and counts of the status saved before a
+// restart, and where its sweep got to.
+func (c *Collector) load() {
+	c.loaded = true
+	gmds, ok := c.srv.MDS.(torus.GCMetadataService)
+	if !ok {
+		return
+	}
+	s, err := gmds.GetGCStatus()
+	if err != nil {
+		clog.Errorf("couldn't get gc status: %v", err)
+		return
+	}
+	if s == nil {
+		return
+	}
+	c.mut.Lock()
+	c.status.Generation = s.Generation
+	c.status.PassFinish = s.PassFinish
+	c.status.Reclaimed = s.Reclaimed
+	c.status.BytesFreed = s.BytesFreed
+	c.mut.Unlock()
+	if s.Sweeping {
+		c.resume = s
+	}
+}
+
+func (c *Collector) startPass() error {
+	vols, maxVolume, err := c.srv.MDS.GetVolumes()
+	if err != nil {
+		return err
+	}
+	c.marking = NewGCController(c.srv, c.inodes)
+	c.toMark = vols
+	c.marked = make(map[torus.VolumeID]bool)
+	c.mut.Lock()
+	c.status.Generation++
+	c.status.Marking = true
+	c.status.Sweeping = false
+	c.status.Swept = 0
+	c.status.Total = 0
+	c.status.PassStart = time.Now().UnixNano()
+	c.mut.Unlock()
+	c.maxVolume = maxVolume
+	promGCGeneration.Set(float64(c.status.Generation))
+	clog.Debugf("starting gc generation %d, marking %d volumes", c.status.Generation, len(vols))
+	c.save(true)
+	return nil
+}
+
+// startSweep makes the new marks current and lists the local blocks to
+// sweep.
+func (c *Collector) startSweep() error {
+	// Volumes created since the pass began weren't marked; listing them now,
+	// before the blocks, keeps those that were being created as it began.
+	vols, _, err := c.srv.MDS.GetVolumes()
+	if err != nil {
+		return err
+	}
+	young := make(map[torus.VolumeID]bool)
+	for _, v := range vols {
+		if !c.marked[torus.VolumeID(v.Id)] {
+			young[torus.VolumeID(v.Id)] = true
+		}
+	}
+	it := c.bs.BlockIterator()
+	refs := make([]torus.BlockRef, 0)
+	for it.Next() {
+		refs = append(refs, it.BlockRef())
+	}
+	err = it.Err()
+	it.Close()
+	if err != nil {
+		return err
+	}
+	sort.Sort(byRef(refs))
+	pos := 0
+	if c.resume != nil {
+		after := c.resume.Last
+		pos = sort.Search(len(refs), func(i int) bool {
+			return refLess(after, refs[i])
+		})
+		clog.Infof("resuming gc sweep, skipping %d blocks already swept", pos)
+		c.resume = nil
+	}
+	c.mut.Lock()
+	c.marks = c.marking
+	c.young = young
+	c.status.Marking = false
+	c.status.Sweeping = true
+	c.status.Swept = uint64(pos)
+	c.status.Total = uint64(len(refs))
+	c.mut.Unlock()
+	c.marking = nil
+	c.refs = refs[pos:]
+	return nil
+}
+
+func (c *Collector) sweep(max int) error {
+	n := len(c.refs)
+	if n > max {
+		n = max
+	}
+	bs := c.bs.BlockSize()
+	var reclaimed uint64
+	for _, ref := range c.refs[:n] {
+		if !c.Marks().IsDead(ref) {
+			continue
+		}
+		if torus.BlockLog.LevelAt(capnslog.TRACE) {
+			torus.BlockLog.Tracef("gc: deleting dead block %s", ref)
+		}
+		err := c.bs.DeleteBlock(context.TODO(), ref)
+		if err != nil {
+			clog.Errorf("couldn't delete dead local block %s: %v", ref, err)
+			promGCFailed.Inc()
+			continue
+		}
+		reclaimed++
+		promGCCollected.Inc()
+		promGCBytesFreed.Add(float64(bs))
+	}
+	if n != 0 {
+		if err := c.bs.Flush(); err != nil {
+			clog.Errorf("couldn't flush after gc: %v", err)
+		}
+	}
+	c.mut.Lock()
+	if n != 0 {
+		c.status.Last = c.refs[n-1]
+	}
+	c.status.Swept += uint64(n)
+	c.status.Reclaimed += reclaimed
+	c.status.BytesFreed += reclaimed * bs
+	c.refs = c.refs[n:]
+	done := len(c.refs) == 0
+	if done {
+		c.refs = nil
+		c.status.Sweeping = false
+		c.status.PassFinish = time.Now().UnixNano()
+	}
+	c.mut.Unlock()
+	promGCSwept.Set(float64(c.status.Swept))
+	c.save(done)
+	if done {
+		clog.Debugf("finished gc generation %d", c.status.Generation)
+		return io.EOF
+	}
+	return nil
+}
+
+// save saves the collector's status, at most every gcSaveInterval unless
+// force is set.
+func (c *Collector) save(force bool) {
+	gmds, ok := c.srv.MDS.(torus.GCMetadataService)
+	if !ok || (!force && time.Since(c.lastSave) < gcSaveInterval) {
+		return
+	}
+	c.lastSave = time.Now()
+	s := c.Status()
+	s.Saved = c.lastSave.UnixNano()
+	if err := gmds.SaveGCStatus(&s); err != nil {
+		clog.Errorf("couldn't save gc status: %v", err)
+	}
+}
+
+func refLess(a, b torus.BlockRef) bool {
+	if a.Volume() != b.Volume() {
+		return a.Volume() < b.Volume()
+	}
+	if a.INode != b.INode {
+		return a.INode < b.INode
+	}
+	return a.Index < b.Index
+}
+
+type byRef []torus.BlockRef
+
+func (b byRef) Len() int           { return len(b) }
+func (b byRef) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byRef) Less(i, j int) bool { return refLess(b[i], b[j]) }
@@ -0,0 +1,86 @@
+package gc_test
+
+import (
+	"io"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/gc"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+
+	_ "github.com/coreos/torus/storage"
+)
+
+// volumeGC counts blocks of every volume it's prepped for as alive.
+type volumeGC struct {
+	live map[torus.VolumeID]bool
+}
+
+func (g *volumeGC) PrepVolume(vol *models.Volume) error {
+	g.live[torus.VolumeID(vol.Id)] = true
+	return nil
+}
+
+func (g *volumeGC) IsDead(ref torus.BlockRef) bool { return !g.live[ref.Volume()] }
+func (g *volumeGC) Clear()                         {}
+
+func init() {
+	gc.RegisterGC("test", func(*torus.Server, gc.INodeFetcher) (gc.GC, error) {
+		return &volumeGC{live: make(map[torus.VolumeID]bool)}, nil
+	})
+}
+
+func TestCollector(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	mds := srv.MDS.(*temp.Client)
+	for _, name := range []string{"a", "b"} {
+		id, err := mds.NewVolumeID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mds.CreateVolume(&models.Volume{Name: name, Id: uint64(id), Type: "test"})
+	}
+	if err := mds.DeleteVolume("b"); err != nil {
+		t.Fatal(err)
+	}
+	var refs []torus.BlockRef
+	for vol := torus.VolumeID(1); vol <= 2; vol++ {
+		for i := 1; i <= 3; i++ {
+			ref := torus.BlockRef{INodeRef: torus.NewINodeRef(vol, 1), Index: torus.IndexID(i)}
+			if err := srv.Blocks.WriteBlock(context.TODO(), ref, make([]byte, srv.Blocks.BlockSize())); err != nil {
+				t.Fatal(err)
+			}
+			refs = append(refs, ref)
+		}
+	}
+
+	c := gc.NewCollector(srv, srv.Blocks, srv.INodes)
+	var err error
+	for i := 0; i < 20 && err == nil; i++ {
+		err = c.Cycle(2)
+	}
+	if err != io.EOF {
+		t.Fatalf("expected a pass to finish, got %v", err)
+	}
+	for _, ref := range refs {
+		_, err := srv.Blocks.GetBlock(context.TODO(), ref)
+		if dead := ref.Volume() == 2; dead != (err != nil) {
+			t.Errorf("block %s: expected deleted %v, got error %v", ref, dead, err)
+		}
+	}
+	s := c.Status()
+	if s.Generation != 1 || s.Reclaimed != 3 || s.Swept != 6 || s.Sweeping || s.PassFinish == 0 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	saved, err := mds.GetGCStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved == nil || saved.Generation != 1 || saved.Reclaimed != 3 {
+		t.Fatalf("unexpected saved status %+v", saved)
+	}
+}
@@ -0,0 +1,40 @@
+package gc
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	promGCCollected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_gc_collected_blocks_total",
+		Help: "Local blocks deleted because no volume uses them anymore",
+	})
+	promGCFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_gc_failed_blocks_total",
+		Help: "Dead local blocks that couldn't be deleted",
+	})
+	promGCBytesFreed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_gc_freed_bytes_total",
+		Help: "Bytes of local blocks deleted by garbage collection",
+	})
+	promGCCycleDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "torus_gc_cycle_duration_seconds",
+		Help:    "How long each bounded cycle of garbage collection took",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+	})
+	promGCGeneration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_gc_generation",
+		Help: "Number of the current garbage collection pass",
+	})
+	promGCSwept = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_gc_pass_swept_blocks",
+		Help: "Local blocks the current garbage collection pass has swept so far",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promGCCollected)
+	prometheus.MustRegister(promGCFailed)
+	prometheus.MustRegister(promGCBytesFreed)
+	prometheus.MustRegister(promGCCycleDuration)
+	prometheus.MustRegister(promGCGeneration)
+	prometheus.MustRegister(promGCSwept)
+}
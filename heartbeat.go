@@ -18,6 +18,10 @@ const (
 
 	heartbeatTimeout  = 1 * time.Second
 	heartbeatInterval = 5 * time.Second
+
+	// DefaultPeerTimeout is how long a peer may go without heartbeating
+	// before it is considered down, unless configured otherwise.
+	DefaultPeerTimeout = 4 * heartbeatInterval
 )
 
 var (
@@ -29,11 +33,22 @@ var (
 		Name: "torus_server_peers_total",
 		Help: "Number of peers this server sees",
 	})
+	promServerDownPeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_server_down_peers",
+		Help: "Number of peers this server sees that have stopped heartbeating",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(promHeartbeats)
 	prometheus.MustRegister(promServerPeers)
+	prometheus.MustRegister(promServerDownPeers)
+}
+
+// PeerStale returns whether p last heartbeated more than timeout ago. Peers
+// that haven't said when they last heartbeated are never stale.
+func PeerStale(p *models.PeerInfo, timeout time.Duration) bool {
+	return p.LastSeen != 0 && time.Since(time.Unix(0, p.LastSeen)) > timeout
 }
 
 // BeginHeartbeat spawns a goroutine for heartbeats. Non-blocking.
@@ -53,6 +68,12 @@ func (s *Server) BeginHeartbeat(addr *url.URL) error {
 
 	// Update our data.
 	s.peerInfo.ProtocolVersion = currentProtocolVersion
+	s.peerInfo.Zone = s.Cfg.Zone
+	if r, ok := s.Blocks.(BlockFileReporter); ok {
+		opts := r.FileOptions()
+		s.peerInfo.DirectIO = opts.DirectIO
+		s.peerInfo.Preallocated = opts.Preallocated
+	}
 	if addr != nil {
 		ipaddr, port, err := net.SplitHostPort(addr.Host)
 		if err != nil {
@@ -74,12 +95,32 @@ func (s *Server) BeginHeartbeat(addr *url.URL) error {
 	s.UpdateRebalanceInfo(&models.RebalanceInfo{})
 	ch := make(chan interface{})
 	s.closeChans = append(s.closeChans, ch)
-	go s.heartbeat(ch)
+	s.heartbeatChan = ch
+	s.heartbeatDone = make(chan struct{})
+	go s.heartbeat(ch, s.heartbeatDone)
 	s.heartbeating = true
 	return nil
 }
 
-func (s *Server) heartbeat(cl chan interface{}) {
+// StopHeartbeat stops heartbeating, and waits for any heartbeat in progress
+// to finish. Other peers time this one out unless it deregisters.
+func (s *Server) StopHeartbeat() {
+	if !s.heartbeating {
+		return
+	}
+	for i, c := range s.closeChans {
+		if c == s.heartbeatChan {
+			s.closeChans = append(s.closeChans[:i], s.closeChans[i+1:]...)
+			break
+		}
+	}
+	close(s.heartbeatChan)
+	<-s.heartbeatDone
+	s.heartbeating = false
+}
+
+func (s *Server) heartbeat(cl chan interface{}, done chan struct{}) {
+	defer close(done)
 	for {
 		s.oneHeartbeat()
 		select {
@@ -102,6 +143,14 @@ func (s *Server) oneHeartbeat() {
 	s.mut.Lock()
 	s.peerInfo.TotalBlocks = s.Blocks.NumBlocks()
 	s.peerInfo.UsedBlocks = s.Blocks.UsedBlocks()
+	if r, ok := s.Blocks.(DeviceReporter); ok {
+		s.peerInfo.Devices = r.Devices()
+	}
+	if r, ok := s.Blocks.(LoadReporter); ok {
+		l := r.Load()
+		s.peerInfo.QueueDepth = l.QueueDepth
+		s.peerInfo.ReadLatency = int64(l.ReadLatency)
+	}
 	s.mut.Unlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), heartbeatTimeout)
@@ -132,24 +181,57 @@ func (s *Server) updatePeerMap() {
 	s.mut.Lock()
 	defer s.mut.Unlock()
 
+	// A peer that is still listed, but whose heartbeat has stopped, is down
+	// as much as one whose lease has run out and taken it off the list.
+	timeout := s.peerTimeout()
+	var down []string
 	for _, p := range peers {
+		if p.UUID != s.peerInfo.UUID && PeerStale(p, timeout) {
+			old := s.peersMap[p.UUID]
+			if old == nil || !old.TimedOut {
+				clog.Warningf("peer %s hasn't heartbeated for %s; marking it down", p.UUID, time.Since(time.Unix(0, p.LastSeen)))
+				down = append(down, p.UUID)
+			}
+			stale := *p
+			stale.TimedOut = true
+			p = &stale
+		}
 		s.peersMap[p.UUID] = p
 	}
 	for k := range s.peersMap {
-		found := false
-		for _, p := range peers {
-			if p.UUID == k {
-				found = true
-				break
-			}
-		}
-		if !found {
-			for _, f := range s.timeoutCallbacks {
-				f(k)
-			}
+		if peers.UUIDAt(k) == -1 {
+			down = append(down, k)
 			s.peersMap[k].TimedOut = true
 		}
 	}
+	for _, k := range down {
+		for _, f := range s.timeoutCallbacks {
+			f(k)
+		}
+	}
+	ndown := 0
+	for _, p := range s.peersMap {
+		if p.TimedOut {
+			ndown++
+		}
+	}
+	promServerDownPeers.Set(float64(ndown))
+}
+
+func (s *Server) peerTimeout() time.Duration {
+	if s.Cfg.PeerTimeout == 0 {
+		return DefaultPeerTimeout
+	}
+	return s.Cfg.PeerTimeout
+}
+
+// PeerDown returns whether the peer with the given UUID has stopped
+// heartbeating, as of the last time the server looked.
+func (s *Server) PeerDown(uuid string) bool {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	p, ok := s.peersMap[uuid]
+	return ok && p.TimedOut
 }
 
 func (s *Server) UpdatePeerMap() map[string]*models.PeerInfo {
@@ -0,0 +1,16 @@
+package torus
+
+// HintLog is implemented by block stores that can hold blocks on behalf of
+// other peers. When a peer is unreachable, its writes go to the next peer in
+// the block's permutation along with a hint naming the rightful owner, and
+// are handed off once the owner is back.
+type HintLog interface {
+	// AddHint records that the block ref is held here for peer.
+	AddHint(peer string, ref BlockRef) error
+	// RemoveHint forgets a hint, once the block has been handed off.
+	RemoveHint(peer string, ref BlockRef) error
+	// HintedPeers returns the peers there are hints for.
+	HintedPeers() []string
+	// Hints returns the blocks held for peer.
+	Hints(peer string) []BlockRef
+}
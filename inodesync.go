@@ -0,0 +1,78 @@
+package torus
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// INodeSyncMode is when a volume's block map is written to the metadata
+// service, on top of every explicit sync.
+type INodeSyncMode int
+
+const (
+	// INodeSyncOnSync writes it only when the volume is synced, such as when
+	// the filesystem on it flushes, or when it is closed.
+	INodeSyncOnSync INodeSyncMode = iota
+	// INodeSyncEveryWrite writes it after every write.
+	INodeSyncEveryWrite
+	// INodeSyncWrites writes it after every Writes writes.
+	INodeSyncWrites
+	// INodeSyncInterval writes it at most Interval after a write.
+	INodeSyncInterval
+)
+
+// INodeSyncPolicy trades the load on the metadata service against how many
+// writes can be lost if a client crashes before syncing.
+type INodeSyncPolicy struct {
+	Mode     INodeSyncMode
+	Writes   int
+	Interval time.Duration
+}
+
+var errINodeSyncPolicy = errors.New("invalid inode sync policy; use one of 'sync', 'write', 'writes=N' or 'interval=DURATION'")
+
+func ParseINodeSyncPolicy(s string) (INodeSyncPolicy, error) {
+	switch {
+	case s == "sync":
+		return INodeSyncPolicy{Mode: INodeSyncOnSync}, nil
+	case s == "write":
+		return INodeSyncPolicy{Mode: INodeSyncEveryWrite}, nil
+	case strings.HasPrefix(s, "writes="):
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "writes="))
+		if err != nil || n <= 0 {
+			return INodeSyncPolicy{}, errINodeSyncPolicy
+		}
+		return INodeSyncPolicy{Mode: INodeSyncWrites, Writes: n}, nil
+	case strings.HasPrefix(s, "interval="):
+		d, err := time.ParseDuration(strings.TrimPrefix(s, "interval="))
+		if err != nil || d <= 0 {
+			return INodeSyncPolicy{}, errINodeSyncPolicy
+		}
+		return INodeSyncPolicy{Mode: INodeSyncInterval, Interval: d}, nil
+	}
+	return INodeSyncPolicy{}, errINodeSyncPolicy
+}
+
+func (p INodeSyncPolicy) String() string {
+	switch p.Mode {
+	case INodeSyncEveryWrite:
+		return "write"
+	case INodeSyncWrites:
+		return fmt.Sprintf("writes=%d", p.Writes)
+	case INodeSyncInterval:
+		return fmt.Sprintf("interval=%s", p.Interval)
+	}
+	return "sync"
+}
+
+// INodeSyncMetadataService is implemented by metadata services that can
+// store an inode sync policy per volume.
+type INodeSyncMetadataService interface {
+	// GetINodeSync returns the volume's policy, which is INodeSyncOnSync if
+	// none was ever set.
+	GetINodeSync(vid VolumeID) (INodeSyncPolicy, error)
+	SetINodeSync(vid VolumeID, p INodeSyncPolicy) error
+}
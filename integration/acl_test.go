@@ -0,0 +1,112 @@
+package integration
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+	"github.com/coreos/torus/distributor/protocols"
+)
+
+func TestVolumeACL(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// Storage nodes check the tokens the client presents.
+	alice, bob := torus.TokenIdentity("alice-token"), torus.TokenIdentity("bob-token")
+	client.Cfg.Token = "alice-token"
+	client.Cfg.Identity = alice
+	err = block.CreateBlockVolume(client.MDS, "testvol", BlockSize*4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol, err := client.MDS.GetVolume("testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vid := torus.VolumeID(vol.Id)
+	// The first grant makes alice an admin too.
+	err = torus.SetPermission(client.MDS, alice, vid, bob, torus.PermRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := makeTestData(BlockSize * 4)
+	f := openVol(t, client, "testvol")
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Cfg.Identity = bob
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bv.OpenBlockFile(); err != torus.ErrPermissionDenied {
+		t.Fatalf("expected a reader to be refused a writable attach, got %v", err)
+	}
+	if err := torus.SetPermission(client.MDS, bob, vid, bob, torus.PermAdmin); err != torus.ErrPermissionDenied {
+		t.Fatalf("expected a reader to be refused changing the ACL, got %v", err)
+	}
+
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	perm, err := client.Blocks.(*distributor.Distributor).Ring().GetPeers(refs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range servers {
+		if s.MDS.UUID() != perm.Peers[0] {
+			continue
+		}
+		d := s.Blocks.(*distributor.Distributor)
+		ctx := torus.WithIdentity(context.TODO(), bob)
+		if _, err := d.Block(ctx, refs[0]); err != nil {
+			t.Fatalf("expected a reader to read a block, got %v", err)
+		}
+		if err := d.PutBlock(ctx, refs[0], data[:BlockSize]); err != torus.ErrPermissionDenied {
+			t.Fatalf("expected a reader to be refused a write, got %v", err)
+		}
+		ctx = torus.WithIdentity(context.TODO(), "cn:eve")
+		if _, err := d.Block(ctx, refs[0]); err != torus.ErrPermissionDenied {
+			t.Fatalf("expected a stranger to be refused a read, got %v", err)
+		}
+
+		// Over the wire, the token decides, and a client without one
+		// is refused.
+		uri, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", 40000+i))
+		for _, token := range []string{"bob-token", ""} {
+			rpc, err := protocols.DialRPC(uri, time.Second, client.MDS.GlobalMetadata(), nil, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rpc.Block(context.TODO(), refs[0])
+			rpc.Close()
+			if token != "" && err != nil {
+				t.Fatalf("expected a reader's token to read a block, got %v", err)
+			}
+			if token == "" && err == nil {
+				t.Fatal("expected a client without a token to be refused a read")
+			}
+		}
+	}
+	closeAll(t, servers...)
+}
@@ -0,0 +1,78 @@
+package integration
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestForceAttach(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	defer closeAll(t, servers...)
+	var clients []*torus.Server
+	for i := 0; i < 2; i++ {
+		c := newServer(t, mds)
+		if err := distributor.OpenReplication(c); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	size := BlockSize * 10
+	old := createVol(t, clients[0], "vm", uint64(size))
+	if _, err := old.WriteAt(makeTestData(size), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	bv, err := block.OpenBlockVolume(clients[1], "vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bv.OpenBlockFile(); err != torus.ErrLocked {
+		t.Fatalf("expected ErrLocked attaching an attached volume, got %v", err)
+	}
+	// The old holder doesn't renew this quickly, so it's taken for dead.
+	defer func(wait time.Duration) { block.ForceAttachWait = wait }(block.ForceAttachWait)
+	block.ForceAttachWait = 10 * time.Millisecond
+	f, err := bv.ForceOpenBlockFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Epoch <= old.Epoch {
+		t.Fatalf("expected the new attachment's epoch %d to be past the old one's %d", f.Epoch, old.Epoch)
+	}
+	data := makeTestData(size)
+	if _, err := f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The peers fence off the old holder's writes, and it can't sync.
+	if _, err := old.WriteAt(makeTestData(size), 0); err != torus.ErrStaleEpoch {
+		t.Errorf("expected ErrStaleEpoch writing from the old attachment, got %v", err)
+	}
+	if err := old.Close(); err == nil {
+		t.Error("expected closing the old attachment to fail")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f = openVol(t, clients[0], "vm")
+	defer f.Close()
+	got := make([]byte, size)
+	if _, err := f.ReadAt(got, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("the volume has data other than the new holder wrote")
+	}
+}
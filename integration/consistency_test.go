@@ -0,0 +1,104 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func readVol(t *testing.T, srv *torus.Server, size int) ([]byte, error) {
+	err := distributor.OpenReplication(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol, err := block.OpenBlockVolume(srv, "testvol")
+	if err != nil {
+		return nil, err
+	}
+	f, err := vol.OpenBlockFile()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := make([]byte, size)
+	_, err = f.ReadAt(out, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	return out, err
+}
+
+func TestQuorumConsistency(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	defer closeAll(t, servers[1:]...)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	data := makeTestData(size)
+	err = block.CreateBlockVolume(client.MDS, "testvol", uint64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol, err := client.MDS.GetVolume("testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds := client.MDS.(torus.ConsistencyMetadataService)
+	err = cmds.SetConsistency(torus.VolumeID(vol.Id), &torus.Consistency{Read: torus.ReadQuorum, Write: torus.WriteQuorum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := openVol(t, client, "testvol")
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	reader := newServer(t, mds)
+	defer reader.Close()
+	out, err := readVol(t, reader, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("bytes not equal")
+	}
+
+	// With one of each block's two replicas gone, most blocks have no
+	// majority left to read from...
+	closeAll(t, servers[0])
+	quorumReader := newServer(t, mds)
+	defer quorumReader.Close()
+	_, err = readVol(t, quorumReader, size)
+	if err == nil {
+		t.Fatal("expected reads short of a quorum to fail")
+	}
+
+	// ...but they can still be read from whichever replica is left once the
+	// volume goes back to the clients' own levels.
+	err = cmds.SetConsistency(torus.VolumeID(vol.Id), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oneReader := newServer(t, mds)
+	defer oneReader.Close()
+	out, err = readVol(t, oneReader, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("bytes not equal")
+	}
+}
@@ -0,0 +1,85 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestErasureCodedVolume(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 10
+	err = block.CreateBlockVolume(client.MDS, "testvol", uint64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	red, _ := torus.ParseRedundancy("ec=2+1")
+	err = torus.SetInitialRedundancy(client.MDS, "testvol", red)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := makeTestData(size)
+	f := openVol(t, client, "testvol")
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := refs[0]
+	if ref.BlockType() != torus.TypeShard {
+		t.Fatalf("expected %s to be a shard", ref)
+	}
+	// Lose the first block; it has to be rebuilt from the rest of its
+	// stripe.
+	perm, err := client.Blocks.(*distributor.Distributor).Ring().GetPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm.Replication != 1 {
+		t.Fatalf("expected shards to be stored once, got %d copies", perm.Replication)
+	}
+	for _, s := range servers {
+		if s.MDS.UUID() == perm.Peers[0] {
+			err = s.Blocks.DeleteBlock(context.TODO(), ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	f = openVol(t, client, "testvol")
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data differs after losing a shard")
+	}
+	f.Close()
+	closeAll(t, servers...)
+}
@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestIncrementalExport(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// Leave the last block partial and the one before it unwritten.
+	size := BlockSize*10 + BlockSize/2
+	data := makeTestData(size)
+	for i := 8 * BlockSize; i < 9*BlockSize; i++ {
+		data[i] = 0
+	}
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = f.WriteAt(data[:8*BlockSize], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(data[9*BlockSize:], 9*BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bv.SaveSnapshot("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := &bytes.Buffer{}
+	n, err := bv.Export(full, "", "one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("expected a full export of the 10 written blocks, got %d", n)
+	}
+
+	image, err := ioutil.TempFile("", "torus-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(image.Name())
+	defer image.Close()
+	_, _, err = block.ApplyExport(image, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, image, data)
+
+	// Change blocks 2 and 8, then export just those.
+	copy(data[2*BlockSize:3*BlockSize], makeTestData(BlockSize))
+	copy(data[8*BlockSize:9*BlockSize], makeTestData(BlockSize))
+	f = openVol(t, client, "testvol")
+	_, err = f.WriteAt(data[2*BlockSize:3*BlockSize], 2*BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(data[8*BlockSize:9*BlockSize], 8*BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bv.SaveSnapshot("two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := bv.ChangedBlocks("one", "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, []int{2, 8}) {
+		t.Fatalf("expected blocks 2 and 8 to have changed, got %v", changed)
+	}
+	incr := &bytes.Buffer{}
+	_, err = bv.Export(incr, "one", "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, n, err := block.ApplyExport(image, incr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || hdr.From != "one" || hdr.To != "two" {
+		t.Fatalf("unexpected incremental export of %d blocks from %q to %q", n, hdr.From, hdr.To)
+	}
+	checkImage(t, image, data)
+
+	// A cut-off export is refused.
+	incr.Reset()
+	_, err = bv.Export(incr, "one", "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := block.ApplyExport(image, bytes.NewReader(incr.Bytes()[:incr.Len()-4])); err == nil {
+		t.Error("expected a truncated export to fail")
+	}
+	closeAll(t, servers...)
+}
+
+func checkImage(t *testing.T, image *os.File, data []byte) {
+	got := make([]byte, len(data))
+	_, err := image.ReadAt(got, 0)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("image differs from the volume")
+	}
+}
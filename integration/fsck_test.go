@@ -0,0 +1,185 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestFsckFix(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	defer closeAll(t, servers...)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 10
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(makeTestData(size)))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The blocks of a deleted volume are orphans until garbage collection's
+	// next pass, which is long after this test once the first is done.
+	gmds := client.MDS.(torus.GCMetadataService)
+	for i := 0; ; i++ {
+		ss, err := gmds.GetGCStatuses()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := 0
+		for _, s := range ss {
+			if s.PassFinish != 0 {
+				done++
+			}
+		}
+		// The client collects its own blocks too.
+		if done == len(servers)+1 {
+			break
+		}
+		if i == 50 {
+			t.Fatal("garbage collection didn't finish its first pass")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	g := createVol(t, client, "gone", uint64(BlockSize*4))
+	_, err = io.Copy(g, bytes.NewReader(makeTestData(BlockSize*4)))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = g.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+	bv, err = block.OpenBlockVolume(client, "gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphans, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = block.DeleteBlockVolume(client.MDS, "gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	dists := make(map[string]*distributor.Distributor)
+	for _, s := range servers {
+		dists[s.MDS.UUID()] = s.Blocks.(*distributor.Distributor)
+	}
+	ring := client.Blocks.(*distributor.Distributor).Ring()
+	// Copy one block to the peer the ring doesn't put it on, and drop a
+	// replica of another.
+	misplaced, lost := refs[0], refs[1]
+	perm, err := ring.GetPeers(misplaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wrong *distributor.Distributor
+	for uuid, d := range dists {
+		if !perm.Replicas().Has(uuid) {
+			wrong = d
+		}
+	}
+	data, err := client.Blocks.GetBlock(ctx, misplaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrong.PutBlock(ctx, misplaced, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perm, err = ring.GetPeers(lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := dists[perm.Replicas()[1]]
+	err = missing.DeleteBlock(ctx, lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmds := client.MDS.(torus.FsckMetadataService)
+	req := torus.FsckRequest{Requested: time.Now().UnixNano(), Fix: true}
+	err = fmds.RequestFsck(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []*torus.FsckReport
+	for i := 0; i < 30 && len(reports) < len(servers); i++ {
+		time.Sleep(time.Second)
+		rs, err := fmds.GetFsckReports()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports = reports[:0]
+		for _, r := range rs {
+			if r.Requested == req.Requested && dists[r.Peer] != nil {
+				reports = append(reports, r)
+			}
+		}
+	}
+	if len(reports) != len(servers) {
+		t.Fatalf("expected a report from every peer, got %d", len(reports))
+	}
+	var found uint64
+	for _, r := range reports {
+		found += r.Orphans
+		if r.Fixed != r.Orphans+r.Misplaced+r.Missing || len(r.Errors) != 0 {
+			t.Errorf("peer %s didn't fix everything it found: %+v", r.Peer, r)
+		}
+	}
+	// Every orphan has two replicas, and the volume's INode is an orphan too.
+	if found < uint64(2*len(orphans)) {
+		t.Errorf("expected at least %d orphans, found %d", 2*len(orphans), found)
+	}
+	for _, d := range dists {
+		has, err := d.RebalanceCheck(ctx, orphans)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, ok := range has {
+			if ok {
+				t.Errorf("orphan %s wasn't deleted", orphans[i])
+			}
+		}
+	}
+	has, err := wrong.RebalanceCheck(ctx, []torus.BlockRef{misplaced})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has[0] {
+		t.Error("misplaced block wasn't removed")
+	}
+	has, err = missing.RebalanceCheck(ctx, []torus.BlockRef{lost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has[0] {
+		t.Error("missing replica wasn't restored")
+	}
+}
@@ -0,0 +1,50 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus/distributor"
+)
+
+func TestDeadPeerMarkedDown(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	data := makeTestData(size)
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	dead := servers[0]
+	dead.StopHeartbeat()
+	// Age the stopped peer's last heartbeat rather than wait out the timeout.
+	err = mds.SetPeerLastSeen(dead.MDS.UUID(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.UpdatePeerMap()
+	if !client.PeerDown(dead.MDS.UUID()) {
+		t.Fatal("expected the peer that stopped heartbeating to be down")
+	}
+	if client.PeerDown(servers[1].MDS.UUID()) {
+		t.Fatal("expected a heartbeating peer to be up")
+	}
+
+	closeAll(t, dead)
+	compareBytes(t, mds, data, "testvol")
+	closeAll(t, servers[1:]...)
+}
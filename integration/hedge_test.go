@@ -0,0 +1,56 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestHedgedReads(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	defer closeAll(t, servers[1:]...)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	data := makeTestData(size)
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	// Hedge every read straight away, and lose a peer, so that some reads
+	// are answered by the second peer asked, and some ask a dead one first.
+	closeAll(t, servers[0])
+	reader := newServer(t, mds)
+	reader.Cfg.ReadCacheSize = 0
+	reader.Cfg.ReadLevel = torus.ReadHedged
+	reader.Cfg.HedgeDelay = time.Nanosecond
+	err = distributor.OpenReplication(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	rf := openVol(t, reader, "testvol")
+	defer rf.Close()
+	out := make([]byte, size)
+	_, err = rf.ReadAt(out, 0)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("bytes not equal")
+	}
+}
@@ -0,0 +1,130 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+	"github.com/coreos/torus/internal/qcow2"
+)
+
+func TestImageImportExport(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// Blocks 1 and 4 are zeros, and the last one is partial.
+	size := BlockSize*6 + 100
+	data := makeTestData(size)
+	for _, i := range []int{1, 4} {
+		copy(data[i*BlockSize:(i+1)*BlockSize], make([]byte, BlockSize))
+	}
+
+	dir, err := ioutil.TempDir("", "torus-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	qf, err := os.Create(dir + "/in.qcow2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := qcow2.NewWriter(qf, uint64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.WriteAt(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := qcow2.Open(qf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = block.CreateBlockVolume(client.MDS, "testvol", uint64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := openVol(t, client, "testvol")
+	n, err := f.ImportImage(img, img.Size(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("expected the 5 blocks with data to be written, got %d", n)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	qf.Close()
+
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bv.SaveSnapshot("export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.Create(dir + "/out.raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	_, err = bv.ExportImage(raw, "export", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Truncate(int64(size))
+	got, err := ioutil.ReadAll(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("raw export differs from the imported image")
+	}
+
+	out := &bytes.Buffer{}
+	qf, err = os.Create(dir + "/out.qcow2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qf.Close()
+	w, err = qcow2.NewWriter(qf, uint64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bv.ExportImage(w, "export", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = qcow2.Open(qf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(out, io.NewSectionReader(img, 0, int64(img.Size())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("qcow2 export differs from the imported image")
+	}
+	closeAll(t, servers...)
+}
@@ -0,0 +1,75 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestINodeSyncPolicy(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	imds := client.MDS.(torus.INodeSyncMetadataService)
+	for _, tt := range []struct {
+		policy string
+		// synced is how many blocks should be in the volume's synced inode
+		// after each write.
+		synced []int
+	}{
+		{"sync", []int{0, 0, 0, 0}},
+		{"write", []int{1, 2, 3, 4}},
+		{"writes=2", []int{0, 2, 2, 4}},
+	} {
+		p, err := torus.ParseINodeSyncPolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != tt.policy {
+			t.Fatalf("expected %s to round trip, got %s", tt.policy, p)
+		}
+		name := "vol-" + tt.policy
+		err = block.CreateBlockVolume(client.MDS, name, BlockSize*4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vol, err := client.MDS.GetVolume(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = imds.SetINodeSync(torus.VolumeID(vol.Id), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := openVol(t, client, name)
+		bv, err := block.OpenBlockVolume(client, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := makeTestData(BlockSize)
+		for i, want := range tt.synced {
+			_, err = f.WriteAt(data, int64(i*BlockSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			refs, err := bv.BlockRefs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(refs) != want {
+				t.Errorf("%s: expected %d synced blocks after write %d, got %d", tt.policy, want, i+1, len(refs))
+			}
+		}
+		err = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeAll(t, servers...)
+}
@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestLocateBlock(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 10
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(makeTestData(size)))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := refs[0]
+	ctx := context.TODO()
+	l := client.Blocks.(torus.BlockLocator)
+
+	copies, err := l.LocateBlock(ctx, ref, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 3 || !copies[0].Replica || !copies[1].Replica || copies[2].Replica {
+		t.Fatalf("expected 2 replicas and a fallback, got %+v", copies)
+	}
+	for _, c := range copies[:2] {
+		if !c.Has || c.Err != nil || c.Checksum != copies[0].Checksum {
+			t.Errorf("expected every replica to have the same copy, got %+v", copies)
+		}
+	}
+	if copies[2].Has || copies[2].Err != nil {
+		t.Errorf("expected the fallback not to have the block, got %+v", copies[2])
+	}
+
+	for _, s := range servers {
+		if s.MDS.UUID() == copies[1].Peer {
+			err = s.Blocks.(*distributor.Distributor).DeleteBlock(ctx, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	copies, err = l.LocateBlock(ctx, ref, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 2 || !copies[0].Has || copies[1].Has || copies[1].Err != nil {
+		t.Errorf("expected the second replica to be missing the block, got %+v", copies)
+	}
+	closeAll(t, servers...)
+}
@@ -0,0 +1,141 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+	"github.com/coreos/torus/internal/placement"
+	"github.com/coreos/torus/models"
+)
+
+func TestLocateVolume(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(makeTestData(size)))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	srv := placement.NewServer(client)
+	resp, err := srv.LocateVolume(context.TODO(), &models.LocateVolumeRequest{Volume: "testvol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Blocks != 100 {
+		t.Fatalf("expected 100 blocks, got %d", resp.Blocks)
+	}
+	var total, primary uint64
+	for i, sh := range resp.Shares {
+		if i > 0 && sh.Blocks > resp.Shares[i-1].Blocks {
+			t.Errorf("shares not sorted: %v", resp.Shares)
+		}
+		total += sh.Blocks
+		primary += sh.Primary
+	}
+	// Replication 2
+	if total != 200 || primary != 100 {
+		t.Errorf("expected 200 replicas with 100 primaries, got %d and %d", total, primary)
+	}
+	if len(resp.Peers) != len(resp.Shares) {
+		t.Errorf("expected addresses for all %d peers, got %d", len(resp.Shares), len(resp.Peers))
+	}
+
+	_, err = srv.LocateVolume(context.TODO(), &models.LocateVolumeRequest{Volume: "nonexistent"})
+	if err == nil {
+		t.Error("expected an error locating a nonexistent volume")
+	}
+	closeAll(t, servers...)
+}
+
+func TestSimulateRing(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(makeTestData(size)))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	r, err := client.MDS.GetRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := servers[2].MDS.UUID()
+	smaller, err := r.(torus.RingRemover).RemovePeers(torus.PeerList{removed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := smaller.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposed := &models.Ring{}
+	err = proposed.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := placement.NewServer(client)
+	resp, err := srv.SimulateRing(context.TODO(), &models.SimulateRingRequest{Ring: proposed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Blocks != 100 {
+		t.Fatalf("expected 100 blocks, got %d", resp.Blocks)
+	}
+	if len(resp.Refusals) != 0 {
+		t.Errorf("expected removing a peer to be safe, got %v", resp.Refusals)
+	}
+	var before, after, received uint64
+	for _, sim := range resp.Peers {
+		if sim.UUID == removed && sim.After != 0 {
+			t.Errorf("removed peer would still hold %d blocks", sim.After)
+		}
+		before += sim.Before
+		after += sim.After
+		received += sim.Received
+	}
+	// Replication 2
+	if before != 200 || after != 200 {
+		t.Errorf("expected 200 replicas before and after, got %d and %d", before, after)
+	}
+	if resp.Moved == 0 || resp.Moved != received {
+		t.Errorf("expected moved blocks to match those received, got %d and %d", resp.Moved, received)
+	}
+
+	proposed.Version = uint32(r.Version())
+	resp, err = srv.SimulateRing(context.TODO(), &models.SimulateRingRequest{Ring: proposed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Refusals) == 0 {
+		t.Error("expected a ring that isn't newer to be refused")
+	}
+	closeAll(t, servers...)
+}
@@ -0,0 +1,59 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestPrefetch(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	data := makeTestData(size)
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	reader := newServer(t, mds)
+	reader.Cfg.ReadCacheSize = uint64(size)
+	err = distributor.OpenReplication(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	rf := openVol(t, reader, "testvol")
+	defer rf.Close()
+	err = rf.Prefetch([]torus.ByteRange{
+		{Offset: 0, Length: int64(size / 2)},
+		{Offset: int64(size / 2), Length: int64(size)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// With every storage peer gone, the volume can only be read from what
+	// was prefetched.
+	closeAll(t, servers...)
+	out := make([]byte, size)
+	_, err = rf.ReadAt(out, 0)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("bytes not equal")
+	}
+}
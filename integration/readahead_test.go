@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+	"golang.org/x/net/context"
+)
+
+// prefetchWatcher passes prefetches on to the distributor, and reports how
+// many blocks each asked for once it's done.
+type prefetchWatcher struct {
+	torus.BlockStore
+	done chan int
+}
+
+func (p *prefetchWatcher) PrefetchBlocks(ctx context.Context, refs []torus.BlockRef) error {
+	err := p.BlockStore.(torus.BlockPrefetcher).PrefetchBlocks(ctx, refs)
+	p.done <- len(refs)
+	return err
+}
+
+func TestReadahead(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	data := makeTestData(size)
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+	vol, err := client.MDS.GetVolume("testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.MDS.(torus.ReadaheadMetadataService).SetReadahead(torus.VolumeID(vol.Id), 20*BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := newServer(t, mds)
+	reader.Cfg.ReadCacheSize = uint64(size)
+	err = distributor.OpenReplication(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	watcher := &prefetchWatcher{BlockStore: reader.Blocks, done: make(chan int, 1)}
+	reader.Blocks = watcher
+	rf := openVol(t, reader, "testvol")
+	defer rf.Close()
+
+	// Reading the first few blocks in order sets off readahead of the next
+	// 20.
+	out := make([]byte, size)
+	for i := 0; i < 3; i++ {
+		_, err = rf.ReadAt(out[i*BlockSize:(i+1)*BlockSize], int64(i*BlockSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case n := <-watcher.done:
+		if n != 20 {
+			t.Fatalf("expected 20 blocks read ahead, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no readahead")
+	}
+
+	// With every storage peer gone, they can only come from the read cache.
+	closeAll(t, servers...)
+	_, err = rf.ReadAt(out[3*BlockSize:23*BlockSize], 3*BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[:23*BlockSize], data[:23*BlockSize]) {
+		t.Error("bytes not equal")
+	}
+}
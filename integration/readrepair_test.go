@@ -0,0 +1,84 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestReadRepair(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 10
+	err = block.CreateBlockVolume(client.MDS, "testvol", uint64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Peers cache the policy, so set it before anything is read.
+	vol, err := client.MDS.GetVolume("testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.MDS.(torus.ReadRepairMetadataService).SetReadRepair(torus.VolumeID(vol.Id), torus.ReadRepairAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := openVol(t, client, "testvol")
+	_, err = io.Copy(f, bytes.NewReader(makeTestData(size)))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := refs[0]
+	perm, err := client.Blocks.(*distributor.Distributor).Ring().GetPeers(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lost *distributor.Distributor
+	for _, s := range servers {
+		if s.MDS.UUID() == perm.Replicas()[1] {
+			lost = s.Blocks.(*distributor.Distributor)
+		}
+	}
+	ctx := context.TODO()
+	err = lost.DeleteBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Blocks.GetBlock(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	has, err := lost.RebalanceCheck(ctx, []torus.BlockRef{ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has[0] {
+		t.Error("expected read repair to restore the missing replica")
+	}
+	closeAll(t, servers...)
+}
@@ -0,0 +1,60 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestVolumeReplicationOverride(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 20
+	for vol, copies := range map[string]int{"scratch": 1, "database": 3} {
+		f := createVol(t, client, vol, uint64(size))
+		err = torus.SetInitialRedundancy(client.MDS, vol, torus.Redundancy{Kind: torus.Replicated, Replicas: copies})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.Copy(f, bytes.NewReader(makeTestData(size)))
+		if err != nil {
+			t.Fatalf("couldn't copy: %v", err)
+		}
+		err = f.Close()
+		if err != nil {
+			t.Fatalf("couldn't close: %v", err)
+		}
+
+		held := make(map[torus.BlockRef]int)
+		for _, s := range servers {
+			it := s.Blocks.BlockIterator()
+			for it.Next() {
+				held[it.BlockRef()]++
+			}
+			it.Close()
+		}
+		bv, err := block.OpenBlockVolume(client, vol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs, err := bv.BlockRefs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ref := range refs {
+			if n := held[ref]; n != copies {
+				t.Errorf("expected block %s of %s to have %d copies, got %d", ref, vol, copies, n)
+			}
+		}
+	}
+	closeAll(t, servers...)
+}
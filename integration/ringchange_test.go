@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+	"github.com/coreos/torus/models"
+)
+
+func TestTwoPhaseRingChange(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	defer closeAll(t, servers...)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Every peer, client included, acknowledges the ring before it's
+	// committed, and has it once it is.
+	r, err := client.MDS.GetRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRing, err := r.(torus.ModifyableRing).ChangeReplication(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = torus.ChangeRing(client.MDS, newRing, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	for i, s := range append(servers, client) {
+		if v := s.Blocks.(*distributor.Distributor).Ring().Version(); v != newRing.Version() {
+			t.Errorf("peer %d is on ring %d, expected %d", i, v, newRing.Version())
+		}
+	}
+
+	// A live peer that never acknowledges holds the next change back until
+	// it's abandoned.
+	err = client.MDS.RegisterPeer(0, &models.PeerInfo{UUID: "silent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextRing, err := newRing.(torus.ModifyableRing).ChangeReplication(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = torus.ChangeRing(client.MDS, nextRing, 2*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "silent") {
+		t.Fatalf("expected the change to wait on the silent peer, got %v", err)
+	}
+	cur, err := client.MDS.GetRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.Version() != newRing.Version() {
+		t.Errorf("expected ring %d to stay in force, got %d", newRing.Version(), cur.Version())
+	}
+	proposed, err := client.MDS.(torus.RingChangeMetadataService).GetProposedRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposed != nil {
+		t.Error("expected the abandoned ring to be dropped")
+	}
+}
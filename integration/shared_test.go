@@ -0,0 +1,108 @@
+package integration
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestSharedVolume(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	defer closeAll(t, servers...)
+	var clients []*torus.Server
+	for i := 0; i < 2; i++ {
+		c := newServer(t, mds)
+		if err := distributor.OpenReplication(c); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	const nBlocks = 20
+	size := BlockSize * nBlocks
+	if err := block.CreateBlockVolume(clients[0].MDS, "shared", uint64(size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.SetShared(clients[0].MDS, "shared", true); err != nil {
+		t.Fatal(err)
+	}
+	bv, err := block.OpenBlockVolume(clients[0], "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bv.OpenBlockFile(); err != torus.ErrShared {
+		t.Fatalf("expected ErrShared attaching a shared volume exclusively, got %v", err)
+	}
+
+	var files []*block.SharedBlockFile
+	for _, c := range clients {
+		bv, err := block.OpenBlockVolume(c, "shared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := bv.OpenSharedBlockFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	if err := block.SetShared(clients[0].MDS, "shared", false); err != torus.ErrLocked {
+		t.Fatalf("expected ErrLocked unsharing an attached volume, got %v", err)
+	}
+
+	// Each client writes its half of every block at the same time, so that
+	// they contend for the same block locks.
+	data := makeTestData(size)
+	half := BlockSize / 2
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i, f := range files {
+		wg.Add(1)
+		go func(i int, f *block.SharedBlockFile) {
+			defer wg.Done()
+			for b := 0; b < nBlocks; b++ {
+				off := b*BlockSize + i*half
+				if _, err := f.WriteAt(data[off:off+half], int64(off)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i, f)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	for i, f := range files {
+		got := make([]byte, size)
+		if _, err := f.ReadAt(got, 0); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("client %d read different data than both wrote", i)
+		}
+	}
+
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := block.SetShared(clients[0].MDS, "shared", false); err != nil {
+		t.Fatal(err)
+	}
+	f := openVol(t, clients[1], "shared")
+	defer f.Close()
+	got := make([]byte, size)
+	if _, err := f.ReadAt(got, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("the volume attached exclusively has different data than was written shared")
+	}
+}
@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/distributor"
+	"golang.org/x/net/context"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	data := makeTestData(size)
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	leaving := servers[0]
+	err = distributor.ShutdownReplication(leaving, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dmds := client.MDS.(torus.DepartureMetadataService)
+	ds, err := dmds.GetDepartures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].Peer != leaving.MDS.UUID() {
+		t.Fatalf("expected %s to have announced its departure, got %v", leaving.MDS.UUID(), ds)
+	}
+	peers, err := client.MDS.GetPeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peers.UUIDAt(leaving.MDS.UUID()) != -1 {
+		t.Fatal("expected the departed peer to have stopped heartbeating")
+	}
+	// The remaining replicas serve everything.
+	compareBytes(t, mds, data, "testvol")
+	closeAll(t, servers...)
+}
+
+func TestGracefulShutdownHandoff(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	// With a replication of 1, the leaving peer has the only copy of its
+	// blocks.
+	r, err := servers[0].MDS.GetRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = r.(torus.ModifyableRing).ChangeReplication(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mds.SetRing(r); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	client := newServer(t, mds)
+	err = distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 100
+	data := makeTestData(size)
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+
+	leaving := servers[0]
+	leaving.Cfg.ShutdownHandoff = true
+	err = distributor.ShutdownReplication(leaving, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes to the leaving peer are turned away.
+	ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	if err := leaving.Blocks.WriteBlock(context.TODO(), ref, make([]byte, BlockSize)); err != torus.ErrLeaving {
+		t.Fatalf("expected ErrLeaving, got %v", err)
+	}
+	// Its blocks are held by the peers after it until it's back.
+	compareBytes(t, mds, data, "testvol")
+	closeAll(t, servers...)
+}
@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestSnapshotSharesBlocks(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	size := BlockSize * 20
+	data := makeTestData(size)
+	f := createVol(t, client, "testvol", uint64(size))
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("couldn't copy: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("couldn't close: %v", err)
+	}
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bv.SaveSnapshot("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bv.SaveSnapshot("bad/name"); err == nil {
+		t.Error("expected a snapshot name with a slash to be rejected")
+	}
+	snapRefs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the first block only.
+	f = openVol(t, client, "testvol")
+	_, err = f.WriteAt(makeTestData(BlockSize), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	curRefs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curRefs[0] == snapRefs[0] {
+		t.Fatal("expected the rewritten block to get a new ref")
+	}
+	for i := 1; i < len(curRefs); i++ {
+		if curRefs[i] != snapRefs[i] {
+			t.Fatalf("expected block %d to be shared with the snapshot", i)
+		}
+	}
+
+	sf, err := bv.OpenSnapshot("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf.File.Close()
+	if !bytes.Equal(got, data) {
+		t.Error("snapshot doesn't read back the data it was taken of")
+	}
+
+	// The block only the snapshot uses lives as long as the snapshot.
+	vol, err := client.MDS.GetVolume("testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc, err := block.NewBlockVolGC(client, torus.NewINodeStore(client.Blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gc.PrepVolume(vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gc.IsDead(snapRefs[0]) {
+		t.Error("expected a block the snapshot refers to to be kept")
+	}
+	err = bv.DeleteSnapshot("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc.Clear()
+	err = gc.PrepVolume(vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gc.IsDead(snapRefs[0]) {
+		t.Error("expected the deleted snapshot's own block to be collected")
+	}
+	if gc.IsDead(snapRefs[1]) {
+		t.Error("expected a block the volume still uses to be kept")
+	}
+	if err := bv.DeleteSnapshot("before"); err != torus.ErrNotExist {
+		t.Errorf("expected deleting a missing snapshot to fail with ErrNotExist, got %v", err)
+	}
+	closeAll(t, servers...)
+}
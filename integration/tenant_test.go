@@ -0,0 +1,60 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestTenantQuota(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	tmds := client.MDS.(torus.TenantMetadataService)
+	err = tmds.SetTenantQuota("acme", torus.TenantQuota{
+		Soft: BlockSize * 15,
+		Hard: BlockSize * 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	soft, err := block.CreateTenantBlockVolume(client.MDS, "acme", "vol1", BlockSize*10)
+	if err != nil || soft {
+		t.Fatalf("expected vol1 to fit the soft quota, got %v, %v", soft, err)
+	}
+	soft, err = block.CreateTenantBlockVolume(client.MDS, "acme", "vol2", BlockSize*10)
+	if err != nil || !soft {
+		t.Fatalf("expected vol2 to go over the soft quota, got %v, %v", soft, err)
+	}
+	_, err = block.CreateTenantBlockVolume(client.MDS, "acme", "vol3", BlockSize*20)
+	if err != torus.ErrQuotaExceeded {
+		t.Fatalf("expected vol3 to go over the hard quota, got %v", err)
+	}
+	usage, err := torus.GetTenantUsage(client.MDS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := usage["acme"]; u == nil || u.Volumes != 2 || u.Provisioned != BlockSize*20 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+
+	// Lowering the hard quota below what's provisioned stops writes.
+	err = tmds.SetTenantQuota("acme", torus.TenantQuota{Hard: BlockSize * 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := openVol(t, client, "vol1")
+	_, err = f.WriteAt(makeTestData(BlockSize), 0)
+	if err != torus.ErrQuotaExceeded {
+		t.Fatalf("expected write over the hard quota to fail, got %v", err)
+	}
+	f.Close()
+	closeAll(t, servers...)
+}
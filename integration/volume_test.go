@@ -0,0 +1,235 @@
+package integration
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/distributor"
+)
+
+func TestCreateBlockVolumes(t *testing.T) {
+	servers, mds := ringN(t, 1)
+	client := newServer(t, mds)
+	defer client.Close()
+	size := uint64(BlockSize * 10)
+	err := block.CreateBlockVolumes(client.MDS, []string{"disk-0", "disk-1", "disk-2"}, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vols, _, err := client.MDS.GetVolumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[uint64]bool)
+	for _, v := range vols {
+		ids[v.Id] = true
+		if v.MaxBytes != size {
+			t.Errorf("volume %s has size %d, expected %d", v.Name, v.MaxBytes, size)
+		}
+	}
+	if len(vols) != 3 || len(ids) != 3 {
+		t.Fatalf("expected 3 volumes with distinct ids, got %v", vols)
+	}
+	// Each volume is usable on its own.
+	f := openVol(t, client, "disk-1")
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = block.CreateBlockVolumes(client.MDS, []string{"disk-3", "disk-2"}, size)
+	if err != torus.ErrExists {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+	_, err = client.MDS.GetVolume("disk-3")
+	if err == nil {
+		t.Error("expected no volumes to be created from a batch with a taken name")
+	}
+	closeAll(t, servers...)
+}
+
+func TestTrimBlockVolume(t *testing.T) {
+	servers, mds := ringN(t, 1)
+	client := newServer(t, mds)
+	defer client.Close()
+	f := createVol(t, client, "testvol", BlockSize*8)
+	data := makeTestData(BlockSize*4 + 100)
+	_, err := f.WriteAt(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last block is still only in the write cache.
+	err = f.Trim(BlockSize, BlockSize*4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f = openVol(t, client, "testvol")
+	got := make([]byte, len(data))
+	_, err = f.ReadAt(got, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:BlockSize], data[:BlockSize]) {
+		t.Error("expected the block before the trim to be kept")
+	}
+	if !bytes.Equal(got[BlockSize:], make([]byte, len(data)-BlockSize)) {
+		t.Error("expected the trimmed blocks to read as zeros")
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeAll(t, servers...)
+}
+
+func TestDiscardFreesBlocks(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	f := createVol(t, client, "testvol", BlockSize*8)
+	data := makeTestData(BlockSize * 4)
+	_, err = f.WriteAt(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 4 {
+		t.Fatalf("expected 4 blocks, got %d", len(refs))
+	}
+
+	f = openVol(t, client, "testvol")
+	err = f.Trim(BlockSize, BlockSize*3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	for _, s := range servers {
+		has, err := s.Blocks.(*distributor.Distributor).RebalanceCheck(ctx, refs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i < 4; i++ {
+			if has[i] {
+				t.Errorf("%s still has discarded block %d", s.MDS.UUID(), i)
+			}
+		}
+	}
+	got := make([]byte, BlockSize)
+	_, err = f.ReadAt(got, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[:BlockSize]) {
+		t.Error("expected the block before the discard to be kept")
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeAll(t, servers...)
+}
+
+func TestDedupBlockVolume(t *testing.T) {
+	servers, mds := ringN(t, 3)
+	client := newServer(t, mds)
+	err := distributor.OpenReplication(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	f := createVol(t, client, "testvol", BlockSize*8)
+	a, b := makeTestData(BlockSize), makeTestData(BlockSize)
+	for i, data := range [][]byte{a, b, a, a} {
+		_, err = f.WriteAt(data, int64(i*BlockSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv, err := block.OpenBlockVolume(client, "testvol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	an, err := bv.AnalyzeDedup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if an.Blocks != 4 || an.Stored != 4 || an.Unique != 2 || an.Savings() != 2*BlockSize {
+		t.Fatalf("unexpected analysis before dedup: %+v", an)
+	}
+
+	err = block.SetDedup(client.MDS, "testvol", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = openVol(t, client, "testvol")
+	for i := 0; len(f.UnhashedBlocks()) != 0; i++ {
+		if i == 100 {
+			t.Fatal("background dedup didn't finish")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// A discard of one of the copies leaves the stored block to the others.
+	err = f.Trim(BlockSize*2, BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	an, err = bv.AnalyzeDedup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if an.Blocks != 3 || an.Stored != 2 || an.Unique != 2 {
+		t.Fatalf("unexpected analysis after dedup: %+v", an)
+	}
+	f = openVol(t, client, "testvol")
+	got := make([]byte, BlockSize*4)
+	_, err = f.ReadAt(got, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bytes.Join([][]byte{a, b, make([]byte, BlockSize), a}, nil)
+	if !bytes.Equal(got, want) {
+		t.Error("deduplicated volume doesn't read back as written")
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeAll(t, servers...)
+}
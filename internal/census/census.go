@@ -0,0 +1,104 @@
+// Package census takes a snapshot of a cluster's peers, ring and blocks, so
+// that tools like ringtool can model changes to the real cluster instead of a
+// synthetic one.
+package census
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/models"
+)
+
+// Census is a snapshot of a cluster, as written by `torusctl ring dump`.
+type Census struct {
+	BlockSize uint64       `json:"block_size"`
+	Ring      *models.Ring `json:"ring"`
+	// Peers are the peers that were heartbeating, with their capacity and
+	// usage.
+	Peers  []*models.PeerInfo `json:"peers"`
+	Blocks []*models.BlockRef `json:"blocks"`
+}
+
+// Take reads the census of the cluster srv belongs to. Blocks are read from
+// the current inodes of every block volume, which takes a peer to serve them.
+func Take(srv *torus.Server) (*Census, error) {
+	r, err := srv.MDS.GetRing()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	rm := &models.Ring{}
+	err = rm.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := srv.MDS.GetPeers()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := Blocks(srv)
+	if err != nil {
+		return nil, err
+	}
+	c := &Census{
+		BlockSize: srv.MDS.GlobalMetadata().BlockSize,
+		Ring:      rm,
+		Peers:     peers,
+	}
+	for _, ref := range refs {
+		c.Blocks = append(c.Blocks, ref.ToProto())
+	}
+	return c, nil
+}
+
+// Blocks returns the blocks of every block volume. Blocks that have never
+// been written are left out.
+func Blocks(srv *torus.Server) ([]torus.BlockRef, error) {
+	vols, _, err := srv.MDS.GetVolumes()
+	if err != nil {
+		return nil, err
+	}
+	var out []torus.BlockRef
+	for _, vol := range vols {
+		if vol.Type != block.VolumeType {
+			continue
+		}
+		bv, err := block.OpenBlockVolume(srv, vol.Name)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := bv.BlockRefs()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, refs...)
+	}
+	return out, nil
+}
+
+func Read(r io.Reader) (*Census, error) {
+	c := &Census{}
+	err := json.NewDecoder(r).Decode(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Census) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(c)
+}
+
+func (c *Census) BlockRefs() []torus.BlockRef {
+	out := make([]torus.BlockRef, len(c.Blocks))
+	for i, b := range c.Blocks {
+		out[i] = torus.BlockFromProto(b)
+	}
+	return out
+}
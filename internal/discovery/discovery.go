@@ -0,0 +1,134 @@
+// discovery finds the etcd endpoints of a cluster, so that a new node only
+// needs to be told where to look, rather than every endpoint. Endpoints are
+// looked up in DNS SRV records, the same ones etcd's own discovery uses, or
+// asked for over multicast DNS on the local network, where the peers of the
+// cluster answer.
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "discovery")
+
+// The SRV services etcd client endpoints are published under, for plain and
+// TLS connections.
+const (
+	serviceClient    = "etcd-client"
+	serviceClientSSL = "etcd-client-ssl"
+)
+
+// DefaultTimeout is how long Lookup waits for answers over multicast DNS.
+const DefaultTimeout = 3 * time.Second
+
+// ErrNotFound is returned if no endpoints were found.
+var ErrNotFound = errors.New("discovery: no metadata endpoints found")
+
+// Lookup finds etcd endpoints as spec says: "dns:DOMAIN" looks up the SRV
+// records of DOMAIN, and "mdns" asks the local network, waiting up to
+// timeout for answers. The endpoints are returned as URLs, sorted.
+func Lookup(spec string, timeout time.Duration) ([]string, error) {
+	switch {
+	case strings.HasPrefix(spec, "dns:"):
+		domain := strings.TrimPrefix(spec, "dns:")
+		if domain == "" {
+			return nil, fmt.Errorf("discovery: no domain in %q", spec)
+		}
+		return LookupSRV(domain)
+	case spec == "mdns":
+		return LookupMDNS(timeout)
+	}
+	return nil, fmt.Errorf("discovery: unknown method %q; use dns:DOMAIN or mdns", spec)
+}
+
+// LookupSRV returns the etcd endpoints in the _etcd-client._tcp and
+// _etcd-client-ssl._tcp SRV records of domain.
+func LookupSRV(domain string) ([]string, error) {
+	var out []string
+	var lastErr error
+	for _, service := range []string{serviceClient, serviceClientSSL} {
+		_, addrs, err := net.LookupSRV(service, "tcp", domain)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, a := range addrs {
+			out = append(out, endpointURL(service, strings.TrimSuffix(a.Target, "."), a.Port))
+		}
+	}
+	if len(out) == 0 {
+		if lastErr != nil {
+			return nil, fmt.Errorf("discovery: %v", lastErr)
+		}
+		return nil, ErrNotFound
+	}
+	return dedup(out), nil
+}
+
+// endpointURL returns the URL of the etcd endpoint at host:port that was
+// published under service.
+func endpointURL(service, host string, port uint16) string {
+	scheme := "http"
+	if service == serviceClientSSL {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+// endpoint is an etcd endpoint to advertise.
+type endpoint struct {
+	service string
+	host    string
+	port    uint16
+}
+
+// parseEndpoint parses an etcd endpoint as the metadata address gives it,
+// either as a URL or as host:port, which etcd takes to be plain HTTP.
+func parseEndpoint(s string) (endpoint, error) {
+	e := endpoint{service: serviceClient}
+	hostport := s
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return e, err
+		}
+		switch u.Scheme {
+		case "http":
+		case "https":
+			e.service = serviceClientSSL
+		default:
+			return e, fmt.Errorf("discovery: can't advertise %s endpoint %s", u.Scheme, s)
+		}
+		hostport = u.Host
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return e, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return e, fmt.Errorf("discovery: bad port in %s", s)
+	}
+	e.host, e.port = host, uint16(p)
+	return e, nil
+}
+
+func dedup(eps []string) []string {
+	sort.Strings(eps)
+	out := eps[:0]
+	for i, e := range eps {
+		if i == 0 || e != eps[i-1] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
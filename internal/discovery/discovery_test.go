@@ -0,0 +1,88 @@
+package discovery
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		in   string
+		want endpoint
+		bad  bool
+	}{
+		{in: "10.0.0.5:2379", want: endpoint{serviceClient, "10.0.0.5", 2379}},
+		{in: "http://etcd.lab:2379", want: endpoint{serviceClient, "etcd.lab", 2379}},
+		{in: "https://[fd00::1]:2379", want: endpoint{serviceClientSSL, "fd00::1", 2379}},
+		{in: "unix://etcd.sock", bad: true},
+		{in: "10.0.0.5", bad: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEndpoint(tt.in)
+		if tt.bad {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMDNSAnswer(t *testing.T) {
+	var eps []endpoint
+	for _, s := range []string{"http://10.0.0.5:2379", "https://etcd.lab:2379", "0.0.0.0:2379", "[::]:2381"} {
+		e, err := parseEndpoint(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eps = append(eps, e)
+	}
+	local := func() net.IP { return net.ParseIP("10.0.0.9") }
+
+	q, err := mdnsQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := answer(q, eps, true, local)
+	if !ok {
+		t.Fatal("expected an answer")
+	}
+	got, err := parseAnswers(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"http://10.0.0.5:2379",
+		"http://10.0.0.9:2379",
+		"http://10.0.0.9:2381",
+		"https://etcd.lab:2379",
+	}
+	if got = dedup(got); !reflect.DeepEqual(got, want) {
+		t.Errorf("got endpoints %v, want %v", got, want)
+	}
+
+	// Responses, and queries for anything else, go unanswered.
+	if _, ok := answer(resp, eps, true, local); ok {
+		t.Error("answered a response")
+	}
+	other := dnsmessage.Message{Questions: []dnsmessage.Question{{
+		Name:  dnsmessage.MustNewName("_http._tcp.local."),
+		Type:  dnsmessage.TypeSRV,
+		Class: dnsmessage.ClassINET,
+	}}}
+	b, err := other.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := answer(b, eps, true, local); ok {
+		t.Error("answered a query for another service")
+	}
+}
@@ -0,0 +1,293 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mdnsAddr is where multicast DNS queries are sent.
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsTTL is how long, in seconds, answers may be cached.
+const mdnsTTL = 120
+
+// Queries ask for a unicast reply in the top bit of their class.
+const unicastResponse = 1 << 15
+
+func serviceName(service string) string {
+	return "_" + service + "._tcp.local."
+}
+
+// LookupMDNS asks the local network for etcd endpoints over multicast DNS,
+// and returns those it hears of within timeout.
+func LookupMDNS(timeout time.Duration) ([]string, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	q, err := mdnsQuery()
+	if err != nil {
+		return nil, err
+	}
+	// Sent from a port other than 5353, this is a legacy unicast query:
+	// responders answer to where it came from, so it needn't join the
+	// multicast group.
+	if _, err = conn.WriteToUDP(q, mdnsAddr); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	var out []string
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		eps, err := parseAnswers(buf[:n])
+		if err != nil {
+			clog.Debugf("ignoring bad mDNS answer from %s: %v", src, err)
+			continue
+		}
+		out = append(out, eps...)
+	}
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	return dedup(out), nil
+}
+
+func mdnsQuery() ([]byte, error) {
+	m := dnsmessage.Message{}
+	for _, service := range []string{serviceClient, serviceClientSSL} {
+		name, err := dnsmessage.NewName(serviceName(service))
+		if err != nil {
+			return nil, err
+		}
+		m.Questions = append(m.Questions, dnsmessage.Question{
+			Name:  name,
+			Type:  dnsmessage.TypeSRV,
+			Class: dnsmessage.ClassINET,
+		})
+	}
+	return m.Pack()
+}
+
+// parseAnswers returns the etcd endpoints in the SRV records of an mDNS
+// response, using the addresses alongside them for their targets.
+func parseAnswers(msg []byte) ([]string, error) {
+	var m dnsmessage.Message
+	if err := m.Unpack(msg); err != nil {
+		return nil, err
+	}
+	if !m.Header.Response {
+		return nil, nil
+	}
+	addrs := make(map[string]string)
+	for _, rs := range [][]dnsmessage.Resource{m.Answers, m.Additionals} {
+		for _, r := range rs {
+			name := strings.ToLower(r.Header.Name.String())
+			switch b := r.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs[name] = net.IP(b.A[:]).String()
+			case *dnsmessage.AAAAResource:
+				addrs[name] = net.IP(b.AAAA[:]).String()
+			}
+		}
+	}
+	var out []string
+	for _, r := range m.Answers {
+		srv, ok := r.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		for _, service := range []string{serviceClient, serviceClientSSL} {
+			if !strings.EqualFold(r.Header.Name.String(), serviceName(service)) {
+				continue
+			}
+			target := srv.Target.String()
+			host, ok := addrs[strings.ToLower(target)]
+			if !ok {
+				host = strings.TrimSuffix(target, ".")
+			}
+			out = append(out, endpointURL(service, host, srv.Port))
+		}
+	}
+	return out, nil
+}
+
+// A Responder answers mDNS queries for etcd endpoints.
+type Responder struct {
+	conn *net.UDPConn
+	eps  []endpoint
+}
+
+// Advertise answers mDNS queries on the local network with endpoints, until
+// the Responder is closed. Endpoints on the loopback address can't be reached
+// from other hosts, so aren't advertised; those on the unspecified address
+// are advertised at the address the query came in on.
+func Advertise(endpoints []string) (*Responder, error) {
+	var eps []endpoint
+	for _, s := range endpoints {
+		e, err := parseEndpoint(s)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(e.host); e.host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			clog.Warningf("not advertising metadata endpoint %s, which other hosts can't reach", s)
+			continue
+		}
+		eps = append(eps, e)
+	}
+	if len(eps) == 0 {
+		return nil, errors.New("discovery: no metadata endpoints other hosts can reach to advertise")
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: couldn't listen for mDNS queries: %v", err)
+	}
+	r := &Responder{conn: conn, eps: eps}
+	go r.serve()
+	return r, nil
+}
+
+// Close stops answering queries.
+func (r *Responder) Close() error {
+	return r.conn.Close()
+}
+
+func (r *Responder) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			// Closed.
+			return
+		}
+		legacy := src.Port != mdnsAddr.Port
+		resp, ok := answer(buf[:n], r.eps, legacy, func() net.IP { return localIPFor(src) })
+		if !ok {
+			continue
+		}
+		dst := mdnsAddr
+		if legacy {
+			dst = src
+		}
+		if _, err := r.conn.WriteToUDP(resp, dst); err != nil {
+			clog.Debugf("couldn't answer mDNS query from %s: %v", src, err)
+		}
+	}
+}
+
+// localIPFor returns the address of this host that packets to dst leave from.
+func localIPFor(dst *net.UDPAddr) net.IP {
+	c, err := net.DialUDP("udp4", nil, dst)
+	if err != nil {
+		return nil
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).IP
+}
+
+// answer returns the response to an mDNS query for eps, if it asks for any
+// of them. A legacy unicast query gets its ID and questions back, as a
+// plain DNS client expects. local returns the address to give for endpoints
+// on the unspecified address.
+func answer(query []byte, eps []endpoint, legacy bool, local func() net.IP) ([]byte, bool) {
+	var q dnsmessage.Message
+	if err := q.Unpack(query); err != nil || q.Header.Response {
+		return nil, false
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+	}
+	if legacy {
+		resp.Header.ID = q.Header.ID
+	}
+	var localIP net.IP
+	for _, question := range q.Questions {
+		if question.Class&^unicastResponse != dnsmessage.ClassINET {
+			continue
+		}
+		if question.Type != dnsmessage.TypeSRV && question.Type != dnsmessage.TypeALL {
+			continue
+		}
+		matched := false
+		for _, e := range eps {
+			if !strings.EqualFold(question.Name.String(), serviceName(e.service)) {
+				continue
+			}
+			ip := net.ParseIP(e.host)
+			if e.host == "" || (ip != nil && ip.IsUnspecified()) {
+				if localIP == nil {
+					localIP = local()
+				}
+				ip = localIP
+				if ip == nil {
+					continue
+				}
+			}
+			target, addr, err := srvTarget(e.host, ip)
+			if err != nil {
+				continue
+			}
+			matched = true
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: mdnsTTL},
+				Body:   &dnsmessage.SRVResource{Port: e.port, Target: target},
+			})
+			if addr != nil {
+				resp.Additionals = append(resp.Additionals, *addr)
+			}
+		}
+		if matched && legacy {
+			resp.Questions = append(resp.Questions, dnsmessage.Question{
+				Name:  question.Name,
+				Type:  question.Type,
+				Class: dnsmessage.ClassINET,
+			})
+		}
+	}
+	if len(resp.Answers) == 0 {
+		return nil, false
+	}
+	b, err := resp.Pack()
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// srvTarget returns the target of the SRV record for an endpoint on host.
+// Endpoints on an IP address get a made-up name, and the address record to
+// go with it; those on a host name are left to be looked up.
+func srvTarget(host string, ip net.IP) (dnsmessage.Name, *dnsmessage.Resource, error) {
+	if ip == nil {
+		name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+		return name, nil, err
+	}
+	label := strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+	name, err := dnsmessage.NewName("torus-" + label + ".local.")
+	if err != nil {
+		return name, nil, err
+	}
+	hdr := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: mdnsTTL}
+	if ip4 := ip.To4(); ip4 != nil {
+		var a dnsmessage.AResource
+		copy(a.A[:], ip4)
+		hdr.Type = dnsmessage.TypeA
+		return name, &dnsmessage.Resource{Header: hdr, Body: &a}, nil
+	}
+	var a dnsmessage.AAAAResource
+	copy(a.AAAA[:], ip.To16())
+	hdr.Type = dnsmessage.TypeAAAA
+	return name, &dnsmessage.Resource{Header: hdr, Body: &a}, nil
+}
@@ -4,6 +4,7 @@ package flagconfig
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -12,9 +13,12 @@ import (
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/coreos/torus"
 	cli "github.com/coreos/torus/cliconfig"
+	"github.com/coreos/torus/internal/discovery"
+	"github.com/coreos/torus/internal/peertls"
 	"github.com/dustin/go-humanize"
 	flag "github.com/spf13/pflag"
 )
@@ -29,25 +33,65 @@ var (
 	localBlockSize    uint64
 	readCacheSizeStr  string
 	readCacheSize     uint64
+	readCacheDir      string
+	readCacheDiskStr  string
+	readCacheDiskSize uint64
 	readLevel         string
 	writeLevel        string
 	etcdAddress       string
+	consulAddress     string
 	etcdCertFile      string
 	etcdKeyFile       string
 	etcdCAFile        string
 	config            string
 	profile           string
+	zone              string
+	readLocalZone     bool
+	readLeastLoaded   bool
+	peerTimeout       time.Duration
+	encryptionKeyFile string
+	peerCertFile      string
+	peerKeyFile       string
+	peerCAFile        string
+	token             string
+	writeBatchSize    int
+	writeBatchWait    time.Duration
+	peerConns         int
+	hedgeDelay        time.Duration
+	peerConnIdle      time.Duration
+	metadataCache     bool
+	discover          string
+	discovered        bool
 )
 
 func AddConfigFlags(set *flag.FlagSet) {
 	set.StringVarP(&localBlockSizeStr, "write-cache-size", "", "128MiB", "Maximum amount of memory to use for the local write cache")
 	set.StringVarP(&readCacheSizeStr, "read-cache-size", "", "50MiB", "Amount of memory to use for read cache")
-	set.StringVarP(&readLevel, "read-level", "", "block", "Read replication level (spread, seq or block)")
-	set.StringVarP(&writeLevel, "write-level", "", "all", "Write replication level (all, one or local)")
-	set.StringVarP(&etcdAddress, "etcd", "C", "", "Address for talking to etcd (default \"127.0.0.1:2379\")")
+	set.StringVarP(&readCacheDir, "read-cache-dir", "", "", "Directory on local disk to keep blocks pushed out of the read cache in memory")
+	set.StringVarP(&readCacheDiskStr, "read-cache-disk-size", "", "0", "Amount of disk under read-cache-dir to use for read cache")
+	set.IntVarP(&writeBatchSize, "write-batch-size", "", 16, "Most blocks to send to a peer in one write; 1 sends each block on its own")
+	set.DurationVarP(&writeBatchWait, "write-batch-interval", "", 0, "How long a write to an idle peer waits for others to send with it")
+	set.IntVarP(&peerConns, "peer-conns", "", 4, "Most connections to keep open to each peer")
+	set.DurationVarP(&peerConnIdle, "peer-conn-idle-timeout", "", 5*time.Minute, "How long a connection to a peer may go unused before it is closed; 0 keeps it open")
+	set.StringVarP(&readLevel, "read-level", "", "block", "Read replication level (spread, seq, block, hedge or quorum)")
+	set.DurationVarP(&hedgeDelay, "hedge-delay", "", 0, "How long a hedged read waits for a peer before asking the next; 0 uses the 95th percentile of recent reads")
+	set.StringVarP(&writeLevel, "write-level", "", "all", "Write replication level (all, quorum, one or local)")
+	set.StringVarP(&etcdAddress, "etcd", "C", "", "Address for talking to etcd, or several separated by commas (default \"127.0.0.1:2379\")")
+	set.StringVarP(&discover, "discover", "", "", "Find the etcd endpoints instead of giving --etcd: dns:DOMAIN looks them up in DOMAIN's SRV records, mdns asks the peers on the local network")
+	set.StringVarP(&consulAddress, "consul", "", "", "Address for talking to Consul, to keep metadata there instead of etcd; the etcd TLS flags apply to it too")
 	set.StringVarP(&etcdCertFile, "etcd-cert-file", "", "", "Certificate to use to authenticate against etcd")
 	set.StringVarP(&etcdKeyFile, "etcd-key-file", "", "", "Key for Certificate")
 	set.StringVarP(&etcdCAFile, "etcd-ca-file", "", "", "CA to authenticate etcd against")
+	set.BoolVarP(&metadataCache, "metadata-cache", "", true, "Keep hot metadata, such as the ring and volumes, in memory, kept up to date by watching etcd")
+	set.StringVarP(&zone, "zone", "", "", "Failure domain, such as a rack or availability zone, this process runs in")
+	set.BoolVarP(&readLocalZone, "read-local-zone", "", false, "Read from replicas in the same zone before others")
+	set.BoolVarP(&readLeastLoaded, "read-least-loaded", "", false, "Read from the least loaded replicas, by their heartbeats, more often than others")
+	set.DurationVarP(&peerTimeout, "peer-timeout", "", torus.DefaultPeerTimeout, "How long a peer may go without heartbeating before it is considered down")
+	set.StringVarP(&encryptionKeyFile, "encryption-key-file", "", "", "File holding the 32-byte key, raw or hex-encoded, that protects the keys of encrypted volumes")
+	set.StringVarP(&peerCertFile, "peer-cert", "", "", "Certificate to present to other peers; enables TLS between peers")
+	set.StringVarP(&peerKeyFile, "peer-key", "", "", "Key for the peer certificate")
+	set.StringVarP(&peerCAFile, "peer-ca", "", "", "Cluster CA that the certificates of other peers must be signed by")
+	set.StringVarP(&token, "token", "", "", "Token identifying this client to volume ACLs, instead of the peer certificate")
 	set.StringVarP(&config, "config", "", "", "path to torus config file")
 	set.StringVarP(&profile, "profile", "", "default", "profile to use in torus config file")
 }
@@ -81,6 +125,19 @@ func LoadConfigFile(config string) (*cli.TorusConfig, error) {
 
 func BuildConfigFromFlags() torus.Config {
 	var err error
+	if discover != "" && !discovered {
+		if etcdAddress != "" || consulAddress != "" {
+			fmt.Fprintf(os.Stderr, "--discover finds the etcd endpoints, so can't be used with --etcd or --consul\n")
+			os.Exit(1)
+		}
+		eps, err := discovery.Lookup(discover, discovery.DefaultTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't discover the etcd endpoints: %s\n", err)
+			os.Exit(1)
+		}
+		etcdAddress = strings.Join(eps, ",")
+		discovered = true
+	}
 	if config == "" {
 		config = defaultConfigPath()
 	}
@@ -109,6 +166,11 @@ func BuildConfigFromFlags() torus.Config {
 		fmt.Fprintf(os.Stderr, "error parsing read-cache-size: %s\n", err)
 		os.Exit(1)
 	}
+	readCacheDiskSize, err = humanize.ParseBytes(readCacheDiskStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing read-cache-disk-size: %s\n", err)
+		os.Exit(1)
+	}
 	localBlockSize, err = humanize.ParseBytes(localBlockSizeStr)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error parsing write-cache-size: %s\n", err)
@@ -130,13 +192,56 @@ func BuildConfigFromFlags() torus.Config {
 	if etcdAddress == "" {
 		etcdAddress = defaultEtcdAddress
 	}
+	if consulAddress != "" {
+		etcdAddress = consulAddress
+	}
 
 	cfg := torus.Config{
-		StorageSize:     localBlockSize,
-		ReadCacheSize:   readCacheSize,
-		WriteLevel:      wl,
-		ReadLevel:       rl,
-		MetadataAddress: etcdAddress,
+		StorageSize:         localBlockSize,
+		ReadCacheSize:       readCacheSize,
+		ReadCacheDir:        readCacheDir,
+		ReadCacheDiskSize:   readCacheDiskSize,
+		WriteLevel:          wl,
+		ReadLevel:           rl,
+		MetadataAddress:     etcdAddress,
+		Zone:                zone,
+		ReadLocalZone:       readLocalZone,
+		ReadLeastLoaded:     readLeastLoaded,
+		PeerTimeout:         peerTimeout,
+		WriteBatchSize:      writeBatchSize,
+		WriteBatchInterval:  writeBatchWait,
+		PeerConns:           peerConns,
+		HedgeDelay:          hedgeDelay,
+		PeerConnIdleTimeout: peerConnIdle,
+		MetadataCache:       metadataCache,
+	}
+	if encryptionKeyFile != "" {
+		cfg.EncryptionKey, err = loadEncryptionKey(encryptionKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading encryption key: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if peerCertFile != "" || peerKeyFile != "" || peerCAFile != "" {
+		if peerCertFile == "" || peerKeyFile == "" || peerCAFile == "" {
+			fmt.Fprintf(os.Stderr, "--peer-cert, --peer-key and --peer-ca must be given together\n")
+			os.Exit(1)
+		}
+		r, err := peertls.NewReloader(peerCertFile, peerKeyFile, peerCAFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't load peer TLS config: %s\n", err)
+			os.Exit(1)
+		}
+		cfg.PeerTLS = r.Config()
+		cfg.Identity, err = r.Identity()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't parse peer certificate: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if token != "" {
+		cfg.Identity = torus.TokenIdentity(token)
+		cfg.Token = token
 	}
 	etcdURL, err := url.Parse(etcdAddress)
 	if err != nil {
@@ -166,3 +271,27 @@ func BuildConfigFromFlags() torus.Config {
 
 	return cfg
 }
+
+// MetadataService returns the name of the metadata service the flags point
+// at, to pass to torus.CreateMetadataService and friends.
+func MetadataService() string {
+	if consulAddress != "" {
+		return "consul"
+	}
+	return "etcd"
+}
+
+func loadEncryptionKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == torus.KeySize {
+		return b, nil
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != torus.KeySize {
+		return nil, fmt.Errorf("%s must hold a %d-byte key, raw or hex-encoded", path, torus.KeySize)
+	}
+	return key, nil
+}
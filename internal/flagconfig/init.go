@@ -0,0 +1,55 @@
+package flagconfig
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	"github.com/coreos/torus/ring"
+	"github.com/dustin/go-humanize"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	initBlockSize string
+	initBlockSpec string
+	initNoRing    bool
+)
+
+// AddInitFlags adds the flags that set up a new cluster's metadata, for
+// torusctl init and for torusd when it initializes the metadata itself.
+func AddInitFlags(set *flag.FlagSet) {
+	set.StringVarP(&initBlockSize, "block-size", "", "512KiB", "size of all data blocks in this storage cluster")
+	set.StringVarP(&initBlockSpec, "block-spec", "", "crc", "default replication/error correction applied to blocks in this storage cluster")
+	set.BoolVar(&initNoRing, "no-ring", false, "do not create the default ring as part of init")
+}
+
+// InitMetadata returns the global metadata and the type of the first ring
+// that the init flags ask for.
+func InitMetadata() (torus.GlobalMetadata, torus.RingType, error) {
+	var md torus.GlobalMetadata
+	size, err := humanize.ParseBytes(initBlockSize)
+	if err != nil {
+		return md, 0, fmt.Errorf("error parsing block-size: %v", err)
+	}
+	md.BlockSize = size
+	spec := initBlockSpec
+	// We *always* need base.
+	if !strings.HasSuffix(spec, ",base") && !strings.HasPrefix(spec, "base") {
+		spec += ",base"
+	}
+	md.DefaultBlockSpec, err = blockset.ParseBlockLayerSpec(spec)
+	if err != nil {
+		return md, 0, fmt.Errorf("error parsing block-spec: %v", err)
+	}
+	if initNoRing {
+		return md, ring.Empty, nil
+	}
+	return md, ring.Ketama, nil
+}
+
+// NoRing reports whether --no-ring was given.
+func NoRing() bool {
+	return initNoRing
+}
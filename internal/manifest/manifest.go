@@ -0,0 +1,137 @@
+// Package manifest computes and checks checksum manifests of volume contents.
+// A manifest is plain text, with a SHA-256 sum for every extent of the volume
+// and one for the whole of it, so that it can be kept outside the cluster and
+// checked against a restore or a mirror copy with ordinary tools.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const header = "torus-manifest v1"
+
+var ErrMalformed = errors.New("manifest: malformed manifest")
+
+// Manifest holds the checksums of a volume's contents.
+type Manifest struct {
+	Volume     string
+	Size       uint64
+	ExtentSize uint64
+	// Extents holds the sum of each extent, in order. The last one may be
+	// short.
+	Extents [][]byte
+	// Sum is the sum of the whole volume.
+	Sum []byte
+}
+
+// Compute reads size bytes from r, and returns their manifest.
+func Compute(volume string, r io.Reader, size, extentSize uint64) (*Manifest, error) {
+	if extentSize == 0 {
+		return nil, errors.New("manifest: extent size must be positive")
+	}
+	m := &Manifest{
+		Volume:     volume,
+		Size:       size,
+		ExtentSize: extentSize,
+	}
+	whole := sha256.New()
+	buf := make([]byte, extentSize)
+	for off := uint64(0); off < size; off += extentSize {
+		n := extentSize
+		if size-off < n {
+			n = size - off
+		}
+		_, err := io.ReadFull(r, buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("manifest: couldn't read at offset %d: %v", off, err)
+		}
+		sum := sha256.Sum256(buf[:n])
+		m.Extents = append(m.Extents, sum[:])
+		whole.Write(buf[:n])
+	}
+	m.Sum = whole.Sum(nil)
+	return m, nil
+}
+
+func (m *Manifest) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, header)
+	fmt.Fprintf(bw, "volume %s\n", m.Volume)
+	fmt.Fprintf(bw, "size %d\n", m.Size)
+	fmt.Fprintf(bw, "extent-size %d\n", m.ExtentSize)
+	fmt.Fprintf(bw, "sha256 %x\n", m.Sum)
+	for i, sum := range m.Extents {
+		fmt.Fprintf(bw, "%d %x\n", uint64(i)*m.ExtentSize, sum)
+	}
+	return bw.Flush()
+}
+
+func Read(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	sc := bufio.NewScanner(r)
+	if !sc.Scan() || sc.Text() != header {
+		return nil, ErrMalformed
+	}
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			return nil, ErrMalformed
+		}
+		var err error
+		switch fields[0] {
+		case "volume":
+			m.Volume = fields[1]
+		case "size":
+			m.Size, err = strconv.ParseUint(fields[1], 10, 64)
+		case "extent-size":
+			m.ExtentSize, err = strconv.ParseUint(fields[1], 10, 64)
+		case "sha256":
+			m.Sum, err = hex.DecodeString(fields[1])
+		default:
+			var off uint64
+			off, err = strconv.ParseUint(fields[0], 10, 64)
+			if err != nil || m.ExtentSize == 0 || off != uint64(len(m.Extents))*m.ExtentSize {
+				return nil, ErrMalformed
+			}
+			var sum []byte
+			sum, err = hex.DecodeString(fields[1])
+			m.Extents = append(m.Extents, sum)
+		}
+		if err != nil {
+			return nil, ErrMalformed
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if m.ExtentSize == 0 || uint64(len(m.Extents)) != (m.Size+m.ExtentSize-1)/m.ExtentSize {
+		return nil, ErrMalformed
+	}
+	return m, nil
+}
+
+// Mismatches returns the offsets of the extents that differ between m and
+// other, which must cover the same size in the same extents.
+func (m *Manifest) Mismatches(other *Manifest) ([]uint64, error) {
+	if m.Size != other.Size {
+		return nil, fmt.Errorf("manifest: sizes differ: %d and %d", m.Size, other.Size)
+	}
+	if m.ExtentSize != other.ExtentSize {
+		return nil, fmt.Errorf("manifest: extent sizes differ: %d and %d", m.ExtentSize, other.ExtentSize)
+	}
+	var out []uint64
+	for i, sum := range m.Extents {
+		if !bytes.Equal(sum, other.Extents[i]) {
+			out = append(out, uint64(i)*m.ExtentSize)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	m, err := Compute("vol", bytes.NewReader(data), uint64(len(data)), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Extents) != 3 {
+		t.Fatalf("expected 3 extents, got %d", len(m.Extents))
+	}
+	whole := sha256.Sum256(data)
+	if !bytes.Equal(m.Sum, whole[:]) {
+		t.Error("wrong sum for the whole volume")
+	}
+	last := sha256.Sum256(data[8192:])
+	if !bytes.Equal(m.Extents[2], last[:]) {
+		t.Error("wrong sum for the short last extent")
+	}
+
+	buf := &bytes.Buffer{}
+	err = m.Write(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("manifest changed in a round trip:\n%#v\n%#v", m, m2)
+	}
+
+	data[5000]++
+	m3, err := Compute("copy", bytes.NewReader(data), uint64(len(data)), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := m.Mismatches(m3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(bad) != "[4096]" {
+		t.Errorf("expected the extent at 4096 to differ, got %v", bad)
+	}
+}
+
+func TestManifestMalformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"not a manifest\n",
+		header + "\nsize 10\nextent-size 4\n0 00\n",
+		header + "\nsize 4\nextent-size 4\n4 00\n",
+	} {
+		if _, err := Read(bytes.NewBufferString(s)); err != ErrMalformed {
+			t.Errorf("expected %q to be malformed, got %v", s, err)
+		}
+	}
+}
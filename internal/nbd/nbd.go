@@ -45,6 +45,7 @@ const (
 	flagHasFlags  = (1 << 0) // nbd-server supports flags
 	flagSendFlush = (1 << 2) // can flush writeback cache
 	flagSendTrim  = (1 << 5) // Send TRIM (discard)
+	flagMultiConn = (1 << 8) // can serve one export over several connections
 	// flagReadOnly   = (1 << 1) // device is read-only
 	// flagSendFUA    = (1 << 3) // Send FUA (Force Unit Access)
 	// flagRotational = (1 << 4) // Use elevator algorithm - rotational media
@@ -60,6 +61,9 @@ const (
 	errIO = 5
 )
 
+// connWorkers is how many requests each connection serves at once.
+const connWorkers = 4
+
 // ioctl() helper function
 func ioctl(a1, a2, a3 uintptr) (err error) {
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, a1, a2, a3)
@@ -80,31 +84,41 @@ type Device interface {
 }
 
 type NBD struct {
-	device    Device
-	size      int64
-	blocksize int64
-	nbd       *os.File
-	socket    int
-	setsocket int
-	closer    chan error
+	device      Device
+	size        int64
+	blocksize   int64
+	connections int
+	nbd         *os.File
+	sockets     []int
+	setsockets  []int
+	closer      chan error
 }
 
 func Create(device Device, size int64, blocksize int64) *NBD {
 	if size >= 0 {
 		return &NBD{
-			device:    device,
-			size:      size,
-			blocksize: blocksize,
-			nbd:       nil,
-			socket:    0,
+			device:      device,
+			size:        size,
+			blocksize:   blocksize,
+			connections: 1,
+			nbd:         nil,
 		}
 	}
 	return nil
 }
 
+// SetConnections sets how many sockets OpenDevice gives the kernel to send
+// requests over. More than one needs Linux 4.10 or later.
+func (nbd *NBD) SetConnections(n int) {
+	if n < 1 {
+		n = 1
+	}
+	nbd.connections = n
+}
+
 // return true if connected
 func (nbd *NBD) IsConnected() bool {
-	return nbd.nbd != nil && nbd.socket > 0
+	return nbd.nbd != nil && len(nbd.sockets) > 0
 }
 
 func (nbd *NBD) Size() int64 {
@@ -162,17 +176,20 @@ func (nbd *NBD) OpenDevice(dev string) (string, error) {
 	// I'm really sorry about this
 	clog.Printf("ioctl (f.Fd(), BLKROSET,0 Error: %v", f)
 	}
-	//pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
-	pair, err := syscall.Socketpair(syscall.SOCK_STREAM, syscall.AF_UNIX, 0)
-	if err != nil {
-		return "", err
-	}
-	if err := ioctl(f.Fd(), ioctlSetSock, uintptr(pair[0])); err != nil {
-		return "", err
+	for i := 0; i < nbd.connections; i++ {
+		pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		if err != nil {
+			return "", err
+		}
+		if err := ioctl(f.Fd(), ioctlSetSock, uintptr(pair[0])); err != nil {
+			if i > 0 && err == syscall.EBUSY {
+				return "", fmt.Errorf("kernel doesn't support multiple connections per NBD device: %v", err)
+			}
+			return "", err
+		}
+		nbd.setsockets = append(nbd.setsockets, pair[0]) // FIXME: We shouldn't hold on to these.
+		nbd.sockets = append(nbd.sockets, pair[1])
 	}
-
-	nbd.setsocket = pair[0] // FIXME: We shouldn't hold on to this.
-	nbd.socket = pair[1]
 	return dev, nil
 }
 
@@ -209,7 +226,13 @@ func (nbd *NBD) Serve() error {
 	}  else {
 		clog.Printf("nbd.SetSize() worked with ndb.size: %v", nbd.size)
 	}
-	if err := ioctl(nbd.nbd.Fd(), ioctlSetFlags, uintptr(flagSendFlush|flagSendTrim)); err != nil {
+	flags := flagSendFlush | flagSendTrim
+	if len(nbd.sockets) > 1 {
+		// Every connection writes through the same device, so a flush on
+		// one covers writes completed on the others.
+		flags |= flagMultiConn
+	}
+	if err := ioctl(nbd.nbd.Fd(), ioctlSetFlags, uintptr(flags)); err != nil {
 		switch err {
 		case syscall.ENOTTY:
 			clog.Error(fmt.Sprintf("ioctl returned: %v. kernel version may be old. flush thread will run every 30sec", err))
@@ -231,22 +254,12 @@ func (nbd *NBD) Serve() error {
 	}
 
 	fmt.Printf("Attached to %s. Server loop begins ... \n", nbd.nbd.Name())
-	c := &serverConn{
-		rw: os.NewFile(uintptr(nbd.socket), "<nbd socket>"),
-	}
-	// TODO(barakmich): Scale up NBD by handling multiple requests.
-	// Requires thread-safety across the block.BlockFile/torus.File
-	//n := runtime.GOMAXPROCS(0) - 1
-	n := 1
-
 	wg := new(sync.WaitGroup)
-	wg.Add(n)
-	for i := 0; i < n; i++ {
-		go func() {
-			if err := c.serveLoop(nbd.device, wg); err != nil {
-				clog.Errorf("server returned: %s", err)
-			}
-		}()
+	for _, sock := range nbd.sockets {
+		c := &serverConn{
+			rw: os.NewFile(uintptr(sock), "<nbd socket>"),
+		}
+		c.serve(nbd.device, connWorkers, wg)
 	}
 	if !blksized {
 		// Back to the hack.
@@ -317,8 +330,23 @@ func (nbd *NBD) Disconnect() {
 }
 
 type serverConn struct {
-	mu sync.Mutex
-	rw io.ReadWriteCloser
+	mu     sync.Mutex // guards reading requests and closed
+	wmu    sync.Mutex // guards writing replies
+	rw     io.ReadWriteCloser
+	closed bool
+}
+
+// serve starts n goroutines answering requests on the connection, adding
+// them to wg.
+func (c *serverConn) serve(dev Device, n int, wg *sync.WaitGroup) {
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			if err := c.serveLoop(dev, wg); err != nil {
+				clog.Errorf("server returned: %s", err)
+			}
+		}()
+	}
 }
 
 func (c *serverConn) serveLoop(dev Device, wg *sync.WaitGroup) error {
@@ -333,7 +361,12 @@ func (c *serverConn) serveLoop(dev Device, wg *sync.WaitGroup) error {
 
 		if _, err := io.ReadFull(c.rw, hdr[:]); err != nil {
 			// FIXME: Are there any valid short reads we need to handle?
+			closed := c.closed
 			c.mu.Unlock()
+			if closed {
+				// Another worker got the disconnect.
+				return nil
+			}
 			return err
 		}
 
@@ -346,9 +379,13 @@ func (c *serverConn) serveLoop(dev Device, wg *sync.WaitGroup) error {
 		if cmd == cmdWrite {
 			buf = hdr.resize(buf)
 			if _, err := io.ReadFull(c.rw, buf[16:]); err != nil {
+				c.mu.Unlock()
 				return err
 			}
 		}
+		if cmd == cmdDisc {
+			c.closed = true
+		}
 		c.mu.Unlock()
 
 		switch cmd {
@@ -367,8 +404,13 @@ func (c *serverConn) serveLoop(dev Device, wg *sync.WaitGroup) error {
 			}
 			buf = buf[:16]
 		case cmdTrim:
+			// Trimmed blocks are only given up once the volume is synced, so
+			// sync here rather than wait for the next flush.
 			if err := dev.Trim(hdr.offset(), int64(hdr.length())); err != nil {
 				clog.Printf("trim error: %s", err)
+				hdr.putReplyHeader(buf, errIO)
+				buf = buf[:16]
+				break
 			}
 			fallthrough
 		case cmdFlush:
@@ -387,8 +429,10 @@ func (c *serverConn) serveLoop(dev Device, wg *sync.WaitGroup) error {
 			return errors.New("nbd: invalid command")
 		}
 
-		// FIXME: Are we sure this whole write is going to be atomic?
-		if _, err := c.rw.Write(buf); err != nil {
+		c.wmu.Lock()
+		_, err := c.rw.Write(buf)
+		c.wmu.Unlock()
+		if err != nil {
 			return err
 		}
 	}
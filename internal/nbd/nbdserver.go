@@ -40,6 +40,16 @@ type DeviceFinder interface {
 type NBDServer struct {
 	l      *net.TCPListener
 	finder DeviceFinder
+
+	// devices are the exports open on at least one connection. Clients may
+	// open several connections to one export, which share its device.
+	mu      sync.Mutex
+	devices map[string]*sharedDevice
+}
+
+type sharedDevice struct {
+	Device
+	refs int
 }
 
 func NewNBDServer(addr string, finder DeviceFinder) (*NBDServer, error) {
@@ -54,8 +64,9 @@ func NewNBDServer(addr string, finder DeviceFinder) (*NBDServer, error) {
 	}
 
 	ns := &NBDServer{
-		l:      ln,
-		finder: finder,
+		l:       ln,
+		finder:  finder,
+		devices: make(map[string]*sharedDevice),
 	}
 
 	return ns, nil
@@ -73,7 +84,7 @@ func (s *NBDServer) Serve() error {
 
 		conn := &NBDConn{
 			c:      c,
-			finder: s.finder,
+			srv:    s,
 			export: "<none>",
 		}
 
@@ -90,6 +101,41 @@ func (s *NBDServer) Close() error {
 	return s.l.Close()
 }
 
+// openDevice returns the device for the named export, opening it if no
+// other connection has.
+func (s *NBDServer) openDevice(name string) (*sharedDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.devices[name]; ok {
+		d.refs++
+		return d, nil
+	}
+	dev, err := s.finder.FindDevice(name)
+	if err != nil {
+		return nil, err
+	}
+	d := &sharedDevice{Device: dev, refs: 1}
+	s.devices[name] = d
+	return d, nil
+}
+
+// closeDevice closes the device for the named export once its last
+// connection is done with it.
+func (s *NBDServer) closeDevice(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[name]
+	if !ok {
+		return nil
+	}
+	d.refs--
+	if d.refs > 0 {
+		return d.Sync()
+	}
+	delete(s.devices, name)
+	return d.Close()
+}
+
 type option struct {
 	opt  uint32
 	data []byte
@@ -97,7 +143,7 @@ type option struct {
 
 type NBDConn struct {
 	c      net.Conn
-	finder DeviceFinder
+	srv    *NBDServer
 	device Device
 	export string
 }
@@ -147,7 +193,7 @@ func (c *NBDConn) handler() error {
 		return err
 	}
 
-	if err := binary.Write(c.c, binary.BigEndian, uint16(flagHasFlags|flagSendFlush|flagSendTrim)); err != nil {
+	if err := binary.Write(c.c, binary.BigEndian, uint16(flagHasFlags|flagSendFlush|flagSendTrim|flagMultiConn)); err != nil {
 		return err
 	}
 
@@ -162,19 +208,8 @@ func (c *NBDConn) handler() error {
 	srv := &serverConn{
 		rw: c.c,
 	}
-
-	n := 1
-
 	wg := new(sync.WaitGroup)
-	wg.Add(n)
-	for i := 0; i < n; i++ {
-		go func() {
-			if err := srv.serveLoop(c.device, wg); err != nil {
-				clog.Errorf("server returned: %s", err)
-			}
-		}()
-	}
-
+	srv.serve(c.device, connWorkers, wg)
 	wg.Wait()
 	return nil
 }
@@ -192,7 +227,7 @@ func (c *NBDConn) options() error {
 			if len(opt.data) == 0 {
 				return fmt.Errorf("nbdserve doesn't support empty volume name. client needs to specify it")
 			}
-			dev, err := c.finder.FindDevice(string(opt.data))
+			dev, err := c.srv.openDevice(string(opt.data))
 			if err != nil {
 				// terminate the connection on failure
 				return err
@@ -210,7 +245,7 @@ func (c *NBDConn) options() error {
 
 			return nil
 		case nbdOptList:
-			devs, err := c.finder.ListDevices()
+			devs, err := c.srv.finder.ListDevices()
 			if err != nil {
 				return err
 			}
@@ -313,7 +348,9 @@ func (c *NBDConn) getOpt() (*option, error) {
 
 func (c *NBDConn) Close() error {
 	if c.device != nil {
-		c.device.Close()
+		if err := c.srv.closeDevice(c.export); err != nil {
+			c.errorf("couldn't close device: %v", err)
+		}
 	}
 	return c.c.Close()
 }
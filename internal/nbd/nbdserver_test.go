@@ -0,0 +1,171 @@
+package nbd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+type memDevice struct {
+	mu      sync.Mutex
+	data    []byte
+	trimmed [][2]int64
+	closed  int
+}
+
+func (m *memDevice) ReadAt(b []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copy(b, m.data[off:]), nil
+}
+
+func (m *memDevice) WriteAt(b []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copy(m.data[off:], b), nil
+}
+
+func (m *memDevice) Trim(off, length int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trimmed = append(m.trimmed, [2]int64{off, length})
+	copy(m.data[off:off+length], make([]byte, length))
+	return nil
+}
+
+func (m *memDevice) Sync() error  { return nil }
+func (m *memDevice) Size() uint64 { return uint64(len(m.data)) }
+
+func (m *memDevice) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed++
+	return nil
+}
+
+type memFinder struct {
+	dev   *memDevice
+	found int
+}
+
+func (f *memFinder) FindDevice(name string) (Device, error) {
+	f.found++
+	return f.dev, nil
+}
+
+func (f *memFinder) ListDevices() ([]string, error) {
+	return []string{"test"}, nil
+}
+
+// dial connects to the export and returns the connection and the
+// transmission flags.
+func dial(t *testing.T, addr string) (net.Conn, uint16) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := make([]byte, 18)
+	if _, err := io.ReadFull(c, hello); err != nil {
+		t.Fatal(err)
+	}
+	opt := make([]byte, 20)
+	binary.BigEndian.PutUint64(opt[4:12], nbdOpts)
+	binary.BigEndian.PutUint32(opt[12:16], nbdOptExportName)
+	binary.BigEndian.PutUint32(opt[16:20], 4)
+	if _, err := c.Write(append(opt, "test"...)); err != nil {
+		t.Fatal(err)
+	}
+	export := make([]byte, 8+2+124)
+	if _, err := io.ReadFull(c, export); err != nil {
+		t.Fatal(err)
+	}
+	return c, binary.BigEndian.Uint16(export[8:10])
+}
+
+func request(t *testing.T, c net.Conn, cmd uint16, handle uint64, off int64, length uint32, data []byte) {
+	req := make([]byte, 28)
+	binary.BigEndian.PutUint32(req[0:4], magicRequest)
+	binary.BigEndian.PutUint16(req[6:8], cmd)
+	binary.BigEndian.PutUint64(req[8:16], handle)
+	binary.BigEndian.PutUint64(req[16:24], uint64(off))
+	binary.BigEndian.PutUint32(req[24:28], length)
+	if _, err := c.Write(append(req, data...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func reply(t *testing.T, c net.Conn, datalen int) (uint64, []byte) {
+	rep := make([]byte, 16+datalen)
+	if _, err := io.ReadFull(c, rep); err != nil {
+		t.Fatal(err)
+	}
+	if e := binary.BigEndian.Uint32(rep[4:8]); e != 0 {
+		t.Fatalf("request failed with error %d", e)
+	}
+	return binary.BigEndian.Uint64(rep[8:16]), rep[16:]
+}
+
+func TestMultiConnTrim(t *testing.T) {
+	dev := &memDevice{data: make([]byte, 1<<16)}
+	finder := &memFinder{dev: dev}
+	srv, err := NewNBDServer("127.0.0.1:0", finder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go srv.Serve()
+	addr := srv.l.Addr().String()
+
+	c1, flags := dial(t, addr)
+	if flags&flagSendTrim == 0 || flags&flagMultiConn == 0 {
+		t.Fatalf("expected trim and multiple connections to be advertised, got flags %b", flags)
+	}
+	c2, _ := dial(t, addr)
+	srv.mu.Lock()
+	if finder.found != 1 {
+		t.Errorf("expected both connections to share the device, opened it %d times", finder.found)
+	}
+	srv.mu.Unlock()
+
+	data := bytes.Repeat([]byte{0xaa}, 4096)
+	// Pipeline writes on the first connection, then read them on the second.
+	for i := 0; i < 8; i++ {
+		request(t, c1, cmdWrite, uint64(i), int64(i)*4096, 4096, data)
+	}
+	seen := make(map[uint64]bool)
+	for i := 0; i < 8; i++ {
+		h, _ := reply(t, c1, 0)
+		seen[h] = true
+	}
+	if len(seen) != 8 {
+		t.Fatalf("expected a reply to each write, got %v", seen)
+	}
+	request(t, c2, cmdRead, 100, 3*4096, 4096, nil)
+	if _, got := reply(t, c2, 4096); !bytes.Equal(got, data) {
+		t.Error("expected to read the write from the other connection")
+	}
+
+	request(t, c2, cmdTrim, 101, 4096, 2*4096, nil)
+	reply(t, c2, 0)
+	request(t, c1, cmdRead, 102, 4096, 4096, nil)
+	if _, got := reply(t, c1, 4096); !bytes.Equal(got, make([]byte, 4096)) {
+		t.Error("expected trimmed data to read as zeros")
+	}
+	dev.mu.Lock()
+	if len(dev.trimmed) != 1 || dev.trimmed[0] != [2]int64{4096, 2 * 4096} {
+		t.Errorf("expected one trim of 8192 bytes at 4096, got %v", dev.trimmed)
+	}
+	dev.mu.Unlock()
+
+	request(t, c1, cmdDisc, 103, 0, 0, nil)
+	c1.Close()
+	request(t, c2, cmdRead, 104, 0, 4096, nil)
+	if _, got := reply(t, c2, 4096); !bytes.Equal(got, data) {
+		t.Error("expected the device to stay open for the remaining connection")
+	}
+	request(t, c2, cmdDisc, 105, 0, 0, nil)
+	c2.Close()
+}
@@ -0,0 +1,183 @@
+// peertls builds the TLS configuration that peers use to authenticate each
+// other, and keeps it current as the certificates on disk are replaced.
+package peertls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/torus"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "peertls")
+
+// checkInterval is how often, at most, the files are looked at again.
+var checkInterval = 10 * time.Second
+
+var errNoPeerCert = errors.New("peertls: peer presented no certificate")
+
+// Reloader holds a peer certificate and the cluster CA, reloading them when
+// the files they came from change. Peers are trusted if their certificate
+// is signed by the CA; host names are not checked, since peers are dialed by
+// whatever address they advertise.
+type Reloader struct {
+	certFile, keyFile, caFile string
+
+	mut     sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	mtimes  [3]time.Time
+	checked time.Time
+}
+
+// NewReloader loads the certificate, key and CA from the given files.
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	mtimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	err = r.load(mtimes)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Config returns a TLS configuration for both listening and dialing. It
+// always uses the most recently loaded certificate and CA.
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		ClientAuth: tls.RequireAnyClientCert,
+		// Servers are verified against the cluster CA by
+		// VerifyPeerCertificate instead of by name.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: r.verify,
+		MinVersion:            tls.VersionTLS12,
+	}
+}
+
+// Identity returns the identity the current certificate gives its holder
+// for volume ACLs.
+func (r *Reloader) Identity() (string, error) {
+	cert := r.certificate()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+	return torus.CertIdentity(leaf), nil
+}
+
+func (r *Reloader) certificate() *tls.Certificate {
+	r.maybeReload()
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return r.cert
+}
+
+func (r *Reloader) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errNoPeerCert
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		c, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = c
+	}
+	r.maybeReload()
+	r.mut.RLock()
+	pool := r.pool
+	r.mut.RUnlock()
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// maybeReload reloads the files if they have been modified since they were
+// last loaded. A file that can't be loaded leaves the previous certificates
+// in place.
+func (r *Reloader) maybeReload() {
+	r.mut.Lock()
+	if time.Since(r.checked) < checkInterval {
+		r.mut.Unlock()
+		return
+	}
+	r.checked = time.Now()
+	old := r.mtimes
+	r.mut.Unlock()
+	mtimes, err := r.stat()
+	if err != nil {
+		clog.Errorf("couldn't check peer certificates: %v", err)
+		return
+	}
+	if mtimes == old {
+		return
+	}
+	err = r.load(mtimes)
+	if err != nil {
+		clog.Errorf("couldn't reload peer certificates, keeping the old ones: %v", err)
+		return
+	}
+	clog.Infof("reloaded peer certificates from %s", r.certFile)
+}
+
+func (r *Reloader) stat() ([3]time.Time, error) {
+	var out [3]time.Time
+	for i, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return out, err
+		}
+		out[i] = fi.ModTime()
+	}
+	return out, nil
+}
+
+func (r *Reloader) load(mtimes [3]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	caPem, err := ioutil.ReadFile(r.caFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return fmt.Errorf("peertls: no certificates in %s", r.caFile)
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.cert = &cert
+	r.pool = pool
+	r.mtimes = mtimes
+	r.checked = time.Now()
+	return nil
+}
@@ -0,0 +1,147 @@
+package peertls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64
+
+func newTestCert(t *testing.T, parent *testCA, isCA bool) (*testCA, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "torus"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signKey := tmpl, key
+	if parent != nil {
+		signer, signKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, keyPem
+}
+
+func writeFiles(t *testing.T, dir, name string, ca *testCA, mtime time.Time) *Reloader {
+	c, key := newTestCert(t, ca, false)
+	files := map[string][]byte{
+		name + ".crt":    c.pem,
+		name + ".key":    key,
+		name + "-ca.crt": ca.pem,
+	}
+	for f, data := range files {
+		p := filepath.Join(dir, f)
+		if err := ioutil.WriteFile(p, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewReloader(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key"), filepath.Join(dir, name+"-ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func handshake(t *testing.T, server, client *Reloader) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	errc := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer c.Close()
+		errc <- c.(*tls.Conn).Handshake()
+	}()
+	c, err := tls.Dial("tcp", l.Addr().String(), client.Config())
+	if err == nil {
+		// The server's verdict on the client arrives after the client
+		// considers the handshake done.
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		c.Read(make([]byte, 1))
+		c.Close()
+	}
+	if serr := <-errc; serr != nil {
+		return serr
+	}
+	return err
+}
+
+func TestMutualAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peertls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster, _ := newTestCert(t, nil, true)
+	other, _ := newTestCert(t, nil, true)
+	then := time.Now().Add(-time.Minute)
+
+	server := writeFiles(t, dir, "server", cluster, then)
+	peer := writeFiles(t, dir, "peer", cluster, then)
+	if err := handshake(t, server, peer); err != nil {
+		t.Fatalf("expected a peer of the cluster CA to be accepted: %v", err)
+	}
+	stranger := writeFiles(t, dir, "stranger", other, then)
+	if err := handshake(t, server, stranger); err == nil {
+		t.Fatal("expected a certificate from another CA to be rejected")
+	}
+
+	// Move the server to the other CA; the change is picked up without
+	// making a new Reloader.
+	defer func(d time.Duration) { checkInterval = d }(checkInterval)
+	checkInterval = 0
+	writeFiles(t, dir, "server", other, time.Now())
+	if err := handshake(t, server, stranger); err != nil {
+		t.Fatalf("expected the reloaded CA to be trusted: %v", err)
+	}
+	if err := handshake(t, server, peer); err == nil {
+		t.Fatal("expected the old CA to no longer be trusted")
+	}
+}
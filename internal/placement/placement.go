@@ -0,0 +1,166 @@
+// Package placement serves the TorusPlacement gRPC service, which lets
+// schedulers outside the cluster find out which peers hold a volume's data so
+// that they can place compute next to it.
+package placement
+
+import (
+	"net"
+	"sort"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/block"
+	"github.com/coreos/torus/models"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "placement")
+
+type Server struct {
+	dfs  *torus.Server
+	grpc *grpc.Server
+}
+
+func NewServer(dfs *torus.Server) *Server {
+	s := &Server{
+		dfs:  dfs,
+		grpc: grpc.NewServer(),
+	}
+	models.RegisterTorusPlacementServer(s.grpc, s)
+	return s
+}
+
+func ServePlacement(addr string, srv *torus.Server) error {
+	return NewServer(srv).Run(addr)
+}
+
+func (s *Server) Run(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	clog.Infof("serving placement on %s", addr)
+	return s.grpc.Serve(lis)
+}
+
+func (s *Server) Close() error {
+	s.grpc.Stop()
+	return nil
+}
+
+// ring returns the ring the distributor is placing blocks with, which accounts
+// for per-volume redundancy, or the ring in the MDS if this server isn't
+// distributing.
+func (s *Server) ring() (torus.Ring, error) {
+	if d, ok := s.dfs.Blocks.(interface {
+		Ring() torus.Ring
+	}); ok {
+		return d.Ring(), nil
+	}
+	return s.dfs.MDS.GetRing()
+}
+
+func (s *Server) LocateBlocks(ctx context.Context, req *models.LocateBlocksRequest) (*models.LocateBlocksResponse, error) {
+	r, err := s.ring()
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.LocateBlocksResponse{}
+	var seen torus.PeerList
+	for _, x := range req.BlockRefs {
+		ref := torus.BlockFromProto(x)
+		perm, err := torus.GetBlockPeers(r, ref)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "couldn't place %s: %v", ref, err)
+		}
+		peers := perm.Replicas()
+		resp.Placements = append(resp.Placements, &models.BlockPlacement{
+			BlockRef: x,
+			Peers:    peers,
+		})
+		seen = seen.Union(peers)
+	}
+	resp.Peers = s.peerInfo(seen)
+	return resp, nil
+}
+
+func (s *Server) LocateVolume(ctx context.Context, req *models.LocateVolumeRequest) (*models.LocateVolumeResponse, error) {
+	vol, err := s.dfs.MDS.GetVolume(req.Volume)
+	if err == torus.ErrNotExist {
+		return nil, grpc.Errorf(codes.NotFound, "volume %s doesn't exist", req.Volume)
+	} else if err != nil {
+		return nil, err
+	}
+	if vol.Type != block.VolumeType {
+		return nil, grpc.Errorf(codes.Unimplemented, "can't locate volumes of type %s", vol.Type)
+	}
+	bv, err := block.OpenBlockVolume(s.dfs, vol.Name)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := bv.BlockRefs()
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.ring()
+	if err != nil {
+		return nil, err
+	}
+	shares := make(map[string]*models.PeerShare)
+	for _, ref := range refs {
+		perm, err := torus.GetBlockPeers(r, ref)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "couldn't place %s: %v", ref, err)
+		}
+		for i, p := range perm.Replicas() {
+			sh, ok := shares[p]
+			if !ok {
+				sh = &models.PeerShare{UUID: p}
+				shares[p] = sh
+			}
+			sh.Blocks++
+			if i == 0 {
+				sh.Primary++
+			}
+		}
+	}
+	resp := &models.LocateVolumeResponse{
+		Volume: vol,
+		Blocks: uint64(len(refs)),
+	}
+	var peers torus.PeerList
+	for p, sh := range shares {
+		resp.Shares = append(resp.Shares, sh)
+		peers = append(peers, p)
+	}
+	sort.Sort(byBlocks(resp.Shares))
+	resp.Peers = s.peerInfo(peers)
+	return resp, nil
+}
+
+// peerInfo looks up the given peers, leaving out any that have not been
+// heard from.
+func (s *Server) peerInfo(peers torus.PeerList) []*models.PeerInfo {
+	pm := s.dfs.GetPeerMap()
+	var out []*models.PeerInfo
+	for _, p := range peers {
+		if pi, ok := pm[p]; ok {
+			out = append(out, pi)
+		}
+	}
+	return out
+}
+
+type byBlocks []*models.PeerShare
+
+func (b byBlocks) Len() int      { return len(b) }
+func (b byBlocks) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byBlocks) Less(i, j int) bool {
+	if b[i].Blocks != b[j].Blocks {
+		return b[i].Blocks > b[j].Blocks
+	}
+	return b[i].UUID < b[j].UUID
+}
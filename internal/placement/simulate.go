@@ -0,0 +1,145 @@
+package placement
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/internal/census"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+)
+
+// SimulateRing warns about any peer that would be fuller than this fraction.
+var simulateMaxFill = 0.85
+
+// SimulateRing works out what replacing the current ring with the proposed
+// one would do to the blocks the cluster actually holds: how many would move,
+// how full each peer would be, and whether any of it would be unsafe. Nothing
+// is changed.
+func (s *Server) SimulateRing(ctx context.Context, req *models.SimulateRingRequest) (*models.SimulateRingResponse, error) {
+	if req.Ring == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "no ring proposed")
+	}
+	proposed, err := ring.CreateRing(req.Ring)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "couldn't create proposed ring: %v", err)
+	}
+	cur, err := s.dfs.MDS.GetRing()
+	if err != nil {
+		return nil, err
+	}
+	peers, err := s.dfs.MDS.GetPeers()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := census.Blocks(s.dfs)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := simulateRing(cur, proposed, req.Ring, peers, refs)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%v", err)
+	}
+	return resp, nil
+}
+
+// simulateRing places refs with both rings, comparing the outcome against the
+// peers that are currently heartbeating. Per-volume redundancy is not taken
+// into account; both rings are compared at their own replication.
+func simulateRing(cur, proposed torus.Ring, pm *models.Ring, peers torus.PeerInfoList, refs []torus.BlockRef) (*models.SimulateRingResponse, error) {
+	resp := &models.SimulateRingResponse{
+		Blocks: uint64(len(refs)),
+	}
+	sims := make(map[string]*models.PeerSimulation)
+	get := func(uuid string) *models.PeerSimulation {
+		sim, ok := sims[uuid]
+		if !ok {
+			sim = &models.PeerSimulation{UUID: uuid}
+			sims[uuid] = sim
+		}
+		return sim
+	}
+	for _, uuid := range cur.Members().Union(proposed.Members()) {
+		get(uuid)
+	}
+	var stranded uint64
+	for _, ref := range refs {
+		before, err := torus.GetBlockPeers(cur, ref)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't place %s with the current ring: %v", ref, err)
+		}
+		after, err := torus.GetBlockPeers(proposed, ref)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't place %s with the proposed ring: %v", ref, err)
+		}
+		old := before.Replicas()
+		for _, p := range old {
+			get(p).Before++
+		}
+		live := false
+		for _, p := range after.Replicas() {
+			sim := get(p)
+			sim.After++
+			if !old.Has(p) {
+				sim.Received++
+				resp.Moved++
+			}
+			if peers.UUIDAt(p) != -1 {
+				live = true
+			}
+		}
+		if !live {
+			stranded++
+		}
+	}
+
+	ringPeers := torus.PeerInfoList(pm.Peers)
+	for uuid, sim := range sims {
+		if i := peers.UUIDAt(uuid); i != -1 {
+			sim.TotalBlocks = peers[i].TotalBlocks
+		} else if i := ringPeers.UUIDAt(uuid); i != -1 {
+			sim.TotalBlocks = ringPeers[i].TotalBlocks
+		}
+		resp.Peers = append(resp.Peers, sim)
+	}
+	sort.Sort(byUUID(resp.Peers))
+
+	if proposed.Version() <= cur.Version() {
+		resp.Refusals = append(resp.Refusals, fmt.Sprintf("proposed ring version %d is not newer than the current version %d", proposed.Version(), cur.Version()))
+	}
+	members := proposed.Members()
+	if len(members) < int(pm.ReplicationFactor) {
+		resp.Refusals = append(resp.Refusals, fmt.Sprintf("only %d peers for replication %d", len(members), pm.ReplicationFactor))
+	}
+	if stranded != 0 {
+		resp.Refusals = append(resp.Refusals, fmt.Sprintf("%d blocks would only be placed on peers that are down", stranded))
+	}
+	for _, uuid := range members {
+		if peers.UUIDAt(uuid) == -1 {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("peer %s is in the proposed ring but isn't heartbeating", uuid))
+		}
+	}
+	for _, sim := range resp.Peers {
+		if sim.TotalBlocks == 0 || !members.Has(sim.UUID) {
+			continue
+		}
+		fill := float64(sim.After) / float64(sim.TotalBlocks)
+		if fill > 1 {
+			resp.Refusals = append(resp.Refusals, fmt.Sprintf("peer %s would overflow (%.0f%% full)", sim.UUID, fill*100))
+		} else if fill > simulateMaxFill {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("peer %s would be %.0f%% full", sim.UUID, fill*100))
+		}
+	}
+	return resp, nil
+}
+
+type byUUID []*models.PeerSimulation
+
+func (b byUUID) Len() int           { return len(b) }
+func (b byUUID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byUUID) Less(i, j int) bool { return b[i].UUID < b[j].UUID }
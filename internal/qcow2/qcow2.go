@@ -0,0 +1,462 @@
+// qcow2 reads and writes the qcow2 disk image format used by QEMU, enough to
+// move plain images in and out of Torus: images with backing files,
+// encryption, compressed clusters, internal snapshots or external data files
+// are not supported. Unallocated clusters read as zeros, and clusters of
+// zeros are left unallocated when writing.
+package qcow2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	magic = 0x514649fb
+
+	// Offsets and flags of L1 and L2 entries.
+	offsetMask     = 0x00fffffffffffe00
+	flagCopied     = 1 << 63
+	flagCompressed = 1 << 62
+	flagZero       = 1
+
+	// Incompatible features of version 3 images.
+	featureDirty   = 1 << 0
+	featureCorrupt = 1 << 1
+
+	// DefaultClusterBits is the cluster size new images get, 64KiB, as
+	// with qemu-img.
+	DefaultClusterBits = 16
+
+	maxL2Cache = 64
+)
+
+var (
+	ErrNotQcow2    = errors.New("qcow2: not a qcow2 image")
+	ErrUnsupported = errors.New("qcow2: image uses a feature that isn't supported")
+	ErrNotInOrder  = errors.New("qcow2: writes must be in increasing order of offset")
+)
+
+// header is the part of the header common to versions 2 and 3.
+type header struct {
+	Magic                 uint32
+	Version               uint32
+	BackingFileOffset     uint64
+	BackingFileSize       uint32
+	ClusterBits           uint32
+	Size                  uint64
+	CryptMethod           uint32
+	L1Size                uint32
+	L1TableOffset         uint64
+	RefcountTableOffset   uint64
+	RefcountTableClusters uint32
+	NbSnapshots           uint32
+	SnapshotsOffset       uint64
+}
+
+// IsQcow2 returns whether r starts with the qcow2 magic.
+func IsQcow2(r io.ReaderAt) bool {
+	var b [4]byte
+	_, err := r.ReadAt(b[:], 0)
+	return err == nil && binary.BigEndian.Uint32(b[:]) == magic
+}
+
+// Image is a qcow2 image open for reading. It is safe for concurrent use.
+type Image struct {
+	r           io.ReaderAt
+	size        uint64
+	clusterBits uint32
+	version     uint32
+	l1          []uint64
+
+	mut     sync.Mutex
+	l2Cache map[uint64][]uint64
+}
+
+// Open reads the header and L1 table of the image in r.
+func Open(r io.ReaderAt) (*Image, error) {
+	var h header
+	err := binary.Read(io.NewSectionReader(r, 0, 72), binary.BigEndian, &h)
+	if err != nil {
+		return nil, ErrNotQcow2
+	}
+	if h.Magic != magic {
+		return nil, ErrNotQcow2
+	}
+	if h.Version != 2 && h.Version != 3 {
+		return nil, fmt.Errorf("qcow2: unsupported version %d", h.Version)
+	}
+	if h.ClusterBits < 9 || h.ClusterBits > 21 {
+		return nil, fmt.Errorf("qcow2: invalid cluster size 2^%d", h.ClusterBits)
+	}
+	if h.BackingFileOffset != 0 || h.CryptMethod != 0 || h.NbSnapshots != 0 {
+		return nil, ErrUnsupported
+	}
+	if h.Version == 3 {
+		var incompat uint64
+		err = binary.Read(io.NewSectionReader(r, 72, 8), binary.BigEndian, &incompat)
+		if err != nil {
+			return nil, ErrNotQcow2
+		}
+		// A dirty image only has stale refcounts, which reading doesn't
+		// need.
+		if incompat&^featureDirty != 0 {
+			if incompat&featureCorrupt != 0 {
+				return nil, errors.New("qcow2: image is marked corrupt")
+			}
+			return nil, ErrUnsupported
+		}
+	}
+	img := &Image{
+		r:           r,
+		size:        h.Size,
+		clusterBits: h.ClusterBits,
+		version:     h.Version,
+		l2Cache:     make(map[uint64][]uint64),
+	}
+	if need := img.l1Entries(); uint64(h.L1Size) < need {
+		return nil, fmt.Errorf("qcow2: L1 table of %d entries is too small for %d bytes", h.L1Size, h.Size)
+	}
+	img.l1, err = readTable(r, h.L1TableOffset, int(h.L1Size))
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// Size returns the size of the virtual disk.
+func (img *Image) Size() uint64 {
+	return img.size
+}
+
+func (img *Image) clusterSize() uint64 {
+	return 1 << img.clusterBits
+}
+
+func (img *Image) l2Entries() uint64 {
+	return img.clusterSize() / 8
+}
+
+func (img *Image) l1Entries() uint64 {
+	span := img.clusterSize() * img.l2Entries()
+	return (img.size + span - 1) / span
+}
+
+func readTable(r io.ReaderAt, off uint64, n int) ([]uint64, error) {
+	out := make([]uint64, n)
+	err := binary.Read(io.NewSectionReader(r, int64(off), int64(n)*8), binary.BigEndian, out)
+	if err != nil {
+		return nil, fmt.Errorf("qcow2: couldn't read table at %d: %v", off, err)
+	}
+	return out, nil
+}
+
+func (img *Image) l2Table(off uint64) ([]uint64, error) {
+	img.mut.Lock()
+	defer img.mut.Unlock()
+	if t, ok := img.l2Cache[off]; ok {
+		return t, nil
+	}
+	t, err := readTable(img.r, off, int(img.l2Entries()))
+	if err != nil {
+		return nil, err
+	}
+	if len(img.l2Cache) >= maxL2Cache {
+		for k := range img.l2Cache {
+			delete(img.l2Cache, k)
+			break
+		}
+	}
+	img.l2Cache[off] = t
+	return t, nil
+}
+
+// hostOffset returns where the guest cluster is stored in the image, or 0 if
+// it reads as zeros.
+func (img *Image) hostOffset(cluster uint64) (uint64, error) {
+	l1i := cluster / img.l2Entries()
+	l2off := img.l1[l1i] & offsetMask
+	if l2off == 0 {
+		return 0, nil
+	}
+	t, err := img.l2Table(l2off)
+	if err != nil {
+		return 0, err
+	}
+	e := t[cluster%img.l2Entries()]
+	if e&flagCompressed != 0 {
+		return 0, ErrUnsupported
+	}
+	if img.version == 3 && e&flagZero != 0 {
+		return 0, nil
+	}
+	return e & offsetMask, nil
+}
+
+// ReadAt reads the virtual disk, as io.ReaderAt.
+func (img *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("qcow2: negative offset")
+	}
+	var eof error
+	if uint64(off) >= img.size {
+		return 0, io.EOF
+	}
+	if uint64(off)+uint64(len(p)) > img.size {
+		p = p[:img.size-uint64(off)]
+		eof = io.EOF
+	}
+	n := 0
+	cs := img.clusterSize()
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		inCluster := pos % cs
+		chunk := p[n:]
+		if uint64(len(chunk)) > cs-inCluster {
+			chunk = chunk[:cs-inCluster]
+		}
+		host, err := img.hostOffset(pos / cs)
+		if err != nil {
+			return n, err
+		}
+		if host == 0 {
+			for i := range chunk {
+				chunk[i] = 0
+			}
+		} else {
+			_, err = img.r.ReadAt(chunk, int64(host+inCluster))
+			if err != nil {
+				return n, fmt.Errorf("qcow2: couldn't read cluster at %d: %v", host, err)
+			}
+		}
+		n += len(chunk)
+	}
+	return n, eof
+}
+
+// Writer writes a new version 2 qcow2 image. Data has to be written in
+// increasing order of offset; clusters that are never written, or only with
+// zeros, are left unallocated. The image is complete once Close returns.
+type Writer struct {
+	w           io.WriterAt
+	size        uint64
+	clusterBits uint32
+	l1          []uint64
+	// next is the index of the next free cluster in the image.
+	next uint64
+
+	// The L2 table being filled, and where it goes.
+	l2     []uint64
+	l2Idx  int64
+	l2Host uint64
+
+	// The guest cluster being filled.
+	cur    int64
+	buf    []byte
+	dirty  bool
+	pos    uint64
+	closed bool
+}
+
+// NewWriter starts an image of a virtual disk of size bytes in w, which
+// should be empty.
+func NewWriter(w io.WriterAt, size uint64) (*Writer, error) {
+	wr := &Writer{
+		w:           w,
+		size:        size,
+		clusterBits: DefaultClusterBits,
+		l2Idx:       -1,
+		cur:         -1,
+	}
+	cs := wr.clusterSize()
+	span := cs * (cs / 8)
+	wr.l1 = make([]uint64, (size+span-1)/span)
+	wr.buf = make([]byte, cs)
+	// The header is cluster 0, followed by the L1 table.
+	l1Clusters := (uint64(len(wr.l1))*8 + cs - 1) / cs
+	wr.next = 1 + l1Clusters
+	return wr, nil
+}
+
+func (wr *Writer) clusterSize() uint64 {
+	return 1 << wr.clusterBits
+}
+
+// WriteAt writes p at off, which must not be before the end of the previous
+// write.
+func (wr *Writer) WriteAt(p []byte, off int64) (int, error) {
+	if wr.closed {
+		return 0, errors.New("qcow2: write to closed image")
+	}
+	if off < 0 || uint64(off) < wr.pos {
+		return 0, ErrNotInOrder
+	}
+	if uint64(off)+uint64(len(p)) > wr.size {
+		return 0, errors.New("qcow2: write past the end of the disk")
+	}
+	cs := wr.clusterSize()
+	n := 0
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		cluster := int64(pos / cs)
+		if cluster != wr.cur {
+			err := wr.flushCluster()
+			if err != nil {
+				return n, err
+			}
+			wr.cur = cluster
+		}
+		c := copy(wr.buf[pos%cs:], p[n:])
+		wr.dirty = true
+		n += c
+	}
+	wr.pos = uint64(off) + uint64(n)
+	return n, nil
+}
+
+func (wr *Writer) alloc() uint64 {
+	off := wr.next << wr.clusterBits
+	wr.next++
+	return off
+}
+
+func (wr *Writer) flushCluster() error {
+	if !wr.dirty {
+		return nil
+	}
+	cluster := uint64(wr.cur)
+	zero := true
+	for _, b := range wr.buf {
+		if b != 0 {
+			zero = false
+			break
+		}
+	}
+	if !zero {
+		l2Entries := wr.clusterSize() / 8
+		l1i := int64(cluster / l2Entries)
+		if l1i != wr.l2Idx {
+			err := wr.flushL2()
+			if err != nil {
+				return err
+			}
+			wr.l2 = make([]uint64, l2Entries)
+			wr.l2Idx = l1i
+			wr.l2Host = wr.alloc()
+			wr.l1[l1i] = wr.l2Host | flagCopied
+		}
+		host := wr.alloc()
+		_, err := wr.w.WriteAt(wr.buf, int64(host))
+		if err != nil {
+			return err
+		}
+		wr.l2[cluster%l2Entries] = host | flagCopied
+	}
+	for i := range wr.buf {
+		wr.buf[i] = 0
+	}
+	wr.dirty = false
+	return nil
+}
+
+func (wr *Writer) flushL2() error {
+	if wr.l2 == nil {
+		return nil
+	}
+	return writeTable(wr.w, wr.l2Host, wr.l2)
+}
+
+func writeTable(w io.WriterAt, off uint64, t interface{}) error {
+	var b sectionWriter
+	err := binary.Write(&b, binary.BigEndian, t)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteAt(b, int64(off))
+	return err
+}
+
+type sectionWriter []byte
+
+func (s *sectionWriter) Write(p []byte) (int, error) {
+	*s = append(*s, p...)
+	return len(p), nil
+}
+
+// Close writes the tables and header that make the image complete.
+func (wr *Writer) Close() error {
+	if wr.closed {
+		return nil
+	}
+	err := wr.flushCluster()
+	if err != nil {
+		return err
+	}
+	err = wr.flushL2()
+	if err != nil {
+		return err
+	}
+	wr.closed = true
+	cs := wr.clusterSize()
+	err = writeTable(wr.w, cs, wr.l1)
+	if err != nil {
+		return err
+	}
+
+	// Every cluster so far is used once. The refcount blocks and table go
+	// at the end, and count themselves.
+	perBlock := cs / 2
+	used := wr.next
+	var blocks, tableClusters uint64
+	for {
+		total := used + blocks + tableClusters
+		nb := (total + perBlock - 1) / perBlock
+		nt := (nb*8 + cs - 1) / cs
+		if nb == blocks && nt == tableClusters {
+			break
+		}
+		blocks, tableClusters = nb, nt
+	}
+	total := used + blocks + tableClusters
+	table := make([]uint64, tableClusters*cs/8)
+	for i := uint64(0); i < blocks; i++ {
+		refs := make([]uint16, perBlock)
+		for j := uint64(0); j < perBlock && i*perBlock+j < total; j++ {
+			refs[j] = 1
+		}
+		off := (used + i) << wr.clusterBits
+		err = writeTable(wr.w, off, refs)
+		if err != nil {
+			return err
+		}
+		table[i] = off
+	}
+	tableOff := (used + blocks) << wr.clusterBits
+	err = writeTable(wr.w, tableOff, table)
+	if err != nil {
+		return err
+	}
+
+	h := header{
+		Magic:                 magic,
+		Version:               2,
+		ClusterBits:           wr.clusterBits,
+		Size:                  wr.size,
+		L1Size:                uint32(len(wr.l1)),
+		L1TableOffset:         cs,
+		RefcountTableOffset:   tableOff,
+		RefcountTableClusters: uint32(tableClusters),
+	}
+	// Pad the header to a whole cluster, which also ends the (empty) list
+	// of header extensions.
+	var b sectionWriter
+	err = binary.Write(&b, binary.BigEndian, h)
+	if err != nil {
+		return err
+	}
+	b = append(b, make([]byte, cs-uint64(len(b)))...)
+	_, err = wr.w.WriteAt(b, 0)
+	return err
+}
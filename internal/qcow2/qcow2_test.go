@@ -0,0 +1,133 @@
+package qcow2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// memFile is an in-memory io.ReaderAt and io.WriterAt.
+type memFile struct {
+	b []byte
+}
+
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.b) {
+		m.b = append(m.b, make([]byte, end-len(m.b))...)
+	}
+	return copy(m.b[off:], p), nil
+}
+
+func (m *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(m.b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	const cs = 1 << DefaultClusterBits
+	// Spans two L2 tables, with a partial cluster at the end.
+	size := uint64(cs*(cs/8) + 5*cs + 1000)
+	data := make([]byte, size)
+	r := rand.New(rand.NewSource(1))
+	// A few clusters of data; the rest stays zero.
+	for _, c := range []uint64{0, 3, cs / 8, size / cs} {
+		start := c * cs
+		end := start + cs
+		if end > size {
+			end = size
+		}
+		r.Read(data[start:end])
+	}
+	// A cluster that's only partly written.
+	r.Read(data[7*cs+100 : 7*cs+200])
+
+	f := &memFile{}
+	w, err := NewWriter(f, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in uneven pieces.
+	for off := uint64(0); off < size; {
+		n := uint64(r.Intn(3*cs) + 1)
+		if off+n > size {
+			n = size - off
+		}
+		_, err := w.WriteAt(data[off:off+n], int64(off))
+		if err != nil {
+			t.Fatal(err)
+		}
+		off += n
+	}
+	if _, err := w.WriteAt(data[:1], 0); err != ErrNotInOrder {
+		t.Errorf("expected a write before the last one to fail, got %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Five data clusters plus metadata, rather than the whole disk.
+	if len(f.b) > 16*cs {
+		t.Errorf("expected a sparse image, got %d bytes", len(f.b))
+	}
+
+	if !IsQcow2(f) {
+		t.Fatal("expected the image to be recognized")
+	}
+	img, err := Open(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Size() != size {
+		t.Fatalf("expected size %d, got %d", size, img.Size())
+	}
+	got := make([]byte, size)
+	_, err = img.ReadAt(got, 0)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("image reads back differently")
+	}
+
+	// Every cluster in the file has a refcount of one.
+	var h header
+	binary.Read(bytes.NewReader(f.b), binary.BigEndian, &h)
+	table, err := readTable(f, h.RefcountTableOffset, int(h.RefcountTableClusters)*cs/8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := make([]uint16, cs/2)
+	binary.Read(bytes.NewReader(f.b[table[0]:]), binary.BigEndian, refs)
+	clusters := len(f.b) / cs
+	for i := 0; i < len(refs); i++ {
+		want := uint16(0)
+		if i < clusters {
+			want = 1
+		}
+		if refs[i] != want {
+			t.Fatalf("expected cluster %d to have refcount %d, got %d", i, want, refs[i])
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	f := &memFile{}
+	w, _ := NewWriter(f, 1<<20)
+	w.Close()
+	// Give it a backing file.
+	binary.BigEndian.PutUint64(f.b[8:], 512)
+	if _, err := Open(f); err != ErrUnsupported {
+		t.Errorf("expected an image with a backing file to be refused, got %v", err)
+	}
+	if _, err := Open(&memFile{b: make([]byte, 1024)}); err != ErrNotQcow2 {
+		t.Errorf("expected zeros not to be an image, got %v", err)
+	}
+}
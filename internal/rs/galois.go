@@ -0,0 +1,55 @@
+package rs
+
+// Arithmetic in GF(2^8) with the polynomial x^8 + x^4 + x^3 + x^2 + 1.
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+	// gfMulTable[a][b] is a*b; it keeps the inner loop to a lookup.
+	gfMulTable [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			gfMulTable[a][b] = gfMul(byte(a), byte(b))
+		}
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	if a == 0 {
+		panic("rs: inverse of zero")
+	}
+	return gfExp[255-int(gfLog[a])]
+}
+
+// mulAdd sets dst to dst + c*src.
+func mulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	t := &gfMulTable[c]
+	for i, s := range src {
+		dst[i] ^= t[s]
+	}
+}
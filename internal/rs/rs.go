@@ -0,0 +1,194 @@
+// Package rs implements systematic Reed-Solomon erasure coding over GF(2^8).
+// Data shards are stored as they are, and parity shards are computed with a
+// Cauchy matrix, so that any Data of the Data+Parity shards are enough to
+// recover the rest.
+package rs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTooFewShards is returned if fewer than Data shards are present.
+	ErrTooFewShards = errors.New("rs: too few shards to reconstruct")
+	// ErrShardSize is returned if the shards given aren't all the same size.
+	ErrShardSize = errors.New("rs: shards differ in size")
+)
+
+// Code encodes and reconstructs stripes of Data data shards and Parity parity
+// shards.
+type Code struct {
+	Data   int
+	Parity int
+	// parity[j][k] is the coefficient of data shard k in parity shard j.
+	parity [][]byte
+}
+
+// New returns a Code for the given numbers of data and parity shards. There
+// can be at most 256 shards in all.
+func New(data, parity int) (*Code, error) {
+	if data < 1 || parity < 1 || data+parity > 256 {
+		return nil, fmt.Errorf("rs: can't code %d+%d shards", data, parity)
+	}
+	c := &Code{
+		Data:   data,
+		Parity: parity,
+		parity: make([][]byte, parity),
+	}
+	// Every square submatrix of a Cauchy matrix is invertible, which makes
+	// the code MDS.
+	for j := range c.parity {
+		c.parity[j] = make([]byte, data)
+		for k := range c.parity[j] {
+			c.parity[j][k] = gfInv(byte(data+j) ^ byte(k))
+		}
+	}
+	return c, nil
+}
+
+// Encode computes the parity shards from the data shards. shards must hold
+// Data+Parity entries, the first Data of them equally sized; parity shards
+// that are nil or the wrong size are allocated.
+func (c *Code) Encode(shards [][]byte) error {
+	if len(shards) != c.Data+c.Parity {
+		return fmt.Errorf("rs: expected %d shards, got %d", c.Data+c.Parity, len(shards))
+	}
+	size := len(shards[0])
+	for _, s := range shards[:c.Data] {
+		if len(s) != size {
+			return ErrShardSize
+		}
+	}
+	for j, row := range c.parity {
+		out := shards[c.Data+j]
+		if len(out) != size {
+			out = make([]byte, size)
+			shards[c.Data+j] = out
+		} else {
+			for i := range out {
+				out[i] = 0
+			}
+		}
+		for k, coef := range row {
+			mulAdd(out, shards[k], coef)
+		}
+	}
+	return nil
+}
+
+// Reconstruct fills in the missing (nil) shards from the ones present. At
+// least Data shards must be present.
+func (c *Code) Reconstruct(shards [][]byte) error {
+	if len(shards) != c.Data+c.Parity {
+		return fmt.Errorf("rs: expected %d shards, got %d", c.Data+c.Parity, len(shards))
+	}
+	size := -1
+	var have []int
+	for i, s := range shards {
+		if s == nil {
+			continue
+		}
+		if size == -1 {
+			size = len(s)
+		} else if len(s) != size {
+			return ErrShardSize
+		}
+		if len(have) < c.Data {
+			have = append(have, i)
+		}
+	}
+	if len(have) < c.Data {
+		return ErrTooFewShards
+	}
+	missingData := false
+	for _, s := range shards[:c.Data] {
+		if s == nil {
+			missingData = true
+			break
+		}
+	}
+	if missingData {
+		// The rows of the generator matrix for the shards we have, inverted,
+		// turn those shards back into the data.
+		m := make([][]byte, c.Data)
+		for r, i := range have {
+			m[r] = c.row(i)
+		}
+		inv, err := invert(m)
+		if err != nil {
+			return err
+		}
+		for k := 0; k < c.Data; k++ {
+			if shards[k] != nil {
+				continue
+			}
+			out := make([]byte, size)
+			for r, i := range have {
+				mulAdd(out, shards[i], inv[k][r])
+			}
+			shards[k] = out
+		}
+	}
+	for j, row := range c.parity {
+		if shards[c.Data+j] != nil {
+			continue
+		}
+		out := make([]byte, size)
+		for k, coef := range row {
+			mulAdd(out, shards[k], coef)
+		}
+		shards[c.Data+j] = out
+	}
+	return nil
+}
+
+// row returns row i of the generator matrix: the identity for data shards,
+// then the parity coefficients.
+func (c *Code) row(i int) []byte {
+	if i >= c.Data {
+		return c.parity[i-c.Data]
+	}
+	r := make([]byte, c.Data)
+	r[i] = 1
+	return r
+}
+
+// invert inverts a square matrix over GF(2^8) by Gauss-Jordan elimination.
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	a := make([][]byte, n)
+	for i := range m {
+		a[i] = make([]byte, 2*n)
+		copy(a[i], m[i])
+		a[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if a[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot == -1 {
+			return nil, errors.New("rs: singular matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		scale := gfInv(a[col][col])
+		for i := range a[col] {
+			a[col][i] = gfMul(a[col][i], scale)
+		}
+		for r := 0; r < n; r++ {
+			if r == col || a[r][col] == 0 {
+				continue
+			}
+			mulAdd(a[r], a[col], a[r][col])
+		}
+	}
+	out := make([][]byte, n)
+	for i := range a {
+		out[i] = a[i][n:]
+	}
+	return out, nil
+}
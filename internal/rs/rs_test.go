@@ -0,0 +1,45 @@
+package rs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestReconstruct(t *testing.T) {
+	c, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	shards := make([][]byte, 6)
+	for i := 0; i < 4; i++ {
+		shards[i] = make([]byte, 100)
+		r.Read(shards[i])
+	}
+	err = c.Encode(shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every way of losing two shards must be recoverable.
+	for a := 0; a < 6; a++ {
+		for b := a + 1; b < 6; b++ {
+			damaged := make([][]byte, 6)
+			copy(damaged, shards)
+			damaged[a], damaged[b] = nil, nil
+			err := c.Reconstruct(damaged)
+			if err != nil {
+				t.Fatalf("lost %d and %d: %v", a, b, err)
+			}
+			for i := range shards {
+				if !bytes.Equal(damaged[i], shards[i]) {
+					t.Fatalf("lost %d and %d: shard %d reconstructed wrong", a, b, i)
+				}
+			}
+		}
+	}
+	shards[0], shards[1], shards[5] = nil, nil, nil
+	if err := c.Reconstruct(shards); err != ErrTooFewShards {
+		t.Fatalf("expected too few shards, got %v", err)
+	}
+}
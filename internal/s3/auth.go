@@ -0,0 +1,233 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signV4Algorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+	// maxClockSkew is how far the time a request was signed at may be from
+	// ours.
+	maxClockSkew = 15 * time.Minute
+)
+
+// LoadCredentials reads the access keys the gateway accepts from a file
+// with one access key ID and its secret key, separated by whitespace, on
+// each line. Blank lines and lines starting with # are skipped.
+func LoadCredentials(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	creds := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected an access key and a secret key", path, line)
+		}
+		creds[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("%s: no credentials", path)
+	}
+	return creds, nil
+}
+
+// authenticate checks the AWS Signature Version 4 of a request signed in its
+// Authorization header, and returns the SHA-256 of the payload the client
+// signed, or "" if it didn't sign the payload. With no credentials, every
+// request is let through.
+func (s *Server) authenticate(r *http.Request) (string, error) {
+	if s.creds == nil {
+		return "", nil
+	}
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+			return "", errNotImplemented
+		}
+		return "", errAccessDenied
+	}
+	if !strings.HasPrefix(auth, signV4Algorithm+" ") {
+		return "", errSignatureVersion
+	}
+	var credential, signature string
+	var signedHeaders []string
+	for _, kv := range strings.Split(strings.TrimPrefix(auth, signV4Algorithm+" "), ",") {
+		kv = strings.TrimSpace(kv)
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return "", errAuthorizationHeaderMalformed
+		}
+		switch kv[:i] {
+		case "Credential":
+			credential = kv[i+1:]
+		case "SignedHeaders":
+			signedHeaders = strings.Split(kv[i+1:], ";")
+		case "Signature":
+			signature = kv[i+1:]
+		}
+	}
+	// The credential is the access key, then the scope of the signing key:
+	// date/region/service/aws4_request.
+	scope := strings.SplitN(credential, "/", 2)
+	if len(scope) != 2 || len(signedHeaders) == 0 || signature == "" {
+		return "", errAuthorizationHeaderMalformed
+	}
+	scopeParts := strings.Split(scope[1], "/")
+	if len(scopeParts) != 4 || scopeParts[3] != "aws4_request" {
+		return "", errAuthorizationHeaderMalformed
+	}
+	secret, ok := s.creds[scope[0]]
+	if !ok {
+		return "", errInvalidAccessKeyID
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	t, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return "", errAccessDenied
+	}
+	if d := time.Since(t); d > maxClockSkew || d < -maxClockSkew {
+		return "", errRequestTimeTooSkewed
+	}
+	if !strings.HasPrefix(amzDate, scopeParts[0]) {
+		return "", errAuthorizationHeaderMalformed
+	}
+
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	switch payload {
+	case "":
+		return "", errAuthorizationHeaderMalformed
+	case streamingPayload:
+		return "", errNotImplemented
+	}
+
+	want := sign(secret, amzDate, scope[1], canonicalRequest(r, signedHeaders, payload))
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return "", errSignatureDoesNotMatch
+	}
+	if payload == unsignedPayload {
+		return "", nil
+	}
+	return payload, nil
+}
+
+// sign returns the signature of a canonical request, made at amzDate, with
+// the signing key for scope.
+func sign(secret, amzDate, scope, canonical string) string {
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		signV4Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+	key := []byte("AWS4" + secret)
+	for _, p := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, p)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalRequest(r *http.Request, signedHeaders []string, payload string) string {
+	var buf bytes.Buffer
+	buf.WriteString(r.Method)
+	buf.WriteByte('\n')
+	buf.WriteString(uriEncode(r.URL.Path, false))
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalQuery(r.URL.Query()))
+	buf.WriteByte('\n')
+	for _, h := range signedHeaders {
+		buf.WriteString(h)
+		buf.WriteByte(':')
+		var values []string
+		if h == "host" {
+			values = []string{r.Host}
+		} else {
+			values = r.Header[http.CanonicalHeaderKey(h)]
+		}
+		for i, v := range values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strings.Join(strings.Fields(v), " "))
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(strings.Join(signedHeaders, ";"))
+	buf.WriteByte('\n')
+	buf.WriteString(payload)
+	return buf.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		vs := append([]string{}, q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters, as the
+// signature needs, and '/' unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			buf.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,284 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/object"
+)
+
+// maxKeys is the most keys a listing returns, whatever the client asks for.
+const maxKeys = 1000
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   owner        `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+type bucketInfo struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Marker                *string        `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              *int           `xml:"KeyCount,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []objectInfo   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type objectInfo struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         uint64 `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Location string   `xml:",chardata"`
+}
+
+type listMultipartUploadsResult struct {
+	XMLName     xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListMultipartUploadsResult"`
+	Bucket      string       `xml:"Bucket"`
+	KeyMarker   string       `xml:"KeyMarker"`
+	Prefix      string       `xml:"Prefix"`
+	MaxUploads  int          `xml:"MaxUploads"`
+	IsTruncated bool         `xml:"IsTruncated"`
+	Uploads     []uploadInfo `xml:"Upload"`
+}
+
+type uploadInfo struct {
+	Key          string `xml:"Key"`
+	UploadID     string `xml:"UploadId"`
+	Initiator    owner  `xml:"Initiator"`
+	Owner        owner  `xml:"Owner"`
+	StorageClass string `xml:"StorageClass"`
+	Initiated    string `xml:"Initiated"`
+}
+
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+type deletedObject struct {
+	Key string `xml:"Key"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request) {
+	vols, err := object.ListBuckets(s.dfs.MDS)
+	if err != nil {
+		writeError(w, r, toAPIError(err, errInternalError))
+		return
+	}
+	res := &listAllMyBucketsResult{Owner: s.owner()}
+	for _, v := range vols {
+		// Volumes don't keep when they were created.
+		res.Buckets = append(res.Buckets, bucketInfo{
+			Name:         v.Name,
+			CreationDate: s3Time(time.Unix(0, 0)),
+		})
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func (s *Server) serveBucket(req *request) {
+	switch req.r.Method {
+	case "PUT":
+		if err := object.CreateBucket(s.dfs.MDS, req.bucket); err != nil {
+			req.error(toAPIError(err, errNoSuchBucket))
+			return
+		}
+		req.w.Header().Set("Location", "/"+req.bucket)
+		req.w.WriteHeader(http.StatusOK)
+		return
+	case "DELETE":
+		if err := object.DeleteBucket(s.dfs.MDS, req.bucket); err != nil {
+			req.error(toAPIError(err, errNoSuchBucket))
+			return
+		}
+		req.w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	b, err := object.OpenBucket(s.dfs, req.bucket)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchBucket))
+		return
+	}
+	switch {
+	case req.r.Method == "HEAD":
+		req.w.WriteHeader(http.StatusOK)
+	case req.r.Method == "GET" && req.has("location"):
+		writeXML(req.w, http.StatusOK, &locationConstraint{})
+	case req.r.Method == "GET" && req.has("uploads"):
+		s.listUploads(req, b)
+	case req.r.Method == "GET":
+		s.listObjects(req, b)
+	case req.r.Method == "POST" && req.has("delete"):
+		s.deleteObjects(req, b)
+	default:
+		req.error(errMethodNotAllowed)
+	}
+}
+
+func (s *Server) listObjects(req *request, b *object.Bucket) {
+	max := maxKeys
+	if v := req.param("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			req.error(errInvalidArgument)
+			return
+		}
+		if n < max {
+			max = n
+		}
+	}
+	res := &listBucketResult{
+		Name:      b.Name(),
+		Prefix:    req.param("prefix"),
+		MaxKeys:   max,
+		Delimiter: req.param("delimiter"),
+	}
+	v2 := req.param("list-type") == "2"
+	var after string
+	if v2 {
+		res.StartAfter = req.param("start-after")
+		res.ContinuationToken = req.param("continuation-token")
+		after = res.StartAfter
+		if res.ContinuationToken != "" {
+			token, err := base64.URLEncoding.DecodeString(res.ContinuationToken)
+			if err != nil {
+				req.error(errInvalidArgument)
+				return
+			}
+			after = string(token)
+		}
+	} else {
+		marker := req.param("marker")
+		res.Marker = &marker
+		after = marker
+	}
+	objs, prefixes, next, err := b.List(res.Prefix, res.Delimiter, after, max)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchBucket))
+		return
+	}
+	for _, o := range objs {
+		res.Contents = append(res.Contents, objectInfo{
+			Key:          o.Key,
+			LastModified: s3Time(o.LastModified),
+			ETag:         quoteETag(o.ETag),
+			Size:         o.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, p := range prefixes {
+		res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: p})
+	}
+	res.IsTruncated = next != ""
+	if v2 {
+		n := len(objs) + len(prefixes)
+		res.KeyCount = &n
+		if next != "" {
+			res.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(next))
+		}
+	} else if next != "" && res.Delimiter != "" {
+		// Without a delimiter, clients continue from the last key.
+		res.NextMarker = next
+	}
+	writeXML(req.w, http.StatusOK, res)
+}
+
+func (s *Server) listUploads(req *request, b *object.Bucket) {
+	ups, err := b.Uploads()
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchBucket))
+		return
+	}
+	res := &listMultipartUploadsResult{
+		Bucket:     b.Name(),
+		Prefix:     req.param("prefix"),
+		MaxUploads: maxKeys,
+	}
+	for _, u := range ups {
+		if len(res.Uploads) == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		if !strings.HasPrefix(u.Key, res.Prefix) {
+			continue
+		}
+		res.Uploads = append(res.Uploads, uploadInfo{
+			Key:          u.Key,
+			UploadID:     u.ID,
+			Initiator:    s.owner(),
+			Owner:        s.owner(),
+			StorageClass: "STANDARD",
+			Initiated:    s3Time(u.Initiated),
+		})
+	}
+	writeXML(req.w, http.StatusOK, res)
+}
+
+func (s *Server) deleteObjects(req *request, b *object.Bucket) {
+	var del deleteRequest
+	if err := req.readXML(&del); err != nil {
+		req.error(toAPIError(err, errNoSuchBucket))
+		return
+	}
+	if len(del.Objects) > maxKeys {
+		req.error(errMalformedXML)
+		return
+	}
+	res := &deleteResult{}
+	for _, o := range del.Objects {
+		err := b.Delete(o.Key)
+		if err != nil && err != torus.ErrNotExist {
+			e := toAPIError(err, errNoSuchKey)
+			res.Errors = append(res.Errors, deleteError{Key: o.Key, Code: e.Code, Message: e.Message})
+			continue
+		}
+		if !del.Quiet {
+			res.Deleted = append(res.Deleted, deletedObject{Key: o.Key})
+		}
+	}
+	writeXML(req.w, http.StatusOK, res)
+}
@@ -0,0 +1,104 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/object"
+)
+
+// apiError is an S3 error, as it is sent to clients.
+type apiError struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied                 = &apiError{"AccessDenied", "Access Denied", http.StatusForbidden}
+	errAuthorizationHeaderMalformed = &apiError{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	errBadDigest                    = &apiError{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	errBucketAlreadyExists          = &apiError{"BucketAlreadyExists", "The requested bucket name is not available.", http.StatusConflict}
+	errBucketNotEmpty               = &apiError{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	errEntityTooSmall               = &apiError{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	errInsufficientCapacity         = &apiError{"InsufficientCapacity", "The cluster is down to its reserved capacity.", http.StatusInsufficientStorage}
+	errInternalError                = &apiError{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	errInvalidAccessKeyID           = &apiError{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records.", http.StatusForbidden}
+	errInvalidArgument              = &apiError{"InvalidArgument", "Invalid argument.", http.StatusBadRequest}
+	errInvalidBucketName            = &apiError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	errInvalidDigest                = &apiError{"InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest}
+	errInvalidPart                  = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder             = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errMalformedXML                 = &apiError{"MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", http.StatusBadRequest}
+	errMethodNotAllowed             = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errNoSuchBucket                 = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey                    = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload                 = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errNotImplemented               = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errQuotaExceeded                = &apiError{"QuotaExceeded", "The bucket or its tenant is over its quota.", http.StatusForbidden}
+	errRequestTimeTooSkewed         = &apiError{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	errSHA256Mismatch               = &apiError{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+	errSignatureDoesNotMatch        = &apiError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	errSignatureVersion             = &apiError{"InvalidRequest", "Only AWS Signature Version 4 is supported.", http.StatusBadRequest}
+)
+
+// toAPIError turns an error from the object package into the S3 error to
+// send. notExist is what a missing thing is in the context of the request.
+func toAPIError(err error, notExist *apiError) *apiError {
+	switch err {
+	case torus.ErrNotExist:
+		return notExist
+	case torus.ErrWrongVolumeType:
+		return errNoSuchBucket
+	case torus.ErrExists:
+		return errBucketAlreadyExists
+	case torus.ErrNotEmpty:
+		return errBucketNotEmpty
+	case torus.ErrPermissionDenied:
+		return errAccessDenied
+	case torus.ErrInvalid:
+		return errInvalidArgument
+	case torus.ErrQuotaExceeded, torus.ErrVolumeQuota, object.ErrQuotaExceeded:
+		return errQuotaExceeded
+	case torus.ErrCapacityReserved:
+		return errInsufficientCapacity
+	case object.ErrInvalidBucketName:
+		return errInvalidBucketName
+	case object.ErrInvalidPart:
+		return errInvalidPart
+	case object.ErrInvalidPartOrder:
+		return errInvalidPartOrder
+	case object.ErrEntityTooSmall:
+		return errEntityTooSmall
+	}
+	if e, ok := err.(*apiError); ok {
+		return e
+	}
+	clog.Errorf("s3 request failed: %v", err)
+	return errInternalError
+}
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	promS3Errors.WithLabelValues(e.Code).Inc()
+	if r.Method == "HEAD" {
+		w.WriteHeader(e.Status)
+		return
+	}
+	writeXML(w, e.Status, &errorResponse{
+		Code:     e.Code,
+		Message:  e.Message,
+		Resource: r.URL.Path,
+	})
+}
@@ -0,0 +1,269 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/object"
+)
+
+// metaPrefix is the prefix of the headers that carry user metadata.
+const metaPrefix = "X-Amz-Meta-"
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+type listPartsResult struct {
+	XMLName     xml.Name   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+	Bucket      string     `xml:"Bucket"`
+	Key         string     `xml:"Key"`
+	UploadID    string     `xml:"UploadId"`
+	Initiator   owner      `xml:"Initiator"`
+	Owner       owner      `xml:"Owner"`
+	MaxParts    int        `xml:"MaxParts"`
+	IsTruncated bool       `xml:"IsTruncated"`
+	Parts       []partInfo `xml:"Part"`
+}
+
+type partInfo struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         uint64 `xml:"Size"`
+}
+
+func (s *Server) serveObject(req *request) {
+	b, err := object.OpenBucket(s.dfs, req.bucket)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchBucket))
+		return
+	}
+	switch {
+	case req.r.Method == "PUT" && req.r.Header.Get("X-Amz-Copy-Source") != "":
+		req.error(errNotImplemented)
+	case req.r.Method == "PUT" && req.has("uploadId"):
+		s.putPart(req, b)
+	case req.r.Method == "PUT":
+		s.putObject(req, b)
+	case req.r.Method == "GET" && req.has("uploadId"):
+		s.listParts(req, b)
+	case req.r.Method == "GET", req.r.Method == "HEAD":
+		s.getObject(req, b)
+	case req.r.Method == "DELETE" && req.has("uploadId"):
+		s.abortUpload(req, b)
+	case req.r.Method == "DELETE":
+		// Deleting a key that isn't there succeeds too.
+		if err := b.Delete(req.key); err != nil && err != torus.ErrNotExist {
+			req.error(toAPIError(err, errNoSuchKey))
+			return
+		}
+		req.w.WriteHeader(http.StatusNoContent)
+	case req.r.Method == "POST" && req.has("uploads"):
+		s.newUpload(req, b)
+	case req.r.Method == "POST" && req.has("uploadId"):
+		s.completeUpload(req, b)
+	default:
+		req.error(errMethodNotAllowed)
+	}
+}
+
+// metadata returns the user metadata in the request's headers, by lower
+// case name.
+func (req *request) metadata() map[string]string {
+	var md map[string]string
+	for k, v := range req.r.Header {
+		if !strings.HasPrefix(k, metaPrefix) {
+			continue
+		}
+		if md == nil {
+			md = make(map[string]string)
+		}
+		md[strings.ToLower(k[len(metaPrefix):])] = strings.Join(v, ",")
+	}
+	return md
+}
+
+func (s *Server) putObject(req *request, b *object.Bucket) {
+	check, err := req.check()
+	if err != nil {
+		req.error(toAPIError(err, errInternalError))
+		return
+	}
+	o, err := b.Put(req.key, req.r.Body, object.PutOptions{
+		ContentType: req.r.Header.Get("Content-Type"),
+		Metadata:    req.metadata(),
+		Check:       check,
+	})
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchBucket))
+		return
+	}
+	req.w.Header().Set("ETag", quoteETag(o.ETag))
+	req.w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getObject(req *request, b *object.Bucket) {
+	o, r, err := b.Get(req.key)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchKey))
+		return
+	}
+	defer r.Close()
+	h := req.w.Header()
+	h.Set("ETag", quoteETag(o.ETag))
+	h.Set("Accept-Ranges", "bytes")
+	contentType := o.ContentType
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	for k, v := range o.Metadata {
+		h.Set(metaPrefix+k, v)
+	}
+	// ServeContent takes care of ranges and conditional requests.
+	http.ServeContent(req.w, req.r, "", o.LastModified, r)
+}
+
+func (s *Server) newUpload(req *request, b *object.Bucket) {
+	u, err := b.NewUpload(req.key, req.r.Header.Get("Content-Type"), req.metadata())
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchBucket))
+		return
+	}
+	writeXML(req.w, http.StatusOK, &initiateMultipartUploadResult{
+		Bucket:   b.Name(),
+		Key:      u.Key,
+		UploadID: u.ID,
+	})
+}
+
+// upload returns the upload the request is for, if it is of the request's
+// key.
+func (req *request) upload(b *object.Bucket) (*object.Upload, error) {
+	u, err := b.GetUpload(req.param("uploadId"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Key != req.key {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+func (s *Server) putPart(req *request, b *object.Bucket) {
+	n, err := strconv.Atoi(req.param("partNumber"))
+	if err != nil || n < 1 || n > object.MaxPartNumber {
+		req.error(errInvalidArgument)
+		return
+	}
+	u, err := req.upload(b)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	check, err := req.check()
+	if err != nil {
+		req.error(toAPIError(err, errInternalError))
+		return
+	}
+	p, err := b.PutPart(u.ID, n, req.r.Body, check)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	req.w.Header().Set("ETag", quoteETag(p.ETag))
+	req.w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) listParts(req *request, b *object.Bucket) {
+	u, err := req.upload(b)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	parts, err := b.ListParts(u.ID)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	res := &listPartsResult{
+		Bucket:    b.Name(),
+		Key:       u.Key,
+		UploadID:  u.ID,
+		Initiator: s.owner(),
+		Owner:     s.owner(),
+		MaxParts:  object.MaxPartNumber,
+	}
+	for _, p := range parts {
+		res.Parts = append(res.Parts, partInfo{
+			PartNumber:   p.Number,
+			LastModified: s3Time(p.LastModified),
+			ETag:         quoteETag(p.ETag),
+			Size:         p.Size,
+		})
+	}
+	writeXML(req.w, http.StatusOK, res)
+}
+
+func (s *Server) completeUpload(req *request, b *object.Bucket) {
+	u, err := req.upload(b)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	var body completeMultipartUpload
+	if err := req.readXML(&body); err != nil {
+		req.error(toAPIError(err, errInternalError))
+		return
+	}
+	parts := make([]object.CompletedPart, len(body.Parts))
+	for i, p := range body.Parts {
+		parts[i] = object.CompletedPart{Number: p.PartNumber, ETag: p.ETag}
+	}
+	o, err := b.CompleteUpload(u.ID, parts)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	writeXML(req.w, http.StatusOK, &completeMultipartUploadResult{
+		Location: "/" + b.Name() + "/" + o.Key,
+		Bucket:   b.Name(),
+		Key:      o.Key,
+		ETag:     quoteETag(o.ETag),
+	})
+}
+
+func (s *Server) abortUpload(req *request, b *object.Bucket) {
+	u, err := req.upload(b)
+	if err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	if err := b.AbortUpload(u.ID); err != nil {
+		req.error(toAPIError(err, errNoSuchUpload))
+		return
+	}
+	req.w.WriteHeader(http.StatusNoContent)
+}
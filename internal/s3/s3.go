@@ -0,0 +1,211 @@
+// Package s3 serves the object volumes of a cluster over a subset of the
+// Amazon S3 REST API, so that applications can store data in Torus over
+// HTTP without a block device. Buckets are addressed by path.
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/torus"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "s3")
+
+var (
+	promS3Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_s3_requests_total",
+		Help: "Number of requests served by the S3 gateway",
+	}, []string{"method"})
+	promS3Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_s3_errors_total",
+		Help: "Number of S3 gateway requests that failed, by S3 error code",
+	}, []string{"code"})
+)
+
+func init() {
+	prometheus.MustRegister(promS3Requests)
+	prometheus.MustRegister(promS3Errors)
+}
+
+// maxXMLBody is the most the gateway reads of a request with an XML body.
+const maxXMLBody = 1 << 20
+
+type Server struct {
+	dfs   *torus.Server
+	creds map[string]string
+}
+
+// NewServer returns a gateway to the object volumes of dfs. Requests must be
+// signed by one of the access keys in creds, unless creds is nil, in which
+// case anyone can do anything the server's identity can.
+func NewServer(dfs *torus.Server, creds map[string]string) *Server {
+	return &Server{
+		dfs:   dfs,
+		creds: creds,
+	}
+}
+
+func ServeS3(addr string, srv *torus.Server, creds map[string]string) error {
+	return NewServer(srv, creds).Run(addr)
+}
+
+func (s *Server) Run(addr string) error {
+	clog.Infof("serving S3 on %s", addr)
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	promS3Requests.WithLabelValues(r.Method).Inc()
+	w.Header().Set("Server", "Torus")
+	payload, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, r, toAPIError(err, errAccessDenied))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		if r.Method != "GET" {
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		s.listBuckets(w, r)
+		return
+	}
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+	req := &request{
+		w:       w,
+		r:       r,
+		bucket:  bucket,
+		key:     key,
+		payload: payload,
+	}
+	if key == "" {
+		s.serveBucket(req)
+		return
+	}
+	s.serveObject(req)
+}
+
+// request is a request for a bucket or an object in one.
+type request struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	bucket  string
+	key     string
+	payload string
+}
+
+func (req *request) has(param string) bool {
+	_, ok := req.r.URL.Query()[param]
+	return ok
+}
+
+func (req *request) param(param string) string {
+	return req.r.URL.Query().Get(param)
+}
+
+func (req *request) error(e *apiError) {
+	writeError(req.w, req.r, e)
+}
+
+// check returns a check of the body of the request against its Content-MD5
+// and the payload hash it was signed with, if any.
+func (req *request) check() (func(md5Sum, sha256Sum []byte) error, error) {
+	var wantMD5 []byte
+	if v := req.r.Header.Get("Content-MD5"); v != "" {
+		var err error
+		wantMD5, err = base64.StdEncoding.DecodeString(v)
+		if err != nil || len(wantMD5) != md5.Size {
+			return nil, errInvalidDigest
+		}
+	}
+	var wantSHA256 []byte
+	if req.payload != "" {
+		var err error
+		wantSHA256, err = hex.DecodeString(req.payload)
+		if err != nil || len(wantSHA256) != sha256.Size {
+			return nil, errSHA256Mismatch
+		}
+	}
+	if wantMD5 == nil && wantSHA256 == nil {
+		return nil, nil
+	}
+	return func(md5Sum, sha256Sum []byte) error {
+		if wantMD5 != nil && string(md5Sum) != string(wantMD5) {
+			return errBadDigest
+		}
+		if wantSHA256 != nil && string(sha256Sum) != string(wantSHA256) {
+			return errSHA256Mismatch
+		}
+		return nil
+	}, nil
+}
+
+// readXML reads and checks an XML request body into v.
+func (req *request) readXML(v interface{}) error {
+	body, err := ioutil.ReadAll(io.LimitReader(req.r.Body, maxXMLBody))
+	if err != nil {
+		return err
+	}
+	check, err := req.check()
+	if err != nil {
+		return err
+	}
+	if check != nil {
+		md5Sum := md5.Sum(body)
+		sha256Sum := sha256.Sum256(body)
+		if err := check(md5Sum[:], sha256Sum[:]); err != nil {
+			return err
+		}
+	}
+	if err := xml.Unmarshal(body, v); err != nil {
+		return errMalformedXML
+	}
+	return nil
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		clog.Errorf("couldn't marshal S3 response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	w.Write(data)
+}
+
+// s3Time formats a time the way S3 does in XML.
+func s3Time(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+func (s *Server) owner() owner {
+	return owner{ID: "torus", DisplayName: "torus"}
+}
@@ -1,10 +1,117 @@
 package torustcmu
 
 import (
+	"encoding/binary"
+
 	"github.com/coreos/go-tcmu"
 	"github.com/coreos/go-tcmu/scsi"
 )
 
+const (
+	unmap          = 0x42
+	readCapacity16 = 0x10
+
+	vpdSupportedPages = 0x00
+	vpdDeviceID       = 0x83
+	vpdBlockLimits    = 0xb0
+	vpdProvisioning   = 0xb2
+)
+
+// handleInquiry adds the block limits and provisioning pages, which tell the
+// kernel it may discard, to the emulated inquiry data.
+func (h *torusHandler) handleInquiry(cmd *tcmu.SCSICmd) (tcmu.SCSIResponse, error) {
+	if cmd.GetCDB(1)&0x01 == 0 {
+		return tcmu.EmulateInquiry(cmd, h.inq)
+	}
+	var data []byte
+	switch page := cmd.GetCDB(2); page {
+	case vpdSupportedPages:
+		data = []byte{0, page, 0, 4, vpdSupportedPages, vpdDeviceID, vpdBlockLimits, vpdProvisioning}
+	case vpdBlockLimits:
+		data = make([]byte, 64)
+		data[1] = page
+		data[3] = 0x3c
+		binary.BigEndian.PutUint32(data[20:24], maxUnmapBlocks)
+		binary.BigEndian.PutUint32(data[24:28], 1<<8)
+		// Torus can only give up whole blocks of the volume.
+		granularity := h.blockSize / uint64(cmd.Device().Sizes().BlockSize)
+		if granularity == 0 {
+			granularity = 1
+		}
+		binary.BigEndian.PutUint32(data[28:32], uint32(granularity))
+	case vpdProvisioning:
+		data = make([]byte, 8)
+		data[1] = page
+		data[3] = 4
+		data[5] = 0x80 // LBPU: UNMAP is supported
+		data[6] = 0x02 // thin provisioned
+	default:
+		return tcmu.EmulateInquiry(cmd, h.inq)
+	}
+	if _, err := cmd.Write(data); err != nil {
+		clog.Errorf("inquiry failed: %v", err)
+		return cmd.MediumError(), nil
+	}
+	return cmd.Ok(), nil
+}
+
+func (h *torusHandler) handleReadCapacity16(cmd *tcmu.SCSICmd) (tcmu.SCSIResponse, error) {
+	sizes := cmd.Device().Sizes()
+	data := make([]byte, 32)
+	binary.BigEndian.PutUint64(data[0:8], uint64(sizes.VolumeSize/sizes.BlockSize)-1)
+	binary.BigEndian.PutUint32(data[8:12], uint32(sizes.BlockSize))
+	data[14] = 0x80 // LBPME: the volume is thin provisioned
+	if _, err := cmd.Write(data); err != nil {
+		clog.Errorf("read capacity failed: %v", err)
+		return cmd.MediumError(), nil
+	}
+	return cmd.Ok(), nil
+}
+
+// handleUnmap drops the volume's references to the whole blocks in each
+// range, as a discard through NBD does.
+func (h *torusHandler) handleUnmap(cmd *tcmu.SCSICmd) (tcmu.SCSIResponse, error) {
+	length := int(cmd.GetCDB(7))<<8 | int(cmd.GetCDB(8))
+	if length == 0 {
+		return cmd.Ok(), nil
+	}
+	if length < 8 {
+		return cmd.IllegalRequest(), nil
+	}
+	params := make([]byte, length)
+	if n, err := cmd.Read(params); err != nil || n < length {
+		clog.Errorf("unmap failed: unable to read the parameters: %v", err)
+		return cmd.MediumError(), nil
+	}
+	descs := params[8:]
+	if n := int(binary.BigEndian.Uint16(params[2:4])); n < len(descs) {
+		descs = descs[:n]
+	}
+	sizes := cmd.Device().Sizes()
+	blocks := uint64(sizes.VolumeSize / sizes.BlockSize)
+	bs := uint64(sizes.BlockSize)
+	for ; len(descs) >= 16; descs = descs[16:] {
+		lba := binary.BigEndian.Uint64(descs[0:8])
+		count := uint64(binary.BigEndian.Uint32(descs[8:12]))
+		if count > maxUnmapBlocks || lba > blocks || count > blocks-lba {
+			return cmd.IllegalRequest(), nil
+		}
+		if count == 0 {
+			continue
+		}
+		if err := h.file.Trim(int64(lba*bs), int64(count*bs)); err != nil {
+			clog.Errorf("unmap failed: %v", err)
+			return cmd.MediumError(), nil
+		}
+	}
+	// Trimmed blocks are only given up once the volume is synced.
+	if err := h.file.Sync(); err != nil {
+		clog.Errorf("sync failed: %v", err)
+		return cmd.MediumError(), nil
+	}
+	return cmd.Ok(), nil
+}
+
 func (h *torusHandler) handleSyncCommand(cmd *tcmu.SCSICmd) (tcmu.SCSIResponse, error) {
 	clog.Debugf("syncing")
 	err := h.file.Sync()
@@ -2,6 +2,8 @@ package torustcmu
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/coreos/go-tcmu"
 	"github.com/coreos/go-tcmu/scsi"
@@ -12,18 +14,43 @@ import (
 const (
 	defaultBlockSize = 4 * 1024
 	devPath          = "/dev/torus"
+	configPath       = "/sys/kernel/config/target/core"
+
+	// firstHBA is the lowest HBA number volumes are attached under.
+	firstHBA = 30
+	// maxUnmapBlocks caps how much a single UNMAP descriptor may cover,
+	// so one command doesn't stall the others for long.
+	maxUnmapBlocks = 1 << 18
 )
 
 var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "tcmu")
 
-func ConnectAndServe(f *block.BlockFile, name string, closer chan bool) error {
+// Options tune how a volume is attached.
+type Options struct {
+	// Workers is how many SCSI commands are served at once.
+	Workers int
+	// BlockSize is the volume's block size, which discards are best
+	// aligned to.
+	BlockSize uint64
+}
+
+// ConnectAndServe registers the volume with the kernel's target_core_user
+// as a local SCSI disk, and serves its commands until closer is closed.
+func ConnectAndServe(f *block.BlockFile, name string, opts Options, closer chan bool) error {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	hba, err := freeHBA()
+	if err != nil {
+		return err
+	}
 	wwn := tcmu.NaaWWN{
 		// TODO(barakmich): CoreOS OUI here
 		OUI:      "000000",
 		VendorID: tcmu.GenerateSerial(name),
 	}
 	h := &tcmu.SCSIHandler{
-		HBA:        30,
+		HBA:        hba,
 		LUN:        0,
 		WWN:        wwn,
 		VolumeName: name,
@@ -34,14 +61,15 @@ func ConnectAndServe(f *block.BlockFile, name string, closer chan bool) error {
 		},
 		DevReady: tcmu.MultiThreadedDevReady(
 			&torusHandler{
-				file: f,
-				name: name,
+				file:      f,
+				name:      name,
+				blockSize: opts.BlockSize,
 				inq: &tcmu.InquiryInfo{
 					VendorID:   "CoreOS",
 					ProductID:  "TorusBlk",
 					ProductRev: "0001",
 				},
-			}, 1),
+			}, opts.Workers),
 	}
 	d, err := tcmu.OpenTCMUDevice(devPath, h)
 	if err != nil {
@@ -53,19 +81,38 @@ func ConnectAndServe(f *block.BlockFile, name string, closer chan bool) error {
 	return nil
 }
 
+// freeHBA finds an HBA number no other attachment on this host is using,
+// so that several volumes can be attached at once.
+func freeHBA() (int, error) {
+	for hba := firstHBA; hba < firstHBA+1024; hba++ {
+		_, err := os.Stat(filepath.Join(configPath, fmt.Sprintf("user_%d", hba)))
+		if os.IsNotExist(err) {
+			return hba, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("no free target_core_user HBA under %s", configPath)
+}
+
 type torusHandler struct {
-	file *block.BlockFile
-	name string
-	inq  *tcmu.InquiryInfo
+	file      *block.BlockFile
+	name      string
+	blockSize uint64
+	inq       *tcmu.InquiryInfo
 }
 
 func (h *torusHandler) HandleCommand(cmd *tcmu.SCSICmd) (tcmu.SCSIResponse, error) {
 	switch cmd.Command() {
 	case scsi.Inquiry:
-		return tcmu.EmulateInquiry(cmd, h.inq)
+		return h.handleInquiry(cmd)
 	case scsi.TestUnitReady:
 		return tcmu.EmulateTestUnitReady(cmd)
 	case scsi.ServiceActionIn16:
+		if cmd.GetCDB(1)&0x1f == readCapacity16 {
+			return h.handleReadCapacity16(cmd)
+		}
 		return tcmu.EmulateServiceActionIn(cmd)
 	case scsi.ModeSense, scsi.ModeSense10:
 		return tcmu.EmulateModeSense(cmd, true)
@@ -77,6 +124,8 @@ func (h *torusHandler) HandleCommand(cmd *tcmu.SCSICmd) (tcmu.SCSIResponse, erro
 		return h.handleWrite(cmd)
 	case scsi.SynchronizeCache, scsi.SynchronizeCache16:
 		return h.handleSyncCommand(cmd)
+	case unmap:
+		return h.handleUnmap(cmd)
 	case scsi.MaintenanceIn:
 		return h.handleReportDeviceID(cmd)
 	default:
@@ -0,0 +1,66 @@
+// tracing sets up the export of the spans Torus records around block I/O.
+package tracing
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/coreos/pkg/capnslog"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "tracing")
+
+// shutdownTimeout bounds how long Start's stop function waits for the last
+// spans to be sent.
+const shutdownTimeout = 5 * time.Second
+
+var (
+	endpoint    string
+	sampleRatio float64
+)
+
+func AddFlags(set *flag.FlagSet) {
+	set.StringVarP(&endpoint, "trace-endpoint", "", "", "Jaeger collector to send traces to, such as http://jaeger:14268/api/traces")
+	set.Float64VarP(&sampleRatio, "trace-sample-ratio", "", 0.01, "Fraction of requests to trace, unless the caller already decided")
+}
+
+// Start sends the spans of this process, named service, to the collector
+// given by the flags. Trace contexts are always propagated, so that a process
+// that doesn't export spans still passes on the traces of those that do. The
+// returned function flushes any spans that are still buffered.
+func Start(service string) (func(), error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if endpoint == "" {
+		return func() {}, nil
+	}
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("tracing: sample ratio must be between 0 and 1, got %v", sampleRatio)
+	}
+	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(endpoint)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+	)
+	otel.SetTracerProvider(tp)
+	clog.Infof("sending %v of traces to %s", sampleRatio, endpoint)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			clog.Errorf("couldn't flush traces: %v", err)
+		}
+	}, nil
+}
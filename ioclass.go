@@ -0,0 +1,70 @@
+package torus
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// IOClass is how urgent the I/O of an attachment is. When a peer has more
+// requests to make of another peer than it lets be in flight at once, the
+// waiting requests of a more urgent class go first.
+type IOClass int
+
+const (
+	// IOClassNormal is the zero value, so that I/O is normal unless said
+	// otherwise.
+	IOClassNormal IOClass = iota
+	// IOClassLatency is for interactive workloads, like a VM's root disk.
+	IOClassLatency
+	// IOClassBatch is for throughput workloads that can wait, like backups.
+	IOClassBatch
+)
+
+// IOClasses lists the classes from most to least urgent.
+var IOClasses = []IOClass{IOClassLatency, IOClassNormal, IOClassBatch}
+
+func (c IOClass) String() string {
+	switch c {
+	case IOClassNormal:
+		return "normal"
+	case IOClassLatency:
+		return "latency"
+	case IOClassBatch:
+		return "batch"
+	}
+	return fmt.Sprintf("IOClass(%d)", int(c))
+}
+
+// Priority orders the classes for scheduling; lower goes first.
+func (c IOClass) Priority() int {
+	switch c {
+	case IOClassLatency:
+		return 0
+	case IOClassBatch:
+		return 2
+	}
+	return 1
+}
+
+func ParseIOClass(s string) (IOClass, error) {
+	for _, c := range IOClasses {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return IOClassNormal, fmt.Errorf("unknown I/O class %q: must be one of latency, normal or batch", s)
+}
+
+// WithIOClass returns a context whose block requests are scheduled as class.
+func WithIOClass(ctx context.Context, class IOClass) context.Context {
+	return context.WithValue(ctx, CtxIOClass, class)
+}
+
+// GetIOClass returns the I/O class of requests made with ctx.
+func GetIOClass(ctx context.Context) IOClass {
+	if c, ok := ctx.Value(CtxIOClass).(IOClass); ok {
+		return c
+	}
+	return IOClassNormal
+}
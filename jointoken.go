@@ -0,0 +1,50 @@
+package torus
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+// JoinTokenMetadataService is implemented by metadata services that can keep
+// a cluster's join token. Only a hash of the token is kept, so reading the
+// metadata doesn't give it away.
+type JoinTokenMetadataService interface {
+	// SetJoinTokenHash replaces the hash of the join token. A nil hash
+	// clears it.
+	SetJoinTokenHash(hash []byte) error
+	// GetJoinTokenHash returns the hash of the join token, or nil if the
+	// cluster has none.
+	GetJoinTokenHash() ([]byte, error)
+}
+
+// HashJoinToken returns the hash of a join token that the metadata service
+// keeps.
+func HashJoinToken(token string) []byte {
+	h := sha256.Sum256([]byte(token))
+	return h[:]
+}
+
+// CheckJoinToken returns ErrJoinToken unless token is the join token of the
+// cluster mds belongs to. If the cluster has no join token, only an empty
+// token matches, so that a node given one doesn't join some other cluster
+// that happens to be reachable.
+func CheckJoinToken(mds MetadataService, token string) error {
+	var want []byte
+	if jt, ok := mds.(JoinTokenMetadataService); ok {
+		var err error
+		want, err = jt.GetJoinTokenHash()
+		if err != nil {
+			return err
+		}
+	}
+	if want == nil {
+		if token == "" {
+			return nil
+		}
+		return ErrJoinToken
+	}
+	if token == "" || subtle.ConstantTimeCompare(want, HashJoinToken(token)) != 1 {
+		return ErrJoinToken
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package torus_test
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+)
+
+func TestCheckJoinToken(t *testing.T) {
+	mds := temp.NewClient(torus.Config{}, temp.NewServer())
+	if err := torus.CheckJoinToken(mds, ""); err != nil {
+		t.Fatalf("no token for a cluster without one: %v", err)
+	}
+	if err := torus.CheckJoinToken(mds, "secret"); err != torus.ErrJoinToken {
+		t.Fatalf("expected ErrJoinToken joining a cluster without a token, got %v", err)
+	}
+	if err := mds.SetJoinTokenHash(torus.HashJoinToken("secret")); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"", "Secret"} {
+		if err := torus.CheckJoinToken(mds, token); err != torus.ErrJoinToken {
+			t.Errorf("token %q: expected ErrJoinToken, got %v", token, err)
+		}
+	}
+	if err := torus.CheckJoinToken(mds, "secret"); err != nil {
+		t.Errorf("the right token: %v", err)
+	}
+	if err := mds.SetJoinTokenHash(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := torus.CheckJoinToken(mds, ""); err != nil {
+		t.Errorf("no token once cleared: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package torus
+
+import "time"
+
+// PeerLoad is how busy a peer is serving blocks to the others. Each peer
+// sends its own with its heartbeat, so that clients can spread reads towards
+// the replicas with the most to spare.
+type PeerLoad struct {
+	// QueueDepth is how many block requests from other peers are being
+	// served.
+	QueueDepth uint64
+	// ReadLatency is how long serving a block read has lately taken.
+	ReadLatency time.Duration
+}
+
+// LoadReporter is implemented by block stores that know how loaded they are.
+type LoadReporter interface {
+	Load() PeerLoad
+}
@@ -39,7 +39,12 @@ func NewServer(cfg Config, metadataServiceKind, blockStoreKind string) (*Server,
 
 	global := mds.GlobalMetadata()
 
-	blocks, err := CreateBlockStore(blockStoreKind, "current", cfg, global)
+	var blocks BlockStore
+	if len(cfg.Devices) != 0 {
+		blocks, err = openDevices(blockStoreKind, "current", cfg, global)
+	} else {
+		blocks, err = CreateBlockStore(blockStoreKind, "current", cfg, global)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,28 @@
+package torus
+
+import "golang.org/x/net/context"
+
+// ReplicaCopy is what one of the peers a block is placed on has of it.
+type ReplicaCopy struct {
+	Peer string
+	// Replica is set if the ring puts the block on the peer. Otherwise the
+	// peer is a fallback, which only has the block if a write was handed
+	// off to it.
+	Replica bool
+	// Has is set if the peer has the block.
+	Has bool
+	// Checksum is the CRC-32C of the peer's copy, if it could be read.
+	Checksum uint32
+	// Err is why the peer couldn't be asked, or, if it has the block, why
+	// its copy couldn't be read.
+	Err error
+}
+
+// BlockLocator is implemented by block stores that can ask the peers a block
+// is placed on for their copies of it.
+type BlockLocator interface {
+	// LocateBlock returns the copies of ref held by each of its replicas,
+	// in the order the ring places it, followed by the next fallbacks
+	// peers after them.
+	LocateBlock(ctx context.Context, ref BlockRef, fallbacks int) ([]ReplicaCopy, error)
+}
@@ -3,6 +3,7 @@ package torus
 import (
 	"fmt"
 	"io"
+	"sort"
 
 	"golang.org/x/net/context"
 
@@ -17,6 +18,7 @@ type MetadataKind int
 const (
 	EtcdMetadata MetadataKind = iota
 	TempMetadata
+	ConsulMetadata
 )
 
 // MetadataService is the interface representing the basic ways to manipulate
@@ -59,6 +61,24 @@ type DebugMetadataService interface {
 	DumpMetadata(io.Writer) error
 }
 
+// VolumeIDReserver is implemented by metadata services that can mint many
+// volume IDs in one operation.
+type VolumeIDReserver interface {
+	// NewVolumeIDs reserves n consecutive volume IDs, returning the first.
+	NewVolumeIDs(n int) (VolumeID, error)
+}
+
+// VolumeWatchMetadataService is implemented by metadata services that can
+// say when a volume's settings change, so that those caching them see the
+// change at once.
+type VolumeWatchMetadataService interface {
+	// SubscribeVolumeChanges sends on ch the ID of each volume whose
+	// settings change, until UnsubscribeVolumeChanges. It fails with
+	// ErrNotSupported if the service doesn't watch them.
+	SubscribeVolumeChanges(ch chan VolumeID) error
+	UnsubscribeVolumeChanges(ch chan VolumeID)
+}
+
 type GlobalMetadata struct {
 	BlockSize        uint64
 	DefaultBlockSpec BlockLayerSpec
@@ -68,104 +88,120 @@ type GlobalMetadata struct {
 // a registered MetadataService.
 type CreateMetadataServiceFunc func(cfg Config) (MetadataService, error)
 
-var metadataServices map[string]CreateMetadataServiceFunc
+// InitMDSFunc is the signature of a function which preformats a metadata service.
+type InitMDSFunc func(cfg Config, gmd GlobalMetadata, ringType RingType) error
+
+// WipeMDSFunc is the signature of a function which deletes all of a metadata
+// service's data.
+type WipeMDSFunc func(cfg Config) error
+
+// SetRingFunc is the signature of a function which sets the ring of a
+// metadata service without connecting to it as a client.
+type SetRingFunc func(cfg Config, r Ring) error
+
+// MetadataProvider is everything a metadata backend registers: how to
+// connect to it, and how to initialize, wipe and set the ring of the store
+// behind it. Only Create is required.
+type MetadataProvider struct {
+	Create  CreateMetadataServiceFunc
+	Init    InitMDSFunc
+	Wipe    WipeMDSFunc
+	SetRing SetRingFunc
+}
+
+var metadataProviders map[string]*MetadataProvider
 
-// RegisterMetadataService is the hook used for implementations of
+// RegisterMetadataProvider is the hook used for implementations of
 // MetadataServices to register themselves to the system. This is usually
 // called in the init() of the package that implements the MetadataService.
 // A similar pattern is used in database/sql of the standard library.
-func RegisterMetadataService(name string, newFunc CreateMetadataServiceFunc) {
-	if metadataServices == nil {
-		metadataServices = make(map[string]CreateMetadataServiceFunc)
+func RegisterMetadataProvider(name string, p MetadataProvider) {
+	if metadataProviders == nil {
+		metadataProviders = make(map[string]*MetadataProvider)
 	}
 
-	if _, ok := metadataServices[name]; ok {
-		panic("torus: attempted to register MetadataService " + name + " twice")
+	if _, ok := metadataProviders[name]; ok {
+		panic("torus: attempted to register MetadataProvider " + name + " twice")
+	}
+	if p.Create == nil {
+		panic("torus: MetadataProvider " + name + " can't create a MetadataService")
 	}
 
-	metadataServices[name] = newFunc
+	metadataProviders[name] = &p
 }
 
-// CreateMetadataService calls the constructor of the specified MetadataService
-// with the provided address.
-func CreateMetadataService(name string, cfg Config) (MetadataService, error) {
-	clog.Infof("creating metadata service: %s", name)
-
-	if mdsf, ok := metadataServices[name]; ok {
-		return mdsf(cfg)
+// MetadataProviders returns the names of the registered metadata backends,
+// in order.
+func MetadataProviders() []string {
+	var out []string
+	for name := range metadataProviders {
+		out = append(out, name)
 	}
-
-	return nil, fmt.Errorf("torus: the metadata service %q doesn't exist", name)
+	sort.Strings(out)
+	return out
 }
 
-// InitMDSFunc is the signature of a function which preformats a metadata service.
-type InitMDSFunc func(cfg Config, gmd GlobalMetadata, ringType RingType) error
+func getMetadataProvider(name string) (*MetadataProvider, error) {
+	p, ok := metadataProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("torus: the metadata service %q doesn't exist", name)
+	}
+	return p, nil
+}
 
-var initMDSFuncs map[string]InitMDSFunc
+// RegisterMetadataService registers a MetadataService that can only be
+// connected to, as RegisterMetadataProvider does.
+func RegisterMetadataService(name string, newFunc CreateMetadataServiceFunc) {
+	RegisterMetadataProvider(name, MetadataProvider{Create: newFunc})
+}
 
-// RegisterMetadataInit is the hook used for implementations of
-// MetadataServices to register their ways of creating base metadata to the system.
-func RegisterMetadataInit(name string, newFunc InitMDSFunc) {
-	if initMDSFuncs == nil {
-		initMDSFuncs = make(map[string]InitMDSFunc)
-	}
+// CreateMetadataService calls the constructor of the specified MetadataService
+// with the provided address.
+func CreateMetadataService(name string, cfg Config) (MetadataService, error) {
+	clog.Infof("creating metadata service: %s", name)
 
-	if _, ok := initMDSFuncs[name]; ok {
-		panic("torus: attempted to register InitMDSFunc " + name + " twice")
+	p, err := getMetadataProvider(name)
+	if err != nil {
+		return nil, err
 	}
-
-	initMDSFuncs[name] = newFunc
+	return p.Create(cfg)
 }
 
 // InitMDS calls the specific init function provided by a metadata package.
 func InitMDS(name string, cfg Config, gmd GlobalMetadata, ringType RingType) error {
 	clog.Debugf("running InitMDS for service type: %s", name)
-	return initMDSFuncs[name](cfg, gmd, ringType)
-}
-
-type WipeMDSFunc func(cfg Config) error
-
-var wipeMDSFuncs map[string]WipeMDSFunc
-
-// RegisterMetadataWipe is the hook used for implementations of
-// MetadataServices to register their ways of deleting their metadata from the consistent store
-func RegisterMetadataWipe(name string, newFunc WipeMDSFunc) {
-	if wipeMDSFuncs == nil {
-		wipeMDSFuncs = make(map[string]WipeMDSFunc)
+	p, err := getMetadataProvider(name)
+	if err != nil {
+		return err
 	}
-
-	if _, ok := wipeMDSFuncs[name]; ok {
-		panic("torus: attempted to register WipeMDSFunc " + name + " twice")
+	if p.Init == nil {
+		return ErrNotSupported
 	}
-
-	wipeMDSFuncs[name] = newFunc
+	return p.Init(cfg, gmd, ringType)
 }
 
+// WipeMDS calls the specific wipe function provided by a metadata package.
 func WipeMDS(name string, cfg Config) error {
 	clog.Debugf("running WipeMDS for service type: %s", name)
-	return wipeMDSFuncs[name](cfg)
-}
-
-type SetRingFunc func(cfg Config, r Ring) error
-
-var setRingFuncs map[string]SetRingFunc
-
-// RegisterSetRing is the hook used for implementations of MetadataServices to
-// register their ways of creating base metadata to the system.
-func RegisterSetRing(name string, newFunc SetRingFunc) {
-	if setRingFuncs == nil {
-		setRingFuncs = make(map[string]SetRingFunc)
+	p, err := getMetadataProvider(name)
+	if err != nil {
+		return err
 	}
-
-	if _, ok := setRingFuncs[name]; ok {
-		panic("torus: attempted to register SetRingFunc " + name + " twice")
+	if p.Wipe == nil {
+		return ErrNotSupported
 	}
-
-	setRingFuncs[name] = newFunc
+	return p.Wipe(cfg)
 }
 
 // SetRing calls the specific SetRing function provided by a metadata package.
 func SetRing(name string, cfg Config, r Ring) error {
 	clog.Debugf("running setRing for service type: %s", name)
-	return setRingFuncs[name](cfg, r)
+	p, err := getMetadataProvider(name)
+	if err != nil {
+		return err
+	}
+	if p.SetRing == nil {
+		return ErrNotSupported
+	}
+	return p.SetRing(cfg, r)
 }
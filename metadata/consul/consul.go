@@ -0,0 +1,559 @@
+// consul is a metadata service that keeps the cluster's metadata in the
+// key/value store of a Consul cluster, and uses Consul sessions as leases.
+package consul
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+)
+
+// As for etcd, keys always put the static parts first, followed by the
+// variables, so that related keys can be listed by prefix.
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "consul")
+
+const (
+	// KeyPrefix has no leading slash, as Consul keys can't start with one.
+	KeyPrefix      = "github.com/coreos/torus/"
+	peerTimeoutMax = 50 * time.Second
+	sessionTTL     = "30s"
+)
+
+var (
+	promAtomicRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_consul_atomic_retries",
+		Help: "Number of times an atomic update failed and needed to be retried",
+	}, []string{"key"})
+	promOps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_consul_base_ops_total",
+		Help: "Number of metadata operations made against Consul",
+	}, []string{"kind"})
+)
+
+func init() {
+	torus.RegisterMetadataProvider("consul", torus.MetadataProvider{
+		Create:  newConsulMetadata,
+		Init:    initConsulMetadata,
+		Wipe:    wipeConsulMetadata,
+		SetRing: setRing,
+	})
+
+	prometheus.MustRegister(promAtomicRetries)
+	prometheus.MustRegister(promOps)
+}
+
+type consulCtx struct {
+	consul *Consul
+	ctx    context.Context
+}
+
+type Consul struct {
+	consulCtx
+	mut          sync.RWMutex
+	cfg          torus.Config
+	global       torus.GlobalMetadata
+	volumesCache map[string]*models.Volume
+
+	ringListeners []chan torus.Ring
+	stopWatch     context.CancelFunc
+
+	// Leases are int64s to the rest of torus, but Consul sessions are
+	// named by UUIDs, so each session gets a number for as long as this
+	// client lives.
+	leaseMut  sync.Mutex
+	leases    map[int64]string
+	lastLease int64
+
+	Client *api.Client
+
+	uuid string
+}
+
+func newClient(cfg torus.Config) (*api.Client, error) {
+	ccfg := api.DefaultConfig()
+	ccfg.Address = cfg.MetadataAddress
+	if cfg.TLS != nil {
+		ccfg.Scheme = "https"
+		ccfg.Transport = &http.Transport{TLSClientConfig: cfg.TLS}
+	}
+	return api.NewClient(ccfg)
+}
+
+func newConsulMetadata(cfg torus.Config) (torus.MetadataService, error) {
+	var uuid string
+	var err error
+	if cfg.DataDir == "" {
+		uuid = metadata.MakeUUID()
+	} else {
+		uuid, err = metadata.GetUUID(cfg.DataDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consul{
+		cfg:          cfg,
+		Client:       client,
+		volumesCache: make(map[string]*models.Volume),
+		leases:       make(map[int64]string),
+		uuid:         uuid,
+	}
+	// As for etcd, c can be used directly (with a nil context), or through
+	// WithContext().
+	c.consulCtx.consul = c
+	err = c.getGlobalMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.watchRingUpdates(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *consulCtx) Kind() torus.MetadataKind {
+	return torus.ConsulMetadata
+}
+
+func (c *Consul) Close() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.stopWatch()
+	for _, l := range c.ringListeners {
+		close(l)
+	}
+	c.ringListeners = nil
+	return nil
+}
+
+func (c *Consul) getGlobalMetadata() error {
+	kv, _, err := c.Client.KV().Get(MkKey("meta", "globalmetadata"), nil)
+	if err != nil {
+		return err
+	}
+	if kv == nil {
+		return torus.ErrNoGlobalMetadata
+	}
+	var gmd torus.GlobalMetadata
+	err = json.Unmarshal(kv.Value, &gmd)
+	if err != nil {
+		return err
+	}
+	c.global = gmd
+	return nil
+}
+
+func (c *Consul) WithContext(ctx context.Context) torus.MetadataService {
+	return &consulCtx{
+		consul: c,
+		ctx:    ctx,
+	}
+}
+
+func (c *Consul) SubscribeNewRings(ch chan torus.Ring) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.ringListeners = append(c.ringListeners, ch)
+}
+
+func (c *Consul) UnsubscribeNewRings(ch chan torus.Ring) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for i, l := range c.ringListeners {
+		if ch == l {
+			c.ringListeners = append(c.ringListeners[:i], c.ringListeners[i+1:]...)
+		}
+	}
+}
+
+// LeaseSession returns the ID of the Consul session behind a lease from
+// GetLease.
+func (c *Consul) LeaseSession(lease int64) (string, error) {
+	c.leaseMut.Lock()
+	defer c.leaseMut.Unlock()
+	id, ok := c.leases[lease]
+	if !ok {
+		return "", torus.ErrLeaseNotFound
+	}
+	return id, nil
+}
+
+// Context-sensitive calls
+
+func (c *consulCtx) getContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+func (c *consulCtx) q() *api.QueryOptions {
+	return (&api.QueryOptions{}).WithContext(c.getContext())
+}
+
+func (c *consulCtx) w() *api.WriteOptions {
+	return (&api.WriteOptions{}).WithContext(c.getContext())
+}
+
+// txn runs ops as one transaction, returning whether it was committed.
+func (c *consulCtx) txn(ops api.KVTxnOps) (bool, *api.KVTxnResponse, error) {
+	ok, resp, _, err := c.consul.Client.KV().Txn(ops, c.q())
+	if err != nil {
+		return false, nil, err
+	}
+	return ok, resp, nil
+}
+
+func (c *consulCtx) WithContext(ctx context.Context) torus.MetadataService {
+	return c.consul.WithContext(ctx)
+}
+
+func (c *consulCtx) Close() error {
+	return c.consul.Close()
+}
+
+func (c *consulCtx) GlobalMetadata() torus.GlobalMetadata {
+	return c.consul.global
+}
+
+func (c *consulCtx) UUID() string {
+	return c.consul.uuid
+}
+
+func (c *consulCtx) RegisterPeer(lease int64, p *models.PeerInfo) error {
+	if lease == 0 {
+		return errors.New("no lease")
+	}
+	session, err := c.consul.LeaseSession(lease)
+	if err != nil {
+		return err
+	}
+	promOps.WithLabelValues("register-peer").Inc()
+	p.LastSeen = time.Now().UnixNano()
+	data, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	// Holding the key with the session deletes it once the session ends,
+	// as an etcd lease would.
+	ok, _, err := c.consul.Client.KV().Acquire(&api.KVPair{
+		Key:     MkKey("nodes", p.UUID),
+		Value:   data,
+		Session: session,
+	}, c.w())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return torus.ErrLeaseNotFound
+	}
+	return nil
+}
+
+func (c *consulCtx) GetPeers() (torus.PeerInfoList, error) {
+	promOps.WithLabelValues("get-peers").Inc()
+	kvs, _, err := c.consul.Client.KV().List(MkPrefix("nodes"), c.q())
+	if err != nil {
+		return nil, err
+	}
+	var out []*models.PeerInfo
+	for _, x := range kvs {
+		var p models.PeerInfo
+		err := p.Unmarshal(x.Value)
+		if err != nil {
+			// Intentionally ignore a peer that doesn't unmarshal properly.
+			clog.Errorf("peer at key %s didn't unmarshal correctly: %v", x.Key, err)
+			continue
+		}
+		if time.Since(time.Unix(0, p.LastSeen)) > peerTimeoutMax {
+			clog.Warningf("peer at key %s is still registered, but hasn't been seen in %v", x.Key, peerTimeoutMax)
+			continue
+		}
+		out = append(out, &p)
+	}
+	return torus.PeerInfoList(out), nil
+}
+
+// AtomicModifyFunc is a class of commutative functions that, given the current
+// state of a key's value `in`, returns the new state of the key `out`, and
+// `data` to be returned to the calling function on success, or an `err`.
+//
+// This function may be run multiple times, if the value has changed in the time
+// between getting the data and setting the new value.
+type AtomicModifyFunc func(in []byte) (out []byte, data interface{}, err error)
+
+func (c *consulCtx) AtomicModifyKey(key string, f AtomicModifyFunc) (interface{}, error) {
+	for {
+		kv, _, err := c.consul.Client.KV().Get(key, c.q())
+		if err != nil {
+			return nil, err
+		}
+		// A ModifyIndex of 0 only sets the key if it doesn't exist yet.
+		var index uint64
+		var value []byte
+		if kv != nil {
+			index = kv.ModifyIndex
+			value = kv.Value
+		}
+		newBytes, fval, err := f(value)
+		if err != nil {
+			return nil, err
+		}
+		ok, _, err := c.consul.Client.KV().CAS(&api.KVPair{
+			Key:         key,
+			Value:       newBytes,
+			ModifyIndex: index,
+		}, c.w())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return fval, nil
+		}
+		promAtomicRetries.WithLabelValues(key).Inc()
+	}
+}
+
+func BytesAddOne(in []byte) ([]byte, interface{}, error) {
+	var newval uint64 = 1
+	if len(in) != 0 {
+		newval = BytesToUint64(in) + 1
+	}
+	return Uint64ToBytes(newval), newval, nil
+}
+
+func (c *consulCtx) GetVolumes() ([]*models.Volume, torus.VolumeID, error) {
+	promOps.WithLabelValues("get-volumes").Inc()
+	ok, resp, err := c.txn(api.KVTxnOps{
+		{Verb: api.KVGet, Key: MkKey("meta", "volumeminter")},
+		{Verb: api.KVGetTree, Key: MkPrefix("volumeid")},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return nil, 0, torus.ErrNoGlobalMetadata
+	}
+	highwater := BytesToUint64(resp.Results[0].Value)
+	var out []*models.Volume
+	for _, x := range resp.Results[1:] {
+		v := &models.Volume{}
+		err := v.Unmarshal(x.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, v)
+	}
+	return out, torus.VolumeID(highwater), nil
+}
+
+func (c *consulCtx) GetVolume(volume string) (*models.Volume, error) {
+	c.consul.mut.Lock()
+	defer c.consul.mut.Unlock()
+	if v, ok := c.consul.volumesCache[volume]; ok {
+		return v, nil
+	}
+	kv, _, err := c.consul.Client.KV().Get(MkKey("volumes", volume), c.q())
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, torus.ErrNotExist
+	}
+	vid := BytesToUint64(kv.Value)
+	kv, _, err = c.consul.Client.KV().Get(MkKey("volumeid", Uint64ToHex(vid)), c.q())
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, fmt.Errorf("consul: volume ID %q not found", Uint64ToHex(vid))
+	}
+	v := &models.Volume{}
+	err = v.Unmarshal(kv.Value)
+	if err != nil {
+		return nil, err
+	}
+	c.consul.volumesCache[volume] = v
+	return v, nil
+}
+
+func (c *consulCtx) GetLockStatus(vid uint64) string {
+	kv, _, err := c.consul.Client.KV().Get(MkKey("volumemeta", Uint64ToHex(vid), "blocklock"), c.q())
+	if err != nil {
+		clog.Debugf("Failed to get lock status: %v", err)
+		return "unknown"
+	}
+	if kv == nil {
+		return "free"
+	}
+	return "in-use"
+}
+
+// GetLease creates a session that Consul ends, deleting the keys held with
+// it, unless renewed within sessionTTL.
+func (c *consulCtx) GetLease() (int64, error) {
+	id, _, err := c.consul.Client.Session().Create(&api.SessionEntry{
+		Name:     "torus-" + c.consul.uuid,
+		TTL:      sessionTTL,
+		Behavior: api.SessionBehaviorDelete,
+		// No node health checks: the lease only ends when it isn't renewed.
+		Checks: []string{},
+	}, c.w())
+	if err != nil {
+		return 0, err
+	}
+	c.consul.leaseMut.Lock()
+	defer c.consul.leaseMut.Unlock()
+	c.consul.lastLease++
+	c.consul.leases[c.consul.lastLease] = id
+	clog.Tracef("created new session %s for lease %d, TTL %s", id, c.consul.lastLease, sessionTTL)
+	return c.consul.lastLease, nil
+}
+
+func (c *consulCtx) RenewLease(lease int64) error {
+	id, err := c.consul.LeaseSession(lease)
+	if err != nil {
+		return err
+	}
+	se, _, err := c.consul.Client.Session().Renew(id, c.w())
+	if err != nil {
+		return err
+	}
+	if se == nil {
+		c.consul.leaseMut.Lock()
+		delete(c.consul.leases, lease)
+		c.consul.leaseMut.Unlock()
+		return torus.ErrLeaseNotFound
+	}
+	clog.Tracef("renewed session %s for lease %d, TTL %s", id, lease, se.TTL)
+	return nil
+}
+
+func (c *consulCtx) GetRing() (torus.Ring, error) {
+	r, _, err := c.getRing()
+	return r, err
+}
+
+func (c *consulCtx) getRing() (torus.Ring, uint64, error) {
+	promOps.WithLabelValues("get-ring").Inc()
+	kv, _, err := c.consul.Client.KV().Get(MkKey("meta", "the-one-ring"), c.q())
+	if err != nil {
+		return nil, 0, err
+	}
+	if kv == nil {
+		return nil, 0, torus.ErrNoGlobalMetadata
+	}
+	r, err := ring.Unmarshal(kv.Value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, kv.ModifyIndex, nil
+}
+
+func (c *consulCtx) SubscribeNewRings(ch chan torus.Ring) {
+	c.consul.SubscribeNewRings(ch)
+}
+
+func (c *consulCtx) UnsubscribeNewRings(ch chan torus.Ring) {
+	c.consul.UnsubscribeNewRings(ch)
+}
+
+func (c *consulCtx) SetRing(r torus.Ring) error {
+	oldr, index, err := c.getRing()
+	if err != nil {
+		return err
+	}
+	if oldr.Version() != r.Version()-1 {
+		return torus.ErrNonSequentialRing
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	ok, _, err := c.consul.Client.KV().CAS(&api.KVPair{
+		Key:         MkKey("meta", "the-one-ring"),
+		Value:       b,
+		ModifyIndex: index,
+	}, c.w())
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	return torus.ErrAgain
+}
+
+func (c *consulCtx) CommitINodeIndex(vid torus.VolumeID) (torus.INodeID, error) {
+	promOps.WithLabelValues("commit-inode-index").Inc()
+	c.consul.mut.Lock()
+	defer c.consul.mut.Unlock()
+	newID, err := c.AtomicModifyKey(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "inode"), BytesAddOne)
+	if err != nil {
+		return 0, err
+	}
+	return torus.INodeID(newID.(uint64)), nil
+}
+
+func (c *consulCtx) NewVolumeID() (torus.VolumeID, error) {
+	c.consul.mut.Lock()
+	defer c.consul.mut.Unlock()
+	newID, err := c.AtomicModifyKey(MkKey("meta", "volumeminter"), BytesAddOne)
+	if err != nil {
+		return 0, err
+	}
+	return torus.VolumeID(newID.(uint64)), nil
+}
+
+func (c *consulCtx) NewVolumeIDs(n int) (torus.VolumeID, error) {
+	if n <= 0 {
+		return 0, torus.ErrInvalid
+	}
+	c.consul.mut.Lock()
+	defer c.consul.mut.Unlock()
+	last, err := c.AtomicModifyKey(MkKey("meta", "volumeminter"), func(in []byte) ([]byte, interface{}, error) {
+		var newval uint64
+		if len(in) != 0 {
+			newval = BytesToUint64(in)
+		}
+		newval += uint64(n)
+		return Uint64ToBytes(newval), newval, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return torus.VolumeID(last.(uint64) - uint64(n) + 1), nil
+}
+
+func (c *consulCtx) GetINodeIndex(vid torus.VolumeID) (torus.INodeID, error) {
+	promOps.WithLabelValues("get-inode-index").Inc()
+	c.consul.mut.Lock()
+	defer c.consul.mut.Unlock()
+	kv, _, err := c.consul.Client.KV().Get(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "inode"), c.q())
+	if err != nil {
+		return torus.INodeID(0), err
+	}
+	if kv == nil {
+		return torus.INodeID(0), torus.ErrNotExist
+	}
+	return torus.INodeID(BytesToUint64(kv.Value)), nil
+}
@@ -0,0 +1,44 @@
+package consul
+
+import (
+	"io"
+	"strings"
+
+	"github.com/coreos/torus/models"
+)
+
+func (c *consulCtx) DumpMetadata(w io.Writer) error {
+	io.WriteString(w, "## Volumes\n")
+	kvs, _, err := c.consul.Client.KV().List(MkPrefix("volumeid"), c.q())
+	if err != nil {
+		return err
+	}
+	for _, x := range kvs {
+		io.WriteString(w, x.Key+":\n")
+		v := &models.Volume{}
+		v.Unmarshal(x.Value)
+		io.WriteString(w, v.String())
+		io.WriteString(w, "\n")
+	}
+	kvs, _, err = c.consul.Client.KV().List(MkPrefix("volumemeta"), c.q())
+	if err != nil {
+		return err
+	}
+	io.WriteString(w, "## INodes\n")
+	for _, x := range kvs {
+		if strings.HasSuffix(x.Key, "/inode") {
+			io.WriteString(w, x.Key+":\n")
+			io.WriteString(w, Uint64ToHex(BytesToUint64(x.Value)))
+			io.WriteString(w, "\n")
+		}
+	}
+	io.WriteString(w, "## BlockLocks\n")
+	for _, x := range kvs {
+		if strings.HasSuffix(x.Key, "/blocklock") {
+			io.WriteString(w, x.Key+":\n")
+			io.WriteString(w, string(x.Value))
+			io.WriteString(w, "\n")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package consul
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func initConsulMetadata(cfg torus.Config, gmd torus.GlobalMetadata, ringType torus.RingType) error {
+	gmdbytes, err := json.Marshal(gmd)
+	if err != nil {
+		return err
+	}
+	emptyRing, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ringType),
+		Version:           1,
+		ReplicationFactor: 2,
+	})
+	if err != nil {
+		return err
+	}
+	ringb, err := emptyRing.Marshal()
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	ok, _, _, err := client.KV().Txn(api.KVTxnOps{
+		{Verb: api.KVCheckNotExists, Key: MkKey("meta", "globalmetadata")},
+		{Verb: api.KVSet, Key: MkKey("meta", "volumeminter"), Value: Uint64ToBytes(1)},
+		{Verb: api.KVSet, Key: MkKey("meta", "globalmetadata"), Value: gmdbytes},
+		{Verb: api.KVSet, Key: MkKey("meta", "the-one-ring"), Value: ringb},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return torus.ErrExists
+	}
+	return nil
+}
+
+func wipeConsulMetadata(cfg torus.Config) error {
+	client, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = client.KV().DeleteTree(KeyPrefix, nil)
+	return err
+}
+
+func setRing(cfg torus.Config, r torus.Ring) error {
+	client, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	kv, _, err := client.KV().Get(MkKey("meta", "the-one-ring"), nil)
+	if err != nil {
+		return err
+	}
+	if kv == nil {
+		return torus.ErrNoGlobalMetadata
+	}
+	oldr, err := ring.Unmarshal(kv.Value)
+	if err != nil {
+		return err
+	}
+	if oldr.Version() != r.Version()-1 {
+		return torus.ErrNonSequentialRing
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = client.KV().Put(&api.KVPair{Key: MkKey("meta", "the-one-ring"), Value: b}, nil)
+	return err
+}
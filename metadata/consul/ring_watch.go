@@ -0,0 +1,71 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/ring"
+	"github.com/hashicorp/consul/api"
+	"golang.org/x/net/context"
+)
+
+// How long to wait before asking Consul about the ring again after an error.
+var ringWatchRetry = time.Second
+
+func (c *Consul) watchRingUpdates() error {
+	r, index, err := c.getRing()
+	if err != nil {
+		clog.Errorf("can't get inital ring: %s", err)
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopWatch = cancel
+	go c.watchRing(ctx, r, index)
+	return nil
+}
+
+// watchRing follows the ring with blocking queries, which return once the
+// key's index moves past the one given.
+func (c *Consul) watchRing(ctx context.Context, r torus.Ring, index uint64) {
+	for {
+		q := (&api.QueryOptions{WaitIndex: index}).WithContext(ctx)
+		kv, meta, err := c.Client.KV().Get(MkKey("meta", "the-one-ring"), q)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			clog.Errorf("error watching ring: %s", err)
+			time.Sleep(ringWatchRetry)
+			continue
+		}
+		if meta.LastIndex < index {
+			// The index went backwards, such as after a Consul restore;
+			// start over.
+			index = 0
+			continue
+		}
+		index = meta.LastIndex
+		if kv == nil {
+			continue
+		}
+		newRing, err := ring.Unmarshal(kv.Value)
+		if err != nil {
+			clog.Debugf("corrupted ring: %#v", kv.Value)
+			clog.Errorf("Failed to unmarshal ring: %s", err)
+			clog.Error("corrupted ring? Continuing with current ring")
+			continue
+		}
+		if newRing.Version() == r.Version() {
+			// Blocking queries can return without a change.
+			continue
+		}
+
+		clog.Infof("got new ring")
+		c.mut.RLock()
+		for _, x := range c.ringListeners {
+			x <- newRing
+		}
+		r = newRing
+		c.mut.RUnlock()
+	}
+}
@@ -0,0 +1,96 @@
+package consul
+
+import (
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/coreos/torus"
+)
+
+// txnKey returns the Consul key of a key of the transaction API, which must
+// stay under KeyPrefix.
+func txnKey(key string) (string, error) {
+	k := MkKey(key)
+	if !strings.HasPrefix(k, KeyPrefix) {
+		return "", torus.ErrInvalid
+	}
+	return k, nil
+}
+
+// GetKeys reads the keys one at a time, as a Consul transaction fails on a
+// key that doesn't exist. The version of a key is its ModifyIndex, so a Txn
+// with them still fails if any changed in between.
+func (c *consulCtx) GetKeys(keys ...string) ([]torus.MetadataKV, error) {
+	promOps.WithLabelValues("get-keys").Inc()
+	out := make([]torus.MetadataKV, len(keys))
+	for i, key := range keys {
+		k, err := txnKey(key)
+		if err != nil {
+			return nil, err
+		}
+		kv, _, err := c.consul.Client.KV().Get(k, c.q())
+		if err != nil {
+			return nil, err
+		}
+		out[i].Key = key
+		if kv != nil {
+			out[i].Value = kv.Value
+			out[i].Version = int64(kv.ModifyIndex)
+		}
+	}
+	return out, nil
+}
+
+func (c *consulCtx) ListKeys(prefix string) ([]torus.MetadataKV, error) {
+	promOps.WithLabelValues("list-keys").Inc()
+	k, err := txnKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+	kvs, _, err := c.consul.Client.KV().List(k+"/", c.q())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]torus.MetadataKV, len(kvs))
+	for i, kv := range kvs {
+		out[i] = torus.MetadataKV{
+			Key:     strings.TrimPrefix(kv.Key, KeyPrefix),
+			Value:   kv.Value,
+			Version: int64(kv.ModifyIndex),
+		}
+	}
+	return out, nil
+}
+
+func (c *consulCtx) Txn(cmps []torus.MetadataKV, ops []torus.MetadataOp) (bool, error) {
+	promOps.WithLabelValues("txn").Inc()
+	if len(cmps)+len(ops) > torus.MaxTxnOps {
+		return false, torus.ErrInvalid
+	}
+	var cops api.KVTxnOps
+	for _, cmp := range cmps {
+		k, err := txnKey(cmp.Key)
+		if err != nil {
+			return false, err
+		}
+		if cmp.Version == 0 {
+			cops = append(cops, &api.KVTxnOp{Verb: api.KVCheckNotExists, Key: k})
+		} else {
+			cops = append(cops, &api.KVTxnOp{Verb: api.KVCheckIndex, Key: k, Index: uint64(cmp.Version)})
+		}
+	}
+	for _, op := range ops {
+		k, err := txnKey(op.Key)
+		if err != nil {
+			return false, err
+		}
+		if op.Delete {
+			cops = append(cops, &api.KVTxnOp{Verb: api.KVDelete, Key: k})
+		} else {
+			cops = append(cops, &api.KVTxnOp{Verb: api.KVSet, Key: k, Value: op.Value})
+		}
+	}
+	ok, _, err := c.txn(cops)
+	return ok, err
+}
@@ -0,0 +1,51 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/torus"
+)
+
+func aclKey(vid torus.VolumeID) []byte {
+	return []byte(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "acl"))
+}
+
+func (c *etcdCtx) GetACL(vid torus.VolumeID) (torus.ACL, error) {
+	promOps.WithLabelValues("get-acl").Inc()
+	val, ok, err := c.getValue(string(aclKey(vid)))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	var acl torus.ACL
+	err = json.Unmarshal(val, &acl)
+	if err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func (c *etcdCtx) ModifyACL(vid torus.VolumeID, f func(torus.ACL) (torus.ACL, error)) error {
+	promOps.WithLabelValues("modify-acl").Inc()
+	_, err := c.AtomicModifyKey(aclKey(vid), func(in []byte) ([]byte, interface{}, error) {
+		var old torus.ACL
+		if len(in) != 0 {
+			err := json.Unmarshal(in, &old)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		acl, err := f(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := json.Marshal(acl)
+		if err != nil {
+			return nil, nil, err
+		}
+		return b, acl, nil
+	})
+	return err
+}
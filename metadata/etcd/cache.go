@@ -0,0 +1,370 @@
+package etcd
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+// cachedPrefixes are the key prefixes, under KeyPrefix, that the cache
+// mirrors: the ring and cluster settings, volumes, and each volume's inode
+// index and settings. These are read on the block path, and change rarely.
+// Peers' heartbeats and the like change too often to be worth it.
+var cachedPrefixes = map[string]bool{
+	"meta":       true,
+	"volumes":    true,
+	"volumeid":   true,
+	"volumemeta": true,
+}
+
+// volumeSettings are the keys under a volume's volumemeta that hold its
+// settings, whose changes are sent to those subscribed to them, rather than
+// its data, such as its INode index or a bucket's objects, which change all
+// the time.
+var volumeSettings = map[string]bool{
+	"acl":         true,
+	"compression": true,
+	"consistency": true,
+	"conversion":  true,
+	"dedup":       true,
+	"inode-sync":  true,
+	"keys":        true,
+	"migration":   true,
+	"qos":         true,
+	"quota":       true,
+	"read-repair": true,
+	"readahead":   true,
+	"tags":        true,
+	"tenant":      true,
+	"tiering":     true,
+}
+
+type cachedKV struct {
+	value []byte
+}
+
+// cacheSource is where the metadata cache reads and watches the prefixes it
+// mirrors: etcd, or a stand-in in tests.
+type cacheSource interface {
+	// getPrefix returns the value of every key under prefix, and the
+	// revision they were read at.
+	getPrefix(ctx context.Context, prefix string) (map[string][]byte, int64, error)
+	// watchPrefix sends the changes under prefix from revision rev on. The
+	// channel is closed once ctx is done, or after sending the error the
+	// watch failed with.
+	watchPrefix(ctx context.Context, prefix string, rev int64) <-chan cacheUpdate
+}
+
+// cacheUpdate is a batch of changes to keys under a prefix, or the error
+// that ended its watch.
+type cacheUpdate struct {
+	changes []cacheChange
+	err     error
+}
+
+// cacheChange is a key's new value, or its deletion.
+type cacheChange struct {
+	key     string
+	value   []byte
+	deleted bool
+}
+
+type etcdCacheSource struct {
+	client *etcdv3.Client
+}
+
+func (s etcdCacheSource) getPrefix(ctx context.Context, prefix string) (map[string][]byte, int64, error) {
+	resp, err := s.client.Get(ctx, prefix, etcdv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	kvs := make(map[string][]byte, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = kv.Value
+	}
+	return kvs, resp.Header.Revision, nil
+}
+
+func (s etcdCacheSource) watchPrefix(ctx context.Context, prefix string, rev int64) <-chan cacheUpdate {
+	wch := s.client.Watch(ctx, prefix, etcdv3.WithPrefix(), etcdv3.WithRev(rev))
+	out := make(chan cacheUpdate)
+	go func() {
+		defer close(out)
+		for resp := range wch {
+			u := cacheUpdate{err: resp.Err()}
+			if u.err == nil {
+				for _, ev := range resp.Events {
+					u.changes = append(u.changes, cacheChange{
+						key:     string(ev.Kv.Key),
+						value:   ev.Kv.Value,
+						deleted: ev.Type == etcdv3.EventTypeDelete,
+					})
+				}
+			}
+			select {
+			case out <- u:
+			case <-ctx.Done():
+				return
+			}
+			if u.err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// cachedPrefix is a copy of every key under a prefix, kept up to date by a
+// watch from the revision it was read at.
+type cachedPrefix struct {
+	loaded chan struct{}
+	err    error
+	kvs    map[string]cachedKV
+}
+
+// metadataCache is a read-through cache of the keys under cachedPrefixes.
+// The first read under a prefix reads all of it, and watches it from then
+// on, so that later reads are answered without a round trip to etcd. If
+// the watch fails, such as when etcd compacts past it, the prefix is
+// dropped, and read again on next use.
+//
+// Reads from the cache can lag writes, even this client's, by as long as a
+// watch event takes to arrive; anything that needs the latest value, such
+// as compare-and-swap, reads etcd directly.
+type metadataCache struct {
+	src    cacheSource
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mut      sync.RWMutex
+	prefixes map[string]*cachedPrefix
+
+	// listeners are sent the IDs of volumes whose settings change.
+	listenMut sync.RWMutex
+	listeners []chan torus.VolumeID
+}
+
+func newMetadataCache(src cacheSource) *metadataCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &metadataCache{
+		src:      src,
+		ctx:      ctx,
+		cancel:   cancel,
+		prefixes: make(map[string]*cachedPrefix),
+	}
+}
+
+func (m *metadataCache) close() {
+	m.cancel()
+}
+
+// cachedPrefixOf returns the prefix the cache would mirror key under.
+func cachedPrefixOf(key string) (string, bool) {
+	rest := strings.TrimPrefix(key, KeyPrefix)
+	if i := strings.Index(rest, "/"); i != -1 {
+		rest = rest[:i]
+	} else {
+		// The prefix itself, rather than a key under it.
+		return "", false
+	}
+	return rest, cachedPrefixes[rest]
+}
+
+func prefixRange(prefix string) string {
+	return MkKey(prefix) + "/"
+}
+
+// load returns the mirror of prefix, reading and watching it if needed.
+func (m *metadataCache) load(prefix string) (*cachedPrefix, error) {
+	m.mut.Lock()
+	p, ok := m.prefixes[prefix]
+	if ok {
+		m.mut.Unlock()
+		<-p.loaded
+		if p.err != nil {
+			return nil, p.err
+		}
+		promCacheHits.WithLabelValues(prefix).Inc()
+		return p, nil
+	}
+	p = &cachedPrefix{
+		loaded: make(chan struct{}),
+		kvs:    make(map[string]cachedKV),
+	}
+	m.prefixes[prefix] = p
+	m.mut.Unlock()
+
+	promCacheMisses.WithLabelValues(prefix).Inc()
+	kvs, rev, err := m.src.getPrefix(m.ctx, prefixRange(prefix))
+	if err != nil {
+		p.err = err
+		m.drop(prefix, p)
+		close(p.loaded)
+		return nil, err
+	}
+	for k, v := range kvs {
+		p.kvs[k] = cachedKV{value: v}
+	}
+	updates := m.src.watchPrefix(m.ctx, prefixRange(prefix), rev+1)
+	close(p.loaded)
+	go m.watch(prefix, p, updates)
+	return p, nil
+}
+
+func (m *metadataCache) watch(prefix string, p *cachedPrefix, updates <-chan cacheUpdate) {
+	defer m.drop(prefix, p)
+	for u := range updates {
+		if u.err != nil {
+			clog.Warningf("metadata cache of %s lost its watch: %v", prefix, u.err)
+			return
+		}
+		m.mut.Lock()
+		for _, c := range u.changes {
+			if c.deleted {
+				delete(p.kvs, c.key)
+				continue
+			}
+			p.kvs[c.key] = cachedKV{value: c.value}
+		}
+		m.mut.Unlock()
+		promCacheInvalidations.WithLabelValues(prefix).Add(float64(len(u.changes)))
+		if prefix == "volumemeta" {
+			m.notify(u.changes)
+		}
+	}
+}
+
+// settingOf returns the volume whose setting key is, if it's one.
+func settingOf(key string) (torus.VolumeID, bool) {
+	parts := strings.Split(strings.TrimPrefix(key, MkKey("volumemeta")+"/"), "/")
+	if len(parts) < 2 || !volumeSettings[parts[1]] {
+		return 0, false
+	}
+	vid, err := strconv.ParseUint(parts[0], 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return torus.VolumeID(vid), true
+}
+
+// notify sends the volumes whose settings changes touch to the listeners.
+func (m *metadataCache) notify(changes []cacheChange) {
+	seen := make(map[torus.VolumeID]bool)
+	m.listenMut.RLock()
+	defer m.listenMut.RUnlock()
+	for _, c := range changes {
+		vid, ok := settingOf(c.key)
+		if !ok || seen[vid] {
+			continue
+		}
+		seen[vid] = true
+		for _, l := range m.listeners {
+			l <- vid
+		}
+	}
+}
+
+// subscribe sends the IDs of volumes whose settings change on ch, and starts
+// watching them if the cache isn't already.
+func (m *metadataCache) subscribe(ch chan torus.VolumeID) {
+	m.listenMut.Lock()
+	m.listeners = append(m.listeners, ch)
+	m.listenMut.Unlock()
+	if _, err := m.load("volumemeta"); err != nil {
+		// The next read under it tries again.
+		clog.Warningf("couldn't watch volume settings: %v", err)
+	}
+}
+
+func (m *metadataCache) unsubscribe(ch chan torus.VolumeID) {
+	m.listenMut.Lock()
+	defer m.listenMut.Unlock()
+	for i, l := range m.listeners {
+		if l == ch {
+			m.listeners = append(m.listeners[:i], m.listeners[i+1:]...)
+			break
+		}
+	}
+}
+
+// drop forgets the mirror p of prefix, if it's still the current one.
+func (m *metadataCache) drop(prefix string, p *cachedPrefix) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.prefixes[prefix] == p {
+		delete(m.prefixes, prefix)
+	}
+}
+
+// get returns the value of key, whether it exists, and whether the cache
+// mirrors it at all.
+func (m *metadataCache) get(key string) (kv cachedKV, ok bool, cached bool) {
+	prefix, ok := cachedPrefixOf(key)
+	if !ok {
+		return cachedKV{}, false, false
+	}
+	p, err := m.load(prefix)
+	if err != nil {
+		return cachedKV{}, false, false
+	}
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	kv, ok = p.kvs[key]
+	return kv, ok, true
+}
+
+// list returns the values of the keys under prefix, a prefix the cache
+// mirrors or a key path under one, in the order of their keys, as etcd would
+// list them, and whether the cache could answer.
+func (m *metadataCache) list(prefix string) ([]cachedKV, bool) {
+	top, ok := cachedPrefixOf(prefix + "/")
+	if !ok {
+		return nil, false
+	}
+	p, err := m.load(top)
+	if err != nil {
+		return nil, false
+	}
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	var keys []string
+	for k := range p.kvs {
+		if strings.HasPrefix(k, prefix+"/") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := make([]cachedKV, len(keys))
+	for i, k := range keys {
+		out[i] = p.kvs[k]
+	}
+	return out, true
+}
+
+// getValue returns the value of key, and whether it exists, from the
+// metadata cache if it mirrors the key, or else from etcd.
+func (c *etcdCtx) getValue(key string) ([]byte, bool, error) {
+	if m := c.etcd.cache; m != nil {
+		if kv, ok, cached := m.get(key); cached {
+			return kv.value, ok, nil
+		}
+	}
+	return c.getUncached(key)
+}
+
+func (c *etcdCtx) getUncached(key string) ([]byte, bool, error) {
+	resp, err := c.etcd.Client.Get(c.getContext(), key)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, false, nil
+	}
+	return resp.Kvs[0].Value, true, nil
+}
@@ -0,0 +1,230 @@
+package etcd
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+// fakeSource stands in for etcd, with watches that send only what the test
+// tells them to.
+type fakeSource struct {
+	mut     sync.Mutex
+	kvs     map[string][]byte
+	rev     int64
+	gets    int
+	watches map[string]chan cacheUpdate
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		kvs:     make(map[string][]byte),
+		watches: make(map[string]chan cacheUpdate),
+	}
+}
+
+func (f *fakeSource) getPrefix(ctx context.Context, prefix string) (map[string][]byte, int64, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.gets++
+	out := make(map[string][]byte)
+	for k, v := range f.kvs {
+		if strings.HasPrefix(k, prefix) {
+			out[k] = v
+		}
+	}
+	return out, f.rev, nil
+}
+
+func (f *fakeSource) watchPrefix(ctx context.Context, prefix string, rev int64) <-chan cacheUpdate {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	ch := make(chan cacheUpdate)
+	f.watches[prefix] = ch
+	return ch
+}
+
+func (f *fakeSource) getCount() int {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.gets
+}
+
+// put changes key without telling any watch.
+func (f *fakeSource) put(key, value string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.rev++
+	f.kvs[key] = []byte(value)
+}
+
+// send delivers u to the watch of the prefix key is under, and returns once
+// the cache has applied it.
+func (f *fakeSource) send(key string, u cacheUpdate) {
+	prefix, _ := cachedPrefixOf(key)
+	f.mut.Lock()
+	ch := f.watches[prefixRange(prefix)]
+	f.mut.Unlock()
+	ch <- u
+	if u.err == nil {
+		// The cache applies one update at a time, so it's done with u
+		// once it takes another.
+		ch <- cacheUpdate{}
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func expectCached(t *testing.T, m *metadataCache, key, value string) {
+	kv, ok, cached := m.get(key)
+	if !cached {
+		t.Fatalf("expected %s to be cached", key)
+	}
+	if !ok || string(kv.value) != value {
+		t.Fatalf("expected %s to be %q, got %q (exists: %v)", key, value, kv.value, ok)
+	}
+}
+
+func TestMetadataCacheWatch(t *testing.T) {
+	src := newFakeSource()
+	key := MkKey("volumemeta", "1", "read-repair")
+	src.put(key, "always")
+	m := newMetadataCache(src)
+	defer m.close()
+
+	hits := promCacheHits.WithLabelValues("volumemeta")
+	misses := promCacheMisses.WithLabelValues("volumemeta")
+	invalidations := promCacheInvalidations.WithLabelValues("volumemeta")
+	h, mi, inv := counterValue(t, hits), counterValue(t, misses), counterValue(t, invalidations)
+
+	// The first read loads the prefix; later ones are answered from it.
+	expectCached(t, m, key, "always")
+	expectCached(t, m, key, "always")
+	if n := counterValue(t, misses) - mi; n != 1 {
+		t.Errorf("expected 1 miss, got %v", n)
+	}
+	if n := counterValue(t, hits) - h; n != 1 {
+		t.Errorf("expected 1 hit, got %v", n)
+	}
+	if src.getCount() != 1 {
+		t.Errorf("expected the prefix to be read once, got %d", src.getCount())
+	}
+
+	// A change replaces the cached value, and the old one is never served
+	// again.
+	src.put(key, "sampled")
+	src.send(key, cacheUpdate{changes: []cacheChange{{key: key, value: []byte("sampled")}}})
+	expectCached(t, m, key, "sampled")
+	if n := counterValue(t, invalidations) - inv; n != 1 {
+		t.Errorf("expected 1 invalidation, got %v", n)
+	}
+
+	// A delete removes the entry.
+	src.send(key, cacheUpdate{changes: []cacheChange{{key: key, deleted: true}}})
+	if _, ok, cached := m.get(key); !cached || ok {
+		t.Fatalf("expected %s to be gone from the cache, got exists %v cached %v", key, ok, cached)
+	}
+	if src.getCount() != 1 {
+		t.Errorf("expected every read to be answered from the cache, but the prefix was read %d times", src.getCount())
+	}
+
+	// New keys turn up in listings, in order.
+	var changes []cacheChange
+	for _, tag := range []string{"b", "a"} {
+		changes = append(changes, cacheChange{key: MkKey("volumemeta", "1", "tags", tag), value: []byte(tag)})
+	}
+	src.send(key, cacheUpdate{changes: changes})
+	kvs, ok := m.list(MkKey("volumemeta", "1", "tags"))
+	if !ok || len(kvs) != 2 || string(kvs[0].value) != "a" || string(kvs[1].value) != "b" {
+		t.Fatalf("unexpected listing %v, cached %v", kvs, ok)
+	}
+
+	// Keys that change too often aren't cached at all.
+	if _, _, cached := m.get(MkKey("nodes", "a")); cached {
+		t.Error("expected peer keys not to be cached")
+	}
+}
+
+func TestMetadataCacheLostWatch(t *testing.T) {
+	src := newFakeSource()
+	key := MkKey("meta", "capacity-reserve")
+	src.put(key, "10")
+	m := newMetadataCache(src)
+	defer m.close()
+	misses := promCacheMisses.WithLabelValues("meta")
+	mi := counterValue(t, misses)
+
+	expectCached(t, m, key, "10")
+	// A change the watch never reports, as when etcd compacts past it.
+	src.put(key, "20")
+	src.send(key, cacheUpdate{err: errors.New("compacted")})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mut.RLock()
+		_, loaded := m.prefixes["meta"]
+		m.mut.RUnlock()
+		if !loaded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the prefix to be dropped once its watch failed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The prefix is read again rather than served stale.
+	expectCached(t, m, key, "20")
+	if src.getCount() != 2 {
+		t.Errorf("expected the prefix to be read again, got %d reads", src.getCount())
+	}
+	if n := counterValue(t, misses) - mi; n != 2 {
+		t.Errorf("expected 2 misses, got %v", n)
+	}
+}
+
+func TestMetadataCacheVolumeChanges(t *testing.T) {
+	src := newFakeSource()
+	m := newMetadataCache(src)
+	defer m.close()
+	ch := make(chan torus.VolumeID, 8)
+	m.subscribe(ch)
+	if src.getCount() != 1 {
+		t.Fatalf("expected subscribing to load volume settings, got %d reads", src.getCount())
+	}
+
+	// Each volume whose settings change is sent once, and changes to its
+	// data aren't sent at all.
+	key := MkKey("volumemeta", "1", "read-repair")
+	src.send(key, cacheUpdate{changes: []cacheChange{
+		{key: key, value: []byte("always")},
+		{key: MkKey("volumemeta", "2", "inode"), value: []byte("3")},
+		{key: MkKey("volumemeta", "1a", "tags", "a"), value: []byte("a")},
+		{key: MkKey("volumemeta", "1a", "acl"), deleted: true},
+	}})
+	var got []torus.VolumeID
+	for len(ch) > 0 {
+		got = append(got, <-ch)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 0x1a {
+		t.Errorf("expected volumes [1 26] to be sent, got %v", got)
+	}
+
+	m.unsubscribe(ch)
+	src.send(key, cacheUpdate{changes: []cacheChange{{key: key, value: []byte("off")}}})
+	if len(ch) != 0 {
+		t.Errorf("expected nothing to be sent once unsubscribed, got %d", len(ch))
+	}
+}
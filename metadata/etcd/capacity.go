@@ -0,0 +1,70 @@
+package etcd
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/coreos/torus"
+)
+
+func (c *etcdCtx) GetCapacityReserve() (torus.CapacityReserve, error) {
+	var r torus.CapacityReserve
+	val, ok, err := c.getValue(MkKey("meta", "capacity-reserve"))
+	if err != nil || !ok {
+		return r, err
+	}
+	err = json.Unmarshal(val, &r)
+	return r, err
+}
+
+func (c *etcdCtx) SetCapacityReserve(r torus.CapacityReserve) error {
+	promOps.WithLabelValues("set-capacity-reserve").Inc()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), MkKey("meta", "capacity-reserve"), string(data))
+	return err
+}
+
+func volumeQuotaKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "quota")
+}
+
+func (c *etcdCtx) GetVolumeQuota(vid torus.VolumeID) (uint64, error) {
+	promOps.WithLabelValues("get-volume-quota").Inc()
+	return c.getQuota(volumeQuotaKey(vid))
+}
+
+func (c *etcdCtx) SetVolumeQuota(vid torus.VolumeID, quota uint64) error {
+	promOps.WithLabelValues("set-volume-quota").Inc()
+	return c.setQuota(volumeQuotaKey(vid), quota)
+}
+
+func (c *etcdCtx) GetDefaultVolumeQuota() (uint64, error) {
+	promOps.WithLabelValues("get-default-volume-quota").Inc()
+	return c.getQuota(MkKey("meta", "volume-quota"))
+}
+
+func (c *etcdCtx) SetDefaultVolumeQuota(quota uint64) error {
+	promOps.WithLabelValues("set-default-volume-quota").Inc()
+	return c.setQuota(MkKey("meta", "volume-quota"), quota)
+}
+
+func (c *etcdCtx) getQuota(key string) (uint64, error) {
+	val, ok, err := c.getValue(key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return strconv.ParseUint(string(val), 10, 64)
+}
+
+func (c *etcdCtx) setQuota(key string, quota uint64) error {
+	var err error
+	if quota == 0 {
+		_, err = c.etcd.Client.Delete(c.getContext(), key)
+	} else {
+		_, err = c.etcd.Client.Put(c.getContext(), key, strconv.FormatUint(quota, 10))
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package etcd
+
+import (
+	"github.com/coreos/torus"
+)
+
+func compressionKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "compression")
+}
+
+func (c *etcdCtx) GetCompression(vid torus.VolumeID) (bool, error) {
+	promOps.WithLabelValues("get-compression").Inc()
+	val, ok, err := c.getValue(compressionKey(vid))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+	return string(val) == "zstd", nil
+}
+
+func (c *etcdCtx) SetCompression(vid torus.VolumeID, on bool) error {
+	promOps.WithLabelValues("set-compression").Inc()
+	if !on {
+		_, err := c.etcd.Client.Delete(c.getContext(), compressionKey(vid))
+		return err
+	}
+	_, err := c.etcd.Client.Put(c.getContext(), compressionKey(vid), "zstd")
+	return err
+}
@@ -0,0 +1,31 @@
+package etcd
+
+import (
+	"github.com/coreos/torus"
+)
+
+func consistencyKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "consistency")
+}
+
+func (c *etcdCtx) GetConsistency(vid torus.VolumeID) (*torus.Consistency, error) {
+	promOps.WithLabelValues("get-consistency").Inc()
+	val, ok, err := c.getValue(consistencyKey(vid))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return torus.ParseConsistency(string(val))
+}
+
+func (c *etcdCtx) SetConsistency(vid torus.VolumeID, cons *torus.Consistency) error {
+	promOps.WithLabelValues("set-consistency").Inc()
+	if cons == nil {
+		_, err := c.etcd.Client.Delete(c.getContext(), consistencyKey(vid))
+		return err
+	}
+	_, err := c.etcd.Client.Put(c.getContext(), consistencyKey(vid), cons.String())
+	return err
+}
@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/torus"
+)
+
+func conversionKey(vid torus.VolumeID) []byte {
+	return []byte(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "conversion"))
+}
+
+func (c *etcdCtx) GetConversion(vid torus.VolumeID) (*torus.Conversion, error) {
+	promOps.WithLabelValues("get-conversion").Inc()
+	val, ok, err := c.getValue(string(conversionKey(vid)))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	var conv torus.Conversion
+	err = json.Unmarshal(val, &conv)
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (c *etcdCtx) ModifyConversion(vid torus.VolumeID, f func(*torus.Conversion) (*torus.Conversion, error)) (*torus.Conversion, error) {
+	promOps.WithLabelValues("modify-conversion").Inc()
+	v, err := c.AtomicModifyKey(conversionKey(vid), func(in []byte) ([]byte, interface{}, error) {
+		var old *torus.Conversion
+		if len(in) != 0 {
+			old = &torus.Conversion{}
+			err := json.Unmarshal(in, old)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		conv, err := f(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := json.Marshal(conv)
+		if err != nil {
+			return nil, nil, err
+		}
+		return b, conv, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*torus.Conversion), nil
+}
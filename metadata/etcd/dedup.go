@@ -0,0 +1,25 @@
+package etcd
+
+import (
+	"github.com/coreos/torus"
+)
+
+func dedupKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "dedup")
+}
+
+func (c *etcdCtx) GetDedup(vid torus.VolumeID) (bool, error) {
+	promOps.WithLabelValues("get-dedup").Inc()
+	_, ok, err := c.getValue(dedupKey(vid))
+	return ok, err
+}
+
+func (c *etcdCtx) SetDedup(vid torus.VolumeID, on bool) error {
+	promOps.WithLabelValues("set-dedup").Inc()
+	if !on {
+		_, err := c.etcd.Client.Delete(c.getContext(), dedupKey(vid))
+		return err
+	}
+	_, err := c.etcd.Client.Put(c.getContext(), dedupKey(vid), "on")
+	return err
+}
@@ -0,0 +1,67 @@
+package etcd
+
+import (
+	"encoding/json"
+	"time"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+)
+
+func (c *etcdCtx) AnnounceDeparture(d *torus.Departure) error {
+	promOps.WithLabelValues("announce-departure").Inc()
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	// The departure gets a lease of its own, so that it goes away by itself
+	// if the peer never comes back to clear it.
+	ttl := int64(time.Duration(d.Until-time.Now().UnixNano())/time.Second) + 1
+	if ttl < leaseTTL {
+		ttl = leaseTTL
+	}
+	resp, err := c.etcd.Client.Grant(c.getContext(), ttl)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), MkKey("departures", c.etcd.uuid), string(data), etcdv3.WithLease(resp.ID))
+	return err
+}
+
+func (c *etcdCtx) ClearDeparture() error {
+	promOps.WithLabelValues("clear-departure").Inc()
+	_, err := c.etcd.Client.Delete(c.getContext(), MkKey("departures", c.etcd.uuid))
+	return err
+}
+
+func (c *etcdCtx) GetDepartures() ([]*torus.Departure, error) {
+	promOps.WithLabelValues("get-departures").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("departures"), etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []*torus.Departure
+	for _, x := range resp.Kvs {
+		var d torus.Departure
+		err := json.Unmarshal(x.Value, &d)
+		if err != nil {
+			clog.Errorf("departure at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		if d.Expired() {
+			continue
+		}
+		out = append(out, &d)
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) DeregisterPeer(lease int64) error {
+	promOps.WithLabelValues("deregister-peer").Inc()
+	if lease == 0 {
+		return nil
+	}
+	_, err := c.etcd.Client.Revoke(c.getContext(), etcdv3.LeaseID(lease))
+	return err
+}
@@ -0,0 +1,35 @@
+package etcd
+
+import (
+	"path"
+	"strconv"
+	"time"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+)
+
+func (c *etcdCtx) SetDraining(uuid string, draining bool) error {
+	promOps.WithLabelValues("set-draining").Inc()
+	key := MkKey("draining", uuid)
+	if !draining {
+		_, err := c.etcd.Client.Delete(c.getContext(), key)
+		return err
+	}
+	// The value is when draining began, for anyone looking at etcd.
+	since := strconv.FormatInt(time.Now().UnixNano(), 10)
+	_, err := c.etcd.Client.Put(c.getContext(), key, since)
+	return err
+}
+
+func (c *etcdCtx) GetDraining() ([]string, error) {
+	promOps.WithLabelValues("get-draining").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("draining")+"/", etcdv3.WithPrefix(), etcdv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, kv := range resp.Kvs {
+		out = append(out, path.Base(string(kv.Key)))
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package etcd
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+// How often StartEmbedded says it's still waiting for the other members.
+var embeddedWaitLog = 10 * time.Second
+
+// EmbeddedConfig is the configuration of an etcd member run inside a torus
+// process, so that a small cluster can keep its metadata without an etcd
+// cluster of its own.
+type EmbeddedConfig struct {
+	// Name names this member among the others.
+	Name string
+	// Dir is where the member keeps its data.
+	Dir string
+	// ClientURL is where the member serves clients, such as torusctl.
+	ClientURL url.URL
+	// PeerURL is where the member talks Raft with the others.
+	PeerURL url.URL
+	// InitialCluster lists every member of a new cluster as NAME=PEER_URL,
+	// separated by commas. If empty, this member starts a cluster of its
+	// own.
+	InitialCluster string
+	// Join adds the member to a running cluster, rather than starting a new
+	// one. The cluster must already have it as a member, such as with
+	// `etcdctl member add`, and InitialCluster must list the members once
+	// it's added.
+	Join bool
+}
+
+// Embedded is an etcd member running in this process.
+type Embedded struct {
+	etcd *embed.Etcd
+}
+
+// StartEmbedded starts an etcd member, and returns once it has joined a
+// quorum of the cluster and can serve requests.
+func StartEmbedded(cfg EmbeddedConfig) (*Embedded, error) {
+	ecfg := embed.NewConfig()
+	ecfg.Name = cfg.Name
+	ecfg.Dir = cfg.Dir
+	ecfg.LCUrls = []url.URL{cfg.ClientURL}
+	ecfg.ACUrls = []url.URL{cfg.ClientURL}
+	ecfg.LPUrls = []url.URL{cfg.PeerURL}
+	ecfg.APUrls = []url.URL{cfg.PeerURL}
+	ecfg.InitialCluster = cfg.InitialCluster
+	if ecfg.InitialCluster == "" {
+		ecfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, cfg.PeerURL.String())
+	}
+	ecfg.InitialClusterToken = "torus"
+	ecfg.ClusterState = embed.ClusterStateFlagNew
+	if cfg.Join {
+		ecfg.ClusterState = embed.ClusterStateFlagExisting
+	}
+
+	e, err := embed.StartEtcd(ecfg)
+	if err != nil {
+		return nil, err
+	}
+	tick := time.NewTicker(embeddedWaitLog)
+	defer tick.Stop()
+	for {
+		select {
+		case <-e.Server.ReadyNotify():
+			clog.Infof("embedded metadata member %s is ready, serving clients on %s", cfg.Name, cfg.ClientURL.String())
+			return &Embedded{etcd: e}, nil
+		case err := <-e.Err():
+			e.Close()
+			return nil, err
+		case <-tick.C:
+			clog.Infof("embedded metadata member %s is waiting for a quorum of %s", cfg.Name, ecfg.InitialCluster)
+		}
+	}
+}
+
+// Err returns a channel that gets the error the member fails with, if it
+// does.
+func (e *Embedded) Err() <-chan error {
+	return e.etcd.Err()
+}
+
+// Close stops the member.
+func (e *Embedded) Close() {
+	e.etcd.Close()
+}
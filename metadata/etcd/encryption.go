@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/torus"
+)
+
+func volumeKeysKey(vid torus.VolumeID) []byte {
+	return []byte(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "keys"))
+}
+
+func (c *etcdCtx) GetVolumeKeys(vid torus.VolumeID) (*torus.VolumeKeys, error) {
+	promOps.WithLabelValues("get-volume-keys").Inc()
+	val, ok, err := c.getValue(string(volumeKeysKey(vid)))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	var vk torus.VolumeKeys
+	err = json.Unmarshal(val, &vk)
+	if err != nil {
+		return nil, err
+	}
+	return &vk, nil
+}
+
+func (c *etcdCtx) ModifyVolumeKeys(vid torus.VolumeID, f func(*torus.VolumeKeys) (*torus.VolumeKeys, error)) (*torus.VolumeKeys, error) {
+	promOps.WithLabelValues("modify-volume-keys").Inc()
+	v, err := c.AtomicModifyKey(volumeKeysKey(vid), func(in []byte) ([]byte, interface{}, error) {
+		var old *torus.VolumeKeys
+		if len(in) != 0 {
+			old = &torus.VolumeKeys{}
+			err := json.Unmarshal(in, old)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		vk, err := f(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := json.Marshal(vk)
+		if err != nil {
+			return nil, nil, err
+		}
+		return b, vk, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*torus.VolumeKeys), nil
+}
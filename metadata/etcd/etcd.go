@@ -39,16 +39,33 @@ var (
 		Name: "torus_etcd_base_ops_total",
 		Help: "Number of times an atomic update failed and needed to be retried",
 	}, []string{"kind"})
+	promCacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_etcd_cache_hits_total",
+		Help: "Number of metadata reads answered from the metadata cache",
+	}, []string{"prefix"})
+	promCacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_etcd_cache_misses_total",
+		Help: "Number of metadata reads that had to load a prefix into the metadata cache",
+	}, []string{"prefix"})
+	promCacheInvalidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_etcd_cache_invalidations_total",
+		Help: "Number of keys updated in the metadata cache by watch events",
+	}, []string{"prefix"})
 )
 
 func init() {
-	torus.RegisterMetadataService("etcd", newEtcdMetadata)
-	torus.RegisterMetadataInit("etcd", initEtcdMetadata)
-	torus.RegisterMetadataWipe("etcd", wipeEtcdMetadata)
-	torus.RegisterSetRing("etcd", setRing)
+	torus.RegisterMetadataProvider("etcd", torus.MetadataProvider{
+		Create:  newEtcdMetadata,
+		Init:    initEtcdMetadata,
+		Wipe:    wipeEtcdMetadata,
+		SetRing: setRing,
+	})
 
 	prometheus.MustRegister(promAtomicRetries)
 	prometheus.MustRegister(promOps)
+	prometheus.MustRegister(promCacheHits)
+	prometheus.MustRegister(promCacheMisses)
+	prometheus.MustRegister(promCacheInvalidations)
 }
 
 type etcdCtx struct {
@@ -62,6 +79,8 @@ type Etcd struct {
 	cfg          torus.Config
 	global       torus.GlobalMetadata
 	volumesCache map[string]*models.Volume
+	// cache mirrors hot keys, if cfg.MetadataCache is set.
+	cache *metadataCache
 
 	ringListeners []chan torus.Ring
 
@@ -82,7 +101,7 @@ func newEtcdMetadata(cfg torus.Config) (torus.MetadataService, error) {
 		return nil, err
 	}
 
-	v3cfg := etcdv3.Config{Endpoints: []string{cfg.MetadataAddress}, TLS: cfg.TLS}
+	v3cfg := etcdv3.Config{Endpoints: Endpoints(cfg.MetadataAddress), TLS: cfg.TLS}
 	client, err := etcdv3.New(v3cfg)
 	if err != nil {
 		return nil, err
@@ -98,6 +117,9 @@ func newEtcdMetadata(cfg torus.Config) (torus.MetadataService, error) {
 	// directly (with a nil context) or, create another reference using
 	// WithContext(), below.
 	e.etcdCtx.etcd = e
+	if cfg.MetadataCache {
+		e.cache = newMetadataCache(etcdCacheSource{client})
+	}
 	err = e.getGlobalMetadata()
 	if err != nil {
 		return nil, err
@@ -116,6 +138,9 @@ func (e *Etcd) Close() error {
 	for _, l := range e.ringListeners {
 		close(l)
 	}
+	if e.cache != nil {
+		e.cache.close()
+	}
 	return e.Client.Close()
 }
 
@@ -165,6 +190,20 @@ func (e *Etcd) UnsubscribeNewRings(ch chan torus.Ring) {
 	}
 }
 
+func (e *Etcd) SubscribeVolumeChanges(ch chan torus.VolumeID) error {
+	if e.cache == nil {
+		return torus.ErrNotSupported
+	}
+	e.cache.subscribe(ch)
+	return nil
+}
+
+func (e *Etcd) UnsubscribeVolumeChanges(ch chan torus.VolumeID) {
+	if e.cache != nil {
+		e.cache.unsubscribe(ch)
+	}
+}
+
 // Context-sensitive calls
 
 func (c *etcdCtx) getContext() context.Context {
@@ -289,6 +328,22 @@ func BytesAddOne(in []byte) ([]byte, interface{}, error) {
 
 func (c *etcdCtx) GetVolumes() ([]*models.Volume, torus.VolumeID, error) {
 	promOps.WithLabelValues("get-volumes").Inc()
+	if m := c.etcd.cache; m != nil {
+		minter, ok, _ := m.get(MkKey("meta", "volumeminter"))
+		list, listed := m.list(MkKey("volumeid"))
+		if ok && listed {
+			var out []*models.Volume
+			for _, x := range list {
+				v := &models.Volume{}
+				err := v.Unmarshal(x.value)
+				if err != nil {
+					return nil, 0, err
+				}
+				out = append(out, v)
+			}
+			return out, torus.VolumeID(BytesToUint64(minter.value)), nil
+		}
+	}
 	txn := c.etcd.Client.Txn(c.getContext()).Then(
 		etcdv3.OpGet(MkKey("meta", "volumeminter")),
 		etcdv3.OpGet(MkKey("volumeid"), etcdv3.WithPrefix()),
@@ -312,6 +367,9 @@ func (c *etcdCtx) GetVolumes() ([]*models.Volume, torus.VolumeID, error) {
 }
 
 func (c *etcdCtx) GetVolume(volume string) (*models.Volume, error) {
+	if c.etcd.cache != nil {
+		return c.getCachedVolume(volume)
+	}
 	if v, ok := c.etcd.volumesCache[volume]; ok {
 		return v, nil
 	}
@@ -322,8 +380,7 @@ func (c *etcdCtx) GetVolume(volume string) (*models.Volume, error) {
 		return nil, err
 	}
 	if len(resp.Kvs) == 0 {
-		return nil, errors.New(fmt.Sprintf("etcd: volume %q not found", volume))
-
+		return nil, torus.ErrNotExist
 	}
 	vid := BytesToUint64(resp.Kvs[0].Value)
 	resp, err = c.etcd.Client.Get(c.getContext(), MkKey("volumeid", Uint64ToHex(vid)))
@@ -343,16 +400,73 @@ func (c *etcdCtx) GetVolume(volume string) (*models.Volume, error) {
 	return v, nil
 }
 
+// getCachedVolume is GetVolume through the metadata cache, which, unlike
+// volumesCache, sees volumes deleted or changed by other clients. Names the
+// cache doesn't have yet are looked up in etcd, so that a volume can be
+// opened as soon as it's created.
+func (c *etcdCtx) getCachedVolume(volume string) (*models.Volume, error) {
+	b, ok, err := c.getValue(MkKey("volumes", volume))
+	if err == nil && !ok {
+		b, ok, err = c.getUncached(MkKey("volumes", volume))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	vid := BytesToUint64(b)
+	b, ok, err = c.getValue(MkKey("volumeid", Uint64ToHex(vid)))
+	if err == nil && !ok {
+		b, ok, err = c.getUncached(MkKey("volumeid", Uint64ToHex(vid)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("etcd: volume ID %q not found", Uint64ToHex(vid)))
+	}
+	v := &models.Volume{}
+	err = v.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
 func (c *etcdCtx) GetLockStatus(vid uint64) string {
-	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("volumemeta", Uint64ToHex(uint64(vid)), "blocklock"))
+	_, ok, err := c.getValue(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "blocklock"))
 	if err != nil {
 		clog.Debugf("Failed to get lock status: %v", err)
 		return "unknown"
 	}
+	if ok {
+		return "in-use"
+	}
+	// Shared block volumes have a key for each attachment instead.
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("volumemeta", Uint64ToHex(uint64(vid)), "sharers")+"/", etcdv3.WithPrefix(), etcdv3.WithCountOnly())
+	if err != nil {
+		clog.Debugf("Failed to get lock status: %v", err)
+		return "unknown"
+	}
+	if resp.Count != 0 {
+		return "in-use"
+	}
+	return "free"
+}
+
+// GetAttachEpoch returns the revision that took the volume's attachment,
+// which is its epoch.
+func (c *etcdCtx) GetAttachEpoch(vid torus.VolumeID) (uint64, error) {
+	promOps.WithLabelValues("get-attach-epoch").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("volumemeta", Uint64ToHex(uint64(vid)), "blocklock"))
+	if err != nil {
+		return 0, err
+	}
 	if len(resp.Kvs) == 0 {
-		return "free"
+		return 0, nil
 	}
-	return "in-use"
+	return uint64(resp.Kvs[0].ModRevision), nil
 }
 
 func (c *etcdCtx) GetLease() (int64, error) {
@@ -377,9 +491,23 @@ func (c *etcdCtx) RenewLease(lease int64) error {
 	return nil
 }
 func (c *etcdCtx) GetRing() (torus.Ring, error) {
-	r, _, err := c.getRing()
-	return r, err
+	if c.etcd.cache == nil {
+		r, _, err := c.getRing()
+		return r, err
+	}
+	promOps.WithLabelValues("get-ring").Inc()
+	b, ok, err := c.getValue(MkKey("meta", "the-one-ring"))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, torus.ErrNoGlobalMetadata
+	}
+	return ring.Unmarshal(b)
 }
+
+// getRing reads the ring, and the version of its key, from etcd rather than
+// the cache, to swap it for another.
 func (c *etcdCtx) getRing() (torus.Ring, int64, error) {
 	promOps.WithLabelValues("get-ring").Inc()
 	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("meta", "the-one-ring"))
@@ -404,6 +532,14 @@ func (c *etcdCtx) UnsubscribeNewRings(ch chan torus.Ring) {
 	c.etcd.UnsubscribeNewRings(ch)
 }
 
+func (c *etcdCtx) SubscribeVolumeChanges(ch chan torus.VolumeID) error {
+	return c.etcd.SubscribeVolumeChanges(ch)
+}
+
+func (c *etcdCtx) UnsubscribeVolumeChanges(ch chan torus.VolumeID) {
+	c.etcd.UnsubscribeVolumeChanges(ch)
+}
+
 func (c *etcdCtx) SetRing(ring torus.Ring) error {
 	oldr, etcdver, err := c.getRing()
 	if err != nil {
@@ -455,17 +591,32 @@ func (c *etcdCtx) NewVolumeID() (torus.VolumeID, error) {
 	return torus.VolumeID(newID.(uint64)), nil
 }
 
-func (c *etcdCtx) GetINodeIndex(vid torus.VolumeID) (torus.INodeID, error) {
-	promOps.WithLabelValues("get-inode-index").Inc()
+func (c *etcdCtx) NewVolumeIDs(n int) (torus.VolumeID, error) {
+	if n <= 0 {
+		return 0, torus.ErrInvalid
+	}
 	c.etcd.mut.Lock()
 	defer c.etcd.mut.Unlock()
-	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("volumemeta", Uint64ToHex(uint64(vid)), "inode"))
+	k := []byte(MkKey("meta", "volumeminter"))
+	last, err := c.AtomicModifyKey(k, func(in []byte) ([]byte, interface{}, error) {
+		newval := BytesToUint64(in) + uint64(n)
+		return Uint64ToBytes(newval), newval, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return torus.VolumeID(last.(uint64) - uint64(n) + 1), nil
+}
+
+func (c *etcdCtx) GetINodeIndex(vid torus.VolumeID) (torus.INodeID, error) {
+	promOps.WithLabelValues("get-inode-index").Inc()
+	b, ok, err := c.getValue(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "inode"))
 	if err != nil {
 		return torus.INodeID(0), err
 	}
-	if len(resp.Kvs) != 1 {
+	if !ok {
 		return torus.INodeID(0), torus.ErrNotExist
 	}
-	id := BytesToUint64(resp.Kvs[0].Value)
+	id := BytesToUint64(b)
 	return torus.INodeID(id), nil
 }
@@ -0,0 +1,127 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+)
+
+// fsckBlock and fsckReport are the stored forms of a torus.FsckBlock and
+// torus.FsckReport.
+type fsckBlock struct {
+	Ref     []byte `json:"ref"`
+	Problem string `json:"problem"`
+	Peer    string `json:"peer,omitempty"`
+	Fixed   bool   `json:"fixed"`
+}
+
+type fsckReport struct {
+	Peer      string      `json:"peer"`
+	Requested int64       `json:"requested"`
+	Finished  int64       `json:"finished"`
+	Checked   uint64      `json:"checked"`
+	Orphans   uint64      `json:"orphans"`
+	Misplaced uint64      `json:"misplaced"`
+	Missing   uint64      `json:"missing"`
+	Fixed     uint64      `json:"fixed"`
+	Blocks    []fsckBlock `json:"blocks"`
+	Errors    []string    `json:"errors"`
+}
+
+type fsckRequest struct {
+	Requested int64 `json:"requested"`
+	Fix       bool  `json:"fix"`
+}
+
+func (c *etcdCtx) RequestFsck(req torus.FsckRequest) error {
+	promOps.WithLabelValues("request-fsck").Inc()
+	data, err := json.Marshal(fsckRequest{Requested: req.Requested, Fix: req.Fix})
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), MkKey("meta", "fsck-request"), string(data))
+	return err
+}
+
+func (c *etcdCtx) GetFsckRequest() (torus.FsckRequest, error) {
+	promOps.WithLabelValues("get-fsck-request").Inc()
+	val, ok, err := c.getValue(MkKey("meta", "fsck-request"))
+	if err != nil || !ok {
+		return torus.FsckRequest{}, err
+	}
+	var req fsckRequest
+	err = json.Unmarshal(val, &req)
+	return torus.FsckRequest{Requested: req.Requested, Fix: req.Fix}, err
+}
+
+func (c *etcdCtx) SaveFsckReport(r *torus.FsckReport) error {
+	promOps.WithLabelValues("save-fsck-report").Inc()
+	s := fsckReport{
+		Peer:      r.Peer,
+		Requested: r.Requested,
+		Finished:  r.Finished,
+		Checked:   r.Checked,
+		Orphans:   r.Orphans,
+		Misplaced: r.Misplaced,
+		Missing:   r.Missing,
+		Fixed:     r.Fixed,
+		Errors:    r.Errors,
+	}
+	for _, b := range r.Blocks {
+		s.Blocks = append(s.Blocks, fsckBlock{
+			Ref:     b.Ref.ToBytes(),
+			Problem: b.Problem,
+			Peer:    b.Peer,
+			Fixed:   b.Fixed,
+		})
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), MkKey("fsck", c.etcd.uuid), string(data))
+	return err
+}
+
+func (c *etcdCtx) GetFsckReports() ([]*torus.FsckReport, error) {
+	promOps.WithLabelValues("get-fsck-reports").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("fsck"), etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []*torus.FsckReport
+	for _, x := range resp.Kvs {
+		var s fsckReport
+		err := json.Unmarshal(x.Value, &s)
+		if err != nil {
+			clog.Errorf("fsck report at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		r := &torus.FsckReport{
+			Peer:      s.Peer,
+			Requested: s.Requested,
+			Finished:  s.Finished,
+			Checked:   s.Checked,
+			Orphans:   s.Orphans,
+			Misplaced: s.Misplaced,
+			Missing:   s.Missing,
+			Fixed:     s.Fixed,
+			Errors:    s.Errors,
+		}
+		for _, b := range s.Blocks {
+			if len(b.Ref) != torus.BlockRefByteSize {
+				continue
+			}
+			r.Blocks = append(r.Blocks, torus.FsckBlock{
+				Ref:     torus.BlockRefFromBytes(b.Ref),
+				Problem: b.Problem,
+				Peer:    b.Peer,
+				Fixed:   b.Fixed,
+			})
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
@@ -0,0 +1,104 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+)
+
+// gcStatus is the stored form of a torus.GCStatus.
+type gcStatus struct {
+	Peer       string `json:"peer"`
+	Generation uint64 `json:"generation"`
+	Marking    bool   `json:"marking"`
+	Sweeping   bool   `json:"sweeping"`
+	Last       []byte `json:"last"`
+	Swept      uint64 `json:"swept"`
+	Total      uint64 `json:"total"`
+	PassStart  int64  `json:"pass_start"`
+	PassFinish int64  `json:"pass_finish"`
+	Reclaimed  uint64 `json:"reclaimed"`
+	BytesFreed uint64 `json:"bytes_freed"`
+	Saved      int64  `json:"saved"`
+}
+
+func unmarshalGCStatus(data []byte) (*torus.GCStatus, error) {
+	var s gcStatus
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Last) != torus.BlockRefByteSize {
+		return nil, torus.ErrInvalid
+	}
+	return &torus.GCStatus{
+		Peer:       s.Peer,
+		Generation: s.Generation,
+		Marking:    s.Marking,
+		Sweeping:   s.Sweeping,
+		Last:       torus.BlockRefFromBytes(s.Last),
+		Swept:      s.Swept,
+		Total:      s.Total,
+		PassStart:  s.PassStart,
+		PassFinish: s.PassFinish,
+		Reclaimed:  s.Reclaimed,
+		BytesFreed: s.BytesFreed,
+		Saved:      s.Saved,
+	}, nil
+}
+
+func (c *etcdCtx) SaveGCStatus(s *torus.GCStatus) error {
+	promOps.WithLabelValues("save-gc-status").Inc()
+	data, err := json.Marshal(gcStatus{
+		Peer:       s.Peer,
+		Generation: s.Generation,
+		Marking:    s.Marking,
+		Sweeping:   s.Sweeping,
+		Last:       s.Last.ToBytes(),
+		Swept:      s.Swept,
+		Total:      s.Total,
+		PassStart:  s.PassStart,
+		PassFinish: s.PassFinish,
+		Reclaimed:  s.Reclaimed,
+		BytesFreed: s.BytesFreed,
+		Saved:      s.Saved,
+	})
+	if err != nil {
+		return err
+	}
+	// Not tied to the lease: the status is for after the peer restarts.
+	_, err = c.etcd.Client.Put(c.getContext(), MkKey("gc-status", c.etcd.uuid), string(data))
+	return err
+}
+
+func (c *etcdCtx) GetGCStatus() (*torus.GCStatus, error) {
+	promOps.WithLabelValues("get-gc-status").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("gc-status", c.etcd.uuid))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return unmarshalGCStatus(resp.Kvs[0].Value)
+}
+
+func (c *etcdCtx) GetGCStatuses() ([]*torus.GCStatus, error) {
+	promOps.WithLabelValues("get-gc-statuses").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("gc-status"), etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []*torus.GCStatus
+	for _, x := range resp.Kvs {
+		s, err := unmarshalGCStatus(x.Value)
+		if err != nil {
+			clog.Errorf("gc status at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"path"
+	"strings"
 )
 
 func MkKey(s ...string) string {
@@ -12,6 +13,18 @@ func MkKey(s ...string) string {
 	return path.Join(s...)
 }
 
+// Endpoints returns the etcd endpoints of a metadata address, which may list
+// several, separated by commas.
+func Endpoints(addr string) []string {
+	var out []string
+	for _, ep := range strings.Split(addr, ",") {
+		if ep = strings.TrimSpace(ep); ep != "" {
+			out = append(out, ep)
+		}
+	}
+	return out
+}
+
 func Uint64ToBytes(x uint64) []byte {
 	buf := new(bytes.Buffer)
 	err := binary.Write(buf, binary.LittleEndian, x)
@@ -0,0 +1,27 @@
+package etcd
+
+import (
+	"github.com/coreos/torus"
+)
+
+func inodeSyncKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "inode-sync")
+}
+
+func (c *etcdCtx) GetINodeSync(vid torus.VolumeID) (torus.INodeSyncPolicy, error) {
+	promOps.WithLabelValues("get-inode-sync").Inc()
+	val, ok, err := c.getValue(inodeSyncKey(vid))
+	if err != nil {
+		return torus.INodeSyncPolicy{}, err
+	}
+	if !ok {
+		return torus.INodeSyncPolicy{}, nil
+	}
+	return torus.ParseINodeSyncPolicy(string(val))
+}
+
+func (c *etcdCtx) SetINodeSync(vid torus.VolumeID, p torus.INodeSyncPolicy) error {
+	promOps.WithLabelValues("set-inode-sync").Inc()
+	_, err := c.etcd.Client.Put(c.getContext(), inodeSyncKey(vid), p.String())
+	return err
+}
@@ -0,0 +1,24 @@
+package etcd
+
+func (c *etcdCtx) SetJoinTokenHash(hash []byte) error {
+	promOps.WithLabelValues("set-join-token").Inc()
+	key := MkKey("meta", "join-token")
+	if hash == nil {
+		_, err := c.etcd.Client.Delete(c.getContext(), key)
+		return err
+	}
+	_, err := c.etcd.Client.Put(c.getContext(), key, string(hash))
+	return err
+}
+
+func (c *etcdCtx) GetJoinTokenHash() ([]byte, error) {
+	promOps.WithLabelValues("get-join-token").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("meta", "join-token"))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return resp.Kvs[0].Value, nil
+}
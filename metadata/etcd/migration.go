@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/torus"
+)
+
+func migrationKey(vid torus.VolumeID) []byte {
+	return []byte(MkKey("volumemeta", Uint64ToHex(uint64(vid)), "migration"))
+}
+
+func (c *etcdCtx) GetMigration(vid torus.VolumeID) (*torus.Migration, error) {
+	promOps.WithLabelValues("get-migration").Inc()
+	val, ok, err := c.getValue(string(migrationKey(vid)))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	var mig torus.Migration
+	err = json.Unmarshal(val, &mig)
+	if err != nil {
+		return nil, err
+	}
+	return &mig, nil
+}
+
+func (c *etcdCtx) ModifyMigration(vid torus.VolumeID, f func(*torus.Migration) (*torus.Migration, error)) (*torus.Migration, error) {
+	promOps.WithLabelValues("modify-migration").Inc()
+	v, err := c.AtomicModifyKey(migrationKey(vid), func(in []byte) ([]byte, interface{}, error) {
+		var old *torus.Migration
+		if len(in) != 0 {
+			old = &torus.Migration{}
+			err := json.Unmarshal(in, old)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		mig, err := f(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := json.Marshal(mig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return b, mig, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*torus.Migration), nil
+}
@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"strings"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/ring"
+)
+
+func poolKey(name string) string {
+	return MkKey("pools", name)
+}
+
+func (c *etcdCtx) GetPools() (map[string]torus.Ring, error) {
+	promOps.WithLabelValues("get-pools").Inc()
+	prefix := MkKey("pools") + "/"
+	resp, err := c.etcd.Client.Get(c.getContext(), prefix, etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]torus.Ring)
+	for _, x := range resp.Kvs {
+		r, err := ring.Unmarshal(x.Value)
+		if err != nil {
+			clog.Errorf("pool ring at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		out[strings.TrimPrefix(string(x.Key), prefix)] = r
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) GetPool(name string) (torus.Ring, error) {
+	promOps.WithLabelValues("get-pool").Inc()
+	b, ok, err := c.getValue(poolKey(name))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return ring.Unmarshal(b)
+}
+
+func (c *etcdCtx) CreatePool(name string, r torus.Ring) error {
+	promOps.WithLabelValues("create-pool").Inc()
+	b, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	key := poolKey(name)
+	resp, err := c.etcd.Client.Txn(c.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(key), "=", 0),
+	).Then(
+		etcdv3.OpPut(key, string(b)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrExists
+	}
+	return nil
+}
+
+func (c *etcdCtx) SetPoolRing(name string, r torus.Ring) error {
+	promOps.WithLabelValues("set-pool-ring").Inc()
+	b, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = c.AtomicModifyKey([]byte(poolKey(name)), func(in []byte) ([]byte, interface{}, error) {
+		if len(in) == 0 {
+			return nil, nil, torus.ErrNotExist
+		}
+		old, err := ring.Unmarshal(in)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r.Version() <= old.Version() {
+			return nil, nil, torus.ErrNonSequentialRing
+		}
+		return b, nil, nil
+	})
+	return err
+}
+
+func (c *etcdCtx) DeletePool(name string) error {
+	promOps.WithLabelValues("delete-pool").Inc()
+	resp, err := c.etcd.Client.Delete(c.getContext(), poolKey(name))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return torus.ErrNotExist
+	}
+	return nil
+}
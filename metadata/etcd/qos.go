@@ -0,0 +1,36 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/torus"
+)
+
+func qosKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "qos")
+}
+
+func (c *etcdCtx) GetQoS(vid torus.VolumeID) (torus.QoS, error) {
+	promOps.WithLabelValues("get-qos").Inc()
+	var q torus.QoS
+	val, ok, err := c.getValue(qosKey(vid))
+	if err != nil || !ok {
+		return q, err
+	}
+	err = json.Unmarshal(val, &q)
+	return q, err
+}
+
+func (c *etcdCtx) SetQoS(vid torus.VolumeID, q torus.QoS) error {
+	promOps.WithLabelValues("set-qos").Inc()
+	if q.IsUnlimited() {
+		_, err := c.etcd.Client.Delete(c.getContext(), qosKey(vid))
+		return err
+	}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), qosKey(vid), string(data))
+	return err
+}
@@ -0,0 +1,33 @@
+package etcd
+
+import (
+	"strconv"
+
+	"github.com/coreos/torus"
+)
+
+func readaheadKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "readahead")
+}
+
+func (c *etcdCtx) GetReadahead(vid torus.VolumeID) (uint64, error) {
+	promOps.WithLabelValues("get-readahead").Inc()
+	val, ok, err := c.getValue(readaheadKey(vid))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(val), 10, 64)
+}
+
+func (c *etcdCtx) SetReadahead(vid torus.VolumeID, bytes uint64) error {
+	promOps.WithLabelValues("set-readahead").Inc()
+	if bytes == 0 {
+		_, err := c.etcd.Client.Delete(c.getContext(), readaheadKey(vid))
+		return err
+	}
+	_, err := c.etcd.Client.Put(c.getContext(), readaheadKey(vid), strconv.FormatUint(bytes, 10))
+	return err
+}
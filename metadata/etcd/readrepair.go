@@ -0,0 +1,27 @@
+package etcd
+
+import (
+	"github.com/coreos/torus"
+)
+
+func readRepairKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "read-repair")
+}
+
+func (c *etcdCtx) GetReadRepair(vid torus.VolumeID) (torus.ReadRepairPolicy, error) {
+	promOps.WithLabelValues("get-read-repair").Inc()
+	val, ok, err := c.getValue(readRepairKey(vid))
+	if err != nil {
+		return torus.ReadRepairOff, err
+	}
+	if !ok {
+		return torus.ReadRepairOff, nil
+	}
+	return torus.ParseReadRepairPolicy(string(val))
+}
+
+func (c *etcdCtx) SetReadRepair(vid torus.VolumeID, p torus.ReadRepairPolicy) error {
+	promOps.WithLabelValues("set-read-repair").Inc()
+	_, err := c.etcd.Client.Put(c.getContext(), readRepairKey(vid), p.String())
+	return err
+}
@@ -0,0 +1,181 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+)
+
+func (c *etcdCtx) RecordRebalance(r *torus.RebalanceRecord) error {
+	promOps.WithLabelValues("record-rebalance").Inc()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// Zero-padded so that the history sorts by version.
+	key := MkKey("rebalance-history", fmt.Sprintf("%08x", r.ToVersion), r.Peer)
+	_, err = c.etcd.Client.Put(c.getContext(), key, string(data))
+	if err != nil {
+		return err
+	}
+	return c.pruneRebalanceHistory()
+}
+
+// pruneRebalanceHistory deletes all but the latest torus.RebalanceHistoryLen ring
+// changes.
+func (c *etcdCtx) pruneRebalanceHistory() error {
+	prefix := MkKey("rebalance-history") + "/"
+	resp, err := c.etcd.Client.Get(c.getContext(), prefix, etcdv3.WithPrefix(), etcdv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+	var versions []string
+	for _, x := range resp.Kvs {
+		v := strings.SplitN(strings.TrimPrefix(string(x.Key), prefix), "/", 2)[0]
+		if len(versions) == 0 || versions[len(versions)-1] != v {
+			versions = append(versions, v)
+		}
+	}
+	for len(versions) > torus.RebalanceHistoryLen {
+		_, err := c.etcd.Client.Delete(c.getContext(), prefix+versions[0]+"/", etcdv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+	return nil
+}
+
+func (c *etcdCtx) GetRebalanceHistory() ([]*torus.RebalanceRecord, error) {
+	promOps.WithLabelValues("get-rebalance-history").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("rebalance-history")+"/", etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []*torus.RebalanceRecord
+	for _, x := range resp.Kvs {
+		var r torus.RebalanceRecord
+		err := json.Unmarshal(x.Value, &r)
+		if err != nil {
+			clog.Errorf("rebalance record at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		out = append(out, &r)
+	}
+	return out, nil
+}
+
+// rebalanceCheckpoint is the stored form of a torus.RebalanceCheckpoint.
+type rebalanceCheckpoint struct {
+	Peer        string `json:"peer"`
+	RingVersion int    `json:"ring_version"`
+	Last        []byte `json:"last"`
+	Saved       int64  `json:"saved"`
+}
+
+func (c *etcdCtx) SaveRebalanceCheckpoint(cp *torus.RebalanceCheckpoint) error {
+	promOps.WithLabelValues("save-rebalance-checkpoint").Inc()
+	key := MkKey("rebalance-checkpoint", c.etcd.uuid)
+	if cp == nil {
+		_, err := c.etcd.Client.Delete(c.getContext(), key)
+		return err
+	}
+	data, err := json.Marshal(rebalanceCheckpoint{
+		Peer:        cp.Peer,
+		RingVersion: cp.RingVersion,
+		Last:        cp.Last.ToBytes(),
+		Saved:       cp.Saved,
+	})
+	if err != nil {
+		return err
+	}
+	// Not tied to the lease: the checkpoint is for after the peer restarts.
+	_, err = c.etcd.Client.Put(c.getContext(), key, string(data))
+	return err
+}
+
+func (c *etcdCtx) GetRebalanceCheckpoint() (*torus.RebalanceCheckpoint, error) {
+	promOps.WithLabelValues("get-rebalance-checkpoint").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("rebalance-checkpoint", c.etcd.uuid))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	var cp rebalanceCheckpoint
+	err = json.Unmarshal(resp.Kvs[0].Value, &cp)
+	if err != nil {
+		return nil, err
+	}
+	if len(cp.Last) != torus.BlockRefByteSize {
+		return nil, torus.ErrInvalid
+	}
+	return &torus.RebalanceCheckpoint{
+		Peer:        cp.Peer,
+		RingVersion: cp.RingVersion,
+		Last:        torus.BlockRefFromBytes(cp.Last),
+		Saved:       cp.Saved,
+	}, nil
+}
+
+// recoveryCheckpoint is the stored form of a torus.RecoveryCheckpoint.
+type recoveryCheckpoint struct {
+	rebalanceCheckpoint
+	Failed []string `json:"failed"`
+}
+
+func (c *etcdCtx) SaveRecoveryCheckpoint(cp *torus.RecoveryCheckpoint) error {
+	promOps.WithLabelValues("save-recovery-checkpoint").Inc()
+	key := MkKey("recovery-checkpoint", c.etcd.uuid)
+	if cp == nil {
+		_, err := c.etcd.Client.Delete(c.getContext(), key)
+		return err
+	}
+	data, err := json.Marshal(recoveryCheckpoint{
+		rebalanceCheckpoint: rebalanceCheckpoint{
+			Peer:        cp.Peer,
+			RingVersion: cp.RingVersion,
+			Last:        cp.Last.ToBytes(),
+			Saved:       cp.Saved,
+		},
+		Failed: cp.Failed,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), key, string(data))
+	return err
+}
+
+func (c *etcdCtx) GetRecoveryCheckpoint() (*torus.RecoveryCheckpoint, error) {
+	promOps.WithLabelValues("get-recovery-checkpoint").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("recovery-checkpoint", c.etcd.uuid))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	var cp recoveryCheckpoint
+	err = json.Unmarshal(resp.Kvs[0].Value, &cp)
+	if err != nil {
+		return nil, err
+	}
+	if len(cp.Last) != torus.BlockRefByteSize {
+		return nil, torus.ErrInvalid
+	}
+	return &torus.RecoveryCheckpoint{
+		RebalanceCheckpoint: torus.RebalanceCheckpoint{
+			Peer:        cp.Peer,
+			RingVersion: cp.RingVersion,
+			Last:        torus.BlockRefFromBytes(cp.Last),
+			Saved:       cp.Saved,
+		},
+		Failed: torus.PeerList(cp.Failed),
+	}, nil
+}
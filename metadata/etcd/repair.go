@@ -0,0 +1,59 @@
+package etcd
+
+import (
+	"encoding/json"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+)
+
+func (c *etcdCtx) GetRepairPolicy() (torus.RepairPolicy, error) {
+	val, ok, err := c.getValue(MkKey("meta", "repair-policy"))
+	if err != nil {
+		return torus.RepairNormal, err
+	}
+	if !ok {
+		return torus.RepairNormal, nil
+	}
+	return torus.ParseRepairPolicy(string(val))
+}
+
+func (c *etcdCtx) SetRepairPolicy(p torus.RepairPolicy) error {
+	_, err := c.etcd.Client.Put(c.getContext(), MkKey("meta", "repair-policy"), p.String())
+	return err
+}
+
+func (c *etcdCtx) SetEmergency(lease int64, e *torus.Emergency) error {
+	promOps.WithLabelValues("set-emergency").Inc()
+	key := MkKey("emergency", c.etcd.uuid)
+	if e == nil {
+		_, err := c.etcd.Client.Delete(c.getContext(), key)
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), key, string(data), etcdv3.WithLease(etcdv3.LeaseID(lease)))
+	return err
+}
+
+func (c *etcdCtx) GetEmergencies() ([]*torus.Emergency, error) {
+	promOps.WithLabelValues("get-emergencies").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("emergency"), etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []*torus.Emergency
+	for _, x := range resp.Kvs {
+		var e torus.Emergency
+		err := json.Unmarshal(x.Value, &e)
+		if err != nil {
+			clog.Errorf("emergency at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		out = append(out, &e)
+	}
+	return out, nil
+}
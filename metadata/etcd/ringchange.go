@@ -0,0 +1,166 @@
+package etcd
+
+import (
+	"path"
+	"time"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/ring"
+)
+
+func ringAcksKey(version int) string {
+	return MkKey("ring-acks", Uint64ToHex(uint64(version))) + "/"
+}
+
+func (c *etcdCtx) getProposedRing() (torus.Ring, []byte, error) {
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("meta", "proposed-ring"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil, nil
+	}
+	r, err := ring.Unmarshal(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, resp.Kvs[0].Value, nil
+}
+
+func (c *etcdCtx) ProposeRing(r torus.Ring, ttl time.Duration) error {
+	promOps.WithLabelValues("propose-ring").Inc()
+	oldr, etcdver, err := c.getRing()
+	if err != nil {
+		return err
+	}
+	if oldr.Version() != r.Version()-1 {
+		return torus.ErrNonSequentialRing
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	// The proposal and its acks go away with the lease, so that they don't
+	// outlive a proposer that dies before committing or aborting.
+	lease, err := c.etcd.Client.Grant(c.getContext(), int64((ttl+time.Second-1)/time.Second))
+	if err != nil {
+		return err
+	}
+	key := MkKey("meta", "the-one-ring")
+	proposed := MkKey("meta", "proposed-ring")
+	resp, err := c.etcd.Client.Txn(c.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(key), "=", etcdver),
+		etcdv3.Compare(etcdv3.Version(proposed), "=", 0),
+	).Then(
+		etcdv3.OpPut(proposed, string(b), etcdv3.WithLease(lease.ID)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if resp.Succeeded {
+		return nil
+	}
+	pr, _, err := c.getProposedRing()
+	if err != nil {
+		return err
+	}
+	if pr != nil {
+		return torus.ErrRingChangePending
+	}
+	return torus.ErrAgain
+}
+
+func (c *etcdCtx) GetProposedRing() (torus.Ring, error) {
+	promOps.WithLabelValues("get-proposed-ring").Inc()
+	r, _, err := c.getProposedRing()
+	return r, err
+}
+
+func (c *etcdCtx) AckRing(version int, uuid string) error {
+	promOps.WithLabelValues("ack-ring").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("meta", "proposed-ring"))
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return torus.ErrNotExist
+	}
+	r, err := ring.Unmarshal(resp.Kvs[0].Value)
+	if err != nil {
+		return err
+	}
+	if r.Version() != version {
+		return torus.ErrNotExist
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), ringAcksKey(version)+uuid, "", etcdv3.WithLease(etcdv3.LeaseID(resp.Kvs[0].Lease)))
+	return err
+}
+
+func (c *etcdCtx) GetRingAcks(version int) ([]string, error) {
+	promOps.WithLabelValues("get-ring-acks").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), ringAcksKey(version), etcdv3.WithPrefix(), etcdv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, kv := range resp.Kvs {
+		out = append(out, path.Base(string(kv.Key)))
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) CommitRing(version int) error {
+	promOps.WithLabelValues("commit-ring").Inc()
+	r, b, err := c.getProposedRing()
+	if err != nil {
+		return err
+	}
+	if r == nil || r.Version() != version {
+		return torus.ErrNotExist
+	}
+	oldr, etcdver, err := c.getRing()
+	if err != nil {
+		return err
+	}
+	if oldr.Version() != version-1 {
+		return torus.ErrNonSequentialRing
+	}
+	key := MkKey("meta", "the-one-ring")
+	proposed := MkKey("meta", "proposed-ring")
+	resp, err := c.etcd.Client.Txn(c.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(key), "=", etcdver),
+		etcdv3.Compare(etcdv3.Value(proposed), "=", string(b)),
+	).Then(
+		etcdv3.OpPut(key, string(b)),
+		etcdv3.OpDelete(proposed),
+		etcdv3.OpDelete(ringAcksKey(version), etcdv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if resp.Succeeded {
+		return nil
+	}
+	return torus.ErrAgain
+}
+
+func (c *etcdCtx) AbortRing(version int) error {
+	promOps.WithLabelValues("abort-ring").Inc()
+	r, b, err := c.getProposedRing()
+	if err != nil {
+		return err
+	}
+	if r == nil || r.Version() != version {
+		return nil
+	}
+	proposed := MkKey("meta", "proposed-ring")
+	_, err = c.etcd.Client.Txn(c.getContext()).If(
+		etcdv3.Compare(etcdv3.Value(proposed), "=", string(b)),
+	).Then(
+		etcdv3.OpDelete(proposed),
+		etcdv3.OpDelete(ringAcksKey(version), etcdv3.WithPrefix()),
+	).Commit()
+	return err
+}
@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+)
+
+// corruptBlock is the stored form of a torus.CorruptBlock.
+type corruptBlock struct {
+	Peer     string `json:"peer"`
+	Ref      []byte `json:"ref"`
+	Found    int64  `json:"found"`
+	Repaired bool   `json:"repaired"`
+}
+
+func (c *etcdCtx) GetScrubControl() (torus.ScrubControl, error) {
+	promOps.WithLabelValues("get-scrub-control").Inc()
+	var sc torus.ScrubControl
+	val, ok, err := c.getValue(MkKey("meta", "scrub-control"))
+	if err != nil {
+		return sc, err
+	}
+	if !ok {
+		return sc, nil
+	}
+	err = json.Unmarshal(val, &sc)
+	return sc, err
+}
+
+func (c *etcdCtx) SetScrubControl(sc torus.ScrubControl) error {
+	promOps.WithLabelValues("set-scrub-control").Inc()
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), MkKey("meta", "scrub-control"), string(data))
+	return err
+}
+
+func (c *etcdCtx) SetScrubStatus(lease int64, s *torus.ScrubStatus) error {
+	promOps.WithLabelValues("set-scrub-status").Inc()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), MkKey("scrub", c.etcd.uuid), string(data), etcdv3.WithLease(etcdv3.LeaseID(lease)))
+	return err
+}
+
+func (c *etcdCtx) GetScrubStatuses() ([]*torus.ScrubStatus, error) {
+	promOps.WithLabelValues("get-scrub-statuses").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("scrub"), etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []*torus.ScrubStatus
+	for _, x := range resp.Kvs {
+		var s torus.ScrubStatus
+		err := json.Unmarshal(x.Value, &s)
+		if err != nil {
+			clog.Errorf("scrub status at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		out = append(out, &s)
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) ReportCorruptBlock(b torus.CorruptBlock) error {
+	promOps.WithLabelValues("report-corrupt-block").Inc()
+	data, err := json.Marshal(corruptBlock{
+		Peer:     b.Peer,
+		Ref:      b.Ref.ToBytes(),
+		Found:    b.Found,
+		Repaired: b.Repaired,
+	})
+	if err != nil {
+		return err
+	}
+	key := MkKey("corrupt", b.Peer, fmt.Sprintf("%x", b.Ref.ToBytes()))
+	_, err = c.etcd.Client.Put(c.getContext(), key, string(data))
+	return err
+}
+
+func (c *etcdCtx) GetCorruptBlocks() ([]torus.CorruptBlock, error) {
+	promOps.WithLabelValues("get-corrupt-blocks").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("corrupt"), etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var out []torus.CorruptBlock
+	for _, x := range resp.Kvs {
+		var b corruptBlock
+		err := json.Unmarshal(x.Value, &b)
+		if err != nil || len(b.Ref) != torus.BlockRefByteSize {
+			clog.Errorf("corrupt block at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		out = append(out, torus.CorruptBlock{
+			Peer:     b.Peer,
+			Ref:      torus.BlockRefFromBytes(b.Ref),
+			Found:    b.Found,
+			Repaired: b.Repaired,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,74 @@
+package etcd
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+)
+
+func (c *etcdCtx) GetVolumeTenants() (map[torus.VolumeID]string, error) {
+	promOps.WithLabelValues("get-volume-tenants").Inc()
+	prefix := MkKey("volumemeta") + "/"
+	resp, err := c.etcd.Client.Get(c.getContext(), prefix, etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[torus.VolumeID]string)
+	for _, x := range resp.Kvs {
+		parts := strings.Split(strings.TrimPrefix(string(x.Key), prefix), "/")
+		if len(parts) != 2 || parts[1] != "tenant" {
+			continue
+		}
+		vid, err := strconv.ParseUint(parts[0], 16, 64)
+		if err != nil {
+			continue
+		}
+		out[torus.VolumeID(vid)] = string(x.Value)
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) SetVolumeTenant(vid torus.VolumeID, tenant string) error {
+	promOps.WithLabelValues("set-volume-tenant").Inc()
+	_, err := c.etcd.Client.Put(c.getContext(), MkKey("volumemeta", Uint64ToHex(uint64(vid)), "tenant"), tenant)
+	return err
+}
+
+func (c *etcdCtx) GetTenantQuotas() (map[string]torus.TenantQuota, error) {
+	promOps.WithLabelValues("get-tenant-quotas").Inc()
+	prefix := MkKey("tenant-quota") + "/"
+	resp, err := c.etcd.Client.Get(c.getContext(), prefix, etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]torus.TenantQuota)
+	for _, x := range resp.Kvs {
+		var q torus.TenantQuota
+		err := json.Unmarshal(x.Value, &q)
+		if err != nil {
+			clog.Errorf("tenant quota at key %s didn't unmarshal correctly: %v", string(x.Key), err)
+			continue
+		}
+		out[strings.TrimPrefix(string(x.Key), prefix)] = q
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) SetTenantQuota(tenant string, q torus.TenantQuota) error {
+	promOps.WithLabelValues("set-tenant-quota").Inc()
+	key := MkKey("tenant-quota", tenant)
+	if q.Soft == 0 && q.Hard == 0 {
+		_, err := c.etcd.Client.Delete(c.getContext(), key)
+		return err
+	}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcd.Client.Put(c.getContext(), key, string(data))
+	return err
+}
@@ -0,0 +1,31 @@
+package etcd
+
+import (
+	"github.com/coreos/torus"
+)
+
+func tieringKey(vid torus.VolumeID) string {
+	return MkKey("volumemeta", Uint64ToHex(uint64(vid)), "tiering")
+}
+
+func (c *etcdCtx) GetTiering(vid torus.VolumeID) (torus.TierPolicy, error) {
+	promOps.WithLabelValues("get-tiering").Inc()
+	val, ok, err := c.getValue(tieringKey(vid))
+	if err != nil {
+		return torus.TierAuto, err
+	}
+	if !ok {
+		return torus.TierAuto, nil
+	}
+	return torus.ParseTierPolicy(string(val))
+}
+
+func (c *etcdCtx) SetTiering(vid torus.VolumeID, p torus.TierPolicy) error {
+	promOps.WithLabelValues("set-tiering").Inc()
+	if p == torus.TierAuto {
+		_, err := c.etcd.Client.Delete(c.getContext(), tieringKey(vid))
+		return err
+	}
+	_, err := c.etcd.Client.Put(c.getContext(), tieringKey(vid), p.String())
+	return err
+}
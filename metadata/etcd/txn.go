@@ -0,0 +1,113 @@
+package etcd
+
+import (
+	"strings"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+// txnKey returns the etcd key of a key of the transaction API, which must
+// stay under KeyPrefix.
+func txnKey(key string) (string, error) {
+	k := MkKey(key)
+	if !strings.HasPrefix(k, KeyPrefix) {
+		return "", torus.ErrInvalid
+	}
+	return k, nil
+}
+
+// GetKeys reads every key in one transaction, so they're all as of the same
+// revision. The version of a key is the revision it was last changed in.
+func (c *etcdCtx) GetKeys(keys ...string) ([]torus.MetadataKV, error) {
+	promOps.WithLabelValues("get-keys").Inc()
+	ops := make([]etcdv3.Op, len(keys))
+	for i, key := range keys {
+		k, err := txnKey(key)
+		if err != nil {
+			return nil, err
+		}
+		ops[i] = etcdv3.OpGet(k)
+	}
+	resp, err := c.etcd.Client.Txn(c.getContext()).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]torus.MetadataKV, len(keys))
+	for i, key := range keys {
+		out[i].Key = key
+		kvs := resp.Responses[i].GetResponseRange().Kvs
+		if len(kvs) == 0 {
+			continue
+		}
+		out[i].Value = kvs[0].Value
+		out[i].Version = kvs[0].ModRevision
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) ListKeys(prefix string) ([]torus.MetadataKV, error) {
+	promOps.WithLabelValues("list-keys").Inc()
+	k, err := txnKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.etcd.Client.Get(c.getContext(), k+"/", etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]torus.MetadataKV, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		out[i] = torus.MetadataKV{
+			Key:     strings.TrimPrefix(string(kv.Key), KeyPrefix),
+			Value:   kv.Value,
+			Version: kv.ModRevision,
+		}
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) Txn(cmps []torus.MetadataKV, ops []torus.MetadataOp) (bool, error) {
+	promOps.WithLabelValues("txn").Inc()
+	if len(cmps)+len(ops) > torus.MaxTxnOps {
+		return false, torus.ErrInvalid
+	}
+	var ecmps []etcdv3.Cmp
+	for _, cmp := range cmps {
+		k, err := txnKey(cmp.Key)
+		if err != nil {
+			return false, err
+		}
+		ecmps = append(ecmps, etcdv3.Compare(etcdv3.ModRevision(k), "=", cmp.Version))
+	}
+	var eops []etcdv3.Op
+	for _, op := range ops {
+		k, err := txnKey(op.Key)
+		if err != nil {
+			return false, err
+		}
+		if op.Delete {
+			eops = append(eops, etcdv3.OpDelete(k))
+		} else {
+			eops = append(eops, etcdv3.OpPut(k, string(op.Value)))
+		}
+	}
+	resp, err := c.etcd.Client.Txn(c.getContext()).If(ecmps...).Then(eops...).Commit()
+	if err != nil {
+		return false, err
+	}
+	if resp.Succeeded {
+		for _, op := range ops {
+			if strings.HasPrefix(op.Key, "volumeid/") {
+				// The volume changed may be cached by its name.
+				c.etcd.mut.Lock()
+				c.etcd.volumesCache = make(map[string]*models.Volume)
+				c.etcd.mut.Unlock()
+				break
+			}
+		}
+	}
+	return resp.Succeeded, nil
+}
@@ -0,0 +1,138 @@
+package etcd
+
+import (
+	"strconv"
+	"strings"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+func (c *etcdCtx) RenameVolume(from, to string) error {
+	promOps.WithLabelValues("rename-volume").Inc()
+	fromKey, toKey := MkKey("volumes", from), MkKey("volumes", to)
+	for {
+		resp, err := c.etcd.Client.Get(c.getContext(), fromKey)
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			return torus.ErrNotExist
+		}
+		nameKv := resp.Kvs[0]
+		idKey := MkKey("volumeid", Uint64ToHex(BytesToUint64(nameKv.Value)))
+		resp, err = c.etcd.Client.Get(c.getContext(), idKey)
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			return torus.ErrNotExist
+		}
+		vol := &models.Volume{}
+		err = vol.Unmarshal(resp.Kvs[0].Value)
+		if err != nil {
+			return err
+		}
+		vol.Name = to
+		vbytes, err := vol.Marshal()
+		if err != nil {
+			return err
+		}
+		txn, err := c.etcd.Client.Txn(c.getContext()).If(
+			etcdv3.Compare(etcdv3.ModRevision(fromKey), "=", nameKv.ModRevision),
+			etcdv3.Compare(etcdv3.ModRevision(idKey), "=", resp.Kvs[0].ModRevision),
+			etcdv3.Compare(etcdv3.Version(toKey), "=", 0),
+		).Then(
+			etcdv3.OpDelete(fromKey),
+			etcdv3.OpPut(toKey, string(nameKv.Value)),
+			etcdv3.OpPut(idKey, string(vbytes)),
+		).Else(
+			etcdv3.OpGet(toKey),
+		).Commit()
+		if err != nil {
+			return err
+		}
+		if txn.Succeeded {
+			c.etcd.mut.Lock()
+			delete(c.etcd.volumesCache, from)
+			c.etcd.mut.Unlock()
+			return nil
+		}
+		if len(txn.Responses[0].GetResponseRange().Kvs) != 0 {
+			return torus.ErrExists
+		}
+		promAtomicRetries.WithLabelValues(fromKey).Inc()
+	}
+}
+
+func (c *etcdCtx) ResizeVolume(name string, size uint64) error {
+	promOps.WithLabelValues("resize-volume").Inc()
+	resp, err := c.etcd.Client.Get(c.getContext(), MkKey("volumes", name))
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return torus.ErrNotExist
+	}
+	k := []byte(MkKey("volumeid", Uint64ToHex(BytesToUint64(resp.Kvs[0].Value))))
+	_, err = c.AtomicModifyKey(k, func(in []byte) ([]byte, interface{}, error) {
+		if len(in) == 0 {
+			return nil, nil, torus.ErrNotExist
+		}
+		vol := &models.Volume{}
+		err := vol.Unmarshal(in)
+		if err != nil {
+			return nil, nil, err
+		}
+		vol.MaxBytes = size
+		b, err := vol.Marshal()
+		return b, nil, err
+	})
+	if err != nil {
+		return err
+	}
+	c.etcd.mut.Lock()
+	delete(c.etcd.volumesCache, name)
+	c.etcd.mut.Unlock()
+	return nil
+}
+
+func (c *etcdCtx) GetVolumeTags() (map[torus.VolumeID]map[string]string, error) {
+	promOps.WithLabelValues("get-volume-tags").Inc()
+	prefix := MkKey("volumemeta") + "/"
+	resp, err := c.etcd.Client.Get(c.getContext(), prefix, etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[torus.VolumeID]map[string]string)
+	for _, x := range resp.Kvs {
+		parts := strings.Split(strings.TrimPrefix(string(x.Key), prefix), "/")
+		if len(parts) != 3 || parts[1] != "tags" {
+			continue
+		}
+		vid, err := strconv.ParseUint(parts[0], 16, 64)
+		if err != nil {
+			continue
+		}
+		tags, ok := out[torus.VolumeID(vid)]
+		if !ok {
+			tags = make(map[string]string)
+			out[torus.VolumeID(vid)] = tags
+		}
+		tags[parts[2]] = string(x.Value)
+	}
+	return out, nil
+}
+
+func (c *etcdCtx) SetVolumeTag(vid torus.VolumeID, key, value string) error {
+	promOps.WithLabelValues("set-volume-tag").Inc()
+	k := MkKey("volumemeta", Uint64ToHex(uint64(vid)), "tags", key)
+	if value == "" {
+		_, err := c.etcd.Client.Delete(c.getContext(), k)
+		return err
+	}
+	_, err := c.etcd.Client.Put(c.getContext(), k, value)
+	return err
+}
@@ -1,9 +1,9 @@
 package temp
 
 import (
-	"errors"
-	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -29,10 +29,51 @@ type Server struct {
 	peers    torus.PeerInfoList
 	ring     torus.Ring
 	newRing  torus.Ring
+	ringAcks map[string]bool
+	// newRingLapses is when newRing is dropped if it hasn't been committed.
+	newRingLapses time.Time
 
-	keys map[string]interface{}
+	keys        map[string]interface{}
+	conversions map[torus.VolumeID]*torus.Conversion
+	migrations  map[torus.VolumeID]*torus.Migration
+	readRepair  map[torus.VolumeID]torus.ReadRepairPolicy
+	consistency map[torus.VolumeID]torus.Consistency
+	inodeSync   map[torus.VolumeID]torus.INodeSyncPolicy
+	compression map[torus.VolumeID]bool
+	dedup       map[torus.VolumeID]bool
+	readahead   map[torus.VolumeID]uint64
+	tiering     map[torus.VolumeID]torus.TierPolicy
+	volumeKeys  map[torus.VolumeID]*torus.VolumeKeys
+	acls        map[torus.VolumeID]torus.ACL
+	qos         map[torus.VolumeID]torus.QoS
+	quotas      map[torus.VolumeID]uint64
 
-	ringListeners []chan torus.Ring
+	repairPolicy    torus.RepairPolicy
+	capacityReserve torus.CapacityReserve
+	volumeQuota     uint64
+	emergencies     map[string]*torus.Emergency
+	departures      map[string]*torus.Departure
+	draining        map[string]bool
+	joinTokenHash   []byte
+
+	scrubControl  torus.ScrubControl
+	scrubStatuses map[string]*torus.ScrubStatus
+	corrupt       []torus.CorruptBlock
+
+	rebalanceHistory     []*torus.RebalanceRecord
+	rebalanceCheckpoints map[string]*torus.RebalanceCheckpoint
+	recoveryCheckpoints  map[string]*torus.RecoveryCheckpoint
+	gcStatuses           map[string]*torus.GCStatus
+	fsckRequest          torus.FsckRequest
+	fsckReports          map[string]*torus.FsckReport
+
+	tenants      map[torus.VolumeID]string
+	tenantQuotas map[string]torus.TenantQuota
+	pools        map[string]torus.Ring
+	tags         map[torus.VolumeID]map[string]string
+
+	ringListeners   []chan torus.Ring
+	volumeListeners []chan torus.VolumeID
 }
 
 type Client struct {
@@ -56,9 +97,36 @@ func NewServer() *Server {
 			BlockSize:        256,
 			DefaultBlockSpec: blockset.MustParseBlockLayerSpec("crc,base"),
 		},
-		ring:  r,
-		keys:  make(map[string]interface{}),
-		inode: make(map[torus.VolumeID]torus.INodeID),
+		ring:        r,
+		keys:        make(map[string]interface{}),
+		conversions: make(map[torus.VolumeID]*torus.Conversion),
+		migrations:  make(map[torus.VolumeID]*torus.Migration),
+		readRepair:  make(map[torus.VolumeID]torus.ReadRepairPolicy),
+		consistency: make(map[torus.VolumeID]torus.Consistency),
+		inodeSync:   make(map[torus.VolumeID]torus.INodeSyncPolicy),
+		compression: make(map[torus.VolumeID]bool),
+		dedup:       make(map[torus.VolumeID]bool),
+		readahead:   make(map[torus.VolumeID]uint64),
+		tiering:     make(map[torus.VolumeID]torus.TierPolicy),
+		volumeKeys:  make(map[torus.VolumeID]*torus.VolumeKeys),
+		acls:        make(map[torus.VolumeID]torus.ACL),
+		qos:         make(map[torus.VolumeID]torus.QoS),
+		quotas:      make(map[torus.VolumeID]uint64),
+		emergencies: make(map[string]*torus.Emergency),
+		departures:  make(map[string]*torus.Departure),
+		draining:    make(map[string]bool),
+		inode:       make(map[torus.VolumeID]torus.INodeID),
+
+		scrubStatuses: make(map[string]*torus.ScrubStatus),
+		tenants:       make(map[torus.VolumeID]string),
+		tenantQuotas:  make(map[string]torus.TenantQuota),
+		pools:         make(map[string]torus.Ring),
+		tags:          make(map[torus.VolumeID]map[string]string),
+
+		rebalanceCheckpoints: make(map[string]*torus.RebalanceCheckpoint),
+		recoveryCheckpoints:  make(map[string]*torus.RecoveryCheckpoint),
+		gcStatuses:           make(map[string]*torus.GCStatus),
+		fsckReports:          make(map[string]*torus.FsckReport),
 	}
 }
 
@@ -93,21 +161,28 @@ func (t *Client) GetLockStatus(vid uint64) string { return "" }
 func (t *Client) GetPeers() (torus.PeerInfoList, error) {
 	t.srv.mut.RLock()
 	defer t.srv.mut.RUnlock()
+	// Hand out copies, so callers never share the stored peers that
+	// RegisterPeer replaces.
 	peers := make(torus.PeerInfoList, len(t.srv.peers))
-	copy(peers, t.srv.peers)
+	for i, p := range t.srv.peers {
+		cp := *p
+		peers[i] = &cp
+	}
 	return peers, nil
 }
 
 func (t *Client) RegisterPeer(_ int64, pi *models.PeerInfo) error {
 	t.srv.mut.Lock()
 	defer t.srv.mut.Unlock()
+	cp := *pi
+	cp.LastSeen = time.Now().UnixNano()
 	for i, p := range t.srv.peers {
-		if p.UUID == pi.UUID {
-			t.srv.peers[i] = pi
+		if p.UUID == cp.UUID {
+			t.srv.peers[i] = &cp
 			return nil
 		}
 	}
-	t.srv.peers = append(t.srv.peers, pi)
+	t.srv.peers = append(t.srv.peers, &cp)
 	return nil
 }
 
@@ -119,6 +194,18 @@ func (t *Client) NewVolumeID() (torus.VolumeID, error) {
 	return t.srv.vol, nil
 }
 
+func (t *Client) NewVolumeIDs(n int) (torus.VolumeID, error) {
+	if n <= 0 {
+		return 0, torus.ErrInvalid
+	}
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+
+	first := t.srv.vol + 1
+	t.srv.vol += torus.VolumeID(n)
+	return first, nil
+}
+
 func (t *Client) CommitINodeIndex(vol torus.VolumeID) (torus.INodeID, error) {
 	t.srv.mut.Lock()
 	defer t.srv.mut.Unlock()
@@ -152,7 +239,7 @@ func (t *Client) GetVolume(volume string) (*models.Volume, error) {
 	if vol, ok := t.srv.volIndex[volume]; ok {
 		return vol, nil
 	}
-	return nil, errors.New(fmt.Sprintf("temp: volume %q not found", volume))
+	return nil, torus.ErrNotExist
 }
 
 func (t *Client) GetRing() (torus.Ring, error) {
@@ -187,6 +274,35 @@ func (s *Server) UnsubscribeNewRings(ch chan torus.Ring) {
 	panic("couldn't remove channel")
 }
 
+func (t *Client) SubscribeVolumeChanges(ch chan torus.VolumeID) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.volumeListeners = append(t.srv.volumeListeners, ch)
+	return nil
+}
+
+func (t *Client) UnsubscribeVolumeChanges(ch chan torus.VolumeID) {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	for i, c := range t.srv.volumeListeners {
+		if ch == c {
+			t.srv.volumeListeners = append(t.srv.volumeListeners[:i], t.srv.volumeListeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// volumeChanged tells the subscribers that a volume's settings changed. It's
+// deferred by those that change them before they take s.mut, so that it
+// runs once they've let it go.
+func (s *Server) volumeChanged(vid torus.VolumeID) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	for _, c := range s.volumeListeners {
+		c <- vid
+	}
+}
+
 func (t *Client) Close() error {
 	t.srv.mut.Lock()
 	defer t.srv.mut.Unlock()
@@ -210,6 +326,106 @@ func (s *Server) SetRing(ring torus.Ring) error {
 	return nil
 }
 
+// SetPeerLastSeen records that the peer last heartbeated at when, for tests
+// that can't wait out a heartbeat timeout.
+func (s *Server) SetPeerLastSeen(uuid string, when time.Time) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for i, p := range s.peers {
+		if p.UUID == uuid {
+			cp := *p
+			cp.LastSeen = when.UnixNano()
+			s.peers[i] = &cp
+			return nil
+		}
+	}
+	return torus.ErrNotExist
+}
+
+// proposedRing returns the staged ring, unless it has lapsed. The caller
+// holds s.mut.
+func (s *Server) proposedRing() torus.Ring {
+	if s.newRing == nil || time.Now().After(s.newRingLapses) {
+		return nil
+	}
+	return s.newRing
+}
+
+func (t *Client) ProposeRing(r torus.Ring, ttl time.Duration) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if t.srv.proposedRing() != nil {
+		return torus.ErrRingChangePending
+	}
+	if r.Version()-1 != t.srv.ring.Version() {
+		return torus.ErrNonSequentialRing
+	}
+	t.srv.newRing = r
+	t.srv.newRingLapses = time.Now().Add(ttl)
+	t.srv.ringAcks = make(map[string]bool)
+	return nil
+}
+
+func (t *Client) GetProposedRing() (torus.Ring, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.proposedRing(), nil
+}
+
+func (t *Client) AckRing(version int, uuid string) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	r := t.srv.proposedRing()
+	if r == nil || r.Version() != version {
+		return torus.ErrNotExist
+	}
+	t.srv.ringAcks[uuid] = true
+	return nil
+}
+
+func (t *Client) GetRingAcks(version int) ([]string, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	r := t.srv.proposedRing()
+	if r == nil || r.Version() != version {
+		return nil, nil
+	}
+	var out []string
+	for uuid := range t.srv.ringAcks {
+		out = append(out, uuid)
+	}
+	return out, nil
+}
+
+func (t *Client) CommitRing(version int) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	r := t.srv.proposedRing()
+	if r == nil || r.Version() != version {
+		return torus.ErrNotExist
+	}
+	if r.Version()-1 != t.srv.ring.Version() {
+		return torus.ErrNonSequentialRing
+	}
+	t.srv.newRing = nil
+	t.srv.ringAcks = nil
+	t.srv.ring = r
+	for _, c := range t.srv.ringListeners {
+		c <- r
+	}
+	return nil
+}
+
+func (t *Client) AbortRing(version int) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if t.srv.newRing != nil && t.srv.newRing.Version() == version {
+		t.srv.newRing = nil
+		t.srv.ringAcks = nil
+	}
+	return nil
+}
+
 func (t *Client) GetINodeIndex(volume torus.VolumeID) (torus.INodeID, error) {
 	t.srv.mut.RLock()
 	defer t.srv.mut.RUnlock()
@@ -242,6 +458,13 @@ func (t *Client) UnlockData() {
 	t.srv.mut.Unlock()
 }
 
+// VolumeExists reports whether a volume is named name. Like GetData, it must
+// be called with the data locked.
+func (t *Client) VolumeExists(name string) bool {
+	_, ok := t.srv.volIndex[name]
+	return ok
+}
+
 func (t *Client) GetData(x string) (interface{}, bool) {
 	out, exists := t.srv.keys[x]
 	return out, exists
@@ -254,7 +477,806 @@ func (t *Client) SetData(x string, v interface{}) {
 func (t *Client) DeleteVolume(name string) error {
 	t.srv.mut.Lock()
 	defer t.srv.mut.Unlock()
+	if vol, ok := t.srv.volIndex[name]; ok {
+		delete(t.srv.conversions, torus.VolumeID(vol.Id))
+		delete(t.srv.migrations, torus.VolumeID(vol.Id))
+		delete(t.srv.readRepair, torus.VolumeID(vol.Id))
+		delete(t.srv.consistency, torus.VolumeID(vol.Id))
+		delete(t.srv.inodeSync, torus.VolumeID(vol.Id))
+		delete(t.srv.compression, torus.VolumeID(vol.Id))
+		delete(t.srv.dedup, torus.VolumeID(vol.Id))
+		delete(t.srv.readahead, torus.VolumeID(vol.Id))
+		delete(t.srv.tiering, torus.VolumeID(vol.Id))
+		delete(t.srv.volumeKeys, torus.VolumeID(vol.Id))
+		delete(t.srv.acls, torus.VolumeID(vol.Id))
+		delete(t.srv.qos, torus.VolumeID(vol.Id))
+		delete(t.srv.quotas, torus.VolumeID(vol.Id))
+		delete(t.srv.tenants, torus.VolumeID(vol.Id))
+		delete(t.srv.tags, torus.VolumeID(vol.Id))
+	}
 	delete(t.srv.keys, name)
 	delete(t.srv.volIndex, name)
 	return nil
 }
+
+func copyConversion(c *torus.Conversion) *torus.Conversion {
+	out := *c
+	out.Progress = make(map[string]torus.ConversionProgress)
+	for k, v := range c.Progress {
+		out.Progress[k] = v
+	}
+	return &out
+}
+
+func (t *Client) GetConversion(vid torus.VolumeID) (*torus.Conversion, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	c, ok := t.srv.conversions[vid]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return copyConversion(c), nil
+}
+
+func (t *Client) ModifyConversion(vid torus.VolumeID, f func(*torus.Conversion) (*torus.Conversion, error)) (*torus.Conversion, error) {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	var old *torus.Conversion
+	if c, ok := t.srv.conversions[vid]; ok {
+		old = copyConversion(c)
+	}
+	c, err := f(old)
+	if err != nil {
+		return nil, err
+	}
+	t.srv.conversions[vid] = copyConversion(c)
+	return c, nil
+}
+
+func copyMigration(m *torus.Migration) *torus.Migration {
+	out := *m
+	out.Progress = make(map[string]torus.MigrationProgress)
+	for k, v := range m.Progress {
+		out.Progress[k] = v
+	}
+	return &out
+}
+
+func (t *Client) GetMigration(vid torus.VolumeID) (*torus.Migration, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	m, ok := t.srv.migrations[vid]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return copyMigration(m), nil
+}
+
+func (t *Client) ModifyMigration(vid torus.VolumeID, f func(*torus.Migration) (*torus.Migration, error)) (*torus.Migration, error) {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	var old *torus.Migration
+	if m, ok := t.srv.migrations[vid]; ok {
+		old = copyMigration(m)
+	}
+	m, err := f(old)
+	if err != nil {
+		return nil, err
+	}
+	t.srv.migrations[vid] = copyMigration(m)
+	return m, nil
+}
+
+func (t *Client) GetReadRepair(vid torus.VolumeID) (torus.ReadRepairPolicy, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.readRepair[vid], nil
+}
+
+func (t *Client) SetReadRepair(vid torus.VolumeID, p torus.ReadRepairPolicy) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.readRepair[vid] = p
+	return nil
+}
+
+func (t *Client) GetQoS(vid torus.VolumeID) (torus.QoS, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.qos[vid], nil
+}
+
+func (t *Client) SetQoS(vid torus.VolumeID, q torus.QoS) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.qos[vid] = q
+	return nil
+}
+
+func (t *Client) GetConsistency(vid torus.VolumeID) (*torus.Consistency, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	c, ok := t.srv.consistency[vid]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (t *Client) SetConsistency(vid torus.VolumeID, c *torus.Consistency) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if c == nil {
+		delete(t.srv.consistency, vid)
+		return nil
+	}
+	t.srv.consistency[vid] = *c
+	return nil
+}
+
+func (t *Client) GetINodeSync(vid torus.VolumeID) (torus.INodeSyncPolicy, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.inodeSync[vid], nil
+}
+
+func (t *Client) SetINodeSync(vid torus.VolumeID, p torus.INodeSyncPolicy) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.inodeSync[vid] = p
+	return nil
+}
+
+func (t *Client) GetCompression(vid torus.VolumeID) (bool, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.compression[vid], nil
+}
+
+func (t *Client) SetCompression(vid torus.VolumeID, on bool) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.compression[vid] = on
+	return nil
+}
+
+func (t *Client) GetDedup(vid torus.VolumeID) (bool, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.dedup[vid], nil
+}
+
+func (t *Client) SetDedup(vid torus.VolumeID, on bool) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.dedup[vid] = on
+	return nil
+}
+
+func (t *Client) GetReadahead(vid torus.VolumeID) (uint64, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.readahead[vid], nil
+}
+
+func (t *Client) SetReadahead(vid torus.VolumeID, bytes uint64) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.readahead[vid] = bytes
+	return nil
+}
+
+func (t *Client) GetTiering(vid torus.VolumeID) (torus.TierPolicy, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.tiering[vid], nil
+}
+
+func (t *Client) SetTiering(vid torus.VolumeID, p torus.TierPolicy) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.tiering[vid] = p
+	return nil
+}
+
+func copyVolumeKeys(vk *torus.VolumeKeys) *torus.VolumeKeys {
+	out := &torus.VolumeKeys{
+		Current: vk.Current,
+		Keys:    make(map[uint32][]byte),
+	}
+	for v, k := range vk.Keys {
+		out.Keys[v] = append([]byte(nil), k...)
+	}
+	return out
+}
+
+func (t *Client) GetVolumeKeys(vid torus.VolumeID) (*torus.VolumeKeys, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	vk, ok := t.srv.volumeKeys[vid]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return copyVolumeKeys(vk), nil
+}
+
+func (t *Client) ModifyVolumeKeys(vid torus.VolumeID, f func(*torus.VolumeKeys) (*torus.VolumeKeys, error)) (*torus.VolumeKeys, error) {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	var old *torus.VolumeKeys
+	if vk, ok := t.srv.volumeKeys[vid]; ok {
+		old = copyVolumeKeys(vk)
+	}
+	vk, err := f(old)
+	if err != nil {
+		return nil, err
+	}
+	t.srv.volumeKeys[vid] = copyVolumeKeys(vk)
+	return vk, nil
+}
+
+func copyACL(acl torus.ACL) torus.ACL {
+	if acl == nil {
+		return nil
+	}
+	out := make(torus.ACL)
+	for k, v := range acl {
+		out[k] = v
+	}
+	return out
+}
+
+func (t *Client) GetACL(vid torus.VolumeID) (torus.ACL, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return copyACL(t.srv.acls[vid]), nil
+}
+
+func (t *Client) ModifyACL(vid torus.VolumeID, f func(torus.ACL) (torus.ACL, error)) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	acl, err := f(copyACL(t.srv.acls[vid]))
+	if err != nil {
+		return err
+	}
+	t.srv.acls[vid] = copyACL(acl)
+	return nil
+}
+
+func (t *Client) GetRepairPolicy() (torus.RepairPolicy, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.repairPolicy, nil
+}
+
+func (t *Client) SetRepairPolicy(p torus.RepairPolicy) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.repairPolicy = p
+	return nil
+}
+
+func (t *Client) GetCapacityReserve() (torus.CapacityReserve, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.capacityReserve, nil
+}
+
+func (t *Client) SetCapacityReserve(r torus.CapacityReserve) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.capacityReserve = r
+	return nil
+}
+
+func (t *Client) GetVolumeQuota(vid torus.VolumeID) (uint64, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.quotas[vid], nil
+}
+
+func (t *Client) SetVolumeQuota(vid torus.VolumeID, quota uint64) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if quota == 0 {
+		delete(t.srv.quotas, vid)
+	} else {
+		t.srv.quotas[vid] = quota
+	}
+	return nil
+}
+
+func (t *Client) GetDefaultVolumeQuota() (uint64, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.volumeQuota, nil
+}
+
+func (t *Client) SetDefaultVolumeQuota(quota uint64) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.volumeQuota = quota
+	return nil
+}
+
+func (t *Client) SetEmergency(_ int64, e *torus.Emergency) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if e == nil {
+		delete(t.srv.emergencies, t.uuid)
+		return nil
+	}
+	x := *e
+	t.srv.emergencies[t.uuid] = &x
+	return nil
+}
+
+func (t *Client) GetEmergencies() ([]*torus.Emergency, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	var out []*torus.Emergency
+	for _, e := range t.srv.emergencies {
+		x := *e
+		out = append(out, &x)
+	}
+	return out, nil
+}
+
+func (t *Client) AnnounceDeparture(d *torus.Departure) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	x := *d
+	t.srv.departures[t.uuid] = &x
+	return nil
+}
+
+func (t *Client) ClearDeparture() error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	delete(t.srv.departures, t.uuid)
+	return nil
+}
+
+func (t *Client) GetDepartures() ([]*torus.Departure, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	var out []*torus.Departure
+	for _, d := range t.srv.departures {
+		if d.Expired() {
+			continue
+		}
+		x := *d
+		out = append(out, &x)
+	}
+	return out, nil
+}
+
+func (t *Client) SetDraining(uuid string, draining bool) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if draining {
+		t.srv.draining[uuid] = true
+	} else {
+		delete(t.srv.draining, uuid)
+	}
+	return nil
+}
+
+func (t *Client) GetDraining() ([]string, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	var out []string
+	for uuid := range t.srv.draining {
+		out = append(out, uuid)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (t *Client) SetJoinTokenHash(hash []byte) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if hash == nil {
+		t.srv.joinTokenHash = nil
+	} else {
+		t.srv.joinTokenHash = append([]byte(nil), hash...)
+	}
+	return nil
+}
+
+func (t *Client) GetJoinTokenHash() ([]byte, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	if t.srv.joinTokenHash == nil {
+		return nil, nil
+	}
+	return append([]byte(nil), t.srv.joinTokenHash...), nil
+}
+
+func (t *Client) DeregisterPeer(_ int64) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	for i, p := range t.srv.peers {
+		if p.UUID == t.uuid {
+			t.srv.peers = append(t.srv.peers[:i], t.srv.peers[i+1:]...)
+			break
+		}
+	}
+	delete(t.srv.emergencies, t.uuid)
+	return nil
+}
+
+func (t *Client) GetScrubControl() (torus.ScrubControl, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.scrubControl, nil
+}
+
+func (t *Client) SetScrubControl(sc torus.ScrubControl) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.scrubControl = sc
+	return nil
+}
+
+func (t *Client) SetScrubStatus(_ int64, s *torus.ScrubStatus) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	x := *s
+	t.srv.scrubStatuses[t.uuid] = &x
+	return nil
+}
+
+func (t *Client) GetScrubStatuses() ([]*torus.ScrubStatus, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	var out []*torus.ScrubStatus
+	for _, s := range t.srv.scrubStatuses {
+		x := *s
+		out = append(out, &x)
+	}
+	return out, nil
+}
+
+func (t *Client) ReportCorruptBlock(b torus.CorruptBlock) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	for i, x := range t.srv.corrupt {
+		if x.Peer == b.Peer && x.Ref == b.Ref {
+			t.srv.corrupt[i] = b
+			return nil
+		}
+	}
+	t.srv.corrupt = append(t.srv.corrupt, b)
+	return nil
+}
+
+func (t *Client) GetCorruptBlocks() ([]torus.CorruptBlock, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return append([]torus.CorruptBlock(nil), t.srv.corrupt...), nil
+}
+
+func (t *Client) RecordRebalance(r *torus.RebalanceRecord) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	x := *r
+	// Kept in the order etcd keeps it: by version, then by peer.
+	h := t.srv.rebalanceHistory
+	i := sort.Search(len(h), func(i int) bool {
+		return h[i].ToVersion > x.ToVersion || (h[i].ToVersion == x.ToVersion && h[i].Peer >= x.Peer)
+	})
+	if i < len(h) && h[i].ToVersion == x.ToVersion && h[i].Peer == x.Peer {
+		h[i] = &x
+		return nil
+	}
+	h = append(h, nil)
+	copy(h[i+1:], h[i:])
+	h[i] = &x
+	// Forget the oldest ring changes beyond the limit.
+	versions := 0
+	for i := len(h) - 1; i >= 0; i-- {
+		if i == len(h)-1 || h[i].ToVersion != h[i+1].ToVersion {
+			versions++
+		}
+		if versions > torus.RebalanceHistoryLen {
+			h = append([]*torus.RebalanceRecord(nil), h[i+1:]...)
+			break
+		}
+	}
+	t.srv.rebalanceHistory = h
+	return nil
+}
+
+func (t *Client) GetRebalanceHistory() ([]*torus.RebalanceRecord, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	var out []*torus.RebalanceRecord
+	for _, r := range t.srv.rebalanceHistory {
+		x := *r
+		out = append(out, &x)
+	}
+	return out, nil
+}
+
+func (t *Client) SaveRebalanceCheckpoint(cp *torus.RebalanceCheckpoint) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if cp == nil {
+		delete(t.srv.rebalanceCheckpoints, t.uuid)
+		return nil
+	}
+	x := *cp
+	t.srv.rebalanceCheckpoints[t.uuid] = &x
+	return nil
+}
+
+func (t *Client) GetRebalanceCheckpoint() (*torus.RebalanceCheckpoint, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	cp, ok := t.srv.rebalanceCheckpoints[t.uuid]
+	if !ok {
+		return nil, nil
+	}
+	x := *cp
+	return &x, nil
+}
+
+func (t *Client) SaveGCStatus(s *torus.GCStatus) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	x := *s
+	t.srv.gcStatuses[t.uuid] = &x
+	return nil
+}
+
+func (t *Client) GetGCStatus() (*torus.GCStatus, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	s, ok := t.srv.gcStatuses[t.uuid]
+	if !ok {
+		return nil, nil
+	}
+	x := *s
+	return &x, nil
+}
+
+func (t *Client) GetGCStatuses() ([]*torus.GCStatus, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	var out []*torus.GCStatus
+	for _, s := range t.srv.gcStatuses {
+		x := *s
+		out = append(out, &x)
+	}
+	return out, nil
+}
+
+func (t *Client) RequestFsck(req torus.FsckRequest) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.fsckRequest = req
+	return nil
+}
+
+func (t *Client) GetFsckRequest() (torus.FsckRequest, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	return t.srv.fsckRequest, nil
+}
+
+func (t *Client) SaveFsckReport(r *torus.FsckReport) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	x := *r
+	t.srv.fsckReports[t.uuid] = &x
+	return nil
+}
+
+func (t *Client) GetFsckReports() ([]*torus.FsckReport, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	var out []*torus.FsckReport
+	for _, r := range t.srv.fsckReports {
+		x := *r
+		out = append(out, &x)
+	}
+	return out, nil
+}
+
+func (t *Client) SaveRecoveryCheckpoint(cp *torus.RecoveryCheckpoint) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if cp == nil {
+		delete(t.srv.recoveryCheckpoints, t.uuid)
+		return nil
+	}
+	x := *cp
+	x.Failed = append(torus.PeerList(nil), cp.Failed...)
+	t.srv.recoveryCheckpoints[t.uuid] = &x
+	return nil
+}
+
+func (t *Client) GetRecoveryCheckpoint() (*torus.RecoveryCheckpoint, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	cp, ok := t.srv.recoveryCheckpoints[t.uuid]
+	if !ok {
+		return nil, nil
+	}
+	x := *cp
+	x.Failed = append(torus.PeerList(nil), cp.Failed...)
+	return &x, nil
+}
+
+func (t *Client) GetVolumeTenants() (map[torus.VolumeID]string, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	out := make(map[torus.VolumeID]string)
+	for vid, tenant := range t.srv.tenants {
+		out[vid] = tenant
+	}
+	return out, nil
+}
+
+func (t *Client) SetVolumeTenant(vid torus.VolumeID, tenant string) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	t.srv.tenants[vid] = tenant
+	return nil
+}
+
+func (t *Client) GetTenantQuotas() (map[string]torus.TenantQuota, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	out := make(map[string]torus.TenantQuota)
+	for tenant, q := range t.srv.tenantQuotas {
+		out[tenant] = q
+	}
+	return out, nil
+}
+
+func (t *Client) SetTenantQuota(tenant string, q torus.TenantQuota) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if q.Soft == 0 && q.Hard == 0 {
+		delete(t.srv.tenantQuotas, tenant)
+		return nil
+	}
+	t.srv.tenantQuotas[tenant] = q
+	return nil
+}
+
+func (t *Client) RenameVolume(from, to string) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	vol, ok := t.srv.volIndex[from]
+	if !ok {
+		return torus.ErrNotExist
+	}
+	if _, ok := t.srv.volIndex[to]; ok {
+		return torus.ErrExists
+	}
+	renamed := *vol
+	renamed.Name = to
+	delete(t.srv.volIndex, from)
+	t.srv.volIndex[to] = &renamed
+	return nil
+}
+
+func (t *Client) ResizeVolume(name string, size uint64) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	vol, ok := t.srv.volIndex[name]
+	if !ok {
+		return torus.ErrNotExist
+	}
+	resized := *vol
+	resized.MaxBytes = size
+	t.srv.volIndex[name] = &resized
+	return nil
+}
+
+func (t *Client) GetVolumeTags() (map[torus.VolumeID]map[string]string, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	out := make(map[torus.VolumeID]map[string]string)
+	for vid, tags := range t.srv.tags {
+		out[vid] = make(map[string]string)
+		for k, v := range tags {
+			out[vid][k] = v
+		}
+	}
+	return out, nil
+}
+
+func (t *Client) SetVolumeTag(vid torus.VolumeID, key, value string) error {
+	defer t.srv.volumeChanged(vid)
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	tags, ok := t.srv.tags[vid]
+	if !ok {
+		if value == "" {
+			return nil
+		}
+		tags = make(map[string]string)
+		t.srv.tags[vid] = tags
+	}
+	if value == "" {
+		delete(tags, key)
+		if len(tags) == 0 {
+			delete(t.srv.tags, vid)
+		}
+		return nil
+	}
+	tags[key] = value
+	return nil
+}
+
+func (t *Client) GetPools() (map[string]torus.Ring, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	out := make(map[string]torus.Ring)
+	for name, r := range t.srv.pools {
+		out[name] = r
+	}
+	return out, nil
+}
+
+func (t *Client) GetPool(name string) (torus.Ring, error) {
+	t.srv.mut.RLock()
+	defer t.srv.mut.RUnlock()
+	r, ok := t.srv.pools[name]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return r, nil
+}
+
+func (t *Client) CreatePool(name string, r torus.Ring) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if _, ok := t.srv.pools[name]; ok {
+		return torus.ErrExists
+	}
+	t.srv.pools[name] = r
+	return nil
+}
+
+func (t *Client) SetPoolRing(name string, r torus.Ring) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	old, ok := t.srv.pools[name]
+	if !ok {
+		return torus.ErrNotExist
+	}
+	if r.Version() <= old.Version() {
+		return torus.ErrNonSequentialRing
+	}
+	t.srv.pools[name] = r
+	return nil
+}
+
+func (t *Client) DeletePool(name string) error {
+	t.srv.mut.Lock()
+	defer t.srv.mut.Unlock()
+	if _, ok := t.srv.pools[name]; !ok {
+		return torus.ErrNotExist
+	}
+	delete(t.srv.pools, name)
+	return nil
+}
@@ -0,0 +1,37 @@
+package torus_test
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+func TestMetadataProviders(t *testing.T) {
+	torus.RegisterMetadataProvider("test-create-only", torus.MetadataProvider{
+		Create: func(cfg torus.Config) (torus.MetadataService, error) {
+			return nil, torus.ErrNotExist
+		},
+	})
+	found := false
+	for _, name := range torus.MetadataProviders() {
+		if name == "test-create-only" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("registered provider not listed")
+	}
+	_, err := torus.CreateMetadataService("test-create-only", torus.Config{})
+	if err != torus.ErrNotExist {
+		t.Fatalf("expected the provider's own error, got %v", err)
+	}
+	if err := torus.InitMDS("test-create-only", torus.Config{}, torus.GlobalMetadata{}, 0); err != torus.ErrNotSupported {
+		t.Fatalf("expected torus.ErrNotSupported from InitMDS, got %v", err)
+	}
+	if err := torus.WipeMDS("test-create-only", torus.Config{}); err != torus.ErrNotSupported {
+		t.Fatalf("expected torus.ErrNotSupported from WipeMDS, got %v", err)
+	}
+	if _, err := torus.CreateMetadataService("no-such-provider", torus.Config{}); err == nil {
+		t.Fatal("expected an error for an unregistered provider")
+	}
+}
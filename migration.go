@@ -0,0 +1,188 @@
+package torus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type MigrationState string
+
+const (
+	MigrationRunning MigrationState = "running"
+	MigrationDone    MigrationState = "done"
+	MigrationAborted MigrationState = "aborted"
+)
+
+// MigrationProgress is a single peer's report on a Migration.
+type MigrationProgress struct {
+	// Blocks is the number of the volume's blocks the peer held in its last
+	// pass.
+	Blocks uint64 `json:"blocks"`
+	// Sent is the number of blocks the peer copied to new homes in its last
+	// pass.
+	Sent uint64 `json:"sent"`
+	// Done is set once the peer has finished a clean pass that began after
+	// every writer knew of the migration.
+	Done bool `json:"done"`
+}
+
+// Migration is the record of a volume moving from one ring to another while
+// it's in use. While it runs, the volume's blocks are placed by both rings,
+// so that writes are mirrored to both placements while the rebalancer copies
+// the rest; once every peer has finished a pass, it's marked done, which
+// makes the new ring the volume's in a single step. The most recent
+// Migration of a volume also determines the ring it's placed by; see
+// Current and CurrentPool.
+type Migration struct {
+	Volume   string   `json:"volume"`
+	VolumeID VolumeID `json:"volume_id"`
+	// From and To are the marshalled rings the volume moves between. Empty
+	// means the cluster's ring, whatever it is at the time, unless FromPool
+	// or ToPool names the storage pool whose ring it is.
+	From     []byte                       `json:"from,omitempty"`
+	To       []byte                       `json:"to,omitempty"`
+	FromPool string                       `json:"from_pool,omitempty"`
+	ToPool   string                       `json:"to_pool,omitempty"`
+	State    MigrationState               `json:"state"`
+	Started  int64                        `json:"started"`
+	Finished int64                        `json:"finished,omitempty"`
+	Progress map[string]MigrationProgress `json:"progress,omitempty"`
+}
+
+// Current returns the marshalled ring the volume is placed by once the
+// migration is over, or nil for the cluster's ring; a running migration
+// counts as done.
+func (m *Migration) Current() []byte {
+	if m == nil {
+		return nil
+	}
+	if m.State == MigrationAborted {
+		return m.From
+	}
+	return m.To
+}
+
+// CurrentPool returns the pool the volume is in once the migration is over,
+// or "" if it isn't in one; a running migration counts as done.
+func (m *Migration) CurrentPool() string {
+	if m == nil {
+		return ""
+	}
+	if m.State == MigrationAborted {
+		return m.FromPool
+	}
+	return m.ToPool
+}
+
+// PeersDone returns how many of the given peers have finished migrating.
+func (m *Migration) PeersDone(members PeerList) int {
+	n := 0
+	for _, p := range members {
+		if m.Progress[p].Done {
+			n++
+		}
+	}
+	return n
+}
+
+// MigrationMetadataService is implemented by metadata services that can store
+// per-volume ring migrations.
+type MigrationMetadataService interface {
+	// GetMigration returns the latest migration of the volume, or
+	// ErrNotExist if it never had one.
+	GetMigration(vid VolumeID) (*Migration, error)
+	// ModifyMigration atomically applies f to the latest migration of the
+	// volume, which is nil if there is none, and stores the result. f may be
+	// called more than once.
+	ModifyMigration(vid VolumeID, f func(m *Migration) (*Migration, error)) (*Migration, error)
+}
+
+var errErasureMigration = errors.New("torus: erasure coded volumes can't be moved to another ring")
+
+// StartMigration begins moving the named volume to ring to, or back to the
+// cluster's ring if to is nil. Every peer of to must be a member of the
+// cluster's ring; volumes are moved onto other peers with storage pools.
+func StartMigration(mds MetadataService, volume string, to Ring) (*Migration, error) {
+	var toBytes []byte
+	if to != nil {
+		cluster, err := mds.GetRing()
+		if err != nil {
+			return nil, err
+		}
+		members := to.Members()
+		if len(members) == 0 {
+			return nil, ErrInvalid
+		}
+		if missing := members.AndNot(cluster.Members()); len(missing) != 0 {
+			return nil, fmt.Errorf("torus: peers %v aren't members of the cluster's ring", missing)
+		}
+		toBytes, err = to.Marshal()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return startMigration(mds, volume, toBytes, "")
+}
+
+// startMigration begins moving the named volume to the marshalled ring to,
+// or to the named pool's ring.
+func startMigration(mds MetadataService, volume string, to []byte, toPool string) (*Migration, error) {
+	mmds, ok := mds.(MigrationMetadataService)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return nil, err
+	}
+	vid := VolumeID(vol.Id)
+	red, err := GetRedundancy(mds, vid)
+	if err != nil {
+		return nil, err
+	}
+	if red.Kind == ErasureCoded {
+		return nil, errErasureMigration
+	}
+	return mmds.ModifyMigration(vid, func(m *Migration) (*Migration, error) {
+		if m != nil && m.State == MigrationRunning {
+			return nil, ErrExists
+		}
+		from, fromPool := m.Current(), m.CurrentPool()
+		if bytes.Equal(from, to) && fromPool == toPool {
+			return nil, ErrInvalid
+		}
+		return &Migration{
+			Volume:   volume,
+			VolumeID: vid,
+			From:     from,
+			To:       to,
+			FromPool: fromPool,
+			ToPool:   toPool,
+			State:    MigrationRunning,
+			Started:  time.Now().UnixNano(),
+		}, nil
+	})
+}
+
+// AbortMigration moves the named volume back to the ring it was on before
+// its running migration.
+func AbortMigration(mds MetadataService, volume string) (*Migration, error) {
+	mmds, ok := mds.(MigrationMetadataService)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return nil, err
+	}
+	return mmds.ModifyMigration(VolumeID(vol.Id), func(m *Migration) (*Migration, error) {
+		if m == nil || m.State != MigrationRunning {
+			return nil, ErrNotExist
+		}
+		m.State = MigrationAborted
+		m.Finished = time.Now().UnixNano()
+		return m, nil
+	})
+}
@@ -0,0 +1,678 @@
+// Code generated by protoc-gen-gogo.
+// source: hints.proto
+// DO NOT EDIT!
+
+/*
+	Package models is a generated protocol buffer package.
+
+	It is generated from these files:
+		hints.proto
+		placement.proto
+		rpc.proto
+		torus.proto
+		transfer.proto
+
+	It has these top-level messages:
+		PutHintedBlockRequest
+		DrainHintsRequest
+		LocateBlocksRequest
+		BlockPlacement
+		LocateBlocksResponse
+		LocateVolumeRequest
+		PeerShare
+		LocateVolumeResponse
+		BlockRequest
+		BlockResponse
+		PutBlockRequest
+		PutResponse
+		RebalanceCheckRequest
+		RebalanceCheckResponse
+		INode
+		BlockLayer
+		Volume
+		PeerInfo
+		RebalanceInfo
+		Ring
+		BlockRef
+		INodeRef
+		TransferBlock
+		TransferAck
+*/
+package models
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import _ "github.com/gogo/protobuf/gogoproto"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+import io "io"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+const _ = proto.GoGoProtoPackageIsVersion1
+
+type PutHintedBlockRequest struct {
+	Peer string    `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"`
+	Ref  *BlockRef `protobuf:"bytes,2,opt,name=ref" json:"ref,omitempty"`
+	Data []byte    `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *PutHintedBlockRequest) Reset()                    { *m = PutHintedBlockRequest{} }
+func (m *PutHintedBlockRequest) String() string            { return proto.CompactTextString(m) }
+func (*PutHintedBlockRequest) ProtoMessage()               {}
+func (*PutHintedBlockRequest) Descriptor() ([]byte, []int) { return fileDescriptorHints, []int{0} }
+
+func (m *PutHintedBlockRequest) GetRef() *BlockRef {
+	if m != nil {
+		return m.Ref
+	}
+	return nil
+}
+
+type DrainHintsRequest struct {
+	Peer string `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"`
+}
+
+func (m *DrainHintsRequest) Reset()                    { *m = DrainHintsRequest{} }
+func (m *DrainHintsRequest) String() string            { return proto.CompactTextString(m) }
+func (*DrainHintsRequest) ProtoMessage()               {}
+func (*DrainHintsRequest) Descriptor() ([]byte, []int) { return fileDescriptorHints, []int{1} }
+
+func init() {
+	proto.RegisterType((*PutHintedBlockRequest)(nil), "models.PutHintedBlockRequest")
+	proto.RegisterType((*DrainHintsRequest)(nil), "models.DrainHintsRequest")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion2
+
+// Client API for TorusHints service
+
+type TorusHintsClient interface {
+	PutHintedBlock(ctx context.Context, in *PutHintedBlockRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	DrainHints(ctx context.Context, in *DrainHintsRequest, opts ...grpc.CallOption) (*PutResponse, error)
+}
+
+type torusHintsClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTorusHintsClient(cc *grpc.ClientConn) TorusHintsClient {
+	return &torusHintsClient{cc}
+}
+
+func (c *torusHintsClient) PutHintedBlock(ctx context.Context, in *PutHintedBlockRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := grpc.Invoke(ctx, "/models.TorusHints/PutHintedBlock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torusHintsClient) DrainHints(ctx context.Context, in *DrainHintsRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := grpc.Invoke(ctx, "/models.TorusHints/DrainHints", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for TorusHints service
+
+type TorusHintsServer interface {
+	PutHintedBlock(context.Context, *PutHintedBlockRequest) (*PutResponse, error)
+	DrainHints(context.Context, *DrainHintsRequest) (*PutResponse, error)
+}
+
+func RegisterTorusHintsServer(s *grpc.Server, srv TorusHintsServer) {
+	s.RegisterService(&_TorusHints_serviceDesc, srv)
+}
+
+func _TorusHints_PutHintedBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutHintedBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorusHintsServer).PutHintedBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/models.TorusHints/PutHintedBlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorusHintsServer).PutHintedBlock(ctx, req.(*PutHintedBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorusHints_DrainHints_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainHintsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorusHintsServer).DrainHints(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/models.TorusHints/DrainHints",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorusHintsServer).DrainHints(ctx, req.(*DrainHintsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TorusHints_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "models.TorusHints",
+	HandlerType: (*TorusHintsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PutHintedBlock",
+			Handler:    _TorusHints_PutHintedBlock_Handler,
+		},
+		{
+			MethodName: "DrainHints",
+			Handler:    _TorusHints_DrainHints_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func (m *PutHintedBlockRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *PutHintedBlockRequest) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Peer) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintHints(data, i, uint64(len(m.Peer)))
+		i += copy(data[i:], m.Peer)
+	}
+	if m.Ref != nil {
+		data[i] = 0x12
+		i++
+		i = encodeVarintHints(data, i, uint64(m.Ref.Size()))
+		n1, err := m.Ref.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n1
+	}
+	if len(m.Data) > 0 {
+		data[i] = 0x1a
+		i++
+		i = encodeVarintHints(data, i, uint64(len(m.Data)))
+		i += copy(data[i:], m.Data)
+	}
+	return i, nil
+}
+
+func (m *DrainHintsRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *DrainHintsRequest) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Peer) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintHints(data, i, uint64(len(m.Peer)))
+		i += copy(data[i:], m.Peer)
+	}
+	return i, nil
+}
+
+func encodeFixed64Hints(data []byte, offset int, v uint64) int {
+	data[offset] = uint8(v)
+	data[offset+1] = uint8(v >> 8)
+	data[offset+2] = uint8(v >> 16)
+	data[offset+3] = uint8(v >> 24)
+	data[offset+4] = uint8(v >> 32)
+	data[offset+5] = uint8(v >> 40)
+	data[offset+6] = uint8(v >> 48)
+	data[offset+7] = uint8(v >> 56)
+	return offset + 8
+}
+func encodeFixed32Hints(data []byte, offset int, v uint32) int {
+	data[offset] = uint8(v)
+	data[offset+1] = uint8(v >> 8)
+	data[offset+2] = uint8(v >> 16)
+	data[offset+3] = uint8(v >> 24)
+	return offset + 4
+}
+func encodeVarintHints(data []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		data[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	data[offset] = uint8(v)
+	return offset + 1
+}
+func (m *PutHintedBlockRequest) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Peer)
+	if l > 0 {
+		n += 1 + l + sovHints(uint64(l))
+	}
+	if m.Ref != nil {
+		l = m.Ref.Size()
+		n += 1 + l + sovHints(uint64(l))
+	}
+	l = len(m.Data)
+	if l > 0 {
+		n += 1 + l + sovHints(uint64(l))
+	}
+	return n
+}
+
+func (m *DrainHintsRequest) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Peer)
+	if l > 0 {
+		n += 1 + l + sovHints(uint64(l))
+	}
+	return n
+}
+
+func sovHints(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozHints(x uint64) (n int) {
+	return sovHints(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *PutHintedBlockRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowHints
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PutHintedBlockRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PutHintedBlockRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Peer", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Peer = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Ref", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Ref == nil {
+				m.Ref = &BlockRef{}
+			}
+			if err := m.Ref.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], data[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipHints(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthHints
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *DrainHintsRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowHints
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DrainHintsRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DrainHintsRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Peer", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Peer = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipHints(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthHints
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipHints(data []byte) (n int, err error) {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowHints
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if data[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			iNdEx += length
+			if length < 0 {
+				return 0, ErrInvalidLengthHints
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowHints
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := data[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipHints(data[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthHints = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowHints   = fmt.Errorf("proto: integer overflow")
+)
+
+var fileDescriptorHints = []byte{
+	// 265 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x90, 0xcd, 0x4a, 0xc3, 0x40,
+	0x14, 0x85, 0x33, 0x56, 0x0a, 0xbd, 0x11, 0xd1, 0x11, 0x21, 0x06, 0x1c, 0x42, 0x36, 0x66, 0x63,
+	0x0a, 0x75, 0xeb, 0xaa, 0x74, 0xe1, 0x52, 0x06, 0x5f, 0x20, 0x3f, 0x93, 0x34, 0xd8, 0xe6, 0xc6,
+	0xf9, 0x79, 0x8f, 0x3e, 0x96, 0xcb, 0x2e, 0x5d, 0x4a, 0xf2, 0x22, 0x92, 0x49, 0x8b, 0x8a, 0xc1,
+	0xdd, 0xb9, 0x9c, 0x73, 0xe6, 0x7c, 0x0c, 0xb8, 0xeb, 0xaa, 0xd6, 0x2a, 0x6e, 0x24, 0x6a, 0xa4,
+	0xd3, 0x2d, 0xe6, 0x62, 0xa3, 0xfc, 0xfb, 0xb2, 0xd2, 0x6b, 0x93, 0xc6, 0x19, 0x6e, 0xe7, 0x25,
+	0x96, 0x38, 0xb7, 0x76, 0x6a, 0x0a, 0x7b, 0xd9, 0xc3, 0xaa, 0xa1, 0xe6, 0xbb, 0x1a, 0xa5, 0x39,
+	0xbc, 0xe1, 0xcf, 0x64, 0x93, 0x0d, 0x32, 0xcc, 0xe0, 0xfa, 0xd9, 0xe8, 0xa7, 0xaa, 0xd6, 0x22,
+	0x5f, 0x6e, 0x30, 0x7b, 0xe5, 0xe2, 0xcd, 0x08, 0xa5, 0x29, 0x85, 0xd3, 0x46, 0x08, 0xe9, 0x91,
+	0x80, 0x44, 0x33, 0x6e, 0x35, 0x0d, 0x61, 0x22, 0x45, 0xe1, 0x9d, 0x04, 0x24, 0x72, 0x17, 0x17,
+	0xf1, 0x40, 0x12, 0x1f, 0x6a, 0x05, 0xef, 0xcd, 0xbe, 0x97, 0x27, 0x3a, 0xf1, 0x26, 0x01, 0x89,
+	0xce, 0xb8, 0xd5, 0xe1, 0x1d, 0x5c, 0xae, 0x64, 0x52, 0xd5, 0xfd, 0x8c, 0xfa, 0x67, 0x60, 0xb1,
+	0x23, 0x00, 0x2f, 0x3d, 0xa8, 0x4d, 0xd2, 0x15, 0x9c, 0xff, 0x86, 0xa3, 0xb7, 0xc7, 0xd1, 0x51,
+	0x68, 0xff, 0xea, 0x87, 0xcd, 0x85, 0x6a, 0xb0, 0x56, 0x82, 0x3e, 0x02, 0x7c, 0xaf, 0xd3, 0x9b,
+	0x63, 0xe4, 0x0f, 0xd1, 0x68, 0x7b, 0xe9, 0xbd, 0xb7, 0x8c, 0xec, 0x5b, 0x46, 0x3e, 0x5b, 0x46,
+	0x76, 0x1d, 0x73, 0xf6, 0x1d, 0x73, 0x3e, 0x3a, 0xe6, 0xa4, 0x53, 0xfb, 0x83, 0x0f, 0x5f, 0x03,
+	0x00, 0x17, 0x3c, 0xf1, 0x70, 0x9f, 0x01, 0x00, 0x00,
+}
@@ -0,0 +1,2143 @@
+// Code generated by protoc-gen-gogo.
+// source: placement.proto
+// DO NOT EDIT!
+
+package models
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import _ "github.com/gogo/protobuf/gogoproto"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+import io "io"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type LocateBlocksRequest struct {
+	BlockRefs []*BlockRef `protobuf:"bytes,1,rep,name=block_refs" json:"block_refs,omitempty"`
+}
+
+func (m *LocateBlocksRequest) Reset()                    { *m = LocateBlocksRequest{} }
+func (m *LocateBlocksRequest) String() string            { return proto.CompactTextString(m) }
+func (*LocateBlocksRequest) ProtoMessage()               {}
+func (*LocateBlocksRequest) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{0} }
+
+func (m *LocateBlocksRequest) GetBlockRefs() []*BlockRef {
+	if m != nil {
+		return m.BlockRefs
+	}
+	return nil
+}
+
+type BlockPlacement struct {
+	BlockRef *BlockRef `protobuf:"bytes,1,opt,name=block_ref" json:"block_ref,omitempty"`
+	// Peers are the UUIDs of the peers responsible for the block, in order of
+	// preference.
+	Peers []string `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *BlockPlacement) Reset()                    { *m = BlockPlacement{} }
+func (m *BlockPlacement) String() string            { return proto.CompactTextString(m) }
+func (*BlockPlacement) ProtoMessage()               {}
+func (*BlockPlacement) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{1} }
+
+func (m *BlockPlacement) GetBlockRef() *BlockRef {
+	if m != nil {
+		return m.BlockRef
+	}
+	return nil
+}
+
+type LocateBlocksResponse struct {
+	Placements []*BlockPlacement `protobuf:"bytes,1,rep,name=placements" json:"placements,omitempty"`
+	// Peers holds the address of every peer named in placements.
+	Peers []*PeerInfo `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *LocateBlocksResponse) Reset()                    { *m = LocateBlocksResponse{} }
+func (m *LocateBlocksResponse) String() string            { return proto.CompactTextString(m) }
+func (*LocateBlocksResponse) ProtoMessage()               {}
+func (*LocateBlocksResponse) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{2} }
+
+func (m *LocateBlocksResponse) GetPlacements() []*BlockPlacement {
+	if m != nil {
+		return m.Placements
+	}
+	return nil
+}
+
+func (m *LocateBlocksResponse) GetPeers() []*PeerInfo {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+type LocateVolumeRequest struct {
+	Volume string `protobuf:"bytes,1,opt,name=volume,proto3" json:"volume,omitempty"`
+}
+
+func (m *LocateVolumeRequest) Reset()                    { *m = LocateVolumeRequest{} }
+func (m *LocateVolumeRequest) String() string            { return proto.CompactTextString(m) }
+func (*LocateVolumeRequest) ProtoMessage()               {}
+func (*LocateVolumeRequest) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{3} }
+
+type PeerShare struct {
+	UUID string `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	// Blocks is how many of the volume's blocks the peer is responsible for.
+	Blocks uint64 `protobuf:"varint,2,opt,name=blocks,proto3" json:"blocks,omitempty"`
+	// Primary is how many of those blocks the peer is first in line for.
+	Primary uint64 `protobuf:"varint,3,opt,name=primary,proto3" json:"primary,omitempty"`
+}
+
+func (m *PeerShare) Reset()                    { *m = PeerShare{} }
+func (m *PeerShare) String() string            { return proto.CompactTextString(m) }
+func (*PeerShare) ProtoMessage()               {}
+func (*PeerShare) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{4} }
+
+type LocateVolumeResponse struct {
+	Volume *Volume `protobuf:"bytes,1,opt,name=volume" json:"volume,omitempty"`
+	Blocks uint64  `protobuf:"varint,2,opt,name=blocks,proto3" json:"blocks,omitempty"`
+	// Shares are sorted by number of blocks, largest first.
+	Shares []*PeerShare `protobuf:"bytes,3,rep,name=shares" json:"shares,omitempty"`
+	Peers  []*PeerInfo  `protobuf:"bytes,4,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *LocateVolumeResponse) Reset()                    { *m = LocateVolumeResponse{} }
+func (m *LocateVolumeResponse) String() string            { return proto.CompactTextString(m) }
+func (*LocateVolumeResponse) ProtoMessage()               {}
+func (*LocateVolumeResponse) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{5} }
+
+func (m *LocateVolumeResponse) GetVolume() *Volume {
+	if m != nil {
+		return m.Volume
+	}
+	return nil
+}
+
+func (m *LocateVolumeResponse) GetShares() []*PeerShare {
+	if m != nil {
+		return m.Shares
+	}
+	return nil
+}
+
+func (m *LocateVolumeResponse) GetPeers() []*PeerInfo {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+type SimulateRingRequest struct {
+	// Ring is the proposed ring, as it would be passed to SetRing.
+	Ring *Ring `protobuf:"bytes,1,opt,name=ring" json:"ring,omitempty"`
+}
+
+func (m *SimulateRingRequest) Reset()                    { *m = SimulateRingRequest{} }
+func (m *SimulateRingRequest) String() string            { return proto.CompactTextString(m) }
+func (*SimulateRingRequest) ProtoMessage()               {}
+func (*SimulateRingRequest) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{6} }
+
+func (m *SimulateRingRequest) GetRing() *Ring {
+	if m != nil {
+		return m.Ring
+	}
+	return nil
+}
+
+type PeerSimulation struct {
+	UUID string `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	// TotalBlocks is the peer's capacity, in blocks.
+	TotalBlocks uint64 `protobuf:"varint,2,opt,name=total_blocks,proto3" json:"total_blocks,omitempty"`
+	// Before and After are how many of the cluster's blocks the peer is
+	// responsible for under the current and the proposed ring.
+	Before uint64 `protobuf:"varint,3,opt,name=before,proto3" json:"before,omitempty"`
+	After  uint64 `protobuf:"varint,4,opt,name=after,proto3" json:"after,omitempty"`
+	// Received is how many blocks would be sent to the peer.
+	Received uint64 `protobuf:"varint,5,opt,name=received,proto3" json:"received,omitempty"`
+}
+
+func (m *PeerSimulation) Reset()                    { *m = PeerSimulation{} }
+func (m *PeerSimulation) String() string            { return proto.CompactTextString(m) }
+func (*PeerSimulation) ProtoMessage()               {}
+func (*PeerSimulation) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{7} }
+
+type SimulateRingResponse struct {
+	// Blocks is the number of blocks in the cluster's block volumes.
+	Blocks uint64 `protobuf:"varint,1,opt,name=blocks,proto3" json:"blocks,omitempty"`
+	// Moved is the number of replicas that would be sent between peers.
+	Moved uint64 `protobuf:"varint,2,opt,name=moved,proto3" json:"moved,omitempty"`
+	// Peers covers every member of either ring.
+	Peers    []*PeerSimulation `protobuf:"bytes,3,rep,name=peers" json:"peers,omitempty"`
+	Warnings []string          `protobuf:"bytes,4,rep,name=warnings" json:"warnings,omitempty"`
+	// Refusals are reasons the change would be unsafe.
+	Refusals []string `protobuf:"bytes,5,rep,name=refusals" json:"refusals,omitempty"`
+}
+
+func (m *SimulateRingResponse) Reset()                    { *m = SimulateRingResponse{} }
+func (m *SimulateRingResponse) String() string            { return proto.CompactTextString(m) }
+func (*SimulateRingResponse) ProtoMessage()               {}
+func (*SimulateRingResponse) Descriptor() ([]byte, []int) { return fileDescriptorPlacement, []int{8} }
+
+func (m *SimulateRingResponse) GetPeers() []*PeerSimulation {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*LocateBlocksRequest)(nil), "models.LocateBlocksRequest")
+	proto.RegisterType((*BlockPlacement)(nil), "models.BlockPlacement")
+	proto.RegisterType((*LocateBlocksResponse)(nil), "models.LocateBlocksResponse")
+	proto.RegisterType((*LocateVolumeRequest)(nil), "models.LocateVolumeRequest")
+	proto.RegisterType((*PeerShare)(nil), "models.PeerShare")
+	proto.RegisterType((*LocateVolumeResponse)(nil), "models.LocateVolumeResponse")
+	proto.RegisterType((*SimulateRingRequest)(nil), "models.SimulateRingRequest")
+	proto.RegisterType((*PeerSimulation)(nil), "models.PeerSimulation")
+	proto.RegisterType((*SimulateRingResponse)(nil), "models.SimulateRingResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion2
+
+// Client API for TorusPlacement service
+
+type TorusPlacementClient interface {
+	LocateBlocks(ctx context.Context, in *LocateBlocksRequest, opts ...grpc.CallOption) (*LocateBlocksResponse, error)
+	LocateVolume(ctx context.Context, in *LocateVolumeRequest, opts ...grpc.CallOption) (*LocateVolumeResponse, error)
+	SimulateRing(ctx context.Context, in *SimulateRingRequest, opts ...grpc.CallOption) (*SimulateRingResponse, error)
+}
+
+type torusPlacementClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTorusPlacementClient(cc *grpc.ClientConn) TorusPlacementClient {
+	return &torusPlacementClient{cc}
+}
+
+func (c *torusPlacementClient) LocateBlocks(ctx context.Context, in *LocateBlocksRequest, opts ...grpc.CallOption) (*LocateBlocksResponse, error) {
+	out := new(LocateBlocksResponse)
+	err := grpc.Invoke(ctx, "/models.TorusPlacement/LocateBlocks", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torusPlacementClient) LocateVolume(ctx context.Context, in *LocateVolumeRequest, opts ...grpc.CallOption) (*LocateVolumeResponse, error) {
+	out := new(LocateVolumeResponse)
+	err := grpc.Invoke(ctx, "/models.TorusPlacement/LocateVolume", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torusPlacementClient) SimulateRing(ctx context.Context, in *SimulateRingRequest, opts ...grpc.CallOption) (*SimulateRingResponse, error) {
+	out := new(SimulateRingResponse)
+	err := grpc.Invoke(ctx, "/models.TorusPlacement/SimulateRing", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for TorusPlacement service
+
+type TorusPlacementServer interface {
+	LocateBlocks(context.Context, *LocateBlocksRequest) (*LocateBlocksResponse, error)
+	LocateVolume(context.Context, *LocateVolumeRequest) (*LocateVolumeResponse, error)
+	SimulateRing(context.Context, *SimulateRingRequest) (*SimulateRingResponse, error)
+}
+
+func RegisterTorusPlacementServer(s *grpc.Server, srv TorusPlacementServer) {
+	s.RegisterService(&_TorusPlacement_serviceDesc, srv)
+}
+
+func _TorusPlacement_LocateBlocks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LocateBlocksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorusPlacementServer).LocateBlocks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/models.TorusPlacement/LocateBlocks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorusPlacementServer).LocateBlocks(ctx, req.(*LocateBlocksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorusPlacement_LocateVolume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LocateVolumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorusPlacementServer).LocateVolume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/models.TorusPlacement/LocateVolume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorusPlacementServer).LocateVolume(ctx, req.(*LocateVolumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorusPlacement_SimulateRing_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SimulateRingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorusPlacementServer).SimulateRing(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/models.TorusPlacement/SimulateRing",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorusPlacementServer).SimulateRing(ctx, req.(*SimulateRingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TorusPlacement_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "models.TorusPlacement",
+	HandlerType: (*TorusPlacementServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "LocateBlocks",
+			Handler:    _TorusPlacement_LocateBlocks_Handler,
+		},
+		{
+			MethodName: "LocateVolume",
+			Handler:    _TorusPlacement_LocateVolume_Handler,
+		},
+		{
+			MethodName: "SimulateRing",
+			Handler:    _TorusPlacement_SimulateRing_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func (m *LocateBlocksRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *LocateBlocksRequest) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.BlockRefs) > 0 {
+		for _, msg := range m.BlockRefs {
+			data[i] = 0xa
+			i++
+			i = encodeVarintPlacement(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *BlockPlacement) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *BlockPlacement) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.BlockRef != nil {
+		data[i] = 0xa
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.BlockRef.Size()))
+		n1, err := m.BlockRef.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n1
+	}
+	if len(m.Peers) > 0 {
+		for _, s := range m.Peers {
+			data[i] = 0x12
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				data[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			data[i] = uint8(l)
+			i++
+			i += copy(data[i:], s)
+		}
+	}
+	return i, nil
+}
+
+func (m *LocateBlocksResponse) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *LocateBlocksResponse) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Placements) > 0 {
+		for _, msg := range m.Placements {
+			data[i] = 0xa
+			i++
+			i = encodeVarintPlacement(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if len(m.Peers) > 0 {
+		for _, msg := range m.Peers {
+			data[i] = 0x12
+			i++
+			i = encodeVarintPlacement(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *LocateVolumeRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *LocateVolumeRequest) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Volume) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintPlacement(data, i, uint64(len(m.Volume)))
+		i += copy(data[i:], m.Volume)
+	}
+	return i, nil
+}
+
+func (m *PeerShare) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *PeerShare) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.UUID) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintPlacement(data, i, uint64(len(m.UUID)))
+		i += copy(data[i:], m.UUID)
+	}
+	if m.Blocks != 0 {
+		data[i] = 0x10
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Blocks))
+	}
+	if m.Primary != 0 {
+		data[i] = 0x18
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Primary))
+	}
+	return i, nil
+}
+
+func (m *LocateVolumeResponse) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *LocateVolumeResponse) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Volume != nil {
+		data[i] = 0xa
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Volume.Size()))
+		n2, err := m.Volume.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n2
+	}
+	if m.Blocks != 0 {
+		data[i] = 0x10
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Blocks))
+	}
+	if len(m.Shares) > 0 {
+		for _, msg := range m.Shares {
+			data[i] = 0x1a
+			i++
+			i = encodeVarintPlacement(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if len(m.Peers) > 0 {
+		for _, msg := range m.Peers {
+			data[i] = 0x22
+			i++
+			i = encodeVarintPlacement(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *SimulateRingRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *SimulateRingRequest) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Ring != nil {
+		data[i] = 0xa
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Ring.Size()))
+		n3, err := m.Ring.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n3
+	}
+	return i, nil
+}
+
+func (m *PeerSimulation) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *PeerSimulation) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.UUID) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintPlacement(data, i, uint64(len(m.UUID)))
+		i += copy(data[i:], m.UUID)
+	}
+	if m.TotalBlocks != 0 {
+		data[i] = 0x10
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.TotalBlocks))
+	}
+	if m.Before != 0 {
+		data[i] = 0x18
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Before))
+	}
+	if m.After != 0 {
+		data[i] = 0x20
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.After))
+	}
+	if m.Received != 0 {
+		data[i] = 0x28
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Received))
+	}
+	return i, nil
+}
+
+func (m *SimulateRingResponse) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *SimulateRingResponse) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Blocks != 0 {
+		data[i] = 0x8
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Blocks))
+	}
+	if m.Moved != 0 {
+		data[i] = 0x10
+		i++
+		i = encodeVarintPlacement(data, i, uint64(m.Moved))
+	}
+	if len(m.Peers) > 0 {
+		for _, msg := range m.Peers {
+			data[i] = 0x1a
+			i++
+			i = encodeVarintPlacement(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			data[i] = 0x22
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				data[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			data[i] = uint8(l)
+			i++
+			i += copy(data[i:], s)
+		}
+	}
+	if len(m.Refusals) > 0 {
+		for _, s := range m.Refusals {
+			data[i] = 0x2a
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				data[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			data[i] = uint8(l)
+			i++
+			i += copy(data[i:], s)
+		}
+	}
+	return i, nil
+}
+
+func encodeFixed64Placement(data []byte, offset int, v uint64) int {
+	data[offset] = uint8(v)
+	data[offset+1] = uint8(v >> 8)
+	data[offset+2] = uint8(v >> 16)
+	data[offset+3] = uint8(v >> 24)
+	data[offset+4] = uint8(v >> 32)
+	data[offset+5] = uint8(v >> 40)
+	data[offset+6] = uint8(v >> 48)
+	data[offset+7] = uint8(v >> 56)
+	return offset + 8
+}
+func encodeFixed32Placement(data []byte, offset int, v uint32) int {
+	data[offset] = uint8(v)
+	data[offset+1] = uint8(v >> 8)
+	data[offset+2] = uint8(v >> 16)
+	data[offset+3] = uint8(v >> 24)
+	return offset + 4
+}
+func encodeVarintPlacement(data []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		data[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	data[offset] = uint8(v)
+	return offset + 1
+}
+func (m *LocateBlocksRequest) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.BlockRefs) > 0 {
+		for _, e := range m.BlockRefs {
+			l = e.Size()
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *BlockPlacement) Size() (n int) {
+	var l int
+	_ = l
+	if m.BlockRef != nil {
+		l = m.BlockRef.Size()
+		n += 1 + l + sovPlacement(uint64(l))
+	}
+	if len(m.Peers) > 0 {
+		for _, s := range m.Peers {
+			l = len(s)
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *LocateBlocksResponse) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.Placements) > 0 {
+		for _, e := range m.Placements {
+			l = e.Size()
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	if len(m.Peers) > 0 {
+		for _, e := range m.Peers {
+			l = e.Size()
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *LocateVolumeRequest) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Volume)
+	if l > 0 {
+		n += 1 + l + sovPlacement(uint64(l))
+	}
+	return n
+}
+
+func (m *PeerShare) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.UUID)
+	if l > 0 {
+		n += 1 + l + sovPlacement(uint64(l))
+	}
+	if m.Blocks != 0 {
+		n += 1 + sovPlacement(uint64(m.Blocks))
+	}
+	if m.Primary != 0 {
+		n += 1 + sovPlacement(uint64(m.Primary))
+	}
+	return n
+}
+
+func (m *LocateVolumeResponse) Size() (n int) {
+	var l int
+	_ = l
+	if m.Volume != nil {
+		l = m.Volume.Size()
+		n += 1 + l + sovPlacement(uint64(l))
+	}
+	if m.Blocks != 0 {
+		n += 1 + sovPlacement(uint64(m.Blocks))
+	}
+	if len(m.Shares) > 0 {
+		for _, e := range m.Shares {
+			l = e.Size()
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	if len(m.Peers) > 0 {
+		for _, e := range m.Peers {
+			l = e.Size()
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *SimulateRingRequest) Size() (n int) {
+	var l int
+	_ = l
+	if m.Ring != nil {
+		l = m.Ring.Size()
+		n += 1 + l + sovPlacement(uint64(l))
+	}
+	return n
+}
+
+func (m *PeerSimulation) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.UUID)
+	if l > 0 {
+		n += 1 + l + sovPlacement(uint64(l))
+	}
+	if m.TotalBlocks != 0 {
+		n += 1 + sovPlacement(uint64(m.TotalBlocks))
+	}
+	if m.Before != 0 {
+		n += 1 + sovPlacement(uint64(m.Before))
+	}
+	if m.After != 0 {
+		n += 1 + sovPlacement(uint64(m.After))
+	}
+	if m.Received != 0 {
+		n += 1 + sovPlacement(uint64(m.Received))
+	}
+	return n
+}
+
+func (m *SimulateRingResponse) Size() (n int) {
+	var l int
+	_ = l
+	if m.Blocks != 0 {
+		n += 1 + sovPlacement(uint64(m.Blocks))
+	}
+	if m.Moved != 0 {
+		n += 1 + sovPlacement(uint64(m.Moved))
+	}
+	if len(m.Peers) > 0 {
+		for _, e := range m.Peers {
+			l = e.Size()
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			l = len(s)
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	if len(m.Refusals) > 0 {
+		for _, s := range m.Refusals {
+			l = len(s)
+			n += 1 + l + sovPlacement(uint64(l))
+		}
+	}
+	return n
+}
+
+func sovPlacement(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozPlacement(x uint64) (n int) {
+	return sovPlacement(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *LocateBlocksRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: LocateBlocksRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LocateBlocksRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockRefs", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BlockRefs = append(m.BlockRefs, &BlockRef{})
+			if err := m.BlockRefs[len(m.BlockRefs)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *BlockPlacement) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BlockPlacement: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BlockPlacement: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockRef", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.BlockRef == nil {
+				m.BlockRef = &BlockRef{}
+			}
+			if err := m.BlockRef.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Peers", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Peers = append(m.Peers, string(data[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *LocateBlocksResponse) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: LocateBlocksResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LocateBlocksResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Placements", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Placements = append(m.Placements, &BlockPlacement{})
+			if err := m.Placements[len(m.Placements)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Peers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Peers = append(m.Peers, &PeerInfo{})
+			if err := m.Peers[len(m.Peers)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *LocateVolumeRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: LocateVolumeRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LocateVolumeRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Volume", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Volume = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *PeerShare) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PeerShare: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PeerShare: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UUID", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.UUID = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Blocks", wireType)
+			}
+			m.Blocks = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Blocks |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Primary", wireType)
+			}
+			m.Primary = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Primary |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *LocateVolumeResponse) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: LocateVolumeResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LocateVolumeResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Volume", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Volume == nil {
+				m.Volume = &Volume{}
+			}
+			if err := m.Volume.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Blocks", wireType)
+			}
+			m.Blocks = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Blocks |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Shares", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Shares = append(m.Shares, &PeerShare{})
+			if err := m.Shares[len(m.Shares)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Peers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Peers = append(m.Peers, &PeerInfo{})
+			if err := m.Peers[len(m.Peers)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SimulateRingRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SimulateRingRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SimulateRingRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Ring", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Ring == nil {
+				m.Ring = &Ring{}
+			}
+			if err := m.Ring.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *PeerSimulation) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PeerSimulation: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PeerSimulation: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UUID", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.UUID = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TotalBlocks", wireType)
+			}
+			m.TotalBlocks = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.TotalBlocks |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Before", wireType)
+			}
+			m.Before = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Before |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field After", wireType)
+			}
+			m.After = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.After |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Received", wireType)
+			}
+			m.Received = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Received |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SimulateRingResponse) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SimulateRingResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SimulateRingResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Blocks", wireType)
+			}
+			m.Blocks = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Blocks |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Moved", wireType)
+			}
+			m.Moved = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Moved |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Peers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Peers = append(m.Peers, &PeerSimulation{})
+			if err := m.Peers[len(m.Peers)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, string(data[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Refusals", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Refusals = append(m.Refusals, string(data[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipPlacement(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthPlacement
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipPlacement(data []byte) (n int, err error) {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowPlacement
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if data[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowPlacement
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			iNdEx += length
+			if length < 0 {
+				return 0, ErrInvalidLengthPlacement
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowPlacement
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := data[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipPlacement(data[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthPlacement = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowPlacement   = fmt.Errorf("proto: integer overflow")
+)
+
+var fileDescriptorPlacement = []byte{
+	// 593 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x54, 0xcf, 0x8e, 0xd2, 0x5e,
+	0x14, 0xe6, 0xfe, 0x28, 0xfc, 0xe8, 0x81, 0xa0, 0x76, 0xc8, 0xa4, 0xa9, 0xa4, 0x62, 0x17, 0x13,
+	0x4c, 0x04, 0x12, 0x4c, 0x74, 0x4f, 0x8c, 0x09, 0x89, 0x8b, 0x49, 0x47, 0xdc, 0xb8, 0x98, 0x14,
+	0xb8, 0xed, 0x34, 0xb6, 0xbd, 0x78, 0x6f, 0x8b, 0xf1, 0x2d, 0xdc, 0xfb, 0x04, 0xfa, 0x24, 0x2e,
+	0x67, 0xe9, 0xca, 0x18, 0x78, 0x02, 0xdf, 0xc0, 0xf4, 0xfe, 0x29, 0xad, 0xa9, 0xba, 0xeb, 0x77,
+	0xce, 0xb9, 0xdf, 0xf9, 0xce, 0xc7, 0x39, 0xc0, 0x9d, 0x5d, 0xe4, 0x6d, 0x70, 0x8c, 0x93, 0x74,
+	0xba, 0xa3, 0x24, 0x25, 0x46, 0x3b, 0x26, 0x5b, 0x1c, 0x31, 0x6b, 0x12, 0x84, 0xe9, 0x4d, 0xb6,
+	0x9e, 0x6e, 0x48, 0x3c, 0x0b, 0x48, 0x40, 0x66, 0x3c, 0xbd, 0xce, 0x7c, 0x8e, 0x38, 0xe0, 0x5f,
+	0xe2, 0x99, 0xd5, 0x4d, 0x09, 0xcd, 0x98, 0x00, 0xce, 0x0b, 0x38, 0x7b, 0x49, 0x36, 0x5e, 0x8a,
+	0x17, 0x11, 0xd9, 0xbc, 0x65, 0x2e, 0x7e, 0x97, 0x61, 0x96, 0x1a, 0x33, 0x80, 0x75, 0x1e, 0xb8,
+	0xa6, 0xd8, 0x67, 0x26, 0x1a, 0x35, 0xc7, 0xdd, 0xf9, 0xdd, 0xa9, 0xe8, 0x37, 0xe5, 0xa5, 0x2e,
+	0xf6, 0x5d, 0x7d, 0x2d, 0xbf, 0x98, 0xb3, 0x82, 0x3e, 0x0f, 0x5f, 0x2a, 0x8d, 0xc6, 0x04, 0xf4,
+	0x82, 0xc2, 0x44, 0x23, 0x54, 0xcb, 0xd0, 0x51, 0x0c, 0xc6, 0x00, 0x5a, 0x3b, 0x8c, 0x29, 0x33,
+	0xff, 0x1b, 0x35, 0xc7, 0xba, 0x2b, 0x80, 0xb3, 0x87, 0x41, 0x55, 0x1e, 0xdb, 0x91, 0x84, 0x61,
+	0xe3, 0x29, 0x40, 0xe1, 0x86, 0xd2, 0x77, 0x5e, 0x61, 0x2f, 0x84, 0xb8, 0xa5, 0x4a, 0xe3, 0xa2,
+	0xdc, 0xa5, 0x24, 0xe8, 0x12, 0x63, 0xba, 0x4c, 0x7c, 0xa2, 0xfa, 0x4e, 0x94, 0x2d, 0xaf, 0x49,
+	0x94, 0xc5, 0x58, 0xd9, 0x72, 0x0e, 0xed, 0x3d, 0x0f, 0xf0, 0x81, 0x74, 0x57, 0x22, 0xe7, 0x0d,
+	0xe8, 0x39, 0xc3, 0xd5, 0x8d, 0x47, 0xb1, 0x31, 0x04, 0x2d, 0xcb, 0xc2, 0xad, 0x28, 0x59, 0x74,
+	0x0e, 0xdf, 0x1f, 0x68, 0xab, 0xd5, 0xf2, 0xb9, 0xcb, 0xa3, 0x39, 0x05, 0x9f, 0x39, 0x97, 0x80,
+	0xc6, 0x9a, 0x2b, 0x91, 0x61, 0xc2, 0xff, 0x3b, 0x1a, 0xc6, 0x1e, 0xfd, 0x60, 0x36, 0x79, 0x42,
+	0x41, 0xe7, 0x33, 0x82, 0x41, 0x55, 0x8c, 0x34, 0xe1, 0xa2, 0xa2, 0xa6, 0x3b, 0xef, 0xab, 0x69,
+	0x64, 0x9d, 0xcc, 0xfe, 0xb1, 0xe5, 0x23, 0x68, 0xb3, 0x5c, 0x31, 0x33, 0x9b, 0xdc, 0x8d, 0x7b,
+	0x65, 0x37, 0xf8, 0x2c, 0xae, 0x2c, 0x38, 0xf9, 0xa6, 0xfd, 0xdd, 0xb7, 0x67, 0x70, 0x76, 0x15,
+	0xc6, 0x59, 0xe4, 0xa5, 0xd8, 0x0d, 0x93, 0x40, 0xf9, 0x36, 0x02, 0x8d, 0x86, 0x49, 0x20, 0x75,
+	0xf6, 0xd4, 0x6b, 0x5e, 0xc2, 0x33, 0xce, 0x27, 0x04, 0x7d, 0xde, 0x56, 0xbc, 0x0e, 0x49, 0xf2,
+	0x0f, 0x1f, 0x1f, 0x42, 0x2f, 0x25, 0xa9, 0x17, 0x5d, 0x57, 0x46, 0xeb, 0xf2, 0x98, 0x58, 0x16,
+	0x3e, 0x37, 0xf6, 0x09, 0xc5, 0xd2, 0x51, 0x89, 0xf2, 0x55, 0xf3, 0xfc, 0x14, 0x53, 0x53, 0xe3,
+	0x61, 0x01, 0x0c, 0x0b, 0x3a, 0x14, 0x6f, 0x70, 0xb8, 0xc7, 0x5b, 0xb3, 0xc5, 0x13, 0x05, 0x76,
+	0xbe, 0x20, 0x18, 0x54, 0xe7, 0x92, 0x3f, 0xc1, 0xc9, 0x5a, 0x54, 0xb1, 0x76, 0x00, 0xad, 0x98,
+	0xe4, 0x4c, 0x42, 0x96, 0x00, 0xc6, 0x63, 0xe5, 0x62, 0xb3, 0xba, 0xb0, 0xd5, 0xc1, 0xa5, 0x97,
+	0xb9, 0xa0, 0xf7, 0x1e, 0x4d, 0xc2, 0x24, 0x10, 0xb6, 0xeb, 0x6e, 0x81, 0x85, 0x58, 0x3f, 0x63,
+	0x5e, 0xc4, 0xcc, 0x96, 0xc8, 0x29, 0x3c, 0xff, 0x89, 0xa0, 0xff, 0x2a, 0x3f, 0xf1, 0xd3, 0x2d,
+	0x2e, 0xa1, 0x57, 0x3e, 0x23, 0xe3, 0xbe, 0xea, 0x5c, 0x73, 0xfb, 0xd6, 0xb0, 0x3e, 0x29, 0x27,
+	0x2e, 0xa8, 0xc4, 0x92, 0xfd, 0x4e, 0x55, 0xb9, 0x17, 0x6b, 0x58, 0x9f, 0x3c, 0x51, 0x95, 0x4d,
+	0x3d, 0x51, 0xd5, 0xac, 0x90, 0x35, 0xac, 0x4f, 0x0a, 0xaa, 0x85, 0xf9, 0xf5, 0x60, 0xa3, 0xdb,
+	0x83, 0x8d, 0x7e, 0x1c, 0x6c, 0xf4, 0xf1, 0x68, 0x37, 0x6e, 0x8f, 0x76, 0xe3, 0xdb, 0xd1, 0x6e,
+	0xac, 0xdb, 0xfc, 0x7f, 0xee, 0xc9, 0xaf, 0x01, 0x00, 0xa7, 0xfc, 0x3d, 0xd7, 0x3e, 0x05, 0x00,
+	0x00,
+}
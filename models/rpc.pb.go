@@ -2,29 +2,6 @@
 // source: rpc.proto
 // DO NOT EDIT!
 
-/*
-	Package models is a generated protocol buffer package.
-
-	It is generated from these files:
-		rpc.proto
-		torus.proto
-
-	It has these top-level messages:
-		BlockRequest
-		BlockResponse
-		PutBlockRequest
-		PutResponse
-		RebalanceCheckRequest
-		RebalanceCheckResponse
-		INode
-		BlockLayer
-		Volume
-		PeerInfo
-		RebalanceInfo
-		Ring
-		BlockRef
-		INodeRef
-*/
 package models
 
 import proto "github.com/gogo/protobuf/proto"
@@ -46,10 +23,6 @@ var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the proto package it is being compiled against.
-const _ = proto.GoGoProtoPackageIsVersion1
-
 type BlockRequest struct {
 	BlockRef *BlockRef `protobuf:"bytes,1,opt,name=block_ref" json:"block_ref,omitempty"`
 }
@@ -79,6 +52,12 @@ func (*BlockResponse) Descriptor() ([]byte, []int) { return fileDescriptorRpc, [
 type PutBlockRequest struct {
 	Refs   []*BlockRef `protobuf:"bytes,1,rep,name=refs" json:"refs,omitempty"`
 	Blocks [][]byte    `protobuf:"bytes,2,rep,name=blocks" json:"blocks,omitempty"`
+	// Epoch is the attachment epoch of the writer, if any. Peers reject
+	// writes from epochs older than the newest they've seen for the volume.
+	Epoch uint64 `protobuf:"varint,3,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	// Repair replaces any copy of the blocks the peer already has, which has
+	// been found to be stale or corrupt.
+	Repair bool `protobuf:"varint,4,opt,name=repair,proto3" json:"repair,omitempty"`
 }
 
 func (m *PutBlockRequest) Reset()                    { *m = PutBlockRequest{} }
@@ -129,6 +108,59 @@ func (m *RebalanceCheckResponse) String() string            { return proto.Compa
 func (*RebalanceCheckResponse) ProtoMessage()               {}
 func (*RebalanceCheckResponse) Descriptor() ([]byte, []int) { return fileDescriptorRpc, []int{5} }
 
+type BlocksRequest struct {
+	BlockRefs []*BlockRef `protobuf:"bytes,1,rep,name=block_refs" json:"block_refs,omitempty"`
+}
+
+func (m *BlocksRequest) Reset()                    { *m = BlocksRequest{} }
+func (m *BlocksRequest) String() string            { return proto.CompactTextString(m) }
+func (*BlocksRequest) ProtoMessage()               {}
+func (*BlocksRequest) Descriptor() ([]byte, []int) { return fileDescriptorRpc, []int{6} }
+
+func (m *BlocksRequest) GetBlockRefs() []*BlockRef {
+	if m != nil {
+		return m.BlockRefs
+	}
+	return nil
+}
+
+type BlocksResponse struct {
+	// Blocks are in the order they were requested. Blocks the peer doesn't
+	// have are not ok.
+	Blocks []*BlockResponse `protobuf:"bytes,1,rep,name=blocks" json:"blocks,omitempty"`
+}
+
+func (m *BlocksResponse) Reset()                    { *m = BlocksResponse{} }
+func (m *BlocksResponse) String() string            { return proto.CompactTextString(m) }
+func (*BlocksResponse) ProtoMessage()               {}
+func (*BlocksResponse) Descriptor() ([]byte, []int) { return fileDescriptorRpc, []int{7} }
+
+func (m *BlocksResponse) GetBlocks() []*BlockResponse {
+	if m != nil {
+		return m.Blocks
+	}
+	return nil
+}
+
+type DiscardBlocksRequest struct {
+	// Refs are the blocks a volume no longer uses.
+	Refs []*BlockRef `protobuf:"bytes,1,rep,name=refs" json:"refs,omitempty"`
+	// Epoch is the attachment epoch of the writer, if any.
+	Epoch uint64 `protobuf:"varint,2,opt,name=epoch,proto3" json:"epoch,omitempty"`
+}
+
+func (m *DiscardBlocksRequest) Reset()                    { *m = DiscardBlocksRequest{} }
+func (m *DiscardBlocksRequest) String() string            { return proto.CompactTextString(m) }
+func (*DiscardBlocksRequest) ProtoMessage()               {}
+func (*DiscardBlocksRequest) Descriptor() ([]byte, []int) { return fileDescriptorRpc, []int{8} }
+
+func (m *DiscardBlocksRequest) GetRefs() []*BlockRef {
+	if m != nil {
+		return m.Refs
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*BlockRequest)(nil), "models.BlockRequest")
 	proto.RegisterType((*BlockResponse)(nil), "models.BlockResponse")
@@ -136,6 +168,9 @@ func init() {
 	proto.RegisterType((*PutResponse)(nil), "models.PutResponse")
 	proto.RegisterType((*RebalanceCheckRequest)(nil), "models.RebalanceCheckRequest")
 	proto.RegisterType((*RebalanceCheckResponse)(nil), "models.RebalanceCheckResponse")
+	proto.RegisterType((*BlocksRequest)(nil), "models.BlocksRequest")
+	proto.RegisterType((*BlocksResponse)(nil), "models.BlocksResponse")
+	proto.RegisterType((*DiscardBlocksRequest)(nil), "models.DiscardBlocksRequest")
 }
 func (this *BlockRequest) VerboseEqual(that interface{}) error {
 	if that == nil {
@@ -304,6 +339,12 @@ func (this *PutBlockRequest) VerboseEqual(that interface{}) error {
 			return fmt.Errorf("Blocks this[%v](%v) Not Equal that[%v](%v)", i, this.Blocks[i], i, that1.Blocks[i])
 		}
 	}
+	if this.Epoch != that1.Epoch {
+		return fmt.Errorf("Epoch this(%v) Not Equal that(%v)", this.Epoch, that1.Epoch)
+	}
+	if this.Repair != that1.Repair {
+		return fmt.Errorf("Repair this(%v) Not Equal that(%v)", this.Repair, that1.Repair)
+	}
 	return nil
 }
 func (this *PutBlockRequest) Equal(that interface{}) bool {
@@ -347,6 +388,12 @@ func (this *PutBlockRequest) Equal(that interface{}) bool {
 			return false
 		}
 	}
+	if this.Epoch != that1.Epoch {
+		return false
+	}
+	if this.Repair != that1.Repair {
+		return false
+	}
 	return true
 }
 func (this *PutResponse) VerboseEqual(that interface{}) error {
@@ -523,6 +570,78 @@ func (this *RebalanceCheckResponse) VerboseEqual(that interface{}) error {
 	}
 	return nil
 }
+
+func (this *BlocksRequest) VerboseEqual(that interface{}) error {
+	if that == nil {
+		if this == nil {
+			return nil
+		}
+		return fmt.Errorf("that == nil && this != nil")
+	}
+
+	that1, ok := that.(*BlocksRequest)
+	if !ok {
+		that2, ok := that.(BlocksRequest)
+		if ok {
+			that1 = &that2
+		} else {
+			return fmt.Errorf("that is not of type *BlocksRequest")
+		}
+	}
+	if that1 == nil {
+		if this == nil {
+			return nil
+		}
+		return fmt.Errorf("that is type *BlocksRequest but is nil && this != nil")
+	} else if this == nil {
+		return fmt.Errorf("that is type *BlocksRequest but is not nil && this == nil")
+	}
+	if len(this.BlockRefs) != len(that1.BlockRefs) {
+		return fmt.Errorf("BlockRefs this(%v) Not Equal that(%v)", len(this.BlockRefs), len(that1.BlockRefs))
+	}
+	for i := range this.BlockRefs {
+		if !this.BlockRefs[i].Equal(that1.BlockRefs[i]) {
+			return fmt.Errorf("BlockRefs this[%v](%v) Not Equal that[%v](%v)", i, this.BlockRefs[i], i, that1.BlockRefs[i])
+		}
+	}
+	return nil
+}
+
+func (this *BlocksResponse) VerboseEqual(that interface{}) error {
+	if that == nil {
+		if this == nil {
+			return nil
+		}
+		return fmt.Errorf("that == nil && this != nil")
+	}
+
+	that1, ok := that.(*BlocksResponse)
+	if !ok {
+		that2, ok := that.(BlocksResponse)
+		if ok {
+			that1 = &that2
+		} else {
+			return fmt.Errorf("that is not of type *BlocksResponse")
+		}
+	}
+	if that1 == nil {
+		if this == nil {
+			return nil
+		}
+		return fmt.Errorf("that is type *BlocksResponse but is nil && this != nil")
+	} else if this == nil {
+		return fmt.Errorf("that is type *BlocksResponse but is not nil && this == nil")
+	}
+	if len(this.Blocks) != len(that1.Blocks) {
+		return fmt.Errorf("Blocks this(%v) Not Equal that(%v)", len(this.Blocks), len(that1.Blocks))
+	}
+	for i := range this.Blocks {
+		if !this.Blocks[i].Equal(that1.Blocks[i]) {
+			return fmt.Errorf("Blocks this[%v](%v) Not Equal that[%v](%v)", i, this.Blocks[i], i, that1.Blocks[i])
+		}
+	}
+	return nil
+}
 func (this *RebalanceCheckResponse) Equal(that interface{}) bool {
 	if that == nil {
 		if this == nil {
@@ -562,6 +681,154 @@ func (this *RebalanceCheckResponse) Equal(that interface{}) bool {
 	return true
 }
 
+func (this *BlocksRequest) Equal(that interface{}) bool {
+	if that == nil {
+		if this == nil {
+			return true
+		}
+		return false
+	}
+
+	that1, ok := that.(*BlocksRequest)
+	if !ok {
+		that2, ok := that.(BlocksRequest)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		if this == nil {
+			return true
+		}
+		return false
+	} else if this == nil {
+		return false
+	}
+	if len(this.BlockRefs) != len(that1.BlockRefs) {
+		return false
+	}
+	for i := range this.BlockRefs {
+		if !this.BlockRefs[i].Equal(that1.BlockRefs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *BlocksResponse) Equal(that interface{}) bool {
+	if that == nil {
+		if this == nil {
+			return true
+		}
+		return false
+	}
+
+	that1, ok := that.(*BlocksResponse)
+	if !ok {
+		that2, ok := that.(BlocksResponse)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		if this == nil {
+			return true
+		}
+		return false
+	} else if this == nil {
+		return false
+	}
+	if len(this.Blocks) != len(that1.Blocks) {
+		return false
+	}
+	for i := range this.Blocks {
+		if !this.Blocks[i].Equal(that1.Blocks[i]) {
+			return false
+		}
+	}
+	return true
+}
+func (this *DiscardBlocksRequest) VerboseEqual(that interface{}) error {
+	if that == nil {
+		if this == nil {
+			return nil
+		}
+		return fmt.Errorf("that == nil && this != nil")
+	}
+
+	that1, ok := that.(*DiscardBlocksRequest)
+	if !ok {
+		that2, ok := that.(DiscardBlocksRequest)
+		if ok {
+			that1 = &that2
+		} else {
+			return fmt.Errorf("that is not of type *DiscardBlocksRequest")
+		}
+	}
+	if that1 == nil {
+		if this == nil {
+			return nil
+		}
+		return fmt.Errorf("that is type *DiscardBlocksRequest but is nil && this != nil")
+	} else if this == nil {
+		return fmt.Errorf("that is type *DiscardBlocksRequest but is not nil && this == nil")
+	}
+	if len(this.Refs) != len(that1.Refs) {
+		return fmt.Errorf("Refs this(%v) Not Equal that(%v)", len(this.Refs), len(that1.Refs))
+	}
+	for i := range this.Refs {
+		if !this.Refs[i].Equal(that1.Refs[i]) {
+			return fmt.Errorf("Refs this[%v](%v) Not Equal that[%v](%v)", i, this.Refs[i], i, that1.Refs[i])
+		}
+	}
+	if this.Epoch != that1.Epoch {
+		return fmt.Errorf("Epoch this(%v) Not Equal that(%v)", this.Epoch, that1.Epoch)
+	}
+	return nil
+}
+func (this *DiscardBlocksRequest) Equal(that interface{}) bool {
+	if that == nil {
+		if this == nil {
+			return true
+		}
+		return false
+	}
+
+	that1, ok := that.(*DiscardBlocksRequest)
+	if !ok {
+		that2, ok := that.(DiscardBlocksRequest)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		if this == nil {
+			return true
+		}
+		return false
+	} else if this == nil {
+		return false
+	}
+	if len(this.Refs) != len(that1.Refs) {
+		return false
+	}
+	for i := range this.Refs {
+		if !this.Refs[i].Equal(that1.Refs[i]) {
+			return false
+		}
+	}
+	if this.Epoch != that1.Epoch {
+		return false
+	}
+	return true
+}
+
 // Reference imports to suppress errors if they are not otherwise used.
 var _ context.Context
 var _ grpc.ClientConn
@@ -576,6 +843,8 @@ type TorusStorageClient interface {
 	Block(ctx context.Context, in *BlockRequest, opts ...grpc.CallOption) (*BlockResponse, error)
 	PutBlock(ctx context.Context, in *PutBlockRequest, opts ...grpc.CallOption) (*PutResponse, error)
 	RebalanceCheck(ctx context.Context, in *RebalanceCheckRequest, opts ...grpc.CallOption) (*RebalanceCheckResponse, error)
+	Blocks(ctx context.Context, in *BlocksRequest, opts ...grpc.CallOption) (*BlocksResponse, error)
+	DiscardBlocks(ctx context.Context, in *DiscardBlocksRequest, opts ...grpc.CallOption) (*PutResponse, error)
 }
 
 type torusStorageClient struct {
@@ -613,12 +882,32 @@ func (c *torusStorageClient) RebalanceCheck(ctx context.Context, in *RebalanceCh
 	return out, nil
 }
 
+func (c *torusStorageClient) Blocks(ctx context.Context, in *BlocksRequest, opts ...grpc.CallOption) (*BlocksResponse, error) {
+	out := new(BlocksResponse)
+	err := grpc.Invoke(ctx, "/models.TorusStorage/Blocks", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torusStorageClient) DiscardBlocks(ctx context.Context, in *DiscardBlocksRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := grpc.Invoke(ctx, "/models.TorusStorage/DiscardBlocks", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for TorusStorage service
 
 type TorusStorageServer interface {
 	Block(context.Context, *BlockRequest) (*BlockResponse, error)
 	PutBlock(context.Context, *PutBlockRequest) (*PutResponse, error)
 	RebalanceCheck(context.Context, *RebalanceCheckRequest) (*RebalanceCheckResponse, error)
+	Blocks(context.Context, *BlocksRequest) (*BlocksResponse, error)
+	DiscardBlocks(context.Context, *DiscardBlocksRequest) (*PutResponse, error)
 }
 
 func RegisterTorusStorageServer(s *grpc.Server, srv TorusStorageServer) {
@@ -679,26 +968,70 @@ func _TorusStorage_RebalanceCheck_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
-var _TorusStorage_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "models.TorusStorage",
-	HandlerType: (*TorusStorageServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Block",
-			Handler:    _TorusStorage_Block_Handler,
-		},
-		{
-			MethodName: "PutBlock",
-			Handler:    _TorusStorage_PutBlock_Handler,
-		},
-		{
-			MethodName: "RebalanceCheck",
-			Handler:    _TorusStorage_RebalanceCheck_Handler,
-		},
-	},
-	Streams: []grpc.StreamDesc{},
-}
-
+func _TorusStorage_Blocks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlocksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorusStorageServer).Blocks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/models.TorusStorage/Blocks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorusStorageServer).Blocks(ctx, req.(*BlocksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorusStorage_DiscardBlocks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiscardBlocksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorusStorageServer).DiscardBlocks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/models.TorusStorage/DiscardBlocks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorusStorageServer).DiscardBlocks(ctx, req.(*DiscardBlocksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TorusStorage_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "models.TorusStorage",
+	HandlerType: (*TorusStorageServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Block",
+			Handler:    _TorusStorage_Block_Handler,
+		},
+		{
+			MethodName: "PutBlock",
+			Handler:    _TorusStorage_PutBlock_Handler,
+		},
+		{
+			MethodName: "RebalanceCheck",
+			Handler:    _TorusStorage_RebalanceCheck_Handler,
+		},
+		{
+			MethodName: "Blocks",
+			Handler:    _TorusStorage_Blocks_Handler,
+		},
+		{
+			MethodName: "DiscardBlocks",
+			Handler:    _TorusStorage_DiscardBlocks_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
 func (m *BlockRequest) Marshal() (data []byte, err error) {
 	size := m.Size()
 	data = make([]byte, size)
@@ -796,6 +1129,21 @@ func (m *PutBlockRequest) MarshalTo(data []byte) (int, error) {
 			i += copy(data[i:], b)
 		}
 	}
+	if m.Epoch != 0 {
+		data[i] = 0x18
+		i++
+		i = encodeVarintRpc(data, i, uint64(m.Epoch))
+	}
+	if m.Repair {
+		data[i] = 0x20
+		i++
+		if m.Repair {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -873,6 +1221,26 @@ func (m *RebalanceCheckResponse) Marshal() (data []byte, err error) {
 	return data[:n], nil
 }
 
+func (m *BlocksRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *BlocksResponse) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
 func (m *RebalanceCheckResponse) MarshalTo(data []byte) (int, error) {
 	var i int
 	_ = i
@@ -898,6 +1266,81 @@ func (m *RebalanceCheckResponse) MarshalTo(data []byte) (int, error) {
 	return i, nil
 }
 
+func (m *BlocksRequest) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.BlockRefs) > 0 {
+		for _, msg := range m.BlockRefs {
+			data[i] = 0xa
+			i++
+			i = encodeVarintRpc(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *BlocksResponse) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Blocks) > 0 {
+		for _, msg := range m.Blocks {
+			data[i] = 0xa
+			i++
+			i = encodeVarintRpc(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *DiscardBlocksRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *DiscardBlocksRequest) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Refs) > 0 {
+		for _, msg := range m.Refs {
+			data[i] = 0xa
+			i++
+			i = encodeVarintRpc(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if m.Epoch != 0 {
+		data[i] = 0x10
+		i++
+		i = encodeVarintRpc(data, i, uint64(m.Epoch))
+	}
+	return i, nil
+}
+
 func encodeFixed64Rpc(data []byte, offset int, v uint64) int {
 	data[offset] = uint8(v)
 	data[offset+1] = uint8(v >> 8)
@@ -966,6 +1409,8 @@ func NewPopulatedPutBlockRequest(r randyRpc, easy bool) *PutBlockRequest {
 			this.Blocks[i][j] = byte(r.Intn(256))
 		}
 	}
+	this.Epoch = uint64(uint64(r.Uint32()))
+	this.Repair = bool(bool(r.Intn(2) == 0))
 	if !easy && r.Intn(10) != 0 {
 	}
 	return this
@@ -1010,6 +1455,49 @@ func NewPopulatedRebalanceCheckResponse(r randyRpc, easy bool) *RebalanceCheckRe
 	return this
 }
 
+func NewPopulatedBlocksRequest(r randyRpc, easy bool) *BlocksRequest {
+	this := &BlocksRequest{}
+	if r.Intn(10) != 0 {
+		v5 := r.Intn(5)
+		this.BlockRefs = make([]*BlockRef, v5)
+		for i := 0; i < v5; i++ {
+			this.BlockRefs[i] = NewPopulatedBlockRef(r, easy)
+		}
+	}
+	if !easy && r.Intn(10) != 0 {
+	}
+	return this
+}
+
+func NewPopulatedBlocksResponse(r randyRpc, easy bool) *BlocksResponse {
+	this := &BlocksResponse{}
+	if r.Intn(10) != 0 {
+		v5 := r.Intn(5)
+		this.Blocks = make([]*BlockResponse, v5)
+		for i := 0; i < v5; i++ {
+			this.Blocks[i] = NewPopulatedBlockResponse(r, easy)
+		}
+	}
+	if !easy && r.Intn(10) != 0 {
+	}
+	return this
+}
+
+func NewPopulatedDiscardBlocksRequest(r randyRpc, easy bool) *DiscardBlocksRequest {
+	this := &DiscardBlocksRequest{}
+	if r.Intn(10) != 0 {
+		v5 := r.Intn(5)
+		this.Refs = make([]*BlockRef, v5)
+		for i := 0; i < v5; i++ {
+			this.Refs[i] = NewPopulatedBlockRef(r, easy)
+		}
+	}
+	this.Epoch = uint64(uint64(r.Uint32()))
+	if !easy && r.Intn(10) != 0 {
+	}
+	return this
+}
+
 type randyRpc interface {
 	Float32() float32
 	Float64() float64
@@ -1120,6 +1608,12 @@ func (m *PutBlockRequest) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.Epoch != 0 {
+		n += 1 + sovRpc(uint64(m.Epoch))
+	}
+	if m.Repair {
+		n += 2
+	}
 	return n
 }
 
@@ -1160,6 +1654,45 @@ func (m *RebalanceCheckResponse) Size() (n int) {
 	return n
 }
 
+func (m *BlocksRequest) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.BlockRefs) > 0 {
+		for _, e := range m.BlockRefs {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *BlocksResponse) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.Blocks) > 0 {
+		for _, e := range m.Blocks {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *DiscardBlocksRequest) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.Refs) > 0 {
+		for _, e := range m.Refs {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if m.Epoch != 0 {
+		n += 1 + sovRpc(uint64(m.Epoch))
+	}
+	return n
+}
+
 func sovRpc(x uint64) (n int) {
 	for {
 		n++
@@ -1446,6 +1979,45 @@ func (m *PutBlockRequest) Unmarshal(data []byte) error {
 			m.Blocks = append(m.Blocks, make([]byte, postIndex-iNdEx))
 			copy(m.Blocks[len(m.Blocks)-1], data[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Epoch", wireType)
+			}
+			m.Epoch = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Epoch |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Repair", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Repair = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(data[iNdEx:])
@@ -1736,6 +2308,270 @@ func (m *RebalanceCheckResponse) Unmarshal(data []byte) error {
 	}
 	return nil
 }
+
+func (m *BlocksRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BlocksRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BlocksRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockRefs", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BlockRefs = append(m.BlockRefs, &BlockRef{})
+			if err := m.BlockRefs[len(m.BlockRefs)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (m *BlocksResponse) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BlocksResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BlocksResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Blocks", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Blocks = append(m.Blocks, &BlockResponse{})
+			if err := m.Blocks[len(m.Blocks)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *DiscardBlocksRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DiscardBlocksRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DiscardBlocksRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Refs", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Refs = append(m.Refs, &BlockRef{})
+			if err := m.Refs[len(m.Refs)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Epoch", wireType)
+			}
+			m.Epoch = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Epoch |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipRpc(data []byte) (n int, err error) {
 	l := len(data)
 	iNdEx := 0
@@ -1842,28 +2678,35 @@ var (
 )
 
 var fileDescriptorRpc = []byte{
-	// 365 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x74, 0x92, 0xcf, 0x4e, 0xf2, 0x40,
-	0x14, 0xc5, 0xbf, 0xf2, 0x2f, 0x70, 0x5b, 0xf8, 0xcc, 0x28, 0x4a, 0x9a, 0xd8, 0x98, 0x4a, 0x8c,
-	0x2e, 0x2c, 0x09, 0x98, 0xe8, 0xc6, 0x85, 0xf8, 0x00, 0x1a, 0x74, 0x6f, 0xa6, 0x65, 0x28, 0x84,
-	0xc2, 0x60, 0x67, 0xea, 0x73, 0xf8, 0x18, 0x3e, 0x82, 0x4b, 0x97, 0xee, 0xf4, 0x11, 0x50, 0x5f,
-	0xc2, 0xa5, 0x97, 0x69, 0x41, 0x69, 0x60, 0x71, 0x92, 0xb9, 0xdc, 0x7b, 0xcf, 0xef, 0x72, 0x52,
-	0x28, 0x85, 0x13, 0xcf, 0x99, 0x84, 0x5c, 0x72, 0x52, 0x18, 0xf1, 0x2e, 0x0b, 0x84, 0x79, 0xec,
-	0x0f, 0x64, 0x3f, 0x72, 0x1d, 0x8f, 0x8f, 0x1a, 0x3e, 0xf7, 0x79, 0x43, 0xb5, 0xdd, 0xa8, 0xa7,
-	0x2a, 0x55, 0xa8, 0x57, 0xbc, 0x66, 0xea, 0x92, 0x87, 0x91, 0x88, 0x0b, 0xbb, 0x05, 0x46, 0x3b,
-	0xe0, 0xde, 0xb0, 0xc3, 0xee, 0x23, 0x26, 0x24, 0xd9, 0x87, 0x92, 0x3b, 0xab, 0xef, 0x42, 0xd6,
-	0xab, 0x69, 0x7b, 0xda, 0xa1, 0xde, 0xdc, 0x70, 0x62, 0x8e, 0x93, 0x0c, 0xf6, 0xec, 0x23, 0x28,
-	0x27, 0x6f, 0x31, 0xe1, 0x63, 0xc1, 0x08, 0x40, 0x86, 0x0f, 0xd5, 0x78, 0x91, 0x18, 0x90, 0xeb,
-	0x52, 0x49, 0x6b, 0x19, 0xac, 0x0c, 0xfb, 0x02, 0xfe, 0x5f, 0x47, 0x72, 0x09, 0x61, 0x41, 0x0e,
-	0xcd, 0x05, 0x8e, 0x67, 0x57, 0xb9, 0x93, 0x0a, 0x14, 0xd4, 0x09, 0x02, 0x2d, 0xb2, 0x68, 0x71,
-	0x00, 0x3a, 0x5a, 0xac, 0x64, 0xe9, 0x90, 0x65, 0x61, 0xa8, 0x50, 0x25, 0xfb, 0x1c, 0xaa, 0x1d,
-	0xe6, 0xd2, 0x80, 0x8e, 0x3d, 0x76, 0xd9, 0x67, 0xbf, 0xc0, 0x3a, 0xc0, 0xe2, 0x3f, 0xad, 0xc5,
-	0xda, 0xa7, 0xb0, 0x9d, 0x5e, 0x4f, 0x88, 0x65, 0xc8, 0x3f, 0xd0, 0x60, 0xd0, 0x55, 0xab, 0xc5,
-	0xd9, 0x7d, 0x42, 0x52, 0x19, 0x09, 0xc5, 0xcd, 0x37, 0xdf, 0x34, 0x30, 0x6e, 0x67, 0x91, 0xde,
-	0x60, 0xb0, 0xd4, 0x67, 0xe4, 0x04, 0xf2, 0xca, 0x95, 0x6c, 0xa5, 0x20, 0xea, 0x1c, 0xb3, 0x9a,
-	0xfa, 0x35, 0xa1, 0x9c, 0x41, 0x71, 0x9e, 0x14, 0xd9, 0x99, 0x8f, 0xa4, 0xb2, 0x33, 0x37, 0xff,
-	0x34, 0x16, 0x9b, 0x57, 0x50, 0x59, 0xbe, 0x9c, 0xec, 0xce, 0xc7, 0x56, 0x06, 0x62, 0x5a, 0xeb,
-	0xda, 0xb1, 0x61, 0xbb, 0x3e, 0xfd, 0xb0, 0xb4, 0x6f, 0xd4, 0xd3, 0xa7, 0xa5, 0x3d, 0xa3, 0x5e,
-	0x50, 0xaf, 0xa8, 0x77, 0xd4, 0x14, 0xf5, 0xf8, 0x65, 0xfd, 0x73, 0x0b, 0xea, 0x0b, 0x6a, 0xfd,
-	0x04, 0x00, 0x00, 0xff, 0xff, 0x80, 0x1e, 0x4f, 0xc2, 0x92, 0x02, 0x00, 0x00,
+	// 472 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x53, 0x3d, 0x8f, 0xd3, 0x40,
+	0x10, 0xcd, 0x3a, 0x1f, 0x4a, 0x26, 0x21, 0x9c, 0x96, 0x5c, 0xb0, 0x2c, 0xb1, 0xb2, 0x2c, 0x8a,
+	0x14, 0x24, 0x91, 0xee, 0x90, 0xa0, 0x41, 0xa0, 0x43, 0x42, 0x74, 0x9c, 0x16, 0x7a, 0x64, 0x3b,
+	0x9b, 0x0f, 0xc5, 0x77, 0x6b, 0x76, 0xd7, 0x74, 0xf4, 0x94, 0xfc, 0x0c, 0x7e, 0x02, 0x25, 0x25,
+	0xe5, 0x95, 0x94, 0x17, 0xe7, 0x4f, 0x50, 0x22, 0xef, 0xae, 0x03, 0xb1, 0x92, 0xe6, 0xba, 0x79,
+	0x3b, 0xef, 0xcd, 0xbc, 0xbc, 0x8c, 0xa1, 0x23, 0xd2, 0x78, 0x92, 0x0a, 0xae, 0x38, 0x6e, 0x5d,
+	0xf1, 0x19, 0x4b, 0xa4, 0x37, 0x5e, 0xac, 0xd4, 0x32, 0x8b, 0x26, 0x31, 0xbf, 0x9a, 0x2e, 0xf8,
+	0x82, 0x4f, 0x75, 0x3b, 0xca, 0xe6, 0x1a, 0x69, 0xa0, 0x2b, 0x23, 0xf3, 0xba, 0x8a, 0x8b, 0x4c,
+	0x1a, 0x10, 0xbc, 0x80, 0xde, 0x45, 0xc2, 0xe3, 0x35, 0x65, 0x9f, 0x32, 0x26, 0x15, 0x1e, 0x43,
+	0x27, 0x2a, 0xf0, 0x47, 0xc1, 0xe6, 0x2e, 0xf2, 0xd1, 0xa8, 0x7b, 0x76, 0x32, 0x31, 0x7b, 0x26,
+	0x96, 0x38, 0xa7, 0xed, 0xc8, 0x56, 0xc1, 0x39, 0xdc, 0xb3, 0xaf, 0x32, 0xe5, 0xd7, 0x92, 0xe1,
+	0x3e, 0x38, 0x7c, 0xad, 0x85, 0x6d, 0xea, 0xf0, 0x35, 0xc6, 0xd0, 0x98, 0x85, 0x2a, 0x74, 0x1d,
+	0x1f, 0x8d, 0x7a, 0x54, 0xd7, 0xc1, 0x17, 0xb8, 0x7f, 0x99, 0xa9, 0xbd, 0xb5, 0x8f, 0xa1, 0x21,
+	0xd8, 0x5c, 0xba, 0xc8, 0xaf, 0x1f, 0xdc, 0xa8, 0xbb, 0x78, 0x08, 0x2d, 0xbd, 0x59, 0xba, 0x8e,
+	0x5f, 0x1f, 0xf5, 0xa8, 0x45, 0x78, 0x00, 0x4d, 0x96, 0xf2, 0x78, 0xe9, 0xd6, 0x7d, 0x34, 0x6a,
+	0x50, 0x03, 0x0a, 0xb6, 0x60, 0x69, 0xb8, 0x12, 0x6e, 0x43, 0xdb, 0xb1, 0x28, 0x98, 0x42, 0xf7,
+	0x32, 0x53, 0x47, 0x1d, 0x9f, 0x40, 0x9d, 0x09, 0xa1, 0x0d, 0x77, 0x68, 0x51, 0x06, 0x6f, 0xe1,
+	0x94, 0xb2, 0x28, 0x4c, 0xc2, 0xeb, 0x98, 0xbd, 0x5e, 0xb2, 0x7f, 0xae, 0xa7, 0x00, 0xbb, 0xb0,
+	0x8e, 0x7b, 0xef, 0x94, 0x69, 0xc9, 0xe0, 0x0d, 0x0c, 0xab, 0x93, 0xac, 0x8b, 0x01, 0x34, 0x3f,
+	0x87, 0xc9, 0x6a, 0xa6, 0xa7, 0xb4, 0xa9, 0x01, 0xc5, 0x4f, 0x90, 0x2a, 0x54, 0x99, 0xd4, 0x76,
+	0x9a, 0xd4, 0xa2, 0xe0, 0x95, 0x8d, 0x5d, 0xde, 0xd9, 0xc9, 0x4b, 0xe8, 0x97, 0x13, 0xac, 0x83,
+	0xf1, 0x2e, 0x5c, 0x23, 0x3f, 0xad, 0xc8, 0x0d, 0xad, 0xcc, 0xfc, 0xec, 0xab, 0x03, 0xbd, 0x0f,
+	0xc5, 0x21, 0xbd, 0x57, 0x5c, 0x84, 0x0b, 0x86, 0x9f, 0x42, 0x53, 0x33, 0xf1, 0xa0, 0x22, 0xd4,
+	0x0e, 0xbd, 0xc3, 0xe3, 0xf0, 0x73, 0x68, 0x97, 0xb7, 0x80, 0x1f, 0x96, 0x94, 0xca, 0x75, 0x78,
+	0x0f, 0xfe, 0x6b, 0xec, 0x94, 0xef, 0xa0, 0xbf, 0x9f, 0x25, 0x7e, 0x54, 0xd2, 0x0e, 0xfe, 0x5b,
+	0x1e, 0x39, 0xd6, 0xb6, 0x03, 0x9f, 0x41, 0xcb, 0x44, 0x82, 0xf7, 0xbd, 0x96, 0x21, 0x7b, 0xc3,
+	0xea, 0xb3, 0x11, 0x5e, 0x3c, 0xb9, 0xdd, 0x10, 0xf4, 0x67, 0x43, 0xd0, 0xf7, 0x9c, 0xa0, 0x1f,
+	0x39, 0x41, 0x3f, 0x73, 0x82, 0x7e, 0xe5, 0x04, 0xdd, 0xe4, 0x04, 0xdd, 0xe6, 0x04, 0x7d, 0xdb,
+	0x92, 0xda, 0xcd, 0x96, 0xd4, 0x7e, 0x6f, 0x49, 0x2d, 0x6a, 0xe9, 0x0f, 0xef, 0xfc, 0xef, 0x00,
+	0xfb, 0x11, 0x7c, 0x37, 0xc9, 0x03, 0x00, 0x00,
 }
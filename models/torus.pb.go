@@ -79,6 +79,23 @@ type PeerInfo struct {
 	// ProtocolVersion is set by each peer to know if we're out of date or if a
 	// protocol migration has occured.
 	ProtocolVersion uint64 `protobuf:"varint,8,opt,name=protocol_version,proto3" json:"protocol_version,omitempty"`
+	// Zone is the failure domain, such as a rack or availability zone, the
+	// peer runs in.
+	Zone string `protobuf:"bytes,9,opt,name=zone,proto3" json:"zone,omitempty"`
+	// DirectIO and Preallocated say whether the peer's block files are
+	// written with O_DIRECT, and were allocated in full up front.
+	DirectIO     bool `protobuf:"varint,10,opt,name=direct_io,proto3" json:"direct_io,omitempty"`
+	Preallocated bool `protobuf:"varint,11,opt,name=preallocated,proto3" json:"preallocated,omitempty"`
+	// Devices are the disks of a peer that stores blocks on more than one,
+	// as sub-peers of their own. Only their UUID, address (the path they're
+	// mounted at), total_blocks and used_blocks are set.
+	Devices []*PeerInfo `protobuf:"bytes,12,rep,name=devices" json:"devices,omitempty"`
+	// QueueDepth and ReadLatency are the peer's load as of its last
+	// heartbeat: how many block requests from other peers it was serving,
+	// and how long it has lately taken to serve a block read, in
+	// nanoseconds.
+	QueueDepth  uint64 `protobuf:"varint,13,opt,name=queue_depth,proto3" json:"queue_depth,omitempty"`
+	ReadLatency int64  `protobuf:"varint,14,opt,name=read_latency,proto3" json:"read_latency,omitempty"`
 }
 
 func (m *PeerInfo) Reset()                    { *m = PeerInfo{} }
@@ -93,10 +110,24 @@ func (m *PeerInfo) GetRebalanceInfo() *RebalanceInfo {
 	return nil
 }
 
+func (m *PeerInfo) GetDevices() []*PeerInfo {
+	if m != nil {
+		return m.Devices
+	}
+	return nil
+}
+
 type RebalanceInfo struct {
 	LastRebalanceFinish int64  `protobuf:"varint,1,opt,name=last_rebalance_finish,proto3" json:"last_rebalance_finish,omitempty"`
 	LastRebalanceBlocks uint64 `protobuf:"varint,2,opt,name=last_rebalance_blocks,proto3" json:"last_rebalance_blocks,omitempty"`
 	Rebalancing         bool   `protobuf:"varint,3,opt,name=rebalancing,proto3" json:"rebalancing,omitempty"`
+	// Progress through the local blocks in the current pass.
+	PassCheckedBlocks uint64 `protobuf:"varint,4,opt,name=pass_checked_blocks,proto3" json:"pass_checked_blocks,omitempty"`
+	PassBlocks        uint64 `protobuf:"varint,5,opt,name=pass_blocks,proto3" json:"pass_blocks,omitempty"`
+	// UnderReplicatedBlocks counts the local blocks with fewer live copies
+	// than the ring wants, as found by the last complete pass or by the
+	// current one, whichever found more.
+	UnderReplicatedBlocks uint64 `protobuf:"varint,6,opt,name=under_replicated_blocks,proto3" json:"under_replicated_blocks,omitempty"`
 }
 
 func (m *RebalanceInfo) Reset()                    { *m = RebalanceInfo{} }
@@ -459,6 +490,29 @@ func (this *PeerInfo) VerboseEqual(that interface{}) error {
 	if this.ProtocolVersion != that1.ProtocolVersion {
 		return fmt.Errorf("ProtocolVersion this(%v) Not Equal that(%v)", this.ProtocolVersion, that1.ProtocolVersion)
 	}
+	if this.Zone != that1.Zone {
+		return fmt.Errorf("Zone this(%v) Not Equal that(%v)", this.Zone, that1.Zone)
+	}
+	if this.DirectIO != that1.DirectIO {
+		return fmt.Errorf("DirectIO this(%v) Not Equal that(%v)", this.DirectIO, that1.DirectIO)
+	}
+	if this.Preallocated != that1.Preallocated {
+		return fmt.Errorf("Preallocated this(%v) Not Equal that(%v)", this.Preallocated, that1.Preallocated)
+	}
+	if len(this.Devices) != len(that1.Devices) {
+		return fmt.Errorf("Devices this(%v) Not Equal that(%v)", len(this.Devices), len(that1.Devices))
+	}
+	for i := range this.Devices {
+		if !this.Devices[i].Equal(that1.Devices[i]) {
+			return fmt.Errorf("Devices this[%v](%v) Not Equal that[%v](%v)", i, this.Devices[i], i, that1.Devices[i])
+		}
+	}
+	if this.QueueDepth != that1.QueueDepth {
+		return fmt.Errorf("QueueDepth this(%v) Not Equal that(%v)", this.QueueDepth, that1.QueueDepth)
+	}
+	if this.ReadLatency != that1.ReadLatency {
+		return fmt.Errorf("ReadLatency this(%v) Not Equal that(%v)", this.ReadLatency, that1.ReadLatency)
+	}
 	return nil
 }
 func (this *PeerInfo) Equal(that interface{}) bool {
@@ -510,6 +564,29 @@ func (this *PeerInfo) Equal(that interface{}) bool {
 	if this.ProtocolVersion != that1.ProtocolVersion {
 		return false
 	}
+	if this.Zone != that1.Zone {
+		return false
+	}
+	if this.DirectIO != that1.DirectIO {
+		return false
+	}
+	if this.Preallocated != that1.Preallocated {
+		return false
+	}
+	if len(this.Devices) != len(that1.Devices) {
+		return false
+	}
+	for i := range this.Devices {
+		if !this.Devices[i].Equal(that1.Devices[i]) {
+			return false
+		}
+	}
+	if this.QueueDepth != that1.QueueDepth {
+		return false
+	}
+	if this.ReadLatency != that1.ReadLatency {
+		return false
+	}
 	return true
 }
 func (this *RebalanceInfo) VerboseEqual(that interface{}) error {
@@ -546,6 +623,15 @@ func (this *RebalanceInfo) VerboseEqual(that interface{}) error {
 	if this.Rebalancing != that1.Rebalancing {
 		return fmt.Errorf("Rebalancing this(%v) Not Equal that(%v)", this.Rebalancing, that1.Rebalancing)
 	}
+	if this.PassCheckedBlocks != that1.PassCheckedBlocks {
+		return fmt.Errorf("PassCheckedBlocks this(%v) Not Equal that(%v)", this.PassCheckedBlocks, that1.PassCheckedBlocks)
+	}
+	if this.PassBlocks != that1.PassBlocks {
+		return fmt.Errorf("PassBlocks this(%v) Not Equal that(%v)", this.PassBlocks, that1.PassBlocks)
+	}
+	if this.UnderReplicatedBlocks != that1.UnderReplicatedBlocks {
+		return fmt.Errorf("UnderReplicatedBlocks this(%v) Not Equal that(%v)", this.UnderReplicatedBlocks, that1.UnderReplicatedBlocks)
+	}
 	return nil
 }
 func (this *RebalanceInfo) Equal(that interface{}) bool {
@@ -582,6 +668,15 @@ func (this *RebalanceInfo) Equal(that interface{}) bool {
 	if this.Rebalancing != that1.Rebalancing {
 		return false
 	}
+	if this.PassCheckedBlocks != that1.PassCheckedBlocks {
+		return false
+	}
+	if this.PassBlocks != that1.PassBlocks {
+		return false
+	}
+	if this.UnderReplicatedBlocks != that1.UnderReplicatedBlocks {
+		return false
+	}
 	return true
 }
 func (this *Ring) VerboseEqual(that interface{}) error {
@@ -1024,6 +1119,54 @@ func (m *PeerInfo) MarshalTo(data []byte) (int, error) {
 		i++
 		i = encodeVarintTorus(data, i, uint64(m.ProtocolVersion))
 	}
+	if len(m.Zone) > 0 {
+		data[i] = 0x4a
+		i++
+		i = encodeVarintTorus(data, i, uint64(len(m.Zone)))
+		i += copy(data[i:], m.Zone)
+	}
+	if m.DirectIO {
+		data[i] = 0x50
+		i++
+		if m.DirectIO {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
+	if m.Preallocated {
+		data[i] = 0x58
+		i++
+		if m.Preallocated {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
+	if len(m.Devices) > 0 {
+		for _, msg := range m.Devices {
+			data[i] = 0x62
+			i++
+			i = encodeVarintTorus(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if m.QueueDepth != 0 {
+		data[i] = 0x68
+		i++
+		i = encodeVarintTorus(data, i, uint64(m.QueueDepth))
+	}
+	if m.ReadLatency != 0 {
+		data[i] = 0x70
+		i++
+		i = encodeVarintTorus(data, i, uint64(m.ReadLatency))
+	}
 	return i, nil
 }
 
@@ -1062,6 +1205,21 @@ func (m *RebalanceInfo) MarshalTo(data []byte) (int, error) {
 		}
 		i++
 	}
+	if m.PassCheckedBlocks != 0 {
+		data[i] = 0x20
+		i++
+		i = encodeVarintTorus(data, i, uint64(m.PassCheckedBlocks))
+	}
+	if m.PassBlocks != 0 {
+		data[i] = 0x28
+		i++
+		i = encodeVarintTorus(data, i, uint64(m.PassBlocks))
+	}
+	if m.UnderReplicatedBlocks != 0 {
+		data[i] = 0x30
+		i++
+		i = encodeVarintTorus(data, i, uint64(m.UnderReplicatedBlocks))
+	}
 	return i, nil
 }
 
@@ -1278,6 +1436,21 @@ func NewPopulatedPeerInfo(r randyTorus, easy bool) *PeerInfo {
 		this.RebalanceInfo = NewPopulatedRebalanceInfo(r, easy)
 	}
 	this.ProtocolVersion = uint64(uint64(r.Uint32()))
+	this.Zone = randStringTorus(r)
+	this.DirectIO = bool(bool(r.Intn(2) == 0))
+	this.Preallocated = bool(bool(r.Intn(2) == 0))
+	if r.Intn(10) == 0 {
+		v2 := r.Intn(3)
+		this.Devices = make([]*PeerInfo, v2)
+		for i := 0; i < v2; i++ {
+			this.Devices[i] = NewPopulatedPeerInfo(r, easy)
+		}
+	}
+	this.QueueDepth = uint64(uint64(r.Uint32()))
+	this.ReadLatency = int64(r.Int63())
+	if r.Intn(2) == 0 {
+		this.ReadLatency *= -1
+	}
 	if !easy && r.Intn(10) != 0 {
 	}
 	return this
@@ -1291,6 +1464,9 @@ func NewPopulatedRebalanceInfo(r randyTorus, easy bool) *RebalanceInfo {
 	}
 	this.LastRebalanceBlocks = uint64(uint64(r.Uint32()))
 	this.Rebalancing = bool(bool(r.Intn(2) == 0))
+	this.PassCheckedBlocks = uint64(uint64(r.Uint32()))
+	this.PassBlocks = uint64(uint64(r.Uint32()))
+	this.UnderReplicatedBlocks = uint64(uint64(r.Uint32()))
 	if !easy && r.Intn(10) != 0 {
 	}
 	return this
@@ -1508,6 +1684,28 @@ func (m *PeerInfo) Size() (n int) {
 	if m.ProtocolVersion != 0 {
 		n += 1 + sovTorus(uint64(m.ProtocolVersion))
 	}
+	l = len(m.Zone)
+	if l > 0 {
+		n += 1 + l + sovTorus(uint64(l))
+	}
+	if m.DirectIO {
+		n += 2
+	}
+	if m.Preallocated {
+		n += 2
+	}
+	if len(m.Devices) > 0 {
+		for _, e := range m.Devices {
+			l = e.Size()
+			n += 1 + l + sovTorus(uint64(l))
+		}
+	}
+	if m.QueueDepth != 0 {
+		n += 1 + sovTorus(uint64(m.QueueDepth))
+	}
+	if m.ReadLatency != 0 {
+		n += 1 + sovTorus(uint64(m.ReadLatency))
+	}
 	return n
 }
 
@@ -1523,6 +1721,15 @@ func (m *RebalanceInfo) Size() (n int) {
 	if m.Rebalancing {
 		n += 2
 	}
+	if m.PassCheckedBlocks != 0 {
+		n += 1 + sovTorus(uint64(m.PassCheckedBlocks))
+	}
+	if m.PassBlocks != 0 {
+		n += 1 + sovTorus(uint64(m.PassBlocks))
+	}
+	if m.UnderReplicatedBlocks != 0 {
+		n += 1 + sovTorus(uint64(m.UnderReplicatedBlocks))
+	}
 	return n
 }
 
@@ -2306,6 +2513,144 @@ func (m *PeerInfo) Unmarshal(data []byte) error {
 					break
 				}
 			}
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Zone", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTorus
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Zone = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DirectIO", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.DirectIO = bool(v != 0)
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Preallocated", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Preallocated = bool(v != 0)
+		case 12:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Devices", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTorus
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Devices = append(m.Devices, &PeerInfo{})
+			if err := m.Devices[len(m.Devices)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 13:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueueDepth", wireType)
+			}
+			m.QueueDepth = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.QueueDepth |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 14:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ReadLatency", wireType)
+			}
+			m.ReadLatency = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.ReadLatency |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTorus(data[iNdEx:])
@@ -2414,6 +2759,63 @@ func (m *RebalanceInfo) Unmarshal(data []byte) error {
 				}
 			}
 			m.Rebalancing = bool(v != 0)
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PassCheckedBlocks", wireType)
+			}
+			m.PassCheckedBlocks = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.PassCheckedBlocks |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PassBlocks", wireType)
+			}
+			m.PassBlocks = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.PassBlocks |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UnderReplicatedBlocks", wireType)
+			}
+			m.UnderReplicatedBlocks = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTorus
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.UnderReplicatedBlocks |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTorus(data[iNdEx:])
@@ -2986,42 +3388,54 @@ var (
 )
 
 var fileDescriptorTorus = []byte{
-	// 578 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x53, 0xcf, 0x6e, 0xd3, 0x4e,
-	0x10, 0xfe, 0x39, 0xb1, 0x5d, 0x67, 0x92, 0xf4, 0x57, 0x16, 0x0a, 0x56, 0x24, 0xd2, 0xca, 0x42,
-	0x50, 0x09, 0x9a, 0x4a, 0xc0, 0x01, 0x71, 0x23, 0x85, 0x43, 0x24, 0x84, 0x50, 0xa4, 0x72, 0xb5,
-	0xd6, 0xce, 0x3a, 0x5d, 0xd5, 0xf1, 0x46, 0xde, 0x75, 0x44, 0x78, 0x0a, 0x1e, 0x83, 0x47, 0xe8,
-	0x09, 0x71, 0xe4, 0x82, 0xc4, 0x13, 0xa0, 0x52, 0x5e, 0x82, 0x23, 0xe3, 0x71, 0x9c, 0x16, 0xc1,
-	0x81, 0x1e, 0x46, 0xca, 0xce, 0x9f, 0xcf, 0xdf, 0xf7, 0xcd, 0x04, 0xda, 0x46, 0xe5, 0x85, 0x1e,
-	0xcc, 0x73, 0x65, 0x14, 0x73, 0x67, 0x6a, 0x22, 0x52, 0xdd, 0xdb, 0x9f, 0x4a, 0x73, 0x5c, 0x44,
-	0x83, 0x58, 0xcd, 0x0e, 0xa6, 0x6a, 0xaa, 0x0e, 0xa8, 0x1c, 0x15, 0x09, 0xbd, 0xe8, 0x41, 0xbf,
-	0xaa, 0xb1, 0xe0, 0xa3, 0x05, 0xce, 0xe8, 0x15, 0x8e, 0xb2, 0x4d, 0x70, 0x17, 0x2a, 0x2d, 0x66,
-	0xc2, 0xb7, 0x76, 0xad, 0x3d, 0x9b, 0xf9, 0xe0, 0xc8, 0x0c, 0x0b, 0x7e, 0xa3, 0x7c, 0x0e, 0x5b,
-	0xe7, 0xdf, 0x76, 0x56, 0x9d, 0x5b, 0xe0, 0x25, 0x32, 0x15, 0x5a, 0xbe, 0x13, 0xbe, 0x4d, 0xbd,
-	0xf7, 0xc0, 0xe1, 0xc6, 0xe4, 0xda, 0xdf, 0xd8, 0x6d, 0xee, 0xb5, 0x1f, 0xfa, 0x83, 0x8a, 0xcc,
-	0x80, 0xfa, 0x07, 0xcf, 0xca, 0xd2, 0x8b, 0xcc, 0xe4, 0x4b, 0x16, 0x80, 0x1b, 0xa5, 0x2a, 0x3e,
-	0xd1, 0xbe, 0x47, 0x9d, 0xac, 0xee, 0x1c, 0x96, 0xd9, 0x97, 0x7c, 0x29, 0xf2, 0xde, 0x03, 0x80,
-	0x4b, 0x13, 0x6d, 0x68, 0x9e, 0x88, 0x25, 0x71, 0x6a, 0xb1, 0x2e, 0x38, 0x0b, 0x9e, 0x16, 0x15,
-	0xa7, 0xd6, 0xd3, 0xc6, 0x13, 0x2b, 0xb8, 0x0f, 0x70, 0x31, 0xcb, 0x3a, 0x60, 0x9b, 0xe5, 0xbc,
-	0x92, 0xd0, 0x65, 0xff, 0xc3, 0x46, 0xac, 0x32, 0x23, 0x32, 0x43, 0x03, 0x9d, 0xe0, 0x10, 0xdc,
-	0x37, 0xa4, 0xb1, 0x6c, 0xcc, 0xf8, 0x4a, 0x6b, 0x8b, 0x01, 0x34, 0xe4, 0xa4, 0x12, 0xba, 0x86,
-	0x68, 0x52, 0xe5, 0x1a, 0xb4, 0x66, 0xfc, 0x6d, 0x18, 0x2d, 0x8d, 0xd0, 0x95, 0xd8, 0xe0, 0x8b,
-	0x05, 0xde, 0x6b, 0x21, 0xf2, 0x51, 0x96, 0x28, 0x76, 0x13, 0xec, 0xa2, 0xc0, 0x59, 0xc2, 0x19,
-	0x7a, 0x68, 0x92, 0x7d, 0x74, 0x34, 0x7a, 0x5e, 0x7e, 0x9a, 0x4f, 0x26, 0xb9, 0xd0, 0xba, 0xe2,
-	0x5a, 0x02, 0xa5, 0x5c, 0x9b, 0x50, 0x0b, 0x91, 0x11, 0x76, 0x93, 0xdd, 0x80, 0x8e, 0x51, 0x86,
-	0xa7, 0xe1, 0xca, 0x92, 0xca, 0xcb, 0xeb, 0xd0, 0x2e, 0xb4, 0x98, 0xd4, 0x49, 0x87, 0x92, 0x38,
-	0x6d, 0xe4, 0x0c, 0xb3, 0xaa, 0x30, 0xbe, 0x8b, 0x29, 0x8f, 0xed, 0xc3, 0x66, 0x2e, 0x22, 0x9e,
-	0xf2, 0x2c, 0x16, 0xa1, 0x44, 0x2e, 0x68, 0xbe, 0x85, 0x96, 0x6e, 0xd7, 0x96, 0x8e, 0xeb, 0x2a,
-	0x11, 0xf5, 0x61, 0x8b, 0x36, 0x1e, 0xab, 0x34, 0x5c, 0x88, 0x5c, 0x4b, 0x95, 0xe1, 0x0e, 0x4a,
-	0x3d, 0x11, 0x74, 0x7f, 0x6f, 0xbd, 0x0d, 0xdb, 0x44, 0xf5, 0x02, 0x3e, 0x91, 0x99, 0xd4, 0xc7,
-	0x24, 0xb2, 0xf9, 0x97, 0xf2, 0x8a, 0x6a, 0xa3, 0xe6, 0x5f, 0x57, 0x64, 0x36, 0x25, 0xa9, 0x5e,
-	0x70, 0x6a, 0x81, 0x3d, 0xc6, 0xe7, 0x9f, 0x0b, 0xaa, 0xb9, 0x34, 0x28, 0xd1, 0x03, 0x96, 0x8b,
-	0x79, 0x2a, 0x63, 0x6e, 0x30, 0x19, 0x26, 0x3c, 0xc6, 0x1b, 0x27, 0x8c, 0x2e, 0xdb, 0x01, 0x67,
-	0x8e, 0xb6, 0x97, 0x3e, 0x95, 0xa7, 0xb3, 0x55, 0xeb, 0x5c, 0xef, 0xe2, 0x6e, 0x7d, 0x85, 0x0e,
-	0x35, 0xdc, 0x5a, 0x1b, 0x81, 0x1f, 0xbe, 0x74, 0x84, 0xff, 0x7c, 0x60, 0x1d, 0x3a, 0xb0, 0x43,
-	0xf0, 0xe8, 0xc0, 0xc6, 0x22, 0xb9, 0xc2, 0x7f, 0x04, 0x81, 0xc8, 0x15, 0xe2, 0x6e, 0x07, 0x8f,
-	0xc1, 0xa3, 0xfc, 0x95, 0x40, 0x86, 0x77, 0xce, 0xbe, 0xf7, 0xad, 0x9f, 0x18, 0x1f, 0xce, 0xfb,
-	0xd6, 0x29, 0xc6, 0x27, 0x8c, 0xcf, 0x18, 0x5f, 0x31, 0xce, 0x30, 0xde, 0xff, 0xe8, 0xff, 0x17,
-	0xb9, 0xb4, 0xd7, 0x47, 0xbf, 0x02, 0x00, 0x00, 0xff, 0xff, 0xb1, 0x01, 0x4d, 0xd4, 0x0f, 0x04,
-	0x00, 0x00,
+	// 773 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x54, 0x4f, 0x6f, 0xe3, 0x44,
+	0x14, 0xaf, 0x13, 0x3b, 0x75, 0x5e, 0x9a, 0xa5, 0x3b, 0xbb, 0x65, 0xad, 0x2e, 0x72, 0x42, 0x0e,
+	0x28, 0x20, 0x9a, 0x95, 0x8a, 0x84, 0x56, 0x2b, 0x2e, 0x64, 0x61, 0xa5, 0x4a, 0x08, 0xd0, 0xa0,
+	0xad, 0xc4, 0x01, 0x59, 0x8e, 0x3d, 0x49, 0x47, 0x75, 0x66, 0x22, 0xcf, 0xb8, 0x6a, 0xfa, 0x29,
+	0xf8, 0x0c, 0x9c, 0xf8, 0x08, 0x5c, 0x90, 0x38, 0x72, 0xec, 0x91, 0x53, 0xd5, 0xba, 0xdf, 0x00,
+	0x71, 0xe0, 0x88, 0xe6, 0x8d, 0x9d, 0x3f, 0x02, 0x0e, 0xb0, 0xb7, 0x79, 0xbf, 0xdf, 0xef, 0xbd,
+	0x79, 0xf3, 0x7b, 0x33, 0x03, 0x1d, 0x2d, 0xf3, 0x42, 0x8d, 0x16, 0xb9, 0xd4, 0x92, 0xb4, 0xe6,
+	0x32, 0x65, 0x99, 0x3a, 0x3c, 0x9a, 0x71, 0x7d, 0x56, 0x4c, 0x46, 0x89, 0x9c, 0x3f, 0x9b, 0xc9,
+	0x99, 0x7c, 0x86, 0xf4, 0xa4, 0x98, 0x62, 0x84, 0x01, 0xae, 0x6c, 0xda, 0xe0, 0x77, 0x07, 0xbc,
+	0x93, 0x2f, 0x65, 0xca, 0xc8, 0xdb, 0xd0, 0xba, 0x90, 0x59, 0x31, 0x67, 0x81, 0xd3, 0x77, 0x86,
+	0x2e, 0xad, 0x22, 0xd2, 0x03, 0x8f, 0x0b, 0x99, 0xb2, 0xa0, 0x61, 0xe0, 0x71, 0xbb, 0xbc, 0xe9,
+	0xd9, 0x0c, 0x6a, 0x71, 0x72, 0x08, 0xfe, 0x94, 0x67, 0x4c, 0xf1, 0x2b, 0x16, 0xb8, 0x98, 0xba,
+	0x8a, 0xc9, 0x08, 0xbc, 0x58, 0xeb, 0x5c, 0x05, 0xbb, 0xfd, 0xe6, 0xb0, 0x73, 0x1c, 0x8c, 0x6c,
+	0x97, 0x23, 0x2c, 0x30, 0xfa, 0xd4, 0x50, 0x9f, 0x0b, 0x9d, 0x2f, 0xa9, 0x95, 0x91, 0x0f, 0xa0,
+	0x35, 0xc9, 0x64, 0x72, 0xae, 0x02, 0x1f, 0x13, 0x48, 0x9d, 0x30, 0x36, 0xe8, 0x17, 0xf1, 0x92,
+	0xe5, 0xb4, 0x52, 0x1c, 0x3e, 0x07, 0x58, 0x17, 0x20, 0xfb, 0xd0, 0x3c, 0x67, 0x4b, 0xec, 0xbd,
+	0x4d, 0xcd, 0x92, 0x3c, 0x06, 0xef, 0x22, 0xce, 0x0a, 0xdb, 0x78, 0x9b, 0xda, 0xe0, 0x45, 0xe3,
+	0xb9, 0x33, 0x78, 0x01, 0xb0, 0xae, 0x47, 0x08, 0xb8, 0x7a, 0xb9, 0xb0, 0xc7, 0xee, 0x52, 0x5c,
+	0x93, 0x00, 0x76, 0x13, 0x29, 0x34, 0x13, 0x1a, 0xb3, 0xf7, 0x68, 0x1d, 0x0e, 0xbe, 0x83, 0xd6,
+	0xa9, 0x35, 0x86, 0x80, 0x2b, 0xe2, 0xca, 0xae, 0x36, 0xc5, 0x35, 0x79, 0x00, 0x0d, 0x9e, 0x5a,
+	0xa7, 0x68, 0x83, 0xa7, 0xab, 0xda, 0x4d, 0xab, 0xc1, 0xda, 0x4f, 0xa1, 0x3d, 0x8f, 0x2f, 0xa3,
+	0xc9, 0x52, 0x33, 0x55, 0x1b, 0x36, 0x8f, 0x2f, 0xc7, 0x26, 0x1e, 0xfc, 0xdc, 0x00, 0xff, 0x6b,
+	0xc6, 0xf2, 0x13, 0x31, 0x95, 0xe4, 0x1d, 0x70, 0x8b, 0x82, 0xa7, 0x76, 0x87, 0xb1, 0x5f, 0xde,
+	0xf4, 0xdc, 0xd7, 0xaf, 0x4f, 0x3e, 0xa3, 0x88, 0x9a, 0x1e, 0xe3, 0x34, 0xcd, 0x99, 0x52, 0xd5,
+	0x09, 0xeb, 0xd0, 0xec, 0x90, 0xc5, 0x4a, 0x47, 0x8a, 0x31, 0x81, 0x5b, 0x37, 0xa9, 0x6f, 0x80,
+	0x6f, 0x18, 0x13, 0xe4, 0x5d, 0xd8, 0xd3, 0x52, 0xc7, 0x59, 0x54, 0x19, 0x6d, 0x3b, 0xe8, 0x20,
+	0x86, 0xae, 0x28, 0xd2, 0x83, 0x4e, 0xa1, 0x58, 0x5a, 0x2b, 0x3c, 0x54, 0x80, 0x81, 0x2a, 0xc1,
+	0x53, 0x68, 0x6b, 0x3e, 0x67, 0x69, 0x24, 0x0b, 0x1d, 0xb4, 0xfa, 0xce, 0xd0, 0xa7, 0x3e, 0x02,
+	0x5f, 0x15, 0x9a, 0x7c, 0x02, 0x0f, 0x72, 0x36, 0x89, 0xb3, 0x58, 0x24, 0x2c, 0xe2, 0x62, 0x2a,
+	0x83, 0xdd, 0xbe, 0x33, 0xec, 0x1c, 0x1f, 0xd4, 0xb3, 0xa4, 0x35, 0x6b, 0x0e, 0x49, 0xbb, 0xf9,
+	0x66, 0x48, 0xde, 0x87, 0x7d, 0xbc, 0x99, 0x89, 0xcc, 0xa2, 0x0b, 0x96, 0x2b, 0x2e, 0x45, 0xe0,
+	0x63, 0x03, 0x6f, 0xd5, 0xf8, 0xa9, 0x85, 0x8d, 0xb9, 0x57, 0x52, 0xb0, 0xa0, 0x6d, 0xcd, 0x35,
+	0xeb, 0xc1, 0x0f, 0x0d, 0xe8, 0x6e, 0xd5, 0x27, 0xc7, 0x70, 0x80, 0x66, 0xac, 0x7b, 0x9a, 0x72,
+	0xc1, 0xd5, 0x19, 0xba, 0xda, 0xa4, 0x8f, 0x0c, 0xb9, 0xca, 0x78, 0x85, 0xd4, 0x3f, 0xe4, 0x54,
+	0x56, 0xd8, 0xc9, 0x6e, 0xe7, 0x54, 0x9e, 0xf4, 0xa1, 0x53, 0xcb, 0xb9, 0x98, 0xa1, 0xed, 0x3e,
+	0xdd, 0x84, 0xc8, 0x08, 0x1e, 0x2d, 0x62, 0xa5, 0xa2, 0xe4, 0x8c, 0x25, 0xe7, 0x2c, 0xdd, 0x1e,
+	0xc0, 0x43, 0x43, 0xbd, 0xb4, 0xcc, 0x7a, 0x0c, 0xa8, 0xdf, 0x1e, 0x83, 0x81, 0x2a, 0xc1, 0xc7,
+	0xf0, 0xa4, 0x10, 0x29, 0xcb, 0xa3, 0x9c, 0x2d, 0x32, 0x9e, 0xc4, 0x7a, 0x5d, 0xb4, 0x85, 0xe2,
+	0x03, 0xa4, 0xe9, 0x8a, 0xb5, 0x79, 0x83, 0x3f, 0x1c, 0x70, 0xa9, 0xe9, 0xe8, 0x5f, 0xae, 0x7e,
+	0xed, 0x7b, 0x03, 0xe1, 0x3a, 0x24, 0x47, 0x40, 0xea, 0x8d, 0xb8, 0x14, 0xd1, 0x34, 0x4e, 0xb4,
+	0xcc, 0xf1, 0xa0, 0x5d, 0xfa, 0x70, 0x83, 0x79, 0x85, 0x04, 0x79, 0x0f, 0xbc, 0x05, 0x63, 0xb9,
+	0x39, 0xa0, 0x79, 0xca, 0xfb, 0xf5, 0xf8, 0xeb, 0xeb, 0x4d, 0x2d, 0x4d, 0x8e, 0xea, 0x3f, 0xc2,
+	0x43, 0xdd, 0x93, 0xd5, 0x35, 0xe1, 0x62, 0xf6, 0xf7, 0x2f, 0xe2, 0xbf, 0x3d, 0xfb, 0xbd, 0xcd,
+	0x67, 0xff, 0x2d, 0xf8, 0x68, 0x00, 0x65, 0xd3, 0xff, 0xff, 0xdb, 0x3d, 0x06, 0x0f, 0x2d, 0xc6,
+	0x73, 0xbb, 0xd4, 0x06, 0x83, 0x97, 0xe0, 0x5b, 0xd5, 0x1b, 0x94, 0x1e, 0x7f, 0x78, 0x7b, 0x17,
+	0x3a, 0x7f, 0xde, 0x85, 0xce, 0x8f, 0x65, 0xe8, 0xfc, 0x54, 0x86, 0xce, 0x2f, 0x65, 0xe8, 0xfc,
+	0x5a, 0x86, 0xce, 0x75, 0x19, 0x3a, 0xb7, 0x65, 0xe8, 0x7c, 0x7f, 0x1f, 0xee, 0x5c, 0xdf, 0x87,
+	0x3b, 0xbf, 0xdd, 0x87, 0x3b, 0x93, 0x16, 0x3e, 0x87, 0x8f, 0xfe, 0x1a, 0x00, 0x32, 0x75, 0x89,
+	0x60, 0x06, 0x06, 0x00, 0x00,
 }
@@ -0,0 +1,793 @@
+// Code generated by protoc-gen-gogo.
+// source: transfer.proto
+// DO NOT EDIT!
+
+package models
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import _ "github.com/gogo/protobuf/gogoproto"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+import io "io"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type TransferBlock struct {
+	// Transfer identifies the transfer, so that it can be resumed on a new
+	// stream if this one breaks.
+	Transfer string `protobuf:"bytes,1,opt,name=transfer,proto3" json:"transfer,omitempty"`
+	// Offset is the position of the block in the transfer. Offsets must
+	// increase, but may skip blocks the sender couldn't read.
+	Offset uint64    `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Ref    *BlockRef `protobuf:"bytes,3,opt,name=ref" json:"ref,omitempty"`
+	Data   []byte    `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	// Crc is the CRC-32 (Castagnoli) of data.
+	Crc uint32 `protobuf:"varint,5,opt,name=crc,proto3" json:"crc,omitempty"`
+	// Epoch is the attachment epoch the block is written at, if any.
+	Epoch uint64 `protobuf:"varint,6,opt,name=epoch,proto3" json:"epoch,omitempty"`
+}
+
+func (m *TransferBlock) Reset()                    { *m = TransferBlock{} }
+func (m *TransferBlock) String() string            { return proto.CompactTextString(m) }
+func (*TransferBlock) ProtoMessage()               {}
+func (*TransferBlock) Descriptor() ([]byte, []int) { return fileDescriptorTransfer, []int{0} }
+
+func (m *TransferBlock) GetRef() *BlockRef {
+	if m != nil {
+		return m.Ref
+	}
+	return nil
+}
+
+type TransferAck struct {
+	// Offset is one past the last block the peer has handled.
+	Offset uint64 `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	// Err, if set, is why the peer couldn't store the block.
+	Err string `protobuf:"bytes,2,opt,name=err,proto3" json:"err,omitempty"`
+	// Failed lists the offsets of the blocks the peer couldn't store, in
+	// answer to the first message of a resumed transfer.
+	Failed []uint64 `protobuf:"varint,3,rep,name=failed" json:"failed,omitempty"`
+}
+
+func (m *TransferAck) Reset()                    { *m = TransferAck{} }
+func (m *TransferAck) String() string            { return proto.CompactTextString(m) }
+func (*TransferAck) ProtoMessage()               {}
+func (*TransferAck) Descriptor() ([]byte, []int) { return fileDescriptorTransfer, []int{1} }
+
+func init() {
+	proto.RegisterType((*TransferBlock)(nil), "models.TransferBlock")
+	proto.RegisterType((*TransferAck)(nil), "models.TransferAck")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion2
+
+// Client API for TorusTransfer service
+
+type TorusTransferClient interface {
+	Transfer(ctx context.Context, opts ...grpc.CallOption) (TorusTransfer_TransferClient, error)
+}
+
+type torusTransferClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTorusTransferClient(cc *grpc.ClientConn) TorusTransferClient {
+	return &torusTransferClient{cc}
+}
+
+func (c *torusTransferClient) Transfer(ctx context.Context, opts ...grpc.CallOption) (TorusTransfer_TransferClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_TorusTransfer_serviceDesc.Streams[0], c.cc, "/models.TorusTransfer/Transfer", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &torusTransferTransferClient{stream}
+	return x, nil
+}
+
+type TorusTransfer_TransferClient interface {
+	Send(*TransferBlock) error
+	Recv() (*TransferAck, error)
+	grpc.ClientStream
+}
+
+type torusTransferTransferClient struct {
+	grpc.ClientStream
+}
+
+func (x *torusTransferTransferClient) Send(m *TransferBlock) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *torusTransferTransferClient) Recv() (*TransferAck, error) {
+	m := new(TransferAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for TorusTransfer service
+
+type TorusTransferServer interface {
+	Transfer(TorusTransfer_TransferServer) error
+}
+
+func RegisterTorusTransferServer(s *grpc.Server, srv TorusTransferServer) {
+	s.RegisterService(&_TorusTransfer_serviceDesc, srv)
+}
+
+func _TorusTransfer_Transfer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TorusTransferServer).Transfer(&torusTransferTransferServer{stream})
+}
+
+type TorusTransfer_TransferServer interface {
+	Send(*TransferAck) error
+	Recv() (*TransferBlock, error)
+	grpc.ServerStream
+}
+
+type torusTransferTransferServer struct {
+	grpc.ServerStream
+}
+
+func (x *torusTransferTransferServer) Send(m *TransferAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *torusTransferTransferServer) Recv() (*TransferBlock, error) {
+	m := new(TransferBlock)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _TorusTransfer_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "models.TorusTransfer",
+	HandlerType: (*TorusTransferServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Transfer",
+			Handler:       _TorusTransfer_Transfer_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+func (m *TransferBlock) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *TransferBlock) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Transfer) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintTransfer(data, i, uint64(len(m.Transfer)))
+		i += copy(data[i:], m.Transfer)
+	}
+	if m.Offset != 0 {
+		data[i] = 0x10
+		i++
+		i = encodeVarintTransfer(data, i, uint64(m.Offset))
+	}
+	if m.Ref != nil {
+		data[i] = 0x1a
+		i++
+		i = encodeVarintTransfer(data, i, uint64(m.Ref.Size()))
+		n1, err := m.Ref.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n1
+	}
+	if len(m.Data) > 0 {
+		data[i] = 0x22
+		i++
+		i = encodeVarintTransfer(data, i, uint64(len(m.Data)))
+		i += copy(data[i:], m.Data)
+	}
+	if m.Crc != 0 {
+		data[i] = 0x28
+		i++
+		i = encodeVarintTransfer(data, i, uint64(m.Crc))
+	}
+	if m.Epoch != 0 {
+		data[i] = 0x30
+		i++
+		i = encodeVarintTransfer(data, i, uint64(m.Epoch))
+	}
+	return i, nil
+}
+
+func (m *TransferAck) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *TransferAck) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Offset != 0 {
+		data[i] = 0x8
+		i++
+		i = encodeVarintTransfer(data, i, uint64(m.Offset))
+	}
+	if len(m.Err) > 0 {
+		data[i] = 0x12
+		i++
+		i = encodeVarintTransfer(data, i, uint64(len(m.Err)))
+		i += copy(data[i:], m.Err)
+	}
+	if len(m.Failed) > 0 {
+		for _, num := range m.Failed {
+			data[i] = 0x18
+			i++
+			i = encodeVarintTransfer(data, i, uint64(num))
+		}
+	}
+	return i, nil
+}
+
+func encodeFixed64Transfer(data []byte, offset int, v uint64) int {
+	data[offset] = uint8(v)
+	data[offset+1] = uint8(v >> 8)
+	data[offset+2] = uint8(v >> 16)
+	data[offset+3] = uint8(v >> 24)
+	data[offset+4] = uint8(v >> 32)
+	data[offset+5] = uint8(v >> 40)
+	data[offset+6] = uint8(v >> 48)
+	data[offset+7] = uint8(v >> 56)
+	return offset + 8
+}
+func encodeFixed32Transfer(data []byte, offset int, v uint32) int {
+	data[offset] = uint8(v)
+	data[offset+1] = uint8(v >> 8)
+	data[offset+2] = uint8(v >> 16)
+	data[offset+3] = uint8(v >> 24)
+	return offset + 4
+}
+func encodeVarintTransfer(data []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		data[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	data[offset] = uint8(v)
+	return offset + 1
+}
+func (m *TransferBlock) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Transfer)
+	if l > 0 {
+		n += 1 + l + sovTransfer(uint64(l))
+	}
+	if m.Offset != 0 {
+		n += 1 + sovTransfer(uint64(m.Offset))
+	}
+	if m.Ref != nil {
+		l = m.Ref.Size()
+		n += 1 + l + sovTransfer(uint64(l))
+	}
+	l = len(m.Data)
+	if l > 0 {
+		n += 1 + l + sovTransfer(uint64(l))
+	}
+	if m.Crc != 0 {
+		n += 1 + sovTransfer(uint64(m.Crc))
+	}
+	if m.Epoch != 0 {
+		n += 1 + sovTransfer(uint64(m.Epoch))
+	}
+	return n
+}
+
+func (m *TransferAck) Size() (n int) {
+	var l int
+	_ = l
+	if m.Offset != 0 {
+		n += 1 + sovTransfer(uint64(m.Offset))
+	}
+	l = len(m.Err)
+	if l > 0 {
+		n += 1 + l + sovTransfer(uint64(l))
+	}
+	if len(m.Failed) > 0 {
+		for _, e := range m.Failed {
+			n += 1 + sovTransfer(uint64(e))
+		}
+	}
+	return n
+}
+
+func sovTransfer(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozTransfer(x uint64) (n int) {
+	return sovTransfer(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *TransferBlock) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTransfer
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TransferBlock: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TransferBlock: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Transfer", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTransfer
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Transfer = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Offset", wireType)
+			}
+			m.Offset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Offset |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Ref", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTransfer
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Ref == nil {
+				m.Ref = &BlockRef{}
+			}
+			if err := m.Ref.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthTransfer
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], data[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Crc", wireType)
+			}
+			m.Crc = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Crc |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Epoch", wireType)
+			}
+			m.Epoch = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Epoch |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTransfer(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTransfer
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *TransferAck) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTransfer
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TransferAck: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TransferAck: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Offset", wireType)
+			}
+			m.Offset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Offset |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Err", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTransfer
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Err = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Failed", wireType)
+			}
+			var v uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Failed = append(m.Failed, v)
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTransfer(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTransfer
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipTransfer(data []byte) (n int, err error) {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowTransfer
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if data[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowTransfer
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			iNdEx += length
+			if length < 0 {
+				return 0, ErrInvalidLengthTransfer
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowTransfer
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := data[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipTransfer(data[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthTransfer = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowTransfer   = fmt.Errorf("proto: integer overflow")
+)
+
+var fileDescriptorTransfer = []byte{
+	// 288 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x90, 0xc1, 0x4e, 0x02, 0x31,
+	0x14, 0x45, 0x79, 0x16, 0x09, 0x14, 0x31, 0xa4, 0x46, 0xd3, 0xcc, 0xa2, 0x69, 0x58, 0x75, 0xe3,
+	0x60, 0x70, 0xe7, 0x0e, 0xb6, 0x2e, 0x4c, 0x1a, 0x7e, 0x60, 0x28, 0x2d, 0x12, 0x06, 0x6b, 0x3a,
+	0x9d, 0xcf, 0x30, 0xf1, 0xb3, 0x5c, 0xb2, 0x74, 0x69, 0x66, 0x7e, 0xc4, 0xb4, 0xc3, 0x10, 0x71,
+	0x77, 0xcf, 0xbc, 0x37, 0xf7, 0xde, 0x3e, 0x7c, 0xed, 0x5d, 0xf6, 0x56, 0x18, 0xed, 0xd2, 0x77,
+	0x67, 0xbd, 0x25, 0xbd, 0xbd, 0x5d, 0xeb, 0xbc, 0x48, 0xee, 0x37, 0x5b, 0xff, 0x5a, 0xae, 0x52,
+	0x65, 0xf7, 0xd3, 0x8d, 0xdd, 0xd8, 0x69, 0x1c, 0xaf, 0x4a, 0x13, 0x29, 0x42, 0x54, 0xcd, 0x6f,
+	0xc9, 0xd0, 0x5b, 0x57, 0x16, 0x0d, 0x4c, 0x3e, 0x00, 0x8f, 0x96, 0x47, 0xdb, 0x45, 0x6e, 0xd5,
+	0x8e, 0x24, 0xb8, 0xdf, 0xe6, 0x50, 0xe0, 0x20, 0x06, 0xf2, 0xc4, 0xe4, 0x0e, 0xf7, 0xac, 0x31,
+	0x85, 0xf6, 0xf4, 0x82, 0x83, 0xe8, 0xca, 0x23, 0x91, 0x09, 0x46, 0x4e, 0x1b, 0x8a, 0x38, 0x88,
+	0xe1, 0x6c, 0x9c, 0x36, 0xbd, 0xd2, 0xe8, 0x27, 0xb5, 0x91, 0x61, 0x48, 0x08, 0xee, 0xae, 0x33,
+	0x9f, 0xd1, 0x2e, 0x07, 0x71, 0x25, 0xa3, 0x26, 0x63, 0x8c, 0x94, 0x53, 0xf4, 0x92, 0x83, 0x18,
+	0xc9, 0x20, 0x27, 0x2f, 0x78, 0xd8, 0xd6, 0x99, 0xab, 0xdd, 0x9f, 0x40, 0x38, 0x0b, 0x1c, 0x63,
+	0xa4, 0x9d, 0x8b, 0x2d, 0x06, 0x32, 0xc8, 0xb0, 0x69, 0xb2, 0x6d, 0xae, 0xd7, 0x14, 0x71, 0x14,
+	0x36, 0x1b, 0x9a, 0x3d, 0xe3, 0xd1, 0x32, 0xbc, 0xb7, 0x75, 0x25, 0x4f, 0xb8, 0x7f, 0xd2, 0xb7,
+	0x6d, 0xd5, 0xb3, 0x13, 0x24, 0x37, 0xff, 0x3f, 0xcf, 0xd5, 0x4e, 0xc0, 0x03, 0x2c, 0xe8, 0x57,
+	0xc5, 0xe0, 0x50, 0x31, 0xf8, 0xa9, 0x18, 0x7c, 0xd6, 0xac, 0x73, 0xa8, 0x59, 0xe7, 0xbb, 0x66,
+	0x9d, 0x55, 0x2f, 0x9e, 0xf3, 0xf1, 0x77, 0x00, 0x77, 0x79, 0xf1, 0xa1, 0xa4, 0x01, 0x00, 0x00,
+}
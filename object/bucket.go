@@ -0,0 +1,536 @@
+package object
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	"github.com/coreos/torus/models"
+)
+
+const VolumeType = "object"
+
+const (
+	// MinPartSize is the smallest a part of a multipart upload may be,
+	// except for the last one.
+	MinPartSize = 5 * 1024 * 1024
+	// MaxPartNumber is the highest part number of a multipart upload.
+	MaxPartNumber = 10000
+)
+
+var (
+	// ErrInvalidBucketName is returned for names S3 clients couldn't address.
+	ErrInvalidBucketName = errors.New("object: invalid bucket name")
+	// ErrInvalidPart is returned when completing an upload with a part that
+	// wasn't uploaded, or whose ETag doesn't match.
+	ErrInvalidPart = errors.New("object: invalid part")
+	// ErrInvalidPartOrder is returned when completing an upload with parts
+	// that aren't in ascending order.
+	ErrInvalidPartOrder = errors.New("object: parts not in ascending order")
+	// ErrEntityTooSmall is returned when completing an upload with a part
+	// other than the last smaller than MinPartSize.
+	ErrEntityTooSmall = errors.New("object: part too small")
+	// ErrQuotaExceeded is returned when storing an object would take a
+	// bucket over its quota.
+	ErrQuotaExceeded = errors.New("object: bucket quota exceeded")
+)
+
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Bucket is an object volume, holding objects by key.
+type Bucket struct {
+	srv    *torus.Server
+	mds    objectMetadata
+	volume *models.Volume
+}
+
+// PutOptions are the optional parts of putting an object or a part.
+type PutOptions struct {
+	ContentType string
+	Metadata    map[string]string
+	// Check, if set, is called with the MD5 and SHA-256 of the data once it
+	// has been written, and fails the put if it returns an error.
+	Check func(md5Sum, sha256Sum []byte) error
+}
+
+// CompletedPart is a part a multipart upload is completed with.
+type CompletedPart struct {
+	Number int
+	ETag   string
+}
+
+type partsByNumber []*Part
+
+func (p partsByNumber) Len() int           { return len(p) }
+func (p partsByNumber) Less(i, j int) bool { return p[i].Number < p[j].Number }
+func (p partsByNumber) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// CreateBucket creates an empty bucket. Buckets are as large as the default
+// volume quota, if there is one; otherwise they have no size limit of their
+// own until one is set by resizing them, and take what the cluster has.
+func CreateBucket(mds torus.MetadataService, name string) error {
+	if !bucketNameRegexp.MatchString(name) {
+		return ErrInvalidBucketName
+	}
+	size, err := torus.GetVolumeQuota(mds, 0)
+	if err != nil {
+		return err
+	}
+	if err := torus.CheckCapacity(mds, size); err != nil {
+		return err
+	}
+	id, err := mds.NewVolumeID()
+	if err != nil {
+		return err
+	}
+	omd, err := createObjectMetadata(mds, name, id)
+	if err != nil {
+		return err
+	}
+	return omd.CreateBucket(&models.Volume{
+		Name:     name,
+		Id:       uint64(id),
+		Type:     VolumeType,
+		MaxBytes: size,
+	})
+}
+
+// DeleteBucket deletes a bucket, which must have no objects or uploads left.
+func DeleteBucket(mds torus.MetadataService, name string) error {
+	vol, err := mds.GetVolume(name)
+	if err != nil {
+		return err
+	}
+	if vol.Type != VolumeType {
+		return torus.ErrWrongVolumeType
+	}
+	omd, err := createObjectMetadata(mds, vol.Name, torus.VolumeID(vol.Id))
+	if err != nil {
+		return err
+	}
+	return omd.DeleteBucket()
+}
+
+// ListBuckets returns the object volumes of the cluster.
+func ListBuckets(mds torus.MetadataService) ([]*models.Volume, error) {
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		return nil, err
+	}
+	var out []*models.Volume
+	for _, v := range vols {
+		if v.Type == VolumeType {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func OpenBucket(s *torus.Server, name string) (*Bucket, error) {
+	vol, err := s.MDS.GetVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	if vol.Type != VolumeType {
+		return nil, torus.ErrWrongVolumeType
+	}
+	mds, err := createObjectMetadata(s.MDS, vol.Name, torus.VolumeID(vol.Id))
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{
+		srv:    s,
+		mds:    mds,
+		volume: vol,
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.volume.Name
+}
+
+func (b *Bucket) vid() torus.VolumeID {
+	return torus.VolumeID(b.volume.Id)
+}
+
+func (b *Bucket) checkAccess(want torus.Permission) error {
+	return torus.CheckAccess(b.srv.MDS, b.vid(), b.srv.Cfg.Identity, want)
+}
+
+// beginWrite records where the INodes this server is about to write start,
+// so that they aren't collected before they are in the bucket's metadata.
+func (b *Bucket) beginWrite() (string, error) {
+	cur, err := b.srv.MDS.GetINodeIndex(b.vid())
+	if err != nil {
+		return "", err
+	}
+	return b.mds.BeginWrite(b.srv.Lease(), cur+1)
+}
+
+func (b *Bucket) endWrite(token string) {
+	if err := b.mds.EndWrite(token); err != nil {
+		clog.Warningf("couldn't end write to bucket %s: %v", b.volume.Name, err)
+	}
+}
+
+func (b *Bucket) newFile() (*torus.File, error) {
+	spec := b.mds.GlobalMetadata().DefaultBlockSpec
+	red, err := torus.GetRedundancy(b.srv.MDS, b.vid())
+	if err != nil {
+		return nil, err
+	}
+	if red.Kind == torus.ErasureCoded {
+		spec = blockset.WithErasureCoding(spec, red.Data, red.Parity)
+	}
+	bs, err := blockset.CreateBlocksetFromSpec(spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	inode := models.NewEmptyINode()
+	inode.Volume = b.volume.Id
+	inode.Blocks, err = torus.MarshalBlocksetToProto(bs)
+	if err != nil {
+		return nil, err
+	}
+	bs, err = blockset.UnmarshalFromProto(inode.Blocks, b.srv.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	return b.srv.CreateFile(b.volume, inode, bs)
+}
+
+// writePart writes the data in r to a new INode. An empty part doesn't take
+// an INode at all.
+func (b *Bucket) writePart(r io.Reader, check func(md5Sum, sha256Sum []byte) error) (*Part, error) {
+	f, err := b.newFile()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	md5h := md5.New()
+	var sha256h hash.Hash
+	w := io.MultiWriter(f, md5h)
+	if check != nil {
+		sha256h = sha256.New()
+		w = io.MultiWriter(f, md5h, sha256h)
+	}
+	buf := make([]byte, b.mds.GlobalMetadata().BlockSize)
+	n, err := io.CopyBuffer(w, r, buf)
+	if err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(md5h.Sum(nil), sha256h.Sum(nil)); err != nil {
+			return nil, err
+		}
+	}
+	p := &Part{
+		Size:         uint64(n),
+		ETag:         hex.EncodeToString(md5h.Sum(nil)),
+		LastModified: time.Now().UTC(),
+	}
+	if n == 0 {
+		return p, nil
+	}
+	if err := f.SyncBlocks(); err != nil {
+		return nil, err
+	}
+	ctx := torus.WithWriteLevel(context.TODO(), torus.WriteAll)
+	ref, err := f.SyncINode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.INode = uint64(ref.INode)
+	return p, nil
+}
+
+// Put stores the data in r as the object key, replacing any object there.
+func (b *Bucket) Put(key string, r io.Reader, opts PutOptions) (*Object, error) {
+	if err := b.checkAccess(torus.PermWrite); err != nil {
+		return nil, err
+	}
+	if err := b.checkFull(); err != nil {
+		return nil, err
+	}
+	token, err := b.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer b.endWrite(token)
+	p, err := b.writePart(r, opts.Check)
+	if err != nil {
+		return nil, err
+	}
+	p.Number = 1
+	o := &Object{
+		Key:          key,
+		Size:         p.Size,
+		ETag:         p.ETag,
+		ContentType:  opts.ContentType,
+		Metadata:     opts.Metadata,
+		LastModified: p.LastModified,
+		Parts:        []*Part{p},
+	}
+	// The data is already written, since its size isn't known until then;
+	// if it doesn't fit, the garbage collector frees it.
+	if err := b.checkQuota(key, o.Size); err != nil {
+		return nil, err
+	}
+	if err := b.mds.PutObject(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Head returns an object's metadata.
+func (b *Bucket) Head(key string) (*Object, error) {
+	if err := b.checkAccess(torus.PermRead); err != nil {
+		return nil, err
+	}
+	return b.mds.GetObject(key)
+}
+
+// Get returns an object and a reader of its data, which must be closed.
+func (b *Bucket) Get(key string) (*Object, *Reader, error) {
+	o, err := b.Head(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return o, newReader(b, o), nil
+}
+
+// Delete deletes an object. Its data is freed by the garbage collector.
+func (b *Bucket) Delete(key string) error {
+	if err := b.checkAccess(torus.PermWrite); err != nil {
+		return err
+	}
+	if err := b.mds.DeleteObject(key); err != nil {
+		return err
+	}
+	b.forgetUsage()
+	return nil
+}
+
+// List lists up to max objects with keys after after that start with
+// prefix. With a delimiter, keys that have it after the prefix are rolled up
+// into the common prefixes up to and including it, each of which counts
+// towards max once. next is the key or common prefix to list after to
+// continue, if the listing was cut short.
+func (b *Bucket) List(prefix, delimiter, after string, max int) (objs []*Object, prefixes []string, next string, err error) {
+	if err := b.checkAccess(torus.PermRead); err != nil {
+		return nil, nil, "", err
+	}
+	if max <= 0 {
+		return nil, nil, "", nil
+	}
+	// Keys can't have 0xff in them, being UTF-8, so this skips every key
+	// under a common prefix.
+	if delimiter != "" && strings.HasPrefix(after, prefix) && strings.HasSuffix(after, delimiter) {
+		after += "\xff"
+	}
+	var last string
+	for {
+		page, err := b.mds.ListObjects(prefix, after, max)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if len(page) == 0 {
+			return objs, prefixes, "", nil
+		}
+		rolled := false
+		for _, o := range page {
+			if len(objs)+len(prefixes) == max {
+				return objs, prefixes, last, nil
+			}
+			if delimiter != "" {
+				if i := strings.Index(o.Key[len(prefix):], delimiter); i >= 0 {
+					common := o.Key[:len(prefix)+i+len(delimiter)]
+					prefixes = append(prefixes, common)
+					last = common
+					after = common + "\xff"
+					rolled = true
+					break
+				}
+			}
+			objs = append(objs, o)
+			last = o.Key
+			after = o.Key
+		}
+		if !rolled && len(page) < max {
+			return objs, prefixes, "", nil
+		}
+	}
+}
+
+// NewUpload starts a multipart upload of an object.
+func (b *Bucket) NewUpload(key string, contentType string, metadata map[string]string) (*Upload, error) {
+	if err := b.checkAccess(torus.PermWrite); err != nil {
+		return nil, err
+	}
+	u := &Upload{
+		ID:          uuid.NewRandom().String(),
+		Key:         key,
+		Initiated:   time.Now().UTC(),
+		ContentType: contentType,
+		Metadata:    metadata,
+	}
+	if err := b.mds.CreateUpload(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// GetUpload returns an upload in progress.
+func (b *Bucket) GetUpload(id string) (*Upload, error) {
+	if err := b.checkAccess(torus.PermRead); err != nil {
+		return nil, err
+	}
+	return b.mds.GetUpload(id)
+}
+
+// Uploads returns the multipart uploads in progress, in order of their keys.
+func (b *Bucket) Uploads() ([]*Upload, error) {
+	if err := b.checkAccess(torus.PermRead); err != nil {
+		return nil, err
+	}
+	ups, err := b.mds.ListUploads()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(uploadsByKey(ups))
+	return ups, nil
+}
+
+// PutPart stores a part of a multipart upload, replacing any part with the
+// same number.
+func (b *Bucket) PutPart(id string, number int, r io.Reader, check func(md5Sum, sha256Sum []byte) error) (*Part, error) {
+	if number < 1 || number > MaxPartNumber {
+		return nil, torus.ErrInvalid
+	}
+	if err := b.checkAccess(torus.PermWrite); err != nil {
+		return nil, err
+	}
+	if _, err := b.mds.GetUpload(id); err != nil {
+		return nil, err
+	}
+	if err := b.checkFull(); err != nil {
+		return nil, err
+	}
+	token, err := b.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer b.endWrite(token)
+	p, err := b.writePart(r, check)
+	if err != nil {
+		return nil, err
+	}
+	p.Number = number
+	if err := b.mds.PutPart(id, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListParts returns the parts of an upload in progress.
+func (b *Bucket) ListParts(id string) ([]*Part, error) {
+	if err := b.checkAccess(torus.PermRead); err != nil {
+		return nil, err
+	}
+	return b.mds.GetParts(id)
+}
+
+// CompleteUpload makes an object out of the given parts of an upload. The
+// parts' INodes become the object's as they are, without copying. Parts
+// that were uploaded but aren't given are freed by the garbage collector.
+func (b *Bucket) CompleteUpload(id string, parts []CompletedPart) (*Object, error) {
+	if err := b.checkAccess(torus.PermWrite); err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, ErrInvalidPart
+	}
+	u, err := b.mds.GetUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	uploaded, err := b.mds.GetParts(id)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := make(map[int]*Part, len(uploaded))
+	for _, p := range uploaded {
+		byNumber[p.Number] = p
+	}
+	o := &Object{
+		Key:          u.Key,
+		ContentType:  u.ContentType,
+		Metadata:     u.Metadata,
+		LastModified: time.Now().UTC(),
+	}
+	for i := 1; i < len(parts); i++ {
+		if parts[i].Number <= parts[i-1].Number {
+			return nil, ErrInvalidPartOrder
+		}
+	}
+	etags := md5.New()
+	for i, cp := range parts {
+		p, ok := byNumber[cp.Number]
+		if !ok || strings.Trim(cp.ETag, `"`) != p.ETag {
+			return nil, ErrInvalidPart
+		}
+		if i != len(parts)-1 && p.Size < MinPartSize {
+			return nil, ErrEntityTooSmall
+		}
+		sum, err := hex.DecodeString(p.ETag)
+		if err != nil {
+			return nil, err
+		}
+		etags.Write(sum)
+		o.Size += p.Size
+		o.Parts = append(o.Parts, p)
+	}
+	// The ETag of a multipart object is the MD5 of its parts' MD5s, and the
+	// number of parts.
+	o.ETag = hex.EncodeToString(etags.Sum(nil)) + "-" + strconv.Itoa(len(parts))
+	if err := b.checkQuota(o.Key, o.Size); err != nil {
+		return nil, err
+	}
+	if err := b.mds.CompleteUpload(id, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// AbortUpload deletes an upload in progress. Its parts are freed by the
+// garbage collector.
+func (b *Bucket) AbortUpload(id string) error {
+	if err := b.checkAccess(torus.PermWrite); err != nil {
+		return err
+	}
+	return b.mds.DeleteUpload(id)
+}
+
+type uploadsByKey []*Upload
+
+func (u uploadsByKey) Len() int { return len(u) }
+func (u uploadsByKey) Less(i, j int) bool {
+	if u[i].Key != u[j].Key {
+		return u[i].Key < u[j].Key
+	}
+	return u[i].Initiated.Before(u[j].Initiated)
+}
+func (u uploadsByKey) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
@@ -0,0 +1,4 @@
+// object provides the implementation of the "object" volume type: a bucket
+// of immutable objects, each stored as one or more Torus INodes, for the S3
+// gateway.
+package object
@@ -0,0 +1,312 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/etcd"
+	"github.com/coreos/torus/models"
+)
+
+// Objects, uploads and their parts each have a key of their own under the
+// bucket's volumemeta, so that puts to different keys don't contend.
+type objectEtcd struct {
+	*etcd.Etcd
+	name string
+	vid  torus.VolumeID
+}
+
+func (b *objectEtcd) getContext() context.Context {
+	return context.TODO()
+}
+
+func (b *objectEtcd) key(parts ...string) string {
+	return etcd.MkKey(append([]string{"volumemeta", etcd.Uint64ToHex(uint64(b.vid))}, parts...)...)
+}
+
+func (b *objectEtcd) objectKey(key string) string {
+	return b.key("objects", key)
+}
+
+func (b *objectEtcd) uploadKey(id string) string {
+	return b.key("uploads", id)
+}
+
+func (b *objectEtcd) partsPrefix(id string) string {
+	return b.key("parts", id) + "/"
+}
+
+func (b *objectEtcd) CreateBucket(volume *models.Volume) error {
+	vbytes, err := volume.Marshal()
+	if err != nil {
+		return err
+	}
+	tx := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(etcd.MkKey("volumes", volume.Name)), "=", 0),
+	).Then(
+		etcdv3.OpPut(etcd.MkKey("volumes", volume.Name), string(etcd.Uint64ToBytes(volume.Id))),
+		etcdv3.OpPut(etcd.MkKey("volumeid", etcd.Uint64ToHex(volume.Id)), string(vbytes)),
+		etcdv3.OpPut(etcd.MkKey("volumemeta", etcd.Uint64ToHex(volume.Id), "inode"), string(etcd.Uint64ToBytes(1))),
+	)
+	resp, err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrExists
+	}
+	return nil
+}
+
+func (b *objectEtcd) DeleteBucket() error {
+	for _, prefix := range []string{b.key("objects") + "/", b.key("uploads") + "/"} {
+		resp, err := b.Etcd.Client.Get(b.getContext(), prefix, etcdv3.WithPrefix(), etcdv3.WithCountOnly())
+		if err != nil {
+			return err
+		}
+		if resp.Count != 0 {
+			return torus.ErrNotEmpty
+		}
+	}
+	vid := uint64(b.vid)
+	_, err := b.Etcd.Client.Txn(b.getContext()).Then(
+		etcdv3.OpDelete(etcd.MkKey("volumes", b.name)),
+		etcdv3.OpDelete(etcd.MkKey("volumeid", etcd.Uint64ToHex(vid))),
+		etcdv3.OpDelete(etcd.MkKey("volumemeta", etcd.Uint64ToHex(vid)), etcdv3.WithPrefix()),
+	).Commit()
+	return err
+}
+
+func (b *objectEtcd) GetObject(key string) (*Object, error) {
+	resp, err := b.Etcd.Client.Get(b.getContext(), b.objectKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, torus.ErrNotExist
+	}
+	var o Object
+	if err := json.Unmarshal(resp.Kvs[0].Value, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (b *objectEtcd) PutObject(o *Object) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	_, err = b.Etcd.Client.Put(b.getContext(), b.objectKey(o.Key), string(data))
+	return err
+}
+
+func (b *objectEtcd) DeleteObject(key string) error {
+	resp, err := b.Etcd.Client.Delete(b.getContext(), b.objectKey(key))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return torus.ErrNotExist
+	}
+	return nil
+}
+
+func (b *objectEtcd) ListObjects(prefix, after string, max int) ([]*Object, error) {
+	base := b.key("objects") + "/"
+	from := base + prefix
+	if after >= prefix {
+		// The smallest key after after.
+		from = base + after + "\x00"
+	}
+	resp, err := b.Etcd.Client.Get(b.getContext(), from,
+		etcdv3.WithRange(etcdv3.GetPrefixRangeEnd(base+prefix)),
+		etcdv3.WithLimit(int64(max)))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Object, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		out[i] = &Object{}
+		if err := json.Unmarshal(kv.Value, out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (b *objectEtcd) CreateUpload(u *Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	k := b.uploadKey(u.ID)
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(k), "=", 0),
+	).Then(
+		etcdv3.OpPut(k, string(data)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrExists
+	}
+	return nil
+}
+
+func (b *objectEtcd) GetUpload(id string) (*Upload, error) {
+	resp, err := b.Etcd.Client.Get(b.getContext(), b.uploadKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, torus.ErrNotExist
+	}
+	var u Upload
+	if err := json.Unmarshal(resp.Kvs[0].Value, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (b *objectEtcd) ListUploads() ([]*Upload, error) {
+	resp, err := b.Etcd.Client.Get(b.getContext(), b.key("uploads")+"/", etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Upload, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		out[i] = &Upload{}
+		if err := json.Unmarshal(kv.Value, out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (b *objectEtcd) PutPart(id string, p *Part) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	// Part numbers are zero-padded so that the parts sort in order.
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(b.uploadKey(id)), ">", 0),
+	).Then(
+		etcdv3.OpPut(b.partsPrefix(id)+fmt.Sprintf("%05d", p.Number), string(data)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrNotExist
+	}
+	return nil
+}
+
+func (b *objectEtcd) GetParts(id string) ([]*Part, error) {
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(b.uploadKey(id)), ">", 0),
+	).Then(
+		etcdv3.OpGet(b.partsPrefix(id), etcdv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, torus.ErrNotExist
+	}
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	out := make([]*Part, len(kvs))
+	for i, kv := range kvs {
+		out[i] = &Part{}
+		if err := json.Unmarshal(kv.Value, out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (b *objectEtcd) CompleteUpload(id string, o *Object) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(b.uploadKey(id)), ">", 0),
+	).Then(
+		etcdv3.OpPut(b.objectKey(o.Key), string(data)),
+		etcdv3.OpDelete(b.uploadKey(id)),
+		etcdv3.OpDelete(b.partsPrefix(id), etcdv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrNotExist
+	}
+	return nil
+}
+
+func (b *objectEtcd) DeleteUpload(id string) error {
+	resp, err := b.Etcd.Client.Txn(b.getContext()).If(
+		etcdv3.Compare(etcdv3.Version(b.uploadKey(id)), ">", 0),
+	).Then(
+		etcdv3.OpDelete(b.uploadKey(id)),
+		etcdv3.OpDelete(b.partsPrefix(id), etcdv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return torus.ErrNotExist
+	}
+	return nil
+}
+
+func (b *objectEtcd) BeginWrite(lease int64, floor torus.INodeID) (string, error) {
+	token := uuid.NewRandom().String()
+	var opts []etcdv3.OpOption
+	if lease != 0 {
+		opts = append(opts, etcdv3.WithLease(etcdv3.LeaseID(lease)))
+	}
+	_, err := b.Etcd.Client.Put(b.getContext(), b.key("writes", token), string(etcd.Uint64ToBytes(uint64(floor))), opts...)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (b *objectEtcd) EndWrite(token string) error {
+	_, err := b.Etcd.Client.Delete(b.getContext(), b.key("writes", token))
+	return err
+}
+
+func (b *objectEtcd) GetWriteFloors() ([]torus.INodeID, error) {
+	resp, err := b.Etcd.Client.Get(b.getContext(), b.key("writes")+"/", etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]torus.INodeID, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		out[i] = torus.INodeID(etcd.BytesToUint64(kv.Value))
+	}
+	return out, nil
+}
+
+func createObjectEtcdMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (objectMetadata, error) {
+	if e, ok := mds.(*etcd.Etcd); ok {
+		return &objectEtcd{
+			Etcd: e,
+			name: name,
+			vid:  vid,
+		}, nil
+	}
+	panic("how are we creating an etcd metadata that doesn't implement it but reports as being etcd")
+}
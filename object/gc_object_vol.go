@@ -0,0 +1,171 @@
+package object
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	"github.com/coreos/torus/gc"
+	"github.com/coreos/torus/models"
+)
+
+func init() {
+	gc.RegisterGC("objectvol", NewObjectVolGC)
+}
+
+// objectvolGC keeps the blocks of every object, and of every part of the
+// uploads in progress, in object volumes. Gateways record a floor for each
+// write before taking INodes for it, so INodes from the lowest of those, or
+// from the next one to be taken, up are left alone.
+type objectvolGC struct {
+	srv        *torus.Server
+	inodes     gc.INodeFetcher
+	set        map[torus.BlockRef]bool
+	highwaters map[torus.VolumeID]torus.INodeID
+	curINodes  map[torus.INodeRef]bool
+	// others are the volumes of other types, which are for their own GCs.
+	others map[torus.VolumeID]bool
+}
+
+func NewObjectVolGC(srv *torus.Server, inodes gc.INodeFetcher) (gc.GC, error) {
+	o := &objectvolGC{
+		srv:    srv,
+		inodes: inodes,
+	}
+	o.Clear()
+	return o, nil
+}
+
+func (o *objectvolGC) getContext() context.Context {
+	ctx, _ := context.WithTimeout(context.TODO(), 2*time.Second)
+	return o.srv.ExtendContext(ctx)
+}
+
+func (o *objectvolGC) PrepVolume(vol *models.Volume) error {
+	vid := torus.VolumeID(vol.Id)
+	if vol.Type != VolumeType {
+		o.others[vid] = true
+		return nil
+	}
+	mds, err := createObjectMetadata(o.srv.MDS, vol.Name, vid)
+	if err != nil {
+		return err
+	}
+	// Read the index before the floors: a write that begins in between has a
+	// floor above the index.
+	cur, err := o.srv.MDS.GetINodeIndex(vid)
+	if err != nil {
+		return err
+	}
+	highwater := cur + 1
+	floors, err := mds.GetWriteFloors()
+	if err != nil {
+		return err
+	}
+	for _, f := range floors {
+		if f < highwater {
+			highwater = f
+		}
+	}
+	// Uploads are listed before objects, so that the parts of one completed
+	// in between are found in one or the other.
+	var parts []*Part
+	ups, err := mds.ListUploads()
+	if err != nil {
+		return err
+	}
+	for _, u := range ups {
+		ps, err := mds.GetParts(u.ID)
+		if err == torus.ErrNotExist {
+			// Completed or aborted since.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		parts = append(parts, ps...)
+	}
+	after := ""
+	for {
+		objs, err := mds.ListObjects("", after, 1000)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			parts = append(parts, obj.Parts...)
+			after = obj.Key
+		}
+		if len(objs) < 1000 {
+			break
+		}
+	}
+	o.highwaters[vid] = highwater
+	for _, p := range parts {
+		if p.INode == 0 {
+			continue
+		}
+		ref := torus.NewINodeRef(vid, torus.INodeID(p.INode))
+		if o.curINodes[ref] {
+			continue
+		}
+		inode, err := o.inodes.GetINode(o.getContext(), ref)
+		if err != nil {
+			return err
+		}
+		set, err := blockset.UnmarshalFromProto(inode.Blocks, nil)
+		if err != nil {
+			return err
+		}
+		for _, bref := range set.GetAllBlockRefs() {
+			if bref.IsZero() {
+				continue
+			}
+			o.set[bref] = true
+		}
+		o.curINodes[ref] = true
+	}
+	return nil
+}
+
+func (o *objectvolGC) IsDead(ref torus.BlockRef) bool {
+	if o.others[ref.Volume()] {
+		return false
+	}
+	v, ok := o.highwaters[ref.Volume()]
+	if !ok {
+		if clog.LevelAt(capnslog.TRACE) {
+			clog.Tracef("%s doesn't exist anymore", ref)
+		}
+		return true
+	}
+	// Possibly a write that isn't in the bucket yet.
+	if ref.INode >= v {
+		return false
+	}
+	if ref.BlockType() == torus.TypeINode {
+		if o.curINodes[torus.NewINodeRef(ref.Volume(), ref.INode)] {
+			return false
+		}
+		if clog.LevelAt(capnslog.TRACE) {
+			clog.Tracef("%s is a dead INode", ref)
+		}
+		return true
+	}
+	if o.set[ref] {
+		return false
+	}
+	if clog.LevelAt(capnslog.TRACE) {
+		clog.Tracef("%s is dead", ref)
+	}
+	return true
+}
+
+func (o *objectvolGC) Clear() {
+	o.highwaters = make(map[torus.VolumeID]torus.INodeID)
+	o.curINodes = make(map[torus.INodeRef]bool)
+	o.set = make(map[torus.BlockRef]bool)
+	o.others = make(map[torus.VolumeID]bool)
+}
@@ -0,0 +1,86 @@
+package object
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+var clog = capnslog.NewPackageLogger("github.com/coreos/torus", "object")
+
+// Object is an object in a bucket.
+type Object struct {
+	Key          string            `json:"key"`
+	Size         uint64            `json:"size"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"content_type,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	LastModified time.Time         `json:"last_modified"`
+	// Parts are the INodes the object's data is in, in order. An object put
+	// in one go has one part.
+	Parts []*Part `json:"parts"`
+}
+
+// Part is an INode holding part of an object's data. An empty part has no
+// INode.
+type Part struct {
+	Number       int       `json:"number"`
+	INode        uint64    `json:"inode,omitempty"`
+	Size         uint64    `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Upload is a multipart upload that hasn't been completed or aborted.
+type Upload struct {
+	ID          string            `json:"id"`
+	Key         string            `json:"key"`
+	Initiated   time.Time         `json:"initiated"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+type objectMetadata interface {
+	torus.MetadataService
+
+	CreateBucket(vol *models.Volume) error
+	// DeleteBucket deletes the bucket if it has no objects or uploads.
+	DeleteBucket() error
+
+	GetObject(key string) (*Object, error)
+	PutObject(o *Object) error
+	DeleteObject(key string) error
+	// ListObjects returns up to max objects with keys after after that start
+	// with prefix, in order of their keys.
+	ListObjects(prefix, after string, max int) ([]*Object, error)
+
+	CreateUpload(u *Upload) error
+	GetUpload(id string) (*Upload, error)
+	ListUploads() ([]*Upload, error)
+	PutPart(id string, p *Part) error
+	// GetParts returns the parts of an upload in order of their numbers.
+	GetParts(id string) ([]*Part, error)
+	// CompleteUpload stores o and deletes the upload, if it still exists.
+	CompleteUpload(id string, o *Object) error
+	DeleteUpload(id string) error
+
+	// BeginWrite records that this server is writing INodes from floor up,
+	// for as long as the lease lasts or until EndWrite.
+	BeginWrite(lease int64, floor torus.INodeID) (token string, err error)
+	EndWrite(token string) error
+	GetWriteFloors() ([]torus.INodeID, error)
+}
+
+func createObjectMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (objectMetadata, error) {
+	switch mds.Kind() {
+	case torus.EtcdMetadata:
+		return createObjectEtcdMetadata(mds, name, vid)
+	case torus.TempMetadata:
+		return createObjectTempMetadata(mds, name, vid)
+	default:
+		return nil, errors.New("unimplemented for this kind of metadata")
+	}
+}
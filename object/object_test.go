@@ -0,0 +1,331 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+	_ "github.com/coreos/torus/metadata/temp"
+	_ "github.com/coreos/torus/storage"
+	"golang.org/x/net/context"
+)
+
+func openNew(t *testing.T, srv *torus.Server) *Bucket {
+	if err := CreateBucket(srv.MDS, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBucket(srv, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func readObject(t *testing.T, b *Bucket, key string) []byte {
+	_, r, err := b.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPutGetList(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	b := openNew(t, srv)
+	bs := int(srv.MDS.GlobalMetadata().BlockSize)
+
+	data := bytes.Repeat([]byte("torus"), bs)
+	o, err := b.Put("dir/a", bytes.NewReader(data), PutOptions{ContentType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.ETag != "" && len(o.ETag) != 32 {
+		t.Fatalf("unexpected ETag %q", o.ETag)
+	}
+	if got := readObject(t, b, "dir/a"); !bytes.Equal(got, data) {
+		t.Fatal("read back different data")
+	}
+	if _, err := b.Put("empty", bytes.NewReader(nil), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, b, "empty"); len(got) != 0 {
+		t.Fatal("empty object isn't")
+	}
+	bad := errors.New("bad digest")
+	_, err = b.Put("checked", strings.NewReader("x"), PutOptions{
+		Check: func(md5Sum, sha256Sum []byte) error { return bad },
+	})
+	if err != bad {
+		t.Fatalf("expected the check's error, got %v", err)
+	}
+	if _, err := b.Head("checked"); err != torus.ErrNotExist {
+		t.Fatalf("object failing its check was stored: %v", err)
+	}
+	for _, k := range []string{"dir/b", "dir/sub/c", "dir/sub/d", "z"} {
+		if _, err := b.Put(k, strings.NewReader(k), PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := func(objs []*Object) []string {
+		var out []string
+		for _, o := range objs {
+			out = append(out, o.Key)
+		}
+		return out
+	}
+	objs, prefixes, next, err := b.List("dir/", "/", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys(objs), []string{"dir/a", "dir/b"}) || !reflect.DeepEqual(prefixes, []string{"dir/sub/"}) || next != "" {
+		t.Fatalf("unexpected listing %v %v %q", keys(objs), prefixes, next)
+	}
+	objs, prefixes, next, err = b.List("", "/", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys(objs), []string{"empty"}) || !reflect.DeepEqual(prefixes, []string{"dir/"}) || next != "empty" {
+		t.Fatalf("unexpected first page %v %v %q", keys(objs), prefixes, next)
+	}
+	// Paging resumes after a common prefix without listing it again.
+	objs, prefixes, _, err = b.List("", "/", "dir/", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys(objs), []string{"empty", "z"}) || len(prefixes) != 0 {
+		t.Fatalf("unexpected listing after a common prefix %v %v", keys(objs), prefixes)
+	}
+	objs, prefixes, next, err = b.List("", "", "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "dir/sub/c" || len(prefixes) != 0 {
+		t.Fatalf("unexpected page %v %v %q", keys(objs), prefixes, next)
+	}
+	objs, _, _, err = b.List("", "", next, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys(objs), []string{"dir/sub/d", "empty", "z"}) {
+		t.Fatalf("unexpected second page %v", keys(objs))
+	}
+
+	if err := DeleteBucket(srv.MDS, "bucket"); err != torus.ErrNotEmpty {
+		t.Fatalf("expected ErrNotEmpty deleting a bucket with objects, got %v", err)
+	}
+	if err := b.Delete("z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete("z"); err != torus.ErrNotExist {
+		t.Fatalf("expected ErrNotExist deleting twice, got %v", err)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	b := openNew(t, srv)
+
+	u, err := b.NewUpload("big", "application/octet-stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := bytes.Repeat([]byte{1}, MinPartSize)
+	second := []byte("the rest")
+	p2, err := b.PutPart(u.ID, 2, bytes.NewReader(second), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1, err := b.PutPart(u.ID, 1, bytes.NewReader(first), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, err := b.ListParts(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || parts[0].Number != 1 || parts[1].Number != 2 {
+		t.Fatal("parts aren't listed in order")
+	}
+	if _, err := b.CompleteUpload(u.ID, []CompletedPart{{2, p2.ETag}, {1, p1.ETag}}); err != ErrInvalidPartOrder {
+		t.Fatalf("expected ErrInvalidPartOrder, got %v", err)
+	}
+	if _, err := b.CompleteUpload(u.ID, []CompletedPart{{1, p2.ETag}}); err != ErrInvalidPart {
+		t.Fatalf("expected ErrInvalidPart, got %v", err)
+	}
+	o, err := b.CompleteUpload(u.ID, []CompletedPart{{1, p1.ETag}, {2, `"` + p2.ETag + `"`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(o.ETag, "-2") || o.Size != uint64(len(first)+len(second)) {
+		t.Fatalf("unexpected object %+v", o)
+	}
+	if got := readObject(t, b, "big"); !bytes.Equal(got, append(first, second...)) {
+		t.Fatal("read back different data")
+	}
+	_, r, err := b.Get("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Across the end of the first part.
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, MinPartSize-2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte{1, 1, 't', 'h'}) {
+		t.Fatalf("read across parts got %v", buf)
+	}
+	if _, err := b.GetUpload(u.ID); err != torus.ErrNotExist {
+		t.Fatalf("completed upload still exists: %v", err)
+	}
+
+	u, err = b.NewUpload("small", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.PutPart(u.ID, 1, strings.NewReader("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	p2, err = b.PutPart(u.ID, 2, strings.NewReader("b"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, _ = b.ListParts(u.ID)
+	if _, err := b.CompleteUpload(u.ID, []CompletedPart{{1, parts[0].ETag}, {2, p2.ETag}}); err != ErrEntityTooSmall {
+		t.Fatalf("expected ErrEntityTooSmall, got %v", err)
+	}
+	if err := b.AbortUpload(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.PutPart(u.ID, 3, strings.NewReader("c"), nil); err != torus.ErrNotExist {
+		t.Fatalf("expected ErrNotExist putting a part of an aborted upload, got %v", err)
+	}
+}
+
+func TestGCKeepsObjects(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	b := openNew(t, srv)
+
+	old, err := b.Put("a", strings.NewReader("old"), PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := b.Put("a", strings.NewReader("new"), PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := b.NewUpload("b", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := b.PutPart(u.ID, 1, strings.NewReader("part"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A write in flight holds the highwater down.
+	token, err := b.beginWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inflight, err := b.newFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inflight.Write([]byte("inflight")); err != nil {
+		t.Fatal(err)
+	}
+	inflightINode, err := srv.MDS.GetINodeIndex(b.vid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Put("c", strings.NewReader("later"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewObjectVolGC(srv, srv.INodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol, err := srv.MDS.GetVolume("bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.PrepVolume(vol); err != nil {
+		t.Fatal(err)
+	}
+	ref := func(p *Part) torus.BlockRef {
+		inode, err := srv.INodes.GetINode(context.TODO(), torus.NewINodeRef(b.vid(), torus.INodeID(p.INode)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		set, err := blockset.UnmarshalFromProto(inode.Blocks, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return set.GetAllBlockRefs()[0]
+	}
+	if !g.IsDead(ref(old.Parts[0])) {
+		t.Error("overwritten object should be dead")
+	}
+	if g.IsDead(ref(cur.Parts[0])) {
+		t.Error("current object shouldn't be dead")
+	}
+	if g.IsDead(ref(part)) {
+		t.Error("part of an upload in progress shouldn't be dead")
+	}
+	if g.IsDead(torus.BlockRef{INodeRef: torus.NewINodeRef(b.vid(), inflightINode)}) {
+		t.Error("block of a write in flight shouldn't be dead")
+	}
+	b.endWrite(token)
+}
+
+func TestBucketQuota(t *testing.T) {
+	srv := torus.NewMemoryServer()
+	defer srv.Close()
+	openNew(t, srv)
+	if _, err := torus.ResizeVolume(srv.MDS, "bucket", 10); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBucket(srv, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.forgetUsage()
+
+	if _, err := b.Put("a", strings.NewReader("123456"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Put("b", strings.NewReader("12345"), PutOptions{}); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	// Replacing an object only counts what it grows by.
+	if _, err := b.Put("a", strings.NewReader("1234567890"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Put("b", strings.NewReader(""), PutOptions{}); err != ErrQuotaExceeded {
+		t.Fatalf("expected a full bucket to refuse writes, got %v", err)
+	}
+	if err := b.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Put("b", strings.NewReader("12345"), PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := b.Usage(); err != nil || n != 5 {
+		t.Fatalf("expected 5 bytes used, got %d, %v", n, err)
+	}
+}
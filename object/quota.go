@@ -0,0 +1,125 @@
+package object
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// bucketUsageTTL is how long the summed size of a bucket's objects is
+// trusted before it's summed again. Objects stored through this process in
+// the meantime are counted as they go; those stored through others aren't.
+var bucketUsageTTL = 30 * time.Second
+
+type bucketUsage struct {
+	bytes  uint64
+	summed time.Time
+}
+
+// bucketUsages caches the usage of every bucket with a quota, since buckets
+// are opened afresh for each request.
+var bucketUsages = struct {
+	mut    sync.Mutex
+	usages map[torus.VolumeID]*bucketUsage
+}{usages: make(map[torus.VolumeID]*bucketUsage)}
+
+// Usage returns the total size of the bucket's objects.
+func (b *Bucket) Usage() (uint64, error) {
+	if err := b.checkAccess(torus.PermRead); err != nil {
+		return 0, err
+	}
+	return b.usage()
+}
+
+func (b *Bucket) usage() (uint64, error) {
+	var total uint64
+	after := ""
+	for {
+		objs, err := b.mds.ListObjects("", after, 1000)
+		if err != nil {
+			return 0, err
+		}
+		for _, o := range objs {
+			total += o.Size
+			after = o.Key
+		}
+		if len(objs) < 1000 {
+			return total, nil
+		}
+	}
+}
+
+// cachedUsage returns the bucket's usage, summing it if it's stale.
+// bucketUsages.mut must be held.
+func (b *Bucket) cachedUsage() (*bucketUsage, error) {
+	u, ok := bucketUsages.usages[b.vid()]
+	if ok && time.Since(u.summed) < bucketUsageTTL {
+		return u, nil
+	}
+	total, err := b.usage()
+	if err != nil {
+		return nil, err
+	}
+	u = &bucketUsage{bytes: total, summed: time.Now()}
+	bucketUsages.usages[b.vid()] = u
+	return u, nil
+}
+
+// checkQuota returns ErrQuotaExceeded if the bucket has a quota and storing
+// an object of size bytes as key, replacing any object there, would take it
+// over. If it wouldn't, the object is counted towards the bucket's usage.
+func (b *Bucket) checkQuota(key string, size uint64) error {
+	if b.volume.MaxBytes == 0 {
+		return nil
+	}
+	var replaced uint64
+	if old, err := b.mds.GetObject(key); err == nil {
+		replaced = old.Size
+	} else if err != torus.ErrNotExist {
+		return err
+	}
+	bucketUsages.mut.Lock()
+	defer bucketUsages.mut.Unlock()
+	u, err := b.cachedUsage()
+	if err != nil {
+		return err
+	}
+	after := u.bytes + size
+	if replaced > after {
+		after = 0
+	} else {
+		after -= replaced
+	}
+	if size > replaced && after > b.volume.MaxBytes {
+		return ErrQuotaExceeded
+	}
+	u.bytes = after
+	return nil
+}
+
+// checkFull returns ErrQuotaExceeded if the bucket is already at its quota,
+// so that writes to it can be refused before their data is stored.
+func (b *Bucket) checkFull() error {
+	if b.volume.MaxBytes == 0 {
+		return nil
+	}
+	bucketUsages.mut.Lock()
+	defer bucketUsages.mut.Unlock()
+	u, err := b.cachedUsage()
+	if err != nil {
+		return err
+	}
+	if u.bytes >= b.volume.MaxBytes {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// forgetUsage drops the bucket's cached usage, so that it's summed afresh
+// once space is freed.
+func (b *Bucket) forgetUsage() {
+	bucketUsages.mut.Lock()
+	delete(bucketUsages.usages, b.vid())
+	bucketUsages.mut.Unlock()
+}
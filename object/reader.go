@@ -0,0 +1,130 @@
+package object
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/blockset"
+)
+
+// Reader reads an object's data across its parts, opening each part's INode
+// the first time it is read from.
+type Reader struct {
+	b      *Bucket
+	parts  []*Part
+	starts []int64
+	size   int64
+	files  map[int]*torus.File
+	offset int64
+}
+
+func newReader(b *Bucket, o *Object) *Reader {
+	r := &Reader{
+		b:      b,
+		parts:  o.Parts,
+		starts: make([]int64, len(o.Parts)),
+		files:  make(map[int]*torus.File),
+	}
+	for i, p := range o.Parts {
+		r.starts[i] = r.size
+		r.size += int64(p.Size)
+	}
+	return r
+}
+
+func (r *Reader) file(i int) (*torus.File, error) {
+	if f, ok := r.files[i]; ok {
+		return f, nil
+	}
+	ref := torus.NewINodeRef(r.b.vid(), torus.INodeID(r.parts[i].INode))
+	inode, err := r.b.srv.INodes.GetINode(r.b.srv.ExtendContext(context.TODO()), ref)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := blockset.UnmarshalFromProto(inode.GetBlocks(), r.b.srv.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.b.srv.CreateFile(r.b.volume, inode, bs)
+	if err != nil {
+		return nil, err
+	}
+	f.ReadOnly = true
+	r.files[i] = f
+	return f, nil
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, torus.ErrInvalid
+	}
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		// The last part starting at or before off, which can't be empty as
+		// off is before the end.
+		i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > off }) - 1
+		part := r.parts[i]
+		partOff := off - r.starts[i]
+		want := p[n:]
+		if rest := int64(part.Size) - partOff; int64(len(want)) > rest {
+			want = want[:rest]
+		}
+		f, err := r.file(i)
+		if err != nil {
+			return n, err
+		}
+		m, err := f.ReadAt(want, partOff)
+		n += m
+		off += int64(m)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if m < len(want) {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += r.offset
+	case os.SEEK_END:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, torus.ErrInvalid
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) Close() error {
+	for i, f := range r.files {
+		f.Close()
+		delete(r.files, i)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+)
+
+type objectTempMetadata struct {
+	*temp.Client
+	name string
+	vid  torus.VolumeID
+}
+
+type objectTempBucketData struct {
+	objects   map[string]*Object
+	uploads   map[string]*Upload
+	parts     map[string]map[int]*Part
+	writes    map[string]torus.INodeID
+	lastWrite int
+}
+
+func (b *objectTempMetadata) CreateBucket(volume *models.Volume) error {
+	b.LockData()
+	defer b.UnlockData()
+	if _, ok := b.GetData(fmt.Sprint(volume.Id)); ok {
+		return torus.ErrExists
+	}
+	if b.VolumeExists(volume.Name) {
+		return torus.ErrExists
+	}
+	b.CreateVolume(volume)
+	b.SetData(fmt.Sprint(volume.Id), &objectTempBucketData{
+		objects: make(map[string]*Object),
+		uploads: make(map[string]*Upload),
+		parts:   make(map[string]map[int]*Part),
+		writes:  make(map[string]torus.INodeID),
+	})
+	return nil
+}
+
+// getData returns the bucket's data. The data must be locked.
+func (b *objectTempMetadata) getData() (*objectTempBucketData, error) {
+	v, ok := b.GetData(fmt.Sprint(b.vid))
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return v.(*objectTempBucketData), nil
+}
+
+func (b *objectTempMetadata) DeleteBucket() error {
+	b.LockData()
+	d, err := b.getData()
+	if err != nil {
+		b.UnlockData()
+		return err
+	}
+	if len(d.objects) != 0 || len(d.uploads) != 0 {
+		b.UnlockData()
+		return torus.ErrNotEmpty
+	}
+	// The client takes the data lock itself.
+	b.UnlockData()
+	return b.Client.DeleteVolume(b.name)
+}
+
+func (b *objectTempMetadata) GetObject(key string) (*Object, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return nil, err
+	}
+	o, ok := d.objects[key]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return o, nil
+}
+
+func (b *objectTempMetadata) PutObject(o *Object) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return err
+	}
+	d.objects[o.Key] = o
+	return nil
+}
+
+func (b *objectTempMetadata) DeleteObject(key string) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return err
+	}
+	if _, ok := d.objects[key]; !ok {
+		return torus.ErrNotExist
+	}
+	delete(d.objects, key)
+	return nil
+}
+
+func (b *objectTempMetadata) ListObjects(prefix, after string, max int) ([]*Object, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for k := range d.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > max {
+		keys = keys[:max]
+	}
+	out := make([]*Object, len(keys))
+	for i, k := range keys {
+		out[i] = d.objects[k]
+	}
+	return out, nil
+}
+
+func (b *objectTempMetadata) CreateUpload(u *Upload) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return err
+	}
+	if _, ok := d.uploads[u.ID]; ok {
+		return torus.ErrExists
+	}
+	d.uploads[u.ID] = u
+	d.parts[u.ID] = make(map[int]*Part)
+	return nil
+}
+
+func (b *objectTempMetadata) GetUpload(id string) (*Upload, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return nil, err
+	}
+	u, ok := d.uploads[id]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	return u, nil
+}
+
+func (b *objectTempMetadata) ListUploads() ([]*Upload, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Upload, 0, len(d.uploads))
+	for _, u := range d.uploads {
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+func (b *objectTempMetadata) PutPart(id string, p *Part) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return err
+	}
+	parts, ok := d.parts[id]
+	if !ok {
+		return torus.ErrNotExist
+	}
+	parts[p.Number] = p
+	return nil
+}
+
+func (b *objectTempMetadata) GetParts(id string) ([]*Part, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return nil, err
+	}
+	parts, ok := d.parts[id]
+	if !ok {
+		return nil, torus.ErrNotExist
+	}
+	out := make([]*Part, 0, len(parts))
+	for _, p := range parts {
+		out = append(out, p)
+	}
+	sort.Sort(partsByNumber(out))
+	return out, nil
+}
+
+func (b *objectTempMetadata) CompleteUpload(id string, o *Object) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return err
+	}
+	if _, ok := d.uploads[id]; !ok {
+		return torus.ErrNotExist
+	}
+	d.objects[o.Key] = o
+	delete(d.uploads, id)
+	delete(d.parts, id)
+	return nil
+}
+
+func (b *objectTempMetadata) DeleteUpload(id string) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return err
+	}
+	if _, ok := d.uploads[id]; !ok {
+		return torus.ErrNotExist
+	}
+	delete(d.uploads, id)
+	delete(d.parts, id)
+	return nil
+}
+
+func (b *objectTempMetadata) BeginWrite(lease int64, floor torus.INodeID) (string, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return "", err
+	}
+	d.lastWrite++
+	token := fmt.Sprint(d.lastWrite)
+	d.writes[token] = floor
+	return token, nil
+}
+
+func (b *objectTempMetadata) EndWrite(token string) error {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return err
+	}
+	delete(d.writes, token)
+	return nil
+}
+
+func (b *objectTempMetadata) GetWriteFloors() ([]torus.INodeID, error) {
+	b.LockData()
+	defer b.UnlockData()
+	d, err := b.getData()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]torus.INodeID, 0, len(d.writes))
+	for _, x := range d.writes {
+		out = append(out, x)
+	}
+	return out, nil
+}
+
+func createObjectTempMetadata(mds torus.MetadataService, name string, vid torus.VolumeID) (objectMetadata, error) {
+	if t, ok := mds.(*temp.Client); ok {
+		return &objectTempMetadata{
+			Client: t,
+			name:   name,
+			vid:    vid,
+		}, nil
+	}
+	panic("how are we creating a temp metadata that doesn't implement it but reports as being temp")
+}
@@ -0,0 +1,150 @@
+package torus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A storage pool is a named ring of its own, over its own peers and with its
+// own replication, such as one of SSD nodes and another of archival HDD
+// nodes. Volumes put in a pool when they're created are placed by its ring
+// instead of the cluster's, so pools never mix their placements, and can be
+// moved between pools while in use with a migration. A volume's pool is
+// recorded by its latest Migration.
+
+// PoolMetadataService is implemented by metadata services that can store
+// storage pools.
+type PoolMetadataService interface {
+	// GetPools returns the ring of every pool, by name.
+	GetPools() (map[string]Ring, error)
+	// GetPool returns the ring of the named pool, or ErrNotExist if there's
+	// no such pool.
+	GetPool(name string) (Ring, error)
+	// CreatePool creates a pool placed by r, or fails with ErrExists.
+	CreatePool(name string, r Ring) error
+	// SetPoolRing replaces the ring of the named pool with r, which must be
+	// of a later version, or fails with ErrNonSequentialRing.
+	SetPoolRing(name string, r Ring) error
+	// DeletePool deletes the named pool, or fails with ErrNotExist.
+	DeletePool(name string) error
+}
+
+var errPoolName = errors.New("torus: pool names can't be empty or contain '/'")
+
+// ValidPoolName returns an error if name can't name a pool.
+func ValidPoolName(name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return errPoolName
+	}
+	return nil
+}
+
+func poolMetadata(mds MetadataService, name string) (PoolMetadataService, error) {
+	pmds, ok := mds.(PoolMetadataService)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if _, err := pmds.GetPool(name); err != nil {
+		if err == ErrNotExist {
+			return nil, fmt.Errorf("torus: no pool named %s", name)
+		}
+		return nil, err
+	}
+	return pmds, nil
+}
+
+// SetInitialPool puts a volume that was just created in the named pool,
+// before anything is written to it. An empty pool leaves it on the cluster's
+// ring.
+func SetInitialPool(mds MetadataService, volume string, pool string) error {
+	if pool == "" {
+		return nil
+	}
+	if _, err := poolMetadata(mds, pool); err != nil {
+		return err
+	}
+	mmds, ok := mds.(MigrationMetadataService)
+	if !ok {
+		return ErrNotSupported
+	}
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return err
+	}
+	if err := checkPlacement(mds, VolumeID(vol.Id), vol.MaxBytes, nil, pool); err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	_, err = mmds.ModifyMigration(VolumeID(vol.Id), func(m *Migration) (*Migration, error) {
+		if m != nil {
+			return nil, ErrExists
+		}
+		return &Migration{
+			Volume:   volume,
+			VolumeID: VolumeID(vol.Id),
+			ToPool:   pool,
+			State:    MigrationDone,
+			Started:  now,
+			Finished: now,
+		}, nil
+	})
+	return err
+}
+
+// StartPoolMigration begins moving the named volume into the named pool.
+func StartPoolMigration(mds MetadataService, volume string, pool string) (*Migration, error) {
+	if _, err := poolMetadata(mds, pool); err != nil {
+		return nil, err
+	}
+	return startMigration(mds, volume, nil, pool)
+}
+
+// GetVolumePool returns the pool a volume is in, or "" if it's placed by the
+// cluster's ring or a ring of its own. A volume that's being moved is in the
+// pool it's moving to.
+func GetVolumePool(mds MetadataService, vid VolumeID) (string, error) {
+	mmds, ok := mds.(MigrationMetadataService)
+	if !ok {
+		return "", nil
+	}
+	m, err := mmds.GetMigration(vid)
+	if err == ErrNotExist {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return m.CurrentPool(), nil
+}
+
+// DeletePool deletes the named pool, as long as no volume is in it or being
+// moved out of it.
+func DeletePool(mds MetadataService, name string) error {
+	pmds, ok := mds.(PoolMetadataService)
+	if !ok {
+		return ErrNotSupported
+	}
+	mmds, ok := mds.(MigrationMetadataService)
+	if !ok {
+		return pmds.DeletePool(name)
+	}
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		return err
+	}
+	for _, v := range vols {
+		m, err := mmds.GetMigration(VolumeID(v.Id))
+		if err == ErrNotExist {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if m.CurrentPool() == name || (m.State == MigrationRunning && m.FromPool == name) {
+			return fmt.Errorf("torus: pool %s still holds volume %s", name, v.Name)
+		}
+	}
+	return pmds.DeletePool(name)
+}
@@ -0,0 +1,70 @@
+package torus
+
+import "golang.org/x/net/context"
+
+// BlockPrefetcher is implemented by BlockStores that can fetch many blocks
+// from other peers ahead of them being read.
+type BlockPrefetcher interface {
+	// PrefetchBlocks reads refs into the store's read cache, fetching as many
+	// at once as it can. Blocks that can't be fetched are skipped; reading
+	// them afterwards tries again.
+	PrefetchBlocks(ctx context.Context, refs []BlockRef) error
+}
+
+// ByteRange is a range of bytes in a file.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// Prefetch fetches the blocks holding ranges into the read cache, grouping
+// them by the peer that holds them and fetching from every peer in parallel.
+// Reading the ranges afterwards is then served from memory, so applications
+// that know what they'll read next, like image converters and backup agents,
+// can keep the whole cluster busy instead of waiting on one block at a time.
+// The ranges should fit in the read cache, or the first blocks are evicted
+// before they are read. Where the BlockStore can't prefetch, this does
+// nothing.
+func (f *File) Prefetch(ranges []ByteRange) error {
+	p, ok := f.srv.Blocks.(BlockPrefetcher)
+	if !ok {
+		return nil
+	}
+	f.mut.RLock()
+	refs := f.prefetchRefs(ranges)
+	f.mut.RUnlock()
+	if len(refs) == 0 {
+		return nil
+	}
+	return p.PrefetchBlocks(f.getContext(), refs)
+}
+
+// prefetchRefs returns the blocks that hold ranges, once each, leaving out
+// blocks that have never been written.
+func (f *File) prefetchRefs(ranges []ByteRange) []BlockRef {
+	// Reads go to the innermost blockset first.
+	var base Blockset
+	for layer := f.blocks; layer != nil; layer = layer.GetSubBlockset() {
+		base = layer
+	}
+	all := base.GetAllBlockRefs()
+	seen := make(map[int]bool)
+	var out []BlockRef
+	for _, r := range ranges {
+		end := r.Offset + r.Length
+		if end > int64(f.inode.Filesize) {
+			end = int64(f.inode.Filesize)
+		}
+		if r.Offset < 0 || r.Offset >= end {
+			continue
+		}
+		for i := int(r.Offset / f.blkSize); i <= int((end-1)/f.blkSize) && i < len(all); i++ {
+			if seen[i] || all[i].IsZero() {
+				continue
+			}
+			seen[i] = true
+			out = append(out, all[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,25 @@
+package torus
+
+// QoS limits how much block I/O each client attachment of a volume may do,
+// so that one busy volume can't starve the others on the same peers. A zero
+// limit is no limit.
+type QoS struct {
+	// IOPS is the most block reads and writes per second.
+	IOPS uint64 `json:"iops,omitempty"`
+	// Bandwidth is the most bytes of blocks read and written per second.
+	Bandwidth uint64 `json:"bandwidth,omitempty"`
+}
+
+// IsUnlimited returns whether q doesn't limit anything.
+func (q QoS) IsUnlimited() bool {
+	return q == QoS{}
+}
+
+// QoSMetadataService is implemented by metadata services that can store QoS
+// limits per volume.
+type QoSMetadataService interface {
+	// GetQoS returns the volume's limits, which are unlimited if none were
+	// ever set.
+	GetQoS(vid VolumeID) (QoS, error)
+	SetQoS(vid VolumeID, q QoS) error
+}
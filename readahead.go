@@ -0,0 +1,101 @@
+package torus
+
+import "sync"
+
+// ReadaheadMetadataService is implemented by metadata services that can store
+// how far ahead of sequential readers of each volume to fetch.
+type ReadaheadMetadataService interface {
+	// GetReadahead returns the volume's readahead window in bytes, which is
+	// zero, for none, if it was never set.
+	GetReadahead(vid VolumeID) (uint64, error)
+	SetReadahead(vid VolumeID, bytes uint64) error
+}
+
+// readaheadRun is how many blocks in a row a file must be read in order
+// before reads of it are taken to be sequential.
+const readaheadRun = 2
+
+// readahead watches which blocks of a file are read. Once they are read in
+// order, it fetches the window of blocks past the last one into the read
+// cache, topping it up each time half of it has been read, so that the next
+// reads don't wait on the network.
+type readahead struct {
+	mut     sync.Mutex
+	window  int
+	last    int
+	run     int
+	fetched int
+	busy    bool
+}
+
+// SetReadahead sets how many bytes ahead of sequential reads of the file to
+// fetch into the read cache. Zero turns readahead off. It does nothing where
+// the BlockStore can't prefetch.
+func (f *File) SetReadahead(bytes uint64) {
+	f.ra.mut.Lock()
+	defer f.ra.mut.Unlock()
+	window := int((bytes + uint64(f.blkSize) - 1) / uint64(f.blkSize))
+	if window == f.ra.window {
+		return
+	}
+	f.ra.window = window
+	f.ra.run = 0
+	f.ra.fetched = 0
+}
+
+// readAhead notes a read of blocks first through last, and starts fetching
+// the blocks past them if the file is being read in order. f.mut must be
+// held.
+func (f *File) readAhead(first, last int) {
+	ra := &f.ra
+	ra.mut.Lock()
+	defer ra.mut.Unlock()
+	if ra.window == 0 {
+		return
+	}
+	switch {
+	case first == ra.last:
+		// Still in the same block.
+	case first == ra.last+1:
+		ra.run++
+	default:
+		ra.run = 0
+		ra.fetched = 0
+	}
+	if last > first {
+		ra.run += last - first
+	}
+	ra.last = last
+	if ra.run < readaheadRun || ra.busy || ra.fetched > last+ra.window/2 {
+		return
+	}
+	p, ok := f.srv.Blocks.(BlockPrefetcher)
+	if !ok {
+		return
+	}
+	from := last + 1
+	if ra.fetched > from {
+		from = ra.fetched
+	}
+	to := last + ra.window + 1
+	refs := f.prefetchRefs([]ByteRange{{
+		Offset: int64(from) * f.blkSize,
+		Length: int64(to-from) * f.blkSize,
+	}})
+	ra.fetched = to
+	if len(refs) == 0 {
+		return
+	}
+	ra.busy = true
+	ctx := f.getContext()
+	go func() {
+		err := p.PrefetchBlocks(ctx, refs)
+		if err != nil {
+			clog.Debugf("readahead of %d blocks failed: %v", len(refs), err)
+		}
+		promFileReadahead.Add(float64(len(refs)))
+		ra.mut.Lock()
+		ra.busy = false
+		ra.mut.Unlock()
+	}()
+}
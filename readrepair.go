@@ -0,0 +1,49 @@
+package torus
+
+import "errors"
+
+// ReadRepairPolicy decides how often reads of a volume's blocks check every
+// replica and fix the ones that have diverged.
+type ReadRepairPolicy int
+
+const (
+	// ReadRepairOff reads from the first replica that answers.
+	ReadRepairOff ReadRepairPolicy = iota
+	// ReadRepairSampled checks one read in a hundred.
+	ReadRepairSampled
+	// ReadRepairAlways checks every read that misses the read cache.
+	ReadRepairAlways
+)
+
+func ParseReadRepairPolicy(s string) (p ReadRepairPolicy, err error) {
+	switch s {
+	case "off":
+		p = ReadRepairOff
+	case "sampled", "1%":
+		p = ReadRepairSampled
+	case "always":
+		p = ReadRepairAlways
+	default:
+		err = errors.New("invalid read repair policy; use one of 'off', 'sampled' or 'always'")
+	}
+	return
+}
+
+func (p ReadRepairPolicy) String() string {
+	switch p {
+	case ReadRepairSampled:
+		return "sampled"
+	case ReadRepairAlways:
+		return "always"
+	}
+	return "off"
+}
+
+// ReadRepairMetadataService is implemented by metadata services that can
+// store a read repair policy per volume.
+type ReadRepairMetadataService interface {
+	// GetReadRepair returns the volume's policy, which is ReadRepairOff if
+	// none was ever set.
+	GetReadRepair(vid VolumeID) (ReadRepairPolicy, error)
+	SetReadRepair(vid VolumeID, p ReadRepairPolicy) error
+}
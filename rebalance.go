@@ -0,0 +1,80 @@
+package torus
+
+// RebalanceRecord is what one peer did to move data for a ring change, from
+// the ring changing until the peer's data was placed by the new ring.
+type RebalanceRecord struct {
+	Peer        string `json:"peer"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+	// Start and Finish are in Unix nanoseconds.
+	Start      int64  `json:"start"`
+	Finish     int64  `json:"finish"`
+	BlocksSent uint64 `json:"blocks_sent"`
+	BytesSent  uint64 `json:"bytes_sent"`
+	// PeakRate is the most bytes per second sent over any one second.
+	PeakRate uint64 `json:"peak_rate"`
+	// Errors counts blocks that failed to be checked or sent, and were
+	// retried on a later pass.
+	Errors uint64 `json:"errors"`
+}
+
+// RebalanceHistoryLen is how many ring changes the rebalance history keeps.
+const RebalanceHistoryLen = 64
+
+// RebalanceHistoryService is implemented by metadata services that keep a
+// history of completed ring changes.
+type RebalanceHistoryService interface {
+	// RecordRebalance records a peer's part in a ring change, replacing any
+	// record it made of the same change, and forgets all but the latest
+	// RebalanceHistoryLen changes.
+	RecordRebalance(r *RebalanceRecord) error
+	// GetRebalanceHistory returns every peer's record of recent ring
+	// changes, oldest first.
+	GetRebalanceHistory() ([]*RebalanceRecord, error)
+}
+
+// RebalanceCheckpoint is how far a peer has got through a rebalance pass, so
+// that it can pick up where it left off after a restart.
+type RebalanceCheckpoint struct {
+	Peer string
+	// RingVersion is the ring the pass is placing blocks by. The checkpoint
+	// is useless once the ring has changed.
+	RingVersion int
+	// Last is the last block the pass has finished with. Passes visit blocks
+	// in order of volume, inode and index.
+	Last BlockRef
+	// Saved is when the checkpoint was taken, in Unix nanoseconds.
+	Saved int64
+}
+
+// RebalanceCheckpointService is implemented by metadata services that can
+// keep peers' rebalance progress across restarts.
+type RebalanceCheckpointService interface {
+	// SaveRebalanceCheckpoint saves this peer's progress. A nil checkpoint
+	// clears it.
+	SaveRebalanceCheckpoint(c *RebalanceCheckpoint) error
+	// GetRebalanceCheckpoint returns this peer's progress, or nil if it has
+	// none.
+	GetRebalanceCheckpoint() (*RebalanceCheckpoint, error)
+}
+
+// RecoveryCheckpoint is how far a peer has got copying its blocks of peers
+// that have failed for good to the peers that take their place.
+type RecoveryCheckpoint struct {
+	RebalanceCheckpoint
+	// Failed are the peers whose blocks are being copied, sorted. The
+	// checkpoint is useless once they change.
+	Failed PeerList
+}
+
+// RecoveryCheckpointService is implemented by metadata services that can
+// keep peers' progress re-replicating the blocks of failed peers across
+// restarts.
+type RecoveryCheckpointService interface {
+	// SaveRecoveryCheckpoint saves this peer's progress. A nil checkpoint
+	// clears it.
+	SaveRecoveryCheckpoint(c *RecoveryCheckpoint) error
+	// GetRecoveryCheckpoint returns this peer's progress, or nil if it has
+	// none.
+	GetRecoveryCheckpoint() (*RecoveryCheckpoint, error)
+}
@@ -0,0 +1,73 @@
+package torus_test
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+)
+
+func TestRebalanceHistory(t *testing.T) {
+	mds := temp.NewClient(torus.Config{}, temp.NewServer())
+	var hmds torus.RebalanceHistoryService = mds
+	record := func(version int, peer string, sent uint64) {
+		err := hmds.RecordRebalance(&torus.RebalanceRecord{
+			Peer:        peer,
+			FromVersion: version - 1,
+			ToVersion:   version,
+			BlocksSent:  sent,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := func() []*torus.RebalanceRecord {
+		rs, err := hmds.GetRebalanceHistory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rs
+	}
+
+	if rs := history(); len(rs) != 0 {
+		t.Fatalf("expected no history, got %d records", len(rs))
+	}
+	record(3, "b", 1)
+	record(2, "a", 2)
+	record(3, "a", 3)
+	// A peer's second record of a change replaces its first.
+	record(3, "b", 4)
+	rs := history()
+	want := []struct {
+		version int
+		peer    string
+		sent    uint64
+	}{{2, "a", 2}, {3, "a", 3}, {3, "b", 4}}
+	if len(rs) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(rs))
+	}
+	for i, w := range want {
+		if rs[i].ToVersion != w.version || rs[i].Peer != w.peer || rs[i].BlocksSent != w.sent {
+			t.Errorf("expected record %d to be %s's of version %d with %d blocks, got %+v", i, w.peer, w.version, w.sent, rs[i])
+		}
+	}
+	// What's returned is a copy.
+	rs[0].BlocksSent = 100
+	if history()[0].BlocksSent != 2 {
+		t.Error("expected the stored history not to change")
+	}
+
+	// Only the latest ring changes are kept, however many peers recorded
+	// each.
+	for v := 4; v < 4+torus.RebalanceHistoryLen; v++ {
+		record(v, "a", 1)
+		record(v, "b", 1)
+	}
+	rs = history()
+	if len(rs) != 2*torus.RebalanceHistoryLen {
+		t.Fatalf("expected %d records, got %d", 2*torus.RebalanceHistoryLen, len(rs))
+	}
+	if rs[0].ToVersion != 4 || rs[len(rs)-1].ToVersion != 3+torus.RebalanceHistoryLen {
+		t.Errorf("expected versions 4 to %d, got %d to %d", 3+torus.RebalanceHistoryLen, rs[0].ToVersion, rs[len(rs)-1].ToVersion)
+	}
+}
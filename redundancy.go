@@ -0,0 +1,309 @@
+package torus
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RedundancyKind int
+
+const (
+	// Replicated stores whole copies of every block on Replicas peers.
+	Replicated RedundancyKind = iota
+	// ErasureCoded splits every stripe into Data shards plus Parity shards.
+	ErasureCoded
+)
+
+// Redundancy describes how a volume's blocks are protected against peer loss.
+// The zero value means "whatever the ring's replication factor is".
+type Redundancy struct {
+	Kind     RedundancyKind `json:"kind"`
+	Replicas int            `json:"replicas,omitempty"`
+	Data     int            `json:"data,omitempty"`
+	Parity   int            `json:"parity,omitempty"`
+}
+
+// ParseRedundancy parses a redundancy scheme in the form "rep=3" (or "3x")
+// for replication, "ec=8+3" for erasure coding, or "ring" to follow the
+// ring's replication factor.
+func ParseRedundancy(s string) (Redundancy, error) {
+	errInvalid := fmt.Errorf("invalid redundancy %q; use one of 'ring', 'rep=N', 'Nx' or 'ec=D+P'", s)
+	switch {
+	case s == "ring":
+		return Redundancy{}, nil
+	case strings.HasPrefix(s, "rep="), strings.HasSuffix(s, "x"):
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(s, "rep="), "x"))
+		if err != nil || n < 1 {
+			return Redundancy{}, errInvalid
+		}
+		return Redundancy{Kind: Replicated, Replicas: n}, nil
+	case strings.HasPrefix(s, "ec="):
+		parts := strings.Split(strings.TrimPrefix(s, "ec="), "+")
+		if len(parts) != 2 {
+			return Redundancy{}, errInvalid
+		}
+		d, err := strconv.Atoi(parts[0])
+		if err != nil || d < 1 {
+			return Redundancy{}, errInvalid
+		}
+		p, err := strconv.Atoi(parts[1])
+		if err != nil || p < 1 {
+			return Redundancy{}, errInvalid
+		}
+		return Redundancy{Kind: ErasureCoded, Data: d, Parity: p}, nil
+	}
+	return Redundancy{}, errInvalid
+}
+
+// IsRingDefault returns whether r simply follows the ring.
+func (r Redundancy) IsRingDefault() bool {
+	return r == Redundancy{}
+}
+
+// Width returns the number of peers a block is spread over, or ringRep if r
+// follows the ring.
+func (r Redundancy) Width(ringRep int) int {
+	switch {
+	case r.IsRingDefault():
+		return ringRep
+	case r.Kind == ErasureCoded:
+		return r.Data + r.Parity
+	}
+	return r.Replicas
+}
+
+// Copies returns the number of peers each whole block is stored on. Erasure
+// coded volumes keep Parity+1 copies of their INodes, so that they survive as
+// many failures as the shards do.
+func (r Redundancy) Copies(ringRep int) int {
+	if r.Kind == ErasureCoded {
+		return r.Parity + 1
+	}
+	return r.Width(ringRep)
+}
+
+func (r Redundancy) String() string {
+	switch {
+	case r.IsRingDefault():
+		return "ring"
+	case r.Kind == ErasureCoded:
+		return fmt.Sprintf("ec=%d+%d", r.Data, r.Parity)
+	}
+	return fmt.Sprintf("rep=%d", r.Replicas)
+}
+
+type ConversionState string
+
+const (
+	ConversionRunning ConversionState = "running"
+	ConversionDone    ConversionState = "done"
+	ConversionAborted ConversionState = "aborted"
+)
+
+// ConversionProgress is a single peer's report on a Conversion.
+type ConversionProgress struct {
+	// Blocks is the number of the volume's blocks the peer held in its last
+	// pass.
+	Blocks uint64 `json:"blocks"`
+	// Sent is the number of blocks the peer copied to new homes in its last
+	// pass.
+	Sent uint64 `json:"sent"`
+	// Done is set once the peer has finished a clean pass under the target
+	// scheme.
+	Done bool `json:"done"`
+}
+
+// Conversion is the record of a volume moving between redundancy schemes. The
+// most recent Conversion of a volume also determines its current redundancy;
+// see Effective.
+type Conversion struct {
+	Volume   string                        `json:"volume"`
+	VolumeID VolumeID                      `json:"volume_id"`
+	From     Redundancy                    `json:"from"`
+	To       Redundancy                    `json:"to"`
+	State    ConversionState               `json:"state"`
+	Started  int64                         `json:"started"`
+	Finished int64                         `json:"finished,omitempty"`
+	Progress map[string]ConversionProgress `json:"progress,omitempty"`
+}
+
+// Effective returns the number of peers each block of the volume should be
+// stored on, given the ring's replication factor. While a conversion is
+// running, blocks are kept under both schemes so that aborting never loses
+// data.
+func (c *Conversion) Effective(ringRep int) int {
+	if c == nil {
+		return ringRep
+	}
+	switch c.State {
+	case ConversionDone:
+		return c.To.Copies(ringRep)
+	case ConversionAborted:
+		return c.From.Copies(ringRep)
+	}
+	from, to := c.From.Copies(ringRep), c.To.Copies(ringRep)
+	if from > to {
+		return from
+	}
+	return to
+}
+
+// Current returns the redundancy the volume has now; a running conversion
+// counts as done.
+func (c *Conversion) Current() Redundancy {
+	if c == nil {
+		return Redundancy{}
+	}
+	if c.State == ConversionAborted {
+		return c.From
+	}
+	return c.To
+}
+
+// PeersDone returns how many of the given peers have finished converting.
+func (c *Conversion) PeersDone(members PeerList) int {
+	n := 0
+	for _, p := range members {
+		if c.Progress[p].Done {
+			n++
+		}
+	}
+	return n
+}
+
+// ConversionMetadataService is implemented by metadata services that can store
+// per-volume redundancy conversions.
+type ConversionMetadataService interface {
+	// GetConversion returns the latest conversion of the volume, or
+	// ErrNotExist if it never had one.
+	GetConversion(vid VolumeID) (*Conversion, error)
+	// ModifyConversion atomically applies f to the latest conversion of the
+	// volume, which is nil if there is none, and stores the result. f may be
+	// called more than once.
+	ModifyConversion(vid VolumeID, f func(c *Conversion) (*Conversion, error)) (*Conversion, error)
+}
+
+// StartConversion begins converting the named volume to the given redundancy.
+// Only replicated volumes can be converted, and only to replication.
+func StartConversion(mds MetadataService, volume string, to Redundancy) (*Conversion, error) {
+	cmds, ok := mds.(ConversionMetadataService)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if to.Kind == ErasureCoded {
+		return nil, errErasureConversion
+	}
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return nil, err
+	}
+	return cmds.ModifyConversion(VolumeID(vol.Id), func(c *Conversion) (*Conversion, error) {
+		if c != nil && c.State == ConversionRunning {
+			return nil, ErrExists
+		}
+		from := c.Current()
+		if from.Kind == ErasureCoded {
+			return nil, errErasureConversion
+		}
+		if from == to {
+			return nil, ErrInvalid
+		}
+		return &Conversion{
+			Volume:   volume,
+			VolumeID: VolumeID(vol.Id),
+			From:     from,
+			To:       to,
+			State:    ConversionRunning,
+			Started:  time.Now().UnixNano(),
+		}, nil
+	})
+}
+
+var errErasureConversion = errors.New("torus: erasure coding can only be chosen when a volume is created")
+
+// GetRedundancy returns the current redundancy of a volume.
+func GetRedundancy(mds MetadataService, vid VolumeID) (Redundancy, error) {
+	cmds, ok := mds.(ConversionMetadataService)
+	if !ok {
+		return Redundancy{}, nil
+	}
+	c, err := cmds.GetConversion(vid)
+	if err == ErrNotExist {
+		return Redundancy{}, nil
+	}
+	if err != nil {
+		return Redundancy{}, err
+	}
+	return c.Current(), nil
+}
+
+// SetInitialRedundancy sets the redundancy of a volume that was just created,
+// before anything is written to it. This is the only way to make a volume
+// erasure coded, since its blocks are laid out differently.
+func SetInitialRedundancy(mds MetadataService, volume string, r Redundancy) error {
+	if r.IsRingDefault() {
+		return nil
+	}
+	cmds, ok := mds.(ConversionMetadataService)
+	if !ok {
+		return ErrNotSupported
+	}
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return err
+	}
+	if r.Kind == ErasureCoded {
+		if r.Data+r.Parity > MaxShards {
+			return fmt.Errorf("torus: a stripe can have at most %d shards", MaxShards)
+		}
+		ring, err := mds.GetRing()
+		if err != nil {
+			return err
+		}
+		if n := len(ring.Members()); n < r.Width(0) {
+			return fmt.Errorf("torus: %s needs at least %d peers, but the ring only has %d", r, r.Width(0), n)
+		}
+	}
+	if err := checkPlacement(mds, VolumeID(vol.Id), vol.MaxBytes, &r, ""); err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	_, err = cmds.ModifyConversion(VolumeID(vol.Id), func(c *Conversion) (*Conversion, error) {
+		if c != nil {
+			return nil, ErrExists
+		}
+		return &Conversion{
+			Volume:   volume,
+			VolumeID: VolumeID(vol.Id),
+			To:       r,
+			State:    ConversionDone,
+			Started:  now,
+			Finished: now,
+		}, nil
+	})
+	return err
+}
+
+// AbortConversion rolls the named volume back to the redundancy it had before
+// its running conversion.
+func AbortConversion(mds MetadataService, volume string) (*Conversion, error) {
+	cmds, ok := mds.(ConversionMetadataService)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	vol, err := mds.GetVolume(volume)
+	if err != nil {
+		return nil, err
+	}
+	return cmds.ModifyConversion(VolumeID(vol.Id), func(c *Conversion) (*Conversion, error) {
+		if c == nil || c.State != ConversionRunning {
+			return nil, ErrNotExist
+		}
+		c.State = ConversionAborted
+		c.Finished = time.Now().UnixNano()
+		return c, nil
+	})
+}
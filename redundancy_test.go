@@ -0,0 +1,64 @@
+package torus_test
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+)
+
+func TestParseRedundancy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want torus.Redundancy
+		ok   bool
+	}{
+		{"ring", torus.Redundancy{}, true},
+		{"rep=3", torus.Redundancy{Kind: torus.Replicated, Replicas: 3}, true},
+		{"2x", torus.Redundancy{Kind: torus.Replicated, Replicas: 2}, true},
+		{"ec=8+3", torus.Redundancy{Kind: torus.ErasureCoded, Data: 8, Parity: 3}, true},
+		{"rep=0", torus.Redundancy{}, false},
+		{"ec=8", torus.Redundancy{}, false},
+		{"mirror", torus.Redundancy{}, false},
+	}
+	for _, tt := range tests {
+		got, err := torus.ParseRedundancy(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: unexpected error state: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %#v, want %#v", tt.in, got, tt.want)
+		}
+		if tt.ok && got.String() != tt.in && tt.in != "2x" {
+			t.Errorf("%s: round trip gave %s", tt.in, got)
+		}
+	}
+}
+
+func TestConversionLifecycle(t *testing.T) {
+	mds := temp.NewClient(torus.Config{}, temp.NewServer())
+	mds.CreateVolume(&models.Volume{Name: "vol", Id: 1, Type: "block"})
+
+	c, err := torus.StartConversion(mds, "vol", torus.Redundancy{Kind: torus.Replicated, Replicas: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Effective(2); got != 3 {
+		t.Fatalf("running conversion from ring(2) to rep=3: expected 3 replicas, got %d", got)
+	}
+	if _, err := torus.StartConversion(mds, "vol", torus.Redundancy{Kind: torus.Replicated, Replicas: 1}); err != torus.ErrExists {
+		t.Fatalf("expected ErrExists starting a second conversion, got %v", err)
+	}
+	c, err = torus.AbortConversion(mds, "vol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Effective(2); got != 2 {
+		t.Fatalf("aborted conversion: expected ring replication 2, got %d", got)
+	}
+	if _, err := torus.StartConversion(mds, "vol", torus.Redundancy{Kind: torus.ErasureCoded, Data: 8, Parity: 3}); err == nil {
+		t.Fatal("expected erasure coding to be refused")
+	}
+}
@@ -0,0 +1,61 @@
+package torus
+
+import "errors"
+
+// RepairPolicy decides what the cluster does when a peer finds blocks that are
+// down to their last live replica.
+type RepairPolicy int
+
+const (
+	// RepairNormal repairs critical blocks alongside all other background
+	// work, at the usual rate.
+	RepairNormal RepairPolicy = iota
+	// RepairPreempt pauses rebalancing, garbage collection and scrubbing on
+	// every peer that isn't repairing, and lifts the rate limit on the peers
+	// that are, until all critical blocks have a second replica again.
+	RepairPreempt
+)
+
+func ParseRepairPolicy(s string) (p RepairPolicy, err error) {
+	switch s {
+	case "normal":
+		p = RepairNormal
+	case "preempt":
+		p = RepairPreempt
+	default:
+		err = errors.New("invalid repair policy; use one of 'normal' or 'preempt'")
+	}
+	return
+}
+
+func (p RepairPolicy) String() string {
+	switch p {
+	case RepairPreempt:
+		return "preempt"
+	}
+	return "normal"
+}
+
+// Emergency is declared by a peer that holds blocks with no other live
+// replica. It lasts until the peer completes a pass without finding any.
+type Emergency struct {
+	Peer string `json:"peer"`
+	// Since is when the emergency was declared, in Unix nanoseconds.
+	Since int64 `json:"since"`
+	// CriticalBlocks is the number of blocks found with a single live replica
+	// so far.
+	CriticalBlocks uint64 `json:"critical_blocks"`
+}
+
+// RepairMetadataService is implemented by metadata services that can
+// coordinate emergency repair across the cluster.
+type RepairMetadataService interface {
+	GetRepairPolicy() (RepairPolicy, error)
+	SetRepairPolicy(RepairPolicy) error
+
+	// SetEmergency declares or updates this peer's emergency. It is tied to
+	// lease so that it vanishes with the peer. A nil Emergency clears it.
+	SetEmergency(lease int64, e *Emergency) error
+	// GetEmergencies returns all currently declared emergencies.
+	GetEmergencies() ([]*Emergency, error)
+}
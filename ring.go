@@ -1,6 +1,8 @@
 package torus
 
 import (
+	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/coreos/torus/models"
@@ -33,11 +35,47 @@ type RingRemover interface {
 	RemovePeers(PeerList) (Ring, error)
 }
 
+// WeightAdjustableRing is implemented by rings that weigh peers by their
+// capacity, and can give some of them less than their share of blocks
+// without the peers themselves changing.
+type WeightAdjustableRing interface {
+	Ring
+	// WeightAdjustments returns the fraction of its weight each peer that
+	// has been adjusted keeps. Peers that aren't in it keep all of it.
+	WeightAdjustments() map[string]float64
+	// AdjustWeights returns the next version of the ring, with the peers in
+	// adj keeping those fractions of their weight, and the rest all of it.
+	AdjustWeights(adj map[string]float64) (Ring, error)
+}
+
+// PeerPermutation is the order in which peers are responsible for a block.
+// The first Replication peers hold it; the rest follow in a deterministic
+// order, so that every client agrees on who to turn to when a replica is down.
 type PeerPermutation struct {
 	Replication int
 	Peers       PeerList
 }
 
+// Replicas returns the peers that should hold the block.
+func (pp PeerPermutation) Replicas() PeerList {
+	if pp.Replication > len(pp.Peers) {
+		return pp.Peers
+	}
+	return pp.Peers[:pp.Replication]
+}
+
+// Fallback returns the next n peers after the replicas, in order, for reads
+// to retry and writes to hand off to when a replica is unavailable. It returns
+// fewer if the ring doesn't have that many more peers, and all of them if n is
+// negative.
+func (pp PeerPermutation) Fallback(n int) PeerList {
+	rest := pp.Peers[len(pp.Replicas()):]
+	if n >= 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	return rest
+}
+
 type PeerList []string
 
 func (pl PeerList) IndexAt(uuid string) int {
@@ -55,8 +93,9 @@ func (pl PeerList) Has(uuid string) bool {
 
 func (pl PeerList) AndNot(b PeerList) PeerList {
 	var out PeerList
+	bs := newPeerSet(b, len(pl))
 	for _, x := range pl {
-		if !b.Has(x) {
+		if !bs.has(x) {
 			out = append(out, x)
 		}
 	}
@@ -68,8 +107,9 @@ func (pl PeerList) Union(b PeerList) PeerList {
 	for _, x := range pl {
 		out = append(out, x)
 	}
+	ps := newPeerSet(pl, len(b))
 	for _, x := range b {
-		if !pl.Has(x) {
+		if !ps.has(x) {
 			out = append(out, x)
 		}
 	}
@@ -78,14 +118,57 @@ func (pl PeerList) Union(b PeerList) PeerList {
 
 func (pl PeerList) Intersect(b PeerList) PeerList {
 	var out PeerList
+	bs := newPeerSet(b, len(pl))
 	for _, x := range pl {
-		if b.Has(x) {
+		if bs.has(x) {
 			out = append(out, x)
 		}
 	}
 	return out
 }
 
+// peerIndexMin is the size past which set operations index peers in a map
+// instead of scanning the list for each one. Replica lists are far shorter,
+// and scanning them beats building a map.
+const peerIndexMin = 16
+
+// peerSet answers whether a peer is in a list.
+type peerSet struct {
+	list PeerList
+	info PeerInfoList
+	m    map[string]bool
+}
+
+// newPeerSet prepares pl for the given number of lookups.
+func newPeerSet(pl PeerList, lookups int) peerSet {
+	s := peerSet{list: pl}
+	if len(pl) > peerIndexMin && lookups > peerIndexMin {
+		s.m = make(map[string]bool, len(pl))
+		for _, x := range pl {
+			s.m[x] = true
+		}
+	}
+	return s
+}
+
+// peerInfoSet is a peerSet of the UUIDs in a PeerInfoList.
+func peerInfoSet(pi PeerInfoList, lookups int) peerSet {
+	if len(pi) > peerIndexMin && lookups > peerIndexMin {
+		return newPeerSet(pi.PeerList(), lookups)
+	}
+	return peerSet{info: pi}
+}
+
+func (s peerSet) has(uuid string) bool {
+	switch {
+	case s.m != nil:
+		return s.m[uuid]
+	case s.info != nil:
+		return s.info.HasUUID(uuid)
+	}
+	return s.list.Has(uuid)
+}
+
 // Applicative! Applicative! My kingdom for Applicative!
 
 type PeerInfoList []*models.PeerInfo
@@ -105,8 +188,9 @@ func (pi PeerInfoList) HasUUID(uuid string) bool {
 
 func (pi PeerInfoList) AndNot(b PeerList) PeerInfoList {
 	var out PeerInfoList
+	bs := newPeerSet(b, len(pi))
 	for _, x := range pi {
-		if !b.Has(x.UUID) {
+		if !bs.has(x.UUID) {
 			out = append(out, x)
 		}
 	}
@@ -118,8 +202,9 @@ func (pi PeerInfoList) Union(b PeerInfoList) PeerInfoList {
 	for _, x := range pi {
 		out = append(out, x)
 	}
+	ps := peerInfoSet(pi, len(b))
 	for _, x := range b {
-		if !pi.HasUUID(x.UUID) {
+		if !ps.has(x.UUID) {
 			out = append(out, x)
 		}
 	}
@@ -128,8 +213,9 @@ func (pi PeerInfoList) Union(b PeerInfoList) PeerInfoList {
 
 func (pi PeerInfoList) Intersect(b PeerInfoList) PeerInfoList {
 	var out PeerInfoList
+	bs := peerInfoSet(b, len(pi))
 	for _, x := range pi {
-		if b.HasUUID(x.UUID) {
+		if bs.has(x.UUID) {
 			out = append(out, x)
 		}
 	}
@@ -144,18 +230,143 @@ func (pi PeerInfoList) PeerList() PeerList {
 	return PeerList(out)
 }
 
-func (pi PeerInfoList) GetWeights() map[string]int {
+// GetWeights returns the weight of each peer on a weighted ring, in
+// proportion to its capacity. Peers that don't report a capacity yet, as
+// when they've just joined, get no weight and are left out. It fails if no
+// peer has any capacity.
+func (pi PeerInfoList) GetWeights() (map[string]int, error) {
 	out := make(map[string]int)
 	if len(pi) == 0 {
-		return out
+		return out, nil
+	}
+	var gcd *big.Int
+	for _, p := range pi {
+		if p.TotalBlocks == 0 {
+			continue
+		}
+		c := new(big.Int).SetUint64(p.TotalBlocks)
+		if gcd == nil {
+			gcd = c
+			continue
+		}
+		gcd.GCD(nil, nil, gcd, c)
 	}
-	gcd := big.NewInt(int64(pi[0].TotalBlocks))
-	for _, p := range pi[1:] {
-		gcd.GCD(nil, nil, gcd, big.NewInt(int64(p.TotalBlocks)))
+	if gcd == nil {
+		return nil, ErrNoCapacity
 	}
 	for _, p := range pi {
-		out[p.UUID] = int(p.TotalBlocks / uint64(gcd.Int64()))
-		clog.Infof("%s: weight %d", p.UUID, out[p.UUID])
+		if p.TotalBlocks == 0 {
+			continue
+		}
+		out[p.UUID] = int(p.TotalBlocks / gcd.Uint64())
+	}
+	return out, nil
+}
+
+// DefaultWeightScale is the weight GetCappedWeights gives the largest peer
+// if it isn't told otherwise: enough points on a ketama ring to spread
+// blocks evenly, and few enough that the ring is quick to build.
+const DefaultWeightScale = 160
+
+// GetCappedWeights is GetWeights with each peer's capacity capped, and
+// weights kept small. maxFill is the fraction of a peer's capacity it should
+// be filled to at most, such as 0.85 for a peer that shares its disk; peers
+// that aren't in it count all of their capacity. The largest peer gets a
+// weight of scale, or DefaultWeightScale if it's 0, and the rest get weights
+// in proportion, rounded but at least 1, rather than the capacities divided
+// by their GCD, which a single prime-sized disk makes run into the millions.
+func (pi PeerInfoList) GetCappedWeights(maxFill map[string]float64, scale int) (map[string]int, error) {
+	if scale <= 0 {
+		scale = DefaultWeightScale
+	}
+	out := make(map[string]int)
+	if len(pi) == 0 {
+		return out, nil
+	}
+	for uuid, f := range maxFill {
+		if f <= 0 || f > 1 {
+			return nil, fmt.Errorf("torus: max fill of %s is %v, not between 0 and 1", uuid, f)
+		}
+	}
+	capped := make([]float64, len(pi))
+	var largest float64
+	for i, p := range pi {
+		capped[i] = float64(p.TotalBlocks)
+		if f, ok := maxFill[p.UUID]; ok {
+			capped[i] *= f
+		}
+		largest = math.Max(largest, capped[i])
+	}
+	if largest == 0 {
+		return nil, ErrNoCapacity
+	}
+	for i, p := range pi {
+		if capped[i] == 0 {
+			continue
+		}
+		w := int(capped[i]/largest*float64(scale) + 0.5)
+		if w < 1 {
+			w = 1
+		}
+		out[p.UUID] = w
+	}
+	return out, nil
+}
+
+const (
+	// DefaultFillThreshold is how full a peer may get, as a fraction of its
+	// capacity, before FillAdjustments lowers its weight, if it isn't told
+	// otherwise.
+	DefaultFillThreshold = 0.85
+	// fillAdjustStep is how much of its weight FillAdjustments takes from a
+	// peer above the threshold, or gives back to one below it, each time.
+	fillAdjustStep = 0.1
+	// fillHysteresis is how far below the threshold a peer must be before
+	// its weight is raised again, so that it doesn't swing back and forth
+	// around it.
+	fillHysteresis = 0.05
+	// minFillAdjustment is the least of its weight a peer is left with, so
+	// that it always takes some blocks.
+	minFillAdjustment = 0.1
+)
+
+// FillAdjustments returns the weight adjustments for a WeightAdjustableRing
+// that follow from adj, given how full each of the peers last said it was.
+// Peers more than threshold full lose another step of their weight; peers
+// that have been adjusted and are comfortably below it get a step back, and
+// drop out of the adjustments once they have all of it again. Peers that
+// don't report a capacity keep what they have. Moving weights a step at a
+// time steers blocks away from full peers gradually, rather than all at
+// once.
+func FillAdjustments(adj map[string]float64, peers PeerInfoList, threshold float64) map[string]float64 {
+	if threshold <= 0 {
+		threshold = DefaultFillThreshold
+	}
+	out := make(map[string]float64)
+	for uuid, f := range adj {
+		out[uuid] = f
+	}
+	for _, p := range peers {
+		if p.TotalBlocks == 0 {
+			continue
+		}
+		cur, ok := adj[p.UUID]
+		if !ok {
+			cur = 1
+		}
+		fill := float64(p.UsedBlocks) / float64(p.TotalBlocks)
+		switch {
+		case fill > threshold:
+			out[p.UUID] = math.Max(cur*(1-fillAdjustStep), minFillAdjustment)
+		case fill < threshold-fillHysteresis && ok:
+			next := cur / (1 - fillAdjustStep)
+			// Allow for rounding on the way back up.
+			if next > 1-1e-9 {
+				delete(out, p.UUID)
+			} else {
+				out[p.UUID] = next
+			}
+		}
 	}
 	return out
 }
@@ -0,0 +1,42 @@
+package ring
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring/ringtest"
+)
+
+func TestKetamaConformance(t *testing.T) {
+	// hashring gives the smallest peers only a few dozen points on the
+	// circle, so allow a little more skew than the default.
+	ringtest.Run(t, ringtest.Config{
+		Type:            Ketama,
+		New:             makeKetama,
+		WeightTolerance: 0.4,
+	})
+}
+
+func TestModConformance(t *testing.T) {
+	// mod rehashes every key on membership change and ignores capacity.
+	ringtest.Run(t, ringtest.Config{
+		Type:         Mod,
+		New:          makeMod,
+		SkipMovement: true,
+		SkipWeights:  true,
+	})
+}
+
+func TestCappedKetamaConformance(t *testing.T) {
+	ringtest.Run(t, ringtest.Config{
+		Type: Ketama,
+		New: func(r *models.Ring) (torus.Ring, error) {
+			if err := SetCappedWeights(r, 0, nil); err != nil {
+				return nil, err
+			}
+			return makeKetama(r)
+		},
+		WeightTolerance: 0.4,
+	})
+}
@@ -10,7 +10,7 @@ type empty struct {
 }
 
 func init() {
-	registerRing(Empty, "empty", makeEmpty)
+	RegisterRing("empty", Empty, makeEmpty)
 }
 
 func makeEmpty(r *models.Ring) (torus.Ring, error) {
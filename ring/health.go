@@ -0,0 +1,56 @@
+package ring
+
+import "github.com/coreos/torus"
+
+// HealthView is a ring as seen by a peer that knows which of the ring's
+// members have stopped heartbeating. The ring itself stays the same for
+// every peer; only which of its members are worth asking changes.
+type HealthView struct {
+	torus.Ring
+	// Down returns whether the member with the given UUID is down.
+	Down func(uuid string) bool
+}
+
+// HealthyMembers returns the members of the ring that aren't down.
+func (v HealthView) HealthyMembers() torus.PeerList {
+	var out torus.PeerList
+	for _, p := range v.Members() {
+		if !v.Down(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// GetPeers returns the ring's permutation for key with the down peers
+// skipped, so that they aren't waited on. See SkipDown.
+func (v HealthView) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
+	perm, err := v.Ring.GetPeers(key)
+	if err != nil {
+		return perm, err
+	}
+	return SkipDown(perm, v.Down), nil
+}
+
+// SkipDown returns perm without the peers that are down. The replicas that
+// are left stay at the front, so Replication shrinks by the number of down
+// replicas. If every peer is down, perm is returned as it is, since trying
+// them is all there is left to do.
+func SkipDown(perm torus.PeerPermutation, down func(uuid string) bool) torus.PeerPermutation {
+	out := torus.PeerPermutation{
+		Peers: make(torus.PeerList, 0, len(perm.Peers)),
+	}
+	for i, p := range perm.Peers {
+		if down(p) {
+			continue
+		}
+		out.Peers = append(out.Peers, p)
+		if i < perm.Replication {
+			out.Replication++
+		}
+	}
+	if len(out.Peers) == len(perm.Peers) || len(out.Peers) == 0 {
+		return perm
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package ring
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+func TestSkipDown(t *testing.T) {
+	perm := torus.PeerPermutation{
+		Peers:       torus.PeerList{"a", "b", "c", "d"},
+		Replication: 2,
+	}
+	down := map[string]bool{"a": true, "c": true}
+	got := SkipDown(perm, func(uuid string) bool { return down[uuid] })
+	want := torus.PeerPermutation{
+		Peers:       torus.PeerList{"b", "d"},
+		Replication: 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	all := SkipDown(perm, func(string) bool { return true })
+	if !reflect.DeepEqual(all, perm) {
+		t.Errorf("expected every peer to be kept when all are down, got %v", all)
+	}
+}
+
+func TestHealthyMembers(t *testing.T) {
+	r, err := CreateRing(&models.Ring{
+		Type:              uint32(Ketama),
+		Version:           1,
+		ReplicationFactor: 3,
+		Peers: []*models.PeerInfo{
+			{UUID: "a", TotalBlocks: 100},
+			{UUID: "b", TotalBlocks: 100},
+			{UUID: "c", TotalBlocks: 100},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := HealthView{Ring: r, Down: func(uuid string) bool { return uuid == "b" }}
+	if got := v.HealthyMembers(); !reflect.DeepEqual(got, torus.PeerList{"a", "c"}) {
+		t.Errorf("expected a and c to be healthy, got %v", got)
+	}
+	perm, err := v.GetPeers(torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm.Peers.Has("b") || perm.Replication != 2 {
+		t.Errorf("expected b to be skipped, got %v", perm)
+	}
+}
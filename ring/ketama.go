@@ -1,9 +1,11 @@
 package ring
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/models"
@@ -16,10 +18,146 @@ type ketama struct {
 	rep     int
 	peers   torus.PeerInfoList
 	ring    *hashring.HashRing
+	// nodes is how many nodes are on the ring, if some peers have their
+	// devices on it instead of themselves.
+	nodes int
+	// weighted is how many nodes are on the ring at all; those without
+	// capacity have no weight, and are left off it.
+	weighted int
+	// capped is how the peers are weighed, if not by the GCD of their
+	// capacities.
+	capped *cappedWeights
+}
+
+// cappedWeightsAttr is the ring attr that holds a ketama ring's
+// cappedWeights. Rings made without it weigh peers by the GCD of their
+// capacities, as they always have, so that their blocks stay where they are.
+const cappedWeightsAttr = "capped-weights"
+
+// cappedWeights are the arguments to torus.PeerInfoList.GetCappedWeights
+// for the peers of a ring.
+type cappedWeights struct {
+	Scale   int                `json:"scale"`
+	MaxFill map[string]float64 `json:"max_fill,omitempty"`
+	// Adjust is the fraction of its capped weight each adjusted peer
+	// keeps; see torus.WeightAdjustableRing.
+	Adjust map[string]float64 `json:"adjust,omitempty"`
+}
+
+// fill returns the fraction of its capacity a peer is weighed by, and
+// whether it's less than all of it.
+func (c *cappedWeights) fill(uuid string) (float64, bool) {
+	if c == nil {
+		return 1, false
+	}
+	f, capped := c.MaxFill[uuid]
+	if !capped {
+		f = 1
+	}
+	if a, ok := c.Adjust[uuid]; ok {
+		f *= a
+		capped = true
+	}
+	return f, capped
+}
+
+// SetCappedWeights makes the ketama ring r weigh its peers with
+// torus.PeerInfoList.GetCappedWeights, and keeps doing so as peers join and
+// leave it. Peers are placed differently once it's set, so it's best set on
+// a new cluster's first ring.
+func SetCappedWeights(r *models.Ring, scale int, maxFill map[string]float64) error {
+	if torus.RingType(r.Type) != Ketama {
+		return errors.New("ring: only ketama rings have capped weights")
+	}
+	if scale <= 0 {
+		scale = torus.DefaultWeightScale
+	}
+	b, err := json.Marshal(cappedWeights{Scale: scale, MaxFill: maxFill})
+	if err != nil {
+		return err
+	}
+	if r.Attrs == nil {
+		r.Attrs = make(map[string][]byte)
+	}
+	r.Attrs[cappedWeightsAttr] = b
+	return nil
+}
+
+// newKetama returns a ketama ring of the given peers. A peer that stores
+// blocks on several devices has each of them put on the ring, as a node
+// named after both, so that a block is placed on a device and not just a
+// peer.
+func newKetama(version, rep int, peers torus.PeerInfoList, capped *cappedWeights) (*ketama, error) {
+	k := &ketama{
+		version: version,
+		rep:     rep,
+		peers:   peers,
+		capped:  capped,
+	}
+	// Devices are filled as far as their peer is.
+	var nodes torus.PeerInfoList
+	maxFill := make(map[string]float64)
+	for _, p := range peers {
+		f, capFill := capped.fill(p.UUID)
+		if len(p.Devices) == 0 {
+			nodes = append(nodes, p)
+			if capFill {
+				maxFill[p.UUID] = f
+			}
+			continue
+		}
+		for _, dev := range p.Devices {
+			node := deviceNode(p.UUID, dev.UUID)
+			nodes = append(nodes, &models.PeerInfo{
+				UUID:        node,
+				TotalBlocks: dev.TotalBlocks,
+			})
+			if capFill {
+				maxFill[node] = f
+			}
+		}
+	}
+	if len(nodes) != len(peers) {
+		k.nodes = len(nodes)
+	}
+	var weights map[string]int
+	var err error
+	if capped != nil {
+		weights, err = nodes.GetCappedWeights(maxFill, capped.Scale)
+	} else {
+		weights, err = nodes.GetWeights()
+	}
+	if err != nil {
+		return nil, err
+	}
+	k.ring = hashring.NewWithWeights(weights)
+	k.weighted = len(weights)
+	return k, nil
+}
+
+func deviceNode(peer, device string) string {
+	return peer + "/" + device
+}
+
+// nodePeers returns the peers of the nodes, in order, each only once; all
+// the devices of a peer are one failure domain.
+func nodePeers(nodes []string) []string {
+	out := make([]string, 0, len(nodes))
+	seen := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		if i := strings.IndexByte(n, '/'); i != -1 {
+			n = n[:i]
+		}
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
 }
 
 func init() {
-	registerRing(Ketama, "ketama", makeKetama)
+	RegisterRing("ketama", Ketama, makeKetama)
 }
 
 func makeKetama(r *models.Ring) (torus.Ring, error) {
@@ -31,16 +169,28 @@ func makeKetama(r *models.Ring) (torus.Ring, error) {
 	if rep > len(pi) {
 		clog.Noticef("Using ring that requests replication level %d, but has only %d peers. Add nodes to match replication.", rep, len(pi))
 	}
-	return &ketama{
-		version: int(r.Version),
-		peers:   pi,
-		rep:     rep,
-		ring:    hashring.NewWithWeights(pi.GetWeights()),
-	}, nil
+	var capped *cappedWeights
+	if b, ok := r.Attrs[cappedWeightsAttr]; ok {
+		capped = &cappedWeights{}
+		if err := json.Unmarshal(b, capped); err != nil {
+			return nil, fmt.Errorf("ring: bad %s attr: %v", cappedWeightsAttr, err)
+		}
+	}
+	k, err := newKetama(int(r.Version), rep, pi, capped)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
 }
 
 func (k *ketama) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
-	s, ok := k.ring.GetNodes(string(key.ToBytes()), len(k.peers))
+	// Asking for more nodes than are on the ring gets none at all. Peers
+	// without capacity are added at the end below.
+	s, ok := k.ring.GetNodes(string(key.ToBytes()), k.weighted)
+	if k.nodes != 0 {
+		s = nodePeers(s)
+	}
+	ok = ok && len(s) == len(k.peers)
 	if !ok {
 		if len(s) == 0 {
 			return torus.PeerPermutation{}, errors.New("couldn't get any nodes")
@@ -74,6 +224,22 @@ func (k *ketama) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
 	}, nil
 }
 
+// GetDevices implements torus.DeviceRing.
+func (k *ketama) GetDevices(key torus.BlockRef, peer string) []string {
+	if k.nodes == 0 {
+		return nil
+	}
+	s, _ := k.ring.GetNodes(string(key.ToBytes()), k.weighted)
+	prefix := peer + "/"
+	var out []string
+	for _, n := range s {
+		if strings.HasPrefix(n, prefix) {
+			out = append(out, n[len(prefix):])
+		}
+	}
+	return out
+}
+
 func (k *ketama) Members() torus.PeerList { return k.peers.PeerList() }
 
 func (k *ketama) Describe() string {
@@ -93,6 +259,13 @@ func (k *ketama) Marshal() ([]byte, error) {
 	out.ReplicationFactor = uint32(k.rep)
 	out.Type = uint32(k.Type())
 	out.Peers = k.peers
+	if k.capped != nil {
+		b, err := json.Marshal(k.capped)
+		if err != nil {
+			return nil, err
+		}
+		out.Attrs = map[string][]byte{cappedWeightsAttr: b}
+	}
 	return out.Marshal()
 }
 
@@ -101,11 +274,9 @@ func (k *ketama) AddPeers(peers torus.PeerInfoList) (torus.Ring, error) {
 	if reflect.DeepEqual(newPeers.PeerList(), k.peers.PeerList()) {
 		return nil, torus.ErrExists
 	}
-	newk := &ketama{
-		version: k.version + 1,
-		rep:     k.rep,
-		peers:   newPeers,
-		ring:    hashring.NewWithWeights(newPeers.GetWeights()),
+	newk, err := newKetama(k.version+1, k.rep, newPeers, k.capped)
+	if err != nil {
+		return nil, err
 	}
 	return newk, nil
 }
@@ -116,11 +287,47 @@ func (k *ketama) RemovePeers(pl torus.PeerList) (torus.Ring, error) {
 		return nil, torus.ErrNotExist
 	}
 
-	newk := &ketama{
-		version: k.version + 1,
-		rep:     k.rep,
-		peers:   newPeers,
-		ring:    hashring.NewWithWeights(newPeers.GetWeights()),
+	newk, err := newKetama(k.version+1, k.rep, newPeers, k.capped)
+	if err != nil {
+		return nil, err
+	}
+	return newk, nil
+}
+
+// WeightAdjustments implements torus.WeightAdjustableRing.
+func (k *ketama) WeightAdjustments() map[string]float64 {
+	out := make(map[string]float64)
+	if k.capped != nil {
+		for uuid, a := range k.capped.Adjust {
+			out[uuid] = a
+		}
+	}
+	return out
+}
+
+// AdjustWeights implements torus.WeightAdjustableRing. Only rings with
+// capped weights can be adjusted: the weights of the others are fixed by the
+// GCD of the peers' capacities.
+func (k *ketama) AdjustWeights(adj map[string]float64) (torus.Ring, error) {
+	if k.capped == nil {
+		return nil, errors.New("ring: only ketama rings with capped weights can be adjusted")
+	}
+	for uuid, a := range adj {
+		if a <= 0 || a > 1 {
+			return nil, fmt.Errorf("ring: weight adjustment of %s is %v, not between 0 and 1", uuid, a)
+		}
+	}
+	capped := *k.capped
+	capped.Adjust = nil
+	if len(adj) != 0 {
+		capped.Adjust = make(map[string]float64, len(adj))
+		for uuid, a := range adj {
+			capped.Adjust[uuid] = a
+		}
+	}
+	newk, err := newKetama(k.version+1, k.rep, k.peers, &capped)
+	if err != nil {
+		return nil, err
 	}
 	return newk, nil
 }
@@ -131,6 +338,8 @@ func (k *ketama) ChangeReplication(r int) (torus.Ring, error) {
 		rep:     r,
 		peers:   k.peers,
 		ring:    k.ring,
+		nodes:   k.nodes,
+		capped:  k.capped,
 	}
 	return newk, nil
 }
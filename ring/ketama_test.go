@@ -23,11 +23,16 @@ func TestTinyPeer(t *testing.T) {
 			TotalBlocks: 100 * 1024 * 2,
 		},
 	}
+	weights, err := pi.GetWeights()
+	if err != nil {
+		t.Fatal(err)
+	}
 	k := &ketama{
-		version: 1,
-		peers:   pi,
-		rep:     2,
-		ring:    hashring.NewWithWeights(pi.GetWeights()),
+		version:  1,
+		peers:    pi,
+		rep:      2,
+		ring:     hashring.NewWithWeights(weights),
+		weighted: len(weights),
 	}
 	l, err := k.GetPeers(torus.BlockRef{
 		INodeRef: torus.NewINodeRef(3, 4),
@@ -38,3 +43,127 @@ func TestTinyPeer(t *testing.T) {
 	}
 	t.Log(l.Peers)
 }
+
+func TestZeroCapacityPeer(t *testing.T) {
+	pi := torus.PeerInfoList{
+		&models.PeerInfo{UUID: "a", TotalBlocks: 100},
+		&models.PeerInfo{UUID: "b", TotalBlocks: 100},
+		&models.PeerInfo{UUID: "c"},
+		&models.PeerInfo{
+			UUID: "d",
+			Devices: []*models.PeerInfo{
+				{UUID: "d1", TotalBlocks: 100},
+				{UUID: "d2"},
+			},
+		},
+	}
+	k, err := newKetama(1, 2, pi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		perm, err := k.GetPeers(torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(perm.Peers) != 4 || perm.Peers[3] != "c" {
+			t.Fatalf("expected every peer, with c last, got %v", perm.Peers)
+		}
+	}
+}
+
+func TestKetamaDevices(t *testing.T) {
+	pi := torus.PeerInfoList{
+		&models.PeerInfo{
+			UUID:        "a",
+			TotalBlocks: 200,
+			Devices: []*models.PeerInfo{
+				{UUID: "a1", TotalBlocks: 100},
+				{UUID: "a2", TotalBlocks: 100},
+			},
+		},
+		&models.PeerInfo{UUID: "b", TotalBlocks: 200},
+		&models.PeerInfo{UUID: "c", TotalBlocks: 200},
+	}
+	k, err := newKetama(1, 2, pi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onDevice := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		perm, err := k.GetPeers(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(perm.Peers) != 3 || len(perm.Peers.Union(torus.PeerList{"a", "b", "c"})) != 3 {
+			t.Fatalf("expected each peer once, got %v", perm.Peers)
+		}
+		devs := k.GetDevices(ref, "a")
+		if len(devs) != 2 {
+			t.Fatalf("expected both devices of a, got %v", devs)
+		}
+		if perm.Replicas().Has("a") {
+			onDevice[devs[0]]++
+		}
+		if k.GetDevices(ref, "b") != nil {
+			t.Fatal("b has no devices on the ring")
+		}
+	}
+	if onDevice["a1"] == 0 || onDevice["a2"] == 0 {
+		t.Fatalf("expected blocks on both devices of a, got %v", onDevice)
+	}
+}
+
+func TestKetamaAdjustWeights(t *testing.T) {
+	pi := torus.PeerInfoList{
+		&models.PeerInfo{UUID: "a", TotalBlocks: 1000},
+		&models.PeerInfo{UUID: "b", TotalBlocks: 1000},
+	}
+	k, err := newKetama(1, 1, pi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.AdjustWeights(map[string]float64{"a": 0.5}); err == nil {
+		t.Fatal("expected a ring without capped weights not to be adjustable")
+	}
+	k, err = newKetama(1, 1, pi, &cappedWeights{Scale: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := k.AdjustWeights(map[string]float64{"a": 0.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version() != 2 {
+		t.Fatalf("expected version 2, got %d", r.Version())
+	}
+	// The adjustment survives a round trip through the metadata service.
+	b, err := r.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m models.Ring
+	if err := m.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	r, err = makeKetama(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adj := r.(torus.WeightAdjustableRing).WeightAdjustments(); adj["a"] != 0.25 {
+		t.Fatalf("expected a to keep a quarter of its weight, got %v", adj)
+	}
+	count := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		perm, err := r.GetPeers(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count[perm.Peers[0]]++
+	}
+	if count["a"]*2 > count["b"] {
+		t.Fatalf("expected a to get far fewer blocks than b, got %v", count)
+	}
+}
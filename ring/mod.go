@@ -17,7 +17,7 @@ type mod struct {
 }
 
 func init() {
-	registerRing(Mod, "mod", makeMod)
+	RegisterRing("mod", Mod, makeMod)
 }
 
 func makeMod(r *models.Ring) (torus.Ring, error) {
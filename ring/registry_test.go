@@ -0,0 +1,45 @@
+package ring
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+const testRingType torus.RingType = 100
+
+func TestRegisterRing(t *testing.T) {
+	RegisterRing("test-mod", testRingType, makeMod)
+	defer func() {
+		delete(ringRegistry, testRingType)
+		delete(ringNames, "test-mod")
+	}()
+
+	rt, ok := RingTypeFromString("test-mod")
+	if !ok || rt != testRingType {
+		t.Fatalf("expected test-mod to be type %d, got %d (%v)", testRingType, rt, ok)
+	}
+	r, err := CreateRing(&models.Ring{
+		Type:              uint32(rt),
+		Version:           1,
+		ReplicationFactor: 1,
+		Peers: torus.PeerInfoList{
+			&models.PeerInfo{UUID: "a", TotalBlocks: 100},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unmarshal(b); err != nil {
+		t.Fatalf("couldn't unmarshal a registered ring: %v", err)
+	}
+
+	if _, err := CreateRing(&models.Ring{Type: 101}); err == nil {
+		t.Fatal("expected an error creating an unregistered ring type")
+	}
+}
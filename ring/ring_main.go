@@ -4,6 +4,9 @@
 package ring
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/coreos/pkg/capnslog"
 	"github.com/coreos/torus"
 	"github.com/coreos/torus/models"
@@ -28,22 +31,26 @@ func Unmarshal(b []byte) (torus.Ring, error) {
 	return CreateRing(&a)
 }
 
-type createRingFunc func(r *models.Ring) (torus.Ring, error)
+// RingFactory creates a ring of a registered type from its stored form.
+type RingFactory func(r *models.Ring) (torus.Ring, error)
 
-var ringRegistry map[torus.RingType]createRingFunc
+var ringRegistry map[torus.RingType]RingFactory
 var ringNames map[string]torus.RingType
 
-func registerRing(t torus.RingType, name string, newFunc createRingFunc) {
+// RegisterRing makes a ring type available to CreateRing, and by name to
+// RingTypeFromString, so that it can be used by torusctl, ringtool and every
+// peer's rebalancer. Rings outside this package should register themselves in
+// an init function, and the binaries that use them must import them. Types
+// below 100 are reserved for the rings in this package.
+func RegisterRing(name string, t torus.RingType, factory RingFactory) {
 	if ringRegistry == nil {
-		ringRegistry = make(map[torus.RingType]createRingFunc)
+		ringRegistry = make(map[torus.RingType]RingFactory)
 	}
 
 	if _, ok := ringRegistry[t]; ok {
-		panic("torus: attempted to register ring type " + string(t) + " twice")
+		panic(fmt.Sprintf("torus: attempted to register ring type %d twice", t))
 	}
 
-	ringRegistry[t] = newFunc
-
 	if ringNames == nil {
 		ringNames = make(map[string]torus.RingType)
 	}
@@ -52,14 +59,45 @@ func registerRing(t torus.RingType, name string, newFunc createRingFunc) {
 		panic("torus: attempted to register ring name " + name + " twice")
 	}
 
+	ringRegistry[t] = factory
 	ringNames[name] = t
 }
 
 func CreateRing(r *models.Ring) (torus.Ring, error) {
-	return ringRegistry[torus.RingType(r.Type)](r)
+	f, ok := ringRegistry[torus.RingType(r.Type)]
+	if !ok {
+		return nil, fmt.Errorf("ring: unknown ring type %d", r.Type)
+	}
+	return f(r)
 }
 
 func RingTypeFromString(s string) (torus.RingType, bool) {
 	v, ok := ringNames[s]
 	return v, ok
 }
+
+// RingNames returns the names of all registered ring types, sorted.
+func RingNames() []string {
+	var out []string
+	for name := range ringNames {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// WithVersion returns a copy of r with the given version, such as to set a
+// ring that was built for an earlier version.
+func WithVersion(r torus.Ring, version int) (torus.Ring, error) {
+	b, err := r.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	var m models.Ring
+	err = m.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	m.Version = uint32(version)
+	return CreateRing(&m)
+}
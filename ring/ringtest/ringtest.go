@@ -0,0 +1,358 @@
+// Package ringtest is a conformance suite for torus.Ring implementations. It
+// checks that a ring places blocks deterministically on distinct peers,
+// survives Marshal, and moves few blocks as peers come and go.
+package ringtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+const (
+	defaultSamples         = 10000
+	defaultPeers           = 8
+	defaultReplication     = 2
+	defaultMovementSlack   = 0.5
+	defaultWeightTolerance = 0.25
+
+	peerBlocks = 100 * 1024 * 1024
+)
+
+// Config describes the ring implementation under test and which properties it
+// is expected to uphold.
+type Config struct {
+	// Type is the RingType stored in the models.Ring handed to New.
+	Type torus.RingType
+	// New creates a ring of the implementation under test.
+	New func(r *models.Ring) (torus.Ring, error)
+
+	// Samples is the number of keys to place for each check.
+	Samples int
+	// Peers is the number of peers in the base ring. Must be at least 2.
+	Peers int
+	// Replication is the replication factor of the base ring.
+	Replication int
+
+	// MovementSlack is how far, as a fraction over the ideal, the number of
+	// replica assignments that move after adding or removing a peer may be.
+	MovementSlack float64
+	// WeightTolerance is the allowed relative error between a peer's share of
+	// keys and its share of the cluster capacity.
+	WeightTolerance float64
+
+	// SkipMovement disables the add/remove movement checks, for rings that
+	// knowingly rehash everything on membership change.
+	SkipMovement bool
+	// SkipWeights disables the weight proportionality check, for rings that
+	// ignore peer capacity.
+	SkipWeights bool
+}
+
+func (c Config) withDefaults() Config {
+	if c.Samples == 0 {
+		c.Samples = defaultSamples
+	}
+	if c.Peers == 0 {
+		c.Peers = defaultPeers
+	}
+	if c.Replication == 0 {
+		c.Replication = defaultReplication
+	}
+	if c.MovementSlack == 0 {
+		c.MovementSlack = defaultMovementSlack
+	}
+	if c.WeightTolerance == 0 {
+		c.WeightTolerance = defaultWeightTolerance
+	}
+	return c
+}
+
+// Run runs the full conformance suite against the ring described by c, each
+// check as its own subtest.
+func Run(t *testing.T, c Config) {
+	if c.New == nil {
+		t.Fatal("ringtest: Config.New must be set")
+	}
+	c = c.withDefaults()
+	if c.Peers < 2 {
+		t.Fatal("ringtest: Config.Peers must be at least 2")
+	}
+	t.Run("Determinism", func(t *testing.T) { testDeterminism(t, c) })
+	t.Run("ReplicaUniqueness", func(t *testing.T) { testUniqueness(t, c) })
+	t.Run("Marshal", func(t *testing.T) { testMarshal(t, c) })
+	t.Run("FallbackChain", func(t *testing.T) { testFallback(t, c) })
+	if !c.SkipMovement {
+		t.Run("AddMovement", func(t *testing.T) { testAddMovement(t, c) })
+		t.Run("RemoveMovement", func(t *testing.T) { testRemoveMovement(t, c) })
+	}
+	if !c.SkipWeights {
+		t.Run("WeightProportionality", func(t *testing.T) { testWeights(t, c) })
+	}
+}
+
+// Keys returns n deterministic block refs spread across a handful of volumes
+// and inodes.
+func Keys(n int) []torus.BlockRef {
+	out := make([]torus.BlockRef, n)
+	for i := range out {
+		out[i] = torus.BlockRef{
+			INodeRef: torus.NewINodeRef(torus.VolumeID(i%7+1), torus.INodeID(i/64+1)),
+			Index:    torus.IndexID(i % 64),
+		}
+	}
+	return out
+}
+
+// Peers returns n peers named "peer-0" through "peer-(n-1)", each with the
+// same capacity.
+func Peers(n int) torus.PeerInfoList {
+	out := make(torus.PeerInfoList, n)
+	for i := range out {
+		out[i] = &models.PeerInfo{
+			UUID:        fmt.Sprintf("peer-%d", i),
+			TotalBlocks: peerBlocks,
+		}
+	}
+	return out
+}
+
+func (c Config) model(peers torus.PeerInfoList, rep int) *models.Ring {
+	return &models.Ring{
+		Type:              uint32(c.Type),
+		Version:           1,
+		ReplicationFactor: uint32(rep),
+		Peers:             peers,
+	}
+}
+
+func (c Config) mustNew(t *testing.T, peers torus.PeerInfoList, rep int) torus.Ring {
+	r, err := c.New(c.model(peers, rep))
+	if err != nil {
+		t.Fatalf("couldn't create ring: %v", err)
+	}
+	return r
+}
+
+func mustGetPeers(t *testing.T, r torus.Ring, key torus.BlockRef) torus.PeerPermutation {
+	perm, err := r.GetPeers(key)
+	if err != nil {
+		t.Fatalf("GetPeers(%s): %v", key, err)
+	}
+	return perm
+}
+
+func replicas(perm torus.PeerPermutation) torus.PeerList {
+	return perm.Replicas()
+}
+
+func equalPeers(a, b torus.PeerList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testDeterminism(t *testing.T, c Config) {
+	peers := Peers(c.Peers)
+	a := c.mustNew(t, peers, c.Replication)
+	b := c.mustNew(t, peers, c.Replication)
+	for _, key := range Keys(c.Samples) {
+		pa := mustGetPeers(t, a, key)
+		if again := mustGetPeers(t, a, key); !equalPeers(pa.Peers, again.Peers) {
+			t.Fatalf("%s: repeated GetPeers differs: %v vs %v", key, pa.Peers, again.Peers)
+		}
+		if pb := mustGetPeers(t, b, key); !equalPeers(pa.Peers, pb.Peers) {
+			t.Fatalf("%s: identical rings disagree: %v vs %v", key, pa.Peers, pb.Peers)
+		}
+	}
+}
+
+func testUniqueness(t *testing.T, c Config) {
+	peers := Peers(c.Peers)
+	for rep := 1; rep <= c.Peers+1; rep++ {
+		r := c.mustNew(t, peers, rep)
+		members := r.Members()
+		want := rep
+		if want > c.Peers {
+			want = c.Peers
+		}
+		for _, key := range Keys(c.Samples) {
+			perm := mustGetPeers(t, r, key)
+			if perm.Replication != want {
+				t.Fatalf("rep %d, %s: got replication %d, want %d", rep, key, perm.Replication, want)
+			}
+			if len(perm.Peers) < perm.Replication {
+				t.Fatalf("rep %d, %s: permutation %v shorter than replication", rep, key, perm.Peers)
+			}
+			seen := make(map[string]bool)
+			for _, p := range perm.Peers {
+				if seen[p] {
+					t.Fatalf("rep %d, %s: peer %s repeated in %v", rep, key, p, perm.Peers)
+				}
+				if !members.Has(p) {
+					t.Fatalf("rep %d, %s: peer %s is not a ring member", rep, key, p)
+				}
+				seen[p] = true
+			}
+		}
+	}
+}
+
+func testMarshal(t *testing.T, c Config) {
+	r := c.mustNew(t, Peers(c.Peers), c.Replication)
+	b, err := r.Marshal()
+	if err != nil {
+		t.Fatalf("couldn't marshal: %v", err)
+	}
+	var m models.Ring
+	if err := m.Unmarshal(b); err != nil {
+		t.Fatalf("couldn't unmarshal: %v", err)
+	}
+	r2, err := c.New(&m)
+	if err != nil {
+		t.Fatalf("couldn't recreate ring: %v", err)
+	}
+	if r2.Type() != r.Type() || r2.Version() != r.Version() {
+		t.Fatalf("round trip changed ring: type %d/%d, version %d/%d", r.Type(), r2.Type(), r.Version(), r2.Version())
+	}
+	for _, key := range Keys(c.Samples) {
+		pa, pb := mustGetPeers(t, r, key), mustGetPeers(t, r2, key)
+		if !equalPeers(replicas(pa), replicas(pb)) {
+			t.Fatalf("%s: round trip changed placement: %v vs %v", key, pa.Peers, pb.Peers)
+		}
+	}
+}
+
+// testFallback checks that the replicas followed by the full fallback chain
+// name every member exactly once, and that shorter chains are prefixes of it.
+func testFallback(t *testing.T, c Config) {
+	r := c.mustNew(t, Peers(c.Peers), c.Replication)
+	members := r.Members()
+	for _, key := range Keys(c.Samples) {
+		perm := mustGetPeers(t, r, key)
+		all := perm.Fallback(-1)
+		chain := append(append(torus.PeerList{}, perm.Replicas()...), all...)
+		if len(chain) != len(members) || len(members.AndNot(chain)) != 0 {
+			t.Fatalf("%s: replicas and fallbacks %v don't cover members %v", key, chain, members)
+		}
+		for n := 0; n <= len(all)+1; n++ {
+			want := all
+			if n < len(all) {
+				want = all[:n]
+			}
+			if got := perm.Fallback(n); !equalPeers(got, want) {
+				t.Fatalf("%s: Fallback(%d) = %v, want %v", key, n, got, want)
+			}
+		}
+	}
+}
+
+// checkMovement compares placements before and after a membership change.
+// Every key may only gain the peer that joined (or lose the one that left),
+// and the total number of moved replica assignments must be within
+// MovementSlack of the ideal.
+func checkMovement(t *testing.T, c Config, before, after torus.Ring, changed string, ideal float64) {
+	moved := 0
+	for _, key := range Keys(c.Samples) {
+		old := replicas(mustGetPeers(t, before, key))
+		cur := replicas(mustGetPeers(t, after, key))
+		gained := cur.AndNot(old)
+		lost := old.AndNot(cur)
+		if len(gained) != len(lost) {
+			t.Fatalf("%s: replica count changed: %v -> %v", key, old, cur)
+		}
+		if len(gained) > 1 {
+			t.Fatalf("%s: more than one replica moved: %v -> %v", key, old, cur)
+		}
+		if len(gained) == 1 && gained[0] != changed && lost[0] != changed {
+			t.Fatalf("%s: replica moved between unchanged peers: %v -> %v", key, old, cur)
+		}
+		moved += len(gained)
+	}
+	limit := ideal * (1 + c.MovementSlack)
+	t.Logf("moved %d replica assignments, ideal %.0f, limit %.0f", moved, ideal, limit)
+	if float64(moved) > limit {
+		t.Fatalf("moved %d replica assignments, more than the limit of %.0f", moved, limit)
+	}
+}
+
+func testAddMovement(t *testing.T, c Config) {
+	peers := Peers(c.Peers + 1)
+	before := c.mustNew(t, peers[:c.Peers], c.Replication)
+	adder, ok := before.(torus.RingAdder)
+	if !ok {
+		t.Skip("ring does not implement torus.RingAdder")
+	}
+	after, err := adder.AddPeers(peers[c.Peers:])
+	if err != nil {
+		t.Fatalf("couldn't add peer: %v", err)
+	}
+	if after.Version() <= before.Version() {
+		t.Fatalf("version did not increase: %d -> %d", before.Version(), after.Version())
+	}
+	if len(after.Members()) != c.Peers+1 {
+		t.Fatalf("expected %d members, got %v", c.Peers+1, after.Members())
+	}
+	if _, err := after.(torus.RingAdder).AddPeers(peers[c.Peers:]); err != torus.ErrExists {
+		t.Fatalf("re-adding a member: expected ErrExists, got %v", err)
+	}
+	rep := len(replicas(mustGetPeers(t, before, Keys(1)[0])))
+	ideal := float64(c.Samples*rep) / float64(c.Peers+1)
+	checkMovement(t, c, before, after, peers[c.Peers].UUID, ideal)
+}
+
+func testRemoveMovement(t *testing.T, c Config) {
+	peers := Peers(c.Peers)
+	before := c.mustNew(t, peers, c.Replication)
+	remover, ok := before.(torus.RingRemover)
+	if !ok {
+		t.Skip("ring does not implement torus.RingRemover")
+	}
+	gone := peers[c.Peers-1].UUID
+	after, err := remover.RemovePeers(torus.PeerList{gone})
+	if err != nil {
+		t.Fatalf("couldn't remove peer: %v", err)
+	}
+	if after.Version() <= before.Version() {
+		t.Fatalf("version did not increase: %d -> %d", before.Version(), after.Version())
+	}
+	if after.Members().Has(gone) {
+		t.Fatalf("removed peer %s still a member", gone)
+	}
+	if _, err := after.(torus.RingRemover).RemovePeers(torus.PeerList{gone}); err != torus.ErrNotExist {
+		t.Fatalf("re-removing a peer: expected ErrNotExist, got %v", err)
+	}
+	rep := len(replicas(mustGetPeers(t, before, Keys(1)[0])))
+	ideal := float64(c.Samples*rep) / float64(c.Peers)
+	checkMovement(t, c, before, after, gone, ideal)
+}
+
+func testWeights(t *testing.T, c Config) {
+	peers := Peers(c.Peers)
+	var total uint64
+	for i, p := range peers {
+		p.TotalBlocks = uint64(i%4+1) * peerBlocks
+		total += p.TotalBlocks
+	}
+	r := c.mustNew(t, peers, 1)
+	counts := make(map[string]int)
+	for _, key := range Keys(c.Samples) {
+		counts[replicas(mustGetPeers(t, r, key))[0]]++
+	}
+	for _, p := range peers {
+		want := float64(c.Samples) * float64(p.TotalBlocks) / float64(total)
+		got := float64(counts[p.UUID])
+		t.Logf("%s: %d keys, expected %.0f", p.UUID, counts[p.UUID], want)
+		if got < want*(1-c.WeightTolerance) || got > want*(1+c.WeightTolerance) {
+			t.Errorf("%s: got %.0f keys, expected %.0f within %.0f%%", p.UUID, got, want, c.WeightTolerance*100)
+		}
+	}
+}
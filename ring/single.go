@@ -14,7 +14,7 @@ type single struct {
 }
 
 func init() {
-	registerRing(Single, "single", makeSingle)
+	RegisterRing("single", Single, makeSingle)
 }
 
 func makeSingle(r *models.Ring) (torus.Ring, error) {
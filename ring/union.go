@@ -8,13 +8,17 @@ import (
 	"github.com/coreos/torus/models"
 )
 
+// unionRing places blocks by two rings at once while a cluster migrates from
+// one to the other, so that every block is on both placements by the time
+// the new ring takes over.
 type unionRing struct {
+	version int
 	oldRing torus.Ring
 	newRing torus.Ring
 }
 
 func init() {
-	registerRing(Union, "union", makeUnion)
+	RegisterRing("union", Union, makeUnion)
 }
 
 func makeUnion(r *models.Ring) (torus.Ring, error) {
@@ -36,16 +40,40 @@ func makeUnion(r *models.Ring) (torus.Ring, error) {
 	if err != nil {
 		return nil, err
 	}
+	out.version = int(r.Version)
+	if out.version == 0 {
+		// Union rings used to take the new ring's version.
+		out.version = out.newRing.Version()
+	}
 	return out, nil
 }
 
-func NewUnionRing(oldRing torus.Ring, newRing torus.Ring) torus.Ring {
+// NewUnionRing returns a ring of the given version that places blocks by both
+// oldRing and newRing, for the migration from one to the other. Once the
+// rebalancer has copied every block to the new placement, newRing can be
+// given the following version with WithVersion and take over.
+func NewUnionRing(version int, oldRing torus.Ring, newRing torus.Ring) torus.Ring {
 	return &unionRing{
+		version: version,
 		oldRing: oldRing,
 		newRing: newRing,
 	}
 }
 
+// SplitUnion returns the rings a union ring was made from, and whether r is
+// one.
+func SplitUnion(r torus.Ring) (oldRing, newRing torus.Ring, ok bool) {
+	u, ok := r.(*unionRing)
+	if !ok {
+		return nil, nil, false
+	}
+	return u.oldRing, u.newRing, true
+}
+
+// GetPeers returns the replicas of both rings as the key's replicas, so that
+// writes land on both placements. The old ring's come first, as it holds
+// every block while the new placement is still being filled, and reads fall
+// back to the new ring's.
 func (u *unionRing) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error) {
 	n, err := u.newRing.GetPeers(key)
 	if err != nil {
@@ -55,12 +83,22 @@ func (u *unionRing) GetPeers(key torus.BlockRef) (torus.PeerPermutation, error)
 	if err != nil {
 		return torus.PeerPermutation{}, err
 	}
+	replicas := o.Replicas().Union(n.Replicas())
 	return torus.PeerPermutation{
-		Peers:       o.Peers.Union(n.Peers),
-		Replication: n.Replication,
+		Peers:       replicas.Union(o.Peers).Union(n.Peers),
+		Replication: len(replicas),
 	}, nil
 }
 
+// GetDevices implements torus.DeviceRing. Blocks are placed as the new
+// ring would.
+func (u *unionRing) GetDevices(key torus.BlockRef, peer string) []string {
+	if dr, ok := u.newRing.(torus.DeviceRing); ok {
+		return dr.GetDevices(key, peer)
+	}
+	return nil
+}
+
 func (u *unionRing) Members() torus.PeerList {
 	return u.newRing.Members().Union(u.oldRing.Members())
 }
@@ -76,7 +114,7 @@ func (u *unionRing) Type() torus.RingType {
 	return Union
 }
 func (u *unionRing) Version() int {
-	return u.newRing.Version()
+	return u.version
 }
 
 func (u *unionRing) Marshal() ([]byte, error) {
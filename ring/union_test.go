@@ -0,0 +1,74 @@
+package ring
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+func TestUnionMigration(t *testing.T) {
+	pi := torus.PeerInfoList{
+		&models.PeerInfo{UUID: "a", TotalBlocks: 100},
+		&models.PeerInfo{UUID: "b", TotalBlocks: 100},
+		&models.PeerInfo{UUID: "c", TotalBlocks: 100},
+		&models.PeerInfo{UUID: "d", TotalBlocks: 100},
+	}
+	oldRing, err := CreateRing(&models.Ring{
+		Type:              uint32(Mod),
+		Version:           1,
+		ReplicationFactor: 2,
+		Peers:             pi,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRing, err := newKetama(2, 2, pi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUnionRing(2, oldRing, newRing)
+
+	for i := 0; i < 100; i++ {
+		ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: torus.IndexID(i)}
+		perm, err := u.GetPeers(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, _ := oldRing.GetPeers(ref)
+		n, _ := newRing.GetPeers(ref)
+		replicas := perm.Replicas()
+		if len(replicas.Union(o.Replicas()).Union(n.Replicas())) != len(replicas) {
+			t.Fatalf("block %d: replicas %v don't hold both %v and %v", i, replicas, o.Replicas(), n.Replicas())
+		}
+		if perm.Replication < 2 || perm.Replication > 4 {
+			t.Fatalf("block %d: replication %d", i, perm.Replication)
+		}
+		if perm.Peers[0] != o.Peers[0] {
+			t.Fatalf("block %d: expected the old ring's first replica first", i)
+		}
+	}
+
+	b, err := u.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Version() != 2 || back.Type() != Union {
+		t.Fatalf("round trip gave a type %d ring of version %d", back.Type(), back.Version())
+	}
+	_, nr, ok := SplitUnion(back)
+	if !ok || nr.Type() != Ketama {
+		t.Fatal("couldn't split the union")
+	}
+	next, err := WithVersion(nr, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Version() != 3 || next.Type() != Ketama || len(next.Members()) != 4 {
+		t.Fatalf("unexpected ring after the migration: %s", next.Describe())
+	}
+}
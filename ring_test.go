@@ -0,0 +1,152 @@
+package torus_test
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+)
+
+func peerList(prefix string, n int) torus.PeerList {
+	out := make(torus.PeerList, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return out
+}
+
+func TestPeerListSets(t *testing.T) {
+	for _, n := range []int{3, 1000} {
+		// a and b share their second halves.
+		a := append(peerList("a", n/2), peerList("c", n-n/2)...)
+		b := append(peerList("c", n-n/2), peerList("b", n/2)...)
+		if got := a.AndNot(b); !reflect.DeepEqual(got, peerList("a", n/2)) {
+			t.Errorf("n=%d: unexpected AndNot: %v", n, got)
+		}
+		if got := a.Intersect(b); !reflect.DeepEqual(got, peerList("c", n-n/2)) {
+			t.Errorf("n=%d: unexpected Intersect: %v", n, got)
+		}
+		want := append(append(torus.PeerList{}, a...), peerList("b", n/2)...)
+		if got := a.Union(b); !reflect.DeepEqual(got, want) {
+			t.Errorf("n=%d: unexpected Union: %v", n, got)
+		}
+
+		var ai, bi torus.PeerInfoList
+		for _, x := range a {
+			ai = append(ai, &models.PeerInfo{UUID: x})
+		}
+		for _, x := range b {
+			bi = append(bi, &models.PeerInfo{UUID: x})
+		}
+		if got := ai.AndNot(b).PeerList(); !reflect.DeepEqual(got, peerList("a", n/2)) {
+			t.Errorf("n=%d: unexpected PeerInfoList AndNot: %v", n, got)
+		}
+		if got := ai.Intersect(bi).PeerList(); !reflect.DeepEqual(got, peerList("c", n-n/2)) {
+			t.Errorf("n=%d: unexpected PeerInfoList Intersect: %v", n, got)
+		}
+		if got := ai.Union(bi).PeerList(); !reflect.DeepEqual(got, want) {
+			t.Errorf("n=%d: unexpected PeerInfoList Union: %v", n, got)
+		}
+	}
+}
+
+func benchmarkPeerList(b *testing.B, n int, op func(x, y torus.PeerList) torus.PeerList) {
+	x := append(peerList("a", n/2), peerList("c", n-n/2)...)
+	y := append(peerList("c", n-n/2), peerList("b", n/2)...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		op(x, y)
+	}
+}
+
+func andNot(x, y torus.PeerList) torus.PeerList    { return x.AndNot(y) }
+func union(x, y torus.PeerList) torus.PeerList     { return x.Union(y) }
+func intersect(x, y torus.PeerList) torus.PeerList { return x.Intersect(y) }
+
+func BenchmarkPeerListAndNot3(b *testing.B)       { benchmarkPeerList(b, 3, andNot) }
+func BenchmarkPeerListAndNot1000(b *testing.B)    { benchmarkPeerList(b, 1000, andNot) }
+func BenchmarkPeerListUnion3(b *testing.B)        { benchmarkPeerList(b, 3, union) }
+func BenchmarkPeerListUnion1000(b *testing.B)     { benchmarkPeerList(b, 1000, union) }
+func BenchmarkPeerListIntersect3(b *testing.B)    { benchmarkPeerList(b, 3, intersect) }
+func BenchmarkPeerListIntersect1000(b *testing.B) { benchmarkPeerList(b, 1000, intersect) }
+
+func TestGetWeights(t *testing.T) {
+	pi := torus.PeerInfoList{
+		&models.PeerInfo{UUID: "a", TotalBlocks: 400},
+		&models.PeerInfo{UUID: "b", TotalBlocks: 0},
+		&models.PeerInfo{UUID: "c", TotalBlocks: 200},
+	}
+	w, err := pi.GetWeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"a": 2, "c": 1}; !reflect.DeepEqual(w, want) {
+		t.Fatalf("expected weights %v, got %v", want, w)
+	}
+	_, err = pi[1:2].GetWeights()
+	if err != torus.ErrNoCapacity {
+		t.Fatalf("expected peers without capacity to fail with ErrNoCapacity, got %v", err)
+	}
+}
+
+func TestGetCappedWeights(t *testing.T) {
+	pi := torus.PeerInfoList{
+		&models.PeerInfo{UUID: "a", TotalBlocks: 4000000},
+		&models.PeerInfo{UUID: "b", TotalBlocks: 3999971}, // prime
+		&models.PeerInfo{UUID: "c", TotalBlocks: 2000000},
+		&models.PeerInfo{UUID: "d", TotalBlocks: 0},
+	}
+	w, err := pi.GetWeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w["a"] != 4000000 {
+		t.Fatalf("expected a prime-sized peer to leave a's weight at 4000000, got %d", w["a"])
+	}
+	w, err = pi.GetCappedWeights(map[string]float64{"a": 0.5}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"a": 50, "b": 100, "c": 50}; !reflect.DeepEqual(w, want) {
+		t.Fatalf("expected weights %v, got %v", want, w)
+	}
+	if _, err := pi.GetCappedWeights(map[string]float64{"a": 1.5}, 100); err == nil {
+		t.Fatal("expected a max fill over 1 to fail")
+	}
+}
+
+func TestFillAdjustments(t *testing.T) {
+	pi := torus.PeerInfoList{
+		&models.PeerInfo{UUID: "a", TotalBlocks: 100, UsedBlocks: 90},
+		&models.PeerInfo{UUID: "b", TotalBlocks: 100, UsedBlocks: 50},
+		&models.PeerInfo{UUID: "c", TotalBlocks: 0},
+	}
+	adj := torus.FillAdjustments(nil, pi, 0.85)
+	if len(adj) != 1 || math.Abs(adj["a"]-0.9) > 1e-9 {
+		t.Fatalf("expected only a to lose a step of its weight, got %v", adj)
+	}
+	adj = torus.FillAdjustments(adj, pi, 0.85)
+	if math.Abs(adj["a"]-0.81) > 1e-9 {
+		t.Fatalf("expected a to lose another step, got %v", adj)
+	}
+	// Once a is below the threshold, its weight comes back a step at a
+	// time, and it drops out of the adjustments.
+	pi[0].UsedBlocks = 70
+	adj = torus.FillAdjustments(adj, pi, 0.85)
+	if math.Abs(adj["a"]-0.9) > 1e-9 {
+		t.Fatalf("expected a to get a step back, got %v", adj)
+	}
+	adj = torus.FillAdjustments(adj, pi, 0.85)
+	if len(adj) != 0 {
+		t.Fatalf("expected no adjustments, got %v", adj)
+	}
+	// Just under the threshold, weights stay where they are.
+	pi[0].UsedBlocks = 83
+	adj = torus.FillAdjustments(map[string]float64{"a": 0.5}, pi, 0.85)
+	if adj["a"] != 0.5 {
+		t.Fatalf("expected a to keep its adjustment, got %v", adj)
+	}
+}
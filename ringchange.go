@@ -0,0 +1,116 @@
+package torus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultRingAckTimeout is how long ChangeRing waits for every peer to
+// acknowledge a proposed ring before giving up on it.
+const DefaultRingAckTimeout = time.Minute
+
+// ringAckPoll is how often ChangeRing checks for acknowledgements.
+var ringAckPoll = 250 * time.Millisecond
+
+// ringProposalGrace is how long a proposal made by ChangeRing outlives its
+// wait for acknowledgements, for the commit to finish in.
+const ringProposalGrace = 30 * time.Second
+
+// RingChangeMetadataService is implemented by metadata services that can
+// change the ring in two phases. A ring is first proposed; each peer
+// acknowledges it once it holds it and has finished every request it began
+// against the current ring, and from then on places blocks by both; only
+// then is it committed and becomes the ring everyone places blocks by. Until
+// then, the current ring stays in force.
+type RingChangeMetadataService interface {
+	// ProposeRing stages r, which must follow the current ring, to become
+	// the next one. It fails with ErrRingChangePending if another ring is
+	// already staged. Unless it's committed or aborted first, the proposal
+	// lapses after ttl, so that one whose proposer died doesn't hold up
+	// every later change.
+	ProposeRing(r Ring, ttl time.Duration) error
+	// GetProposedRing returns the staged ring, or nil if there is none.
+	GetProposedRing() (Ring, error)
+	// AckRing records that the peer with the given UUID is ready for the
+	// staged ring of the given version.
+	AckRing(version int, uuid string) error
+	// GetRingAcks returns the UUIDs of the peers that are ready for the
+	// staged ring of the given version.
+	GetRingAcks(version int) ([]string, error)
+	// CommitRing makes the staged ring of the given version the current
+	// one. It fails with ErrNonSequentialRing if the ring has changed since
+	// it was proposed, and ErrNotExist if it is no longer staged.
+	CommitRing(version int) error
+	// AbortRing drops the staged ring of the given version, if it is still
+	// staged.
+	AbortRing(version int) error
+}
+
+// ChangeRing makes r the cluster's ring. Where the metadata service can,
+// it proposes r, waits up to timeout for every live peer to acknowledge it,
+// and commits it; if some don't, the change is abandoned, and an error
+// names them. Otherwise, it sets the ring straight away.
+func ChangeRing(mds MetadataService, r Ring, timeout time.Duration) error {
+	rc, ok := mds.(RingChangeMetadataService)
+	if !ok {
+		return mds.SetRing(r)
+	}
+	err := rc.ProposeRing(r, timeout+ringProposalGrace)
+	if err != nil {
+		return err
+	}
+	v := r.Version()
+	deadline := time.Now().Add(timeout)
+	for {
+		missing, err := missingRingAcks(mds, rc, r)
+		if err != nil {
+			rc.AbortRing(v)
+			return err
+		}
+		if len(missing) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err := rc.AbortRing(v); err != nil {
+				clog.Errorf("couldn't abandon proposed ring %d: %v", v, err)
+			}
+			return fmt.Errorf("peers %s didn't acknowledge ring %d within %s; keeping the current ring", strings.Join(missing, ", "), v, timeout)
+		}
+		time.Sleep(ringAckPoll)
+	}
+	return rc.CommitRing(v)
+}
+
+// missingRingAcks returns the live peers that haven't acknowledged the
+// staged ring r. The caller itself is left out unless it's a member of the
+// current ring or of r, since then it has blocks to place by both.
+func missingRingAcks(mds MetadataService, rc RingChangeMetadataService, r Ring) ([]string, error) {
+	peers, err := mds.GetPeers()
+	if err != nil {
+		return nil, err
+	}
+	current, err := mds.GetRing()
+	if err != nil {
+		return nil, err
+	}
+	acks, err := rc.GetRingAcks(r.Version())
+	if err != nil {
+		return nil, err
+	}
+	acked := PeerList(acks)
+	self := mds.UUID()
+	member := current.Members().Has(self) || r.Members().Has(self)
+	var missing []string
+	for _, p := range peers {
+		if p.UUID == self && !member || p.TimedOut || PeerStale(p, DefaultPeerTimeout) {
+			continue
+		}
+		if !acked.Has(p.UUID) {
+			missing = append(missing, p.UUID)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
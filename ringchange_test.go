@@ -0,0 +1,54 @@
+package torus_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+)
+
+func singleRing(t *testing.T, version int, uuid string) torus.Ring {
+	r, err := ring.CreateRing(&models.Ring{
+		Type:    uint32(ring.Single),
+		Version: uint32(version),
+		Peers:   torus.PeerInfoList{{UUID: uuid, TotalBlocks: 100}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRingProposalLapses(t *testing.T) {
+	mds := temp.NewClient(torus.Config{}, temp.NewServer())
+	if err := mds.SetRing(singleRing(t, 2, "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A proposer that dies leaves its proposal behind until it lapses.
+	next := singleRing(t, 3, "b")
+	if err := mds.ProposeRing(next, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := torus.ChangeRing(mds, next, time.Second); err != torus.ErrRingChangePending {
+		t.Fatalf("expected the proposal to hold up the change, got %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if r, _ := mds.GetProposedRing(); r != nil {
+		t.Fatalf("expected the proposal to have lapsed, got ring %d", r.Version())
+	}
+	if err := torus.ChangeRing(mds, next, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// A caller that is a member of the ring has to acknowledge it too.
+	mds.RegisterPeer(1, &models.PeerInfo{UUID: mds.UUID()})
+	err := torus.ChangeRing(mds, singleRing(t, 4, mds.UUID()), 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), mds.UUID()) {
+		t.Fatalf("expected the change to wait on the caller, got %v", err)
+	}
+}
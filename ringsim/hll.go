@@ -0,0 +1,62 @@
+package ringsim
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/coreos/torus"
+)
+
+const hllPrecision = 14
+
+// HyperLogLog estimates how many different blocks it has been given, to
+// within about 1%, in 16KiB however many there are.
+type HyperLogLog struct {
+	reg [1 << hllPrecision]uint8
+}
+
+// Add counts ref.
+func (h *HyperLogLog) Add(ref torus.BlockRef) {
+	f := fnv.New64a()
+	f.Write(ref.ToBytes())
+	x := mix64(f.Sum64())
+	i := x >> (64 - hllPrecision)
+	rho := uint8(1)
+	for w := x << hllPrecision; w&(1<<63) == 0 && rho <= 64-hllPrecision; w <<= 1 {
+		rho++
+	}
+	if rho > h.reg[i] {
+		h.reg[i] = rho
+	}
+}
+
+// Count returns the estimated number of different blocks added.
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.reg))
+	var sum float64
+	zeros := 0
+	for _, r := range h.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		// Few blocks have been added; linear counting is closer.
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// mix64 spreads the bits of an FNV hash, whose high bits change little
+// between refs that differ only in their index.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,133 @@
+package ringsim
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/coreos/torus"
+)
+
+// Workers is how many goroutines a simulation spreads its blocks across.
+// Where a ring places one block doesn't depend on any other, so simulations
+// speed up with every core.
+var Workers = runtime.NumCPU()
+
+// batchSize is how many blocks of a stream are handed to a worker at once.
+const batchSize = 4096
+
+func workers() int {
+	if Workers < 1 {
+		return 1
+	}
+	return Workers
+}
+
+// errOnce keeps the first of the errors of several goroutines.
+type errOnce struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (e *errOnce) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *errOnce) get() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// parallel hands the blocks of s out in batches to n goroutines, and waits
+// for them to call work on every block. Each worker passes work its own
+// index, so that it can keep what it tallies to itself until they're done.
+func parallel(n int, s Stream, work func(w int, b torus.BlockRef) error) error {
+	var (
+		wg      sync.WaitGroup
+		failed  errOnce
+		batches = make(chan []torus.BlockRef, n)
+	)
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for batch := range batches {
+				if failed.get() != nil {
+					continue
+				}
+				for _, b := range batch {
+					if err := work(w, b); err != nil {
+						failed.set(err)
+						break
+					}
+				}
+			}
+		}(w)
+	}
+	batch := make([]torus.BlockRef, 0, batchSize)
+	err := s(func(b torus.BlockRef) error {
+		batch = append(batch, b)
+		if len(batch) < batchSize {
+			return nil
+		}
+		if err := failed.get(); err != nil {
+			return err
+		}
+		batches <- batch
+		batch = make([]torus.BlockRef, 0, batchSize)
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return failed.get()
+}
+
+// run calls f from n goroutines, each with its own index, and waits for
+// them.
+func run(n int, f func(w int) error) error {
+	var (
+		wg     sync.WaitGroup
+		failed errOnce
+	)
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			if err := f(w); err != nil {
+				failed.set(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return failed.get()
+}
+
+func (s *Stats) add(o Stats) {
+	s.BlocksKept += o.BlocksKept
+	s.BlocksSent += o.BlocksSent
+	for p, n := range o.Sent {
+		s.Sent[p] += n
+	}
+	for p, n := range o.Received {
+		s.Received[p] += n
+	}
+	for f, n := range o.Flows {
+		s.Flows[f] += n
+	}
+}
+
+func (c Counts) add(o Counts) {
+	for p, n := range o {
+		c[p] += n
+	}
+}
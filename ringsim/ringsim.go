@@ -0,0 +1,254 @@
+// Package ringsim simulates how blocks are placed by a ring and what a change
+// of ring costs, without touching a cluster. It backs ringtool and
+// `torusctl ring preview`, and its exported API is kept stable so that other
+// tools can embed the simulator rather than run ringtool and parse its
+// output.
+//
+// The blocks simulated are either a Cluster, which holds every block on each
+// peer, or a Stream, of which only counts are kept. A Generator makes up
+// streams of blocks the way real workloads write them, and a Topology says
+// how long moving them between racks takes.
+package ringsim
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+// Cluster is which blocks each peer holds.
+type Cluster map[string][]torus.BlockRef
+
+// Stats is what moving a cluster from one ring to another costs.
+type Stats struct {
+	BlocksKept uint64
+	BlocksSent uint64
+	// Sent and Received are the number of blocks each peer sends and
+	// receives.
+	Sent     map[string]uint64
+	Received map[string]uint64
+	// Flows is the number of blocks each peer sends each other peer.
+	Flows map[Flow]uint64
+}
+
+// Flow is blocks sent from one peer to another.
+type Flow struct {
+	From, To string
+}
+
+// Assign places blocks on the replicas r chooses for them.
+func Assign(blocks []torus.BlockRef, r torus.Ring) (Cluster, error) {
+	n := workers()
+	parts := make([]Cluster, n)
+	err := run(n, func(w int) error {
+		part := make(Cluster)
+		from, to := len(blocks)*w/n, len(blocks)*(w+1)/n
+		for _, b := range blocks[from:to] {
+			peers, err := replicas(r, b)
+			if err != nil {
+				return fmt.Errorf("error in the ring: %s", err)
+			}
+			for _, p := range peers {
+				part[p] = append(part[p], b)
+			}
+		}
+		parts[w] = part
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(r, parts), nil
+}
+
+// merge joins the clusters each worker built, in order, into one holding
+// every member of r.
+func merge(r torus.Ring, parts []Cluster) Cluster {
+	out := make(Cluster)
+	for _, p := range r.Members() {
+		out[p] = make([]torus.BlockRef, 0)
+	}
+	for _, part := range parts {
+		for p, l := range part {
+			out[p] = append(out[p], l...)
+		}
+	}
+	return out
+}
+
+// Rebalance moves the cluster from oldRing to newRing the way the rebalancer
+// does, where each old replica of a block sends it to at most one of the new
+// ones, and returns where the blocks end up.
+func (c Cluster) Rebalance(oldRing, newRing torus.Ring) (Cluster, Stats, error) {
+	n := workers()
+	parts := make([]Cluster, n)
+	partStats := make([]Stats, n)
+	// Each worker takes its share of every peer's blocks.
+	err := run(n, func(w int) error {
+		parts[w], partStats[w] = make(Cluster), newStats()
+		part, stats := parts[w], &partStats[w]
+		for p, l := range c {
+			from, to := len(l)*w/n, len(l)*(w+1)/n
+			for _, ref := range l[from:to] {
+				newpeers, err := replicas(newRing, ref)
+				if err != nil {
+					return fmt.Errorf("error in the new ring: %s", err)
+				}
+				oldpeers, err := replicas(oldRing, ref)
+				if err != nil {
+					return fmt.Errorf("error in the old ring: %s", err)
+				}
+				kept, dests := moves(p, oldpeers, newpeers)
+				if kept {
+					part[p] = append(part[p], ref)
+					stats.BlocksKept++
+				}
+				for _, q := range dests {
+					part[q] = append(part[q], ref)
+					stats.send(p, q)
+				}
+			}
+		}
+		return nil
+	})
+	stats := newStats()
+	if err != nil {
+		return nil, stats, err
+	}
+	for _, s := range partStats {
+		stats.add(s)
+	}
+	return merge(newRing, parts), stats, nil
+}
+
+func newStats() Stats {
+	return Stats{
+		Sent:     make(map[string]uint64),
+		Received: make(map[string]uint64),
+		Flows:    make(map[Flow]uint64),
+	}
+}
+
+func (s *Stats) send(from, to string) {
+	s.BlocksSent++
+	s.Sent[from]++
+	s.Received[to]++
+	s.Flows[Flow{from, to}]++
+}
+
+func replicas(r torus.Ring, ref torus.BlockRef) (torus.PeerList, error) {
+	p, err := r.GetPeers(ref)
+	if err != nil {
+		return nil, err
+	}
+	return p.Peers[:p.Replication], nil
+}
+
+// moves returns whether p, one of a block's old replicas, keeps the block,
+// and which of its new replicas p sends it to.
+func moves(p string, oldpeers, newpeers torus.PeerList) (bool, torus.PeerList) {
+	kept := newpeers.Has(p)
+	myIndex := oldpeers.IndexAt(p)
+	diffpeers := newpeers.AndNot(oldpeers)
+	if myIndex >= len(diffpeers) {
+		// downsizing
+		return kept, nil
+	}
+	if myIndex == len(oldpeers)-1 && len(diffpeers) > len(oldpeers) {
+		return kept, diffpeers[myIndex:]
+	}
+	return kept, diffpeers[myIndex : myIndex+1]
+}
+
+// Duration estimates how long the move takes if every peer can send and
+// receive bw bytes per second. Peers move data in parallel, so it is bound by
+// the busiest one.
+func (s Stats) Duration(blockSize, bw uint64) time.Duration {
+	var busiest uint64
+	for _, n := range s.Sent {
+		if n > busiest {
+			busiest = n
+		}
+	}
+	for _, n := range s.Received {
+		if n > busiest {
+			busiest = n
+		}
+	}
+	if bw == 0 {
+		return 0
+	}
+	return time.Duration(float64(busiest*blockSize) / float64(bw) * float64(time.Second))
+}
+
+// Topology is how peers are connected. Each peer has a link of IntraRack
+// bytes per second to the peers in its rack, and a share of InterRack bytes
+// per second of its rack's uplink to the others, which is usually less when
+// the uplink is oversubscribed.
+type Topology struct {
+	// Racks is the rack of each peer. Peers that aren't in it share one rack.
+	Racks     map[string]string
+	IntraRack uint64
+	InterRack uint64
+}
+
+// CrossRack returns whether blocks sent along f cross between racks.
+func (t Topology) CrossRack(f Flow) bool {
+	return t.Racks[f.From] != t.Racks[f.To]
+}
+
+// CrossRack returns how many of the blocks sent stay within a rack, and how
+// many cross between racks.
+func (s Stats) CrossRack(t Topology) (intra, inter uint64) {
+	for f, n := range s.Flows {
+		if t.CrossRack(f) {
+			inter += n
+		} else {
+			intra += n
+		}
+	}
+	return intra, inter
+}
+
+// TopologyDuration estimates how long the move takes on t. Each peer is
+// bound by whichever is slower: all it sends or receives over its own link,
+// or what of that crosses racks over its share of the uplink. Peers move data
+// in parallel, so the move is bound by the slowest one.
+func (s Stats) TopologyDuration(blockSize uint64, t Topology) time.Duration {
+	if t.IntraRack == 0 || t.InterRack == 0 {
+		return 0
+	}
+	type load struct{ all, cross uint64 }
+	sent := make(map[string]*load)
+	recv := make(map[string]*load)
+	get := func(m map[string]*load, p string) *load {
+		l, ok := m[p]
+		if !ok {
+			l = &load{}
+			m[p] = l
+		}
+		return l
+	}
+	for f, n := range s.Flows {
+		from, to := get(sent, f.From), get(recv, f.To)
+		from.all += n
+		to.all += n
+		if t.CrossRack(f) {
+			from.cross += n
+			to.cross += n
+		}
+	}
+	var longest float64
+	for _, m := range []map[string]*load{sent, recv} {
+		for _, l := range m {
+			secs := math.Max(
+				float64(l.all*blockSize)/float64(t.IntraRack),
+				float64(l.cross*blockSize)/float64(t.InterRack),
+			)
+			longest = math.Max(longest, secs)
+		}
+	}
+	return time.Duration(longest * float64(time.Second))
+}
@@ -0,0 +1,240 @@
+package ringsim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/models"
+	"github.com/coreos/torus/ring"
+)
+
+func TestRebalanceAddPeer(t *testing.T) {
+	var peers torus.PeerInfoList
+	for _, uuid := range []string{"a", "b", "c", "d"} {
+		peers = append(peers, &models.PeerInfo{
+			UUID:        uuid,
+			TotalBlocks: 1000,
+		})
+	}
+	r1, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Ketama),
+		Version:           1,
+		ReplicationFactor: 2,
+		Peers:             peers[:3],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := r1.(torus.RingAdder).AddPeers(peers[3:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []torus.BlockRef
+	for i := 1; i <= 500; i++ {
+		blocks = append(blocks, torus.BlockRef{
+			INodeRef: torus.NewINodeRef(1, 1),
+			Index:    torus.IndexID(i),
+		})
+	}
+	c, err := Assign(blocks, r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, same, err := c.Rebalance(r1, r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.BlocksSent != 0 || same.BlocksKept != 1000 {
+		t.Fatalf("expected an unchanged ring to keep everything, got %+v", same)
+	}
+
+	after, stats, err := c.Rebalance(r1, r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.BlocksSent == 0 {
+		t.Fatal("expected blocks to move to the new peer")
+	}
+	if stats.Received["d"] != stats.BlocksSent || uint64(len(after["d"])) != stats.BlocksSent {
+		t.Fatalf("expected only the new peer to receive blocks, got %v", stats.Received)
+	}
+	var busiest uint64
+	for _, n := range stats.Sent {
+		if n > busiest {
+			busiest = n
+		}
+	}
+	if stats.Received["d"] > busiest {
+		busiest = stats.Received["d"]
+	}
+	want := time.Duration(busiest) * time.Second
+	if d := stats.Duration(1024, 1024); d != want {
+		t.Fatalf("expected %s to move the data, got %s", want, d)
+	}
+}
+
+func TestTopologyDuration(t *testing.T) {
+	s := Stats{
+		Flows: map[Flow]uint64{
+			{"a", "b"}: 100,
+			{"a", "c"}: 50,
+		},
+	}
+	topo := Topology{
+		Racks:     map[string]string{"a": "r1", "b": "r1", "c": "r2"},
+		IntraRack: 100,
+		InterRack: 10,
+	}
+	intra, inter := s.CrossRack(topo)
+	if intra != 100 || inter != 50 {
+		t.Fatalf("expected 100 blocks within racks and 50 across, got %d and %d", intra, inter)
+	}
+	if d := s.TopologyDuration(1, topo); d != 5*time.Second {
+		t.Fatalf("expected the uplink to take 5s, got %s", d)
+	}
+	topo.InterRack = 100
+	if d := s.TopologyDuration(1, topo); d != 1500*time.Millisecond {
+		t.Fatalf("expected a's link to take 1.5s, got %s", d)
+	}
+}
+
+func TestRebalanceCounts(t *testing.T) {
+	var peers torus.PeerInfoList
+	for _, uuid := range []string{"a", "b", "c", "d", "e"} {
+		peers = append(peers, &models.PeerInfo{
+			UUID:        uuid,
+			TotalBlocks: 1000,
+		})
+	}
+	r1, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Ketama),
+		Version:           1,
+		ReplicationFactor: 2,
+		Peers:             peers[:4],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := r1.(torus.RingAdder).AddPeers(peers[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err = r2.(torus.ModifyableRing).ChangeReplication(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []torus.BlockRef
+	for i := 1; i <= 500; i++ {
+		blocks = append(blocks, torus.BlockRef{
+			INodeRef: torus.NewINodeRef(1, torus.INodeID(i%7+1)),
+			Index:    torus.IndexID(i),
+		})
+	}
+	c, err := Assign(blocks, r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := SliceStream(blocks)
+	counts, err := AssignCounts(s, r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counts, c.Counts()) {
+		t.Fatalf("expected streamed counts %v to match %v", counts, c.Counts())
+	}
+	after, stats, err := c.Rebalance(r1, r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterCounts, streamed, err := RebalanceCounts(s, r1, r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(afterCounts, after.Counts()) {
+		t.Fatalf("expected streamed counts %v to match %v", afterCounts, after.Counts())
+	}
+	if !reflect.DeepEqual(streamed, stats) {
+		t.Fatalf("expected streamed stats %+v to match %+v", streamed, stats)
+	}
+	if afterCounts.Total() != 1500 {
+		t.Fatalf("expected 3 replicas of 500 blocks, got %d", afterCounts.Total())
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	var h HyperLogLog
+	for pass := 0; pass < 2; pass++ {
+		for i := 1; i <= 100000; i++ {
+			h.Add(torus.BlockRef{
+				INodeRef: torus.NewINodeRef(torus.VolumeID(i%3+1), torus.INodeID(i/1000+1)),
+				Index:    torus.IndexID(i),
+			})
+		}
+	}
+	n := h.Count()
+	if n < 97000 || n > 103000 {
+		t.Fatalf("expected about 100000 different blocks, estimated %d", n)
+	}
+}
+
+func TestParallelMatchesSerial(t *testing.T) {
+	defer func(n int) { Workers = n }(Workers)
+	var peers torus.PeerInfoList
+	for _, uuid := range []string{"a", "b", "c", "d"} {
+		peers = append(peers, &models.PeerInfo{
+			UUID:        uuid,
+			TotalBlocks: 100000,
+		})
+	}
+	r1, err := ring.CreateRing(&models.Ring{
+		Type:              uint32(ring.Ketama),
+		Version:           1,
+		ReplicationFactor: 2,
+		Peers:             peers[:3],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := r1.(torus.RingAdder).AddPeers(peers[3:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []torus.BlockRef
+	for i := 1; i <= 3*batchSize+17; i++ {
+		blocks = append(blocks, torus.BlockRef{
+			INodeRef: torus.NewINodeRef(1, 1),
+			Index:    torus.IndexID(i),
+		})
+	}
+	simulate := func() (Counts, Stats, Counts, Stats) {
+		c, err := Assign(blocks, r1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, stats, err := c.Rebalance(r1, r2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts, streamed, err := RebalanceCounts(SliceStream(blocks), r1, r2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return after.Counts(), stats, counts, streamed
+	}
+	Workers = 1
+	c1, s1, sc1, ss1 := simulate()
+	Workers = 4
+	c4, s4, sc4, ss4 := simulate()
+	if !reflect.DeepEqual(c1, c4) || !reflect.DeepEqual(s1, s4) {
+		t.Fatalf("expected 4 workers to rebalance like 1, got %v and %v", c4, c1)
+	}
+	if !reflect.DeepEqual(sc1, sc4) || !reflect.DeepEqual(ss1, ss4) {
+		t.Fatalf("expected 4 workers to rebalance a stream like 1, got %v and %v", sc4, sc1)
+	}
+	if !reflect.DeepEqual(c1, sc4) {
+		t.Fatalf("expected a stream to rebalance like a cluster, got %v and %v", sc4, c1)
+	}
+}
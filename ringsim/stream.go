@@ -0,0 +1,136 @@
+package ringsim
+
+import (
+	"fmt"
+
+	"github.com/coreos/torus"
+)
+
+// Stream calls emit with each of a set of blocks, in the same order every
+// time it's called, and stops at the first error emit returns. Simulating a
+// stream rather than a Cluster only keeps counts of blocks in memory, so
+// clusters of any size can be simulated, at the cost of generating or
+// reading the blocks again for each pass.
+type Stream func(emit func(torus.BlockRef) error) error
+
+// SliceStream returns a Stream of blocks.
+func SliceStream(blocks []torus.BlockRef) Stream {
+	return func(emit func(torus.BlockRef) error) error {
+		for _, b := range blocks {
+			if err := emit(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Concat returns a Stream of the blocks of each of streams in turn.
+func Concat(streams ...Stream) Stream {
+	return func(emit func(torus.BlockRef) error) error {
+		for _, s := range streams {
+			if err := s(emit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Counts is how many blocks each peer holds.
+type Counts map[string]uint64
+
+// Counts returns how many blocks each peer of the cluster holds.
+func (c Cluster) Counts() Counts {
+	out := make(Counts)
+	for p, l := range c {
+		out[p] = uint64(len(l))
+	}
+	return out
+}
+
+// Total returns how many blocks all the peers hold between them.
+func (c Counts) Total() uint64 {
+	var n uint64
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// AssignCounts counts the blocks of s that r places on each peer.
+func AssignCounts(s Stream, r torus.Ring) (Counts, error) {
+	n := workers()
+	parts := make([]Counts, n)
+	for w := range parts {
+		parts[w] = make(Counts)
+	}
+	err := parallel(n, s, func(w int, b torus.BlockRef) error {
+		peers, err := replicas(r, b)
+		if err != nil {
+			return fmt.Errorf("error in the ring: %s", err)
+		}
+		for _, p := range peers {
+			parts[w][p]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make(Counts)
+	for _, p := range r.Members() {
+		out[p] = 0
+	}
+	for _, part := range parts {
+		out.add(part)
+	}
+	return out, nil
+}
+
+// RebalanceCounts is Rebalance for the blocks of s, as placed by oldRing. It
+// returns how many blocks each peer ends up with.
+func RebalanceCounts(s Stream, oldRing, newRing torus.Ring) (Counts, Stats, error) {
+	n := workers()
+	parts := make([]Counts, n)
+	partStats := make([]Stats, n)
+	for w := range parts {
+		parts[w], partStats[w] = make(Counts), newStats()
+	}
+	err := parallel(n, s, func(w int, ref torus.BlockRef) error {
+		newpeers, err := replicas(newRing, ref)
+		if err != nil {
+			return fmt.Errorf("error in the new ring: %s", err)
+		}
+		oldpeers, err := replicas(oldRing, ref)
+		if err != nil {
+			return fmt.Errorf("error in the old ring: %s", err)
+		}
+		out, stats := parts[w], &partStats[w]
+		for _, p := range oldpeers {
+			kept, to := moves(p, oldpeers, newpeers)
+			if kept {
+				out[p]++
+				stats.BlocksKept++
+			}
+			for _, q := range to {
+				out[q]++
+				stats.send(p, q)
+			}
+		}
+		return nil
+	})
+	stats := newStats()
+	if err != nil {
+		return nil, stats, err
+	}
+	out := make(Counts)
+	for _, p := range newRing.Members() {
+		out[p] = 0
+	}
+	for w := range parts {
+		out.add(parts[w])
+		stats.add(partStats[w])
+	}
+	return out, stats, nil
+}
@@ -0,0 +1,303 @@
+package ringsim
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/coreos/torus"
+)
+
+// A workload writes the blocks a kind of deployment leaves behind to a sink,
+// as the refs of the latest write to each block, which is what the ring
+// places. It stops once the sink is full.
+type workload func(g *Generator, s *sink)
+
+var workloads = map[string]workload{
+	"vm-images":     vmImages,
+	"oltp":          oltp,
+	"backup-stream": backupStream,
+	"mixed":         mixed,
+}
+
+// Workloads returns the names of the workloads a Generator can write.
+func Workloads() []string {
+	var out []string
+	for name := range workloads {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sink passes the blocks a workload writes on to emit, until it has had as
+// many as it wants or emit fails.
+type sink struct {
+	emit func(torus.BlockRef) error
+	left int
+	err  error
+}
+
+func (s *sink) full() bool {
+	return s.left <= 0 || s.err != nil
+}
+
+func (s *sink) put(b torus.BlockRef) {
+	if s.full() {
+		return
+	}
+	s.err = s.emit(b)
+	s.left--
+}
+
+// part has w write n of the blocks s wants.
+func (s *sink) part(g *Generator, w workload, n int) {
+	if n > s.left {
+		n = s.left
+	}
+	sub := &sink{emit: s.emit, left: n}
+	w(g, sub)
+	s.left -= n - sub.left
+	if sub.err != nil {
+		s.err = sub.err
+	}
+}
+
+// Generator writes blocks the way a workload does, as the refs of the
+// latest write to each block that a volume of the kind would end up with.
+// It hands out volume and INode IDs, so that every volume and file it writes
+// is distinct. The workloads are:
+//
+// vm-images: VM disks imported from images, then overwritten over and over
+// in a few hot regions.
+//
+// oltp: database volumes written sparsely at random, mostly to hot pages,
+// each with a write-ahead log appended to in small commits.
+//
+// backup-stream: large files streamed once and never rewritten.
+//
+// mixed: all three sharing one cluster.
+type Generator struct {
+	rnd       *rand.Rand
+	w         workload
+	blockSize uint64
+	vol       torus.VolumeID
+	inode     torus.INodeID
+	// backups is the volume backup streams are written to, once there is one.
+	backups torus.VolumeID
+}
+
+// NewGenerator returns a Generator of the named workload, for volumes of
+// blocks of blockSize bytes, whose choices all come from rnd.
+func NewGenerator(rnd *rand.Rand, name string, blockSize uint64) (*Generator, error) {
+	w, ok := workloads[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown workload %q (try one of %s)", name, strings.Join(Workloads(), ", "))
+	}
+	if blockSize == 0 {
+		return nil, errors.New("invalid block size 0")
+	}
+	return &Generator{rnd: rnd, w: w, blockSize: blockSize}, nil
+}
+
+// Stream returns a Stream of n more blocks written by the workload. The
+// blocks are never all in memory: each time the stream is replayed, they're
+// written afresh from the same seed and IDs, so they come out the same.
+func (g *Generator) Stream(n int) Stream {
+	seed := g.rnd.Int63()
+	start := *g
+	replay := func(emit func(torus.BlockRef) error) (*Generator, error) {
+		r := start
+		r.rnd = rand.New(rand.NewSource(seed))
+		s := &sink{emit: emit, left: n}
+		r.w(&r, s)
+		return &r, s.err
+	}
+	// Move on past the IDs the stream uses, for whatever is written next.
+	end, _ := replay(func(torus.BlockRef) error { return nil })
+	g.vol, g.inode, g.backups = end.vol, end.inode, end.backups
+	return func(emit func(torus.BlockRef) error) error {
+		_, err := replay(emit)
+		return err
+	}
+}
+
+// Blocks returns n more blocks written by the workload.
+func (g *Generator) Blocks(n int) []torus.BlockRef {
+	out := make([]torus.BlockRef, 0, n)
+	g.Stream(n)(func(b torus.BlockRef) error {
+		out = append(out, b)
+		return nil
+	})
+	return out
+}
+
+// After makes the generator write volumes other than those of blocks, such
+// as those of a real cluster that the workload is added to.
+func (g *Generator) After(blocks []torus.BlockRef) {
+	for _, b := range blocks {
+		if b.Volume() > g.vol {
+			g.vol = b.Volume()
+		}
+	}
+}
+
+// volumeBlocks returns how many blocks a volume of size bytes has.
+func (g *Generator) volumeBlocks(size uint64) int {
+	n := int(size / g.blockSize)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// simVolume is a block volume being written. Like a block volume's
+// blockset, every write gets a new index under the INode being written, and
+// each sync starts a new INode.
+type simVolume struct {
+	vol    torus.VolumeID
+	inode  torus.INodeID
+	ids    torus.IndexID
+	blocks []torus.BlockRef
+}
+
+func (g *Generator) newVolume(nblocks int) *simVolume {
+	g.vol++
+	return &simVolume{
+		vol:    g.vol,
+		inode:  1,
+		blocks: make([]torus.BlockRef, nblocks),
+	}
+}
+
+func (v *simVolume) write(i int) {
+	v.ids++
+	v.blocks[i] = torus.BlockRef{
+		INodeRef: torus.NewINodeRef(v.vol, v.inode),
+		Index:    v.ids,
+	}
+}
+
+func (v *simVolume) sync() {
+	v.inode++
+}
+
+// flush puts the blocks of the volume that have been written.
+func (v *simVolume) flush(s *sink) {
+	for _, b := range v.blocks {
+		if !b.IsZero() {
+			s.put(b)
+		}
+	}
+}
+
+// vmImages is VM disks: each is imported from an image in one pass, then
+// overwritten again and again in a few hot regions, such as the guest's
+// logs and swap.
+func vmImages(g *Generator, s *sink) {
+	for !s.full() {
+		size := g.volumeBlocks(uint64(10+g.rnd.Intn(90)) << 30)
+		if size > s.left {
+			size = s.left
+		}
+		v := g.newVolume(size)
+		for i := range v.blocks {
+			v.write(i)
+			if i%256 == 255 {
+				v.sync()
+			}
+		}
+		v.sync()
+		hot := make([]int, 1+g.rnd.Intn(4))
+		hotSize := size/20 + 1
+		for i := range hot {
+			hot[i] = g.rnd.Intn(size)
+		}
+		for w := 0; w < size/2; w++ {
+			var i int
+			if g.rnd.Float64() < 0.9 {
+				i = (hot[g.rnd.Intn(len(hot))] + g.rnd.Intn(hotSize)) % size
+			} else {
+				i = g.rnd.Intn(size)
+			}
+			v.write(i)
+			if w%64 == 63 {
+				v.sync()
+			}
+		}
+		v.flush(s)
+	}
+}
+
+// oltp is databases: a data volume written sparsely at random, skewed
+// towards hot pages, next to a write-ahead log that's appended to in small
+// commits and wraps around.
+func oltp(g *Generator, s *sink) {
+	for !s.full() {
+		// The data volume is thin; about half of it gets written.
+		size := g.volumeBlocks(uint64(50+g.rnd.Intn(450)) << 30)
+		if size > 2*s.left {
+			size = 2 * s.left
+		}
+		data := g.newVolume(size)
+		zipf := rand.NewZipf(g.rnd, 1.1, 1, uint64(size-1))
+		// Hot pages are scattered, not at the start of the volume.
+		perm := g.rnd.Perm(size)
+		for w := 0; w < size; w++ {
+			if g.rnd.Float64() < 0.5 {
+				data.write(perm[zipf.Uint64()])
+			} else {
+				data.write(g.rnd.Intn(size))
+			}
+			if w%16 == 15 {
+				data.sync()
+			}
+		}
+		data.flush(s)
+
+		logSize := size/10 + 1
+		if logSize > s.left {
+			logSize = s.left
+		}
+		if logSize <= 0 {
+			break
+		}
+		wal := g.newVolume(logSize)
+		for w := 0; w < 3*logSize; w++ {
+			wal.write(w % logSize)
+			if g.rnd.Intn(4) == 0 {
+				wal.sync()
+			}
+		}
+		wal.flush(s)
+	}
+}
+
+// backupStream is backups: big files streamed once, front to back, and
+// never rewritten.
+func backupStream(g *Generator, s *sink) {
+	if g.backups == 0 {
+		g.vol++
+		g.backups = g.vol
+	}
+	for !s.full() {
+		size := g.volumeBlocks(uint64(1+g.rnd.Intn(200)) << 30)
+		g.inode++
+		for x := 1; x <= size && !s.full(); x++ {
+			s.put(torus.BlockRef{
+				INodeRef: torus.NewINodeRef(g.backups, g.inode),
+				Index:    torus.IndexID(x),
+			})
+		}
+	}
+}
+
+// mixed is a cluster shared by all of the above.
+func mixed(g *Generator, s *sink) {
+	n := s.left
+	s.part(g, vmImages, n*4/10)
+	s.part(g, oltp, n*3/10)
+	backupStream(g, s)
+}
@@ -0,0 +1,45 @@
+package ringsim
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+func TestGenerator(t *testing.T) {
+	for _, name := range Workloads() {
+		g, err := NewGenerator(rand.New(rand.NewSource(1)), name, 1<<30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := g.Stream(5000)
+		var first []torus.BlockRef
+		s(func(b torus.BlockRef) error {
+			first = append(first, b)
+			return nil
+		})
+		if len(first) != 5000 {
+			t.Fatalf("%s: expected 5000 blocks, got %d", name, len(first))
+		}
+		var again []torus.BlockRef
+		s(func(b torus.BlockRef) error {
+			again = append(again, b)
+			return nil
+		})
+		if !reflect.DeepEqual(first, again) {
+			t.Fatalf("%s: expected a replayed stream to give the same blocks", name)
+		}
+		seen := make(map[torus.BlockRef]bool)
+		for _, b := range append(first, g.Blocks(5000)...) {
+			if seen[b] {
+				t.Fatalf("%s: block %s written twice", name, b)
+			}
+			seen[b] = true
+		}
+	}
+	if _, err := NewGenerator(rand.New(rand.NewSource(1)), "nope", 1<<30); err == nil {
+		t.Fatal("expected an unknown workload to fail")
+	}
+}
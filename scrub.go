@@ -0,0 +1,64 @@
+package torus
+
+import "golang.org/x/net/context"
+
+// BlockVerifier is implemented by block stores that keep a checksum of every
+// block they hold, and so can tell when a block has rotted on disk.
+type BlockVerifier interface {
+	// VerifyBlock returns ErrBlockCorrupt if the stored block no longer
+	// matches the checksum taken when it was written.
+	VerifyBlock(ctx context.Context, ref BlockRef) error
+}
+
+// ScrubControl is set by the operator to steer the scrubbers on every peer.
+type ScrubControl struct {
+	Paused bool `json:"paused"`
+	// Requested is when a new pass was last asked for, in Unix nanoseconds.
+	// Peers whose current pass started earlier start over.
+	Requested int64 `json:"requested"`
+}
+
+// ScrubStatus is the progress of a peer's scrubber.
+type ScrubStatus struct {
+	Peer   string `json:"peer"`
+	Paused bool   `json:"paused"`
+	// Scrubbing is set while a pass is underway.
+	Scrubbing bool `json:"scrubbing"`
+	// PassStart is when the current or last pass started, in Unix
+	// nanoseconds.
+	PassStart int64 `json:"pass_start"`
+	// PassFinish is when the last complete pass finished, in Unix
+	// nanoseconds.
+	PassFinish int64  `json:"pass_finish"`
+	Checked    uint64 `json:"checked"`
+	Total      uint64 `json:"total"`
+	// Corrupt and Repaired count blocks since the peer started.
+	Corrupt  uint64 `json:"corrupt"`
+	Repaired uint64 `json:"repaired"`
+}
+
+// CorruptBlock is a block a scrubber found not to match its checksum.
+type CorruptBlock struct {
+	Peer string
+	Ref  BlockRef
+	// Found is when the block was found, in Unix nanoseconds.
+	Found int64
+	// Repaired is set if the block was replaced with a copy from another
+	// replica.
+	Repaired bool
+}
+
+// ScrubMetadataService is implemented by metadata services that can
+// coordinate scrubbing across the cluster.
+type ScrubMetadataService interface {
+	GetScrubControl() (ScrubControl, error)
+	SetScrubControl(ScrubControl) error
+
+	// SetScrubStatus updates this peer's status. It is tied to lease so that
+	// it vanishes with the peer.
+	SetScrubStatus(lease int64, s *ScrubStatus) error
+	GetScrubStatuses() ([]*ScrubStatus, error)
+
+	ReportCorruptBlock(b CorruptBlock) error
+	GetCorruptBlocks() ([]CorruptBlock, error)
+}
@@ -24,6 +24,9 @@ func init() {
 const (
 	CtxWriteLevel int = iota
 	CtxReadLevel
+	CtxWriteEpoch
+	CtxIOClass
+	CtxIdentity
 )
 
 // Server is the type representing the generic distributed block store.
@@ -43,8 +46,12 @@ type Server struct {
 	leaseMut sync.RWMutex
 
 	heartbeating     bool
+	heartbeatChan    chan interface{}
+	heartbeatDone    chan struct{}
 	ReplicationOpen  bool
 	timeoutCallbacks []func(string)
+
+	quotas tenantQuotas
 }
 
 func (s *Server) createOrRenewLease(ctx context.Context) error {
@@ -106,10 +113,11 @@ func (s *Server) getContext() context.Context {
 	return s.ctx
 }
 
+// ExtendContext returns ctx for requests made by the server. It leaves the
+// read and write levels unset, so that the distributor applies a volume's
+// consistency ahead of the client's own levels.
 func (s *Server) ExtendContext(ctx context.Context) context.Context {
-	wl := context.WithValue(ctx, CtxWriteLevel, s.Cfg.WriteLevel)
-	rl := context.WithValue(wl, CtxReadLevel, s.Cfg.ReadLevel)
-	return rl
+	return ctx
 }
 
 func (s *Server) GetPeerMap() map[string]*models.PeerInfo {
@@ -121,3 +129,11 @@ func (s *Server) GetPeerMap() map[string]*models.PeerInfo {
 	}
 	return out
 }
+
+// GetPeer returns what the server last heard about the peer with the given
+// UUID, or nil if it has never heard of it.
+func (s *Server) GetPeer(uuid string) *models.PeerInfo {
+	s.infoMut.Lock()
+	defer s.infoMut.Unlock()
+	return s.peersMap[uuid]
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
 
 	"golang.org/x/net/context"
 
@@ -30,6 +34,9 @@ type (
 const (
 	TypeBlock BlockType = iota
 	TypeINode
+	// TypeShard blocks are data or parity shards of an erasure coded
+	// stripe. See ShardRef.
+	TypeShard
 )
 
 const (
@@ -137,8 +144,66 @@ func BlockRefFromBytes(b []byte) BlockRef {
 	return ref
 }
 
+// String returns the ref as "VOLUME:INODE:INDEX", in decimal, as
+// ParseBlockRef reads it, followed by "/inode" or "/shard" for those types of
+// block.
 func (b BlockRef) String() string {
-	return fmt.Sprintf("br %x : %x : %x", b.volume, b.INode, b.Index)
+	s := fmt.Sprintf("%d:%d:%d", b.Volume(), b.INode, b.Index)
+	switch t := b.BlockType(); t {
+	case TypeBlock:
+		return s
+	case TypeINode:
+		return s + "/inode"
+	case TypeShard:
+		return s + "/shard"
+	default:
+		return fmt.Sprintf("%s/type%d", s, t)
+	}
+}
+
+// ParseBlockRef parses a ref written by BlockRef.String.
+func ParseBlockRef(s string) (BlockRef, error) {
+	bad := fmt.Errorf("invalid block ref %q; expected VOLUME:INODE:INDEX", s)
+	var ref BlockRef
+	t := TypeBlock
+	if i := strings.LastIndex(s, "/"); i != -1 {
+		switch suffix := s[i+1:]; {
+		case suffix == "inode":
+			t = TypeINode
+		case suffix == "shard":
+			t = TypeShard
+		case strings.HasPrefix(suffix, "type"):
+			n, err := strconv.ParseUint(suffix[len("type"):], 10, 16)
+			if err != nil {
+				return ref, bad
+			}
+			t = BlockType(n)
+		default:
+			return ref, bad
+		}
+		s = s[:i]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return ref, bad
+	}
+	var nums [3]uint64
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return ref, bad
+		}
+		nums[i] = n
+	}
+	if nums[0] >= VolumeMax {
+		return ref, bad
+	}
+	ref = BlockRef{
+		INodeRef: NewINodeRef(VolumeID(nums[0]), INodeID(nums[1])),
+		Index:    IndexID(nums[2]),
+	}
+	ref.SetBlockType(t)
+	return ref, nil
 }
 
 func (b BlockRef) ToProto() *models.BlockRef {
@@ -197,6 +262,9 @@ const (
 	WriteAll WriteLevel = iota
 	WriteOne
 	WriteLocal
+	// WriteQuorum writes to every replica at once and returns once most of
+	// them have the block.
+	WriteQuorum
 )
 
 func ParseWriteLevel(s string) (wl WriteLevel, err error) {
@@ -207,16 +275,36 @@ func ParseWriteLevel(s string) (wl WriteLevel, err error) {
 		wl = WriteOne
 	case "local":
 		wl = WriteLocal
+	case "quorum":
+		wl = WriteQuorum
 	default:
-		err = errors.New("invalid writelevel; use one of 'one', 'all', or 'local'")
+		err = errors.New("invalid writelevel; use one of 'one', 'all', 'quorum' or 'local'")
 	}
 	return
 }
 
+func (wl WriteLevel) String() string {
+	switch wl {
+	case WriteAll:
+		return "all"
+	case WriteOne:
+		return "one"
+	case WriteLocal:
+		return "local"
+	case WriteQuorum:
+		return "quorum"
+	}
+	return fmt.Sprintf("WriteLevel(%d)", int(wl))
+}
+
 const (
 	ReadBlock ReadLevel = iota
 	ReadSequential
 	ReadSpread
+	ReadHedged
+	// ReadQuorum reads from every replica at once and returns the copy most
+	// of them agree on.
+	ReadQuorum
 )
 
 func ParseReadLevel(s string) (rl ReadLevel, err error) {
@@ -227,12 +315,32 @@ func ParseReadLevel(s string) (rl ReadLevel, err error) {
 		rl = ReadSequential
 	case "block":
 		rl = ReadBlock
+	case "hedge":
+		rl = ReadHedged
+	case "quorum":
+		rl = ReadQuorum
 	default:
-		err = errors.New("invalid readlevel; use one of 'spread', 'seq', or 'block'")
+		err = errors.New("invalid readlevel; use one of 'spread', 'seq', 'block', 'hedge' or 'quorum'")
 	}
 	return
 }
 
+func (rl ReadLevel) String() string {
+	switch rl {
+	case ReadBlock:
+		return "block"
+	case ReadSequential:
+		return "seq"
+	case ReadSpread:
+		return "spread"
+	case ReadHedged:
+		return "hedge"
+	case ReadQuorum:
+		return "quorum"
+	}
+	return fmt.Sprintf("ReadLevel(%d)", int(rl))
+}
+
 // BlockStore is the interface representing the standardized methods to
 // interact with something storing blocks.
 type BlockStore interface {
@@ -246,6 +354,9 @@ type BlockStore interface {
 	UsedBlocks() uint64
 	BlockIterator() BlockIterator
 	BlockSize() uint64
+	// GetBlockChecksum returns the CRC32C (Castagnoli) of a stored block,
+	// or ErrBlockCorrupt if the block no longer matches it.
+	GetBlockChecksum(ctx context.Context, b BlockRef) (uint32, error)
 	// TODO(barakmich) FreeBlocks()
 }
 
@@ -256,10 +367,47 @@ type BlockIterator interface {
 	Close() error
 }
 
-type NewBlockStoreFunc func(string, Config, GlobalMetadata) (BlockStore, error)
+// BlockCacheInvalidator is implemented by block stores that cache blocks
+// read from elsewhere, and need telling when a volume's INode is replaced
+// by an older one, as when a snapshot is restored.
+type BlockCacheInvalidator interface {
+	InvalidateVolume(vid VolumeID)
+}
+
+// BlockDiscarder is implemented by block stores that can free blocks a
+// volume no longer uses right away, such as those a discard dropped, rather
+// than leaving them for garbage collection.
+type BlockDiscarder interface {
+	// DiscardBlocks deletes every replica of the blocks that can be reached.
+	DiscardBlocks(ctx context.Context, refs []BlockRef) error
+}
+
+// BlockWriterTo is implemented by block stores that can write a block
+// straight from where it's kept to w, such as a socket, without first
+// copying it onto the heap.
+type BlockWriterTo interface {
+	// WriteBlockTo writes the whole block to w. It returns ErrNotSupported,
+	// having written nothing, if the block can't be written this way, say
+	// because it's compressed or encrypted and has to be read with GetBlock.
+	WriteBlockTo(ctx context.Context, b BlockRef, w io.Writer) error
+}
+
+// NewBlockStoreFunc opens the block store called name, kept under
+// cfg.DataDir and cfg.StorageSize bytes large, creating it if it doesn't
+// exist.
+type NewBlockStoreFunc func(name string, cfg Config, gmd GlobalMetadata) (BlockStore, error)
 
 var blockStores map[string]NewBlockStoreFunc
 
+// RegisterBlockStore is the hook used by implementations of BlockStore to
+// register themselves to the system, usually in the init() of their
+// package, the same way MetadataServices do.
+//
+// Besides BlockStore, a store may implement any of BlockVerifier,
+// BlockCompressor, BlockEncryptor, BlockWriterTo, HintLog and
+// BlockFileReporter. Peers find out which by type assertion and do without
+// the rest; note that a store that isn't a BlockEncryptor keeps the blocks
+// of encrypted volumes in the clear.
 func RegisterBlockStore(name string, newFunc NewBlockStoreFunc) {
 	if blockStores == nil {
 		blockStores = make(map[string]NewBlockStoreFunc)
@@ -272,7 +420,22 @@ func RegisterBlockStore(name string, newFunc NewBlockStoreFunc) {
 	blockStores[name] = newFunc
 }
 
+// CreateBlockStore opens the block store called name, of the registered
+// kind.
 func CreateBlockStore(kind string, name string, cfg Config, gmd GlobalMetadata) (BlockStore, error) {
 	clog.Infof("creating blockstore: %s", kind)
-	return blockStores[kind](name, cfg, gmd)
+	if f, ok := blockStores[kind]; ok {
+		return f(name, cfg, gmd)
+	}
+	return nil, fmt.Errorf("torus: the block store %q doesn't exist; use one of %s", kind, strings.Join(BlockStoreKinds(), ", "))
+}
+
+// BlockStoreKinds returns the kinds of block store registered, sorted.
+func BlockStoreKinds() []string {
+	out := make([]string, 0, len(blockStores))
+	for k := range blockStores {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
 }
@@ -0,0 +1,456 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+var (
+	_ torus.BlockStore      = &boltBlock{}
+	_ torus.BlockVerifier   = &boltBlock{}
+	_ torus.BlockCompressor = &boltBlock{}
+	_ torus.BlockEncryptor  = &boltBlock{}
+	_ torus.HintLog         = &boltBlock{}
+)
+
+func init() {
+	torus.RegisterBlockStore("bolt", newBoltBlockStore)
+}
+
+var boltBlocksBucket = []byte("blocks")
+
+// boltHeaderSize is the size of what's in front of every stored block: its
+// codec, the checksum of the block as written, and its encryption entry.
+const boltHeaderSize = 1 + 4 + encEntrySize
+
+// boltBlock keeps blocks in a BoltDB file, keyed by ref. Unlike an mfile
+// store, it takes up only as much disk as the blocks it holds, short blocks
+// take less, and the space of deleted ones is reused without searching for
+// it, which suits volumes of many small files.
+type boltBlock struct {
+	db        *bolt.DB
+	name      string
+	blocksize uint64
+	nBlocks   uint64
+
+	mut      sync.RWMutex
+	used     uint64
+	closed   bool
+	compress func(torus.VolumeID) bool
+	keyring  func(torus.VolumeID) (*torus.Keyring, error)
+
+	*hintLog
+}
+
+func newBoltBlockStore(name string, cfg torus.Config, meta torus.GlobalMetadata) (torus.BlockStore, error) {
+	nBlocks := cfg.StorageSize / meta.BlockSize
+	promBytesPerBlock.Set(float64(meta.BlockSize))
+	setTotalBlocks(name, nBlocks)
+	path := filepath.Join(cfg.DataDir, "block", fmt.Sprintf("blocks-%s.db", name))
+	// Don't wait forever for another process that has it open.
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	var used int
+	err = db.Update(func(tx *bolt.Tx) error {
+		bk, err := tx.CreateBucketIfNotExists(boltBlocksBucket)
+		if err != nil {
+			return err
+		}
+		used = bk.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	hints, err := openHintLog(filepath.Join(cfg.DataDir, "block", fmt.Sprintf("hints-%s.log", name)))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	setUsedBlocks(name, used)
+	return &boltBlock{
+		db:        db,
+		name:      name,
+		blocksize: meta.BlockSize,
+		nBlocks:   nBlocks,
+		used:      uint64(used),
+		hintLog:   hints,
+	}, nil
+}
+
+func (b *boltBlock) Kind() string { return "bolt" }
+
+func (b *boltBlock) BlockSize() uint64 { return b.blocksize }
+
+func (b *boltBlock) NumBlocks() uint64 { return b.nBlocks }
+
+func (b *boltBlock) UsedBlocks() uint64 {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.used
+}
+
+// Flush does nothing; every change is synced as it's committed.
+func (b *boltBlock) Flush() error { return nil }
+
+func (b *boltBlock) Close() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	err := b.db.Close()
+	if err != nil {
+		return err
+	}
+	return b.closeHints()
+}
+
+func (b *boltBlock) isClosed() bool {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.closed
+}
+
+// SetCompressionPolicy implements torus.BlockCompressor.
+func (b *boltBlock) SetCompressionPolicy(f func(torus.VolumeID) bool) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.compress = f
+}
+
+// SetKeyringFunc implements torus.BlockEncryptor.
+func (b *boltBlock) SetKeyringFunc(f func(torus.VolumeID) (*torus.Keyring, error)) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.keyring = f
+}
+
+func (b *boltBlock) volumeKeyring(vid torus.VolumeID) (*torus.Keyring, error) {
+	b.mut.RLock()
+	f := b.keyring
+	b.mut.RUnlock()
+	if f == nil {
+		return nil, nil
+	}
+	return f(vid)
+}
+
+// encode returns what a block is stored as. The zeros at the end of the
+// block aren't stored.
+func (b *boltBlock) encode(s torus.BlockRef, data []byte, kr *torus.Keyring) ([]byte, error) {
+	b.mut.RLock()
+	compress := b.compress
+	b.mut.RUnlock()
+	stored := bytes.TrimRight(data, "\x00")
+	codec := byte(codecRaw)
+	if compress != nil && compress(s.Volume()) {
+		if packed := compressBlock(stored); packed != nil {
+			stored = packed
+			codec = codecZstd
+		} else {
+			promBlocksIncompressible.WithLabelValues(b.name).Inc()
+		}
+	}
+	entry := blankEncEntry
+	if kr != nil {
+		var err error
+		stored, entry, err = sealBlock(kr, s, stored)
+		if err != nil {
+			return nil, err
+		}
+	}
+	value := make([]byte, boltHeaderSize+len(stored))
+	value[0] = codec
+	// The checksum is of the whole block, as on every other store.
+	binary.LittleEndian.PutUint32(value[1:5], blockCRC(padBlock(data, b.blocksize)))
+	copy(value[5:boltHeaderSize], entry)
+	copy(value[boltHeaderSize:], stored)
+	return value, nil
+}
+
+// decode returns the block a stored value holds, and says whether it should
+// be encrypted under the volume's current key but isn't.
+func (b *boltBlock) decode(s torus.BlockRef, value []byte, kr *torus.Keyring) ([]byte, bool, error) {
+	if len(value) < boltHeaderSize {
+		return nil, false, torus.ErrBlockCorrupt
+	}
+	sum := binary.LittleEndian.Uint32(value[1:5])
+	entry := value[5:boltHeaderSize]
+	data := value[boltHeaderSize:]
+	version, encrypted := parseEncEntry(entry)
+	var err error
+	if encrypted {
+		data, err = openBlock(kr, s, entry, data)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	switch value[0] {
+	case codecRaw:
+		if uint64(len(data)) > b.blocksize {
+			return nil, false, torus.ErrBlockCorrupt
+		}
+		data = padBlock(data, b.blocksize)
+	case codecZstd:
+		data, err = decompressBlock(data, b.blocksize)
+		if err != nil {
+			return nil, false, torus.ErrBlockCorrupt
+		}
+	default:
+		return nil, false, torus.ErrBlockCorrupt
+	}
+	if blockCRC(data) != sum {
+		return nil, false, torus.ErrBlockCorrupt
+	}
+	stale := kr != nil && (!encrypted || version != kr.Current)
+	return data, stale, nil
+}
+
+// get returns a copy of the value stored for a block, or nil.
+func (b *boltBlock) get(s torus.BlockRef) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltBlocksBucket).Get(s.ToBytes()); v != nil {
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return value, err
+}
+
+func (b *boltBlock) HasBlock(_ context.Context, s torus.BlockRef) (bool, error) {
+	if b.isClosed() {
+		return false, torus.ErrClosed
+	}
+	value, err := b.get(s)
+	return value != nil, err
+}
+
+func (b *boltBlock) GetBlock(ctx context.Context, s torus.BlockRef) (_ []byte, err error) {
+	_, span := torus.StartSpan(ctx, "disk.GetBlock", torus.AttrBlock.String(s.String()))
+	defer func() { torus.EndSpan(span, err) }()
+	if b.isClosed() {
+		promBlocksFailed.WithLabelValues(b.name).Inc()
+		return nil, torus.ErrClosed
+	}
+	kr, err := b.volumeKeyring(s.Volume())
+	if err != nil {
+		promBlocksFailed.WithLabelValues(b.name).Inc()
+		return nil, err
+	}
+	value, err := b.get(s)
+	if err != nil {
+		promBlocksFailed.WithLabelValues(b.name).Inc()
+		return nil, err
+	}
+	if value == nil {
+		promBlocksFailed.WithLabelValues(b.name).Inc()
+		return nil, torus.ErrBlockNotExist
+	}
+	data, stale, err := b.decode(s, value, kr)
+	if err == torus.ErrKeyUnavailable {
+		promBlocksFailed.WithLabelValues(b.name).Inc()
+		return nil, err
+	}
+	if err != nil {
+		promBlocksCorrupt.WithLabelValues(b.name).Inc()
+		promBlocksFailed.WithLabelValues(b.name).Inc()
+		return nil, torus.ErrBlockCorrupt
+	}
+	promBlocksRetrieved.WithLabelValues(b.name).Inc()
+	if stale {
+		b.reencrypt(s, value, data, kr)
+	}
+	return data, nil
+}
+
+// reencrypt stores a block again under its volume's current key, if it's
+// still stored as old.
+func (b *boltBlock) reencrypt(s torus.BlockRef, old, data []byte, kr *torus.Keyring) {
+	value, err := b.encode(s, data, kr)
+	if err != nil {
+		clog.Errorf("bolt: couldn't re-encrypt block %s: %v", s, err)
+		return
+	}
+	replaced := false
+	err = b.db.Batch(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(boltBlocksBucket)
+		replaced = bytes.Equal(bk.Get(s.ToBytes()), old)
+		if !replaced {
+			return nil
+		}
+		return bk.Put(s.ToBytes(), value)
+	})
+	if err != nil {
+		clog.Errorf("bolt: couldn't re-encrypt block %s: %v", s, err)
+		return
+	}
+	if replaced {
+		promBlocksReencrypted.WithLabelValues(b.name).Inc()
+	}
+}
+
+func (b *boltBlock) WriteBlock(ctx context.Context, s torus.BlockRef, data []byte) (err error) {
+	_, span := torus.StartSpan(ctx, "disk.WriteBlock", torus.AttrBlock.String(s.String()))
+	defer func() { torus.EndSpan(span, err) }()
+	if uint64(len(data)) > b.blocksize {
+		promBlockWritesFailed.WithLabelValues(b.name).Inc()
+		return errors.New("bolt: block too large")
+	}
+	if b.isClosed() {
+		promBlockWritesFailed.WithLabelValues(b.name).Inc()
+		return torus.ErrClosed
+	}
+	kr, err := b.volumeKeyring(s.Volume())
+	if err != nil {
+		promBlockWritesFailed.WithLabelValues(b.name).Inc()
+		return err
+	}
+	value, err := b.encode(s, data, kr)
+	if err != nil {
+		promBlockWritesFailed.WithLabelValues(b.name).Inc()
+		return err
+	}
+	var existing []byte
+	// Batch shares one commit, and so one sync, between concurrent writes.
+	err = b.db.Batch(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(boltBlocksBucket)
+		existing = nil
+		if v := bk.Get(s.ToBytes()); v != nil {
+			existing = append([]byte(nil), v...)
+			return nil
+		}
+		if b.UsedBlocks() >= b.nBlocks {
+			return torus.ErrOutOfSpace
+		}
+		return bk.Put(s.ToBytes(), value)
+	})
+	if err == torus.ErrOutOfSpace {
+		clog.Error("bolt: out of space")
+	}
+	if err != nil {
+		promBlockWritesFailed.WithLabelValues(b.name).Inc()
+		return err
+	}
+	if existing != nil {
+		// Not an error, if we already have it
+		clog.Debug("bolt: block already exists: ", s)
+		olddata, _, err := b.decode(s, existing, kr)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(olddata, padBlock(data, b.blocksize)) {
+			clog.Error("getting wrong data for block: ", s)
+			return torus.ErrExists
+		}
+		return nil
+	}
+	if kr != nil {
+		promBlocksEncrypted.WithLabelValues(b.name).Inc()
+	}
+	if value[0] == codecZstd {
+		promBlocksCompressed.WithLabelValues(b.name).Inc()
+		promCompressionSavedBytes.WithLabelValues(b.name).Add(float64(b.blocksize) - float64(len(value)-boltHeaderSize))
+	}
+	b.mut.Lock()
+	b.used++
+	b.mut.Unlock()
+	addUsedBlocks(b.name, 1)
+	promBlocksWritten.WithLabelValues(b.name).Inc()
+	return nil
+}
+
+// WriteBuf isn't supported; blocks are encoded before they're stored.
+func (b *boltBlock) WriteBuf(_ context.Context, s torus.BlockRef) ([]byte, error) {
+	return nil, torus.ErrNotSupported
+}
+
+func (b *boltBlock) DeleteBlock(_ context.Context, s torus.BlockRef) error {
+	if b.isClosed() {
+		promBlockDeletesFailed.WithLabelValues(b.name).Inc()
+		return torus.ErrClosed
+	}
+	err := b.db.Batch(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(boltBlocksBucket)
+		if bk.Get(s.ToBytes()) == nil {
+			return torus.ErrBlockNotExist
+		}
+		return bk.Delete(s.ToBytes())
+	})
+	if err == torus.ErrBlockNotExist {
+		clog.Errorf("bolt: deleting non-existent thing? %s", s)
+	}
+	if err != nil {
+		promBlockDeletesFailed.WithLabelValues(b.name).Inc()
+		return err
+	}
+	b.mut.Lock()
+	b.used--
+	b.mut.Unlock()
+	addUsedBlocks(b.name, -1)
+	promBlocksDeleted.WithLabelValues(b.name).Inc()
+	return nil
+}
+
+func (b *boltBlock) VerifyBlock(ctx context.Context, s torus.BlockRef) error {
+	_, err := b.GetBlockChecksum(ctx, s)
+	return err
+}
+
+func (b *boltBlock) GetBlockChecksum(_ context.Context, s torus.BlockRef) (uint32, error) {
+	if b.isClosed() {
+		return 0, torus.ErrClosed
+	}
+	kr, err := b.volumeKeyring(s.Volume())
+	if err != nil {
+		return 0, err
+	}
+	value, err := b.get(s)
+	if err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return 0, torus.ErrBlockNotExist
+	}
+	data, _, err := b.decode(s, value, kr)
+	if err == torus.ErrKeyUnavailable {
+		return 0, err
+	}
+	if err != nil {
+		promBlocksCorrupt.WithLabelValues(b.name).Inc()
+		return 0, torus.ErrBlockCorrupt
+	}
+	return blockCRC(data), nil
+}
+
+func (b *boltBlock) BlockIterator() torus.BlockIterator {
+	var refs []torus.BlockRef
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBlocksBucket).ForEach(func(k, _ []byte) error {
+			refs = append(refs, torus.BlockRefFromBytes(k))
+			return nil
+		})
+	})
+	if err != nil {
+		clog.Errorf("bolt: couldn't list blocks: %v", err)
+	}
+	return &mfileIterator{
+		set: refs,
+		i:   -1,
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func TestBoltBlockStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := torus.Config{DataDir: dir, StorageSize: 3 * 1024}
+	meta := torus.GlobalMetadata{BlockSize: 1024}
+	s, err := torus.CreateBlockStore("bolt", "test", cfg, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.(torus.BlockCompressor).SetCompressionPolicy(func(vid torus.VolumeID) bool { return vid == 2 })
+	ctx := context.TODO()
+	a := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	b := torus.BlockRef{INodeRef: torus.NewINodeRef(2, 1), Index: 1}
+	c := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}
+	adata := []byte("short")
+	bdata := bytes.Repeat([]byte("compress me "), 80)
+	cdata := bytes.Repeat([]byte{0xff}, 1024)
+	for _, x := range []struct {
+		ref  torus.BlockRef
+		data []byte
+	}{{a, adata}, {b, bdata}, {c, cdata}} {
+		if err := s.WriteBlock(ctx, x.ref, x.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.WriteBlock(ctx, a, adata); err != nil {
+		t.Fatalf("rewriting the same block: %v", err)
+	}
+	if err := s.WriteBlock(ctx, a, []byte("other")); err != torus.ErrExists {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+	d := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 3}
+	if err := s.WriteBlock(ctx, d, adata); err != torus.ErrOutOfSpace {
+		t.Fatalf("expected ErrOutOfSpace, got %v", err)
+	}
+	if err := s.DeleteBlock(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteBlock(ctx, c); err != torus.ErrBlockNotExist {
+		t.Fatalf("expected ErrBlockNotExist, got %v", err)
+	}
+	s.Close()
+	if _, err := s.GetBlock(ctx, a); err != torus.ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+
+	s, err = torus.CreateBlockStore("bolt", "test", cfg, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.UsedBlocks() != 2 {
+		t.Fatalf("expected 2 blocks after reopening, got %d", s.UsedBlocks())
+	}
+	for _, x := range []struct {
+		ref  torus.BlockRef
+		data []byte
+	}{{a, adata}, {b, bdata}} {
+		got, err := s.GetBlock(ctx, x.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, padBlock(x.data, 1024)) {
+			t.Fatalf("block %s reads back differently", x.ref)
+		}
+		if err := s.(torus.BlockVerifier).VerifyBlock(ctx, x.ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, _ := s.HasBlock(ctx, c); ok {
+		t.Fatal("deleted block came back")
+	}
+	n := 0
+	it := s.BlockIterator()
+	for it.Next() {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected to iterate over 2 blocks, got %d", n)
+	}
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Each checksum entry is a CRC32C of the block and a flag saying the CRC has
+// been taken. Blocks written before checksums existed have no flag, and are
+// checksummed the first time they're verified.
+const crcEntrySize = 8
+
+func blockCRC(data []byte) uint32 {
+	return crc32.Checksum(data, crcTable)
+}
+
+func crcEntry(sum uint32) []byte {
+	b := make([]byte, crcEntrySize)
+	binary.LittleEndian.PutUint32(b[0:4], sum)
+	b[4] = 1
+	return b
+}
+
+func parseCRCEntry(b []byte) (sum uint32, ok bool) {
+	return binary.LittleEndian.Uint32(b[0:4]), b[4] == 1
+}
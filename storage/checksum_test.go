@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func TestMFileVerifyBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := torus.Config{DataDir: dir, StorageSize: 16 * 1024}
+	s, err := newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := s.(*mfileBlock)
+	ctx := context.TODO()
+	a := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	b := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}
+
+	err = m.WriteBlock(ctx, a, []byte("some data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := m.WriteBuf(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(buf, "more data")
+	err = m.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []torus.BlockRef{a, b} {
+		if err := m.VerifyBlock(ctx, ref); err != nil {
+			t.Fatalf("expected %s to verify, got %v", ref, err)
+		}
+	}
+
+	data, err := m.GetBlock(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[3] ^= 0x40
+	if err := m.VerifyBlock(ctx, b); err != torus.ErrBlockCorrupt {
+		t.Fatalf("expected corrupt block, got %v", err)
+	}
+	if err := m.VerifyBlock(ctx, a); err != nil {
+		t.Fatalf("expected %s to verify, got %v", a, err)
+	}
+	if _, err := m.GetBlock(ctx, b); err != torus.ErrBlockCorrupt {
+		t.Fatalf("expected reading a corrupt block to fail, got %v", err)
+	}
+	data, err = m.GetBlock(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := m.GetBlockChecksum(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != blockCRC(data) {
+		t.Errorf("expected checksum %x, got %x", blockCRC(data), sum)
+	}
+}
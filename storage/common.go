@@ -6,6 +6,8 @@
 package storage
 
 import (
+	"sync"
+
 	"github.com/coreos/pkg/capnslog"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -21,6 +23,10 @@ var (
 		Name: "torus_storage_blocks_total",
 		Help: "Gauge of number of blocks available in local storage",
 	}, []string{"storage"})
+	promFillRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "torus_storage_fill_ratio",
+		Help: "Fraction of the blocks available in local storage that are used",
+	}, []string{"storage"})
 	promBlocksRetrieved = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "torus_storage_read_blocks",
 		Help: "Number of blocks returned from local block storage",
@@ -45,10 +51,64 @@ var (
 		Name: "torus_storage_failed_deleted_blocks",
 		Help: "Number of blocks failed to be deleted from local block storage",
 	}, []string{"storage"})
+	promBlocksCorrupt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_corrupt_blocks",
+		Help: "Number of blocks found not to match their checksum in local block storage",
+	}, []string{"storage"})
+	promBlocksCompressed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_compressed_blocks",
+		Help: "Number of blocks written compressed to local block storage",
+	}, []string{"storage"})
+	promBlocksIncompressible = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_incompressible_blocks",
+		Help: "Number of blocks of compressed volumes written raw because compression didn't help",
+	}, []string{"storage"})
+	promCompressionSavedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_compression_saved_bytes",
+		Help: "Number of bytes compression saved on the blocks written to local block storage",
+	}, []string{"storage"})
+	promBlocksEncrypted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_encrypted_blocks",
+		Help: "Number of blocks written encrypted to local block storage",
+	}, []string{"storage"})
+	promBlocksReencrypted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_reencrypted_blocks",
+		Help: "Number of blocks encrypted under a newer volume key as they were read",
+	}, []string{"storage"})
 	promStorageFlushes = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "torus_storage_flushes",
 		Help: "Number of times the storage layer is synced to disk",
 	}, []string{"storage"})
+	promJournalRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_journal_records_total",
+		Help: "Number of records appended to the write-ahead journal",
+	}, []string{"storage"})
+	promJournalBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_journal_bytes_total",
+		Help: "Number of bytes appended to the write-ahead journal",
+	}, []string{"storage"})
+	promJournalSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_journal_syncs_total",
+		Help: "Number of times the write-ahead journal is synced to disk",
+	}, []string{"storage"})
+	promJournalSyncSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "torus_storage_journal_sync_seconds",
+		Help:    "Time taken to sync the write-ahead journal to disk",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"storage"})
+	promJournalBatch = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "torus_storage_journal_sync_records",
+		Help:    "Number of records made durable by each sync of the write-ahead journal",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"storage"})
+	promJournalCheckpoints = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_journal_checkpoints_total",
+		Help: "Number of times the block files are synced and the write-ahead journal emptied",
+	}, []string{"storage"})
+	promJournalErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "torus_storage_journal_errors_total",
+		Help: "Number of failed writes and syncs of the write-ahead journal",
+	}, []string{"storage"})
 	promBytesPerBlock = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "torus_storage_block_bytes",
 		Help: "Number of bytes per block in the storage layer",
@@ -58,12 +118,68 @@ var (
 func init() {
 	prometheus.MustRegister(promBlocks)
 	prometheus.MustRegister(promBlocksAvail)
+	prometheus.MustRegister(promFillRatio)
 	prometheus.MustRegister(promBlocksRetrieved)
 	prometheus.MustRegister(promBlocksFailed)
 	prometheus.MustRegister(promBlocksWritten)
 	prometheus.MustRegister(promBlockWritesFailed)
 	prometheus.MustRegister(promBlocksDeleted)
 	prometheus.MustRegister(promBlockDeletesFailed)
+	prometheus.MustRegister(promBlocksCorrupt)
+	prometheus.MustRegister(promBlocksCompressed)
+	prometheus.MustRegister(promBlocksIncompressible)
+	prometheus.MustRegister(promCompressionSavedBytes)
+	prometheus.MustRegister(promBlocksEncrypted)
+	prometheus.MustRegister(promBlocksReencrypted)
 	prometheus.MustRegister(promStorageFlushes)
+	prometheus.MustRegister(promJournalRecords)
+	prometheus.MustRegister(promJournalBytes)
+	prometheus.MustRegister(promJournalSyncs)
+	prometheus.MustRegister(promJournalSyncSeconds)
+	prometheus.MustRegister(promJournalBatch)
+	prometheus.MustRegister(promJournalCheckpoints)
+	prometheus.MustRegister(promJournalErrors)
 	prometheus.MustRegister(promBytesPerBlock)
 }
+
+// fill tracks how many blocks each store uses and has, to export how full it
+// is.
+var fill = struct {
+	sync.Mutex
+	used, total map[string]float64
+}{
+	used:  make(map[string]float64),
+	total: make(map[string]float64),
+}
+
+func setTotalBlocks(name string, n uint64) {
+	fill.Lock()
+	defer fill.Unlock()
+	fill.total[name] = float64(n)
+	promBlocksAvail.WithLabelValues(name).Set(float64(n))
+	updateFill(name)
+}
+
+func setUsedBlocks(name string, n int) {
+	fill.Lock()
+	defer fill.Unlock()
+	fill.used[name] = float64(n)
+	promBlocks.WithLabelValues(name).Set(float64(n))
+	updateFill(name)
+}
+
+func addUsedBlocks(name string, delta int) {
+	fill.Lock()
+	defer fill.Unlock()
+	fill.used[name] += float64(delta)
+	promBlocks.WithLabelValues(name).Set(fill.used[name])
+	updateFill(name)
+}
+
+// updateFill is called with fill locked.
+func updateFill(name string) {
+	if fill.total[name] == 0 {
+		return
+	}
+	promFillRatio.WithLabelValues(name).Set(fill.used[name] / fill.total[name])
+}
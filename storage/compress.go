@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressed blocks are stored at the start of their slot, with the rest of
+// the slot zeroed and, where the filesystem allows, given back to it. Each
+// slot has an entry saying how its block is stored and how long the stored
+// form is; an empty entry, as on stores that predate compression, means raw.
+const compEntrySize = 8
+
+const (
+	codecRaw  = 0
+	codecZstd = 1
+)
+
+var blankCompEntry = make([]byte, compEntrySize)
+
+func compEntry(codec byte, n int) []byte {
+	b := make([]byte, compEntrySize)
+	binary.LittleEndian.PutUint32(b[0:4], uint32(n))
+	b[4] = codec
+	return b
+}
+
+func parseCompEntry(b []byte) (codec byte, n int) {
+	return b[4], int(binary.LittleEndian.Uint32(b[0:4]))
+}
+
+var (
+	zstdOnce sync.Once
+	zstdEnc  *zstd.Encoder
+	zstdDec  *zstd.Decoder
+)
+
+func initZstd() {
+	var err error
+	zstdEnc, err = zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+	zstdDec, err = zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// compressBlock returns the compressed form of data, or nil if compressing
+// doesn't save at least an eighth of it, in which case it's stored raw.
+func compressBlock(data []byte) []byte {
+	zstdOnce.Do(initZstd)
+	out := zstdEnc.EncodeAll(data, nil)
+	if len(out) > len(data)-len(data)/8 {
+		return nil
+	}
+	return out
+}
+
+// decompressBlock returns the block stored in data, padded to blocksize.
+func decompressBlock(data []byte, blocksize uint64) ([]byte, error) {
+	zstdOnce.Do(initZstd)
+	out, err := zstdDec.DecodeAll(data, make([]byte, 0, blocksize))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(out)) > blocksize {
+		return nil, errors.New("storage: compressed block is larger than a block")
+	}
+	return padBlock(out, blocksize), nil
+}
+
+func padBlock(data []byte, blocksize uint64) []byte {
+	if uint64(len(data)) >= blocksize {
+		return data
+	}
+	out := make([]byte, blocksize)
+	copy(out, data)
+	return out
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func TestMFileCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const blocksize = 64 * 1024
+	cfg := torus.Config{DataDir: dir, StorageSize: 4 * blocksize}
+	s, err := newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: blocksize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := s.(*mfileBlock)
+	m.SetCompressionPolicy(func(vid torus.VolumeID) bool { return vid == 1 })
+	ctx := context.TODO()
+
+	text := bytes.Repeat([]byte("All work and no play makes Jack a dull boy.\n"), 1000)
+	noise := make([]byte, blocksize)
+	rand.New(rand.NewSource(1)).Read(noise)
+	tests := []struct {
+		ref   torus.BlockRef
+		data  []byte
+		codec byte
+	}{
+		{torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}, text, codecZstd},
+		{torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}, noise, codecRaw},
+		{torus.BlockRef{INodeRef: torus.NewINodeRef(2, 1), Index: 1}, text, codecRaw},
+	}
+	for _, tt := range tests {
+		err := m.WriteBlock(ctx, tt.ref, tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codec, _ := parseCompEntry(m.compFile.GetBlock(uint64(m.findIndex(tt.ref))))
+		if codec != tt.codec {
+			t.Errorf("%s: expected codec %d, got %d", tt.ref, tt.codec, codec)
+		}
+	}
+	// Compressed or not, blocks read back and checksum the same, including
+	// after a restart.
+	for pass := 0; pass < 2; pass++ {
+		for _, tt := range tests {
+			want := padBlock(tt.data, blocksize)
+			data, err := m.GetBlock(ctx, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("%s: read back different data", tt.ref)
+			}
+			sum, err := m.GetBlockChecksum(ctx, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum != blockCRC(want) {
+				t.Errorf("%s: checksum differs from that of the data", tt.ref)
+			}
+		}
+		err = m.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: blocksize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m = s.(*mfileBlock)
+	}
+	m.Close()
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// directAlign is what the buffers, offsets and lengths of direct I/O have
+// to be multiples of.
+const directAlign = 4096
+
+// blockFile is a file of fixed-size blocks: an MFile, or a directFile.
+type blockFile interface {
+	GetBlock(n uint64) []byte
+	WriteBlock(n uint64, data []byte) error
+	WriteBlockSparse(n uint64, data []byte) error
+	NumBlocks() uint64
+	Flush() error
+	Sync() error
+	Close() error
+}
+
+// directFile is a file of blocks read and written with O_DIRECT, so that
+// they don't take up the page cache as well as the caches Torus keeps.
+type directFile struct {
+	file    *os.File
+	blkSize uint64
+	size    uint64
+}
+
+func openDirectFile(path string, blkSize uint64) (*directFile, error) {
+	if blkSize%directAlign != 0 {
+		return nil, fmt.Errorf("direct I/O needs a block size that is a multiple of %d", directAlign)
+	}
+	f, err := openDirect(path)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size := uint64(st.Size())
+	if size%blkSize != 0 {
+		f.Close()
+		return nil, fmt.Errorf("File size is not a multiple of the block size: %d size, %d blksize", size, blkSize)
+	}
+	return &directFile{
+		file:    f,
+		blkSize: blkSize,
+		size:    size,
+	}, nil
+}
+
+// alignedBuffer returns a buffer of n bytes that direct I/O can use.
+func alignedBuffer(n uint64) []byte {
+	buf := make([]byte, n+directAlign)
+	off := int(uintptr(unsafe.Pointer(&buf[0])) & (directAlign - 1))
+	if off != 0 {
+		off = directAlign - off
+	}
+	return buf[off : off+int(n)]
+}
+
+// GetBlock reads the n-th block into a new buffer. It returns nil if the
+// block is past the end of the file or can't be read.
+func (d *directFile) GetBlock(n uint64) []byte {
+	if n >= d.NumBlocks() {
+		return nil
+	}
+	buf := alignedBuffer(d.blkSize)
+	_, err := d.file.ReadAt(buf, int64(n*d.blkSize))
+	if err != nil {
+		clog.Errorf("couldn't read block %d of %s: %v", n, d.file.Name(), err)
+		return nil
+	}
+	return buf
+}
+
+func (d *directFile) NumBlocks() uint64 {
+	return d.size / d.blkSize
+}
+
+func (d *directFile) WriteBlock(n uint64, data []byte) error {
+	if uint64(len(data)) > d.blkSize {
+		return errors.New("Data block too large")
+	}
+	if n >= d.NumBlocks() {
+		return errors.New("Offset too large")
+	}
+	buf := alignedBuffer(d.blkSize)
+	copy(buf, data)
+	_, err := d.file.WriteAt(buf, int64(n*d.blkSize))
+	return err
+}
+
+// WriteBlockSparse writes only the pages data takes, and gives the rest of
+// the block back to the filesystem where it supports that.
+func (d *directFile) WriteBlockSparse(n uint64, data []byte) error {
+	if uint64(len(data)) > d.blkSize {
+		return errors.New("Data block too large")
+	}
+	if n >= d.NumBlocks() {
+		return errors.New("Offset too large")
+	}
+	used := (uint64(len(data)) + directAlign - 1) / directAlign * directAlign
+	if used == d.blkSize {
+		return d.WriteBlock(n, data)
+	}
+	off := int64(n * d.blkSize)
+	if punchHole(d.file, off+int64(used), int64(d.blkSize-used)) != nil {
+		return d.WriteBlock(n, data)
+	}
+	if used == 0 {
+		return nil
+	}
+	buf := alignedBuffer(used)
+	copy(buf, data)
+	_, err := d.file.WriteAt(buf, off)
+	return err
+}
+
+// Flush does nothing; writes don't wait in the page cache.
+func (d *directFile) Flush() error {
+	return nil
+}
+
+// Sync waits for the disk to have the blocks written so far.
+func (d *directFile) Sync() error {
+	return d.file.Sync()
+}
+
+func (d *directFile) Close() error {
+	err := d.file.Sync()
+	if err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
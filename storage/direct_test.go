@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func TestMFileDirectIO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := torus.Config{DataDir: dir, StorageSize: 64 * 1024, DirectIO: true, Preallocate: true}
+	s, err := newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: 8192})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := s.(*mfileBlock)
+	opts := m.FileOptions()
+	if !opts.DirectIO {
+		// Not every filesystem takes O_DIRECT; the store falls back to
+		// the page cache, which the rest of the test still covers.
+		t.Logf("no direct I/O on %s", dir)
+	}
+	m.SetCompressionPolicy(func(vid torus.VolumeID) bool { return vid == 2 })
+	ctx := context.TODO()
+	a := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	b := torus.BlockRef{INodeRef: torus.NewINodeRef(2, 1), Index: 1}
+	adata := bytes.Repeat([]byte{'a', 'b', 'c', 0xff}, 2048)
+	bdata := padBlock(bytes.Repeat([]byte("compress me "), 100), 8192)
+	if err := m.WriteBlock(ctx, a, adata); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteBlock(ctx, b, bdata); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.WriteBuf(ctx, torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}); opts.DirectIO && err != torus.ErrNotSupported {
+		t.Fatalf("expected WriteBuf to be unsupported with direct I/O, got %v", err)
+	}
+	s.Close()
+
+	s, err = newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: 8192})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, x := range []struct {
+		ref  torus.BlockRef
+		data []byte
+	}{{a, adata}, {b, bdata}} {
+		got, err := s.GetBlock(ctx, x.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, x.data) {
+			t.Fatalf("block %s reads back differently", x.ref)
+		}
+	}
+	if opts.Preallocated {
+		fi, err := os.Stat(filepath.Join(dir, "block", "data-test.blk"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != 64*1024 {
+			t.Fatalf("expected a 64KiB data file, got %d bytes", fi.Size())
+		}
+	}
+}
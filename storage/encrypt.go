@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/coreos/torus"
+)
+
+// Blocks of encrypted volumes are sealed with AES-GCM after any compression.
+// The ciphertext takes the place of the stored bytes in the slot, and the
+// nonce and tag go in the slot's encryption entry along with the version of
+// the volume key used, so a block takes no more room than it would in the
+// clear. The block's ref is authenticated too, so a block can't be passed
+// off as another. An empty entry means the block is stored in the clear.
+const encEntrySize = 40
+
+const (
+	encNonceSize = 12
+	encTagSize   = 16
+)
+
+var blankEncEntry = make([]byte, encEntrySize)
+
+func parseEncEntry(b []byte) (version uint32, ok bool) {
+	return binary.LittleEndian.Uint32(b[1:5]), b[0] == 1
+}
+
+// sealBlock encrypts stored with the volume's current key, returning the
+// ciphertext, which is the same length, and the encryption entry.
+func sealBlock(kr *torus.Keyring, ref torus.BlockRef, stored []byte) ([]byte, []byte, error) {
+	aead := kr.Key(kr.Current)
+	if aead == nil {
+		return nil, nil, torus.ErrKeyUnavailable
+	}
+	entry := make([]byte, encEntrySize)
+	entry[0] = 1
+	binary.LittleEndian.PutUint32(entry[1:5], kr.Current)
+	nonce := entry[5 : 5+encNonceSize]
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := aead.Seal(nil, nonce, stored, ref.ToBytes())
+	copy(entry[5+encNonceSize:], out[len(stored):])
+	return out[:len(stored)], entry, nil
+}
+
+// openBlock decrypts the stored bytes of a block, given its encryption entry.
+func openBlock(kr *torus.Keyring, ref torus.BlockRef, entry []byte, stored []byte) ([]byte, error) {
+	if kr == nil {
+		return nil, torus.ErrKeyUnavailable
+	}
+	version, _ := parseEncEntry(entry)
+	aead := kr.Key(version)
+	if aead == nil {
+		return nil, torus.ErrKeyUnavailable
+	}
+	buf := make([]byte, len(stored), len(stored)+encTagSize)
+	copy(buf, stored)
+	buf = append(buf, entry[5+encNonceSize:5+encNonceSize+encTagSize]...)
+	out, err := aead.Open(buf[:0], entry[5:5+encNonceSize], buf, ref.ToBytes())
+	if err != nil {
+		return nil, torus.ErrBlockCorrupt
+	}
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+)
+
+func TestMFileEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-encrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := torus.Config{DataDir: dir, StorageSize: 16 * 1024}
+	s, err := newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := s.(*mfileBlock)
+
+	mds := temp.NewClient(torus.Config{}, temp.NewServer())
+	mds.CreateVolume(&models.Volume{Name: "vol", Id: 1, Type: "block"})
+	kek := bytes.Repeat([]byte{7}, torus.KeySize)
+	var kr *torus.Keyring
+	m.SetKeyringFunc(func(vid torus.VolumeID) (*torus.Keyring, error) {
+		if vid != 1 {
+			return nil, nil
+		}
+		return kr, nil
+	})
+	rotate := func() {
+		_, err := torus.RotateVolumeKey(mds, kek, "vol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		vk, err := mds.GetVolumeKeys(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kr, err = torus.UnwrapVolumeKeys(kek, 1, vk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.TODO()
+	secret := []byte("the secret recipe")
+	before := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	a := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}
+
+	// A block written before the volume was encrypted is encrypted the
+	// first time it's read afterwards.
+	err = m.WriteBlock(ctx, before, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotate()
+	err = m.WriteBlock(ctx, a, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.WriteBuf(ctx, a); err != torus.ErrNotSupported {
+		t.Fatalf("expected WriteBuf to be refused for an encrypted volume, got %v", err)
+	}
+	want := padBlock(secret, 1024)
+	check := func(version uint32) {
+		for _, ref := range []torus.BlockRef{before, a} {
+			data, err := m.GetBlock(ctx, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Fatalf("%s: read back different data", ref)
+			}
+			index := m.findIndex(ref)
+			if bytes.Contains(m.dataFile.GetBlock(uint64(index)), secret) {
+				t.Fatalf("%s: stored in the clear", ref)
+			}
+			if v, ok := parseEncEntry(m.encFile.GetBlock(uint64(index))); !ok || v != version {
+				t.Fatalf("%s: expected key version %d, got %d", ref, version, v)
+			}
+			if err := m.VerifyBlock(ctx, ref); err != nil {
+				t.Fatalf("%s: %v", ref, err)
+			}
+		}
+	}
+	check(1)
+	rotate()
+	check(2)
+
+	// Tampering is caught, and so is the lack of keys.
+	m.dataFile.GetBlock(uint64(m.findIndex(a)))[0] ^= 1
+	if _, err := m.GetBlock(ctx, a); err != torus.ErrBlockCorrupt {
+		t.Fatalf("expected corrupt block, got %v", err)
+	}
+	kr = nil
+	if _, err := m.GetBlock(ctx, before); err != torus.ErrKeyUnavailable {
+		t.Fatalf("expected no key, got %v", err)
+	}
+}
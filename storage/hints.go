@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/coreos/torus"
+)
+
+const (
+	hintAdd byte = iota + 1
+	hintRemove
+)
+
+// hintLog keeps the hints of a block store. If it has a file, every change is
+// appended to it, and the file is compacted to the live hints when opened.
+// New hints are synced before they're acknowledged, since the hinted block
+// may be the only copy of a write.
+type hintLog struct {
+	hintMut sync.Mutex
+	hints   map[string]map[torus.BlockRef]bool
+	file    *os.File
+}
+
+func newMemoryHintLog() *hintLog {
+	return &hintLog{
+		hints: make(map[string]map[torus.BlockRef]bool),
+	}
+}
+
+func openHintLog(path string) (*hintLog, error) {
+	h := newMemoryHintLog()
+	f, err := os.Open(path)
+	if err == nil {
+		err = h.replay(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	// Compact by writing out only the live hints.
+	tmp := path + ".tmp"
+	f, err = os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	for peer, refs := range h.hints {
+		for ref := range refs {
+			_, err = f.Write(hintRecord(hintAdd, peer, ref))
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return nil, err
+	}
+	h.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func hintRecord(op byte, peer string, ref torus.BlockRef) []byte {
+	buf := make([]byte, 2+len(peer)+torus.BlockRefByteSize)
+	buf[0] = op
+	buf[1] = byte(len(peer))
+	copy(buf[2:], peer)
+	ref.ToBytesBuf(buf[2+len(peer):])
+	return buf
+}
+
+func (h *hintLog) replay(r *bufio.Reader) error {
+	header := make([]byte, 2)
+	refbuf := make([]byte, torus.BlockRefByteSize)
+	for {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// A torn write at the end; everything before it is good.
+			clog.Warningf("truncated hint log: %v", err)
+			return nil
+		}
+		peer := make([]byte, header[1])
+		_, err = io.ReadFull(r, peer)
+		if err == nil {
+			_, err = io.ReadFull(r, refbuf)
+		}
+		if err != nil {
+			clog.Warningf("truncated hint log: %v", err)
+			return nil
+		}
+		ref := torus.BlockRefFromBytes(refbuf)
+		switch header[0] {
+		case hintAdd:
+			h.add(string(peer), ref)
+		case hintRemove:
+			h.remove(string(peer), ref)
+		default:
+			return errors.New("storage: corrupt hint log")
+		}
+	}
+}
+
+func (h *hintLog) add(peer string, ref torus.BlockRef) {
+	if h.hints[peer] == nil {
+		h.hints[peer] = make(map[torus.BlockRef]bool)
+	}
+	h.hints[peer][ref] = true
+}
+
+func (h *hintLog) remove(peer string, ref torus.BlockRef) {
+	delete(h.hints[peer], ref)
+	if len(h.hints[peer]) == 0 {
+		delete(h.hints, peer)
+	}
+}
+
+func (h *hintLog) AddHint(peer string, ref torus.BlockRef) error {
+	h.hintMut.Lock()
+	defer h.hintMut.Unlock()
+	if h.hints[peer][ref] {
+		return nil
+	}
+	if h.file != nil {
+		_, err := h.file.Write(hintRecord(hintAdd, peer, ref))
+		if err != nil {
+			return err
+		}
+		err = h.file.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	h.add(peer, ref)
+	return nil
+}
+
+func (h *hintLog) RemoveHint(peer string, ref torus.BlockRef) error {
+	h.hintMut.Lock()
+	defer h.hintMut.Unlock()
+	if !h.hints[peer][ref] {
+		return nil
+	}
+	if h.file != nil {
+		_, err := h.file.Write(hintRecord(hintRemove, peer, ref))
+		if err != nil {
+			return err
+		}
+	}
+	h.remove(peer, ref)
+	return nil
+}
+
+func (h *hintLog) HintedPeers() []string {
+	h.hintMut.Lock()
+	defer h.hintMut.Unlock()
+	out := make([]string, 0, len(h.hints))
+	for p := range h.hints {
+		out = append(out, p)
+	}
+	return out
+}
+
+func (h *hintLog) Hints(peer string) []torus.BlockRef {
+	h.hintMut.Lock()
+	defer h.hintMut.Unlock()
+	out := make([]torus.BlockRef, 0, len(h.hints[peer]))
+	for ref := range h.hints[peer] {
+		out = append(out, ref)
+	}
+	return out
+}
+
+func (h *hintLog) closeHints() error {
+	h.hintMut.Lock()
+	defer h.hintMut.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+func TestHintLogReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-hints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hints.log")
+
+	h, err := openHintLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	b := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}
+	for _, x := range []struct {
+		peer string
+		ref  torus.BlockRef
+	}{{"peer-a", a}, {"peer-a", b}, {"peer-b", a}} {
+		if err := h.AddHint(x.peer, x.ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.RemoveHint("peer-a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.RemoveHint("peer-b", a); err != nil {
+		t.Fatal(err)
+	}
+	h.closeHints()
+
+	h, err = openHintLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.closeHints()
+	peers := h.HintedPeers()
+	if len(peers) != 1 || peers[0] != "peer-a" {
+		t.Fatalf("expected hints for peer-a only, got %v", peers)
+	}
+	refs := h.Hints("peer-a")
+	if len(refs) != 1 || refs[0] != b {
+		t.Fatalf("expected hint for %s, got %v", b, refs)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(hintRecord(hintAdd, "peer-a", b))) {
+		t.Fatalf("expected log to be compacted, is %d bytes", fi.Size())
+	}
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coreos/torus"
+)
+
+const (
+	journalPut byte = iota + 1
+	journalFree
+)
+
+const (
+	// journalHeaderSize is the length and checksum in front of every record.
+	journalHeaderSize = 8
+	// journalPutSize is the size of a put record without its data: the op,
+	// index, ref, and the entries of the block in the other files.
+	journalPutSize  = 1 + 8 + torus.BlockRefByteSize + compEntrySize + encEntrySize + crcEntrySize
+	journalFreeSize = 1 + 8 + torus.BlockRefByteSize
+
+	// journalCheckpointSize is how large the journal may grow before the
+	// block files are synced and it is emptied.
+	journalCheckpointSize = 256 * 1024 * 1024
+)
+
+var journalTable = crc32.MakeTable(crc32.Castagnoli)
+
+// journalRecord is a change to one index of a block store: a block stored at
+// it, as it is stored, or the index freed.
+type journalRecord struct {
+	op    byte
+	index uint64
+	ref   torus.BlockRef
+	comp  []byte
+	enc   []byte
+	crc   []byte
+	data  []byte
+}
+
+func (r *journalRecord) marshal() []byte {
+	n := journalFreeSize
+	if r.op == journalPut {
+		n = journalPutSize + len(r.data)
+	}
+	buf := make([]byte, journalHeaderSize+n)
+	body := buf[journalHeaderSize:]
+	body[0] = r.op
+	binary.LittleEndian.PutUint64(body[1:], r.index)
+	r.ref.ToBytesBuf(body[9:])
+	if r.op == journalPut {
+		off := journalFreeSize
+		off += copy(body[off:], r.comp)
+		off += copy(body[off:], r.enc)
+		off += copy(body[off:], r.crc)
+		copy(body[off:], r.data)
+	}
+	binary.LittleEndian.PutUint32(buf[0:], uint32(n))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(body, journalTable))
+	return buf
+}
+
+func unmarshalJournalRecord(body []byte) (*journalRecord, bool) {
+	if len(body) < journalFreeSize {
+		return nil, false
+	}
+	r := &journalRecord{
+		op:    body[0],
+		index: binary.LittleEndian.Uint64(body[1:]),
+		ref:   torus.BlockRefFromBytes(body[9:journalFreeSize]),
+	}
+	switch r.op {
+	case journalFree:
+		return r, len(body) == journalFreeSize
+	case journalPut:
+		if len(body) < journalPutSize {
+			return nil, false
+		}
+		off := journalFreeSize
+		r.comp = body[off : off+compEntrySize]
+		off += compEntrySize
+		r.enc = body[off : off+encEntrySize]
+		off += encEntrySize
+		r.crc = body[off : off+crcEntrySize]
+		r.data = body[journalPutSize:]
+		return r, true
+	}
+	return nil, false
+}
+
+// replayJournal calls apply with every record in the journal at path, in
+// order, up to the first that is torn or corrupt. No record holds more than
+// blocksize bytes of data.
+func replayJournal(path string, blocksize uint64, apply func(*journalRecord) error) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	header := make([]byte, journalHeaderSize)
+	n := 0
+	for {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			// A torn write at the end; everything before it is good.
+			clog.Warningf("truncated journal: %v", err)
+			return n, nil
+		}
+		size := binary.LittleEndian.Uint32(header[0:])
+		if uint64(size) > journalPutSize+blocksize {
+			clog.Warningf("corrupt journal record after %d records; ignoring the rest", n)
+			return n, nil
+		}
+		body := make([]byte, size)
+		_, err = io.ReadFull(r, body)
+		if err != nil {
+			clog.Warningf("truncated journal: %v", err)
+			return n, nil
+		}
+		rec, ok := unmarshalJournalRecord(body)
+		if !ok || crc32.Checksum(body, journalTable) != binary.LittleEndian.Uint32(header[4:]) {
+			// Nothing after a record that didn't make it to disk whole
+			// was acknowledged.
+			clog.Warningf("corrupt journal record after %d records; ignoring the rest", n)
+			return n, nil
+		}
+		err = apply(rec)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// journal is the write-ahead log of a block store. Every record is written
+// to the file as it is appended, so that it survives the process crashing,
+// and synced according to the policy so that it survives the machine
+// crashing.
+type journal struct {
+	mut    sync.Mutex
+	file   *os.File
+	size   int64
+	seq    uint64
+	synced uint64
+
+	// syncMut is held while syncing. Writers waiting for it find their
+	// records synced by whoever held it before them, or sync everything
+	// appended so far themselves; that's the group commit.
+	syncMut sync.Mutex
+
+	name   string
+	policy torus.JournalSync
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func openJournal(path, name string, policy torus.JournalSync, interval time.Duration) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{
+		file:   f,
+		name:   name,
+		policy: policy,
+	}
+	if policy == torus.JournalInterval {
+		if interval == 0 {
+			interval = torus.DefaultJournalSyncInterval
+		}
+		j.stop = make(chan struct{})
+		j.done = make(chan struct{})
+		go j.syncEvery(interval)
+	}
+	return j, nil
+}
+
+// append writes a record to the journal and returns its sequence number, to
+// wait for with waitSync.
+func (j *journal) append(r *journalRecord) (uint64, error) {
+	buf := r.marshal()
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	_, err := j.file.Write(buf)
+	if err != nil {
+		promJournalErrors.WithLabelValues(j.name).Inc()
+		return 0, err
+	}
+	j.size += int64(len(buf))
+	j.seq++
+	promJournalRecords.WithLabelValues(j.name).Inc()
+	promJournalBytes.WithLabelValues(j.name).Add(float64(len(buf)))
+	return j.seq, nil
+}
+
+// waitSync returns once the record with sequence number seq, and everything
+// before it, is on disk.
+func (j *journal) waitSync(seq uint64) error {
+	j.syncMut.Lock()
+	defer j.syncMut.Unlock()
+	j.mut.Lock()
+	if j.synced >= seq {
+		j.mut.Unlock()
+		return nil
+	}
+	upto := j.seq
+	j.mut.Unlock()
+	return j.sync(upto)
+}
+
+// sync syncs the file, which holds every record up to upto. syncMut is
+// held.
+func (j *journal) sync(upto uint64) error {
+	start := time.Now()
+	err := j.file.Sync()
+	if err != nil {
+		promJournalErrors.WithLabelValues(j.name).Inc()
+		return err
+	}
+	promJournalSyncs.WithLabelValues(j.name).Inc()
+	promJournalSyncSeconds.WithLabelValues(j.name).Observe(time.Since(start).Seconds())
+	j.mut.Lock()
+	if upto > j.synced {
+		promJournalBatch.WithLabelValues(j.name).Observe(float64(upto - j.synced))
+		j.synced = upto
+	}
+	j.mut.Unlock()
+	return nil
+}
+
+func (j *journal) syncEvery(interval time.Duration) {
+	defer close(j.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-t.C:
+		}
+		j.mut.Lock()
+		upto := j.seq
+		j.mut.Unlock()
+		if err := j.waitSync(upto); err != nil {
+			clog.Errorf("couldn't sync journal for %s: %v", j.name, err)
+		}
+	}
+}
+
+// last returns the sequence number of the last record appended.
+func (j *journal) last() uint64 {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	return j.seq
+}
+
+func (j *journal) full() bool {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	return j.size >= journalCheckpointSize
+}
+
+// reset empties the journal, once everything in it is safely in the block
+// files.
+func (j *journal) reset() error {
+	j.syncMut.Lock()
+	defer j.syncMut.Unlock()
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	err := j.file.Truncate(0)
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		promJournalErrors.WithLabelValues(j.name).Inc()
+		return err
+	}
+	j.size = 0
+	j.synced = j.seq
+	promJournalCheckpoints.WithLabelValues(j.name).Inc()
+	return nil
+}
+
+func (j *journal) close() error {
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+	return j.file.Close()
+}
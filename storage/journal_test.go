@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func newJournalTestStore(t *testing.T, dir string, policy torus.JournalSync) *mfileBlock {
+	cfg := torus.Config{DataDir: dir, StorageSize: 256 * 1024, JournalSync: policy}
+	s, err := newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*mfileBlock)
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	s := newJournalTestStore(t, dir, torus.JournalAlways)
+	s.SetCompressionPolicy(func(torus.VolumeID) bool { return true })
+	a := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	b := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}
+	c := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 3}
+	bdata := bytes.Repeat([]byte("b"), 1024)
+	cdata := bytes.Repeat([]byte("compressible "), 78)
+	for _, x := range []struct {
+		ref  torus.BlockRef
+		data []byte
+	}{{a, []byte("a")}, {b, bdata}, {c, cdata}} {
+		if err := s.WriteBlock(ctx, x.ref, x.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.DeleteBlock(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteBuf(ctx, a); err != torus.ErrNotSupported {
+		t.Fatalf("expected WriteBuf to be unsupported with a journal, got %v", err)
+	}
+
+	// Crash, losing every write to the block files but keeping the
+	// journal, and with half a record at the end of it.
+	jpath := filepath.Join(dir, "block", "journal-test.log")
+	journal, err := ioutil.ReadFile(jpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	for _, kind := range []string{"data", "map", "crc", "comp", "enc"} {
+		if err := os.Remove(filepath.Join(dir, "block", fmt.Sprintf("%s-test.blk", kind))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	torn := (&journalRecord{op: journalPut, ref: a, data: []byte("lost")}).marshal()
+	journal = append(journal, torn[:len(torn)/2]...)
+	if err := ioutil.WriteFile(jpath, journal, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newJournalTestStore(t, dir, torus.JournalOff)
+	defer s.Close()
+	if ok, _ := s.HasBlock(ctx, a); ok {
+		t.Fatal("deleted block came back")
+	}
+	for _, x := range []struct {
+		ref  torus.BlockRef
+		data []byte
+	}{{b, bdata}, {c, padBlock(cdata, 1024)}} {
+		got, err := s.GetBlock(ctx, x.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, x.data) {
+			t.Fatalf("block %s differs after replay", x.ref)
+		}
+		if err := s.VerifyBlock(ctx, x.ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.UsedBlocks() != 2 {
+		t.Fatalf("expected 2 blocks after replay, got %d", s.UsedBlocks())
+	}
+	if _, err := os.Stat(jpath); !os.IsNotExist(err) {
+		t.Fatalf("expected the journal to be removed with journaling off, got %v", err)
+	}
+}
+
+func TestJournalConcurrentWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	s := newJournalTestStore(t, dir, torus.JournalAlways)
+	defer s.Close()
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 8; i++ {
+				ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, torus.INodeID(w)), Index: torus.IndexID(i)}
+				// Every block is written twice at once, and one of each
+				// pair has to give way.
+				var pair sync.WaitGroup
+				for k := 0; k < 2; k++ {
+					pair.Add(1)
+					go func() {
+						defer pair.Done()
+						if err := s.WriteBlock(ctx, ref, padBlock([]byte(ref.String()), 1024)); err != nil {
+							t.Error(err)
+						}
+					}()
+				}
+				pair.Wait()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if s.UsedBlocks() != 128 {
+		t.Fatalf("expected 128 blocks, got %d", s.UsedBlocks())
+	}
+	for w := 0; w < 16; w++ {
+		for i := 0; i < 8; i++ {
+			ref := torus.BlockRef{INodeRef: torus.NewINodeRef(1, torus.INodeID(w)), Index: torus.IndexID(i)}
+			got, err := s.GetBlock(ctx, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(got, []byte(ref.String())) {
+				t.Fatalf("block %s has the wrong data", ref)
+			}
+		}
+	}
+}
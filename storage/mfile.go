@@ -2,7 +2,10 @@ package storage
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 
 	"runtime"
@@ -14,7 +17,15 @@ import (
 	"github.com/coreos/torus"
 )
 
-var _ torus.BlockStore = &mfileBlock{}
+var (
+	_ torus.BlockStore      = &mfileBlock{}
+	_ torus.BlockVerifier   = &mfileBlock{}
+	_ torus.BlockCompressor = &mfileBlock{}
+	_ torus.BlockEncryptor  = &mfileBlock{}
+	_ torus.BlockWriterTo   = &mfileBlock{}
+
+	_ torus.BlockFileReporter = &mfileBlock{}
+)
 
 func init() {
 	torus.RegisterBlockStore("mfile", newMFileBlockStore)
@@ -22,19 +33,45 @@ func init() {
 
 type mfileBlock struct {
 	mut       sync.RWMutex
-	dataFile  *MFile
+	dataFile  blockFile
 	refFile   *MFile
+	crcFile   *MFile
+	compFile  *MFile
+	encFile   *MFile
 	refIndex  map[torus.BlockRef]int
 	closed    bool
 	lastFree  int
 	name      string
 	blocksize uint64
+	fileOpts  torus.BlockFileOptions
+
+	// pending are the indexes handed out by WriteBuf whose data may still be
+	// arriving. They're checksummed on the next flush.
+	pending map[int]bool
+
+	compress func(torus.VolumeID) bool
+	keyring  func(torus.VolumeID) (*torus.Keyring, error)
+
+	// journal, if the store has one, logs every change before it's made
+	// to the files. Changes are made in the order they were logged; applied
+	// is the last one made. reserved are the indexes of blocks logged but
+	// not written yet, and checkpointing holds new changes back while the
+	// files are synced and the journal emptied.
+	journal       *journal
+	applied       uint64
+	reserved      map[int]bool
+	checkpointing bool
+	cond          *sync.Cond
 
 	itPool sync.Pool
+	*hintLog
 	// NB: Still room for improvement. Free lists, smart allocation, etc.
 }
 
-var blankRefBytes = make([]byte, torus.BlockRefByteSize)
+var (
+	blankRefBytes = make([]byte, torus.BlockRefByteSize)
+	blankCRCEntry = make([]byte, crcEntrySize)
+)
 
 func loadIndex(m *MFile) (map[torus.BlockRef]int, error) {
 	clog.Infof("loading block index...")
@@ -72,35 +109,121 @@ func newMFileBlockStore(name string, cfg torus.Config, meta torus.GlobalMetadata
 
 	nBlocks := storageSize / meta.BlockSize
 	promBytesPerBlock.Set(float64(meta.BlockSize))
-	promBlocksAvail.WithLabelValues(name).Set(float64(nBlocks))
+	setTotalBlocks(name, nBlocks)
 	dpath := filepath.Join(cfg.DataDir, "block", fmt.Sprintf("data-%s.blk", name))
 	mpath := filepath.Join(cfg.DataDir, "block", fmt.Sprintf("map-%s.blk", name))
-	d, err := CreateOrOpenMFile(dpath, storageSize, meta.BlockSize)
+	cpath := filepath.Join(cfg.DataDir, "block", fmt.Sprintf("crc-%s.blk", name))
+	zpath := filepath.Join(cfg.DataDir, "block", fmt.Sprintf("comp-%s.blk", name))
+	epath := filepath.Join(cfg.DataDir, "block", fmt.Sprintf("enc-%s.blk", name))
+	paths := []string{dpath, mpath, cpath, zpath, epath}
+	sizes := []uint64{storageSize, nBlocks * torus.BlockRefByteSize, nBlocks * crcEntrySize, nBlocks * compEntrySize, nBlocks * encEntrySize}
+	for i, path := range paths {
+		err := createOrGrowFile(path, sizes[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	var opts torus.BlockFileOptions
+	if cfg.Preallocate {
+		opts.Preallocated = true
+		for _, path := range paths {
+			err := preallocateFile(path)
+			if err != nil {
+				clog.Warningf("couldn't preallocate %s, leaving it sparse: %v", path, err)
+				opts.Preallocated = false
+				break
+			}
+		}
+	}
+	var d blockFile
+	if cfg.DirectIO {
+		df, err := openDirectFile(dpath, meta.BlockSize)
+		if err == nil {
+			d = df
+			opts.DirectIO = true
+		} else {
+			clog.Warningf("couldn't open %s for direct I/O, using the page cache: %v", dpath, err)
+		}
+	}
+	if d == nil {
+		df, err := OpenMFile(dpath, meta.BlockSize)
+		if err != nil {
+			return nil, err
+		}
+		d = df
+	}
+	m, err := OpenMFile(mpath, torus.BlockRefByteSize)
+	if err != nil {
+		return nil, err
+	}
+	c, err := OpenMFile(cpath, crcEntrySize)
 	if err != nil {
 		return nil, err
 	}
-	m, err := CreateOrOpenMFile(mpath, nBlocks*torus.BlockRefByteSize, torus.BlockRefByteSize)
+	z, err := OpenMFile(zpath, compEntrySize)
 	if err != nil {
 		return nil, err
 	}
-	refIndex, err := loadIndex(m)
+	e, err := OpenMFile(epath, encEntrySize)
 	if err != nil {
 		return nil, err
 	}
 	if m.NumBlocks() != d.NumBlocks() {
 		panic("non-equal number of blocks between data and metadata")
 	}
-	promBlocks.WithLabelValues(name).Set(float64(len(refIndex)))
-	return &mfileBlock{
+	mb := &mfileBlock{
 		dataFile:  d,
 		refFile:   m,
-		refIndex:  refIndex,
+		crcFile:   c,
+		compFile:  z,
+		encFile:   e,
+		pending:   make(map[int]bool),
+		reserved:  make(map[int]bool),
 		name:      name,
 		blocksize: meta.BlockSize,
-	}, nil
+		fileOpts:  opts,
+	}
+	mb.cond = sync.NewCond(&mb.mut)
+	// Whatever the policy is now, redo what the journal of the last run
+	// holds; the files may not have all of it.
+	jpath := filepath.Join(cfg.DataDir, "block", fmt.Sprintf("journal-%s.log", name))
+	n, err := replayJournal(jpath, meta.BlockSize, mb.apply)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		clog.Infof("replayed %d journal records", n)
+		err = mb.syncFiles()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JournalSync != torus.JournalOff {
+		mb.journal, err = openJournal(jpath, name, cfg.JournalSync, cfg.JournalSyncInterval)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := os.Remove(jpath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	mb.refIndex, err = loadIndex(m)
+	if err != nil {
+		return nil, err
+	}
+	mb.hintLog, err = openHintLog(filepath.Join(cfg.DataDir, "block", fmt.Sprintf("hints-%s.log", name)))
+	if err != nil {
+		return nil, err
+	}
+	setUsedBlocks(name, len(mb.refIndex))
+	return mb, nil
 }
 
 func (m *mfileBlock) Kind() string { return "mfile" }
+
+// FileOptions implements torus.BlockFileReporter.
+func (m *mfileBlock) FileOptions() torus.BlockFileOptions {
+	return m.fileOpts
+}
 func (m *mfileBlock) NumBlocks() uint64 {
 	m.mut.RLock()
 	defer m.mut.RUnlock()
@@ -128,6 +251,13 @@ func (m *mfileBlock) Flush() error {
 }
 
 func (m *mfileBlock) flush() error {
+	for index := range m.pending {
+		m.crcFile.WriteBlock(uint64(index), crcEntry(blockCRC(m.dataFile.GetBlock(uint64(index)))))
+		delete(m.pending, index)
+	}
+	if m.journal != nil && !m.closed && m.journal.full() {
+		return m.checkpoint()
+	}
 	err := m.dataFile.Flush()
 
 	if err != nil {
@@ -137,6 +267,18 @@ func (m *mfileBlock) flush() error {
 	if err != nil {
 		return err
 	}
+	err = m.crcFile.Flush()
+	if err != nil {
+		return err
+	}
+	err = m.compFile.Flush()
+	if err != nil {
+		return err
+	}
+	err = m.encFile.Flush()
+	if err != nil {
+		return err
+	}
 	promStorageFlushes.WithLabelValues(m.name).Inc()
 	return nil
 }
@@ -152,6 +294,12 @@ func (m *mfileBlock) close() error {
 	if m.closed {
 		return nil
 	}
+	m.closed = true
+	if m.journal != nil {
+		for m.applied != m.journal.last() {
+			m.cond.Wait()
+		}
+	}
 	err := m.dataFile.Close()
 	if err != nil {
 		return err
@@ -160,7 +308,145 @@ func (m *mfileBlock) close() error {
 	if err != nil {
 		return err
 	}
-	m.closed = true
+	err = m.crcFile.Close()
+	if err != nil {
+		return err
+	}
+	err = m.compFile.Close()
+	if err != nil {
+		return err
+	}
+	err = m.encFile.Close()
+	if err != nil {
+		return err
+	}
+	if m.journal != nil {
+		// Closing synced the files, so the journal has nothing they don't.
+		err = m.journal.reset()
+		if err != nil {
+			return err
+		}
+		err = m.journal.close()
+		if err != nil {
+			return err
+		}
+	}
+	return m.closeHints()
+}
+
+// syncFiles writes the changes to the files to disk, and waits for them to
+// get there.
+func (m *mfileBlock) syncFiles() error {
+	for _, f := range []blockFile{m.dataFile, m.refFile, m.crcFile, m.compFile, m.encFile} {
+		err := f.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply makes the change a journal record describes to the files.
+func (m *mfileBlock) apply(r *journalRecord) error {
+	if r.index >= m.numBlocks() {
+		return errors.New("mfile: journal record past the end of the store")
+	}
+	if r.op == journalFree {
+		err := m.refFile.WriteBlock(r.index, blankRefBytes)
+		if err != nil {
+			return err
+		}
+		err = m.crcFile.WriteBlock(r.index, blankCRCEntry)
+		if err != nil || m.fileOpts.Preallocated {
+			return err
+		}
+		// Give the freed block's space back to the filesystem.
+		return m.dataFile.WriteBlockSparse(r.index, nil)
+	}
+	var err error
+	// Holes in a preallocated file would only fragment it again.
+	if codec, _ := parseCompEntry(r.comp); codec == codecZstd && !m.fileOpts.Preallocated {
+		err = m.dataFile.WriteBlockSparse(r.index, r.data)
+	} else {
+		err = m.dataFile.WriteBlock(r.index, r.data)
+	}
+	if err != nil {
+		return err
+	}
+	err = m.compFile.WriteBlock(r.index, r.comp)
+	if err != nil {
+		return err
+	}
+	err = m.encFile.WriteBlock(r.index, r.enc)
+	if err != nil {
+		return err
+	}
+	err = m.crcFile.WriteBlock(r.index, r.crc)
+	if err != nil {
+		return err
+	}
+	return m.refFile.WriteBlock(r.index, r.ref.ToBytes())
+}
+
+// commit makes a change to the files, logging it first if there's a
+// journal. m.mut is held. Under JournalAlways it's let go while the journal
+// syncs, so that other writes can share the sync, and so the index the
+// change is to must be kept from other writes meanwhile.
+func (m *mfileBlock) commit(r *journalRecord) error {
+	if m.journal == nil {
+		return m.apply(r)
+	}
+	for m.checkpointing {
+		m.cond.Wait()
+	}
+	if m.closed {
+		return torus.ErrClosed
+	}
+	seq, err := m.journal.append(r)
+	if err != nil {
+		return err
+	}
+	if m.journal.policy == torus.JournalAlways {
+		m.mut.Unlock()
+		err = m.journal.waitSync(seq)
+		m.mut.Lock()
+		// Make the changes in the order they were logged, so the files
+		// end up as replaying the journal would leave them.
+		for m.applied != seq-1 {
+			m.cond.Wait()
+		}
+	}
+	if err == nil {
+		err = m.apply(r)
+	}
+	m.applied = seq
+	m.cond.Broadcast()
+	return err
+}
+
+// checkpoint syncs the files and empties the journal, once every change
+// logged in it is made.
+func (m *mfileBlock) checkpoint() error {
+	if m.checkpointing {
+		return nil
+	}
+	m.checkpointing = true
+	defer func() {
+		m.checkpointing = false
+		m.cond.Broadcast()
+	}()
+	for m.applied != m.journal.last() {
+		m.cond.Wait()
+	}
+	err := m.syncFiles()
+	if err != nil {
+		return err
+	}
+	err = m.journal.reset()
+	if err != nil {
+		return err
+	}
+	promStorageFlushes.WithLabelValues(m.name).Inc()
 	return nil
 }
 
@@ -178,7 +464,7 @@ func (m *mfileBlock) findEmpty() int {
 	emptyBlock := make([]byte, torus.BlockRefByteSize)
 	for i := uint64(0); i < m.numBlocks(); i++ {
 		b := m.refFile.GetBlock((i + uint64(m.lastFree) + 1) % m.numBlocks())
-		if bytes.Equal(b, emptyBlock) {
+		if bytes.Equal(b, emptyBlock) && !m.reserved[int((i+uint64(m.lastFree)+1)%m.numBlocks())] {
 			m.lastFree = int((i + uint64(m.lastFree) + 1) % m.numBlocks())
 			return m.lastFree
 		}
@@ -196,30 +482,274 @@ func (m *mfileBlock) HasBlock(_ context.Context, s torus.BlockRef) (bool, error)
 	return true, nil
 }
 
-func (m *mfileBlock) GetBlock(_ context.Context, s torus.BlockRef) ([]byte, error) {
+func (m *mfileBlock) GetBlock(ctx context.Context, s torus.BlockRef) (_ []byte, err error) {
+	_, span := torus.StartSpan(ctx, "disk.GetBlock", torus.AttrBlock.String(s.String()))
+	defer func() { torus.EndSpan(span, err) }()
+	kr, err := m.volumeKeyring(s.Volume())
+	if err != nil {
+		promBlocksFailed.WithLabelValues(m.name).Inc()
+		return nil, err
+	}
+	data, stale, err := m.getBlock(s, kr)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		m.reencrypt(s, kr)
+	}
+	return data, nil
+}
+
+// getBlock reads a block, and says whether it should be encrypted under the
+// volume's current key but isn't.
+func (m *mfileBlock) getBlock(s torus.BlockRef, kr *torus.Keyring) ([]byte, bool, error) {
 	m.mut.RLock()
 	defer m.mut.RUnlock()
 	if m.closed {
 		promBlocksFailed.WithLabelValues(m.name).Inc()
-		return nil, torus.ErrClosed
+		return nil, false, torus.ErrClosed
 	}
 	index := m.findIndex(s)
 	if index == -1 {
 		promBlocksFailed.WithLabelValues(m.name).Inc()
-		return nil, torus.ErrBlockNotExist
+		return nil, false, torus.ErrBlockNotExist
 	}
 	clog.Tracef("mfile: getting block at index %d", index)
+	data, err := m.readBlock(index, s, kr)
+	if err == nil && !m.pending[index] {
+		expected, ok := parseCRCEntry(m.crcFile.GetBlock(uint64(index)))
+		if ok && blockCRC(data) != expected {
+			err = torus.ErrBlockCorrupt
+		}
+	}
+	if err == torus.ErrKeyUnavailable {
+		promBlocksFailed.WithLabelValues(m.name).Inc()
+		return nil, false, err
+	}
+	if err != nil {
+		promBlocksCorrupt.WithLabelValues(m.name).Inc()
+		promBlocksFailed.WithLabelValues(m.name).Inc()
+		return nil, false, torus.ErrBlockCorrupt
+	}
+	promBlocksRetrieved.WithLabelValues(m.name).Inc()
+	stale := false
+	if kr != nil && !m.pending[index] {
+		version, ok := parseEncEntry(m.encFile.GetBlock(uint64(index)))
+		stale = !ok || version != kr.Current
+	}
+	if stale {
+		// It's about to be encrypted in place.
+		data = append([]byte(nil), data...)
+	}
+	return data, stale, nil
+}
+
+// WriteBlockTo writes a block that's stored as written straight from the
+// mapping of the data file to w. The store stays read-locked until w has
+// taken it, so that the block can't be overwritten underneath it.
+func (m *mfileBlock) WriteBlockTo(ctx context.Context, s torus.BlockRef, w io.Writer) error {
+	kr, err := m.volumeKeyring(s.Volume())
+	if err != nil {
+		return err
+	}
+	if kr != nil {
+		return torus.ErrNotSupported
+	}
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	if m.closed {
+		return torus.ErrClosed
+	}
+	index := m.findIndex(s)
+	if index == -1 {
+		return torus.ErrBlockNotExist
+	}
+	if m.pending[index] {
+		return torus.ErrNotSupported
+	}
+	if _, ok := parseEncEntry(m.encFile.GetBlock(uint64(index))); ok {
+		return torus.ErrNotSupported
+	}
+	data, codec, err := m.storedBytes(index)
+	if err == nil && codec != codecRaw {
+		return torus.ErrNotSupported
+	}
+	if err == nil {
+		expected, ok := parseCRCEntry(m.crcFile.GetBlock(uint64(index)))
+		if ok && blockCRC(data) != expected {
+			err = torus.ErrBlockCorrupt
+		}
+	}
+	if err != nil {
+		promBlocksCorrupt.WithLabelValues(m.name).Inc()
+		promBlocksFailed.WithLabelValues(m.name).Inc()
+		return torus.ErrBlockCorrupt
+	}
 	promBlocksRetrieved.WithLabelValues(m.name).Inc()
-	return m.dataFile.GetBlock(uint64(index)), nil
+	_, err = w.Write(data)
+	return err
+}
+
+// storedBytes returns the bytes of the block at index as they are stored,
+// that is, compressed and encrypted if it is, and its compression codec.
+func (m *mfileBlock) storedBytes(index int) ([]byte, byte, error) {
+	data := m.dataFile.GetBlock(uint64(index))
+	if data == nil {
+		// It couldn't be read.
+		return nil, codecRaw, torus.ErrBlockCorrupt
+	}
+	codec, n := parseCompEntry(m.compFile.GetBlock(uint64(index)))
+	switch codec {
+	case codecRaw:
+		return data, codec, nil
+	case codecZstd:
+		if uint64(n) > m.blocksize {
+			return nil, codec, torus.ErrBlockCorrupt
+		}
+		return data[:n], codec, nil
+	}
+	return nil, codec, torus.ErrBlockCorrupt
+}
+
+// readBlock returns the block stored at index as it was written.
+func (m *mfileBlock) readBlock(index int, s torus.BlockRef, kr *torus.Keyring) ([]byte, error) {
+	data, codec, err := m.storedBytes(index)
+	if err != nil {
+		return nil, err
+	}
+	entry := m.encFile.GetBlock(uint64(index))
+	if _, ok := parseEncEntry(entry); ok {
+		data, err = openBlock(kr, s, entry, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if codec == codecZstd {
+		return decompressBlock(data, m.blocksize)
+	}
+	return data, nil
 }
 
-func (m *mfileBlock) WriteBlock(_ context.Context, s torus.BlockRef, data []byte) error {
+// reencrypt encrypts a block in place under its volume's current key, if it
+// isn't already.
+func (m *mfileBlock) reencrypt(s torus.BlockRef, kr *torus.Keyring) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	index := m.findIndex(s)
+	if index == -1 || m.pending[index] {
+		return
+	}
+	entry := m.encFile.GetBlock(uint64(index))
+	version, ok := parseEncEntry(entry)
+	if ok && version == kr.Current {
+		return
+	}
+	stored, _, err := m.storedBytes(index)
+	if err != nil {
+		return
+	}
+	plain := stored
+	if ok {
+		plain, err = openBlock(kr, s, entry, stored)
+		if err != nil {
+			return
+		}
+	}
+	sealed, newEntry, err := sealBlock(kr, s, plain)
+	if err != nil {
+		clog.Errorf("mfile: couldn't re-encrypt block %s: %v", s, err)
+		return
+	}
+	err = m.commit(&journalRecord{
+		op:    journalPut,
+		index: uint64(index),
+		ref:   s,
+		comp:  append([]byte(nil), m.compFile.GetBlock(uint64(index))...),
+		enc:   newEntry,
+		crc:   append([]byte(nil), m.crcFile.GetBlock(uint64(index))...),
+		data:  sealed,
+	})
+	if err != nil {
+		clog.Errorf("mfile: couldn't re-encrypt block %s: %v", s, err)
+		return
+	}
+	promBlocksReencrypted.WithLabelValues(m.name).Inc()
+}
+
+// SetKeyringFunc implements torus.BlockEncryptor.
+func (m *mfileBlock) SetKeyringFunc(f func(torus.VolumeID) (*torus.Keyring, error)) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.keyring = f
+}
+
+func (m *mfileBlock) volumeKeyring(vid torus.VolumeID) (*torus.Keyring, error) {
+	m.mut.RLock()
+	f := m.keyring
+	m.mut.RUnlock()
+	if f == nil {
+		return nil, nil
+	}
+	return f(vid)
+}
+
+// SetCompressionPolicy implements torus.BlockCompressor.
+func (m *mfileBlock) SetCompressionPolicy(f func(torus.VolumeID) bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.compress = f
+}
+
+func (m *mfileBlock) WriteBlock(ctx context.Context, s torus.BlockRef, data []byte) (err error) {
+	_, span := torus.StartSpan(ctx, "disk.WriteBlock", torus.AttrBlock.String(s.String()))
+	defer func() { torus.EndSpan(span, err) }()
+	// Do the compression and encryption before taking the lock; the
+	// policies may ask the MDS.
+	m.mut.RLock()
+	compress := m.compress
+	m.mut.RUnlock()
+	if uint64(len(data)) > m.blocksize {
+		promBlockWritesFailed.WithLabelValues(m.name).Inc()
+		return errors.New("mfile: block too large")
+	}
+	var packed []byte
+	if compress != nil && compress(s.Volume()) {
+		packed = compressBlock(data)
+		if packed == nil {
+			promBlocksIncompressible.WithLabelValues(m.name).Inc()
+		}
+	}
+	kr, err := m.volumeKeyring(s.Volume())
+	if err != nil {
+		promBlockWritesFailed.WithLabelValues(m.name).Inc()
+		return err
+	}
+	stored := data
+	if packed != nil {
+		stored = packed
+	}
+	encEntry := blankEncEntry
+	if kr != nil {
+		if packed == nil {
+			stored = padBlock(data, m.blocksize)
+		}
+		stored, encEntry, err = sealBlock(kr, s, stored)
+		if err != nil {
+			promBlockWritesFailed.WithLabelValues(m.name).Inc()
+			return err
+		}
+	}
 	m.mut.Lock()
 	defer m.mut.Unlock()
 	if m.closed {
 		promBlockWritesFailed.WithLabelValues(m.name).Inc()
 		return torus.ErrClosed
 	}
+	if v := m.findIndex(s); v != -1 {
+		// Not an error, if we already have it
+		clog.Debug("mfile: block already exists: ", s)
+		return m.sameBlock(v, s, kr, data)
+	}
 	index := m.findEmpty()
 	if index == -1 {
 		clog.Error("mfile: out of space")
@@ -227,35 +757,77 @@ func (m *mfileBlock) WriteBlock(_ context.Context, s torus.BlockRef, data []byte
 		return torus.ErrOutOfSpace
 	}
 	clog.Tracef("mfile: writing block at index %d", index)
-	err := m.dataFile.WriteBlock(uint64(index), data)
-	if err != nil {
-		promBlockWritesFailed.WithLabelValues(m.name).Inc()
-		return err
-	}
-	err = m.refFile.WriteBlock(uint64(index), s.ToBytes())
+	entry := blankCompEntry
+	if packed != nil {
+		entry = compEntry(codecZstd, len(packed))
+	}
+	// The checksum is always of the block as written, so that it's the
+	// same on every replica however each stores it.
+	sum := blockCRC(padBlock(data, m.blocksize))
+	m.reserved[index] = true
+	err = m.commit(&journalRecord{
+		op:    journalPut,
+		index: uint64(index),
+		ref:   s,
+		comp:  entry,
+		enc:   encEntry,
+		crc:   crcEntry(sum),
+		data:  stored,
+	})
+	delete(m.reserved, index)
 	if err != nil {
 		promBlockWritesFailed.WithLabelValues(m.name).Inc()
 		return err
 	}
 	if v := m.findIndex(s); v != -1 {
-		// we already have it
-		clog.Debug("mfile: block already exists: ", s)
-		olddata := m.dataFile.GetBlock(uint64(v))
-		if !bytes.Equal(olddata, data) {
-			clog.Error("getting wrong data for block: ", s)
-			clog.Errorf("%s, %s", olddata[:10], data[:10])
-			return torus.ErrExists
+		// Someone else wrote it while the journal synced.
+		err = m.commit(&journalRecord{op: journalFree, index: uint64(index), ref: s})
+		if err != nil {
+			promBlockWritesFailed.WithLabelValues(m.name).Inc()
+			return err
 		}
-		// Not an error, if we already have it
-		return nil
+		return m.sameBlock(v, s, kr, data)
+	}
+	if kr != nil {
+		promBlocksEncrypted.WithLabelValues(m.name).Inc()
 	}
-	promBlocks.WithLabelValues(m.name).Inc()
+	if packed != nil {
+		promBlocksCompressed.WithLabelValues(m.name).Inc()
+		promCompressionSavedBytes.WithLabelValues(m.name).Add(float64(m.blocksize) - float64(len(packed)))
+	}
+	addUsedBlocks(m.name, 1)
 	m.refIndex[s] = index
 	promBlocksWritten.WithLabelValues(m.name).Inc()
 	return nil
 }
 
+// sameBlock checks that the block stored at index is data.
+func (m *mfileBlock) sameBlock(index int, s torus.BlockRef, kr *torus.Keyring, data []byte) error {
+	olddata, err := m.readBlock(index, s, kr)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(olddata, data) {
+		clog.Error("getting wrong data for block: ", s)
+		clog.Errorf("%s, %s", olddata[:10], data[:10])
+		return torus.ErrExists
+	}
+	return nil
+}
+
 func (m *mfileBlock) WriteBuf(_ context.Context, s torus.BlockRef) ([]byte, error) {
+	// Blocks written straight to the map would be in the clear, and
+	// wouldn't be in the journal. With direct I/O, there's no map.
+	if m.journal != nil || m.fileOpts.DirectIO {
+		return nil, torus.ErrNotSupported
+	}
+	kr, err := m.volumeKeyring(s.Volume())
+	if err != nil {
+		return nil, err
+	}
+	if kr != nil {
+		return nil, torus.ErrNotSupported
+	}
 	m.mut.Lock()
 	defer m.mut.Unlock()
 	if m.closed {
@@ -270,7 +842,17 @@ func (m *mfileBlock) WriteBuf(_ context.Context, s torus.BlockRef) ([]byte, erro
 	}
 	clog.Tracef("mfile: writing block at index %d", index)
 	buf := m.dataFile.GetBlock(uint64(index))
-	err := m.refFile.WriteBlock(uint64(index), s.ToBytes())
+	err = m.compFile.WriteBlock(uint64(index), blankCompEntry)
+	if err != nil {
+		promBlockWritesFailed.WithLabelValues(m.name).Inc()
+		return nil, err
+	}
+	err = m.encFile.WriteBlock(uint64(index), blankEncEntry)
+	if err != nil {
+		promBlockWritesFailed.WithLabelValues(m.name).Inc()
+		return nil, err
+	}
+	err = m.refFile.WriteBlock(uint64(index), s.ToBytes())
 	if err != nil {
 		promBlockWritesFailed.WithLabelValues(m.name).Inc()
 		return nil, err
@@ -281,8 +863,9 @@ func (m *mfileBlock) WriteBuf(_ context.Context, s torus.BlockRef) ([]byte, erro
 		// Not an error, if we already have it
 		return nil, torus.ErrExists
 	}
-	promBlocks.WithLabelValues(m.name).Inc()
+	addUsedBlocks(m.name, 1)
 	m.refIndex[s] = index
+	m.pending[index] = true
 	promBlocksWritten.WithLabelValues(m.name).Inc()
 	return buf, nil
 }
@@ -300,17 +883,64 @@ func (m *mfileBlock) DeleteBlock(_ context.Context, s torus.BlockRef) error {
 		clog.Errorf("mfile: deleting non-existent thing? %s", s)
 		return torus.ErrBlockNotExist
 	}
-	err := m.refFile.WriteBlock(uint64(index), blankRefBytes)
+	delete(m.refIndex, s)
+	err := m.commit(&journalRecord{op: journalFree, index: uint64(index), ref: s})
 	if err != nil {
+		if _, ok := m.refIndex[s]; !ok {
+			m.refIndex[s] = index
+		}
 		promBlockDeletesFailed.WithLabelValues(m.name).Inc()
 		return err
 	}
-	promBlocks.WithLabelValues(m.name).Dec()
-	delete(m.refIndex, s)
+	addUsedBlocks(m.name, -1)
+	delete(m.pending, index)
 	promBlocksDeleted.WithLabelValues(m.name).Inc()
 	return nil
 }
 
+func (m *mfileBlock) VerifyBlock(ctx context.Context, s torus.BlockRef) error {
+	_, err := m.GetBlockChecksum(ctx, s)
+	return err
+}
+
+func (m *mfileBlock) GetBlockChecksum(_ context.Context, s torus.BlockRef) (uint32, error) {
+	kr, err := m.volumeKeyring(s.Volume())
+	if err != nil {
+		return 0, err
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.closed {
+		return 0, torus.ErrClosed
+	}
+	index := m.findIndex(s)
+	if index == -1 {
+		return 0, torus.ErrBlockNotExist
+	}
+	data, err := m.readBlock(index, s, kr)
+	if err == torus.ErrKeyUnavailable {
+		return 0, err
+	}
+	if err != nil {
+		promBlocksCorrupt.WithLabelValues(m.name).Inc()
+		return 0, torus.ErrBlockCorrupt
+	}
+	sum := blockCRC(data)
+	if m.pending[index] {
+		// Checksummed on the next flush.
+		return sum, nil
+	}
+	expected, ok := parseCRCEntry(m.crcFile.GetBlock(uint64(index)))
+	if !ok {
+		return sum, m.crcFile.WriteBlock(uint64(index), crcEntry(sum))
+	}
+	if sum != expected {
+		promBlocksCorrupt.WithLabelValues(m.name).Inc()
+		return 0, torus.ErrBlockCorrupt
+	}
+	return sum, nil
+}
+
 func (m *mfileBlock) BlockIterator() torus.BlockIterator {
 	m.mut.RLock()
 	defer m.mut.RUnlock()
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/coreos/torus"
+)
+
+func TestMFileWriteBlockTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torus-writeto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "block"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const blocksize = 64 * 1024
+	cfg := torus.Config{DataDir: dir, StorageSize: 4 * blocksize}
+	s, err := newMFileBlockStore("test", cfg, torus.GlobalMetadata{BlockSize: blocksize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := s.(*mfileBlock)
+	defer m.Close()
+	m.SetCompressionPolicy(func(vid torus.VolumeID) bool { return vid == 2 })
+	ctx := context.TODO()
+
+	raw := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 1}
+	noise := make([]byte, blocksize)
+	rand.New(rand.NewSource(1)).Read(noise)
+	packed := torus.BlockRef{INodeRef: torus.NewINodeRef(2, 1), Index: 1}
+	text := bytes.Repeat([]byte("All work and no play makes Jack a dull boy.\n"), 1000)
+	for ref, data := range map[torus.BlockRef][]byte{raw: noise, packed: text} {
+		err := m.WriteBlock(ctx, ref, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	err = m.WriteBlockTo(ctx, raw, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), noise) {
+		t.Fatal("wrote different data")
+	}
+
+	// Compressed blocks have to be read with GetBlock.
+	buf.Reset()
+	err = m.WriteBlockTo(ctx, packed, &buf)
+	if err != torus.ErrNotSupported || buf.Len() != 0 {
+		t.Fatalf("expected ErrNotSupported and nothing written, got %v and %d bytes", err, buf.Len())
+	}
+	missing := torus.BlockRef{INodeRef: torus.NewINodeRef(1, 1), Index: 2}
+	err = m.WriteBlockTo(ctx, missing, &buf)
+	if err != torus.ErrBlockNotExist {
+		t.Fatalf("expected ErrBlockNotExist, got %v", err)
+	}
+
+	// Nor are rotten blocks sent on.
+	copy(m.dataFile.GetBlock(uint64(m.findIndex(raw))), "rot")
+	err = m.WriteBlockTo(ctx, raw, &buf)
+	if err != torus.ErrBlockCorrupt || buf.Len() != 0 {
+		t.Fatalf("expected ErrBlockCorrupt and nothing written, got %v and %d bytes", err, buf.Len())
+	}
+}
@@ -12,24 +12,48 @@ type MFile struct {
 	mmap    mmap.MMap
 	blkSize uint64
 	size    uint64
+	// file is kept open only to give unused parts of blocks back to the
+	// filesystem; see WriteBlockSparse.
+	file *os.File
 }
 
 func CreateOrOpenMFile(path string, size uint64, blkSize uint64) (*MFile, error) {
+	err := createOrGrowFile(path, size)
+	if err != nil {
+		return nil, err
+	}
+	return OpenMFile(path, blkSize)
+}
+
+// createOrGrowFile makes the file at path size bytes long, creating it if
+// it doesn't exist. It can't shrink.
+func createOrGrowFile(path string, size uint64) error {
 	finfo, err := os.Stat(path)
 	if os.IsNotExist(err) {
-		err := CreateMFile(path, size)
-		if err != nil {
-			return nil, err
-		}
+		return CreateMFile(path, size)
 	}
 	if finfo != nil && finfo.Size() != int64(size) {
 		if finfo.Size() > int64(size) {
-			return nil, fmt.Errorf("Specified size %d is smaller than current size %d.", size, finfo.Size())
+			return fmt.Errorf("Specified size %d is smaller than current size %d.", size, finfo.Size())
 		}
 		clog.Debugf("mfile: expand %s %d to %d", path, finfo.Size(), size)
 		os.Truncate(path, int64(size))
 	}
-	return OpenMFile(path, blkSize)
+	return nil
+}
+
+// preallocateFile allocates the whole of the file at path on disk.
+func preallocateFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return preallocate(f, st.Size())
 }
 
 func CreateMFile(path string, size uint64) error {
@@ -48,23 +72,25 @@ func OpenMFile(path string, blkSize uint64) (*MFile, error) {
 	if err != nil {
 		return nil, err
 	}
-	// We don't need the file handle after we mmap it.
+	// The mapping doesn't need the file handle, but punching holes does.
 	// See http://stackoverflow.com/questions/17490033/do-i-need-to-keep-a-file-open-after-calling-mmap-on-it.
-	defer f.Close()
-
 	st, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 	mf.size = uint64(st.Size())
 	if mf.size%blkSize != 0 {
+		f.Close()
 		return nil, fmt.Errorf("File size is not a multiple of the block size: %d size, %d blksize", mf.size, blkSize)
 	}
 	mf.mmap, err = mmap.Map(f, mmap.RDWR, 0)
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 	mf.blkSize = blkSize
+	mf.file = f
 	return &mf, nil
 }
 
@@ -105,15 +131,51 @@ func (m *MFile) WriteBlock(n uint64, data []byte) error {
 	return nil
 }
 
+// WriteBlockSparse writes data to the n-th block like WriteBlock, but gives
+// the whole pages after it back to the filesystem where it supports that, so
+// that a short block takes less space on disk.
+func (m *MFile) WriteBlockSparse(n uint64, data []byte) error {
+	if uint64(len(data)) > m.blkSize {
+		return errors.New("Data block too large")
+	}
+	blk := m.GetBlock(n)
+	if blk == nil {
+		return errors.New("Offset too large")
+	}
+	copy(blk, data)
+	start := n*m.blkSize + uint64(len(data))
+	end := (n + 1) * m.blkSize
+	page := uint64(os.Getpagesize())
+	holeStart := (start + page - 1) / page * page
+	holeEnd := end / page * page
+	if holeStart >= holeEnd || punchHole(m.file, int64(holeStart), int64(holeEnd-holeStart)) != nil {
+		zero(blk[len(data):])
+		return nil
+	}
+	base := n * m.blkSize
+	zero(blk[start-base : holeStart-base])
+	zero(blk[holeEnd-base:])
+	return nil
+}
+
 func (m *MFile) Flush() error {
 	return m.mmap.FlushAsync()
 }
 
+// Sync writes the changes to the file to disk, and waits for them to get
+// there.
+func (m *MFile) Sync() error {
+	return m.mmap.Flush()
+}
+
 func (m *MFile) Close() error {
 	if err := m.mmap.Flush(); err != nil {
 		return err
 	}
-	return m.mmap.Unmap()
+	if err := m.mmap.Unmap(); err != nil {
+		return err
+	}
+	return m.file.Close()
 }
 
 func zero(b []byte) {
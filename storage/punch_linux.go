@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	fallocKeepSize  = 0x01
+	fallocPunchHole = 0x02
+)
+
+// punchHole deallocates n bytes of f at off. They read back as zeros.
+func punchHole(f *os.File, off, n int64) error {
+	return syscall.Fallocate(int(f.Fd()), fallocKeepSize|fallocPunchHole, off, n)
+}
+
+// preallocate allocates the first n bytes of f on disk, without changing
+// what they read back as.
+func preallocate(f *os.File, n int64) error {
+	return syscall.Fallocate(int(f.Fd()), 0, 0, n)
+}
+
+func openDirect(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|syscall.O_DIRECT, 0644)
+}
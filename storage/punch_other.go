@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// Punching holes, preallocating and direct I/O are only supported on Linux.
+// Elsewhere the caller zeroes the range, leaves the file sparse, or goes
+// through the page cache instead.
+func punchHole(f *os.File, off, n int64) error {
+	return errors.New("punching holes is not supported on this platform")
+}
+
+func preallocate(f *os.File, n int64) error {
+	return errors.New("preallocating files is not supported on this platform")
+}
+
+func openDirect(path string) (*os.File, error) {
+	return nil, errors.New("direct I/O is not supported on this platform")
+}
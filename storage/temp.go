@@ -8,7 +8,10 @@ import (
 	"github.com/coreos/torus"
 )
 
-var _ torus.BlockStore = &tempBlockStore{}
+var (
+	_ torus.BlockStore    = &tempBlockStore{}
+	_ torus.BlockVerifier = &tempBlockStore{}
+)
 
 func init() {
 	torus.RegisterBlockStore("temp", openTempBlockStore)
@@ -17,21 +20,25 @@ func init() {
 type tempBlockStore struct {
 	mut       sync.RWMutex
 	store     map[torus.BlockRef][]byte
+	crcs      map[torus.BlockRef]uint32
 	nBlocks   uint64
 	name      string
 	blockSize uint64
+	*hintLog
 }
 
 func openTempBlockStore(name string, cfg torus.Config, gmd torus.GlobalMetadata) (torus.BlockStore, error) {
 	nBlocks := cfg.StorageSize / gmd.BlockSize
-	promBlocksAvail.WithLabelValues(name).Set(float64(nBlocks))
-	promBlocks.WithLabelValues(name).Set(0)
+	setTotalBlocks(name, nBlocks)
+	setUsedBlocks(name, 0)
 	promBytesPerBlock.Set(float64(gmd.BlockSize))
 	return &tempBlockStore{
 		store:     make(map[torus.BlockRef][]byte),
+		crcs:      make(map[torus.BlockRef]uint32),
 		nBlocks:   nBlocks,
 		name:      name,
 		blockSize: gmd.BlockSize,
+		hintLog:   newMemoryHintLog(),
 	}, nil
 }
 
@@ -81,6 +88,11 @@ func (t *tempBlockStore) GetBlock(_ context.Context, s torus.BlockRef) ([]byte,
 		promBlocksFailed.WithLabelValues(t.name).Inc()
 		return nil, torus.ErrBlockNotExist
 	}
+	if expected, ok := t.crcs[s]; ok && blockCRC(x) != expected {
+		promBlocksCorrupt.WithLabelValues(t.name).Inc()
+		promBlocksFailed.WithLabelValues(t.name).Inc()
+		return nil, torus.ErrBlockCorrupt
+	}
 	promBlocksRetrieved.WithLabelValues(t.name).Inc()
 	return x, nil
 }
@@ -99,7 +111,8 @@ func (t *tempBlockStore) WriteBlock(_ context.Context, s torus.BlockRef, data []
 	buf := make([]byte, len(data))
 	copy(buf, data)
 	t.store[s] = buf
-	promBlocks.WithLabelValues(t.name).Set(float64(len(t.store)))
+	t.crcs[s] = blockCRC(buf)
+	setUsedBlocks(t.name, len(t.store))
 	promBlocksWritten.WithLabelValues(t.name).Inc()
 	return nil
 }
@@ -117,7 +130,9 @@ func (t *tempBlockStore) WriteBuf(_ context.Context, s torus.BlockRef) ([]byte,
 	}
 	buf := make([]byte, t.blockSize)
 	t.store[s] = buf
-	promBlocks.WithLabelValues(t.name).Set(float64(len(t.store)))
+	// The data isn't here yet; it's checksummed when first verified.
+	delete(t.crcs, s)
+	setUsedBlocks(t.name, len(t.store))
 	promBlocksWritten.WithLabelValues(t.name).Inc()
 	return buf, nil
 }
@@ -132,11 +147,41 @@ func (t *tempBlockStore) DeleteBlock(_ context.Context, s torus.BlockRef) error
 	}
 
 	delete(t.store, s)
-	promBlocks.WithLabelValues(t.name).Set(float64(len(t.store)))
+	delete(t.crcs, s)
+	setUsedBlocks(t.name, len(t.store))
 	promBlocksDeleted.WithLabelValues(t.name).Inc()
 	return nil
 }
 
+func (t *tempBlockStore) VerifyBlock(ctx context.Context, s torus.BlockRef) error {
+	_, err := t.GetBlockChecksum(ctx, s)
+	return err
+}
+
+func (t *tempBlockStore) GetBlockChecksum(_ context.Context, s torus.BlockRef) (uint32, error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if t.store == nil {
+		return 0, torus.ErrClosed
+	}
+	x, ok := t.store[s]
+	if !ok {
+		return 0, torus.ErrBlockNotExist
+	}
+	sum := blockCRC(x)
+	expected, ok := t.crcs[s]
+	if !ok {
+		t.crcs[s] = sum
+		return sum, nil
+	}
+	if sum != expected {
+		promBlocksCorrupt.WithLabelValues(t.name).Inc()
+		return 0, torus.ErrBlockCorrupt
+	}
+	return sum, nil
+}
+
 func (t *tempBlockStore) BlockIterator() torus.BlockIterator {
 	t.mut.RLock()
 	defer t.mut.RUnlock()
@@ -0,0 +1,16 @@
+package torus
+
+// BlockFileOptions says how a block store uses the files it's kept in.
+type BlockFileOptions struct {
+	// DirectIO is set if blocks are read and written around the page
+	// cache.
+	DirectIO bool
+	// Preallocated is set if the files were allocated on disk in full.
+	Preallocated bool
+}
+
+// BlockFileReporter is implemented by block stores kept in files, so that
+// peers can report how their storage is set up.
+type BlockFileReporter interface {
+	FileOptions() BlockFileOptions
+}
@@ -0,0 +1,39 @@
+package torus_test
+
+import (
+	"testing"
+
+	"github.com/coreos/torus"
+)
+
+func TestBlockRefString(t *testing.T) {
+	inode := torus.NewINodeRef(5, 3)
+	block := torus.BlockRef{INodeRef: inode, Index: 17}
+	meta := block
+	meta.SetBlockType(torus.TypeINode)
+	tests := []struct {
+		ref  torus.BlockRef
+		want string
+	}{
+		{block, "5:3:17"},
+		{meta, "5:3:17/inode"},
+		{torus.ShardRef(inode, 1, 2, 3), "5:3:4294967811/shard"},
+		{torus.BlockRef{INodeRef: torus.NewINodeRef(torus.VolumeMax-1, 1<<63), Index: 1<<64 - 1}, "1099511627774:9223372036854775808:18446744073709551615"},
+	}
+	for _, tt := range tests {
+		if got := tt.ref.String(); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+		ref, err := torus.ParseBlockRef(tt.want)
+		if err != nil {
+			t.Errorf("%s: %v", tt.want, err)
+		} else if ref != tt.ref {
+			t.Errorf("%s: parsed as %s", tt.want, ref)
+		}
+	}
+	for _, s := range []string{"", "5:3", "5:3:17:1", "5:3:x", "5:3:17/", "5:3:17/parity", "-1:3:17", "1099511627775:1:1"} {
+		if ref, err := torus.ParseBlockRef(s); err == nil {
+			t.Errorf("%q: expected an error, got %s", s, ref)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package torus
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/torus/models"
+)
+
+// How long a server trusts a volume's quota check before checking again.
+var tenantQuotaTTL = 30 * time.Second
+
+// TenantQuota limits the total provisioned size of all of a tenant's volumes.
+// Zero means no limit.
+type TenantQuota struct {
+	// Going over Soft is allowed, but warned about.
+	Soft uint64 `json:"soft"`
+	// Hard can't be gone over by creating volumes. A tenant that is over it
+	// anyway, because it was lowered, can't write to its volumes until it
+	// deletes enough of them.
+	Hard uint64 `json:"hard"`
+}
+
+// TenantMetadataService is implemented by metadata services that can assign
+// volumes to tenants and keep their quotas.
+type TenantMetadataService interface {
+	// GetVolumeTenants returns the tenant of every volume that has one.
+	GetVolumeTenants() (map[VolumeID]string, error)
+	SetVolumeTenant(vid VolumeID, tenant string) error
+
+	GetTenantQuotas() (map[string]TenantQuota, error)
+	SetTenantQuota(tenant string, q TenantQuota) error
+}
+
+// TenantUsage is how much of its quota a tenant uses.
+type TenantUsage struct {
+	Tenant      string
+	Quota       TenantQuota
+	Volumes     int
+	Provisioned uint64
+}
+
+func (u *TenantUsage) OverSoft() bool { return u.Quota.Soft != 0 && u.Provisioned > u.Quota.Soft }
+func (u *TenantUsage) OverHard() bool { return u.Quota.Hard != 0 && u.Provisioned > u.Quota.Hard }
+
+func ValidTenantName(tenant string) error {
+	if tenant == "" || strings.ContainsAny(tenant, "/ ") {
+		return errors.New("tenant names must be non-empty and contain no slashes or spaces")
+	}
+	return nil
+}
+
+// GetTenantUsage returns the usage of every tenant with a volume or a quota.
+func GetTenantUsage(mds MetadataService) (map[string]*TenantUsage, error) {
+	if _, ok := mds.(TenantMetadataService); !ok {
+		return nil, ErrNotSupported
+	}
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		return nil, err
+	}
+	return tenantUsageOf(mds, vols)
+}
+
+func tenantUsageOf(mds MetadataService, vols []*models.Volume) (map[string]*TenantUsage, error) {
+	tmds, ok := mds.(TenantMetadataService)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	tenants, err := tmds.GetVolumeTenants()
+	if err != nil {
+		return nil, err
+	}
+	quotas, err := tmds.GetTenantQuotas()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*TenantUsage)
+	get := func(tenant string) *TenantUsage {
+		u, ok := out[tenant]
+		if !ok {
+			u = &TenantUsage{Tenant: tenant, Quota: quotas[tenant]}
+			out[tenant] = u
+		}
+		return u
+	}
+	for tenant := range quotas {
+		get(tenant)
+	}
+	for _, v := range vols {
+		tenant, ok := tenants[VolumeID(v.Id)]
+		if !ok {
+			continue
+		}
+		u := get(tenant)
+		u.Volumes++
+		u.Provisioned += v.MaxBytes
+	}
+	return out, nil
+}
+
+// CheckTenantQuota returns ErrQuotaExceeded if provisioning size more bytes
+// would take tenant over its hard quota. It returns whether the tenant would
+// be over its soft quota.
+func CheckTenantQuota(mds MetadataService, tenant string, size uint64) (soft bool, err error) {
+	vols, _, err := mds.GetVolumes()
+	if err != nil {
+		return false, err
+	}
+	return CheckTenantQuotaOf(mds, vols, tenant, size)
+}
+
+// CheckTenantQuotaOf is CheckTenantQuota, counting vols as every volume of
+// the cluster, such as those read in a transaction, rather than those mds
+// lists.
+func CheckTenantQuotaOf(mds MetadataService, vols []*models.Volume, tenant string, size uint64) (soft bool, err error) {
+	usage, err := tenantUsageOf(mds, vols)
+	if err != nil {
+		return false, err
+	}
+	u, ok := usage[tenant]
+	if !ok {
+		return false, nil
+	}
+	after := *u
+	after.Provisioned += size
+	if after.OverHard() {
+		return false, ErrQuotaExceeded
+	}
+	if after.OverSoft() {
+		clog.Warningf("tenant %s is over its soft quota: %d of %d bytes provisioned", tenant, after.Provisioned, after.Quota.Soft)
+		return true, nil
+	}
+	return false, nil
+}
+
+type tenantQuotaCheck struct {
+	err     error
+	checked time.Time
+}
+
+// tenantQuotas caches whether each volume's tenant is over its hard quota,
+// so that writes don't ask the MDS every time.
+type tenantQuotas struct {
+	mut    sync.Mutex
+	checks map[VolumeID]tenantQuotaCheck
+}
+
+// checkTenantWrite returns ErrQuotaExceeded if the volume's tenant is over
+// its hard quota.
+func (s *Server) checkTenantWrite(vid VolumeID) error {
+	tmds, ok := s.MDS.(TenantMetadataService)
+	if !ok {
+		return nil
+	}
+	s.quotas.mut.Lock()
+	defer s.quotas.mut.Unlock()
+	if c, ok := s.quotas.checks[vid]; ok && time.Since(c.checked) < tenantQuotaTTL {
+		return c.err
+	}
+	if s.quotas.checks == nil {
+		s.quotas.checks = make(map[VolumeID]tenantQuotaCheck)
+	}
+	c := tenantQuotaCheck{checked: time.Now()}
+	tenants, err := tmds.GetVolumeTenants()
+	if err != nil {
+		// Don't stop writes because the MDS is having trouble.
+		clog.Errorf("couldn't check tenant quota for volume %d: %v", vid, err)
+		return nil
+	}
+	if tenant, ok := tenants[vid]; ok {
+		usage, err := GetTenantUsage(s.MDS)
+		if err != nil {
+			clog.Errorf("couldn't check tenant quota for volume %d: %v", vid, err)
+			return nil
+		}
+		if u := usage[tenant]; u != nil && u.OverHard() {
+			c.err = ErrQuotaExceeded
+		}
+	}
+	s.quotas.checks[vid] = c
+	return c.err
+}
@@ -0,0 +1,93 @@
+package torus
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+)
+
+// TierPolicy is which tier a volume's blocks are kept on, on peers that
+// have both fast devices, such as SSDs, and slow ones.
+type TierPolicy int
+
+const (
+	// TierAuto writes blocks to the slow tier and moves them to the fast
+	// one while they're read or written often, and back once they aren't.
+	TierAuto TierPolicy = iota
+	// TierFast keeps every block on the fast tier, while it has room.
+	TierFast
+	// TierSlow keeps every block on the slow tier.
+	TierSlow
+)
+
+var errTierPolicy = errors.New("invalid tiering policy; use one of 'auto', 'fast' or 'slow'")
+
+func ParseTierPolicy(s string) (TierPolicy, error) {
+	switch s {
+	case "auto":
+		return TierAuto, nil
+	case "fast":
+		return TierFast, nil
+	case "slow":
+		return TierSlow, nil
+	}
+	return TierAuto, errTierPolicy
+}
+
+func (p TierPolicy) String() string {
+	switch p {
+	case TierFast:
+		return "fast"
+	case TierSlow:
+		return "slow"
+	}
+	return "auto"
+}
+
+// TieringMetadataService is implemented by metadata services that can store
+// a tiering policy per volume.
+type TieringMetadataService interface {
+	// GetTiering returns the volume's policy, which is TierAuto if none was
+	// ever set.
+	GetTiering(vid VolumeID) (TierPolicy, error)
+	SetTiering(vid VolumeID, p TierPolicy) error
+}
+
+// BlockTierer is implemented by block stores that keep blocks on fast and
+// slow devices, and move them between the two.
+type BlockTierer interface {
+	// SetTierPolicy sets the function the store asks for a volume's
+	// policy. It may be called on every write, and without the store's
+	// locks held.
+	SetTierPolicy(f func(vid VolumeID) TierPolicy)
+	// Retier moves up to n blocks to the tier they belong on, given how
+	// often they were used since it was last called.
+	Retier(ctx context.Context, n int) (promoted, demoted int, err error)
+}
+
+var (
+	promTierPromoted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_tier_promoted_blocks_total",
+		Help: "Number of blocks moved from slow devices to fast ones",
+	})
+	promTierDemoted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_tier_demoted_blocks_total",
+		Help: "Number of blocks moved from fast devices to slow ones",
+	})
+	promTierMovesFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "torus_tier_failed_moves_total",
+		Help: "Number of blocks that couldn't be moved between tiers",
+	})
+	promTierFastUsed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "torus_tier_fast_used_ratio",
+		Help: "Fraction of the fast devices in use",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promTierPromoted)
+	prometheus.MustRegister(promTierDemoted)
+	prometheus.MustRegister(promTierMovesFailed)
+	prometheus.MustRegister(promTierFastUsed)
+}
@@ -0,0 +1,35 @@
+package torus
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+)
+
+// Block I/O is traced with OpenTelemetry. Spans are only recorded if the
+// process installs a tracer provider, as torusd and torusblk do when given
+// --trace-endpoint; otherwise they cost next to nothing.
+
+const tracerName = "github.com/coreos/torus"
+
+// Span attributes.
+var (
+	AttrBlock = attribute.Key("torus.block")
+	AttrPeer  = attribute.Key("torus.peer")
+)
+
+// StartSpan starts a span as a child of the one in ctx, if any.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan ends span, marking it as failed if err isn't nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
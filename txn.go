@@ -0,0 +1,78 @@
+package torus
+
+// MaxTxnOps is the most compares and changes, together, that a transaction
+// may have. Consul allows 64 operations in a transaction; etcd allows 128 by
+// default.
+const MaxTxnOps = 64
+
+// MetadataKV is a key of the metadata service with its value. Keys are paths
+// under where torus keeps its metadata, such as "volumes/NAME", laid out as
+// the etcd and Consul backends store them.
+//
+// Version is zero if the key doesn't exist, and otherwise changes every time
+// the key is set. A key that is deleted and set again doesn't get back its
+// old version.
+type MetadataKV struct {
+	Key     string
+	Value   []byte
+	Version int64
+}
+
+// MetadataOp is a change made by a transaction: setting Key to Value, or,
+// if Delete is set, deleting it.
+type MetadataOp struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// TxnMetadataService is implemented by metadata services that can read and
+// change several keys at once.
+type TxnMetadataService interface {
+	// GetKeys returns each of the keys, in order, with a version of zero
+	// for those that don't exist.
+	GetKeys(keys ...string) ([]MetadataKV, error)
+	// ListKeys returns every key under prefix, in order.
+	ListKeys(prefix string) ([]MetadataKV, error)
+	// Txn makes every change in ops, all at once, if each key in cmps still
+	// has the version it's given there, and none of them otherwise. It
+	// returns whether it did.
+	Txn(cmps []MetadataKV, ops []MetadataOp) (bool, error)
+}
+
+// AtomicUpdateFunc returns the changes to make to the metadata service,
+// given the current values of the keys passed to AtomicUpdate. It may be
+// called several times, and should have no side effects that can't be
+// repeated.
+type AtomicUpdateFunc func(kvs []MetadataKV) ([]MetadataOp, error)
+
+// AtomicUpdate reads keys, and makes the changes f returns for them, as long
+// as none of the keys changed in between. If one did, it tries again with the
+// new values. An error from f is returned as it is, with nothing changed.
+func AtomicUpdate(mds MetadataService, keys []string, f AtomicUpdateFunc) error {
+	tmds, ok := mds.(TxnMetadataService)
+	if !ok {
+		return ErrNotSupported
+	}
+	for {
+		kvs, err := tmds.GetKeys(keys...)
+		if err != nil {
+			return err
+		}
+		ops, err := f(kvs)
+		if err != nil {
+			return err
+		}
+		if len(kvs)+len(ops) > MaxTxnOps {
+			return ErrInvalid
+		}
+		ok, err := tmds.Txn(kvs, ops)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		clog.Debugf("keys %v changed during an atomic update, trying again", keys)
+	}
+}
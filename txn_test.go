@@ -0,0 +1,99 @@
+package torus_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+)
+
+// txnMDS keeps keys in a map, and lets a test change them between an
+// AtomicUpdate's read and its transaction.
+type txnMDS struct {
+	torus.MetadataService
+	kvs     map[string]torus.MetadataKV
+	version int64
+	racer   func()
+}
+
+func (m *txnMDS) GetKeys(keys ...string) ([]torus.MetadataKV, error) {
+	out := make([]torus.MetadataKV, len(keys))
+	for i, k := range keys {
+		out[i] = m.kvs[k]
+		out[i].Key = k
+	}
+	return out, nil
+}
+
+func (m *txnMDS) ListKeys(prefix string) ([]torus.MetadataKV, error) {
+	var keys []string
+	for k := range m.kvs {
+		if strings.HasPrefix(k, prefix+"/") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := make([]torus.MetadataKV, len(keys))
+	for i, k := range keys {
+		out[i] = m.kvs[k]
+	}
+	return out, nil
+}
+
+func (m *txnMDS) Txn(cmps []torus.MetadataKV, ops []torus.MetadataOp) (bool, error) {
+	if m.racer != nil {
+		m.racer()
+		m.racer = nil
+	}
+	for _, c := range cmps {
+		if m.kvs[c.Key].Version != c.Version {
+			return false, nil
+		}
+	}
+	for _, op := range ops {
+		m.set(op.Key, op.Value)
+	}
+	return true, nil
+}
+
+func (m *txnMDS) set(k string, v []byte) {
+	m.version++
+	m.kvs[k] = torus.MetadataKV{Key: k, Value: v, Version: m.version}
+}
+
+func TestAtomicUpdate(t *testing.T) {
+	m := &txnMDS{kvs: make(map[string]torus.MetadataKV)}
+	m.set("a", []byte("1"))
+	m.racer = func() { m.set("b", []byte("raced")) }
+	calls := 0
+	err := torus.AtomicUpdate(m, []string{"a", "b"}, func(kvs []torus.MetadataKV) ([]torus.MetadataOp, error) {
+		calls++
+		return []torus.MetadataOp{
+			{Key: "a", Value: append([]byte("b was "), kvs[1].Value...)},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected a retry after the race, got %d calls", calls)
+	}
+	if string(m.kvs["a"].Value) != "b was raced" {
+		t.Fatalf("update used stale values: %q", m.kvs["a"].Value)
+	}
+
+	stop := errors.New("stop")
+	err = torus.AtomicUpdate(m, []string{"a"}, func(kvs []torus.MetadataKV) ([]torus.MetadataOp, error) {
+		return []torus.MetadataOp{{Key: "a", Delete: true}}, stop
+	})
+	if err != stop || m.kvs["a"].Version == 0 {
+		t.Fatalf("expected the func's error and no changes, got %v", err)
+	}
+
+	if err := torus.AtomicUpdate(temp.NewClient(torus.Config{}, temp.NewServer()), nil, nil); err != torus.ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported without transactions, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package torus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/torus/models"
+)
+
+// VolumeEditMetadataService is implemented by metadata services that can
+// rename and resize volumes.
+type VolumeEditMetadataService interface {
+	// RenameVolume renames the volume named from to to. It fails with
+	// ErrExists if another volume is named to.
+	RenameVolume(from, to string) error
+	// ResizeVolume sets how many bytes the volume named name holds.
+	ResizeVolume(name string, size uint64) error
+}
+
+// TagMetadataService is implemented by metadata services that can tag
+// volumes with key=value pairs, such as owner=alice.
+type TagMetadataService interface {
+	// GetVolumeTags returns the tags of every volume that has any.
+	GetVolumeTags() (map[VolumeID]map[string]string, error)
+	// SetVolumeTag sets a tag of the volume, or removes it if value is
+	// empty.
+	SetVolumeTag(vid VolumeID, key, value string) error
+}
+
+func validVolumeName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/ ") {
+		return errors.New("volume names must be non-empty and contain no slashes or spaces")
+	}
+	return nil
+}
+
+func ValidTagKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "/= ") {
+		return errors.New("tag keys must be non-empty and contain no slashes, spaces or '='")
+	}
+	return nil
+}
+
+// ParseTags parses tags given as KEY=VALUE. With keysOnly, they may also be
+// given as just KEY, to match or remove a tag whatever its value; such keys
+// map to the empty string.
+func ParseTags(args []string, keysOnly bool) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) == 1 && !keysOnly {
+			return nil, fmt.Errorf("tag %q isn't KEY=VALUE", arg)
+		}
+		if err := ValidTagKey(parts[0]); err != nil {
+			return nil, err
+		}
+		if len(parts) == 2 {
+			if parts[1] == "" {
+				return nil, fmt.Errorf("tag %q has an empty value", arg)
+			}
+			out[parts[0]] = parts[1]
+		} else {
+			out[parts[0]] = ""
+		}
+	}
+	return out, nil
+}
+
+// MatchTags reports whether tags has every tag in filter. A tag in filter
+// with an empty value matches any value.
+func MatchTags(tags, filter map[string]string) bool {
+	for k, v := range filter {
+		have, ok := tags[k]
+		if !ok || (v != "" && have != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatTags returns tags as KEY=VALUE pairs, sorted and separated by commas.
+func FormatTags(tags map[string]string) string {
+	var out []string
+	for k, v := range tags {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
+
+// RenameVolume renames the volume named from to to. Servers that have the
+// volume open keep using it; it's opened by its new name from then on.
+func RenameVolume(mds MetadataService, from, to string) error {
+	emds, ok := mds.(VolumeEditMetadataService)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := validVolumeName(to); err != nil {
+		return err
+	}
+	return emds.RenameVolume(from, to)
+}
+
+// ResizeVolume sets the size of the volume named name. Growing a volume
+// counts against its quota, the cluster's capacity reserve and, if it
+// belongs to a tenant, the tenant's quota, as creating one would; it returns
+// whether the tenant is now over its soft quota. Where the metadata service
+// has transactions, the tenant's quota is checked in the same one as the
+// resize.
+func ResizeVolume(mds MetadataService, name string, size uint64) (soft bool, err error) {
+	emds, ok := mds.(VolumeEditMetadataService)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	vol, err := mds.GetVolume(name)
+	if err != nil {
+		return false, err
+	}
+	if size == 0 || size > vol.MaxBytes {
+		if err := CheckVolumeQuota(mds, VolumeID(vol.Id), size); err != nil {
+			return false, err
+		}
+	}
+	if size > vol.MaxBytes {
+		if err := CheckVolumeCapacity(mds, VolumeID(vol.Id), size-vol.MaxBytes); err != nil {
+			return false, err
+		}
+	}
+	if tmds, ok := mds.(TenantMetadataService); ok && size > vol.MaxBytes {
+		tenants, err := tmds.GetVolumeTenants()
+		if err != nil {
+			return false, err
+		}
+		if tenant, ok := tenants[VolumeID(vol.Id)]; ok {
+			if _, ok := mds.(TxnMetadataService); ok {
+				return resizeTenantVolumeTxn(mds, vol, tenant, size)
+			}
+			soft, err = CheckTenantQuota(mds, tenant, size-vol.MaxBytes)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return soft, emds.ResizeVolume(name, size)
+}
+
+// resizeTenantVolumeTxn resizes vol and checks its tenant's quota in one
+// transaction, bumping the tenant's generation key as creating a volume for
+// it does, so that volumes of the tenant grown or created at the same time
+// can't together take it over its hard quota.
+func resizeTenantVolumeTxn(mds MetadataService, vol *models.Volume, tenant string, size uint64) (soft bool, err error) {
+	tmds := mds.(TxnMetadataService)
+	volKey := path.Join("volumeid", fmt.Sprintf("%x", vol.Id))
+	genKey := path.Join("tenant-gen", tenant)
+	err = AtomicUpdate(mds, []string{volKey, genKey}, func(kvs []MetadataKV) ([]MetadataOp, error) {
+		if kvs[0].Version == 0 {
+			return nil, ErrNotExist
+		}
+		resized := &models.Volume{}
+		err := resized.Unmarshal(kvs[0].Value)
+		if err != nil {
+			return nil, err
+		}
+		vkvs, err := tmds.ListKeys("volumeid")
+		if err != nil {
+			return nil, err
+		}
+		vols := make([]*models.Volume, len(vkvs))
+		for i, kv := range vkvs {
+			vols[i] = &models.Volume{}
+			err := vols[i].Unmarshal(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		soft = false
+		if size > resized.MaxBytes {
+			soft, err = CheckTenantQuotaOf(mds, vols, tenant, size-resized.MaxBytes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		resized.MaxBytes = size
+		b, err := resized.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		var gen uint64
+		if kvs[1].Version != 0 {
+			gen = binary.LittleEndian.Uint64(kvs[1].Value)
+		}
+		genb := make([]byte, 8)
+		binary.LittleEndian.PutUint64(genb, gen+1)
+		return []MetadataOp{
+			{Key: volKey, Value: b},
+			{Key: genKey, Value: genb},
+		}, nil
+	})
+	return soft, err
+}
+
+// SetVolumeTags sets tags of the volume named name, removing those with an
+// empty value.
+func SetVolumeTags(mds MetadataService, name string, tags map[string]string) error {
+	tmds, ok := mds.(TagMetadataService)
+	if !ok {
+		return ErrNotSupported
+	}
+	vol, err := mds.GetVolume(name)
+	if err != nil {
+		return err
+	}
+	for k, v := range tags {
+		if err := ValidTagKey(k); err != nil {
+			return err
+		}
+		err = tmds.SetVolumeTag(VolumeID(vol.Id), k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
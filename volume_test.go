@@ -0,0 +1,144 @@
+package torus_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/coreos/torus"
+	"github.com/coreos/torus/metadata/temp"
+	"github.com/coreos/torus/models"
+)
+
+func TestRenameResizeAndTagVolume(t *testing.T) {
+	mds := temp.NewClient(torus.Config{}, temp.NewServer())
+	mds.CreateVolume(&models.Volume{Name: "a", Id: 1, Type: "block", MaxBytes: 100})
+	mds.CreateVolume(&models.Volume{Name: "b", Id: 2, Type: "block", MaxBytes: 100})
+
+	if err := torus.RenameVolume(mds, "a", "b"); err != torus.ErrExists {
+		t.Fatalf("expected ErrExists renaming onto another volume, got %v", err)
+	}
+	if err := torus.RenameVolume(mds, "a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mds.GetVolume("a"); err != torus.ErrNotExist {
+		t.Fatalf("old name still exists: %v", err)
+	}
+	if _, err := torus.ResizeVolume(mds, "c", 200); err != nil {
+		t.Fatal(err)
+	}
+	vol, err := mds.GetVolume("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.Name != "c" || vol.Id != 1 || vol.MaxBytes != 200 {
+		t.Fatalf("unexpected volume after rename and resize: %+v", vol)
+	}
+
+	tags, err := torus.ParseTags([]string{"owner=alice", "env=prod"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := torus.SetVolumeTags(mds, "c", tags); err != nil {
+		t.Fatal(err)
+	}
+	if err := torus.SetVolumeTags(mds, "c", map[string]string{"env": ""}); err != nil {
+		t.Fatal(err)
+	}
+	all, err := mds.GetVolumeTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := torus.FormatTags(all[1]); got != "owner=alice" {
+		t.Fatalf("unexpected tags %q", got)
+	}
+	for _, c := range []struct {
+		filter []string
+		match  bool
+	}{
+		{nil, true},
+		{[]string{"owner"}, true},
+		{[]string{"owner=alice"}, true},
+		{[]string{"owner=bob"}, false},
+		{[]string{"owner", "env"}, false},
+	} {
+		filter, err := torus.ParseTags(c.filter, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if torus.MatchTags(all[1], filter) != c.match {
+			t.Errorf("filter %v: expected match %v", c.filter, c.match)
+		}
+	}
+	if _, err := torus.ParseTags([]string{"owner"}, false); err == nil {
+		t.Error("expected a tag without a value to be refused")
+	}
+}
+
+// tenantTxnMDS is a temp client that also keeps volumes as keys, for
+// ResizeVolume to change in a transaction.
+type tenantTxnMDS struct {
+	*temp.Client
+	*txnMDS
+}
+
+func (m *tenantTxnMDS) volume(t *testing.T, key string) *models.Volume {
+	vol := &models.Volume{}
+	if err := vol.Unmarshal(m.kvs[key].Value); err != nil {
+		t.Fatal(err)
+	}
+	return vol
+}
+
+func (m *tenantTxnMDS) resize(t *testing.T, key string, size uint64) {
+	vol := m.volume(t, key)
+	vol.MaxBytes = size
+	b, err := vol.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.set(key, b)
+}
+
+func TestResizeTenantVolume(t *testing.T) {
+	m := &tenantTxnMDS{
+		Client: temp.NewClient(torus.Config{}, temp.NewServer()),
+		txnMDS: &txnMDS{kvs: make(map[string]torus.MetadataKV)},
+	}
+	for _, vol := range []*models.Volume{
+		{Name: "a", Id: 1, Type: "block", MaxBytes: 100},
+		{Name: "b", Id: 2, Type: "block", MaxBytes: 100},
+	} {
+		m.CreateVolume(vol)
+		m.SetVolumeTenant(torus.VolumeID(vol.Id), "t")
+		b, err := vol.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.set(fmt.Sprintf("volumeid/%x", vol.Id), b)
+	}
+	m.SetTenantQuota("t", torus.TenantQuota{Hard: 300})
+
+	// b is grown at the same time, which a on its own would have fit.
+	m.racer = func() {
+		m.resize(t, "volumeid/2", 150)
+		gen := make([]byte, 8)
+		binary.LittleEndian.PutUint64(gen, 1)
+		m.set("tenant-gen/t", gen)
+	}
+	if _, err := torus.ResizeVolume(m, "a", 160); err != torus.ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded growing past the quota with another volume, got %v", err)
+	}
+	if got := m.volume(t, "volumeid/1").MaxBytes; got != 100 {
+		t.Fatalf("expected a to keep its size, got %d", got)
+	}
+	if _, err := torus.ResizeVolume(m, "a", 140); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.volume(t, "volumeid/1").MaxBytes; got != 140 {
+		t.Fatalf("expected a to be resized to 140, got %d", got)
+	}
+	if gen := binary.LittleEndian.Uint64(m.kvs["tenant-gen/t"].Value); gen != 2 {
+		t.Fatalf("expected the resize to bump the tenant's generation to 2, got %d", gen)
+	}
+}